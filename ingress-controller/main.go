@@ -13,6 +13,7 @@ import (
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -72,13 +73,31 @@ func (sic *SetagayaIngressController) findCollectionIDFromPath(path string) stri
 	return items[2]
 }
 
+// getPlanEnginesCount returns the number of engines of the plan, which run as a statefulset or as a job when they
+// run the plan once
 func (sic *SetagayaIngressController) getPlanEnginesCount(projectID, collectionID, planID string) (int, error) {
 	planName := fmt.Sprintf("engine-%s-%s-%s", projectID, collectionID, planID)
 	resp, err := sic.client.AppsV1().StatefulSets(sic.namespace).Get(context.TODO(), planName, metav1.GetOptions{})
+	if err == nil {
+		return int(*resp.Spec.Replicas), nil
+	}
+	if !errors.IsNotFound(err) {
+		return 0, err
+	}
+	job, err := sic.client.BatchV1().Jobs(sic.namespace).Get(context.TODO(), planName, metav1.GetOptions{})
 	if err != nil {
 		return 0, err
 	}
-	return int(*resp.Spec.Replicas), nil
+	return int(*job.Spec.Completions), nil
+}
+
+// engineName is the path of the engine of the endpoint. The pods of the jobs are named after the job, their
+// index and a random suffix, their hostname is the name of the engine.
+func engineName(e apiv1.EndpointAddress) string {
+	if e.Hostname != "" {
+		return e.Hostname
+	}
+	return e.TargetRef.Name
 }
 
 func (sic *SetagayaIngressController) updateInventory(inventoryByCollection map[string][]EngineEndPoint) {
@@ -162,9 +181,8 @@ func (sic *SetagayaIngressController) makeInventory() {
 			}
 			port := ports[0].Port
 			for _, e := range engineEndpoints {
-				podName := e.TargetRef.Name
 				inventoryByCollection[collectionID] = append(inventoryByCollection[collectionID], EngineEndPoint{
-					path: podName,
+					path: engineName(e),
 					addr: fmt.Sprintf("%s:%d", e.IP, port),
 				})
 			}
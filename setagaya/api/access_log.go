@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+type accessLogKeyType struct{}
+
+var accessLogKey = accessLogKeyType{}
+
+// The fields of the forms and the keys of the json bodies which are never logged. value is the one of the secrets of
+// the plans
+var redactedFields = []string{"password", "secret", "token", "value"}
+
+func isRedactedField(field string) bool {
+	field = strings.ToLower(field)
+	for _, redacted := range redactedFields {
+		if strings.Contains(field, redacted) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLogEntry is filled along the handling of a request: the route by the router and the user by authRequired
+type accessLogEntry struct {
+	route string
+	user  string
+}
+
+// cappedBuffer keeps the first bytes written to it, up to its size
+type cappedBuffer struct {
+	bytes.Buffer
+	size      int
+	truncated bool
+}
+
+func (cb *cappedBuffer) Write(b []byte) (int, error) {
+	if room := cb.size - cb.Len(); room < len(b) {
+		cb.truncated = true
+		if room > 0 {
+			cb.Buffer.Write(b[:room])
+		}
+		return len(b), nil
+	}
+	return cb.Buffer.Write(b)
+}
+
+func (cb *cappedBuffer) String() string {
+	if cb.truncated {
+		return cb.Buffer.String() + "..."
+	}
+	return cb.Buffer.String()
+}
+
+// accessLogWriter records the status and the size of the response, and its beginning when the bodies are logged
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+	body   *cappedBuffer
+}
+
+func (aw *accessLogWriter) WriteHeader(status int) {
+	if aw.status == 0 {
+		aw.status = status
+	}
+	aw.ResponseWriter.WriteHeader(status)
+}
+
+func (aw *accessLogWriter) Write(b []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	if aw.body != nil {
+		aw.body.Write(b)
+	}
+	n, err := aw.ResponseWriter.Write(b)
+	aw.size += n
+	return n, err
+}
+
+// Flush keeps the metrics streams working through the access log
+func (aw *accessLogWriter) Flush() {
+	if f, ok := aw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (aw *accessLogWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
+
+func (aw *accessLogWriter) statusCode() int {
+	if aw.status == 0 {
+		return http.StatusOK
+	}
+	return aw.status
+}
+
+// teeReadCloser copies the request body to the access log as the handler reads it
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type accessLogger struct {
+	conf   *config.AccessLogConfig
+	logger *log.Logger
+	// random returns a number in [0, 1) deciding whether a successful request is sampled
+	random func() float64
+}
+
+// AccessLog logs every request handled by the handler, with its route, user, status and latency, when the access
+// log is enabled. The routes are known when their handlers are wrapped with LogRoute.
+func AccessLog(next http.Handler) http.Handler {
+	conf := config.SC.AccessLog
+	if conf == nil || !conf.Enabled {
+		return next
+	}
+	al := &accessLogger{conf: conf, logger: log.StandardLogger(), random: rand.Float64}
+	return al.handler(next)
+}
+
+// LogRoute gives the template of the route, like /api/collections/:collection_id, to the access log
+func LogRoute(route string, next httprouter.Handle) httprouter.Handle {
+	return httprouter.Handle(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if entry, ok := r.Context().Value(accessLogKey).(*accessLogEntry); ok {
+			entry.route = route
+		}
+		next(w, r, params)
+	})
+}
+
+func setAccessLogUser(r *http.Request, user string) {
+	if entry, ok := r.Context().Value(accessLogKey).(*accessLogEntry); ok {
+		entry.user = user
+	}
+}
+
+func (al *accessLogger) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := new(accessLogEntry)
+		aw := &accessLogWriter{ResponseWriter: w}
+		var reqBody *cappedBuffer
+		if al.conf.LogFailedBodies {
+			aw.body = &cappedBuffer{size: al.conf.MaxBodySize}
+			if r.Body != nil && r.Body != http.NoBody {
+				reqBody = &cappedBuffer{size: al.conf.MaxBodySize}
+				r.Body = teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+			}
+		}
+		next.ServeHTTP(aw, r.WithContext(context.WithValue(r.Context(), accessLogKey, entry)))
+
+		status := aw.statusCode()
+		failed := status >= http.StatusBadRequest
+		if !failed && al.random() >= al.conf.Rate() {
+			return
+		}
+		route := entry.route
+		if route == "" {
+			route = "unmatched"
+		}
+		fields := log.Fields{
+			"method":     r.Method,
+			"route":      route,
+			"path":       r.URL.Path,
+			"status":     status,
+			"latency_ms": time.Since(start).Milliseconds(),
+			"size":       aw.size,
+			"user":       entry.user,
+			"remote":     r.RemoteAddr,
+		}
+		if failed && al.conf.LogFailedBodies {
+			if reqBody != nil {
+				fields["request_body"] = requestBodyForLog(r.Header.Get("Content-Type"), reqBody)
+			}
+			fields["response_body"] = aw.body.String()
+		}
+		al.logger.WithFields(fields).Info("access")
+	})
+}
+
+// requestBodyForLog returns the body as it can be logged. The files uploaded are left out and the secrets of the
+// forms, like the password of the login, are redacted.
+func requestBodyForLog(contentType string, body *cappedBuffer) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		return "[multipart body]"
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(body.Buffer.String())
+		if err != nil {
+			return "[unparsable form]"
+		}
+		for field := range form {
+			if isRedactedField(field) {
+				form.Set(field, "[redacted]")
+			}
+		}
+		if body.truncated {
+			return form.Encode() + "..."
+		}
+		return form.Encode()
+	}
+	trimmed := bytes.TrimSpace(body.Buffer.Bytes())
+	if mediaType == "application/json" || bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")) {
+		// A json body cut at the size of the buffer cannot be redacted, it's left out
+		var v interface{}
+		if body.truncated || json.Unmarshal(trimmed, &v) != nil {
+			return "[unparsable json body]"
+		}
+		redacted, err := json.Marshal(redactJSON(v))
+		if err != nil {
+			return "[unparsable json body]"
+		}
+		return string(redacted)
+	}
+	return body.String()
+}
+
+// redactJSON redacts the values of the redacted keys, at any depth
+func redactJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, value := range t {
+			if isRedactedField(k) {
+				t[k] = "[redacted]"
+			} else {
+				t[k] = redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range t {
+			t[i] = redactJSON(value)
+		}
+	}
+	return v
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func newTestAccessLog(conf *config.AccessLogConfig, sample float64) (http.Handler, *test.Hook) {
+	logger, hook := test.NewNullLogger()
+	al := &accessLogger{conf: conf, logger: logger, random: func() float64 { return sample }}
+	router := httprouter.New()
+	router.POST("/api/collections/:collection_id", LogRoute("/api/collections/:collection_id",
+		func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+			setAccessLogUser(r, "alice")
+			_, _ = io.ReadAll(r.Body)
+			if params.ByName("collection_id") == "0" {
+				http.Error(w, "collection not found", http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}))
+	return al.handler(router), hook
+}
+
+func TestAccessLog(t *testing.T) {
+	half := 0.5
+	handler, hook := newTestAccessLog(&config.AccessLogConfig{SampleRate: &half}, 0.2)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/collections/1", nil))
+	entry := hook.LastEntry()
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, log.InfoLevel, entry.Level)
+		assert.Equal(t, "/api/collections/:collection_id", entry.Data["route"])
+		assert.Equal(t, "/api/collections/1", entry.Data["path"])
+		assert.Equal(t, http.StatusOK, entry.Data["status"])
+		assert.Equal(t, "alice", entry.Data["user"])
+		assert.Equal(t, 2, entry.Data["size"])
+		assert.NotContains(t, entry.Data, "response_body")
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nowhere", nil))
+	assert.Equal(t, "unmatched", hook.LastEntry().Data["route"])
+	assert.Equal(t, http.StatusNotFound, hook.LastEntry().Data["status"])
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	none := 0.0
+	handler, hook := newTestAccessLog(&config.AccessLogConfig{SampleRate: &none}, 0)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/collections/1", nil))
+	assert.Empty(t, hook.AllEntries())
+
+	// The failed requests are always logged
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/collections/0", nil))
+	assert.Len(t, hook.AllEntries(), 1)
+}
+
+func TestAccessLogFailedBodies(t *testing.T) {
+	handler, hook := newTestAccessLog(&config.AccessLogConfig{LogFailedBodies: true, MaxBodySize: 64}, 0)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/collections/1", strings.NewReader("name=ok"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.NotContains(t, hook.LastEntry().Data, "request_body")
+
+	r = httptest.NewRequest(http.MethodPost, "/api/collections/0", strings.NewReader("name=x&password=hunter2"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	entry := hook.LastEntry()
+	assert.Equal(t, "name=x&password=%5Bredacted%5D", entry.Data["request_body"])
+	assert.Equal(t, "collection not found\n", entry.Data["response_body"])
+
+	r = httptest.NewRequest(http.MethodPost, "/api/collections/0", strings.NewReader(strings.Repeat("a", 100)))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, strings.Repeat("a", 64)+"...", hook.LastEntry().Data["request_body"])
+}
+
+func TestRequestBodyForLog(t *testing.T) {
+	body := &cappedBuffer{size: 64}
+	body.WriteString("--boundary")
+	assert.Equal(t, "[multipart body]", requestBodyForLog("multipart/form-data; boundary=boundary", body))
+}
+
+// A secret of a plan which is refused is not logged with the body of the request
+func TestAccessLogPlanSecretBody(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	al := &accessLogger{conf: &config.AccessLogConfig{LogFailedBodies: true, MaxBodySize: 1024}, logger: logger,
+		random: func() float64 { return 0 }}
+	router := httprouter.New()
+	router.PUT("/api/plans/:plan_id/secrets/:name", LogRoute("/api/plans/:plan_id/secrets/:name",
+		func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+			var body struct {
+				Kind  string `json:"kind"`
+				Value string `json:"value"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			secret := &model.PlanSecret{Name: params.ByName("name"), Kind: body.Kind,
+				Value: model.EncryptedString(body.Value)}
+			if err := secret.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+		}))
+	r := httptest.NewRequest(http.MethodPut, "/api/plans/1/secrets/checkout",
+		strings.NewReader(`{"kind": "bogus", "value": "hunter2", "nested": [{"password": "s3cr3t"}]}`))
+	r.Header.Set("Content-Type", "application/json")
+	al.handler(router).ServeHTTP(httptest.NewRecorder(), r)
+	entry := hook.LastEntry()
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, http.StatusBadRequest, entry.Data["status"])
+		body := entry.Data["request_body"].(string)
+		assert.NotContains(t, body, "hunter2")
+		assert.NotContains(t, body, "s3cr3t")
+		assert.Contains(t, body, `"kind":"bogus"`)
+	}
+
+	// A json body cut at the size of the buffer cannot be redacted
+	small := &cappedBuffer{size: 16}
+	_, _ = small.Write([]byte(`{"kind": "webhook_secret", "value": "hunter2"}`))
+	assert.Equal(t, "[unparsable json body]", requestBodyForLog("application/json", small))
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// recordActivity adds the change made by the account to the feed of the project. Failing to do so does not fail
+// the change.
+func recordActivity(r *http.Request, a *model.Activity) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		return
+	}
+	a.Actor = account.Name
+	if err := model.RecordActivity(a); err != nil {
+		log.Printf("Cannot record the %s of %s %d by %s: %v", a.Action, a.TargetKind, a.TargetID, a.Actor, err)
+	}
+}
+
+func recordProjectActivity(r *http.Request, project *model.Project, action, detail string) {
+	recordActivity(r, &model.Activity{ProjectID: project.ID, Action: action, TargetKind: model.UserItemProject,
+		TargetID: project.ID, TargetName: project.Name, Detail: detail})
+}
+
+func recordPlanActivity(r *http.Request, plan *model.Plan, action, detail string) {
+	recordActivity(r, &model.Activity{ProjectID: plan.ProjectID, Action: action, TargetKind: model.UserItemPlan,
+		TargetID: plan.ID, TargetName: plan.Name, Detail: detail})
+}
+
+func recordCollectionActivity(r *http.Request, collection *model.Collection, action, detail string) {
+	recordActivity(r, &model.Activity{ProjectID: collection.ProjectID, Action: action,
+		TargetKind: model.UserItemCollection, TargetID: collection.ID, TargetName: collection.Name, Detail: detail})
+}
+
+func (s *SetagayaAPI) projectActivityGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	qs := r.URL.Query()
+	limit := 50
+	if l := qs.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 500 {
+			s.handleErrors(w, makeInvalidRequestError("limit should be between 1 and 500"))
+			return
+		}
+		limit = n
+	}
+	var before int64
+	if b := qs.Get("before"); b != "" {
+		if before, err = strconv.ParseInt(b, 10, 64); err != nil {
+			s.handleErrors(w, makeInvalidRequestError("before should be the id of an activity"))
+			return
+		}
+	}
+	activity, err := model.GetProjectActivity(project.ID, before, limit)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, activity)
+}
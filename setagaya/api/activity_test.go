@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func withAccount(r *http.Request, name string) *http.Request {
+	account := &model.Account{Name: name, ML: []string{name}, MLMap: map[string]interface{}{name: nil}}
+	return r.WithContext(context.WithValue(r.Context(), accountKey, account))
+}
+
+func getProjectActivity(t *testing.T, s *SetagayaAPI, account string, projectID int64, query string) ([]*model.Activity, int) {
+	url := "/api/projects/" + strconv.FormatInt(projectID, 10) + "/activity" + query
+	r := withAccount(httptest.NewRequest(http.MethodGet, url, nil), account)
+	w := httptest.NewRecorder()
+	s.projectActivityGetHandler(w, r, httprouter.Params{{Key: "project_id", Value: strconv.FormatInt(projectID, 10)}})
+	if w.Code != http.StatusOK {
+		return nil, w.Code
+	}
+	activity := []*model.Activity{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &activity))
+	return activity, w.Code
+}
+
+func TestRecordActivity(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	collection := &model.Collection{ID: 3, ProjectID: 1, Name: "checkout"}
+
+	// The activity is recorded under the name of the account making the change
+	r := withAccount(httptest.NewRequest(http.MethodPost, "/api/collections/3/trigger", nil), "alice")
+	recordCollectionActivity(r, collection, model.ActivityCollectionTriggered, "")
+	// There is nobody to record it for without an account
+	recordCollectionActivity(httptest.NewRequest(http.MethodPost, "/api/collections/3/stop", nil), collection,
+		model.ActivityCollectionStopped, "")
+
+	activity, err := model.GetProjectActivity(1, 0, 50)
+	assert.NoError(t, err)
+	if assert.Len(t, activity, 1) {
+		assert.Equal(t, "alice", activity[0].Actor)
+		assert.Equal(t, model.ActivityCollectionTriggered, activity[0].Action)
+		assert.Equal(t, model.UserItemCollection, activity[0].TargetKind)
+		assert.Equal(t, int64(3), activity[0].TargetID)
+		assert.Equal(t, "checkout", activity[0].TargetName)
+	}
+}
+
+func TestProjectActivityGetHandler(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	s := &SetagayaAPI{}
+	projectID, err := model.CreateProject("shop", "alice", "")
+	assert.NoError(t, err)
+	project := &model.Project{ID: projectID, Name: "shop"}
+	r := withAccount(httptest.NewRequest(http.MethodPut, "/api/projects/1", nil), "alice")
+	for _, detail := range []string{"first", "second", "third"} {
+		recordProjectActivity(r, project, model.ActivityProjectUpdated, detail)
+	}
+
+	// The feed is paged from the latest activity
+	page, code := getProjectActivity(t, s, "alice", projectID, "?limit=2")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, page, 2) {
+		assert.Equal(t, "third", page[0].Detail)
+		assert.Equal(t, "second", page[1].Detail)
+	}
+	next, code := getProjectActivity(t, s, "alice", projectID, "?limit=2&before="+strconv.FormatInt(page[1].ID, 10))
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, next, 1) {
+		assert.Equal(t, "first", next[0].Detail)
+	}
+	all, code := getProjectActivity(t, s, "alice", projectID, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, all, 3)
+
+	for _, query := range []string{"?limit=0", "?limit=501", "?limit=many", "?before=last"} {
+		_, code = getProjectActivity(t, s, "alice", projectID, query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+	// Only the owners of the project see its feed
+	_, code = getProjectActivity(t, s, "mallory", projectID, "")
+	assert.Equal(t, http.StatusForbidden, code)
+	_, code = getProjectActivity(t, s, "alice", projectID+1, "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// collectionHeartbeatHandler keeps the attended-only run in progress of the collection going for another timeout.
+// The UI sends it while the collection is open.
+func (s *SetagayaAPI) collectionHeartbeatHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	runID, err := collection.GetCurrentRun()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if runID == 0 {
+		s.handleErrors(w, makeInvalidRequestError("the collection is not running"))
+		return
+	}
+	rh, err := model.GetRunHeartbeat(runID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if !rh.StoppingTime.IsZero() {
+		s.handleErrors(w, makeInvalidRequestError("the run missed its heartbeat and is stopping"))
+		return
+	}
+	if err := rh.Beat(account.Name, time.Now()); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, rh)
+}
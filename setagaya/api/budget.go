@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// budgetProject returns the project of the request when the account owns it, and can change it unless it reads it
+func budgetProject(r *http.Request, params httprouter.Params) (*model.Project, *model.Account, error) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		return nil, nil, makeInvalidRequestError("account")
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasProjectOwnership(project, account) {
+		return nil, nil, makeProjectOwnershipError()
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		return nil, nil, err
+	}
+	return project, account, nil
+}
+
+func (s *SetagayaAPI) projectBudgetGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	project, _, err := budgetProject(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	status, err := model.GetBudgetStatus(project.ID, time.Now())
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if status == nil {
+		s.handleErrors(w, &model.DBError{Err: errors.New("not found"), Message: "the project has no budget"})
+		return
+	}
+	s.jsonise(w, http.StatusOK, status)
+}
+
+// checkBudgetChange keeps the owners from lifting the budget of the project themselves, exhausted or not: they set a
+// budget and lower it, only the admins raise or remove it
+func checkBudgetChange(account *model.Account, projectID int64, monthlyEngineMinutes int) error {
+	if account.IsAdmin() {
+		return nil
+	}
+	pb, err := model.GetProjectBudget(projectID)
+	if err != nil || pb == nil {
+		return err
+	}
+	if monthlyEngineMinutes == 0 || monthlyEngineMinutes > pb.MonthlyEngineMinutes {
+		return makeNoPermissionErr("Only the admins can raise or remove the budget of the project")
+	}
+	return nil
+}
+
+// projectBudgetSetHandler sets the engine minutes the project can use every month
+func (s *SetagayaAPI) projectBudgetSetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	project, account, err := budgetProject(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	minutes, err := strconv.Atoi(r.Form.Get("monthly_engine_minutes"))
+	if err != nil {
+		s.handleErrors(w, makeInvalidRequestError("monthly_engine_minutes should be a number"))
+		return
+	}
+	pb := &model.ProjectBudget{ProjectID: project.ID, MonthlyEngineMinutes: minutes, UpdatedBy: account.Name}
+	if err := pb.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := checkBudgetChange(account, project.ID, minutes); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := model.SetProjectBudget(pb); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordProjectActivity(r, project, model.ActivityProjectUpdated, fmt.Sprintf("budget of %d engine minutes", minutes))
+	status, err := model.GetBudgetStatus(project.ID, time.Now())
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, status)
+}
+
+func (s *SetagayaAPI) projectBudgetDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	project, account, err := budgetProject(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := checkBudgetChange(account, project.ID, 0); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := model.DeleteProjectBudget(project.ID); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordProjectActivity(r, project, model.ActivityProjectUpdated, "budget removed")
+}
+
+// budgetExtensionHandler adds engine minutes to the budget of the project for the current month
+func (s *SetagayaAPI) budgetExtensionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can extend the budgets"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	minutes, err := strconv.Atoi(r.Form.Get("engine_minutes"))
+	if err != nil {
+		s.handleErrors(w, makeInvalidRequestError("engine_minutes should be a number"))
+		return
+	}
+	now := time.Now()
+	be := &model.BudgetExtension{ProjectID: project.ID, Month: model.BudgetMonth(now), EngineMinutes: minutes,
+		GrantedBy: account.Name, Reason: r.Form.Get("reason")}
+	if err := be.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	pb, err := model.GetProjectBudget(project.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if pb == nil {
+		s.handleErrors(w, makeInvalidRequestError("the project has no budget to extend"))
+		return
+	}
+	if err := model.GrantBudgetExtension(be); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordProjectActivity(r, project, model.ActivityProjectUpdated,
+		fmt.Sprintf("budget of %s extended by %d engine minutes", be.Month, minutes))
+	status, err := model.GetBudgetStatus(project.ID, now)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, status)
+}
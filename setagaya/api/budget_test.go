@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// The owners set a budget and lower it, they cannot raise it or remove it before it's exhausted either
+func TestOwnersCannotLiftTheBudget(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	ac := config.SC.AuthConfig
+	defer func() { config.SC.AuthConfig = ac }()
+	config.SC.AuthConfig = &config.AuthConfig{AdminUsers: []string{"root"}, LdapConfig: &config.LdapConfig{}}
+
+	projectID, err := model.CreateProject("checkout", "perf-team", "")
+	assert.NoError(t, err)
+	params := httprouter.Params{{Key: "project_id", Value: strconv.FormatInt(projectID, 10)}}
+	owner := &model.Account{Name: "bob", MLMap: map[string]interface{}{"perf-team": nil}}
+	admin := &model.Account{Name: "root", ML: []string{"root"}, MLMap: map[string]interface{}{"root": nil}}
+	s := &SetagayaAPI{}
+	set := func(account *model.Account, minutes int) int {
+		form := url.Values{"monthly_engine_minutes": {strconv.Itoa(minutes)}}
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req = req.WithContext(context.WithValue(req.Context(), accountKey, account))
+		rec := httptest.NewRecorder()
+		s.projectBudgetSetHandler(rec, req, params)
+		return rec.Code
+	}
+	remove := func(account *model.Account) int {
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), accountKey, account))
+		rec := httptest.NewRecorder()
+		s.projectBudgetDeleteHandler(rec, req, params)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, set(owner, 6000))
+	assert.Equal(t, http.StatusOK, set(owner, 3000))
+	assert.Equal(t, http.StatusForbidden, set(owner, 9000))
+	assert.Equal(t, http.StatusForbidden, remove(owner))
+	pb, err := model.GetProjectBudget(projectID)
+	assert.NoError(t, err)
+	assert.Equal(t, 3000, pb.MonthlyEngineMinutes)
+
+	assert.Equal(t, http.StatusOK, set(admin, 9000))
+	assert.Equal(t, http.StatusOK, remove(admin))
+	pb, err = model.GetProjectBudget(projectID)
+	assert.NoError(t, err)
+	assert.Nil(t, pb)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/controller"
+)
+
+const icsTimeFormat = "20060102T150405Z"
+
+// parseCalendarRange reads the range of the calendar, the next week by default
+func parseCalendarRange(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	qs := r.URL.Query()
+	from, to := now, time.Time{}
+	if v := qs.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, makeInvalidResourceError("from")
+		}
+		from = t
+	}
+	to = from.Add(controller.DefaultCalendarRange)
+	if v := qs.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, makeInvalidResourceError("to")
+		}
+		to = t
+	}
+	if err := controller.ValidateCalendarRange(from, to); err != nil {
+		return from, to, makeInvalidRequestError(err.Error())
+	}
+	return from, to, nil
+}
+
+// calendarICS renders the entries of the calendar as iCalendar events, for the calendar applications to subscribe to
+func calendarICS(cal *controller.Calendar, now time.Time) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Setagaya//Calendar//EN\r\n")
+	for _, e := range cal.Entries {
+		id := e.RunID
+		summary := fmt.Sprintf("Run of collection %d, %d engines", e.CollectionID, e.Engines)
+		if e.Kind == controller.CalendarEntryReservation {
+			id = e.ReservationID
+			summary = fmt.Sprintf("Reservation of collection %d, %d engines", e.CollectionID, e.Engines)
+		}
+		buf.WriteString("BEGIN:VEVENT\r\n")
+		fmt.Fprintf(&buf, "UID:%s-%d-%d@setagaya\r\n", e.Kind, e.CollectionID, id)
+		fmt.Fprintf(&buf, "DTSTAMP:%s\r\n", now.UTC().Format(icsTimeFormat))
+		fmt.Fprintf(&buf, "DTSTART:%s\r\n", e.StartTime.UTC().Format(icsTimeFormat))
+		fmt.Fprintf(&buf, "DTEND:%s\r\n", e.EndTime.UTC().Format(icsTimeFormat))
+		fmt.Fprintf(&buf, "SUMMARY:%s\r\n", summary)
+		buf.WriteString("END:VEVENT\r\n")
+	}
+	buf.WriteString("END:VCALENDAR\r\n")
+	return buf.Bytes()
+}
+
+// calendarGetHandler lists the runs in progress and the reservations of all the collections, with the engines
+// expected every hour, so the teams can spread their big tests over the shared clusters. With format=ics, the
+// entries are rendered as iCalendar events.
+func (s *SetagayaAPI) calendarGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	now := time.Now()
+	from, to, err := parseCalendarRange(r, now)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	cal, err := s.ctr.Calendar(from, to)
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	if r.URL.Query().Get("format") != "ics" {
+		s.jsonise(w, http.StatusOK, cal)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if _, err := w.Write(calendarICS(cal, now)); err != nil {
+		log.Printf("Error writing calendar response: %v", err)
+	}
+}
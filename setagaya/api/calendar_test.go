@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/controller"
+)
+
+func TestParseCalendarRange(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	from, to, err := parseCalendarRange(httptest.NewRequest(http.MethodGet, "/api/calendar", nil), now)
+	assert.NoError(t, err)
+	assert.Equal(t, now, from)
+	assert.Equal(t, now.Add(controller.DefaultCalendarRange), to)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/calendar?from=2026-10-05T00:00:00Z&to=2026-10-06T00:00:00Z", nil)
+	from, to, err = parseCalendarRange(r, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2026, 10, 6, 0, 0, 0, 0, time.UTC), to)
+
+	for _, qs := range []string{"from=tomorrow", "to=2026-10-01", "to=2026-09-01T00:00:00Z",
+		"from=2026-10-01T00:00:00Z&to=2026-12-01T00:00:00Z"} {
+		_, _, err := parseCalendarRange(httptest.NewRequest(http.MethodGet, "/api/calendar?"+qs, nil), now)
+		assert.Error(t, err, qs)
+	}
+}
+
+func TestCalendarICS(t *testing.T) {
+	start := time.Date(2026, 10, 5, 2, 0, 0, 0, time.UTC)
+	cal := &controller.Calendar{Entries: []*controller.CalendarEntry{
+		{Kind: controller.CalendarEntryReservation, CollectionID: 7, ReservationID: 3, Engines: 20, StartTime: start,
+			EndTime: start.Add(2 * time.Hour)},
+		{Kind: controller.CalendarEntryRun, CollectionID: 8, RunID: 42, Engines: 5, StartTime: start,
+			EndTime: start.Add(time.Hour)},
+	}}
+	ics := string(calendarICS(cal, start))
+	assert.True(t, strings.HasPrefix(ics, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+	assert.Equal(t, 2, strings.Count(ics, "BEGIN:VEVENT"))
+	assert.Contains(t, ics, "UID:reservation-7-3@setagaya\r\n")
+	assert.Contains(t, ics, "UID:run-8-42@setagaya\r\n")
+	assert.Contains(t, ics, "DTSTART:20261005T020000Z\r\nDTEND:20261005T040000Z\r\n")
+	assert.Contains(t, ics, "SUMMARY:Reservation of collection 7, 20 engines\r\n")
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// Version is the version of the API server, set when its image is built with
+// -ldflags "-X github.com/hveda/Setagaya/setagaya/api.Version=v1.2.3"
+var Version = "dev"
+
+// The channels the users are notified through: the inbox of the UI, and the callbacks of the async jobs
+const (
+	NotificationChannelInbox    = "inbox"
+	NotificationChannelCallback = "job_callback"
+)
+
+// SchedulerCapabilities is how the engines are run
+type SchedulerCapabilities struct {
+	// k8s, cloudrun or docker. Empty when the deployment runs no engines
+	Kind string `json:"kind"`
+	// deployment or job
+	ExecutionMode string `json:"execution_mode"`
+	// sse or batch
+	MetricTransport string `json:"metric_transport"`
+	Chaos           bool   `json:"chaos"`
+	NetworkShaping  bool   `json:"network_shaping"`
+}
+
+// StorageCapabilities is where the files are kept
+type StorageCapabilities struct {
+	Provider string `json:"provider"`
+	// Provider of the storage the files are also written to, empty when there is none
+	Secondary string `json:"secondary,omitempty"`
+	// Regions the tenants can keep their files in
+	Regions          []string `json:"regions"`
+	SignedURLs       bool     `json:"signed_urls"`
+	ContentAddressed bool     `json:"content_addressed"`
+}
+
+// Capabilities are the optional subsystems enabled in the deployment and the version of the server, so the clients
+// and the UI can leave out what the deployment does not support rather than fail on it. The features are the ones of
+// the config, the tenants can override them.
+type Capabilities struct {
+	Version string `json:"version"`
+	// Protocol the controller speaks with the agents
+	AgentProtocol        int                    `json:"agent_protocol"`
+	Scheduler            *SchedulerCapabilities `json:"scheduler"`
+	Storage              *StorageCapabilities   `json:"storage"`
+	Engines              []string               `json:"engines"`
+	NotificationChannels []string               `json:"notification_channels"`
+	GraphQL              bool                   `json:"graphql"`
+	SID                  bool                   `json:"sid"`
+	StepUp               bool                   `json:"step_up"`
+	ShareLinks           bool                   `json:"share_links"`
+	Features             map[string]bool        `json:"features"`
+	// What changes in the API: the routes the clients should stop calling
+	Deprecations []*config.Deprecation `json:"deprecations"`
+}
+
+func newCapabilities(sc *config.SetagayaConfig) *Capabilities {
+	c := &Capabilities{
+		Version:              Version,
+		AgentProtocol:        enginesModel.ProtocolVersion,
+		Scheduler:            &SchedulerCapabilities{},
+		Storage:              &StorageCapabilities{Regions: []string{}},
+		Engines:              []string{},
+		NotificationChannels: []string{NotificationChannelInbox},
+		GraphQL:              sc.EnableGraphQL,
+		SID:                  sc.EnableSid,
+		StepUp:               sc.AuthConfig != nil && sc.AuthConfig.StepUp != nil,
+		ShareLinks:           sc.AuthConfig != nil && sc.AuthConfig.ShareLinkKey != "",
+		Features:             map[string]bool{},
+		Deprecations:         []*config.Deprecation{},
+	}
+	if ec := sc.ExecutorConfig; ec != nil && ec.Cluster != nil {
+		c.Scheduler = &SchedulerCapabilities{
+			Kind:            ec.Cluster.Kind,
+			ExecutionMode:   ec.ExecutionMode,
+			MetricTransport: ec.MetricTransport,
+			Chaos:           len(ec.ChaosNamespaces) > 0,
+			NetworkShaping:  ec.NetworkShaper != nil,
+		}
+		c.Engines = append(c.Engines, model.JmeterEngine)
+		if ec.PlaywrightContainer != nil && sc.FeatureFlags.Enabled(config.FeaturePlaywrightEngine) {
+			c.Engines = append(c.Engines, model.PlaywrightEngine)
+		}
+	}
+	if o := sc.ObjectStorage; o != nil {
+		c.Storage.Provider = o.Provider
+		if o.Secondary != nil {
+			c.Storage.Secondary = o.Secondary.Provider
+		}
+		for region := range o.Regions {
+			c.Storage.Regions = append(c.Storage.Regions, region)
+		}
+		sort.Strings(c.Storage.Regions)
+		c.Storage.SignedURLs = o.SignedURLTTL != ""
+		c.Storage.ContentAddressed = o.ContentAddressed
+	}
+	if sc.FeatureFlags.Enabled(config.FeatureAsyncJobs) {
+		c.NotificationChannels = append(c.NotificationChannels, NotificationChannelCallback)
+	}
+	for _, f := range config.KnownFeatures {
+		c.Features[f.Name] = sc.FeatureFlags.Enabled(f.Name)
+	}
+	c.Deprecations = append(c.Deprecations, sc.Deprecations...)
+	return c
+}
+
+// capabilitiesGetHandler tells the clients what the deployment supports
+func (s *SetagayaAPI) capabilitiesGetHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	s.jsonise(w, http.StatusOK, newCapabilities(config.SC))
+}
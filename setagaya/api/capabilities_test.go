@@ -0,0 +1,62 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestNewCapabilities(t *testing.T) {
+	d := &config.Deprecation{Route: "usage_summary_by_sid", Since: "2026-10-01"}
+	sc := &config.SetagayaConfig{
+		EnableGraphQL: true,
+		AuthConfig:    &config.AuthConfig{StepUp: &config.StepUpConfig{Window: 5}},
+		ExecutorConfig: &config.ExecutorConfig{
+			Cluster:             &config.ClusterConfig{Kind: "k8s"},
+			ExecutionMode:       config.ExecutionModeJob,
+			MetricTransport:     config.MetricTransportBatch,
+			PlaywrightContainer: &config.PlaywrightContainer{},
+			ChaosNamespaces:     []string{"checkout"},
+		},
+		ObjectStorage: &config.ObjectStorage{
+			Provider:  "gcp",
+			Secondary: &config.ObjectStorage{Provider: "nexus"},
+			Regions: map[string]*config.ObjectStorage{
+				"us": {Provider: "gcp"}, "eu": {Provider: "gcp"},
+			},
+			SignedURLTTL: "15m",
+		},
+		FeatureFlags: config.FeatureFlags{config.FeatureAsyncJobs: false},
+		Deprecations: []*config.Deprecation{d},
+	}
+	c := newCapabilities(sc)
+	assert.Equal(t, Version, c.Version)
+	assert.Equal(t, &SchedulerCapabilities{Kind: "k8s", ExecutionMode: config.ExecutionModeJob,
+		MetricTransport: config.MetricTransportBatch, Chaos: true}, c.Scheduler)
+	assert.Equal(t, &StorageCapabilities{Provider: "gcp", Secondary: "nexus", Regions: []string{"eu", "us"},
+		SignedURLs: true}, c.Storage)
+	assert.Equal(t, []string{"jmeter", "playwright"}, c.Engines)
+	assert.Equal(t, []string{NotificationChannelInbox}, c.NotificationChannels)
+	assert.True(t, c.GraphQL)
+	assert.True(t, c.StepUp)
+	assert.False(t, c.ShareLinks)
+	assert.False(t, c.Features[config.FeatureAsyncJobs])
+	assert.True(t, c.Features[config.FeaturePlaywrightEngine])
+	assert.Len(t, c.Features, len(config.KnownFeatures))
+	assert.Equal(t, []*config.Deprecation{d}, c.Deprecations)
+
+	// The playwright engines are left out when their flag is off
+	sc.FeatureFlags = config.FeatureFlags{config.FeaturePlaywrightEngine: false}
+	c = newCapabilities(sc)
+	assert.Equal(t, []string{"jmeter"}, c.Engines)
+	assert.Equal(t, []string{NotificationChannelInbox, NotificationChannelCallback}, c.NotificationChannels)
+
+	// A deployment running no engines
+	c = newCapabilities(&config.SetagayaConfig{})
+	assert.Equal(t, &SchedulerCapabilities{}, c.Scheduler)
+	assert.Empty(t, c.Engines)
+	assert.Empty(t, c.Storage.Provider)
+	assert.NotNil(t, c.Deprecations)
+}
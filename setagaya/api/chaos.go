@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func (s *SetagayaAPI) chaosGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	actions, err := collection.GetChaosActions()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, actions)
+}
+
+// chaosSetHandler replaces the chaos actions of the collection, they are taken from its next run. An empty list
+// removes them.
+func (s *SetagayaAPI) chaosSetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	var actions []*model.ChaosAction
+	if err := json.NewDecoder(r.Body).Decode(&actions); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("chaos actions should be a list of actions"))
+		return
+	}
+	if err := model.ValidateChaosActions(actions); err != nil {
+		s.handleErrors(w, wrapInvalidRequestError(err))
+		return
+	}
+	if err := collection.SetChaosActions(actions); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if actions == nil {
+		actions = []*model.ChaosAction{}
+	}
+	s.jsonise(w, http.StatusOK, actions)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// classifiedResponseWriter marks the responses of the admin endpoints, the classified data they carry is recorded
+// in the audit log
+type classifiedResponseWriter struct {
+	http.ResponseWriter
+	r *http.Request
+}
+
+func (cw *classifiedResponseWriter) Flush() {
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *classifiedResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// auditClassifiedReads marks the reads of the admin endpoints. It runs after authRequired, so the admin is known
+func auditClassifiedReads(routes Routes) {
+	for _, route := range routes {
+		if route.Method != http.MethodGet || !strings.HasPrefix(route.Path, "/api/admin/") {
+			continue
+		}
+		next := route.HandlerFunc
+		route.HandlerFunc = func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+			next(&classifiedResponseWriter{ResponseWriter: w, r: r}, r, params)
+		}
+	}
+}
+
+// recordClassifiedRead records the classified fields of the content in the audit log, when it's the response of an
+// admin endpoint. The response is sent even when it cannot be recorded.
+func recordClassifiedRead(w http.ResponseWriter, status int, content interface{}) {
+	if status >= http.StatusMultipleChoices {
+		return
+	}
+	for {
+		switch rw := w.(type) {
+		case *classifiedResponseWriter:
+			classes := model.Classify(content)
+			if len(classes) == 0 {
+				return
+			}
+			actor := anonymousUser
+			if account, ok := rw.r.Context().Value(accountKey).(*model.Account); ok {
+				actor = account.Name
+			}
+			if err := model.RecordClassifiedRead(actor, rw.r.URL.RequestURI(), classes); err != nil {
+				log.Errorf("Cannot record the read of classified data by %s: %v", actor, err)
+			}
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestAuditClassifiedReads(t *testing.T) {
+	marked := map[string]bool{}
+	handler := func(name string) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			_, marked[name] = w.(*classifiedResponseWriter)
+		}
+	}
+	routes := Routes{
+		&Route{"admin_deployments", "GET", "/api/admin/deployments", handler("admin_deployments")},
+		&Route{"admin_create_tenant", "POST", "/api/admin/tenants", handler("admin_create_tenant")},
+		&Route{"get_projects", "GET", "/api/projects", handler("get_projects")},
+	}
+	auditClassifiedReads(routes)
+	for _, route := range routes {
+		route.HandlerFunc(httptest.NewRecorder(), httptest.NewRequest(route.Method, route.Path, nil), nil)
+	}
+	assert.Equal(t, map[string]bool{"admin_deployments": true, "admin_create_tenant": false, "get_projects": false}, marked)
+}
+
+func TestRecordClassifiedReadSkipped(t *testing.T) {
+	// Nothing is recorded, the test would fail without a database otherwise
+	r := httptest.NewRequest("GET", "/api/admin/deployments", nil)
+	w := &classifiedResponseWriter{ResponseWriter: httptest.NewRecorder(), r: r}
+	deployments := []*model.Deployment{{LaunchedBy: "alice"}}
+	recordClassifiedRead(httptest.NewRecorder(), http.StatusOK, deployments)
+	recordClassifiedRead(w, http.StatusForbidden, deployments)
+	recordClassifiedRead(w, http.StatusOK, []*model.Deployment{{CollectionID: 1}})
+	recordClassifiedRead(&problemResponseWriter{ResponseWriter: w}, http.StatusOK, []*model.RunningPlan{})
+}
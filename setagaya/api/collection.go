@@ -2,15 +2,23 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8syaml "sigs.k8s.io/yaml"
 
 	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/scheduler"
+	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
 )
 
 func getCollection(collectionID string) (*model.Collection, error) {
@@ -43,6 +51,10 @@ func (s *SetagayaAPI) collectionConfigGetHandler(w http.ResponseWriter, req *htt
 			return
 		}
 		ep.Name = plan.Name
+		if ep.Regions, err = collection.GetPlanRegions(ep.PlanID); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
 	}
 	e := &model.ExecutionWrapper{
 		Content: &model.ExecutionCollection{
@@ -51,6 +63,9 @@ func (s *SetagayaAPI) collectionConfigGetHandler(w http.ResponseWriter, req *htt
 			CollectionID: collection.ID,
 			Tests:        eps,
 			CSVSplit:     collection.CSVSplit,
+			Continuous:   collection.Continuous,
+			Soak:         collection.Soak,
+			Variables:    collection.Variables,
 		},
 	}
 	content, err := yaml.Marshal(e)
@@ -65,3 +80,246 @@ func (s *SetagayaAPI) collectionConfigGetHandler(w http.ResponseWriter, req *htt
 
 	http.ServeContent(w, req, filename, time.Now(), r)
 }
+
+// marshalManifests writes the resources as a stream of yaml documents, the way kubectl takes them
+func marshalManifests(objects []runtime.Object) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, o := range objects {
+		content, err := k8syaml.Marshal(o)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(content)
+	}
+	return buf.Bytes(), nil
+}
+
+// collectionManifestsHandler renders the resources a deployment of the collection would create, nothing is
+// deployed. The platform engineers use it to review and diff them.
+func (s *SetagayaAPI) collectionManifestsHandler(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(req, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	objects, err := s.ctr.RenderCollection(collection)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrFeatureUnavailable) {
+			s.handleErrors(w, makeInvalidRequestError("the scheduler does not render its resources"))
+			return
+		}
+		s.handleErrors(w, err)
+		return
+	}
+	content, err := marshalManifests(objects)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(content); err != nil {
+		log.Printf("Error writing manifests response: %v", err)
+	}
+}
+
+const (
+	deploymentProgressInterval = 2 * time.Second
+	// The stream is closed after this long even when the engines did not get through
+	deploymentProgressTimeout = 15 * time.Minute
+	// The clients of the streams reconnect after this long when the server shuts down
+	shutdownRetryDelay = 5 * time.Second
+)
+
+// progressChanges returns the engines the stage of which changed since the last time and records their stage
+func progressChanges(stages map[string]string, engines []*smodel.EngineProgress) []*smodel.EngineProgress {
+	changed := []*smodel.EngineProgress{}
+	for _, e := range engines {
+		key := fmt.Sprintf("%d-%d", e.PlanID, e.EngineID)
+		if stages[key] == e.Stage {
+			continue
+		}
+		stages[key] = e.Stage
+		changed = append(changed, e)
+	}
+	return changed
+}
+
+// deploymentFinished tells whether none of the engines can get any further
+func deploymentFinished(engines []*smodel.EngineProgress) bool {
+	for _, e := range engines {
+		if e.Stage != smodel.EngineReachable && e.Stage != smodel.EngineFailed {
+			return false
+		}
+	}
+	return true
+}
+
+func writeEvent(w http.ResponseWriter, event string, content interface{}) {
+	data, err := json.Marshal(content)
+	if err != nil {
+		fmt.Fprintf(w, "event: error\ndata:%v\n\n", err)
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata:%s\n\n", event, data)
+}
+
+// writeShutdownEvent tells the client of a stream that the server is going away. The stream should be opened again
+// after the retry delay, the load balancer sends it to another server by then.
+func writeShutdownEvent(w http.ResponseWriter, flusher http.Flusher) {
+	fmt.Fprintf(w, "retry: %d\n", shutdownRetryDelay.Milliseconds())
+	writeEvent(w, "shutdown", &JSONMessage{Message: "the server is shutting down, reconnect to resume the stream"})
+	flusher.Flush()
+}
+
+// deploymentProgressHandler streams the stages the engines of the collection go through while they are deployed.
+// A progress event is sent every time an engine gets to another stage, and a done event with all the engines
+// once they are all reachable or failed, then the stream is closed.
+func (s *SetagayaAPI) deploymentProgressHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+		return
+	}
+	engines, err := s.ctr.EnginesProgress(r.Context(), collection)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrFeatureUnavailable) {
+			s.handleErrors(w, makeInvalidRequestError("the scheduler does not report the deployment progress"))
+			return
+		}
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	ctx := r.Context()
+	timeout := time.After(deploymentProgressTimeout)
+	ticker := time.NewTicker(deploymentProgressInterval)
+	defer ticker.Stop()
+	stages := make(map[string]string)
+	for {
+		for _, e := range progressChanges(stages, engines) {
+			writeEvent(w, "progress", e)
+		}
+		if deploymentFinished(engines) {
+			writeEvent(w, "done", engines)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.shutdown:
+			writeShutdownEvent(w, flusher)
+			return
+		case <-timeout:
+			writeEvent(w, "timeout", engines)
+			flusher.Flush()
+			return
+		case <-ticker.C:
+		}
+		if engines, err = s.ctr.EnginesProgress(r.Context(), collection); err != nil {
+			writeEvent(w, "error", s.makeRespMessage(err.Error()))
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+const (
+	// The number of collections the status of which can be asked at once
+	maxBulkStatusCollections = 100
+	// The number of statuses asked to the scheduler at the same time
+	bulkStatusWorkers = 8
+)
+
+type bulkStatusRequest struct {
+	CollectionIDs []int64 `json:"collection_ids"`
+}
+
+// collectionStatusResult is the status of one of the collections, or the error which prevented getting it
+type collectionStatusResult struct {
+	CollectionID int64                    `json:"collection_id"`
+	Status       *smodel.CollectionStatus `json:"status,omitempty"`
+	Error        *JSONMessage             `json:"error,omitempty"`
+}
+
+func parseBulkStatusRequest(r *http.Request) ([]int64, error) {
+	br := new(bulkStatusRequest)
+	if err := json.NewDecoder(r.Body).Decode(br); err != nil {
+		return nil, makeInvalidRequestError("collection_ids should be a list of collection ids")
+	}
+	if len(br.CollectionIDs) == 0 || len(br.CollectionIDs) > maxBulkStatusCollections {
+		return nil, makeInvalidRequestError(fmt.Sprintf("collection_ids should have between 1 and %d ids",
+			maxBulkStatusCollections))
+	}
+	ids := []int64{}
+	seen := map[int64]bool{}
+	for _, id := range br.CollectionIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// collectionsStatusHandler returns the status of several collections at once, so a dashboard showing the collections
+// of a project asks for them in one request. A collection which cannot be read has an error instead of a status, the
+// others are still returned.
+//
+// httprouter cannot route /api/collections/status along with /api/collections/:collection_id/..., so the route takes
+// any name in place of the id and only answers to status.
+func (s *SetagayaAPI) collectionsStatusHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	if params.ByName("collection_id") != "status" {
+		s.makeFailMessage(w, "not found", http.StatusNotFound)
+		return
+	}
+	ids, err := parseBulkStatusRequest(r)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	results := make([]*collectionStatusResult, len(ids))
+	sem := make(chan struct{}, bulkStatusWorkers)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id int64) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result := &collectionStatusResult{CollectionID: id}
+			status, err := s.collectionStatus(r, id)
+			if err != nil {
+				result.Error, _ = errorMessage(err)
+			} else {
+				result.Status = status
+			}
+			results[i] = result
+		}(i, id)
+	}
+	wg.Wait()
+	s.jsonise(w, http.StatusOK, results)
+}
+
+func (s *SetagayaAPI) collectionStatus(r *http.Request, collectionID int64) (*smodel.CollectionStatus, error) {
+	collection, err := hasCollectionOwnership(r, httprouter.Params{
+		{Key: "collection_id", Value: strconv.FormatInt(collectionID, 10)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.ctr.CollectionStatus(r.Context(), collection)
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
+)
+
+func TestProgressChanges(t *testing.T) {
+	stages := make(map[string]string)
+	engines := []*smodel.EngineProgress{
+		{PlanID: 1, EngineID: 0, Stage: smodel.EngineScheduled},
+		{PlanID: 1, EngineID: 1, Stage: smodel.EnginePending},
+	}
+	assert.Len(t, progressChanges(stages, engines), 2)
+	assert.Empty(t, progressChanges(stages, engines))
+
+	engines[1].Stage = smodel.EngineCreated
+	changed := progressChanges(stages, engines)
+	assert.Len(t, changed, 1)
+	assert.Equal(t, 1, changed[0].EngineID)
+}
+
+func TestDeploymentFinished(t *testing.T) {
+	engines := []*smodel.EngineProgress{
+		{PlanID: 1, EngineID: 0, Stage: smodel.EngineReachable},
+		{PlanID: 1, EngineID: 1, Stage: smodel.EngineReady},
+	}
+	assert.False(t, deploymentFinished(engines))
+	engines[1].Stage = smodel.EngineFailed
+	assert.True(t, deploymentFinished(engines))
+}
+
+func TestMarshalManifests(t *testing.T) {
+	objects := []runtime.Object{
+		&appsv1.StatefulSet{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+			ObjectMeta: metav1.ObjectMeta{Name: "engine-1-2-3", Namespace: "setagaya-executors"},
+		},
+		&apiv1.Service{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: metav1.ObjectMeta{Name: "engine-1-2-3", Namespace: "setagaya-executors"},
+		},
+	}
+	content, err := marshalManifests(objects)
+	assert.NoError(t, err)
+	documents := strings.Split(string(content), "---\n")
+	assert.Len(t, documents, 2)
+	assert.Contains(t, documents[0], "kind: StatefulSet")
+	assert.Contains(t, documents[0], "namespace: setagaya-executors")
+	assert.Contains(t, documents[1], "kind: Service")
+
+	content, err = marshalManifests(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, content)
+}
+
+func TestWriteShutdownEvent(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeShutdownEvent(w, w)
+	assert.Equal(t, "retry: 5000\nevent: shutdown\n"+
+		`data:{"message":"the server is shutting down, reconnect to resume the stream"}`+"\n\n", w.Body.String())
+	assert.True(t, w.Flushed)
+}
+
+func TestShutdownEndsTheStreams(t *testing.T) {
+	s := &SetagayaAPI{shutdown: make(chan struct{})}
+	s.Shutdown()
+	// It can be called again
+	s.Shutdown()
+	select {
+	case <-s.shutdown:
+	default:
+		t.Fatal("the streams are not told to end")
+	}
+}
+
+func TestParseBulkStatusRequest(t *testing.T) {
+	testCases := []struct {
+		body  string
+		ids   []int64
+		valid bool
+	}{
+		{`{"collection_ids":[3,1,3,2]}`, []int64{3, 1, 2}, true},
+		{`{"collection_ids":[]}`, nil, false},
+		{`{"collection_ids":["1"]}`, nil, false},
+		{`{"collection_ids":[` + strings.Repeat("1,", maxBulkStatusCollections) + `1]}`, nil, false},
+		{`not json`, nil, false},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodPost, "/api/collections/status", strings.NewReader(tc.body))
+		ids, err := parseBulkStatusRequest(r)
+		if !tc.valid {
+			assert.True(t, errors.Is(err, errInvalidRequest), tc.body)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.ids, ids)
+	}
+}
+
+func TestCollectionsStatusHandlerOnlyAnswersToStatus(t *testing.T) {
+	s := &SetagayaAPI{}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/collections/12", strings.NewReader(`{"collection_ids":[1]}`))
+	s.collectionsStatusHandler(w, r, httprouter.Params{{Key: "collection_id", Value: "12"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// The routes can all be registered, httprouter panics when their paths conflict
+func TestRoutesRegister(t *testing.T) {
+	router := httprouter.New()
+	for _, route := range (&SetagayaAPI{}).InitRoutes() {
+		assert.NotPanics(t, func() {
+			router.Handle(route.Method, route.Path, route.HandlerFunc)
+		}, route.Name)
+	}
+}
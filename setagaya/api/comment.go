@@ -0,0 +1,188 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func (s *SetagayaAPI) runCommentsGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	comments, err := model.GetRunComments(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, comments)
+}
+
+// mentionedAccount is what is known of a mentioned user from their name alone: the projects owned by their name are
+// theirs and they are an admin when their name is. Their groups are only known from their session
+func mentionedAccount(name string) *model.Account {
+	return &model.Account{Name: name, ML: []string{name}, MLMap: map[string]interface{}{name: nil}}
+}
+
+// runCommentCreateHandler comments on the run, or replies to a comment with parent_id. The users mentioned with
+// @name are notified, with an excerpt of the comment when they can read the project.
+func (s *SetagayaAPI) runCommentCreateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	body := r.Form.Get("body")
+	if err := model.ValidateComment(body); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	var parentID int64
+	if p := r.Form.Get("parent_id"); p != "" {
+		if parentID, err = strconv.ParseInt(p, 10, 64); err != nil || parentID <= 0 {
+			s.handleErrors(w, makeInvalidResourceError("parent_id"))
+			return
+		}
+	}
+	project, err := model.GetProject(collection.ProjectID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	comment, err := model.AddRunComment(run, parentID, account.Name, body, func(user string) bool {
+		return hasProjectOwnership(project, mentionedAccount(user))
+	})
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, comment)
+}
+
+// runCommentDeleteHandler deletes a comment with its replies. Only its author and the admins can delete it.
+func (s *SetagayaAPI) runCommentDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	commentID, err := strconv.ParseInt(params.ByName("comment_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("comment_id"))
+		return
+	}
+	comment, err := model.GetRunComment(commentID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if comment.RunID != run.ID {
+		s.handleErrors(w, withErrorCode(ErrCodeResourceNotInCollection,
+			makeInvalidRequestError("comment does not belong to the run")))
+		return
+	}
+	if comment.Author != account.Name && !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only the author of a comment can delete it"))
+		return
+	}
+	if err := comment.Delete(); err != nil {
+		s.handleErrors(w, err)
+	}
+}
+
+func (s *SetagayaAPI) notificationsGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	qs := r.URL.Query()
+	limit := 50
+	if l := qs.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 500 {
+			s.handleErrors(w, makeInvalidRequestError("limit should be between 1 and 500"))
+			return
+		}
+		limit = n
+	}
+	notifications, err := model.GetNotifications(account.Name, qs.Get("unread") == "true", limit)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, notifications)
+}
+
+// parseNotificationIDs reads the comma separated ids of the notifications
+func parseNotificationIDs(ids string) ([]int64, error) {
+	r := []int64{}
+	if ids == "" {
+		return r, nil
+	}
+	for _, id := range strings.Split(ids, ",") {
+		n, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil {
+			return nil, errors.New("ids should be the comma separated ids of the notifications")
+		}
+		r = append(r, n)
+	}
+	return r, nil
+}
+
+// notificationsReadHandler marks the given notifications as read, all the notifications of the user without ids
+func (s *SetagayaAPI) notificationsReadHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	ids, err := parseNotificationIDs(r.Form.Get("ids"))
+	if err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := model.MarkNotificationsRead(account.Name, ids); err != nil {
+		s.handleErrors(w, err)
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestParseNotificationIDs(t *testing.T) {
+	ids, err := parseNotificationIDs("")
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+
+	ids, err = parseNotificationIDs("3, 14,15")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 14, 15}, ids)
+
+	_, err = parseNotificationIDs("3,all")
+	assert.Error(t, err)
+}
+
+func TestMentionedAccount(t *testing.T) {
+	ac := config.SC.AuthConfig
+	defer func() { config.SC.AuthConfig = ac }()
+	config.SC.AuthConfig = &config.AuthConfig{AdminUsers: []string{"root"}, LdapConfig: &config.LdapConfig{}}
+
+	assert.True(t, hasProjectOwnership(&model.Project{Owner: "bob"}, mentionedAccount("bob")))
+	assert.False(t, hasProjectOwnership(&model.Project{Owner: "perf-team"}, mentionedAccount("mallory")))
+	assert.True(t, hasProjectOwnership(&model.Project{Owner: "perf-team"}, mentionedAccount("root")))
+}
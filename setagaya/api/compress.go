@@ -0,0 +1,163 @@
+package api
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Only the text is worth compressing, the images and the archives are compressed already. The streams of events are
+// left as they are, so every event reaches the browser as soon as it's flushed.
+var compressibleTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+	"text/css",
+	"text/csv",
+	"text/html",
+	"text/javascript",
+	"text/plain",
+	"text/xml",
+}
+
+// The responses smaller than this are not worth the cost of compressing them, when their size is known
+const minCompressSize = 1024
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// acceptsEncoding tells whether the client accepts the content coding in its Accept-Encoding header
+func acceptsEncoding(r *http.Request, coding string) bool {
+	for _, accept := range r.Header.Values("Accept-Encoding") {
+		for _, c := range strings.Split(accept, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(c), ";")
+			if !strings.EqualFold(strings.TrimSpace(name), coding) {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range compressibleTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter decides whether to compress the response once its headers are known, when the handler writes them
+type compressWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	if isCompressible(h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+		if cw.shouldCompress(status) {
+			h.Set("Content-Encoding", "gzip")
+			h.Del("Content-Length")
+			cw.gz = gzipWriters.Get().(*gzip.Writer)
+			cw.gz.Reset(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) shouldCompress(status int) bool {
+	h := cw.Header()
+	switch {
+	case status < http.StatusOK, status == http.StatusNoContent, status == http.StatusNotModified,
+		status == http.StatusPartialContent:
+		return false
+	case h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+		return false
+	}
+	if l := h.Get("Content-Length"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n < minCompressSize {
+			return false
+		}
+	}
+	return true
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush sends what is compressed so far to the client
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.gz != nil {
+		if err := cw.gz.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() error {
+	if cw.gz == nil {
+		return nil
+	}
+	defer gzipWriters.Put(cw.gz)
+	return cw.gz.Close()
+}
+
+// Compress gzips the text responses, like the JSON of the API, for the clients accepting it
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead || !acceptsEncoding(r, "gzip") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		// The client is gone when the end of the response cannot be written
+		_ = cw.close()
+	})
+}
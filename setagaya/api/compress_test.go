@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	testCases := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.5, br", true},
+		{"GZIP", true},
+		{"gzip;q=0", false},
+		{"br", false},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/api/collections/1/runs", nil)
+		r.Header.Set("Accept-Encoding", tc.accept)
+		assert.Equal(t, tc.want, acceptsEncoding(r, "gzip"), tc.accept)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	s := &SetagayaAPI{}
+	runs := make([]map[string]int, 200)
+	for i := range runs {
+		runs[i] = map[string]int{"id": i}
+	}
+	handler := Compress(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.jsonise(w, http.StatusOK, runs)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/collections/1/runs", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	gz, err := gzip.NewReader(w.Body)
+	if assert.NoError(t, err) {
+		body, err := io.ReadAll(gz)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(body), `[{"id":0},{"id":1}`))
+	}
+
+	// The clients not accepting gzip get the JSON as it is
+	r = httptest.NewRequest(http.MethodGet, "/api/collections/1/runs", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.True(t, strings.HasPrefix(w.Body.String(), `[{"id":0},{"id":1}`))
+}
+
+func TestCompressSkips(t *testing.T) {
+	// The responses are left as the handlers write them
+	testCases := []struct {
+		name    string
+		size    int
+		handler http.HandlerFunc
+	}{
+		{"small", 2, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "2")
+			_, _ = w.Write([]byte("{}"))
+		}},
+		{"image", 4096, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(make([]byte, 4096))
+		}},
+		{"already encoded", 4096, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(make([]byte, 4096))
+		}},
+		{"not modified", 0, func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotModified)
+		}},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		Compress(tc.handler).ServeHTTP(w, r)
+		assert.Equal(t, tc.size, w.Body.Len(), tc.name)
+	}
+}
+
+// The events of a stream reach the client as soon as they are flushed, through the compression and over HTTP/2
+func TestCompressFlushesStreamsOverHTTP2(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewUnstartedServer(Compress(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "data:first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "data:second\n\n")
+	})))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := ts.Client().Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	reader := bufio.NewReader(resp.Body)
+	// The second event is only written once the first one is read
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data:first\n", line)
+	close(release)
+	rest, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "\ndata:second\n\n", string(rest))
+}
+
+// A compressed response is flushed as it is written as well
+func TestCompressFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	cw := &compressWriter{ResponseWriter: w}
+	cw.Header().Set("Content-Type", "text/plain")
+	cw.WriteHeader(http.StatusOK)
+	_, err := cw.Write([]byte("hello"))
+	assert.NoError(t, err)
+	cw.Flush()
+	assert.True(t, w.Flushed)
+	gz, err := gzip.NewReader(strings.NewReader(w.Body.String()))
+	if assert.NoError(t, err) {
+		buf := make([]byte, 5)
+		_, err := io.ReadFull(gz, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(buf))
+	}
+	assert.NoError(t, cw.close())
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const (
+	anonymousUser = "anonymous"
+	unknownClient = "unknown"
+	// The client programs are told apart by the product of their User-Agent, which is cut to keep the number of
+	// series of the counter bounded
+	maxClientNameLength = 32
+)
+
+// clientName is the program calling the API, the product of its User-Agent like curl or python-requests
+func clientName(r *http.Request) string {
+	ua := strings.TrimSpace(r.UserAgent())
+	if ua == "" {
+		return unknownClient
+	}
+	product := strings.Fields(ua)[0]
+	if i := strings.Index(product, "/"); i >= 0 {
+		product = product[:i]
+	}
+	if product == "" {
+		return unknownClient
+	}
+	if len(product) > maxClientNameLength {
+		product = product[:maxClientNameLength]
+	}
+	return product
+}
+
+// setDeprecationHeaders tells the client the route is deprecated, with the Deprecation header of RFC 9745 and the
+// Sunset header of RFC 8594
+func setDeprecationHeaders(h http.Header, d *config.Deprecation) {
+	h.Set("Deprecation", fmt.Sprintf("@%d", d.SinceTime().Unix()))
+	if sunset := d.SunsetTime(); !sunset.IsZero() {
+		h.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		h.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"; type="text/html"`, d.Link))
+	}
+}
+
+// deprecated marks the responses of the route as deprecated and counts its calls. It runs after authRequired, the
+// calls of the routes without an account are counted as anonymous
+func deprecated(route string, d *config.Deprecation, next httprouter.Handle) httprouter.Handle {
+	return httprouter.Handle(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		user := anonymousUser
+		if account, ok := r.Context().Value(accountKey).(*model.Account); ok {
+			user = account.Name
+		}
+		config.DeprecatedCallsCounter.WithLabelValues(route, user, clientName(r)).Inc()
+		setDeprecationHeaders(w.Header(), d)
+		next(w, r, params)
+	})
+}
+
+// markDeprecated wraps the routes deprecated by the config. A deprecation of a route which does not exist is a
+// mistake of the config, it's fatal like the other ones
+func markDeprecated(routes Routes, deprecations []*config.Deprecation) {
+	byName := make(map[string]*Route, len(routes))
+	for _, r := range routes {
+		byName[r.Name] = r
+	}
+	for _, d := range deprecations {
+		r, ok := byName[d.Route]
+		if !ok {
+			log.Fatalf("Deprecated route %s does not exist", d.Route)
+		}
+		r.HandlerFunc = deprecated(r.Name, d, r.HandlerFunc)
+	}
+}
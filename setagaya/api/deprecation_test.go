@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestClientName(t *testing.T) {
+	for ua, expected := range map[string]string{
+		"curl/8.4.0":                      "curl",
+		"python-requests/2.31.0":          "python-requests",
+		"Mozilla/5.0 (X11; Linux x86_64)": "Mozilla",
+		"setagaya-ci":                     "setagaya-ci",
+		"":                                unknownClient,
+		"/1.0":                            unknownClient,
+		"a-very-long-client-name-going-on-and-on": "a-very-long-client-name-going-on",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/usage/summary_sid", nil)
+		r.Header.Set("User-Agent", ua)
+		assert.Equal(t, expected, clientName(r), ua)
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	d := &config.Deprecation{Route: "usage_summary_by_sid", Since: "2026-10-01", Sunset: "2027-04-01",
+		Link: "https://docs.example.com/usage"}
+	routes := Routes{
+		&Route{"usage_summary", "GET", "/api/usage/summary", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {}},
+		&Route{"usage_summary_by_sid", "GET", "/api/usage/summary_sid", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {}},
+	}
+	markDeprecated(routes, []*config.Deprecation{d})
+	router := httprouter.New()
+	for _, r := range routes {
+		router.Handle(r.Method, r.Path, r.HandlerFunc)
+	}
+	counter := config.DeprecatedCallsCounter.WithLabelValues("usage_summary_by_sid", anonymousUser, "curl")
+	before := testutil.ToFloat64(counter)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/usage/summary_sid", nil)
+	req.Header.Set("User-Agent", "curl/8.4.0")
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, "@1790812800", rr.Header().Get("Deprecation"))
+	assert.Equal(t, "Thu, 01 Apr 2027 00:00:00 GMT", rr.Header().Get("Sunset"))
+	assert.Equal(t, `<https://docs.example.com/usage>; rel="deprecation"; type="text/html"`, rr.Header().Get("Link"))
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+
+	// The other routes are left as they are
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/usage/summary", nil))
+	assert.Empty(t, rr.Header().Get("Deprecation"))
+	assert.Empty(t, rr.Header().Get("Sunset"))
+}
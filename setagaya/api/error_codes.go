@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/controller"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/scheduler"
+)
+
+// The codes of the errors returned by the API. Unlike the messages, they never change, so the clients can rely on
+// them. Every code is documented in docs/src/user/error_codes.md.
+const (
+	// Codes of the errors which have no code of their own, by their status
+	ErrCodeInvalidRequest = "SETAGAYA_ERR_INVALID_REQUEST"
+	ErrCodeNoPermission   = "SETAGAYA_ERR_NO_PERMISSION"
+	ErrCodeNotFound       = "SETAGAYA_ERR_NOT_FOUND"
+	ErrCodeConflict       = "SETAGAYA_ERR_CONFLICT"
+	ErrCodeInternal       = "SETAGAYA_ERR_INTERNAL"
+
+	ErrCodeLoginRequired           = "SETAGAYA_ERR_LOGIN_REQUIRED"
+	ErrCodeProjectOwnership        = "SETAGAYA_ERR_PROJECT_OWNERSHIP"
+	ErrCodeCollectionOwnership     = "SETAGAYA_ERR_COLLECTION_OWNERSHIP"
+	ErrCodeProjectNotEmpty         = "SETAGAYA_ERR_PROJECT_NOT_EMPTY"
+	ErrCodePlanInUse               = "SETAGAYA_ERR_PLAN_IN_USE"
+	ErrCodeProjectFileInUse        = "SETAGAYA_ERR_PROJECT_FILE_IN_USE"
+	ErrCodeEnginesDeployed         = "SETAGAYA_ERR_ENGINES_DEPLOYED"
+	ErrCodeCollectionRunning       = "SETAGAYA_ERR_COLLECTION_RUNNING"
+	ErrCodeEngineLimit             = "SETAGAYA_ERR_ENGINE_LIMIT"
+	ErrCodeNoResources             = "SETAGAYA_ERR_NO_RESOURCES"
+	ErrCodeInvalidParameters       = "SETAGAYA_ERR_INVALID_PARAMETERS"
+	ErrCodeImagePolicy             = "SETAGAYA_ERR_IMAGE_POLICY"
+	ErrCodeIdempotencyKeyInUse     = "SETAGAYA_ERR_IDEMPOTENCY_KEY_IN_USE"
+	ErrCodeTenantExists            = "SETAGAYA_ERR_TENANT_EXISTS"
+	ErrCodeBrandingHostTaken       = "SETAGAYA_ERR_BRANDING_HOST_TAKEN"
+	ErrCodeInvalidStorageRegion    = "SETAGAYA_ERR_INVALID_STORAGE_REGION"
+	ErrCodeTooManyFavorites        = "SETAGAYA_ERR_TOO_MANY_FAVORITES"
+	ErrCodeResourceNotInCollection = "SETAGAYA_ERR_RESOURCE_NOT_IN_COLLECTION"
+	ErrCodeShareLinksDisabled      = "SETAGAYA_ERR_SHARE_LINKS_DISABLED"
+	ErrCodeShareLinkExpired        = "SETAGAYA_ERR_SHARE_LINK_EXPIRED"
+	ErrCodeShareLinkRevoked        = "SETAGAYA_ERR_SHARE_LINK_REVOKED"
+	ErrCodeChaosDisabled           = "SETAGAYA_ERR_CHAOS_DISABLED"
+	ErrCodeCapacityReserved        = "SETAGAYA_ERR_CAPACITY_RESERVED"
+	ErrCodeIncompatibleEngines     = "SETAGAYA_ERR_INCOMPATIBLE_ENGINES"
+	ErrCodeInvalidFragments        = "SETAGAYA_ERR_INVALID_FRAGMENTS"
+	ErrCodeInvalidTemplate         = "SETAGAYA_ERR_INVALID_TEMPLATE"
+	ErrCodeSchedulerUnavailable    = "SETAGAYA_ERR_SCHEDULER_UNAVAILABLE"
+	ErrCodeOperationTimeout        = "SETAGAYA_ERR_OPERATION_TIMEOUT"
+	ErrCodeFeatureDisabled         = "SETAGAYA_ERR_FEATURE_DISABLED"
+	ErrCodeEncryptionDisabled      = "SETAGAYA_ERR_ENCRYPTION_DISABLED"
+	ErrCodeBudgetExhausted         = "SETAGAYA_ERR_BUDGET_EXHAUSTED"
+	ErrCodeStepUpRequired          = "SETAGAYA_ERR_STEP_UP_REQUIRED"
+	ErrCodeMFAEnrolled             = "SETAGAYA_ERR_MFA_ENROLLED"
+	ErrCodeMFALocked               = "SETAGAYA_ERR_MFA_LOCKED"
+	ErrCodePlatformFrozen          = "SETAGAYA_ERR_PLATFORM_FROZEN"
+)
+
+var statusErrorCodes = map[int]string{
+	http.StatusBadRequest:          ErrCodeInvalidRequest,
+	http.StatusForbidden:           ErrCodeNoPermission,
+	http.StatusNotFound:            ErrCodeNotFound,
+	http.StatusConflict:            ErrCodeConflict,
+	http.StatusInternalServerError: ErrCodeInternal,
+}
+
+// The errors of the other packages which have a code of their own, with the status they are answered with
+var sentinelErrorCodes = []struct {
+	err    error
+	code   string
+	status int
+}{
+	{model.ErrProjectFileInUse, ErrCodeProjectFileInUse, http.StatusConflict},
+	{model.ErrIdempotencyKeyInUse, ErrCodeIdempotencyKeyInUse, http.StatusConflict},
+	{model.ErrTenantExists, ErrCodeTenantExists, http.StatusConflict},
+	{model.ErrBrandingHostTaken, ErrCodeBrandingHostTaken, http.StatusConflict},
+	{model.ErrTooManyFavorites, ErrCodeTooManyFavorites, http.StatusBadRequest},
+	{model.ErrShareLinksDisabled, ErrCodeShareLinksDisabled, http.StatusBadRequest},
+	{model.ErrShareLinkExpired, ErrCodeShareLinkExpired, http.StatusGone},
+	{model.ErrShareLinkRevoked, ErrCodeShareLinkRevoked, http.StatusGone},
+	{model.ErrChaosDisabled, ErrCodeChaosDisabled, http.StatusBadRequest},
+	{model.ErrInvalidTemplate, ErrCodeInvalidTemplate, http.StatusBadRequest},
+	{model.ErrFeatureDisabled, ErrCodeFeatureDisabled, http.StatusForbidden},
+	{model.ErrEncryptionDisabled, ErrCodeEncryptionDisabled, http.StatusBadRequest},
+	{model.ErrBudgetExhausted, ErrCodeBudgetExhausted, http.StatusForbidden},
+	{model.ErrStepUpRequired, ErrCodeStepUpRequired, http.StatusForbidden},
+	{model.ErrMFAEnrolled, ErrCodeMFAEnrolled, http.StatusConflict},
+	{model.ErrMFALocked, ErrCodeMFALocked, http.StatusTooManyRequests},
+	{model.ErrPlatformFrozen, ErrCodePlatformFrozen, http.StatusServiceUnavailable},
+	{controller.ErrInvalidStorageRegion, ErrCodeInvalidStorageRegion, http.StatusBadRequest},
+	{controller.ErrImagePolicy, ErrCodeImagePolicy, http.StatusForbidden},
+	{controller.ErrCapacityReserved, ErrCodeCapacityReserved, http.StatusBadRequest},
+	{controller.ErrIncompatibleEngines, ErrCodeIncompatibleEngines, http.StatusBadRequest},
+	{controller.ErrInvalidFragments, ErrCodeInvalidFragments, http.StatusBadRequest},
+	{scheduler.ErrSchedulerUnavailable, ErrCodeSchedulerUnavailable, http.StatusServiceUnavailable},
+	{context.DeadlineExceeded, ErrCodeOperationTimeout, http.StatusGatewayTimeout},
+}
+
+// extErrorStatus returns the status of the errors of the other packages, by their sentinel or else by their kind.
+// ok is false when the error is neither.
+func extErrorStatus(err error) (status int, ok bool) {
+	for _, s := range sentinelErrorCodes {
+		if errors.Is(err, s.err) {
+			return s.status, true
+		}
+	}
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		return http.StatusNotFound, true
+	case errors.Is(err, model.ErrInvalid):
+		return http.StatusBadRequest, true
+	}
+	return 0, false
+}
+
+// setRetryAfter tells the clients when the calls refused while the circuit of the scheduler is open can be made again
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var ue *scheduler.UnavailableError
+	if !errors.As(err, &ue) {
+		return
+	}
+	seconds := int((ue.RetryAfter + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+}
+
+// errorStatus returns the status the error is answered with. The errors of the API keep the status they were made
+// with, whatever they wrap.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNoPermission):
+		return http.StatusForbidden
+	case errors.Is(err, errInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrServer):
+		return http.StatusInternalServerError
+	}
+	if status, ok := extErrorStatus(err); ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// codedError gives its code to an error, its message stays the same
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+func withErrorCode(code string, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// errorCode returns the code of the error, the code of the status when it has none of its own
+func errorCode(err error, statusCode int) string {
+	var (
+		ce  *codedError
+		pe  *model.ParameterError
+		nre *scheduler.NoResourcesFoundErr
+	)
+	switch {
+	case errors.As(err, &ce):
+		return ce.code
+	case errors.As(err, &pe):
+		return ErrCodeInvalidParameters
+	case errors.As(err, &nre):
+		return ErrCodeNoResources
+	}
+	for _, s := range sentinelErrorCodes {
+		if errors.Is(err, s.err) {
+			return s.code
+		}
+	}
+	if code, ok := statusErrorCodes[statusCode]; ok {
+		return code
+	}
+	return ErrCodeInternal
+}
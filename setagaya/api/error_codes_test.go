@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/controller"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/scheduler"
+)
+
+func TestErrorCode(t *testing.T) {
+	testCases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{makeInvalidRequestError("name"), http.StatusBadRequest, ErrCodeInvalidRequest},
+		{makeNoPermissionErr("admins only"), http.StatusForbidden, ErrCodeNoPermission},
+		{makeProjectOwnershipError(), http.StatusForbidden, ErrCodeProjectOwnership},
+		{withErrorCode(ErrCodePlanInUse, makeInvalidRequestError("plan is being used")), http.StatusBadRequest, ErrCodePlanInUse},
+		{&model.DBError{Message: "plan not found"}, http.StatusNotFound, ErrCodeNotFound},
+		{wrapInvalidRequestError(&model.ParameterError{Message: "missing"}), http.StatusBadRequest, ErrCodeInvalidParameters},
+		{&scheduler.NoResourcesFoundErr{Message: "no engines"}, http.StatusNotFound, ErrCodeNoResources},
+		{fmt.Errorf("cannot onboard: %w", model.ErrTenantExists), http.StatusConflict, ErrCodeTenantExists},
+		{wrapInvalidRequestError(controller.ErrInvalidStorageRegion), http.StatusBadRequest, ErrCodeInvalidStorageRegion},
+		{fmt.Errorf("deploy_plan: %w", scheduler.ErrSchedulerUnavailable), http.StatusServiceUnavailable, ErrCodeSchedulerUnavailable},
+		{errors.New("boom"), http.StatusInternalServerError, ErrCodeInternal},
+		{errors.New("teapot"), http.StatusTeapot, ErrCodeInternal},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.code, errorCode(tc.err, tc.status), tc.err.Error())
+	}
+}
+
+func TestWithErrorCodeKeepsTheError(t *testing.T) {
+	err := withErrorCode(ErrCodeEnginesDeployed, makeInvalidRequestError("engines are deployed"))
+	assert.Equal(t, "400-engines are deployed", err.Error())
+	assert.True(t, errors.Is(err, errInvalidRequest))
+}
+
+func TestHandleErrorsReturnsTheCode(t *testing.T) {
+	s := &SetagayaAPI{}
+	testCases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{withErrorCode(ErrCodeCollectionRunning, makeInvalidRequestError("running")), http.StatusBadRequest,
+			ErrCodeCollectionRunning},
+		{makeCollectionOwnershipError(), http.StatusForbidden, ErrCodeCollectionOwnership},
+		{withErrorCode(ErrCodeResourceNotInCollection, &model.DBError{Message: "run not found"}), http.StatusNotFound,
+			ErrCodeResourceNotInCollection},
+		{errors.New("boom"), http.StatusInternalServerError, ErrCodeInternal},
+	}
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		s.handleErrors(w, tc.err)
+		assert.Equal(t, tc.status, w.Code)
+		msg := new(JSONMessage)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), msg))
+		assert.Equal(t, tc.code, msg.Code)
+		assert.Equal(t, tc.err.Error(), msg.Message)
+	}
+}
+
+// The errors gathered in a response read the same as when they are the response
+func TestErrorMessageMatchesHandleErrors(t *testing.T) {
+	s := &SetagayaAPI{}
+	for _, err := range []error{
+		makeInvalidRequestError("name"),
+		makeCollectionOwnershipError(),
+		&model.DBError{Message: "collection not found"},
+		&scheduler.NoResourcesFoundErr{Message: "no engines"},
+		errors.New("boom"),
+	} {
+		w := httptest.NewRecorder()
+		s.handleErrors(w, err)
+		want := new(JSONMessage)
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), want))
+		msg, status := errorMessage(err)
+		assert.Equal(t, w.Code, status, err.Error())
+		assert.Equal(t, want, msg, err.Error())
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	testCases := []struct {
+		err    error
+		status int
+	}{
+		{&model.DBError{Message: "plan not found"}, http.StatusNotFound},
+		{fmt.Errorf("cannot replace: %w", &model.DBError{Message: "plan 1 is not in the collection"}), http.StatusNotFound},
+		{&scheduler.NoResourcesFoundErr{Message: "no engines"}, http.StatusNotFound},
+		{&model.RequestError{Message: "the collection is not running"}, http.StatusBadRequest},
+		{&model.ParameterError{Message: "missing"}, http.StatusBadRequest},
+		{fmt.Errorf("cannot delete: %w", model.ErrProjectFileInUse), http.StatusConflict},
+		{model.ErrShareLinkExpired, http.StatusGone},
+		{controller.ErrCapacityReserved, http.StatusBadRequest},
+		{fmt.Errorf("image setagaya:jmeter: %w", controller.ErrImagePolicy), http.StatusForbidden},
+		{&scheduler.UnavailableError{Operation: "deploy_plan"}, http.StatusServiceUnavailable},
+		{fmt.Errorf("purging: %w", context.DeadlineExceeded), http.StatusGatewayTimeout},
+		// The sentinel wins over the kind wrapping it
+		{&model.RequestError{Err: model.ErrTenantExists, Message: "tenant exists"}, http.StatusConflict},
+		// The errors of the API keep their status
+		{makeNoPermissionErr("admins only"), http.StatusForbidden},
+		{wrapInvalidRequestError(&model.DBError{Message: "run not found"}), http.StatusBadRequest},
+		{makeInternalServerError("cannot deploy"), http.StatusInternalServerError},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.status, errorStatus(tc.err), tc.err.Error())
+	}
+}
+
+// The clients are told to retry once the cool-down of the scheduler is over
+func TestHandleErrorsRetryAfter(t *testing.T) {
+	s := &SetagayaAPI{}
+	w := httptest.NewRecorder()
+	s.handleErrors(w, &scheduler.UnavailableError{Operation: "deploy_plan", RetryAfter: 2500 * time.Millisecond})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+	msg := new(JSONMessage)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), msg))
+	assert.Equal(t, ErrCodeSchedulerUnavailable, msg.Code)
+
+	// The call let through at the end of the cool-down failed a moment ago
+	w = httptest.NewRecorder()
+	s.handleErrors(w, &scheduler.UnavailableError{Operation: "deploy_plan"})
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	s.handleErrors(w, model.ErrPlatformFrozen)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
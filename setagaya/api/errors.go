@@ -12,13 +12,18 @@ var (
 )
 
 func makeLoginError() error {
-	return fmt.Errorf("%wyou need to login", errNoPermission)
+	return withErrorCode(ErrCodeLoginRequired, fmt.Errorf("%wyou need to login", errNoPermission))
 }
 
 func makeInvalidRequestError(message string) error {
 	return fmt.Errorf("%w%s", errInvalidRequest, message)
 }
 
+// wrapInvalidRequestError keeps the error behind the invalid request, so its code is returned
+func wrapInvalidRequestError(err error) error {
+	return fmt.Errorf("%w%w", errInvalidRequest, err)
+}
+
 func makeNoPermissionErr(message string) error {
 	return fmt.Errorf("%w%s", errNoPermission, message)
 }
@@ -34,9 +39,9 @@ func makeInvalidResourceError(resource string) error {
 }
 
 func makeProjectOwnershipError() error {
-	return fmt.Errorf("%w%s", errNoPermission, "You don't own the project")
+	return withErrorCode(ErrCodeProjectOwnership, fmt.Errorf("%w%s", errNoPermission, "You don't own the project"))
 }
 
 func makeCollectionOwnershipError() error {
-	return fmt.Errorf("%w%s", errNoPermission, "You don't own the collection")
+	return withErrorCode(ErrCodeCollectionOwnership, fmt.Errorf("%w%s", errNoPermission, "You don't own the collection"))
 }
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// makeETag returns the tag of the content. It's weak as the responses are compressed for some of the clients.
+func makeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified tells whether the client has the content already, by the conditions of its request
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		// If-Modified-Since is ignored along with If-None-Match
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// jsoniseCacheable sends the content like jsonise, along with its ETag. The clients polling it, like the UI, get a
+// 304 without the content when it did not change since they last got it. lastModified is sent when it's not zero,
+// it must be later every time the content changes.
+func (s *SetagayaAPI) jsoniseCacheable(w http.ResponseWriter, r *http.Request, content interface{},
+	lastModified time.Time) {
+	body, err := json.Marshal(content)
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	recordClassifiedRead(w, http.StatusOK, content)
+	body = append(body, '\n')
+	etag := makeETag(body)
+	h := w.Header()
+	h.Set("ETag", etag)
+	// The browsers keep the content, but check it did not change every time they need it
+	h.Set("Cache-Control", "private, no-cache")
+	if !lastModified.IsZero() {
+		h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	h.Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Failed to write JSON response: %v", err)
+	}
+}
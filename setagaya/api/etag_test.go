@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestJsoniseCacheable(t *testing.T) {
+	s := &SetagayaAPI{}
+	status := map[string]string{"status": "running"}
+	lastModified := time.Date(2026, 10, 16, 9, 30, 15, 500, time.UTC)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/collections/1/status", nil)
+	w := httptest.NewRecorder()
+	s.jsoniseCacheable(w, r, status, lastModified)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"running"}`, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Fri, 16 Oct 2026 09:30:15 GMT", w.Header().Get("Last-Modified"))
+	etag := w.Header().Get("ETag")
+	assert.Regexp(t, `^W/"[0-9a-f]{32}"$`, etag)
+
+	testCases := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"same etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"one of the etags", map[string]string{"If-None-Match": `W/"0123", ` + etag}, http.StatusNotModified},
+		{"other etag", map[string]string{"If-None-Match": `W/"0123"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": "Fri, 16 Oct 2026 09:30:15 GMT"},
+			http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": "Fri, 16 Oct 2026 09:30:14 GMT"}, http.StatusOK},
+		{"etag wins", map[string]string{"If-None-Match": `W/"0123"`,
+			"If-Modified-Since": "Fri, 16 Oct 2026 09:30:15 GMT"}, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/api/collections/1/status", nil)
+		for k, v := range tc.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.jsoniseCacheable(w, r, status, lastModified)
+		assert.Equal(t, tc.status, w.Code, tc.name)
+		if tc.status == http.StatusNotModified {
+			assert.Empty(t, w.Body.String(), tc.name)
+		}
+	}
+
+	// The etag changes with the content
+	w = httptest.NewRecorder()
+	s.jsoniseCacheable(w, r, map[string]string{"status": "stopped"}, time.Time{})
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+}
+
+func TestRunsLastModified(t *testing.T) {
+	started := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	ended := started.Add(time.Hour)
+	assert.True(t, runsLastModified(nil).IsZero())
+	assert.Equal(t, ended, runsLastModified([]*model.RunHistory{
+		{StartedTime: started.Add(-time.Hour), EndTime: ended},
+		{StartedTime: started},
+	}))
+}
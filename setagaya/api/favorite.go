@@ -0,0 +1,175 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func parseUserItem(params httprouter.Params) (string, int64, error) {
+	kind := params.ByName("kind")
+	if err := model.ValidateUserItemKind(kind); err != nil {
+		return "", 0, makeInvalidRequestError(err.Error())
+	}
+	id, err := strconv.ParseInt(params.ByName("item_id"), 10, 64)
+	if err != nil || id <= 0 {
+		return "", 0, makeInvalidResourceError("item_id")
+	}
+	return kind, id, nil
+}
+
+// resolveUserItem fills in the name and the project of the item. The item is not visible when it was deleted or
+// the account cannot access its project anymore.
+func resolveUserItem(item *model.UserItem, account *model.Account) (bool, error) {
+	projectID := item.ID
+	switch item.Kind {
+	case model.UserItemPlan:
+		plan, err := model.GetPlan(item.ID)
+		if err != nil {
+			return false, err
+		}
+		item.Name, projectID = plan.Name, plan.ProjectID
+	case model.UserItemCollection:
+		collection, err := model.GetCollection(item.ID)
+		if err != nil {
+			return false, err
+		}
+		item.Name, projectID = collection.Name, collection.ProjectID
+	}
+	project, err := model.GetProject(projectID)
+	if err != nil {
+		return false, err
+	}
+	if item.Kind == model.UserItemProject {
+		item.Name = project.Name
+	} else {
+		item.ProjectID = project.ID
+	}
+	return hasProjectOwnership(project, account), nil
+}
+
+func visibleUserItems(items []*model.UserItem, account *model.Account) ([]*model.UserItem, error) {
+	r := []*model.UserItem{}
+	for _, item := range items {
+		visible, err := resolveUserItem(item, account)
+		if errors.Is(err, model.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if visible {
+			r = append(r, item)
+		}
+	}
+	return r, nil
+}
+
+// recordRecentItem remembers the account opened the item. Failing to do so does not fail the request.
+func recordRecentItem(r *http.Request, kind string, id int64) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		return
+	}
+	if err := model.RecordRecentItem(account.Name, kind, id); err != nil {
+		log.Printf("Cannot record %s opened %s %d: %v", account.Name, kind, id, err)
+	}
+}
+
+func (s *SetagayaAPI) favoritesGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	favorites, err := model.GetFavorites(account.Name)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	favorites, err = visibleUserItems(favorites, account)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, favorites)
+}
+
+func (s *SetagayaAPI) favoriteAddHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	kind, id, err := parseUserItem(params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	item := &model.UserItem{Kind: kind, ID: id}
+	visible, err := resolveUserItem(item, account)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if !visible {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	if err := model.AddFavorite(account.Name, kind, id); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, item)
+}
+
+// favoriteDeleteHandler unpins the item. Items which were deleted or cannot be accessed anymore can be unpinned
+// as well.
+func (s *SetagayaAPI) favoriteDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	kind, id, err := parseUserItem(params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := model.RemoveFavorite(account.Name, kind, id); err != nil {
+		s.handleErrors(w, err)
+	}
+}
+
+func (s *SetagayaAPI) recentItemsGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > model.MaxRecentItems {
+			s.handleErrors(w, makeInvalidRequestError("limit should be between 1 and "+strconv.Itoa(model.MaxRecentItems)))
+			return
+		}
+		limit = n
+	}
+	items, err := model.GetRecentItems(account.Name, limit)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	items, err = visibleUserItems(items, account)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, items)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserItem(t *testing.T) {
+	params := httprouter.Params{{Key: "kind", Value: "collection"}, {Key: "item_id", Value: "42"}}
+	kind, id, err := parseUserItem(params)
+	assert.NoError(t, err)
+	assert.Equal(t, "collection", kind)
+	assert.Equal(t, int64(42), id)
+
+	invalid := []httprouter.Params{
+		{{Key: "kind", Value: "run"}, {Key: "item_id", Value: "42"}},
+		{{Key: "kind", Value: "plan"}, {Key: "item_id", Value: "abc"}},
+		{{Key: "kind", Value: "plan"}, {Key: "item_id", Value: "0"}},
+		{{Key: "item_id", Value: "42"}},
+	}
+	for _, params := range invalid {
+		_, _, err := parseUserItem(params)
+		assert.True(t, errors.Is(err, errInvalidRequest))
+	}
+}
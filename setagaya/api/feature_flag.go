@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// featureFlagsAdminGetHandler lists the feature flags, as the config sets them and as the tenants override them
+func (s *SetagayaAPI) featureFlagsAdminGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can see the feature flags"))
+		return
+	}
+	flags, err := model.GetFeatureFlags()
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	s.jsonise(w, http.StatusOK, flags)
+}
+
+func (s *SetagayaAPI) tenantFeatureFlagsGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	tenant, err := getAdminTenant(r, params, "see the feature flags of the tenants")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	flags, err := tenant.GetFeatureFlags()
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	s.jsonise(w, http.StatusOK, flags)
+}
+
+// tenantFeatureFlagSetHandler turns a feature on or off for the tenant, whatever the config sets, so the risky
+// features can be rolled out one tenant at a time
+func (s *SetagayaAPI) tenantFeatureFlagSetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	tenant, err := getAdminTenant(r, params, "set the feature flags of the tenants")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	flag := params.ByName("flag")
+	if config.GetFeature(flag) == nil {
+		s.handleErrors(w, makeInvalidResourceError("flag"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	enabled, err := strconv.ParseBool(r.Form.Get("enabled"))
+	if err != nil {
+		s.handleErrors(w, makeInvalidRequestError("enabled should be true or false"))
+		return
+	}
+	if err := tenant.SetFeatureFlag(flag, enabled); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	account := r.Context().Value(accountKey).(*model.Account)
+	log.Printf("Admin %s turns feature %s of tenant %s to %t", account.Name, flag, tenant.Name, enabled)
+	flags, err := tenant.GetFeatureFlags()
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	s.jsonise(w, http.StatusOK, flags)
+}
+
+// tenantFeatureFlagDeleteHandler removes the override of the tenant, the feature follows the config again
+func (s *SetagayaAPI) tenantFeatureFlagDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	tenant, err := getAdminTenant(r, params, "set the feature flags of the tenants")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := tenant.DeleteFeatureFlag(params.ByName("flag")); err != nil {
+		s.handleErrors(w, err)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// The changes still allowed while the platform is frozen: the load is shed by stopping and purging the collections,
+// the admins lift the freeze, and the rest only reads
+var freezeExemptRoutes = map[string]bool{
+	"collections_status":    true,
+	"stop":                  true,
+	"stop_plan":             true,
+	"heartbeat":             true,
+	"stop_replay":           true,
+	"purge":                 true,
+	"force_purge":           true,
+	"simulate":              true,
+	"graphql":               true,
+	"admin_stop_collection": true,
+	"admin_enroll_mfa":      true,
+	"admin_verify_mfa":      true,
+	"admin_freeze":          true,
+	"admin_unfreeze":        true,
+}
+
+type platformFreezeStatus struct {
+	Frozen bool `json:"frozen"`
+	*model.PlatformFreeze
+}
+
+// refuseWhenFrozen has the changes of the routes refused while the platform is frozen. The reads go on as usual
+func (s *SetagayaAPI) refuseWhenFrozen(routes Routes) {
+	for _, route := range routes {
+		if route.Method == http.MethodGet || freezeExemptRoutes[route.Name] {
+			continue
+		}
+		next := route.HandlerFunc
+		route.HandlerFunc = func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+			if err := model.CheckPlatformFreeze(); err != nil {
+				s.handleErrors(w, err)
+				return
+			}
+			next(w, r, params)
+		}
+	}
+}
+
+func (s *SetagayaAPI) platformFreezeGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if _, err := adminAccount(r, "see the freeze of the platform"); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	pf, err := model.GetPlatformFreeze()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, &platformFreezeStatus{Frozen: pf != nil, PlatformFreeze: pf})
+}
+
+// platformFreezeHandler makes the platform read-only, for an incident or a change freeze
+func (s *SetagayaAPI) platformFreezeHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, err := adminAccount(r, "freeze the platform")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	pf := &model.PlatformFreeze{Reason: r.Form.Get("reason"), FrozenBy: account.Name}
+	if err := pf.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := model.FreezePlatform(pf); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if pf, err = model.GetPlatformFreeze(); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, &platformFreezeStatus{Frozen: pf != nil, PlatformFreeze: pf})
+}
+
+func (s *SetagayaAPI) platformUnfreezeHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, err := adminAccount(r, "unfreeze the platform")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := model.UnfreezePlatform(account.Name); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// The exempt routes are named as they are registered, graphql is only registered when enabled
+func TestFreezeExemptRoutesExist(t *testing.T) {
+	names := map[string]bool{"graphql": true}
+	for _, route := range (&SetagayaAPI{}).InitRoutes() {
+		names[route.Name] = true
+	}
+	for name := range freezeExemptRoutes {
+		assert.True(t, names[name], name)
+	}
+}
+
+func TestRefuseWhenFrozen(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {}
+	routes := Routes{
+		&Route{"get_collection", "GET", "/api/collections/:collection_id", handler},
+		&Route{"stop", "POST", "/api/collections/:collection_id/stop", handler},
+		&Route{"trigger", "POST", "/api/collections/:collection_id/trigger", handler},
+		&Route{"delete_collection", "DELETE", "/api/collections/:collection_id", handler},
+	}
+	(&SetagayaAPI{}).refuseWhenFrozen(routes)
+	wrapped := map[string]bool{}
+	for _, route := range routes {
+		wrapped[route.Name] = reflect.ValueOf(route.HandlerFunc).Pointer() != reflect.ValueOf(handler).Pointer()
+	}
+	assert.Equal(t, map[string]bool{"get_collection": false, "stop": false, "trigger": true,
+		"delete_collection": true}, wrapped)
+}
+
+// The bulk status of the collections is a POST, it's still answered while the platform is frozen
+func TestCollectionsStatusWhenFrozen(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	assert.NoError(t, model.FreezePlatform(&model.PlatformFreeze{Reason: "incident", FrozenBy: "admin"}))
+	s := &SetagayaAPI{}
+	handler := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {}
+	routes := Routes{
+		&Route{"collections_status", "POST", "/api/collections/:collection_id", s.collectionsStatusHandler},
+		&Route{"trigger", "POST", "/api/collections/:collection_id/trigger", handler},
+	}
+	s.refuseWhenFrozen(routes)
+	router := httprouter.New()
+	for _, route := range routes {
+		router.Handle(route.Method, route.Path, route.HandlerFunc)
+	}
+
+	// The ids are checked, the request is not refused by the freeze
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/collections/status",
+		strings.NewReader(`{"collection_ids": []}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/collections/1/trigger", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
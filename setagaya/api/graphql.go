@@ -0,0 +1,466 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A small GraphQL implementation for the read API of the UI. It runs the queries with their aliases, arguments and
+// variables. The fragments, the directives, the mutations and the introspection are not supported. The queries are
+// parsed once graphQLLimits checked their size and their depth.
+
+type gqlTokenKind int
+
+const (
+	gqlEOF gqlTokenKind = iota
+	gqlPunct
+	gqlName
+	gqlInt
+	gqlFloat
+	gqlString
+)
+
+func isGQLNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+type gqlToken struct {
+	kind  gqlTokenKind
+	value string
+	pos   int
+}
+
+func gqlLex(query string) ([]gqlToken, error) {
+	tokens := []gqlToken{}
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], "..."):
+			return nil, fmt.Errorf("fragments are not supported, at %d", i)
+		case strings.ContainsRune("{}():$![]=@", rune(c)):
+			tokens = append(tokens, gqlToken{kind: gqlPunct, value: string(c), pos: i})
+			i++
+		case isGQLNameStart(c):
+			start := i
+			for i < len(query) && (isGQLNameStart(query[i]) || query[i] >= '0' && query[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: gqlName, value: query[start:i], pos: start})
+		case c == '-' || c >= '0' && c <= '9':
+			start := i
+			kind := gqlInt
+			i++
+			for i < len(query) && strings.ContainsRune("0123456789.eE+-", rune(query[i])) {
+				if strings.ContainsRune(".eE", rune(query[i])) {
+					kind = gqlFloat
+				}
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: kind, value: query[start:i], pos: start})
+		case c == '"':
+			start := i
+			i++
+			for i < len(query) && query[i] != '"' {
+				if query[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(query) {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			s, err := strconv.Unquote(query[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d", start)
+			}
+			tokens = append(tokens, gqlToken{kind: gqlString, value: s, pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+		}
+	}
+	return append(tokens, gqlToken{kind: gqlEOF, pos: len(query)}), nil
+}
+
+// gqlSelection is a field asked for in the query
+type gqlSelection struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	selections []*gqlSelection
+}
+
+// gqlVariable is the name of a variable given as an argument, its value is known when the query is run
+type gqlVariable string
+
+type gqlParser struct {
+	tokens []gqlToken
+	i      int
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.i]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.i]
+	if t.kind != gqlEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *gqlParser) isPunct(value string) bool {
+	t := p.peek()
+	return t.kind == gqlPunct && t.value == value
+}
+
+func (p *gqlParser) expect(value string) error {
+	t := p.next()
+	if t.kind != gqlPunct || t.value != value {
+		return fmt.Errorf("expected %s at %d", value, t.pos)
+	}
+	return nil
+}
+
+func (p *gqlParser) name() (string, error) {
+	t := p.next()
+	if t.kind != gqlName {
+		return "", fmt.Errorf("expected a name at %d", t.pos)
+	}
+	return t.value, nil
+}
+
+// parseGraphQL returns the selections of the query, which is the only operation of the document
+func parseGraphQL(query string) ([]*gqlSelection, error) {
+	tokens, err := gqlLex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &gqlParser{tokens: tokens}
+	if t := p.peek(); t.kind == gqlName {
+		if t.value != "query" {
+			return nil, fmt.Errorf("only queries are supported, got %s", t.value)
+		}
+		p.next()
+		if p.peek().kind == gqlName {
+			p.next()
+		}
+		if p.isPunct("(") {
+			if err := p.skipVariableDefinitions(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != gqlEOF {
+		return nil, fmt.Errorf("only one operation is supported, unexpected %q at %d", t.value, t.pos)
+	}
+	return selections, nil
+}
+
+// skipVariableDefinitions skips ($id: Int!, ...), the variables are taken as they are given
+func (p *gqlParser) skipVariableDefinitions() error {
+	depth := 0
+	for {
+		t := p.next()
+		switch {
+		case t.kind == gqlEOF:
+			return fmt.Errorf("unterminated variable definitions")
+		case t.kind == gqlPunct && t.value == "(":
+			depth++
+		case t.kind == gqlPunct && t.value == ")":
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+}
+
+func (p *gqlParser) selectionSet() ([]*gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	selections := []*gqlSelection{}
+	for !p.isPunct("}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, s)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("a selection cannot be empty")
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) selection() (*gqlSelection, error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	s := &gqlSelection{alias: name, name: name, args: map[string]interface{}{}}
+	if p.isPunct(":") {
+		p.next()
+		if s.name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.isPunct("(") {
+		p.next()
+		for !p.isPunct(")") {
+			arg, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if s.args[arg], err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+	}
+	if p.isPunct("@") {
+		return nil, fmt.Errorf("directives are not supported, at %d", p.peek().pos)
+	}
+	if p.isPunct("{") {
+		if s.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *gqlParser) value() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case gqlInt:
+		return strconv.ParseInt(t.value, 10, 64)
+	case gqlFloat:
+		return strconv.ParseFloat(t.value, 64)
+	case gqlString:
+		return t.value, nil
+	case gqlName:
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// An enum value
+		return t.value, nil
+	case gqlPunct:
+		switch t.value {
+		case "$":
+			name, err := p.name()
+			return gqlVariable(name), err
+		case "[":
+			list := []interface{}{}
+			for !p.isPunct("]") {
+				v, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a value at %d", t.pos)
+}
+
+// gqlType is an object of the schema. A field without a type is a scalar.
+type gqlType struct {
+	name   string
+	fields map[string]*gqlField
+}
+
+type gqlField struct {
+	typ     *gqlType
+	resolve func(r *http.Request, source interface{}, args map[string]interface{}) (interface{}, error)
+}
+
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+	// The code of the error, like in the responses of the REST API
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+func makeGQLError(err error, path []interface{}) *gqlError {
+	msg, _ := errorMessage(err)
+	return &gqlError{Message: msg.Message, Path: path, Extensions: map[string]string{"code": msg.Code}}
+}
+
+// gqlObject keeps the fields in the order they are asked for, as GraphQL requires
+type gqlObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *gqlObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBufferString("{")
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type gqlExecution struct {
+	r         *http.Request
+	variables map[string]interface{}
+	errors    []*gqlError
+}
+
+func (e *gqlExecution) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, makeGQLError(err, append([]interface{}{}, path...)))
+}
+
+// resolveArgs replaces the variables given as arguments by their values
+func (e *gqlExecution) resolveArgs(args map[string]interface{}) (map[string]interface{}, error) {
+	resolved := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		if name, ok := v.(gqlVariable); ok {
+			value, ok := e.variables[string(name)]
+			if !ok {
+				return nil, makeInvalidRequestError(fmt.Sprintf("variable $%s is not given", name))
+			}
+			v = value
+		}
+		resolved[k] = v
+	}
+	return resolved, nil
+}
+
+// executeObject resolves the selections on the source, an object of the type. A field failing to resolve is null
+// and its error is reported along with the data.
+func (e *gqlExecution) executeObject(typ *gqlType, source interface{}, selections []*gqlSelection,
+	path []interface{}) *gqlObject {
+	o := &gqlObject{values: map[string]interface{}{}}
+	for _, s := range selections {
+		fieldPath := append(path, s.alias)
+		if s.name == "__typename" {
+			o.set(s.alias, typ.name)
+			continue
+		}
+		field, ok := typ.fields[s.name]
+		if !ok {
+			e.fail(fieldPath, makeInvalidRequestError(fmt.Sprintf("%s has no field %s", typ.name, s.name)))
+			o.set(s.alias, nil)
+			continue
+		}
+		if field.typ == nil && len(s.selections) > 0 {
+			e.fail(fieldPath, makeInvalidRequestError(fmt.Sprintf("%s of %s has no fields", s.name, typ.name)))
+			o.set(s.alias, nil)
+			continue
+		}
+		if field.typ != nil && len(s.selections) == 0 {
+			e.fail(fieldPath, makeInvalidRequestError(fmt.Sprintf("the fields of %s of %s should be selected", s.name,
+				typ.name)))
+			o.set(s.alias, nil)
+			continue
+		}
+		args, err := e.resolveArgs(s.args)
+		if err != nil {
+			e.fail(fieldPath, err)
+			o.set(s.alias, nil)
+			continue
+		}
+		value, err := field.resolve(e.r, source, args)
+		if err != nil {
+			e.fail(fieldPath, err)
+			o.set(s.alias, nil)
+			continue
+		}
+		if field.typ == nil {
+			o.set(s.alias, value)
+			continue
+		}
+		o.set(s.alias, e.executeValue(field.typ, value, s.selections, fieldPath))
+	}
+	return o
+}
+
+// executeValue resolves the selections on an object, or on every object of a list
+func (e *gqlExecution) executeValue(typ *gqlType, value interface{}, selections []*gqlSelection,
+	path []interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() || (v.Kind() == reflect.Ptr || v.Kind() == reflect.Slice) && v.IsNil() {
+		if v.IsValid() && v.Kind() == reflect.Slice {
+			return []interface{}{}
+		}
+		return nil
+	}
+	if v.Kind() != reflect.Slice {
+		return e.executeObject(typ, value, selections, path)
+	}
+	list := make([]interface{}, v.Len())
+	for i := range list {
+		list[i] = e.executeValue(typ, v.Index(i).Interface(), selections, append(path, i))
+	}
+	return list
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLResponse struct {
+	Data   interface{} `json:"data"`
+	Errors []*gqlError `json:"errors,omitempty"`
+}
+
+// executeGraphQL runs the query on the root type of the schema
+func executeGraphQL(r *http.Request, root *gqlType, req *graphQLRequest) *graphQLResponse {
+	selections, err := parseGraphQL(req.Query)
+	if err != nil {
+		return &graphQLResponse{Errors: []*gqlError{makeGQLError(wrapInvalidRequestError(err), nil)}}
+	}
+	e := &gqlExecution{r: r, variables: req.Variables}
+	data := e.executeObject(root, nil, selections, nil)
+	return &graphQLResponse{Data: data, Errors: e.errors}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// The limits of the GraphQL queries are checked before the queries are parsed, by their text, so they keep protecting
+// the server whichever implementation runs the queries.
+
+const (
+	// The size in bytes of a query at most
+	maxGraphQLQuerySize = 16 * 1024
+	// How deep the selections of a query can be nested at most
+	maxGraphQLDepth = 8
+)
+
+// graphQLLimits rejects the GraphQL requests whose query is too long or nested too deep, before they are run
+func (s *SetagayaAPI) graphQLLimits(next httprouter.Handle) httprouter.Handle {
+	return httprouter.Handle(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 2*maxGraphQLQuerySize))
+		if err != nil {
+			s.handleErrors(w, makeInvalidRequestError("the body should be a GraphQL request"))
+			return
+		}
+		req := new(graphQLRequest)
+		if err := json.Unmarshal(body, req); err != nil {
+			s.handleErrors(w, makeInvalidRequestError("the body should be a GraphQL request"))
+			return
+		}
+		if err := checkGraphQLLimits(req.Query); err != nil {
+			s.handleErrors(w, makeInvalidRequestError(err.Error()))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r, params)
+	})
+}
+
+func checkGraphQLLimits(query string) error {
+	if len(query) > maxGraphQLQuerySize {
+		return fmt.Errorf("the query cannot be longer than %d bytes", maxGraphQLQuerySize)
+	}
+	if graphQLDepth(query) > maxGraphQLDepth {
+		return fmt.Errorf("the query cannot be nested deeper than %d", maxGraphQLDepth)
+	}
+	return nil
+}
+
+// graphQLDepth returns how deep the selection sets of the query are nested. The braces of the strings, of the
+// comments and of the object values of the arguments are not selection sets.
+func graphQLDepth(query string) int {
+	depth, deepest, args := 0, 0, 0
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(query[i:], `"""`):
+			end := strings.Index(query[i+3:], `"""`)
+			if end < 0 {
+				return deepest
+			}
+			i += end + 5
+		case c == '"':
+			for i++; i < len(query) && query[i] != '"'; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+		case c == '(':
+			args++
+		case c == ')' && args > 0:
+			args--
+		case c == '{' && args == 0:
+			depth++
+			if depth > deepest {
+				deepest = depth
+			}
+		case c == '}' && args == 0:
+			depth--
+		}
+	}
+	return deepest
+}
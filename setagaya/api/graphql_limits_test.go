@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphQLDepth(t *testing.T) {
+	testCases := []struct {
+		query string
+		depth int
+	}{
+		{`{ shelf { name } }`, 2},
+		{`query Q($id: Int!) { shelf(id: $id) { books(limit: 2) { title } } }`, 3},
+		// Neither the object values of the arguments nor the strings and the comments are selections
+		{`{ shelf(filter: {a: {b: 1}}) { name } }`, 2},
+		{`{ shelf(name: "{{{") { name } }`, 2},
+		{`{ shelf(name: "\"{{") { name } }`, 2},
+		{"{ shelf(name: \"\"\"{ \" {\"\"\") { name } }", 2},
+		{"{ shelf # { {\n { name } }", 2},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.depth, graphQLDepth(tc.query), tc.query)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	s := &SetagayaAPI{}
+	handled := false
+	handler := s.graphQLLimits(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		handled = true
+		// The query is still there for the handler
+		req := new(graphQLRequest)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(req))
+		assert.Equal(t, "{ a }", req.Query)
+	})
+	send := func(query string) *httptest.ResponseRecorder {
+		handled = false
+		body, _ := json.Marshal(&graphQLRequest{Query: query})
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(string(body))), nil)
+		return rr
+	}
+
+	send("{ a }")
+	assert.True(t, handled)
+
+	deep := "{ " + strings.Repeat("a { ", maxGraphQLDepth) + "b" + strings.Repeat(" }", maxGraphQLDepth+1)
+	rr := send(deep)
+	assert.False(t, handled)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "cannot be nested deeper")
+
+	rr = send("{ a " + strings.Repeat("#", maxGraphQLQuerySize) + "\n }")
+	assert.False(t, handled)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "cannot be longer")
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/api/graphql",
+		strings.NewReader(strings.Repeat(" ", 3*maxGraphQLQuerySize))), nil)
+	assert.False(t, handled)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,194 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// The schema of the GraphQL read API. Its types and fields are named like the JSON of the REST API.
+var (
+	gqlPlanType = &gqlType{name: "Plan", fields: map[string]*gqlField{
+		"id":           gqlScalar(func(p *model.Plan) interface{} { return p.ID }),
+		"name":         gqlScalar(func(p *model.Plan) interface{} { return p.Name }),
+		"project_id":   gqlScalar(func(p *model.Plan) interface{} { return p.ProjectID }),
+		"description":  gqlScalar(func(p *model.Plan) interface{} { return p.Description }),
+		"created_time": gqlScalar(func(p *model.Plan) interface{} { return p.CreatedTime }),
+	}}
+	gqlRunType = &gqlType{name: "Run", fields: map[string]*gqlField{
+		"id":            gqlScalar(func(r *model.RunHistory) interface{} { return r.ID }),
+		"collection_id": gqlScalar(func(r *model.RunHistory) interface{} { return r.CollectionID }),
+		"started_time":  gqlScalar(func(r *model.RunHistory) interface{} { return r.StartedTime }),
+		"end_time":      gqlScalar(func(r *model.RunHistory) interface{} { return r.EndTime }),
+	}}
+	gqlExecutionPlanType = &gqlType{name: "ExecutionPlan", fields: map[string]*gqlField{
+		"plan_id":     gqlScalar(func(ep *model.ExecutionPlan) interface{} { return ep.PlanID }),
+		"name":        gqlScalar(func(ep *model.ExecutionPlan) interface{} { return ep.Name }),
+		"engines":     gqlScalar(func(ep *model.ExecutionPlan) interface{} { return ep.Engines }),
+		"concurrency": gqlScalar(func(ep *model.ExecutionPlan) interface{} { return ep.Concurrency }),
+		"rampup":      gqlScalar(func(ep *model.ExecutionPlan) interface{} { return ep.Rampup }),
+		"rampdown":    gqlScalar(func(ep *model.ExecutionPlan) interface{} { return ep.Rampdown }),
+		"duration":    gqlScalar(func(ep *model.ExecutionPlan) interface{} { return ep.Duration }),
+		"plan": {typ: gqlPlanType, resolve: gqlResolver(func(_ *http.Request, ep *model.ExecutionPlan,
+			_ map[string]interface{}) (interface{}, error) {
+			return model.GetPlan(ep.PlanID)
+		})},
+	}}
+	gqlCollectionType = &gqlType{name: "Collection", fields: map[string]*gqlField{
+		"id":           gqlScalar(func(c *model.Collection) interface{} { return c.ID }),
+		"name":         gqlScalar(func(c *model.Collection) interface{} { return c.Name }),
+		"project_id":   gqlScalar(func(c *model.Collection) interface{} { return c.ProjectID }),
+		"description":  gqlScalar(func(c *model.Collection) interface{} { return c.Description }),
+		"created_time": gqlScalar(func(c *model.Collection) interface{} { return c.CreatedTime }),
+		"csv_split":    gqlScalar(func(c *model.Collection) interface{} { return c.CSVSplit }),
+		"execution_plans": {typ: gqlExecutionPlanType, resolve: gqlResolver(func(_ *http.Request,
+			c *model.Collection, _ map[string]interface{}) (interface{}, error) {
+			return c.GetExecutionPlans()
+		})},
+		"runs": {typ: gqlRunType, resolve: gqlResolver(func(_ *http.Request, c *model.Collection,
+			args map[string]interface{}) (interface{}, error) {
+			limit, ok, err := gqlIntArg(args, "limit")
+			if err != nil {
+				return nil, err
+			}
+			runs, err := c.GetRuns()
+			if err != nil {
+				return nil, err
+			}
+			// The latest runs come first
+			if ok && limit >= 0 && int(limit) < len(runs) {
+				runs = runs[:limit]
+			}
+			return runs, nil
+		})},
+	}}
+	gqlProjectType = &gqlType{name: "Project", fields: map[string]*gqlField{
+		"id":           gqlScalar(func(p *model.Project) interface{} { return p.ID }),
+		"name":         gqlScalar(func(p *model.Project) interface{} { return p.Name }),
+		"owner":        gqlScalar(func(p *model.Project) interface{} { return p.Owner }),
+		"sid":          gqlScalar(func(p *model.Project) interface{} { return p.SID }),
+		"description":  gqlScalar(func(p *model.Project) interface{} { return p.Description }),
+		"created_time": gqlScalar(func(p *model.Project) interface{} { return p.CreatedTime }),
+		"collections": {typ: gqlCollectionType, resolve: gqlResolver(func(_ *http.Request, p *model.Project,
+			_ map[string]interface{}) (interface{}, error) {
+			return p.GetCollections()
+		})},
+		"plans": {typ: gqlPlanType, resolve: gqlResolver(func(_ *http.Request, p *model.Project,
+			_ map[string]interface{}) (interface{}, error) {
+			return p.GetPlans()
+		})},
+	}}
+	gqlQueryType = &gqlType{name: "Query", fields: map[string]*gqlField{
+		"projects": {typ: gqlProjectType, resolve: func(r *http.Request, _ interface{},
+			_ map[string]interface{}) (interface{}, error) {
+			account, ok := r.Context().Value(accountKey).(*model.Account)
+			if !ok {
+				return nil, makeInvalidRequestError("account")
+			}
+			return model.GetProjectsByOwners(account.ML)
+		}},
+		"project": {typ: gqlProjectType, resolve: func(r *http.Request, _ interface{},
+			args map[string]interface{}) (interface{}, error) {
+			account, ok := r.Context().Value(accountKey).(*model.Account)
+			if !ok {
+				return nil, makeInvalidRequestError("account")
+			}
+			id, err := gqlIDArg(args)
+			if err != nil {
+				return nil, err
+			}
+			project, err := getProject(id)
+			if err != nil {
+				return nil, err
+			}
+			if !hasProjectOwnership(project, account) {
+				return nil, makeProjectOwnershipError()
+			}
+			return project, nil
+		}},
+		"collection": {typ: gqlCollectionType, resolve: gqlByID("collection_id", func(r *http.Request,
+			params httprouter.Params) (interface{}, error) {
+			return hasCollectionOwnership(r, params)
+		})},
+		"plan": {typ: gqlPlanType, resolve: gqlByID("plan_id", func(r *http.Request,
+			params httprouter.Params) (interface{}, error) {
+			return hasPlanOwnership(r, params)
+		})},
+	}}
+)
+
+// gqlScalar makes a scalar field of the objects of type T
+func gqlScalar[T any](get func(T) interface{}) *gqlField {
+	return &gqlField{resolve: func(_ *http.Request, source interface{}, _ map[string]interface{}) (interface{}, error) {
+		return get(source.(T)), nil
+	}}
+}
+
+// gqlResolver makes the resolver of a field of the objects of type T
+func gqlResolver[T any](resolve func(*http.Request, T, map[string]interface{}) (interface{}, error)) func(
+	*http.Request, interface{}, map[string]interface{}) (interface{}, error) {
+	return func(r *http.Request, source interface{}, args map[string]interface{}) (interface{}, error) {
+		return resolve(r, source.(T), args)
+	}
+}
+
+// gqlByID resolves the object with the id argument by the ownership check of the REST API, which reads the id from
+// the params of the route
+func gqlByID(param string, get func(*http.Request, httprouter.Params) (interface{}, error)) func(*http.Request,
+	interface{}, map[string]interface{}) (interface{}, error) {
+	return func(r *http.Request, _ interface{}, args map[string]interface{}) (interface{}, error) {
+		id, err := gqlIDArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return get(r, httprouter.Params{{Key: param, Value: id}})
+	}
+}
+
+// gqlIntArg returns the integer argument. The variables decoded from JSON are float64.
+func gqlIntArg(args map[string]interface{}, name string) (int64, bool, error) {
+	v, ok := args[name]
+	if !ok || v == nil {
+		return 0, false, nil
+	}
+	switch n := v.(type) {
+	case int64:
+		return n, true, nil
+	case float64:
+		if n == float64(int64(n)) {
+			return int64(n), true, nil
+		}
+	}
+	return 0, false, makeInvalidRequestError(fmt.Sprintf("%s should be an integer", name))
+}
+
+func gqlIDArg(args map[string]interface{}) (string, error) {
+	if s, ok := args["id"].(string); ok {
+		return s, nil
+	}
+	id, ok, err := gqlIntArg(args, "id")
+	if err != nil || !ok {
+		return "", makeInvalidRequestError("id is required")
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+// graphQLHandler runs the GraphQL queries of the UI, which gets the nested views like a project with its
+// collections and their runs in one request. The objects are only returned to the owners, like by the REST API.
+func (s *SetagayaAPI) graphQLHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	req := new(graphQLRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("the body should be a GraphQL request"))
+		return
+	}
+	if req.Query == "" {
+		s.handleErrors(w, makeInvalidRequestError("query"))
+		return
+	}
+	s.jsonise(w, http.StatusOK, executeGraphQL(r, gqlQueryType, req))
+}
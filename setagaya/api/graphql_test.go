@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBook struct {
+	ID    int64
+	Title string
+}
+
+type testShelf struct {
+	Name  string
+	Books []*testBook
+}
+
+func testLibrarySchema() *gqlType {
+	book := &gqlType{name: "Book", fields: map[string]*gqlField{
+		"id":    gqlScalar(func(b *testBook) interface{} { return b.ID }),
+		"title": gqlScalar(func(b *testBook) interface{} { return b.Title }),
+	}}
+	shelf := &gqlType{name: "Shelf", fields: map[string]*gqlField{
+		"name": gqlScalar(func(s *testShelf) interface{} { return s.Name }),
+		"books": {typ: book, resolve: gqlResolver(func(_ *http.Request, s *testShelf,
+			args map[string]interface{}) (interface{}, error) {
+			limit, ok, err := gqlIntArg(args, "limit")
+			if err != nil {
+				return nil, err
+			}
+			if ok && int(limit) < len(s.Books) {
+				return s.Books[:limit], nil
+			}
+			return s.Books, nil
+		})},
+		"owner": {resolve: func(*http.Request, interface{}, map[string]interface{}) (interface{}, error) {
+			return nil, makeNoPermissionErr("the owner is private")
+		}},
+	}}
+	shelves := map[string]*testShelf{
+		"1": {Name: "go", Books: []*testBook{{1, "The Go Programming Language"}, {2, "Concurrency in Go"}}},
+	}
+	return &gqlType{name: "Query", fields: map[string]*gqlField{
+		"shelf": {typ: shelf, resolve: func(_ *http.Request, _ interface{},
+			args map[string]interface{}) (interface{}, error) {
+			id, err := gqlIDArg(args)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := shelves[id]
+			if !ok {
+				return nil, errors.New("shelf not found")
+			}
+			return s, nil
+		}},
+	}}
+}
+
+func runTestQuery(t *testing.T, query string, variables map[string]interface{}) string {
+	r := httptest.NewRequest(http.MethodPost, "/api/graphql", nil)
+	resp := executeGraphQL(r, testLibrarySchema(), &graphQLRequest{Query: query, Variables: variables})
+	b, err := json.Marshal(resp)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestGraphQLQuery(t *testing.T) {
+	got := runTestQuery(t, `
+		# The first book of the shelf
+		query FirstBook($shelf: Int!) {
+			shelf(id: $shelf) {
+				__typename
+				name
+				first: books(limit: 1) { title id }
+			}
+		}`, map[string]interface{}{"shelf": float64(1)})
+	assert.Equal(t, `{"data":{"shelf":{"__typename":"Shelf","name":"go",`+
+		`"first":[{"title":"The Go Programming Language","id":1}]}}}`, got)
+
+	got = runTestQuery(t, `{ shelf(id: "1") { books { id } } }`, nil)
+	assert.Equal(t, `{"data":{"shelf":{"books":[{"id":1},{"id":2}]}}}`, got)
+}
+
+func TestGraphQLFieldErrors(t *testing.T) {
+	// The fields failing are null, the others are still returned
+	got := runTestQuery(t, `{ shelf(id: 1) { name owner color } missing: shelf(id: 2) { name } }`, nil)
+	assert.Equal(t, `{"data":{"shelf":{"name":"go","owner":null,"color":null},"missing":null},"errors":[`+
+		`{"message":"403-the owner is private","path":["shelf","owner"],"extensions":{"code":"SETAGAYA_ERR_NO_PERMISSION"}},`+
+		`{"message":"400-Shelf has no field color","path":["shelf","color"],"extensions":{"code":"SETAGAYA_ERR_INVALID_REQUEST"}},`+
+		`{"message":"shelf not found","path":["missing"],"extensions":{"code":"SETAGAYA_ERR_INTERNAL"}}]}`, got)
+
+	got = runTestQuery(t, `{ shelf(id: 1) { books } }`, nil)
+	assert.Contains(t, got, "the fields of books of Shelf should be selected")
+	got = runTestQuery(t, `{ shelf(id: 1) { name { length } } }`, nil)
+	assert.Contains(t, got, "name of Shelf has no fields")
+	got = runTestQuery(t, `{ shelf(id: $id) { name } }`, nil)
+	assert.Contains(t, got, "variable $id is not given")
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	testCases := []struct {
+		query string
+		err   string
+	}{
+		{`mutation { deleteShelf(id: 1) }`, "only queries are supported"},
+		{`{ shelf { ...Books } }`, "fragments are not supported"},
+		{`{ shelf @include(if: true) { name } }`, "directives are not supported"},
+		{`{ shelf { name }`, "expected a name"},
+		{`{ }`, "a selection cannot be empty"},
+		{`{ a } { b }`, "only one operation is supported"},
+		{`{ shelf(id: "1) { name } }`, "unterminated string"},
+	}
+	for _, tc := range testCases {
+		_, err := parseGraphQL(tc.query)
+		if assert.Error(t, err, tc.query) {
+			assert.Contains(t, err.Error(), tc.err, tc.query)
+		}
+	}
+}
+
+func TestParseGraphQL(t *testing.T) {
+	selections, err := parseGraphQL(`{ recent: runs(limit: 5, ids: [1, 2], name: "a\"b", ok: true, state: RUNNING) { id } }`)
+	assert.NoError(t, err)
+	if assert.Len(t, selections, 1) {
+		s := selections[0]
+		assert.Equal(t, "recent", s.alias)
+		assert.Equal(t, "runs", s.name)
+		assert.Equal(t, map[string]interface{}{"limit": int64(5), "ids": []interface{}{int64(1), int64(2)},
+			"name": `a"b`, "ok": true, "state": "RUNNING"}, s.args)
+		assert.Len(t, s.selections, 1)
+	}
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const (
+	maxCallbackURLLength = 1024
+	jobCallbackTimeout   = 10 * time.Second
+)
+
+// discardWriter is the client of the operations run as jobs. Their response is only recorded
+type discardWriter struct {
+	header http.Header
+}
+
+func (dw *discardWriter) Header() http.Header {
+	return dw.header
+}
+
+func (dw *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (dw *discardWriter) WriteHeader(int) {}
+
+var errCallbackAddress = errors.New("callback url should not point to a private, loopback or link-local address")
+
+// lookupCallbackHost resolves the hosts of the callback urls
+var lookupCallbackHost = net.DefaultResolver.LookupIPAddr
+
+// callbackClient posts the finished jobs to their callback url. The address is checked again when it's dialled, so
+// a host resolving to another address after its url was validated cannot reach the private network either, and
+// neither can the redirects. The callbacks do not go through the proxy, the addresses it connects to cannot be checked.
+var callbackClient = &http.Client{
+	Transport: makeCallbackTransport(),
+}
+
+func makeCallbackTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = dialCallback
+	return t
+}
+
+// publicCallbackIP tells whether the callbacks can be posted to the address. They are not posted to the
+// platform, to its cluster or to the metadata servers of the cloud providers.
+func publicCallbackIP(ip net.IP) bool {
+	return !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// checkCallbackAddress is the control of the connections of the callbacks, it's called with the address being
+// connected to once the host is resolved
+func checkCallbackAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicCallbackIP(ip) {
+		return errCallbackAddress
+	}
+	return nil
+}
+
+func dialCallback(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: jobCallbackTimeout}
+	if !config.SC.HttpConfig.CallbackHostAllowed(host) {
+		dialer.Control = checkCallbackAddress
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func validateCallbackURL(ctx context.Context, callbackURL string) error {
+	if len(callbackURL) > maxCallbackURLLength {
+		return errors.New("callback url is too long")
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("callback url should be a http(s) url")
+	}
+	host := u.Hostname()
+	if config.SC.HttpConfig.CallbackHostAllowed(host) {
+		return nil
+	}
+	// Rejected right away when we can tell, the address is checked again when the callback is posted
+	addrs, err := lookupCallbackHost(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve the host of the callback url: %s", host)
+	}
+	for _, addr := range addrs {
+		if !publicCallbackIP(addr.IP) {
+			return errCallbackAddress
+		}
+	}
+	return nil
+}
+
+// makeJobOutcome turns the response of an operation into the result of its job. Errors are responded as a
+// JSONMessage, their message becomes the error of the job.
+func makeJobOutcome(statusCode int, body []byte) (json.RawMessage, string) {
+	body = bytes.TrimSpace(body)
+	if statusCode >= 400 {
+		msg := new(JSONMessage)
+		if err := json.Unmarshal(body, msg); err == nil && msg.Message != "" {
+			return nil, msg.Message
+		}
+		return nil, string(body)
+	}
+	if len(body) == 0 || !json.Valid(body) {
+		return nil, ""
+	}
+	return json.RawMessage(body), ""
+}
+
+// async runs the operation in the background when the request asks for it with async=true, for the clients
+// that would time out waiting for it. The client gets the job with a 202 right away and polls it at
+// /api/jobs/:job_id until it's finished. When a callback_url is given, the finished job is also posted to it.
+func (s *SetagayaAPI) async(kind string, next httprouter.Handle) httprouter.Handle {
+	return httprouter.Handle(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		qs := r.URL.Query()
+		if qs.Get("async") != "true" {
+			next(w, r, params)
+			return
+		}
+		callbackURL := qs.Get("callback_url")
+		if callbackURL != "" {
+			if err := validateCallbackURL(r.Context(), callbackURL); err != nil {
+				s.handleErrors(w, makeInvalidRequestError(err.Error()))
+				return
+			}
+		}
+		collection, err := hasCollectionOwnership(r, params)
+		if err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		if err := model.RequireFeature(config.FeatureAsyncJobs, collection.ProjectID); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		// The body is closed once we responded, so the operation gets a copy of it
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.handleErrors(w, makeInvalidRequestError("failed to read the request"))
+			return
+		}
+		job, err := model.CreateJob(collection.ID, kind, callbackURL)
+		if err != nil {
+			s.handleErrors(w, makeInternalServerError(err.Error()))
+			return
+		}
+		// The operation outlives the request, so it must not be cancelled with it
+		req := r.Clone(context.WithoutCancel(r.Context()))
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		go s.runJob(job, next, req, params)
+		w.Header().Set("Location", fmt.Sprintf("/api/jobs/%d", job.ID))
+		s.jsonise(w, http.StatusAccepted, job)
+	})
+}
+
+func (s *SetagayaAPI) runJob(job *model.Job, next httprouter.Handle, r *http.Request, params httprouter.Params) {
+	rr := &responseRecorder{ResponseWriter: &discardWriter{header: http.Header{}}}
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("Job %d panicked: %v", job.ID, p)
+				rr.status = http.StatusInternalServerError
+				rr.body.Reset()
+			}
+		}()
+		next(rr, r, params)
+	}()
+	result, errMessage := makeJobOutcome(rr.statusCode(), rr.body.Bytes())
+	if err := job.Finish(rr.statusCode(), result, errMessage); err != nil {
+		log.Printf("Error finishing job %d: %v", job.ID, err)
+	}
+	log.Printf("Job %d to %s collection %d is %s", job.ID, job.Kind, job.CollectionID, job.Status)
+	if job.CallbackURL != "" {
+		if err := postJobCallback(job); err != nil {
+			log.Printf("Error calling back for job %d: %v", job.ID, err)
+		}
+	}
+}
+
+func postJobCallback(job *model.Job) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), jobCallbackTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := callbackClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *SetagayaAPI) jobGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	job, err := hasJobOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, job)
+}
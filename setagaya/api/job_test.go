@@ -0,0 +1,153 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// stubCallbackHosts resolves the hosts of the callback urls with the addresses given
+func stubCallbackHosts(t *testing.T, hosts map[string]string) {
+	lookup := lookupCallbackHost
+	t.Cleanup(func() { lookupCallbackHost = lookup })
+	lookupCallbackHost = func(_ context.Context, host string) ([]net.IPAddr, error) {
+		if ip := net.ParseIP(host); ip != nil {
+			return []net.IPAddr{{IP: ip}}, nil
+		}
+		addr, ok := hosts[host]
+		if !ok {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return []net.IPAddr{{IP: net.ParseIP(addr)}}, nil
+	}
+}
+
+// allowCallbackHosts allows the hosts to receive the callbacks from a private network
+func allowCallbackHosts(t *testing.T, hosts ...string) {
+	hc := config.SC.HttpConfig
+	t.Cleanup(func() { config.SC.HttpConfig = hc })
+	config.SC.HttpConfig = &config.HttpConfig{CallbackAllowedHosts: hosts}
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	stubCallbackHosts(t, map[string]string{
+		"ci.example.com":     "93.184.216.34",
+		"localhost.":         "127.0.0.1",
+		"ci.internal":        "10.0.3.7",
+		"rebind.example.com": "127.0.0.1",
+	})
+	ctx := context.Background()
+	assert.NoError(t, validateCallbackURL(ctx, "https://ci.example.com/hooks/setagaya?build=1"))
+	assert.NoError(t, validateCallbackURL(ctx, "http://ci.example.com:8080/hook"))
+
+	invalid := []string{
+		"ftp://ci.example.com/hook",
+		"ci.example.com/hook",
+		"https://",
+		"https://ci.example.com/" + strings.Repeat("a", maxCallbackURLLength),
+		"https://unknown.example.com/hook",
+	}
+	for _, callbackURL := range invalid {
+		assert.Error(t, validateCallbackURL(ctx, callbackURL), callbackURL)
+	}
+
+	// The platform and its network are not reachable with the callbacks
+	private := []string{
+		"http://127.0.0.1:8080/api/admin",
+		"http://localhost.:8080/api/admin",
+		"http://[::1]/hook",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[fe80::1]/hook",
+		"http://0.0.0.0/hook",
+		"https://ci.internal/hook",
+		"https://rebind.example.com/hook",
+	}
+	for _, callbackURL := range private {
+		assert.ErrorIs(t, validateCallbackURL(ctx, callbackURL), errCallbackAddress, callbackURL)
+	}
+
+	// Unless the config allows them
+	allowCallbackHosts(t, "ci.internal")
+	assert.NoError(t, validateCallbackURL(ctx, "https://ci.internal/hook"))
+}
+
+func TestPostJobCallback(t *testing.T) {
+	posted := make(chan *model.Job, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job := new(model.Job)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(job))
+		posted <- job
+	}))
+	defer server.Close()
+	job := &model.Job{ID: 3, Kind: "deploy", CallbackURL: server.URL + "/hook"}
+
+	// The address is checked when it's dialled, whatever the host resolved to when the url was validated
+	assert.ErrorIs(t, postJobCallback(job), errCallbackAddress)
+	assert.Empty(t, posted)
+
+	allowCallbackHosts(t, "127.0.0.1")
+	assert.NoError(t, postJobCallback(job))
+	select {
+	case p := <-posted:
+		assert.Equal(t, int64(3), p.ID)
+	default:
+		t.Fatal("the job was not posted")
+	}
+}
+
+func TestMakeJobOutcome(t *testing.T) {
+	result, errMessage := makeJobOutcome(http.StatusOK, []byte(`{"id":1}`+"\n"))
+	assert.JSONEq(t, `{"id":1}`, string(result))
+	assert.Empty(t, errMessage)
+
+	// Operations responding with no content
+	result, errMessage = makeJobOutcome(http.StatusOK, nil)
+	assert.Nil(t, result)
+	assert.Empty(t, errMessage)
+
+	body, _ := json.Marshal(&JSONMessage{Message: "400-invalid collection_id"})
+	result, errMessage = makeJobOutcome(http.StatusBadRequest, body)
+	assert.Nil(t, result)
+	assert.Equal(t, "400-invalid collection_id", errMessage)
+
+	_, errMessage = makeJobOutcome(http.StatusBadGateway, []byte("bad gateway"))
+	assert.Equal(t, "bad gateway", errMessage)
+}
+
+func TestAsyncWithoutAsyncParam(t *testing.T) {
+	api := &SetagayaAPI{}
+	called := false
+	handler := api.async("deploy", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+	req := httptest.NewRequest("POST", "/api/collections/1/deploy", nil)
+	w := httptest.NewRecorder()
+	handler(w, req, httprouter.Params{})
+	// The operation is run in the request when it's not asked to be async
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAsyncInvalidCallbackURL(t *testing.T) {
+	api := &SetagayaAPI{}
+	handler := api.async("deploy", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		t.Fatal("the operation should not be run")
+	})
+	req := httptest.NewRequest("POST", "/api/collections/1/deploy?async=true&callback_url=ftp://ci", nil)
+	w := httptest.NewRecorder()
+	handler(w, req, httprouter.Params{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
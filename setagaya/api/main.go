@@ -2,13 +2,16 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -26,23 +29,51 @@ import (
 
 type SetagayaAPI struct {
 	ctr *controller.Controller
+	// Closed when the server shuts down, so the streams end
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
 func NewAPIServer() *SetagayaAPI {
 	c := &SetagayaAPI{
-		ctr: controller.NewController(),
+		ctr:      controller.NewController(),
+		shutdown: make(chan struct{}),
 	}
 	c.ctr.StartRunning()
 	return c
 }
 
+// Shutdown ends the streams with a shutdown event, so their clients reconnect to another API server instead of
+// being cut off. The http server calls it when it starts shutting down, it waits for the streams to end.
+func (s *SetagayaAPI) Shutdown() {
+	s.shutdownOnce.Do(func() {
+		close(s.shutdown)
+	})
+}
+
+// ReadyzHandler reports the health of the dependencies of the platform, with a 503 when any of them is unreachable so
+// the load balancer stops sending requests to this server. It's not authenticated, the probes have no account
+func (s *SetagayaAPI) ReadyzHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+	report := s.ctr.DependencyReport()
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.jsonise(w, status, report)
+}
+
 type JSONMessage struct {
 	Message string `json:"message"`
+	// Code of the error, see error_codes.go. Empty when the response is not an error
+	Code string `json:"code,omitempty"`
 }
 
 func (s *SetagayaAPI) jsonise(w http.ResponseWriter, status int, content interface{}) {
-	w.WriteHeader(status)
+	recordClassifiedRead(w, status, content)
+	// The headers cannot change once they are written
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(content); err != nil {
 		log.Printf("Failed to encode JSON response: %v", err)
 	}
@@ -55,41 +86,43 @@ func (s *SetagayaAPI) makeRespMessage(message string) *JSONMessage {
 }
 
 func (s *SetagayaAPI) makeFailMessage(w http.ResponseWriter, message string, statusCode int) {
-	messageObj := s.makeRespMessage(message)
-	s.jsonise(w, statusCode, messageObj)
+	s.makeCodedFailMessage(w, message, statusErrorCodes[statusCode], statusCode)
+}
+
+func (s *SetagayaAPI) makeCodedFailMessage(w http.ResponseWriter, message, code string, statusCode int) {
+	if instance, ok := problemInstance(w); ok {
+		s.writeProblem(w, makeProblem(message, code, statusCode, instance))
+		return
+	}
+	s.jsonise(w, statusCode, &JSONMessage{Message: message, Code: code})
 }
 
-// handles errors from other packages, like model, scheduler, etc.
+// handles errors from other packages, like model, scheduler, etc., by their sentinel or their kind.
 // unhandle errors will be returned
 func (s *SetagayaAPI) handleErrorsFromExt(w http.ResponseWriter, err error) error {
-	var (
-		dbe                   *model.DBError
-		noResourcesFoundError *scheduler.NoResourcesFoundErr
-	)
-	switch {
-	case errors.As(err, &dbe):
-		s.makeFailMessage(w, dbe.Error(), http.StatusNotFound)
-		return nil
-	case errors.As(err, &noResourcesFoundError):
-		s.makeFailMessage(w, noResourcesFoundError.Message, http.StatusNotFound)
-		return nil
+	status, ok := extErrorStatus(err)
+	if !ok {
+		return err
 	}
-	return err
+	setRetryAfter(w, err)
+	s.makeCodedFailMessage(w, err.Error(), errorCode(err, status), status)
+	return nil
+}
+
+// errorMessage returns the message and the status handleErrors responds with, for the responses gathering the
+// results of several operations
+func errorMessage(err error) (*JSONMessage, int) {
+	status := errorStatus(err)
+	return &JSONMessage{Message: err.Error(), Code: errorCode(err, status)}, status
 }
 
 func (s *SetagayaAPI) handleErrors(w http.ResponseWriter, err error) {
-	unhandledError := s.handleErrorsFromExt(w, err)
-	if unhandledError != nil { // if unhandleError is not nil, it's the same as original error
-		switch {
-		case errors.Is(err, errNoPermission):
-			s.makeFailMessage(w, err.Error(), http.StatusForbidden)
-		case errors.Is(err, errInvalidRequest):
-			s.makeFailMessage(w, err.Error(), http.StatusBadRequest)
-		default:
-			log.Printf("api error: %v", err)
-			s.makeFailMessage(w, err.Error(), http.StatusInternalServerError)
-		}
+	msg, status := errorMessage(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("api error: %v", err)
 	}
+	setRetryAfter(w, err)
+	s.makeCodedFailMessage(w, msg.Message, msg.Code, status)
 }
 
 func (s *SetagayaAPI) projectsGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -149,11 +182,72 @@ func (s *SetagayaAPI) projectGetHandler(w http.ResponseWriter, r *http.Request,
 		s.handleErrors(w, err)
 		return
 	}
+	recordRecentItem(r, model.UserItemProject, project.ID)
 	s.jsonise(w, http.StatusOK, project)
 }
 
-func (s *SetagayaAPI) projectUpdateHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	s.jsonise(w, http.StatusNotImplemented, nil)
+// parseDescription reads the markdown description of a project, a plan or a collection from the form. ok is false
+// when the form has none
+func parseDescription(form url.Values) (description string, ok bool, err error) {
+	if _, ok := form["description"]; !ok {
+		return "", false, nil
+	}
+	description = form.Get("description")
+	if err := model.ValidateDescription(description); err != nil {
+		return "", true, makeInvalidRequestError(err.Error())
+	}
+	return description, true, nil
+}
+
+// parseTeam returns the team of the plan in the form, ok is false when the form does not set it
+func parseTeam(form url.Values) (team string, ok bool, err error) {
+	if _, ok := form["team"]; !ok {
+		return "", false, nil
+	}
+	team = form.Get("team")
+	if err := model.ValidateTeam(team); err != nil {
+		return "", true, makeInvalidRequestError(err.Error())
+	}
+	return team, true, nil
+}
+
+// projectUpdateHandler updates the description of the project
+func (s *SetagayaAPI) projectUpdateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	description, ok, err := parseDescription(r.Form)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if ok {
+		if err := project.SetDescription(description); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		recordProjectActivity(r, project, model.ActivityProjectUpdated, "description")
+	}
+	s.jsonise(w, http.StatusOK, project)
 }
 
 func (s *SetagayaAPI) projectCreateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -180,6 +274,11 @@ func (s *SetagayaAPI) projectCreateHandler(w http.ResponseWriter, r *http.Reques
 		s.handleErrors(w, makeNoPermissionErr(fmt.Sprintf("You are not part of %s", owner)))
 		return
 	}
+	description, _, err := parseDescription(r.Form)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
 	var sid string
 	if config.SC.EnableSid {
 		sid = r.Form.Get("sid")
@@ -202,6 +301,12 @@ func (s *SetagayaAPI) projectCreateHandler(w http.ResponseWriter, r *http.Reques
 		s.handleErrors(w, err)
 		return
 	}
+	if description != "" {
+		if err := project.SetDescription(description); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+	}
 	s.jsonise(w, http.StatusOK, project)
 }
 
@@ -220,13 +325,18 @@ func (s *SetagayaAPI) projectDeleteHandler(w http.ResponseWriter, r *http.Reques
 		s.handleErrors(w, makeProjectOwnershipError())
 		return
 	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
 	collectionIDs, err := project.GetCollections()
 	if err != nil {
 		s.handleErrors(w, err)
 		return
 	}
 	if len(collectionIDs) > 0 {
-		s.handleErrors(w, makeInvalidRequestError("You cannot delete a project that has collections"))
+		s.handleErrors(w, withErrorCode(ErrCodeProjectNotEmpty,
+			makeInvalidRequestError("You cannot delete a project that has collections")))
 		return
 	}
 	planIDs, err := project.GetPlans()
@@ -235,7 +345,8 @@ func (s *SetagayaAPI) projectDeleteHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	if len(planIDs) > 0 {
-		s.handleErrors(w, makeInvalidRequestError("You cannot delete a project that has plans"))
+		s.handleErrors(w, withErrorCode(ErrCodeProjectNotEmpty,
+			makeInvalidRequestError("You cannot delete a project that has plans")))
 		return
 	}
 	if err := project.Delete(); err != nil {
@@ -251,11 +362,46 @@ func (s *SetagayaAPI) planGetHandler(w http.ResponseWriter, r *http.Request, par
 		s.handleErrors(w, err)
 		return
 	}
+	recordRecentItem(r, model.UserItemPlan, plan.ID)
 	s.jsonise(w, http.StatusOK, plan)
 }
 
-func (s *SetagayaAPI) planUpdateHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	s.jsonise(w, http.StatusNotImplemented, nil)
+// planUpdateHandler updates the description of the plan
+func (s *SetagayaAPI) planUpdateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	plan, err := hasPlanOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	description, ok, err := parseDescription(r.Form)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if ok {
+		if err := plan.SetDescription(description); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		recordPlanActivity(r, plan, model.ActivityPlanUpdated, "description")
+	}
+	team, ok, err := parseTeam(r.Form)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if ok {
+		if err := plan.SetTeam(team); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		recordPlanActivity(r, plan, model.ActivityPlanUpdated, "team")
+	}
+	s.jsonise(w, http.StatusOK, plan)
 }
 
 type AdminCollectionResponse struct {
@@ -274,6 +420,203 @@ func (s *SetagayaAPI) collectionAdminGetHandler(w http.ResponseWriter, r *http.R
 	s.jsonise(w, http.StatusOK, acr)
 }
 
+// orphansAdminGetHandler reports what the orphaned resource reaper would do, without deleting anything
+func (s *SetagayaAPI) orphansAdminGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can see the orphaned resources"))
+		return
+	}
+	report, err := s.ctr.ReconcileOrphans(r.Context(), true)
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	s.jsonise(w, http.StatusOK, report)
+}
+
+// storageOrphansAdminGetHandler reports the orphaned files of the object storage, without deleting anything
+func (s *SetagayaAPI) storageOrphansAdminGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can see the orphaned files"))
+		return
+	}
+	report, err := s.ctr.ReconcileStorageOrphans(true)
+	if errors.Is(err, object_storage.ErrListUnsupported) {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	s.jsonise(w, http.StatusOK, report)
+}
+
+// overviewAdminGetHandler summarises the state of the platform for the admins
+func (s *SetagayaAPI) overviewAdminGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can see the overview of the platform"))
+		return
+	}
+	overview, err := s.ctr.Overview(r.Context())
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	s.jsonise(w, http.StatusOK, overview)
+}
+
+// deploymentsAdminGetHandler lists the collections deployed by all the projects, with who they belong to
+func (s *SetagayaAPI) deploymentsAdminGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can see all the deployments"))
+		return
+	}
+	deployments, err := model.GetDeployments()
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	s.jsonise(w, http.StatusOK, deployments)
+}
+
+// collectionAdminStopHandler stops the test of any collection and purges its engines, for when a test is
+// impacting the shared infrastructure. With force=true the collection is force purged.
+func (s *SetagayaAPI) collectionAdminStopHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can stop the collections of other projects"))
+		return
+	}
+	collection, err := getCollection(params.ByName("collection_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+	log.Printf("Admin %s stops collection %d, force: %t", account.Name, collection.ID, force)
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Purge })
+	defer cancel()
+	if force {
+		err = s.ctr.ForcePurgeCollection(ctx, collection)
+	} else {
+		err = s.ctr.TermAndPurgeCollection(ctx, collection)
+	}
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionStopped, "stopped by an admin")
+	s.jsonise(w, http.StatusOK, s.makeRespMessage("Collection stopped and purged"))
+}
+
+// imagePolicyOverrideHandler lets an image digest blocked by the vulnerability policy be deployed
+func (s *SetagayaAPI) imagePolicyOverrideHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can override the vulnerability policy"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	digest := r.Form.Get("digest")
+	if err := model.ValidateImageDigest(digest); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	image := r.Form.Get("image")
+	if image == "" {
+		s.handleErrors(w, makeInvalidRequestError("image cannot be empty"))
+		return
+	}
+	reason := r.Form.Get("reason")
+	if reason == "" {
+		s.handleErrors(w, makeInvalidRequestError("reason cannot be empty"))
+		return
+	}
+	if err := model.CreateImagePolicyOverride(digest, image, account.Name, reason); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	override, err := model.GetImagePolicyOverride(digest)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, override)
+}
+
+func (s *SetagayaAPI) auditLogAdminGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can see the audit log"))
+		return
+	}
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 || n > 1000 {
+			s.handleErrors(w, makeInvalidRequestError("limit should be between 1 and 1000"))
+			return
+		}
+		limit = n
+	}
+	entries, err := model.GetAuditLog(limit)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, entries)
+}
+
+// storageHealthAdminGetHandler probes the object storages and lists the files which are not in sync between them
+func (s *SetagayaAPI) storageHealthAdminGetHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can see the health of the object storage"))
+		return
+	}
+	s.jsonise(w, http.StatusOK, object_storage.CheckHealth(object_storage.Client.Storage))
+}
+
 func (s *SetagayaAPI) planCreateHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	account, ok := r.Context().Value(accountKey).(*model.Account)
 	if !ok {
@@ -294,11 +637,25 @@ func (s *SetagayaAPI) planCreateHandler(w http.ResponseWriter, r *http.Request,
 		s.handleErrors(w, makeProjectOwnershipError())
 		return
 	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
 	name := r.Form.Get("name")
 	if name == "" {
 		s.handleErrors(w, makeInvalidRequestError("plan name cannot be empty"))
 		return
 	}
+	description, _, err := parseDescription(r.Form)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	team, _, err := parseTeam(r.Form)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
 	planID, err := model.CreatePlan(name, project.ID)
 	if err != nil {
 		s.handleErrors(w, err)
@@ -307,7 +664,21 @@ func (s *SetagayaAPI) planCreateHandler(w http.ResponseWriter, r *http.Request,
 	plan, err := model.GetPlan(planID)
 	if err != nil {
 		s.handleErrors(w, err)
+		return
 	}
+	if description != "" {
+		if err := plan.SetDescription(description); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+	}
+	if team != "" {
+		if err := plan.SetTeam(team); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+	}
+	recordPlanActivity(r, plan, model.ActivityPlanCreated, "")
 	s.jsonise(w, http.StatusOK, plan)
 }
 
@@ -331,6 +702,10 @@ func (s *SetagayaAPI) planDeleteHandler(w http.ResponseWriter, r *http.Request,
 		s.handleErrors(w, makeProjectOwnershipError())
 		return
 	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
 	using, err := plan.IsBeingUsed()
 	if err != nil {
 		s.handleErrors(w, err)
@@ -338,13 +713,14 @@ func (s *SetagayaAPI) planDeleteHandler(w http.ResponseWriter, r *http.Request,
 
 	}
 	if using {
-		s.handleErrors(w, makeInvalidRequestError("plan is being used"))
+		s.handleErrors(w, withErrorCode(ErrCodePlanInUse, makeInvalidRequestError("plan is being used")))
 		return
 	}
 	if err := plan.Delete(); err != nil {
 		s.handleErrors(w, err)
 		return
 	}
+	recordPlanActivity(r, plan, model.ActivityPlanDeleted, "")
 }
 
 func (s *SetagayaAPI) planFilesUploadHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -368,11 +744,39 @@ func (s *SetagayaAPI) planFilesUploadHandler(w http.ResponseWriter, r *http.Requ
 		s.handleErrors(w, err)
 		return
 	}
+	recordPlanActivity(r, plan, model.ActivityPlanFileUploaded, handler.Filename)
 	if _, err := w.Write([]byte("success")); err != nil {
 		log.Printf("Error writing success response: %v", err)
 	}
 }
 
+func (s *SetagayaAPI) planParametersUpdateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	plan, err := hasPlanOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	parameters := []*model.PlanParameter{}
+	if err := json.NewDecoder(r.Body).Decode(&parameters); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("invalid parameters"))
+		return
+	}
+	if err := model.ValidatePlanParameters(parameters); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := plan.ValidateTestFileTemplate(parameters); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := plan.StoreParameters(parameters); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordPlanActivity(r, plan, model.ActivityPlanUpdated, "parameters")
+	s.jsonise(w, http.StatusOK, parameters)
+}
+
 func (s *SetagayaAPI) planFilesGetHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
 	s.jsonise(w, http.StatusNotImplemented, nil)
 }
@@ -393,21 +797,90 @@ func (s *SetagayaAPI) collectionFilesUploadHandler(w http.ResponseWriter, r *htt
 	}
 	file, handler, err := r.FormFile("collectionFile")
 	if err != nil {
-		s.handleErrors(w, makeInvalidRequestError("Something wrong with file you uploaded"))
+		s.handleErrors(w, makeInvalidRequestError("Something wrong with file you uploaded"))
+		return
+	}
+	err = collection.StoreFile(file, handler.Filename)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionFileUploaded, handler.Filename)
+	if _, err := w.Write([]byte("success")); err != nil {
+		log.Printf("Error writing success response: %v", err)
+	}
+}
+
+func (s *SetagayaAPI) collectionFilesDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if parseErr := r.ParseForm(); parseErr != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	filename := r.Form.Get("filename")
+	if filename == "" {
+		s.handleErrors(w, makeInvalidRequestError("Collection file name cannot be empty"))
+		return
+	}
+	err = collection.DeleteFile(filename)
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError("Deletion was unsuccessful"))
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionFileDeleted, filename)
+	if _, err := w.Write([]byte("Deleted successfully")); err != nil {
+		log.Printf("Error writing deletion response: %v", err)
+	}
+}
+
+func (s *SetagayaAPI) planFilesDeleteHandler(w http.ResponseWriter, r *http.Request, param httprouter.Params) {
+	plan, err := getPlan(param.ByName("plan_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if parseErr := r.ParseForm(); parseErr != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	filename := r.Form.Get("filename")
+	if filename == "" {
+		s.handleErrors(w, makeInvalidRequestError("plan file name cannot be empty"))
+		return
+	}
+	err = plan.DeleteFile(filename)
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError("Deletetion was unsuccessful"))
+		return
+	}
+	recordPlanActivity(r, plan, model.ActivityPlanFileDeleted, filename)
+	if _, err := w.Write([]byte("Deleted successfully")); err != nil {
+		log.Printf("Error writing deletion response: %v", err)
+	}
+}
+
+// planFileUsageHandler tells what uses a file of the plan, before it's deleted or replaced
+func (s *SetagayaAPI) planFileUsageHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	plan, err := hasPlanOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
 		return
 	}
-	err = collection.StoreFile(file, handler.Filename)
+	usage, err := plan.GetFileUsage(params.ByName("name"))
 	if err != nil {
 		s.handleErrors(w, err)
 		return
 	}
-	if _, err := w.Write([]byte("success")); err != nil {
-		log.Printf("Error writing success response: %v", err)
-	}
+	s.jsonise(w, http.StatusOK, usage)
 }
 
-func (s *SetagayaAPI) collectionFilesDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-	collection, err := hasCollectionOwnership(r, params)
+// planSharedFilesAddHandler makes the plan use a file of the library of its project
+func (s *SetagayaAPI) planSharedFilesAddHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	plan, err := hasPlanOwnership(r, params)
 	if err != nil {
 		s.handleErrors(w, err)
 		return
@@ -418,21 +891,21 @@ func (s *SetagayaAPI) collectionFilesDeleteHandler(w http.ResponseWriter, r *htt
 	}
 	filename := r.Form.Get("filename")
 	if filename == "" {
-		s.handleErrors(w, makeInvalidRequestError("Collection file name cannot be empty"))
+		s.handleErrors(w, makeInvalidRequestError("shared file name cannot be empty"))
 		return
 	}
-	err = collection.DeleteFile(filename)
-	if err != nil {
-		s.handleErrors(w, makeInternalServerError("Deletion was unsuccessful"))
+	if err := plan.ShareFile(filename); err != nil {
+		s.handleErrors(w, err)
 		return
 	}
-	if _, err := w.Write([]byte("Deleted successfully")); err != nil {
-		log.Printf("Error writing deletion response: %v", err)
+	recordPlanActivity(r, plan, model.ActivityPlanUpdated, "uses the shared file "+filename)
+	if _, err := w.Write([]byte("success")); err != nil {
+		log.Printf("Error writing success response: %v", err)
 	}
 }
 
-func (s *SetagayaAPI) planFilesDeleteHandler(w http.ResponseWriter, r *http.Request, param httprouter.Params) {
-	plan, err := getPlan(param.ByName("plan_id"))
+func (s *SetagayaAPI) planSharedFilesDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	plan, err := hasPlanOwnership(r, params)
 	if err != nil {
 		s.handleErrors(w, err)
 		return
@@ -443,14 +916,14 @@ func (s *SetagayaAPI) planFilesDeleteHandler(w http.ResponseWriter, r *http.Requ
 	}
 	filename := r.Form.Get("filename")
 	if filename == "" {
-		s.handleErrors(w, makeInvalidRequestError("plan file name cannot be empty"))
+		s.handleErrors(w, makeInvalidRequestError("shared file name cannot be empty"))
 		return
 	}
-	err = plan.DeleteFile(filename)
-	if err != nil {
-		s.handleErrors(w, makeInternalServerError("Deletetion was unsuccessful"))
+	if err := plan.UnshareFile(filename); err != nil {
+		s.handleErrors(w, err)
 		return
 	}
+	recordPlanActivity(r, plan, model.ActivityPlanUpdated, "stops using the shared file "+filename)
 	if _, err := w.Write([]byte("Deleted successfully")); err != nil {
 		log.Printf("Error writing deletion response: %v", err)
 	}
@@ -481,6 +954,15 @@ func (s *SetagayaAPI) collectionCreateHandler(w http.ResponseWriter, r *http.Req
 		s.handleErrors(w, makeProjectOwnershipError())
 		return
 	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	description, _, err := parseDescription(r.Form)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
 	collectionID, err := model.CreateCollection(collectionName, project.ID)
 	if err != nil {
 		s.handleErrors(w, err)
@@ -491,6 +973,13 @@ func (s *SetagayaAPI) collectionCreateHandler(w http.ResponseWriter, r *http.Req
 		s.handleErrors(w, err)
 		return
 	}
+	if description != "" {
+		if err := collection.SetDescription(description); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionCreated, "")
 	s.jsonise(w, http.StatusOK, collection)
 }
 
@@ -500,8 +989,9 @@ func (s *SetagayaAPI) collectionDeleteHandler(w http.ResponseWriter, r *http.Req
 		s.handleErrors(w, err)
 		return
 	}
-	if s.ctr.Scheduler.PodReadyCount(collection.ID) > 0 {
-		s.handleErrors(w, makeInvalidRequestError("You cannot launch engines when there are engines already deployed"))
+	if s.ctr.Scheduler.PodReadyCount(r.Context(), collection.ID) > 0 {
+		s.handleErrors(w, withErrorCode(ErrCodeEnginesDeployed,
+			makeInvalidRequestError("You cannot launch engines when there are engines already deployed")))
 		return
 	}
 	runningPlans, err := model.GetRunningPlansByCollection(collection.ID)
@@ -510,13 +1000,15 @@ func (s *SetagayaAPI) collectionDeleteHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 	if len(runningPlans) > 0 {
-		s.handleErrors(w, makeInvalidRequestError("You cannot delete the collection during testing period"))
+		s.handleErrors(w, withErrorCode(ErrCodeCollectionRunning,
+			makeInvalidRequestError("You cannot delete the collection during testing period")))
 		return
 	}
 	if err := collection.Delete(); err != nil {
 		s.handleErrors(w, err)
 		return
 	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionDeleted, "")
 }
 
 func (s *SetagayaAPI) collectionGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -532,6 +1024,7 @@ func (s *SetagayaAPI) collectionGetHandler(w http.ResponseWriter, r *http.Reques
 	if runHistories, err := collection.GetRuns(); err == nil {
 		collection.RunHistories = runHistories
 	}
+	recordRecentItem(r, model.UserItemCollection, collection.ID)
 	s.jsonise(w, http.StatusOK, collection)
 }
 
@@ -558,8 +1051,30 @@ func hasInvalidDiff(curr, updated []*model.ExecutionPlan) (bool, string) {
 	return false, ""
 }
 
-func (s *SetagayaAPI) collectionUpdateHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	s.jsonise(w, http.StatusNotImplemented, nil)
+// collectionUpdateHandler updates the description of the collection
+func (s *SetagayaAPI) collectionUpdateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	description, ok, err := parseDescription(r.Form)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if ok {
+		if err := collection.SetDescription(description); err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		recordCollectionActivity(r, collection, model.ActivityCollectionUpdated, "description")
+	}
+	s.jsonise(w, http.StatusOK, collection)
 }
 
 // parseCollectionUpload extracts and validates the uploaded YAML file
@@ -595,6 +1110,56 @@ func (s *SetagayaAPI) validateExecutionPlans(project *model.Project, tests []*mo
 		if ep.Engines <= 0 {
 			return 0, makeInvalidRequestError("You cannot configure a plan with zero engine")
 		}
+		if ep.TargetRPS < 0 {
+			return 0, makeInvalidRequestError("Target RPS cannot be negative")
+		}
+		if err := model.ValidateRegionWeights(ep.Regions, ep.Engines); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if err := scheduler.CheckRegions(s.ctr.Scheduler, ep.Regions); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if err := model.ValidateEngineType(ep.EngineType); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if ep.GetEngineType() == model.PlaywrightEngine {
+			if err := model.RequireFeature(config.FeaturePlaywrightEngine, project.ID); err != nil {
+				return 0, err
+			}
+		}
+		if err := model.ValidateOS(ep.OS, ep.EngineType); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if err := model.ValidateArch(ep.Arch, ep.OS); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if err := model.ValidateNetworkShaping(ep.NetworkShaping, ep.OS, config.SC.ExecutorConfig.NetworkShaper); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if err := model.ValidateDNSCaching(ep.DNSCaching, ep.EngineType); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if err := ep.ApplyConcurrencyDistribution(); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if err := model.ValidateConnectionPolicy(ep.ConnectionPolicy, ep.EngineType, ep.Concurrency); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if ep.GetEngineType() == model.PlaywrightEngine && ep.TargetRPS > 0 {
+			return 0, makeInvalidRequestError("Target RPS is only supported by jmeter plans")
+		}
+		if err := ep.ValidateMaxEngineRPS(); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if err := ep.ValidatePhases(); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
+		if ep.GetEngineType() == model.PlaywrightEngine && ep.Rampdown > 0 {
+			return 0, makeInvalidRequestError("Ramp down is only supported by jmeter plans")
+		}
+		if err := model.ValidateVariables(ep.Variables); err != nil {
+			return 0, makeInvalidRequestError(err.Error())
+		}
 
 		plan, planErr := model.GetPlan(ep.PlanID)
 		if planErr != nil {
@@ -617,23 +1182,24 @@ func (s *SetagayaAPI) validateExecutionPlans(project *model.Project, tests []*mo
 }
 
 // validateCollectionState checks if collection can be modified
-func (s *SetagayaAPI) validateCollectionState(collection *model.Collection, newTests []*model.ExecutionPlan) error {
+func (s *SetagayaAPI) validateCollectionState(ctx context.Context, collection *model.Collection, newTests []*model.ExecutionPlan) error {
 	runningPlans, err := model.GetRunningPlansByCollection(collection.ID)
 	if err != nil {
 		return err
 	}
 
 	if len(runningPlans) > 0 {
-		return makeInvalidRequestError("You cannot change the collection during testing period")
+		return withErrorCode(ErrCodeCollectionRunning,
+			makeInvalidRequestError("You cannot change the collection during testing period"))
 	}
 
-	if s.ctr.Scheduler.PodReadyCount(collection.ID) > 0 {
+	if s.ctr.Scheduler.PodReadyCount(ctx, collection.ID) > 0 {
 		currentPlans, plansErr := collection.GetExecutionPlans()
 		if plansErr != nil {
 			return plansErr
 		}
 		if ok, message := hasInvalidDiff(currentPlans, newTests); ok {
-			return makeInvalidRequestError(message)
+			return withErrorCode(ErrCodeEnginesDeployed, makeInvalidRequestError(message))
 		}
 	}
 
@@ -674,19 +1240,45 @@ func (s *SetagayaAPI) collectionUploadHandler(w http.ResponseWriter, r *http.Req
 	if totalEnginesRequired > config.SC.ExecutorConfig.MaxEnginesInCollection {
 		errMsg := fmt.Sprintf("You are reaching the resource limit of the cluster. Requesting engines: %d, limit: %d.",
 			totalEnginesRequired, config.SC.ExecutorConfig.MaxEnginesInCollection)
-		s.handleErrors(w, makeInvalidRequestError(errMsg))
+		s.handleErrors(w, withErrorCode(ErrCodeEngineLimit, makeInvalidRequestError(errMsg)))
 		return
 	}
 
-	if validateErr := s.validateCollectionState(collection, e.Content.Tests); validateErr != nil {
+	if validateErr := s.validateCollectionState(r.Context(), collection, e.Content.Tests); validateErr != nil {
 		s.handleErrors(w, validateErr)
 		return
 	}
 
-	err = collection.Store(e.Content)
-	if err != nil {
+	if err := e.Content.Continuous.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := e.Content.Soak.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if e.Content.Continuous != nil && e.Content.Soak != nil {
+		s.handleErrors(w, makeInvalidRequestError("a collection cannot be both continuous and soak"))
+		return
+	}
+	if err := model.ValidateVariables(e.Content.Variables); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := model.ValidatePlanDependencies(e.Content.Tests); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if e.Content.Continuous != nil && model.HasPlanDependencies(e.Content.Tests) {
+		s.handleErrors(w, makeInvalidRequestError("the plans of a continuous collection start together in every window"))
+		return
+	}
+
+	if err := collection.Store(e.Content); err != nil {
 		s.handleErrors(w, err)
+		return
 	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionConfigured, "")
 }
 
 func (s *SetagayaAPI) collectionEnginesDetailHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -695,7 +1287,7 @@ func (s *SetagayaAPI) collectionEnginesDetailHandler(w http.ResponseWriter, r *h
 		s.handleErrors(w, err)
 		return
 	}
-	collectionDetails, err := s.ctr.Scheduler.GetCollectionEnginesDetail(collection.ProjectID, collection.ID)
+	collectionDetails, err := s.ctr.Scheduler.GetCollectionEnginesDetail(r.Context(), collection.ProjectID, collection.ID)
 	if err != nil {
 		s.handleErrors(w, err)
 		return
@@ -703,33 +1295,176 @@ func (s *SetagayaAPI) collectionEnginesDetailHandler(w http.ResponseWriter, r *h
 	s.jsonise(w, http.StatusOK, collectionDetails)
 }
 
+// operationContext is the context of an operation driving the engines: it's cancelled when the client goes away or
+// once the timeout of the operation, in seconds, is reached
+func operationContext(r *http.Request, timeout func(*config.OperationTimeouts) int) (context.Context, context.CancelFunc) {
+	seconds := timeout(config.SC.OperationTimeouts.WithDefaults())
+	return context.WithTimeout(r.Context(), time.Duration(seconds)*time.Second)
+}
+
 func (s *SetagayaAPI) collectionDeploymentHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	collection, err := hasCollectionOwnership(r, params)
 	if err != nil {
 		s.handleErrors(w, err)
 		return
 	}
-	if err := s.ctr.DeployCollection(collection); err != nil {
-		var dbe *model.DBError
-		if errors.As(err, &dbe) {
-			s.handleErrors(w, makeInvalidRequestError(err.Error()))
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Deploy })
+	defer cancel()
+	if err := s.ctr.DeployCollection(ctx, collection); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionDeployed, "")
+}
+
+func (s *SetagayaAPI) collectionTriggerHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	tr := new(model.TriggerRequest)
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(tr); err != nil && !errors.Is(err, io.EOF) {
+			s.handleErrors(w, makeInvalidRequestError("invalid trigger request"))
 			return
 		}
-		s.handleErrors(w, makeInternalServerError(err.Error()))
+	}
+	if err := tr.Metadata.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := tr.FailureCapture.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := tr.Attended.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Trigger })
+	defer cancel()
+	runID, err := s.ctr.TriggerCollection(ctx, collection, tr)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionTriggered, fmt.Sprintf("run %d", runID))
+	// The run is returned so clients can poll it by its id rather than guessing it from the list of runs
+	run, err := model.GetRun(runID)
+	if err != nil {
+		s.handleErrors(w, err)
 		return
 	}
+	s.jsonise(w, http.StatusOK, run)
 }
 
-func (s *SetagayaAPI) collectionTriggerHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+func (s *SetagayaAPI) smokeTestHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	planID, err := strconv.ParseInt(params.ByName("plan_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("plan_id"))
+		return
+	}
+	tr := new(model.TriggerRequest)
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(tr); err != nil && !errors.Is(err, io.EOF) {
+			s.handleErrors(w, makeInvalidRequestError("invalid smoke test request"))
+			return
+		}
+	}
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Deploy })
+	defer cancel()
+	if err := s.ctr.SmokeTestPlan(ctx, collection, planID, tr.Parameters); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	st, err := model.GetSmokeTest(collection.ID, planID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusAccepted, st)
+}
+
+func (s *SetagayaAPI) smokeTestGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	planID, err := strconv.ParseInt(params.ByName("plan_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("plan_id"))
+		return
+	}
+	st, err := model.GetSmokeTest(collection.ID, planID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, st)
+}
+
+func (s *SetagayaAPI) debugSessionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	planID, err := strconv.ParseInt(params.ByName("plan_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("plan_id"))
+		return
+	}
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Deploy })
+	defer cancel()
+	if err := s.ctr.StartDebugSession(ctx, collection, planID); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type debugSamplersRequest struct {
+	Samplers   []string          `json:"samplers"`
+	Parameters map[string]string `json:"parameters"`
+}
+
+func (s *SetagayaAPI) debugSamplersHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	collection, err := hasCollectionOwnership(r, params)
 	if err != nil {
 		s.handleErrors(w, err)
 		return
 	}
-	if err := s.ctr.TriggerCollection(collection); err != nil {
+	planID, err := strconv.ParseInt(params.ByName("plan_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("plan_id"))
+		return
+	}
+	dr := new(debugSamplersRequest)
+	if err := json.NewDecoder(r.Body).Decode(dr); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("invalid debug request"))
+		return
+	}
+	if len(dr.Samplers) == 0 {
+		s.handleErrors(w, makeInvalidRequestError("samplers"))
+		return
+	}
+	// A debug execution starts a new jmeter process in the engine, so it outlives the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(4 * time.Minute)); err != nil {
+		log.Printf("Cannot extend the write deadline of the debug request: %v", err)
+	}
+	result, err := s.ctr.DebugSamplers(r.Context(), collection, planID, dr.Samplers, dr.Parameters)
+	if err != nil {
 		s.handleErrors(w, err)
 		return
 	}
+	s.jsonise(w, http.StatusOK, result)
 }
 
 func (s *SetagayaAPI) collectionTermHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -738,10 +1473,90 @@ func (s *SetagayaAPI) collectionTermHandler(w http.ResponseWriter, r *http.Reque
 		s.handleErrors(w, err)
 		return
 	}
-	if err := s.ctr.TermCollection(collection, false); err != nil {
-		s.handleErrors(w, makeInternalServerError(err.Error()))
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Stop })
+	defer cancel()
+	if err := s.ctr.TermCollection(ctx, collection, false); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionStopped, "")
+}
+
+// planTermHandler stops a single running plan of the collection
+func (s *SetagayaAPI) planTermHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	planID, err := strconv.ParseInt(params.ByName("plan_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("plan_id"))
+		return
+	}
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Stop })
+	defer cancel()
+	if err := s.ctr.StopPlan(ctx, collection, planID); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionPlanStopped, fmt.Sprintf("plan %d", planID))
+}
+
+func (s *SetagayaAPI) planRetryHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	planID, err := strconv.ParseInt(params.ByName("plan_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("plan_id"))
+		return
+	}
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Deploy })
+	defer cancel()
+	pr, err := s.ctr.RetryPlan(ctx, collection, planID, account.Name)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionPlanRetried,
+		fmt.Sprintf("plan %d, attempt %d", planID, pr.Attempt))
+	s.jsonise(w, http.StatusAccepted, pr)
+}
+
+// engineReplaceHandler replaces an engine named like in the details of the engines of the collection
+func (s *SetagayaAPI) engineReplaceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
 		return
 	}
+	engineName := params.ByName("engine_id")
+	_, collectionID, planID, engineID, err := scheduler.ParseEngineName(engineName)
+	if err != nil || collectionID != collection.ID {
+		s.handleErrors(w, makeInvalidResourceError("engine_id"))
+		return
+	}
+	restart := r.URL.Query().Get("restart") == "true"
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Deploy })
+	defer cancel()
+	if err := s.ctr.ReplaceEngine(ctx, collection, planID, engineID, restart); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	detail := engineName
+	if restart {
+		detail += ", restarted"
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionEngineReplaced, detail)
+	w.WriteHeader(http.StatusAccepted)
 }
 
 func (s *SetagayaAPI) collectionStatusHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -750,11 +1565,12 @@ func (s *SetagayaAPI) collectionStatusHandler(w http.ResponseWriter, r *http.Req
 		s.handleErrors(w, err)
 		return
 	}
-	collectionStatus, err := s.ctr.CollectionStatus(collection)
+	collectionStatus, err := s.ctr.CollectionStatus(r.Context(), collection)
 	if err != nil {
 		s.handleErrors(w, err)
+		return
 	}
-	s.jsonise(w, http.StatusOK, collectionStatus)
+	s.jsoniseCacheable(w, r, collectionStatus, time.Time{})
 }
 
 func (s *SetagayaAPI) collectionPurgeHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -763,10 +1579,28 @@ func (s *SetagayaAPI) collectionPurgeHandler(w http.ResponseWriter, r *http.Requ
 		s.handleErrors(w, err)
 		return
 	}
-	if err = s.ctr.TermAndPurgeCollection(collection); err != nil {
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Purge })
+	defer cancel()
+	if err = s.ctr.TermAndPurgeCollection(ctx, collection); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionPurged, "")
+}
+
+func (s *SetagayaAPI) collectionForcePurgeHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Purge })
+	defer cancel()
+	if err = s.ctr.ForcePurgeCollection(ctx, collection); err != nil {
 		s.handleErrors(w, err)
 		return
 	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionPurged, "forced")
 }
 
 func (s *SetagayaAPI) planLogHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
@@ -780,13 +1614,13 @@ func (s *SetagayaAPI) planLogHandler(w http.ResponseWriter, r *http.Request, par
 		s.handleErrors(w, makeInvalidResourceError("plan_id"))
 		return
 	}
-	content, err := s.ctr.Scheduler.DownloadPodLog(int64(collectionID), int64(planID))
+	content, err := s.ctr.Scheduler.DownloadPodLog(r.Context(), int64(collectionID), int64(planID))
 	if err != nil {
 		s.handleErrors(w, makeInvalidRequestError(err.Error()))
 		return
 	}
 	m := make(map[string]string)
-	m["c"] = content
+	m["c"] = config.ScrubSecrets(content)
 	s.jsonise(w, http.StatusOK, m)
 }
 
@@ -820,24 +1654,34 @@ func (s *SetagayaAPI) streamCollectionMetrics(w http.ResponseWriter, r *http.Req
 		<-ctx.Done()
 		s.ctr.ApiClosingClients <- item
 	}()
-	for event := range item.StreamClient {
-		if event == nil {
-			continue
-		}
-		s, err := json.Marshal(event)
-		if err != nil {
-			fmt.Fprintf(w, "data:%v\n\n", err)
-		} else {
-			fmt.Fprintf(w, "data:%s\n\n", s)
+	for {
+		select {
+		case <-s.shutdown:
+			writeShutdownEvent(w, flusher)
+			// The controller can be sending an event, it is drained until the client is closed
+			go func() {
+				for range item.StreamClient {
+				}
+			}()
+			return
+		case event, ok := <-item.StreamClient:
+			if !ok {
+				return
+			}
+			if event == nil {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				fmt.Fprintf(w, "data:%v\n\n", err)
+			} else {
+				fmt.Fprintf(w, "data:%s\n\n", data)
+			}
+			flusher.Flush()
 		}
-		flusher.Flush()
 	}
 }
 
-func (s *SetagayaAPI) runGetHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	s.jsonise(w, http.StatusNotImplemented, nil)
-}
-
 func (s *SetagayaAPI) runDeleteHandler(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
 	s.jsonise(w, http.StatusNotImplemented, nil)
 }
@@ -874,6 +1718,22 @@ func (s *SetagayaAPI) InitRoutes() Routes {
 		&Route{"delete_project", "DELETE", "/api/projects/:project_id", s.projectDeleteHandler},
 		&Route{"get_project", "GET", "/api/projects/:project_id", s.projectGetHandler},
 		&Route{"update_project", "PUT", "/api/projects/:project_id", s.projectUpdateHandler},
+		&Route{"get_project_security_context", "GET", "/api/projects/:project_id/security_context", s.projectSecurityContextGetHandler},
+		&Route{"set_project_security_context", "PUT", "/api/projects/:project_id/security_context", s.projectSecurityContextSetHandler},
+		&Route{"delete_project_security_context", "DELETE", "/api/projects/:project_id/security_context", s.projectSecurityContextDeleteHandler},
+		&Route{"get_project_registry", "GET", "/api/projects/:project_id/registry", s.projectRegistryGetHandler},
+		&Route{"set_project_registry", "PUT", "/api/projects/:project_id/registry", s.projectRegistrySetHandler},
+		&Route{"delete_project_registry", "DELETE", "/api/projects/:project_id/registry", s.projectRegistryDeleteHandler},
+		&Route{"get_project_budget", "GET", "/api/projects/:project_id/budget", s.projectBudgetGetHandler},
+		&Route{"set_project_budget", "PUT", "/api/projects/:project_id/budget", s.projectBudgetSetHandler},
+		&Route{"delete_project_budget", "DELETE", "/api/projects/:project_id/budget", s.projectBudgetDeleteHandler},
+		&Route{"get_project_metadata", "GET", "/api/projects/:project_id/metadata", s.projectMetadataGetHandler},
+		&Route{"set_project_metadata", "PUT", "/api/projects/:project_id/metadata", s.projectMetadataSetHandler},
+		&Route{"delete_project_metadata", "DELETE", "/api/projects/:project_id/metadata", s.projectMetadataDeleteHandler},
+		&Route{"get_project_files", "GET", "/api/projects/:project_id/files", s.projectFilesGetHandler},
+		&Route{"upload_project_files", "PUT", "/api/projects/:project_id/files", s.projectFilesUploadHandler},
+		&Route{"delete_project_files", "DELETE", "/api/projects/:project_id/files", s.projectFilesDeleteHandler},
+		&Route{"get_project_activity", "GET", "/api/projects/:project_id/activity", s.projectActivityGetHandler},
 
 		&Route{"create_plan", "POST", "/api/plans", s.planCreateHandler},
 		&Route{"get_plan", "GET", "/api/plans/:plan_id", s.planGetHandler},
@@ -882,6 +1742,13 @@ func (s *SetagayaAPI) InitRoutes() Routes {
 		&Route{"get_plan_files", "GET", "/api/plans/:plan_id/files", s.planFilesGetHandler},
 		&Route{"upload_plan_files", "PUT", "/api/plans/:plan_id/files", s.planFilesUploadHandler},
 		&Route{"delete_plan_files", "DELETE", "/api/plans/:plan_id/files", s.planFilesDeleteHandler},
+		&Route{"get_plan_file_usage", "GET", "/api/plans/:plan_id/files/:name/usage", s.planFileUsageHandler},
+		&Route{"add_plan_shared_files", "PUT", "/api/plans/:plan_id/shared_files", s.planSharedFilesAddHandler},
+		&Route{"delete_plan_shared_files", "DELETE", "/api/plans/:plan_id/shared_files", s.planSharedFilesDeleteHandler},
+		&Route{"update_plan_parameters", "PUT", "/api/plans/:plan_id/parameters", s.planParametersUpdateHandler},
+		&Route{"get_plan_secrets", "GET", "/api/plans/:plan_id/secrets", s.planSecretsGetHandler},
+		&Route{"set_plan_secret", "PUT", "/api/plans/:plan_id/secrets/:name", s.planSecretSetHandler},
+		&Route{"delete_plan_secret", "DELETE", "/api/plans/:plan_id/secrets/:name", s.planSecretDeleteHandler},
 
 		&Route{"create_collection", "POST", "/api/collections", s.collectionCreateHandler},
 		&Route{"delete_collection", "DELETE", "/api/collections/:collection_id", s.collectionDeleteHandler},
@@ -891,33 +1758,135 @@ func (s *SetagayaAPI) InitRoutes() Routes {
 		&Route{"upload_collection_files", "PUT", "/api/collections/:collection_id/files", s.collectionFilesUploadHandler},
 		&Route{"delete_collection_files", "DELETE", "/api/collections/:collection_id/files", s.collectionFilesDeleteHandler},
 		&Route{"get_collection_engines_detail", "GET", "/api/collections/:collection_id/engines_detail", s.collectionEnginesDetailHandler},
-		&Route{"deploy", "POST", "/api/collections/:collection_id/deploy", s.collectionDeploymentHandler},
-		&Route{"trigger", "POST", "/api/collections/:collection_id/trigger", s.collectionTriggerHandler},
-		&Route{"stop", "POST", "/api/collections/:collection_id/stop", s.collectionTermHandler},
-		&Route{"purge", "POST", "/api/collections/:collection_id/purge", s.collectionPurgeHandler},
+		&Route{"deploy", "POST", "/api/collections/:collection_id/deploy", s.async("deploy", s.collectionDeploymentHandler)},
+		&Route{"trigger", "POST", "/api/collections/:collection_id/trigger", s.idempotent("trigger", s.async("trigger", s.collectionTriggerHandler))},
+		&Route{"stop", "POST", "/api/collections/:collection_id/stop", s.idempotent("stop", s.collectionTermHandler)},
+		&Route{"heartbeat", "POST", "/api/collections/:collection_id/heartbeat", s.collectionHeartbeatHandler},
+		&Route{"stop_plan", "POST", "/api/collections/:collection_id/plans/:plan_id/stop", s.planTermHandler},
+		&Route{"retry_plan", "POST", "/api/collections/:collection_id/plans/:plan_id/retry", s.planRetryHandler},
+		&Route{"replace_engine", "POST", "/api/collections/:collection_id/engines/:engine_id/replace", s.engineReplaceHandler},
+		&Route{"smoke_test", "POST", "/api/collections/:collection_id/plans/:plan_id/smoke", s.smokeTestHandler},
+		&Route{"get_smoke_test", "GET", "/api/collections/:collection_id/plans/:plan_id/smoke", s.smokeTestGetHandler},
+		&Route{"create_verification", "POST", "/api/collections/:collection_id/verifications", s.idempotent("verify", s.verificationCreateHandler)},
+		&Route{"get_verification", "GET", "/api/collections/:collection_id/verifications/:verification_id", s.verificationGetHandler},
+		&Route{"get_reservations", "GET", "/api/collections/:collection_id/reservations", s.reservationsGetHandler},
+		&Route{"create_reservation", "POST", "/api/collections/:collection_id/reservations", s.reservationCreateHandler},
+		&Route{"delete_reservation", "DELETE", "/api/collections/:collection_id/reservations/:reservation_id", s.reservationDeleteHandler},
+		&Route{"get_chaos", "GET", "/api/collections/:collection_id/chaos", s.chaosGetHandler},
+		&Route{"set_chaos", "PUT", "/api/collections/:collection_id/chaos", s.chaosSetHandler},
+		&Route{"push_properties", "POST", "/api/collections/:collection_id/properties", s.propertiesPushHandler},
+		&Route{"start_debug_session", "POST", "/api/collections/:collection_id/plans/:plan_id/debug", s.debugSessionHandler},
+		&Route{"debug_samplers", "POST", "/api/collections/:collection_id/plans/:plan_id/debug/samplers", s.debugSamplersHandler},
+		&Route{"purge", "POST", "/api/collections/:collection_id/purge", s.async("purge", s.collectionPurgeHandler)},
+		&Route{"force_purge", "POST", "/api/collections/:collection_id/force-purge", s.collectionForcePurgeHandler},
 		&Route{"get_runs", "GET", "/api/collections/:collection_id/runs", s.runGetHandler},
 		&Route{"get_run", "GET", "/api/collections/:collection_id/runs/:run_id", s.runGetHandler},
+		&Route{"get_run_failures", "GET", "/api/collections/:collection_id/runs/:run_id/failures", s.runFailuresGetHandler},
+		&Route{"get_run_soak", "GET", "/api/collections/:collection_id/runs/:run_id/soak", s.runSoakGetHandler},
+		&Route{"extend_run_soak", "POST", "/api/collections/:collection_id/runs/:run_id/extend", s.runSoakExtendHandler},
+		&Route{"get_run_errors", "GET", "/api/collections/:collection_id/runs/:run_id/errors", s.runErrorsGetHandler},
+		&Route{"export_run", "GET", "/api/collections/:collection_id/runs/:run_id/export", s.runExportHandler},
+		&Route{"get_run_comments", "GET", "/api/collections/:collection_id/runs/:run_id/comments", s.runCommentsGetHandler},
+		&Route{"create_run_comment", "POST", "/api/collections/:collection_id/runs/:run_id/comments", s.runCommentCreateHandler},
+		&Route{"delete_run_comment", "DELETE", "/api/collections/:collection_id/runs/:run_id/comments/:comment_id", s.runCommentDeleteHandler},
+		&Route{"get_run_status_page", "GET", "/api/collections/:collection_id/runs/:run_id/status_page", s.runStatusPageGetHandler},
+		&Route{"create_run_status_page", "POST", "/api/collections/:collection_id/runs/:run_id/status_page", s.runStatusPageCreateHandler},
+		&Route{"delete_run_status_page", "DELETE", "/api/collections/:collection_id/runs/:run_id/status_page", s.runStatusPageDeleteHandler},
+		&Route{"get_run_share_links", "GET", "/api/collections/:collection_id/runs/:run_id/share_links", s.runShareLinksGetHandler},
+		&Route{"create_run_share_link", "POST", "/api/collections/:collection_id/runs/:run_id/share_links", s.runShareLinkCreateHandler},
+		&Route{"delete_run_share_link", "DELETE", "/api/collections/:collection_id/runs/:run_id/share_links/:link_id", s.runShareLinkDeleteHandler},
+		&Route{"replay_run", "POST", "/api/collections/:collection_id/runs/:run_id/replay", s.runReplayHandler},
+		&Route{"get_replay", "GET", "/api/collections/:collection_id/replay", s.replayGetHandler},
+		&Route{"stop_replay", "DELETE", "/api/collections/:collection_id/replay", s.replayStopHandler},
+		&Route{"compare_runs", "GET", "/api/collections/:collection_id/compare", s.runCompareHandler},
+		&Route{"get_calibration", "GET", "/api/collections/:collection_id/calibration", s.calibrationGetHandler},
+		&Route{"get_baseline", "GET", "/api/collections/:collection_id/baseline", s.baselineGetHandler},
+		&Route{"set_baseline", "PUT", "/api/collections/:collection_id/baseline", s.baselineSetHandler},
+		&Route{"delete_baseline", "DELETE", "/api/collections/:collection_id/baseline", s.baselineDeleteHandler},
 		&Route{"delete_runs", "DELETE", "/api/collections/:collection_id/runs", s.runDeleteHandler},
 		&Route{"delete_run", "DELETE", "/api/collections/:collection_id/runs/:run_id", s.runDeleteHandler},
 		&Route{"status", "GET", "/api/collections/:collection_id/status", s.collectionStatusHandler},
+		&Route{"collections_status", "POST", "/api/collections/:collection_id", s.collectionsStatusHandler},
 		&Route{"stream", "GET", "/api/collections/:collection_id/stream", s.streamCollectionMetrics},
+		&Route{"deployment_progress", "GET", "/api/collections/:collection_id/deploy/progress", s.deploymentProgressHandler},
 		&Route{"get_plan_log", "GET", "/api/collections/:collection_id/logs/:plan_id", s.planLogHandler},
 		&Route{"upload_collection_config", "PUT", "/api/collections/:collection_id/config", s.collectionUploadHandler},
 		&Route{"get_collection_config", "GET", "/api/collections/:collection_id/config", s.collectionConfigGetHandler},
+		&Route{"get_collection_manifests", "GET", "/api/collections/:collection_id/manifests", s.collectionManifestsHandler},
+
+		&Route{"get_job", "GET", "/api/jobs/:job_id", s.jobGetHandler},
+		&Route{"get_run_engine_config", "GET", "/api/runs/:run_id/engine-config", s.runEngineConfigGetHandler},
+		&Route{"reproduce_run", "POST", "/api/runs/:run_id/reproduce", s.runReproduceHandler},
+		&Route{"get_run_verdict", "GET", "/api/runs/:run_id/verdict", s.runVerdictGetHandler},
 
 		&Route{"files", "GET", "/api/files/:kind/:id/:name", s.fileDownloadHandler},
 
+		&Route{"get_favorites", "GET", "/api/favorites", s.favoritesGetHandler},
+		&Route{"add_favorite", "PUT", "/api/favorites/:kind/:item_id", s.favoriteAddHandler},
+		&Route{"delete_favorite", "DELETE", "/api/favorites/:kind/:item_id", s.favoriteDeleteHandler},
+		&Route{"get_recent_items", "GET", "/api/recent", s.recentItemsGetHandler},
+		&Route{"get_notifications", "GET", "/api/notifications", s.notificationsGetHandler},
+		&Route{"get_capabilities", "GET", "/api/capabilities", s.capabilitiesGetHandler},
+		&Route{"read_notifications", "POST", "/api/notifications/read", s.notificationsReadHandler},
+
+		&Route{"get_calendar", "GET", "/api/calendar", s.calendarGetHandler},
+		&Route{"simulate", "POST", "/api/simulations", s.simulationHandler},
+
 		&Route{"usage_summary", "GET", "/api/usage/summary", s.usageSummaryHandler},
 		&Route{"usage_summary_by_sid", "GET", "/api/usage/summary_sid", s.usageSummaryHandlerBySid},
 
 		&Route{"admin_collections", "GET", "/api/admin/collections", s.collectionAdminGetHandler},
-	}
+		&Route{"admin_orphans", "GET", "/api/admin/orphans", s.orphansAdminGetHandler},
+		&Route{"admin_storage_orphans", "GET", "/api/admin/storage_orphans", s.storageOrphansAdminGetHandler},
+		&Route{"admin_overview", "GET", "/api/admin/overview", s.overviewAdminGetHandler},
+		&Route{"admin_deployments", "GET", "/api/admin/deployments", s.deploymentsAdminGetHandler},
+		&Route{"admin_stop_collection", "POST", "/api/admin/collections/:collection_id/stop", s.stepUp(s.async("stop", s.collectionAdminStopHandler))},
+		&Route{"admin_create_tenant", "POST", "/api/admin/tenants", s.stepUp(s.tenantCreateHandler)},
+		&Route{"admin_move_tenant_storage", "POST", "/api/admin/tenants/:tenant_id/storage_region", s.stepUp(s.tenantStorageRegionHandler)},
+		&Route{"admin_get_tenant_branding", "GET", "/api/admin/tenants/:tenant_id/branding", s.tenantBrandingGetHandler},
+		&Route{"admin_set_tenant_branding", "PUT", "/api/admin/tenants/:tenant_id/branding", s.tenantBrandingSetHandler},
+		&Route{"admin_delete_tenant_branding", "DELETE", "/api/admin/tenants/:tenant_id/branding", s.tenantBrandingDeleteHandler},
+		&Route{"admin_feature_flags", "GET", "/api/admin/feature_flags", s.featureFlagsAdminGetHandler},
+		&Route{"admin_get_tenant_feature_flags", "GET", "/api/admin/tenants/:tenant_id/feature_flags", s.tenantFeatureFlagsGetHandler},
+		&Route{"admin_set_tenant_feature_flag", "PUT", "/api/admin/tenants/:tenant_id/feature_flags/:flag", s.stepUp(s.tenantFeatureFlagSetHandler)},
+		&Route{"admin_delete_tenant_feature_flag", "DELETE", "/api/admin/tenants/:tenant_id/feature_flags/:flag", s.stepUp(s.tenantFeatureFlagDeleteHandler)},
+		&Route{"admin_override_image_policy", "POST", "/api/admin/image_overrides", s.stepUp(s.imagePolicyOverrideHandler)},
+		&Route{"admin_extend_project_budget", "POST", "/api/admin/projects/:project_id/budget/extensions", s.budgetExtensionHandler},
+		&Route{"admin_audit_log", "GET", "/api/admin/audit", s.auditLogAdminGetHandler},
+		&Route{"admin_enroll_mfa", "POST", "/api/admin/mfa", s.mfaEnrollHandler},
+		&Route{"admin_verify_mfa", "POST", "/api/admin/mfa/verify", s.mfaVerifyHandler},
+		&Route{"admin_reset_mfa", "DELETE", "/api/admin/mfa/:account", s.stepUp(s.mfaResetHandler)},
+		&Route{"admin_storage_health", "GET", "/api/admin/storage/health", s.storageHealthAdminGetHandler},
+		&Route{"admin_get_freeze", "GET", "/api/admin/freeze", s.platformFreezeGetHandler},
+		&Route{"admin_freeze", "PUT", "/api/admin/freeze", s.stepUp(s.platformFreezeHandler)},
+		&Route{"admin_unfreeze", "DELETE", "/api/admin/freeze", s.stepUp(s.platformUnfreezeHandler)},
+	}
+	if config.SC.EnableGraphQL {
+		routes = append(routes, &Route{"graphql", "POST", "/api/graphql", s.graphQLLimits(s.graphQLHandler)})
+	}
+	// Whoever has the link of a status page or a share link can see it, without an account. The UI reads the
+	// branding before the users log in
+	public := Routes{
+		&Route{"bootstrap", "GET", "/api/bootstrap", s.bootstrapHandler},
+		&Route{"run_status_page", "GET", "/status/:token", s.statusPageHandler},
+		&Route{"shared_run", "GET", "/share/:token", s.sharedRunHandler},
+		&Route{"shared_run_summary", "GET", "/share/:token/summary", s.sharedRunSummaryHandler},
+	}
+	// Before authRequired wraps them, so the reads are recorded and the calls are counted by user
+	auditClassifiedReads(routes)
+	s.refuseWhenFrozen(routes)
+	markReads(routes)
+	markDeprecated(append(append(Routes{}, routes...), public...), config.SC.Deprecations)
 	for _, r := range routes {
 		// TODO! We don't require auth for usage endpoint for now.
-		if strings.Contains(r.Path, "usage") {
+		if strings.HasPrefix(r.Path, "/api/usage/") {
 			continue
 		}
 		r.HandlerFunc = s.authRequired(r.HandlerFunc)
 	}
+	routes = append(routes, public...)
+	for _, r := range routes {
+		r.HandlerFunc = s.problemDetails(r.HandlerFunc)
+	}
 	return routes
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
@@ -12,6 +13,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/hveda/Setagaya/setagaya/controller"
 	"github.com/hveda/Setagaya/setagaya/model"
 	"github.com/hveda/Setagaya/setagaya/scheduler"
 )
@@ -502,6 +504,18 @@ func TestSetagayaAPI_NewAPIServer_Safe(t *testing.T) {
 	assert.NotNil(t, api.ctr)
 }
 
+func TestReadyzHandler(t *testing.T) {
+	// Nothing was checked yet
+	api := &SetagayaAPI{ctr: &controller.Controller{}}
+	recorder := httptest.NewRecorder()
+	api.ReadyzHandler(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil), nil)
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "no-store", recorder.Header().Get("Cache-Control"))
+	report := new(controller.DependencyReport)
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(report))
+	assert.False(t, report.Ready)
+}
+
 // Test jsonise function with various scenarios
 func TestSetagayaAPI_Jsonise(t *testing.T) {
 	api := &SetagayaAPI{}
@@ -836,3 +850,23 @@ func TestSetagayaAPI_handleErrors_WithSchedulerError(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "No compute resources available", response.Message)
 }
+
+func TestParseDescription(t *testing.T) {
+	description, ok, err := parseDescription(url.Values{})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "", description)
+
+	description, ok, err = parseDescription(url.Values{"description": {"# Checkout"}})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "# Checkout", description)
+
+	// An empty description clears it
+	_, ok, err = parseDescription(url.Values{"description": {""}})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, _, err = parseDescription(url.Values{"description": {strings.Repeat("a", model.MaxDescriptionSize+1)}})
+	assert.True(t, errors.Is(err, errInvalidRequest))
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/auth"
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// The scripts send a code with every destructive request instead of verifying it first
+const stepUpCodeHeader = "Setagaya-OTP"
+
+type stepUpResponse struct {
+	VerifiedUntil time.Time `json:"verified_until"`
+}
+
+func adminAccount(r *http.Request, action string) (*model.Account, error) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		return nil, makeInvalidRequestError("account")
+	}
+	if !account.IsAdmin() {
+		return nil, makeNoPermissionErr("Only admins can " + action)
+	}
+	return account, nil
+}
+
+// stepUpVerifiedAt is when the admin of the session last entered a valid code, zero when they did not
+func stepUpVerifiedAt(r *http.Request) time.Time {
+	session, err := auth.SessionStore.Get(r, config.SC.AuthConfig.SessionKey)
+	if err != nil {
+		return time.Time{}
+	}
+	if verified, ok := session.Values[auth.StepUpKey].(int64); ok {
+		return time.Unix(verified, 0)
+	}
+	return time.Time{}
+}
+
+// verifyStepUpCode checks the code against the confirmed secret of the account
+func verifyStepUpCode(account *model.Account, code string, confirmed bool) error {
+	m, err := model.GetAccountMFA(account.Name)
+	if err != nil {
+		return err
+	}
+	if m == nil || (confirmed && !m.Confirmed) {
+		return makeNoPermissionErr("Enroll a TOTP secret before the destructive actions")
+	}
+	return m.Verify(code, time.Now())
+}
+
+// stepUp asks the admins for a TOTP code before the destructive action, on top of their login. The code is sent
+// with the request, or was verified by the session within the window of the config. Every action let through is
+// recorded in the audit log. It does nothing when the step-up is not configured, or without authentication.
+func (s *SetagayaAPI) stepUp(next httprouter.Handle) httprouter.Handle {
+	return httprouter.Handle(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		ac := config.SC.AuthConfig
+		if ac.StepUp == nil || ac.NoAuth {
+			next(w, r, params)
+			return
+		}
+		account, ok := r.Context().Value(accountKey).(*model.Account)
+		if !ok {
+			s.handleErrors(w, makeInvalidRequestError("account"))
+			return
+		}
+		how := "session"
+		if code := r.Header.Get(stepUpCodeHeader); code != "" {
+			if err := verifyStepUpCode(account, code, true); err != nil {
+				s.handleErrors(w, err)
+				return
+			}
+			how = "code"
+		} else if time.Since(stepUpVerifiedAt(r)) > ac.StepUp.WindowDuration() {
+			s.handleErrors(w, model.ErrStepUpRequired)
+			return
+		}
+		if err := model.RecordStepUp(account.Name, r.Method+" "+r.URL.Path, how); err != nil {
+			log.Printf("Error recording the step-up of %s: %v", account.Name, err)
+		}
+		next(w, r, params)
+	})
+}
+
+// mfaEnrollHandler draws the TOTP secret of the admin. It's confirmed by the first code verified
+func (s *SetagayaAPI) mfaEnrollHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, err := adminAccount(r, "enroll a TOTP secret")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	enrollment, err := model.EnrollMFA(account.Name)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, enrollment)
+}
+
+// mfaVerifyHandler verifies a code of the admin. The destructive actions of the session need no other code within
+// the window
+func (s *SetagayaAPI) mfaVerifyHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, err := adminAccount(r, "verify a TOTP code")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	ac := config.SC.AuthConfig
+	if ac.StepUp == nil || ac.NoAuth {
+		s.handleErrors(w, makeInvalidRequestError("the step-up is not enabled"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	if err := verifyStepUpCode(account, r.Form.Get("code"), false); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	session, err := auth.SessionStore.Get(r, ac.SessionKey)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	now := time.Now()
+	session.Values[auth.StepUpKey] = now.Unix()
+	if err := session.Save(r, w); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, &stepUpResponse{VerifiedUntil: now.Add(ac.StepUp.WindowDuration())})
+}
+
+// mfaResetHandler deletes the TOTP secret of an admin who lost it, so they can enroll again
+func (s *SetagayaAPI) mfaResetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, err := adminAccount(r, "reset the TOTP secrets")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := model.ResetMFA(account.Name, params.ByName("account")); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
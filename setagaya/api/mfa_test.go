@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestStepUpSkipped(t *testing.T) {
+	ac := config.SC.AuthConfig
+	stepUp, noAuth := ac.StepUp, ac.NoAuth
+	defer func() { ac.StepUp, ac.NoAuth = stepUp, noAuth }()
+
+	s := &SetagayaAPI{}
+	called := false
+	handler := s.stepUp(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) { called = true })
+
+	// Not configured
+	ac.StepUp, ac.NoAuth = nil, false
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/admin/tenants", nil), nil)
+	assert.True(t, called)
+
+	// Without authentication, there is no admin to ask a code to
+	called = false
+	ac.StepUp, ac.NoAuth = &config.StepUpConfig{}, true
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/admin/tenants", nil), nil)
+	assert.True(t, called)
+	assert.Equal(t, config.DefaultStepUpWindow*60, int(ac.StepUp.WindowDuration().Seconds()))
+}
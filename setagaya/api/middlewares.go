@@ -1,10 +1,12 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/hveda/Setagaya/setagaya/model"
 )
@@ -15,6 +17,12 @@ const (
 	accountKey contextKey = "account"
 )
 
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// Set on the responses replayed for a key used already
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
 func authWithSession(r *http.Request) (*model.Account, error) {
 	account := model.GetAccountBySession(r)
 	if account == nil {
@@ -32,6 +40,96 @@ func (s *SetagayaAPI) authRequired(next httprouter.Handle) httprouter.Handle {
 			s.handleErrors(w, err)
 			return
 		}
+		setAccessLogUser(r, account.Name)
 		next(w, r.WithContext(context.WithValue(r.Context(), accountKey, account)), params)
 	})
 }
+
+// responseRecorder keeps a copy of the response sent to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// statusCode returns the status of the response. Handlers writing nothing respond with 200
+func (rr *responseRecorder) statusCode() int {
+	if rr.status == 0 {
+		return http.StatusOK
+	}
+	return rr.status
+}
+
+// idempotent makes the operation on a collection safe to retry. The response to the first request sent with an
+// Idempotency-Key header is stored and returned again to the requests with the same key, without handling them,
+// e.g. a CI job retrying a trigger does not deploy the engines twice. Requests without the header are handled as usual.
+func (s *SetagayaAPI) idempotent(operation string, next httprouter.Handle) httprouter.Handle {
+	return httprouter.Handle(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next(w, r, params)
+			return
+		}
+		if len(key) > model.MaxIdempotencyKeyLength {
+			s.handleErrors(w, makeInvalidRequestError("idempotency key is too long"))
+			return
+		}
+		// Stored responses are only returned to the owners of the collection
+		collection, err := hasCollectionOwnership(r, params)
+		if err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		stored, err := model.ReserveIdempotencyKey(collection.ID, operation, key)
+		if err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		if stored != nil {
+			w.Header().Set(idempotentReplayedHeader, "true")
+			if len(stored.Body) > 0 {
+				w.Header().Set("Content-Type", "application/json")
+			}
+			w.WriteHeader(stored.StatusCode)
+			if _, err := w.Write(stored.Body); err != nil {
+				log.Printf("Failed to write the stored response: %v", err)
+			}
+			return
+		}
+		rr := &responseRecorder{ResponseWriter: w}
+		next(rr, r, params)
+		// Server errors are not stored, so a retry gets another chance
+		if rr.statusCode() >= http.StatusInternalServerError {
+			if err := model.ReleaseIdempotencyKey(collection.ID, operation, key); err != nil {
+				log.Printf("Error releasing idempotency key of collection %d: %v", collection.ID, err)
+			}
+			return
+		}
+		resp := &model.IdempotentResponse{
+			StatusCode: rr.statusCode(),
+			Body:       rr.body.Bytes(),
+		}
+		if err := model.CompleteIdempotencyKey(collection.ID, operation, key, resp); err != nil {
+			log.Printf("Error storing the response of idempotency key of collection %d: %v", collection.ID, err)
+		}
+	})
+}
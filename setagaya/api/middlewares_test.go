@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseRecorder(t *testing.T) {
+	api := &SetagayaAPI{}
+	w := httptest.NewRecorder()
+	rr := &responseRecorder{ResponseWriter: w}
+	api.jsonise(rr, http.StatusCreated, &JSONMessage{Message: "created"})
+
+	assert.Equal(t, http.StatusCreated, rr.statusCode())
+	assert.JSONEq(t, `{"message":"created"}`, rr.body.String())
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, rr.body.String(), w.Body.String())
+
+	// Handlers writing nothing respond with 200
+	rr = &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	assert.Equal(t, http.StatusOK, rr.statusCode())
+}
+
+func TestIdempotentWithoutKey(t *testing.T) {
+	api := &SetagayaAPI{}
+	calls := 0
+	handler := api.idempotent("trigger", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/api/collections/1/trigger", nil)
+		handler(httptest.NewRecorder(), req, httprouter.Params{})
+	}
+	// Requests without a key are all handled
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotentKeyTooLong(t *testing.T) {
+	api := &SetagayaAPI{}
+	handler := api.idempotent("trigger", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		t.Fatal("the request should not be handled")
+	})
+	req := httptest.NewRequest("POST", "/api/collections/1/trigger", nil)
+	req.Header.Set(idempotencyKeyHeader, strings.Repeat("k", 256))
+	w := httptest.NewRecorder()
+	handler(w, req, httprouter.Params{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -1,10 +1,13 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/hveda/Setagaya/setagaya/config"
 	"github.com/hveda/Setagaya/setagaya/model"
 )
 
@@ -17,6 +20,82 @@ func hasProjectOwnership(project *model.Project, account *model.Account) bool {
 	return true
 }
 
+// The routes that only read though they are not GETs, the viewers of a tenant can still call them. graphql only
+// answers queries
+var readRoutes = map[string]bool{
+	"collections_status": true,
+	"graphql":            true,
+}
+
+const readKey contextKey = "read"
+
+// markReads has the requests of the read routes known as reads by checkTenantRole
+func markReads(routes Routes) {
+	for _, route := range routes {
+		if !readRoutes[route.Name] {
+			continue
+		}
+		next := route.HandlerFunc
+		route.HandlerFunc = func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+			next(w, r.WithContext(context.WithValue(r.Context(), readKey, true)), params)
+		}
+	}
+}
+
+func isRead(r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	read, _ := r.Context().Value(readKey).(bool)
+	return read
+}
+
+// checkTenantRole only lets the members and the admins of the tenant of the project change it, its plans, its
+// collections and their runs, once rbac_enforcement is on for the tenant. The viewers can still read them.
+func checkTenantRole(r *http.Request, project *model.Project, account *model.Account) error {
+	if isRead(r) || account.IsAdmin() {
+		return nil
+	}
+	tenant, err := model.GetTenantByProject(project.ID)
+	if err != nil || tenant == nil {
+		return err
+	}
+	enforced, err := model.FeatureEnabled(config.FeatureRBACEnforcement, tenant)
+	if err != nil || !enforced {
+		return err
+	}
+	assignments, err := tenant.GetRoleAssignments()
+	if err != nil {
+		return err
+	}
+	if !model.CanChange(assignments, account) {
+		return makeNoPermissionErr("Only the members and the admins of tenant " + tenant.Name + " can change it")
+	}
+	return nil
+}
+
+func hasPlanOwnership(r *http.Request, params httprouter.Params) (*model.Plan, error) {
+	plan, err := getPlan(params.ByName("plan_id"))
+	if err != nil {
+		return nil, err
+	}
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		return nil, makeInvalidRequestError("account")
+	}
+	project, err := model.GetProject(plan.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		return nil, makeProjectOwnershipError()
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
 func hasCollectionOwnership(r *http.Request, params httprouter.Params) (*model.Collection, error) {
 	collection, err := getCollection(params.ByName("collection_id"))
 	if err != nil {
@@ -33,5 +112,68 @@ func hasCollectionOwnership(r *http.Request, params httprouter.Params) (*model.C
 	if r := hasProjectOwnership(project, account); !r {
 		return nil, makeCollectionOwnershipError()
 	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		return nil, err
+	}
 	return collection, nil
 }
+
+func hasJobOwnership(r *http.Request, params httprouter.Params) (*model.Job, error) {
+	jobID, err := strconv.ParseInt(params.ByName("job_id"), 10, 64)
+	if err != nil {
+		return nil, makeInvalidResourceError("job_id")
+	}
+	job, err := model.GetJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		return nil, makeInvalidRequestError("account")
+	}
+	collection, err := model.GetCollection(job.CollectionID)
+	if err != nil {
+		return nil, err
+	}
+	project, err := model.GetProject(collection.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		return nil, makeCollectionOwnershipError()
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func hasRunOwnership(r *http.Request, params httprouter.Params) (*model.RunHistory, error) {
+	runID, err := strconv.ParseInt(params.ByName("run_id"), 10, 64)
+	if err != nil {
+		return nil, makeInvalidResourceError("run_id")
+	}
+	run, err := model.GetRun(runID)
+	if err != nil {
+		return nil, &model.DBError{Err: err, Message: "run not found"}
+	}
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		return nil, makeInvalidRequestError("account")
+	}
+	collection, err := model.GetCollection(run.CollectionID)
+	if err != nil {
+		return nil, err
+	}
+	project, err := model.GetProject(collection.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		return nil, makeCollectionOwnershipError()
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
@@ -1,10 +1,18 @@
 package api
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/hveda/Setagaya/setagaya/config"
 	"github.com/hveda/Setagaya/setagaya/model"
 )
 
@@ -212,3 +220,88 @@ func TestHasProjectOwnershipEdgeCases(t *testing.T) {
 		assert.IsType(t, bool(false), result)
 	})
 }
+
+// Under rbac_enforcement, owning the project through a mailing list is not enough to change it, the account needs a
+// role of the tenant letting it change it
+func TestViewerCannotChangeTheProject(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	ac := config.SC.AuthConfig
+	defer func() { config.SC.AuthConfig = ac }()
+	config.SC.AuthConfig = &config.AuthConfig{AdminUsers: []string{"root"}, LdapConfig: &config.LdapConfig{}}
+
+	projectID, err := model.CreateProject("checkout", "perf-team", "")
+	assert.NoError(t, err)
+	tenant, err := model.CreateTenant("perf", "perf-team", "setagaya-perf", "alice", "", &model.TenantQuota{})
+	assert.NoError(t, err)
+	assert.NoError(t, tenant.SetFeatureFlag(config.FeatureRBACEnforcement, true))
+	project := &model.Project{ID: projectID, Owner: "perf-team"}
+	viewer := &model.Account{Name: "bob", MLMap: map[string]interface{}{"perf-team": nil}}
+	member := &model.Account{Name: "alice", MLMap: map[string]interface{}{"perf-team": nil}}
+
+	assert.NoError(t, checkTenantRole(httptest.NewRequest(http.MethodGet, "/", nil), project, viewer))
+	assert.Error(t, checkTenantRole(httptest.NewRequest(http.MethodDelete, "/", nil), project, viewer))
+	assert.NoError(t, checkTenantRole(httptest.NewRequest(http.MethodDelete, "/", nil), project, member))
+
+	form := url.Values{"project_id": {strconv.FormatInt(projectID, 10)}, "name": {"browse"}}
+	req := httptest.NewRequest(http.MethodPost, "/api/plans", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req = req.WithContext(context.WithValue(req.Context(), accountKey, viewer))
+	rec := httptest.NewRecorder()
+	(&SetagayaAPI{}).planCreateHandler(rec, req, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+// The read routes are named as they are registered, graphql is only registered when enabled
+func TestReadRoutesExist(t *testing.T) {
+	names := map[string]bool{"graphql": true}
+	for _, route := range (&SetagayaAPI{}).InitRoutes() {
+		names[route.Name] = true
+	}
+	for name := range readRoutes {
+		assert.True(t, names[name], name)
+	}
+}
+
+// The bulk status of the collections is a POST, the viewers can still read the status of the collections with it
+func TestViewerReadsTheCollectionsStatus(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	ac := config.SC.AuthConfig
+	defer func() { config.SC.AuthConfig = ac }()
+	config.SC.AuthConfig = &config.AuthConfig{AdminUsers: []string{"root"}, LdapConfig: &config.LdapConfig{}}
+
+	projectID, err := model.CreateProject("checkout", "perf-team", "")
+	assert.NoError(t, err)
+	collectionID, err := model.CreateCollection("nightly", projectID)
+	assert.NoError(t, err)
+	tenant, err := model.CreateTenant("perf", "perf-team", "setagaya-perf", "alice", "", &model.TenantQuota{})
+	assert.NoError(t, err)
+	assert.NoError(t, tenant.SetFeatureFlag(config.FeatureRBACEnforcement, true))
+	viewer := &model.Account{Name: "bob", MLMap: map[string]interface{}{"perf-team": nil}}
+
+	owned := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		_, err := hasCollectionOwnership(r, httprouter.Params{
+			{Key: "collection_id", Value: strconv.FormatInt(collectionID, 10)},
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}
+	routes := Routes{
+		&Route{"collections_status", "POST", "/api/collections/:collection_id", owned},
+		&Route{"trigger", "POST", "/api/collections/:collection_id/trigger", owned},
+	}
+	markReads(routes)
+	router := httprouter.New()
+	for _, route := range routes {
+		router.Handle(route.Method, route.Path, route.HandlerFunc)
+	}
+	post := func(path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), accountKey, viewer))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, post("/api/collections/status"))
+	assert.Equal(t, http.StatusForbidden, post("/api/collections/1/trigger"))
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func (s *SetagayaAPI) planSecretsGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	plan, err := hasPlanOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	secrets, err := plan.GetSecrets()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, secrets)
+}
+
+// planSecretSetHandler stores a secret of the plan, encrypted. Its value is write only, the API never returns it
+func (s *SetagayaAPI) planSecretSetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	plan, err := hasPlanOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	var body struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("invalid secret"))
+		return
+	}
+	account := r.Context().Value(accountKey).(*model.Account)
+	secret := &model.PlanSecret{PlanID: plan.ID, Name: params.ByName("name"), Kind: body.Kind,
+		Value: model.EncryptedString(body.Value), UpdatedBy: account.Name}
+	if err := secret.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := plan.SetSecret(secret); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordPlanActivity(r, plan, model.ActivityPlanUpdated, "secret "+secret.Name)
+	stored, err := plan.GetSecret(secret.Name)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, stored)
+}
+
+func (s *SetagayaAPI) planSecretDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	plan, err := hasPlanOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := plan.DeleteSecret(params.ByName("name")); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordPlanActivity(r, plan, model.ActivityPlanUpdated, "secret "+params.ByName("name"))
+}
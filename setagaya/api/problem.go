@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	// The type of a problem is the urn of its error code, e.g. urn:setagaya:error:SETAGAYA_ERR_PLAN_IN_USE
+	problemTypePrefix = "urn:setagaya:error:"
+)
+
+// Problem is an error response as defined by RFC 7807. It is sent instead of JSONMessage to the clients accepting
+// application/problem+json.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code of the error, the same as in JSONMessage
+	Code string `json:"code,omitempty"`
+}
+
+func makeProblem(message, code string, statusCode int, instance string) *Problem {
+	return &Problem{
+		Type:     problemTypePrefix + code,
+		Title:    http.StatusText(statusCode),
+		Status:   statusCode,
+		Detail:   message,
+		Instance: instance,
+		Code:     code,
+	}
+}
+
+// acceptsProblem tells whether the client asked for the errors as problem details in its Accept header
+func acceptsProblem(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil || mediaType != problemContentType {
+				continue
+			}
+			if q, ok := params["q"]; ok {
+				if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+					continue
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// problemResponseWriter marks the responses whose errors are sent as problem details
+type problemResponseWriter struct {
+	http.ResponseWriter
+	instance string
+}
+
+func (pw *problemResponseWriter) Flush() {
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (pw *problemResponseWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// problemInstance returns the path of the request when its errors are sent as problem details. The writer can be
+// wrapped by the other middlewares.
+func problemInstance(w http.ResponseWriter) (string, bool) {
+	for {
+		switch rw := w.(type) {
+		case *problemResponseWriter:
+			return rw.instance, true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return "", false
+		}
+	}
+}
+
+// problemDetails sends the errors of the handler as problem details when the client accepts them. The other clients
+// keep getting JSONMessage.
+func (s *SetagayaAPI) problemDetails(next httprouter.Handle) httprouter.Handle {
+	return httprouter.Handle(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if acceptsProblem(r) {
+			w = &problemResponseWriter{ResponseWriter: w, instance: r.URL.Path}
+		}
+		next(w, r, params)
+	})
+}
+
+func (s *SetagayaAPI) writeProblem(w http.ResponseWriter, problem *Problem) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		log.Printf("Failed to encode problem response: %v", err)
+	}
+}
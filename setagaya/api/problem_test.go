@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptsProblem(t *testing.T) {
+	testCases := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"*/*", false},
+		{"application/problem+json", true},
+		{"application/json, application/problem+json;q=0.9", true},
+		{"application/problem+json; q=0", false},
+		{"Application/Problem+JSON", true},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest(http.MethodGet, "/api/projects", nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		assert.Equal(t, tc.want, acceptsProblem(r), tc.accept)
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	s := &SetagayaAPI{}
+	handler := s.problemDetails(func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
+		// The idempotent middleware wraps the writer as well
+		s.handleErrors(&responseRecorder{ResponseWriter: w}, makeProjectOwnershipError())
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/api/projects/1", nil)
+	r.Header.Set("Accept", "application/problem+json")
+	w := httptest.NewRecorder()
+	handler(w, r, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+	problem := new(Problem)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), problem))
+	assert.Equal(t, &Problem{
+		Type:     "urn:setagaya:error:" + ErrCodeProjectOwnership,
+		Title:    "Forbidden",
+		Status:   http.StatusForbidden,
+		Detail:   makeProjectOwnershipError().Error(),
+		Instance: "/api/projects/1",
+		Code:     ErrCodeProjectOwnership,
+	}, problem)
+
+	// The clients not asking for problem details keep getting JSONMessage
+	r = httptest.NewRequest(http.MethodGet, "/api/projects/1", nil)
+	w = httptest.NewRecorder()
+	handler(w, r, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	msg := new(JSONMessage)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), msg))
+	assert.Equal(t, ErrCodeProjectOwnership, msg.Code)
+	assert.Equal(t, makeProjectOwnershipError().Error(), msg.Message)
+}
@@ -1,8 +1,15 @@
 package api
 
 import (
+	"encoding/json"
+	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
 	"github.com/hveda/Setagaya/setagaya/model"
 )
 
@@ -20,3 +27,368 @@ func getProject(projectID string) (*model.Project, error) {
 	}
 	return project, nil
 }
+
+type SecurityContextResponse struct {
+	SecurityContext *config.EngineSecurityContext `json:"security_context"`
+	// The project has no security context of its own, the one of the config applies
+	Inherited bool `json:"inherited"`
+}
+
+func (s *SetagayaAPI) projectSecurityContextGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	esc, err := model.GetProjectSecurityContext(project.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	resp := &SecurityContextResponse{SecurityContext: esc}
+	if esc == nil {
+		resp.SecurityContext = config.SC.ExecutorConfig.SecurityContext
+		resp.Inherited = true
+	}
+	s.jsonise(w, http.StatusOK, resp)
+}
+
+// projectSecurityContextSetHandler overrides the security context of the engines of the project. Only admins can
+// change it, as it could loosen the hardening of the cluster.
+func (s *SetagayaAPI) projectSecurityContextSetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can change the security context of a project"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	esc := new(config.EngineSecurityContext)
+	if err := json.NewDecoder(r.Body).Decode(esc); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("invalid security context"))
+		return
+	}
+	if err := esc.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := model.SetProjectSecurityContext(project.ID, esc); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, &SecurityContextResponse{SecurityContext: esc})
+}
+
+func (s *SetagayaAPI) projectSecurityContextDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can change the security context of a project"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := model.DeleteProjectSecurityContext(project.ID); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+}
+
+func (s *SetagayaAPI) projectRegistryGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	registry, err := model.GetProjectRegistry(project.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if registry == nil {
+		registry = &model.ProjectRegistry{ImagePullSecrets: []string{}}
+	}
+	s.jsonise(w, http.StatusOK, registry)
+}
+
+// projectRegistrySetHandler sets the custom engine images of the project and the secrets to pull them with. The
+// secrets are created by the team in the namespace of their engines, they are only checked at deploy time.
+func (s *SetagayaAPI) projectRegistrySetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	registry := new(model.ProjectRegistry)
+	if err := json.NewDecoder(r.Body).Decode(registry); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("invalid registry"))
+		return
+	}
+	if err := registry.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := model.SetProjectRegistry(project.ID, registry); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, registry)
+}
+
+func (s *SetagayaAPI) projectRegistryDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := model.DeleteProjectRegistry(project.ID); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+}
+
+func (s *SetagayaAPI) projectMetadataGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	metadata, err := model.GetProjectMetadata(project.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if metadata == nil {
+		metadata = &model.ProjectMetadata{Labels: map[string]string{}, Annotations: map[string]string{}}
+	}
+	s.jsonise(w, http.StatusOK, metadata)
+}
+
+// projectMetadataSetHandler sets the labels and the annotations added to the engine resources of the project. The
+// keys kubernetes and Setagaya rely on are rejected, as well as the reserved prefixes of the config.
+func (s *SetagayaAPI) projectMetadataSetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	metadata := new(model.ProjectMetadata)
+	if err := json.NewDecoder(r.Body).Decode(metadata); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("invalid metadata"))
+		return
+	}
+	if err := metadata.Validate(config.SC.ExecutorConfig.ReservedMetadataPrefixes); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := model.SetProjectMetadata(project.ID, metadata); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, metadata)
+}
+
+func (s *SetagayaAPI) projectMetadataDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := model.DeleteProjectMetadata(project.ID); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+}
+
+func (s *SetagayaAPI) projectFilesGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	files, err := project.GetFiles()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsoniseCacheable(w, r, files, time.Time{})
+}
+
+// projectFilesUploadHandler adds a data file to the library of the project. The plans of the project can use it
+// without uploading a copy of their own.
+func (s *SetagayaAPI) projectFilesUploadHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if parseErr := r.ParseMultipartForm(100 << 20); parseErr != nil { //parse 100 MB of data
+		s.handleErrors(w, makeInvalidRequestError("failed to parse multipart form"))
+		return
+	}
+	file, handler, err := r.FormFile("projectFile")
+	if err != nil {
+		s.handleErrors(w, makeInvalidRequestError("Something wrong with file you uploaded"))
+		return
+	}
+	if err := project.StoreFile(file, handler.Filename); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordProjectActivity(r, project, model.ActivityProjectFileUploaded, handler.Filename)
+	if _, err := w.Write([]byte("success")); err != nil {
+		log.Printf("Error writing success response: %v", err)
+	}
+}
+
+func (s *SetagayaAPI) projectFilesDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	project, err := getProject(params.ByName("project_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if r := hasProjectOwnership(project, account); !r {
+		s.handleErrors(w, makeProjectOwnershipError())
+		return
+	}
+	if err := checkTenantRole(r, project, account); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if parseErr := r.ParseForm(); parseErr != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	filename := r.Form.Get("filename")
+	if filename == "" {
+		s.handleErrors(w, makeInvalidRequestError("Project file name cannot be empty"))
+		return
+	}
+	if err := project.DeleteFile(filename); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordProjectActivity(r, project, model.ActivityProjectFileDeleted, filename)
+	if _, err := w.Write([]byte("Deleted successfully")); err != nil {
+		log.Printf("Error writing deletion response: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+type propertiesPushResponse struct {
+	Engines int `json:"engines"`
+}
+
+// propertiesPushHandler changes jmeter properties of the run in progress of the collection, e.g. a debug flag the
+// plans read with ${__P(name)}
+func (s *SetagayaAPI) propertiesPushHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	rpr := new(enginesModel.RuntimePropertiesRequest)
+	if err := json.NewDecoder(r.Body).Decode(rpr); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("properties should be an object of names and values"))
+		return
+	}
+	if err := rpr.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	running, err := collection.HasRunningPlan()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if !running {
+		s.handleErrors(w, makeInvalidRequestError("the properties can only be changed while the collection is running"))
+		return
+	}
+	engines, err := s.ctr.PushRuntimeProperties(collection, rpr)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, &propertiesPushResponse{Engines: engines})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/controller"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// runReplayHandler replays the stored samples of a run into the stream and the metrics of its collection, for
+// trying the dashboards and the alerts without deploying engines
+func (s *SetagayaAPI) runReplayHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	rr := &controller.ReplayRequest{Speed: 1}
+	if speed := r.Form.Get("speed"); speed != "" {
+		if rr.Speed, err = strconv.ParseFloat(speed, 64); err != nil {
+			s.handleErrors(w, makeInvalidRequestError("speed should be a number"))
+			return
+		}
+	}
+	if err := rr.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	replay, err := s.ctr.ReplayRun(collection, run, rr)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusAccepted, replay)
+}
+
+func (s *SetagayaAPI) replayGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	replay := s.ctr.GetReplay(collection.ID)
+	if replay == nil {
+		s.handleErrors(w, &model.DBError{Err: errors.New("not found"), Message: "the collection is not replaying a run"})
+		return
+	}
+	s.jsonise(w, http.StatusOK, replay)
+}
+
+func (s *SetagayaAPI) replayStopHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if !s.ctr.StopReplay(collection.ID) {
+		s.handleErrors(w, &model.DBError{Err: errors.New("not found"), Message: "the collection is not replaying a run"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
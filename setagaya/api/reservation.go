@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/scheduler"
+)
+
+// reservationsGetHandler lists the reservations of the collection which did not end yet
+func (s *SetagayaAPI) reservationsGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	reservations, err := model.GetReservations(collection.ID, time.Now())
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, reservations)
+}
+
+// reservationCreateHandler holds room in the cluster for the engines of the collection during a window, the other
+// collections cannot take it then
+func (s *SetagayaAPI) reservationCreateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	reservation := new(model.Reservation)
+	if err := json.NewDecoder(r.Body).Decode(reservation); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("invalid reservation"))
+		return
+	}
+	reservation.CreatedBy = account.Name
+	if err := s.ctr.Reserve(r.Context(), collection, reservation); err != nil {
+		if errors.Is(err, scheduler.ErrFeatureUnavailable) {
+			s.handleErrors(w, makeInvalidRequestError("the scheduler does not know the capacity of its cluster"))
+			return
+		}
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionReserved,
+		fmt.Sprintf("%d engines from %s to %s", reservation.Engines, reservation.StartTime.Format(time.RFC3339),
+			reservation.EndTime.Format(time.RFC3339)))
+	s.jsonise(w, http.StatusOK, reservation)
+}
+
+// reservationDeleteHandler releases the room held by the reservation, even when its window started
+func (s *SetagayaAPI) reservationDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	id, err := strconv.ParseInt(params.ByName("reservation_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("reservation_id"))
+		return
+	}
+	reservation, err := model.GetReservation(collection.ID, id)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := reservation.Delete(); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	recordCollectionActivity(r, collection, model.ActivityCollectionUnreserved, fmt.Sprintf("reservation %d", id))
+}
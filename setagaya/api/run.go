@@ -0,0 +1,430 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func getRun(collection *model.Collection, runID string) (*model.RunHistory, error) {
+	rid, err := strconv.ParseInt(runID, 10, 64)
+	if err != nil {
+		return nil, makeInvalidResourceError("run_id")
+	}
+	run, err := model.GetRun(rid)
+	if err != nil {
+		return nil, &model.DBError{Err: err, Message: "run not found"}
+	}
+	if run.CollectionID != collection.ID {
+		return nil, withErrorCode(ErrCodeResourceNotInCollection,
+			makeInvalidRequestError("run does not belong to the collection"))
+	}
+	return run, nil
+}
+
+func (s *SetagayaAPI) runGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	runID := params.ByName("run_id")
+	if runID == "" {
+		runs, err := collection.GetRuns()
+		if err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		s.jsoniseCacheable(w, r, runs, runsLastModified(runs))
+		return
+	}
+	run, err := getRun(collection, runID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := run.LoadDetails(); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run.ScrubSecrets()
+	// The summary, the gaps and the events of the run can be added after it ends, so only its ETag tells it changed
+	s.jsoniseCacheable(w, r, run, time.Time{})
+}
+
+// runsLastModified returns when the runs last changed. The runs of a collection are only ever started and ended, until
+// the collection is deleted.
+func runsLastModified(runs []*model.RunHistory) time.Time {
+	var t time.Time
+	for _, run := range runs {
+		for _, rt := range []time.Time{run.StartedTime, run.EndTime} {
+			if rt.After(t) {
+				t = rt
+			}
+		}
+	}
+	return t
+}
+
+// runFailuresGetHandler returns the failing responses captured by the engines during the run
+func (s *SetagayaAPI) runFailuresGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	responses, err := model.GetFailedResponses(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, responses)
+}
+
+// runEngineConfigGetHandler returns the config every engine was triggered with in the run, without the secrets, and
+// the checksum of the test plan they ran
+func (s *SetagayaAPI) runEngineConfigGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	run, err := hasRunOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	configs, err := model.GetRunEngineConfigs(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, configs)
+}
+
+type reproduceResponse struct {
+	Run *model.RunHistory `json:"run"`
+	// What changed since the reproduced run. null when it cannot be told
+	Changes []string `json:"changes"`
+}
+
+// runReproduceHandler triggers the collection of the run again with the inputs recorded in the manifest of the run,
+// and flags what changed since
+func (s *SetagayaAPI) runReproduceHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	run, err := hasRunOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	manifest, err := model.GetRunManifest(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	collection, err := model.GetCollection(run.CollectionID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	ctx, cancel := operationContext(r, func(ot *config.OperationTimeouts) int { return ot.Trigger })
+	defer cancel()
+	runID, changes, err := s.ctr.ReproduceRun(ctx, collection, manifest)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	reproduced, err := model.GetRun(runID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, &reproduceResponse{Run: reproduced, Changes: changes})
+}
+
+// runErrorsGetHandler returns the error breakdown of the run with the top errors of every label.
+// The number of errors per label can be set with the top query parameter.
+func (s *SetagayaAPI) runErrorsGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	top := model.DefaultTopErrors
+	if t := r.URL.Query().Get("top"); t != "" {
+		top, err = strconv.Atoi(t)
+		if err != nil || top < 1 || top > model.MaxTopErrors {
+			s.handleErrors(w, makeInvalidRequestError("top"))
+			return
+		}
+	}
+	runErrors, err := model.GetRunErrors(run.ID, top)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	runErrors.ScrubSecrets()
+	s.jsonise(w, http.StatusOK, runErrors)
+}
+
+// runExportHandler downloads the run, its errors and the logs of its engines as a json document. With anonymize=true,
+// the users and the hosts of the system under test are redacted so it can be shared with external vendors.
+func (s *SetagayaAPI) runExportHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	anonymize := false
+	if a := r.URL.Query().Get("anonymize"); a != "" {
+		if anonymize, err = strconv.ParseBool(a); err != nil {
+			s.handleErrors(w, makeInvalidRequestError("anonymize"))
+			return
+		}
+	}
+	export, err := s.ctr.ExportRun(r.Context(), collection, run, anonymize)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	filename := fmt.Sprintf("run-%d.json", run.ID)
+	if anonymize {
+		filename = fmt.Sprintf("run-%d-anonymized.json", run.ID)
+	}
+	w.Header().Add("Content-Disposition", fmt.Sprintf("Attachment; filename=%s", filename))
+	s.jsonise(w, http.StatusOK, export)
+}
+
+func (s *SetagayaAPI) getRunSummary(collection *model.Collection, runID string) (*model.RunSummary, error) {
+	if runID == "" {
+		return nil, makeInvalidRequestError("base and target runs are required")
+	}
+	run, err := getRun(collection, runID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := model.GetRunSummary(run.ID)
+	if err != nil {
+		return nil, err
+	}
+	if metadata, err := model.GetRunMetadata(run.ID); err == nil {
+		metadata.ScrubSecrets()
+		summary.Metadata = metadata
+	}
+	return summary, nil
+}
+
+// comparisonBase is the run the target is compared against. Without an explicit base, runs are compared against the
+// baseline of the collection
+func comparisonBase(collection *model.Collection, base string) (string, error) {
+	if base != "" {
+		return base, nil
+	}
+	baseline, err := collection.GetBaseline()
+	if err != nil {
+		return "", makeInvalidRequestError("base run is required when the collection does not have a baseline")
+	}
+	return strconv.FormatInt(baseline.RunID, 10), nil
+}
+
+func (s *SetagayaAPI) runCompareHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	qs := r.URL.Query()
+	baseRunID, err := comparisonBase(collection, qs.Get("base"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	base, err := s.getRunSummary(collection, baseRunID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	target, err := s.getRunSummary(collection, qs.Get("target"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	confidence := defaultConfidence
+	if c := qs.Get("confidence"); c != "" {
+		if confidence, err = strconv.ParseFloat(c, 64); err != nil || confidence < 0.5 || confidence >= 1 {
+			s.handleErrors(w, makeInvalidRequestError("confidence should be between 0.5 and 1"))
+			return
+		}
+	}
+	resp, err := compareRuns(collection, base, target, confidence)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, resp)
+}
+
+// compareRuns compares the target run to the base run, against the environment noise of the collection
+func compareRuns(collection *model.Collection, base, target *model.RunSummary,
+	confidence float64) (*runComparisonResponse, error) {
+	resp := &runComparisonResponse{RunComparison: model.CompareRunSummaries(base, target)}
+	// Runs with too few samples cannot be tested. The raw differences are still returned in that case
+	resp.Significance, _ = compareRunLatencies(base, target, confidence)
+	noise, err := collection.GetCalibrationNoise()
+	if err != nil {
+		return nil, err
+	}
+	resp.Noise = noise
+	resp.Significant = resp.Significance != nil && resp.Significance.Significant && resp.Noise.ExceedsNoise(base, target)
+	return resp, nil
+}
+
+func (s *SetagayaAPI) calibrationGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	summaries, err := collection.GetCalibrationSummaries()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, &calibrationResponse{
+		Runs:  summaries,
+		Noise: model.CalculateNoise(summaries),
+	})
+}
+
+type calibrationResponse struct {
+	Runs []*model.RunSummary `json:"runs"`
+	// nil until the collection has at least two finished calibration runs
+	Noise *model.CalibrationNoise `json:"noise"`
+}
+
+const defaultConfidence = 0.95
+
+type runComparisonResponse struct {
+	*model.RunComparison
+	Significance *enginesModel.Significance `json:"significance"`
+	// Environment noise measured by the calibration runs of the collection, nil if there are not enough of them
+	Noise *model.CalibrationNoise `json:"noise"`
+	// The difference is statistically significant and larger than the environment noise
+	Significant bool `json:"significant"`
+}
+
+func compareRunLatencies(base, target *model.RunSummary, confidence float64) (*enginesModel.Significance, error) {
+	baseHistogram := enginesModel.NewLatencyHistogram()
+	if err := json.Unmarshal([]byte(base.Histogram), baseHistogram); err != nil {
+		return nil, err
+	}
+	targetHistogram := enginesModel.NewLatencyHistogram()
+	if err := json.Unmarshal([]byte(target.Histogram), targetHistogram); err != nil {
+		return nil, err
+	}
+	return enginesModel.CompareLatencies(baseHistogram, targetHistogram, confidence)
+}
+
+type baselineResponse struct {
+	Baseline *model.Baseline         `json:"baseline"`
+	History  []*model.BaselineChange `json:"history"`
+}
+
+func (s *SetagayaAPI) baselineGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	resp := new(baselineResponse)
+	// It's fine for a collection not to have a baseline. We still return the history
+	if baseline, err := collection.GetBaseline(); err == nil {
+		resp.Baseline = baseline
+	}
+	if resp.History, err = collection.GetBaselineHistory(); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, resp)
+}
+
+func (s *SetagayaAPI) baselineSetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	reason := r.Form.Get("reason")
+	if reason == "" {
+		s.handleErrors(w, makeInvalidRequestError("reason cannot be empty"))
+		return
+	}
+	run, err := getRun(collection, r.Form.Get("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	// A baseline is only useful for comparisons, which are based on the run summary
+	if _, err := model.GetRunSummary(run.ID); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("only finished runs with results can be the baseline"))
+		return
+	}
+	if err := collection.SetBaseline(run.ID, account.Name, reason); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	baseline, err := collection.GetBaseline()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, baseline)
+}
+
+func (s *SetagayaAPI) baselineDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		s.handleErrors(w, makeInvalidRequestError("reason cannot be empty"))
+		return
+	}
+	if err := collection.ClearBaseline(account.Name, reason); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+}
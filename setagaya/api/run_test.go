@@ -0,0 +1,35 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestComparisonBase(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	collection := &model.Collection{ID: 1}
+
+	// A collection without a baseline needs an explicit base
+	_, err := comparisonBase(collection, "")
+	assert.True(t, errors.Is(err, errInvalidRequest))
+	base, err := comparisonBase(collection, "7")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", base)
+
+	// The baseline is the default base, an explicit one still wins
+	assert.NoError(t, collection.SetBaseline(12, "alice", "release 1.1"))
+	base, err = comparisonBase(collection, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "12", base)
+	base, err = comparisonBase(collection, "7")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", base)
+
+	assert.NoError(t, collection.ClearBaseline("alice", "flaky environment"))
+	_, err = comparisonBase(collection, "")
+	assert.True(t, errors.Is(err, errInvalidRequest))
+}
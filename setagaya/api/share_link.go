@@ -0,0 +1,216 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+type runShareLinkResp struct {
+	*model.RunShareLink
+	// Path of the shared page, relative to the address of the API. The summary is at its summary sub path.
+	URL string `json:"url"`
+}
+
+func makeRunShareLinkResp(l *model.RunShareLink) (*runShareLinkResp, error) {
+	token, err := l.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &runShareLinkResp{RunShareLink: l, URL: "/share/" + token}, nil
+}
+
+// parseShareLinkTTL reads how long the link lasts, from a duration like 72h
+func parseShareLinkTTL(expiresIn string) (time.Duration, error) {
+	if expiresIn == "" {
+		return model.DefaultShareLinkTTL, nil
+	}
+	ttl, err := time.ParseDuration(expiresIn)
+	if err != nil || ttl < time.Minute || ttl > model.MaxShareLinkTTL {
+		return 0, makeInvalidRequestError(fmt.Sprintf("expires_in should be a duration between 1m and %s",
+			model.MaxShareLinkTTL))
+	}
+	return ttl, nil
+}
+
+func (s *SetagayaAPI) runShareLinksGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	links, err := model.GetRunShareLinks(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	resp := make([]*runShareLinkResp, 0, len(links))
+	for _, l := range links {
+		lr, err := makeRunShareLinkResp(l)
+		if err != nil {
+			s.handleErrors(w, err)
+			return
+		}
+		resp = append(resp, lr)
+	}
+	s.jsonise(w, http.StatusOK, resp)
+}
+
+// runShareLinkCreateHandler makes a link giving read-only access to the run, which expires after expires_in
+func (s *SetagayaAPI) runShareLinkCreateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	ttl, err := parseShareLinkTTL(r.Form.Get("expires_in"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	l, err := model.CreateRunShareLink(run, account.Name, ttl)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	resp, err := makeRunShareLinkResp(l)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, resp)
+}
+
+// runShareLinkDeleteHandler revokes the link, it stops working before it expires
+func (s *SetagayaAPI) runShareLinkDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	linkID, err := strconv.ParseInt(params.ByName("link_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("link_id"))
+		return
+	}
+	l, err := model.GetRunShareLink(linkID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if l.RunID != run.ID {
+		s.handleErrors(w, withErrorCode(ErrCodeResourceNotInCollection,
+			makeInvalidRequestError("share link does not belong to the run")))
+		return
+	}
+	if err := l.Revoke(); err != nil {
+		s.handleErrors(w, err)
+	}
+}
+
+// runDashboardURL returns the metrics dashboard of the run, like the UI links it. It's empty when there's no
+// dashboard.
+func runDashboardURL(run *model.RunHistory) string {
+	dc := config.SC.DashboardConfig
+	if dc == nil || dc.Url == "" || dc.RunDashboard == "" {
+		return ""
+	}
+	qs := url.Values{}
+	qs.Set("var-runID", strconv.FormatInt(run.ID, 10))
+	qs.Set("from", strconv.FormatInt(run.StartedTime.UnixMilli(), 10))
+	if run.EndTime.IsZero() {
+		qs.Set("to", "now")
+		qs.Set("refresh", "3s")
+	} else {
+		qs.Set("to", strconv.FormatInt(run.EndTime.UnixMilli(), 10))
+	}
+	return dc.Url + dc.RunDashboard + "?" + qs.Encode()
+}
+
+// sharedRunHandler renders the page of the run shared by the link, which needs no account. Along with the figures
+// of the run, it links to its metrics dashboard.
+func (s *SetagayaAPI) sharedRunHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	l, err := model.GetRunShareLinkByToken(params.ByName("token"), time.Now())
+	if err != nil {
+		s.writeSharedRunError(w, err)
+		return
+	}
+	s.renderRunPage(w, l.RunID, func(v *statusPageView, run *model.RunHistory) {
+		v.DashboardURL = runDashboardURL(run)
+		v.ExpiresTime = l.ExpiresTime
+	})
+}
+
+func (s *SetagayaAPI) writeSharedRunError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, model.ErrShareLinkExpired), errors.Is(err, model.ErrShareLinkRevoked):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, model.ErrShareLinksDisabled):
+		http.Error(w, "share link not found", http.StatusNotFound)
+	default:
+		s.writeStatusPageError(w, err)
+	}
+}
+
+// sharedRunSummaryHandler returns the summary of the run shared by the link, like the API returns it to its owners
+func (s *SetagayaAPI) sharedRunSummaryHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	l, err := model.GetRunShareLinkByToken(params.ByName("token"), time.Now())
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := model.GetRun(l.RunID)
+	if err != nil {
+		s.handleErrors(w, &model.DBError{Err: err, Message: "run not found"})
+		return
+	}
+	collection, err := model.GetCollection(run.CollectionID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	summary, err := s.ctr.RunSummary(collection, run)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	end := run.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	summary.CalculateThroughput(end.Sub(run.StartedTime))
+	w.Header().Set("Cache-Control", "no-store")
+	s.jsonise(w, http.StatusOK, summary)
+}
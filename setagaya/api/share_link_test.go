@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestParseShareLinkTTL(t *testing.T) {
+	ttl, err := parseShareLinkTTL("")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DefaultShareLinkTTL, ttl)
+	ttl, err = parseShareLinkTTL("72h")
+	assert.NoError(t, err)
+	assert.Equal(t, 72*time.Hour, ttl)
+	for _, expiresIn := range []string{"tomorrow", "30s", "-1h", "721h"} {
+		_, err := parseShareLinkTTL(expiresIn)
+		assert.ErrorIs(t, err, errInvalidRequest, expiresIn)
+	}
+}
+
+func TestRunDashboardURL(t *testing.T) {
+	dc := config.SC.DashboardConfig
+	defer func() { config.SC.DashboardConfig = dc }()
+
+	started := time.UnixMilli(1792137600000)
+	run := &model.RunHistory{ID: 7, StartedTime: started}
+	config.SC.DashboardConfig = &config.DashboardConfig{Url: "http://grafana:3000", RunDashboard: "/d/run/setagaya"}
+	assert.Equal(t, "http://grafana:3000/d/run/setagaya?from=1792137600000&refresh=3s&to=now&var-runID=7",
+		runDashboardURL(run))
+	run.EndTime = started.Add(time.Minute)
+	assert.Equal(t, "http://grafana:3000/d/run/setagaya?from=1792137600000&to=1792137660000&var-runID=7",
+		runDashboardURL(run))
+
+	config.SC.DashboardConfig = &config.DashboardConfig{Url: "http://grafana:3000"}
+	assert.Empty(t, runDashboardURL(run))
+}
+
+func TestShareLinkError(t *testing.T) {
+	s := &SetagayaAPI{}
+	testCases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{model.ErrShareLinksDisabled, http.StatusBadRequest, ErrCodeShareLinksDisabled},
+		{model.ErrShareLinkExpired, http.StatusGone, ErrCodeShareLinkExpired},
+		{fmt.Errorf("link 3: %w", model.ErrShareLinkRevoked), http.StatusGone, ErrCodeShareLinkRevoked},
+		{&model.DBError{Message: "share link not found"}, http.StatusNotFound, ErrCodeNotFound},
+	}
+	for _, tc := range testCases {
+		w := httptest.NewRecorder()
+		s.handleErrors(w, tc.err)
+		assert.Equal(t, tc.status, w.Code, tc.err.Error())
+		assert.Contains(t, w.Body.String(), tc.code, tc.err.Error())
+	}
+}
+
+func TestSharedRunHandlerErrors(t *testing.T) {
+	key := config.SC.AuthConfig.ShareLinkKey
+	defer func() { config.SC.AuthConfig.ShareLinkKey = key }()
+	s := &SetagayaAPI{}
+	get := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/share/"+token, nil)
+		s.sharedRunHandler(w, r, httprouter.Params{{Key: "token", Value: token}})
+		return w
+	}
+
+	config.SC.AuthConfig.ShareLinkKey = ""
+	assert.Equal(t, http.StatusNotFound, get("1.1792137600.sig").Code)
+
+	config.SC.AuthConfig.ShareLinkKey = "share-link-key"
+	assert.Equal(t, http.StatusNotFound, get("guess").Code)
+	w := get(fmt.Sprintf("1.%d.sig", time.Now().Add(-time.Minute).Unix()))
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Contains(t, w.Body.String(), "the share link expired")
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/controller"
+)
+
+// simulationHandler predicts whether the collections of a capacity plan would start on time in the clusters of the
+// plan. It's a dry run, nothing is deployed and the real clusters are not looked at.
+func (s *SetagayaAPI) simulationHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sr := new(controller.SimulationRequest)
+	if err := json.NewDecoder(r.Body).Decode(sr); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("invalid simulation request"))
+		return
+	}
+	if err := sr.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	s.jsonise(w, http.StatusOK, controller.Simulate(sr))
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+type runSoakResponse struct {
+	*model.RunSoak
+	Checkpoints []*model.RunCheckpoint `json:"checkpoints"`
+	Segments    []*model.ResultSegment `json:"segments"`
+}
+
+// runSoakGetHandler returns the end time of the soak run, its checkpoints and the segments of its results
+func (s *SetagayaAPI) runSoakGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	rs, err := model.GetRunSoak(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	checkpoints, err := model.GetRunCheckpoints(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	segments, err := model.GetResultSegments(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, &runSoakResponse{RunSoak: rs, Checkpoints: checkpoints, Segments: segments})
+}
+
+// runSoakExtendHandler pushes the end of a soak run in progress back by the given minutes
+func (s *SetagayaAPI) runSoakExtendHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	minutes, err := strconv.Atoi(r.Form.Get("minutes"))
+	if err != nil || minutes <= 0 {
+		s.handleErrors(w, makeInvalidRequestError("minutes should be a positive number"))
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	current, err := collection.GetCurrentRun()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if current != run.ID || !run.EndTime.IsZero() {
+		s.handleErrors(w, makeInvalidRequestError("only a run in progress can be extended"))
+		return
+	}
+	rs, err := model.GetRunSoak(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := rs.Extend(time.Duration(minutes) * time.Minute); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := rs.UpdateEndTime(); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	message := fmt.Sprintf("extended by %d minutes, until %s", minutes, rs.EndTime.UTC().Format(time.RFC3339))
+	if err := model.AddRunEvent(collection.ID, run.ID, model.RunEventSoakExtended, message); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, rs)
+}
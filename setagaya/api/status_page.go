@@ -0,0 +1,227 @@
+package api
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// The status page of a run in progress reloads itself this often
+const statusPageRefresh = 5 * time.Second
+
+type runStatusPageResp struct {
+	*model.RunStatusPage
+	// Path of the public page, relative to the address of the API
+	URL string `json:"url"`
+}
+
+func makeRunStatusPageResp(sp *model.RunStatusPage) *runStatusPageResp {
+	return &runStatusPageResp{RunStatusPage: sp, URL: "/status/" + sp.Token}
+}
+
+func (s *SetagayaAPI) runStatusPageGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	sp, err := model.GetRunStatusPageByRun(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, makeRunStatusPageResp(sp))
+}
+
+// runStatusPageCreateHandler makes the public status page of the run, or returns the one it has already
+func (s *SetagayaAPI) runStatusPageCreateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	sp, err := model.CreateRunStatusPage(run, account.Name)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, makeRunStatusPageResp(sp))
+}
+
+// runStatusPageDeleteHandler revokes the status page of the run, whoever has its link cannot see it anymore
+func (s *SetagayaAPI) runStatusPageDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	run, err := getRun(collection, params.ByName("run_id"))
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := model.DeleteRunStatusPage(run.ID); err != nil {
+		s.handleErrors(w, err)
+	}
+}
+
+// statusPageView holds the headline figures of the run shown by its status page. The latencies are in ms.
+type statusPageView struct {
+	CollectionName string
+	RunID          int64
+	Running        bool
+	StartedTime    time.Time
+	Elapsed        time.Duration
+	Samples        uint64
+	Throughput     float64
+	Mean           float64
+	P50            float64
+	P95            float64
+	P99            float64
+	Max            float64
+	Refresh        int
+	// Only shown by the pages of the share links
+	DashboardURL string
+	ExpiresTime  time.Time
+}
+
+func makeStatusPageView(collection *model.Collection, run *model.RunHistory, summary *model.RunSummary,
+	now time.Time) *statusPageView {
+	v := &statusPageView{
+		CollectionName: collection.Name,
+		RunID:          run.ID,
+		Running:        run.EndTime.IsZero(),
+		StartedTime:    run.StartedTime,
+	}
+	end := run.EndTime
+	if v.Running {
+		end = now
+		v.Refresh = int(statusPageRefresh.Seconds())
+	}
+	v.Elapsed = end.Sub(run.StartedTime).Truncate(time.Second)
+	if summary == nil {
+		return v
+	}
+	v.Samples = summary.Samples
+	v.Mean, v.P50, v.P95, v.P99, v.Max = summary.Mean, summary.P50, summary.P95, summary.P99, summary.Max
+	if v.Elapsed > 0 {
+		v.Throughput = float64(summary.Samples) / v.Elapsed.Seconds()
+	}
+	return v
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+{{if .Refresh}}<meta http-equiv="refresh" content="{{.Refresh}}">{{end}}
+<title>{{.CollectionName}} - run {{.RunID}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em; background: #fff; color: #222; }
+h1 { font-size: 1.2em; margin: 0 0 .5em; }
+.state { display: inline-block; padding: .1em .5em; border-radius: .3em; color: #fff; background: #777; }
+.running { background: #2a7d2e; }
+.figures { display: flex; flex-wrap: wrap; gap: 1em; margin-top: 1em; }
+.figure { min-width: 7em; }
+.figure .value { font-size: 2em; font-weight: bold; }
+.figure .label { color: #666; }
+.expires { color: #666; font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>{{.CollectionName}} - run {{.RunID}}</h1>
+<div>
+{{if .Running}}<span class="state running">running</span>{{else}}<span class="state">finished</span>{{end}}
+started {{.StartedTime.UTC.Format "2006-01-02 15:04:05"}} UTC, for {{.Elapsed}}
+</div>
+<div class="figures">
+<div class="figure"><div class="value">{{.Samples}}</div><div class="label">samples</div></div>
+<div class="figure"><div class="value">{{printf "%.1f" .Throughput}}</div><div class="label">samples/s</div></div>
+<div class="figure"><div class="value">{{printf "%.0f" .Mean}}</div><div class="label">mean (ms)</div></div>
+<div class="figure"><div class="value">{{printf "%.0f" .P50}}</div><div class="label">p50 (ms)</div></div>
+<div class="figure"><div class="value">{{printf "%.0f" .P95}}</div><div class="label">p95 (ms)</div></div>
+<div class="figure"><div class="value">{{printf "%.0f" .P99}}</div><div class="label">p99 (ms)</div></div>
+<div class="figure"><div class="value">{{printf "%.0f" .Max}}</div><div class="label">max (ms)</div></div>
+</div>
+{{if .DashboardURL}}<p><a href="{{.DashboardURL}}" target="_blank" rel="noopener noreferrer">Metrics dashboard</a></p>{{end}}
+{{if not .ExpiresTime.IsZero}}<p class="expires">This link expires on {{.ExpiresTime.UTC.Format "2006-01-02 15:04"}} UTC</p>{{end}}
+</body>
+</html>
+`))
+
+// statusPageHandler renders the public status page of the token, which needs no account. The page can be embedded
+// in the dashboards of a war room, it shows the live figures of the run while it's in progress.
+func (s *SetagayaAPI) statusPageHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	sp, err := model.GetRunStatusPage(params.ByName("token"))
+	if err != nil {
+		s.writeStatusPageError(w, err)
+		return
+	}
+	s.renderRunPage(w, sp.RunID, nil)
+}
+
+// renderRunPage renders the headline figures of the run for the people without an account. decorate adds what
+// the page shows besides them.
+func (s *SetagayaAPI) renderRunPage(w http.ResponseWriter, runID int64,
+	decorate func(*statusPageView, *model.RunHistory)) {
+	run, err := model.GetRun(runID)
+	if err != nil {
+		s.writeStatusPageError(w, &model.DBError{Err: err, Message: "run not found"})
+		return
+	}
+	collection, err := model.GetCollection(run.CollectionID)
+	if err != nil {
+		s.writeStatusPageError(w, err)
+		return
+	}
+	// A run that finished without any samples has no summary
+	summary, err := s.ctr.RunSummary(collection, run)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		s.writeStatusPageError(w, err)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	// The token is in the address of the page, it should not leak to the links followed from it
+	h.Set("Referrer-Policy", "no-referrer")
+	v := makeStatusPageView(collection, run, summary, time.Now())
+	if decorate != nil {
+		decorate(v, run)
+	}
+	if err := statusPageTemplate.Execute(w, v); err != nil {
+		log.Printf("Error executing status page template: %v", err)
+	}
+}
+
+func (s *SetagayaAPI) writeStatusPageError(w http.ResponseWriter, err error) {
+	if errors.Is(err, model.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Printf("Error rendering status page: %v", err)
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestMakeStatusPageView(t *testing.T) {
+	started := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	collection := &model.Collection{Name: "checkout"}
+	summary := &model.RunSummary{Samples: 1200, Mean: 80, P50: 70, P95: 150, P99: 300, Max: 900}
+
+	run := &model.RunHistory{ID: 7, StartedTime: started}
+	v := makeStatusPageView(collection, run, summary, started.Add(2*time.Minute+500*time.Millisecond))
+	assert.True(t, v.Running)
+	assert.Equal(t, int(statusPageRefresh.Seconds()), v.Refresh)
+	assert.Equal(t, 2*time.Minute, v.Elapsed)
+	assert.Equal(t, 10.0, v.Throughput)
+	assert.Equal(t, 300.0, v.P99)
+
+	run.EndTime = started.Add(4 * time.Minute)
+	v = makeStatusPageView(collection, run, summary, started.Add(time.Hour))
+	assert.False(t, v.Running)
+	assert.Zero(t, v.Refresh)
+	assert.Equal(t, 5.0, v.Throughput)
+
+	// The run did not get any samples
+	v = makeStatusPageView(collection, run, nil, started.Add(time.Hour))
+	assert.Zero(t, v.Samples)
+	assert.Zero(t, v.Throughput)
+}
+
+func TestStatusPageTemplate(t *testing.T) {
+	started := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	collection := &model.Collection{Name: "<script>checkout</script>"}
+	run := &model.RunHistory{ID: 7, StartedTime: started}
+	summary := &model.RunSummary{Samples: 1200, P99: 300.4}
+
+	var b bytes.Buffer
+	v := makeStatusPageView(collection, run, summary, started.Add(time.Minute))
+	assert.NoError(t, statusPageTemplate.Execute(&b, v))
+	page := b.String()
+	assert.Contains(t, page, `<meta http-equiv="refresh" content="5">`)
+	assert.Contains(t, page, "&lt;script&gt;checkout&lt;/script&gt; - run 7")
+	assert.Contains(t, page, `<div class="value">300</div><div class="label">p99 (ms)</div>`)
+	assert.Contains(t, page, `<div class="value">20.0</div><div class="label">samples/s</div>`)
+
+	run.EndTime = started.Add(time.Minute)
+	b.Reset()
+	v = makeStatusPageView(collection, run, summary, started.Add(time.Hour))
+	assert.NoError(t, statusPageTemplate.Execute(&b, v))
+	assert.NotContains(t, b.String(), "refresh")
+	assert.Contains(t, b.String(), "finished")
+}
+
+func TestStatusPageHandlerUnknownToken(t *testing.T) {
+	s := &SetagayaAPI{}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/status/guess", nil)
+	s.statusPageHandler(w, r, httprouter.Params{{Key: "token", Value: "guess"}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "status page not found")
+}
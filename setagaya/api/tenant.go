@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+type TenantResponse struct {
+	*model.Tenant
+	// Subjects having every role of the tenant
+	Roles map[string][]string `json:"roles"`
+}
+
+func parseTenantQuota(form url.Values) (*model.TenantQuota, error) {
+	quota := new(model.TenantQuota)
+	for field, limit := range map[string]*int{
+		"max_engines":             &quota.MaxEngines,
+		"max_running_collections": &quota.MaxRunningCollections,
+	} {
+		v := form.Get(field)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, makeInvalidRequestError(field + " should be a number")
+		}
+		*limit = n
+	}
+	if err := quota.Validate(); err != nil {
+		return nil, makeInvalidRequestError(err.Error())
+	}
+	return quota, nil
+}
+
+// tenantCreateHandler onboards a tenant in one call. The admin role of the tenant is assigned to the given
+// admin, or to the caller when there is none.
+func (s *SetagayaAPI) tenantCreateHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can onboard tenants"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	name := r.Form.Get("name")
+	if err := model.ValidateTenantName(name); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	owner := r.Form.Get("owner")
+	if owner == "" {
+		s.handleErrors(w, makeInvalidRequestError("Owner name cannot be empty"))
+		return
+	}
+	admin := r.Form.Get("admin")
+	if admin == "" {
+		admin = account.Name
+	}
+	quota, err := parseTenantQuota(r.Form)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	tenant, err := s.ctr.OnboardTenant(r.Context(), name, owner, admin, r.Form.Get("storage_region"), quota)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	roles, err := tenant.GetRoleAssignments()
+	if err != nil {
+		s.handleErrors(w, makeInternalServerError(err.Error()))
+		return
+	}
+	s.jsonise(w, http.StatusOK, &TenantResponse{Tenant: tenant, Roles: roles})
+}
+
+// tenantStorageRegionHandler moves the files of the tenant to the bucket of another region. With dry_run, it only
+// lists the files it would move.
+func (s *SetagayaAPI) tenantStorageRegionHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	if !account.IsAdmin() {
+		s.handleErrors(w, makeNoPermissionErr("Only admins can move the files of the tenants"))
+		return
+	}
+	tenantID, err := strconv.ParseInt(params.ByName("tenant_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("tenant_id"))
+		return
+	}
+	tenant, err := model.GetTenant(tenantID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("failed to parse form"))
+		return
+	}
+	dryRun := r.Form.Get("dry_run") == "true"
+	log.Printf("Admin %s moves the files of tenant %s to region %q, dry run: %t", account.Name, tenant.Name,
+		r.Form.Get("region"), dryRun)
+	migration, err := s.ctr.MoveTenantStorage(tenant, r.Form.Get("region"), dryRun)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, migration)
+}
+
+// getAdminTenant returns the tenant of the request, for the admins only
+func getAdminTenant(r *http.Request, params httprouter.Params, action string) (*model.Tenant, error) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		return nil, makeInvalidRequestError("account")
+	}
+	if !account.IsAdmin() {
+		return nil, makeNoPermissionErr("Only admins can " + action)
+	}
+	tenantID, err := strconv.ParseInt(params.ByName("tenant_id"), 10, 64)
+	if err != nil {
+		return nil, makeInvalidResourceError("tenant_id")
+	}
+	return model.GetTenant(tenantID)
+}
+
+func (s *SetagayaAPI) tenantBrandingGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	tenant, err := getAdminTenant(r, params, "see the branding of the tenants")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	branding, err := tenant.GetBranding()
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if branding == nil {
+		s.handleErrors(w, &model.DBError{Err: errors.New("not found"), Message: "tenant has no branding"})
+		return
+	}
+	s.jsonise(w, http.StatusOK, branding)
+}
+
+// tenantBrandingSetHandler sets the display name, the logo and the support links the UI shows to the users of the
+// tenant, and the host its UI is served at
+func (s *SetagayaAPI) tenantBrandingSetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	tenant, err := getAdminTenant(r, params, "brand the tenants")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	branding := new(model.TenantBranding)
+	if err := json.NewDecoder(r.Body).Decode(branding); err != nil {
+		s.handleErrors(w, makeInvalidRequestError("invalid branding"))
+		return
+	}
+	if err := branding.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	if err := tenant.SetBranding(branding); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, branding)
+}
+
+func (s *SetagayaAPI) tenantBrandingDeleteHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	tenant, err := getAdminTenant(r, params, "brand the tenants")
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	if err := tenant.DeleteBranding(); err != nil {
+		s.handleErrors(w, err)
+	}
+}
+
+// bootstrapHandler returns what the UI shows before the users log in: the branding of the tenant named by tenant,
+// or of the tenant the UI is served at the host for
+func (s *SetagayaAPI) bootstrapHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	branding, err := model.FindBranding(r.URL.Query().Get("tenant"), host)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	// The response depends on the host
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Vary", "Host")
+	s.jsonise(w, http.StatusOK, branding)
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTenantQuota(t *testing.T) {
+	quota, err := parseTenantQuota(url.Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, quota.MaxEngines)
+	assert.Equal(t, 0, quota.MaxRunningCollections)
+
+	quota, err = parseTenantQuota(url.Values{"max_engines": {"200"}, "max_running_collections": {"3"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 200, quota.MaxEngines)
+	assert.Equal(t, 3, quota.MaxRunningCollections)
+
+	for _, form := range []url.Values{{"max_engines": {"many"}}, {"max_running_collections": {"-1"}}} {
+		_, err = parseTenantQuota(form)
+		assert.True(t, errors.Is(err, errInvalidRequest), form.Encode())
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// runVerdict is what a CI gate needs to pass or fail a build on a run, in one call
+type runVerdict struct {
+	RunID        int64 `json:"run_id"`
+	CollectionID int64 `json:"collection_id"`
+	// running, finished or aborted. A run scored by a verification is running until its score is known
+	State string `json:"state"`
+	// The run finished, its verification did not fail and it's not significantly slower than the baseline. Only
+	// final once the run is not running
+	Passed      bool              `json:"passed"`
+	StartedTime time.Time         `json:"started_time"`
+	EndTime     time.Time         `json:"end_time"`
+	Summary     *model.RunSummary `json:"summary"`
+	// Verification scoring the run against its baseline, nil when the run is not verified
+	Verification *verificationResp `json:"verification"`
+	// Comparison with the baseline of the collection, nil when it has none, when the run is the baseline or when one
+	// of them has no results
+	Baseline *verdictComparison `json:"baseline"`
+	// URLs of the results of the run, by name
+	Links map[string]string `json:"links"`
+}
+
+type verdictComparison struct {
+	RunID int64                 `json:"run_id"`
+	Diff  *model.RunSummaryDiff `json:"diff"`
+	// The difference is statistically significant and larger than the environment noise
+	Significant bool `json:"significant"`
+	// The run is significantly slower than the baseline
+	Regressed bool `json:"regressed"`
+}
+
+// judge tells whether the run passes the gate
+func (rv *runVerdict) judge() {
+	rv.Passed = rv.State == model.RunStateFinished &&
+		(rv.Verification == nil || rv.Verification.Status != model.VerificationFailed) &&
+		(rv.Baseline == nil || !rv.Baseline.Regressed)
+}
+
+// runLinks are the URLs of the results of the run
+func runLinks(r *http.Request, run *model.RunHistory) map[string]string {
+	runPath := fmt.Sprintf("/api/collections/%d/runs/%d", run.CollectionID, run.ID)
+	return map[string]string{
+		"run":           apiURL(r, runPath),
+		"errors":        apiURL(r, runPath+"/errors"),
+		"failures":      apiURL(r, runPath+"/failures"),
+		"engine_config": apiURL(r, fmt.Sprintf("/api/runs/%d/engine-config", run.ID)),
+	}
+}
+
+// runVerdictGetHandler returns the state of the run, the score of its verification and its comparison with the
+// baseline, for the CI gates polling a run until it's over
+func (s *SetagayaAPI) runVerdictGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	run, err := hasRunOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	collection, err := model.GetCollection(run.CollectionID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	events, err := model.GetRunEvents(run.ID)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	// Runs that are still in progress or finished without any samples do not have a summary
+	var summary *model.RunSummary
+	if rs, err := model.GetRunSummary(run.ID); err == nil {
+		rs.CalculateThroughput(run.EndTime.Sub(run.StartedTime))
+		summary = rs
+	}
+	var expected time.Duration
+	if manifest, err := model.GetRunManifest(run.ID); err == nil {
+		expected = manifest.ExpectedDuration(collection.Continuous)
+	}
+	verdict := &runVerdict{
+		RunID:        run.ID,
+		CollectionID: run.CollectionID,
+		State:        run.State(expected, summary != nil, events),
+		StartedTime:  run.StartedTime,
+		EndTime:      run.EndTime,
+		Summary:      summary,
+		Links:        runLinks(r, run),
+	}
+	if v, err := model.GetRunVerification(collection.ID, run.ID); err == nil {
+		verdict.Verification = &verificationResp{Verification: v, StatusURL: verificationURL(r, v)}
+		verdict.Links["verification"] = verdict.Verification.StatusURL
+		if !v.IsFinished() {
+			verdict.State = model.RunStateRunning
+		}
+	}
+	if summary != nil && verdict.State != model.RunStateRunning {
+		if baseline, err := collection.GetBaseline(); err == nil && baseline.RunID != run.ID {
+			if base, err := model.GetRunSummary(baseline.RunID); err == nil {
+				comparison, err := compareRuns(collection, base, summary, defaultConfidence)
+				if err != nil {
+					s.handleErrors(w, err)
+					return
+				}
+				verdict.Baseline = &verdictComparison{
+					RunID:       baseline.RunID,
+					Diff:        comparison.Diff,
+					Significant: comparison.Significant,
+					Regressed:   comparison.Significant && comparison.Diff.Mean > 0,
+				}
+				verdict.Links["comparison"] = apiURL(r, fmt.Sprintf("/api/collections/%d/compare?target=%d",
+					collection.ID, run.ID))
+			}
+		}
+	}
+	verdict.judge()
+	s.jsonise(w, http.StatusOK, verdict)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestRunVerdictJudge(t *testing.T) {
+	rv := &runVerdict{State: model.RunStateFinished}
+	rv.judge()
+	assert.True(t, rv.Passed)
+
+	rv.Verification = &verificationResp{Verification: &model.Verification{Status: model.VerificationMarginal}}
+	rv.Baseline = &verdictComparison{Significant: true}
+	rv.judge()
+	assert.True(t, rv.Passed)
+
+	rv.Baseline.Regressed = true
+	rv.judge()
+	assert.False(t, rv.Passed)
+
+	rv.Baseline.Regressed = false
+	rv.Verification.Status = model.VerificationFailed
+	rv.judge()
+	assert.False(t, rv.Passed)
+
+	for _, state := range []string{model.RunStateRunning, model.RunStateAborted} {
+		rv := &runVerdict{State: state}
+		rv.judge()
+		assert.False(t, rv.Passed)
+	}
+}
+
+func TestRunLinks(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/runs/7/verdict", nil)
+	r.Host = "setagaya.example.com"
+	links := runLinks(r, &model.RunHistory{ID: 7, CollectionID: 12})
+	assert.Equal(t, "http://setagaya.example.com/api/collections/12/runs/7", links["run"])
+	assert.Equal(t, "http://setagaya.example.com/api/collections/12/runs/7/errors", links["errors"])
+	assert.Equal(t, "http://setagaya.example.com/api/runs/7/engine-config", links["engine_config"])
+}
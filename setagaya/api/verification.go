@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+type verificationResp struct {
+	*model.Verification
+	// Absolute URL of the verification, for the gates resolving it from the response rather than from its headers,
+	// e.g. when the response is replayed for an idempotency key
+	StatusURL string `json:"status_url"`
+}
+
+// apiURL is the absolute URL of the path, as the client reached the API
+func apiURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, path)
+}
+
+// verificationURL is the URL of the verification, as the gate reached the API
+func verificationURL(r *http.Request, v *model.Verification) string {
+	return apiURL(r, fmt.Sprintf("/api/collections/%d/verifications/%d", v.CollectionID, v.ID))
+}
+
+// verificationCreateHandler starts the verification of a release for a deployment gate, e.g. a webhook stage of
+// Spinnaker or an HTTP step of Harness. It replies at once with the URL of the verification, in the Location header
+// and in the response.
+// The gate polls it until its status is passed, marginal or failed.
+func (s *SetagayaAPI) verificationCreateHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	account, ok := r.Context().Value(accountKey).(*model.Account)
+	if !ok {
+		s.handleErrors(w, makeInvalidRequestError("account"))
+		return
+	}
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	vr := new(model.VerificationRequest)
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(vr); err != nil && !errors.Is(err, io.EOF) {
+			s.handleErrors(w, makeInvalidRequestError("invalid verification request"))
+			return
+		}
+	}
+	if err := vr.Validate(); err != nil {
+		s.handleErrors(w, makeInvalidRequestError(err.Error()))
+		return
+	}
+	baselineRunID := vr.BaselineRunID
+	if baselineRunID == 0 {
+		baseline, err := collection.GetBaseline()
+		if err != nil {
+			s.handleErrors(w, makeInvalidRequestError("baseline_run_id is required when the collection does not have a baseline"))
+			return
+		}
+		baselineRunID = baseline.RunID
+	}
+	if _, err := getRun(collection, strconv.FormatInt(baselineRunID, 10)); err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	v, err := s.ctr.StartVerification(collection, baselineRunID, vr, account.Name)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	resp := &verificationResp{Verification: v, StatusURL: verificationURL(r, v)}
+	w.Header().Set("Location", resp.StatusURL)
+	s.jsonise(w, http.StatusAccepted, resp)
+}
+
+func (s *SetagayaAPI) verificationGetHandler(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	collection, err := hasCollectionOwnership(r, params)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	id, err := strconv.ParseInt(params.ByName("verification_id"), 10, 64)
+	if err != nil {
+		s.handleErrors(w, makeInvalidResourceError("verification_id"))
+		return
+	}
+	v, err := model.GetVerification(collection.ID, id)
+	if err != nil {
+		s.handleErrors(w, err)
+		return
+	}
+	s.jsonise(w, http.StatusOK, &verificationResp{Verification: v, StatusURL: verificationURL(r, v)})
+}
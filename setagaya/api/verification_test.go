@@ -0,0 +1,28 @@
+package api
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestVerificationURL(t *testing.T) {
+	v := &model.Verification{ID: 3, CollectionID: 12}
+	r := httptest.NewRequest("POST", "/api/collections/12/verifications", nil)
+	r.Host = "setagaya.example.com"
+	assert.Equal(t, "http://setagaya.example.com/api/collections/12/verifications/3", verificationURL(r, v))
+
+	r.TLS = &tls.ConnectionState{}
+	assert.Equal(t, "https://setagaya.example.com/api/collections/12/verifications/3", verificationURL(r, v))
+
+	// Behind a proxy terminating TLS
+	r.TLS = nil
+	r.Header.Set("X-Forwarded-Proto", "https")
+	assert.Equal(t, "https://setagaya.example.com/api/collections/12/verifications/3", verificationURL(r, v))
+	r.Header.Set("X-Forwarded-Proto", "javascript")
+	assert.Equal(t, "http://setagaya.example.com/api/collections/12/verifications/3", verificationURL(r, v))
+}
@@ -14,6 +14,8 @@ var (
 	CNPattern  = regexp.MustCompile(`CN=([^,]+)\,OU=DLM\sDistribution\sGroups`)
 	AccountKey = "account"
 	MLKey      = "ml"
+	// Unix time the admin last entered a valid TOTP code
+	StepUpKey = "step_up"
 )
 
 type AuthResult struct {
@@ -1,15 +1,26 @@
 #!/bin/bash
 
 target=$1
+# The engines are also built for arm64, e.g. ./build.sh jmeter arm64
+arch=${2:-amd64}
+# The version the agents report, e.g. AGENT_VERSION=v1.2.3 ./build.sh jmeter
+agent_ldflags="-w -s -X github.com/hveda/Setagaya/setagaya/engines/model.AgentVersion=${AGENT_VERSION:-dev}"
 mkdir -p build
 export GO111MODULE=on
 go mod download
 
 case "$target" in
-    "jmeter") GOOS=linux GOARCH=amd64 go build -ldflags="-w -s" -o build/setagaya-agent "$(pwd)/engines/jmeter"
+    "jmeter") GOOS=linux GOARCH=$arch go build -ldflags="$agent_ldflags" -o build/setagaya-agent "$(pwd)/engines/jmeter"
+    ;;
+    "jmeter-windows") GOOS=windows GOARCH=amd64 go build -ldflags="$agent_ldflags" -o build/setagaya-agent.exe "$(pwd)/engines/jmeter"
+    ;;
+    "playwright") GOOS=linux GOARCH=$arch go build -ldflags="$agent_ldflags" -o build/setagaya-playwright-agent "$(pwd)/engines/playwright"
     ;;
     "controller") GOOS=linux GOARCH=amd64 go build -ldflags="-w -s" -o build/setagaya-controller "$(pwd)/controller/cmd"
     ;;
+    "operator") GOOS=linux GOARCH=amd64 go build -ldflags="-w -s" -o build/setagaya-operator "$(pwd)/operator/cmd"
+    ;;
     *)
-    GOOS=linux GOARCH=amd64 go build -ldflags="-w -s" -o build/setagaya .
+    # The version the API server reports, e.g. VERSION=v1.2.3 ./build.sh
+    GOOS=linux GOARCH=amd64 go build -ldflags="-w -s -X github.com/hveda/Setagaya/setagaya/api.Version=${VERSION:-dev}" -o build/setagaya .
 esac
\ No newline at end of file
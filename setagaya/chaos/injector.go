@@ -0,0 +1,83 @@
+// Package chaos creates the chaos experiments of the runs, with Chaos Mesh or Litmus, in the namespaces of the
+// systems under test
+package chaos
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// RunLabel holds the run an experiment was created for, to find the ones left behind by a restart of the controller
+const RunLabel = "setagaya.io/run"
+
+type Injector struct {
+	client dynamic.Interface
+	mapper meta.RESTMapper
+}
+
+func NewInjector(client dynamic.Interface, mapper meta.RESTMapper) *Injector {
+	return &Injector{client: client, mapper: mapper}
+}
+
+// ExperimentName is the name of the experiment of the action in the run
+func ExperimentName(runID int64, action *model.ChaosAction) string {
+	return fmt.Sprintf("setagaya-%d-%s", runID, action.Name)
+}
+
+func (i *Injector) resource(action *model.ChaosAction) (schema.GroupVersionResource, error) {
+	apiVersion, kind := action.APIVersion()
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	mapping, err := i.mapper.RESTMapping(gv.WithKind(kind).GroupKind(), gv.Version)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	return mapping.Resource, nil
+}
+
+// Inject creates the experiment of the action for the run
+func (i *Injector) Inject(ctx context.Context, runID int64, action *model.ChaosAction) error {
+	gvr, err := i.resource(action)
+	if err != nil {
+		return err
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	for k, v := range action.Manifest {
+		obj.Object[k] = v
+	}
+	obj.SetName(ExperimentName(runID, action))
+	obj.SetNamespace(action.Namespace)
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[RunLabel] = fmt.Sprint(runID)
+	obj.SetLabels(labels)
+	_, err = i.client.Resource(gvr).Namespace(action.Namespace).Create(ctx, obj, metav1.CreateOptions{})
+	return err
+}
+
+// Remove deletes the experiment of the action created for the run. It does nothing when the action was not taken.
+func (i *Injector) Remove(ctx context.Context, runID int64, action *model.ChaosAction) error {
+	gvr, err := i.resource(action)
+	if err != nil {
+		return err
+	}
+	err = i.client.Resource(gvr).Namespace(action.Namespace).Delete(ctx, ExperimentName(runID, action),
+		metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
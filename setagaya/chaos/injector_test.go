@@ -0,0 +1,62 @@
+package chaos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+var podChaos = schema.GroupVersionResource{Group: "chaos-mesh.org", Version: "v1alpha1", Resource: "podchaos"}
+
+func newTestInjector() (*Injector, *fake.FakeDynamicClient) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.AddSpecific(podChaos.GroupVersion().WithKind("PodChaos"), podChaos,
+		podChaos.GroupVersion().WithResource("podchaos"), meta.RESTScopeNamespace)
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{podChaos: "PodChaosList"})
+	return NewInjector(client, mapper), client
+}
+
+func TestInjectAndRemove(t *testing.T) {
+	i, client := newTestInjector()
+	action := &model.ChaosAction{
+		Name:      "kill-checkout",
+		At:        "5m",
+		Provider:  model.ChaosMesh,
+		Namespace: "shop",
+		Manifest: map[string]interface{}{
+			"apiVersion": "chaos-mesh.org/v1alpha1",
+			"kind":       "PodChaos",
+			"metadata":   map[string]interface{}{"labels": map[string]interface{}{"team": "shop"}},
+			"spec":       map[string]interface{}{"action": "pod-kill", "mode": "one"},
+		},
+	}
+	ctx := context.Background()
+	assert.NoError(t, i.Inject(ctx, 12, action))
+
+	obj, err := client.Resource(podChaos).Namespace("shop").Get(ctx, "setagaya-12-kill-checkout", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "shop", RunLabel: "12"}, obj.GetLabels())
+	spec, _, _ := unstructured.NestedString(obj.Object, "spec", "action")
+	assert.Equal(t, "pod-kill", spec)
+
+	// The action can be taken again in another run
+	assert.NoError(t, i.Inject(ctx, 13, action))
+	assert.NoError(t, i.Remove(ctx, 12, action))
+	assert.NoError(t, i.Remove(ctx, 12, action))
+	list, err := client.Resource(podChaos).Namespace("shop").List(ctx, metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Items, 1)
+
+	action.Manifest["kind"] = "NetworkChaos"
+	assert.Error(t, i.Inject(ctx, 12, action))
+}
@@ -2,16 +2,24 @@ package config
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"regexp"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+
+	"github.com/hveda/Setagaya/setagaya/utils"
 )
 
 const (
@@ -34,9 +42,89 @@ type AuthConfig struct {
 	AdminUsers []string `json:"admin_users"`
 	NoAuth     bool     `json:"no_auth"`
 	SessionKey string   `json:"session_key"`
+	// Signs the share links of the runs. They are disabled when it's empty
+	ShareLinkKey string `json:"share_link_key"`
+	// Asks the admins for a TOTP code before their destructive actions. Disabled when nil
+	StepUp *StepUpConfig `json:"step_up,omitempty"`
 	*LdapConfig
 }
 
+const (
+	DefaultStepUpWindow      = 5
+	DefaultStepUpMaxAttempts = 5
+	DefaultStepUpLockout     = 15
+)
+
+// StepUpConfig is the second step the admins take before the destructive actions, on top of their login. The TOTP
+// secrets of the admins are encrypted with the key of the secure config.
+type StepUpConfig struct {
+	// Minutes a verified code lets the admin act without entering another one, 5 by default
+	Window int `json:"window"`
+	// Invalid codes an admin can enter in a row before their codes are refused, 5 by default
+	MaxAttempts int `json:"max_attempts"`
+	// Minutes the codes of an admin are refused once they reached max_attempts, 15 by default
+	Lockout int `json:"lockout"`
+}
+
+// WindowDuration is how long a verified code lasts
+func (su *StepUpConfig) WindowDuration() time.Duration {
+	if su.Window == 0 {
+		return DefaultStepUpWindow * time.Minute
+	}
+	return time.Duration(su.Window) * time.Minute
+}
+
+// AttemptsLimit is how many invalid codes an admin can enter in a row
+func (su *StepUpConfig) AttemptsLimit() int {
+	if su == nil || su.MaxAttempts == 0 {
+		return DefaultStepUpMaxAttempts
+	}
+	return su.MaxAttempts
+}
+
+// LockoutDuration is how long the codes of an admin are refused once they entered too many invalid ones
+func (su *StepUpConfig) LockoutDuration() time.Duration {
+	if su == nil || su.Lockout == 0 {
+		return DefaultStepUpLockout * time.Minute
+	}
+	return time.Duration(su.Lockout) * time.Minute
+}
+
+// SecureConfig holds the key encrypting the sensitive fields of the database, like the secrets of the plans. The
+// keys are 32 random bytes encoded in base64, e.g. the output of openssl rand -base64 32
+type SecureConfig struct {
+	// Key the fields are encrypted with. The sensitive fields cannot be written without it
+	EncryptionKey string `json:"encryption_key"`
+	// Former keys, the fields they encrypted can still be read once the key is rotated
+	PreviousKeys []string `json:"previous_keys,omitempty"`
+}
+
+const encryptionKeySize = 32
+
+// DecodeEncryptionKey decodes a key of the secure config
+func DecodeEncryptionKey(key string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("the encryption keys should be encoded in base64")
+	}
+	if len(decoded) != encryptionKeySize {
+		return nil, fmt.Errorf("the encryption keys should be %d bytes, not %d", encryptionKeySize, len(decoded))
+	}
+	return decoded, nil
+}
+
+func (sc *SecureConfig) Validate() error {
+	if _, err := DecodeEncryptionKey(sc.EncryptionKey); err != nil {
+		return err
+	}
+	for _, k := range sc.PreviousKeys {
+		if _, err := DecodeEncryptionKey(k); err != nil {
+			return fmt.Errorf("previous key: %w", err)
+		}
+	}
+	return nil
+}
+
 type ClusterConfig struct {
 	Project     string  `json:"project"`
 	Zone        string  `json:"zone"`
@@ -46,6 +134,127 @@ type ClusterConfig struct {
 	APIEndpoint string  `json:"api_endpoint"`
 	GCDuration  float64 `json:"gc_duration"` // in minutes
 	ServiceType string  `json:"service_type"`
+	// Retries and circuit breaking of the calls to the scheduler. nil means the defaults
+	Resilience *SchedulerResilience `json:"resilience,omitempty"`
+}
+
+// SchedulerResilience retries the calls to the scheduler failing transiently, e.g. when the apiserver times out, and
+// stops calling it for a while after too many transient failures in a row
+type SchedulerResilience struct {
+	// Attempts of every call, 3 by default. 1 does not retry
+	Attempts int `json:"attempts"`
+	// Milliseconds before the first retry, 200 by default. The wait doubles at every retry, with jitter
+	BackoffMs int `json:"backoff_ms"`
+	// Transient failures in a row opening the circuit, 5 by default
+	FailureThreshold int `json:"failure_threshold"`
+	// Seconds the circuit stays open before a call is let through again, 30 by default
+	CooldownSeconds int `json:"cooldown_seconds"`
+}
+
+// WithDefaults returns the resilience with the defaults of the fields not set
+func (sr *SchedulerResilience) WithDefaults() *SchedulerResilience {
+	r := SchedulerResilience{}
+	if sr != nil {
+		r = *sr
+	}
+	if r.Attempts == 0 {
+		r.Attempts = 3
+	}
+	if r.BackoffMs == 0 {
+		r.BackoffMs = 200
+	}
+	if r.FailureThreshold == 0 {
+		r.FailureThreshold = 5
+	}
+	if r.CooldownSeconds == 0 {
+		r.CooldownSeconds = 30
+	}
+	return &r
+}
+
+// OperationTimeouts are the deadlines, in seconds, of the operations of the API driving the engines. The work left is
+// given up once they are reached, as when the client goes away. 0 means the default
+type OperationTimeouts struct {
+	// Exposing the project and deploying the engines, 120 by default
+	Deploy int `json:"deploy"`
+	// Starting the run and triggering the engines of its plans, 300 by default
+	Trigger int `json:"trigger"`
+	// Stopping the engines of a collection or of a plan, and waiting for them to shut down, 120 by default
+	Stop int `json:"stop"`
+	// Stopping and deleting the engines, and waiting for them to be gone, 180 by default
+	Purge int `json:"purge"`
+}
+
+// WithDefaults returns the timeouts with the defaults of the fields not set
+func (ot *OperationTimeouts) WithDefaults() *OperationTimeouts {
+	t := OperationTimeouts{}
+	if ot != nil {
+		t = *ot
+	}
+	if t.Deploy == 0 {
+		t.Deploy = 120
+	}
+	if t.Trigger == 0 {
+		t.Trigger = 300
+	}
+	if t.Stop == 0 {
+		t.Stop = 120
+	}
+	if t.Purge == 0 {
+		t.Purge = 180
+	}
+	return &t
+}
+
+// StartupConfig bounds how long the API server and the controller wait for the database, the object storage and the
+// scheduler when they start, and how often /readyz checks them afterwards. The durations are in seconds, 0 means
+// the default
+type StartupConfig struct {
+	// Checks of the dependencies before the start is given up, 30 by default
+	MaxAttempts int `json:"max_attempts"`
+	// Wait after the first failed check, doubling with every check up to MaxRetryInterval. 2 by default
+	RetryInterval int `json:"retry_interval"`
+	// 30 by default
+	MaxRetryInterval int `json:"max_retry_interval"`
+	// How long a check of a dependency can take, 10 by default
+	CheckTimeout int `json:"check_timeout"`
+	// Interval of the checks /readyz reports once started, 15 by default
+	ReadinessInterval int `json:"readiness_interval"`
+}
+
+// WithDefaults returns the config with the defaults of the fields not set
+func (sc *StartupConfig) WithDefaults() *StartupConfig {
+	c := StartupConfig{}
+	if sc != nil {
+		c = *sc
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = 30
+	}
+	if c.RetryInterval == 0 {
+		c.RetryInterval = 2
+	}
+	if c.MaxRetryInterval == 0 {
+		c.MaxRetryInterval = 30
+	}
+	if c.CheckTimeout == 0 {
+		c.CheckTimeout = 10
+	}
+	if c.ReadinessInterval == 0 {
+		c.ReadinessInterval = 15
+	}
+	return &c
+}
+
+func (sc *StartupConfig) Validate() error {
+	if sc.MaxAttempts < 0 || sc.RetryInterval < 0 || sc.MaxRetryInterval < 0 || sc.CheckTimeout < 0 ||
+		sc.ReadinessInterval < 0 {
+		return fmt.Errorf("the attempts and the intervals cannot be negative")
+	}
+	if sc.MaxRetryInterval > 0 && sc.MaxRetryInterval < sc.RetryInterval {
+		return fmt.Errorf("the max retry interval cannot be shorter than the retry interval")
+	}
+	return nil
 }
 
 type HostAlias struct {
@@ -60,26 +269,235 @@ type Toleration struct {
 }
 
 type ExecutorConfig struct {
-	InCluster              bool                `json:"in_cluster"`
-	Namespace              string              `json:"namespace"`
-	Cluster                *ClusterConfig      `json:"cluster"`
-	ImagePullSecret        string              `json:"pull_secret"`
-	ImagePullPolicy        apiv1.PullPolicy    `json:"pull_policy"`
-	JmeterContainer        *JmeterContainer    `json:"jmeter"`
-	HostAliases            []*HostAlias        `json:"host_aliases,omitempty"`
-	NodeAffinity           []map[string]string `json:"node_affinity"`
-	Tolerations            []Toleration        `json:"tolerations"`
-	MaxEnginesInCollection int                 `json:"max_engines_in_collection"`
+	InCluster              bool                 `json:"in_cluster"`
+	Namespace              string               `json:"namespace"`
+	Cluster                *ClusterConfig       `json:"cluster"`
+	ImagePullSecret        string               `json:"pull_secret"`
+	ImagePullPolicy        apiv1.PullPolicy     `json:"pull_policy"`
+	JmeterContainer        *JmeterContainer     `json:"jmeter"`
+	PlaywrightContainer    *PlaywrightContainer `json:"playwright,omitempty"`
+	HostAliases            []*HostAlias         `json:"host_aliases,omitempty"`
+	NodeAffinity           []map[string]string  `json:"node_affinity"`
+	Tolerations            []Toleration         `json:"tolerations"`
+	MaxEnginesInCollection int                  `json:"max_engines_in_collection"`
+	TenantNamespaces       *TenantNamespaces    `json:"tenant_namespaces,omitempty"`
+	// Applied to the engines of the projects without a security context of their own
+	SecurityContext *EngineSecurityContext `json:"security_context,omitempty"`
+	ImagePolicy     *ImagePolicy           `json:"image_policy,omitempty"`
+	// Base url of the mirror the engines download the artifacts from, for the clusters without access to the
+	// internet. https://repo1.maven.org/maven2/a.jar is then downloaded from <mirror>/repo1.maven.org/maven2/a.jar
+	ArtifactMirror string `json:"artifact_mirror,omitempty"`
+	// Label and annotation keys the projects cannot add to their engines, on top of the ones of kubernetes and the
+	// labels of Setagaya. A prefix ending with a slash covers the subdomains too, e.g. istio.io/ covers
+	// security.istio.io/
+	ReservedMetadataPrefixes []string `json:"reserved_metadata_prefixes,omitempty"`
+	// Set when a service mesh injects its sidecar in the engine pods
+	ServiceMesh *ServiceMesh `json:"service_mesh,omitempty"`
+	// What a core of each architecture is worth in amd64 cores, so the cpu used by the engines compares across
+	// architectures. The architectures left out are worth 1
+	CPUFactors map[string]float64 `json:"cpu_factors,omitempty"`
+	// Lets the plans shape the egress network of their engines. The init container it adds to the engine pods runs
+	// as root with the NET_ADMIN capability, so it's only set on the clusters allowing it
+	NetworkShaper *NetworkShaper `json:"network_shaper,omitempty"`
+	// deployment or job. The engines deployed as jobs run the plan once and exit after the controller collected the
+	// results, the cluster cleans them up and the end of the run is told by the completion of the jobs.
+	// deployment by default, only the k8s scheduler supports jobs
+	ExecutionMode string `json:"execution_mode,omitempty"`
+	// Namespaces the chaos actions of the collections can create their experiments in, with Chaos Mesh or Litmus.
+	// The chaos actions are disabled when it's empty
+	ChaosNamespaces []string `json:"chaos_namespaces,omitempty"`
+	// Oldest version of the agents the engine images should run, like v1.2.0. The controller warns about the engines
+	// running an older agent, or one not telling its version. No version is checked when it's empty
+	MinAgentVersion string `json:"min_agent_version,omitempty"`
+	// How the engines stream their samples to the controller, sse or batch. sse sends every sample as an event, batch
+	// sends them in binary frames of many samples, for the large fleets of engines. sse by default
+	MetricTransport string `json:"metric_transport,omitempty"`
+}
+
+const (
+	ExecutionModeDeployment = "deployment"
+	ExecutionModeJob        = "job"
+)
+
+const (
+	MetricTransportSSE   = "sse"
+	MetricTransportBatch = "batch"
+)
+
+// BatchesMetrics tells whether the engines stream their samples in batches
+func (ec *ExecutorConfig) BatchesMetrics() bool {
+	return ec != nil && ec.MetricTransport == MetricTransportBatch
+}
+
+// RunsOnce tells whether the engines run a single run and exit, as jobs
+func (ec *ExecutorConfig) RunsOnce() bool {
+	return ec != nil && ec.ExecutionMode == ExecutionModeJob
+}
+
+// ChaosAllowed tells whether the chaos actions can create their experiments in the namespace
+func (ec *ExecutorConfig) ChaosAllowed(namespace string) bool {
+	if ec == nil {
+		return false
+	}
+	for _, ns := range ec.ChaosNamespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// CPUFactor is what a core of the architecture is worth in amd64 cores
+func (ec *ExecutorConfig) CPUFactor(arch string) float64 {
+	if f, ok := ec.CPUFactors[arch]; ok {
+		return f
+	}
+	return 1
+}
+
+const (
+	ArtifactKindPlugin  = "plugin"
+	ArtifactKindLibrary = "library"
+)
+
+var artifactChecksumPattern = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// Artifact is a file the engines download before a run, e.g. the jar of a JMeter plugin
+type Artifact struct {
+	URL string `json:"url"`
+	// Hex encoded sha256 of the file. A download that does not match is rejected
+	SHA256 string `json:"sha256"`
+	// Plugins are scanned by JMeter for test elements, libraries are only added to its classpath. Plugin by default
+	Kind string `json:"kind,omitempty"`
+}
+
+func (a *Artifact) Validate() error {
+	u, err := url.Parse(a.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		return fmt.Errorf("url of artifact %s should be the http(s) url of a file", a.URL)
+	}
+	if !artifactChecksumPattern.MatchString(a.SHA256) {
+		return fmt.Errorf("sha256 of artifact %s should be 64 lowercase hex characters", a.URL)
+	}
+	if a.Kind != "" && a.Kind != ArtifactKindPlugin && a.Kind != ArtifactKindLibrary {
+		return fmt.Errorf("kind of artifact %s should be %s or %s", a.URL, ArtifactKindPlugin, ArtifactKindLibrary)
+	}
+	return nil
+}
+
+// ImagePolicy gates the custom engine images of the projects on their vulnerabilities. The scanner is asked for the
+// report of an image with GET <scanner_url>?image=<image> and responds with the digest of the image and the count
+// of its vulnerabilities by severity, e.g. {"digest": "sha256:...", "critical": 2, "high": 10}. It can be an
+// adapter in front of a Trivy server or of the attestations of the registry.
+type ImagePolicy struct {
+	ScannerURL string `json:"scanner_url"`
+	// Images with more critical vulnerabilities are blocked, unless an admin overrode the policy for their digest
+	MaxCritical int `json:"max_critical"`
+}
+
+// EngineSecurityContext hardens the engine pods. Without it the engines run the way their image is built.
+type EngineSecurityContext struct {
+	RunAsNonRoot bool   `json:"run_as_non_root"`
+	RunAsUser    *int64 `json:"run_as_user,omitempty"`
+	RunAsGroup   *int64 `json:"run_as_group,omitempty"`
+	FSGroup      *int64 `json:"fs_group,omitempty"`
+	// The engines then write to volumes only, see the volumes of the engine pods
+	ReadOnlyRootFilesystem      bool `json:"read_only_root_filesystem"`
+	DisallowPrivilegeEscalation bool `json:"disallow_privilege_escalation"`
+	// RuntimeDefault, Unconfined or Localhost/<profile>
+	SeccompProfile   string   `json:"seccomp_profile,omitempty"`
+	DropCapabilities []string `json:"drop_capabilities,omitempty"`
+}
+
+var capabilityPattern = regexp.MustCompile(`^[A-Z_]+$`)
+
+func (esc *EngineSecurityContext) Validate() error {
+	switch {
+	case esc.SeccompProfile == "", esc.SeccompProfile == "RuntimeDefault", esc.SeccompProfile == "Unconfined":
+	case strings.HasPrefix(esc.SeccompProfile, "Localhost/") && len(esc.SeccompProfile) > len("Localhost/"):
+	default:
+		return fmt.Errorf("seccomp profile %s should be RuntimeDefault, Unconfined or Localhost/<profile>", esc.SeccompProfile)
+	}
+	for _, c := range esc.DropCapabilities {
+		if !capabilityPattern.MatchString(c) {
+			return fmt.Errorf("capability %s is invalid", c)
+		}
+	}
+	for _, id := range []*int64{esc.RunAsUser, esc.RunAsGroup, esc.FSGroup} {
+		if id != nil && *id < 0 {
+			return errors.New("user and group ids cannot be negative")
+		}
+	}
+	if esc.RunAsNonRoot && esc.RunAsUser != nil && *esc.RunAsUser == 0 {
+		return errors.New("engines cannot run as root user when they must run as non-root")
+	}
+	return nil
+}
+
+const (
+	ServiceMeshIstio   = "istio"
+	ServiceMeshLinkerd = "linkerd"
+)
+
+// ServiceMesh makes the engines work along the sidecar of the mesh: the port of the engines is left out of the
+// mesh as the proxy breaks the streaming of the metrics, the engines wait for the sidecar to be ready before a run
+// and stop it when they are terminated, so the pods do not hang on the sidecar.
+type ServiceMesh struct {
+	// istio or linkerd
+	Kind string `json:"kind"`
+	// Seconds the engines wait for the sidecar before giving up on a run. 60 by default
+	ReadyTimeout int `json:"ready_timeout,omitempty"`
+}
+
+func (sm *ServiceMesh) Validate() error {
+	if sm.Kind != ServiceMeshIstio && sm.Kind != ServiceMeshLinkerd {
+		return fmt.Errorf("service mesh %s should be %s or %s", sm.Kind, ServiceMeshIstio, ServiceMeshLinkerd)
+	}
+	if sm.ReadyTimeout < 0 {
+		return errors.New("ready timeout of the sidecar cannot be negative")
+	}
+	return nil
+}
+
+// TenantNamespaces runs the engines of every tenant in a namespace of its own instead of the namespace of the
+// executors. The templates are applied to the namespace of a tenant when it's onboarded.
+type TenantNamespaces struct {
+	Enabled       bool                            `json:"enabled"`
+	ResourceQuota *apiv1.ResourceQuotaSpec        `json:"resource_quota,omitempty"`
+	NetworkPolicy *networkingv1.NetworkPolicySpec `json:"network_policy,omitempty"`
 }
 
 type ExecutorContainer struct {
 	Image string `json:"image"`
 	CPU   string `json:"cpu"`
 	Mem   string `json:"mem"`
+	// Secrets to pull the image with, on top of the pull secret of the executors
+	ImagePullSecrets []string `json:"image_pull_secrets,omitempty"`
+	// Operating system of the nodes the engines are scheduled on. It's set for the plans running on windows, the
+	// image is the windows one of the engine then
+	OS string `json:"-"`
+	// Architecture of the nodes the engines are scheduled on, set by the plans choosing one. The image has to be
+	// built for it
+	Arch string `json:"-"`
+	// Egress network of the engines, set by the plans shaping it
+	NetworkShaping *NetworkShaping `json:"-"`
 }
 
 type JmeterContainer struct {
 	*ExecutorContainer
+	// Columns of the JTL files written by the engines, in order. Only needed when the image writes other columns
+	// than the default ones and the files have no header line
+	JTLColumns []string `json:"jtl_columns,omitempty"`
+	// Plugins and their dependencies the engines install before every run
+	Artifacts []*Artifact `json:"artifacts,omitempty"`
+	// Engines of the plans running on windows nodes. The plans cannot run on windows when it's not configured
+	Windows *ExecutorContainer `json:"windows,omitempty"`
+}
+
+// PlaywrightContainer is optional. Plans using the playwright engine can only be deployed when it's configured
+type PlaywrightContainer struct {
+	*ExecutorContainer
 }
 
 type DashboardConfig struct {
@@ -90,6 +508,21 @@ type DashboardConfig struct {
 
 type HttpConfig struct {
 	Proxy string `json:"proxy"`
+	// Hosts the job callbacks can be posted to even though they are in a private network
+	CallbackAllowedHosts []string `json:"callback_allowed_hosts,omitempty"`
+}
+
+// CallbackHostAllowed tells whether the host is allowed to receive the job callbacks from a private network
+func (hc *HttpConfig) CallbackHostAllowed(host string) bool {
+	if hc == nil {
+		return false
+	}
+	for _, h := range hc.CallbackAllowedHosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
 }
 
 type ObjectStorage struct {
@@ -105,6 +538,56 @@ type ObjectStorage struct {
 	AuthFileName string `json:"auth_file_name"`
 	// This is the configuration file
 	ConfigMapName string `json:"config_map_name"`
+	// Folder of the filesystem storage
+	Path string `json:"path,omitempty"`
+	// Stores the content of the files once under its sha256, however many plans and projects upload it. The index
+	// of the content is kept in the database
+	ContentAddressed bool `json:"content_addressed,omitempty"`
+	// How long the signed urls of the files are valid, e.g. 15m. The users and the engines download the files
+	// through signed urls, so the engines do not need the credentials of the storage. Only gcp can sign urls
+	SignedURLTTL string `json:"signed_url_ttl,omitempty"`
+	// Storage the files are also written to. The files are read from it when the primary storage fails, until the
+	// primary storage is healthy again
+	Secondary *ObjectStorage `json:"secondary,omitempty"`
+	// Storages of the regions the tenants can keep their files in, by region. The files of the tenants without a
+	// region are kept in this storage
+	Regions map[string]*ObjectStorage `json:"regions,omitempty"`
+	// Looks for the files no row of the database references any more, e.g. the files of the deleted plans which
+	// failed to be deleted. nil does not look for them
+	OrphanCleanup *OrphanCleanup `json:"orphan_cleanup,omitempty"`
+}
+
+// OrphanCleanup reports the orphaned files of the object storage periodically, and deletes them when it's set to
+type OrphanCleanup struct {
+	// Deletes the orphaned files older than the grace period. They are only reported otherwise
+	Delete bool `json:"delete"`
+	// Hours a file is left alone after it was last written, 72 by default. The engines upload the files of the runs
+	// before the controller records them
+	GracePeriodHours int `json:"grace_period_hours"`
+}
+
+// WithDefaults returns the cleanup with the defaults of the fields not set
+func (oc *OrphanCleanup) WithDefaults() *OrphanCleanup {
+	c := OrphanCleanup{}
+	if oc != nil {
+		c = *oc
+	}
+	if c.GracePeriodHours == 0 {
+		c.GracePeriodHours = 72
+	}
+	return &c
+}
+
+// SignedURLExpiry is 0 when the urls are not signed
+func (o *ObjectStorage) SignedURLExpiry() time.Duration {
+	if o == nil || o.SignedURLTTL == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(o.SignedURLTTL)
+	if err != nil {
+		return 0
+	}
+	return d
 }
 
 type LogFormat struct {
@@ -112,6 +595,155 @@ type LogFormat struct {
 	JsonPath string `json:"path"`
 }
 
+// AccessLogConfig configures the log of the requests handled by the API server
+type AccessLogConfig struct {
+	Enabled bool `json:"enabled"`
+	// Share of the successful requests which are logged, from 0 to 1, all of them by default. The failed requests
+	// are always logged.
+	SampleRate *float64 `json:"sample_rate,omitempty"`
+	// Logs the bodies of the failed requests and of their responses
+	LogFailedBodies bool `json:"log_failed_bodies"`
+	// Size in bytes of a body logged at most, 4KiB by default
+	MaxBodySize int `json:"max_body_size"`
+}
+
+func (c *AccessLogConfig) Validate() error {
+	if c.SampleRate != nil && (*c.SampleRate < 0 || *c.SampleRate > 1) {
+		return fmt.Errorf("sample rate should be between 0 and 1, got %v", *c.SampleRate)
+	}
+	if c.MaxBodySize < 0 {
+		return fmt.Errorf("max body size cannot be negative")
+	}
+	return nil
+}
+
+// Rate returns the share of the successful requests which are logged
+func (c *AccessLogConfig) Rate() float64 {
+	if c.SampleRate == nil {
+		return 1
+	}
+	return *c.SampleRate
+}
+
+// RunExportConfig redacts the runs exported with anonymize, so their results can be shared with external vendors
+type RunExportConfig struct {
+	// Rules applied after the built-in ones, which redact the users, the e-mail addresses, the hosts of the urls,
+	// the ip addresses and the host names
+	Redactions []*RedactionRule `json:"redactions"`
+}
+
+func (c *RunExportConfig) Validate() error {
+	return validateRedactionRules(c.Redactions)
+}
+
+// The feature flags gating the experimental features, so they can be rolled out gradually
+const (
+	// Plans run by the playwright engine
+	FeaturePlaywrightEngine = "playwright_engine"
+	// The viewers of a tenant cannot change its projects, plans and collections, only the members and the admins can
+	FeatureRBACEnforcement = "rbac_enforcement"
+	// The operations run in the background with async=true
+	FeatureAsyncJobs = "async_jobs"
+)
+
+// Feature is a feature flag and whether the feature is on when the config does not set it
+type Feature struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+}
+
+// KnownFeatures are the flags the config and the tenants can set. The features which were released before they had a
+// flag are on by default, so they keep working for everyone.
+var KnownFeatures = []*Feature{
+	{Name: FeaturePlaywrightEngine, Description: "Plans run by the playwright engine", Default: true},
+	{Name: FeatureRBACEnforcement, Description: "Only the members and the admins of a tenant can change it"},
+	{Name: FeatureAsyncJobs, Description: "Operations run in the background with async=true", Default: true},
+}
+
+// FeatureFlags turns the features on or off for every tenant, the tenants can override them
+type FeatureFlags map[string]bool
+
+func GetFeature(name string) *Feature {
+	for _, f := range KnownFeatures {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (ff FeatureFlags) Validate() error {
+	for name := range ff {
+		if GetFeature(name) == nil {
+			return fmt.Errorf("unknown feature flag %s", name)
+		}
+	}
+	return nil
+}
+
+// Enabled tells whether the feature is on, as set by the config or else by default
+func (ff FeatureFlags) Enabled(name string) bool {
+	if enabled, ok := ff[name]; ok {
+		return enabled
+	}
+	if f := GetFeature(name); f != nil {
+		return f.Default
+	}
+	return false
+}
+
+// Deprecation marks a route of the API as deprecated. Its responses tell the clients when it's removed and what
+// replaces it, and its calls are counted by client, so it's only removed once nobody calls it anymore
+type Deprecation struct {
+	// Name of the route, e.g. usage_summary_by_sid
+	Route string `json:"route"`
+	// Day the route was deprecated, as YYYY-MM-DD
+	Since string `json:"since"`
+	// Day the route is removed, as YYYY-MM-DD. Optional
+	Sunset string `json:"sunset"`
+	// Documentation of the replacement of the route. Optional
+	Link string `json:"link"`
+}
+
+const deprecationDateLayout = "2006-01-02"
+
+// SinceTime is the day the route was deprecated, Validate makes sure it's set
+func (d *Deprecation) SinceTime() time.Time {
+	t, _ := time.Parse(deprecationDateLayout, d.Since)
+	return t
+}
+
+// SunsetTime is the day the route is removed. It's zero when no day is set
+func (d *Deprecation) SunsetTime() time.Time {
+	t, _ := time.Parse(deprecationDateLayout, d.Sunset)
+	return t
+}
+
+func (d *Deprecation) Validate() error {
+	if d.Route == "" {
+		return fmt.Errorf("deprecations need a route")
+	}
+	if _, err := time.Parse(deprecationDateLayout, d.Since); err != nil {
+		return fmt.Errorf("since of the deprecation of %s should be a YYYY-MM-DD day", d.Route)
+	}
+	if d.Sunset != "" {
+		sunset, err := time.Parse(deprecationDateLayout, d.Sunset)
+		if err != nil {
+			return fmt.Errorf("sunset of the deprecation of %s should be a YYYY-MM-DD day", d.Route)
+		}
+		if sunset.Before(d.SinceTime()) {
+			return fmt.Errorf("the sunset of %s cannot be before its deprecation", d.Route)
+		}
+	}
+	if d.Link != "" {
+		if u, err := url.Parse(d.Link); err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+			return fmt.Errorf("link of the deprecation of %s should be an http(s) url", d.Route)
+		}
+	}
+	return nil
+}
+
 type IngressConfig struct {
 	Image    string `json:"image"`
 	Replicas int32  `json:"replicas"`
@@ -141,9 +773,26 @@ type SetagayaConfig struct {
 	AuthConfig       *AuthConfig      `json:"auth_config"`
 	ObjectStorage    *ObjectStorage   `json:"object_storage"`
 	LogFormat        *LogFormat       `json:"log_format"`
+	AccessLog        *AccessLogConfig `json:"access_log,omitempty"`
 	BackgroundColour string           `json:"bg_color"`
 	IngressConfig    *IngressConfig   `json:"ingress"`
 	EnableSid        bool             `json:"enable_sid"`
+	EnableGraphQL    bool             `json:"enable_graphql"`
+	Local            *LocalConfig     `json:"local,omitempty"`
+	// Deadlines of the operations driving the engines. nil means the defaults
+	OperationTimeouts *OperationTimeouts `json:"operation_timeouts,omitempty"`
+	// Redaction of the anonymized exports of the runs. nil applies the built-in rules only
+	RunExport *RunExportConfig `json:"run_export,omitempty"`
+	// Secrets of the deployment scrubbed from the logs and the runs of the API. nil scrubs the built-in ones only
+	SecretRedaction *SecretRedactionConfig `json:"secret_redaction,omitempty"`
+	// Features turned on or off. The features it does not set keep their default
+	FeatureFlags FeatureFlags `json:"feature_flags,omitempty"`
+	// Encryption of the sensitive fields of the database. They cannot be written when it's nil
+	Secure *SecureConfig `json:"secure,omitempty"`
+	// How long the start waits for the dependencies. nil means the defaults
+	Startup *StartupConfig `json:"startup,omitempty"`
+	// Routes of the API the clients should stop calling
+	Deprecations []*Deprecation `json:"deprecations,omitempty"`
 
 	// below are configs generated from above values
 	DevMode         bool
@@ -196,6 +845,7 @@ func setupLogging() {
 			applyJsonLogging()
 		}
 	}
+	setupSecretScrubbing(SC.SecretRedaction)
 }
 
 func loadConfig() *SetagayaConfig {
@@ -222,6 +872,9 @@ func loadConfig() *SetagayaConfig {
 		sc.ObjectStorage = &ObjectStorage{Provider: "local"}
 		return sc
 	}
+	if isLocalMode() {
+		return localConfig(sc)
+	}
 
 	// Validate config file path for security
 	if !strings.HasSuffix(ConfigFilePath, "config.json") {
@@ -245,6 +898,29 @@ func loadConfig() *SetagayaConfig {
 	if sc.HttpConfig != nil {
 		sc.makeHTTPClients()
 	}
+	if ot := sc.OperationTimeouts; ot != nil && (ot.Deploy < 0 || ot.Trigger < 0 || ot.Stop < 0 || ot.Purge < 0) {
+		log.Fatal("The timeouts of the operations cannot be negative")
+	}
+	sc.OperationTimeouts = sc.OperationTimeouts.WithDefaults()
+	if sec := sc.Secure; sec != nil {
+		if err := sec.Validate(); err != nil {
+			log.Fatalf("Invalid secure config: %v", err)
+		}
+	}
+	if ac := sc.AuthConfig; ac != nil && ac.StepUp != nil {
+		if ac.StepUp.Window < 0 || ac.StepUp.MaxAttempts < 0 || ac.StepUp.Lockout < 0 {
+			log.Fatal("The step-up window, max_attempts and lockout cannot be negative")
+		}
+		if sc.Secure == nil || sc.Secure.EncryptionKey == "" {
+			log.Fatal("The step-up needs an encryption_key in the secure config to encrypt the secrets of the admins")
+		}
+	}
+	if st := sc.Startup; st != nil {
+		if err := st.Validate(); err != nil {
+			log.Fatalf("Invalid startup: %v", err)
+		}
+	}
+	sc.Startup = sc.Startup.WithDefaults()
 	// In jmeter agent, we also rely on this module, therefore we need to check whether this is nil or not. As jmeter
 	// configuration might provide an empty struct here
 	// TODO: we should not let jmeter code rely on this part
@@ -256,9 +932,132 @@ func loadConfig() *SetagayaConfig {
 			// if not specified, use k8s as default
 			sc.ExecutorConfig.Cluster.Kind = "k8s"
 		}
+		if r := sc.ExecutorConfig.Cluster.Resilience; r != nil &&
+			(r.Attempts < 0 || r.BackoffMs < 0 || r.FailureThreshold < 0 || r.CooldownSeconds < 0) {
+			log.Fatal("The resilience of the scheduler cannot have negative values")
+		}
+		sc.ExecutorConfig.Cluster.Resilience = sc.ExecutorConfig.Cluster.Resilience.WithDefaults()
 		if sc.ExecutorConfig.MaxEnginesInCollection == 0 {
 			sc.ExecutorConfig.MaxEnginesInCollection = 500
 		}
+		if jc := sc.ExecutorConfig.JmeterContainer; jc != nil {
+			for _, a := range jc.Artifacts {
+				if err := a.Validate(); err != nil {
+					log.Fatalf("Invalid artifact of the jmeter engines: %v", err)
+				}
+			}
+		}
+		if ip := sc.ExecutorConfig.ImagePolicy; ip != nil && ip.ScannerURL == "" {
+			log.Fatal("Image policy needs the url of the scanner")
+		}
+		if esc := sc.ExecutorConfig.SecurityContext; esc != nil {
+			if err := esc.Validate(); err != nil {
+				log.Fatalf("Invalid security context of the engines: %v", err)
+			}
+		}
+		if sm := sc.ExecutorConfig.ServiceMesh; sm != nil {
+			if err := sm.Validate(); err != nil {
+				log.Fatalf("Invalid service mesh of the engines: %v", err)
+			}
+			if sm.ReadyTimeout == 0 {
+				sm.ReadyTimeout = 60
+			}
+		}
+		if ns := sc.ExecutorConfig.NetworkShaper; ns != nil {
+			if ns.Image == "" {
+				log.Fatal("The network shaper needs an image")
+			}
+			if ns.Device == "" {
+				ns.Device = "eth0"
+			}
+		}
+		switch sc.ExecutorConfig.ExecutionMode {
+		case "":
+			sc.ExecutorConfig.ExecutionMode = ExecutionModeDeployment
+		case ExecutionModeDeployment:
+		case ExecutionModeJob:
+			if sc.ExecutorConfig.Cluster.Kind != "k8s" {
+				log.Fatalf("The engines of the %s scheduler cannot run as jobs", sc.ExecutorConfig.Cluster.Kind)
+			}
+		default:
+			log.Fatalf("Invalid execution mode %q, it should be %s or %s", sc.ExecutorConfig.ExecutionMode,
+				ExecutionModeDeployment, ExecutionModeJob)
+		}
+		switch sc.ExecutorConfig.MetricTransport {
+		case "":
+			sc.ExecutorConfig.MetricTransport = MetricTransportSSE
+		case MetricTransportSSE, MetricTransportBatch:
+		default:
+			log.Fatalf("Invalid metric transport %q, it should be %s or %s", sc.ExecutorConfig.MetricTransport,
+				MetricTransportSSE, MetricTransportBatch)
+		}
+		for arch, f := range sc.ExecutorConfig.CPUFactors {
+			if f <= 0 {
+				log.Fatalf("Invalid cpu factor of %s: %v", arch, f)
+			}
+		}
+		if v := sc.ExecutorConfig.MinAgentVersion; v != "" {
+			if _, err := utils.ParseVersion(v); err != nil {
+				log.Fatalf("Invalid minimum version of the agents: %v", err)
+			}
+		}
+	}
+	if o := sc.ObjectStorage; o != nil && o.SignedURLTTL != "" {
+		if d, err := time.ParseDuration(o.SignedURLTTL); err != nil || d <= 0 {
+			log.Fatalf("Invalid ttl of the signed urls: %s", o.SignedURLTTL)
+		}
+	}
+	if o := sc.ObjectStorage; o != nil && o.Secondary != nil {
+		if o.Secondary.Provider == "" || o.Secondary.Secondary != nil {
+			log.Fatal("The secondary object storage needs a provider and cannot have a secondary storage")
+		}
+	}
+	if o := sc.ObjectStorage; o != nil {
+		for region, r := range o.Regions {
+			if region == "" || r == nil || r.Provider == "" || len(r.Regions) > 0 {
+				log.Fatalf("The object storage of region %q needs a provider and cannot have regions", region)
+			}
+		}
+		if oc := o.OrphanCleanup; oc != nil {
+			if oc.GracePeriodHours < 0 {
+				log.Fatal("The grace period of the orphaned files cannot be negative")
+			}
+			o.OrphanCleanup = oc.WithDefaults()
+		}
+	}
+	if re := sc.RunExport; re != nil {
+		if err := re.Validate(); err != nil {
+			log.Fatalf("Invalid export of the runs: %v", err)
+		}
+	}
+	if sr := sc.SecretRedaction; sr != nil {
+		if err := sr.Validate(); err != nil {
+			log.Fatalf("Invalid secret redaction: %v", err)
+		}
+	}
+	if err := sc.FeatureFlags.Validate(); err != nil {
+		log.Fatalf("Invalid feature flags: %v", err)
+	}
+	deprecated := make(map[string]bool)
+	for _, d := range sc.Deprecations {
+		if d == nil {
+			log.Fatal("Invalid deprecation: it cannot be empty")
+		}
+		if err := d.Validate(); err != nil {
+			log.Fatalf("Invalid deprecation: %v", err)
+		}
+		if deprecated[d.Route] {
+			log.Fatalf("Route %s is deprecated twice", d.Route)
+		}
+		deprecated[d.Route] = true
+	}
+	if al := sc.AccessLog; al != nil {
+		if err := al.Validate(); err != nil {
+			log.Fatalf("Invalid access log: %v", err)
+		}
+		if al.MaxBodySize == 0 {
+			al.MaxBodySize = 4096
+		}
 	}
 	if sc.IngressConfig.Lifespan == "" {
 		sc.IngressConfig.Lifespan = "30m"
@@ -279,4 +1078,7 @@ func init() {
 		sc.DBC = createMySQLClient(sc.DBConf)
 		sc.DBEndpoint = sc.DBConf.Endpoint
 	}
+	if sc.Local != nil {
+		sc.DBC = createSQLiteClient(sc.Local.databasePath())
+	}
 }
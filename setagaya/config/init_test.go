@@ -1,9 +1,11 @@
 package config
 
 import (
+	"encoding/base64"
 	"net/http"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -484,3 +486,177 @@ func TestConfigStructIntegration(t *testing.T) {
 	assert.Contains(t, endpoint, mysqlConfig.Host)
 	assert.Contains(t, endpoint, mysqlConfig.Database)
 }
+
+func TestEngineSecurityContextValidate(t *testing.T) {
+	root, nobody, negative := int64(0), int64(65534), int64(-1)
+	testCases := []struct {
+		name  string
+		esc   EngineSecurityContext
+		valid bool
+	}{
+		{"empty", EngineSecurityContext{}, true},
+		{"hardened", EngineSecurityContext{
+			RunAsNonRoot:                true,
+			RunAsUser:                   &nobody,
+			ReadOnlyRootFilesystem:      true,
+			DisallowPrivilegeEscalation: true,
+			SeccompProfile:              "RuntimeDefault",
+			DropCapabilities:            []string{"ALL"},
+		}, true},
+		{"localhost profile", EngineSecurityContext{SeccompProfile: "Localhost/profiles/engine.json"}, true},
+		{"localhost without profile", EngineSecurityContext{SeccompProfile: "Localhost/"}, false},
+		{"unknown profile", EngineSecurityContext{SeccompProfile: "Strict"}, false},
+		{"invalid capability", EngineSecurityContext{DropCapabilities: []string{"net_raw"}}, false},
+		{"negative id", EngineSecurityContext{FSGroup: &negative}, false},
+		{"non-root as root", EngineSecurityContext{RunAsNonRoot: true, RunAsUser: &root}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.esc.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCPUFactor(t *testing.T) {
+	ec := &ExecutorConfig{}
+	assert.Equal(t, 1.0, ec.CPUFactor("arm64"))
+	ec.CPUFactors = map[string]float64{"arm64": 0.8}
+	assert.Equal(t, 0.8, ec.CPUFactor("arm64"))
+	assert.Equal(t, 1.0, ec.CPUFactor("amd64"))
+}
+
+func TestRunsOnce(t *testing.T) {
+	var ec *ExecutorConfig
+	assert.False(t, ec.RunsOnce())
+	ec = &ExecutorConfig{ExecutionMode: ExecutionModeDeployment}
+	assert.False(t, ec.RunsOnce())
+	ec.ExecutionMode = ExecutionModeJob
+	assert.True(t, ec.RunsOnce())
+}
+
+func TestBatchesMetrics(t *testing.T) {
+	var ec *ExecutorConfig
+	assert.False(t, ec.BatchesMetrics())
+	ec = &ExecutorConfig{MetricTransport: MetricTransportSSE}
+	assert.False(t, ec.BatchesMetrics())
+	ec.MetricTransport = MetricTransportBatch
+	assert.True(t, ec.BatchesMetrics())
+}
+
+func TestChaosAllowed(t *testing.T) {
+	var ec *ExecutorConfig
+	assert.False(t, ec.ChaosAllowed("shop"))
+	ec = &ExecutorConfig{}
+	assert.False(t, ec.ChaosAllowed("shop"))
+	ec.ChaosNamespaces = []string{"shop", "payments"}
+	assert.True(t, ec.ChaosAllowed("payments"))
+	assert.False(t, ec.ChaosAllowed("setagaya"))
+}
+
+func TestServiceMeshValidate(t *testing.T) {
+	assert.NoError(t, (&ServiceMesh{Kind: ServiceMeshIstio}).Validate())
+	assert.NoError(t, (&ServiceMesh{Kind: ServiceMeshLinkerd, ReadyTimeout: 30}).Validate())
+	assert.Error(t, (&ServiceMesh{Kind: "consul"}).Validate())
+	assert.Error(t, (&ServiceMesh{Kind: ServiceMeshIstio, ReadyTimeout: -1}).Validate())
+}
+
+func TestAccessLogConfig(t *testing.T) {
+	half, tooMuch := 0.5, 1.5
+	assert.NoError(t, (&AccessLogConfig{}).Validate())
+	assert.NoError(t, (&AccessLogConfig{SampleRate: &half}).Validate())
+	assert.Error(t, (&AccessLogConfig{SampleRate: &tooMuch}).Validate())
+	assert.Error(t, (&AccessLogConfig{MaxBodySize: -1}).Validate())
+	assert.Equal(t, 1.0, (&AccessLogConfig{}).Rate())
+	assert.Equal(t, 0.5, (&AccessLogConfig{SampleRate: &half}).Rate())
+}
+
+func TestSignedURLExpiry(t *testing.T) {
+	var o *ObjectStorage
+	assert.Equal(t, time.Duration(0), o.SignedURLExpiry())
+	assert.Equal(t, time.Duration(0), (&ObjectStorage{}).SignedURLExpiry())
+	assert.Equal(t, time.Duration(0), (&ObjectStorage{SignedURLTTL: "soon"}).SignedURLExpiry())
+	assert.Equal(t, 15*time.Minute, (&ObjectStorage{SignedURLTTL: "15m"}).SignedURLExpiry())
+}
+
+func TestOrphanCleanupDefaults(t *testing.T) {
+	var unset *OrphanCleanup
+	assert.Equal(t, &OrphanCleanup{GracePeriodHours: 72}, unset.WithDefaults())
+	assert.Equal(t, &OrphanCleanup{Delete: true, GracePeriodHours: 24},
+		(&OrphanCleanup{Delete: true, GracePeriodHours: 24}).WithDefaults())
+}
+
+func TestRunExportConfigValidate(t *testing.T) {
+	assert.NoError(t, (&RunExportConfig{}).Validate())
+	assert.NoError(t, (&RunExportConfig{Redactions: []*RedactionRule{{Pattern: `order-\d+`}}}).Validate())
+	assert.Error(t, (&RunExportConfig{Redactions: []*RedactionRule{{Pattern: "("}}}).Validate())
+	assert.Error(t, (&RunExportConfig{Redactions: []*RedactionRule{{Replacement: "x"}}}).Validate())
+}
+
+func TestFeatureFlags(t *testing.T) {
+	var unset FeatureFlags
+	assert.NoError(t, unset.Validate())
+	assert.True(t, unset.Enabled(FeaturePlaywrightEngine))
+	assert.False(t, unset.Enabled(FeatureRBACEnforcement))
+	assert.False(t, unset.Enabled("unknown"))
+
+	ff := FeatureFlags{FeaturePlaywrightEngine: false, FeatureRBACEnforcement: true}
+	assert.NoError(t, ff.Validate())
+	assert.False(t, ff.Enabled(FeaturePlaywrightEngine))
+	assert.True(t, ff.Enabled(FeatureRBACEnforcement))
+	assert.True(t, ff.Enabled(FeatureAsyncJobs))
+	assert.Error(t, FeatureFlags{"unknown": true}.Validate())
+}
+
+func TestDeprecationValidate(t *testing.T) {
+	valid := []*Deprecation{
+		{Route: "usage_summary_by_sid", Since: "2026-10-01"},
+		{Route: "usage_summary_by_sid", Since: "2026-10-01", Sunset: "2027-04-01", Link: "https://docs.example.com/usage"},
+	}
+	for _, d := range valid {
+		assert.NoError(t, d.Validate())
+	}
+	invalid := []*Deprecation{
+		{Since: "2026-10-01"},
+		{Route: "usage_summary_by_sid"},
+		{Route: "usage_summary_by_sid", Since: "01/10/2026"},
+		{Route: "usage_summary_by_sid", Since: "2026-10-01", Sunset: "2026-09-01"},
+		{Route: "usage_summary_by_sid", Since: "2026-10-01", Link: "javascript:alert(1)"},
+	}
+	for _, d := range invalid {
+		assert.Error(t, d.Validate())
+	}
+	d := &Deprecation{Route: "usage_summary_by_sid", Since: "2026-10-01"}
+	assert.True(t, d.SunsetTime().IsZero())
+	assert.Equal(t, 2026, d.SinceTime().Year())
+}
+
+func TestStartupConfig(t *testing.T) {
+	var unset *StartupConfig
+	assert.Equal(t, &StartupConfig{MaxAttempts: 30, RetryInterval: 2, MaxRetryInterval: 30, CheckTimeout: 10,
+		ReadinessInterval: 15}, unset.WithDefaults())
+	assert.Equal(t, 5, (&StartupConfig{MaxAttempts: 5}).WithDefaults().MaxAttempts)
+	assert.NoError(t, (&StartupConfig{MaxAttempts: 5}).Validate())
+	assert.Error(t, (&StartupConfig{MaxAttempts: -1}).Validate())
+	assert.Error(t, (&StartupConfig{RetryInterval: 10, MaxRetryInterval: 5}).Validate())
+}
+
+func TestSecureConfigValidate(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	assert.NoError(t, (&SecureConfig{EncryptionKey: key}).Validate())
+	assert.NoError(t, (&SecureConfig{EncryptionKey: key, PreviousKeys: []string{key}}).Validate())
+	assert.Error(t, (&SecureConfig{}).Validate())
+	assert.Error(t, (&SecureConfig{EncryptionKey: "not base64!"}).Validate())
+	assert.Error(t, (&SecureConfig{EncryptionKey: base64.StdEncoding.EncodeToString(make([]byte, 16))}).Validate())
+	assert.Error(t, (&SecureConfig{EncryptionKey: key, PreviousKeys: []string{"short"}}).Validate())
+}
+
+func TestOperationTimeoutsDefaults(t *testing.T) {
+	var unset *OperationTimeouts
+	assert.Equal(t, &OperationTimeouts{Deploy: 120, Trigger: 300, Stop: 120, Purge: 180}, unset.WithDefaults())
+	assert.Equal(t, 30, (&OperationTimeouts{Stop: 30}).WithDefaults().Stop)
+}
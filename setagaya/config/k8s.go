@@ -4,8 +4,13 @@ import (
 	"fmt"
 	"log"
 
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/flowcontrol"
 	metricsc "k8s.io/metrics/pkg/client/clientset/versioned"
@@ -54,6 +59,25 @@ func GetKubeClient() (*kubernetes.Clientset, error) {
 	return client, nil
 }
 
+// GetDynamicClient returns a client of the custom resources of the cluster and the mapper of their kinds
+func GetDynamicClient() (dynamic.Interface, meta.RESTMapper, error) {
+	config, err := configForContext()
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The kinds are discovered when they are first used, so the custom resources installed later are found
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(dc))
+	return client, mapper, nil
+}
+
 func GetMetricsClient() (*metricsc.Clientset, error) {
 	config, err := configForContext()
 	if err != nil {
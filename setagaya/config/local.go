@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	localModeEnv  = "SETAGAYA_LOCAL_MODE"
+	localDirEnv   = "SETAGAYA_LOCAL_DIR"
+	localUIDirEnv = "SETAGAYA_UI_DIR"
+	localModeFlag = "-local"
+
+	defaultLocalDir = "setagaya-local"
+	// The binary is expected to run from the setagaya folder of the repository
+	defaultLocalUIDir = "ui"
+	// The engines run in docker and reach the platform running on the host
+	defaultLocalEngineHost = "host.docker.internal:8080"
+)
+
+// LocalConfig is the config of the local mode, where the platform runs on a single machine: the database is a
+// SQLite file, the object storage a folder and the engines are docker containers
+type LocalConfig struct {
+	// Where the database and the files are kept
+	Dir string `json:"dir"`
+	// Host and port the engines reach the platform at, to download the test files
+	EngineHost string `json:"engine_host"`
+	// Folder of the templates and the static files of the ui, they are in / of the image otherwise
+	UIDir string `json:"ui_dir"`
+}
+
+func (lc *LocalConfig) databasePath() string {
+	return filepath.Join(lc.Dir, "setagaya.db")
+}
+
+func (lc *LocalConfig) storagePath() string {
+	return filepath.Join(lc.Dir, "storage")
+}
+
+// isLocalMode is checked before the flags are parsed, as the config is loaded when the package is initialised
+func isLocalMode() bool {
+	return os.Getenv(localModeEnv) == "true" || slices.Contains(os.Args[1:], localModeFlag)
+}
+
+// localConfig is the whole config of the local mode, it does not need a config file
+func localConfig(sc *SetagayaConfig) *SetagayaConfig {
+	lc := &LocalConfig{
+		Dir:        os.Getenv(localDirEnv),
+		EngineHost: defaultLocalEngineHost,
+	}
+	if lc.Dir == "" {
+		lc.Dir = defaultLocalDir
+	}
+	if lc.UIDir = os.Getenv(localUIDirEnv); lc.UIDir == "" {
+		lc.UIDir = defaultLocalUIDir
+	}
+	if err := os.MkdirAll(lc.storagePath(), 0750); err != nil {
+		log.Fatalf("Cannot create the folder of the local mode: %v", err)
+	}
+	sc.Local = lc
+	sc.Context = "local"
+	sc.DevMode = true
+	sc.AuthConfig = &AuthConfig{
+		// Without authentication everybody is the setagaya user
+		AdminUsers: []string{"setagaya"},
+		NoAuth:     true,
+		LdapConfig: &LdapConfig{},
+	}
+	sc.HttpConfig = &HttpConfig{}
+	sc.makeHTTPClients()
+	sc.ObjectStorage = &ObjectStorage{
+		Provider: "filesystem",
+		Url:      "http://" + lc.EngineHost + "/storage",
+		Path:     lc.storagePath(),
+	}
+	sc.ExecutorConfig = &ExecutorConfig{
+		Cluster: &ClusterConfig{
+			Kind:       "docker",
+			GCDuration: 15,
+		},
+		JmeterContainer: &JmeterContainer{
+			ExecutorContainer: &ExecutorContainer{
+				Image: "setagaya:jmeter",
+				CPU:   "1",
+				Mem:   "1Gi",
+			},
+		},
+		MaxEnginesInCollection: 5,
+	}
+	sc.IngressConfig.Lifespan = "30m"
+	sc.IngressConfig.GCInterval = "30s"
+	return sc
+}
+
+// UIDir is the folder the templates and the static files of the ui are in
+func (sc *SetagayaConfig) UIDir() string {
+	if sc.Local != nil {
+		return sc.Local.UIDir
+	}
+	return "/"
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NetworkShapingEnv is the shaping the engine was deployed with, so the engine can tell the plan changed since
+const NetworkShapingEnv = "NETWORK_SHAPING"
+
+var shapingRatePattern = regexp.MustCompile(`^\d+(\.\d+)?(bit|kbit|mbit|gbit)$`)
+
+// NetworkShaper shapes the egress traffic of the engines of the plans asking for it, to emulate the networks of
+// constrained clients. The shaping is applied with tc by an init container of the engine pods, which has to run as
+// root with the NET_ADMIN capability. The plans cannot shape their network when it's not configured.
+type NetworkShaper struct {
+	// Image of the init container, it needs the tc command of iproute2
+	Image string `json:"image"`
+	// Network interface of the pods. eth0 by default
+	Device string `json:"device,omitempty"`
+}
+
+// NetworkShaping is the egress network of the engines of a plan
+type NetworkShaping struct {
+	// Bandwidth in the units of tc, e.g. 512kbit or 10mbit
+	Rate string `json:"rate,omitempty" yaml:"rate,omitempty"`
+	// Latency added to every packet, in milliseconds
+	Delay int `json:"delay,omitempty" yaml:"delay,omitempty"`
+	// Variation of the latency, in milliseconds
+	Jitter int `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	// Percentage of the packets dropped
+	Loss float64 `json:"loss,omitempty" yaml:"loss,omitempty"`
+}
+
+func (ns *NetworkShaping) Validate() error {
+	if ns.Rate != "" && !shapingRatePattern.MatchString(ns.Rate) {
+		return fmt.Errorf("rate %s should be a number followed by bit, kbit, mbit or gbit", ns.Rate)
+	}
+	if ns.Delay < 0 || ns.Jitter < 0 {
+		return errors.New("delay and jitter cannot be negative")
+	}
+	if ns.Jitter > 0 && ns.Delay == 0 {
+		return errors.New("jitter needs a delay")
+	}
+	if ns.Loss < 0 || ns.Loss > 100 {
+		return errors.New("loss should be a percentage")
+	}
+	if ns.Rate == "" && ns.Delay == 0 && ns.Loss == 0 {
+		return errors.New("network shaping should set a rate, a delay or a loss")
+	}
+	return nil
+}
+
+// NetemArgs are the arguments of the netem qdisc applying the shaping
+func (ns *NetworkShaping) NetemArgs() []string {
+	args := []string{}
+	if ns.Delay > 0 {
+		args = append(args, "delay", fmt.Sprintf("%dms", ns.Delay))
+		if ns.Jitter > 0 {
+			args = append(args, fmt.Sprintf("%dms", ns.Jitter))
+		}
+	}
+	if ns.Loss > 0 {
+		args = append(args, "loss", strconv.FormatFloat(ns.Loss, 'f', -1, 64)+"%")
+	}
+	if ns.Rate != "" {
+		args = append(args, "rate", ns.Rate)
+	}
+	return args
+}
+
+// String is empty for no shaping
+func (ns *NetworkShaping) String() string {
+	if ns == nil {
+		return ""
+	}
+	return strings.Join(ns.NetemArgs(), " ")
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkShapingValidate(t *testing.T) {
+	assert.NoError(t, (&NetworkShaping{Rate: "512kbit"}).Validate())
+	assert.NoError(t, (&NetworkShaping{Rate: "1.5mbit", Delay: 100, Jitter: 20, Loss: 0.5}).Validate())
+	assert.Error(t, (&NetworkShaping{}).Validate())
+	assert.Error(t, (&NetworkShaping{Rate: "1MB"}).Validate())
+	assert.Error(t, (&NetworkShaping{Delay: -1}).Validate())
+	assert.Error(t, (&NetworkShaping{Jitter: 10}).Validate())
+	assert.Error(t, (&NetworkShaping{Loss: 101}).Validate())
+}
+
+func TestNetworkShapingNetemArgs(t *testing.T) {
+	ns := &NetworkShaping{Rate: "1mbit", Delay: 100, Jitter: 10, Loss: 0.5}
+	assert.Equal(t, []string{"delay", "100ms", "10ms", "loss", "0.5%", "rate", "1mbit"}, ns.NetemArgs())
+	assert.Equal(t, "delay 100ms 10ms loss 0.5% rate 1mbit", ns.String())
+	assert.Equal(t, "rate 1mbit", (&NetworkShaping{Rate: "1mbit"}).String())
+
+	var none *NetworkShaping
+	assert.Equal(t, "", none.String())
+}
@@ -26,6 +26,26 @@ var (
 		Help:       "Percentile latency of a collection",
 		Objectives: map[float64]float64{0.9: 0.01, 0.99: 0.001},
 	}, []string{"collection_id", "label", "run_id"})
+	// Transaction controllers are kept out of the metrics above so the samples are not counted twice
+	TransactionLatencySummary = promauto.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  "setagaya",
+		Name:       "latency_transaction",
+		Help:       "Percentile latency of a business transaction",
+		Objectives: map[float64]float64{0.9: 0.01, 0.99: 0.001},
+	}, []string{"collection_id", "label", "run_id"})
+	// Page timings and web vitals of the playwright engines, by "<test title>:<timing>" label. They are not requests,
+	// so they are kept out of the latency and the counters of the samples. CLS is the score times 1000
+	WebVitalSummary = promauto.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace:  "setagaya",
+		Name:       "web_vital",
+		Help:       "Percentile page timings and web vitals of the playwright scenarios",
+		Objectives: map[float64]float64{0.5: 0.05, 0.75: 0.01, 0.9: 0.01},
+	}, []string{"collection_id", "label", "run_id"})
+	TransactionCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "setagaya",
+		Name:      "transaction_counter",
+		Help:      "stores count of business transactions and whether they were successful",
+	}, []string{"collection_id", "plan_id", "run_id", "engine_no", "label", "success"})
 
 	// This is similar to Latency but cannot use histogram here because we need a very accurate count of every status error that occurred.
 	// So 200s are different bucket than 201s responses.
@@ -54,4 +74,98 @@ var (
 		Name:      "mem_gauge",
 		Help:      "Memory used by engine",
 	}, []string{"collection_id", "plan_id", "engine_no"})
+
+	// Share of the last 10 seconds the tasks of the engine were stalled on the resource, in percent. Only the engines
+	// on the nodes running cgroup v2 report it.
+	PressureGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "pressure_gauge",
+		Help:      "Pressure stall of the engine on a resource",
+	}, []string{"collection_id", "plan_id", "engine_no", "resource", "kind"})
+
+	// Bytes per second the engine receives and sends, by direction, rx or tx
+	NetworkGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "network_gauge",
+		Help:      "Network throughput of engine",
+	}, []string{"collection_id", "plan_id", "engine_no", "direction"})
+
+	TCPRetransmitsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "tcp_retransmits_gauge",
+		Help:      "TCP segments retransmitted per second by engine",
+	}, []string{"collection_id", "plan_id", "engine_no"})
+
+	// Sockets of the engine by state, established or time_wait
+	TCPConnectionsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "tcp_connections_gauge",
+		Help:      "TCP connections of engine",
+	}, []string{"collection_id", "plan_id", "engine_no", "state"})
+
+	// Heap of the JVM running JMeter in bytes, by area, used, committed or max
+	JVMHeapGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "jvm_heap_gauge",
+		Help:      "Heap of the JMeter JVM of engine",
+	}, []string{"collection_id", "plan_id", "engine_no", "area"})
+
+	// Seconds the last collection of a garbage collector of the JMeter JVM took
+	JVMGCPauseGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "jvm_gc_pause_gauge",
+		Help:      "Last pause of a garbage collector of the JMeter JVM of engine",
+	}, []string{"collection_id", "plan_id", "engine_no", "collector"})
+
+	// Seconds per second a garbage collector of the JMeter JVM spent collecting
+	JVMGCTimeGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "jvm_gc_time_gauge",
+		Help:      "Time spent collecting by a garbage collector of the JMeter JVM of engine",
+	}, []string{"collection_id", "plan_id", "engine_no", "collector"})
+
+	// Threads of the JMeter JVM by kind, live or daemon. The live ones include the threads of the test.
+	JVMThreadsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "jvm_threads_gauge",
+		Help:      "Threads of the JMeter JVM of engine",
+	}, []string{"collection_id", "plan_id", "engine_no", "kind"})
+
+	// Info style metric. It is always 1 and is meant to be joined with the engine metrics on engine_no
+	// so dashboards can break the traffic down by region.
+	EngineRegionGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "engine_region",
+		Help:      "Region an engine generates the traffic for",
+	}, []string{"collection_id", "plan_id", "run_id", "engine_no", "region"})
+
+	// Info style metric like the region one, joined on plan_id so dashboards can be scoped to the plans of a team
+	PlanTeamGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "plan_team",
+		Help:      "Team owning a plan of the run",
+	}, []string{"collection_id", "plan_id", "run_id", "team"})
+
+	// Failed calls of the controller to the scheduler, by kind: transient ones are retried, permanent ones are not,
+	// rejected ones were not made because the circuit was open
+	SchedulerCallFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "setagaya",
+		Name:      "scheduler_call_failures",
+		Help:      "Failed calls to the scheduler",
+	}, []string{"operation", "kind"})
+
+	// 1 while the circuit of the scheduler is open and its calls are rejected
+	SchedulerCircuitOpenGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "setagaya",
+		Name:      "scheduler_circuit_open",
+		Help:      "Whether the calls to the scheduler are rejected",
+	}, []string{"scheduler"})
+
+	// Calls to the deprecated routes of the API, by user and by client program, so a route is only removed once
+	// nobody calls it anymore
+	DeprecatedCallsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "setagaya",
+		Name:      "deprecated_api_calls",
+		Help:      "Calls to the deprecated routes of the API",
+	}, []string{"route", "user", "client"})
 )
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// redactionPlaceholder replaces the redacted text when the rule does not say what replaces it
+const redactionPlaceholder = "[REDACTED]"
+
+// RedactionRule replaces the text matching its pattern
+type RedactionRule struct {
+	// Regular expression of the text to redact
+	Pattern string `json:"pattern"`
+	// Text replacing it, [REDACTED] by default. It can refer to the groups of the pattern, e.g. ${1}
+	Replacement string `json:"replacement"`
+}
+
+func validateRedactionRules(rules []*RedactionRule) error {
+	for _, r := range rules {
+		if r == nil || r.Pattern == "" {
+			return fmt.Errorf("redaction rules need a pattern")
+		}
+	}
+	_, err := CompileRedactions(rules)
+	return err
+}
+
+type compiledRedaction struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// Redactions are the rules compiled, the secrets scrubbed from the logs and the identifiers stripped from the
+// exported runs are redacted by them
+type Redactions []*compiledRedaction
+
+// CompileRedactions compiles the rules, which are applied in their order
+func CompileRedactions(rules []*RedactionRule) (Redactions, error) {
+	redactions := Redactions{}
+	for _, rr := range rules {
+		pattern, err := regexp.Compile(rr.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", rr.Pattern, err)
+		}
+		replacement := rr.Replacement
+		if replacement == "" {
+			replacement = redactionPlaceholder
+		}
+		redactions = append(redactions, &compiledRedaction{pattern: pattern, replacement: replacement})
+	}
+	return redactions, nil
+}
+
+// Apply returns the text with the rules applied
+func (rs Redactions) Apply(text string) string {
+	if text == "" {
+		return text
+	}
+	for _, r := range rs {
+		text = r.pattern.ReplaceAllString(text, r.replacement)
+	}
+	return text
+}
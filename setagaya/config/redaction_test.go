@@ -0,0 +1,23 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileRedactions(t *testing.T) {
+	redactions, err := CompileRedactions([]*RedactionRule{
+		{Pattern: `order-\d+`},
+		{Pattern: `(customer=)\w+`, Replacement: "${1}someone"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "[REDACTED] of customer=someone", redactions.Apply("order-42 of customer=alice"))
+	assert.Equal(t, "", redactions.Apply(""))
+
+	_, err = CompileRedactions([]*RedactionRule{{Pattern: "("}})
+	assert.Error(t, err)
+	none, err := CompileRedactions(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "order-42", none.Apply("order-42"))
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"io"
+	stdlog "log"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The secrets scrubbed whatever the config: the bearer tokens, the values of the keys looking like credentials, the
+// passwords of the urls, the signatures of the signed urls, the JWTs, the AWS access keys and the private keys
+var builtinSecretRules = []*RedactionRule{
+	{Pattern: `(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/-]+=*`, Replacement: "${1} " + redactionPlaceholder},
+	{
+		Pattern: `(?i)([\w.-]*(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|credential)[\w.-]*` +
+			`"?\s*[=:]\s*"?)[^\s&"',;]+`,
+		Replacement: "${1}" + redactionPlaceholder,
+	},
+	{Pattern: `([a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:)[^/\s@]+@`, Replacement: "${1}" + redactionPlaceholder + "@"},
+	{
+		Pattern: `(?i)([?&](?:x-amz-signature|x-amz-credential|x-amz-security-token|x-goog-signature|` +
+			`x-goog-credential|signature|sig|googleaccessid|awsaccesskeyid)=)[^&\s"']+`,
+		Replacement: "${1}" + redactionPlaceholder,
+	},
+	{Pattern: `\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`, Replacement: redactionPlaceholder},
+	{Pattern: `\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`, Replacement: redactionPlaceholder},
+	{Pattern: `(?s)-----BEGIN [A-Z ]*PRIVATE KEY-----.*?-----END [A-Z ]*PRIVATE KEY-----`, Replacement: redactionPlaceholder},
+}
+
+// SecretRedactionConfig adds the secrets of the deployment to the ones scrubbed from the logs of the controller and
+// the agents, and from the metadata of the runs returned by the API
+type SecretRedactionConfig struct {
+	// Rules applied after the built-in ones
+	Patterns []*RedactionRule `json:"patterns"`
+}
+
+func (c *SecretRedactionConfig) Validate() error {
+	return validateRedactionRules(c.Patterns)
+}
+
+// SecretScrubber replaces the secrets found in the texts
+type SecretScrubber struct {
+	redactions Redactions
+}
+
+// NewSecretScrubber returns a scrubber of the built-in secrets and of the ones of the config, which can be nil
+func NewSecretScrubber(c *SecretRedactionConfig) (*SecretScrubber, error) {
+	rules := builtinSecretRules
+	if c != nil {
+		rules = append(append([]*RedactionRule{}, rules...), c.Patterns...)
+	}
+	redactions, err := CompileRedactions(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretScrubber{redactions: redactions}, nil
+}
+
+// Scrub returns the text without its secrets
+func (s *SecretScrubber) Scrub(text string) string {
+	return s.redactions.Apply(text)
+}
+
+// Writer scrubs what is written to w. The loggers write an entry at a time
+func (s *SecretScrubber) Writer(w io.Writer) io.Writer {
+	return &scrubbingWriter{w: w, s: s}
+}
+
+type scrubbingWriter struct {
+	w io.Writer
+	s *SecretScrubber
+}
+
+// Write reports the length of p as written, the scrubbed text is shorter or longer
+func (sw *scrubbingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(sw.w, sw.s.Scrub(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// scrubbingFormatter scrubs the entries of logrus once formatted, their fields included
+type scrubbingFormatter struct {
+	log.Formatter
+	s *SecretScrubber
+}
+
+func (f *scrubbingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	b, err := f.Formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(f.s.Scrub(string(b))), nil
+}
+
+var secrets *SecretScrubber
+
+// ScrubSecrets returns the text without the secrets of the config
+func ScrubSecrets(text string) string {
+	return secrets.Scrub(text)
+}
+
+// ScrubSecretsWriter scrubs the secrets of the config from what is written to w, for the loggers of the agents
+func ScrubSecretsWriter(w io.Writer) io.Writer {
+	return secrets.Writer(w)
+}
+
+// setupSecretScrubbing scrubs the secrets from the logs of logrus and of the standard logger
+func setupSecretScrubbing(c *SecretRedactionConfig) {
+	s, err := NewSecretScrubber(c)
+	if err != nil {
+		log.Fatalf("Invalid secret redaction: %v", err)
+	}
+	secrets = s
+	log.SetFormatter(&scrubbingFormatter{Formatter: log.StandardLogger().Formatter, s: s})
+	stdlog.SetOutput(s.Writer(os.Stderr))
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// mysqlDuplicateEntry is the number of the MySQL errors of the inserts breaking a unique key
+const mysqlDuplicateEntry = 1062
+
+//go:embed sqlite_schema.sql
+var sqliteSchema string
+
+// The queries of the models are written for MySQL. The SQLite driver of the local mode rewrites the few MySQL
+// constructs they use into their SQLite equivalent.
+var (
+	insertSetPattern      = regexp.MustCompile(`(?is)^\s*insert\s+(?:into\s+)?(\w+)\s+set\s+(.+)$`)
+	intervalPattern       = regexp.MustCompile(`(?i)NOW\(\)\s*-\s*INTERVAL\s+\?\s+SECOND`)
+	nowPattern            = regexp.MustCompile(`(?i)NOW\(\)`)
+	onDuplicateKeyPattern = regexp.MustCompile(`(?i)on\s+duplicate\s+key\s+update`)
+	lastInsertIDPattern   = regexp.MustCompile(`(?is)set\s+(\w+)\s*=\s*LAST_INSERT_ID\((.+)\)\s*$`)
+	// The transactions of SQLite lock the whole database when they start, the rows need no lock of their own
+	forUpdatePattern = regexp.MustCompile(`(?i)\s+for\s+update\s*$`)
+)
+
+// rewriteMySQL returns the SQLite version of the query and whether it was an update setting LAST_INSERT_ID, the
+// result of which has to be read from the returned row
+func rewriteMySQL(query string) (string, bool) {
+	if m := insertSetPattern.FindStringSubmatch(query); m != nil {
+		columns := []string{}
+		values := []string{}
+		for _, assignment := range strings.Split(m[2], ",") {
+			column, value, _ := strings.Cut(assignment, "=")
+			columns = append(columns, strings.TrimSpace(column))
+			values = append(values, strings.TrimSpace(value))
+		}
+		query = fmt.Sprintf("insert into %s (%s) values (%s)", m[1], strings.Join(columns, ", "), strings.Join(values, ", "))
+	}
+	query = intervalPattern.ReplaceAllString(query, "datetime('now', '-' || ? || ' seconds')")
+	query = nowPattern.ReplaceAllString(query, "CURRENT_TIMESTAMP")
+	query = onDuplicateKeyPattern.ReplaceAllString(query, "on conflict do update set")
+	query = forUpdatePattern.ReplaceAllString(query, "")
+	if lastInsertIDPattern.MatchString(query) {
+		return lastInsertIDPattern.ReplaceAllString(query, "set $1=$2 returning $1"), true
+	}
+	return query, false
+}
+
+type sqliteDriver struct {
+	*sqlite.Driver
+}
+
+func (d *sqliteDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteConn{Conn: conn}, nil
+}
+
+type sqliteConn struct {
+	driver.Conn
+}
+
+func (c *sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	rewritten, returning := rewriteMySQL(query)
+	stmt, err := c.Conn.Prepare(rewritten)
+	if err != nil {
+		return nil, err
+	}
+	if returning {
+		return &returningStmt{Stmt: stmt}, nil
+	}
+	return &sqliteStmt{Stmt: stmt}, nil
+}
+
+// sqliteStmt reports the unique keys broken as MySQL does, the models tell the duplicates by the number of the error
+// to answer them with a conflict or replay the response of the request they retry
+type sqliteStmt struct {
+	driver.Stmt
+}
+
+func (s *sqliteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	r, err := s.Stmt.Exec(args) //nolint:staticcheck // The SQLite driver only implements the driver.Value methods
+	return r, mysqlError(err)
+}
+
+func (s *sqliteStmt) Query(args []driver.Value) (driver.Rows, error) {
+	rows, err := s.Stmt.Query(args) //nolint:staticcheck // The SQLite driver only implements the driver.Value methods
+	return rows, mysqlError(err)
+}
+
+func mysqlError(err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return &mysql.MySQLError{Number: mysqlDuplicateEntry, Message: sqliteErr.Error()}
+	}
+	return err
+}
+
+// returningStmt reads the value MySQL would have given with LAST_INSERT_ID from the row returned by the update
+type returningStmt struct {
+	driver.Stmt
+}
+
+type returningResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r returningResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r returningResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+func (s *returningStmt) Exec(args []driver.Value) (driver.Result, error) {
+	rows, err := s.Stmt.Query(args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := returningResult{}
+	dest := make([]driver.Value, len(rows.Columns()))
+	for {
+		if err := rows.Next(dest); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if id, ok := dest[0].(int64); ok {
+			result.lastInsertID = id
+		}
+		result.rowsAffected++
+	}
+	return result, nil
+}
+
+type sqliteConnector struct {
+	dsn    string
+	driver *sqliteDriver
+}
+
+func (c *sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// OpenLocalDatabase opens the database of the local mode kept in dir. The tests of the models run against it
+func OpenLocalDatabase(dir string) *sql.DB {
+	return createSQLiteClient((&LocalConfig{Dir: dir}).databasePath())
+}
+
+// createSQLiteClient opens the database of the local mode and creates its tables when they do not exist yet
+func createSQLiteClient(path string) *sql.DB {
+	// The write transactions take the lock right away, so they wait for each other instead of failing
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate", path)
+	db := sql.OpenDB(&sqliteConnector{dsn: dsn, driver: &sqliteDriver{Driver: &sqlite.Driver{}}})
+	for _, stmt := range strings.Split(sqliteSchema, ";\n") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+		if _, err := db.Exec(stmt); err != nil {
+			// The columns added to a table are already there when the database was created by this version
+			if strings.Contains(err.Error(), "duplicate column name") {
+				continue
+			}
+			log.Fatalf("Cannot create the tables of the local mode: %v", err)
+		}
+	}
+	return db
+}
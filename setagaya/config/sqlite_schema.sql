@@ -0,0 +1,650 @@
+-- Schema of the local mode. It's the schema the MySQL migrations in db/ end up with, so it has to be kept in sync
+-- with them.
+CREATE TABLE IF NOT EXISTS plan (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    project_id INTEGER NOT NULL,
+    created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS plan_project_id ON plan (project_id);
+
+CREATE TABLE IF NOT EXISTS collection (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    project_id INTEGER NOT NULL,
+    created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    csv_split TINYINT DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS collection_project_id ON collection (project_id);
+
+CREATE TABLE IF NOT EXISTS collection_plan (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    concurrency INTEGER NOT NULL,
+    rampup INTEGER NOT NULL,
+    duration INTEGER NOT NULL,
+    engines INTEGER,
+    created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    csv_split TINYINT DEFAULT 0,
+    target_rps INTEGER NOT NULL DEFAULT 0,
+    engine_type VARCHAR(20) NOT NULL DEFAULT 'jmeter',
+    UNIQUE (collection_id, plan_id)
+);
+
+CREATE TABLE IF NOT EXISTS project (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    owner VARCHAR(50) NOT NULL,
+    created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sid VARCHAR(25)
+);
+CREATE INDEX IF NOT EXISTS project_owner ON project (owner);
+
+CREATE TABLE IF NOT EXISTS running_plan (
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    context VARCHAR(20) NOT NULL,
+    started_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (collection_id, plan_id)
+);
+CREATE INDEX IF NOT EXISTS running_plan_context ON running_plan (context);
+
+CREATE TABLE IF NOT EXISTS collection_run_history (
+    run_id INTEGER NOT NULL UNIQUE,
+    collection_id INTEGER NOT NULL,
+    started_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    end_time TIMESTAMP NULL DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS collection_run_history_started_time ON collection_run_history (collection_id, started_time);
+
+CREATE TABLE IF NOT EXISTS collection_run (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_id INTEGER NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS collection_data (
+    filename VARCHAR(191) NOT NULL,
+    collection_id INTEGER NOT NULL,
+    PRIMARY KEY (collection_id, filename)
+);
+
+CREATE TABLE IF NOT EXISTS plan_data (
+    filename VARCHAR(191) NOT NULL,
+    plan_id INTEGER NOT NULL,
+    PRIMARY KEY (plan_id, filename)
+);
+
+CREATE TABLE IF NOT EXISTS plan_test_file (
+    filename VARCHAR(191) NOT NULL,
+    plan_id INTEGER PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS collection_launch_history2 (
+    collection_id INTEGER NOT NULL,
+    context VARCHAR(20) NOT NULL,
+    owner VARCHAR(50) NOT NULL,
+    launch_id INTEGER NOT NULL,
+    engines_count INTEGER,
+    nodes_count INTEGER,
+    vu INTEGER,
+    started_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    end_time TIMESTAMP NULL DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS collection_launch_history2_end_time ON collection_launch_history2 (collection_id, context, end_time);
+CREATE INDEX IF NOT EXISTS collection_launch_history2_started_time ON collection_launch_history2 (started_time, end_time);
+CREATE INDEX IF NOT EXISTS collection_launch_history2_launch_id ON collection_launch_history2 (launch_id);
+
+CREATE TABLE IF NOT EXISTS collection_launch (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_id INTEGER NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS collection_run_summary (
+    run_id INTEGER NOT NULL PRIMARY KEY,
+    collection_id INTEGER NOT NULL,
+    samples BIGINT NOT NULL DEFAULT 0,
+    min_latency DOUBLE NOT NULL DEFAULT 0,
+    max_latency DOUBLE NOT NULL DEFAULT 0,
+    mean_latency DOUBLE NOT NULL DEFAULT 0,
+    p50 DOUBLE NOT NULL DEFAULT 0,
+    p90 DOUBLE NOT NULL DEFAULT 0,
+    p95 DOUBLE NOT NULL DEFAULT 0,
+    p99 DOUBLE NOT NULL DEFAULT 0,
+    histogram TEXT,
+    assertions TEXT NULL,
+    transactions TEXT NULL,
+    created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS collection_run_summary_collection_id ON collection_run_summary (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_plan_region (
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    region VARCHAR(50) NOT NULL,
+    weight INTEGER NOT NULL,
+    PRIMARY KEY (collection_id, plan_id, region)
+);
+
+CREATE TABLE IF NOT EXISTS plan_parameter (
+    plan_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    default_value VARCHAR(1024) NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (plan_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS collection_run_metadata (
+    run_id INTEGER NOT NULL PRIMARY KEY,
+    collection_id INTEGER NOT NULL,
+    commit_sha VARCHAR(40) NOT NULL DEFAULT '',
+    branch VARCHAR(255) NOT NULL DEFAULT '',
+    build_url VARCHAR(1024) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS collection_run_metadata_collection_id ON collection_run_metadata (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_baseline (
+    collection_id INTEGER NOT NULL PRIMARY KEY,
+    run_id INTEGER NOT NULL,
+    set_by VARCHAR(100) NOT NULL,
+    reason VARCHAR(500) NOT NULL,
+    set_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS collection_baseline_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_id INTEGER NOT NULL,
+    run_id INTEGER NOT NULL,
+    changed_by VARCHAR(100) NOT NULL,
+    reason VARCHAR(500) NOT NULL,
+    changed_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS collection_baseline_history_collection_id ON collection_baseline_history (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_calibration_run (
+    run_id INTEGER NOT NULL PRIMARY KEY,
+    collection_id INTEGER NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS collection_calibration_run_collection_id ON collection_calibration_run (collection_id);
+
+CREATE TABLE IF NOT EXISTS plan_smoke_test (
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    message VARCHAR(1024) NOT NULL DEFAULT '',
+    samples BIGINT NOT NULL DEFAULT 0,
+    failures BIGINT NOT NULL DEFAULT 0,
+    p95 DOUBLE NOT NULL DEFAULT 0,
+    started_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, plan_id)
+);
+
+CREATE TABLE IF NOT EXISTS collection_run_failure_capture (
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    engine_id INTEGER NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    samples INTEGER NOT NULL,
+    PRIMARY KEY (run_id, plan_id, engine_id)
+);
+CREATE INDEX IF NOT EXISTS collection_run_failure_capture_collection_id ON collection_run_failure_capture (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_error (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    label VARCHAR(255) NOT NULL,
+    category VARCHAR(20) NOT NULL,
+    code VARCHAR(255) NOT NULL,
+    message VARCHAR(512) NOT NULL,
+    count BIGINT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS collection_run_error_run_id ON collection_run_error (run_id);
+CREATE INDEX IF NOT EXISTS collection_run_error_collection_id ON collection_run_error (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_gap (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    engine_id INTEGER NOT NULL,
+    file VARCHAR(255) NOT NULL,
+    start_time DATETIME NOT NULL,
+    end_time DATETIME NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    samples BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS collection_run_gap_run_id ON collection_run_gap (run_id);
+CREATE INDEX IF NOT EXISTS collection_run_gap_collection_id ON collection_run_gap (collection_id);
+
+CREATE TABLE IF NOT EXISTS run_id_sequence (
+    id INTEGER NOT NULL
+);
+INSERT INTO run_id_sequence (id) SELECT 0 WHERE NOT EXISTS (SELECT * FROM run_id_sequence);
+
+CREATE TABLE IF NOT EXISTS idempotency_key (
+    collection_id INTEGER NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    response TEXT,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, operation, idempotency_key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_key_created_time ON idempotency_key (created_time);
+
+CREATE TABLE IF NOT EXISTS job (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_id INTEGER NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    result TEXT,
+    error VARCHAR(1024) NOT NULL DEFAULT '',
+    callback_url VARCHAR(1024) NOT NULL DEFAULT '',
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_time TIMESTAMP NULL DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS job_collection_id ON job (collection_id);
+
+CREATE TABLE IF NOT EXISTS tenant (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(30) NOT NULL UNIQUE,
+    owner VARCHAR(50) NOT NULL,
+    namespace VARCHAR(63) NOT NULL,
+    storage_prefix VARCHAR(255) NOT NULL,
+    max_engines INTEGER NOT NULL DEFAULT 0,
+    max_running_collections INTEGER NOT NULL DEFAULT 0,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tenant_role (
+    tenant_id INTEGER NOT NULL,
+    name VARCHAR(20) NOT NULL,
+    PRIMARY KEY (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS tenant_role_assignment (
+    tenant_id INTEGER NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    subject VARCHAR(50) NOT NULL,
+    PRIMARY KEY (tenant_id, role, subject)
+);
+
+CREATE TABLE IF NOT EXISTS project_security_context (
+    project_id INTEGER NOT NULL PRIMARY KEY,
+    security_context TEXT NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS project_registry (
+    project_id INTEGER NOT NULL PRIMARY KEY,
+    registry TEXT NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    detail TEXT NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS audit_log_created_time ON audit_log (created_time);
+
+CREATE TABLE IF NOT EXISTS image_policy_override (
+    digest VARCHAR(71) NOT NULL PRIMARY KEY,
+    image VARCHAR(255) NOT NULL,
+    admin VARCHAR(255) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS project_metadata (
+    project_id INTEGER NOT NULL PRIMARY KEY,
+    metadata TEXT NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS collection_run_engine_config (
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    engine_id INTEGER NOT NULL,
+    config TEXT NOT NULL,
+    jmx_sha256 VARCHAR(64) NOT NULL DEFAULT '',
+    triggered_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, plan_id, engine_id)
+);
+CREATE INDEX IF NOT EXISTS collection_run_engine_config_collection_id ON collection_run_engine_config (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_manifest (
+    run_id INTEGER NOT NULL PRIMARY KEY,
+    collection_id INTEGER NOT NULL,
+    manifest TEXT NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS collection_run_manifest_collection_id ON collection_run_manifest (collection_id);
+
+CREATE TABLE IF NOT EXISTS project_file (
+    project_id INTEGER NOT NULL,
+    filename VARCHAR(191) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, filename)
+);
+
+CREATE TABLE IF NOT EXISTS plan_shared_file (
+    plan_id INTEGER NOT NULL,
+    project_id INTEGER NOT NULL,
+    filename VARCHAR(191) NOT NULL,
+    PRIMARY KEY (plan_id, filename)
+);
+CREATE INDEX IF NOT EXISTS plan_shared_file_project_file ON plan_shared_file (project_id, filename);
+
+CREATE TABLE IF NOT EXISTS object_storage_content (
+    filename VARCHAR(255) NOT NULL PRIMARY KEY,
+    digest CHAR(64) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS object_storage_content_digest ON object_storage_content (digest);
+
+CREATE TABLE IF NOT EXISTS user_favorite (
+    user VARCHAR(191) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    item_id INTEGER NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user, kind, item_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_recent (
+    user VARCHAR(191) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    item_id INTEGER NOT NULL,
+    accessed_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user, kind, item_id)
+);
+CREATE INDEX IF NOT EXISTS user_recent_accessed_time ON user_recent (user, accessed_time);
+
+CREATE TABLE IF NOT EXISTS project_activity (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    target_kind VARCHAR(20) NOT NULL,
+    target_id INTEGER NOT NULL,
+    target_name VARCHAR(255) NOT NULL DEFAULT '',
+    detail VARCHAR(255) NOT NULL DEFAULT '',
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS project_activity_project_id ON project_activity (project_id, id);
+
+CREATE TABLE IF NOT EXISTS run_comment (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    parent_id INTEGER NOT NULL DEFAULT 0,
+    author VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS run_comment_run_id ON run_comment (run_id);
+CREATE INDEX IF NOT EXISTS run_comment_parent_id ON run_comment (parent_id);
+
+CREATE TABLE IF NOT EXISTS user_notification (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user VARCHAR(191) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    collection_id INTEGER NOT NULL,
+    run_id INTEGER NOT NULL,
+    comment_id INTEGER NOT NULL,
+    message VARCHAR(255) NOT NULL,
+    read_time TIMESTAMP NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS user_notification_user ON user_notification (user, id);
+CREATE INDEX IF NOT EXISTS user_notification_comment_id ON user_notification (comment_id);
+
+CREATE TABLE IF NOT EXISTS run_status_page (
+    token VARCHAR(64) PRIMARY KEY,
+    run_id INTEGER NOT NULL UNIQUE,
+    collection_id INTEGER NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS run_share_link (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    expires_time DATETIME NOT NULL,
+    revoked_time TIMESTAMP NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS run_share_link_run_id ON run_share_link (run_id);
+
+CREATE TABLE IF NOT EXISTS collection_verification (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_id INTEGER NOT NULL,
+    run_id INTEGER NOT NULL DEFAULT 0,
+    baseline_run_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    score DOUBLE NOT NULL DEFAULT 0,
+    pass_threshold DOUBLE NOT NULL,
+    marginal_threshold DOUBLE NOT NULL,
+    tolerance DOUBLE NOT NULL,
+    metrics TEXT,
+    message VARCHAR(1024) NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS collection_verification_collection_id ON collection_verification (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_chaos (
+    collection_id INTEGER PRIMARY KEY,
+    actions TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS collection_run_event (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    event_time DATETIME NOT NULL,
+    kind VARCHAR(30) NOT NULL,
+    message VARCHAR(1024) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS collection_run_event_run_id ON collection_run_event (run_id);
+CREATE INDEX IF NOT EXISTS collection_run_event_collection_id ON collection_run_event (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_soak (
+    run_id INTEGER PRIMARY KEY,
+    collection_id INTEGER NOT NULL,
+    started_time DATETIME NOT NULL,
+    end_time DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS collection_run_soak_collection_id ON collection_run_soak (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_heartbeat (
+    run_id INTEGER PRIMARY KEY,
+    collection_id INTEGER NOT NULL,
+    timeout_minutes INTEGER NOT NULL,
+    last_heartbeat DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_by VARCHAR(255) NOT NULL DEFAULT '',
+    stopping_time DATETIME NULL
+);
+CREATE INDEX IF NOT EXISTS collection_run_heartbeat_collection_id ON collection_run_heartbeat (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_checkpoint (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    checkpoint_time DATETIME NOT NULL,
+    summary TEXT NOT NULL,
+    histogram TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS collection_run_checkpoint_run_id ON collection_run_checkpoint (run_id);
+CREATE INDEX IF NOT EXISTS collection_run_checkpoint_collection_id ON collection_run_checkpoint (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_result_segment (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    engine_id INTEGER NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    samples INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS collection_run_result_segment_run_id ON collection_run_result_segment (run_id);
+CREATE INDEX IF NOT EXISTS collection_run_result_segment_collection_id ON collection_run_result_segment (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_pending_plan (
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    plan TEXT NOT NULL,
+    engine_data TEXT NOT NULL,
+    created_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, plan_id)
+);
+CREATE INDEX IF NOT EXISTS collection_run_pending_plan_collection_id ON collection_run_pending_plan (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_plan_retry (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    attempt INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    message VARCHAR(1024) NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS collection_run_plan_retry_run_id ON collection_run_plan_retry (run_id);
+
+CREATE TABLE IF NOT EXISTS collection_reservation (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_id INTEGER NOT NULL,
+    engines INTEGER NOT NULL,
+    cpu VARCHAR(20) NOT NULL,
+    mem VARCHAR(20) NOT NULL,
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS collection_reservation_collection_id ON collection_reservation (collection_id);
+
+CREATE TABLE IF NOT EXISTS collection_run_file (
+    run_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    plan_id INTEGER NOT NULL,
+    filepath VARCHAR(255) NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, plan_id, filepath)
+);
+CREATE INDEX IF NOT EXISTS collection_run_file_filepath ON collection_run_file (filepath);
+CREATE INDEX IF NOT EXISTS collection_run_file_collection_id ON collection_run_file (collection_id);
+
+CREATE TABLE IF NOT EXISTS tenant_branding (
+    tenant_id INTEGER NOT NULL PRIMARY KEY,
+    host VARCHAR(255) NULL UNIQUE,
+    branding TEXT NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS tenant_feature_flag (
+    tenant_id INTEGER NOT NULL,
+    flag VARCHAR(50) NOT NULL,
+    enabled TINYINT(1) NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, flag)
+);
+
+CREATE TABLE IF NOT EXISTS plan_secret (
+    plan_id INTEGER NOT NULL,
+    name VARCHAR(63) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    value TEXT NOT NULL,
+    updated_by VARCHAR(50) NOT NULL DEFAULT '',
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (plan_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS project_budget (
+    project_id INTEGER NOT NULL,
+    monthly_engine_minutes INTEGER NOT NULL,
+    updated_by VARCHAR(255) NOT NULL DEFAULT '',
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id)
+);
+
+CREATE TABLE IF NOT EXISTS project_budget_extension (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    month CHAR(7) NOT NULL,
+    engine_minutes INTEGER NOT NULL,
+    granted_by VARCHAR(255) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS project_budget_extension_month ON project_budget_extension (project_id, month);
+
+CREATE TABLE IF NOT EXISTS project_budget_warning (
+    project_id INTEGER NOT NULL,
+    month CHAR(7) NOT NULL,
+    threshold INTEGER NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, month, threshold)
+);
+
+CREATE TABLE IF NOT EXISTS account_mfa (
+    account VARCHAR(255) PRIMARY KEY,
+    secret VARCHAR(255) NOT NULL,
+    confirmed INTEGER NOT NULL DEFAULT 0,
+    last_counter BIGINT NOT NULL DEFAULT 0,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until DATETIME,
+    created_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS platform_freeze (
+    id INTEGER PRIMARY KEY DEFAULT 1,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    frozen_by VARCHAR(255) NOT NULL,
+    frozen_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Columns added to the tables above. Adding a column twice fails, which is ignored when the schema is applied
+ALTER TABLE collection_plan ADD COLUMN os VARCHAR(10) NOT NULL DEFAULT 'linux';
+ALTER TABLE collection_plan ADD COLUMN arch VARCHAR(10) NOT NULL DEFAULT '';
+ALTER TABLE collection_plan ADD COLUMN network_shaping TEXT;
+ALTER TABLE collection_plan ADD COLUMN dns_caching TEXT;
+ALTER TABLE collection_plan ADD COLUMN connection_policy TEXT;
+ALTER TABLE tenant ADD COLUMN storage_region VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE project ADD COLUMN description TEXT;
+ALTER TABLE plan ADD COLUMN description TEXT;
+ALTER TABLE collection ADD COLUMN description TEXT;
+ALTER TABLE collection ADD COLUMN continuous TEXT;
+ALTER TABLE collection ADD COLUMN soak TEXT;
+ALTER TABLE collection_plan ADD COLUMN rampdown INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE collection_plan ADD COLUMN concurrency_distribution TEXT;
+ALTER TABLE collection_plan ADD COLUMN start_after TEXT;
+ALTER TABLE collection ADD COLUMN variables TEXT;
+ALTER TABLE collection_plan ADD COLUMN variables TEXT;
+ALTER TABLE plan ADD COLUMN team VARCHAR(63) NOT NULL DEFAULT '';
+ALTER TABLE collection_run_failure_capture ADD COLUMN team VARCHAR(63) NOT NULL DEFAULT '';
+ALTER TABLE collection_run_result_segment ADD COLUMN team VARCHAR(63) NOT NULL DEFAULT '';
+ALTER TABLE collection_run_engine_config ADD COLUMN agent_version VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE collection_run_engine_config ADD COLUMN engine_version VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE collection_run_metadata ADD COLUMN seed BIGINT NULL;
+ALTER TABLE collection_plan ADD COLUMN warmup INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE collection_plan ADD COLUMN max_engine_rps INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteMySQL(t *testing.T) {
+	testCases := []struct {
+		name      string
+		query     string
+		expected  string
+		returning bool
+	}{
+		{
+			name:     "insert set",
+			query:    "insert project set name=?, owner=?",
+			expected: "insert into project (name, owner) values (?, ?)",
+		},
+		{
+			name:     "insert into set",
+			query:    "insert into collection_launch_history2 set collection_id=?,context=?",
+			expected: "insert into collection_launch_history2 (collection_id, context) values (?, ?)",
+		},
+		{
+			name:     "interval",
+			query:    "delete from idempotency_key where created_time < NOW() - INTERVAL ? SECOND",
+			expected: "delete from idempotency_key where created_time < datetime('now', '-' || ? || ' seconds')",
+		},
+		{
+			name:     "upsert",
+			query:    "insert into smoke_test (collection_id) values (?) on duplicate key update started_time=NOW()",
+			expected: "insert into smoke_test (collection_id) values (?) on conflict do update set started_time=CURRENT_TIMESTAMP",
+		},
+		{
+			name:     "for update",
+			query:    "select count(*) from object_storage_content where digest=? for update",
+			expected: "select count(*) from object_storage_content where digest=?",
+		},
+		{
+			name:      "last insert id",
+			query:     "update run_id_sequence set id=LAST_INSERT_ID(id+1)",
+			expected:  "update run_id_sequence set id=id+1 returning id",
+			returning: true,
+		},
+		{
+			name:     "untouched",
+			query:    "select id from project where owner=?",
+			expected: "select id from project where owner=?",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, returning := rewriteMySQL(tc.query)
+			assert.Equal(t, tc.expected, query)
+			assert.Equal(t, tc.returning, returning)
+		})
+	}
+}
+
+func TestSQLiteClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "setagaya.db")
+	db := createSQLiteClient(path)
+
+	r, err := db.Exec("insert project set name=?, owner=?, sid=?", "local", "setagaya", "")
+	assert.NoError(t, err)
+	projectID, err := r.LastInsertId()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), projectID)
+
+	for i := int64(1); i <= 2; i++ {
+		r, err = db.Exec("update run_id_sequence set id=LAST_INSERT_ID(id+1)")
+		assert.NoError(t, err)
+		runID, err := r.LastInsertId()
+		assert.NoError(t, err)
+		assert.Equal(t, i, runID)
+	}
+
+	upsert := "insert into idempotency_key (collection_id, operation, idempotency_key, status_code) values (?,?,?,?) on duplicate key update status_code=?"
+	for _, code := range []int{200, 409} {
+		_, err = db.Exec(upsert, 1, "trigger", "key", code, code)
+		assert.NoError(t, err)
+	}
+	var code int
+	assert.NoError(t, db.QueryRow("select status_code from idempotency_key where collection_id=?", 1).Scan(&code))
+	assert.Equal(t, 409, code)
+
+	r, err = db.Exec("delete from idempotency_key where created_time < NOW() - INTERVAL ? SECOND", 3600)
+	assert.NoError(t, err)
+	deleted, err := r.RowsAffected()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+
+	// Opening the database again keeps what it holds
+	assert.NoError(t, db.Close())
+	db = createSQLiteClient(path)
+	defer db.Close()
+	var name string
+	assert.NoError(t, db.QueryRow("select name from project where id=?", projectID).Scan(&name))
+	assert.Equal(t, "local", name)
+}
+
+func TestSQLiteDuplicateEntry(t *testing.T) {
+	db := createSQLiteClient(filepath.Join(t.TempDir(), "setagaya.db"))
+	defer db.Close()
+
+	// The unique keys and the primary keys broken are reported as MySQL does
+	duplicates := []struct {
+		name  string
+		query string
+		args  []any
+	}{
+		{name: "unique", query: "insert collection_run set collection_id=?", args: []any{1}},
+		{
+			name:  "primary key",
+			query: "insert into idempotency_key (collection_id, operation, idempotency_key) values (?, ?, ?)",
+			args:  []any{1, "trigger", "key"},
+		},
+	}
+	for _, d := range duplicates {
+		t.Run(d.name, func(t *testing.T) {
+			_, err := db.Exec(d.query, d.args...)
+			assert.NoError(t, err)
+			_, err = db.Exec(d.query, d.args...)
+			var mysqlErr *mysql.MySQLError
+			assert.True(t, errors.As(err, &mysqlErr))
+			assert.Equal(t, uint16(mysqlDuplicateEntry), mysqlErr.Number)
+		})
+	}
+
+	// The other errors are left as they are
+	_, err := db.Exec("insert collection_run set collection_id=?", nil)
+	assert.Error(t, err)
+	var mysqlErr *mysql.MySQLError
+	assert.False(t, errors.As(err, &mysqlErr))
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// startAttendedRun records the first heartbeat of the run when it's attended-only. The trigger counts as one
+func startAttendedRun(collection *model.Collection, runID int64, ar *model.AttendedRun) {
+	if ar == nil {
+		return
+	}
+	if err := model.StartRunHeartbeat(collection.ID, runID, ar, time.Now(), ""); err != nil {
+		log.Printf("Error starting the heartbeat of run %d: %v", runID, err)
+	}
+}
+
+// checkAttendedRun stops the attended-only run of the collection when nobody sent its heartbeat for the timeout.
+// The jmeter engines ramp down first, the run is ended once they had the time to. It's called for the plans still
+// in progress.
+func (c *Controller) checkAttendedRun(collection *model.Collection) {
+	if _, checking := c.checkingHeartbeats.LoadOrStore(collection.ID, struct{}{}); checking {
+		return
+	}
+	go func() {
+		defer c.checkingHeartbeats.Delete(collection.ID)
+		runID, err := collection.GetCurrentRun()
+		if err != nil || runID == 0 {
+			return
+		}
+		rh, err := model.GetRunHeartbeat(runID)
+		if err != nil {
+			// The run is not attended-only
+			return
+		}
+		now := time.Now()
+		switch {
+		case rh.Missed(now):
+			if err := rh.Stop(now); err != nil {
+				log.Printf("Error stopping attended run %d: %v", runID, err)
+				return
+			}
+			message := fmt.Sprintf("no heartbeat since %s, ramping down over %d seconds",
+				rh.LastHeartbeat.UTC().Format(time.RFC3339), model.AttendedRampdown)
+			log.Printf("Attended run %d of collection %d: %s", runID, collection.ID, message)
+			if err := model.AddRunEvent(collection.ID, runID, model.RunEventHeartbeatMissed, message); err != nil {
+				log.Printf("Error recording the event of run %d: %v", runID, err)
+			}
+			c.rampdownCollection(collection, model.AttendedRampdown)
+		case rh.RampedDown(now):
+			log.Printf("Attended run %d of collection %d ramped down", runID, collection.ID)
+			if err := c.TermCollection(context.Background(), collection, false); err != nil {
+				log.Printf("Error ending attended run %d: %v", runID, err)
+			}
+		}
+	}()
+}
+
+// rampdownCollection has the jmeter engines of the running plans stop their threads over the seconds. The other
+// engines keep running until the run is ended.
+func (c *Controller) rampdownCollection(collection *model.Collection, seconds int) {
+	eps, err := collection.GetExecutionPlans()
+	if err != nil {
+		log.Printf("Error ramping down collection %d: %v", collection.ID, err)
+		return
+	}
+	targets := []*model.ExecutionPlan{}
+	for _, ep := range eps {
+		if ep.GetEngineType() == model.JmeterEngine {
+			targets = append(targets, ep)
+		}
+	}
+	rr := &enginesModel.RampdownRequest{Seconds: seconds}
+	c.forEachConnectedEngine(collection, targets, func(engine setagayaEngine, _ int64, key string) {
+		if err := engine.rampdown(rr); err != nil {
+			log.Printf("Error ramping down engine %s: %v", key, err)
+		}
+	})
+}
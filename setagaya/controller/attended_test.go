@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestAttendedRunEngineDataConfigs(t *testing.T) {
+	ec := config.SC.ExecutorConfig
+	defer func() { config.SC.ExecutorConfig = ec }()
+	config.SC.ExecutorConfig = &config.ExecutorConfig{JmeterContainer: &config.JmeterContainer{}}
+
+	ep := &model.ExecutionPlan{PlanID: 1, Engines: 3, Concurrency: 10, Duration: 5}
+	collection := &model.Collection{ID: 1, ExecutionPlans: []*model.ExecutionPlan{ep}}
+	plan := &model.Plan{ID: 1, TestFile: &model.SetagayaFile{Filename: "test.jmx", Filepath: "plan/1/test.jmx"}}
+
+	for _, attended := range []*model.AttendedRun{nil, {HeartbeatTimeout: 60}} {
+		tr := &model.TriggerRequest{Attended: attended}
+		edcs := runEngineDataConfigs(collection, tr, []map[string]string{nil})
+		pc := NewPlanController(ep, collection, nil)
+		engineDataConfigs := pc.prepare(plan, edcs[0], 1)
+		assert.Len(t, engineDataConfigs, 3)
+		// Every engine ramps down when nobody attends the run anymore, not only the config of the plan
+		for _, edc := range engineDataConfigs {
+			assert.Equal(t, attended != nil, edc.Attended)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const (
+	budgetCheckInterval = time.Minute
+	// Actor of the warnings in the activity of the projects
+	budgetActor = "setagaya"
+)
+
+// TrackBudgets warns the projects reaching the thresholds of their engine minutes budget, in their activity. The
+// exhausted budgets block the triggers, the collections running already are not stopped.
+func (c *Controller) TrackBudgets() {
+	log.Info("Start the loop for tracking the budgets of the projects")
+	for {
+		checkBudgets(time.Now())
+		time.Sleep(budgetCheckInterval)
+	}
+}
+
+func checkBudgets(now time.Time) {
+	budgets, err := model.GetProjectBudgets()
+	if err != nil {
+		log.Errorf("Error getting the budgets of the projects: %v", err)
+		return
+	}
+	for _, pb := range budgets {
+		bs, err := model.GetBudgetStatus(pb.ProjectID, now)
+		if err != nil || bs == nil {
+			log.Errorf("Error getting the budget of project %d: %v", pb.ProjectID, err)
+			continue
+		}
+		if err := warnBudget(bs); err != nil {
+			log.Errorf("Error warning project %d about its budget: %v", pb.ProjectID, err)
+		}
+	}
+}
+
+// warnBudget records the thresholds the project reached. A single warning is shown for the highest one, the budget
+// can be set in the middle of the month with several thresholds reached already.
+func warnBudget(bs *model.BudgetStatus) error {
+	highest := 0
+	for _, threshold := range bs.CrossedThresholds() {
+		warned, err := model.RecordBudgetWarning(bs.ProjectID, bs.Month, threshold)
+		if err != nil {
+			return err
+		}
+		if warned {
+			highest = threshold
+		}
+	}
+	if highest == 0 {
+		return nil
+	}
+	detail := fmt.Sprintf("%d%% of the engine minutes budget of %s is used: %.0f of %d", highest, bs.Month,
+		bs.ConsumedEngineMinutes, bs.LimitEngineMinutes)
+	if bs.Exhausted {
+		detail += ", the collections cannot be triggered until an admin extends it"
+	}
+	log.Printf("Project %d: %s", bs.ProjectID, detail)
+	return model.RecordActivity(&model.Activity{ProjectID: bs.ProjectID, Actor: budgetActor,
+		Action: model.ActivityProjectBudgetWarning, TargetKind: model.UserItemProject, TargetID: bs.ProjectID,
+		Detail: detail})
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const (
+	CalendarEntryRun         = "run"
+	CalendarEntryReservation = "reservation"
+
+	DefaultCalendarRange = 7 * 24 * time.Hour
+	MaxCalendarRange     = 31 * 24 * time.Hour
+	calendarSlot         = time.Hour
+)
+
+// CalendarEntry is a window the engines of a collection take room in the cluster, either a run in progress or a
+// reservation
+type CalendarEntry struct {
+	Kind          string `json:"kind"`
+	CollectionID  int64  `json:"collection_id"`
+	ProjectID     int64  `json:"project_id"`
+	ReservationID int64  `json:"reservation_id,omitempty"`
+	RunID         int64  `json:"run_id,omitempty"`
+	Engines       int    `json:"engines"`
+	// The end of a run is expected from the duration of its plans. The continuous runs last until they are stopped,
+	// they are open ended.
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	OpenEnded bool      `json:"open_ended,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+// CalendarSlot is the engines expected to run during a slot of the calendar
+type CalendarSlot struct {
+	StartTime time.Time `json:"start_time"`
+	Engines   int       `json:"engines"`
+}
+
+// Calendar is what takes room in the cluster during a range, so the teams can spread their big tests
+type Calendar struct {
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Entries []*CalendarEntry `json:"entries"`
+	// Engines expected every hour of the range, and the most of them
+	Slots       []*CalendarSlot `json:"slots"`
+	PeakEngines int             `json:"peak_engines"`
+}
+
+// ValidateCalendarRange checks the range is not empty and not too long to be listed
+func ValidateCalendarRange(from, to time.Time) error {
+	if !to.After(from) {
+		return errors.New("to should be after from")
+	}
+	if to.Sub(from) > MaxCalendarRange {
+		return fmt.Errorf("the calendar cannot cover more than %s", MaxCalendarRange)
+	}
+	return nil
+}
+
+// makeCalendarSlots counts the engines of the entries in every slot of the range. A collection running within its
+// reservation uses the room it reserved, so only the most engines of the entries of a collection are counted.
+func makeCalendarSlots(entries []*CalendarEntry, from, to time.Time, slot time.Duration) ([]*CalendarSlot, int) {
+	slots := []*CalendarSlot{}
+	peak := 0
+	for start := from; start.Before(to); start = start.Add(slot) {
+		end := start.Add(slot)
+		byCollection := map[int64]int{}
+		for _, e := range entries {
+			if e.StartTime.Before(end) && e.EndTime.After(start) {
+				byCollection[e.CollectionID] = max(byCollection[e.CollectionID], e.Engines)
+			}
+		}
+		engines := 0
+		for _, n := range byCollection {
+			engines += n
+		}
+		slots = append(slots, &CalendarSlot{StartTime: start, Engines: engines})
+		peak = max(peak, engines)
+	}
+	return slots, peak
+}
+
+// runEntry is the run in progress of a collection, it's expected to end with its longest plan. A run lasting longer
+// than expected is still running now.
+func runEntry(collection *model.Collection, started, now, to time.Time) (*CalendarEntry, error) {
+	eps, err := collection.GetExecutionPlans()
+	if err != nil {
+		return nil, err
+	}
+	e := &CalendarEntry{
+		Kind:         CalendarEntryRun,
+		CollectionID: collection.ID,
+		ProjectID:    collection.ProjectID,
+		StartTime:    started,
+	}
+	duration := 0
+	for _, ep := range eps {
+		e.Engines += ep.Engines
+		duration = max(duration, ep.Duration)
+	}
+	e.EndTime = started.Add(time.Duration(duration) * time.Minute)
+	if e.RunID, err = collection.GetCurrentRun(); err != nil {
+		return nil, err
+	}
+	switch {
+	case collection.Continuous != nil:
+		e.EndTime = to
+		e.OpenEnded = true
+	case collection.Soak != nil:
+		// The soak runs can be extended while they run
+		if rs, err := model.GetRunSoak(e.RunID); err == nil {
+			e.EndTime = rs.EndTime
+		}
+	}
+	if e.EndTime.Before(now) {
+		e.EndTime = now
+	}
+	return e, nil
+}
+
+// Calendar lists the runs in progress and the reservations of all the collections between from and to, along with
+// the engines expected every hour
+func (c *Controller) Calendar(from, to time.Time) (*Calendar, error) {
+	entries := []*CalendarEntry{}
+	now := time.Now()
+	running, err := model.GetRunningCollections()
+	if err != nil {
+		return nil, err
+	}
+	collections := map[int64]*model.Collection{}
+	getCollection := func(id int64) (*model.Collection, error) {
+		if collection, ok := collections[id]; ok {
+			return collection, nil
+		}
+		collection, err := model.GetCollection(id)
+		if err != nil {
+			return nil, err
+		}
+		collections[id] = collection
+		return collection, nil
+	}
+	for _, rp := range running {
+		collection, err := getCollection(rp.CollectionID)
+		if err != nil {
+			return nil, err
+		}
+		e, err := runEntry(collection, rp.StartedTime, now, to)
+		if err != nil {
+			return nil, err
+		}
+		if !e.EndTime.Before(from) {
+			entries = append(entries, e)
+		}
+	}
+	reservations, err := model.GetOverlappingReservations(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reservations {
+		collection, err := getCollection(r.CollectionID)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &CalendarEntry{
+			Kind:          CalendarEntryReservation,
+			CollectionID:  r.CollectionID,
+			ProjectID:     collection.ProjectID,
+			ReservationID: r.ID,
+			Engines:       r.Engines,
+			StartTime:     r.StartTime,
+			EndTime:       r.EndTime,
+			CreatedBy:     r.CreatedBy,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartTime.Before(entries[j].StartTime)
+	})
+	slots, peak := makeCalendarSlots(entries, from.Truncate(calendarSlot), to, calendarSlot)
+	return &Calendar{From: from, To: to, Entries: entries, Slots: slots, PeakEngines: peak}, nil
+}
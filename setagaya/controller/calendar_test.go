@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeCalendarSlots(t *testing.T) {
+	from := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	entries := []*CalendarEntry{
+		{Kind: CalendarEntryReservation, CollectionID: 1, Engines: 20, StartTime: from.Add(time.Hour),
+			EndTime: from.Add(3 * time.Hour)},
+		// The run within the reservation of its collection takes the room reserved
+		{Kind: CalendarEntryRun, CollectionID: 1, Engines: 10, StartTime: from.Add(90 * time.Minute),
+			EndTime: from.Add(2 * time.Hour)},
+		{Kind: CalendarEntryRun, CollectionID: 2, Engines: 5, StartTime: from.Add(-time.Hour),
+			EndTime: from.Add(150 * time.Minute)},
+	}
+	slots, peak := makeCalendarSlots(entries, from, from.Add(4*time.Hour), time.Hour)
+	engines := []int{}
+	for _, s := range slots {
+		engines = append(engines, s.Engines)
+	}
+	assert.Equal(t, []int{5, 25, 25, 0}, engines)
+	assert.Equal(t, from.Add(time.Hour), slots[1].StartTime)
+	assert.Equal(t, 25, peak)
+
+	slots, peak = makeCalendarSlots(nil, from, from.Add(time.Hour), time.Hour)
+	assert.Len(t, slots, 1)
+	assert.Equal(t, 0, peak)
+}
+
+func TestValidateCalendarRange(t *testing.T) {
+	from := time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, ValidateCalendarRange(from, from.Add(DefaultCalendarRange)))
+	assert.NoError(t, ValidateCalendarRange(from, from.Add(MaxCalendarRange)))
+	assert.Error(t, ValidateCalendarRange(from, from))
+	assert.Error(t, ValidateCalendarRange(from, from.Add(-time.Hour)))
+	assert.Error(t, ValidateCalendarRange(from, from.Add(MaxCalendarRange+time.Hour)))
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const (
+	// How often the run is checked for its end, to remove its experiments
+	chaosPoll    = 5 * time.Second
+	chaosTimeout = 30 * time.Second
+)
+
+// scheduleChaos takes the chaos actions of the collection at their time during the run. The run can be ended by
+// another process, e.g. the controller when its plans are over, so the experiments are removed once the run is seen
+// as ended rather than by the code ending it.
+func (c *Controller) scheduleChaos(collection *model.Collection, runID int64) {
+	if c.chaos == nil {
+		return
+	}
+	actions, err := collection.GetChaosActions()
+	if err != nil {
+		log.Printf("Error getting the chaos actions of collection %d: %v", collection.ID, err)
+		return
+	}
+	if len(actions) == 0 {
+		return
+	}
+	go c.runChaos(collection, runID, actions, time.Now())
+}
+
+func (c *Controller) runChaos(collection *model.Collection, runID int64, actions []*model.ChaosAction, start time.Time) {
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].Offset() < actions[j].Offset() })
+	var injected []*model.ChaosAction
+	defer func() {
+		for _, action := range injected {
+			c.removeChaos(collection, runID, action)
+		}
+	}()
+	next := 0
+	for {
+		running, err := chaosRunInProgress(collection, runID)
+		if err != nil {
+			log.Printf("Error checking run %d for its chaos actions: %v", runID, err)
+		}
+		if !running {
+			return
+		}
+		for ; next < len(actions) && !time.Now().Before(start.Add(actions[next].Offset())); next++ {
+			if c.injectChaos(collection, runID, actions[next]) {
+				injected = append(injected, actions[next])
+			}
+		}
+		wait := chaosPoll
+		if next < len(actions) {
+			wait = min(wait, time.Until(start.Add(actions[next].Offset())))
+		}
+		time.Sleep(wait)
+	}
+}
+
+// chaosRunInProgress tells whether the run is still the current one of the collection. The run is considered in
+// progress when it cannot be told, not to remove the experiments too early.
+func chaosRunInProgress(collection *model.Collection, runID int64) (bool, error) {
+	currRunID, err := collection.GetCurrentRun()
+	if err != nil {
+		return true, err
+	}
+	return currRunID == runID, nil
+}
+
+func (c *Controller) injectChaos(collection *model.Collection, runID int64, action *model.ChaosAction) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), chaosTimeout)
+	defer cancel()
+	apiVersion, kind := action.APIVersion()
+	target := fmt.Sprintf("%s %s (%s) in namespace %s", action.Name, kind, apiVersion, action.Namespace)
+	err := c.chaos.Inject(ctx, runID, action)
+	kindOfEvent, message := model.RunEventChaosInjected, target
+	if err != nil {
+		log.Printf("Error taking chaos action %s of run %d: %v", action.Name, runID, err)
+		kindOfEvent, message = model.RunEventChaosFailed, fmt.Sprintf("%s: %v", target, err)
+	}
+	if err := model.AddRunEvent(collection.ID, runID, kindOfEvent, message); err != nil {
+		log.Printf("Error recording chaos action %s of run %d: %v", action.Name, runID, err)
+	}
+	return err == nil
+}
+
+func (c *Controller) removeChaos(collection *model.Collection, runID int64, action *model.ChaosAction) {
+	ctx, cancel := context.WithTimeout(context.Background(), chaosTimeout)
+	defer cancel()
+	if err := c.chaos.Remove(ctx, runID, action); err != nil {
+		log.Printf("Error removing chaos action %s of run %d: %v", action.Name, runID, err)
+		return
+	}
+	if err := model.AddRunEvent(collection.ID, runID, model.RunEventChaosRemoved, action.Name); err != nil {
+		log.Printf("Error recording the removal of chaos action %s of run %d: %v", action.Name, runID, err)
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"os"
+
 	log "github.com/sirupsen/logrus"
 
 	"github.com/hveda/Setagaya/setagaya/controller"
@@ -9,7 +13,28 @@ import (
 // This func keep tracks of all the running engines. They should just rely on the data in the db
 // and make necessary queries to the scheduler.
 func main() {
+	selfTest := flag.Bool("selftest", false, "run the self test of the platform, print its report and exit")
+	flag.Parse()
+	if *selfTest {
+		runSelfTest()
+		return
+	}
 	log.Info("Controller is running in distributed mode")
 	controller := controller.NewController()
+	controller.WaitForDependencies()
+	go controller.MonitorDependencies()
 	controller.IsolateBackgroundTasks()
 }
+
+// runSelfTest exits with 1 when the platform is not healthy, so it can be used as a post upgrade check
+func runSelfTest() {
+	report := controller.NewController().SelfTest()
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+	if !report.Healthy {
+		os.Exit(1)
+	}
+}
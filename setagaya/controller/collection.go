@@ -1,9 +1,13 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -36,6 +40,21 @@ func prepareCollection(collection *model.Collection) []*enginesModel.EngineDataC
 	return engineDataConfigs
 }
 
+// runEngineDataConfigs returns what the engines of each plan receive when the run is triggered
+func runEngineDataConfigs(collection *model.Collection, tr *model.TriggerRequest,
+	planParams []map[string]string) []*enginesModel.EngineDataConfig {
+	engineDataConfigs := prepareCollection(collection)
+	for i, params := range planParams {
+		engineDataConfigs[i].Parameters = params
+		engineDataConfigs[i].FailureCapture = tr.FailureCapture
+		engineDataConfigs[i].ResultSegments = collection.Soak != nil
+		engineDataConfigs[i].Seed = tr.Seed
+		engineDataConfigs[i].ShuffleData = tr.ShuffleData
+		engineDataConfigs[i].Attended = tr.Attended != nil
+	}
+	return engineDataConfigs
+}
+
 func (c *Controller) calculateUsage(collection *model.Collection) error {
 	eps, err := collection.GetExecutionPlans()
 	if err != nil {
@@ -43,12 +62,75 @@ func (c *Controller) calculateUsage(collection *model.Collection) error {
 	}
 	vu := 0
 	for _, ep := range eps {
-		vu += ep.Engines * ep.Concurrency
+		vu += ep.TotalConcurrency()
 	}
 	return collection.MarkUsageFinished(config.SC.Context, int64(vu))
 }
 
-func (c *Controller) TermAndPurgeCollection(collection *model.Collection) (err error) {
+const (
+	// How long we wait for the engines to shut down after they are stopped, and for the pods to be gone after a purge
+	shutdownVerifyTimeout  = 30 * time.Second
+	shutdownVerifyInterval = 2 * time.Second
+)
+
+// waitUntil calls done every interval until it returns true, the timeout is reached or ctx is done
+func waitUntil(ctx context.Context, timeout, interval time.Duration, done func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if done() {
+			return true
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(interval):
+		}
+	}
+}
+
+// waitEnginesStopped polls the progress of the engines until none of them is running a test.
+// It returns the keys of the engines still running when it gives up.
+func waitEnginesStopped(ctx context.Context, engines map[string]setagayaEngine) []string {
+	var running []string
+	waitUntil(ctx, shutdownVerifyTimeout, shutdownVerifyInterval, func() bool {
+		running = []string{}
+		for key, engine := range engines {
+			if engine.progress() {
+				running = append(running, key)
+			}
+		}
+		return len(running) == 0
+	})
+	sort.Strings(running)
+	return running
+}
+
+// waitEnginesPurged waits until the scheduler has no engine of the collection left
+func (c *Controller) waitEnginesPurged(ctx context.Context, collectionID int64) error {
+	var left int
+	var err error
+	purged := waitUntil(ctx, shutdownVerifyTimeout, shutdownVerifyInterval, func() bool {
+		left, err = c.Scheduler.EngineCount(ctx, collectionID)
+		return err == nil && left == 0
+	})
+	if err != nil {
+		return err
+	}
+	if !purged && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if !purged {
+		return makeEnginesNotPurgedError(left)
+	}
+	return nil
+}
+
+// TermAndPurgeCollection terminates the run of the collection and deletes its engines. The work left is given up when
+// ctx is done, the usage of the collection is accounted anyway.
+func (c *Controller) TermAndPurgeCollection(ctx context.Context, collection *model.Collection) (err error) {
 	// This is a force remove so we ignore the errors happened at test termination
 	defer func() {
 		// This is a bit tricky. We only set the error to the outer scope to not nil when e is not nil
@@ -57,10 +139,10 @@ func (c *Controller) TermAndPurgeCollection(collection *model.Collection) (err e
 			err = e
 		}
 	}()
-	if termErr := c.TermCollection(collection, true); termErr != nil {
+	if termErr := c.TermCollection(ctx, collection, true); termErr != nil {
 		return termErr
 	}
-	if err = c.Scheduler.PurgeCollection(collection.ID); err != nil {
+	if err = c.Scheduler.PurgeCollection(ctx, collection.ID); err != nil {
 		return err
 	}
 	eps, err := collection.GetExecutionPlans()
@@ -70,10 +152,65 @@ func (c *Controller) TermAndPurgeCollection(collection *model.Collection) (err e
 	for _, p := range eps {
 		c.deleteEngineHealthMetrics(strconv.Itoa(int(collection.ID)), strconv.Itoa(int(p.PlanID)), p.Engines)
 	}
-	return err
+	return c.waitEnginesPurged(ctx, collection.ID)
 }
 
-// validateCollectionPlans ensures all plans have test files
+// ForcePurgeCollection is the way out for a collection stuck in a state the normal flow cannot handle,
+// e.g. engines that never stop or running plans left behind by a crashed controller. It does not talk
+// to the engines nor collect the run digests, it drops the streams, deletes the scheduler resources and
+// clears the running plans. All the steps are tried even when one of them fails, the scheduler is not called once
+// ctx is done.
+func (c *Controller) ForcePurgeCollection(ctx context.Context, collection *model.Collection) error {
+	var errs []error
+	eps, err := collection.GetExecutionPlans()
+	if err != nil {
+		return err
+	}
+	for _, ep := range eps {
+		for i := 0; i < ep.Engines; i++ {
+			key := makePlanEngineKey(collection.ID, ep.PlanID, i)
+			if item, ok := c.connectedEngines.LoadAndDelete(key); ok {
+				if engine, ok := item.(setagayaEngine); ok {
+					engine.closeStream()
+				}
+			}
+		}
+		c.deleteEngineHealthMetrics(strconv.Itoa(int(collection.ID)), strconv.Itoa(int(ep.PlanID)), ep.Engines)
+	}
+	if err := c.Scheduler.PurgeCollection(ctx, collection.ID); err != nil {
+		errs = append(errs, err)
+	}
+	if err := model.DeleteRunningPlansByCollection(collection.ID); err != nil {
+		errs = append(errs, err)
+	}
+	if err := model.DeletePendingPlansByCollection(collection.ID); err != nil {
+		errs = append(errs, err)
+	}
+	currRunID, err := collection.GetCurrentRun()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if err := collection.StopRun(); err != nil {
+		errs = append(errs, err)
+	}
+	if currRunID != 0 {
+		if err := collection.RunFinish(currRunID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := c.calculateUsage(collection); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		if err := c.waitEnginesPurged(ctx, collection.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	log.Printf("Collection %d is force purged", collection.ID)
+	return errors.Join(errs...)
+}
+
+// validateCollectionPlans ensures all plans have test files, and the fragments their test plans include
 func validateCollectionPlans(collection *model.Collection) error {
 	for _, ep := range collection.ExecutionPlans {
 		plan, planErr := model.GetPlan(ep.PlanID)
@@ -83,24 +220,32 @@ func validateCollectionPlans(collection *model.Collection) error {
 		if plan.TestFile == nil {
 			return fmt.Errorf("triggering plan aborted; there is no Test file (.jmx) in this plan %d", plan.ID)
 		}
+		if _, err := planFragments(plan); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// triggerExecutionPlans starts all execution plans concurrently
-func (c *Controller) triggerExecutionPlans(collection *model.Collection, engineDataConfigs []*enginesModel.EngineDataConfig, runID int64) []error {
+// triggerExecutionPlans starts all execution plans concurrently. The plans starting after other plans wait until
+// startDuePlans triggers them.
+func (c *Controller) triggerExecutionPlans(ctx context.Context, collection *model.Collection, engineDataConfigs []*enginesModel.EngineDataConfig, runID int64) []error {
 	errs := make(chan error, len(collection.ExecutionPlans))
 	defer close(errs)
 
 	for i, ep := range collection.ExecutionPlans {
 		go func(i int, ep *model.ExecutionPlan) {
+			if ep.StartAfter != nil {
+				errs <- deferPlan(collection, ep, engineDataConfigs[i], runID)
+				return
+			}
 			pc := NewPlanController(ep, collection, c.Scheduler)
-			if err := pc.trigger(engineDataConfigs[i], runID); err != nil {
+			if err := pc.trigger(ctx, engineDataConfigs[i], runID); err != nil {
 				errs <- err
 				return
 			}
 
-			if err := pc.subscribe(&c.connectedEngines, c.readingEngines); err != nil {
+			if err := pc.subscribe(ctx, &c.connectedEngines, c.readingEngines); err != nil {
 				errs <- err
 				return
 			}
@@ -124,45 +269,153 @@ func (c *Controller) triggerExecutionPlans(collection *model.Collection, engineD
 	return triggerErrors
 }
 
-func (c *Controller) TriggerCollection(collection *model.Collection) error {
+// TriggerCollection starts a new run of the collection with the parameters and metadata supplied in tr.
+// It returns the id of the run, which is recorded before the engines are triggered, also when some of the
+// plans could not be triggered. Nothing is started when ctx is done before the run is recorded, the plans which are
+// not triggered yet when it's done fail.
+func (c *Controller) TriggerCollection(ctx context.Context, collection *model.Collection, tr *model.TriggerRequest) (int64, error) {
+	runID, _, err := c.triggerCollection(ctx, collection, tr, 0, false)
+	return runID, err
+}
+
+// triggerCollection also returns the manifest of the run, nil when it could not be recorded. nextWindow tells the
+// run follows the previous window of a continuous collection.
+func (c *Controller) triggerCollection(ctx context.Context, collection *model.Collection, tr *model.TriggerRequest, reproducedFrom int64,
+	nextWindow bool) (int64, *model.RunManifest, error) {
 	var err error
 	// Get all the execution plans within the collection
 	collection.ExecutionPlans, err = collection.GetExecutionPlans()
 	if err != nil {
-		return err
+		return int64(0), nil, err
 	}
 
 	if validateErr := validateCollectionPlans(collection); validateErr != nil {
-		return validateErr
+		return int64(0), nil, validateErr
+	}
+	// The scheduled triggers, the windows and the retries are refused along with the ones of the API
+	if err := model.CheckPlatformFreeze(); err != nil {
+		return int64(0), nil, err
+	}
+	if err := model.CheckBudget(collection.ProjectID, time.Now()); err != nil {
+		return int64(0), nil, err
+	}
+	if tr.Attended != nil && collection.Continuous != nil {
+		return int64(0), nil, &model.RequestError{Message: "the windows of a continuous collection run unattended"}
+	}
+	// The samples of the run are not mixed with the ones of a replay
+	if c.StopReplay(collection.ID) {
+		log.Printf("Replay of collection %d is stopped by the trigger", collection.ID)
+	}
+	if collection.Continuous != nil {
+		collection.Continuous.ApplyTo(collection.ExecutionPlans, nextWindow)
+	}
+	if collection.Soak != nil {
+		collection.Soak.ApplyTo(collection.ExecutionPlans)
 	}
 
-	engineDataConfigs := prepareCollection(collection)
-	runID, err := collection.StartRun()
+	planParams, err := collection.ResolveCollectionParameters(tr.Parameters)
 	if err != nil {
-		return err
+		return int64(0), nil, err
+	}
+	if err := c.handshake(ctx, collection); err != nil {
+		return int64(0), nil, err
+	}
+	tr = tr.WithSeed()
+	// The manifest is recorded before the run starts, so it has the files the engines are about to download
+	manifest, err := c.runManifest(ctx, collection, tr)
+	if err != nil {
+		log.Printf("Error recording the manifest of collection %d: %v", collection.ID, err)
 	}
 
-	triggerErrors := c.triggerExecutionPlans(collection, engineDataConfigs, runID)
+	engineDataConfigs := runEngineDataConfigs(collection, tr, planParams)
+	if err := ctx.Err(); err != nil {
+		return int64(0), nil, err
+	}
+	runID, err := collection.StartRun()
+	if err != nil {
+		return int64(0), nil, err
+	}
+	startSoakRun(collection, runID)
+	startAttendedRun(collection, runID, tr.Attended)
+	if manifest != nil {
+		manifest.RunID = runID
+		manifest.ReproducedFrom = reproducedFrom
+		if err := model.StoreRunManifest(manifest); err != nil {
+			log.Printf("Error storing the manifest of run %d: %v", runID, err)
+			manifest = nil
+		}
+	}
+	if tr.Calibration {
+		if err := model.MarkCalibrationRun(collection.ID, runID); err != nil {
+			log.Printf("Error marking run %d as calibration: %v", runID, err)
+		}
+	}
+	// Metadata is informational. We should not fail the run because of it
+	metadata := new(model.RunMetadata)
+	if tr.Metadata != nil {
+		*metadata = *tr.Metadata
+	}
+	metadata.Seed = tr.Seed
+	if err := model.StoreRunMetadata(collection.ID, runID, metadata); err != nil {
+		log.Printf("Error storing metadata of run %d: %v", runID, err)
+	}
 
-	if err := collection.NewRun(runID); err != nil {
-		log.Printf("Error creating new run: %v", err)
+	triggerErrors := c.triggerExecutionPlans(ctx, collection, engineDataConfigs, runID)
+	if len(triggerErrors) < len(collection.ExecutionPlans) {
+		c.scheduleChaos(collection, runID)
 	}
 
-	if len(triggerErrors) == len(collection.ExecutionPlans) {
-		// every plan in collection has error
-		if err := c.TermCollection(collection, true); err != nil {
+	running, err := collection.HasRunningPlan()
+	if err != nil {
+		log.Printf("Error checking the running plans of collection %d: %v", collection.ID, err)
+	}
+	if err == nil && !running {
+		// every plan in collection has error. The run is ended even when the trigger was given up
+		if err := c.TermCollection(context.WithoutCancel(ctx), collection, true); err != nil {
 			log.Printf("Error terminating collection: %v", err)
 		}
 	}
 
 	if len(triggerErrors) > 0 {
-		return fmt.Errorf("triggering errors %v", triggerErrors)
+		return runID, manifest, fmt.Errorf("triggering errors %v", triggerErrors)
 	}
 
+	return runID, manifest, nil
+}
+
+// StopPlan terminates the engines of a running plan of the collection while its other plans keep running. The run
+// ends with its last plan.
+func (c *Controller) StopPlan(ctx context.Context, collection *model.Collection, planID int64) error {
+	ep, err := model.GetExecutionPlan(collection.ID, planID)
+	if err != nil {
+		return err
+	}
+	// The plan can end while it's being stopped, so it's only looked up with the ends of the plans held off
+	lock := c.sequencingLock(collection.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	if _, err := model.GetRunningPlan(collection.ID, planID); err != nil {
+		return &model.RequestError{Err: err, Message: fmt.Sprintf("plan %d is not running", planID)}
+	}
+	runID, err := collection.GetCurrentRun()
+	if err != nil {
+		return err
+	}
+	if runID == 0 {
+		return &model.RequestError{Message: fmt.Sprintf("plan %d is not running", planID)}
+	}
+	// Recorded before the plan ends, it can be the last one of the run
+	message := fmt.Sprintf("plan %d was stopped", planID)
+	if err := model.AddRunEvent(collection.ID, runID, model.RunEventPlanStopped, message); err != nil {
+		log.Printf("Error recording the event of run %d: %v", runID, err)
+	}
+	c.finishPlan(ctx, collection, NewPlanController(ep, collection, c.Scheduler), runID)
 	return nil
 }
 
-func (c *Controller) TermCollection(collection *model.Collection, force bool) (e error) {
+// TermCollection stops the engines of the collection and ends its run. The engines which are not stopped when ctx is
+// done are left to the purge, the run is ended anyway.
+func (c *Controller) TermCollection(ctx context.Context, collection *model.Collection, force bool) (e error) {
 	eps, err := collection.GetExecutionPlans()
 	if err != nil {
 		return err
@@ -171,13 +424,42 @@ func (c *Controller) TermCollection(collection *model.Collection, force bool) (e
 	if err != nil {
 		return err
 	}
+	// Digests need to be collected before the engines are terminated and the streams are closed
+	if currRunID != 0 {
+		if err := c.storeRunSummary(collection, eps, currRunID); err != nil {
+			log.Printf("Error storing run summary: %v", err)
+		}
+		c.storeFailureCaptures(collection, eps, currRunID)
+		if err := c.storeRunErrors(collection, eps, currRunID); err != nil {
+			log.Printf("Error storing run errors: %v", err)
+		}
+		if err := c.storeRunGaps(collection, eps, currRunID); err != nil {
+			log.Printf("Error storing run gaps: %v", err)
+		}
+		c.storeLastResultSegments(collection, eps, currRunID)
+	}
+	if err := model.DeletePendingPlansByCollection(collection.ID); err != nil {
+		log.Printf("Error deleting the waiting plans of collection %d: %v", collection.ID, err)
+	}
+	// The engines are disconnected as they are terminated, so we keep them to check they actually shut down
+	stopping := make(map[string]setagayaEngine)
+	for _, ep := range eps {
+		for i := 0; i < ep.Engines; i++ {
+			key := makePlanEngineKey(collection.ID, ep.PlanID, i)
+			if item, ok := c.connectedEngines.Load(key); ok {
+				if engine, ok := item.(setagayaEngine); ok {
+					stopping[key] = engine
+				}
+			}
+		}
+	}
 	var wg sync.WaitGroup
 	for _, ep := range eps {
 		wg.Add(1)
 		go func(ep *model.ExecutionPlan) {
 			defer wg.Done()
 			pc := NewPlanController(ep, collection, nil) // we don't need scheduler here
-			if err := pc.term(force, &c.connectedEngines); err != nil {
+			if err := pc.term(ctx, force, &c.connectedEngines); err != nil {
 				log.Error(err)
 				e = err
 			}
@@ -185,6 +467,13 @@ func (c *Controller) TermCollection(collection *model.Collection, force bool) (e
 		}(ep)
 	}
 	wg.Wait()
+	// A forced termination is followed by a purge, which checks the engines are gone
+	if !force {
+		if running := waitEnginesStopped(ctx, stopping); len(running) > 0 {
+			log.Printf("Engines of collection %d are still running after stop: %v", collection.ID, running)
+			e = makeEnginesNotStoppedError(running)
+		}
+	}
 	if err := collection.StopRun(); err != nil {
 		log.Printf("Error stopping run: %v", err)
 	}
@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestWaitUntil(t *testing.T) {
+	calls := 0
+	done := waitUntil(context.Background(), time.Second, time.Millisecond, func() bool {
+		calls++
+		return calls == 3
+	})
+	assert.True(t, done)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	done = waitUntil(context.Background(), 10*time.Millisecond, 4*time.Millisecond, func() bool {
+		calls++
+		return false
+	})
+	assert.False(t, done)
+	assert.Greater(t, calls, 1)
+
+	// The wait is given up as soon as the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = 0
+	start := time.Now()
+	done = waitUntil(ctx, time.Minute, time.Second, func() bool {
+		calls++
+		cancel()
+		return false
+	})
+	assert.False(t, done)
+	assert.Equal(t, 1, calls)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestStopPlan(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	c := &Controller{}
+	collection := &model.Collection{ID: 1, ProjectID: 1}
+	for _, planID := range []int64{1, 2} {
+		assert.NoError(t, collection.AddExecutionPlan(&model.ExecutionPlan{PlanID: planID, Engines: 1, Concurrency: 1, Duration: 1}))
+	}
+	runID, err := collection.StartRun()
+	assert.NoError(t, err)
+	assert.NoError(t, model.AddRunningPlan(collection.ID, 1))
+	assert.NoError(t, model.AddRunningPlan(collection.ID, 2))
+
+	// The other plan keeps the run going
+	assert.NoError(t, c.StopPlan(context.Background(), collection, 1))
+	_, err = model.GetRunningPlan(collection.ID, 1)
+	assert.Error(t, err)
+	_, err = model.GetRunningPlan(collection.ID, 2)
+	assert.NoError(t, err)
+	current, err := collection.GetCurrentRun()
+	assert.NoError(t, err)
+	assert.Equal(t, runID, current)
+	events, err := model.GetRunEvents(runID)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, model.RunEventPlanStopped, events[0].Kind)
+	}
+	assert.ErrorIs(t, c.StopPlan(context.Background(), collection, 1), model.ErrInvalid)
+
+	// The last plan is stopped while the garbage collector finds it over, the run ends once
+	ep, err := model.GetExecutionPlan(collection.ID, 2)
+	assert.NoError(t, err)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	stopped := false
+	go func() {
+		defer wg.Done()
+		// The plan is not running anymore when the garbage collector ended it first
+		err := c.StopPlan(context.Background(), collection, 2)
+		if err != nil {
+			assert.ErrorIs(t, err, model.ErrInvalid)
+		}
+		stopped = err == nil
+	}()
+	go func() {
+		defer wg.Done()
+		c.endPlan(context.Background(), collection, NewPlanController(ep, collection, nil))
+	}()
+	wg.Wait()
+	current, err = collection.GetCurrentRun()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), current)
+	last, err := collection.GetLastRun()
+	assert.NoError(t, err)
+	if assert.NotNil(t, last) {
+		assert.Equal(t, runID, last.ID)
+		assert.False(t, last.EndTime.IsZero())
+	}
+	running, err := collection.HasRunningPlan()
+	assert.NoError(t, err)
+	assert.False(t, running)
+	// The stop is recorded in the run it ended, only when the plan was still running
+	events, err = model.GetRunEvents(runID)
+	assert.NoError(t, err)
+	if !stopped {
+		assert.Len(t, events, 1)
+	} else if assert.Len(t, events, 2) {
+		assert.Equal(t, model.RunEventPlanStopped, events[1].Kind)
+	}
+}
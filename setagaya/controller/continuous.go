@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// rollContinuousRun ends the window of a continuous collection and starts the next one with the same trigger. The
+// engines of a plan finish when the window is over, or earlier when they crashed and were restarted by the cluster.
+// Either way they are triggered again, and deployed again first when they are gone.
+func (c *Controller) rollContinuousRun(collection *model.Collection) {
+	if _, rolling := c.rollingCollections.LoadOrStore(collection.ID, struct{}{}); rolling {
+		return
+	}
+	go func() {
+		defer c.rollingCollections.Delete(collection.ID)
+		runID, err := collection.GetCurrentRun()
+		if err != nil || runID == 0 {
+			return
+		}
+		tr := &model.TriggerRequest{}
+		if manifest, err := model.GetRunManifest(runID); err == nil && manifest.Trigger != nil {
+			previous := *manifest.Trigger
+			previous.Calibration = false
+			tr = &previous
+		}
+		log.Printf("Window of run %d of continuous collection %d is over", runID, collection.ID)
+		if err := c.TermCollection(context.Background(), collection, false); err != nil {
+			log.Printf("Error ending the window of collection %d: %v", collection.ID, err)
+		}
+		if err := c.startWindow(collection, tr); err != nil {
+			log.Printf("Continuous collection %d is stopped, the next window cannot start: %v", collection.ID, err)
+		}
+	}()
+}
+
+func (c *Controller) startWindow(collection *model.Collection, tr *model.TriggerRequest) error {
+	runID, _, err := c.triggerCollection(context.Background(), collection, tr, 0, true)
+	if err == nil {
+		log.Printf("Run %d of continuous collection %d started", runID, collection.ID)
+		return nil
+	}
+	// Deploying the engines again would not let the window start
+	if errors.Is(err, model.ErrPlatformFrozen) || errors.Is(err, model.ErrBudgetExhausted) {
+		return err
+	}
+	// The run goes on with the plans that could be triggered
+	if current, currErr := collection.GetCurrentRun(); currErr == nil && current != 0 {
+		log.Printf("Run %d of continuous collection %d started without some plans: %v", current, collection.ID, err)
+		return nil
+	}
+	log.Printf("Deploying the engines of continuous collection %d again: %v", collection.ID, err)
+	if err := c.deployAndWait(collection); err != nil {
+		return err
+	}
+	runID, _, err = c.triggerCollection(context.Background(), collection, tr, 0, true)
+	if err != nil {
+		return err
+	}
+	log.Printf("Run %d of continuous collection %d started", runID, collection.ID)
+	return nil
+}
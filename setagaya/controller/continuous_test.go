@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestStartWindowFrozen(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	// Without a scheduler, the window would panic if it deployed the engines
+	c := &Controller{}
+	collection := &model.Collection{ID: 1, ProjectID: 1, Continuous: &model.ContinuousMode{}}
+	assert.NoError(t, model.FreezePlatform(&model.PlatformFreeze{Reason: "incident", FrozenBy: "admin"}))
+
+	assert.ErrorIs(t, c.startWindow(collection, &model.TriggerRequest{}), model.ErrPlatformFrozen)
+}
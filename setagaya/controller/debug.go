@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	engineClient "github.com/hveda/Setagaya/setagaya/engines/client"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/utils"
+)
+
+// A debug execution starts a new jmeter process, so it takes much longer than the other engine requests
+var debugHttpClient = &http.Client{
+	Timeout: 3 * time.Minute,
+}
+
+var (
+	errDebugEngineType     = errors.New("debug sessions are only supported by jmeter plans")
+	errDebugEngineNotReady = errors.New("the debug engine is not ready. Start a debug session or wait for the engine to be deployed")
+)
+
+func (c *Controller) getDebugPlan(collection *model.Collection, planID int64) (*model.ExecutionPlan, *model.Plan, error) {
+	ep, err := model.GetExecutionPlan(collection.ID, planID)
+	if err != nil {
+		return nil, nil, &model.DBError{Err: err, Message: "plan is not part of the collection"}
+	}
+	if findEngineType(ep) != JmeterEngineType {
+		return nil, nil, &model.RequestError{Err: errDebugEngineType, Message: errDebugEngineType.Error()}
+	}
+	plan, err := model.GetPlan(planID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if plan.TestFile == nil {
+		return nil, nil, &model.RequestError{Message: fmt.Sprintf("there is no test file in plan %d", plan.ID)}
+	}
+	if err := addFragments(plan); err != nil {
+		return nil, nil, err
+	}
+	// Debug executions are single iterations, so the plan does not need a duration
+	return makeSingleEngineExecutionPlan(ep, 0), plan, nil
+}
+
+// StartDebugSession deploys the debug engine of the plan. It returns once the deployment is started.
+// Debug sessions keep a single jmeter engine deployed so the samplers can be executed on demand, one iteration
+// at a time, to inspect the full requests and responses inside the real engine environment.
+// The session ends when the collection is purged.
+func (c *Controller) StartDebugSession(ctx context.Context, collection *model.Collection, planID int64) error {
+	ep, _, err := c.getDebugPlan(collection, planID)
+	if err != nil {
+		return err
+	}
+	if err := c.launchSingleEngine(ctx, collection); err != nil {
+		return err
+	}
+	pc := NewPlanController(ep, collection, c.Scheduler)
+	if err := utils.RetryContext(ctx, func() error {
+		return pc.deploy(ctx)
+	}, nil); err != nil {
+		return err
+	}
+	log.Printf("Debug session of plan %d in collection %d is started", planID, collection.ID)
+	return nil
+}
+
+// DebugSamplers executes the samplers once in the debug engine of the plan and returns their requests and responses
+func (c *Controller) DebugSamplers(ctx context.Context, collection *model.Collection, planID int64, samplers []string,
+	runParams map[string]string) (*enginesModel.DebugResult, error) {
+	ep, plan, err := c.getDebugPlan(collection, planID)
+	if err != nil {
+		return nil, err
+	}
+	params, err := model.ResolveParameters(plan.Parameters, runParams)
+	if err != nil {
+		return nil, &model.ParameterError{Message: err.Error()}
+	}
+	if c.Scheduler.PodReadyCount(ctx, collection.ID) < 1 {
+		return nil, &model.RequestError{Err: errDebugEngineNotReady, Message: errDebugEngineNotReady.Error()}
+	}
+	engines, err := generateEnginesWithUrl(ctx, 1, ep.PlanID, collection.ID, collection.ProjectID, JmeterEngineType, c.Scheduler)
+	if err != nil {
+		return nil, &model.RequestError{Err: err, Message: errDebugEngineNotReady.Error()}
+	}
+	engine, ok := engines[0].(*jmeterEngine)
+	if !ok {
+		return nil, makeWrongEngineTypeError()
+	}
+	pc := NewPlanController(ep, collection, c.Scheduler)
+	return engine.debug(ctx, &enginesModel.DebugRequest{
+		EngineDataConfig: makeSingleEngineConfig(collection, pc, plan, params),
+		Samplers:         samplers,
+	})
+}
+
+func (je *jmeterEngine) debug(ctx context.Context, dr *enginesModel.DebugRequest) (*enginesModel.DebugResult, error) {
+	r, err := engineClient.New(je.engineUrl, debugHttpClient).Debug(ctx, dr)
+	var se *engineClient.StatusError
+	switch {
+	case errors.Is(err, engineClient.ErrBusy):
+		return nil, &model.RequestError{Message: "the debug engine is busy with another execution"}
+	case errors.Is(err, engineClient.ErrFilesMissing):
+		return nil, &model.RequestError{Message: "some test files are missing. Please re-upload them"}
+	case errors.Is(err, engineClient.ErrInvalidRequest) && errors.As(err, &se):
+		return nil, &model.RequestError{Message: fmt.Sprintf("invalid debug request: %s", se.Message)}
+	case err != nil:
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// deferPlan keeps the plan and what its engines are triggered with until the plan it starts after is far enough
+func deferPlan(collection *model.Collection, ep *model.ExecutionPlan, edc *enginesModel.EngineDataConfig,
+	runID int64) error {
+	engineData, err := json.Marshal(edc)
+	if err != nil {
+		return err
+	}
+	pp := &model.PendingPlan{RunID: runID, CollectionID: collection.ID, Plan: ep, EngineData: string(engineData)}
+	if err := model.AddPendingPlan(pp); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("plan %d starts %s", ep.PlanID, ep.StartAfter)
+	if err := model.AddRunEvent(collection.ID, runID, model.RunEventPlanWaiting, message); err != nil {
+		log.Printf("Error recording the event of run %d: %v", runID, err)
+	}
+	return nil
+}
+
+// planDue tells whether a plan waiting for another one can start. The other plan is running since started, or is
+// not running anymore. A plan waiting for a plan which did not start yet keeps waiting.
+func planDue(pd *model.PlanDependency, dependencyPending, dependencyRunning bool, started, now time.Time) bool {
+	if dependencyPending {
+		return false
+	}
+	if !dependencyRunning {
+		return true
+	}
+	if pd.Finished {
+		return false
+	}
+	return now.Sub(started) >= time.Duration(pd.Minutes)*time.Minute
+}
+
+// sequencingLock serialises the starts of the waiting plans of a collection and the ends of its plans, so a plan is
+// not triggered or ended twice by the workers processing the running plans and the requests of the users
+func (c *Controller) sequencingLock(collectionID int64) *sync.Mutex {
+	item, _ := c.sequencingCollections.LoadOrStore(collectionID, new(sync.Mutex))
+	return item.(*sync.Mutex)
+}
+
+// startWaitingPlans starts the due plans of the current run of the collection in the background, unless they are
+// already being started
+func (c *Controller) startWaitingPlans(collection *model.Collection) {
+	lock := c.sequencingLock(collection.ID)
+	if !lock.TryLock() {
+		return
+	}
+	go func() {
+		defer lock.Unlock()
+		runID, err := collection.GetCurrentRun()
+		if err != nil || runID == 0 {
+			return
+		}
+		if _, err := c.startDuePlans(collection, runID); err != nil {
+			log.Printf("Error starting the waiting plans of collection %d: %v", collection.ID, err)
+		}
+	}()
+}
+
+// startDuePlans triggers the waiting plans of the run whose dependency is far enough. It returns the number of
+// plans still waiting. The plans whose trigger fails stop waiting, so the plans after them are not stuck.
+// The caller holds the sequencing lock of the collection.
+func (c *Controller) startDuePlans(collection *model.Collection, runID int64) (int, error) {
+	for {
+		pps, err := model.GetPendingPlans(runID)
+		if err != nil {
+			return 0, err
+		}
+		pending := make(map[int64]bool, len(pps))
+		for _, pp := range pps {
+			pending[pp.Plan.PlanID] = true
+		}
+		changed := false
+		now := time.Now()
+		for _, pp := range pps {
+			pd := pp.Plan.StartAfter
+			rp, err := model.GetRunningPlan(collection.ID, pd.PlanID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return 0, err
+			}
+			var started time.Time
+			if rp != nil {
+				started = rp.StartedTime
+			}
+			if !planDue(pd, pending[pd.PlanID], rp != nil, started, now) {
+				continue
+			}
+			c.startPendingPlan(collection, pp)
+			changed = true
+		}
+		if !changed {
+			return len(pps), nil
+		}
+	}
+}
+
+func (c *Controller) startPendingPlan(collection *model.Collection, pp *model.PendingPlan) {
+	ep := pp.Plan
+	kind := model.RunEventPlanStarted
+	message := fmt.Sprintf("plan %d started %s", ep.PlanID, ep.StartAfter)
+	if err := c.triggerPendingPlan(collection, pp); err != nil {
+		log.Printf("Error starting plan %d of collection %d: %v", ep.PlanID, collection.ID, err)
+		kind = model.RunEventPlanStartFailed
+		message = fmt.Sprintf("plan %d could not start %s: %v", ep.PlanID, ep.StartAfter, err)
+	}
+	if err := model.DeletePendingPlan(pp.RunID, ep.PlanID); err != nil {
+		log.Printf("Error deleting the waiting plan %d of run %d: %v", ep.PlanID, pp.RunID, err)
+	}
+	if err := model.AddRunEvent(collection.ID, pp.RunID, kind, message); err != nil {
+		log.Printf("Error recording the event of run %d: %v", pp.RunID, err)
+	}
+}
+
+func (c *Controller) triggerPendingPlan(collection *model.Collection, pp *model.PendingPlan) error {
+	edc := new(enginesModel.EngineDataConfig)
+	if err := json.Unmarshal([]byte(pp.EngineData), edc); err != nil {
+		return err
+	}
+	pc := NewPlanController(pp.Plan, collection, c.Scheduler)
+	if err := pc.trigger(context.Background(), edc, pp.RunID); err != nil {
+		return err
+	}
+	if err := pc.subscribe(context.Background(), &c.connectedEngines, c.readingEngines); err != nil {
+		return err
+	}
+	return model.AddRunningPlan(collection.ID, pp.Plan.PlanID)
+}
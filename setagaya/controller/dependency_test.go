@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestPlanDue(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	minutes := &model.PlanDependency{PlanID: 1, Minutes: 5}
+	finished := &model.PlanDependency{PlanID: 1, Finished: true}
+
+	assert.False(t, planDue(minutes, false, true, now.Add(-4*time.Minute), now))
+	assert.True(t, planDue(minutes, false, true, now.Add(-5*time.Minute), now))
+	assert.False(t, planDue(finished, false, true, now.Add(-time.Hour), now))
+	// The plan it waits for ended, or could not start
+	assert.True(t, planDue(minutes, false, false, time.Time{}, now))
+	assert.True(t, planDue(finished, false, false, time.Time{}, now))
+	// The plan it waits for is waiting itself
+	assert.False(t, planDue(minutes, true, false, time.Time{}, now))
+	assert.False(t, planDue(finished, true, false, time.Time{}, now))
+}
@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -12,33 +11,54 @@ import (
 	"time"
 
 	"github.com/hveda/Setagaya/setagaya/config"
+	engineClient "github.com/hveda/Setagaya/setagaya/engines/client"
 	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
 	"github.com/hveda/Setagaya/setagaya/model"
 	sos "github.com/hveda/Setagaya/setagaya/object_storage"
 	"github.com/hveda/Setagaya/setagaya/scheduler"
 	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
-	"github.com/hveda/Setagaya/setagaya/utils"
 
-	es "github.com/iandyh/eventsource"
 	log "github.com/sirupsen/logrus"
 )
 
 type setagayaEngine interface {
-	trigger(edc *enginesModel.EngineDataConfig) error
-	deploy(scheduler.EngineScheduler) error
+	trigger(ctx context.Context, edc *enginesModel.EngineDataConfig) error
+	deploy(ctx context.Context, manager scheduler.EngineScheduler) error
 	subscribe(runID int64) error
 	progress() bool
 	readMetrics() chan *setagayaMetric
 	reachable(*scheduler.K8sClientManager) bool
 	closeStream()
-	terminate(force bool) error
+	terminate(ctx context.Context, force bool) error
 	EngineID() int
 	updateEngineUrl(url string)
+	histogram() (*enginesModel.LatencyHistogram, error)
+	failures(fr *enginesModel.FailuresRequest) (*model.FailureCaptureFile, error)
+	resultSegment(req *enginesModel.ResultSegmentRequest) (*model.ResultSegment, error)
+	pushProperties(rpr *enginesModel.RuntimePropertiesRequest) error
+	rampdown(rr *enginesModel.RampdownRequest) error
+	errorStats() (*enginesModel.ErrorStats, error)
+	assertions() (*enginesModel.AssertionStats, error)
+	transactions() (*enginesModel.TransactionStats, error)
+	gaps() ([]*enginesModel.ResultGap, error)
+	version() (*enginesModel.EngineVersion, error)
 }
 
-type engineType struct{}
+type engineType struct {
+	name string
+}
+
+var (
+	JmeterEngineType     = engineType{name: model.JmeterEngine}
+	PlaywrightEngineType = engineType{name: model.PlaywrightEngine}
+)
 
-var JmeterEngineType engineType
+func findEngineType(ep *model.ExecutionPlan) engineType {
+	if ep.GetEngineType() == model.PlaywrightEngine {
+		return PlaywrightEngineType
+	}
+	return JmeterEngineType
+}
 
 // HttPClient shared by the engines to contact with the container
 // deployed in the k8s cluster
@@ -51,11 +71,20 @@ type setagayaMetric struct {
 	latency      float64
 	label        string
 	status       string
+	success      bool
+	transaction  bool
+	webVital     bool
 	raw          string
 	collectionID string
 	planID       string
 	engineID     string
 	runID        string
+	// Sequence number of the sample in the engine stream and the engine clock when it was streamed, in ms.
+	// Both are zero for the engines which do not number their stream
+	seq        uint64
+	engineTime int64
+	// Read from the stored results of a run rather than from an engine
+	replay bool
 }
 
 type baseEngine struct {
@@ -64,73 +93,49 @@ type baseEngine struct {
 	planID       int64
 	projectID    int64
 	ID           int
-	stream       *es.Stream
-	cancel       context.CancelFunc
+	stream       *engineClient.Stream
 	runID        int64
 	*config.ExecutorContainer
-}
-
-func sendTriggerRequest(url string, edc *enginesModel.EngineDataConfig) (*http.Response, error) {
-	body := new(bytes.Buffer)
-	if err := json.NewEncoder(body).Encode(&edc); err != nil {
-		return nil, err
-	}
-	req, err := http.NewRequest("POST", url, body)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	return engineHttpClient.Do(req)
+	// Sequence numbers of the stream, to account for the samples lost while reconnecting
+	tracker *streamTracker
 }
 
 func (be *baseEngine) EngineID() int {
 	return be.ID
 }
 
-func (be *baseEngine) makeBaseUrl() string {
-	base := "%s/%s"
-	if strings.Contains(be.engineUrl, "http") {
-		return base
-	}
-	return "http://" + base
+// api is the client of the agent of the engine
+func (be *baseEngine) api() *engineClient.Client {
+	return engineClient.New(be.engineUrl, engineHttpClient)
 }
 
 func (be *baseEngine) subscribe(runID int64) error {
-	base := be.makeBaseUrl()
-	streamUrl := fmt.Sprintf(base, be.engineUrl, "stream")
-	req, err := http.NewRequest("GET", streamUrl, nil)
-	if err != nil {
-		return err
+	api := be.api()
+	var stream *engineClient.Stream
+	err := engineClient.ErrBatchesUnsupported
+	if config.SC.ExecutorConfig.BatchesMetrics() {
+		log.Printf("Subscribing to engine url %s", api.URL("stream/batches"))
+		stream, err = api.SubscribeBatches(context.Background())
+	}
+	if errors.Is(err, engineClient.ErrBatchesUnsupported) {
+		log.Printf("Subscribing to engine url %s", api.URL("stream"))
+		stream, err = api.Subscribe(context.Background())
 	}
-	log.Printf("Subscribing to engine url %s", streamUrl)
-	ctx, cancel := context.WithCancel(req.Context())
-	req = req.WithContext(ctx)
-	httpClient := &http.Client{}
-	stream, err := es.SubscribeWith("", httpClient, req)
 	if err != nil {
-		cancel()
 		return err
 	}
 	be.stream = stream
-	be.cancel = cancel
+	be.tracker = newStreamTracker()
 	be.runID = runID
 	return nil
 }
 
 func (be *baseEngine) progress() bool {
-	base := be.makeBaseUrl()
-	progressEndpoint := fmt.Sprintf(base, be.engineUrl, "progress")
-	var resp *http.Response
-	var httpError error
-	err := utils.Retry(func() error {
-		resp, httpError = engineHttpClient.Get(progressEndpoint)
-		return httpError
-	}, nil)
+	running, err := be.api().Progress(context.Background())
 	if err != nil {
 		return false
 	}
-	defer resp.Body.Close()
-	return resp.StatusCode == http.StatusOK
+	return running
 }
 
 func (be *baseEngine) reachable(manager *scheduler.K8sClientManager) bool {
@@ -138,54 +143,136 @@ func (be *baseEngine) reachable(manager *scheduler.K8sClientManager) bool {
 }
 
 func (be *baseEngine) closeStream() {
-	be.cancel()
 	be.stream.Close()
 }
 
-func (be *baseEngine) terminate(force bool) error {
+func (be *baseEngine) terminate(ctx context.Context, force bool) error {
 	// If it's force, it means we are purging the collection
 	// In this case, we don't send the stop request to test containers
 	if force {
 		return nil
 	}
-	base := be.makeBaseUrl()
-	stopUrl := fmt.Sprintf(base, be.engineUrl, "stop")
-	resp, err := engineHttpClient.Post(stopUrl, "application/x-www-form-urlencoded", nil)
-	if err != nil {
+	if err := be.api().Stop(ctx); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 	be.closeStream()
 	return nil
 }
 
-func (be *baseEngine) deploy(manager scheduler.EngineScheduler) error {
-	return manager.DeployEngine(be.projectID, be.collectionID, be.planID, be.ID, be.ExecutorContainer)
+func (be *baseEngine) deploy(ctx context.Context, manager scheduler.EngineScheduler) error {
+	return manager.DeployEngine(ctx, be.projectID, be.collectionID, be.planID, be.ID, be.ExecutorContainer)
 }
 
-func (be *baseEngine) trigger(edc *enginesModel.EngineDataConfig) error {
-	engineUrl := be.engineUrl
-	base := be.makeBaseUrl()
-	url := fmt.Sprintf(base, engineUrl, "start")
-	return utils.Retry(func() error {
-		resp, err := sendTriggerRequest(url, edc)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode == http.StatusConflict {
-			log.Printf("%s is already triggered", engineUrl)
-			return nil
-		}
-		if resp.StatusCode == http.StatusNotFound {
-			return fmt.Errorf("%w: Some test files are missing. Please stop collection re-upload them", sos.FileNotFoundError())
-		}
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("engine failed to trigger: %d %s", resp.StatusCode, resp.Status)
-		}
-		log.Printf("%s is triggered", engineUrl)
+func (be *baseEngine) trigger(ctx context.Context, edc *enginesModel.EngineDataConfig) error {
+	result, err := be.api().Start(ctx, edc)
+	if errors.Is(err, engineClient.ErrFilesMissing) {
+		return fmt.Errorf("%w: Some test files are missing. Please stop collection re-upload them", sos.FileNotFoundError())
+	}
+	if err != nil {
+		return err
+	}
+	if result.AlreadyStarted {
+		log.Printf("%s is already triggered", be.engineUrl)
 		return nil
-	}, sos.FileNotFoundError())
+	}
+	log.Printf("%s is triggered", be.engineUrl)
+	if err := checkAgentVersion(result.AgentVersion, config.SC.ExecutorConfig.MinAgentVersion); err != nil {
+		log.Warnf("Engine %d of plan %d of collection %d: %v", be.ID, be.planID, be.collectionID, err)
+	}
+	be.recordConfig(edc, result)
+	be.reportStrippedListeners(edc, result.StrippedListeners)
+	return nil
+}
+
+// reportStrippedListeners records in the timeline of the run the heavy listeners the engines disabled in the test
+// plan. The engines of a plan run the same test plan, the first one reports them for the plan.
+func (be *baseEngine) reportStrippedListeners(edc *enginesModel.EngineDataConfig, listeners []string) {
+	if len(listeners) == 0 || be.ID != 0 || edc.RunID == 0 {
+		return
+	}
+	message := fmt.Sprintf("plan %d: the listeners %s are disabled, they slow the engines down", be.planID,
+		strings.Join(listeners, ", "))
+	if err := model.AddRunEvent(be.collectionID, edc.RunID, model.RunEventListenersStripped, message); err != nil {
+		log.Errorf("Cannot record the listeners disabled in plan %d: %v", be.planID, err)
+	}
+}
+
+// recordConfig keeps the config the engine was triggered with, without its secrets, and the versions it reported when
+// it started, for the audits of the run. The run goes on when it cannot be kept.
+func (be *baseEngine) recordConfig(edc *enginesModel.EngineDataConfig, result *engineClient.StartResult) {
+	c, err := json.Marshal(edc.Redacted())
+	if err != nil {
+		log.Errorf("Cannot encode the config of engine %d of plan %d: %v", be.ID, be.planID, err)
+		return
+	}
+	rec := &model.RunEngineConfig{
+		PlanID:        be.planID,
+		EngineID:      be.ID,
+		Config:        c,
+		JMXSHA256:     result.JMXSHA256,
+		AgentVersion:  result.AgentVersion,
+		EngineVersion: result.EngineVersion,
+	}
+	if err := model.StoreRunEngineConfig(be.collectionID, edc.RunID, rec); err != nil {
+		log.Errorf("Cannot store the config of engine %d of plan %d: %v", be.ID, be.planID, err)
+	}
+}
+
+// version asks the agent its version and the protocol it speaks
+func (be *baseEngine) version() (*enginesModel.EngineVersion, error) {
+	return be.api().Version(context.Background())
+}
+
+// histogram fetches the latency digest of the current run from the engine
+func (be *baseEngine) histogram() (*enginesModel.LatencyHistogram, error) {
+	return be.api().Histogram(context.Background())
+}
+
+// errorStats fetches the failed samples of the current run from the engine
+func (be *baseEngine) errorStats() (*enginesModel.ErrorStats, error) {
+	return be.api().ErrorStats(context.Background())
+}
+
+// assertions fetches the assertion results of the current run from the engine
+func (be *baseEngine) assertions() (*enginesModel.AssertionStats, error) {
+	return be.api().Assertions(context.Background())
+}
+
+// transactions fetches the transaction controller samples of the current run from the engine
+func (be *baseEngine) transactions() (*enginesModel.TransactionStats, error) {
+	return be.api().Transactions(context.Background())
+}
+
+// gaps fetches the periods of the current run whose samples are missing from the engine results,
+// along with the samples lost by the stream. Engines which do not report gaps only have the latter.
+func (be *baseEngine) gaps() ([]*enginesModel.ResultGap, error) {
+	var streamGaps []*enginesModel.ResultGap
+	if be.tracker != nil {
+		streamGaps = be.tracker.resultGaps()
+	}
+	gaps, err := be.api().Gaps(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return append(gaps, streamGaps...), nil
+}
+
+// failures asks the engine to upload the failing responses it captured in the current run
+func (be *baseEngine) failures(fr *enginesModel.FailuresRequest) (*model.FailureCaptureFile, error) {
+	return be.api().Failures(context.Background(), fr)
+}
+
+// resultSegment asks the engine to upload the samples it read since the previous checkpoint of the soak run
+func (be *baseEngine) resultSegment(req *enginesModel.ResultSegmentRequest) (*model.ResultSegment, error) {
+	return be.api().ResultSegment(context.Background(), req)
+}
+
+func (be *baseEngine) pushProperties(rpr *enginesModel.RuntimePropertiesRequest) error {
+	return be.api().PushProperties(context.Background(), rpr)
+}
+
+func (be *baseEngine) rampdown(rr *enginesModel.RampdownRequest) error {
+	return be.api().Rampdown(context.Background(), rr)
 }
 
 func (be *baseEngine) readMetrics() chan *setagayaMetric {
@@ -201,6 +288,10 @@ func findEngineConfig(et engineType) *config.ExecutorContainer {
 	switch et {
 	case JmeterEngineType:
 		return config.SC.ExecutorConfig.JmeterContainer.ExecutorContainer
+	case PlaywrightEngineType:
+		if pc := config.SC.ExecutorConfig.PlaywrightContainer; pc != nil {
+			return pc.ExecutorContainer
+		}
 	}
 	return nil
 }
@@ -217,6 +308,8 @@ func generateEngines(enginesRequired int, planID, collectionID, projectID int64,
 		switch et {
 		case JmeterEngineType:
 			e = NewJmeterEngine(engineC)
+		case PlaywrightEngineType:
+			e = NewPlaywrightEngine(engineC)
 		default:
 			return nil, makeWrongEngineTypeError()
 		}
@@ -225,12 +318,12 @@ func generateEngines(enginesRequired int, planID, collectionID, projectID int64,
 	return engines, nil
 }
 
-func generateEnginesWithUrl(enginesRequired int, planID, collectionID, projectID int64, et engineType, scheduler scheduler.EngineScheduler) (engines []setagayaEngine, err error) {
+func generateEnginesWithUrl(ctx context.Context, enginesRequired int, planID, collectionID, projectID int64, et engineType, scheduler scheduler.EngineScheduler) (engines []setagayaEngine, err error) {
 	engines, err = generateEngines(enginesRequired, planID, collectionID, projectID, et)
 	if err != nil {
 		return nil, err
 	}
-	engineUrls, err := scheduler.FetchEngineUrlsByPlan(collectionID, planID, &smodel.EngineOwnerRef{
+	engineUrls, err := scheduler.FetchEngineUrlsByPlan(ctx, collectionID, planID, &smodel.EngineOwnerRef{
 		ProjectID:    projectID,
 		EnginesCount: len(engines),
 	})
@@ -268,7 +361,7 @@ func (ctr *Controller) fetchEngineMetrics() {
 			}
 			collectionID_str := strconv.FormatInt(collectionID, 10)
 			for _, ep := range eps {
-				podsMetrics, err := ctr.Scheduler.GetPodsMetrics(collectionID, ep.PlanID)
+				podsMetrics, err := ctr.Scheduler.GetPodsMetrics(context.Background(), collectionID, ep.PlanID)
 				if err != nil {
 					// Some schedulers might not have the feature to expose the metrics
 					// We will return directly
@@ -279,10 +372,12 @@ func (ctr *Controller) fetchEngineMetrics() {
 					continue
 				}
 				planID_str := strconv.FormatInt(ep.PlanID, 10)
+				// The architecture of the nodes is only known when the plan chose it
+				cpuFactor := config.SC.ExecutorConfig.CPUFactor(ep.Arch)
 				for engineNumber, metrics := range podsMetrics {
 					for resourceName, m := range metrics {
 						if resourceName == "cpu" {
-							config.CpuGauge.WithLabelValues(collectionID_str, planID_str, engineNumber).Set(float64(m.MilliValue()))
+							config.CpuGauge.WithLabelValues(collectionID_str, planID_str, engineNumber).Set(float64(m.MilliValue()) * cpuFactor)
 						} else {
 							config.MemGauge.WithLabelValues(collectionID_str, planID_str, engineNumber).Set(float64(m.Value()))
 						}
@@ -3,12 +3,23 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
 	ErrEngine = errors.New("error with Engine-")
+	// The engines did not shut down in time. The collection can still be force purged
+	ErrEnginesNotStopped = errors.New("engines did not shut down: ")
 )
 
 func makeWrongEngineTypeError() error {
 	return fmt.Errorf("%w%s", ErrEngine, "wrong engine type requested")
 }
+
+func makeEnginesNotStoppedError(engines []string) error {
+	return fmt.Errorf("%w%s", ErrEnginesNotStopped, strings.Join(engines, ", "))
+}
+
+func makeEnginesNotPurgedError(left int) error {
+	return fmt.Errorf("%w%d engines are still deployed", ErrEnginesNotStopped, left)
+}
@@ -79,3 +79,13 @@ func TestErrEngineConstants(t *testing.T) {
 	originalErr := ErrEngine
 	assert.Equal(t, originalErr, ErrEngine)
 }
+
+func TestMakeEnginesNotStoppedError(t *testing.T) {
+	err := makeEnginesNotStoppedError([]string{"1-1-0", "1-1-1"})
+	assert.True(t, errors.Is(err, ErrEnginesNotStopped))
+	assert.Contains(t, err.Error(), "1-1-0, 1-1-1")
+
+	err = makeEnginesNotPurgedError(2)
+	assert.True(t, errors.Is(err, ErrEnginesNotStopped))
+	assert.Contains(t, err.Error(), "2 engines are still deployed")
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// ExportRun gathers the run, its errors and, for the last run of the collection, the logs of its engines. With
+// anonymize, the users and the hosts are redacted with the built-in rules and the ones of the config. The secrets are
+// scrubbed either way.
+func (c *Controller) ExportRun(ctx context.Context, collection *model.Collection, run *model.RunHistory, anonymize bool) (*model.RunExport, error) {
+	if err := run.LoadDetails(); err != nil {
+		return nil, err
+	}
+	runErrors, err := model.GetRunErrors(run.ID, model.MaxTopErrors)
+	if err != nil {
+		return nil, err
+	}
+	run.ScrubSecrets()
+	runErrors.ScrubSecrets()
+	export := &model.RunExport{Run: run, Errors: runErrors, Logs: map[int64]string{}}
+	last, err := collection.GetLastRun()
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && last.ID == run.ID {
+		eps, err := collection.GetExecutionPlans()
+		if err != nil {
+			return nil, err
+		}
+		for _, ep := range eps {
+			// The engines can be purged already
+			if content, err := c.Scheduler.DownloadPodLog(ctx, collection.ID, ep.PlanID); err == nil {
+				export.Logs[ep.PlanID] = config.ScrubSecrets(content)
+			}
+		}
+	}
+	if !anonymize {
+		return export, nil
+	}
+	var rules []*config.RedactionRule
+	if config.SC.RunExport != nil {
+		rules = config.SC.RunExport.Redactions
+	}
+	redactor, err := model.NewRedactor(rules)
+	if err != nil {
+		return nil, err
+	}
+	project, err := model.GetProject(collection.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	redactor.User(project.Owner)
+	export.Anonymize(redactor)
+	return export, nil
+}
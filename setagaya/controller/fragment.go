@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+var ErrInvalidFragments = errors.New("the fragments of the test plan cannot be resolved")
+
+// maxFragments bounds the fragments a test plan includes, with the ones the fragments include themselves
+const maxFragments = 50
+
+// resolveFragments follows the Include Controllers of the test plan, and of the fragments it includes, to the
+// fragments of the project library. Every fragment is sent once to the engines, whichever jmx includes it.
+func resolveFragments(testFile string, content []byte, lookup func(string) (*model.SetagayaFile, error),
+	download func(string) ([]byte, error)) ([]*model.SetagayaFile, error) {
+	fragments := []*model.SetagayaFile{}
+	resolved := map[string]bool{}
+	type pending struct {
+		from    string
+		content []byte
+	}
+	queue := []pending{{from: testFile, content: content}}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		includes, err := model.JMXIncludes(p.content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFragments, p.from, err)
+		}
+		for _, name := range includes {
+			if resolved[name] {
+				continue
+			}
+			if name == testFile {
+				return nil, fmt.Errorf("%w: %s includes %s, the fragments must be named differently from the test plan",
+					ErrInvalidFragments, p.from, name)
+			}
+			if len(fragments) == maxFragments {
+				return nil, fmt.Errorf("%w: %s includes more than %d fragments", ErrInvalidFragments, testFile,
+					maxFragments)
+			}
+			f, err := lookup(name)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s includes %s: %v", ErrInvalidFragments, p.from, name, err)
+			}
+			c, err := download(f.Filepath)
+			if err != nil {
+				return nil, fmt.Errorf("cannot download the fragment %s: %w", name, err)
+			}
+			resolved[name] = true
+			fragments = append(fragments, f)
+			queue = append(queue, pending{from: name, content: c})
+		}
+	}
+	return fragments, nil
+}
+
+// planFragments are the fragments of the library of the project the test plan includes. Only the jmeter plans have
+// fragments.
+func planFragments(plan *model.Plan) ([]*model.SetagayaFile, error) {
+	if plan.TestFile == nil || !model.IsFragment(plan.TestFile.Filename) {
+		return nil, nil
+	}
+	content, err := sos.Client.Storage.Download(plan.TestFile.Filepath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot download the test plan of plan %d: %w", plan.ID, err)
+	}
+	project := &model.Project{ID: plan.ProjectID}
+	return resolveFragments(plan.TestFile.Filename, content, project.GetFragment, sos.Client.Storage.Download)
+}
+
+// addFragments sends the fragments the test plan includes to the engines with the data of the plan
+func addFragments(plan *model.Plan) error {
+	fragments, err := planFragments(plan)
+	if err != nil {
+		return err
+	}
+	plan.Data = append(plan.Data, fragments...)
+	return nil
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func includingJMX(includes ...string) []byte {
+	jmx := `<jmeterTestPlan><hashTree>`
+	for _, include := range includes {
+		jmx += fmt.Sprintf(`<IncludeController><stringProp name="IncludeController.includepath">%s</stringProp>`+
+			`</IncludeController>`, include)
+	}
+	return []byte(jmx + `</hashTree></jmeterTestPlan>`)
+}
+
+func fragmentLibrary(library map[string][]byte) (func(string) (*model.SetagayaFile, error), func(string) ([]byte, error)) {
+	lookup := func(name string) (*model.SetagayaFile, error) {
+		if _, ok := library[name]; !ok {
+			return nil, errors.New("not in the library")
+		}
+		return &model.SetagayaFile{Filename: name, Filepath: "project/1/" + name, Fragment: true}, nil
+	}
+	download := func(path string) ([]byte, error) {
+		return library[path[len("project/1/"):]], nil
+	}
+	return lookup, download
+}
+
+func TestResolveFragments(t *testing.T) {
+	lookup, download := fragmentLibrary(map[string][]byte{
+		"login.jmx":  includingJMX("fragments/auth.jmx"),
+		"auth.jmx":   includingJMX(),
+		"setup.jmx":  includingJMX(`C:\tests\login.jmx`),
+		"unused.jmx": includingJMX(),
+	})
+	fragments, err := resolveFragments("checkout.jmx", includingJMX("login.jmx", "setup.jmx"), lookup, download)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, f := range fragments {
+		assert.True(t, f.Fragment)
+		names = append(names, f.Filename)
+	}
+	assert.Equal(t, []string{"login.jmx", "setup.jmx", "auth.jmx"}, names)
+
+	fragments, err = resolveFragments("checkout.jmx", includingJMX(), lookup, download)
+	assert.NoError(t, err)
+	assert.Empty(t, fragments)
+}
+
+func TestResolveFragmentsInvalid(t *testing.T) {
+	lookup, download := fragmentLibrary(map[string][]byte{
+		"login.jmx": includingJMX("checkout.jmx"),
+		"loop.jmx":  includingJMX("loop.jmx"),
+	})
+	_, err := resolveFragments("checkout.jmx", includingJMX("missing.jmx"), lookup, download)
+	assert.ErrorIs(t, err, ErrInvalidFragments)
+	assert.Contains(t, err.Error(), "missing.jmx")
+
+	_, err = resolveFragments("checkout.jmx", includingJMX("login.jmx"), lookup, download)
+	assert.ErrorIs(t, err, ErrInvalidFragments)
+
+	_, err = resolveFragments("checkout.jmx", []byte("<jmeterTestPlan>"), lookup, download)
+	assert.ErrorIs(t, err, ErrInvalidFragments)
+
+	// A fragment including itself is sent once
+	fragments, err := resolveFragments("checkout.jmx", includingJMX("loop.jmx"), lookup, download)
+	assert.NoError(t, err)
+	assert.Len(t, fragments, 1)
+
+	library := map[string][]byte{}
+	includes := []string{}
+	for i := 0; i <= maxFragments; i++ {
+		name := fmt.Sprintf("f%d.jmx", i)
+		library[name] = includingJMX()
+		includes = append(includes, name)
+	}
+	lookup, download = fragmentLibrary(library)
+	_, err = resolveFragments("checkout.jmx", includingJMX(includes...), lookup, download)
+	assert.ErrorIs(t, err, ErrInvalidFragments)
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"time"
@@ -14,29 +15,92 @@ import (
 
 // processRunningPlan handles a single running plan
 func (c *Controller) processRunningPlan(j *RunningPlan) {
+	if config.SC.ExecutorConfig.RunsOnce() {
+		c.processRunOnceCollection(j.collection)
+		return
+	}
 	pc := NewPlanController(j.ep, j.collection, c.Scheduler)
-	if running := pc.progress(); !running {
+	running := pc.progress()
+	if running && j.collection.Soak != nil {
+		c.checkSoakRun(j.collection)
+	}
+	if running {
+		c.checkAttendedRun(j.collection)
+		c.startWaitingPlans(j.collection)
+	}
+	if !running {
 		collection := j.collection
-		currRunID, err := collection.GetCurrentRun()
-		if currRunID != int64(0) {
-			if termErr := pc.term(false, &c.connectedEngines); termErr != nil {
-				log.Printf("Error terminating plan %d: %v", j.ep.PlanID, termErr)
-			}
-			log.Printf("Plan %d is terminated.", j.ep.PlanID)
-		}
-		if err != nil {
+		if collection.Continuous != nil {
+			c.rollContinuousRun(collection)
 			return
 		}
-		if t, err := collection.HasRunningPlan(); t || err != nil {
+		c.endPlan(context.Background(), collection, pc)
+	}
+}
+
+// endPlan terminates the engines of a plan of the current run. The plans waiting for it start, and the run ends
+// once none of its plans is running or waiting anymore. The plans of a collection are ended one at a time, so a plan
+// stopped by its owner while the garbage collector finds it over does not finish the run twice.
+func (c *Controller) endPlan(ctx context.Context, collection *model.Collection, pc *PlanController) {
+	lock := c.sequencingLock(collection.ID)
+	lock.Lock()
+	defer lock.Unlock()
+	currRunID, err := collection.GetCurrentRun()
+	if err != nil || currRunID == 0 {
+		return
+	}
+	c.finishPlan(ctx, collection, pc, currRunID)
+}
+
+// finishPlan is endPlan once the sequencing lock of the collection is held and its current run is known
+func (c *Controller) finishPlan(ctx context.Context, collection *model.Collection, pc *PlanController, currRunID int64) {
+	if termErr := pc.term(ctx, false, &c.connectedEngines); termErr != nil {
+		log.Printf("Error terminating plan %d: %v", pc.ep.PlanID, termErr)
+	}
+	log.Printf("Plan %d is terminated.", pc.ep.PlanID)
+	// The plans waiting for the one which ended can start now
+	pending, err := c.startDuePlans(collection, currRunID)
+	if pending > 0 || err != nil || c.retryingCollection(collection.ID) {
+		return
+	}
+	if t, err := collection.HasRunningPlan(); t || err != nil {
+		return
+	}
+	if err := collection.StopRun(); err != nil {
+		log.Printf("Error stopping run: %v", err)
+	}
+	if err := collection.RunFinish(currRunID); err != nil {
+		log.Printf("Error finishing run: %v", err)
+	}
+}
+
+// processRunOnceCollection ends the run of a collection whose engines run as jobs. The engines exit once they are
+// stopped, so the results of all the plans are collected at once: when the jobs completed or none of the plans is
+// in progress anymore.
+func (c *Controller) processRunOnceCollection(collection *model.Collection) {
+	if _, ending := c.endingCollections.LoadOrStore(collection.ID, struct{}{}); ending {
+		return
+	}
+	defer c.endingCollections.Delete(collection.ID)
+	completed, err := c.Scheduler.CollectionCompleted(context.Background(), collection.ID)
+	if err != nil {
+		log.Printf("Error checking the jobs of collection %d: %v", collection.ID, err)
+	}
+	if !completed {
+		eps, err := collection.GetExecutionPlans()
+		if err != nil {
 			return
 		}
-		if err := collection.StopRun(); err != nil {
-			log.Printf("Error stopping run: %v", err)
-		}
-		if err := collection.RunFinish(currRunID); err != nil {
-			log.Printf("Error finishing run: %v", err)
+		for _, ep := range eps {
+			if NewPlanController(ep, collection, c.Scheduler).progress() {
+				return
+			}
 		}
 	}
+	log.Printf("The engines of collection %d finished their run", collection.ID)
+	if err := c.TermCollection(context.Background(), collection, false); err != nil {
+		log.Printf("Error terminating collection %d: %v", collection.ID, err)
+	}
 }
 
 // startWorkers creates worker goroutines to process running plans
@@ -150,7 +214,7 @@ func isCollectionStale(rh *model.RunHistory, launchTime time.Time) (bool, error)
 func (c *Controller) AutoPurgeDeployments() {
 	log.Info("Start the loop for purging idle engines")
 	for {
-		deployedCollections, err := c.Scheduler.GetDeployedCollections()
+		deployedCollections, err := c.Scheduler.GetDeployedCollections(context.Background())
 		if err != nil {
 			log.Error(err)
 			continue
@@ -175,7 +239,7 @@ func (c *Controller) AutoPurgeDeployments() {
 			if !status {
 				continue
 			}
-			err = c.TermAndPurgeCollection(collection)
+			err = c.TermAndPurgeCollection(context.Background(), collection)
 			if err != nil {
 				log.Error(err)
 				continue
@@ -280,13 +344,13 @@ func (c *Controller) AutoPurgeProjectIngressController() {
 	log.Println(fmt.Sprintf("Project ingress lifespan is %v. And the GC Interval is %v", ingressLifespan, gcInterval))
 
 	for {
-		deployedServices, err := c.Scheduler.GetDeployedServices()
+		deployedServices, err := c.Scheduler.GetDeployedServices(context.Background())
 		if err != nil {
 			continue
 		}
 
 		for projectID := range deployedServices {
-			pods, err := c.Scheduler.GetEnginesByProject(projectID)
+			pods, err := c.Scheduler.GetEnginesByProject(context.Background(), projectID)
 			if err != nil {
 				continue
 			}
@@ -300,7 +364,7 @@ func (c *Controller) AutoPurgeProjectIngressController() {
 
 			if time.Since(plu) > ingressLifespan {
 				log.Println(fmt.Sprintf("Going to delete ingress for project %d. Last used time was %v", projectID, plu))
-				if err := c.Scheduler.PurgeProjectIngress(projectID); err != nil {
+				if err := c.Scheduler.PurgeProjectIngress(context.Background(), projectID); err != nil {
 					log.Printf("Error purging project ingress for project %d: %v", projectID, err)
 				}
 			}
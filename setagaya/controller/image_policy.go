@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const imageScanTimeout = 30 * time.Second
+
+var ErrImagePolicy = errors.New("blocked by the vulnerability policy")
+
+// ImageScanReport is what the scanner knows about an image
+type ImageScanReport struct {
+	Digest   string `json:"digest"`
+	Critical int    `json:"critical"`
+	High     int    `json:"high"`
+}
+
+func scanImage(client *http.Client, scannerURL, image string) (*ImageScanReport, error) {
+	u, err := url.Parse(scannerURL)
+	if err != nil {
+		return nil, err
+	}
+	qs := u.Query()
+	qs.Set("image", image)
+	u.RawQuery = qs.Encode()
+	ctx, cancel := context.WithTimeout(context.Background(), imageScanTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scanner responded with %d", resp.StatusCode)
+	}
+	report := new(ImageScanReport)
+	if err := json.NewDecoder(resp.Body).Decode(report); err != nil {
+		return nil, err
+	}
+	if err := model.ValidateImageDigest(report.Digest); err != nil {
+		return nil, fmt.Errorf("scanner responded with an invalid digest: %w", err)
+	}
+	return report, nil
+}
+
+// checkImageScan applies the policy to the report of the image. An override of its digest lets it through
+func checkImageScan(image string, report *ImageScanReport, policy *config.ImagePolicy, override *model.ImagePolicyOverride) error {
+	if report.Critical <= policy.MaxCritical {
+		return nil
+	}
+	if override != nil {
+		log.Printf("Image %s (%s) has %d critical vulnerabilities, it's allowed by %s: %s", image, report.Digest,
+			report.Critical, override.Admin, override.Reason)
+		return nil
+	}
+	return fmt.Errorf("image %s (%s) has %d critical vulnerabilities and the policy allows %d, it's %w. An admin can override the policy for its digest",
+		image, report.Digest, report.Critical, policy.MaxCritical, ErrImagePolicy)
+}
+
+// checkImagePolicy blocks the custom engine images with too many critical vulnerabilities. Images the scanner has
+// no report for are blocked too, as they could not be checked.
+func checkImagePolicy(image string) error {
+	policy := config.SC.ExecutorConfig.ImagePolicy
+	if policy == nil {
+		return nil
+	}
+	report, err := scanImage(config.SC.HTTPClient, policy.ScannerURL, image)
+	if err != nil {
+		return fmt.Errorf("cannot check image %s against the vulnerability policy: %w", image, err)
+	}
+	override, err := model.GetImagePolicyOverride(report.Digest)
+	if err != nil {
+		return err
+	}
+	return checkImageScan(image, report, policy, override)
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestScanImage(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("image") {
+		case "registry.example.com/team/jmeter:5.6":
+			w.Write([]byte(`{"digest": "` + digest + `", "critical": 2, "high": 5}`))
+		case "registry.example.com/team/unsigned":
+			w.Write([]byte(`{"digest": "latest"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	report, err := scanImage(ts.Client(), ts.URL+"/reports", "registry.example.com/team/jmeter:5.6")
+	assert.NoError(t, err)
+	assert.Equal(t, &ImageScanReport{Digest: digest, Critical: 2, High: 5}, report)
+
+	_, err = scanImage(ts.Client(), ts.URL, "registry.example.com/team/unsigned")
+	assert.Error(t, err)
+	_, err = scanImage(ts.Client(), ts.URL, "registry.example.com/team/unknown")
+	assert.Error(t, err)
+}
+
+func TestCheckImageScan(t *testing.T) {
+	image := "registry.example.com/team/jmeter:5.6"
+	report := &ImageScanReport{Digest: "sha256:" + strings.Repeat("a", 64), Critical: 2}
+	assert.NoError(t, checkImageScan(image, report, &config.ImagePolicy{MaxCritical: 2}, nil))
+
+	err := checkImageScan(image, report, &config.ImagePolicy{MaxCritical: 0}, nil)
+	assert.True(t, errors.Is(err, ErrImagePolicy))
+	assert.Contains(t, err.Error(), report.Digest)
+
+	override := &model.ImagePolicyOverride{Digest: report.Digest, Admin: "admin", Reason: "not reachable from the engines"}
+	assert.NoError(t, checkImageScan(image, report, &config.ImagePolicy{MaxCritical: 0}, override))
+}
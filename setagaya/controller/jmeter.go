@@ -1,12 +1,14 @@
 package controller
 
 import (
+	"errors"
 	"strconv"
-	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/hveda/Setagaya/setagaya/config"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
 )
 
 type jmeterEngine struct {
@@ -20,51 +22,64 @@ func NewJmeterEngine(be *baseEngine) *jmeterEngine {
 }
 
 func (je *jmeterEngine) readMetrics() chan *setagayaMetric {
+	return readJTLMetrics(je.baseEngine, config.SC.ExecutorConfig.JmeterContainer.JTLColumns)
+}
+
+// readJTLMetrics converts the JTL lines streamed by an engine into metrics.
+// Every engine agent streams its results in the jmeter JTL format so they can share the same pipeline.
+// columns are the expected JTL columns, empty means the default ones. The header line overrides them.
+func readJTLMetrics(be *baseEngine, columns []string) chan *setagayaMetric {
 	ch := make(chan *setagayaMetric)
+	parser, err := enginesModel.NewJTLParser(columns)
+	if err != nil {
+		log.Errorf("Invalid JTL columns, the default ones are used: %v", err)
+		parser, _ = enginesModel.NewJTLParser(nil)
+	}
 	go func() {
 	outer:
 		for {
 			select {
-			case ev, ok := <-je.stream.Events:
+			case ev, ok := <-be.stream.Events:
 				if !ok {
 					break outer
 				}
-				raw := ev.Data()
-				line := strings.Split(raw, "|")
-				// We use char "|" as the separator in jmeter jtl file. If some users somehow put another | in their label name
-				// we could end up a broken split. For those requests, we simply ignore otherwise the process will crash.
-				// With current jmeter setup, we are expecting 12 items to be presented in the JTL file after split.
-				// The column in the JTL files are:
-				// timeStamp|elapsed|label|responseCode|responseMessage|threadName|success|bytes|grpThreads|allThreads|Latency|Connect
-				if len(line) < 12 {
-					log.Infof("line length was less than required. Raw line is %s", raw)
+				id := ev.ID
+				if ev.Numbered && !be.tracker.observe(id, time.Now()) {
+					// Received already before the stream was resumed
 					continue
 				}
-				label := line[2]
-				status := line[3]
-				threads, err := strconv.ParseFloat(line[9], 64)
-				if err != nil {
-					threads = 0 // default to 0 if parsing fails
+				raw := ev.Data
+				record, err := parser.Parse(raw)
+				if errors.Is(err, enginesModel.ErrJTLHeader) {
+					continue
 				}
-				latency, err := strconv.ParseFloat(line[10], 64)
 				if err != nil {
-					continue outer // no csv headers
+					log.Infof("Cannot parse JTL line: %v", err)
+					continue
 				}
 				ch <- &setagayaMetric{
-					threads:      threads,
-					label:        label,
-					status:       status,
-					latency:      latency,
+					threads:      record.AllThreads,
+					label:        record.Label,
+					status:       record.ResponseCode,
+					latency:      record.Latency,
+					success:      record.Success,
+					transaction:  record.Transaction,
+					webVital:     record.WebVital,
 					raw:          raw,
-					collectionID: strconv.FormatInt(je.collectionID, 10),
-					planID:       strconv.FormatInt(je.planID, 10),
-					engineID:     strconv.FormatInt(int64(je.ID), 10),
-					runID:        strconv.FormatInt(je.runID, 10),
+					seq:          id.Seq,
+					engineTime:   id.Timestamp,
+					collectionID: strconv.FormatInt(be.collectionID, 10),
+					planID:       strconv.FormatInt(be.planID, 10),
+					engineID:     strconv.FormatInt(int64(be.ID), 10),
+					runID:        strconv.FormatInt(be.runID, 10),
 				}
-			case _, ok := <-je.stream.Errors:
+			case err, ok := <-be.stream.Errors:
 				if !ok {
 					break outer
 				}
+				// The stream reconnects by itself and resumes from the last event
+				be.tracker.disconnect(time.Now())
+				log.Printf("Stream of engine %d of plan %d is interrupted: %v", be.ID, be.planID, err)
 			}
 		}
 		close(ch)
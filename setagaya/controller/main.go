@@ -1,13 +1,17 @@
 package controller
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
 
+	"github.com/hveda/Setagaya/setagaya/chaos"
 	"github.com/hveda/Setagaya/setagaya/config"
 	"github.com/hveda/Setagaya/setagaya/model"
 	"github.com/hveda/Setagaya/setagaya/scheduler"
@@ -28,6 +32,29 @@ type Controller struct {
 	httpClient         *http.Client
 	schedulerKind      string
 	Scheduler          scheduler.EngineScheduler
+	// The figures of the runs in progress shown by the status pages, by run id
+	liveSummaries sync.Map
+	// The collections whose engines run once and whose run is being ended
+	endingCollections sync.Map
+	// Creates the chaos experiments of the runs, nil when the chaos actions are disabled
+	chaos *chaos.Injector
+	// The continuous collections whose window is being ended and the next one started
+	rollingCollections sync.Map
+	// The soak runs being checked, and the memory of their engines sampled so far, by run id
+	checkingSoaks sync.Map
+	soakWatches   sync.Map
+	// The attended-only runs whose heartbeat is being checked, by collection id
+	checkingHeartbeats sync.Map
+	// Serialises the starts of the plans waiting for other plans, by collection id
+	sequencingCollections sync.Map
+	// The plans being deployed and triggered again within the run in progress, by planKey
+	retryingPlans sync.Map
+	// The engines being deleted and created again, by the key of the engine
+	replacingEngines sync.Map
+	// The stored runs being replayed into the streams of their collection, by collection id
+	replayingCollections sync.Map
+	// The last check of the dependencies, reported by /readyz
+	dependencyReport atomic.Pointer[DependencyReport]
 }
 
 func NewController() *Controller {
@@ -44,6 +71,13 @@ func NewController() *Controller {
 	}
 	c.schedulerKind = config.SC.ExecutorConfig.Cluster.Kind
 	c.Scheduler = scheduler.NewEngineScheduler(config.SC.ExecutorConfig.Cluster)
+	if len(config.SC.ExecutorConfig.ChaosNamespaces) > 0 {
+		if client, mapper, err := config.GetDynamicClient(); err != nil {
+			log.Warnf("Chaos actions are disabled, cannot create the kubernetes client: %v", err)
+		} else {
+			c.chaos = chaos.NewInjector(client, mapper)
+		}
+	}
 	return c
 }
 
@@ -57,9 +91,18 @@ type ApiMetricStreamEvent struct {
 	CollectionID string `json:"collection_id"`
 	Raw          string `json:"metrics"`
 	PlanID       string `json:"plan_id"`
+	EngineID     string `json:"engine_id"`
+	// Sequence number of the sample in the stream of its engine and the engine clock when it was streamed,
+	// in ms. Consumers use them to order the samples of an engine and to find the missing ones
+	Seq             uint64 `json:"seq,omitempty"`
+	EngineTimestamp int64  `json:"engine_timestamp,omitempty"`
+	// The sample is replayed from a stored run, see ReplayRun
+	Replay bool `json:"replay,omitempty"`
 }
 
 func (c *Controller) StartRunning() {
+	c.WaitForDependencies()
+	go c.MonitorDependencies()
 	// First we do is to resume the running plans
 	// This method should not be moved as later goroutines rely on it.
 	c.resumeRunningPlans()
@@ -67,6 +110,7 @@ func (c *Controller) StartRunning() {
 	go c.readConnectedEngines()
 	go c.fetchEngineMetrics()
 	go c.cleanLocalStore()
+	go c.CheckStorage()
 	// We can only move this func to an isolated controller process later
 	// because when we are terminating, we also need to close the opening connections
 	// Otherwise we might face connection leaks
@@ -81,6 +125,11 @@ func (c *Controller) StartRunning() {
 // In non-distributed mode, the func will be run as a goroutine.
 func (c *Controller) IsolateBackgroundTasks() {
 	go c.AutoPurgeDeployments()
+	go c.ReapOrphanedResources()
+	go c.TrackBudgets()
+	if config.SC.ObjectStorage.OrphanCleanup != nil {
+		go c.ReapStorageOrphans()
+	}
 	c.AutoPurgeProjectIngressController()
 }
 
@@ -147,7 +196,7 @@ func (c *Controller) resumeRunningPlans() {
 			continue
 		}
 		pc := NewPlanController(ep, collection, c.Scheduler)
-		if err := pc.subscribe(&c.connectedEngines, c.readingEngines); err != nil {
+		if err := pc.subscribe(context.Background(), &c.connectedEngines, c.readingEngines); err != nil {
 			log.Printf("Error subscribing to plan controller: %v", err)
 		}
 	}
@@ -158,37 +207,62 @@ func (c *Controller) readConnectedEngines() {
 		go func(engine setagayaEngine) {
 			ch := engine.readMetrics()
 			for metric := range ch {
-				collectionID := metric.collectionID
-				planID := metric.planID
-				runID := metric.runID
-				engineID := metric.engineID
-				label := metric.label
-				status := metric.status
-				latency := metric.latency
-				threads := metric.threads
-				c.ApiMetricStreamBus <- &ApiMetricStreamEvent{
-					CollectionID: metric.collectionID,
-					PlanID:       metric.planID,
-					Raw:          metric.raw,
-				}
-				config.StatusCounter.WithLabelValues(metric.collectionID, metric.planID, runID, engineID, label, status).Inc()
-				config.CollectionLatencySummary.WithLabelValues(collectionID, runID).Observe(latency)
-				config.PlanLatencySummary.WithLabelValues(collectionID, planID, runID).Observe(latency)
-				config.LabelLatencySummary.WithLabelValues(collectionID, label, runID).Observe(latency)
-				config.ThreadsGauge.WithLabelValues(collectionID, planID, runID, engineID).Set(threads)
-
-				rid, err := strconv.ParseInt(runID, 10, 64)
-				if err != nil {
-					log.Printf("Error parsing run ID %s: %v", runID, err)
-					rid = 0 // default to 0 if parsing fails
-				}
-				go c.storeLocally(rid, label, status)
+				c.publishMetric(metric)
 			}
 		}(engine)
 	}
 }
 
-func (c *Controller) DeployCollection(collection *model.Collection) error {
+// publishMetric sends the metric to the streams of its collection and records it in the prometheus metrics
+func (c *Controller) publishMetric(metric *setagayaMetric) {
+	collectionID := metric.collectionID
+	planID := metric.planID
+	runID := metric.runID
+	engineID := metric.engineID
+	label := metric.label
+	status := metric.status
+	latency := metric.latency
+	threads := metric.threads
+	c.ApiMetricStreamBus <- &ApiMetricStreamEvent{
+		CollectionID:    metric.collectionID,
+		PlanID:          metric.planID,
+		EngineID:        metric.engineID,
+		Raw:             metric.raw,
+		Seq:             metric.seq,
+		EngineTimestamp: metric.engineTime,
+		Replay:          metric.replay,
+	}
+	config.ThreadsGauge.WithLabelValues(collectionID, planID, runID, engineID).Set(threads)
+	switch {
+	case metric.webVital:
+		config.WebVitalSummary.WithLabelValues(collectionID, label, runID).Observe(latency)
+	case metric.transaction:
+		config.TransactionCounter.WithLabelValues(collectionID, planID, runID, engineID, label,
+			strconv.FormatBool(metric.success)).Inc()
+		config.TransactionLatencySummary.WithLabelValues(collectionID, label, runID).Observe(latency)
+	default:
+		config.StatusCounter.WithLabelValues(metric.collectionID, metric.planID, runID, engineID, label, status).Inc()
+		config.CollectionLatencySummary.WithLabelValues(collectionID, runID).Observe(latency)
+		config.PlanLatencySummary.WithLabelValues(collectionID, planID, runID).Observe(latency)
+		config.LabelLatencySummary.WithLabelValues(collectionID, label, runID).Observe(latency)
+	}
+
+	rid, err := metricStoreKey(runID)
+	if err != nil {
+		log.Printf("Error parsing run ID %s: %v", runID, err)
+		rid = 0 // default to 0 if parsing fails
+	}
+	if metric.webVital {
+		// The label is kept to delete the summary of the run, the web vitals have no status
+		go syncMapInserter(&c.LabelStore, rid, label)
+		return
+	}
+	go c.storeLocally(rid, label, status)
+}
+
+// DeployCollection creates the engines of the collection. The engines are created in the background, they keep the
+// deadline of ctx but they are not given up when ctx is cancelled.
+func (c *Controller) DeployCollection(ctx context.Context, collection *model.Collection) error {
 	eps, err := collection.GetExecutionPlans()
 	if err != nil {
 		return err
@@ -198,7 +272,10 @@ func (c *Controller) DeployCollection(collection *model.Collection) error {
 	vu := 0
 	for _, e := range eps {
 		enginesCount += e.Engines
-		vu += e.Engines * e.Concurrency
+		vu += e.TotalConcurrency()
+	}
+	if err := c.checkReservations(ctx, collection, eps); err != nil {
+		return err
 	}
 	sid := ""
 	if project, projectErr := model.GetProject(collection.ProjectID); projectErr == nil {
@@ -207,8 +284,8 @@ func (c *Controller) DeployCollection(collection *model.Collection) error {
 	if launchErr := collection.NewLaunchEntry(sid, config.SC.Context, int64(enginesCount), nodesCount, int64(vu)); launchErr != nil {
 		return launchErr
 	}
-	err = utils.Retry(func() error {
-		return c.Scheduler.ExposeProject(collection.ProjectID)
+	err = utils.RetryContext(ctx, func() error {
+		return c.Scheduler.ExposeProject(ctx, collection.ProjectID)
 	}, nil)
 	if err != nil {
 		return err
@@ -216,7 +293,12 @@ func (c *Controller) DeployCollection(collection *model.Collection) error {
 	// we will assume collection deployment will always be successful
 	// For some large deployments, it might take more than 1 min to finish, which could result 504 at gateway side
 	// So we do not wait for the deployment to be finished.
+	deployCtx, cancel := context.WithoutCancel(ctx), context.CancelFunc(func() {})
+	if deadline, ok := ctx.Deadline(); ok {
+		deployCtx, cancel = context.WithDeadline(deployCtx, deadline)
+	}
 	go func() {
+		defer cancel()
 		var wg sync.WaitGroup
 		now_ := time.Now()
 		for _, e := range eps {
@@ -224,8 +306,8 @@ func (c *Controller) DeployCollection(collection *model.Collection) error {
 			go func(ep *model.ExecutionPlan) {
 				defer wg.Done()
 				pc := NewPlanController(ep, collection, c.Scheduler)
-				if err := utils.Retry(func() error {
-					return pc.deploy()
+				if err := utils.RetryContext(deployCtx, func() error {
+					return pc.deploy(deployCtx)
 				}, nil); err != nil {
 					log.Printf("Error deploying plan controller: %v", err)
 				}
@@ -239,18 +321,68 @@ func (c *Controller) DeployCollection(collection *model.Collection) error {
 	return nil
 }
 
-func (c *Controller) CollectionStatus(collection *model.Collection) (*smodel.CollectionStatus, error) {
+// RenderCollection returns the resources the scheduler would create to deploy the collection, without creating
+// them, so they can be reviewed
+func (c *Controller) RenderCollection(collection *model.Collection) ([]runtime.Object, error) {
 	eps, err := collection.GetExecutionPlans()
 	if err != nil {
 		return nil, err
 	}
-	cs, err := c.Scheduler.CollectionStatus(collection.ProjectID, collection.ID, eps)
+	objects := []runtime.Object{}
+	for _, ep := range eps {
+		planObjects, err := NewPlanController(ep, collection, c.Scheduler).render()
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, planObjects...)
+	}
+	return objects, nil
+}
+
+func (c *Controller) CollectionStatus(ctx context.Context, collection *model.Collection) (*smodel.CollectionStatus, error) {
+	eps, err := collection.GetExecutionPlans()
+	if err != nil {
+		return nil, err
+	}
+	cs, err := c.Scheduler.CollectionStatus(ctx, collection.ProjectID, collection.ID, eps)
 	if err != nil {
 		return nil, err
 	}
+	// The plans of the continuous and of the soak collections do not run for their own duration
+	if collection.Continuous != nil {
+		collection.Continuous.ApplyTo(eps, false)
+	}
+	if collection.Soak != nil {
+		collection.Soak.ApplyTo(eps)
+	}
+	setPlanPhases(cs, eps, time.Now())
 	if config.SC.DevMode {
 		cs.PoolSize = 100
 		cs.PoolStatus = "running"
 	}
 	return cs, nil
 }
+
+// setPlanPhases tells the phase of the plans in progress, from the time they started
+func setPlanPhases(cs *smodel.CollectionStatus, eps []*model.ExecutionPlan, now time.Time) {
+	plans := make(map[int64]*model.ExecutionPlan, len(eps))
+	for _, ep := range eps {
+		plans[ep.PlanID] = ep
+	}
+	for _, ps := range cs.Plans {
+		ep, ok := plans[ps.PlanID]
+		if !ok || !ps.InProgress {
+			continue
+		}
+		ps.Phase = ep.Phase(now.Sub(ps.StartedTime))
+	}
+}
+
+// EnginesProgress reports how far the deployment of every engine of the collection got
+func (c *Controller) EnginesProgress(ctx context.Context, collection *model.Collection) ([]*smodel.EngineProgress, error) {
+	eps, err := collection.GetExecutionPlans()
+	if err != nil {
+		return nil, err
+	}
+	return c.Scheduler.GetEnginesProgress(ctx, collection.ProjectID, collection.ID, eps)
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// runManifest records what the collection is about to be triggered with: the files of the collection and of its
+// plans, the execution plans, the trigger request and the images of the deployed engines
+func (c *Controller) runManifest(ctx context.Context, collection *model.Collection, tr *model.TriggerRequest) (*model.RunManifest, error) {
+	m := &model.RunManifest{
+		CollectionID: collection.ID,
+		Trigger:      tr,
+		Plans:        collection.ExecutionPlans,
+		Variables:    collection.Variables,
+		Files:        []*model.ManifestFile{},
+		EngineImages: map[int64]string{},
+	}
+	addFile := func(planID int64, sf *model.SetagayaFile) error {
+		checksum, err := model.FileChecksum(sf.Filepath)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, &model.ManifestFile{PlanID: planID, Filepath: sf.Filepath, SHA256: checksum})
+		return nil
+	}
+	for _, sf := range collection.Data {
+		if err := addFile(0, sf); err != nil {
+			return nil, err
+		}
+	}
+	for _, ep := range collection.ExecutionPlans {
+		plan, err := model.GetPlan(ep.PlanID)
+		if err != nil {
+			return nil, err
+		}
+		if err := addFragments(plan); err != nil {
+			return nil, err
+		}
+		files := plan.Data
+		if plan.TestFile != nil {
+			files = append([]*model.SetagayaFile{plan.TestFile}, files...)
+		}
+		for _, sf := range files {
+			if err := addFile(ep.PlanID, sf); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// The images are informational, not every scheduler can tell them
+	if details, err := c.Scheduler.GetCollectionEnginesDetail(ctx, collection.ProjectID, collection.ID); err == nil && details != nil {
+		for _, e := range details.Engines {
+			if e.Image != "" {
+				m.EngineImages[e.PlanID] = e.Image
+			}
+		}
+	}
+	return m, nil
+}
+
+// ReproduceRun triggers the collection again with the inputs of a previous run. It returns the id of the new run
+// and what changed since the previous one, which cannot be told when the inputs of the new run could not be recorded.
+func (c *Controller) ReproduceRun(ctx context.Context, collection *model.Collection, previous *model.RunManifest) (int64, []string, error) {
+	runID, m, err := c.triggerCollection(ctx, collection, previous.Trigger, previous.RunID, false)
+	if m == nil {
+		return runID, nil, err
+	}
+	return runID, previous.Diff(m), err
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/scheduler"
+	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
+)
+
+const (
+	overviewFailuresWindow = 24 * time.Hour
+	overviewMaxFailures    = 20
+	overviewUsageWindow    = 30 * 24 * time.Hour
+	overviewTopProjects    = 10
+)
+
+// ClusterOverview is the engines launched in the cluster of a context
+type ClusterOverview struct {
+	Context         string `json:"context"`
+	LaunchedEngines int64  `json:"launched_engines"`
+	// Only the capacity of the cluster of this controller is known
+	Capacity *smodel.ClusterCapacity `json:"capacity,omitempty"`
+}
+
+// PlatformOverview is the state of the platform at a glance, for the admins
+type PlatformOverview struct {
+	RunningCollections []*model.RunningPlan `json:"running_collections"`
+	TotalEngines       int64                `json:"total_engines"`
+	Clusters           []*ClusterOverview   `json:"clusters"`
+	// Background jobs which failed lately
+	RecentFailures []*model.Job `json:"recent_failures"`
+	// Projects which used the most vuh lately
+	TopProjects []*model.ProjectUsage `json:"top_projects"`
+}
+
+// makeClusterOverviews lists the clusters by context. The cluster of this controller is listed even without
+// engines launched, so its capacity is shown.
+func makeClusterOverviews(launched map[string]int64, context string, capacity *smodel.ClusterCapacity) ([]*ClusterOverview, int64) {
+	clusters := []*ClusterOverview{}
+	var total int64
+	for cxt, engines := range launched {
+		clusters = append(clusters, &ClusterOverview{Context: cxt, LaunchedEngines: engines})
+		total += engines
+	}
+	if _, ok := launched[context]; !ok {
+		clusters = append(clusters, &ClusterOverview{Context: context})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Context < clusters[j].Context
+	})
+	for _, c := range clusters {
+		if c.Context == context {
+			c.Capacity = capacity
+		}
+	}
+	return clusters, total
+}
+
+// Overview gathers what the admins otherwise look up across several endpoints. The capacity of the cluster
+// is left out when the scheduler cannot report it, the rest of the overview is still useful.
+func (c *Controller) Overview(ctx context.Context) (*PlatformOverview, error) {
+	running, err := model.GetRunningCollections()
+	if err != nil {
+		return nil, err
+	}
+	launched, err := model.GetLaunchedEngines()
+	if err != nil {
+		return nil, err
+	}
+	capacity, err := c.Scheduler.GetClusterCapacity(ctx)
+	if err != nil && !errors.Is(err, scheduler.ErrFeatureUnavailable) {
+		log.Printf("Error getting the capacity of the cluster: %v", err)
+	}
+	now := time.Now()
+	failures, err := model.GetFailedJobs(now.Add(-overviewFailuresWindow), overviewMaxFailures)
+	if err != nil {
+		return nil, err
+	}
+	topProjects, err := model.GetTopProjectsByUsage(now.Add(-overviewUsageWindow).Format(model.MySQLFormat),
+		now.Format(model.MySQLFormat), overviewTopProjects)
+	if err != nil {
+		return nil, err
+	}
+	clusters, total := makeClusterOverviews(launched, config.SC.Context, capacity)
+	return &PlatformOverview{
+		RunningCollections: running,
+		TotalEngines:       total,
+		Clusters:           clusters,
+		RecentFailures:     failures,
+		TopProjects:        topProjects,
+	}, nil
+}
@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
+)
+
+func TestMakeClusterOverviews(t *testing.T) {
+	capacity := &smodel.ClusterCapacity{Nodes: 3}
+	clusters, total := makeClusterOverviews(map[string]int64{"gcp": 5, "aws": 10}, "gcp", capacity)
+	assert.Equal(t, int64(15), total)
+	assert.Len(t, clusters, 2)
+	assert.Equal(t, "aws", clusters[0].Context)
+	assert.Nil(t, clusters[0].Capacity)
+	assert.Equal(t, "gcp", clusters[1].Context)
+	assert.Equal(t, int64(5), clusters[1].LaunchedEngines)
+	assert.Equal(t, capacity, clusters[1].Capacity)
+
+	// The cluster of the controller is listed without any engine launched
+	clusters, total = makeClusterOverviews(map[string]int64{}, "gcp", capacity)
+	assert.Equal(t, int64(0), total)
+	assert.Len(t, clusters, 1)
+	assert.Equal(t, capacity, clusters[0].Capacity)
+}
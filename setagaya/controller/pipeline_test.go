@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	engineClient "github.com/hveda/Setagaya/setagaya/engines/client"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/testutil"
+)
+
+// How long the streams of the API are given to receive the last samples once they are all sent
+const pipelineDrainTimeout = 10 * time.Second
+
+func newPipelineController() *Controller {
+	c := &Controller{
+		ApiMetricStreamBus: make(chan *ApiMetricStreamEvent),
+		ApiClosingClients:  make(chan *ApiMetricStream),
+		ApiNewClients:      make(chan *ApiMetricStream),
+		ApiStreamClients:   make(map[string]map[string]chan *ApiMetricStreamEvent),
+	}
+	go c.streamToApi()
+	return c
+}
+
+// runControllerPipeline has the engines stream the load to the controller, which parses the samples and relays
+// them to the streams of the API
+func runControllerPipeline(c *Controller, load *testutil.MetricLoad, engines, clients int) *testutil.MetricLoadReport {
+	var received, last atomic.Int64
+	items := make([]*ApiMetricStream, clients)
+	for i := range items {
+		items[i] = &ApiMetricStream{
+			CollectionID: "1",
+			StreamClient: make(chan *ApiMetricStreamEvent),
+			ClientID:     fmt.Sprintf("client-%d", i),
+		}
+		c.ApiNewClients <- items[i]
+		go func(events chan *ApiMetricStreamEvent) {
+			for range events {
+				received.Add(1)
+				last.Store(time.Now().UnixNano())
+			}
+		}(items[i].StreamClient)
+	}
+	streams := make([]chan *engineClient.Event, engines)
+	for i := range streams {
+		streams[i] = make(chan *engineClient.Event)
+		be := &baseEngine{collectionID: 1, planID: 1, ID: i, runID: 1, tracker: newStreamTracker(),
+			stream: &engineClient.Stream{Events: streams[i], Errors: make(chan error)}}
+		go func() {
+			for metric := range readJTLMetrics(be, nil) {
+				c.publishMetric(metric)
+			}
+		}()
+	}
+	start := time.Now()
+	n := 0
+	sent := load.Run(context.Background(), func(line string) {
+		streams[n%engines] <- &engineClient.Event{StreamEvent: enginesModel.StreamEvent{Data: line}}
+		n++
+	})
+	deadline := time.Now().Add(pipelineDrainTimeout)
+	for received.Load() < int64(sent*clients) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for _, s := range streams {
+		close(s)
+	}
+	for _, item := range items {
+		c.ApiClosingClients <- item
+	}
+	return &testutil.MetricLoadReport{
+		Rate:        load.Rate,
+		Subscribers: clients,
+		Sent:        sent,
+		Received:    int(received.Load()),
+		Elapsed:     time.Unix(0, last.Load()).Sub(start),
+	}
+}
+
+// BenchmarkControllerPipeline streams synthetic samples from 20 engines through the controller to two streams of
+// the API, at the rates of -metric-rates. Run it with -bench ControllerPipeline -benchtime 1x, it reports the
+// samples every stream received per second and the ones dropped.
+func BenchmarkControllerPipeline(b *testing.B) {
+	const samples, engines, clients = 100000, 20, 2
+	rates, err := testutil.MetricRates()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, rate := range rates {
+		b.Run(fmt.Sprintf("rate=%d", rate), func(b *testing.B) {
+			c := newPipelineController()
+			load := &testutil.MetricLoad{Rate: rate, Samples: samples, Labels: 20}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runControllerPipeline(c, load, engines, clients).ReportTo(b)
+			}
+		})
+	}
+}
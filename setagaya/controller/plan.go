@@ -1,16 +1,19 @@
 package controller
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
 	"sync"
 
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/hveda/Setagaya/setagaya/config"
 	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
 	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
 	"github.com/hveda/Setagaya/setagaya/scheduler"
 	_ "github.com/hveda/Setagaya/setagaya/utils"
 )
@@ -29,21 +32,98 @@ func NewPlanController(ep *model.ExecutionPlan, collection *model.Collection, sc
 	}
 }
 
-func (pc *PlanController) deploy() error {
-	engineConfig := findEngineConfig(JmeterEngineType)
-	if err := pc.scheduler.DeployPlan(pc.collection.ProjectID, pc.collection.ID, pc.ep.PlanID,
+// engineConfig is the container the engines of the plan run in, taking the registry of the project into account
+func (pc *PlanController) engineConfig() (*config.ExecutorContainer, error) {
+	engineConfig := findEngineConfig(findEngineType(pc.ep))
+	if engineConfig == nil {
+		return nil, fmt.Errorf("%s engine is not configured", pc.ep.GetEngineType())
+	}
+	if pc.ep.GetOS() == model.WindowsOS {
+		return windowsEngineConfig()
+	}
+	registry, err := model.GetProjectRegistry(pc.collection.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	if image, ok := registry.CustomImage(pc.ep.GetEngineType()); ok {
+		if err := checkImagePolicy(image); err != nil {
+			return nil, err
+		}
+	}
+	c := *registry.EngineContainer(pc.ep.GetEngineType(), engineConfig)
+	c.Arch = pc.ep.Arch
+	c.NetworkShaping = pc.ep.NetworkShaping
+	return &c, nil
+}
+
+// windowsEngineConfig is the container of the jmeter engines running on windows. The custom images of the projects
+// are linux ones, so they do not apply.
+func windowsEngineConfig() (*config.ExecutorContainer, error) {
+	windows := config.SC.ExecutorConfig.JmeterContainer.Windows
+	if windows == nil {
+		return nil, fmt.Errorf("%s engines are not configured", model.WindowsOS)
+	}
+	c := *windows
+	c.OS = model.WindowsOS
+	return &c, nil
+}
+
+func (pc *PlanController) deploy(ctx context.Context) error {
+	engineConfig, err := pc.engineConfig()
+	if err != nil {
+		return err
+	}
+	// The scheduler may have moved since the collection was configured
+	if err := scheduler.CheckRegions(pc.scheduler, pc.ep.Regions); err != nil {
+		return err
+	}
+	if err := pc.scheduler.DeployPlan(ctx, pc.collection.ProjectID, pc.collection.ID, pc.ep.PlanID,
 		pc.ep.Engines, engineConfig); err != nil {
 		return err
 	}
 	return nil
 }
 
+func (pc *PlanController) render() ([]runtime.Object, error) {
+	engineConfig, err := pc.engineConfig()
+	if err != nil {
+		return nil, err
+	}
+	return pc.scheduler.RenderPlan(pc.collection.ProjectID, pc.collection.ID, pc.ep.PlanID, pc.ep.Engines, engineConfig)
+}
+
 func (pc *PlanController) prepare(plan *model.Plan, edc *enginesModel.EngineDataConfig, runID int64) []*enginesModel.EngineDataConfig {
 	edc.Duration = strconv.Itoa(pc.ep.Duration)
 	edc.Concurrency = strconv.Itoa(pc.ep.Concurrency)
 	edc.Rampup = strconv.Itoa(pc.ep.Rampup)
+	edc.Rampdown = pc.ep.Rampdown
+	edc.Warmup = pc.ep.Warmup
+	edc.TargetRPS = enginesModel.SplitTargetRPS(pc.ep.TargetRPS, pc.ep.Engines)
+	edc.MaxRPS = float64(pc.ep.MaxEngineRPS)
+	edc.NetworkShaping = pc.ep.NetworkShaping
+	if findEngineType(pc.ep) == JmeterEngineType {
+		edc.JTLColumns = config.SC.ExecutorConfig.JmeterContainer.JTLColumns
+		edc.Artifacts = config.SC.ExecutorConfig.JmeterContainer.Artifacts
+		edc.ArtifactMirror = config.SC.ExecutorConfig.ArtifactMirror
+		edc.DNSCaching = pc.ep.DNSCaching
+		edc.ConnectionPolicy = pc.ep.ConnectionPolicy
+	}
 	engineDataConfigs := edc.DeepCopies(pc.ep.Engines)
+	engineRegions := model.AssignEngineRegions(pc.ep.Regions, pc.ep.Engines)
+	// The distribution was checked when the collection was configured
+	concurrencies, err := pc.ep.EngineConcurrencies()
+	if err != nil {
+		log.Printf("Error splitting the users of plan %d, every engine runs %d: %v", pc.ep.PlanID, pc.ep.Concurrency,
+			err)
+		concurrencies = nil
+	}
 	for i := 0; i < pc.ep.Engines; i++ {
+		if engineRegions != nil {
+			engineDataConfigs[i].Region = engineRegions[i]
+		}
+		if concurrencies != nil {
+			engineDataConfigs[i].Concurrency = strconv.Itoa(concurrencies[i])
+		}
 		// we split the data inherited from collection if the plan specifies split too
 		if pc.ep.CSVSplit {
 			for _, ed := range engineDataConfigs[i].EngineData {
@@ -55,6 +135,10 @@ func (pc *PlanController) prepare(plan *model.Plan, edc *enginesModel.EngineData
 		engineDataConfigs[i].EngineData[plan.TestFile.Filename] = plan.TestFile
 		engineDataConfigs[i].RunID = runID
 		engineDataConfigs[i].EngineID = i
+		if edc.Seed != nil {
+			seed := enginesModel.EngineSeed(*edc.Seed, pc.ep.PlanID, i)
+			engineDataConfigs[i].Seed = &seed
+		}
 		// add all data uploaded in plans. This will override common data if same filename already exists
 		for _, d := range plan.Data {
 			sf := model.SetagayaFile{
@@ -62,6 +146,7 @@ func (pc *PlanController) prepare(plan *model.Plan, edc *enginesModel.EngineData
 				Filepath:     d.Filepath,
 				TotalSplits:  1,
 				CurrentSplit: 0,
+				Fragment:     d.Fragment,
 			}
 			if pc.ep.CSVSplit {
 				sf.TotalSplits = pc.ep.Engines
@@ -69,18 +154,47 @@ func (pc *PlanController) prepare(plan *model.Plan, edc *enginesModel.EngineData
 			}
 			engineDataConfigs[i].EngineData[d.Filename] = &sf
 		}
+		// The engines download the files from where their content is stored, in the region of the tenant, through
+		// a signed url when the storage signs them so they don't need its credentials
+		for name, sf := range engineDataConfigs[i].EngineData {
+			located := *sf
+			region, err := sos.Region(sos.Client.Storage, sf.Filepath)
+			if err != nil {
+				log.Printf("Cannot find the region of %s: %v", sf.Filepath, err)
+			}
+			located.Region = region
+			located.Filepath = sos.Locate(sos.Client.Storage, sf.Filepath)
+			located.Filelink = sos.SignedUrl(sos.Client.Storage, sf.Filepath)
+			engineDataConfigs[i].EngineData[name] = &located
+		}
 	}
 	return engineDataConfigs
 }
 
-func (pc *PlanController) trigger(engineDataConfig *enginesModel.EngineDataConfig, runID int64) error {
+// engineDataConfigs returns what every engine of the plan receives when it's triggered
+func (pc *PlanController) engineDataConfigs(engineDataConfig *enginesModel.EngineDataConfig, runID int64) (*model.Plan, []*enginesModel.EngineDataConfig, error) {
 	plan, err := model.GetPlan(pc.ep.PlanID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := addFragments(plan); err != nil {
+		return nil, nil, err
+	}
+	if pc.ep.Regions, err = pc.collection.GetPlanRegions(pc.ep.PlanID); err != nil {
+		return nil, nil, err
+	}
+	return plan, pc.prepare(plan, engineDataConfig, runID), nil
+}
+
+func (pc *PlanController) trigger(ctx context.Context, engineDataConfig *enginesModel.EngineDataConfig, runID int64) error {
+	plan, engineDataConfigs, err := pc.engineDataConfigs(engineDataConfig, runID)
 	if err != nil {
 		return err
 	}
-	engineDataConfigs := pc.prepare(plan, engineDataConfig, runID)
-	engines, err := generateEnginesWithUrl(pc.ep.Engines, pc.ep.PlanID, pc.collection.ID, pc.collection.ProjectID,
-		JmeterEngineType, pc.scheduler)
+	setEngineRegionMetrics(engineDataConfigs, pc.collection.ID, pc.ep.PlanID, runID)
+	setPlanTeamMetric(plan.Team, pc.collection.ID, pc.ep.PlanID, runID)
+	engines, err := generateEnginesWithUrl(ctx, pc.ep.Engines, pc.ep.PlanID, pc.collection.ID, pc.collection.ProjectID,
+		findEngineType(pc.ep), pc.scheduler)
 	if err != nil {
 		return err
 	}
@@ -89,7 +203,7 @@ func (pc *PlanController) trigger(engineDataConfig *enginesModel.EngineDataConfi
 	planErrors := []error{}
 	for i, engine := range engines {
 		go func(engine setagayaEngine, i int) {
-			if err := engine.trigger(engineDataConfigs[i]); err != nil {
+			if err := engine.trigger(ctx, engineDataConfigs[i]); err != nil {
 				errs <- err
 				return
 			}
@@ -112,11 +226,11 @@ func makePlanEngineKey(collectionID, planID int64, engineID int) string {
 	return fmt.Sprintf("%s-%d-%d-%d", config.SC.Context, collectionID, planID, engineID)
 }
 
-func (pc *PlanController) subscribe(connectedEngines *sync.Map, readingEngines chan setagayaEngine) error {
+func (pc *PlanController) subscribe(ctx context.Context, connectedEngines *sync.Map, readingEngines chan setagayaEngine) error {
 	ep := pc.ep
 	collection := pc.collection
-	engines, err := generateEnginesWithUrl(ep.Engines, ep.PlanID, collection.ID, collection.ProjectID,
-		JmeterEngineType, pc.scheduler)
+	engines, err := generateEnginesWithUrl(ctx, ep.Engines, ep.PlanID, collection.ID, collection.ProjectID,
+		findEngineType(pc.ep), pc.scheduler)
 	if err != nil {
 		return err
 	}
@@ -127,33 +241,38 @@ func (pc *PlanController) subscribe(connectedEngines *sync.Map, readingEngines c
 	for _, engine := range engines {
 		go func(engine setagayaEngine, runID int64) {
 			//After this step, the engine instance has states including stream client
-			err := engine.subscribe(runID)
-			if err != nil {
+			if err := engine.subscribe(runID); err != nil {
 				return
 			}
-			key := makePlanEngineKey(collection.ID, ep.PlanID, engine.EngineID())
-			if _, loaded := connectedEngines.LoadOrStore(key, engine); !loaded {
-				readingEngines <- engine
-				log.Printf("Engine %s is subscribed", key)
-				return
-			}
-			// This might be triggered by some cases that multiple streams are being estabalished at the same time
-			// for example, when the plan was broken and later replaced by a working one without purging the engines
-			// In this case, we only mainain the first stream and close the current one
-			engine.closeStream()
-			log.Printf("Duplicate stream of engine %s is closed", key)
+			pc.connect(engine, connectedEngines, readingEngines)
 		}(engine, runID)
 	}
 	log.Printf("Subscribe to Plan %d", ep.PlanID)
 	return nil
 }
 
+// connect starts reading the metrics of a subscribed engine
+func (pc *PlanController) connect(engine setagayaEngine, connectedEngines *sync.Map, readingEngines chan setagayaEngine) {
+	key := makePlanEngineKey(pc.collection.ID, pc.ep.PlanID, engine.EngineID())
+	if _, loaded := connectedEngines.LoadOrStore(key, engine); !loaded {
+		readingEngines <- engine
+		log.Printf("Engine %s is subscribed", key)
+		return
+	}
+	// This might be triggered by some cases that multiple streams are being estabalished at the same time
+	// for example, when the plan was broken and later replaced by a working one without purging the engines
+	// In this case, we only mainain the first stream and close the current one
+	engine.closeStream()
+	log.Printf("Duplicate stream of engine %s is closed", key)
+}
+
 // TODO. we can use the cached clients here.
 func (pc *PlanController) progress() bool {
 	r := true
 	ep := pc.ep
 	collection := pc.collection
-	engines, err := generateEnginesWithUrl(ep.Engines, ep.PlanID, collection.ID, collection.ProjectID, JmeterEngineType, pc.scheduler)
+	engines, err := generateEnginesWithUrl(context.Background(), ep.Engines, ep.PlanID, collection.ID, collection.ProjectID,
+		findEngineType(ep), pc.scheduler)
 	if errors.Is(err, scheduler.ErrIngress) {
 		log.Error(err)
 		return true
@@ -167,7 +286,7 @@ func (pc *PlanController) progress() bool {
 	return !r
 }
 
-func (pc *PlanController) term(force bool, connectedEngines *sync.Map) error {
+func (pc *PlanController) term(ctx context.Context, force bool, connectedEngines *sync.Map) error {
 	var wg sync.WaitGroup
 	ep := pc.ep
 	for i := 0; i < ep.Engines; i++ {
@@ -183,7 +302,7 @@ func (pc *PlanController) term(force bool, connectedEngines *sync.Map) error {
 			}
 			go func(engine setagayaEngine) {
 				defer wg.Done()
-				if err := engine.terminate(force); err != nil {
+				if err := engine.terminate(ctx, force); err != nil {
 					log.Printf("Error terminating engine %s: %v", key, err)
 				}
 				connectedEngines.Delete(key)
@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// playwrightEngine drives browser based scenarios. It's experimental.
+// The agent reports every page load and web vital as a JTL line, so the controller treats
+// them like any other sample. For example, the LCP of the checkout page is reported with label
+// "checkout:lcp" and its value in milliseconds as the latency.
+type playwrightEngine struct {
+	*baseEngine
+}
+
+func NewPlaywrightEngine(be *baseEngine) *playwrightEngine {
+	be.ExecutorContainer = config.SC.ExecutorConfig.PlaywrightContainer.ExecutorContainer
+	return &playwrightEngine{be}
+}
+
+func (pe *playwrightEngine) readMetrics() chan *setagayaMetric {
+	return readJTLMetrics(pe.baseEngine, nil)
+}
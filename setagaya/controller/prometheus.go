@@ -1,13 +1,16 @@
 package controller
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/hveda/Setagaya/setagaya/config"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
 	"github.com/hveda/Setagaya/setagaya/model"
 )
 
@@ -34,6 +37,16 @@ func syncMapInserter(sm *sync.Map, id int64, value string) {
 	nestedSyncMap.Store(value, struct{}{})
 }
 
+// metricStoreKey is the key of the labels and the statuses of the run in the local stores, from its run_id label.
+// The replays of a run are kept apart from it under the negative of its id
+func metricStoreKey(runID string) (int64, error) {
+	if id, ok := strings.CutPrefix(runID, replayRunPrefix); ok {
+		rid, err := strconv.ParseInt(id, 10, 64)
+		return -rid, err
+	}
+	return strconv.ParseInt(runID, 10, 64)
+}
+
 func (c *Controller) storeLocally(id int64, label string, status string) {
 	syncMapInserter(&c.LabelStore, id, label)
 	syncMapInserter(&c.StatusStore, id, status)
@@ -61,6 +74,82 @@ func (c *Controller) deleteEngineHealthMetrics(collectionID string, planID strin
 	}
 }
 
+// The region label value is needed to delete the region metric, so we remember the regions
+// assigned to the engines per run and plan.
+var engineRegionStore sync.Map
+
+func makeEngineRegionKey(collectionID, planID, runID string) string {
+	return fmt.Sprintf("%s-%s-%s", collectionID, planID, runID)
+}
+
+func setEngineRegionMetrics(edcs []*enginesModel.EngineDataConfig, collectionID, planID, runID int64) {
+	cid := strconv.FormatInt(collectionID, 10)
+	pid := strconv.FormatInt(planID, 10)
+	rid := strconv.FormatInt(runID, 10)
+	regions := make([]string, len(edcs))
+	for i, edc := range edcs {
+		if edc.Region == "" {
+			continue
+		}
+		regions[i] = edc.Region
+		config.EngineRegionGauge.WithLabelValues(cid, pid, rid, strconv.Itoa(edc.EngineID), edc.Region).Set(1)
+	}
+	engineRegionStore.Store(makeEngineRegionKey(cid, pid, rid), regions)
+}
+
+func deleteEngineRegionMetrics(collectionID, planID, runID string) {
+	key := makeEngineRegionKey(collectionID, planID, runID)
+	item, ok := engineRegionStore.LoadAndDelete(key)
+	if !ok {
+		return
+	}
+	regions, ok := item.([]string)
+	if !ok {
+		return
+	}
+	for i, region := range regions {
+		if region == "" {
+			continue
+		}
+		config.EngineRegionGauge.Delete(prometheus.Labels{
+			"collection_id": collectionID,
+			"plan_id":       planID,
+			"run_id":        runID,
+			"engine_no":     strconv.Itoa(i),
+			"region":        region,
+		})
+	}
+}
+
+// The teams of the plans of the runs, by the same key as the regions, so their metric can be deleted
+var planTeamStore sync.Map
+
+func setPlanTeamMetric(team string, collectionID, planID, runID int64) {
+	if team == "" {
+		return
+	}
+	cid := strconv.FormatInt(collectionID, 10)
+	pid := strconv.FormatInt(planID, 10)
+	rid := strconv.FormatInt(runID, 10)
+	config.PlanTeamGauge.WithLabelValues(cid, pid, rid, team).Set(1)
+	planTeamStore.Store(makeEngineRegionKey(cid, pid, rid), team)
+}
+
+func deletePlanTeamMetric(collectionID, planID, runID string) {
+	item, ok := planTeamStore.LoadAndDelete(makeEngineRegionKey(collectionID, planID, runID))
+	if !ok {
+		return
+	}
+	if team, ok := item.(string); ok {
+		config.PlanTeamGauge.Delete(prometheus.Labels{
+			"collection_id": collectionID,
+			"plan_id":       planID,
+			"run_id":        runID,
+			"team":          team,
+		})
+	}
+}
+
 func (c *Controller) deleteMetrics(runID string, collectionID string, planID string, engines int) {
 	for i := 0; i < engines; i++ {
 		engineID := strconv.Itoa(i)
@@ -71,6 +160,8 @@ func (c *Controller) deleteMetrics(runID string, collectionID string, planID str
 			"engine_no":     engineID,
 		})
 	}
+	deleteEngineRegionMetrics(collectionID, planID, runID)
+	deletePlanTeamMetric(collectionID, planID, runID)
 	config.PlanLatencySummary.Delete(prometheus.Labels{
 		"collection_id": collectionID,
 		"plan_id":       planID,
@@ -84,7 +175,7 @@ func (c *Controller) deleteMetrics(runID string, collectionID string, planID str
 }
 
 func (c *Controller) deleteMetricsUsingLabelStore(runID string, collectionID string, planID string, engines int) {
-	runID_int, err := strconv.ParseInt(runID, 10, 64)
+	runID_int, err := metricStoreKey(runID)
 	if err != nil {
 		log.Printf("Error parsing run ID %s: %v", runID, err)
 		return
@@ -109,6 +200,29 @@ func (c *Controller) deleteMetricsUsingLabelStore(runID string, collectionID str
 			"run_id":        runID,
 			"label":         labelStr,
 		})
+		// Transaction labels are kept in the same store as the sampler labels
+		config.TransactionLatencySummary.Delete(prometheus.Labels{
+			"collection_id": collectionID,
+			"run_id":        runID,
+			"label":         labelStr,
+		})
+		config.WebVitalSummary.Delete(prometheus.Labels{
+			"collection_id": collectionID,
+			"run_id":        runID,
+			"label":         labelStr,
+		})
+		for i := 0; i < engines; i++ {
+			for _, success := range []string{"true", "false"} {
+				config.TransactionCounter.Delete(prometheus.Labels{
+					"collection_id": collectionID,
+					"plan_id":       planID,
+					"run_id":        runID,
+					"engine_no":     strconv.Itoa(i),
+					"label":         labelStr,
+					"success":       success,
+				})
+			}
+		}
 		c.deleteMetricsUsingStatusStore(runID, collectionID, planID,
 			engines, labelStr)
 		return true
@@ -117,7 +231,7 @@ func (c *Controller) deleteMetricsUsingLabelStore(runID string, collectionID str
 
 func (c *Controller) deleteMetricsUsingStatusStore(runID string, collectionID string,
 	planID string, engines int, label string) {
-	runID_int, err := strconv.ParseInt(runID, 10, 64)
+	runID_int, err := metricStoreKey(runID)
 	if err != nil {
 		log.Printf("Error parsing run ID %s: %v", runID, err)
 		return
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// PushRuntimeProperties changes jmeter properties of the engines of the running plans of the collection, and
+// records the names of the properties in the timeline of the run. It returns the number of engines changed, the
+// error tells about the engines which could not be.
+func (c *Controller) PushRuntimeProperties(collection *model.Collection, rpr *enginesModel.RuntimePropertiesRequest) (int, error) {
+	runID, err := collection.GetCurrentRun()
+	if err != nil {
+		return 0, err
+	}
+	if runID == 0 {
+		return 0, &model.RequestError{Message: "the collection is not running"}
+	}
+	eps, err := collection.GetExecutionPlans()
+	if err != nil {
+		return 0, err
+	}
+	running, err := model.GetRunningPlansByCollection(collection.ID)
+	if err != nil {
+		return 0, err
+	}
+	runningIDs := make(map[int64]bool, len(running))
+	for _, rp := range running {
+		runningIDs[rp.PlanID] = true
+	}
+	// The playwright engines do not have properties, and the plans waiting to start are not running yet
+	targets := []*model.ExecutionPlan{}
+	for _, ep := range eps {
+		if ep.GetEngineType() == model.JmeterEngine && runningIDs[ep.PlanID] {
+			targets = append(targets, ep)
+		}
+	}
+	var mu sync.Mutex
+	changed := 0
+	errs := []error{}
+	c.forEachConnectedEngine(collection, targets, func(engine setagayaEngine, _ int64, key string) {
+		err := engine.pushProperties(rpr)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("engine %s: %w", key, err))
+			return
+		}
+		changed++
+	})
+	if changed > 0 {
+		message := fmt.Sprintf("properties %s changed on %d engines", strings.Join(rpr.Names(), ", "), changed)
+		if err := model.AddRunEvent(collection.ID, runID, model.RunEventPropertiesChanged, message); err != nil {
+			log.Printf("Error recording the event of run %d: %v", runID, err)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
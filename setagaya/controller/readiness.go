@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/scheduler"
+)
+
+// The dependencies the API server and the controller cannot work without
+const (
+	DependencyDatabase      = "database"
+	DependencyObjectStorage = "object_storage"
+	DependencyScheduler     = "scheduler"
+)
+
+// DependencyStatus is the outcome of the last check of a dependency
+type DependencyStatus struct {
+	Name        string    `json:"name"`
+	Healthy     bool      `json:"healthy"`
+	Error       string    `json:"error,omitempty"`
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// DependencyReport is the health of the dependencies. It's ready when they are all healthy
+type DependencyReport struct {
+	Ready        bool                `json:"ready"`
+	Dependencies []*DependencyStatus `json:"dependencies"`
+}
+
+type dependency struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// dependencies are the checks of what the platform needs to work. The database is missing when the config has none
+func (c *Controller) dependencies() []*dependency {
+	deps := []*dependency{}
+	if db := config.SC.DBC; db != nil {
+		deps = append(deps, &dependency{name: DependencyDatabase, check: db.PingContext})
+	}
+	deps = append(deps,
+		&dependency{name: DependencyObjectStorage, check: func(context.Context) error { return checkStorage() }},
+		&dependency{name: DependencyScheduler, check: func(ctx context.Context) error {
+			return scheduler.Ping(ctx, c.Scheduler)
+		}},
+	)
+	return deps
+}
+
+// checkDependencies checks the dependencies at the same time. A check taking longer than the timeout fails, the
+// storages which do not take a context are not waited for after it
+func checkDependencies(deps []*dependency, timeout time.Duration) *DependencyReport {
+	report := &DependencyReport{Ready: true, Dependencies: make([]*DependencyStatus, len(deps))}
+	var wg sync.WaitGroup
+	for i, d := range deps {
+		wg.Add(1)
+		go func(i int, d *dependency) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- d.check(ctx) }()
+			var err error
+			select {
+			case err = <-done:
+			case <-ctx.Done():
+				err = fmt.Errorf("no answer within %s", timeout)
+			}
+			status := &DependencyStatus{Name: d.name, Healthy: err == nil, LastChecked: time.Now()}
+			if err != nil {
+				status.Error = err.Error()
+			}
+			report.Dependencies[i] = status
+		}(i, d)
+	}
+	wg.Wait()
+	for _, s := range report.Dependencies {
+		report.Ready = report.Ready && s.Healthy
+	}
+	return report
+}
+
+// waitForDependencies checks the dependencies until they are all healthy, waiting longer after every failed check.
+// It gives up after the attempts of the config
+func waitForDependencies(deps []*dependency, sc *config.StartupConfig, sleep func(time.Duration)) (*DependencyReport, error) {
+	timeout := time.Duration(sc.CheckTimeout) * time.Second
+	delay := time.Duration(sc.RetryInterval) * time.Second
+	maxDelay := time.Duration(sc.MaxRetryInterval) * time.Second
+	var report *DependencyReport
+	for attempt := 1; attempt <= sc.MaxAttempts; attempt++ {
+		report = checkDependencies(deps, timeout)
+		if report.Ready {
+			return report, nil
+		}
+		for _, s := range report.Dependencies {
+			if !s.Healthy {
+				log.Warnf("Dependency %s is not reachable, attempt %d of %d: %s", s.Name, attempt, sc.MaxAttempts, s.Error)
+			}
+		}
+		if attempt == sc.MaxAttempts {
+			break
+		}
+		log.Infof("Checking the dependencies again in %s", delay)
+		sleep(delay)
+		delay = min(delay*2, maxDelay)
+	}
+	var errs []error
+	for _, s := range report.Dependencies {
+		if !s.Healthy {
+			errs = append(errs, fmt.Errorf("%s: %s", s.Name, s.Error))
+		}
+	}
+	return report, fmt.Errorf("the dependencies are not reachable after %d attempts: %w", sc.MaxAttempts,
+		errors.Join(errs...))
+}
+
+// WaitForDependencies holds the start until the database, the object storage and the scheduler are reachable, so a
+// platform started along with them does not crash. The process exits when they are still unreachable after the
+// attempts of the config.
+func (c *Controller) WaitForDependencies() {
+	log.Info("Waiting for the dependencies to be reachable")
+	report, err := waitForDependencies(c.dependencies(), config.SC.Startup, time.Sleep)
+	c.dependencyReport.Store(report)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Info("The dependencies are reachable")
+}
+
+// MonitorDependencies checks the dependencies at the interval of the config, for /readyz
+func (c *Controller) MonitorDependencies() {
+	interval := time.Duration(config.SC.Startup.ReadinessInterval) * time.Second
+	timeout := time.Duration(config.SC.Startup.CheckTimeout) * time.Second
+	deps := c.dependencies()
+	for {
+		time.Sleep(interval)
+		report := checkDependencies(deps, timeout)
+		if !report.Ready {
+			for _, s := range report.Dependencies {
+				if !s.Healthy {
+					log.Warnf("Dependency %s is not reachable: %s", s.Name, s.Error)
+				}
+			}
+		}
+		c.dependencyReport.Store(report)
+	}
+}
+
+// DependencyReport is the last check of the dependencies. It's not ready before the first one
+func (c *Controller) DependencyReport() *DependencyReport {
+	if report := c.dependencyReport.Load(); report != nil {
+		return report
+	}
+	return &DependencyReport{Dependencies: []*DependencyStatus{}}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestCheckDependencies(t *testing.T) {
+	deps := []*dependency{
+		{name: DependencyDatabase, check: func(context.Context) error { return nil }},
+		{name: DependencyObjectStorage, check: func(context.Context) error { return errors.New("bucket not found") }},
+		// Hangs without looking at its context, like a storage call
+		{name: DependencyScheduler, check: func(context.Context) error { time.Sleep(time.Second); return nil }},
+	}
+	report := checkDependencies(deps, 50*time.Millisecond)
+	assert.False(t, report.Ready)
+	assert.Len(t, report.Dependencies, 3)
+	assert.True(t, report.Dependencies[0].Healthy)
+	assert.Equal(t, "bucket not found", report.Dependencies[1].Error)
+	assert.False(t, report.Dependencies[2].Healthy)
+	assert.Contains(t, report.Dependencies[2].Error, "no answer")
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	sc := &config.StartupConfig{MaxAttempts: 5, RetryInterval: 1, MaxRetryInterval: 3, CheckTimeout: 1}
+	var waits []time.Duration
+	sleep := func(d time.Duration) { waits = append(waits, d) }
+
+	// The database comes up at the third check
+	checks := 0
+	deps := []*dependency{{name: DependencyDatabase, check: func(context.Context) error {
+		checks++
+		if checks < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}}}
+	report, err := waitForDependencies(deps, sc, sleep)
+	assert.NoError(t, err)
+	assert.True(t, report.Ready)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, waits)
+
+	// It gives up after the attempts, the intervals capped
+	waits = nil
+	deps = []*dependency{{name: DependencyScheduler, check: func(context.Context) error {
+		return errors.New("connection refused")
+	}}}
+	report, err = waitForDependencies(deps, sc, sleep)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "scheduler: connection refused")
+	assert.False(t, report.Ready)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}, waits)
+}
+
+func TestDependencyReportBeforeCheck(t *testing.T) {
+	c := &Controller{}
+	assert.False(t, c.DependencyReport().Ready)
+	c.dependencyReport.Store(&DependencyReport{Ready: true, Dependencies: []*DependencyStatus{}})
+	assert.True(t, c.DependencyReport().Ready)
+}
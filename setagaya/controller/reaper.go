@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const (
+	orphanReapInterval = 5 * time.Minute
+	// Resources and running plans younger than this are left alone, they could be in the middle of a launch
+	orphanGracePeriod = 10 * time.Minute
+)
+
+// OrphanReport is what the reconciler found out of sync between the scheduler and the database
+type OrphanReport struct {
+	DryRun bool `json:"dry_run"`
+	// Collections with resources in the scheduler but no launch in progress in the database
+	OrphanedCollections []int64 `json:"orphaned_collections"`
+	// Collections the resources of which could not be deleted
+	FailedCollections []int64 `json:"failed_collections"`
+	// Collections launched by this controller which have no resources in the scheduler
+	LaunchesWithoutResources []int64 `json:"launches_without_resources"`
+	// Running plans of this controller the collection of which has no resources in the scheduler
+	RunningPlansWithoutResources []*model.RunningPlan `json:"running_plans_without_resources"`
+}
+
+// findOrphans compares the collections owning resources in the scheduler with the launches and running plans
+// in the database. The launches of all the controllers back the resources, as several controllers can share a
+// cluster, but only the rows of this controller are expected to have resources in its scheduler.
+func findOrphans(resources map[int64]time.Time, launching, contextLaunching []int64,
+	runningPlans []*model.RunningPlan, now time.Time) *OrphanReport {
+	report := &OrphanReport{
+		OrphanedCollections:          []int64{},
+		FailedCollections:            []int64{},
+		LaunchesWithoutResources:     []int64{},
+		RunningPlansWithoutResources: []*model.RunningPlan{},
+	}
+	launched := make(map[int64]bool)
+	for _, collectionID := range launching {
+		launched[collectionID] = true
+	}
+	for collectionID, created := range resources {
+		if launched[collectionID] || now.Sub(created) < orphanGracePeriod {
+			continue
+		}
+		report.OrphanedCollections = append(report.OrphanedCollections, collectionID)
+	}
+	sort.Slice(report.OrphanedCollections, func(i, j int) bool {
+		return report.OrphanedCollections[i] < report.OrphanedCollections[j]
+	})
+	for _, collectionID := range contextLaunching {
+		if _, ok := resources[collectionID]; !ok {
+			report.LaunchesWithoutResources = append(report.LaunchesWithoutResources, collectionID)
+		}
+	}
+	for _, rp := range runningPlans {
+		if _, ok := resources[rp.CollectionID]; ok || now.Sub(rp.StartedTime) < orphanGracePeriod {
+			continue
+		}
+		report.RunningPlansWithoutResources = append(report.RunningPlansWithoutResources, rp)
+	}
+	return report
+}
+
+// ReconcileOrphans deletes the scheduler resources that are not backed by a launch in the database and reports
+// the database rows that have no resources. The rows are only reported, they need to be looked at by an admin
+// before being force purged. In dry run nothing is deleted.
+func (c *Controller) ReconcileOrphans(ctx context.Context, dryRun bool) (*OrphanReport, error) {
+	resources, err := c.Scheduler.GetCollectionResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	launching, err := model.GetLaunchingCollections()
+	if err != nil {
+		return nil, err
+	}
+	contextLaunching, err := model.GetLaunchingCollectionByContext(config.SC.Context)
+	if err != nil {
+		return nil, err
+	}
+	runningPlans, err := model.GetRunningPlans()
+	if err != nil {
+		return nil, err
+	}
+	report := findOrphans(resources, launching, contextLaunching, runningPlans, time.Now())
+	report.DryRun = dryRun
+	if dryRun {
+		return report, nil
+	}
+	for _, collectionID := range report.OrphanedCollections {
+		log.Printf("Purging orphaned resources of collection %d", collectionID)
+		if err := c.Scheduler.PurgeCollection(ctx, collectionID); err != nil {
+			log.Printf("Error purging orphaned resources of collection %d: %v", collectionID, err)
+			report.FailedCollections = append(report.FailedCollections, collectionID)
+		}
+	}
+	return report, nil
+}
+
+// ReapOrphanedResources runs the reconciler periodically
+func (c *Controller) ReapOrphanedResources() {
+	log.Info("Start the loop for reaping orphaned resources")
+	for {
+		report, err := c.ReconcileOrphans(context.Background(), false)
+		if err != nil {
+			log.Error(err)
+		} else {
+			if len(report.LaunchesWithoutResources) > 0 {
+				log.Printf("Collections launched without resources in the scheduler: %v", report.LaunchesWithoutResources)
+			}
+			for _, rp := range report.RunningPlansWithoutResources {
+				log.Printf("Plan %d of collection %d is running without resources in the scheduler", rp.PlanID, rp.CollectionID)
+			}
+		}
+		time.Sleep(orphanReapInterval)
+	}
+}
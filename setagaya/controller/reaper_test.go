@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestFindOrphans(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-time.Hour)
+	resources := map[int64]time.Time{
+		1: old,
+		2: old,
+		// Deployed in the middle of a launch
+		3: now.Add(-time.Minute),
+		4: old,
+	}
+	// Collection 4 is launched by another controller sharing the cluster
+	launching := []int64{1, 4, 5}
+	contextLaunching := []int64{1, 5}
+	runningPlans := []*model.RunningPlan{
+		{CollectionID: 1, PlanID: 1, StartedTime: old},
+		{CollectionID: 6, PlanID: 1, StartedTime: old},
+		{CollectionID: 7, PlanID: 1, StartedTime: now},
+	}
+	report := findOrphans(resources, launching, contextLaunching, runningPlans, now)
+	assert.Equal(t, []int64{2}, report.OrphanedCollections)
+	assert.Equal(t, []int64{5}, report.LaunchesWithoutResources)
+	assert.Len(t, report.RunningPlansWithoutResources, 1)
+	assert.Equal(t, int64(6), report.RunningPlansWithoutResources[0].CollectionID)
+	assert.Empty(t, report.FailedCollections)
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const (
+	replaceEngineWait = 15 * time.Minute
+	replaceEnginePoll = 5 * time.Second
+)
+
+// remainingMinutes is what is left of the duration of a plan started at started, rounded up. It's zero or less once
+// the plan ran for its duration.
+func remainingMinutes(duration int, started, now time.Time) int {
+	left := started.Add(time.Duration(duration) * time.Minute).Sub(now)
+	return int(math.Ceil(left.Minutes()))
+}
+
+// ReplaceEngine deletes a single engine of a plan and creates it again, e.g. when it stopped sending its metrics.
+// The stream of the engine is connected again when its plan is running. With restart, the new engine also runs
+// its portion of the plan for what is left of the duration of the plan. It returns once the engine is deleted, it's
+// created and connected in the background.
+func (c *Controller) ReplaceEngine(ctx context.Context, collection *model.Collection, planID int64, engineID int, restart bool) error {
+	if config.SC.ExecutorConfig.RunsOnce() {
+		return &model.RequestError{Message: "the engines running once cannot be replaced"}
+	}
+	ep, err := model.GetExecutionPlan(collection.ID, planID)
+	if err != nil {
+		return &model.DBError{Err: err, Message: fmt.Sprintf("plan %d is not in the collection", planID)}
+	}
+	if engineID < 0 || engineID >= ep.Engines {
+		return &model.DBError{Message: fmt.Sprintf("plan %d does not have engine %d", planID, engineID)}
+	}
+	runID, err := collection.GetCurrentRun()
+	if err != nil {
+		return err
+	}
+	running := false
+	var edc *enginesModel.EngineDataConfig
+	if rp, err := model.GetRunningPlan(collection.ID, planID); err == nil && runID != 0 {
+		running = true
+		if restart {
+			if ep, edc, err = c.runPlanEngineDataConfig(collection, planID, runID); err != nil {
+				return err
+			}
+			ep.Duration = remainingMinutes(ep.Duration, rp.StartedTime, time.Now())
+			if ep.Duration <= 0 {
+				return &model.RequestError{Message: fmt.Sprintf("plan %d already ran for its duration", planID)}
+			}
+		}
+	}
+	if restart && !running {
+		return &model.RequestError{Message: fmt.Sprintf("plan %d is not running, its engines have nothing to restart", planID)}
+	}
+	key := makePlanEngineKey(collection.ID, planID, engineID)
+	if _, replacing := c.replacingEngines.LoadOrStore(key, struct{}{}); replacing {
+		return &model.RequestError{Message: fmt.Sprintf("engine %d of plan %d is already being replaced", engineID, planID)}
+	}
+	pc := NewPlanController(ep, collection, c.Scheduler)
+	engineConfig, err := pc.engineConfig()
+	if err != nil {
+		c.replacingEngines.Delete(key)
+		return err
+	}
+	// The stream of the engine being deleted is not read anymore, the new engine gets its own
+	if item, ok := c.connectedEngines.LoadAndDelete(key); ok {
+		if engine, ok := item.(setagayaEngine); ok {
+			engine.closeStream()
+		}
+	}
+	if err := c.Scheduler.ReplaceEngine(ctx, collection.ProjectID, collection.ID, planID, engineID, engineConfig); err != nil {
+		c.replacingEngines.Delete(key)
+		return err
+	}
+	if runID != 0 {
+		message := fmt.Sprintf("engine %d of plan %d was replaced", engineID, planID)
+		if restart {
+			message += fmt.Sprintf(" and restarted for %d minutes", ep.Duration)
+		}
+		if err := model.AddRunEvent(collection.ID, runID, model.RunEventEngineReplaced, message); err != nil {
+			log.Printf("Error recording the event of run %d: %v", runID, err)
+		}
+	}
+	if !running {
+		c.replacingEngines.Delete(key)
+		return nil
+	}
+	// The engine is connected again after the request returned
+	reconnectCtx := context.WithoutCancel(ctx)
+	go func() {
+		defer c.replacingEngines.Delete(key)
+		if err := c.reconnectEngine(reconnectCtx, pc, engineID, runID, edc); err != nil {
+			log.Printf("Error connecting engine %s again: %v", key, err)
+		}
+	}()
+	return nil
+}
+
+// reconnectEngine waits for the new engine to answer, triggers it when edc is given and reads its metrics
+func (c *Controller) reconnectEngine(ctx context.Context, pc *PlanController, engineID int, runID int64, edc *enginesModel.EngineDataConfig) error {
+	engines, err := generateEnginesWithUrl(ctx, pc.ep.Engines, pc.ep.PlanID, pc.collection.ID, pc.collection.ProjectID,
+		findEngineType(pc.ep), pc.scheduler)
+	if err != nil {
+		return err
+	}
+	engine := engines[engineID]
+	deadline := time.Now().Add(replaceEngineWait)
+	for {
+		// The stream is only served once the engine is up
+		if err := engine.subscribe(runID); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the engine was not reachable after %s", replaceEngineWait)
+		}
+		time.Sleep(replaceEnginePoll)
+	}
+	if edc != nil {
+		_, engineDataConfigs, err := pc.engineDataConfigs(edc, runID)
+		if err != nil {
+			engine.closeStream()
+			return err
+		}
+		if err := engine.trigger(ctx, engineDataConfigs[engineID]); err != nil {
+			engine.closeStream()
+			return err
+		}
+	}
+	pc.connect(engine, &c.connectedEngines, c.readingEngines)
+	return nil
+}
@@ -0,0 +1,18 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemainingMinutes(t *testing.T) {
+	started := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30, remainingMinutes(30, started, started))
+	assert.Equal(t, 20, remainingMinutes(30, started, started.Add(10*time.Minute)))
+	// What is left is rounded up, so the engine runs until the end of the plan
+	assert.Equal(t, 1, remainingMinutes(30, started, started.Add(29*time.Minute+30*time.Second)))
+	assert.Equal(t, 0, remainingMinutes(30, started, started.Add(30*time.Minute)))
+	assert.True(t, remainingMinutes(30, started, started.Add(40*time.Minute)) < 0)
+}
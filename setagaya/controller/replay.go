@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+const (
+	// The run_id label of the metrics of a replay, followed by the id of the run replayed
+	replayRunPrefix = "replay-"
+	MaxReplaySpeed  = 100
+)
+
+// ReplayRequest replays the stored results of a run at its original speed, 1, or faster
+type ReplayRequest struct {
+	Speed float64 `json:"speed"`
+}
+
+func (rr *ReplayRequest) Validate() error {
+	if rr.Speed < 1 || rr.Speed > MaxReplaySpeed {
+		return fmt.Errorf("speed should be between 1 and %d", MaxReplaySpeed)
+	}
+	return nil
+}
+
+// RunReplay is a stored run being replayed into the stream and the metrics of its collection, so the dashboards
+// and the alerts can be tried on realistic samples without deploying engines. The samples are streamed flagged as
+// replayed, and their metrics have a run_id of their own.
+type RunReplay struct {
+	RunID       int64     `json:"run_id"`
+	Speed       float64   `json:"speed"`
+	Segments    int       `json:"segments"`
+	StartedTime time.Time `json:"started_time"`
+	cancel      context.CancelFunc
+}
+
+func replayRunLabel(runID int64) string {
+	return replayRunPrefix + strconv.FormatInt(runID, 10)
+}
+
+type replaySample struct {
+	record   *enginesModel.JTLRecord
+	raw      string
+	planID   int64
+	engineID int
+}
+
+// replayBatches groups the segments by checkpoint: the segments of a batch cover the same period of the run, every
+// engine uploaded one of them at the same checkpoint
+func replayBatches(segments []*model.ResultSegment) [][]*model.ResultSegment {
+	seqs := map[string]int{}
+	batches := [][]*model.ResultSegment{}
+	for _, rs := range segments {
+		key := fmt.Sprintf("%d-%d", rs.PlanID, rs.EngineID)
+		seq := seqs[key]
+		seqs[key]++
+		if seq == len(batches) {
+			batches = append(batches, []*model.ResultSegment{})
+		}
+		batches[seq] = append(batches[seq], rs)
+	}
+	return batches
+}
+
+// parseReplaySegment reads the samples of a gzipped segment, which has the default JTL columns
+func parseReplaySegment(content []byte, planID int64, engineID int) ([]*replaySample, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	parser, err := enginesModel.NewJTLParser(nil)
+	if err != nil {
+		return nil, err
+	}
+	samples := []*replaySample{}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		raw := scanner.Text()
+		record, err := parser.Parse(raw)
+		if errors.Is(err, enginesModel.ErrJTLHeader) {
+			continue
+		}
+		if err != nil {
+			log.Infof("Cannot parse JTL line: %v", err)
+			continue
+		}
+		samples = append(samples, &replaySample{record: record, raw: raw, planID: planID, engineID: engineID})
+	}
+	return samples, scanner.Err()
+}
+
+// loadReplayBatch downloads the segments of a batch and orders their samples by time
+func loadReplayBatch(batch []*model.ResultSegment) ([]*replaySample, error) {
+	samples := []*replaySample{}
+	for _, rs := range batch {
+		content, err := sos.Client.Storage.Download(rs.Filename)
+		if err != nil {
+			return nil, fmt.Errorf("cannot download segment %s: %w", rs.Filename, err)
+		}
+		s, err := parseReplaySegment(content, rs.PlanID, rs.EngineID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read segment %s: %w", rs.Filename, err)
+		}
+		samples = append(samples, s...)
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].record.Timestamp < samples[j].record.Timestamp
+	})
+	return samples, nil
+}
+
+// ReplayRun replays an ended run of the collection. Only the soak runs store their samples. The collection cannot
+// be running, nor replaying another run.
+func (c *Controller) ReplayRun(collection *model.Collection, run *model.RunHistory, rr *ReplayRequest) (*RunReplay, error) {
+	if run.EndTime.IsZero() {
+		return nil, &model.RequestError{Message: "only an ended run can be replayed"}
+	}
+	current, err := collection.GetCurrentRun()
+	if err != nil {
+		return nil, err
+	}
+	if current != 0 {
+		return nil, &model.RequestError{Message: "the collection is running, the replay would be mixed with its samples"}
+	}
+	segments, err := model.GetResultSegments(run.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return nil, &model.RequestError{Message: "the run has no stored samples to replay, only the soak runs store them"}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	replay := &RunReplay{RunID: run.ID, Speed: rr.Speed, Segments: len(segments), StartedTime: time.Now(),
+		cancel: cancel}
+	if _, replaying := c.replayingCollections.LoadOrStore(collection.ID, replay); replaying {
+		cancel()
+		return nil, &model.RequestError{Message: "the collection is replaying another run"}
+	}
+	go func() {
+		defer c.replayingCollections.Delete(collection.ID)
+		defer cancel()
+		c.replay(ctx, collection.ID, replay, replayBatches(segments))
+	}()
+	return replay, nil
+}
+
+// GetReplay returns the replay of the collection in progress, nil when there is none
+func (c *Controller) GetReplay(collectionID int64) *RunReplay {
+	item, ok := c.replayingCollections.Load(collectionID)
+	if !ok {
+		return nil
+	}
+	return item.(*RunReplay)
+}
+
+// StopReplay stops the replay of the collection in progress. It returns false when there is none
+func (c *Controller) StopReplay(collectionID int64) bool {
+	replay := c.GetReplay(collectionID)
+	if replay == nil {
+		return false
+	}
+	replay.cancel()
+	return true
+}
+
+// replay publishes the samples at the pace they were read by the engines, sped up by the speed of the replay. The
+// metrics of the replay are deleted once it's over.
+func (c *Controller) replay(ctx context.Context, collectionID int64, replay *RunReplay,
+	batches [][]*model.ResultSegment) {
+	cid := strconv.FormatInt(collectionID, 10)
+	runLabel := replayRunLabel(replay.RunID)
+	// The number of engines of the plans, for deleting their metrics
+	engines := map[int64]int{}
+	defer func() {
+		for planID, n := range engines {
+			c.deleteMetrics(runLabel, cid, strconv.FormatInt(planID, 10), n)
+		}
+		c.removeLocally(-replay.RunID)
+		log.Printf("Replay of run %d of collection %d is over", replay.RunID, collectionID)
+	}()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var origin int64
+	var start time.Time
+	for _, batch := range batches {
+		samples, err := loadReplayBatch(batch)
+		if err != nil {
+			log.Printf("Error replaying run %d: %v", replay.RunID, err)
+			return
+		}
+		for _, s := range samples {
+			if origin == 0 {
+				origin, start = s.record.Timestamp, time.Now()
+			}
+			offset := time.Duration(float64(s.record.Timestamp-origin) / replay.Speed * float64(time.Millisecond))
+			if wait := time.Until(start.Add(offset)); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+				}
+			} else if ctx.Err() != nil {
+				return
+			}
+			if s.engineID >= engines[s.planID] {
+				engines[s.planID] = s.engineID + 1
+			}
+			c.publishMetric(&setagayaMetric{
+				threads:      s.record.AllThreads,
+				label:        s.record.Label,
+				status:       s.record.ResponseCode,
+				latency:      s.record.Latency,
+				success:      s.record.Success,
+				transaction:  s.record.Transaction,
+				webVital:     s.record.WebVital,
+				raw:          s.raw,
+				collectionID: cid,
+				planID:       strconv.FormatInt(s.planID, 10),
+				engineID:     strconv.Itoa(s.engineID),
+				runID:        runLabel,
+				replay:       true,
+			})
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestReplayRequestValidate(t *testing.T) {
+	assert.NoError(t, (&ReplayRequest{Speed: 1}).Validate())
+	assert.NoError(t, (&ReplayRequest{Speed: 2.5}).Validate())
+	assert.Error(t, (&ReplayRequest{Speed: 0.5}).Validate())
+	assert.Error(t, (&ReplayRequest{Speed: MaxReplaySpeed + 1}).Validate())
+}
+
+func TestReplayBatches(t *testing.T) {
+	segments := []*model.ResultSegment{
+		{PlanID: 1, EngineID: 0, Filename: "a0"},
+		{PlanID: 1, EngineID: 1, Filename: "b0"},
+		{PlanID: 1, EngineID: 0, Filename: "a1"},
+		// The engine joined the run late
+		{PlanID: 2, EngineID: 0, Filename: "c0"},
+		{PlanID: 1, EngineID: 1, Filename: "b1"},
+	}
+	filenames := [][]string{}
+	for _, batch := range replayBatches(segments) {
+		names := []string{}
+		for _, rs := range batch {
+			names = append(names, rs.Filename)
+		}
+		filenames = append(filenames, names)
+	}
+	assert.Equal(t, [][]string{{"a0", "b0", "c0"}, {"a1", "b1"}}, filenames)
+}
+
+func TestParseReplaySegment(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(strings.Join(enginesModel.DefaultJTLColumns, enginesModel.JTLSeparator) + "\n"))
+	gz.Write([]byte("1700000001000|120|login|200|OK|Thread 1-1|true||512|10|10|100|5\n"))
+	gz.Write([]byte("not a sample\n"))
+	gz.Write([]byte("1700000002000|80|home|500|Error|Thread 1-2|false||256|10|10|70|3\n"))
+	gz.Close()
+
+	samples, err := parseReplaySegment(buf.Bytes(), 3, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, samples, 2) {
+		assert.Equal(t, int64(1700000001000), samples[0].record.Timestamp)
+		assert.Equal(t, "login", samples[0].record.Label)
+		assert.Equal(t, "500", samples[1].record.ResponseCode)
+		assert.Equal(t, int64(3), samples[1].planID)
+		assert.Equal(t, 1, samples[1].engineID)
+	}
+
+	_, err = parseReplaySegment([]byte("not gzipped"), 3, 1)
+	assert.Error(t, err)
+}
+
+func TestMetricStoreKey(t *testing.T) {
+	key, err := metricStoreKey("42")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), key)
+	key, err = metricStoreKey(replayRunLabel(42))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-42), key)
+	_, err = metricStoreKey("replay-x")
+	assert.Error(t, err)
+}
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/scheduler"
+)
+
+var ErrCapacityReserved = errors.New("the capacity of the cluster is reserved")
+
+var reservedResources = []apiv1.ResourceName{apiv1.ResourceCPU, apiv1.ResourceMemory}
+
+func addResourceList(total, rl apiv1.ResourceList) {
+	for _, name := range reservedResources {
+		q, ok := rl[name]
+		if !ok {
+			continue
+		}
+		sum := total[name]
+		sum.Add(q)
+		total[name] = sum
+	}
+}
+
+// engineResources is what the engines of the size request
+func engineResources(cpu, mem string, engines int) apiv1.ResourceList {
+	return (&model.Reservation{CPU: cpu, Mem: mem}).Resources(engines)
+}
+
+// checkRoom makes sure the resources requested fit in the allocatable ones, next to the ones already requested and
+// the ones reserved
+func checkRoom(allocatable, requested, reserved, wanted apiv1.ResourceList) error {
+	for _, name := range reservedResources {
+		a, ok := allocatable[name]
+		if !ok {
+			continue
+		}
+		used := requested[name].DeepCopy()
+		used.Add(reserved[name])
+		free := a.DeepCopy()
+		free.Sub(used)
+		w := wanted[name]
+		if w.Cmp(free) > 0 {
+			return fmt.Errorf("%w: %s %s is needed and %s is left out of the reservations", ErrCapacityReserved, w.String(),
+				name, free.String())
+		}
+	}
+	return nil
+}
+
+// unusedReservations sums up the room the other collections reserved and did not fill with their engines yet
+func unusedReservations(reservations []*model.Reservation, collectionID int64,
+	engineCount func(int64) (int, error)) (apiv1.ResourceList, error) {
+	unused := apiv1.ResourceList{}
+	for _, r := range reservations {
+		if r.CollectionID == collectionID {
+			continue
+		}
+		deployed, err := engineCount(r.CollectionID)
+		if err != nil {
+			return nil, err
+		}
+		addResourceList(unused, r.Resources(r.Engines-deployed))
+	}
+	return unused, nil
+}
+
+// checkReservations is the admission check of the deployments. The engines of the collection are not deployed when
+// they would take the room the other collections reserved for now. Only the schedulers knowing the capacity of their
+// cluster enforce the reservations.
+func (c *Controller) checkReservations(ctx context.Context, collection *model.Collection, eps []*model.ExecutionPlan) error {
+	now := time.Now()
+	reservations, err := model.GetOverlappingReservations(now, now)
+	if err != nil {
+		return err
+	}
+	if len(reservations) == 0 {
+		return nil
+	}
+	capacity, err := c.Scheduler.GetClusterCapacity(ctx)
+	if errors.Is(err, scheduler.ErrFeatureUnavailable) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	wanted := apiv1.ResourceList{}
+	for _, ep := range eps {
+		ec, err := NewPlanController(ep, collection, c.Scheduler).engineConfig()
+		if err != nil {
+			return err
+		}
+		addResourceList(wanted, engineResources(ec.CPU, ec.Mem, ep.Engines))
+	}
+	unused, err := unusedReservations(reservations, collection.ID, func(collectionID int64) (int, error) {
+		return c.Scheduler.EngineCount(ctx, collectionID)
+	})
+	if err != nil {
+		return err
+	}
+	return checkRoom(capacity.Allocatable, capacity.Requested, unused, wanted)
+}
+
+// Reserve holds room in the cluster for the engines of the collection during the window of the reservation. The
+// engines of every reservation overlapping the window have to fit in the cluster, even when they do not run at the
+// same time.
+func (c *Controller) Reserve(ctx context.Context, collection *model.Collection, r *model.Reservation) error {
+	r.CollectionID = collection.ID
+	if ec := config.SC.ExecutorConfig.JmeterContainer.ExecutorContainer; ec != nil {
+		if r.CPU == "" {
+			r.CPU = ec.CPU
+		}
+		if r.Mem == "" {
+			r.Mem = ec.Mem
+		}
+	}
+	if err := r.Validate(time.Now()); err != nil {
+		return &model.RequestError{Err: err, Message: err.Error()}
+	}
+	capacity, err := c.Scheduler.GetClusterCapacity(ctx)
+	if err != nil {
+		return err
+	}
+	overlapping, err := model.GetOverlappingReservations(r.StartTime, r.EndTime)
+	if err != nil {
+		return err
+	}
+	reserved := apiv1.ResourceList{}
+	for _, o := range overlapping {
+		addResourceList(reserved, o.Resources(o.Engines))
+	}
+	if err := checkRoom(capacity.Allocatable, nil, reserved, r.Resources(r.Engines)); err != nil {
+		return err
+	}
+	return model.CreateReservation(r)
+}
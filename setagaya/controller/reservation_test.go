@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func resources(cpu, mem string) apiv1.ResourceList {
+	return apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse(cpu), apiv1.ResourceMemory: resource.MustParse(mem)}
+}
+
+func TestCheckRoom(t *testing.T) {
+	allocatable := resources("10", "20Gi")
+	assert.NoError(t, checkRoom(allocatable, resources("4", "8Gi"), resources("4", "8Gi"), resources("2", "4Gi")))
+	assert.NoError(t, checkRoom(allocatable, nil, nil, resources("10", "20Gi")))
+
+	err := checkRoom(allocatable, resources("4", "8Gi"), resources("4", "8Gi"), resources("3", "1Gi"))
+	assert.True(t, errors.Is(err, ErrCapacityReserved))
+	assert.Contains(t, err.Error(), "cpu")
+
+	err = checkRoom(allocatable, nil, resources("1", "18Gi"), resources("1", "4Gi"))
+	assert.True(t, errors.Is(err, ErrCapacityReserved))
+	assert.Contains(t, err.Error(), "memory")
+}
+
+func TestUnusedReservations(t *testing.T) {
+	reservations := []*model.Reservation{
+		{CollectionID: 1, Engines: 4, CPU: "1", Mem: "1Gi"},
+		{CollectionID: 2, Engines: 3, CPU: "2", Mem: "2Gi"},
+		{CollectionID: 3, Engines: 2, CPU: "1", Mem: "1Gi"},
+	}
+	deployed := map[int64]int{2: 1, 3: 5}
+	engineCount := func(collectionID int64) (int, error) {
+		return deployed[collectionID], nil
+	}
+	// The reservation of the collection deploying is its own room, the engines deployed fill the other ones
+	unused, err := unusedReservations(reservations, 1, engineCount)
+	assert.NoError(t, err)
+	cpu, mem := unused[apiv1.ResourceCPU], unused[apiv1.ResourceMemory]
+	assert.Equal(t, 0, cpu.Cmp(resource.MustParse("4")))
+	assert.Equal(t, 0, mem.Cmp(resource.MustParse("4Gi")))
+
+	_, err = unusedReservations(reservations, 1, func(int64) (int, error) {
+		return 0, errors.New("no cluster")
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/utils"
+)
+
+const (
+	retryDeployWait = 15 * time.Minute
+	retryPoll       = 5 * time.Second
+)
+
+type planKey struct {
+	collectionID int64
+	planID       int64
+}
+
+// retryingCollection tells whether a plan of the collection is being deployed and triggered again. The run does
+// not end meanwhile.
+func (c *Controller) retryingCollection(collectionID int64) bool {
+	retrying := false
+	c.retryingPlans.Range(func(k, _ interface{}) bool {
+		retrying = k.(planKey).collectionID == collectionID
+		return !retrying
+	})
+	return retrying
+}
+
+// RetryPlan deploys the engines of a plan of the run in progress again, e.g. after they crashed, and triggers them
+// with what the plan received when the run was triggered. The run keeps its id. It returns once the attempt is
+// recorded, the engines are deployed and triggered in the background.
+func (c *Controller) RetryPlan(ctx context.Context, collection *model.Collection, planID int64, owner string) (*model.PlanRetry, error) {
+	if config.SC.ExecutorConfig.RunsOnce() {
+		return nil, &model.RequestError{Message: "the plans of the engines running once cannot be retried"}
+	}
+	if collection.Continuous != nil {
+		return nil, &model.RequestError{Message: "the plans of a continuous collection start again with the next window"}
+	}
+	runID, err := collection.GetCurrentRun()
+	if err != nil {
+		return nil, err
+	}
+	if runID == 0 {
+		return nil, &model.RequestError{Message: "the collection is not running"}
+	}
+	pendings, err := model.GetPendingPlans(runID)
+	if err != nil {
+		return nil, err
+	}
+	for _, pp := range pendings {
+		if pp.Plan.PlanID == planID {
+			return nil, &model.RequestError{Message: fmt.Sprintf("plan %d did not start yet", planID)}
+		}
+	}
+	ep, edc, err := c.runPlanEngineDataConfig(collection, planID, runID)
+	if err != nil {
+		return nil, err
+	}
+	key := planKey{collectionID: collection.ID, planID: planID}
+	if _, retrying := c.retryingPlans.LoadOrStore(key, struct{}{}); retrying {
+		return nil, &model.RequestError{Message: fmt.Sprintf("plan %d is already being retried", planID)}
+	}
+	pr, err := model.CreatePlanRetry(collection.ID, runID, planID, owner)
+	if err != nil {
+		c.retryingPlans.Delete(key)
+		return nil, err
+	}
+	pc := NewPlanController(ep, collection, c.Scheduler)
+	// The engines which are still connected are stopped, so their results are not mixed with the new ones
+	if err := pc.term(ctx, true, &c.connectedEngines); err != nil {
+		log.Printf("Error terminating plan %d: %v", planID, err)
+	}
+	// The engines are deployed after the request returned
+	go c.runPlanRetry(context.WithoutCancel(ctx), pc, pr, edc)
+	return pr, nil
+}
+
+// runPlanEngineDataConfig returns the plan and what its engines received when the run was triggered
+func (c *Controller) runPlanEngineDataConfig(collection *model.Collection, planID, runID int64) (*model.ExecutionPlan,
+	*enginesModel.EngineDataConfig, error) {
+	var err error
+	collection.ExecutionPlans, err = collection.GetExecutionPlans()
+	if err != nil {
+		return nil, nil, err
+	}
+	i := -1
+	for j, ep := range collection.ExecutionPlans {
+		if ep.PlanID == planID {
+			i = j
+		}
+	}
+	if i < 0 {
+		return nil, nil, &model.DBError{Message: fmt.Sprintf("plan %d is not in the collection", planID)}
+	}
+	if collection.Soak != nil {
+		collection.Soak.ApplyTo(collection.ExecutionPlans)
+	}
+	tr := new(model.TriggerRequest)
+	if manifest, err := model.GetRunManifest(runID); err == nil && manifest.Trigger != nil {
+		tr = manifest.Trigger
+	}
+	planParams, err := collection.ResolveCollectionParameters(tr.Parameters)
+	if err != nil {
+		return nil, nil, err
+	}
+	return collection.ExecutionPlans[i], runEngineDataConfigs(collection, tr, planParams)[i], nil
+}
+
+func (c *Controller) runPlanRetry(ctx context.Context, pc *PlanController, pr *model.PlanRetry,
+	edc *enginesModel.EngineDataConfig) {
+	collection := pc.collection
+	err := c.retryPlan(ctx, pc, pr, edc)
+	c.retryingPlans.Delete(planKey{collectionID: collection.ID, planID: pr.PlanID})
+	kind := model.RunEventPlanRetried
+	message := fmt.Sprintf("plan %d was deployed and triggered again, attempt %d", pr.PlanID, pr.Attempt)
+	pr.Status = model.PlanRetryRunning
+	if err != nil {
+		kind = model.RunEventPlanRetryFailed
+		message = fmt.Sprintf("attempt %d of plan %d failed: %v", pr.Attempt, pr.PlanID, err)
+		pr.Status = model.PlanRetryFailed
+		pr.Message = err.Error()
+	}
+	if err := model.UpdatePlanRetry(pr); err != nil {
+		log.Printf("Error storing retry %d of plan %d: %v", pr.ID, pr.PlanID, err)
+	}
+	if err := model.AddRunEvent(collection.ID, pr.RunID, kind, message); err != nil {
+		log.Printf("Error recording the event of run %d: %v", pr.RunID, err)
+	}
+	log.Printf("Retry %d of plan %d of collection %d is %s", pr.ID, pr.PlanID, collection.ID, pr.Status)
+	if err == nil {
+		return
+	}
+	// The run ends when the plan was the last one it was waiting for
+	if runID, err := collection.GetCurrentRun(); err == nil && runID == pr.RunID {
+		c.endPlan(ctx, collection, pc)
+	}
+}
+
+func (c *Controller) retryPlan(ctx context.Context, pc *PlanController, pr *model.PlanRetry,
+	edc *enginesModel.EngineDataConfig) error {
+	collection := pc.collection
+	if err := c.Scheduler.PurgePlan(ctx, collection.ID, pr.PlanID); err != nil {
+		return err
+	}
+	if err := utils.RetryContext(ctx, func() error {
+		return pc.deploy(ctx)
+	}, nil); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(retryDeployWait)
+	for {
+		cs, err := c.Scheduler.CollectionStatus(ctx, collection.ProjectID, collection.ID, []*model.ExecutionPlan{pc.ep})
+		if err != nil {
+			return err
+		}
+		if len(cs.Plans) > 0 && cs.Plans[0].EnginesReachable {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the engines were not reachable after %s", retryDeployWait)
+		}
+		time.Sleep(retryPoll)
+	}
+	// The run could have been stopped while the engines were deployed
+	runID, err := collection.GetCurrentRun()
+	if err != nil {
+		return err
+	}
+	if runID != pr.RunID {
+		return errors.New("the run ended before the engines were reachable")
+	}
+	if err := pc.trigger(ctx, edc, pr.RunID); err != nil {
+		return err
+	}
+	if err := pc.subscribe(ctx, &c.connectedEngines, c.readingEngines); err != nil {
+		return err
+	}
+	return model.AddRunningPlan(collection.ID, pr.PlanID)
+}
@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryingCollection(t *testing.T) {
+	c := new(Controller)
+	assert.False(t, c.retryingCollection(1))
+	c.retryingPlans.Store(planKey{collectionID: 1, planID: 10}, struct{}{})
+	c.retryingPlans.Store(planKey{collectionID: 2, planID: 20}, struct{}{})
+	assert.True(t, c.retryingCollection(1))
+	assert.True(t, c.retryingCollection(2))
+	assert.False(t, c.retryingCollection(3))
+	c.retryingPlans.Delete(planKey{collectionID: 1, planID: 10})
+	assert.False(t, c.retryingCollection(1))
+}
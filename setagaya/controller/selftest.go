@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+// The self test runs a tiny load test against the echo endpoint of the engine itself, so it does not depend on
+// anything but the platform. It's meant to verify an environment after an upgrade.
+const (
+	selfTestName     = "setagaya-selftest"
+	selfTestFilename = "selftest.jmx"
+	// minutes
+	selfTestDuration = 1
+)
+
+//go:embed selftest.jmx
+var selfTestPlan []byte
+
+type SelfTestCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Message string `json:"message,omitempty"`
+	// seconds
+	Duration float64 `json:"duration"`
+}
+
+// SelfTestReport is the verdict of the self test. The platform is healthy when all the checks passed
+type SelfTestReport struct {
+	Healthy      bool             `json:"healthy"`
+	Checks       []*SelfTestCheck `json:"checks"`
+	StartedTime  time.Time        `json:"started_time"`
+	FinishedTime time.Time        `json:"finished_time"`
+}
+
+func newSelfTestReport() *SelfTestReport {
+	return &SelfTestReport{
+		Healthy:     true,
+		Checks:      []*SelfTestCheck{},
+		StartedTime: time.Now(),
+	}
+}
+
+// check runs the step and records its outcome. A step is skipped once a previous one failed, as it would fail
+// for the same reason. It returns whether the step passed.
+func (r *SelfTestReport) check(name string, step func() error) bool {
+	if !r.Healthy {
+		r.Checks = append(r.Checks, &SelfTestCheck{Name: name, Skipped: true})
+		return false
+	}
+	return r.verify(name, step)
+}
+
+// verify runs the step even when a previous one failed
+func (r *SelfTestReport) verify(name string, step func() error) bool {
+	c := &SelfTestCheck{Name: name}
+	r.Checks = append(r.Checks, c)
+	started := time.Now()
+	err := step()
+	c.Duration = time.Since(started).Seconds()
+	c.Passed = err == nil
+	if err != nil {
+		c.Message = err.Error()
+		r.Healthy = false
+	}
+	log.Printf("Self test check %s passed: %t %s", name, c.Passed, c.Message)
+	return c.Passed
+}
+
+// cleanUp runs even when a previous step failed. It does not change the verdict, what it could not delete is
+// reported in its message.
+func (r *SelfTestReport) cleanUp(name string, steps ...func() error) {
+	c := &SelfTestCheck{Name: name}
+	r.Checks = append(r.Checks, c)
+	started := time.Now()
+	var errs []error
+	for _, step := range steps {
+		if err := step(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	c.Duration = time.Since(started).Seconds()
+	c.Passed = len(errs) == 0
+	if err := errors.Join(errs...); err != nil {
+		c.Message = err.Error()
+	}
+}
+
+func checkStorage() error {
+	filename := fmt.Sprintf("%s/%d", selfTestName, time.Now().UnixNano())
+	probe := []byte(filename)
+	storage := object_storage.Client.Storage
+	if err := storage.Upload(filename, io.NopCloser(bytes.NewReader(probe))); err != nil {
+		return fmt.Errorf("upload: %w", err)
+	}
+	downloaded, err := storage.Download(filename)
+	if err != nil {
+		return fmt.Errorf("download: %w", err)
+	}
+	if !bytes.Equal(downloaded, probe) {
+		return errors.New("the downloaded file differs from the uploaded one")
+	}
+	if err := storage.Delete(filename); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	return nil
+}
+
+// SelfTest verifies the platform end to end: the object storage, the deployment of an engine, the flow of its
+// metrics to the controller and the purge of its resources. Everything it creates is deleted at the end.
+func (c *Controller) SelfTest() *SelfTestReport {
+	// The self test runs from the command line, nothing cancels it
+	ctx := context.Background()
+	report := newSelfTestReport()
+	defer func() {
+		report.FinishedTime = time.Now()
+	}()
+	report.check("storage", checkStorage)
+
+	var project *model.Project
+	var plan *model.Plan
+	var collection *model.Collection
+	report.check("setup", func() error {
+		projectID, err := model.CreateProject(selfTestName, selfTestName, "")
+		if err != nil {
+			return err
+		}
+		if project, err = model.GetProject(projectID); err != nil {
+			return err
+		}
+		planID, err := model.CreatePlan(selfTestName, project.ID)
+		if err != nil {
+			return err
+		}
+		if plan, err = model.GetPlan(planID); err != nil {
+			return err
+		}
+		if err := plan.StoreFile(io.NopCloser(bytes.NewReader(selfTestPlan)), selfTestFilename); err != nil {
+			return err
+		}
+		// The test file is looked up with the plan
+		if plan, err = model.GetPlan(planID); err != nil {
+			return err
+		}
+		collectionID, err := model.CreateCollection(selfTestName, project.ID)
+		if err != nil {
+			return err
+		}
+		if collection, err = model.GetCollection(collectionID); err != nil {
+			return err
+		}
+		return collection.AddExecutionPlan(&model.ExecutionPlan{
+			PlanID:      plan.ID,
+			Engines:     1,
+			Concurrency: singleEngineConcurrency,
+			Duration:    selfTestDuration,
+			EngineType:  model.JmeterEngine,
+		})
+	})
+
+	launched := report.check("launch", func() error {
+		return c.launchSingleEngine(ctx, collection)
+	})
+	report.check("run", func() error {
+		ep, err := model.GetExecutionPlan(collection.ID, plan.ID)
+		if err != nil {
+			return err
+		}
+		st := &model.SmokeTest{CollectionID: collection.ID, PlanID: plan.ID}
+		if err := c.smokeTest(ctx, st, collection, ep, plan, nil); err != nil {
+			return err
+		}
+		if st.Status != model.SmokePassed {
+			return fmt.Errorf("the metrics did not flow: %s", st.Message)
+		}
+		return nil
+	})
+	// The engine is purged whatever happened to the run
+	purged := false
+	if launched {
+		purged = report.verify("purge", func() error {
+			return c.TermAndPurgeCollection(ctx, collection)
+		})
+	} else {
+		report.check("purge", nil)
+	}
+
+	var cleanups []func() error
+	if launched && !purged {
+		cleanups = append(cleanups, func() error { return c.ForcePurgeCollection(ctx, collection) })
+	}
+	if collection != nil {
+		cleanups = append(cleanups, collection.Delete)
+	}
+	if plan != nil {
+		cleanups = append(cleanups, plan.Delete)
+	}
+	if project != nil {
+		cleanups = append(cleanups, project.Delete)
+	}
+	report.cleanUp("cleanup", cleanups...)
+	return report
+}
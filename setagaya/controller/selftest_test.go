@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/testutil"
+)
+
+func TestSelfTestReport(t *testing.T) {
+	r := newSelfTestReport()
+	assert.True(t, r.check("first", func() error { return nil }))
+	assert.False(t, r.check("second", func() error { return errors.New("broken") }))
+	ran := false
+	assert.False(t, r.check("third", func() error {
+		ran = true
+		return nil
+	}))
+	assert.False(t, ran)
+	// Verified steps run even after a failure
+	assert.True(t, r.verify("fourth", func() error { return nil }))
+	r.cleanUp("cleanup", func() error { return nil }, func() error { return errors.New("leftover") })
+
+	assert.False(t, r.Healthy)
+	assert.Len(t, r.Checks, 5)
+	assert.True(t, r.Checks[0].Passed)
+	assert.Equal(t, "broken", r.Checks[1].Message)
+	assert.True(t, r.Checks[2].Skipped)
+	assert.True(t, r.Checks[3].Passed)
+	assert.False(t, r.Checks[4].Passed)
+	assert.Equal(t, "leftover", r.Checks[4].Message)
+
+	// A failed clean up does not make the platform unhealthy
+	r = newSelfTestReport()
+	r.cleanUp("cleanup", func() error { return errors.New("leftover") })
+	assert.True(t, r.Healthy)
+}
+
+func TestSelfTestPlan(t *testing.T) {
+	assert.Contains(t, string(selfTestPlan), "<ThreadGroup")
+	assert.Contains(t, string(selfTestPlan), "<stringProp name=\"HTTPSampler.path\">/echo</stringProp>")
+}
+
+func TestCheckStorage(t *testing.T) {
+	ms, restore := testutil.UseMemoryStorage()
+	defer restore()
+	assert.NoError(t, checkStorage())
+	// The probe is deleted
+	assert.Empty(t, ms.Filenames())
+}
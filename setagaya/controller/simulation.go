@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	SimulationOnTime     = "on_time"
+	SimulationQueued     = "queued"
+	SimulationOverflow   = "overflow"
+	SimulationInfeasible = "infeasible"
+
+	MaxSimulatedCollections = 200
+	MaxSimulationWindow     = 31 * 24 * time.Hour
+)
+
+// SimulatedCluster is the room a hypothetical cluster has for the engines
+type SimulatedCluster struct {
+	Name string `json:"name"`
+	CPU  string `json:"cpu"`
+	Mem  string `json:"mem"`
+}
+
+// SimulatedCollection is a hypothetical collection, its engines run together in a cluster for its duration
+type SimulatedCollection struct {
+	Name    string `json:"name"`
+	Engines int    `json:"engines"`
+	// Resources of every engine, the ones of the jmeter engines by default
+	CPU string `json:"cpu"`
+	Mem string `json:"mem"`
+	// When the collection would be triggered, the start of the window by default
+	StartTime time.Time `json:"start_time"`
+	// Minutes the collection runs
+	Duration int `json:"duration"`
+}
+
+// SimulationRequest describes the collections and the clusters of a capacity plan. Nothing is deployed, the real
+// clusters are not looked at.
+type SimulationRequest struct {
+	StartTime   time.Time              `json:"start_time"`
+	EndTime     time.Time              `json:"end_time"`
+	Clusters    []*SimulatedCluster    `json:"clusters"`
+	Collections []*SimulatedCollection `json:"collections"`
+}
+
+// Validate fills the default sizes of the engines and checks the plan can be simulated
+func (sr *SimulationRequest) Validate() error {
+	if !sr.EndTime.After(sr.StartTime) {
+		return errors.New("end_time should be after start_time")
+	}
+	if sr.EndTime.Sub(sr.StartTime) > MaxSimulationWindow {
+		return fmt.Errorf("the simulation cannot cover more than %s", MaxSimulationWindow)
+	}
+	if len(sr.Clusters) == 0 {
+		return errors.New("at least one cluster is needed")
+	}
+	for _, c := range sr.Clusters {
+		if _, err := resource.ParseQuantity(c.CPU); err != nil {
+			return fmt.Errorf("invalid cpu %q of cluster %s", c.CPU, c.Name)
+		}
+		if _, err := resource.ParseQuantity(c.Mem); err != nil {
+			return fmt.Errorf("invalid mem %q of cluster %s", c.Mem, c.Name)
+		}
+	}
+	if len(sr.Collections) == 0 || len(sr.Collections) > MaxSimulatedCollections {
+		return fmt.Errorf("between 1 and %d collections can be simulated", MaxSimulatedCollections)
+	}
+	ec := config.SC.ExecutorConfig.JmeterContainer.ExecutorContainer
+	for _, c := range sr.Collections {
+		if c.CPU == "" {
+			c.CPU = ec.CPU
+		}
+		if c.Mem == "" {
+			c.Mem = ec.Mem
+		}
+		if c.StartTime.IsZero() {
+			c.StartTime = sr.StartTime
+		}
+		if c.Engines <= 0 || c.Duration <= 0 {
+			return fmt.Errorf("collection %s should have engines and a duration", c.Name)
+		}
+		if _, err := resource.ParseQuantity(c.CPU); err != nil {
+			return fmt.Errorf("invalid cpu %q of collection %s", c.CPU, c.Name)
+		}
+		if _, err := resource.ParseQuantity(c.Mem); err != nil {
+			return fmt.Errorf("invalid mem %q of collection %s", c.Mem, c.Name)
+		}
+		if c.StartTime.Before(sr.StartTime) || !c.StartTime.Before(sr.EndTime) {
+			return fmt.Errorf("collection %s should start within the window", c.Name)
+		}
+	}
+	return nil
+}
+
+// SimulatedRun is when and where a collection of the plan would run. The infeasible collections have more engines
+// than any cluster can hold, they do not run.
+type SimulatedRun struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Cluster   string    `json:"cluster,omitempty"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	// Minutes the collection waited for room after it was triggered
+	Wait int `json:"wait"`
+}
+
+// SimulatedClusterUsage is the most the collections took of the room of a cluster, in percent
+type SimulatedClusterUsage struct {
+	Name    string  `json:"name"`
+	PeakCPU float64 `json:"peak_cpu"`
+	PeakMem float64 `json:"peak_mem"`
+}
+
+// SimulationResult tells whether every collection of the plan would start on time
+type SimulationResult struct {
+	Feasible bool                     `json:"feasible"`
+	MaxWait  int                      `json:"max_wait"`
+	Runs     []*SimulatedRun          `json:"runs"`
+	Clusters []*SimulatedClusterUsage `json:"clusters"`
+}
+
+type simulatedAllocation struct {
+	cluster    int
+	start, end time.Time
+	resources  apiv1.ResourceList
+}
+
+// usedResources sums up the resources the allocations hold in the cluster at the time
+func usedResources(allocations []*simulatedAllocation, cluster int, at time.Time) apiv1.ResourceList {
+	total := apiv1.ResourceList{}
+	for _, a := range allocations {
+		if a.cluster == cluster && !a.start.After(at) && a.end.After(at) {
+			addResourceList(total, a.resources)
+		}
+	}
+	return total
+}
+
+func fits(capacity, used, wanted apiv1.ResourceList) bool {
+	for _, name := range reservedResources {
+		sum := used[name].DeepCopy()
+		sum.Add(wanted[name])
+		if sum.Cmp(capacity[name]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func percentOf(q, total resource.Quantity) float64 {
+	if total.IsZero() {
+		return 0
+	}
+	return 100 * q.AsApproximateFloat64() / total.AsApproximateFloat64()
+}
+
+// Simulate queues the collections in the order they are triggered, first come first served, and runs every one of
+// them in the first cluster with room for all its engines. A collection waits for the earlier ones to end when none
+// has room, the ones after it wait too. The request has to be validated.
+func Simulate(sr *SimulationRequest) *SimulationResult {
+	capacities := make([]apiv1.ResourceList, len(sr.Clusters))
+	for i, c := range sr.Clusters {
+		capacities[i] = engineResources(c.CPU, c.Mem, 1)
+	}
+	collections := make([]*SimulatedCollection, len(sr.Collections))
+	copy(collections, sr.Collections)
+	sort.SliceStable(collections, func(i, j int) bool {
+		return collections[i].StartTime.Before(collections[j].StartTime)
+	})
+	result := &SimulationResult{Feasible: true, Runs: []*SimulatedRun{}, Clusters: []*SimulatedClusterUsage{}}
+	allocations := []*simulatedAllocation{}
+	queueHead := sr.StartTime
+	for _, c := range collections {
+		run := &SimulatedRun{Name: c.Name}
+		result.Runs = append(result.Runs, run)
+		wanted := engineResources(c.CPU, c.Mem, c.Engines)
+		possible := false
+		for _, capacity := range capacities {
+			possible = possible || fits(capacity, nil, wanted)
+		}
+		if !possible {
+			run.Status = SimulationInfeasible
+			result.Feasible = false
+			continue
+		}
+		// The room only grows after the last start, so the first time a cluster has room is the earliest
+		earliest := c.StartTime
+		if queueHead.After(earliest) {
+			earliest = queueHead
+		}
+		candidates := []time.Time{earliest}
+		for _, a := range allocations {
+			if a.end.After(earliest) {
+				candidates = append(candidates, a.end)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].Before(candidates[j])
+		})
+	placement:
+		for _, at := range candidates {
+			for i, capacity := range capacities {
+				if fits(capacity, usedResources(allocations, i, at), wanted) {
+					end := at.Add(time.Duration(c.Duration) * time.Minute)
+					allocations = append(allocations, &simulatedAllocation{cluster: i, start: at, end: end,
+						resources: wanted})
+					run.Cluster = sr.Clusters[i].Name
+					run.StartTime, run.EndTime = at, end
+					break placement
+				}
+			}
+		}
+		queueHead = run.StartTime
+		run.Wait = int(run.StartTime.Sub(c.StartTime).Minutes())
+		result.MaxWait = max(result.MaxWait, run.Wait)
+		switch {
+		case !run.StartTime.Before(sr.EndTime):
+			run.Status = SimulationOverflow
+			result.Feasible = false
+		case run.Wait > 0:
+			run.Status = SimulationQueued
+			result.Feasible = false
+		default:
+			run.Status = SimulationOnTime
+		}
+	}
+	for i, c := range sr.Clusters {
+		usage := &SimulatedClusterUsage{Name: c.Name}
+		for _, a := range allocations {
+			if a.cluster != i {
+				continue
+			}
+			u := usedResources(allocations, i, a.start)
+			usage.PeakCPU = max(usage.PeakCPU, percentOf(u[apiv1.ResourceCPU], capacities[i][apiv1.ResourceCPU]))
+			usage.PeakMem = max(usage.PeakMem, percentOf(u[apiv1.ResourceMemory], capacities[i][apiv1.ResourceMemory]))
+		}
+		result.Clusters = append(result.Clusters, usage)
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+var simulationStart = time.Date(2026, 10, 5, 0, 0, 0, 0, time.UTC)
+
+func simulationRequest(collections ...*SimulatedCollection) *SimulationRequest {
+	return &SimulationRequest{
+		StartTime:   simulationStart,
+		EndTime:     simulationStart.Add(4 * time.Hour),
+		Clusters:    []*SimulatedCluster{{Name: "a", CPU: "10", Mem: "20Gi"}, {Name: "b", CPU: "4", Mem: "8Gi"}},
+		Collections: collections,
+	}
+}
+
+func TestSimulationRequestValidate(t *testing.T) {
+	ec := config.SC.ExecutorConfig
+	defer func() { config.SC.ExecutorConfig = ec }()
+	config.SC.ExecutorConfig = &config.ExecutorConfig{JmeterContainer: &config.JmeterContainer{
+		ExecutorContainer: &config.ExecutorContainer{CPU: "1", Mem: "2Gi"}}}
+
+	sr := simulationRequest(&SimulatedCollection{Name: "checkout", Engines: 2, Duration: 30})
+	assert.NoError(t, sr.Validate())
+	assert.Equal(t, "1", sr.Collections[0].CPU)
+	assert.Equal(t, "2Gi", sr.Collections[0].Mem)
+	assert.Equal(t, simulationStart, sr.Collections[0].StartTime)
+
+	sr = simulationRequest(&SimulatedCollection{Name: "checkout", Engines: 2, Duration: 30})
+	sr.EndTime = sr.StartTime
+	assert.Error(t, sr.Validate())
+
+	sr = simulationRequest(&SimulatedCollection{Name: "checkout", Engines: 2, Duration: 30})
+	sr.Clusters = nil
+	assert.Error(t, sr.Validate())
+
+	assert.Error(t, simulationRequest().Validate())
+	assert.Error(t, simulationRequest(&SimulatedCollection{Name: "checkout", Duration: 30}).Validate())
+	assert.Error(t, simulationRequest(&SimulatedCollection{Name: "checkout", Engines: 2, Duration: 30,
+		CPU: "many"}).Validate())
+	assert.Error(t, simulationRequest(&SimulatedCollection{Name: "checkout", Engines: 2, Duration: 30,
+		StartTime: simulationStart.Add(5 * time.Hour)}).Validate())
+}
+
+func TestSimulate(t *testing.T) {
+	sr := simulationRequest(
+		&SimulatedCollection{Name: "first", Engines: 8, CPU: "1", Mem: "1Gi", StartTime: simulationStart, Duration: 60},
+		// Does not fit next to the first one in a, fits in b
+		&SimulatedCollection{Name: "second", Engines: 4, CPU: "1", Mem: "1Gi", StartTime: simulationStart, Duration: 60},
+		// No room left anywhere until the first one ends
+		&SimulatedCollection{Name: "third", Engines: 6, CPU: "1", Mem: "1Gi",
+			StartTime: simulationStart.Add(30 * time.Minute), Duration: 60},
+		&SimulatedCollection{Name: "huge", Engines: 20, CPU: "1", Mem: "1Gi", StartTime: simulationStart, Duration: 60},
+		// Triggered after the third, it waits for it even though it would fit in b
+		&SimulatedCollection{Name: "last", Engines: 1, CPU: "1", Mem: "1Gi",
+			StartTime: simulationStart.Add(45 * time.Minute), Duration: 180},
+	)
+	result := Simulate(sr)
+	assert.False(t, result.Feasible)
+	runs := map[string]*SimulatedRun{}
+	for _, r := range result.Runs {
+		runs[r.Name] = r
+	}
+	assert.Equal(t, SimulationOnTime, runs["first"].Status)
+	assert.Equal(t, "a", runs["first"].Cluster)
+	assert.Equal(t, SimulationOnTime, runs["second"].Status)
+	assert.Equal(t, "b", runs["second"].Cluster)
+	assert.Equal(t, SimulationQueued, runs["third"].Status)
+	assert.Equal(t, "a", runs["third"].Cluster)
+	assert.Equal(t, simulationStart.Add(time.Hour), runs["third"].StartTime)
+	assert.Equal(t, 30, runs["third"].Wait)
+	assert.Equal(t, SimulationInfeasible, runs["huge"].Status)
+	assert.Empty(t, runs["huge"].Cluster)
+	assert.Equal(t, SimulationQueued, runs["last"].Status)
+	assert.Equal(t, simulationStart.Add(time.Hour), runs["last"].StartTime)
+	assert.Equal(t, 30, result.MaxWait)
+
+	assert.Len(t, result.Clusters, 2)
+	assert.InDelta(t, 80, result.Clusters[0].PeakCPU, 0.01)
+	assert.InDelta(t, 100, result.Clusters[1].PeakCPU, 0.01)
+	assert.InDelta(t, 50, result.Clusters[1].PeakMem, 0.01)
+}
+
+func TestSimulateOverflow(t *testing.T) {
+	sr := simulationRequest(
+		&SimulatedCollection{Name: "long", Engines: 10, CPU: "1", Mem: "1Gi", StartTime: simulationStart, Duration: 300},
+		&SimulatedCollection{Name: "late", Engines: 5, CPU: "1", Mem: "1Gi", StartTime: simulationStart, Duration: 60},
+	)
+	sr.Clusters = sr.Clusters[:1]
+	result := Simulate(sr)
+	assert.False(t, result.Feasible)
+	assert.Equal(t, SimulationOverflow, result.Runs[1].Status)
+	assert.Equal(t, 300, result.Runs[1].Wait)
+
+	sr = simulationRequest(&SimulatedCollection{Name: "alone", Engines: 2, CPU: "1", Mem: "1Gi",
+		StartTime: simulationStart, Duration: 60})
+	result = Simulate(sr)
+	assert.True(t, result.Feasible)
+	assert.Equal(t, 0, result.MaxWait)
+}
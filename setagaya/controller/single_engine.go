@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/utils"
+)
+
+// Smoke tests and debug sessions deploy a single engine for one plan of the collection
+// outside of the run lifecycle
+const singleEngineConcurrency = 1
+
+var errCollectionBusy = errors.New("the collection is deployed or running. Purge it first")
+
+// makeSingleEngineExecutionPlan scales the plan down to one engine running a single thread
+func makeSingleEngineExecutionPlan(ep *model.ExecutionPlan, duration int) *model.ExecutionPlan {
+	return &model.ExecutionPlan{
+		Name:        ep.Name,
+		PlanID:      ep.PlanID,
+		Concurrency: singleEngineConcurrency,
+		Rampup:      0,
+		Engines:     1,
+		Duration:    duration,
+		EngineType:  ep.EngineType,
+		// The engine stays under the cap of the plan, in case the plan relies on it
+		MaxEngineRPS: ep.MaxEngineRPS,
+	}
+}
+
+// launchSingleEngine reserves the collection for a single engine deployment.
+// The launch entry also prevents the collection from being deployed while the engine is in use
+func (c *Controller) launchSingleEngine(ctx context.Context, collection *model.Collection) error {
+	deployed, err := c.Scheduler.GetDeployedCollections(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := deployed[collection.ID]; ok {
+		return &model.RequestError{Err: errCollectionBusy, Message: errCollectionBusy.Error()}
+	}
+	sid := ""
+	if project, projectErr := model.GetProject(collection.ProjectID); projectErr == nil {
+		sid = project.SID
+	}
+	if err := collection.NewLaunchEntry(sid, config.SC.Context, 1, 0, singleEngineConcurrency); err != nil {
+		return err
+	}
+	return utils.RetryContext(ctx, func() error {
+		return c.Scheduler.ExposeProject(ctx, collection.ProjectID)
+	}, nil)
+}
+
+// makeSingleEngineConfig prepares the engine data of the only engine of a single engine execution plan
+func makeSingleEngineConfig(collection *model.Collection, pc *PlanController, plan *model.Plan,
+	params map[string]string) *enginesModel.EngineDataConfig {
+	edc := prepareCollection(&model.Collection{
+		ExecutionPlans: []*model.ExecutionPlan{pc.ep},
+		Data:           collection.Data,
+		CSVSplit:       collection.CSVSplit,
+	})[0]
+	edc.Parameters = params
+	// Single engine executions are not runs, so we use 0 as the run id
+	return pc.prepare(plan, edc, 0)[0]
+}
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestMakeSingleEngineExecutionPlan(t *testing.T) {
+	ep := &model.ExecutionPlan{
+		Name:         "checkout",
+		PlanID:       3,
+		Concurrency:  500,
+		Rampup:       60,
+		Engines:      10,
+		Duration:     30,
+		CSVSplit:     true,
+		TargetRPS:    200,
+		EngineType:   model.PlaywrightEngine,
+		MaxEngineRPS: 50,
+	}
+	smoke := makeSingleEngineExecutionPlan(ep, smokeDuration)
+	assert.Equal(t, int64(3), smoke.PlanID)
+	assert.Equal(t, 1, smoke.Engines)
+	assert.Equal(t, singleEngineConcurrency, smoke.Concurrency)
+	assert.Equal(t, smokeDuration, smoke.Duration)
+	assert.Equal(t, 0, smoke.Rampup)
+	assert.Equal(t, 0, smoke.TargetRPS)
+	assert.Equal(t, 50, smoke.MaxEngineRPS)
+	assert.False(t, smoke.CSVSplit)
+	assert.Equal(t, model.PlaywrightEngine, smoke.EngineType)
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/utils"
+)
+
+// Smoke tests run the plan with one engine and a tiny workload so a new test plan can be validated
+// quickly before a full multi engine run. The engine is purged when the smoke test is finished.
+const (
+	// minutes
+	smokeDuration     = 1
+	smokeDeployWait   = 5 * time.Minute
+	smokeProgressPoll = 5 * time.Second
+)
+
+// SmokeTestPlan deploys a single engine for the plan and runs it with a tiny workload.
+// It returns once the deployment is started. The progress can be followed with model.GetSmokeTest.
+func (c *Controller) SmokeTestPlan(ctx context.Context, collection *model.Collection, planID int64, runParams map[string]string) error {
+	ep, err := model.GetExecutionPlan(collection.ID, planID)
+	if err != nil {
+		return &model.DBError{Err: err, Message: "plan is not part of the collection"}
+	}
+	plan, err := model.GetPlan(planID)
+	if err != nil {
+		return err
+	}
+	if plan.TestFile == nil {
+		return &model.RequestError{Message: fmt.Sprintf("there is no test file in plan %d", plan.ID)}
+	}
+	if err := addFragments(plan); err != nil {
+		return err
+	}
+	params, err := model.ResolveParameters(plan.Parameters, runParams)
+	if err != nil {
+		return &model.ParameterError{Message: err.Error()}
+	}
+	if err := c.launchSingleEngine(ctx, collection); err != nil {
+		return err
+	}
+	if err := model.StartSmokeTest(collection.ID, planID); err != nil {
+		return err
+	}
+	// The smoke test runs after the request returned
+	go c.runSmokeTest(context.WithoutCancel(ctx), collection, makeSingleEngineExecutionPlan(ep, smokeDuration), plan, params)
+	return nil
+}
+
+func (c *Controller) runSmokeTest(ctx context.Context, collection *model.Collection, ep *model.ExecutionPlan, plan *model.Plan, params map[string]string) {
+	st := &model.SmokeTest{
+		CollectionID: collection.ID,
+		PlanID:       ep.PlanID,
+		Status:       model.SmokeFailed,
+	}
+	defer func() {
+		if err := model.UpdateSmokeTest(st); err != nil {
+			log.Printf("Error storing smoke test of plan %d: %v", ep.PlanID, err)
+		}
+		if err := c.TermAndPurgeCollection(ctx, collection); err != nil {
+			log.Printf("Error purging smoke test of collection %d: %v", collection.ID, err)
+		}
+	}()
+	if err := c.smokeTest(ctx, st, collection, ep, plan, params); err != nil {
+		st.Status = model.SmokeFailed
+		st.Message = err.Error()
+	}
+	if len(st.Message) > 1024 {
+		st.Message = st.Message[:1024]
+	}
+	log.Printf("Smoke test of plan %d in collection %d is %s", ep.PlanID, collection.ID, st.Status)
+}
+
+func (c *Controller) smokeTest(ctx context.Context, st *model.SmokeTest, collection *model.Collection, ep *model.ExecutionPlan, plan *model.Plan, params map[string]string) error {
+	pc := NewPlanController(ep, collection, c.Scheduler)
+	if err := utils.RetryContext(ctx, func() error {
+		return pc.deploy(ctx)
+	}, nil); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(smokeDeployWait)
+	for c.Scheduler.PodReadyCount(ctx, collection.ID) < 1 {
+		if time.Now().After(deadline) {
+			return errors.New("the engine was not ready in time")
+		}
+		time.Sleep(smokeProgressPoll)
+	}
+	engines, err := generateEnginesWithUrl(ctx, 1, ep.PlanID, collection.ID, collection.ProjectID, findEngineType(ep), c.Scheduler)
+	if err != nil {
+		return err
+	}
+	engine := engines[0]
+
+	if err := engine.trigger(ctx, makeSingleEngineConfig(collection, pc, plan, params)); err != nil {
+		return err
+	}
+	st.Status = model.SmokeRunning
+	if err := model.UpdateSmokeTest(st); err != nil {
+		log.Printf("Error storing smoke test of plan %d: %v", ep.PlanID, err)
+	}
+	if err := engine.subscribe(0); err != nil {
+		return err
+	}
+	failedLabels := map[string]bool{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range engine.readMetrics() {
+			st.Samples++
+			if !strings.HasPrefix(metric.status, "2") && !strings.HasPrefix(metric.status, "3") {
+				st.Failures++
+				failedLabels[metric.label] = true
+			}
+		}
+	}()
+
+	deadline = time.Now().Add(smokeDuration*time.Minute + smokeDeployWait)
+	for engine.progress() {
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(smokeProgressPoll)
+	}
+	if h, err := engine.histogram(); err == nil {
+		st.P95 = h.Percentile(95)
+	}
+	if err := engine.terminate(ctx, false); err != nil {
+		log.Printf("Error terminating smoke test engine of plan %d: %v", ep.PlanID, err)
+		engine.closeStream()
+	}
+	<-done
+
+	switch {
+	case st.Samples == 0:
+		st.Status = model.SmokeFailed
+		st.Message = "the plan did not produce any samples"
+	case st.Failures > 0:
+		labels := make([]string, 0, len(failedLabels))
+		for l := range failedLabels {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		st.Status = model.SmokeFailed
+		st.Message = fmt.Sprintf("%d of %d samples failed. Failed labels: %s", st.Failures, st.Samples, strings.Join(labels, ", "))
+	default:
+		st.Status = model.SmokePassed
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+const (
+	// The memory trend of an engine is only trusted once it was sampled for that long, and that many times
+	memoryTrendSpan    = time.Hour
+	memoryTrendSamples = 10
+	// The memory of an engine is sampled at most that often
+	memorySampleInterval = time.Minute
+)
+
+// The events of the memory leaks start with the engine, e.g. "plan 3 engine 0 grows by 80 MB per hour"
+const memoryLeakSeparator = " grows by "
+
+type memorySample struct {
+	time time.Time
+	// Bytes
+	memory float64
+}
+
+// soakWatch is what the controller keeps about a soak run in progress. It's rebuilt from the checkpoints and the
+// events of the run when the controller restarts, only the memory samples are lost.
+type soakWatch struct {
+	lastCheckpoint time.Time
+	lastSample     time.Time
+	// By engine, the key of the engine
+	samples map[string][]memorySample
+	leaking map[string]bool
+}
+
+// memoryTrend is the growth of the memory, in MB per hour, by least squares. ok is false when the samples do not
+// span enough time to tell.
+func memoryTrend(samples []memorySample) (slope float64, ok bool) {
+	if len(samples) < memoryTrendSamples || samples[len(samples)-1].time.Sub(samples[0].time) < memoryTrendSpan {
+		return 0, false
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.time.Sub(samples[0].time).Hours()
+		y := s.memory / (1024 * 1024)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	d := n*sumXX - sumX*sumX
+	if d == 0 {
+		return 0, false
+	}
+	return (n*sumXY - sumX*sumY) / d, true
+}
+
+// startSoakRun records the end time of the run when the collection is a soak one
+func startSoakRun(collection *model.Collection, runID int64) {
+	if collection.Soak == nil {
+		return
+	}
+	if _, err := model.StartRunSoak(collection.ID, runID, time.Now(), collection.Soak); err != nil {
+		log.Printf("Error starting soak run %d: %v", runID, err)
+	}
+}
+
+// checkSoakRun ends the soak run of the collection when its end time is reached. Until then it takes a
+// checkpoint at every interval and watches the memory of the engines. It's called for the plans still in progress.
+func (c *Controller) checkSoakRun(collection *model.Collection) {
+	if _, checking := c.checkingSoaks.LoadOrStore(collection.ID, struct{}{}); checking {
+		return
+	}
+	go func() {
+		defer c.checkingSoaks.Delete(collection.ID)
+		runID, err := collection.GetCurrentRun()
+		if err != nil || runID == 0 {
+			return
+		}
+		rs, err := model.GetRunSoak(runID)
+		if err != nil {
+			// The collection became a soak one during the run
+			return
+		}
+		if !time.Now().Before(rs.EndTime) {
+			log.Printf("Soak run %d of collection %d reached its end time", runID, collection.ID)
+			if err := c.TermCollection(context.Background(), collection, false); err != nil {
+				log.Printf("Error ending soak run %d: %v", runID, err)
+			}
+			c.soakWatches.Delete(runID)
+			return
+		}
+		w := c.loadSoakWatch(rs)
+		eps, err := collection.GetExecutionPlans()
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		if now.Sub(w.lastSample) >= memorySampleInterval {
+			w.lastSample = now
+			c.sampleSoakMemory(collection, eps, runID, w, now)
+		}
+		if now.Sub(w.lastCheckpoint) >= time.Duration(collection.Soak.CheckpointInterval)*time.Minute {
+			w.lastCheckpoint = now
+			if err := c.storeCheckpoint(collection, eps, runID, now); err != nil {
+				log.Printf("Error storing a checkpoint of soak run %d: %v", runID, err)
+			}
+		}
+	}()
+}
+
+func (c *Controller) loadSoakWatch(rs *model.RunSoak) *soakWatch {
+	if item, ok := c.soakWatches.Load(rs.RunID); ok {
+		return item.(*soakWatch)
+	}
+	w := &soakWatch{
+		lastCheckpoint: rs.StartedTime,
+		samples:        map[string][]memorySample{},
+		leaking:        map[string]bool{},
+	}
+	if checkpoints, err := model.GetRunCheckpoints(rs.RunID); err == nil && len(checkpoints) > 0 {
+		w.lastCheckpoint = checkpoints[len(checkpoints)-1].Time
+	}
+	if events, err := model.GetRunEvents(rs.RunID); err == nil {
+		for _, e := range events {
+			if e.Kind == model.RunEventMemoryLeak {
+				key, _, _ := strings.Cut(e.Message, memoryLeakSeparator)
+				w.leaking[key] = true
+			}
+		}
+	}
+	item, _ := c.soakWatches.LoadOrStore(rs.RunID, w)
+	return item.(*soakWatch)
+}
+
+// sampleSoakMemory records the memory of the engines and reports the ones growing faster than the threshold of
+// the collection, once per engine
+func (c *Controller) sampleSoakMemory(collection *model.Collection, eps []*model.ExecutionPlan, runID int64,
+	w *soakWatch, now time.Time) {
+	for _, ep := range eps {
+		podsMetrics, err := c.Scheduler.GetPodsMetrics(context.Background(), collection.ID, ep.PlanID)
+		if err != nil {
+			log.Printf("Error sampling the memory of the engines of soak run %d: %v", runID, err)
+			return
+		}
+		for engineNumber, metrics := range podsMetrics {
+			memory, ok := metrics["memory"]
+			if !ok {
+				continue
+			}
+			key := fmt.Sprintf("plan %d engine %s", ep.PlanID, engineNumber)
+			w.samples[key] = append(w.samples[key], memorySample{time: now, memory: float64(memory.Value())})
+			if w.leaking[key] {
+				continue
+			}
+			slope, ok := memoryTrend(w.samples[key])
+			if !ok || slope < collection.Soak.MemoryLeakThreshold {
+				continue
+			}
+			w.leaking[key] = true
+			message := fmt.Sprintf("%s%s%.0f MB per hour", key, memoryLeakSeparator, slope)
+			log.Printf("The memory of soak run %d leaks: %s", runID, message)
+			if err := model.AddRunEvent(collection.ID, runID, model.RunEventMemoryLeak, message); err != nil {
+				log.Printf("Error recording the memory leak of soak run %d: %v", runID, err)
+			}
+		}
+	}
+}
+
+// storeCheckpoint saves the aggregates of the soak run so far, and has the engines upload the samples they read
+// since the previous checkpoint
+func (c *Controller) storeCheckpoint(collection *model.Collection, eps []*model.ExecutionPlan, runID int64,
+	now time.Time) error {
+	h := c.collectRunHistogram(collection, eps)
+	if h.Total > 0 {
+		rs, err := makeRunSummary(runID, collection.ID, h, c.collectRunAssertions(collection, eps),
+			c.collectRunTransactions(collection, eps))
+		if err != nil {
+			return err
+		}
+		if err := model.StoreRunCheckpoint(&model.RunCheckpoint{Time: now, Summary: rs}); err != nil {
+			return err
+		}
+	}
+	return c.storeResultSegments(collection, eps, runID)
+}
+
+// storeResultSegments has every engine of the soak run upload the samples it read since its previous segment
+func (c *Controller) storeResultSegments(collection *model.Collection, eps []*model.ExecutionPlan, runID int64) error {
+	stored, err := model.GetResultSegments(runID)
+	if err != nil {
+		return err
+	}
+	seqs := map[string]int{}
+	for _, rs := range stored {
+		seqs[makePlanEngineKey(collection.ID, rs.PlanID, rs.EngineID)]++
+	}
+	teams := planTeams(eps)
+	var mu sync.Mutex
+	c.forEachConnectedEngine(collection, eps, func(engine setagayaEngine, planID int64, key string) {
+		mu.Lock()
+		seq := seqs[key]
+		mu.Unlock()
+		filename := model.MakeResultSegmentFilename(runID, planID, engine.EngineID(), seq)
+		region, err := sos.Region(sos.Client.Storage, filename)
+		if err != nil {
+			log.Printf("Error finding the region of the result segment of engine %s: %v", key, err)
+			return
+		}
+		rs, err := engine.resultSegment(&enginesModel.ResultSegmentRequest{
+			Filename:  filename,
+			UploadURL: sos.SignedUploadUrl(sos.Client.Storage, filename),
+			Region:    region,
+		})
+		if err != nil {
+			log.Printf("Error collecting the result segment of engine %s: %v", key, err)
+			return
+		}
+		if rs.Samples == 0 {
+			return
+		}
+		rs.Team = teams[planID]
+		if err := model.StoreResultSegment(collection.ID, runID, rs); err != nil {
+			log.Printf("Error storing the result segment of engine %s: %v", key, err)
+		}
+	})
+	return nil
+}
+
+// storeLastResultSegments uploads the samples read since the last checkpoint when a soak run ends
+func (c *Controller) storeLastResultSegments(collection *model.Collection, eps []*model.ExecutionPlan, runID int64) {
+	if _, err := model.GetRunSoak(runID); err != nil {
+		return
+	}
+	c.soakWatches.Delete(runID)
+	if err := c.storeResultSegments(collection, eps, runID); err != nil {
+		log.Printf("Error storing the last result segments of soak run %d: %v", runID, err)
+	}
+}
+
+// lastCheckpointSummary is the summary of the last checkpoint of a soak run, for when its engines cannot be
+// reached anymore when it ends. nil when there is none.
+func lastCheckpointSummary(runID int64) *model.RunSummary {
+	checkpoints, err := model.GetRunCheckpoints(runID)
+	if err != nil || len(checkpoints) == 0 {
+		return nil
+	}
+	return checkpoints[len(checkpoints)-1].Summary
+}
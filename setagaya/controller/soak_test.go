@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeMemorySamples(start time.Time, n int, interval time.Duration, mb func(i int) float64) []memorySample {
+	samples := make([]memorySample, n)
+	for i := range samples {
+		samples[i] = memorySample{time: start.Add(time.Duration(i) * interval), memory: mb(i) * 1024 * 1024}
+	}
+	return samples
+}
+
+func TestMemoryTrend(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// 10 MB every 10 minutes is 60 MB per hour
+	growing := makeMemorySamples(start, 13, 10*time.Minute, func(i int) float64 { return 500 + 10*float64(i) })
+	slope, ok := memoryTrend(growing)
+	assert.True(t, ok)
+	assert.InDelta(t, 60, slope, 0.001)
+
+	// The garbage collections make the memory go up and down around a flat line
+	flat := makeMemorySamples(start, 13, 10*time.Minute, func(i int) float64 { return 500 + 50*float64(i%2) })
+	slope, ok = memoryTrend(flat)
+	assert.True(t, ok)
+	assert.Less(t, slope, 10.0)
+
+	// Less than an hour of samples
+	_, ok = memoryTrend(makeMemorySamples(start, 30, time.Minute, func(i int) float64 { return float64(i) }))
+	assert.False(t, ok)
+	_, ok = memoryTrend(growing[:5])
+	assert.False(t, ok)
+}
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+const storageCheckInterval = time.Minute
+
+// CheckStorage probes the object storage. The files written to one storage only while the other one was down are
+// copied to it, so it has to run in the process serving the api, which writes the files.
+func (c *Controller) CheckStorage() {
+	log.Info("Start the loop for checking the object storage")
+	for {
+		report := sos.CheckHealth(sos.Client.Storage)
+		for _, h := range report.Storages {
+			if !h.Healthy {
+				log.Printf("The %s object storage is unhealthy: %s", h.Name, h.LastError)
+			}
+		}
+		if len(report.OutOfSync) > 0 {
+			log.Printf("%d files are out of sync in the object storages", len(report.OutOfSync))
+		}
+		time.Sleep(storageCheckInterval)
+	}
+}
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+const storageReapInterval = time.Hour
+
+// StorageOrphan is a file of the object storage no row of the database references
+type StorageOrphan struct {
+	sos.ObjectInfo
+	// The file was last written before the grace period, it's deleted when the cleanup deletes the orphans
+	PastGracePeriod bool `json:"past_grace_period"`
+	Deleted         bool `json:"deleted"`
+}
+
+// StorageOrphanReport is what the reconciler found in the object storage
+type StorageOrphanReport struct {
+	DryRun           bool             `json:"dry_run"`
+	GracePeriodHours int              `json:"grace_period_hours"`
+	Orphans          []*StorageOrphan `json:"orphans"`
+	// Orphans past the grace period which could not be deleted
+	Failed []*StorageOrphan `json:"failed"`
+}
+
+// findStorageOrphans compares the files of the storage with the files the database references. A referenced file
+// is an orphan too when it's kept in another region than the one of its tenant, e.g. a copy left behind when the
+// tenant moved. regionOf returns false when the region of the file cannot be told, the file is not an orphan then.
+// The files without a time are never past the grace period.
+func findStorageOrphans(objects []*sos.ObjectInfo, references map[string]bool,
+	regionOf func(filename string) (string, bool), now time.Time, grace time.Duration) []*StorageOrphan {
+	orphans := []*StorageOrphan{}
+	for _, o := range objects {
+		if references[o.Name] {
+			region, ok := regionOf(o.Name)
+			if !ok || region == o.Region {
+				continue
+			}
+		}
+		orphans = append(orphans, &StorageOrphan{
+			ObjectInfo:      *o,
+			PastGracePeriod: !o.Updated.IsZero() && now.Sub(o.Updated) >= grace,
+		})
+	}
+	return orphans
+}
+
+// ReconcileStorageOrphans reports the files of the plans, collections, projects and runs no row of the database
+// references any more, typically the files of the deleted plans which failed to be deleted. The orphans past the
+// grace period are deleted when the cleanup is set to delete them. In dry run nothing is deleted.
+func (c *Controller) ReconcileStorageOrphans(dryRun bool) (*StorageOrphanReport, error) {
+	cleanup := config.SC.ObjectStorage.OrphanCleanup.WithDefaults()
+	grace := time.Duration(cleanup.GracePeriodHours) * time.Hour
+	// The files are listed before the references are read, so a file written in between is still referenced
+	objects := []*sos.ObjectInfo{}
+	for _, prefix := range model.StoragePrefixes {
+		o, err := sos.List(sos.Client.Storage, prefix)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, o...)
+	}
+	references, err := model.GetStorageReferences()
+	if err != nil {
+		return nil, err
+	}
+	regionOf := func(filename string) (string, bool) {
+		region, err := sos.Region(sos.Client.Storage, filename)
+		return region, err == nil
+	}
+	report := &StorageOrphanReport{
+		DryRun:           dryRun,
+		GracePeriodHours: cleanup.GracePeriodHours,
+		Orphans:          findStorageOrphans(objects, references, regionOf, time.Now(), grace),
+		Failed:           []*StorageOrphan{},
+	}
+	if dryRun || !cleanup.Delete {
+		return report, nil
+	}
+	for _, o := range report.Orphans {
+		if !o.PastGracePeriod {
+			continue
+		}
+		storage, err := sos.ForRegion(sos.Client.Storage, o.Region)
+		if err == nil {
+			err = storage.Delete(o.Name)
+		}
+		if err != nil && !errors.Is(err, sos.FileNotFoundError()) {
+			log.Printf("Error deleting the orphaned file %s of region %q: %v", o.Name, o.Region, err)
+			report.Failed = append(report.Failed, o)
+			continue
+		}
+		o.Deleted = true
+	}
+	return report, nil
+}
+
+// ReapStorageOrphans runs the storage reconciler periodically
+func (c *Controller) ReapStorageOrphans() {
+	log.Info("Start the loop for reaping the orphaned files of the object storage")
+	for {
+		report, err := c.ReconcileStorageOrphans(false)
+		if errors.Is(err, sos.ErrListUnsupported) {
+			log.Printf("Stop looking for orphaned files: %v", err)
+			return
+		}
+		if err != nil {
+			log.Error(err)
+		} else if len(report.Orphans) > 0 {
+			deleted := 0
+			for _, o := range report.Orphans {
+				if o.Deleted {
+					deleted++
+				}
+			}
+			log.Printf("%d orphaned files in the object storage, %d deleted, %d failed to be deleted",
+				len(report.Orphans), deleted, len(report.Failed))
+		}
+		time.Sleep(storageReapInterval)
+	}
+}
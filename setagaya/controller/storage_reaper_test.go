@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+func TestFindStorageOrphans(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-100 * time.Hour)
+	objects := []*sos.ObjectInfo{
+		{Name: "plan/1/test.jmx", Updated: old},
+		// The plan was deleted, the file failed to be deleted
+		{Name: "plan/2/test.jmx", Updated: old},
+		// Uploaded by an engine, not recorded yet
+		{Name: "run/7/failures-1-0.json", Updated: now.Add(-time.Minute)},
+		// Left behind when the tenant moved to eu
+		{Name: "project/3/users.csv", Updated: old},
+		{Name: "project/3/users.csv", Region: "eu", Updated: old},
+		{Name: "collection/4/users.csv"},
+	}
+	references := map[string]bool{"plan/1/test.jmx": true, "project/3/users.csv": true}
+	regionOf := func(filename string) (string, bool) {
+		if filename == "project/3/users.csv" {
+			return "eu", true
+		}
+		return "", true
+	}
+	orphans := findStorageOrphans(objects, references, regionOf, now, 72*time.Hour)
+	names := []string{}
+	for _, o := range orphans {
+		names = append(names, o.Name+"@"+o.Region)
+	}
+	assert.Equal(t, []string{"plan/2/test.jmx@", "run/7/failures-1-0.json@", "project/3/users.csv@",
+		"collection/4/users.csv@"}, names)
+	assert.True(t, orphans[0].PastGracePeriod)
+	assert.False(t, orphans[1].PastGracePeriod)
+	assert.True(t, orphans[2].PastGracePeriod)
+	// Its time is unknown
+	assert.False(t, orphans[3].PastGracePeriod)
+
+	// The copies of the files are kept when their region cannot be told
+	orphans = findStorageOrphans(objects[3:5], references, func(string) (string, bool) { return "", false }, now,
+		72*time.Hour)
+	assert.Empty(t, orphans)
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+// streamTracker follows the sequence numbers of the events streamed by an engine. When the stream is lost,
+// the stream client reconnects by itself with the id of the last event it received and the engine replays
+// the events it still has. Samples the engine cannot replay show up as a jump in the numbers.
+type streamTracker struct {
+	mu   sync.Mutex
+	last enginesModel.StreamEventID
+	// When the stream was lost. Zero while it's connected
+	disconnected time.Time
+	gaps         []*enginesModel.ResultGap
+}
+
+func newStreamTracker() *streamTracker {
+	return new(streamTracker)
+}
+
+// disconnect records that the stream is lost. The stream keeps reconnecting until it's closed
+func (st *streamTracker) disconnect(now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.disconnected.IsZero() {
+		st.disconnected = now
+	}
+}
+
+// observe checks the id of a received event against the last one. It returns false for the events
+// received already, so they are not counted twice.
+func (st *streamTracker) observe(id enginesModel.StreamEventID, now time.Time) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	disconnected := st.disconnected
+	st.disconnected = time.Time{}
+	switch {
+	case st.last.Seq == 0 || id.Epoch != st.last.Epoch:
+		// The first event, or the engine started a new numbering for a new run or after a restart.
+		// The engine reports the samples it lost with a restart itself
+	case !id.Follows(st.last):
+		return false
+	case id.Seq > st.last.Seq+1:
+		lost := id.Seq - st.last.Seq - 1
+		start := disconnected
+		if start.IsZero() {
+			start = now
+		}
+		st.gaps = append(st.gaps, &enginesModel.ResultGap{
+			Start:   start,
+			End:     now,
+			Reason:  enginesModel.GapReasonStreamInterrupted,
+			Samples: lost,
+		})
+		log.Printf("Stream lost %d samples between events %s and %s", lost, st.last, id)
+	}
+	st.last = id
+	return true
+}
+
+// resultGaps returns the samples lost by the stream so far
+func (st *streamTracker) resultGaps() []*enginesModel.ResultGap {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	gaps := make([]*enginesModel.ResultGap, len(st.gaps))
+	copy(gaps, st.gaps)
+	return gaps
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+func streamEventID(epoch int64, seq uint64) enginesModel.StreamEventID {
+	return enginesModel.StreamEventID{Epoch: epoch, Seq: seq, Timestamp: epoch + int64(seq)}
+}
+
+func TestStreamTrackerCountsLostSamples(t *testing.T) {
+	st := newStreamTracker()
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	assert.True(t, st.observe(streamEventID(1, 1), start))
+	assert.True(t, st.observe(streamEventID(1, 2), start))
+	st.disconnect(start.Add(time.Second))
+	// The engine could only replay from event 6
+	assert.True(t, st.observe(streamEventID(1, 6), start.Add(5*time.Second)))
+	assert.True(t, st.observe(streamEventID(1, 7), start.Add(5*time.Second)))
+
+	gaps := st.resultGaps()
+	assert.Len(t, gaps, 1)
+	assert.Equal(t, uint64(3), gaps[0].Samples)
+	assert.Equal(t, start.Add(time.Second), gaps[0].Start)
+	assert.Equal(t, start.Add(5*time.Second), gaps[0].End)
+	assert.Equal(t, enginesModel.GapReasonStreamInterrupted, gaps[0].Reason)
+}
+
+func TestStreamTrackerFullReplay(t *testing.T) {
+	st := newStreamTracker()
+	now := time.Now()
+	assert.True(t, st.observe(streamEventID(1, 1), now))
+	st.disconnect(now)
+	assert.True(t, st.observe(streamEventID(1, 2), now))
+	assert.Empty(t, st.resultGaps())
+}
+
+func TestStreamTrackerDropsDuplicates(t *testing.T) {
+	st := newStreamTracker()
+	now := time.Now()
+	assert.True(t, st.observe(streamEventID(1, 1), now))
+	assert.True(t, st.observe(streamEventID(1, 2), now))
+	assert.False(t, st.observe(streamEventID(1, 2), now))
+	assert.False(t, st.observe(streamEventID(1, 1), now))
+	assert.True(t, st.observe(streamEventID(1, 3), now))
+	assert.Empty(t, st.resultGaps())
+}
+
+func TestStreamTrackerNewNumbering(t *testing.T) {
+	st := newStreamTracker()
+	now := time.Now()
+	// The first event does not need to be 1, the subscription can start in the middle of the run
+	assert.True(t, st.observe(streamEventID(1, 40), now))
+	assert.True(t, st.observe(streamEventID(1, 41), now))
+	// The numbering starts over when the engine is restarted
+	assert.True(t, st.observe(streamEventID(2, 1), now))
+	assert.True(t, st.observe(streamEventID(2, 2), now))
+	assert.Empty(t, st.resultGaps())
+}
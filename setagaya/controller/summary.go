@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+func makeTransactionSummaries(ts *enginesModel.TransactionStats) map[string]*model.TransactionSummary {
+	if len(ts.Labels) == 0 {
+		return nil
+	}
+	r := make(map[string]*model.TransactionSummary, len(ts.Labels))
+	for label, stat := range ts.Labels {
+		h := stat.Histogram
+		r[label] = &model.TransactionSummary{
+			Samples: h.Total,
+			Failed:  stat.Failed,
+			Mean:    h.Mean(),
+			P50:     h.Percentile(50),
+			P90:     h.Percentile(90),
+			P95:     h.Percentile(95),
+			P99:     h.Percentile(99),
+		}
+	}
+	return r
+}
+
+func makeRunSummary(runID, collectionID int64, h *enginesModel.LatencyHistogram,
+	as *enginesModel.AssertionStats, ts *enginesModel.TransactionStats) (*model.RunSummary, error) {
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	rs := &model.RunSummary{
+		RunID:        runID,
+		CollectionID: collectionID,
+		Samples:      h.Total,
+		Min:          h.Min,
+		Max:          h.Max,
+		Mean:         h.Mean(),
+		P50:          h.Percentile(50),
+		P90:          h.Percentile(90),
+		P95:          h.Percentile(95),
+		P99:          h.Percentile(99),
+		Histogram:    string(raw),
+		Transactions: makeTransactionSummaries(ts),
+	}
+	if len(as.Labels) > 0 {
+		rs.Assertions = as.Labels
+	}
+	return rs, nil
+}
+
+// forEachConnectedEngine calls f concurrently for every connected engine of the collection and waits for them.
+// Engines that are not connected are skipped.
+func (c *Controller) forEachConnectedEngine(collection *model.Collection, eps []*model.ExecutionPlan,
+	f func(engine setagayaEngine, planID int64, key string)) {
+	var wg sync.WaitGroup
+	for _, ep := range eps {
+		for i := 0; i < ep.Engines; i++ {
+			key := makePlanEngineKey(collection.ID, ep.PlanID, i)
+			item, ok := c.connectedEngines.Load(key)
+			if !ok {
+				continue
+			}
+			engine, ok := item.(setagayaEngine)
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func(engine setagayaEngine, planID int64, key string) {
+				defer wg.Done()
+				f(engine, planID, key)
+			}(engine, ep.PlanID, key)
+		}
+	}
+	wg.Wait()
+}
+
+// collectRunHistogram merges the latency digests from all the connected engines of the collection
+// Engines that cannot be reached are skipped so a single broken engine does not lose the whole summary
+func (c *Controller) collectRunHistogram(collection *model.Collection, eps []*model.ExecutionPlan) *enginesModel.LatencyHistogram {
+	merged := enginesModel.NewLatencyHistogram()
+	var mu sync.Mutex
+	c.forEachConnectedEngine(collection, eps, func(engine setagayaEngine, _ int64, key string) {
+		h, err := engine.histogram()
+		if err != nil {
+			log.Printf("Error fetching histogram from engine %s: %v", key, err)
+			return
+		}
+		mu.Lock()
+		merged.Merge(h)
+		mu.Unlock()
+	})
+	return merged
+}
+
+// collectRunAssertions merges the assertion results from all the connected engines of the collection
+func (c *Controller) collectRunAssertions(collection *model.Collection, eps []*model.ExecutionPlan) *enginesModel.AssertionStats {
+	merged := enginesModel.NewAssertionStats()
+	var mu sync.Mutex
+	c.forEachConnectedEngine(collection, eps, func(engine setagayaEngine, _ int64, key string) {
+		as, err := engine.assertions()
+		if err != nil {
+			log.Printf("Error fetching assertions from engine %s: %v", key, err)
+			return
+		}
+		mu.Lock()
+		merged.Merge(as)
+		mu.Unlock()
+	})
+	return merged
+}
+
+// collectRunTransactions merges the transaction controller samples from all the connected engines of the collection
+func (c *Controller) collectRunTransactions(collection *model.Collection, eps []*model.ExecutionPlan) *enginesModel.TransactionStats {
+	merged := enginesModel.NewTransactionStats()
+	var mu sync.Mutex
+	c.forEachConnectedEngine(collection, eps, func(engine setagayaEngine, _ int64, key string) {
+		ts, err := engine.transactions()
+		if err != nil {
+			log.Printf("Error fetching transactions from engine %s: %v", key, err)
+			return
+		}
+		mu.Lock()
+		merged.Merge(ts)
+		mu.Unlock()
+	})
+	return merged
+}
+
+func (c *Controller) storeRunSummary(collection *model.Collection, eps []*model.ExecutionPlan, runID int64) error {
+	h := c.collectRunHistogram(collection, eps)
+	if h.Total == 0 {
+		// The engines of a soak run can be gone by its end, its last checkpoint is the best summary left
+		if rs := lastCheckpointSummary(runID); rs != nil {
+			return model.StoreRunSummary(rs)
+		}
+		return nil
+	}
+	rs, err := makeRunSummary(runID, collection.ID, h, c.collectRunAssertions(collection, eps),
+		c.collectRunTransactions(collection, eps))
+	if err != nil {
+		return err
+	}
+	return model.StoreRunSummary(rs)
+}
+
+// liveSummaryTTL is how long the figures of a run in progress are reused. Everyone watching its status page would
+// make the engines merge their histograms otherwise.
+const liveSummaryTTL = 5 * time.Second
+
+type liveSummary struct {
+	summary   *model.RunSummary
+	collected time.Time
+}
+
+// RunSummary returns the latency figures of the run. They are collected from the engines while the run is in
+// progress, and read from the summary stored when it ended afterwards.
+func (c *Controller) RunSummary(collection *model.Collection, run *model.RunHistory) (*model.RunSummary, error) {
+	if !run.EndTime.IsZero() {
+		c.liveSummaries.Delete(run.ID)
+		return model.GetRunSummary(run.ID)
+	}
+	if item, ok := c.liveSummaries.Load(run.ID); ok {
+		if ls := item.(*liveSummary); time.Since(ls.collected) < liveSummaryTTL {
+			return ls.summary, nil
+		}
+	}
+	eps, err := collection.GetExecutionPlans()
+	if err != nil {
+		return nil, err
+	}
+	rs, err := makeRunSummary(run.ID, collection.ID, c.collectRunHistogram(collection, eps),
+		enginesModel.NewAssertionStats(), enginesModel.NewTransactionStats())
+	if err != nil {
+		return nil, err
+	}
+	c.liveSummaries.Store(run.ID, &liveSummary{summary: rs, collected: time.Now()})
+	return rs, nil
+}
+
+// planTeams returns the teams of the plans, the files of their engines are labelled with. A plan whose team cannot
+// be found has none.
+func planTeams(eps []*model.ExecutionPlan) map[int64]string {
+	teams := map[int64]string{}
+	for _, ep := range eps {
+		team, err := model.GetPlanTeam(ep.PlanID)
+		if err != nil {
+			log.Printf("Error finding the team of plan %d: %v", ep.PlanID, err)
+			continue
+		}
+		teams[ep.PlanID] = team
+	}
+	return teams
+}
+
+// storeFailureCaptures records where the engines uploaded the failing responses they captured during the run
+func (c *Controller) storeFailureCaptures(collection *model.Collection, eps []*model.ExecutionPlan, runID int64) {
+	teams := planTeams(eps)
+	c.forEachConnectedEngine(collection, eps, func(engine setagayaEngine, planID int64, key string) {
+		filename := model.MakeFailureCaptureFilename(runID, planID, engine.EngineID())
+		region, err := sos.Region(sos.Client.Storage, filename)
+		if err != nil {
+			log.Printf("Error finding the region of the failures of engine %s: %v", key, err)
+			return
+		}
+		fcf, err := engine.failures(&enginesModel.FailuresRequest{
+			UploadURL: sos.SignedUploadUrl(sos.Client.Storage, filename),
+			Region:    region,
+		})
+		if err != nil {
+			log.Printf("Error collecting failures from engine %s: %v", key, err)
+			return
+		}
+		if fcf.Samples == 0 {
+			return
+		}
+		fcf.Team = teams[planID]
+		if err := model.StoreFailureCaptureFile(collection.ID, runID, planID, engine.EngineID(), fcf); err != nil {
+			log.Printf("Error storing failures of engine %s: %v", key, err)
+		}
+	})
+}
+
+func makeRunErrors(es *enginesModel.ErrorStats) []*model.RunError {
+	r := []*model.RunError{}
+	for label, errs := range es.Labels {
+		for _, ec := range errs {
+			r = append(r, &model.RunError{
+				Label:    label,
+				Category: ec.Category,
+				Code:     ec.Code,
+				Message:  ec.Message,
+				Count:    ec.Count,
+			})
+		}
+	}
+	return r
+}
+
+// storeRunErrors aggregates the failed samples of all the engines of the run
+func (c *Controller) storeRunErrors(collection *model.Collection, eps []*model.ExecutionPlan, runID int64) error {
+	merged := enginesModel.NewErrorStats()
+	var mu sync.Mutex
+	c.forEachConnectedEngine(collection, eps, func(engine setagayaEngine, _ int64, key string) {
+		es, err := engine.errorStats()
+		if err != nil {
+			log.Printf("Error fetching errors from engine %s: %v", key, err)
+			return
+		}
+		mu.Lock()
+		merged.Merge(es)
+		mu.Unlock()
+	})
+	if len(merged.Labels) == 0 {
+		return nil
+	}
+	return model.StoreRunErrors(collection.ID, runID, makeRunErrors(merged))
+}
+
+// storeRunGaps records the periods whose samples are missing from the results of the engines
+func (c *Controller) storeRunGaps(collection *model.Collection, eps []*model.ExecutionPlan, runID int64) error {
+	var gaps []*model.RunGap
+	var mu sync.Mutex
+	c.forEachConnectedEngine(collection, eps, func(engine setagayaEngine, planID int64, key string) {
+		egs, err := engine.gaps()
+		if err != nil {
+			log.Printf("Error fetching gaps from engine %s: %v", key, err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, g := range egs {
+			gaps = append(gaps, &model.RunGap{
+				PlanID:   planID,
+				EngineID: engine.EngineID(),
+				File:     g.File,
+				Start:    g.Start,
+				End:      g.End,
+				Reason:   g.Reason,
+				Samples:  g.Samples,
+			})
+		}
+	})
+	if len(gaps) == 0 {
+		return nil
+	}
+	return model.StoreRunGaps(collection.ID, runID, gaps)
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+func TestMakeRunSummary(t *testing.T) {
+	h := enginesModel.NewLatencyHistogram()
+	for i := 1; i <= 100; i++ {
+		h.Observe(float64(i))
+	}
+	rs, err := makeRunSummary(10, 20, h, enginesModel.NewAssertionStats(), enginesModel.NewTransactionStats())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), rs.RunID)
+	assert.Equal(t, int64(20), rs.CollectionID)
+	assert.Equal(t, uint64(100), rs.Samples)
+	assert.Equal(t, float64(1), rs.Min)
+	assert.Equal(t, float64(100), rs.Max)
+	assert.InEpsilon(t, 50, rs.P50, 0.05)
+	assert.InEpsilon(t, 99, rs.P99, 0.05)
+
+	decoded := new(enginesModel.LatencyHistogram)
+	assert.NoError(t, json.Unmarshal([]byte(rs.Histogram), decoded))
+	assert.Equal(t, h.Total, decoded.Total)
+	assert.Nil(t, rs.Assertions)
+	assert.Nil(t, rs.Transactions)
+}
+
+func TestMakeRunSummaryAssertions(t *testing.T) {
+	h := enginesModel.NewLatencyHistogram()
+	h.Observe(100)
+	as := enginesModel.NewAssertionStats()
+	as.Observe("login", "")
+	as.Observe("login", "Response code was 500")
+
+	rs, err := makeRunSummary(10, 20, h, as, enginesModel.NewTransactionStats())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), rs.Assertions["login"].Samples)
+	assert.Equal(t, uint64(1), rs.Assertions["login"].Failed)
+}
+
+func TestMakeRunSummaryTransactions(t *testing.T) {
+	h := enginesModel.NewLatencyHistogram()
+	h.Observe(100)
+	ts := enginesModel.NewTransactionStats()
+	for i := 1; i <= 100; i++ {
+		ts.Observe("checkout", float64(i*10), i%10 != 0)
+	}
+
+	rs, err := makeRunSummary(10, 20, h, enginesModel.NewAssertionStats(), ts)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), rs.Samples)
+	checkout := rs.Transactions["checkout"]
+	assert.Equal(t, uint64(100), checkout.Samples)
+	assert.Equal(t, uint64(10), checkout.Failed)
+	assert.InEpsilon(t, 500, checkout.P50, 0.05)
+}
+
+func TestMakeRunErrors(t *testing.T) {
+	es := enginesModel.NewErrorStats()
+	es.Observe("login", "500", "Internal Server Error")
+	es.Observe("login", "500", "Internal Server Error")
+	es.Observe("search", "404", "Not Found")
+
+	errs := makeRunErrors(es)
+	assert.Len(t, errs, 2)
+	for _, e := range errs {
+		switch e.Label {
+		case "login":
+			assert.Equal(t, enginesModel.ErrorServer, e.Category)
+			assert.Equal(t, uint64(2), e.Count)
+		case "search":
+			assert.Equal(t, enginesModel.ErrorClient, e.Category)
+			assert.Equal(t, "Not Found", e.Message)
+		default:
+			t.Errorf("unexpected label %s", e.Label)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+	"github.com/hveda/Setagaya/setagaya/scheduler"
+)
+
+// ErrInvalidStorageRegion is returned when the files of a tenant are kept in a region without an object storage
+var ErrInvalidStorageRegion = errors.New("invalid storage region")
+
+// OnboardTenant provisions everything a new tenant needs. The tenant is removed when its namespace cannot be
+// created, so the onboarding can simply be tried again.
+func (c *Controller) OnboardTenant(ctx context.Context, name, owner, admin, storageRegion string, quota *model.TenantQuota) (*model.Tenant, error) {
+	if !sos.HasRegion(storageRegion) {
+		return nil, fmt.Errorf("%w: no object storage is configured for region %s", ErrInvalidStorageRegion, storageRegion)
+	}
+	namespace, err := model.MakeTenantNamespace(name)
+	if err != nil {
+		return nil, err
+	}
+	tenant, err := model.CreateTenant(name, owner, namespace, admin, storageRegion, quota)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Scheduler.ProvisionTenant(ctx, tenant); err != nil && !errors.Is(err, scheduler.ErrFeatureUnavailable) {
+		if deleteErr := tenant.Delete(); deleteErr != nil {
+			log.Printf("Error removing tenant %s after a failed onboarding: %v", tenant.Name, deleteErr)
+		}
+		return nil, err
+	}
+	log.Printf("Tenant %s is onboarded in namespace %s", tenant.Name, tenant.Namespace)
+	return tenant, nil
+}
+
+// StorageMigration is what moving the files of a tenant to another region did, or would do in dry run
+type StorageMigration struct {
+	DryRun bool   `json:"dry_run"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	// Files copied to the new region
+	Moved []string `json:"moved"`
+	// Files known to the database which are in neither region
+	Missing []string `json:"missing"`
+	// Files which could not be deleted from the old region once the tenant was switched to the new one
+	NotDeleted []string `json:"not_deleted"`
+}
+
+// MoveTenantStorage copies the files of the tenant to the storage of the region, switches the tenant to it, then
+// deletes the files from the old region. Nothing is switched when a file cannot be copied, so the move can simply be
+// tried again. In dry run only the files to move are listed.
+func (c *Controller) MoveTenantStorage(tenant *model.Tenant, region string, dryRun bool) (*StorageMigration, error) {
+	if !sos.HasRegion(region) {
+		return nil, fmt.Errorf("%w: no object storage is configured for region %s", ErrInvalidStorageRegion, region)
+	}
+	routes, err := tenant.RoutesStorage()
+	if err != nil {
+		return nil, err
+	}
+	if !routes {
+		return nil, fmt.Errorf("%w: the files of %s are kept in the region of its first tenant", ErrInvalidStorageRegion,
+			tenant.Owner)
+	}
+	m := &StorageMigration{DryRun: dryRun, From: tenant.StorageRegion, To: region, Moved: []string{},
+		Missing: []string{}, NotDeleted: []string{}}
+	if region == tenant.StorageRegion {
+		return m, nil
+	}
+	from, err := sos.ForRegion(sos.Client.Storage, tenant.StorageRegion)
+	if err != nil {
+		return nil, err
+	}
+	to, err := sos.ForRegion(sos.Client.Storage, region)
+	if err != nil {
+		return nil, err
+	}
+	files, err := tenant.StorageFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, filename := range files {
+		if dryRun {
+			m.Moved = append(m.Moved, filename)
+			continue
+		}
+		content, err := from.Download(filename)
+		if errors.Is(err, sos.FileNotFoundError()) {
+			// Moved by a previous attempt which failed later
+			if _, err := to.Download(filename); err != nil {
+				m.Missing = append(m.Missing, filename)
+			}
+			continue
+		}
+		if err != nil {
+			return m, fmt.Errorf("cannot read %s from the old region: %w", filename, err)
+		}
+		if err := to.Upload(filename, io.NopCloser(bytes.NewReader(content))); err != nil {
+			return m, fmt.Errorf("cannot copy %s to region %s: %w", filename, region, err)
+		}
+		m.Moved = append(m.Moved, filename)
+	}
+	if dryRun {
+		return m, nil
+	}
+	if err := tenant.SetStorageRegion(region); err != nil {
+		return m, err
+	}
+	for _, filename := range m.Moved {
+		if err := from.Delete(filename); err != nil && !errors.Is(err, sos.FileNotFoundError()) {
+			log.Printf("Error deleting %s from the old region of tenant %s: %v", filename, tenant.Name, err)
+			m.NotDeleted = append(m.NotDeleted, filename)
+		}
+	}
+	log.Printf("Moved %d files of tenant %s from region %q to %q", len(m.Moved), tenant.Name, m.From, m.To)
+	return m, nil
+}
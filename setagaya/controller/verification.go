@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const (
+	verificationDeployWait = 15 * time.Minute
+	// Time the run is given to end after the longest duration of its plans
+	verificationRunGrace   = 10 * time.Minute
+	verificationPoll       = 5 * time.Second
+	verificationConfidence = 0.95
+	// The assertion failure rate of a verification run can exceed the one of the baseline by that many points
+	assertionRateMargin = 0.01
+)
+
+// StartVerification runs the collection and scores the run against the baseline run, for the deployment gates.
+// It returns once the verification is recorded, its progress can be followed with model.GetVerification.
+func (c *Controller) StartVerification(collection *model.Collection, baselineRunID int64,
+	vr *model.VerificationRequest, owner string) (*model.Verification, error) {
+	running, err := collection.HasRunningPlan()
+	if err != nil {
+		return nil, err
+	}
+	if running {
+		return nil, &model.RequestError{Message: "the collection is already running"}
+	}
+	if _, err := model.GetRunSummary(baselineRunID); err != nil {
+		return nil, &model.RequestError{Err: err, Message: fmt.Sprintf("baseline run %d does not have a summary", baselineRunID)}
+	}
+	v, err := model.CreateVerification(collection.ID, baselineRunID, vr, owner)
+	if err != nil {
+		return nil, err
+	}
+	go c.runVerification(collection, v, vr)
+	return v, nil
+}
+
+func (c *Controller) runVerification(collection *model.Collection, v *model.Verification, vr *model.VerificationRequest) {
+	defer func() {
+		if err := model.UpdateVerification(v); err != nil {
+			log.Printf("Error storing verification %d: %v", v.ID, err)
+		}
+		if vr.KeepEngines {
+			return
+		}
+		if err := c.TermAndPurgeCollection(context.Background(), collection); err != nil {
+			log.Printf("Error purging verification %d of collection %d: %v", v.ID, collection.ID, err)
+		}
+	}()
+	if err := c.verify(collection, v, vr); err != nil {
+		v.Status = model.VerificationFailed
+		v.Message = err.Error()
+	}
+	log.Printf("Verification %d of collection %d is %s with a score of %.0f", v.ID, collection.ID, v.Status, v.Score)
+}
+
+// deployAndWait deploys the engines of the collection, unless they already are, and waits until they are
+// reachable
+func (c *Controller) deployAndWait(collection *model.Collection) error {
+	cs, err := c.CollectionStatus(context.Background(), collection)
+	if err != nil {
+		return err
+	}
+	deployed := len(cs.Plans) > 0
+	for _, ps := range cs.Plans {
+		deployed = deployed && ps.EnginesDeployed == ps.Engines
+	}
+	if !deployed {
+		if err := c.DeployCollection(context.Background(), collection); err != nil {
+			return err
+		}
+	}
+	deadline := time.Now().Add(verificationDeployWait)
+	for {
+		cs, err := c.CollectionStatus(context.Background(), collection)
+		if err != nil {
+			return err
+		}
+		reachable := len(cs.Plans) > 0
+		for _, ps := range cs.Plans {
+			reachable = reachable && ps.EnginesReachable
+		}
+		if reachable {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the engines were not reachable after %s", verificationDeployWait)
+		}
+		time.Sleep(verificationPoll)
+	}
+}
+
+func (c *Controller) verify(collection *model.Collection, v *model.Verification, vr *model.VerificationRequest) error {
+	if err := c.deployAndWait(collection); err != nil {
+		return err
+	}
+	runID, err := c.TriggerCollection(context.Background(), collection, &model.TriggerRequest{Parameters: vr.Parameters, Metadata: vr.Metadata})
+	if err != nil {
+		return err
+	}
+	v.RunID = runID
+	v.Status = model.VerificationRunning
+	if err := model.UpdateVerification(v); err != nil {
+		log.Printf("Error storing verification %d: %v", v.ID, err)
+	}
+	duration := 0
+	for _, ep := range collection.ExecutionPlans {
+		duration = max(duration, ep.Duration)
+	}
+	deadline := time.Now().Add(time.Duration(duration)*time.Minute + verificationRunGrace)
+	for {
+		run, err := model.GetRun(runID)
+		if err != nil {
+			return err
+		}
+		if !run.EndTime.IsZero() {
+			break
+		}
+		if time.Now().After(deadline) {
+			return errors.New("the run did not end in time")
+		}
+		time.Sleep(verificationPoll)
+	}
+	base, err := model.GetRunSummary(v.BaselineRunID)
+	if err != nil {
+		return err
+	}
+	target, err := model.GetRunSummary(runID)
+	if err != nil {
+		return errors.New("the run did not produce any samples")
+	}
+	scoreVerification(v, base, target)
+	return nil
+}
+
+// meanSignificant tells whether the mean latency of the runs differs by more than noise. It's considered
+// significant when the runs cannot be tested.
+func meanSignificant(base, target *model.RunSummary) bool {
+	baseHistogram := enginesModel.NewLatencyHistogram()
+	targetHistogram := enginesModel.NewLatencyHistogram()
+	if json.Unmarshal([]byte(base.Histogram), baseHistogram) != nil ||
+		json.Unmarshal([]byte(target.Histogram), targetHistogram) != nil {
+		return true
+	}
+	s, err := enginesModel.CompareLatencies(baseHistogram, targetHistogram, verificationConfidence)
+	return err != nil || s.Significant
+}
+
+func assertionFailureRate(rs *model.RunSummary) float64 {
+	var samples, failed uint64
+	for _, la := range rs.Assertions {
+		samples += la.Samples
+		failed += la.Failed
+	}
+	if samples == 0 {
+		return 0
+	}
+	return float64(failed) / float64(samples)
+}
+
+// scoreVerification compares the figures of the run to the ones of the baseline. A latency passes when it does not
+// exceed the baseline by more than the tolerance. The mean also passes when its difference is not significant.
+// The score is the percentage of the metrics that passed.
+func scoreVerification(v *model.Verification, base, target *model.RunSummary) {
+	v.Metrics = []*model.VerificationMetric{}
+	latencies := []struct {
+		name         string
+		base, target float64
+	}{
+		{"mean", base.Mean, target.Mean},
+		{"p50", base.P50, target.P50},
+		{"p90", base.P90, target.P90},
+		{"p95", base.P95, target.P95},
+		{"p99", base.P99, target.P99},
+	}
+	for _, l := range latencies {
+		passed := l.target <= l.base*(1+v.Tolerance)
+		if l.name == "mean" && !passed {
+			passed = !meanSignificant(base, target)
+		}
+		v.Metrics = append(v.Metrics, &model.VerificationMetric{Name: l.name, Baseline: l.base, Value: l.target,
+			Passed: passed})
+	}
+	if len(base.Assertions) > 0 || len(target.Assertions) > 0 {
+		baseRate, targetRate := assertionFailureRate(base), assertionFailureRate(target)
+		v.Metrics = append(v.Metrics, &model.VerificationMetric{Name: "assertion_failure_rate", Baseline: baseRate,
+			Value: targetRate, Passed: targetRate <= baseRate+assertionRateMargin})
+	}
+	passed := 0
+	for _, m := range v.Metrics {
+		if m.Passed {
+			passed++
+		}
+	}
+	v.Score = 100 * float64(passed) / float64(len(v.Metrics))
+	v.Judge()
+}
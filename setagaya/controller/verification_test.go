@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func makeVerificationSummary(t *testing.T, shift float64) *model.RunSummary {
+	h := enginesModel.NewLatencyHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Observe(float64(i%100) + shift)
+	}
+	rs, err := makeRunSummary(1, 1, h, enginesModel.NewAssertionStats(), enginesModel.NewTransactionStats())
+	assert.NoError(t, err)
+	return rs
+}
+
+func TestScoreVerification(t *testing.T) {
+	base := makeVerificationSummary(t, 100)
+	v := &model.Verification{Tolerance: 0.1, PassThreshold: 75, MarginalThreshold: 50}
+	scoreVerification(v, base, makeVerificationSummary(t, 105))
+	assert.Equal(t, float64(100), v.Score)
+	assert.Equal(t, model.VerificationPassed, v.Status)
+	assert.Len(t, v.Metrics, 5)
+
+	// All the latencies regressed
+	scoreVerification(v, base, makeVerificationSummary(t, 200))
+	assert.Equal(t, float64(0), v.Score)
+	assert.Equal(t, model.VerificationFailed, v.Status)
+	for _, m := range v.Metrics {
+		assert.False(t, m.Passed, m.Name)
+	}
+
+	// Failing assertions are a metric of their own
+	target := makeVerificationSummary(t, 100)
+	target.Assertions = map[string]*model.LabelAssertions{"login": {Samples: 100, Passed: 90, Failed: 10}}
+	scoreVerification(v, base, target)
+	assert.Len(t, v.Metrics, 6)
+	assert.InDelta(t, 83.3, v.Score, 0.1)
+	assert.Equal(t, "assertion_failure_rate", v.Metrics[5].Name)
+	assert.InDelta(t, 0.1, v.Metrics[5].Value, 1e-9)
+	assert.False(t, v.Metrics[5].Passed)
+
+	v.PassThreshold = 90
+	scoreVerification(v, base, target)
+	assert.Equal(t, model.VerificationMarginal, v.Status)
+}
+
+func TestMeanSignificant(t *testing.T) {
+	base := makeVerificationSummary(t, 100)
+	assert.False(t, meanSignificant(base, makeVerificationSummary(t, 100)))
+	assert.True(t, meanSignificant(base, makeVerificationSummary(t, 150)))
+	// Runs that cannot be tested are considered different
+	assert.True(t, meanSignificant(base, &model.RunSummary{Histogram: "{}"}))
+	raw, _ := json.Marshal(enginesModel.NewLatencyHistogram())
+	assert.True(t, meanSignificant(base, &model.RunSummary{Histogram: string(raw)}))
+}
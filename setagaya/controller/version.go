@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/utils"
+)
+
+var ErrIncompatibleEngines = errors.New("the engines are incompatible with the controller")
+
+// checkAgentVersion tells why the agent of an engine is older than the minimum version of the config. The images
+// built before the agents reported their version, and the ones built without a version, cannot be told apart from
+// the old ones.
+func checkAgentVersion(version, minimum string) error {
+	if minimum == "" {
+		return nil
+	}
+	if version == "" {
+		return fmt.Errorf("the agent does not report its version, the image may be older than %s", minimum)
+	}
+	c, err := utils.CompareVersions(version, minimum)
+	if err != nil {
+		return fmt.Errorf("the version %q of the agent cannot be compared to %s", version, minimum)
+	}
+	if c < 0 {
+		return fmt.Errorf("the agent %s is older than %s, the engine image should be updated", version, minimum)
+	}
+	return nil
+}
+
+// engineHandshake is the version an engine of a plan reported
+type engineHandshake struct {
+	planID   int64
+	engineID int
+	version  *enginesModel.EngineVersion
+}
+
+func (eh *engineHandshake) String() string {
+	agent := eh.version.Agent
+	if agent == "" {
+		agent = "unknown"
+	}
+	return fmt.Sprintf("engine %d of plan %d (agent %s, protocol %d)", eh.engineID, eh.planID, agent,
+		eh.version.Protocol)
+}
+
+// checkHandshakes lists the engines the controller cannot work with, the ones too old for it and the ones too new
+func checkHandshakes(handshakes []*engineHandshake, protocol, minimum int) error {
+	incompatible := []string{}
+	sort.Slice(handshakes, func(i, j int) bool {
+		if handshakes[i].planID != handshakes[j].planID {
+			return handshakes[i].planID < handshakes[j].planID
+		}
+		return handshakes[i].engineID < handshakes[j].engineID
+	})
+	for _, eh := range handshakes {
+		if !eh.version.CompatibleWith(protocol, minimum) {
+			incompatible = append(incompatible, eh.String())
+		}
+	}
+	if len(incompatible) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: the controller speaks the protocols %d to %d and cannot drive %s, the engine images and the "+
+		"controller should be upgraded together", ErrIncompatibleEngines, minimum, protocol, strings.Join(incompatible, ", "))
+}
+
+// handshake asks the version of every engine of the collection before the run starts, so a run does not start with
+// engines the controller cannot drive. The engines of the plans starting after other plans are asked too.
+func (c *Controller) handshake(ctx context.Context, collection *model.Collection) error {
+	type result struct {
+		eh  *engineHandshake
+		err error
+	}
+	engines := []setagayaEngine{}
+	planIDs := []int64{}
+	for _, ep := range collection.ExecutionPlans {
+		planEngines, err := generateEnginesWithUrl(ctx, ep.Engines, ep.PlanID, collection.ID, collection.ProjectID,
+			findEngineType(ep), c.Scheduler)
+		if err != nil {
+			return err
+		}
+		for range planEngines {
+			planIDs = append(planIDs, ep.PlanID)
+		}
+		engines = append(engines, planEngines...)
+	}
+	results := make(chan result, len(engines))
+	for i, engine := range engines {
+		go func(engine setagayaEngine, planID int64) {
+			v, err := engine.version()
+			if err != nil {
+				results <- result{err: fmt.Errorf("cannot ask engine %d of plan %d its version: %w", engine.EngineID(),
+					planID, err)}
+				return
+			}
+			results <- result{eh: &engineHandshake{planID: planID, engineID: engine.EngineID(), version: v}}
+		}(engine, planIDs[i])
+	}
+	handshakes := []*engineHandshake{}
+	errs := []error{}
+	for range engines {
+		r := <-results
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		handshakes = append(handshakes, r.eh)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return checkHandshakes(handshakes, enginesModel.ProtocolVersion, enginesModel.MinProtocolVersion)
+}
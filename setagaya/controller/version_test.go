@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+func TestCheckAgentVersion(t *testing.T) {
+	assert.NoError(t, checkAgentVersion("", ""))
+	assert.NoError(t, checkAgentVersion("dev", ""))
+	assert.NoError(t, checkAgentVersion("v1.2.0", "v1.2.0"))
+	assert.NoError(t, checkAgentVersion("v1.10.0", "v1.2.0"))
+
+	err := checkAgentVersion("v1.1.9", "v1.2.0")
+	assert.ErrorContains(t, err, "older than v1.2.0")
+	err = checkAgentVersion("", "v1.2.0")
+	assert.ErrorContains(t, err, "does not report its version")
+	err = checkAgentVersion("dev", "v1.2.0")
+	assert.ErrorContains(t, err, "cannot be compared")
+}
+
+func TestCheckHandshakes(t *testing.T) {
+	handshakes := []*engineHandshake{
+		{planID: 2, engineID: 1, version: &enginesModel.EngineVersion{Agent: "v1.3.0", Protocol: 2, MinProtocol: 1}},
+		{planID: 2, engineID: 0, version: &enginesModel.EngineVersion{}},
+		{planID: 1, engineID: 0, version: &enginesModel.EngineVersion{Agent: "v1.2.0", Protocol: 1}},
+		{planID: 1, engineID: 1, version: &enginesModel.EngineVersion{Agent: "v2.0.0", Protocol: 4, MinProtocol: 2}},
+	}
+	assert.NoError(t, checkHandshakes(handshakes, 2, 0))
+
+	// The agent of v2.0.0 no longer works with the protocol 1, the one of plan 2 is older than the handshake
+	err := checkHandshakes(handshakes, 1, 1)
+	assert.ErrorIs(t, err, ErrIncompatibleEngines)
+	assert.ErrorContains(t, err, "engine 1 of plan 1 (agent v2.0.0, protocol 4), engine 0 of plan 2 (agent unknown, "+
+		"protocol 0)")
+	assert.NotContains(t, err.Error(), "agent v1.2.0")
+	assert.NotContains(t, err.Error(), "agent v1.3.0")
+}
+
+func TestEngineVersion(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/version", r.URL.Path)
+		w.WriteHeader(status)
+		w.Write([]byte(`{"agent": "v1.2.0", "engine": "jmeter", "engine_version": "5.6.3", "protocol": 1}`))
+	}))
+	defer ts.Close()
+	be := &baseEngine{engineUrl: ts.URL}
+
+	v, err := be.version()
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.2.0", v.Agent)
+	assert.Equal(t, "5.6.3", v.EngineVersion)
+	assert.Equal(t, 1, v.Protocol)
+
+	// The agents before the handshake
+	status = http.StatusNotFound
+	v, err = be.version()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, v.Protocol)
+
+	status = http.StatusInternalServerError
+	_, err = be.version()
+	assert.Error(t, err)
+}
@@ -0,0 +1,17 @@
+use setagaya;
+
+CREATE TABLE IF NOT EXISTS collection_run_summary (
+    run_id INT UNSIGNED NOT NULL PRIMARY KEY,
+    collection_id INT UNSIGNED NOT NULL,
+    samples BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    min_latency DOUBLE NOT NULL DEFAULT 0,
+    max_latency DOUBLE NOT NULL DEFAULT 0,
+    mean_latency DOUBLE NOT NULL DEFAULT 0,
+    p50 DOUBLE NOT NULL DEFAULT 0,
+    p90 DOUBLE NOT NULL DEFAULT 0,
+    p95 DOUBLE NOT NULL DEFAULT 0,
+    p99 DOUBLE NOT NULL DEFAULT 0,
+    histogram MEDIUMTEXT,
+    created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    key (collection_id)
+)CHARSET=utf8mb4;
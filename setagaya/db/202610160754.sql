@@ -0,0 +1,3 @@
+use setagaya;
+
+ALTER TABLE collection_plan ADD COLUMN target_rps INT UNSIGNED NOT NULL DEFAULT 0;
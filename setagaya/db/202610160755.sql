@@ -0,0 +1,9 @@
+use setagaya;
+
+CREATE TABLE IF NOT EXISTS collection_plan_region (
+    collection_id INT UNSIGNED NOT NULL,
+    plan_id INT UNSIGNED NOT NULL,
+    region VARCHAR(50) NOT NULL,
+    weight INT UNSIGNED NOT NULL,
+    PRIMARY KEY (collection_id, plan_id, region)
+)CHARSET=utf8mb4;
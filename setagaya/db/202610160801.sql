@@ -0,0 +1,3 @@
+use setagaya;
+
+ALTER TABLE collection_plan ADD COLUMN engine_type VARCHAR(20) NOT NULL DEFAULT 'jmeter';
@@ -0,0 +1,10 @@
+use setagaya;
+
+CREATE TABLE IF NOT EXISTS plan_parameter (
+    plan_id INT UNSIGNED NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    default_value VARCHAR(1024) NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    PRIMARY KEY (plan_id, name)
+)CHARSET=utf8mb4;
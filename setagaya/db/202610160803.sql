@@ -0,0 +1,11 @@
+use setagaya;
+
+CREATE TABLE IF NOT EXISTS collection_run_metadata (
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    commit_sha VARCHAR(40) NOT NULL DEFAULT '',
+    branch VARCHAR(255) NOT NULL DEFAULT '',
+    build_url VARCHAR(1024) NOT NULL DEFAULT '',
+    PRIMARY KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,22 @@
+use setagaya;
+
+CREATE TABLE IF NOT EXISTS collection_baseline (
+    collection_id INT UNSIGNED NOT NULL,
+    run_id INT UNSIGNED NOT NULL,
+    set_by VARCHAR(100) NOT NULL,
+    reason VARCHAR(500) NOT NULL,
+    set_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id)
+)CHARSET=utf8mb4;
+
+-- Audit log of the baseline changes. run_id is 0 when the baseline was cleared
+CREATE TABLE IF NOT EXISTS collection_baseline_history (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    collection_id INT UNSIGNED NOT NULL,
+    run_id INT UNSIGNED NOT NULL,
+    changed_by VARCHAR(100) NOT NULL,
+    reason VARCHAR(500) NOT NULL,
+    changed_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,9 @@
+use setagaya;
+
+CREATE TABLE IF NOT EXISTS collection_calibration_run (
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,15 @@
+use setagaya;
+
+-- Only the latest smoke test of a plan within a collection is kept
+CREATE TABLE IF NOT EXISTS plan_smoke_test (
+    collection_id INT UNSIGNED NOT NULL,
+    plan_id INT UNSIGNED NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    message VARCHAR(1024) NOT NULL DEFAULT '',
+    samples BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    failures BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    p95 DOUBLE NOT NULL DEFAULT 0,
+    started_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, plan_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+use setagaya;
+
+CREATE TABLE IF NOT EXISTS collection_run_failure_capture (
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    plan_id INT UNSIGNED NOT NULL,
+    engine_id INT UNSIGNED NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    samples INT UNSIGNED NOT NULL,
+    PRIMARY KEY (run_id, plan_id, engine_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
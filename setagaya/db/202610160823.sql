@@ -0,0 +1,15 @@
+use setagaya;
+
+CREATE TABLE IF NOT EXISTS collection_run_error (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    label VARCHAR(255) NOT NULL,
+    category VARCHAR(20) NOT NULL,
+    code VARCHAR(255) NOT NULL,
+    message VARCHAR(512) NOT NULL,
+    count BIGINT UNSIGNED NOT NULL,
+    PRIMARY KEY (id),
+    KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,3 @@
+use setagaya;
+
+ALTER TABLE collection_run_summary ADD COLUMN assertions MEDIUMTEXT NULL AFTER histogram;
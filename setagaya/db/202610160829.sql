@@ -0,0 +1,3 @@
+use setagaya;
+
+ALTER TABLE collection_run_summary ADD COLUMN transactions MEDIUMTEXT NULL AFTER assertions;
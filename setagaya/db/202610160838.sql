@@ -0,0 +1,16 @@
+use setagaya;
+
+CREATE TABLE IF NOT EXISTS collection_run_gap (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    plan_id INT UNSIGNED NOT NULL,
+    engine_id INT UNSIGNED NOT NULL,
+    file VARCHAR(255) NOT NULL,
+    start_time DATETIME NOT NULL,
+    end_time DATETIME NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    PRIMARY KEY (id),
+    KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
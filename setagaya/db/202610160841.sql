@@ -0,0 +1,3 @@
+use setagaya;
+
+ALTER TABLE collection_run_gap ADD COLUMN samples BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER reason;
@@ -0,0 +1,13 @@
+use setagaya;
+
+-- Single row counter the run ids are allocated from. The ids used to be the auto increment ids of
+-- collection_run, whose rows are deleted when the runs stop, so the ids could be reused after a restart
+CREATE TABLE IF NOT EXISTS run_id_sequence (
+    id INT UNSIGNED NOT NULL
+)CHARSET=utf8mb4;
+
+INSERT INTO run_id_sequence (id)
+SELECT GREATEST(
+    (SELECT COALESCE(MAX(run_id), 0) FROM collection_run_history),
+    (SELECT COALESCE(MAX(id), 0) FROM collection_run)
+) FROM DUAL WHERE NOT EXISTS (SELECT * FROM run_id_sequence);
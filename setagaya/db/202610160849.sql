@@ -0,0 +1,14 @@
+use setagaya;
+
+-- Responses of the trigger and stop requests sent with an Idempotency-Key header. status_code is 0 while
+-- the request is being handled
+CREATE TABLE IF NOT EXISTS idempotency_key (
+    collection_id INT UNSIGNED NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    response MEDIUMTEXT,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, operation, idempotency_key),
+    KEY (created_time)
+)CHARSET=utf8mb4;
@@ -0,0 +1,17 @@
+use setagaya;
+
+-- Operations run in the background for clients which cannot wait for them, e.g. behind a gateway timeout
+CREATE TABLE IF NOT EXISTS job (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    collection_id INT UNSIGNED NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    result MEDIUMTEXT,
+    error VARCHAR(1024) NOT NULL DEFAULT '',
+    callback_url VARCHAR(1024) NOT NULL DEFAULT '',
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_time TIMESTAMP NULL DEFAULT NULL,
+    PRIMARY KEY (id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,30 @@
+use setagaya;
+
+-- A tenant is a team sharing the platform. It owns the projects of its mailing list and gets its own namespace
+-- in the scheduler and prefix in the object storage. A quota of 0 is unlimited
+CREATE TABLE IF NOT EXISTS tenant (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name VARCHAR(30) NOT NULL,
+    owner VARCHAR(50) NOT NULL,
+    namespace VARCHAR(63) NOT NULL,
+    storage_prefix VARCHAR(255) NOT NULL,
+    max_engines INT UNSIGNED NOT NULL DEFAULT 0,
+    max_running_collections INT UNSIGNED NOT NULL DEFAULT 0,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY (name)
+)CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS tenant_role (
+    tenant_id INT UNSIGNED NOT NULL,
+    name VARCHAR(20) NOT NULL,
+    PRIMARY KEY (tenant_id, name)
+)CHARSET=utf8mb4;
+
+-- The subject is a user or a mailing list
+CREATE TABLE IF NOT EXISTS tenant_role_assignment (
+    tenant_id INT UNSIGNED NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    subject VARCHAR(50) NOT NULL,
+    PRIMARY KEY (tenant_id, role, subject)
+)CHARSET=utf8mb4;
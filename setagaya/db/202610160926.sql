@@ -0,0 +1,9 @@
+use setagaya;
+
+-- Security context of the engines of a project, it replaces the one of the config. Set by the admins only
+CREATE TABLE IF NOT EXISTS project_security_context (
+    project_id INT UNSIGNED NOT NULL,
+    security_context TEXT NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,9 @@
+use setagaya;
+
+-- Custom engine images of a project and the secrets to pull them from private registries
+CREATE TABLE IF NOT EXISTS project_registry (
+    project_id INT UNSIGNED NOT NULL,
+    registry TEXT NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,23 @@
+use setagaya;
+
+-- Actions of the admins that bypass the safeguards of the platform
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    target VARCHAR(255) NOT NULL,
+    detail TEXT NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (created_time)
+)CHARSET=utf8mb4;
+
+-- Image digests the admins allowed to be deployed in spite of the vulnerability policy
+CREATE TABLE IF NOT EXISTS image_policy_override (
+    digest VARCHAR(71) NOT NULL,
+    image VARCHAR(255) NOT NULL,
+    admin VARCHAR(255) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (digest)
+)CHARSET=utf8mb4;
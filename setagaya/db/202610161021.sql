@@ -0,0 +1,9 @@
+use setagaya;
+
+-- Labels and annotations added to all the engine resources of a project
+CREATE TABLE IF NOT EXISTS project_metadata (
+    project_id INT UNSIGNED NOT NULL,
+    metadata TEXT NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id)
+)CHARSET=utf8mb4;
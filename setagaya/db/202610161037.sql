@@ -0,0 +1,3 @@
+use setagaya;
+
+ALTER TABLE collection_plan ADD COLUMN os VARCHAR(10) NOT NULL DEFAULT 'linux';
@@ -0,0 +1,3 @@
+use setagaya;
+
+ALTER TABLE collection_plan ADD COLUMN arch VARCHAR(10) NOT NULL DEFAULT '';
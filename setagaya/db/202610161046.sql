@@ -0,0 +1,3 @@
+use setagaya;
+
+ALTER TABLE collection_plan ADD COLUMN network_shaping TEXT NULL;
@@ -0,0 +1,14 @@
+use setagaya;
+
+-- What the engines were sent when a run was triggered, for the audits reproducing a run
+CREATE TABLE IF NOT EXISTS collection_run_engine_config (
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    plan_id INT UNSIGNED NOT NULL,
+    engine_id INT UNSIGNED NOT NULL,
+    config MEDIUMTEXT NOT NULL,
+    jmx_sha256 VARCHAR(64) NOT NULL DEFAULT '',
+    triggered_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, plan_id, engine_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
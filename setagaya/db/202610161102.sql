@@ -0,0 +1,11 @@
+use setagaya;
+
+-- Everything a run was triggered with, written once when the run starts so the run can be reproduced
+CREATE TABLE IF NOT EXISTS collection_run_manifest (
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    manifest MEDIUMTEXT NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
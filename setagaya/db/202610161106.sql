@@ -0,0 +1,18 @@
+use setagaya;
+
+-- Library of data files of a project, stored once and used by any plan of the project
+CREATE TABLE IF NOT EXISTS project_file (
+    project_id INT UNSIGNED NOT NULL,
+    filename VARCHAR(191) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, filename)
+)CHARSET=utf8mb4;
+
+-- Files of the library the plans use. A file cannot be deleted from the library while plans use it
+CREATE TABLE IF NOT EXISTS plan_shared_file (
+    plan_id INT UNSIGNED NOT NULL,
+    project_id INT UNSIGNED NOT NULL,
+    filename VARCHAR(191) NOT NULL,
+    PRIMARY KEY (plan_id, filename),
+    KEY (project_id, filename)
+)CHARSET=utf8mb4;
@@ -0,0 +1,10 @@
+use setagaya;
+
+-- Index of the content addressed object storage, the sha256 of the content of every file
+CREATE TABLE IF NOT EXISTS object_storage_content (
+    filename VARCHAR(255) NOT NULL,
+    digest CHAR(64) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (filename),
+    KEY (digest)
+)CHARSET=utf8mb4;
@@ -0,0 +1,4 @@
+use setagaya;
+
+-- Region of the bucket the files of the tenant are kept in, the default bucket when it's empty
+ALTER TABLE tenant ADD COLUMN storage_region VARCHAR(50) NOT NULL DEFAULT '';
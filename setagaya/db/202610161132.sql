@@ -0,0 +1,6 @@
+use setagaya;
+
+-- Markdown documenting the intent and the prerequisites of the tests
+ALTER TABLE project ADD COLUMN description TEXT NULL;
+ALTER TABLE plan ADD COLUMN description TEXT NULL;
+ALTER TABLE collection ADD COLUMN description TEXT NULL;
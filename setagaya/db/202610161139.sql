@@ -0,0 +1,20 @@
+use setagaya;
+
+-- Projects, plans and collections pinned by the users
+CREATE TABLE IF NOT EXISTS user_favorite (
+    user VARCHAR(191) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    item_id INT UNSIGNED NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user, kind, item_id)
+)CHARSET=utf8mb4;
+
+-- Projects, plans and collections the users opened lately
+CREATE TABLE IF NOT EXISTS user_recent (
+    user VARCHAR(191) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    item_id INT UNSIGNED NOT NULL,
+    accessed_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user, kind, item_id),
+    KEY (user, accessed_time)
+)CHARSET=utf8mb4;
@@ -0,0 +1,16 @@
+use setagaya;
+
+-- What the users did in the projects, shown to the users of the project
+CREATE TABLE IF NOT EXISTS project_activity (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    project_id INT UNSIGNED NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    target_kind VARCHAR(20) NOT NULL,
+    target_id INT UNSIGNED NOT NULL,
+    target_name VARCHAR(255) NOT NULL DEFAULT '',
+    detail VARCHAR(255) NOT NULL DEFAULT '',
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (project_id, id)
+)CHARSET=utf8mb4;
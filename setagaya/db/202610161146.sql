@@ -0,0 +1,32 @@
+use setagaya;
+
+-- Discussions of the runs. A reply belongs to the thread of a top level comment
+CREATE TABLE IF NOT EXISTS run_comment (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    parent_id INT UNSIGNED NOT NULL DEFAULT 0,
+    author VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (run_id),
+    KEY (parent_id)
+)CHARSET=utf8mb4;
+
+-- Inbox of the users, e.g. the comments they were mentioned in
+CREATE TABLE IF NOT EXISTS user_notification (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user VARCHAR(191) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    run_id INT UNSIGNED NOT NULL,
+    comment_id INT UNSIGNED NOT NULL,
+    message VARCHAR(255) NOT NULL,
+    read_time TIMESTAMP NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (user, id),
+    KEY (comment_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+use setagaya;
+
+-- Public status pages of the runs. Whoever has the token sees the headline figures of the run without signing in
+CREATE TABLE IF NOT EXISTS run_status_page (
+    token VARCHAR(64) NOT NULL,
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (token),
+    UNIQUE KEY (run_id)
+)CHARSET=utf8mb4;
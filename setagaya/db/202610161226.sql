@@ -0,0 +1,14 @@
+use setagaya;
+
+-- Expiring links sharing a run with the people without an account. They are signed, the rows tell the revoked ones
+CREATE TABLE IF NOT EXISTS run_share_link (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    expires_time DATETIME NOT NULL,
+    revoked_time TIMESTAMP NULL DEFAULT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (run_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,21 @@
+use setagaya;
+
+-- Verifications of deployment gates: a run of the collection scored against a baseline run, canary style
+CREATE TABLE IF NOT EXISTS collection_verification (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    collection_id INT UNSIGNED NOT NULL,
+    run_id INT UNSIGNED NOT NULL DEFAULT 0,
+    baseline_run_id INT UNSIGNED NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    score DOUBLE NOT NULL DEFAULT 0,
+    pass_threshold DOUBLE NOT NULL,
+    marginal_threshold DOUBLE NOT NULL,
+    tolerance DOUBLE NOT NULL,
+    metrics TEXT,
+    message VARCHAR(1024) NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,21 @@
+use setagaya;
+
+-- Chaos experiments created at points of the timeline of the runs of a collection
+CREATE TABLE IF NOT EXISTS collection_chaos (
+    collection_id INT UNSIGNED NOT NULL,
+    actions TEXT NOT NULL,
+    PRIMARY KEY (collection_id)
+)CHARSET=utf8mb4;
+
+-- What happened to the system under test during the runs, e.g. the chaos experiments
+CREATE TABLE IF NOT EXISTS collection_run_event (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    event_time DATETIME NOT NULL,
+    kind VARCHAR(30) NOT NULL,
+    message VARCHAR(1024) NOT NULL DEFAULT '',
+    PRIMARY KEY (id),
+    KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
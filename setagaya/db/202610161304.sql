@@ -0,0 +1,4 @@
+use setagaya;
+
+-- Window of the collections keeping a constant load until they are stopped, NULL for the discrete runs
+ALTER TABLE collection ADD COLUMN continuous TEXT NULL;
@@ -0,0 +1,40 @@
+use setagaya;
+
+-- Duration, checkpoints and memory leak threshold of the collections running for days, NULL for the regular runs
+ALTER TABLE collection ADD COLUMN soak TEXT NULL;
+
+CREATE TABLE IF NOT EXISTS collection_run_soak (
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    started_time DATETIME NOT NULL,
+    end_time DATETIME NOT NULL,
+    PRIMARY KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
+
+-- Aggregates of the soak runs saved along the way, so the results do not depend on the engines lasting
+CREATE TABLE IF NOT EXISTS collection_run_checkpoint (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    checkpoint_time DATETIME NOT NULL,
+    summary MEDIUMTEXT NOT NULL,
+    histogram MEDIUMTEXT NOT NULL,
+    PRIMARY KEY (id),
+    KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
+
+-- Results of the engines uploaded at the checkpoints of the soak runs
+CREATE TABLE IF NOT EXISTS collection_run_result_segment (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    plan_id INT UNSIGNED NOT NULL,
+    engine_id INT UNSIGNED NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    samples INT UNSIGNED NOT NULL,
+    PRIMARY KEY (id),
+    KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
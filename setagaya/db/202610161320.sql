@@ -0,0 +1,4 @@
+use setagaya;
+
+-- Seconds the threads of the plans take to stop at the end of the runs
+ALTER TABLE collection_plan ADD COLUMN rampdown INT UNSIGNED NOT NULL DEFAULT 0;
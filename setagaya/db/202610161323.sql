@@ -0,0 +1,4 @@
+use setagaya;
+
+-- How the users of the plans are divided across their engines, NULL when every engine runs the concurrency
+ALTER TABLE collection_plan ADD COLUMN concurrency_distribution TEXT NULL;
@@ -0,0 +1,16 @@
+use setagaya;
+
+-- Plan the plan waits for before starting in the runs, NULL when it starts with the run
+ALTER TABLE collection_plan ADD COLUMN start_after TEXT NULL;
+
+-- Plans of the runs waiting for the plan they start after
+CREATE TABLE IF NOT EXISTS collection_run_pending_plan (
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    plan_id INT UNSIGNED NOT NULL,
+    plan TEXT NOT NULL,
+    engine_data MEDIUMTEXT NOT NULL,
+    created_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, plan_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,5 @@
+use setagaya;
+
+-- Variables passed to the engines of all the plans of the collection, and the ones a plan overrides them with
+ALTER TABLE collection ADD COLUMN variables TEXT NULL;
+ALTER TABLE collection_plan ADD COLUMN variables TEXT NULL;
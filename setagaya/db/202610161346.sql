@@ -0,0 +1,18 @@
+use setagaya;
+
+-- Attempts to deploy the engines of a plan again and to trigger them within the run in progress
+CREATE TABLE IF NOT EXISTS collection_run_plan_retry (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    plan_id INT UNSIGNED NOT NULL,
+    attempt INT UNSIGNED NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    message VARCHAR(1024) NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,6 @@
+use setagaya;
+
+-- Team owning the plan, the files its engines upload during the runs are labelled with it
+ALTER TABLE plan ADD COLUMN team VARCHAR(63) NOT NULL DEFAULT '';
+ALTER TABLE collection_run_failure_capture ADD COLUMN team VARCHAR(63) NOT NULL DEFAULT '';
+ALTER TABLE collection_run_result_segment ADD COLUMN team VARCHAR(63) NOT NULL DEFAULT '';
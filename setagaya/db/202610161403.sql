@@ -0,0 +1,17 @@
+use setagaya;
+
+-- Capacity of the cluster held for the engines of a collection during a window
+CREATE TABLE IF NOT EXISTS collection_reservation (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    collection_id INT UNSIGNED NOT NULL,
+    engines INT UNSIGNED NOT NULL,
+    cpu VARCHAR(20) NOT NULL,
+    mem VARCHAR(20) NOT NULL,
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (collection_id),
+    KEY (end_time)
+)CHARSET=utf8mb4;
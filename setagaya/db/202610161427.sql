@@ -0,0 +1,5 @@
+use setagaya;
+
+-- Versions of the agent and of the engine the engines reported when the run was triggered
+ALTER TABLE collection_run_engine_config ADD COLUMN agent_version VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE collection_run_engine_config ADD COLUMN engine_version VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+use setagaya;
+
+-- Seed of the random values of the engines of the run
+ALTER TABLE collection_run_metadata ADD COLUMN seed BIGINT NULL;
@@ -0,0 +1,4 @@
+use setagaya;
+
+-- Seconds at the start of the plans whose samples are left out of the summary and the SLOs
+ALTER TABLE collection_plan ADD COLUMN warmup INT UNSIGNED NOT NULL DEFAULT 0;
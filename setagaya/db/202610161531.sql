@@ -0,0 +1,15 @@
+use setagaya;
+
+-- Files every run was sent with their checksum, written with the manifest of the run. They tell what uses a version
+-- of a file
+CREATE TABLE IF NOT EXISTS collection_run_file (
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    plan_id INT UNSIGNED NOT NULL,
+    filepath VARCHAR(255) NOT NULL,
+    sha256 CHAR(64) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, plan_id, filepath),
+    KEY (filepath),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+use setagaya;
+
+-- Display name, logo and support links the UI shows to the users of a tenant. The host the UI of the tenant is
+-- served at picks its branding before the users log in
+CREATE TABLE IF NOT EXISTS tenant_branding (
+    tenant_id INT UNSIGNED NOT NULL,
+    host VARCHAR(255) NULL,
+    branding TEXT NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id),
+    UNIQUE KEY (host)
+)CHARSET=utf8mb4;
@@ -0,0 +1,11 @@
+use setagaya;
+
+-- Feature flags turned on or off for a tenant, overriding the feature_flags of the config. A flag without a row
+-- follows the config
+CREATE TABLE IF NOT EXISTS tenant_feature_flag (
+    tenant_id INT UNSIGNED NOT NULL,
+    flag VARCHAR(50) NOT NULL,
+    enabled TINYINT(1) NOT NULL,
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, flag)
+)CHARSET=utf8mb4;
@@ -0,0 +1,13 @@
+use setagaya;
+
+-- Sensitive metadata of the plans, like the references to the credentials of an environment or the secrets signing
+-- the webhooks. The values are encrypted with the key of the secure config
+CREATE TABLE IF NOT EXISTS plan_secret (
+    plan_id INT UNSIGNED NOT NULL,
+    name VARCHAR(63) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    value TEXT NOT NULL,
+    updated_by VARCHAR(50) NOT NULL DEFAULT '',
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (plan_id, name)
+)CHARSET=utf8mb4;
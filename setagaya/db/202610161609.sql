@@ -0,0 +1,4 @@
+use setagaya;
+
+-- Hard cap of the requests per second of every engine of the plans, 0 when they are not capped
+ALTER TABLE collection_plan ADD COLUMN max_engine_rps INT UNSIGNED NOT NULL DEFAULT 0;
@@ -0,0 +1,32 @@
+use setagaya;
+
+-- Engine minutes the projects can use every calendar month, in UTC. The projects without a row have no budget
+CREATE TABLE IF NOT EXISTS project_budget (
+    project_id INT UNSIGNED NOT NULL,
+    monthly_engine_minutes INT UNSIGNED NOT NULL,
+    updated_by VARCHAR(255) NOT NULL DEFAULT '',
+    updated_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id)
+)CHARSET=utf8mb4;
+
+-- Engine minutes the admins added to the budget of a project for a month, once it was exhausted
+CREATE TABLE IF NOT EXISTS project_budget_extension (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    project_id INT UNSIGNED NOT NULL,
+    month CHAR(7) NOT NULL,
+    engine_minutes INT UNSIGNED NOT NULL,
+    granted_by VARCHAR(255) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY (project_id, month)
+)CHARSET=utf8mb4;
+
+-- Thresholds of the budget of the month the projects were warned about, so they are warned once
+CREATE TABLE IF NOT EXISTS project_budget_warning (
+    project_id INT UNSIGNED NOT NULL,
+    month CHAR(7) NOT NULL,
+    threshold INT UNSIGNED NOT NULL,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, month, threshold)
+)CHARSET=utf8mb4;
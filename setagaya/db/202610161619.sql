@@ -0,0 +1,13 @@
+use setagaya;
+
+-- Last heartbeat of the attended-only runs. The controller stops the run when nobody sent one for the timeout
+CREATE TABLE IF NOT EXISTS collection_run_heartbeat (
+    run_id INT UNSIGNED NOT NULL,
+    collection_id INT UNSIGNED NOT NULL,
+    timeout_minutes INT UNSIGNED NOT NULL,
+    last_heartbeat TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_by VARCHAR(255) NOT NULL DEFAULT '',
+    stopping_time TIMESTAMP NULL,
+    PRIMARY KEY (run_id),
+    KEY (collection_id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+use setagaya;
+
+-- TOTP secrets of the admins, for the step-up before the destructive actions. The secrets are encrypted with the key
+-- of the secure config. last_counter is the time step of the last code used, so a code is not used twice
+CREATE TABLE IF NOT EXISTS account_mfa (
+    account VARCHAR(255) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    confirmed TINYINT(1) NOT NULL DEFAULT 0,
+    last_counter BIGINT NOT NULL DEFAULT 0,
+    created_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account)
+)CHARSET=utf8mb4;
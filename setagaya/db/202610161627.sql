@@ -0,0 +1,10 @@
+use setagaya;
+
+-- The platform is read-only while the row exists, during an incident or a change freeze. There is one row at most
+CREATE TABLE IF NOT EXISTS platform_freeze (
+    id TINYINT NOT NULL DEFAULT 1,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    frozen_by VARCHAR(255) NOT NULL,
+    frozen_time TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+)CHARSET=utf8mb4;
@@ -0,0 +1,6 @@
+use setagaya;
+
+-- Invalid TOTP codes entered in a row. Once they reach the limit of the step-up config, the codes of the admin are
+-- refused until locked_until, so the codes cannot be guessed
+ALTER TABLE account_mfa ADD COLUMN failed_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE account_mfa ADD COLUMN locked_until TIMESTAMP NULL DEFAULT NULL;
@@ -0,0 +1,154 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// Fetcher downloads the artifacts the engines need before a run, from the mirror when one is configured. The files
+// are cached by their checksum, so a pod only downloads them once for all of its runs.
+type Fetcher struct {
+	client   *http.Client
+	mirror   string
+	cacheDir string
+}
+
+func NewFetcher(client *http.Client, mirror, cacheDir string) *Fetcher {
+	return &Fetcher{
+		client:   client,
+		mirror:   mirror,
+		cacheDir: cacheDir,
+	}
+}
+
+// MirrorURL is where the artifact is downloaded from. The host and the path of the artifact are appended to the
+// url of the mirror.
+func MirrorURL(mirror, rawURL string) (string, error) {
+	if mirror == "" {
+		return rawURL, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	m, err := url.Parse(mirror)
+	if err != nil {
+		return "", err
+	}
+	m.Path = path.Join(m.Path, u.Host, u.Path)
+	m.RawQuery = u.RawQuery
+	return m.String(), nil
+}
+
+func (f *Fetcher) cachePath(a *config.Artifact) string {
+	return filepath.Join(f.cacheDir, a.SHA256)
+}
+
+// Fetch returns the path of the artifact in the cache. It's downloaded when it's not in the cache yet
+func (f *Fetcher) Fetch(a *config.Artifact) (string, error) {
+	if err := a.Validate(); err != nil {
+		return "", err
+	}
+	cached := f.cachePath(a)
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
+	}
+	src, err := MirrorURL(f.mirror, a.URL)
+	if err != nil {
+		return "", err
+	}
+	resp, err := f.client.Get(src)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading %s responded with %d", src, resp.StatusCode)
+	}
+	if err := os.MkdirAll(f.cacheDir, 0750); err != nil {
+		return "", err
+	}
+	// The file only shows up in the cache once it's complete and verified
+	tmp, err := os.CreateTemp(f.cacheDir, "download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), resp.Body); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != a.SHA256 {
+		return "", fmt.Errorf("checksum of %s is %s, expected %s", src, sum, a.SHA256)
+	}
+	if err := os.Rename(tmp.Name(), cached); err != nil {
+		return "", err
+	}
+	return cached, nil
+}
+
+// Install fetches the artifacts and puts them in the folder of their kind under dir, which is emptied first. It
+// returns the folders of the plugins and of the libraries, empty when there are none of the kind.
+func (f *Fetcher) Install(artifacts []*config.Artifact, dir string) (string, string, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return "", "", err
+	}
+	folders := map[string]string{}
+	for _, a := range artifacts {
+		cached, err := f.Fetch(a)
+		if err != nil {
+			return "", "", err
+		}
+		kind := a.Kind
+		if kind == "" {
+			kind = config.ArtifactKindPlugin
+		}
+		folder := filepath.Join(dir, kind)
+		if err := os.MkdirAll(folder, 0750); err != nil {
+			return "", "", err
+		}
+		folders[kind] = folder
+		u, err := url.Parse(a.URL)
+		if err != nil {
+			return "", "", err
+		}
+		if err := link(cached, filepath.Join(folder, path.Base(u.Path))); err != nil {
+			return "", "", err
+		}
+	}
+	return folders[config.ArtifactKindPlugin], folders[config.ArtifactKindLibrary], nil
+}
+
+// link avoids copying the cached file when it's on the same filesystem
+func link(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
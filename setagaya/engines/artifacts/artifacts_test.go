@@ -0,0 +1,74 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestMirrorURL(t *testing.T) {
+	u, err := MirrorURL("", "https://repo1.maven.org/maven2/kg/apc/cmdrunner/2.3/cmdrunner-2.3.jar")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://repo1.maven.org/maven2/kg/apc/cmdrunner/2.3/cmdrunner-2.3.jar", u)
+
+	u, err = MirrorURL("https://nexus.internal/repository/raw/", "https://repo1.maven.org/maven2/kg/apc/cmdrunner/2.3/cmdrunner-2.3.jar")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://nexus.internal/repository/raw/repo1.maven.org/maven2/kg/apc/cmdrunner/2.3/cmdrunner-2.3.jar", u)
+}
+
+func TestFetcherInstall(t *testing.T) {
+	plugin, library := []byte("plugin"), []byte("library")
+	checksum := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:])
+	}
+	downloads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		switch r.URL.Path {
+		case "/mirror/repo.example.com/plugins/jpgc-casutg.jar":
+			w.Write(plugin)
+		case "/mirror/repo.example.com/libs/json-path.jar":
+			w.Write(library)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	root := t.TempDir()
+	f := NewFetcher(ts.Client(), ts.URL+"/mirror", filepath.Join(root, "cache"))
+	artifacts := []*config.Artifact{
+		{URL: "https://repo.example.com/plugins/jpgc-casutg.jar", SHA256: checksum(plugin)},
+		{URL: "https://repo.example.com/libs/json-path.jar", SHA256: checksum(library), Kind: config.ArtifactKindLibrary},
+	}
+	plugins, libraries, err := f.Install(artifacts, filepath.Join(root, "run"))
+	assert.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(plugins, "jpgc-casutg.jar"))
+	assert.NoError(t, err)
+	assert.Equal(t, plugin, content)
+	content, err = os.ReadFile(filepath.Join(libraries, "json-path.jar"))
+	assert.NoError(t, err)
+	assert.Equal(t, library, content)
+
+	// The next run is served from the cache
+	_, libraries, err = f.Install(artifacts[:1], filepath.Join(root, "run"))
+	assert.NoError(t, err)
+	assert.Equal(t, "", libraries)
+	assert.Equal(t, 2, downloads)
+
+	// A file that does not match its checksum is not cached
+	tampered := &config.Artifact{URL: "https://repo.example.com/plugins/jpgc-casutg.jar", SHA256: checksum([]byte("tampered"))}
+	_, err = f.Fetch(tampered)
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(root, "cache", tampered.SHA256))
+	assert.True(t, os.IsNotExist(err))
+}
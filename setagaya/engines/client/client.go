@@ -0,0 +1,342 @@
+// Package client talks to the agents of the engines over the HTTP API the agents of every engine type serve. The
+// controller drives the engines with it, and the tests check the agents keep to the same contract.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/utils"
+)
+
+var (
+	// ErrFilesMissing is returned when the engine could not download some of the test files
+	ErrFilesMissing = errors.New("some test files are missing")
+	// ErrNotRunning is returned when the request needs the engine to run a test and it does not
+	ErrNotRunning = errors.New("engine is not running")
+	// ErrBusy is returned when the engine is busy with another execution
+	ErrBusy = errors.New("engine is busy with another execution")
+	// ErrInvalidRequest is returned when the engine refused the request, the StatusError wrapping it has the reason
+	ErrInvalidRequest = errors.New("invalid request")
+)
+
+// StatusError is an answer of the engine with a status the request does not expect
+type StatusError struct {
+	// What the engine failed to do, e.g. "trigger"
+	Operation  string
+	StatusCode int
+	Status     string
+	// Body of the answer, for the errors the engine explains
+	Message string
+	// Kind of the error, nil when the status is not expected at all
+	Err error
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("engine failed to %s: %d %s: %s", e.Operation, e.StatusCode, e.Status, e.Message)
+	}
+	return fmt.Sprintf("engine failed to %s: %d %s", e.Operation, e.StatusCode, e.Status)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+func statusError(operation string, resp *http.Response, kind error) *StatusError {
+	return &StatusError{Operation: operation, StatusCode: resp.StatusCode, Status: resp.Status, Err: kind}
+}
+
+// Client is the client of the agent of a single engine
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	// Retries the requests which are retried, the start and the progress of the engine
+	retry func(ctx context.Context, attempt func() error, exempt error) error
+	// How long the stream of batches waits before reconnecting
+	batchesReconnectDelay time.Duration
+}
+
+// New returns the client of the engine at engineURL, which is a host and a port when it has no scheme
+func New(engineURL string, httpClient *http.Client) *Client {
+	if !strings.Contains(engineURL, "http") {
+		engineURL = "http://" + engineURL
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(engineURL, "/"),
+		httpClient: httpClient,
+		retry:      utils.RetryContext,
+
+		batchesReconnectDelay: defaultBatchesReconnectDelay,
+	}
+}
+
+// URL is the url of the endpoint of the agent
+func (c *Client) URL(endpoint string) string {
+	return fmt.Sprintf("%s/%s", c.baseURL, endpoint)
+}
+
+func (c *Client) do(ctx context.Context, method, endpoint string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.URL(endpoint), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.httpClient.Do(req)
+}
+
+// get decodes the answer of the engine to the GET of the endpoint into v. missing tells whether the engine does not
+// serve the endpoint, v is left as it is then.
+func (c *Client) get(ctx context.Context, endpoint, operation string, v any) (missing bool, err error) {
+	return c.send(ctx, http.MethodGet, endpoint, operation, nil, v)
+}
+
+// send sends the body to the endpoint and decodes the answer into v, like get
+func (c *Client) send(ctx context.Context, method, endpoint, operation string, body, v any) (missing bool, err error) {
+	resp, err := c.do(ctx, method, endpoint, body)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, statusError(operation, resp, nil)
+	}
+	return false, json.NewDecoder(resp.Body).Decode(v)
+}
+
+// StartResult is what the engine tells when it starts a test
+type StartResult struct {
+	// The engine was running a test already, the other fields are empty
+	AlreadyStarted bool
+	// Sha256 of the test plan as the engine modified it
+	JMXSHA256     string
+	AgentVersion  string
+	EngineVersion string
+	// The heavy listeners of the test plan the engine disabled
+	StrippedListeners []string
+}
+
+// Start starts the test of edc. It's retried until the engine is up, unless its test files are missing.
+func (c *Client) Start(ctx context.Context, edc *enginesModel.EngineDataConfig) (*StartResult, error) {
+	var result *StartResult
+	err := c.retry(ctx, func() error {
+		resp, err := c.do(ctx, http.MethodPost, "start", edc)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusConflict:
+			result = &StartResult{AlreadyStarted: true}
+			return nil
+		case http.StatusNotFound:
+			return statusError("trigger", resp, ErrFilesMissing)
+		default:
+			return statusError("trigger", resp, nil)
+		}
+		result = &StartResult{
+			JMXSHA256:         resp.Header.Get(enginesModel.JMXChecksumHeader),
+			AgentVersion:      resp.Header.Get(enginesModel.AgentVersionHeader),
+			EngineVersion:     resp.Header.Get(enginesModel.EngineVersionHeader),
+			StrippedListeners: enginesModel.StrippedListeners(resp.Header),
+		}
+		return nil
+	}, ErrFilesMissing)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Stop stops the test the engine is running
+func (c *Client) Stop(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodPost, "stop", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+// Progress tells whether the engine is running a test. It's retried when the engine cannot be reached.
+func (c *Client) Progress(ctx context.Context) (bool, error) {
+	var running bool
+	err := c.retry(ctx, func() error {
+		resp, err := c.do(ctx, http.MethodGet, "progress", nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		running = resp.StatusCode == http.StatusOK
+		return nil
+	}, nil)
+	return running, err
+}
+
+// Version returns the version of the agent and the protocol it speaks. The agents built before the handshake have no
+// /version endpoint, they speak the protocol 0.
+func (c *Client) Version(ctx context.Context) (*enginesModel.EngineVersion, error) {
+	ev := new(enginesModel.EngineVersion)
+	if _, err := c.get(ctx, "version", "return its version", ev); err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// Histogram returns the latency digest of the current run
+func (c *Client) Histogram(ctx context.Context) (*enginesModel.LatencyHistogram, error) {
+	h := enginesModel.NewLatencyHistogram()
+	if missing, err := c.get(ctx, "histogram", "return histogram", h); err != nil || missing {
+		return nil, missingEndpoint("return histogram", err)
+	}
+	return h, nil
+}
+
+// ErrorStats returns the failed samples of the current run
+func (c *Client) ErrorStats(ctx context.Context) (*enginesModel.ErrorStats, error) {
+	es := enginesModel.NewErrorStats()
+	if missing, err := c.get(ctx, "errors", "return errors", es); err != nil || missing {
+		return nil, missingEndpoint("return errors", err)
+	}
+	return es, nil
+}
+
+// Assertions returns the assertion results of the current run
+func (c *Client) Assertions(ctx context.Context) (*enginesModel.AssertionStats, error) {
+	as := enginesModel.NewAssertionStats()
+	if missing, err := c.get(ctx, "assertions", "return assertions", as); err != nil || missing {
+		return nil, missingEndpoint("return assertions", err)
+	}
+	return as, nil
+}
+
+// Transactions returns the transaction controller samples of the current run. The engines without transaction
+// controllers, e.g. playwright, return an empty result.
+func (c *Client) Transactions(ctx context.Context) (*enginesModel.TransactionStats, error) {
+	ts := enginesModel.NewTransactionStats()
+	if _, err := c.get(ctx, "transactions", "return transactions", ts); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// Gaps returns the periods of the current run whose samples are missing from the results. The engines which do not
+// report them return none.
+func (c *Client) Gaps(ctx context.Context) ([]*enginesModel.ResultGap, error) {
+	var gaps []*enginesModel.ResultGap
+	if _, err := c.get(ctx, "gaps", "return gaps", &gaps); err != nil {
+		return nil, err
+	}
+	return gaps, nil
+}
+
+// Failures asks the engine to upload the failing responses it captured in the current run, to the signed url when
+// it's given. The engines which do not capture them return an empty file.
+func (c *Client) Failures(ctx context.Context, fr *enginesModel.FailuresRequest) (*model.FailureCaptureFile, error) {
+	fcf := new(model.FailureCaptureFile)
+	if _, err := c.send(ctx, http.MethodPost, "failures", "upload failures", fr, fcf); err != nil {
+		return nil, err
+	}
+	return fcf, nil
+}
+
+// ResultSegment asks the engine to upload the samples it read since the previous checkpoint of the soak run. The
+// engines which do not keep result segments return an empty segment.
+func (c *Client) ResultSegment(ctx context.Context, req *enginesModel.ResultSegmentRequest) (*model.ResultSegment, error) {
+	rs := new(model.ResultSegment)
+	if _, err := c.send(ctx, http.MethodPost, "segments", "upload the result segment", req, rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// PushProperties changes the properties of the test the engine is running
+func (c *Client) PushProperties(ctx context.Context, rpr *enginesModel.RuntimePropertiesRequest) error {
+	resp, err := c.do(ctx, http.MethodPost, "properties", rpr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return ErrNotRunning
+	}
+	return statusError("change the properties", resp, nil)
+}
+
+// Rampdown stops the threads of the test the engine is running one by one over the seconds
+func (c *Client) Rampdown(ctx context.Context, rr *enginesModel.RampdownRequest) error {
+	resp, err := c.do(ctx, http.MethodPost, "rampdown", rr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return ErrNotRunning
+	}
+	return statusError("ramp down", resp, nil)
+}
+
+// Debug runs the samplers of the debug request once and returns what they sent and received
+func (c *Client) Debug(ctx context.Context, dr *enginesModel.DebugRequest) (*enginesModel.DebugResult, error) {
+	resp, err := c.do(ctx, http.MethodPost, "debug", dr)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		return nil, statusError("debug", resp, ErrBusy)
+	case http.StatusNotFound:
+		return nil, statusError("debug", resp, ErrFilesMissing)
+	case http.StatusBadRequest:
+		se := statusError("debug", resp, ErrInvalidRequest)
+		message, _ := io.ReadAll(resp.Body)
+		se.Message = string(bytes.TrimSpace(message))
+		return nil, se
+	default:
+		return nil, statusError("debug", resp, nil)
+	}
+	r := new(enginesModel.DebugResult)
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// missingEndpoint is the error of the endpoints every engine serves, err when there is one
+func missingEndpoint(operation string, err error) error {
+	if err != nil {
+		return err
+	}
+	return &StatusError{Operation: operation, StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+}
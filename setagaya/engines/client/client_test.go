@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+// newTestClient returns the client of an agent answering with handler, retrying 3 times without waiting
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	c := New(ts.URL, &http.Client{Timeout: 5 * time.Second})
+	c.retry = func(ctx context.Context, attempt func() error, exempt error) error {
+		var err error
+		for i := 0; i < 3; i++ {
+			if err = attempt(); err == nil || errors.Is(err, exempt) {
+				return err
+			}
+		}
+		return err
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	assert.Equal(t, "http://engine-1:8080/start", New("engine-1:8080", http.DefaultClient).URL("start"))
+	assert.Equal(t, "https://engines.local/p1/start", New("https://engines.local/p1/", http.DefaultClient).URL("start"))
+}
+
+func TestStart(t *testing.T) {
+	status := http.StatusOK
+	calls := 0
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/start", r.URL.Path)
+		edc := new(enginesModel.EngineDataConfig)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(edc))
+		assert.Equal(t, int64(7), edc.RunID)
+		(&enginesModel.EngineVersion{Agent: "v1.3.0", EngineVersion: "5.6.3"}).SetHeaders(w.Header())
+		enginesModel.SetStrippedListeners(w.Header(), []string{"View Results Tree"})
+		w.Header().Set(enginesModel.JMXChecksumHeader, "abc")
+		w.WriteHeader(status)
+	})
+	edc := &enginesModel.EngineDataConfig{RunID: 7}
+
+	result, err := c.Start(context.Background(), edc)
+	assert.NoError(t, err)
+	assert.Equal(t, &StartResult{JMXSHA256: "abc", AgentVersion: "v1.3.0", EngineVersion: "5.6.3",
+		StrippedListeners: []string{"View Results Tree"}}, result)
+
+	status = http.StatusConflict
+	result, err = c.Start(context.Background(), edc)
+	assert.NoError(t, err)
+	assert.True(t, result.AlreadyStarted)
+
+	// The missing files are not retried
+	status, calls = http.StatusNotFound, 0
+	_, err = c.Start(context.Background(), edc)
+	assert.ErrorIs(t, err, ErrFilesMissing)
+	assert.Equal(t, 1, calls)
+
+	status, calls = http.StatusServiceUnavailable, 0
+	_, err = c.Start(context.Background(), edc)
+	var se *StatusError
+	assert.ErrorAs(t, err, &se)
+	assert.Equal(t, http.StatusServiceUnavailable, se.StatusCode)
+	assert.Equal(t, 3, calls)
+}
+
+func TestProgressAndStop(t *testing.T) {
+	running := true
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stop":
+			assert.Equal(t, http.MethodPost, r.Method)
+			running = false
+		case "/progress":
+			if !running {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}
+	})
+	ctx := context.Background()
+	r, err := c.Progress(ctx)
+	assert.NoError(t, err)
+	assert.True(t, r)
+	assert.NoError(t, c.Stop(ctx))
+	r, err = c.Progress(ctx)
+	assert.NoError(t, err)
+	assert.False(t, r)
+}
+
+func TestDigests(t *testing.T) {
+	missing := map[string]bool{}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if missing[r.URL.Path] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Path {
+		case "/version":
+			fmt.Fprint(w, `{"agent": "v1.2.0", "engine": "jmeter", "engine_version": "5.6.3", "protocol": 1}`)
+		case "/histogram":
+			h := enginesModel.NewLatencyHistogram()
+			h.Observe(120)
+			json.NewEncoder(w).Encode(h)
+		case "/gaps":
+			json.NewEncoder(w).Encode([]*enginesModel.ResultGap{{Reason: "the results file was rotated"}})
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	})
+	ctx := context.Background()
+
+	v, err := c.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v.Protocol)
+	h, err := c.Histogram(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), h.Total)
+	gaps, err := c.Gaps(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, gaps, 1)
+	_, err = c.Transactions(ctx)
+	assert.NoError(t, err)
+
+	// The endpoints the older agents or the other engine types do not serve
+	for _, endpoint := range []string{"/version", "/histogram", "/gaps", "/transactions", "/failures", "/segments"} {
+		missing[endpoint] = true
+	}
+	v, err = c.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, v.Protocol)
+	_, err = c.Histogram(ctx)
+	assert.Error(t, err)
+	gaps, err = c.Gaps(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, gaps)
+	ts, err := c.Transactions(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, ts.Labels)
+	fcf, err := c.Failures(ctx, &enginesModel.FailuresRequest{})
+	assert.NoError(t, err)
+	assert.Empty(t, fcf.Filename)
+	_, err = c.ResultSegment(ctx, &enginesModel.ResultSegmentRequest{})
+	assert.NoError(t, err)
+}
+
+func TestPushProperties(t *testing.T) {
+	status := http.StatusOK
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	rpr := &enginesModel.RuntimePropertiesRequest{}
+	assert.NoError(t, c.PushProperties(context.Background(), rpr))
+	status = http.StatusConflict
+	assert.ErrorIs(t, c.PushProperties(context.Background(), rpr), ErrNotRunning)
+	status = http.StatusInternalServerError
+	assert.EqualError(t, c.PushProperties(context.Background(), rpr),
+		"engine failed to change the properties: 500 500 Internal Server Error")
+}
+
+func TestRampdown(t *testing.T) {
+	status := http.StatusOK
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rampdown", r.URL.Path)
+		w.WriteHeader(status)
+	})
+	rr := &enginesModel.RampdownRequest{Seconds: 60}
+	assert.NoError(t, c.Rampdown(context.Background(), rr))
+	status = http.StatusConflict
+	assert.ErrorIs(t, c.Rampdown(context.Background(), rr), ErrNotRunning)
+	status = http.StatusNotFound
+	assert.EqualError(t, c.Rampdown(context.Background(), rr), "engine failed to ramp down: 404 404 Not Found")
+}
+
+func TestDebug(t *testing.T) {
+	status := http.StatusBadRequest
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/debug", r.URL.Path)
+		w.WriteHeader(status)
+		if status == http.StatusBadRequest {
+			fmt.Fprint(w, "unknown sampler login\n")
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+	dr := &enginesModel.DebugRequest{Samplers: []string{"login"}}
+
+	_, err := c.Debug(context.Background(), dr)
+	assert.ErrorIs(t, err, ErrInvalidRequest)
+	var se *StatusError
+	assert.ErrorAs(t, err, &se)
+	assert.Equal(t, "unknown sampler login", se.Message)
+
+	status = http.StatusConflict
+	_, err = c.Debug(context.Background(), dr)
+	assert.ErrorIs(t, err, ErrBusy)
+
+	status = http.StatusOK
+	r, err := c.Debug(context.Background(), dr)
+	assert.NoError(t, err)
+	assert.NotNil(t, r)
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+// fakeStreamingAgent serves the samples of an agent at /stream and /stream/batches, as the agents number and resume
+// them. The connection is cut after cut events when it's set.
+type fakeStreamingAgent struct {
+	samples int
+	cut     int
+	// Bytes written to the subscribers
+	written atomic.Int64
+}
+
+func (a *fakeStreamingAgent) events(r *http.Request) []enginesModel.StreamEvent {
+	b := enginesModel.NewStreamBuffer(a.samples)
+	for i := 0; i < a.samples; i++ {
+		b.Add(fmt.Sprintf("1760000000%03d,120,login,200", i%1000))
+	}
+	last, resume := enginesModel.ParseStreamEventID(r.Header.Get("Last-Event-ID"))
+	if !resume {
+		return b.Since(enginesModel.StreamEventID{})
+	}
+	// The numbering of the fake agent starts over with every connection, it keeps the epoch of the subscriber
+	events := b.Since(enginesModel.StreamEventID{})
+	for i := range events {
+		events[i].ID.Epoch = last.Epoch
+	}
+	return events[last.Seq:]
+}
+
+func (a *fakeStreamingAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	events := a.events(r)
+	if a.cut > 0 && len(events) > a.cut {
+		events = events[:a.cut]
+	}
+	counter := &countingWriter{w: w, written: &a.written}
+	switch r.URL.Path {
+	case "/stream":
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, ev := range events {
+			fmt.Fprintf(counter, "id: %s\ndata: %s\n\n", ev.ID, ev.Data)
+		}
+	case "/stream/batches":
+		ch := make(chan enginesModel.StreamEvent)
+		go func() {
+			for _, ev := range events {
+				ch <- ev
+			}
+			close(ch)
+		}()
+		enginesModel.WriteStreamBatches(counter, w.(http.Flusher).Flush, ch, enginesModel.DefaultStreamBatchSize,
+			enginesModel.StreamBatchInterval)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.(http.Flusher).Flush()
+	if a.cut == 0 {
+		<-r.Context().Done()
+	}
+}
+
+type countingWriter struct {
+	w       http.ResponseWriter
+	written *atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.written.Add(int64(len(p)))
+	return cw.w.Write(p)
+}
+
+// receive reads n events of the stream, the interruptions are counted
+func receive(t testing.TB, stream *Stream, n int) (events []*Event, interruptions int) {
+	timeout := time.After(30 * time.Second)
+	for len(events) < n {
+		select {
+		case ev := <-stream.Events:
+			events = append(events, ev)
+		case <-stream.Errors:
+			interruptions++
+		case <-timeout:
+			t.Errorf("received %d events out of %d", len(events), n)
+			return events, interruptions
+		}
+	}
+	return events, interruptions
+}
+
+func TestSubscribe(t *testing.T) {
+	id := enginesModel.StreamEventID{Epoch: 100, Seq: 1, Timestamp: 120}
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/stream", r.URL.Path)
+		w.Header().Set("Content-Type", "text/event-stream")
+		// As the agents write their events
+		fmt.Fprintf(w, "id: %s\ndata: %s\n\n", id, "1700000000000,120,login,200")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	stream, err := c.Subscribe(context.Background())
+	assert.NoError(t, err)
+	defer stream.Close()
+
+	events, _ := receive(t, stream, 1)
+	assert.Len(t, events, 1)
+	assert.True(t, events[0].Numbered)
+	assert.Equal(t, id, events[0].ID)
+	assert.Equal(t, "1700000000000,120,login,200", events[0].Data)
+}
+
+func TestSubscribeBatches(t *testing.T) {
+	agent := &fakeStreamingAgent{samples: 5, cut: 3}
+	ts := httptest.NewServer(agent)
+	defer ts.Close()
+
+	c := New(ts.URL, http.DefaultClient)
+	c.batchesReconnectDelay = time.Millisecond
+	stream, err := c.SubscribeBatches(context.Background())
+	assert.NoError(t, err)
+	defer stream.Close()
+
+	// The stream is cut after 3 events and resumes from the 4th
+	events, interruptions := receive(t, stream, 5)
+	assert.Len(t, events, 5)
+	assert.GreaterOrEqual(t, interruptions, 1)
+	for i, ev := range events {
+		assert.True(t, ev.Numbered)
+		assert.Equal(t, uint64(i+1), ev.ID.Seq)
+		assert.Equal(t, events[0].ID.Epoch, ev.ID.Epoch)
+	}
+	assert.Equal(t, "1760000000004,120,login,200", events[4].Data)
+}
+
+func TestSubscribeBatchesUnsupported(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	_, err := c.SubscribeBatches(context.Background())
+	assert.ErrorIs(t, err, ErrBatchesUnsupported)
+}
+
+// BenchmarkStreams streams the samples of a fleet of 1000 engines to a single subscriber over both transports. Run
+// it with -bench Streams -benchtime 1x, it reports the bytes sent for every sample along with the time.
+func BenchmarkStreams(b *testing.B) {
+	const engines, samples = 1000, 1000
+	for _, transport := range []string{"sse", "batch"} {
+		b.Run(transport, func(b *testing.B) {
+			agent := &fakeStreamingAgent{samples: samples}
+			ts := httptest.NewServer(agent)
+			defer ts.Close()
+			// A connection for every engine, as the controller does
+			ts.Config.SetKeepAlivesEnabled(false)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				agent.written.Store(0)
+				var wg sync.WaitGroup
+				var lost atomic.Int64
+				for e := 0; e < engines; e++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						c := New(ts.URL, http.DefaultClient)
+						subscribe := c.Subscribe
+						if transport == "batch" {
+							subscribe = c.SubscribeBatches
+						}
+						stream, err := subscribe(context.Background())
+						if err != nil {
+							b.Error(err)
+							return
+						}
+						defer stream.Close()
+						events, _ := receive(b, stream, samples)
+						lost.Add(int64(samples - len(events)))
+					}()
+				}
+				wg.Wait()
+				b.ReportMetric(float64(agent.written.Load())/(engines*samples), "bytes/sample")
+				b.ReportMetric(float64(lost.Load()), "lost")
+			}
+			b.ReportMetric(float64(b.N*engines*samples)/b.Elapsed().Seconds(), "samples/s")
+		})
+	}
+}
@@ -2,65 +2,111 @@ package containerstats
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
-	cgroupV2Path = "/sys/fs/cgroup/cgroup.controllers"
+	cgroupRoot   = "/sys/fs/cgroup"
+	cgroupV2Path = cgroupRoot + "/cgroup.controllers"
+	// Where the process finds its cgroup when the container does not have a cgroup namespace of its own
+	selfCgroupPath = "/proc/self/cgroup"
 )
 
+// The resources the kernel reports the pressure of
+const (
+	PressureCPU    = "cpu"
+	PressureMemory = "memory"
+	PressureIO     = "io"
+)
+
+var PressureResources = []string{PressureCPU, PressureMemory, PressureIO}
+
+// ErrPressureUnavailable is returned on cgroup v1, and on the kernels without pressure stall information
+var ErrPressureUnavailable = errors.New("pressure stall information is not available")
+
 var (
-	cgroupVersion      = ""
-	noContentError     = "No content in the file %s"
-	cpuByCgroupVersion = map[string]StatsParser{
-		"v2": {
-			path:   "/sys/fs/cgroup/cpu.stat",
-			parser: readCPUStatFileV2,
-		},
-		"v1": {
-			path:   "/sys/fs/cgroup/cpu,cpuacct/cpuacct.usage",
-			parser: readCPUStatFileV1,
-		},
-	}
-	memByCgroupVersion = map[string]StatsParser{
-		"v2": {
-			path:   "/sys/fs/cgroup/memory.current",
-			parser: readMemoryStatFile,
-		},
-		"v1": {
-			path:   "/sys/fs/cgroup/memory/memory.usage_in_bytes",
-			parser: readMemoryStatFile,
-		},
-	}
+	noContentError = "No content in the file %s"
+	detectOnce     sync.Once
+	detected       *cgroup
 )
 
-type StatsParser struct {
-	path   string
-	parser func(path string) (uint64, error)
+// cgroup is the hierarchy the engine runs in. On cgroup v2, the files of the engine are in its own directory of the
+// unified hierarchy.
+type cgroup struct {
+	version string
+	dir     string
 }
 
-func (sp StatsParser) readUsage() (uint64, error) {
-	return sp.parser(sp.path)
+func (cg *cgroup) cpuUsage() (uint64, error) {
+	if cg.version == "v1" {
+		return readCPUStatFileV1(cgroupRoot + "/cpu,cpuacct/cpuacct.usage")
+	}
+	return readCPUStatFileV2(cg.dir + "/cpu.stat")
+}
+
+func (cg *cgroup) memoryUsage() (uint64, error) {
+	if cg.version == "v1" {
+		return readMemoryStatFile(cgroupRoot + "/memory/memory.usage_in_bytes")
+	}
+	return readMemoryStatFile(cg.dir + "/memory.current")
 }
 
-func detectCgroupVersion() string {
-	if cgroupVersion != "" {
-		return cgroupVersion
+func (cg *cgroup) pressure(resource string) (*Pressure, error) {
+	if cg.version == "v1" {
+		return nil, ErrPressureUnavailable
 	}
-	if _, err := os.Stat(cgroupV2Path); err == nil {
-		cgroupVersion = "v2"
-		return cgroupVersion
+	t, err := head(cg.dir+"/"+resource+".pressure", 2)
+	if err != nil {
+		// The files exist but cannot be read when the kernel was booted with psi=0
+		return nil, fmt.Errorf("%w: %v", ErrPressureUnavailable, err)
+	}
+	return parsePressure(t)
+}
+
+// v2Dir is the directory of the cgroup of the process in the unified hierarchy. The line of cgroup v2 in
+// /proc/self/cgroup is like 0::/kubepods/pod1234/abcd. It's the root when the container has a cgroup namespace.
+func v2Dir(selfCgroup []string, exists func(string) bool) string {
+	for _, line := range selfCgroup {
+		p, ok := strings.CutPrefix(line, "0::")
+		if !ok {
+			continue
+		}
+		dir := path.Join(cgroupRoot, path.Clean("/"+p))
+		if dir != cgroupRoot && exists(dir+"/cpu.stat") {
+			return dir
+		}
 	}
-	cgroupVersion = "v1"
-	return cgroupVersion
+	return cgroupRoot
+}
+
+func detectCgroup() *cgroup {
+	detectOnce.Do(func() {
+		if _, err := os.Stat(cgroupV2Path); err != nil {
+			detected = &cgroup{version: "v1", dir: cgroupRoot}
+			return
+		}
+		var selfCgroup []string
+		if content, err := os.ReadFile(selfCgroupPath); err == nil {
+			selfCgroup = strings.Split(string(content), "\n")
+		}
+		detected = &cgroup{version: "v2", dir: v2Dir(selfCgroup, func(p string) bool {
+			_, err := os.Stat(p)
+			return err == nil
+		})}
+	})
+	return detected
 }
 
+// head reads the first nol lines of the file, all of them when nol is 0
 func head(path string, nol int) ([]string, error) {
 	// Validate that the path is within the expected cgroup directories for security
-	if !strings.HasPrefix(path, "/sys/fs/cgroup/") {
+	if !strings.HasPrefix(path, cgroupRoot+"/") {
 		return nil, fmt.Errorf("invalid cgroup path: %s", path)
 	}
 
@@ -69,6 +115,7 @@ func head(path string, nol int) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 	scanner := bufio.NewScanner(file)
 	scanned := 0
 	r := []string{}
@@ -79,9 +126,10 @@ func head(path string, nol int) ([]string, error) {
 			break
 		}
 	}
-	return r, nil
+	return r, scanner.Err()
 }
 
+// cpuacct.usage is in nanoseconds
 func readCPUStatFileV1(path string) (uint64, error) {
 	t, err := head(path, 1)
 	if err != nil {
@@ -90,19 +138,33 @@ func readCPUStatFileV1(path string) (uint64, error) {
 	if len(t) == 0 {
 		return 0, fmt.Errorf(noContentError, path)
 	}
-	return strconv.ParseUint(t[0], 10, 64)
+	ns, err := strconv.ParseUint(t[0], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return ns / 1000, nil
 }
 
 func readCPUStatFileV2(path string) (uint64, error) {
-	t, err := head(path, 1)
+	t, err := head(path, 0)
 	if err != nil {
 		return 0, err
 	}
 	if len(t) == 0 {
 		return 0, fmt.Errorf(noContentError, path)
 	}
-	firstLine := t[0]
-	return strconv.ParseUint(strings.Split(firstLine, " ")[1], 10, 64)
+	return parseCPUStatV2(t)
+}
+
+// parseCPUStatV2 reads the usage_usec line of cpu.stat
+func parseCPUStatV2(lines []string) (uint64, error) {
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "usage_usec" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, errors.New("no usage_usec in cpu.stat")
 }
 
 func readMemoryStatFile(path string) (uint64, error) {
@@ -116,18 +178,77 @@ func readMemoryStatFile(path string) (uint64, error) {
 	return strconv.ParseUint(t[0], 10, 64)
 }
 
-func readUsage(m map[string]StatsParser) (uint64, error) {
-	cgroupVersion := detectCgroupVersion()
-	sp := m[cgroupVersion]
-	return sp.readUsage()
+// PressureStall is the share of the time, in percent, some or all the tasks of the cgroup were stalled on a
+// resource, averaged over the last 10, 60 and 300 seconds. Total is the time stalled in microseconds.
+type PressureStall struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64
+}
+
+// Pressure is the pressure stall information of a resource. Full is nil when the kernel does not report it, like
+// for the cpu before 5.13.
+type Pressure struct {
+	Some *PressureStall
+	Full *PressureStall
+}
+
+// parsePressure reads the lines of a pressure file, like
+// some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func parsePressure(lines []string) (*Pressure, error) {
+	p := new(Pressure)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		ps := new(PressureStall)
+		for _, f := range fields[1:] {
+			k, v, ok := strings.Cut(f, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid pressure field %q", f)
+			}
+			var err error
+			switch k {
+			case "avg10":
+				ps.Avg10, err = strconv.ParseFloat(v, 64)
+			case "avg60":
+				ps.Avg60, err = strconv.ParseFloat(v, 64)
+			case "avg300":
+				ps.Avg300, err = strconv.ParseFloat(v, 64)
+			case "total":
+				ps.Total, err = strconv.ParseUint(v, 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid pressure field %q: %w", f, err)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			p.Some = ps
+		case "full":
+			p.Full = ps
+		}
+	}
+	if p.Some == nil {
+		return nil, errors.New("no some line in the pressure file")
+	}
+	return p, nil
 }
 
 // Return the raw usage in microseconds
 func ReadCPUUsage() (uint64, error) {
-	return readUsage(cpuByCgroupVersion)
+	return detectCgroup().cpuUsage()
 }
 
 // Return the RSS memory in bytes
 func ReadMemoryUsage() (uint64, error) {
-	return readUsage(memByCgroupVersion)
+	return detectCgroup().memoryUsage()
+}
+
+// ReadPressure returns the pressure stall information of the resource, one of PressureResources. It's only
+// available on cgroup v2.
+func ReadPressure(resource string) (*Pressure, error) {
+	return detectCgroup().pressure(resource)
 }
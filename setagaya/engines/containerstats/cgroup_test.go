@@ -0,0 +1,57 @@
+package containerstats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUStatV2(t *testing.T) {
+	usage, err := parseCPUStatV2([]string{"usage_usec 123456", "user_usec 100000", "system_usec 23456"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(123456), usage)
+
+	// The kernels with the pressure of the cpu list other fields first
+	usage, err = parseCPUStatV2([]string{"nr_periods 0", "usage_usec 42"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), usage)
+
+	_, err = parseCPUStatV2([]string{"user_usec 100000"})
+	assert.Error(t, err)
+}
+
+func TestParsePressure(t *testing.T) {
+	p, err := parsePressure([]string{
+		"some avg10=1.50 avg60=0.75 avg300=0.10 total=123456",
+		"full avg10=0.50 avg60=0.25 avg300=0.00 total=2345",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &PressureStall{Avg10: 1.5, Avg60: 0.75, Avg300: 0.1, Total: 123456}, p.Some)
+	assert.Equal(t, &PressureStall{Avg10: 0.5, Avg60: 0.25, Total: 2345}, p.Full)
+
+	p, err = parsePressure([]string{"some avg10=0.00 avg60=0.00 avg300=0.00 total=0"})
+	assert.NoError(t, err)
+	assert.Nil(t, p.Full)
+
+	_, err = parsePressure([]string{"some avg10=high"})
+	assert.Error(t, err)
+	_, err = parsePressure([]string{"some avg10"})
+	assert.Error(t, err)
+	_, err = parsePressure(nil)
+	assert.Error(t, err)
+}
+
+func TestV2Dir(t *testing.T) {
+	exists := func(p string) bool {
+		return p == "/sys/fs/cgroup/kubepods/pod1/abcd/cpu.stat"
+	}
+	assert.Equal(t, "/sys/fs/cgroup/kubepods/pod1/abcd",
+		v2Dir([]string{"0::/kubepods/pod1/abcd", ""}, exists))
+	// With a cgroup namespace, the cgroup of the container is the root
+	assert.Equal(t, cgroupRoot, v2Dir([]string{"0::/"}, exists))
+	assert.Equal(t, cgroupRoot, v2Dir([]string{"0::/elsewhere"}, exists))
+	assert.Equal(t, cgroupRoot, v2Dir([]string{"0::/../../etc"}, exists))
+	assert.Equal(t, cgroupRoot, v2Dir(nil, exists))
+	// The lines of the cgroup v1 controllers are skipped
+	assert.Equal(t, cgroupRoot, v2Dir([]string{"4:cpu,cpuacct:/kubepods/pod1/abcd"}, exists))
+}
@@ -0,0 +1,27 @@
+package containerstats
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+)
+
+// CPUFactorsEnv holds what a core of each architecture is worth in amd64 cores, as a json object
+const CPUFactorsEnv = "CPU_FACTORS"
+
+// CPUFactor is what a core of the architecture the engine runs on is worth in amd64 cores. The cpu usage is
+// multiplied by it so the engines running on different architectures compare
+func CPUFactor() float64 {
+	return cpuFactor(os.Getenv(CPUFactorsEnv), runtime.GOARCH)
+}
+
+func cpuFactor(raw, arch string) float64 {
+	factors := map[string]float64{}
+	if err := json.Unmarshal([]byte(raw), &factors); err != nil {
+		return 1
+	}
+	if f, ok := factors[arch]; ok && f > 0 {
+		return f
+	}
+	return 1
+}
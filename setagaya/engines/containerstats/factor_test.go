@@ -0,0 +1,15 @@
+package containerstats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPUFactor(t *testing.T) {
+	assert.Equal(t, 1.0, cpuFactor("", "arm64"))
+	assert.Equal(t, 1.0, cpuFactor("not json", "arm64"))
+	assert.Equal(t, 0.8, cpuFactor(`{"arm64": 0.8}`, "arm64"))
+	assert.Equal(t, 1.0, cpuFactor(`{"arm64": 0.8}`, "amd64"))
+	assert.Equal(t, 1.0, cpuFactor(`{"arm64": -1}`, "arm64"))
+}
@@ -0,0 +1,162 @@
+package containerstats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The files of the network namespace of the container, the engine only sees its own interfaces and sockets
+const (
+	netDevPath  = "/proc/net/dev"
+	netSNMPPath = "/proc/net/snmp"
+	netTCPPath  = "/proc/net/tcp"
+	netTCP6Path = "/proc/net/tcp6"
+)
+
+// The states of the sockets in /proc/net/tcp, in hex
+const (
+	tcpEstablished = "01"
+	tcpTimeWait    = "06"
+)
+
+// NetworkStats is what the engine sent and received since its network namespace was created, and its tcp
+// connections at the time
+type NetworkStats struct {
+	RxBytes     uint64
+	TxBytes     uint64
+	RetransSegs uint64
+	// Connections open, and closed but still holding their port
+	Established int
+	TimeWait    int
+}
+
+// NetworkRates is the throughput of the engine in bytes per second, and the segments it retransmitted per second
+type NetworkRates struct {
+	RxBytes     float64
+	TxBytes     float64
+	RetransSegs float64
+}
+
+func readNetFile(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "/proc/net/") {
+		return nil, fmt.Errorf("invalid network stats path: %s", path)
+	}
+	// #nosec G304 -- Path is validated to be within /proc/net/ and comes from hardcoded constants
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimSpace(string(content)), "\n"), nil
+}
+
+// parseNetDev sums up the bytes received and sent by the interfaces, the loopback left out. The two first lines of
+// /proc/net/dev are headers.
+func parseNetDev(lines []string) (rx, tx uint64, err error) {
+	for _, line := range lines {
+		name, counters, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			return 0, 0, fmt.Errorf("invalid interface line %q", line)
+		}
+		r, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		t, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		rx += r
+		tx += t
+	}
+	return rx, tx, nil
+}
+
+// parseRetransSegs reads the RetransSegs counter of /proc/net/snmp, where a line of names precedes every line of
+// values
+func parseRetransSegs(lines []string) (uint64, error) {
+	for i := 0; i+1 < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "Tcp:") || !strings.HasPrefix(lines[i+1], "Tcp:") {
+			continue
+		}
+		names, values := strings.Fields(lines[i]), strings.Fields(lines[i+1])
+		for j, name := range names {
+			if name == "RetransSegs" && j < len(values) {
+				return strconv.ParseUint(values[j], 10, 64)
+			}
+		}
+	}
+	return 0, errors.New("no RetransSegs in the tcp stats")
+}
+
+// countTCPStates counts the established and the time wait sockets of /proc/net/tcp, whose first line is a header
+func countTCPStates(lines []string) (established, timeWait int) {
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		switch fields[3] {
+		case tcpEstablished:
+			established++
+		case tcpTimeWait:
+			timeWait++
+		}
+	}
+	return established, timeWait
+}
+
+// ReadNetworkStats reads the counters of the network of the container. The engines without ipv6 have no tcp6 file.
+func ReadNetworkStats() (*NetworkStats, error) {
+	ns := new(NetworkStats)
+	lines, err := readNetFile(netDevPath)
+	if err != nil {
+		return nil, err
+	}
+	if ns.RxBytes, ns.TxBytes, err = parseNetDev(lines); err != nil {
+		return nil, err
+	}
+	if lines, err = readNetFile(netSNMPPath); err != nil {
+		return nil, err
+	}
+	if ns.RetransSegs, err = parseRetransSegs(lines); err != nil {
+		return nil, err
+	}
+	for _, path := range []string{netTCPPath, netTCP6Path} {
+		lines, err := readNetFile(path)
+		if errors.Is(err, os.ErrNotExist) && path == netTCP6Path {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		established, timeWait := countTCPStates(lines)
+		ns.Established += established
+		ns.TimeWait += timeWait
+	}
+	return ns, nil
+}
+
+func counterRate(prev, cur uint64, interval time.Duration) float64 {
+	// The counters of the interfaces start over when they are recreated
+	if cur < prev || interval <= 0 {
+		return 0
+	}
+	return float64(cur-prev) / interval.Seconds()
+}
+
+// Rates is what changed per second between the previous stats and these ones
+func (ns *NetworkStats) Rates(prev *NetworkStats, interval time.Duration) *NetworkRates {
+	return &NetworkRates{
+		RxBytes:     counterRate(prev.RxBytes, ns.RxBytes, interval),
+		TxBytes:     counterRate(prev.TxBytes, ns.TxBytes, interval),
+		RetransSegs: counterRate(prev.RetransSegs, ns.RetransSegs, interval),
+	}
+}
@@ -0,0 +1,63 @@
+package containerstats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetDev(t *testing.T) {
+	lines := []string{
+		"Inter-|   Receive                                                |  Transmit",
+		" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed",
+		"    lo:  500000     100    0    0    0     0          0         0   500000     100    0    0    0     0       0          0",
+		"  eth0: 1000000    2000    0    0    0     0          0         0  300000    1500    0    0    0     0       0          0",
+		"  eth1:    2000      20    0    0    0     0          0         0    1000      10    0    0    0     0       0          0",
+	}
+	rx, tx, err := parseNetDev(lines)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1002000), rx)
+	assert.Equal(t, uint64(301000), tx)
+
+	_, _, err = parseNetDev([]string{"eth0: 1 2 3"})
+	assert.Error(t, err)
+}
+
+func TestParseRetransSegs(t *testing.T) {
+	lines := []string{
+		"Ip: Forwarding DefaultTTL InReceives",
+		"Ip: 1 64 12345",
+		"Tcp: RtoAlgorithm RtoMin RtoMax MaxConn ActiveOpens PassiveOpens AttemptFails EstabResets CurrEstab InSegs OutSegs RetransSegs InErrs OutRsts",
+		"Tcp: 1 200 120000 -1 100 5 0 0 20 50000 40000 37 0 3",
+		"Udp: InDatagrams NoPorts",
+		"Udp: 10 0",
+	}
+	retrans, err := parseRetransSegs(lines)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(37), retrans)
+
+	_, err = parseRetransSegs(lines[:2])
+	assert.Error(t, err)
+}
+
+func TestCountTCPStates(t *testing.T) {
+	lines := []string{
+		"  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode",
+		"   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1234",
+		"   1: 0100007F:9C40 0100007F:1F90 01 00000000:00000000 00:00000000 00000000     0        0 2345",
+		"   2: 0A00000F:C350 0A000020:01BB 01 00000000:00000000 00:00000000 00000000     0        0 3456",
+		"   3: 0A00000F:C351 0A000020:01BB 06 00000000:00000000 03:00001770 00000000     0        0 0",
+	}
+	established, timeWait := countTCPStates(lines)
+	assert.Equal(t, 2, established)
+	assert.Equal(t, 1, timeWait)
+}
+
+func TestNetworkRates(t *testing.T) {
+	prev := &NetworkStats{RxBytes: 1000, TxBytes: 500, RetransSegs: 10}
+	cur := &NetworkStats{RxBytes: 6000, TxBytes: 1500, RetransSegs: 20}
+	assert.Equal(t, &NetworkRates{RxBytes: 1000, TxBytes: 200, RetransSegs: 2}, cur.Rates(prev, 5*time.Second))
+	// The counters started over
+	assert.Equal(t, &NetworkRates{}, prev.Rates(cur, 5*time.Second))
+}
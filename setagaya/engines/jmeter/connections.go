@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	etree "github.com/beevik/etree"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+const (
+	CONNECTION_TTL_PROPERTY   = "httpclient4.time_to_live"
+	CONNECTION_RESET_PROPERTY = "httpclient.reset_state_on_thread_group_iteration"
+	STAGGER_PROPERTY          = "setagaya.connection.stagger"
+)
+
+// The first sample of every thread waits a random part of the stagger, the later ones go on right away
+var staggerScript = fmt.Sprintf(`if (vars.get("setagaya.staggered") != null) return
+vars.put("setagaya.staggered", "true")
+Thread.sleep((long) (Math.random() * Long.parseLong(props.get("%s"))))
+`, STAGGER_PROPERTY)
+
+// setProp sets the property of a test element, adding it when the element does not have it yet
+func setProp(el *etree.Element, kind, name, value string) {
+	for _, child := range el.ChildElements() {
+		if child.SelectAttrValue("name", "") == name {
+			child.Tag = kind
+			child.SetText(value)
+			return
+		}
+	}
+	p := el.CreateElement(kind)
+	p.CreateAttr("name", name)
+	p.SetText(value)
+}
+
+// applyConnectionPolicy overrides the connection settings of the HTTP samplers and of the HTTP request defaults.
+// The ttl and the reset of the connections are properties of jmeter, they are passed when it's started.
+func applyConnectionPolicy(planDoc *etree.Document, cp *model.ConnectionPolicy, threads int) error {
+	elements := planDoc.FindElements("//HTTPSamplerProxy")
+	for _, ct := range planDoc.FindElements("//ConfigTestElement") {
+		if ct.SelectAttrValue("guiclass", "") == "HttpDefaultsGui" {
+			elements = append(elements, ct)
+		}
+	}
+	parallelDownloads := cp.ParallelDownloads(threads)
+	for _, el := range elements {
+		if cp.KeepAlive != nil {
+			setProp(el, "boolProp", "HTTPSampler.use_keepalive", strconv.FormatBool(*cp.KeepAlive))
+		}
+		if cp.MaxConnections > 0 {
+			setProp(el, "boolProp", "HTTPSampler.concurrentDwn", strconv.FormatBool(parallelDownloads > 0))
+			if parallelDownloads > 0 {
+				setProp(el, "stringProp", "HTTPSampler.concurrentPool", strconv.Itoa(parallelDownloads))
+			}
+		}
+	}
+	if cp.Stagger > 0 {
+		return addStaggerPreProcessor(planDoc)
+	}
+	return nil
+}
+
+// addStaggerPreProcessor injects a JSR223 pre processor on the test plan level so it runs before the first sample
+// of the threads of all the thread groups
+func addStaggerPreProcessor(planDoc *etree.Document) error {
+	jtp := planDoc.SelectElement("jmeterTestPlan")
+	if jtp == nil {
+		return errors.New("missing Jmeter Test plan in jmx")
+	}
+	ht := jtp.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside Jmeter test plan in jmx")
+	}
+	ht = ht.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside hash tree in jmx")
+	}
+	pre := etree.NewElement("JSR223PreProcessor")
+	pre.CreateAttr("guiclass", "TestBeanGUI")
+	pre.CreateAttr("testclass", "JSR223PreProcessor")
+	pre.CreateAttr("testname", "Setagaya Connection Stagger")
+	pre.CreateAttr("enabled", "true")
+	for _, prop := range []struct{ name, value string }{
+		{"scriptLanguage", "groovy"},
+		{"parameters", ""},
+		{"filename", ""},
+		{"cacheKey", "true"},
+		{"script", staggerScript},
+	} {
+		p := pre.CreateElement("stringProp")
+		p.CreateAttr("name", prop.name)
+		p.SetText(prop.value)
+	}
+	ht.InsertChildAt(0, pre)
+	ht.InsertChildAt(1, etree.NewElement("hashTree"))
+	return nil
+}
+
+func (sw *SetagayaWrapper) connectionPolicyArgs() []string {
+	cp := sw.connectionPolicy
+	if cp == nil {
+		return nil
+	}
+	args := []string{fmt.Sprintf("-J%s=%t", CONNECTION_RESET_PROPERTY, cp.ResetEachIteration)}
+	if cp.TTL > 0 {
+		args = append(args, fmt.Sprintf("-J%s=%d", CONNECTION_TTL_PROPERTY, cp.TTL))
+	}
+	if cp.Stagger > 0 {
+		args = append(args, fmt.Sprintf("-J%s=%d", STAGGER_PROPERTY, cp.Stagger))
+	}
+	return args
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	etree "github.com/beevik/etree"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+const (
+	DEBUG_RESULT_FILENAME = "debug.xml"
+	// A debug execution is a single iteration, so it should be done long before this
+	debugTimeout = 2 * time.Minute
+	// Limits of the response bodies and the jmeter output returned to the controller
+	debugMaxBody   = 64 * 1024
+	debugMaxOutput = 16 * 1024
+)
+
+// The debug results are saved in xml because the csv format cannot hold the requests and responses
+var debugSaveProperties = []string{
+	"jmeter.save.saveservice.output_format=xml",
+	"jmeter.save.saveservice.response_data=true",
+	"jmeter.save.saveservice.samplerData=true",
+	"jmeter.save.saveservice.requestHeaders=true",
+	"jmeter.save.saveservice.responseHeaders=true",
+	"jmeter.save.saveservice.url=true",
+	"jmeter.save.saveservice.assertion_results_failure_message=true",
+	"jmeter.save.saveservice.assertion_results=all",
+}
+
+var errSamplerNotFound = errors.New("sampler is not found in the plan")
+
+func isSampler(e *etree.Element) bool {
+	testClass := e.SelectAttrValue("testclass", "")
+	return strings.HasSuffix(testClass, "Sampler") || strings.HasSuffix(testClass, "SamplerProxy")
+}
+
+// makeDebugJMX runs every thread group with a single thread for a single iteration
+// and disables all the samplers which are not requested
+func makeDebugJMX(file []byte, samplers []string) ([]byte, error) {
+	planDoc, err := parseTestPlan(file)
+	if err != nil {
+		return nil, err
+	}
+	localizeIncludes(planDoc)
+	threadGroups, err := GetThreadGroups(planDoc)
+	if err != nil {
+		return nil, err
+	}
+	for _, tg := range threadGroups {
+		for _, child := range tg.ChildElements() {
+			switch child.SelectAttrValue("name", "") {
+			case "ThreadGroup.scheduler":
+				child.SetText("false")
+			case "ThreadGroup.num_threads":
+				child.SetText("1")
+			case "ThreadGroup.ramp_time":
+				child.SetText("0")
+			case "ThreadGroup.main_controller":
+				for _, prop := range child.ChildElements() {
+					switch prop.SelectAttrValue("name", "") {
+					case "LoopController.loops":
+						prop.SetText("1")
+					case "LoopController.continue_forever":
+						prop.SetText("false")
+					}
+				}
+			}
+		}
+	}
+	requested := make(map[string]bool, len(samplers))
+	for _, s := range samplers {
+		requested[s] = false
+	}
+	for _, e := range planDoc.FindElements("//*[@testclass]") {
+		if !isSampler(e) {
+			continue
+		}
+		name := e.SelectAttrValue("testname", "")
+		if _, ok := requested[name]; ok {
+			requested[name] = true
+			continue
+		}
+		e.CreateAttr("enabled", "false")
+	}
+	for name, found := range requested {
+		if !found {
+			return nil, fmt.Errorf("%w: %s", errSamplerNotFound, name)
+		}
+	}
+	return planDoc.WriteToBytes()
+}
+
+func (sw *SetagayaWrapper) prepareDebugData(dr *enginesModel.DebugRequest) error {
+	for _, sf := range dr.EngineDataConfig.EngineData {
+		switch filepath.Ext(sf.Filename) {
+		case ".jmx":
+			if sf.Fragment {
+				if err := sw.prepareFragment(sf, dr.EngineDataConfig.Parameters); err != nil {
+					return err
+				}
+				continue
+			}
+			file, err := enginesModel.FetchFile(sw.storageClient, sf)
+			if err != nil {
+				return err
+			}
+			if file, err = model.RenderTemplate(file, dr.EngineDataConfig.Parameters); err != nil {
+				return err
+			}
+			modified, err := makeDebugJMX(file, dr.Samplers)
+			if err != nil {
+				return err
+			}
+			if err := saveToDisk(JMX_FILENAME, modified); err != nil {
+				return err
+			}
+		case ".csv":
+			if err := sw.prepareCSV(sf, nil); err != nil {
+				return err
+			}
+		default:
+			if err := sw.downloadAndSaveFile(sf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func lastBytes(b []byte, n int) string {
+	if len(b) > n {
+		b = b[len(b)-n:]
+	}
+	return string(b)
+}
+
+// runDebug executes the prepared plan and waits for it to finish.
+// The pid is set while jmeter is running so a normal run cannot be started at the same time.
+func (sw *SetagayaWrapper) runDebug(parameters map[string]string) (*enginesModel.DebugResult, error) {
+	resultFile := path.Join(RESULT_ROOT, DEBUG_RESULT_FILENAME)
+	if err := os.Remove(resultFile); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	args := []string{"-n", "-t", JMX_FILEPATH, "-l", resultFile, "-q", PROPERTY_FILE, "-j", STDERR}
+	for _, p := range debugSaveProperties {
+		args = append(args, "-J"+p)
+	}
+	for name, value := range parameters {
+		args = append(args, fmt.Sprintf("-J%s=%s", name, value))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), debugTimeout)
+	defer cancel()
+	output := new(bytes.Buffer)
+	// #nosec G204 - JMETER_EXECUTABLE and arguments are validated and controlled by container environment
+	cmd := exec.CommandContext(ctx, JMETER_EXECUTABLE, args...)
+	cmd.Stdout = output
+	cmd.Stderr = io.MultiWriter(output, sw.writer)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	sw.setPid(cmd.Process.Pid)
+	if err := cmd.Wait(); err != nil {
+		log.Printf("setagaya-agent: Debug execution failed: %v", err)
+	}
+	sw.setPid(0)
+
+	r := &enginesModel.DebugResult{
+		Samples: []*enginesModel.DebugSample{},
+		Output:  lastBytes(output.Bytes(), debugMaxOutput),
+	}
+	data, err := os.ReadFile(resultFile)
+	if os.IsNotExist(err) {
+		// jmeter did not manage to run the plan. The output tells why
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.Samples, err = enginesModel.ParseDebugResults(data, debugMaxBody); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// debugHandler executes the requested samplers once and returns their full requests and responses
+func (sw *SetagayaWrapper) debugHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	sw.handlerLock.Lock()
+	defer sw.handlerLock.Unlock()
+
+	if sw.getPid() != 0 {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	dr := new(enginesModel.DebugRequest)
+	if err := json.NewDecoder(r.Body).Decode(dr); err != nil || dr.EngineDataConfig == nil || len(dr.Samplers) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := enginesModel.CleanFolder(TEST_DATA_FOLDER); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := sw.prepareDebugData(dr); err != nil {
+		switch {
+		case errors.Is(err, sos.FileNotFoundError()):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, errSamplerNotFound):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	// The server write timeout is shorter than a debug execution
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(debugTimeout + 30*time.Second)); err != nil {
+		log.Printf("Error extending the write deadline: %v", err)
+	}
+	result, err := sw.runDebug(dr.EngineDataConfig.Parameters)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error writing debug response: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	etree "github.com/beevik/etree"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// addDNSCacheManager injects a DNS Cache Manager on the test plan level so it applies to the samplers of all the
+// thread groups. A DNS Cache Manager of the test plan itself is disabled, it would take precedence otherwise.
+func addDNSCacheManager(planDoc *etree.Document, dc *model.DNSCaching) error {
+	jtp := planDoc.SelectElement("jmeterTestPlan")
+	if jtp == nil {
+		return errors.New("missing Jmeter Test plan in jmx")
+	}
+	ht := jtp.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside Jmeter test plan in jmx")
+	}
+	ht = ht.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside hash tree in jmx")
+	}
+	for _, existing := range planDoc.FindElements("//DNSCacheManager") {
+		existing.CreateAttr("enabled", "false")
+	}
+	manager := etree.NewElement("DNSCacheManager")
+	manager.CreateAttr("guiclass", "DNSCachePanel")
+	manager.CreateAttr("testclass", "DNSCacheManager")
+	manager.CreateAttr("testname", "Setagaya DNS Cache Manager")
+	manager.CreateAttr("enabled", "true")
+	servers := manager.CreateElement("collectionProp")
+	servers.CreateAttr("name", "DNSCacheManager.servers")
+	for _, s := range dc.Servers {
+		p := servers.CreateElement("stringProp")
+		p.CreateAttr("name", s)
+		p.SetText(s)
+	}
+	manager.CreateElement("collectionProp").CreateAttr("name", "DNSCacheManager.hosts")
+	for _, prop := range []struct {
+		name  string
+		value bool
+	}{
+		{"DNSCacheManager.clearEachIteration", dc.ClearEachIteration},
+		{"DNSCacheManager.isCustomResolver", len(dc.Servers) > 0},
+	} {
+		p := manager.CreateElement("boolProp")
+		p.CreateAttr("name", prop.name)
+		p.SetText(strconv.FormatBool(prop.value))
+	}
+	ht.InsertChildAt(0, manager)
+	ht.InsertChildAt(1, etree.NewElement("hashTree"))
+	return nil
+}
+
+// dnsCachingEnv passes the dns ttls of the run to the JVM of jmeter, on top of the JVM_ARGS of the image
+func (sw *SetagayaWrapper) dnsCachingEnv() []string {
+	if sw.dnsCaching == nil {
+		return nil
+	}
+	jvmArgs := append(strings.Fields(os.Getenv("JVM_ARGS")), sw.dnsCaching.JVMArgs()...)
+	return append(os.Environ(), "JVM_ARGS="+strings.Join(jvmArgs, " "))
+}
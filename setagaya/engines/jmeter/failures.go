@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	etree "github.com/beevik/etree"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+const (
+	FAILURE_CAPTURE_FOLDER = "/test-result/failures"
+	FAILURE_RATE_PROPERTY  = "setagaya.failure.rate"
+	FAILURE_MAX_PROPERTY   = "setagaya.failure.max"
+)
+
+// failureCaptureScript runs after every sample. It writes a random sample of the failing responses
+// into FAILURE_CAPTURE_FOLDER, one json file per response, up to the maximum number of samples.
+var failureCaptureScript = fmt.Sprintf(`import groovy.json.JsonOutput
+import java.util.concurrent.atomic.AtomicInteger
+
+if (prev.isSuccessful()) return
+String code = prev.getResponseCode()
+if (!code.isInteger() || code.toInteger() < 400) return
+if (Math.random() >= Double.parseDouble(props.get("%[1]s"))) return
+props.putIfAbsent("setagaya.failure.captured", new AtomicInteger())
+int n = props.get("setagaya.failure.captured").incrementAndGet()
+if (n > Integer.parseInt(props.get("%[2]s"))) return
+String body = prev.getResponseDataAsString()
+boolean truncated = body.length() > %[3]d
+if (truncated) body = body.substring(0, %[3]d)
+new File("%[4]s", n + ".json").write(JsonOutput.toJson([
+	label: prev.getSampleLabel(),
+	response_code: code,
+	response_message: prev.getResponseMessage(),
+	url: prev.getUrlAsString(),
+	timestamp: prev.getTimeStamp(),
+	response_headers: prev.getResponseHeaders(),
+	response_body: body,
+	truncated: truncated,
+]), "UTF-8")
+`, FAILURE_RATE_PROPERTY, FAILURE_MAX_PROPERTY, model.FailureCaptureBodyLimit, FAILURE_CAPTURE_FOLDER)
+
+// addFailureCaptureListener injects a JSR223 listener on the test plan level so it sees the samples
+// of all the thread groups
+func addFailureCaptureListener(planDoc *etree.Document) error {
+	jtp := planDoc.SelectElement("jmeterTestPlan")
+	if jtp == nil {
+		return errors.New("missing Jmeter Test plan in jmx")
+	}
+	ht := jtp.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside Jmeter test plan in jmx")
+	}
+	ht = ht.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside hash tree in jmx")
+	}
+	listener := etree.NewElement("JSR223Listener")
+	listener.CreateAttr("guiclass", "TestBeanGUI")
+	listener.CreateAttr("testclass", "JSR223Listener")
+	listener.CreateAttr("testname", "Setagaya Failure Capture")
+	listener.CreateAttr("enabled", "true")
+	for _, prop := range []struct{ name, value string }{
+		{"scriptLanguage", "groovy"},
+		{"parameters", ""},
+		{"filename", ""},
+		{"cacheKey", "true"},
+		{"script", failureCaptureScript},
+	} {
+		p := listener.CreateElement("stringProp")
+		p.CreateAttr("name", prop.name)
+		p.SetText(prop.value)
+	}
+	ht.AddChild(listener)
+	ht.AddChild(etree.NewElement("hashTree"))
+	return nil
+}
+
+func (sw *SetagayaWrapper) failureCaptureArgs() []string {
+	if sw.failureCapture == nil {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("-J%s=%g", FAILURE_RATE_PROPERTY, sw.failureCapture.Rate),
+		fmt.Sprintf("-J%s=%d", FAILURE_MAX_PROPERTY, sw.failureCapture.GetMaxSamples()),
+	}
+}
+
+func cleanFailureCaptures() error {
+	if err := os.RemoveAll(FAILURE_CAPTURE_FOLDER); err != nil {
+		return err
+	}
+	return os.MkdirAll(FAILURE_CAPTURE_FOLDER, 0750)
+}
+
+// readFailureCaptures collects the responses captured so far. Files still being written are skipped.
+func (sw *SetagayaWrapper) readFailureCaptures(planID int64) ([]*model.FailedResponse, error) {
+	files, err := filepath.Glob(path.Join(FAILURE_CAPTURE_FOLDER, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	r := []*model.FailedResponse{}
+	for _, f := range files {
+		content, err := os.ReadFile(f) // #nosec G304 - files are listed from the capture folder
+		if err != nil {
+			continue
+		}
+		fr := new(model.FailedResponse)
+		if err := json.Unmarshal(content, fr); err != nil {
+			continue
+		}
+		fr.PlanID = planID
+		fr.EngineID = sw.engineID
+		r = append(r, fr)
+	}
+	return r, nil
+}
+
+// failuresHandler uploads the failing responses captured in the current run to the object storage
+// and returns where they are stored. The controller calls it when the run is finished, with the signed
+// url to upload them to when the storage signs urls.
+func (sw *SetagayaWrapper) failuresHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	fr := new(enginesModel.FailuresRequest)
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(fr); err != nil && !errors.Is(err, io.EOF) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	fcf := new(model.FailureCaptureFile)
+	if sw.failureCapture != nil {
+		planID, _ := strconv.ParseInt(sw.planID, 10, 64)
+		responses, err := sw.readFailureCaptures(planID)
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if len(responses) > 0 {
+			content, err := json.Marshal(responses)
+			if err != nil {
+				log.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fcf.Filename = model.MakeFailureCaptureFilename(int64(sw.runID), planID, sw.engineID)
+			if err := sw.uploadFailures(fr, fcf.Filename, content); err != nil {
+				log.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fcf.Samples = len(responses)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fcf); err != nil {
+		log.Printf("Error writing failures response: %v", err)
+	}
+}
+
+func (sw *SetagayaWrapper) uploadFailures(fr *enginesModel.FailuresRequest, filename string, content []byte) error {
+	if fr.UploadURL != "" {
+		return enginesModel.UploadFile(fr.UploadURL, content)
+	}
+	storage, err := sos.ForRegion(sw.storageClient, fr.Region)
+	if err != nil {
+		return err
+	}
+	return storage.Upload(filename, io.NopCloser(bytes.NewReader(content)))
+}
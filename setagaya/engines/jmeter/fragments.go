@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	etree "github.com/beevik/etree"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// localizeIncludes points the Include Controllers of the jmx to the fragments the controller sent, kept next to the
+// test plan. jmeter resolves the relative include paths from the folder of the test plan.
+func localizeIncludes(doc *etree.Document) {
+	for _, p := range doc.FindElements("//stringProp[@name='IncludeController.includepath']") {
+		if name := model.IncludeName(p.Text()); name != "" {
+			p.SetText(name)
+		}
+	}
+}
+
+// prepareFragment saves a fragment the test plan includes under its name, rendered like the test plan and with the
+// fragments it includes itself localized too
+func (sw *SetagayaWrapper) prepareFragment(sf *model.SetagayaFile, parameters map[string]string) error {
+	if sf.Filename == JMX_FILENAME {
+		return fmt.Errorf("the fragment %s is named like the test plan of the engine", sf.Filename)
+	}
+	file, err := enginesModel.FetchFile(sw.storageClient, sf)
+	if err != nil {
+		return err
+	}
+	if file, err = model.RenderTemplate(file, parameters); err != nil {
+		return fmt.Errorf("fragment %s: %w", sf.Filename, err)
+	}
+	doc, err := parseTestPlan(file)
+	if err != nil {
+		return fmt.Errorf("invalid fragment %s: %w", sf.Filename, err)
+	}
+	localizeIncludes(doc)
+	localized, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+	return saveToDisk(sf.Filename, localized)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	etree "github.com/beevik/etree"
+)
+
+// heavyListeners are the listeners of the jmeter gui keeping or drawing every sample. They are only useful while a
+// plan is written, in the engines they take the cpu and the memory the threads need, by the gui class of their
+// result collector and with their default name.
+var heavyListeners = map[string]string{
+	"ViewResultsFullVisualizer": "View Results Tree",
+	"TableVisualizer":           "View Results in Table",
+	"GraphVisualizer":           "Graph Results",
+	"StatGraphVisualizer":       "Aggregate Graph",
+	"RespTimeGraphVisualizer":   "Response Time Graph",
+	"AssertionVisualizer":       "Assertion Results",
+	"ComparisonVisualizer":      "Compare Assertion Results",
+	"SplineVisualizer":          "Spline Visualizer",
+}
+
+// stripListeners disables the heavy listeners of the test plan, and returns their names so the run tells why they
+// did not write their files. The engines report the results themselves, the test plan does not need them.
+func stripListeners(planDoc *etree.Document) []string {
+	stripped := []string{}
+	for _, collector := range planDoc.FindElements("//ResultCollector") {
+		name, heavy := heavyListeners[collector.SelectAttrValue("guiclass", "")]
+		if !heavy || collector.SelectAttrValue("enabled", "true") == "false" {
+			continue
+		}
+		collector.CreateAttr("enabled", "false")
+		stripped = append(stripped, collector.SelectAttrValue("testname", name))
+	}
+	return stripped
+}
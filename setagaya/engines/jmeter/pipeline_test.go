@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/testutil"
+)
+
+// How long the subscribers are given to receive the last samples once they are all sent
+const pipelineDrainTimeout = 10 * time.Second
+
+func newPipelineWrapper() *SetagayaWrapper {
+	sw := &SetagayaWrapper{
+		histogram:    enginesModel.NewLatencyHistogram(),
+		errorStats:   enginesModel.NewErrorStats(),
+		assertions:   enginesModel.NewAssertionStats(),
+		transactions: enginesModel.NewTransactionStats(),
+		collectionID: "1",
+		planID:       "1",
+	}
+	sw.stream = enginesModel.NewStreamBroker(enginesModel.DefaultStreamBufferSize, sw.makePromMetrics)
+	return sw
+}
+
+// runAgentPipeline sends the load through the Bus of the agent, as the tailer does with the samples of jmeter, to
+// subscribers of its stream
+func runAgentPipeline(sw *SetagayaWrapper, load *testutil.MetricLoad, subscribers int) *testutil.MetricLoadReport {
+	var received, last atomic.Int64
+	subs := make([]chan enginesModel.StreamEvent, subscribers)
+	for i := range subs {
+		subs[i] = sw.stream.Subscribe("")
+		go func(events chan enginesModel.StreamEvent) {
+			for range events {
+				received.Add(1)
+				last.Store(time.Now().UnixNano())
+			}
+		}(subs[i])
+	}
+	start := time.Now()
+	sent := load.Run(context.Background(), func(line string) { sw.queueSample(line, nil) })
+	deadline := time.Now().Add(pipelineDrainTimeout)
+	for received.Load() < int64(sent*subscribers) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for _, events := range subs {
+		sw.stream.Unsubscribe(events)
+	}
+	return &testutil.MetricLoadReport{
+		Rate:        load.Rate,
+		Subscribers: subscribers,
+		Sent:        sent,
+		Received:    int(received.Load()),
+		Elapsed:     time.Unix(0, last.Load()).Sub(start),
+	}
+}
+
+// BenchmarkAgentPipeline streams synthetic samples from the Bus of the agent to two subscribers of its stream, at
+// the rates of -metric-rates. Run it with -bench AgentPipeline -benchtime 1x, it reports the samples every
+// subscriber received per second and the ones dropped.
+func BenchmarkAgentPipeline(b *testing.B) {
+	const samples, subscribers = 100000, 2
+	rates, err := testutil.MetricRates()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, rate := range rates {
+		b.Run(fmt.Sprintf("rate=%d", rate), func(b *testing.B) {
+			sw := newPipelineWrapper()
+			load := &testutil.MetricLoad{Rate: rate, Samples: samples, Labels: 20}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runAgentPipeline(sw, load, subscribers).ReportTo(b)
+			}
+		})
+	}
+}
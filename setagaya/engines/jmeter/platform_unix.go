@@ -0,0 +1,44 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"syscall"
+)
+
+const (
+	JMETER_BIN                = "jmeter"
+	JMETER_SHUTDOWN_SCRIPT    = "stoptest.sh"
+	STDERR                    = "/dev/stderr"
+	DEFAULT_JMETER_BIN_FOLDER = "/apache-jmeter-3.3/bin"
+	// The cpu and memory used by the engine are read from its cgroup
+	CGROUP_METRICS = true
+)
+
+var (
+	ALLOWED_JMETER_PATHS = []string{
+		"/apache-jmeter-3.3/bin",       // Legacy JMeter 3.3
+		"/opt/apache-jmeter-5.6.3/bin", // Modern JMeter 5.6.3
+	}
+	JMETER_PATH_PATTERN = regexp.MustCompile(`^/opt/apache-jmeter-\d+\.\d+\.\d+/bin$`)
+)
+
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+}
+
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
+
+// fileID identifies a file by its device and inode, so a rotated file keeps its offset under its new name
+func fileID(filename string, fi os.FileInfo) string {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return filename
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino)
+}
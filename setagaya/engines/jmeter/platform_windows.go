@@ -0,0 +1,55 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"syscall"
+)
+
+const (
+	JMETER_BIN             = "jmeter.bat"
+	JMETER_SHUTDOWN_SCRIPT = "stoptest.cmd"
+	// jmeter.bat cannot log to the console of the container, the log is kept next to the results instead
+	STDERR                    = RESULT_ROOT + "/jmeter.log"
+	DEFAULT_JMETER_BIN_FOLDER = `C:\apache-jmeter-5.6.3\bin`
+	// Windows containers have no cgroup, the engine does not report its cpu and memory
+	CGROUP_METRICS = false
+)
+
+var (
+	ALLOWED_JMETER_PATHS = []string{DEFAULT_JMETER_BIN_FOLDER}
+	JMETER_PATH_PATTERN  = regexp.MustCompile(`^C:\\apache-jmeter-\d+\.\d+\.\d+\\bin$`)
+)
+
+// The spill buffer is not available on windows, the results are streamed as they are read
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return nil, errors.New("memory mapped spill buffers are not supported on windows")
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
+
+// fileID identifies a file by its volume and its file index, so a rotated file keeps its offset under its new name.
+// The file is opened without access to its content, which does not stand in the way of jmeter renaming it.
+func fileID(filename string, fi os.FileInfo) string {
+	name, err := syscall.UTF16PtrFromString(filename)
+	if err != nil {
+		return filename
+	}
+	h, err := syscall.CreateFile(name, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return filename
+	}
+	defer syscall.CloseHandle(h)
+	var info syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &info); err != nil {
+		return filename
+	}
+	return fmt.Sprintf("%d:%d:%d", info.VolumeSerialNumber, info.FileIndexHigh, info.FileIndexLow)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+
+	etree "github.com/beevik/etree"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+// The properties pushed during the run. The file is in the test data, so it's dropped with the previous run
+var RUNTIME_PROPERTIES_FILE = path.Join(TEST_DATA_FOLDER, "runtime.properties")
+
+// runtimePropertiesScript runs before every sample. Every thread checks the file of the pushed properties once a
+// second and loads it into the jmeter properties when it changed, so ${__P(name)} returns the new values.
+const runtimePropertiesScript = `long now = System.currentTimeMillis()
+if (now - (vars.getObject("setagaya.properties.checked") ?: 0L) >= 1000) {
+	vars.putObject("setagaya.properties.checked", now)
+	File file = new File("%s")
+	long modified = file.lastModified()
+	if (modified > (vars.getObject("setagaya.properties.modified") ?: 0L)) {
+		vars.putObject("setagaya.properties.modified", modified)
+		Properties pushed = new Properties()
+		file.withInputStream { pushed.load(it) }
+		props.putAll(pushed)
+	}
+}
+`
+
+// addRuntimePropertiesPreProcessor injects a JSR223 pre-processor on the test plan level so the samples of all the
+// thread groups see the pushed properties
+func addRuntimePropertiesPreProcessor(planDoc *etree.Document) error {
+	jtp := planDoc.SelectElement("jmeterTestPlan")
+	if jtp == nil {
+		return errors.New("missing Jmeter Test plan in jmx")
+	}
+	ht := jtp.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside Jmeter test plan in jmx")
+	}
+	ht = ht.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside hash tree in jmx")
+	}
+	pp := etree.NewElement("JSR223PreProcessor")
+	pp.CreateAttr("guiclass", "TestBeanGUI")
+	pp.CreateAttr("testclass", "JSR223PreProcessor")
+	pp.CreateAttr("testname", "Setagaya Runtime Properties")
+	pp.CreateAttr("enabled", "true")
+	for _, prop := range []struct{ name, value string }{
+		{"scriptLanguage", "groovy"},
+		{"parameters", ""},
+		{"filename", ""},
+		{"cacheKey", "true"},
+		{"script", fmt.Sprintf(runtimePropertiesScript, RUNTIME_PROPERTIES_FILE)},
+	} {
+		p := pp.CreateElement("stringProp")
+		p.CreateAttr("name", prop.name)
+		p.SetText(prop.value)
+	}
+	ht.AddChild(pp)
+	ht.AddChild(etree.NewElement("hashTree"))
+	return nil
+}
+
+// writeRuntimeProperties adds the properties to the ones pushed before during the run. The file is replaced at
+// once so the threads never load half of it.
+func (sw *SetagayaWrapper) writeRuntimeProperties(properties map[string]string) error {
+	sw.runtimePropertiesLock.Lock()
+	defer sw.runtimePropertiesLock.Unlock()
+	if sw.runtimeProperties == nil {
+		sw.runtimeProperties = map[string]string{}
+	}
+	for name, value := range properties {
+		sw.runtimeProperties[name] = value
+	}
+	tmp := RUNTIME_PROPERTIES_FILE + ".tmp"
+	if err := os.WriteFile(tmp, enginesModel.FormatProperties(sw.runtimeProperties), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, RUNTIME_PROPERTIES_FILE)
+}
+
+// propertiesHandler changes jmeter properties of the run in progress
+func (sw *SetagayaWrapper) propertiesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if sw.getPid() == 0 {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	rpr := new(enginesModel.RuntimePropertiesRequest)
+	if err := json.NewDecoder(r.Body).Decode(rpr); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := rpr.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := sw.writeRuntimeProperties(rpr.Properties); err != nil {
+		log.Printf("setagaya-agent: Cannot write the runtime properties: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("setagaya-agent: Runtime properties changed: %v", rpr.Names())
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	etree "github.com/beevik/etree"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+// The properties pushed when the controller stops the run before the end of its duration: when the threads are all
+// stopped, in epoch milliseconds, and the seconds they take to stop
+const (
+	STOP_AT_PROPERTY       = "setagaya.stop_at"
+	STOP_RAMPDOWN_PROPERTY = "setagaya.stop_rampdown"
+)
+
+// rampdownScript runs before every sample. The standard thread groups stop all their threads at the end of the
+// duration, so the threads are stopped one by one during the ramp-down instead, in the reverse order they started.
+// A stopped thread finishes its current sample and closes its connections. The run ends earlier the same way when
+// the controller stops it.
+const rampdownScript = `import org.apache.jmeter.threads.JMeterContextService
+
+long end = JMeterContextService.getTestStartTime() + %[1]dL * 1000
+long rampdown = %[2]dL * 1000
+String stopAt = props.getProperty("%[3]s")
+if (stopAt != null && Long.parseLong(stopAt) < end) {
+	end = Long.parseLong(stopAt)
+	rampdown = Long.parseLong(props.getProperty("%[4]s", "0")) * 1000
+}
+int threads = Math.max(1, ctx.getThreadGroup().getNumThreads())
+long threadStopAt = end - (long) (rampdown * (ctx.getThreadNum() + 1) / threads)
+if (System.currentTimeMillis() >= threadStopAt) {
+	ctx.getThread().stop()
+}
+`
+
+// addRampdownPreProcessor injects a JSR223 pre-processor on the test plan level so it runs before the samples of
+// all the thread groups. duration and rampdown are in seconds.
+func addRampdownPreProcessor(planDoc *etree.Document, duration, rampdown int) error {
+	jtp := planDoc.SelectElement("jmeterTestPlan")
+	if jtp == nil {
+		return errors.New("missing Jmeter Test plan in jmx")
+	}
+	ht := jtp.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside Jmeter test plan in jmx")
+	}
+	ht = ht.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside hash tree in jmx")
+	}
+	pp := etree.NewElement("JSR223PreProcessor")
+	pp.CreateAttr("guiclass", "TestBeanGUI")
+	pp.CreateAttr("testclass", "JSR223PreProcessor")
+	pp.CreateAttr("testname", "Setagaya Ramp-down")
+	pp.CreateAttr("enabled", "true")
+	for _, prop := range []struct{ name, value string }{
+		{"scriptLanguage", "groovy"},
+		{"parameters", ""},
+		{"filename", ""},
+		{"cacheKey", "true"},
+		{"script", fmt.Sprintf(rampdownScript, duration, rampdown, STOP_AT_PROPERTY, STOP_RAMPDOWN_PROPERTY)},
+	} {
+		p := pp.CreateElement("stringProp")
+		p.CreateAttr("name", prop.name)
+		p.SetText(prop.value)
+	}
+	ht.AddChild(pp)
+	ht.AddChild(etree.NewElement("hashTree"))
+	return nil
+}
+
+// rampdownHandler stops the threads of the run in progress one by one over the seconds requested. The test plan of
+// the run needs the ramp-down pre-processor, the engines of the attended-only runs have it.
+func (sw *SetagayaWrapper) rampdownHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if sw.getPid() == 0 {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	rr := new(enginesModel.RampdownRequest)
+	if err := json.NewDecoder(r.Body).Decode(rr); err != nil || rr.Seconds < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// The time of the engine, the controller's clock may differ
+	stopAt := time.Now().Add(time.Duration(rr.Seconds) * time.Second).UnixMilli()
+	// The properties are reserved, they are written along with the pushed ones without their validation
+	if err := sw.writeRuntimeProperties(map[string]string{
+		STOP_AT_PROPERTY:       strconv.FormatInt(stopAt, 10),
+		STOP_RAMPDOWN_PROPERTY: strconv.Itoa(rr.Seconds),
+	}); err != nil {
+		log.Printf("setagaya-agent: Cannot write the ramp-down properties: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("setagaya-agent: Ramping down over %d seconds", rr.Seconds)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strconv"
+
+	etree "github.com/beevik/etree"
+)
+
+// SEED_PROPERTY is the seed of the engine, for the scripts of the test plan drawing their own random values
+const SEED_PROPERTY = "setagaya.seed"
+
+// seedRandomVariables seeds the Random Variables of the test plan which are not seeded yet, each one with its own
+// seed so they draw different values. The random functions of jmeter, like __Random, cannot be seeded.
+func seedRandomVariables(planDoc *etree.Document, seed int64) {
+	for i, rv := range planDoc.FindElements("//RandomVariableConfig") {
+		if p := rv.FindElement("stringProp[@name='randomSeed']"); p != nil && p.Text() != "" {
+			continue
+		}
+		setProp(rv, "stringProp", "randomSeed", strconv.FormatInt(seed+int64(i), 10))
+	}
+}
+
+func (sw *SetagayaWrapper) seedArgs() []string {
+	if sw.seed == nil {
+		return nil
+	}
+	return []string{"-J" + SEED_PROPERTY + "=" + strconv.FormatInt(*sw.seed, 10)}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+// The segments are kept apart from the result files, the tailer would read them as results otherwise
+const RESULT_SEGMENT_FOLDER = "/test-result/segments"
+
+// startResultSegments closes the segment of the previous run and starts the one of the current run when the
+// controller asks for them, for the soak runs
+func (sw *SetagayaWrapper) startResultSegments(edc enginesModel.EngineDataConfig) error {
+	sw.segmentsLock.Lock()
+	defer sw.segmentsLock.Unlock()
+	if sw.segments != nil {
+		if err := sw.segments.Close(); err != nil {
+			log.Printf("setagaya-agent: Cannot close the result segment: %v", err)
+		}
+		sw.segments = nil
+	}
+	if !edc.ResultSegments {
+		return nil
+	}
+	if err := os.MkdirAll(RESULT_SEGMENT_FOLDER, 0750); err != nil {
+		return err
+	}
+	segments, err := enginesModel.NewResultSegmentWriter(path.Join(RESULT_SEGMENT_FOLDER, "current.jtl.gz"))
+	if err != nil {
+		return err
+	}
+	sw.segments = segments
+	return nil
+}
+
+// writeResultSegment adds a sample to the segment, when the run keeps them
+func (sw *SetagayaWrapper) writeResultSegment(line string) {
+	sw.segmentsLock.RLock()
+	defer sw.segmentsLock.RUnlock()
+	if sw.segments == nil {
+		return
+	}
+	if err := sw.segments.Write(line); err != nil {
+		log.Printf("setagaya-agent: Cannot write the result segment: %v", err)
+	}
+}
+
+// segmentsHandler uploads the samples read since the previous checkpoint of the soak run and starts the next
+// segment. The controller gives the name of the segment, and the signed url to upload it to when the storage
+// signs urls. Nothing is uploaded when there are no samples.
+func (sw *SetagayaWrapper) segmentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	req := new(enginesModel.ResultSegmentRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Filename == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	sw.segmentsLock.RLock()
+	defer sw.segmentsLock.RUnlock()
+	planID, _ := strconv.ParseInt(sw.planID, 10, 64)
+	rs := &model.ResultSegment{PlanID: planID, EngineID: sw.engineID}
+	if sw.segments != nil {
+		content, samples, err := sw.segments.Rotate()
+		if err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if samples > 0 {
+			if err := sw.uploadSegment(req, content); err != nil {
+				log.Println(err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			rs.Filename = req.Filename
+			rs.Samples = samples
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rs); err != nil {
+		log.Printf("Error writing segments response: %v", err)
+	}
+}
+
+func (sw *SetagayaWrapper) uploadSegment(req *enginesModel.ResultSegmentRequest, content []byte) error {
+	if req.UploadURL != "" {
+		return enginesModel.UploadFile(req.UploadURL, content)
+	}
+	storage, err := sos.ForRegion(sw.storageClient, req.Region)
+	if err != nil {
+		return err
+	}
+	return storage.Upload(req.Filename, io.NopCloser(bytes.NewReader(content)))
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,12 +12,14 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	etree "github.com/beevik/etree"
@@ -25,36 +29,27 @@ import (
 	"github.com/hveda/Setagaya/setagaya/config"
 	sos "github.com/hveda/Setagaya/setagaya/object_storage"
 
+	"github.com/hveda/Setagaya/setagaya/engines/artifacts"
 	"github.com/hveda/Setagaya/setagaya/engines/containerstats"
+	"github.com/hveda/Setagaya/setagaya/engines/jvmstats"
 	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/engines/runonce"
+	"github.com/hveda/Setagaya/setagaya/engines/sidecar"
 	"github.com/hveda/Setagaya/setagaya/model"
 	"github.com/hveda/Setagaya/setagaya/utils"
-
-	"github.com/hpcloud/tail"
 )
 
 // validateJMeterPath ensures the JMeter path is safe and within expected boundaries
 func validateJMeterPath(path string) bool {
-	// Define allowed JMeter paths (container-safe)
-	allowedPaths := []string{
-		"/apache-jmeter-3.3/bin",       // Legacy JMeter 3.3
-		"/opt/apache-jmeter-5.6.3/bin", // Modern JMeter 5.6.3
-	}
-
 	// Check if path matches any allowed pattern
-	for _, allowedPath := range allowedPaths {
+	for _, allowedPath := range ALLOWED_JMETER_PATHS {
 		if path == allowedPath {
 			return true
 		}
 	}
 
-	// Allow paths that match the pattern /opt/apache-jmeter-X.X.X/bin
-	matched, err := regexp.MatchString(`^/opt/apache-jmeter-\d+\.\d+\.\d+/bin$`, path)
-	if err != nil {
-		log.Printf("Error matching regex pattern: %v", err)
-		return false
-	}
-	return matched
+	// Allow paths that match the pattern of the versioned installs, e.g. /opt/apache-jmeter-X.X.X/bin
+	return JMETER_PATH_PATTERN.MatchString(path)
 }
 
 // init sets up JMeter paths based on environment variables for version compatibility
@@ -64,7 +59,7 @@ func init() {
 	jmeterBinFolder := os.Getenv("JMETER_BIN")
 	if jmeterBinFolder == "" {
 		// Fallback to legacy hardcoded path for JMeter 3.3
-		jmeterBinFolder = "/apache-jmeter-3.3/bin"
+		jmeterBinFolder = DEFAULT_JMETER_BIN_FOLDER
 		log.Println("setagaya-agent: JMETER_BIN not set, using legacy path:", jmeterBinFolder)
 	} else {
 		log.Println("setagaya-agent: Using JMETER_BIN from environment:", jmeterBinFolder)
@@ -74,13 +69,13 @@ func init() {
 	if !validateJMeterPath(jmeterBinFolder) {
 		log.Printf("setagaya-agent: WARNING - Invalid JMeter path detected: %s", jmeterBinFolder)
 		// Fall back to safe default
-		jmeterBinFolder = "/apache-jmeter-3.3/bin"
+		jmeterBinFolder = DEFAULT_JMETER_BIN_FOLDER
 		log.Println("setagaya-agent: Using safe fallback path:", jmeterBinFolder)
 	}
 
-	// Set up dynamic paths using path.Join for security
-	JMETER_EXECUTABLE = path.Join(jmeterBinFolder, JMETER_BIN)
-	JMETER_SHUTDOWN = path.Join(jmeterBinFolder, "stoptest.sh")
+	// Set up dynamic paths using filepath.Join for security, the folder is a windows path on windows
+	JMETER_EXECUTABLE = filepath.Join(jmeterBinFolder, JMETER_BIN)
+	JMETER_SHUTDOWN = filepath.Join(jmeterBinFolder, JMETER_SHUTDOWN_SCRIPT)
 
 	// Log final paths for debugging
 	log.Printf("setagaya-agent: JMeter executable path: %s", JMETER_EXECUTABLE)
@@ -91,9 +86,11 @@ const (
 	RESULT_ROOT      = "/test-result"
 	TEST_DATA_FOLDER = "/test-data"
 	PROPERTY_FILE    = "/test-conf/setagaya.properties"
-	JMETER_BIN       = "jmeter"
-	STDERR           = "/dev/stderr"
 	JMX_FILENAME     = "modified.jmx"
+	// The artifacts are cached for the next runs of the pod. /tmp stays writable with a read-only root filesystem
+	ARTIFACT_CACHE_FOLDER = "/tmp/setagaya-artifacts/cache"
+	ARTIFACT_FOLDER       = "/tmp/setagaya-artifacts/run"
+	ARTIFACT_TIMEOUT      = 5 * time.Minute
 )
 
 var (
@@ -103,17 +100,14 @@ var (
 )
 
 type SetagayaWrapper struct {
-	newClients     chan chan string
-	closingClients chan chan string
-	clients        map[chan string]bool
-	closeSignal    chan int
-	Bus            chan string
-	logCounter     int
-	httpClient     *http.Client
-	pidLock        sync.RWMutex
-	handlerLock    sync.RWMutex
-	currentPid     int
-	storageClient  sos.StorageInterface
+	// Streams the samples of jmeter to the controller
+	stream        *enginesModel.StreamBroker
+	logCounter    int
+	httpClient    *http.Client
+	pidLock       sync.RWMutex
+	handlerLock   sync.RWMutex
+	currentPid    int
+	storageClient sos.StorageInterface
 	//stderr         io.ReadCloser
 	reader       io.ReadCloser
 	writer       io.Writer
@@ -122,6 +116,58 @@ type SetagayaWrapper struct {
 	collectionID string
 	planID       string
 	engineID     int
+	// Mergeable latency digest of the current run. The controller collects it when the run is finished
+	histogram     *enginesModel.LatencyHistogram
+	histogramLock sync.RWMutex
+	// Failed samples of the current run by label and error
+	errorStats     *enginesModel.ErrorStats
+	errorStatsLock sync.RWMutex
+	// Assertion results of the current run by label
+	assertions     *enginesModel.AssertionStats
+	assertionsLock sync.RWMutex
+	// Samples of the transaction controllers of the current run. They are kept apart from the samplers
+	transactions     *enginesModel.TransactionStats
+	transactionsLock sync.RWMutex
+	// nil when the plan neither requests a target throughput nor caps the engines. It's read for every sample
+	throughput atomic.Pointer[throughputController]
+	// Heavy listeners of the test plan disabled for the current run
+	strippedListeners []string
+	// nil when the run does not seed the random values
+	seed *int64
+	// Start of the run left out of its summary
+	warmup enginesModel.Warmup
+	// Run parameters of the current run. They are passed to jmeter as properties
+	parameters map[string]string
+	// nil when the run does not capture failing responses
+	failureCapture *model.FailureCapture
+	// nil when the run keeps the dns cache of the JVM
+	dnsCaching *model.DNSCaching
+	// nil when the run keeps the connection settings of the test plan
+	connectionPolicy *model.ConnectionPolicy
+	// Expected columns of the result files when they are delimited values without a header
+	jtlColumns []string
+	// Folders of the plugins and of the libraries installed for the current run. Empty when there are none
+	pluginsFolder   string
+	librariesFolder string
+	// Follows the result files of the current run
+	tailer     *resultTailer
+	tailerLock sync.Mutex
+	// Periods of the current run whose samples are missing
+	gaps     []*enginesModel.ResultGap
+	gapsLock sync.RWMutex
+	// Queues the samples read from the result files until they are streamed. nil when the buffer cannot be
+	// set up, the samples are then streamed as they are read
+	spill *spillBuffer
+	// nil when no service mesh injects its sidecar in the pod
+	sidecar *sidecar.Sidecar
+	// nil when the engine is not a job running the plan once
+	runOnce *runonce.Run
+	// Samples of the current soak run not uploaded yet. nil when the run does not keep result segments
+	segments     *enginesModel.ResultSegmentWriter
+	segmentsLock sync.RWMutex
+	// Properties pushed during the current run
+	runtimeProperties     map[string]string
+	runtimePropertiesLock sync.Mutex
 }
 
 func findCollectionIDPlanID() (string, string) {
@@ -129,18 +175,20 @@ func findCollectionIDPlanID() (string, string) {
 }
 
 func NewServer() (sw *SetagayaWrapper) {
-	// Instantiate a broker
 	sw = &SetagayaWrapper{
-		newClients:     make(chan chan string),
-		closingClients: make(chan chan string),
-		clients:        make(map[chan string]bool),
-		closeSignal:    make(chan int),
-		logCounter:     0,
-		Bus:            make(chan string),
-		httpClient:     &http.Client{},
-		storageClient:  sos.Client.Storage,
+		logCounter:    0,
+		httpClient:    &http.Client{},
+		storageClient: sos.Client.Storage,
+		histogram:     enginesModel.NewLatencyHistogram(),
+		errorStats:    enginesModel.NewErrorStats(),
+		assertions:    enginesModel.NewAssertionStats(),
+		transactions:  enginesModel.NewTransactionStats(),
+		sidecar:       sidecar.FromEnv(),
 	}
+	sw.runOnce = runonce.FromEnv(sw.exit)
 	sw.collectionID, sw.planID = findCollectionIDPlanID()
+	// Set it running - listening and broadcasting events
+	sw.stream = enginesModel.NewStreamBroker(enginesModel.DefaultStreamBufferSize, sw.makePromMetrics)
 	reader, writer, err := os.Pipe()
 	if err != nil {
 		log.Printf("Error creating pipe: %v", err)
@@ -148,14 +196,101 @@ func NewServer() (sw *SetagayaWrapper) {
 	}
 	mw := io.MultiWriter(writer, os.Stderr)
 	sw.reader = reader
-	sw.writer = mw
-	log.SetOutput(mw)
-	// Set it running - listening and broadcasting events
-	go sw.listen()
+	// The secrets are scrubbed from the logs of the agent and the errors of jmeter, the samples are tailed apart
+	sw.writer = config.ScrubSecretsWriter(mw)
+	log.SetOutput(sw.writer)
 	go sw.readOutput()
+	if sw.spill, err = newSpillBuffer(SPILL_BUFFER_FILE, SPILL_BUFFER_SIZE); err != nil {
+		log.Printf("setagaya-agent: Cannot set up the spill buffer, samples are streamed as they are read: %v", err)
+	} else {
+		go sw.drainSpill()
+	}
+	sw.resumeRun()
 	return
 }
 
+// resumeRun carries on with the run the agent was serving before it was restarted. The results written while
+// the agent was down are read from the saved offsets. Jmeter does not outlive the agent, so when the run was
+// still going on, the rest of it is reported as a gap.
+func (sw *SetagayaWrapper) resumeRun() {
+	state, err := loadTailState()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("setagaya-agent: Cannot read the tail state: %v", err)
+		}
+		return
+	}
+	sw.runID = state.RunID
+	sw.engineID = state.EngineID
+	sw.jtlColumns = state.JTLColumns
+	sw.logCounter = state.LogCounter
+	if state.Running {
+		// Jmeter stopped writing when it was stopped with the agent
+		start := state.Checkpoint
+		for _, o := range state.Offsets {
+			if fi, err := os.Stat(o.Path); err == nil && fi.ModTime().After(start) {
+				start = fi.ModTime()
+			}
+		}
+		sw.recordGap(&enginesModel.ResultGap{
+			Start:  start,
+			End:    time.Now(),
+			Reason: enginesModel.GapReasonAgentRestarted,
+		})
+	}
+	log.Printf("setagaya-agent: Resuming run %d from the saved offsets", state.RunID)
+	sw.tailJemeter(state.Offsets, state.Checkpoint)
+}
+
+// queueSample hands a sample read from the result files over to the stream. It returns false when stop is closed
+// before the stream took the sample
+func (sw *SetagayaWrapper) queueSample(line string, stop <-chan struct{}) bool {
+	sw.writeResultSegment(line)
+	if sw.spill != nil && sw.spill.push(line, stop) {
+		return true
+	}
+	select {
+	case sw.stream.Bus <- line:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// drainSpill streams the samples queued in the spill buffer. A sample leaves the buffer once the stream took it,
+// and the samples of a run stopped meanwhile are left out
+func (sw *SetagayaWrapper) drainSpill() {
+	for {
+		line, pos, ok := sw.spill.peek()
+		if !ok {
+			return
+		}
+		if sw.spill.current(pos) {
+			sw.stream.Bus <- line
+		}
+		sw.spill.advance(pos, line)
+	}
+}
+
+// resetSpill drops the samples of the previous run still queued, so they are not streamed as samples of the next
+// run. A stopped run is given a moment to stream its last samples first.
+func (sw *SetagayaWrapper) resetSpill(wait time.Duration) {
+	if sw.spill == nil {
+		return
+	}
+	for deadline := time.Now().Add(wait); !sw.spill.empty() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sw.spill.reset()
+}
+
+func (sw *SetagayaWrapper) recordGap(gap *enginesModel.ResultGap) {
+	log.Printf("setagaya-agent: Samples of run %d are missing from %s: %s", sw.runID, gap.Start, gap.Reason)
+	sw.gapsLock.Lock()
+	defer sw.gapsLock.Unlock()
+	sw.gaps = append(sw.gaps, gap)
+}
+
 func (sw *SetagayaWrapper) readOutput() {
 	rd := bufio.NewReader(sw.reader)
 	for {
@@ -168,37 +303,37 @@ func (sw *SetagayaWrapper) readOutput() {
 	}
 }
 
+// parseRawMetrics parses the lines streamed by the agent. Whatever the format of the result file,
+// the lines are streamed with the default JTL columns.
 func parseRawMetrics(rawLine string) (enginesModel.SetagayaMetric, error) {
-	line := strings.Split(rawLine, "|")
-	// We use char "|" as the separator in jmeter jtl file. If some users somehow put another | in their label name
-	// we could end up a broken split. For those requests, we simply ignore otherwise the process will crash.
-	// With current jmeter setup, we are expecting 12 items to be presented in the JTL file after split.
-	// The column in the JTL files are:
-	// timeStamp|elapsed|label|responseCode|responseMessage|threadName|success|bytes|grpThreads|allThreads|Latency|Connect
-	if len(line) < 12 {
-		log.Printf("line length was less than required. Raw line is %s", rawLine)
-		return enginesModel.SetagayaMetric{}, fmt.Errorf("line length was less than required. Raw line is %s", rawLine)
-	}
-	label := line[2]
-	status := line[3]
-	threads, err := strconv.ParseFloat(line[9], 64)
-	if err != nil {
-		threads = 0 // default to 0 if parsing fails
-		log.Printf("Error parsing threads from line[9] '%s': %v", line[9], err)
-	}
-	latency, err := strconv.ParseFloat(line[10], 64)
+	record, err := enginesModel.ParseJTLLine(rawLine)
 	if err != nil {
 		return enginesModel.SetagayaMetric{}, err
 	}
 	return enginesModel.SetagayaMetric{
-		Threads: threads,
-		Label:   label,
-		Status:  status,
-		Latency: latency,
-		Raw:     rawLine,
+		Timestamp:      record.Timestamp,
+		Threads:        record.AllThreads,
+		Label:          record.Label,
+		Status:         record.ResponseCode,
+		Message:        record.ResponseMessage,
+		Success:        record.Success,
+		FailureMessage: record.FailureMessage,
+		Latency:        record.Latency,
+		Transaction:    record.Transaction,
+		Raw:            rawLine,
 	}, nil
 }
 
+// setRegionMetric publishes the region the engine generates the traffic for, so the metrics scraped from the engine
+// can be broken down by region
+func (sw *SetagayaWrapper) setRegionMetric(region string) {
+	if region == "" {
+		return
+	}
+	config.EngineRegionGauge.WithLabelValues(sw.collectionID, sw.planID, strconv.Itoa(sw.runID),
+		strconv.Itoa(sw.engineID), region).Set(1)
+}
+
 func (sw *SetagayaWrapper) makePromMetrics(line string) {
 	metric, err := parseRawMetrics(line)
 	// we need to pass the engine meta(project, collection, plan), especially run id
@@ -216,36 +351,41 @@ func (sw *SetagayaWrapper) makePromMetrics(line string) {
 	latency := metric.Latency
 	threads := metric.Threads
 
+	config.ThreadsGauge.WithLabelValues(collectionID, planID, runID, engineID).Set(threads)
+	warmingUp := sw.warmup.Excludes(metric.Timestamp)
+	if metric.Transaction {
+		config.TransactionCounter.WithLabelValues(collectionID, planID, runID, engineID, label,
+			strconv.FormatBool(metric.Success)).Inc()
+		config.TransactionLatencySummary.WithLabelValues(collectionID, label, runID).Observe(latency)
+		if warmingUp {
+			return
+		}
+		sw.transactionsLock.Lock()
+		sw.transactions.Observe(label, latency, metric.Success)
+		sw.transactionsLock.Unlock()
+		return
+	}
 	config.StatusCounter.WithLabelValues(sw.collectionID, planID, runID, engineID, label, status).Inc()
 	config.CollectionLatencySummary.WithLabelValues(collectionID, runID).Observe(latency)
 	config.PlanLatencySummary.WithLabelValues(collectionID, planID, runID).Observe(latency)
 	config.LabelLatencySummary.WithLabelValues(collectionID, label, runID).Observe(latency)
-	config.ThreadsGauge.WithLabelValues(collectionID, planID, runID, engineID).Set(threads)
-
-}
+	if tc := sw.throughput.Load(); tc != nil {
+		tc.observe()
+	}
+	if warmingUp {
+		return
+	}
 
-func (sw *SetagayaWrapper) listen() {
-	for {
-		select {
-		case s := <-sw.newClients:
-			// A new client has connected.
-			// Register their message channel
-			sw.clients[s] = true
-			log.Printf("setagaya-agent: Metric subscriber added. %d registered subscribers", len(sw.clients))
-		case s := <-sw.closingClients:
-			// A client has dettached and we want to
-			// stop sending them messages.
-			delete(sw.clients, s)
-			close(s)
-			log.Printf("setagaya-agent: Metric subscriber removed. %d registered subscribers", len(sw.clients))
-		case event := <-sw.Bus:
-			// We got a new event from the outside!
-			// Send event to all connected clients
-			sw.makePromMetrics(event)
-			for clientMessageChan := range sw.clients {
-				clientMessageChan <- event
-			}
-		}
+	sw.histogramLock.Lock()
+	sw.histogram.Observe(latency)
+	sw.histogramLock.Unlock()
+	sw.assertionsLock.Lock()
+	sw.assertions.Observe(label, metric.FailureMessage)
+	sw.assertionsLock.Unlock()
+	if !metric.Success {
+		sw.errorStatsLock.Lock()
+		sw.errorStats.Observe(label, status, metric.ErrorMessage())
+		sw.errorStatsLock.Unlock()
 	}
 }
 
@@ -254,63 +394,40 @@ func (sw *SetagayaWrapper) makeLogFile() string {
 	return path.Join(RESULT_ROOT, filename)
 }
 
-func (sw *SetagayaWrapper) tailJemeter() {
-	var t *tail.Tail
-	var err error
-	logFile := sw.makeLogFile()
-	for {
-		t, err = tail.TailFile(logFile, tail.Config{MustExist: true, Follow: true, Poll: true})
-		if err != nil {
-			time.Sleep(time.Second)
-			continue
+// tailJemeter follows the result files of the current run from the offsets, until jmeter is stopped or
+// the next run is started. The offsets are saved as they move so a restarted agent can carry on from them.
+func (sw *SetagayaWrapper) tailJemeter(offsets map[string]*resultOffset, since time.Time) {
+	sw.tailerLock.Lock()
+	defer sw.tailerLock.Unlock()
+	if sw.tailer != nil {
+		sw.tailer.stop()
+	}
+	state := tailState{
+		RunID:      sw.runID,
+		EngineID:   sw.engineID,
+		LogCounter: sw.logCounter,
+		JTLColumns: sw.jtlColumns,
+	}
+	checkpoint := func(offsets map[string]*resultOffset) {
+		state.Offsets = offsets
+		state.Running = sw.getPid() != 0
+		state.Checkpoint = time.Now()
+		if err := saveTailState(&state); err != nil {
+			log.Printf("setagaya-agent: Cannot save the tail state: %v", err)
 		}
-		break
 	}
+	sw.tailer = newResultTailer(sw.logCounter, sw.jtlColumns, sw.queueSample, offsets, since, sw.recordGap, checkpoint)
 	// It's not thread safe. But we should be ok since we don't perform tests in parallel.
 	sw.logCounter += 1
-	log.Printf("setagaya-agent: Start tailing JTL file %s", logFile)
-	for {
-		select {
-		case <-sw.closeSignal:
-			if err := t.Stop(); err != nil {
-				log.Printf("Error stopping tail: %v", err)
-			}
-			return
-		case line := <-t.Lines:
-			sw.Bus <- line.Text
-		}
-	}
+	sw.tailer.start()
 }
 
-func (sw *SetagayaWrapper) streamHandler(w http.ResponseWriter, r *http.Request) {
-	messageChan := make(chan string)
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
-		return
-
-	}
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	// Signal the sw that we have a new connection
-	sw.newClients <- messageChan
-	// Listen to connection close and un-register messageChan using context
-	ctx := r.Context()
-
-	go func() {
-		<-ctx.Done()
-		sw.closingClients <- messageChan
-	}()
-
-	for message := range messageChan {
-		if message == "" {
-			continue
-		}
-		fmt.Fprintf(w, "data: %s\n\n", message)
-		flusher.Flush()
+func (sw *SetagayaWrapper) stopTailing() {
+	sw.tailerLock.Lock()
+	defer sw.tailerLock.Unlock()
+	if sw.tailer != nil {
+		sw.tailer.stop()
+		sw.tailer = nil
 	}
 }
 
@@ -323,6 +440,9 @@ func (sw *SetagayaWrapper) stopHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println(err)
 		return
 	}
+	// The controller stops the engines once it collected their results, the engines running once are done
+	defer sw.runOnce.Stopped()
+	sw.stopThroughput(nil)
 	pid := sw.getPid()
 	if pid == 0 {
 		return
@@ -343,7 +463,16 @@ func (sw *SetagayaWrapper) stopHandler(w http.ResponseWriter, r *http.Request) {
 	for sw.getPid() != 0 {
 		time.Sleep(time.Second * 2)
 	}
-	sw.closeSignal <- 1
+	sw.stopTailing()
+	sw.resetSpill(spillDrainTimeout)
+}
+
+// stopThroughput ends the feedback loop of the previous run, and replaces its controller with the one of the next
+// run, nil when the run is stopped
+func (sw *SetagayaWrapper) stopThroughput(next *throughputController) {
+	if previous := sw.throughput.Swap(next); previous != nil {
+		previous.stop()
+	}
 }
 
 func (sw *SetagayaWrapper) setPid(pid int) {
@@ -378,8 +507,25 @@ func (sw *SetagayaWrapper) runCommand() int {
 	logFile := sw.makeLogFile()
 
 	// #nosec G204 - JMETER_EXECUTABLE and arguments are validated and controlled by container environment
-	cmd := exec.Command(JMETER_EXECUTABLE, "-n", "-t", JMX_FILEPATH, "-l", logFile,
-		"-q", PROPERTY_FILE, "-G", PROPERTY_FILE, "-j", STDERR)
+	args := []string{"-n", "-t", JMX_FILEPATH, "-l", logFile,
+		"-q", PROPERTY_FILE, "-G", PROPERTY_FILE, "-j", STDERR}
+	if tc := sw.throughput.Load(); tc != nil {
+		args = append(args, tc.jmeterArgs()...)
+	}
+	args = append(args, sw.failureCaptureArgs()...)
+	args = append(args, sw.connectionPolicyArgs()...)
+	args = append(args, sw.seedArgs()...)
+	if sw.pluginsFolder != "" {
+		args = append(args, "-Jsearch_paths="+sw.pluginsFolder)
+	}
+	if sw.librariesFolder != "" {
+		args = append(args, "-Juser.classpath="+sw.librariesFolder)
+	}
+	for name, value := range sw.parameters {
+		args = append(args, fmt.Sprintf("-J%s=%s", name, value))
+	}
+	cmd := exec.Command(JMETER_EXECUTABLE, args...)
+	cmd.Env = sw.dnsCachingEnv()
 	cmd.Stderr = sw.writer
 	err := cmd.Start()
 	if err != nil {
@@ -394,20 +540,11 @@ func (sw *SetagayaWrapper) runCommand() int {
 		}
 		log.Printf("setagaya-agent: Shutdown is finished, resetting pid to zero")
 		sw.setPid(0)
+		sw.runOnce.Finished()
 	}()
 	return pid
 }
 
-func cleanTestData() error {
-	if err := os.RemoveAll(TEST_DATA_FOLDER); err != nil {
-		return err
-	}
-	if err := os.MkdirAll(TEST_DATA_FOLDER, 0750); err != nil {
-		return err
-	}
-	return nil
-}
-
 func saveToDisk(filename string, file []byte) error {
 	// Sanitize filename to prevent path traversal attacks
 	cleanFilename := filepath.Base(filename)
@@ -456,19 +593,20 @@ func parseTestPlan(file []byte) (*etree.Document, error) {
 	return doc, nil
 }
 
-func modifyJMX(file []byte, threads, duration, rampTime string) ([]byte, error) {
+func modifyJMX(file []byte, threads, duration, rampTime string, rampdown int, stoppable bool, targetRPS float64,
+	captureFailures bool, dnsCaching *model.DNSCaching, connectionPolicy *model.ConnectionPolicy, seed *int64) ([]byte, []string, error) {
 	planDoc, err := parseTestPlan(file)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	durationInt, err := strconv.Atoi(duration)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// it includes threadgroups and setupthreadgroups
 	threadGroups, err := GetThreadGroups(planDoc)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	for _, tg := range threadGroups {
 		children := tg.ChildElements()
@@ -486,24 +624,75 @@ func modifyJMX(file []byte, threads, duration, rampTime string) ([]byte, error)
 			}
 		}
 	}
-	return planDoc.WriteToBytes()
+	// The controller can only ramp the engines down before the end when the test plan is prepared for it
+	if rampdown > 0 || stoppable {
+		if err := addRampdownPreProcessor(planDoc, durationInt*60, rampdown); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := addRuntimePropertiesPreProcessor(planDoc); err != nil {
+		return nil, nil, err
+	}
+	localizeIncludes(planDoc)
+	stripped := stripListeners(planDoc)
+	if seed != nil {
+		seedRandomVariables(planDoc, *seed)
+	}
+	if targetRPS > 0 {
+		if err := addThroughputTimer(planDoc); err != nil {
+			return nil, nil, err
+		}
+	}
+	if captureFailures {
+		if err := addFailureCaptureListener(planDoc); err != nil {
+			return nil, nil, err
+		}
+	}
+	if dnsCaching != nil && dnsCaching.UsesCacheManager() {
+		if err := addDNSCacheManager(planDoc, dnsCaching); err != nil {
+			return nil, nil, err
+		}
+	}
+	if connectionPolicy != nil {
+		threadsInt, err := strconv.Atoi(threads)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := applyConnectionPolicy(planDoc, connectionPolicy, threadsInt); err != nil {
+			return nil, nil, err
+		}
+	}
+	modified, err := planDoc.WriteToBytes()
+	return modified, stripped, err
 }
 
-func (sw *SetagayaWrapper) prepareJMX(sf *model.SetagayaFile, threads, duration, rampTime string) error {
-	file, err := sw.storageClient.Download(sf.Filepath)
+func (sw *SetagayaWrapper) prepareJMX(sf *model.SetagayaFile, parameters map[string]string, threads, duration, rampTime string,
+	rampdown int, stoppable bool, targetRPS float64, captureFailures bool, dnsCaching *model.DNSCaching,
+	connectionPolicy *model.ConnectionPolicy, seed *int64) error {
+	file, err := enginesModel.FetchFile(sw.storageClient, sf)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-	modified, err := modifyJMX(file, threads, duration, rampTime)
+	// The template variables are rendered before the plan is modified, the modifications do not add any
+	if file, err = model.RenderTemplate(file, parameters); err != nil {
+		return err
+	}
+	modified, stripped, err := modifyJMX(file, threads, duration, rampTime, rampdown, stoppable, targetRPS, captureFailures,
+		dnsCaching, connectionPolicy, seed)
 	if err != nil {
 		return err
 	}
+	if len(stripped) > 0 {
+		log.Printf("setagaya-agent: Disabled the listeners %s", strings.Join(stripped, ", "))
+	}
+	sw.strippedListeners = stripped
 	return saveToDisk(JMX_FILENAME, modified)
 }
 
-func (sw *SetagayaWrapper) prepareCSV(sf *model.SetagayaFile) error {
-	file, err := sw.storageClient.Download(sf.Filepath)
+// prepareCSV keeps the part of the csv of the engine, with its rows shuffled when there is a seed to shuffle them with
+func (sw *SetagayaWrapper) prepareCSV(sf *model.SetagayaFile, shuffleSeed *int64) error {
+	file, err := enginesModel.FetchFile(sw.storageClient, sf)
 	if err != nil {
 		return err
 	}
@@ -511,11 +700,16 @@ func (sw *SetagayaWrapper) prepareCSV(sf *model.SetagayaFile) error {
 	if err != nil {
 		return err
 	}
+	if shuffleSeed != nil {
+		if splittedCSV, err = utils.ShuffleCSV(splittedCSV, *shuffleSeed); err != nil {
+			return err
+		}
+	}
 	return saveToDisk(sf.Filename, splittedCSV)
 }
 
 func (sw *SetagayaWrapper) downloadAndSaveFile(sf *model.SetagayaFile) error {
-	file, err := sw.storageClient.Download(sf.Filepath)
+	file, err := enginesModel.FetchFile(sw.storageClient, sf)
 	if err != nil {
 		return err
 	}
@@ -523,15 +717,28 @@ func (sw *SetagayaWrapper) downloadAndSaveFile(sf *model.SetagayaFile) error {
 }
 
 func (sw *SetagayaWrapper) prepareTestData(edc enginesModel.EngineDataConfig) error {
+	var shuffleSeed *int64
+	if edc.ShuffleData {
+		shuffleSeed = edc.Seed
+	}
+	// The test plan is paced when the engine has a target or a cap
+	pacing := enginesModel.CapThroughput(edc.TargetRPS, edc.MaxRPS)
 	for _, sf := range edc.EngineData {
 		fileType := filepath.Ext(sf.Filename)
 		switch fileType {
 		case ".jmx":
-			if err := sw.prepareJMX(sf, edc.Concurrency, edc.Duration, edc.Rampup); err != nil {
+			if sf.Fragment {
+				if err := sw.prepareFragment(sf, edc.Parameters); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := sw.prepareJMX(sf, edc.Parameters, edc.Concurrency, edc.Duration, edc.Rampup, edc.Rampdown, edc.Attended, pacing, edc.FailureCapture != nil,
+				edc.DNSCaching, edc.ConnectionPolicy, edc.Seed); err != nil {
 				return err
 			}
 		case ".csv":
-			if err := sw.prepareCSV(sf); err != nil {
+			if err := sw.prepareCSV(sf, shuffleSeed); err != nil {
 				return err
 			}
 		default:
@@ -543,6 +750,32 @@ func (sw *SetagayaWrapper) prepareTestData(edc enginesModel.EngineDataConfig) er
 	return nil
 }
 
+// jmxChecksum is the sha256 of the test plan as modified for the run, so the run can be audited
+func jmxChecksum() string {
+	file, err := os.ReadFile(JMX_FILEPATH)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(file)
+	return hex.EncodeToString(sum[:])
+}
+
+// installArtifacts fetches the plugins and the libraries of the run. They are added to the classpath of jmeter
+// when it's started.
+func (sw *SetagayaWrapper) installArtifacts(edc enginesModel.EngineDataConfig) error {
+	client := &http.Client{Timeout: ARTIFACT_TIMEOUT}
+	fetcher := artifacts.NewFetcher(client, edc.ArtifactMirror, ARTIFACT_CACHE_FOLDER)
+	plugins, libraries, err := fetcher.Install(edc.Artifacts, ARTIFACT_FOLDER)
+	if err != nil {
+		return err
+	}
+	sw.pluginsFolder, sw.librariesFolder = plugins, libraries
+	if len(edc.Artifacts) > 0 {
+		log.Printf("setagaya-agent: Installed %d artifacts", len(edc.Artifacts))
+	}
+	return nil
+}
+
 func (sw *SetagayaWrapper) startHandler(w http.ResponseWriter, r *http.Request) {
 	sw.handlerLock.Lock()
 	defer sw.handlerLock.Unlock()
@@ -565,7 +798,27 @@ func (sw *SetagayaWrapper) startHandler(w http.ResponseWriter, r *http.Request)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if err := cleanTestData(); err != nil {
+		if _, err := enginesModel.NewResultParser(edc.JTLColumns); err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := edc.CheckNetworkShaping(); err != nil {
+			log.Printf("setagaya-agent: %v", err)
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if err := sw.sidecar.WaitReady(); err != nil {
+			log.Printf("setagaya-agent: %v", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if err := enginesModel.CleanFolder(TEST_DATA_FOLDER); err != nil {
+			log.Println(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := cleanFailureCaptures(); err != nil {
 			log.Println(err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
@@ -579,11 +832,63 @@ func (sw *SetagayaWrapper) startHandler(w http.ResponseWriter, r *http.Request)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		if err := sw.installArtifacts(edc); err != nil {
+			log.Printf("setagaya-agent: Cannot install the artifacts: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := sw.startResultSegments(edc); err != nil {
+			log.Printf("setagaya-agent: Cannot start the result segments: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 		sw.runID = int(edc.RunID)
 		sw.engineID = edc.EngineID
+		sw.setRegionMetric(edc.Region)
+		sw.histogramLock.Lock()
+		sw.histogram = enginesModel.NewLatencyHistogram()
+		sw.histogramLock.Unlock()
+		sw.errorStatsLock.Lock()
+		sw.errorStats = enginesModel.NewErrorStats()
+		sw.errorStatsLock.Unlock()
+		sw.assertionsLock.Lock()
+		sw.assertions = enginesModel.NewAssertionStats()
+		sw.assertionsLock.Unlock()
+		sw.transactionsLock.Lock()
+		sw.transactions = enginesModel.NewTransactionStats()
+		sw.transactionsLock.Unlock()
+		sw.parameters = edc.Parameters
+		sw.runtimePropertiesLock.Lock()
+		sw.runtimeProperties = nil
+		sw.runtimePropertiesLock.Unlock()
+		sw.failureCapture = edc.FailureCapture
+		sw.dnsCaching = edc.DNSCaching
+		sw.connectionPolicy = edc.ConnectionPolicy
+		sw.seed = edc.Seed
+		sw.warmup = enginesModel.NewWarmup(time.Now(), edc.Warmup)
+		sw.jtlColumns = edc.JTLColumns
+		sw.gapsLock.Lock()
+		sw.gaps = nil
+		sw.gapsLock.Unlock()
+		sw.stream.Reset()
+		sw.resetSpill(0)
+		var tc *throughputController
+		if edc.TargetRPS > 0 || edc.MaxRPS > 0 {
+			tc = newThroughputController(edc.TargetRPS, edc.MaxRPS, sw.writeRuntimeProperties)
+		}
+		sw.stopThroughput(tc)
 		pid := sw.runCommand()
-		go sw.tailJemeter()
+		sw.tailJemeter(nil, time.Now())
+		// A cap alone is a fixed pacing, there is no target to hold
+		if tc != nil && tc.target > 0 && pid != 0 {
+			go tc.run(throughputFeedbackInterval, func() bool { return sw.getPid() != 0 })
+		}
 		log.Printf("setagaya-agent: Start running Jmeter process with pid: %d", pid)
+		if checksum := jmxChecksum(); checksum != "" {
+			w.Header().Set(enginesModel.JMXChecksumHeader, checksum)
+		}
+		jmeterVersion().SetHeaders(w.Header())
+		enginesModel.SetStrippedListeners(w.Header(), sw.strippedListeners)
 		if _, err := w.Write([]byte(strconv.Itoa(pid))); err != nil {
 			log.Printf("Error writing PID response: %v", err)
 		}
@@ -603,17 +908,59 @@ func (sw *SetagayaWrapper) progressHandler(w http.ResponseWriter, r *http.Reques
 	w.WriteHeader(http.StatusOK)
 }
 
+// histogramHandler returns the latency digest of the current run so the controller can merge
+// digests from all the engines into true collection level percentiles
+func (sw *SetagayaWrapper) histogramHandler(w http.ResponseWriter, r *http.Request) {
+	sw.histogramLock.RLock()
+	defer sw.histogramLock.RUnlock()
+	enginesModel.WriteJSON(w, sw.histogram)
+}
+
+// errorsHandler returns the failed samples of the current run so the controller can aggregate them across engines
+func (sw *SetagayaWrapper) errorsHandler(w http.ResponseWriter, r *http.Request) {
+	sw.errorStatsLock.RLock()
+	defer sw.errorStatsLock.RUnlock()
+	enginesModel.WriteJSON(w, sw.errorStats)
+}
+
+// assertionsHandler returns the assertion results of the current run so the controller can add them to the run summary
+func (sw *SetagayaWrapper) assertionsHandler(w http.ResponseWriter, r *http.Request) {
+	sw.assertionsLock.RLock()
+	defer sw.assertionsLock.RUnlock()
+	enginesModel.WriteJSON(w, sw.assertions)
+}
+
+// transactionsHandler returns the transaction controller samples of the current run
+func (sw *SetagayaWrapper) transactionsHandler(w http.ResponseWriter, r *http.Request) {
+	sw.transactionsLock.RLock()
+	defer sw.transactionsLock.RUnlock()
+	enginesModel.WriteJSON(w, sw.transactions)
+}
+
+// gapsHandler returns the periods of the current run whose samples are missing
+func (sw *SetagayaWrapper) gapsHandler(w http.ResponseWriter, r *http.Request) {
+	sw.gapsLock.RLock()
+	defer sw.gapsLock.RUnlock()
+	gaps := sw.gaps
+	if gaps == nil {
+		gaps = []*enginesModel.ResultGap{}
+	}
+	enginesModel.WriteJSON(w, gaps)
+}
+
 func (sw *SetagayaWrapper) stdoutHandler(w http.ResponseWriter, r *http.Request) {
 	if _, err := w.Write(sw.buffer); err != nil {
 		log.Printf("Error writing stdout response: %v", err)
 	}
 }
 
-// This func reports the cpu/memory usage of the engine
+// This func reports the cpu/memory usage and the network of the engine
 // It will run when the engine is started until it's finished.
 func (sw *SetagayaWrapper) reportOwnMetrics(interval time.Duration) error {
 	prev := uint64(0)
+	var prevNetwork *containerstats.NetworkStats
 	engineNumber := strconv.Itoa(sw.engineID)
+	cpuFactor := containerstats.CPUFactor()
 	for {
 		time.Sleep(interval)
 		cpuUsage, err := containerstats.ReadCPUUsage()
@@ -631,15 +978,123 @@ func (sw *SetagayaWrapper) reportOwnMetrics(interval time.Duration) error {
 			return err
 		}
 		config.CpuGauge.WithLabelValues(sw.collectionID,
-			sw.planID, engineNumber).Set(float64(used))
+			sw.planID, engineNumber).Set(float64(used) * cpuFactor)
 		config.MemGauge.WithLabelValues(sw.collectionID,
 			sw.planID, engineNumber).Set(float64(memoryUsage))
+		for _, resource := range containerstats.PressureResources {
+			// The nodes running cgroup v1 do not report the pressure
+			p, err := containerstats.ReadPressure(resource)
+			if err != nil {
+				continue
+			}
+			config.PressureGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, resource, "some").Set(p.Some.Avg10)
+			if p.Full != nil {
+				config.PressureGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, resource, "full").Set(p.Full.Avg10)
+			}
+		}
+		// The network is reported on a best effort basis, the engine keeps running without it
+		ns, err := containerstats.ReadNetworkStats()
+		if err != nil {
+			continue
+		}
+		if prevNetwork != nil {
+			rates := ns.Rates(prevNetwork, interval)
+			config.NetworkGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "rx").Set(rates.RxBytes)
+			config.NetworkGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "tx").Set(rates.TxBytes)
+			config.TCPRetransmitsGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber).Set(rates.RetransSegs)
+		}
+		prevNetwork = ns
+		config.TCPConnectionsGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "established").
+			Set(float64(ns.Established))
+		config.TCPConnectionsGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "time_wait").
+			Set(float64(ns.TimeWait))
 	}
 }
 
+// reportJVMMetrics reports the heap, the garbage collections and the threads of the JVM running JMeter, so the long
+// pauses can be told apart from the latency of the target. The JVM publishes them in its perf data, nothing attaches
+// to it. They are reported on a best effort basis, while JMeter runs.
+func (sw *SetagayaWrapper) reportJVMMetrics(interval time.Duration) {
+	var prev *jvmstats.Stats
+	engineNumber := strconv.Itoa(sw.engineID)
+	for {
+		time.Sleep(interval)
+		pid := sw.getPid()
+		if pid == 0 {
+			prev = nil
+			continue
+		}
+		s, err := jvmstats.Read(pid)
+		if err != nil {
+			prev = nil
+			continue
+		}
+		config.JVMHeapGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "used").Set(float64(s.HeapUsed))
+		config.JVMHeapGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "committed").
+			Set(float64(s.HeapCommitted))
+		config.JVMHeapGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "max").Set(float64(s.HeapMax))
+		config.JVMThreadsGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "live").
+			Set(float64(s.LiveThreads))
+		config.JVMThreadsGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "daemon").
+			Set(float64(s.DaemonThreads))
+		for _, c := range s.Collectors {
+			config.JVMGCPauseGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, c.Name).
+				Set(c.LastPause.Seconds())
+		}
+		if prev != nil {
+			for name, share := range s.GCTime(prev, interval) {
+				config.JVMGCTimeGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, name).Set(share)
+			}
+		}
+		prev = s
+	}
+}
+
+func jmeterVersion() *enginesModel.EngineVersion {
+	return enginesModel.NewEngineVersion(model.JmeterEngine, "JMETER_VERSION")
+}
+
+// versionHandler returns the versions of the agent and of JMeter
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	enginesModel.WriteJSON(w, jmeterVersion())
+}
+
+// echoHandler is the target of the self test of the platform, it responds with what it was sent
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if _, err := io.Copy(w, r.Body); err != nil {
+		log.Printf("Error echoing the request: %v", err)
+	}
+}
+
+// exitOnTermination closes the spill buffer and stops the sidecar of the service mesh along the engine, the pod
+// would not terminate while the sidecar runs
+func (sw *SetagayaWrapper) exitOnTermination() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	<-signals
+	sw.exit()
+}
+
+// exit closes the spill buffer, stops the sidecar along the engine and exits
+func (sw *SetagayaWrapper) exit() {
+	if sw.spill != nil {
+		if err := sw.spill.close(); err != nil {
+			log.Printf("setagaya-agent: Cannot close the spill buffer: %v", err)
+		}
+	}
+	if err := sw.sidecar.Quit(); err != nil {
+		log.Printf("setagaya-agent: Cannot stop the sidecar: %v", err)
+	}
+	os.Exit(0)
+}
+
 func main() {
 	sw := NewServer()
 	go func() {
+		if !CGROUP_METRICS {
+			return
+		}
 		if err := sw.reportOwnMetrics(5 * time.Second); err != nil {
 			// if the engine is having issues with reading stats from cgroup
 			// we should fast fail to detect the issue. It could be due to
@@ -647,11 +1102,26 @@ func main() {
 			log.Fatal(err)
 		}
 	}()
+	go sw.reportJVMMetrics(5 * time.Second)
+	go sw.exitOnTermination()
 	http.HandleFunc("/start", sw.startHandler)
 	http.HandleFunc("/stop", sw.stopHandler)
-	http.HandleFunc("/stream", sw.streamHandler)
+	http.HandleFunc("/stream", sw.stream.ServeEvents)
+	http.HandleFunc("/stream/batches", sw.stream.ServeBatches)
 	http.HandleFunc("/progress", sw.progressHandler)
 	http.HandleFunc("/output", sw.stdoutHandler)
+	http.HandleFunc("/histogram", sw.histogramHandler)
+	http.HandleFunc("/errors", sw.errorsHandler)
+	http.HandleFunc("/assertions", sw.assertionsHandler)
+	http.HandleFunc("/transactions", sw.transactionsHandler)
+	http.HandleFunc("/gaps", sw.gapsHandler)
+	http.HandleFunc("/debug", sw.debugHandler)
+	http.HandleFunc("/failures", sw.failuresHandler)
+	http.HandleFunc("/segments", sw.segmentsHandler)
+	http.HandleFunc("/properties", sw.propertiesHandler)
+	http.HandleFunc("/rampdown", sw.rampdownHandler)
+	http.HandleFunc("/echo", echoHandler)
+	http.HandleFunc("/version", versionHandler)
 	http.HandleFunc("/metrics", promhttp.Handler().ServeHTTP)
 
 	// Create HTTP server with timeouts for security
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// The spill buffer lives next to the result files so the samples queued in it outlive a restart of the agent
+	SPILL_BUFFER_FILE = "/test-result/spill.buf"
+	SPILL_BUFFER_SIZE = 64 << 20
+	// The read and write positions are kept at the start of the file, the ring follows them
+	spillHeaderSize = 16
+	spillLengthSize = 4
+	// How long a stopped run has to stream the samples left in the buffer before they are dropped
+	spillDrainTimeout = 5 * time.Second
+)
+
+// spillBuffer queues the samples between the result tailer and the stream. The queue is a ring in a
+// memory-mapped file, so bursts are absorbed by the page cache rather than the heap, and the tailer keeps
+// reading the result files while the subscribers catch up. When the ring is full the tailer waits, the
+// samples stay in the result files until there is room again, so none is dropped.
+type spillBuffer struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	file *os.File
+	data []byte
+	ring []byte
+	// Positions of the next read and write. They only grow, the index in the ring is the position modulo its size
+	head   uint64
+	tail   uint64
+	closed bool
+}
+
+func newSpillBuffer(filename string, size int) (*spillBuffer, error) {
+	if size <= spillHeaderSize+spillLengthSize {
+		return nil, errors.New("spill buffer is too small")
+	}
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// A file of another size is not a buffer we can carry on with
+	resume := fi.Size() == int64(size)
+	if !resume {
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := f.Truncate(int64(size)); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	data, err := mmapFile(f, size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	b := &spillBuffer{
+		file: f,
+		data: data,
+		ring: data[spillHeaderSize:],
+	}
+	b.cond = sync.NewCond(&b.mu)
+	if resume {
+		b.head = binary.LittleEndian.Uint64(data[0:8])
+		b.tail = binary.LittleEndian.Uint64(data[8:16])
+		if b.head > b.tail || b.tail-b.head > uint64(len(b.ring)) {
+			log.Printf("setagaya-agent: Spill buffer %s is corrupted, it's started over", filename)
+			b.head, b.tail = 0, 0
+		} else if b.tail > b.head {
+			log.Printf("setagaya-agent: Resuming %d bytes of samples from the spill buffer", b.tail-b.head)
+		}
+	}
+	b.savePositions()
+	return b, nil
+}
+
+func (b *spillBuffer) savePositions() {
+	binary.LittleEndian.PutUint64(b.data[0:8], b.head)
+	binary.LittleEndian.PutUint64(b.data[8:16], b.tail)
+}
+
+func (b *spillBuffer) write(pos uint64, p []byte) {
+	i := int(pos % uint64(len(b.ring)))
+	n := copy(b.ring[i:], p)
+	copy(b.ring, p[n:])
+}
+
+func (b *spillBuffer) read(pos uint64, p []byte) {
+	i := int(pos % uint64(len(b.ring)))
+	n := copy(p, b.ring[i:])
+	copy(p[n:], b.ring)
+}
+
+// push queues the line. It waits while the buffer is full, and returns false once the buffer is closed or stop is
+// closed while it waits
+func (b *spillBuffer) push(line string, stop <-chan struct{}) bool {
+	size := uint64(spillLengthSize + len(line))
+	if size > uint64(len(b.ring)) {
+		log.Printf("setagaya-agent: Sample of %d bytes does not fit in the spill buffer", len(line))
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	watching := false
+	for !b.closed && b.tail-b.head+size > uint64(len(b.ring)) {
+		if isClosed(stop) {
+			return false
+		}
+		// The waits are rare, only they pay for a goroutine waking them up when stop is closed
+		if !watching {
+			watching = true
+			done := make(chan struct{})
+			defer close(done)
+			go b.wakeOn(stop, done)
+		}
+		b.cond.Wait()
+	}
+	if b.closed {
+		return false
+	}
+	var length [spillLengthSize]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(line)))
+	b.write(b.tail, length[:])
+	b.write(b.tail+spillLengthSize, []byte(line))
+	b.tail += size
+	b.savePositions()
+	b.cond.Broadcast()
+	return true
+}
+
+func (b *spillBuffer) wakeOn(stop, done <-chan struct{}) {
+	select {
+	case <-stop:
+		b.mu.Lock()
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	case <-done:
+	}
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// peek returns the oldest line and its position, without removing it. The line is removed with advance once it's
+// delivered, so the line being delivered is still in the buffer after a restart. It waits while the buffer is empty
+// and returns false once the buffer is closed.
+func (b *spillBuffer) peek() (string, uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		for !b.closed && b.head == b.tail {
+			b.cond.Wait()
+		}
+		if b.closed {
+			return "", 0, false
+		}
+		var lb [spillLengthSize]byte
+		b.read(b.head, lb[:])
+		length := uint64(binary.LittleEndian.Uint32(lb[:]))
+		if b.tail-b.head < spillLengthSize || length > b.tail-b.head-spillLengthSize {
+			// A write torn by a crash of the node, the rest of the ring cannot be trusted
+			log.Printf("setagaya-agent: Spill buffer has a sample of %d bytes out of %d, it's started over", length,
+				b.tail-b.head)
+			b.head = b.tail
+			b.savePositions()
+			b.cond.Broadcast()
+			continue
+		}
+		line := make([]byte, length)
+		b.read(b.head+spillLengthSize, line)
+		return string(line), b.head, true
+	}
+}
+
+// advance removes the line peeked at pos. It does nothing when the buffer was reset since
+func (b *spillBuffer) advance(pos uint64, line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || b.head != pos {
+		return
+	}
+	b.head += uint64(spillLengthSize + len(line))
+	b.savePositions()
+	b.cond.Broadcast()
+}
+
+// current tells whether the line peeked at pos is still the oldest one, it's not once the buffer is reset
+func (b *spillBuffer) current(pos uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.head == pos && b.head != b.tail
+}
+
+func (b *spillBuffer) empty() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.head == b.tail
+}
+
+// reset drops the lines queued, so the samples of a run are never streamed in the next one
+func (b *spillBuffer) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.head = b.tail
+	b.savePositions()
+	b.cond.Broadcast()
+}
+
+// close wakes up the pushes and the peeks waiting, and unmaps the file. The positions are kept in the file
+func (b *spillBuffer) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.cond.Broadcast()
+	if err := munmapFile(b.data); err != nil {
+		return err
+	}
+	return b.file.Close()
+}
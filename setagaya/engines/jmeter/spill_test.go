@@ -0,0 +1,207 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A ring of 48 bytes holds 4 samples of 8 characters, their length included
+const testSpillSize = spillHeaderSize + 48
+
+func newTestSpillBuffer(t *testing.T, filename string) *spillBuffer {
+	b, err := newSpillBuffer(filename, testSpillSize)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return b
+}
+
+// pop removes the oldest line as drainSpill does once it's delivered
+func pop(b *spillBuffer) (string, bool) {
+	line, pos, ok := b.peek()
+	if ok {
+		b.advance(pos, line)
+	}
+	return line, ok
+}
+
+func TestSpillBufferWrapAround(t *testing.T) {
+	b := newTestSpillBuffer(t, filepath.Join(t.TempDir(), "spill.buf"))
+	defer b.close()
+	// The positions go round the ring several times, the samples straddle its end
+	for i := 0; i < 20; i++ {
+		line := string(rune('a'+i)) + "-sample"
+		assert.True(t, b.push(line, nil))
+		got, ok := pop(b)
+		assert.True(t, ok)
+		assert.Equal(t, line, got)
+	}
+	assert.True(t, b.tail > uint64(len(b.ring)))
+	assert.True(t, b.empty())
+}
+
+func TestSpillBufferBlocks(t *testing.T) {
+	b := newTestSpillBuffer(t, filepath.Join(t.TempDir(), "spill.buf"))
+	defer b.close()
+
+	// An empty buffer holds the peek until a sample is pushed
+	peeked := make(chan string)
+	go func() {
+		line, _ := pop(b)
+		peeked <- line
+	}()
+	select {
+	case <-peeked:
+		t.Fatal("peek returned from an empty buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.True(t, b.push("sample-0", nil))
+	assert.Equal(t, "sample-0", <-peeked)
+
+	// A full buffer holds the push until a sample is removed
+	for i := 0; i < 4; i++ {
+		assert.True(t, b.push("sample-0", nil))
+	}
+	pushed := make(chan bool)
+	go func() { pushed <- b.push("sample-5", nil) }()
+	select {
+	case <-pushed:
+		t.Fatal("push returned from a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, ok := pop(b)
+	assert.True(t, ok)
+	assert.True(t, <-pushed)
+
+	// Stopping the tailer gives up the push
+	stop := make(chan struct{})
+	go func() { pushed <- b.push("sample-6", stop) }()
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	assert.False(t, <-pushed)
+
+	// A sample larger than the ring is never queued
+	assert.False(t, b.push(string(make([]byte, 64)), nil))
+}
+
+func TestSpillBufferClose(t *testing.T) {
+	b := newTestSpillBuffer(t, filepath.Join(t.TempDir(), "spill.buf"))
+	peeked := make(chan bool)
+	go func() {
+		_, _, ok := b.peek()
+		peeked <- ok
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, b.close())
+	assert.False(t, <-peeked)
+	assert.False(t, b.push("sample", nil))
+	// Closing twice and resetting a closed buffer do nothing
+	assert.NoError(t, b.close())
+	b.reset()
+
+	full := newTestSpillBuffer(t, filepath.Join(t.TempDir(), "spill.buf"))
+	for i := 0; i < 4; i++ {
+		assert.True(t, full.push("sample-0", nil))
+	}
+	pushed := make(chan bool)
+	go func() { pushed <- full.push("sample-5", nil) }()
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, full.close())
+	assert.False(t, <-pushed)
+}
+
+func TestSpillBufferResume(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "spill.buf")
+	b := newTestSpillBuffer(t, filename)
+	assert.True(t, b.push("sample-0", nil))
+	assert.True(t, b.push("sample-1", nil))
+	assert.True(t, b.push("sample-2", nil))
+	_, ok := pop(b)
+	assert.True(t, ok)
+	// Peeked but not delivered when the agent restarts
+	_, _, ok = b.peek()
+	assert.True(t, ok)
+	assert.NoError(t, b.close())
+
+	b = newTestSpillBuffer(t, filename)
+	line, ok := pop(b)
+	assert.True(t, ok)
+	assert.Equal(t, "sample-1", line)
+	line, ok = pop(b)
+	assert.True(t, ok)
+	assert.Equal(t, "sample-2", line)
+	assert.True(t, b.empty())
+
+	// A reset drops the samples, the line peeked before it is not removed twice
+	assert.True(t, b.push("sample-3", nil))
+	line, pos, _ := b.peek()
+	assert.True(t, b.current(pos))
+	b.reset()
+	assert.False(t, b.current(pos))
+	b.advance(pos, line)
+	assert.True(t, b.empty())
+	assert.NoError(t, b.close())
+
+	// A file of another size is started over
+	assert.NoError(t, os.Truncate(filename, testSpillSize+8))
+	b, err := newSpillBuffer(filename, testSpillSize)
+	assert.NoError(t, err)
+	assert.True(t, b.empty())
+	assert.NoError(t, b.close())
+}
+
+func TestSpillBufferCorrupted(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "spill.buf")
+	b := newTestSpillBuffer(t, filename)
+	assert.True(t, b.push("sample-0", nil))
+	assert.NoError(t, b.close())
+
+	// The head past the tail
+	writeSpillPositions(t, filename, 40, 12)
+	b = newTestSpillBuffer(t, filename)
+	assert.Equal(t, uint64(0), b.head)
+	assert.Equal(t, uint64(0), b.tail)
+	assert.NoError(t, b.close())
+
+	// More queued than the ring holds
+	writeSpillPositions(t, filename, 0, 100)
+	b = newTestSpillBuffer(t, filename)
+	assert.True(t, b.empty())
+	assert.NoError(t, b.close())
+
+	// A length torn by a crash, larger than what is queued: the ring is started over rather than read
+	b = newTestSpillBuffer(t, filename)
+	assert.True(t, b.push("sample-0", nil))
+	binary.LittleEndian.PutUint32(b.ring[b.head%uint64(len(b.ring)):], 1<<31)
+	assert.True(t, b.push("sample-1", nil))
+	peeked := make(chan bool)
+	go func() {
+		_, _, ok := b.peek()
+		peeked <- ok
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, b.empty())
+	assert.True(t, b.push("sample-2", nil))
+	assert.True(t, <-peeked)
+	assert.NoError(t, b.close())
+}
+
+func writeSpillPositions(t *testing.T, filename string, head, tail uint64) {
+	f, err := os.OpenFile(filename, os.O_RDWR, 0600)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer f.Close()
+	var header [spillHeaderSize]byte
+	binary.LittleEndian.PutUint64(header[0:8], head)
+	binary.LittleEndian.PutUint64(header[8:16], tail)
+	_, err = f.WriteAt(header[:], 0)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+const (
+	// The tail state lives next to the result files so it outlives a restart of the agent
+	TAIL_STATE_FILE = "/test-result/tail-state.json"
+	// How often new result files are looked for and the read offsets are saved
+	tailCheckpointInterval = time.Second
+	// How often a result file read to its end is checked for new samples
+	tailPollInterval = 250 * time.Millisecond
+)
+
+// resultOffset is how far a result file has been read
+type resultOffset struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+}
+
+// tailState is what a restarted agent needs to carry on with the run it was serving
+type tailState struct {
+	RunID      int      `json:"run_id"`
+	EngineID   int      `json:"engine_id"`
+	LogCounter int      `json:"log_counter"`
+	JTLColumns []string `json:"jtl_columns,omitempty"`
+	// Read offsets by file identity, see fileID
+	Offsets map[string]*resultOffset `json:"offsets"`
+	// True while jmeter is running. When a restarted agent finds it true, jmeter was stopped with the agent
+	Running    bool      `json:"running"`
+	Checkpoint time.Time `json:"checkpoint"`
+}
+
+func saveTailState(state *tailState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// The state is replaced in one go, a restart while writing leaves the previous state
+	tmp := TAIL_STATE_FILE + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, TAIL_STATE_FILE)
+}
+
+func loadTailState() (*tailState, error) {
+	b, err := os.ReadFile(TAIL_STATE_FILE)
+	if err != nil {
+		return nil, err
+	}
+	state := new(tailState)
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, err
+	}
+	if state.Offsets == nil {
+		state.Offsets = map[string]*resultOffset{}
+	}
+	return state, nil
+}
+
+func readFirstLine(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// resultFilePatterns matches the result files of a run. Jmeter writes the file passed with -l, rotation renames it
+// with a suffix, and the plans can write more result files next to it, e.g. kpi-0-errors.jtl.
+func resultFilePatterns(root string, logCounter int) []string {
+	return []string{
+		path.Join(root, fmt.Sprintf("kpi-%d.jtl*", logCounter)),
+		path.Join(root, fmt.Sprintf("kpi-%d-*.jtl*", logCounter)),
+	}
+}
+
+// resultTailer follows all the result files of a run and sends their samples to the stream.
+// Files are rotated by renaming them. A file truncated in place is read again from its start.
+type resultTailer struct {
+	// Folder of the result files, RESULT_ROOT
+	root       string
+	logCounter int
+	columns    []string
+	// Hands a sample over to the stream, it returns false when stop is closed before the stream took it
+	send func(line string, stop <-chan struct{}) bool
+	// When the offsets were last known to be complete. Samples lost after it are reported from there
+	since time.Time
+	gap   func(*enginesModel.ResultGap)
+	// Saves the offsets so a restarted agent carries on from them
+	checkpoint func(map[string]*resultOffset)
+
+	mu      sync.Mutex
+	offsets map[string]*resultOffset
+	active  map[string]bool
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newResultTailer(logCounter int, columns []string, send func(string, <-chan struct{}) bool,
+	offsets map[string]*resultOffset, since time.Time, gap func(*enginesModel.ResultGap), checkpoint func(map[string]*resultOffset)) *resultTailer {
+	if offsets == nil {
+		offsets = map[string]*resultOffset{}
+	}
+	return &resultTailer{
+		root:       RESULT_ROOT,
+		logCounter: logCounter,
+		columns:    columns,
+		send:       send,
+		since:      since,
+		gap:        gap,
+		checkpoint: checkpoint,
+		offsets:    offsets,
+		active:     map[string]bool{},
+		stopCh:     make(chan struct{}),
+	}
+}
+
+func (rt *resultTailer) start() {
+	rt.wg.Add(1)
+	go rt.run()
+}
+
+// run looks for the result files of the run and saves the read offsets until the tailer is stopped
+func (rt *resultTailer) run() {
+	defer rt.wg.Done()
+	ticker := time.NewTicker(tailCheckpointInterval)
+	defer ticker.Stop()
+	for {
+		rt.discover()
+		rt.checkpoint(rt.snapshot())
+		select {
+		case <-rt.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop stops tailing all the files and saves the final offsets
+func (rt *resultTailer) stop() {
+	close(rt.stopCh)
+	rt.wg.Wait()
+	rt.checkpoint(rt.snapshot())
+}
+
+func (rt *resultTailer) snapshot() map[string]*resultOffset {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	offsets := make(map[string]*resultOffset, len(rt.offsets))
+	for id, o := range rt.offsets {
+		offsets[id] = &resultOffset{Path: o.Path, Offset: o.Offset}
+	}
+	return offsets
+}
+
+func (rt *resultTailer) discover() {
+	for _, pattern := range resultFilePatterns(rt.root, rt.logCounter) {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Printf("setagaya-agent: Cannot look for result files: %v", err)
+			continue
+		}
+		for _, f := range files {
+			fi, err := os.Stat(f)
+			if err != nil || fi.IsDir() {
+				continue
+			}
+			rt.follow(f, fi)
+		}
+	}
+}
+
+func (rt *resultTailer) follow(filename string, fi os.FileInfo) {
+	id := fileID(filename, fi)
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	o, known := rt.offsets[id]
+	if !known {
+		o = new(resultOffset)
+		rt.offsets[id] = o
+	}
+	o.Path = filename
+	if rt.active[id] {
+		return
+	}
+	if o.Offset > fi.Size() {
+		// The file was truncated while nobody was reading it, what was written before is gone
+		rt.gap(&enginesModel.ResultGap{
+			File:   filepath.Base(filename),
+			Start:  rt.since,
+			End:    time.Now(),
+			Reason: enginesModel.GapReasonTruncated,
+		})
+		o.Offset = 0
+	}
+	if known && o.Offset == fi.Size() {
+		return
+	}
+	rt.active[id] = true
+	rt.wg.Add(1)
+	go rt.tailFile(id, filename, o.Offset)
+}
+
+func (rt *resultTailer) tailFile(id, filename string, offset int64) {
+	defer rt.wg.Done()
+	defer func() {
+		rt.mu.Lock()
+		rt.active[id] = false
+		rt.mu.Unlock()
+	}()
+	// The columns were validated when the run was started
+	parser, _ := enginesModel.NewResultParser(rt.columns)
+	if offset > 0 {
+		// Lines in the middle of the file are read with the header of the file
+		if header, err := readFirstLine(filename); err == nil {
+			if _, err := parser.Parse(header); err != nil {
+				log.Printf("setagaya-agent: Cannot parse the first line of %s: %v", filename, err)
+			}
+		}
+	}
+	// The file is read through the descriptor opened here until it's replaced. Reopening it by its name would read
+	// the file jmeter created in place of a rotated one as the same file
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Printf("setagaya-agent: Cannot tail result file %s: %v", filename, err)
+		return
+	}
+	defer f.Close()
+	opened, err := f.Stat()
+	if err != nil {
+		log.Printf("setagaya-agent: Cannot tail result file %s: %v", filename, err)
+		return
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		log.Printf("setagaya-agent: Cannot tail result file %s: %v", filename, err)
+		return
+	}
+	log.Printf("setagaya-agent: Start tailing result file %s from offset %d", filename, offset)
+	r := bufio.NewReader(f)
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	// The line being written by jmeter, it's read once it's complete
+	var partial string
+	replaced := false
+	for {
+		chunk, err := r.ReadString('\n')
+		if err == nil {
+			line := partial + chunk
+			partial = ""
+			if !rt.readLine(id, parser, line) {
+				return
+			}
+			continue
+		}
+		if err != io.EOF {
+			log.Printf("setagaya-agent: Cannot read result file %s: %v", filename, err)
+			return
+		}
+		partial += chunk
+		if replaced {
+			// What was written before the file was replaced is read. A rotated file is picked up again under its
+			// new name, a truncated one is read again from its start
+			log.Printf("setagaya-agent: Stop tailing result file %s", filename)
+			return
+		}
+		select {
+		case <-rt.stopCh:
+			return
+		case <-ticker.C:
+		}
+		replaced = fileReplaced(f, filename, opened)
+	}
+}
+
+// fileReplaced tells whether the file opened is not the one under its name anymore, or was truncated
+func fileReplaced(f *os.File, filename string, opened os.FileInfo) bool {
+	current, err := os.Stat(filename)
+	if err != nil || !os.SameFile(opened, current) {
+		return true
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	return err != nil || fi.Size() < pos
+}
+
+// readLine sends the samples of the line, it returns false when the tailer is stopped meanwhile
+func (rt *resultTailer) readLine(id string, parser enginesModel.ResultParser, line string) bool {
+	rt.mu.Lock()
+	rt.offsets[id].Offset += int64(len(line))
+	rt.mu.Unlock()
+	records, err := parser.Parse(strings.TrimRight(line, "\n"))
+	if err != nil {
+		log.Printf("setagaya-agent: Cannot parse result line: %v", err)
+		return true
+	}
+	// The results are streamed with the default columns so the consumers do not depend on
+	// the format jmeter is configured with
+	for _, r := range records {
+		if !rt.send(r.String(), rt.stopCh) {
+			return false
+		}
+	}
+	return true
+}
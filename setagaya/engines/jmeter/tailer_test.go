@@ -0,0 +1,217 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+// How long the tailer is given to pick up a change of the result files, it looks for them every second
+const tailerTimeout = 5 * time.Second
+
+type testTailer struct {
+	*resultTailer
+	lines chan string
+	gaps  chan *enginesModel.ResultGap
+
+	mu          sync.Mutex
+	checkpoints map[string]*resultOffset
+}
+
+func newTestTailer(root string, offsets map[string]*resultOffset, since time.Time) *testTailer {
+	tt := &testTailer{
+		lines: make(chan string, 100),
+		gaps:  make(chan *enginesModel.ResultGap, 10),
+	}
+	send := func(line string, stop <-chan struct{}) bool {
+		select {
+		case tt.lines <- line:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	gap := func(g *enginesModel.ResultGap) { tt.gaps <- g }
+	checkpoint := func(offsets map[string]*resultOffset) {
+		tt.mu.Lock()
+		defer tt.mu.Unlock()
+		tt.checkpoints = offsets
+	}
+	tt.resultTailer = newResultTailer(0, nil, send, offsets, since, gap, checkpoint)
+	tt.root = root
+	return tt
+}
+
+// receive returns the labels of the n next samples
+func (tt *testTailer) receive(t *testing.T, n int) []string {
+	labels := []string{}
+	timeout := time.After(tailerTimeout)
+	for len(labels) < n {
+		select {
+		case line := <-tt.lines:
+			labels = append(labels, sampleLabel(line))
+		case <-timeout:
+			t.Fatalf("received %v, expected %d samples", labels, n)
+		}
+	}
+	return labels
+}
+
+// sampleLabel finds the label of the sample among its columns, the tests label them sample-N
+func sampleLabel(line string) string {
+	for _, column := range strings.Split(line, enginesModel.JTLSeparator) {
+		if strings.HasPrefix(column, "sample-") {
+			return column
+		}
+	}
+	return line
+}
+
+func (tt *testTailer) offsets() map[string]*resultOffset {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	return tt.checkpoints
+}
+
+func writeResultFile(t *testing.T, filename string, labels ...string) {
+	lines := []string{"label,Latency,responseCode,success"}
+	for _, l := range labels {
+		lines = append(lines, l+",120,200,true")
+	}
+	if !assert.NoError(t, os.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0600)) {
+		t.FailNow()
+	}
+}
+
+func TestResultTailerRotation(t *testing.T) {
+	root := t.TempDir()
+	current := filepath.Join(root, "kpi-0.jtl")
+	writeResultFile(t, current, "sample-1", "sample-2")
+	tt := newTestTailer(root, nil, time.Now())
+	tt.start()
+	assert.Equal(t, []string{"sample-1", "sample-2"}, tt.receive(t, 2))
+
+	// Jmeter renames the file and starts a new one. The renamed file is not read again
+	rotated := current + ".1"
+	assert.NoError(t, os.Rename(current, rotated))
+	writeResultFile(t, current, "sample-3")
+	assert.Equal(t, []string{"sample-3"}, tt.receive(t, 1))
+	select {
+	case line := <-tt.lines:
+		t.Fatalf("unexpected sample %s", line)
+	case <-time.After(2 * tailCheckpointInterval):
+	}
+	tt.stop()
+	assert.Empty(t, tt.gaps)
+
+	// The rotated file keeps its offset under its new name
+	fi, err := os.Stat(rotated)
+	assert.NoError(t, err)
+	o := tt.offsets()[fileID(rotated, fi)]
+	if assert.NotNil(t, o) {
+		assert.Equal(t, rotated, o.Path)
+		assert.Equal(t, fi.Size(), o.Offset)
+	}
+	assert.Len(t, tt.offsets(), 2)
+}
+
+func TestResultTailerTruncated(t *testing.T) {
+	root := t.TempDir()
+	filename := filepath.Join(root, "kpi-0.jtl")
+	writeResultFile(t, filename, "sample-1")
+	fi, err := os.Stat(filename)
+	assert.NoError(t, err)
+	// The restarted agent had read further than what the file holds now
+	since := time.Now().Add(-time.Minute)
+	offsets := map[string]*resultOffset{fileID(filename, fi): {Path: filename, Offset: fi.Size() + 100}}
+	tt := newTestTailer(root, offsets, since)
+	tt.start()
+	defer tt.stop()
+
+	// The file is read again from its start, and what was lost is reported
+	assert.Equal(t, []string{"sample-1"}, tt.receive(t, 1))
+	select {
+	case g := <-tt.gaps:
+		assert.Equal(t, "kpi-0.jtl", g.File)
+		assert.Equal(t, enginesModel.GapReasonTruncated, g.Reason)
+		assert.Equal(t, since, g.Start)
+	case <-time.After(tailerTimeout):
+		t.Fatal("the truncation was not reported")
+	}
+}
+
+func TestResultTailerTruncatedInPlace(t *testing.T) {
+	root := t.TempDir()
+	filename := filepath.Join(root, "kpi-0.jtl")
+	writeResultFile(t, filename, "sample-1", "sample-2")
+	tt := newTestTailer(root, nil, time.Now())
+	tt.start()
+	defer tt.stop()
+	assert.Equal(t, []string{"sample-1", "sample-2"}, tt.receive(t, 2))
+
+	// The same file is written again from its start
+	writeResultFile(t, filename, "sample-3")
+	assert.Equal(t, []string{"sample-3"}, tt.receive(t, 1))
+	select {
+	case g := <-tt.gaps:
+		assert.Equal(t, enginesModel.GapReasonTruncated, g.Reason)
+	case <-time.After(tailerTimeout):
+		t.Fatal("the truncation was not reported")
+	}
+}
+
+func TestResultTailerPartialLine(t *testing.T) {
+	root := t.TempDir()
+	filename := filepath.Join(root, "kpi-0.jtl")
+	writeResultFile(t, filename, "sample-1")
+	tt := newTestTailer(root, nil, time.Now())
+	tt.start()
+	defer tt.stop()
+	assert.Equal(t, []string{"sample-1"}, tt.receive(t, 1))
+
+	// A line is only read once jmeter wrote all of it
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer f.Close()
+	_, err = f.WriteString("sample-2,12")
+	assert.NoError(t, err)
+	time.Sleep(2 * tailPollInterval)
+	_, err = f.WriteString("0,200,true\n")
+	assert.NoError(t, err)
+	select {
+	case line := <-tt.lines:
+		assert.Equal(t, "sample-2", sampleLabel(line))
+		assert.Contains(t, strings.Split(line, enginesModel.JTLSeparator), "120")
+	case <-time.After(tailerTimeout):
+		t.Fatal("the line was not read")
+	}
+}
+
+func TestResultTailerResume(t *testing.T) {
+	root := t.TempDir()
+	filename := filepath.Join(root, "kpi-0.jtl")
+	writeResultFile(t, filename, "sample-1", "sample-2")
+	fi, err := os.Stat(filename)
+	assert.NoError(t, err)
+	header := int64(len("label,Latency,responseCode,success\n"))
+	sample := int64(len("sample-1,120,200,true\n"))
+	offsets := map[string]*resultOffset{fileID(filename, fi): {Path: filename, Offset: header + sample}}
+	tt := newTestTailer(root, offsets, time.Now())
+	tt.start()
+	defer tt.stop()
+
+	// The samples already streamed are skipped, the ones after them are parsed with the header of the file
+	assert.Equal(t, []string{"sample-2"}, tt.receive(t, 1))
+	assert.Empty(t, tt.gaps)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	etree "github.com/beevik/etree"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+const (
+	// JMeter property read by the injected Constant Throughput Timer. The value is in samples per minute
+	THROUGHPUT_PROPERTY = "setagaya.throughput"
+	// Changes smaller than this ratio are not pushed to JMeter
+	throughputTolerance        = 0.01
+	throughputFeedbackInterval = 10 * time.Second
+)
+
+// throughputController holds the requested throughput of the engine by adjusting the pacing of JMeter
+// while the test is running. The pacing is pushed with the runtime properties, which the threads of JMeter reload
+// from a file, so nothing listens on the network for it. It never goes above the cap of the engine, an engine with
+// a cap but no target is paced at its cap.
+type throughputController struct {
+	target  float64
+	max     float64
+	current float64
+	samples int64
+	// Writes the properties the threads reload
+	push func(map[string]string) error
+	// Closed when the run is stopped, so the controller never paces the next run
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func newThroughputController(target, max float64, push func(map[string]string) error) *throughputController {
+	return &throughputController{
+		target:  target,
+		max:     max,
+		current: enginesModel.CapThroughput(target, max),
+		push:    push,
+		stopCh:  make(chan struct{}),
+	}
+}
+
+func (tc *throughputController) observe() {
+	atomic.AddInt64(&tc.samples, 1)
+}
+
+func rpsToRpm(rps float64) string {
+	return strconv.FormatFloat(rps*60, 'f', 2, 64)
+}
+
+// jmeterArgs is the pacing JMeter starts with, the runtime properties change it afterwards
+func (tc *throughputController) jmeterArgs() []string {
+	return []string{fmt.Sprintf("-J%s=%s", THROUGHPUT_PROPERTY, rpsToRpm(tc.current))}
+}
+
+func (tc *throughputController) apply(rps float64) error {
+	return tc.push(map[string]string{THROUGHPUT_PROPERTY: rpsToRpm(rps)})
+}
+
+// stop ends the feedback loop of the run
+func (tc *throughputController) stop() {
+	tc.stopOnce.Do(func() { close(tc.stopCh) })
+}
+
+// run is the feedback loop. It measures the achieved throughput over every interval and corrects the pacing
+// so slow responses are compensated, up to the cap. It stops with the run, or when the JMeter process is finished.
+func (tc *throughputController) run(interval time.Duration, running func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tc.stopCh:
+			return
+		case <-ticker.C:
+		}
+		if !running() {
+			return
+		}
+		samples := atomic.SwapInt64(&tc.samples, 0)
+		achieved := float64(samples) / interval.Seconds()
+		next := enginesModel.CapThroughput(enginesModel.NextThroughput(tc.target, tc.current, achieved), tc.max)
+		if tc.current > 0 && abs(next-tc.current)/tc.current < throughputTolerance {
+			continue
+		}
+		// The run can be stopped while the samples were counted
+		if isClosed(tc.stopCh) {
+			return
+		}
+		if err := tc.apply(next); err != nil {
+			log.Printf("setagaya-agent: Failed to adjust throughput: %v", err)
+			continue
+		}
+		log.Printf("setagaya-agent: Achieved %.2f rps against target %.2f rps, pacing adjusted from %.2f to %.2f rps",
+			achieved, tc.target, tc.current, next)
+		tc.current = next
+	}
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// addThroughputTimer injects a Constant Throughput Timer on the test plan level so it paces all the samplers
+// of the plan. The throughput is read from a JMeter property so it can be changed while the test is running.
+func addThroughputTimer(planDoc *etree.Document) error {
+	jtp := planDoc.SelectElement("jmeterTestPlan")
+	if jtp == nil {
+		return errors.New("missing Jmeter Test plan in jmx")
+	}
+	ht := jtp.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside Jmeter test plan in jmx")
+	}
+	ht = ht.SelectElement("hashTree")
+	if ht == nil {
+		return errors.New("missing hash tree inside hash tree in jmx")
+	}
+	timer := etree.NewElement("ConstantThroughputTimer")
+	timer.CreateAttr("guiclass", "TestBeanGUI")
+	timer.CreateAttr("testclass", "ConstantThroughputTimer")
+	timer.CreateAttr("testname", "Setagaya Throughput Control")
+	timer.CreateAttr("enabled", "true")
+	// 3 means all active threads (shared), so the timer paces the whole engine instead of each thread
+	calcMode := timer.CreateElement("intProp")
+	calcMode.CreateAttr("name", "calcMode")
+	calcMode.SetText("3")
+	throughput := timer.CreateElement("stringProp")
+	throughput.CreateAttr("name", "throughput")
+	throughput.SetText(fmt.Sprintf("${__P(%s)}", THROUGHPUT_PROPERTY))
+	ht.InsertChildAt(0, timer)
+	ht.InsertChildAt(1, etree.NewElement("hashTree"))
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughputControllerRun(t *testing.T) {
+	var mu sync.Mutex
+	pushed := []string{}
+	tc := newThroughputController(10, 20, func(properties map[string]string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		pushed = append(pushed, properties[THROUGHPUT_PROPERTY])
+		return nil
+	})
+	assert.Equal(t, []string{"-J" + THROUGHPUT_PROPERTY + "=600.00"}, tc.jmeterArgs())
+
+	done := make(chan struct{})
+	go func() {
+		tc.run(10*time.Millisecond, func() bool { return true })
+		close(done)
+	}()
+	// The engine achieves more than its target, the pacing is lowered
+	for i := 0; i < 5; i++ {
+		tc.observe()
+		time.Sleep(10 * time.Millisecond)
+	}
+	tc.stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the feedback loop goes on after the run is stopped")
+	}
+	mu.Lock()
+	count := len(pushed)
+	assert.NotEmpty(t, pushed)
+	for _, rpm := range pushed {
+		v, err := strconv.ParseFloat(rpm, 64)
+		assert.NoError(t, err)
+		assert.Less(t, v, 600.0)
+	}
+	mu.Unlock()
+
+	// Nothing is pushed once stopped, and stopping twice is harmless
+	tc.stop()
+	time.Sleep(30 * time.Millisecond)
+	mu.Lock()
+	assert.Len(t, pushed, count)
+	mu.Unlock()
+}
+
+func TestThroughputControllerEndsWithJmeter(t *testing.T) {
+	tc := newThroughputController(10, 0, func(map[string]string) error { return nil })
+	done := make(chan struct{})
+	go func() {
+		tc.run(10*time.Millisecond, func() bool { return false })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the feedback loop goes on after jmeter is finished")
+	}
+}
@@ -0,0 +1,199 @@
+package jvmstats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The JVMs on linux publish their perf data in /tmp whatever the java.io.tmpdir is
+	perfDataRoot = "/tmp"
+	procRoot     = "/proc"
+	// The JVM is started by the jmeter script, a few processes below the one the agent started at most
+	maxProcessDepth = 4
+)
+
+var ErrNoJVM = errors.New("no perf data of the jvm")
+
+// Collector is the collections of a garbage collector of the JVM. LastPause is how long its last collection took,
+// the whole of it is a pause for the stop the world collectors.
+type Collector struct {
+	Name        string
+	Invocations int64
+	Time        time.Duration
+	LastPause   time.Duration
+}
+
+// Stats is the heap, the collections and the threads of a JVM. The heap is in bytes, the metaspace left out.
+type Stats struct {
+	HeapUsed      int64
+	HeapCommitted int64
+	HeapMax       int64
+	Collectors    []*Collector
+	LiveThreads   int64
+	DaemonThreads int64
+}
+
+// ticks converts the ticks of the high resolution timer of the JVM to a duration
+func ticks(t, frequency int64) time.Duration {
+	if frequency <= 0 {
+		return 0
+	}
+	return time.Duration(float64(t) / float64(frequency) * float64(time.Second))
+}
+
+// NewStats picks the counters of the heap, the collectors and the threads out of the perf data, like
+// sun.gc.generation.0.space.0.used or sun.gc.collector.0.time
+func NewStats(pd *PerfData) *Stats {
+	s := &Stats{
+		LiveThreads:   pd.Longs["java.threads.live"],
+		DaemonThreads: pd.Longs["java.threads.daemon"],
+	}
+	frequency := pd.Longs["sun.os.hrt.frequency"]
+	collectors := map[string]*Collector{}
+	for name, v := range pd.Longs {
+		parts := strings.Split(name, ".")
+		if len(parts) < 5 || parts[0] != "sun" || parts[1] != "gc" {
+			continue
+		}
+		switch {
+		case parts[2] == "generation" && len(parts) == 5 && parts[4] == "capacity":
+			s.HeapCommitted += v
+		case parts[2] == "generation" && len(parts) == 5 && parts[4] == "maxCapacity":
+			s.HeapMax += v
+		case parts[2] == "generation" && len(parts) == 7 && parts[4] == "space" && parts[6] == "used":
+			s.HeapUsed += v
+		case parts[2] == "collector" && len(parts) == 5:
+			if _, ok := collectors[parts[3]]; !ok {
+				collectors[parts[3]] = &Collector{}
+			}
+		}
+	}
+	ids := make([]string, 0, len(collectors))
+	for id := range collectors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		prefix := "sun.gc.collector." + id + "."
+		c := &Collector{
+			Name:        pd.Strings[prefix+"name"],
+			Invocations: pd.Longs[prefix+"invocations"],
+			Time:        ticks(pd.Longs[prefix+"time"], frequency),
+		}
+		if c.Name == "" {
+			c.Name = "collector " + id
+		}
+		// The exit is before the entry while a collection is in progress
+		if entry, exit := pd.Longs[prefix+"lastEntryTime"], pd.Longs[prefix+"lastExitTime"]; exit >= entry {
+			c.LastPause = ticks(exit-entry, frequency)
+		}
+		s.Collectors = append(s.Collectors, c)
+	}
+	return s
+}
+
+// GCTime is the share of the interval every collector spent collecting since the previous stats, by its name. The
+// collectors are compared by name as a new JVM may have started in between.
+func (s *Stats) GCTime(prev *Stats, interval time.Duration) map[string]float64 {
+	r := map[string]float64{}
+	if interval <= 0 {
+		return r
+	}
+	previous := map[string]*Collector{}
+	for _, c := range prev.Collectors {
+		previous[c.Name] = c
+	}
+	for _, c := range s.Collectors {
+		p, ok := previous[c.Name]
+		if !ok || c.Time < p.Time {
+			r[c.Name] = 0
+			continue
+		}
+		r[c.Name] = (c.Time - p.Time).Seconds() / interval.Seconds()
+	}
+	return r
+}
+
+// parsePPid reads the parent of the process out of its /proc/<pid>/stat. The name of the command is between
+// parentheses and may contain spaces, so the fields are counted after the last parenthesis.
+func parsePPid(stat string) (int, error) {
+	i := strings.LastIndex(stat, ")")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid process stat %q", stat)
+	}
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("invalid process stat %q", stat)
+	}
+	return strconv.Atoi(fields[1])
+}
+
+func readPPid(pid int) (int, error) {
+	// #nosec G304 -- The path is made of the proc root and a pid
+	content, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	return parsePPid(string(content))
+}
+
+// descendantOf tells whether the process is the ancestor or one of the processes below it. The other JVMs of the
+// engine, like the one stopping the test, are not started by the ancestor.
+func descendantOf(pid, ancestor int, ppid func(int) (int, error)) bool {
+	for depth := 0; depth <= maxProcessDepth && pid > 1; depth++ {
+		if pid == ancestor {
+			return true
+		}
+		parent, err := ppid(pid)
+		if err != nil {
+			return false
+		}
+		pid = parent
+	}
+	return false
+}
+
+// findPerfData is the perf data file of the JVM started by the process. The files are named after the pid of the
+// JVM, in a directory of the user running it.
+func findPerfData(root string, ancestor int, ppid func(int) (int, error)) (string, error) {
+	files, err := filepath.Glob(filepath.Join(root, "hsperfdata_*", "*"))
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		pid, err := strconv.Atoi(filepath.Base(f))
+		if err != nil {
+			continue
+		}
+		if descendantOf(pid, ancestor, ppid) {
+			return f, nil
+		}
+	}
+	return "", ErrNoJVM
+}
+
+// Read returns the stats of the JVM started by the process, the process being the JVM or the script starting it.
+// The perf data is published by the JVMs unless they run with -XX:-UsePerfData.
+func Read(pid int) (*Stats, error) {
+	f, err := findPerfData(perfDataRoot, pid, readPPid)
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G304 -- The file is one of the perf data files of /tmp
+	buf, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	pd, err := ParsePerfData(buf)
+	if err != nil {
+		return nil, err
+	}
+	return NewStats(pd), nil
+}
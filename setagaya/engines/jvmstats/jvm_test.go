@@ -0,0 +1,113 @@
+package jvmstats
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStats(t *testing.T) {
+	pd := &PerfData{
+		Longs: map[string]int64{
+			"sun.os.hrt.frequency":                     1000000000,
+			"java.threads.live":                        120,
+			"java.threads.daemon":                      20,
+			"sun.gc.generation.0.capacity":             100,
+			"sun.gc.generation.0.maxCapacity":          400,
+			"sun.gc.generation.0.space.0.used":         30,
+			"sun.gc.generation.0.space.1.used":         5,
+			"sun.gc.generation.0.space.1.capacity":     10,
+			"sun.gc.generation.1.capacity":             200,
+			"sun.gc.generation.1.maxCapacity":          600,
+			"sun.gc.generation.1.space.0.used":         150,
+			"sun.gc.metaspace.used":                    1000,
+			"sun.gc.collector.0.invocations":           12,
+			"sun.gc.collector.0.time":                  300000000,
+			"sun.gc.collector.0.lastEntryTime":         5000000000,
+			"sun.gc.collector.0.lastExitTime":          5025000000,
+			"sun.gc.collector.1.invocations":           1,
+			"sun.gc.collector.1.time":                  2000000000,
+			"sun.gc.collector.1.lastEntryTime":         9000000000,
+			"sun.gc.collector.1.lastExitTime":          7000000000,
+			"sun.gc.generation.0.space.0.initCapacity": 10,
+			"sun.gc.generation.0.spaces":               2,
+		},
+		Strings: map[string]string{
+			"sun.gc.collector.0.name": "G1 young collection pauses",
+		},
+	}
+	s := NewStats(pd)
+	assert.Equal(t, int64(185), s.HeapUsed)
+	assert.Equal(t, int64(300), s.HeapCommitted)
+	assert.Equal(t, int64(1000), s.HeapMax)
+	assert.Equal(t, int64(120), s.LiveThreads)
+	assert.Equal(t, int64(20), s.DaemonThreads)
+	assert.Len(t, s.Collectors, 2)
+	young := s.Collectors[0]
+	assert.Equal(t, "G1 young collection pauses", young.Name)
+	assert.Equal(t, int64(12), young.Invocations)
+	assert.Equal(t, 300*time.Millisecond, young.Time)
+	assert.Equal(t, 25*time.Millisecond, young.LastPause)
+	// The collection in progress has no pause yet, and the collector without a name is named after its number
+	assert.Equal(t, "collector 1", s.Collectors[1].Name)
+	assert.Equal(t, time.Duration(0), s.Collectors[1].LastPause)
+}
+
+func TestGCTime(t *testing.T) {
+	prev := &Stats{Collectors: []*Collector{{Name: "young", Time: time.Second}, {Name: "old", Time: 3 * time.Second}}}
+	s := &Stats{Collectors: []*Collector{
+		{Name: "young", Time: 1500 * time.Millisecond},
+		{Name: "old", Time: time.Second},
+		{Name: "full", Time: time.Second},
+	}}
+	gc := s.GCTime(prev, 5*time.Second)
+	assert.InDelta(t, 0.1, gc["young"], 0.0001)
+	// A new JVM started over
+	assert.Equal(t, 0.0, gc["old"])
+	assert.Equal(t, 0.0, gc["full"])
+	assert.Empty(t, s.GCTime(prev, 0))
+}
+
+func TestParsePPid(t *testing.T) {
+	ppid, err := parsePPid("1234 (java) S 1200 1234 1 0 -1 4194560")
+	assert.NoError(t, err)
+	assert.Equal(t, 1200, ppid)
+
+	ppid, err = parsePPid("1234 (my (odd) cmd) R 77 1234 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 77, ppid)
+
+	_, err = parsePPid("1234 java")
+	assert.Error(t, err)
+}
+
+func TestFindPerfData(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "hsperfdata_setagaya")
+	assert.NoError(t, os.MkdirAll(dir, 0750))
+	for _, name := range []string{"300", "310", "notapid"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{}, 0600))
+	}
+	// 100 is the agent, 200 the jmeter script it started, 300 the jvm of jmeter and 310 the jvm stopping the test
+	parents := map[int]int{300: 200, 200: 100, 100: 1, 310: 1}
+	ppid := func(pid int) (int, error) {
+		if p, ok := parents[pid]; ok {
+			return p, nil
+		}
+		return 0, errors.New("no such process")
+	}
+	f, err := findPerfData(root, 200, ppid)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "300"), f)
+
+	f, err = findPerfData(root, 300, ppid)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "300"), f)
+
+	_, err = findPerfData(root, 400, ppid)
+	assert.ErrorIs(t, err, ErrNoJVM)
+}
@@ -0,0 +1,95 @@
+package jvmstats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The layout of the perf data the HotSpot JVMs publish in /tmp/hsperfdata_<user>/<pid>, it's the file jstat reads.
+// The buffer starts with a prologue and is followed by the entries, every entry has a name and a value.
+const (
+	perfDataMagic       = 0xcafec0c0
+	perfDataBigEndian   = 0
+	prologueSize        = 32
+	prologueByteOrder   = 4
+	prologueAccessible  = 7
+	prologueEntryOffset = 24
+	prologueNumEntries  = 28
+	entryHeaderSize     = 20
+	entryNameOffset     = 4
+	entryVectorLength   = 8
+	entryDataType       = 12
+	entryDataOffset     = 16
+	dataTypeLong        = 'J'
+	dataTypeByte        = 'B'
+	maxPerfDataEntries  = 1 << 16
+)
+
+var ErrPerfDataNotAccessible = errors.New("the perf data of the jvm is not accessible yet")
+
+// PerfData is the counters of a JVM, the strings like the names of the collectors are apart from the numbers
+type PerfData struct {
+	Longs   map[string]int64
+	Strings map[string]string
+}
+
+// cString is the bytes up to the first NUL
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// ParsePerfData reads the entries of the perf data buffer of a JVM. The magic is always big endian, the rest of the
+// buffer is in the byte order of the machine the JVM runs on. Only the longs and the strings are kept.
+func ParsePerfData(buf []byte) (*PerfData, error) {
+	if len(buf) < prologueSize {
+		return nil, fmt.Errorf("the perf data is too short: %d bytes", len(buf))
+	}
+	if magic := binary.BigEndian.Uint32(buf); magic != perfDataMagic {
+		return nil, fmt.Errorf("invalid perf data magic %#x", magic)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if buf[prologueByteOrder] == perfDataBigEndian {
+		order = binary.BigEndian
+	}
+	if buf[prologueAccessible] == 0 {
+		return nil, ErrPerfDataNotAccessible
+	}
+	offset := int(int32(order.Uint32(buf[prologueEntryOffset:])))
+	numEntries := int(int32(order.Uint32(buf[prologueNumEntries:])))
+	if numEntries < 0 || numEntries > maxPerfDataEntries {
+		return nil, fmt.Errorf("invalid number of perf data entries %d", numEntries)
+	}
+	pd := &PerfData{Longs: map[string]int64{}, Strings: map[string]string{}}
+	for i := 0; i < numEntries; i++ {
+		if offset < prologueSize || offset+entryHeaderSize > len(buf) {
+			return nil, fmt.Errorf("perf data entry %d is out of the buffer", i)
+		}
+		entry := buf[offset:]
+		length := int(int32(order.Uint32(entry)))
+		if length < entryHeaderSize || length > len(entry) {
+			return nil, fmt.Errorf("invalid length %d of perf data entry %d", length, i)
+		}
+		entry = entry[:length]
+		nameOffset := int(int32(order.Uint32(entry[entryNameOffset:])))
+		vectorLength := int(int32(order.Uint32(entry[entryVectorLength:])))
+		dataOffset := int(int32(order.Uint32(entry[entryDataOffset:])))
+		if nameOffset < entryHeaderSize || nameOffset >= length || dataOffset < entryHeaderSize || dataOffset > length {
+			return nil, fmt.Errorf("invalid offsets of perf data entry %d", i)
+		}
+		name := cString(entry[nameOffset:])
+		data := entry[dataOffset:]
+		switch {
+		case entry[entryDataType] == dataTypeLong && vectorLength == 0 && len(data) >= 8:
+			pd.Longs[name] = int64(order.Uint64(data))
+		case entry[entryDataType] == dataTypeByte && vectorLength > 0:
+			pd.Strings[name] = cString(data[:min(vectorLength, len(data))])
+		}
+		offset += length
+	}
+	return pd, nil
+}
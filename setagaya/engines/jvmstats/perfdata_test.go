@@ -0,0 +1,85 @@
+package jvmstats
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type perfEntry struct {
+	name string
+	long int64
+	str  string
+}
+
+// makePerfData lays out the entries the way the JVM does, the names and the values follow the header of every entry
+func makePerfData(order binary.ByteOrder, entries []perfEntry) []byte {
+	buf := make([]byte, prologueSize)
+	binary.BigEndian.PutUint32(buf, perfDataMagic)
+	buf[prologueByteOrder] = 1
+	if order == binary.BigEndian {
+		buf[prologueByteOrder] = perfDataBigEndian
+	}
+	buf[prologueAccessible] = 1
+	order.PutUint32(buf[prologueEntryOffset:], prologueSize)
+	order.PutUint32(buf[prologueNumEntries:], uint32(len(entries)))
+	for _, e := range entries {
+		name := append([]byte(e.name), 0)
+		var data []byte
+		dataType, vectorLength := byte(dataTypeLong), 0
+		if e.str != "" {
+			data = append([]byte(e.str), 0)
+			dataType, vectorLength = dataTypeByte, len(data)
+		} else {
+			data = make([]byte, 8)
+			order.PutUint64(data, uint64(e.long))
+		}
+		header := make([]byte, entryHeaderSize)
+		order.PutUint32(header, uint32(entryHeaderSize+len(name)+len(data)))
+		order.PutUint32(header[entryNameOffset:], entryHeaderSize)
+		order.PutUint32(header[entryVectorLength:], uint32(vectorLength))
+		header[entryDataType] = dataType
+		order.PutUint32(header[entryDataOffset:], uint32(entryHeaderSize+len(name)))
+		buf = append(buf, header...)
+		buf = append(buf, name...)
+		buf = append(buf, data...)
+	}
+	return buf
+}
+
+func TestParsePerfData(t *testing.T) {
+	entries := []perfEntry{
+		{name: "java.threads.live", long: 42},
+		{name: "sun.gc.collector.0.name", str: "G1 young collection pauses"},
+		{name: "sun.gc.generation.0.capacity", long: -1},
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		pd, err := ParsePerfData(makePerfData(order, entries))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), pd.Longs["java.threads.live"])
+		assert.Equal(t, int64(-1), pd.Longs["sun.gc.generation.0.capacity"])
+		assert.Equal(t, "G1 young collection pauses", pd.Strings["sun.gc.collector.0.name"])
+	}
+}
+
+func TestParsePerfDataInvalid(t *testing.T) {
+	buf := makePerfData(binary.LittleEndian, []perfEntry{{name: "java.threads.live", long: 42}})
+
+	_, err := ParsePerfData(buf[:16])
+	assert.Error(t, err)
+
+	wrongMagic := append([]byte{}, buf...)
+	wrongMagic[0] = 0
+	_, err = ParsePerfData(wrongMagic)
+	assert.Error(t, err)
+
+	notAccessible := append([]byte{}, buf...)
+	notAccessible[prologueAccessible] = 0
+	_, err = ParsePerfData(notAccessible)
+	assert.ErrorIs(t, err, ErrPerfDataNotAccessible)
+
+	// An entry longer than the buffer
+	_, err = ParsePerfData(buf[:len(buf)-4])
+	assert.Error(t, err)
+}
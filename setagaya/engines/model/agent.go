@@ -0,0 +1,35 @@
+package model
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// WriteJSON writes the stats of the current run the controller collects from the agents
+func WriteJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing %T response: %v", v, err)
+	}
+}
+
+// CleanFolder only removes the content of the folder. The test data folder is a volume mounted by the scheduler when
+// the root filesystem of the engine is read-only, and a mount point cannot be removed.
+func CleanFolder(folder string) error {
+	if err := os.MkdirAll(folder, 0750); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(folder, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
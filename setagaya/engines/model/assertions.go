@@ -0,0 +1,43 @@
+package model
+
+import (
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// AssertionStats counts the assertion results of the samples by label. Like the error stats, stats from
+// different engines can be merged into the stats of the whole run.
+type AssertionStats struct {
+	Labels map[string]*model.LabelAssertions `json:"labels"`
+}
+
+func NewAssertionStats() *AssertionStats {
+	return &AssertionStats{Labels: map[string]*model.LabelAssertions{}}
+}
+
+func (as *AssertionStats) get(label string) *model.LabelAssertions {
+	la, ok := as.Labels[label]
+	if !ok {
+		la = new(model.LabelAssertions)
+		as.Labels[label] = la
+	}
+	return la
+}
+
+// Observe counts a sample. failureMessage is the failure message column of the JTL, it's empty when
+// all the assertions of the sample passed.
+func (as *AssertionStats) Observe(label, failureMessage string) {
+	la := as.get(label)
+	la.Samples++
+	if failureMessage == "" {
+		la.Passed++
+		return
+	}
+	la.Failed++
+	la.AddFailures(failureMessage, 1)
+}
+
+func (as *AssertionStats) Merge(other *AssertionStats) {
+	for label, la := range other.Labels {
+		as.get(label).Merge(la)
+	}
+}
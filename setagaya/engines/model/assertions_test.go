@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssertionStatsObserve(t *testing.T) {
+	as := NewAssertionStats()
+	as.Observe("login", "")
+	as.Observe("login", "Test failed: text expected to contain /welcome/")
+	as.Observe("login", "Test failed: text expected to contain /welcome/")
+	as.Observe("search", "")
+
+	login := as.Labels["login"]
+	assert.Equal(t, uint64(3), login.Samples)
+	assert.Equal(t, uint64(1), login.Passed)
+	assert.Equal(t, uint64(2), login.Failed)
+	assert.Equal(t, uint64(2), login.Failures["Test failed: text expected to contain /welcome/"])
+
+	search := as.Labels["search"]
+	assert.Equal(t, uint64(1), search.Passed)
+	assert.Empty(t, search.Failures)
+}
+
+func TestAssertionStatsMerge(t *testing.T) {
+	a := NewAssertionStats()
+	a.Observe("login", "")
+	a.Observe("login", "Response code was 500")
+	b := NewAssertionStats()
+	b.Observe("login", "Response code was 500")
+	b.Observe("search", "")
+
+	a.Merge(b)
+	assert.Equal(t, uint64(3), a.Labels["login"].Samples)
+	assert.Equal(t, uint64(2), a.Labels["login"].Failed)
+	assert.Equal(t, uint64(2), a.Labels["login"].Failures["Response code was 500"])
+	assert.Equal(t, uint64(1), a.Labels["search"].Samples)
+}
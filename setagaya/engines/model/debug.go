@@ -0,0 +1,66 @@
+package model
+
+import (
+	"encoding/xml"
+)
+
+// DebugRequest asks a debug engine to execute the named samplers once, with a single thread.
+// Samplers run in the order of the test plan so extractors of earlier samplers can feed the later ones.
+type DebugRequest struct {
+	EngineDataConfig *EngineDataConfig `json:"engine_data_config"`
+	Samplers         []string          `json:"samplers"`
+}
+
+type DebugAssertion struct {
+	Name           string `json:"name" xml:"name"`
+	Failure        bool   `json:"failure" xml:"failure"`
+	Error          bool   `json:"error" xml:"error"`
+	FailureMessage string `json:"failure_message" xml:"failureMessage"`
+}
+
+// DebugSample is the full request and response of one sampler execution
+type DebugSample struct {
+	Label           string            `json:"label" xml:"lb,attr"`
+	Success         bool              `json:"success" xml:"s,attr"`
+	ResponseCode    string            `json:"response_code" xml:"rc,attr"`
+	ResponseMessage string            `json:"response_message" xml:"rm,attr"`
+	Elapsed         int64             `json:"elapsed" xml:"t,attr"`
+	Latency         int64             `json:"latency" xml:"lt,attr"`
+	Timestamp       int64             `json:"timestamp" xml:"ts,attr"`
+	URL             string            `json:"url" xml:"java.net.URL"`
+	Method          string            `json:"method" xml:"method"`
+	RequestHeaders  string            `json:"request_headers" xml:"requestHeader"`
+	RequestBody     string            `json:"request_body" xml:"queryString"`
+	SamplerData     string            `json:"sampler_data" xml:"samplerData"`
+	ResponseHeaders string            `json:"response_headers" xml:"responseHeader"`
+	ResponseBody    string            `json:"response_body" xml:"responseData"`
+	Assertions      []*DebugAssertion `json:"assertions" xml:"assertionResult"`
+	// True when the response body was cut to the size limit of the debug engine
+	Truncated bool `json:"truncated" xml:"-"`
+}
+
+type DebugResult struct {
+	Samples []*DebugSample `json:"samples"`
+	// Tail of the jmeter output, useful when the plan fails to start
+	Output string `json:"output"`
+}
+
+type debugResults struct {
+	Samples []*DebugSample `xml:",any"`
+}
+
+// ParseDebugResults reads the samples out of an XML JTL file. Sub results, like redirects, are not included.
+// Response bodies larger than maxBody bytes are truncated.
+func ParseDebugResults(data []byte, maxBody int) ([]*DebugSample, error) {
+	r := new(debugResults)
+	if err := xml.Unmarshal(data, r); err != nil {
+		return nil, err
+	}
+	for _, s := range r.Samples {
+		if len(s.ResponseBody) > maxBody {
+			s.ResponseBody = s.ResponseBody[:maxBody]
+			s.Truncated = true
+		}
+	}
+	return r.Samples, nil
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const debugJTL = `<?xml version="1.0" encoding="UTF-8"?>
+<testResults version="1.2">
+<httpSample t="120" lt="100" ts="1700000000000" s="true" lb="Login" rc="200" rm="OK">
+  <requestHeader class="java.lang.String">Content-Type: application/json</requestHeader>
+  <responseHeader class="java.lang.String">HTTP/1.1 200 OK</responseHeader>
+  <responseData class="java.lang.String">{"token":"abcdef"}</responseData>
+  <method class="java.lang.String">POST</method>
+  <queryString class="java.lang.String">{"user":"setagaya"}</queryString>
+  <java.net.URL>https://example.com/login</java.net.URL>
+</httpSample>
+<sample t="5" lt="0" ts="1700000000120" s="false" lb="Check token" rc="500" rm="Internal Server Error">
+  <assertionResult>
+    <name>Token assertion</name>
+    <failure>true</failure>
+    <error>false</error>
+    <failureMessage>token is empty</failureMessage>
+  </assertionResult>
+</sample>
+</testResults>`
+
+func TestParseDebugResults(t *testing.T) {
+	samples, err := ParseDebugResults([]byte(debugJTL), 10)
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2)
+
+	login := samples[0]
+	assert.Equal(t, "Login", login.Label)
+	assert.True(t, login.Success)
+	assert.Equal(t, "200", login.ResponseCode)
+	assert.Equal(t, int64(120), login.Elapsed)
+	assert.Equal(t, "POST", login.Method)
+	assert.Equal(t, "https://example.com/login", login.URL)
+	assert.Equal(t, `{"user":"setagaya"}`, login.RequestBody)
+	assert.Equal(t, `{"token":"`, login.ResponseBody)
+	assert.True(t, login.Truncated)
+
+	check := samples[1]
+	assert.False(t, check.Success)
+	assert.False(t, check.Truncated)
+	assert.Len(t, check.Assertions, 1)
+	assert.True(t, check.Assertions[0].Failure)
+	assert.Equal(t, "token is empty", check.Assertions[0].FailureMessage)
+}
+
+func TestParseDebugResultsInvalid(t *testing.T) {
+	_, err := ParseDebugResults([]byte("<testResults>"), 10)
+	assert.Error(t, err)
+}
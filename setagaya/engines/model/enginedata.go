@@ -1,12 +1,141 @@
 package model
 
-import "github.com/hveda/Setagaya/setagaya/model"
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+// JMXChecksumHeader is the header of the response to /start with the sha256 of the test plan the engine modified
+const JMXChecksumHeader = "X-Setagaya-Jmx-Sha256"
+
+// StrippedListenersHeader is the header of the response to /start with the names of the listeners of the test plan
+// the engine disabled, as a json array
+const StrippedListenersHeader = "X-Setagaya-Stripped-Listeners"
+
+func SetStrippedListeners(h http.Header, listeners []string) {
+	if len(listeners) == 0 {
+		return
+	}
+	// The names are escaped by the encoding, they cannot break the header
+	if b, err := json.Marshal(listeners); err == nil {
+		h.Set(StrippedListenersHeader, string(b))
+	}
+}
+
+// StrippedListeners are the listeners the engine disabled, none when it did not report them
+func StrippedListeners(h http.Header) []string {
+	var listeners []string
+	if v := h.Get(StrippedListenersHeader); v != "" {
+		if err := json.Unmarshal([]byte(v), &listeners); err != nil {
+			return nil
+		}
+	}
+	return listeners
+}
+
+const redacted = "[REDACTED]"
+
+// The run parameters looking like credentials are left out of the configs kept for the audits
+var secretParameterPattern = regexp.MustCompile(`(?i)pass|secret|token|key|credential|auth`)
 
 type EngineDataConfig struct {
 	EngineData  map[string]*model.SetagayaFile `json:"engine_data"`
 	Duration    string                         `json:"duration"`
 	Concurrency string                         `json:"concurrency"`
 	Rampup      string                         `json:"rampup"`
-	RunID       int64                          `json:"run_id"`
-	EngineID    int                            `json:"engine_id"`
+	// Seconds the threads take to stop at the end of the duration. 0 stops them at once
+	Rampdown int `json:"rampdown,omitempty"`
+	// The run is attended-only, the controller ramps the engines down when nobody attends it anymore
+	Attended bool  `json:"attended,omitempty"`
+	RunID    int64 `json:"run_id"`
+	EngineID int   `json:"engine_id"`
+	// Requests per second this engine should hold. 0 disables throughput control
+	TargetRPS float64 `json:"target_rps"`
+	// Requests per second this engine sends at most, the pacing of the target included. 0 means no cap
+	MaxRPS float64 `json:"max_rps,omitempty"`
+	// Region the engine generates the traffic for. Empty when the plan is not geographically weighted
+	Region string `json:"region"`
+	// Run parameters declared by the plan, resolved with the values supplied at trigger time
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// Sampling of the failing responses. nil when the run does not capture them
+	FailureCapture *model.FailureCapture `json:"failure_capture,omitempty"`
+	// Columns of the JTL files. Empty means they are detected from the header or the default ones are used
+	JTLColumns []string `json:"jtl_columns,omitempty"`
+	// Plugins and libraries the engine installs before the run, from the mirror when there is one
+	Artifacts      []*config.Artifact `json:"artifacts,omitempty"`
+	ArtifactMirror string             `json:"artifact_mirror,omitempty"`
+	// Egress network of the engine. It's shaped when the engine is deployed, nil when it's not
+	NetworkShaping *config.NetworkShaping `json:"network_shaping,omitempty"`
+	// DNS cache of jmeter. nil keeps the defaults of the JVM
+	DNSCaching *model.DNSCaching `json:"dns_caching,omitempty"`
+	// HTTP connections of jmeter. nil keeps what the test plan sets
+	ConnectionPolicy *model.ConnectionPolicy `json:"connection_policy,omitempty"`
+	// Keeps the samples in segments the controller has the engine upload at the checkpoints of the soak runs
+	ResultSegments bool `json:"result_segments,omitempty"`
+	// Seed of the random values of the engine, derived from the one of the run. nil keeps them unseeded
+	Seed *int64 `json:"seed,omitempty"`
+	// Shuffles the rows of the csv files with the seed
+	ShuffleData bool `json:"shuffle_data,omitempty"`
+	// Seconds from the start of the engine whose samples are left out of the summary of the run
+	Warmup int `json:"warmup,omitempty"`
+}
+
+// CheckNetworkShaping fails when the engine was deployed with another network shaping than the one the run asks
+// for, the plan changed since and the engines have to be deployed again
+func (edc *EngineDataConfig) CheckNetworkShaping() error {
+	deployed := os.Getenv(config.NetworkShapingEnv)
+	if requested := edc.NetworkShaping.String(); requested != deployed {
+		return fmt.Errorf("the engine was deployed with the network shaping %q instead of %q, it has to be deployed again",
+			deployed, requested)
+	}
+	return nil
+}
+
+// Redacted is a copy of the config without its secrets: the values of the parameters looking like credentials, the
+// credentials of the urls and the signatures of the file links
+func (edc *EngineDataConfig) Redacted() *EngineDataConfig {
+	r := edc.deepCopy()
+	for name, value := range r.Parameters {
+		if secretParameterPattern.MatchString(name) {
+			r.Parameters[name] = redacted
+		} else {
+			// The values can carry secrets of their own, e.g. the token of a url
+			r.Parameters[name] = config.ScrubSecrets(value)
+		}
+	}
+	r.ArtifactMirror = redactURL(r.ArtifactMirror, false)
+	for i, a := range r.Artifacts {
+		ac := *a
+		ac.URL = redactURL(ac.URL, false)
+		r.Artifacts[i] = &ac
+	}
+	for _, sf := range r.EngineData {
+		sf.Filelink = redactURL(sf.Filelink, true)
+	}
+	return r
+}
+
+// redactURL removes the credentials of the url, and its query when it can carry a signature
+func redactURL(raw string, query bool) string {
+	if raw == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if query && u.RawQuery != "" {
+		u.RawQuery = ""
+	}
+	return u.String()
 }
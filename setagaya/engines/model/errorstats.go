@@ -0,0 +1,122 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Error categories of the failed samples
+const (
+	ErrorConnectTimeout = "connect_timeout"
+	ErrorReadTimeout    = "read_timeout"
+	ErrorTLS            = "tls"
+	ErrorConnection     = "connection"
+	ErrorClient         = "4xx"
+	ErrorServer         = "5xx"
+	// The response was fine but an assertion marked the sample as failed
+	ErrorAssertion = "assertion"
+	ErrorOther     = "other"
+)
+
+const (
+	// Messages often contain ids, so the number of distinct errors per label is capped to keep the stats small.
+	// Errors beyond the cap are counted under their category with overflowMessage.
+	maxErrorsPerLabel = 100
+	maxErrorMessage   = 256
+	overflowMessage   = "(other messages)"
+)
+
+// ClassifyError returns the category of a failed sample from the response code and message columns of the JTL.
+// For non HTTP errors jmeter puts the exception in the response code, e.g.
+// "Non HTTP response code: java.net.SocketTimeoutException".
+func ClassifyError(code, message string) string {
+	if status, err := strconv.Atoi(code); err == nil {
+		switch {
+		case status >= 500 && status < 600:
+			return ErrorServer
+		case status >= 400 && status < 500:
+			return ErrorClient
+		case status >= 100 && status < 400:
+			return ErrorAssertion
+		}
+		return ErrorOther
+	}
+	lower := strings.ToLower(code + " " + message)
+	switch {
+	case strings.Contains(lower, "connecttimeoutexception"), strings.Contains(lower, "connect timed out"):
+		return ErrorConnectTimeout
+	case strings.Contains(lower, "sockettimeoutexception"), strings.Contains(lower, "read timed out"):
+		return ErrorReadTimeout
+	case strings.Contains(lower, "javax.net.ssl"), strings.Contains(lower, "sslexception"):
+		return ErrorTLS
+	case strings.Contains(lower, "connectexception"), strings.Contains(lower, "socketexception"),
+		strings.Contains(lower, "nohttpresponseexception"), strings.Contains(lower, "unknownhostexception"):
+		return ErrorConnection
+	}
+	return ErrorOther
+}
+
+type ErrorCount struct {
+	Category string `json:"category"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Count    uint64 `json:"count"`
+}
+
+func (ec *ErrorCount) key() string {
+	return ec.Category + "|" + ec.Code + "|" + ec.Message
+}
+
+// ErrorStats counts the failed samples by label and error. Like the latency histogram, stats from
+// different engines can be merged into the stats of the whole run.
+type ErrorStats struct {
+	Labels map[string]map[string]*ErrorCount `json:"labels"`
+}
+
+func NewErrorStats() *ErrorStats {
+	return &ErrorStats{Labels: map[string]map[string]*ErrorCount{}}
+}
+
+func (es *ErrorStats) add(label string, ec *ErrorCount) {
+	errs, ok := es.Labels[label]
+	if !ok {
+		errs = map[string]*ErrorCount{}
+		es.Labels[label] = errs
+	}
+	key := ec.key()
+	if existing, ok := errs[key]; ok {
+		existing.Count += ec.Count
+		return
+	}
+	if len(errs) >= maxErrorsPerLabel {
+		ec = &ErrorCount{Category: ec.Category, Message: overflowMessage, Count: ec.Count}
+		key = ec.key()
+		if existing, ok := errs[key]; ok {
+			existing.Count += ec.Count
+			return
+		}
+	}
+	errs[key] = ec
+}
+
+// Observe counts a failed sample
+func (es *ErrorStats) Observe(label, code, message string) {
+	if len(message) > maxErrorMessage {
+		message = message[:maxErrorMessage]
+	}
+	es.add(label, &ErrorCount{
+		Category: ClassifyError(code, message),
+		Code:     code,
+		Message:  message,
+		Count:    1,
+	})
+}
+
+func (es *ErrorStats) Merge(other *ErrorStats) {
+	for label, errs := range other.Labels {
+		for _, ec := range errs {
+			c := *ec
+			es.add(label, &c)
+		}
+	}
+}
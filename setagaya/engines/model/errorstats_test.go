@@ -0,0 +1,80 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		code     string
+		message  string
+		expected string
+	}{
+		{"500", "Internal Server Error", ErrorServer},
+		{"503", "Service Unavailable", ErrorServer},
+		{"404", "Not Found", ErrorClient},
+		{"200", "OK", ErrorAssertion},
+		{"302", "Found", ErrorAssertion},
+		{"Non HTTP response code: org.apache.http.conn.ConnectTimeoutException", "Non HTTP response message: Connect to example.com:443 failed", ErrorConnectTimeout},
+		{"Non HTTP response code: java.net.SocketTimeoutException", "Non HTTP response message: connect timed out", ErrorConnectTimeout},
+		{"Non HTTP response code: java.net.SocketTimeoutException", "Non HTTP response message: Read timed out", ErrorReadTimeout},
+		{"Non HTTP response code: javax.net.ssl.SSLHandshakeException", "Non HTTP response message: PKIX path building failed", ErrorTLS},
+		{"Non HTTP response code: java.net.ConnectException", "Non HTTP response message: Connection refused", ErrorConnection},
+		{"Non HTTP response code: org.apache.http.NoHttpResponseException", "Non HTTP response message: example.com:443 failed to respond", ErrorConnection},
+		{"", "", ErrorOther},
+		{"999", "", ErrorOther},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.code+" "+tc.message, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ClassifyError(tc.code, tc.message))
+		})
+	}
+}
+
+func TestErrorStatsMerge(t *testing.T) {
+	a := NewErrorStats()
+	a.Observe("login", "500", "Internal Server Error")
+	a.Observe("login", "500", "Internal Server Error")
+	a.Observe("search", "404", "Not Found")
+	b := NewErrorStats()
+	b.Observe("login", "500", "Internal Server Error")
+	b.Observe("login", "Non HTTP response code: java.net.SocketTimeoutException", "Read timed out")
+
+	a.Merge(b)
+	assert.Len(t, a.Labels, 2)
+	assert.Len(t, a.Labels["login"], 2)
+	for _, ec := range a.Labels["login"] {
+		switch ec.Category {
+		case ErrorServer:
+			assert.Equal(t, uint64(3), ec.Count)
+		case ErrorReadTimeout:
+			assert.Equal(t, uint64(1), ec.Count)
+		default:
+			t.Errorf("unexpected category %s", ec.Category)
+		}
+	}
+	// merging must not share the counters of the other stats
+	a.Observe("search", "404", "Not Found")
+	assert.Len(t, b.Labels, 1)
+}
+
+func TestErrorStatsOverflow(t *testing.T) {
+	es := NewErrorStats()
+	for i := 0; i < maxErrorsPerLabel+10; i++ {
+		es.Observe("checkout", "500", fmt.Sprintf("order %d failed", i))
+	}
+	errs := es.Labels["checkout"]
+	assert.Len(t, errs, maxErrorsPerLabel+1)
+	var total uint64
+	for _, ec := range errs {
+		total += ec.Count
+		if ec.Message == overflowMessage {
+			assert.Equal(t, uint64(10), ec.Count)
+			assert.Equal(t, ErrorServer, ec.Category)
+		}
+	}
+	assert.Equal(t, uint64(maxErrorsPerLabel+10), total)
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+// The files can be large, the timeout only guards against a storage which stopped answering
+var fileHttpClient = &http.Client{Timeout: 30 * time.Minute}
+
+// FetchFile downloads a file the controller sent. The file is read from its signed url when the controller signed
+// one, so the engine does not need the credentials of the storage, and from the storage of its region otherwise.
+func FetchFile(storage object_storage.StorageInterface, sf *model.SetagayaFile) ([]byte, error) {
+	if sf.Filelink == "" {
+		regional, err := object_storage.ForRegion(storage, sf.Region)
+		if err != nil {
+			return nil, err
+		}
+		return regional.Download(sf.Filepath)
+	}
+	resp, err := fileHttpClient.Get(sf.Filelink)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, object_storage.FileNotFoundError()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot download %s: %s", sf.Filename, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// UploadFile uploads the content to a signed url with a PUT
+func UploadFile(url string, content []byte) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	resp, err := fileHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("cannot upload to the signed url: %s", resp.Status)
+	}
+	return nil
+}
+
+// FailuresRequest is what the controller sends to the engines when it collects the failing responses they captured
+type FailuresRequest struct {
+	// Signed url the engine uploads the captures to. The engine uploads them to the storage when it's empty
+	UploadURL string `json:"upload_url,omitempty"`
+	// Region of the storage the engine uploads the captures to when there is no signed url
+	Region string `json:"region,omitempty"`
+}
@@ -0,0 +1,67 @@
+package model
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+type fakeStorage struct {
+	object_storage.StorageInterface
+	files map[string][]byte
+}
+
+func (fs *fakeStorage) Download(filename string) ([]byte, error) {
+	if content, ok := fs.files[filename]; ok {
+		return content, nil
+	}
+	return nil, object_storage.FileNotFoundError()
+}
+
+func TestFetchFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/signed/data.csv":
+			w.Write([]byte("signed"))
+		case "/signed/broken.csv":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	storage := &fakeStorage{files: map[string][]byte{"plan/1/data.csv": []byte("stored")}}
+
+	content, err := FetchFile(storage, &model.SetagayaFile{Filename: "data.csv", Filepath: "plan/1/data.csv"})
+	assert.Nil(t, err)
+	assert.Equal(t, "stored", string(content))
+
+	content, err = FetchFile(storage, &model.SetagayaFile{Filename: "data.csv", Filepath: "plan/1/data.csv",
+		Filelink: server.URL + "/signed/data.csv"})
+	assert.Nil(t, err)
+	assert.Equal(t, "signed", string(content))
+
+	_, err = FetchFile(storage, &model.SetagayaFile{Filename: "missing.csv", Filelink: server.URL + "/signed/missing.csv"})
+	assert.ErrorIs(t, err, object_storage.FileNotFoundError())
+
+	_, err = FetchFile(storage, &model.SetagayaFile{Filename: "broken.csv", Filelink: server.URL + "/signed/broken.csv"})
+	assert.NotNil(t, err)
+}
+
+func TestUploadFile(t *testing.T) {
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		body, _ := io.ReadAll(r.Body)
+		uploaded = string(body)
+	}))
+	defer server.Close()
+	assert.Nil(t, UploadFile(server.URL+"/signed/failures.json", []byte("failures")))
+	assert.Equal(t, "failures", uploaded)
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"math"
+	"sort"
+)
+
+// Each power of two is split into this many linear sub buckets. 32 sub buckets keeps the
+// relative error of a reported percentile under ~3%, which is good enough for latency reporting
+// while keeping the digest small enough to ship over HTTP.
+const histogramSubBuckets = 32
+
+// LatencyHistogram is a mergeable latency digest.
+// Percentiles calculated by each engine cannot be averaged, but bucket counts can simply be added up.
+// Engines keep one of these per run and the controller merges them into collection level percentiles.
+type LatencyHistogram struct {
+	Counts map[int]uint64 `json:"counts"`
+	Total  uint64         `json:"total"`
+	Sum    float64        `json:"sum"`
+	Min    float64        `json:"min"`
+	Max    float64        `json:"max"`
+}
+
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{
+		Counts: map[int]uint64{},
+	}
+}
+
+// bucketIndex maps a latency in milliseconds to its bucket
+// Bucket 0 holds everything below 1ms.
+func bucketIndex(v float64) int {
+	if v < 1 {
+		return 0
+	}
+	exp := int(math.Floor(math.Log2(v)))
+	lower := math.Exp2(float64(exp))
+	sub := int((v - lower) / lower * histogramSubBuckets)
+	if sub >= histogramSubBuckets {
+		sub = histogramSubBuckets - 1
+	}
+	return 1 + exp*histogramSubBuckets + sub
+}
+
+// bucketValue returns the mid point of the bucket, which is what we report as the percentile value
+func bucketValue(idx int) float64 {
+	if idx <= 0 {
+		return 0.5
+	}
+	idx--
+	exp := idx / histogramSubBuckets
+	sub := idx % histogramSubBuckets
+	lower := math.Exp2(float64(exp))
+	width := lower / histogramSubBuckets
+	return lower + width*float64(sub) + width/2
+}
+
+func (h *LatencyHistogram) Observe(latency float64) {
+	if latency < 0 || math.IsNaN(latency) {
+		return
+	}
+	if h.Counts == nil {
+		h.Counts = map[int]uint64{}
+	}
+	if h.Total == 0 || latency < h.Min {
+		h.Min = latency
+	}
+	if latency > h.Max {
+		h.Max = latency
+	}
+	h.Counts[bucketIndex(latency)]++
+	h.Total++
+	h.Sum += latency
+}
+
+// Merge adds all the observations of other into h
+func (h *LatencyHistogram) Merge(other *LatencyHistogram) {
+	if other == nil || other.Total == 0 {
+		return
+	}
+	if h.Counts == nil {
+		h.Counts = map[int]uint64{}
+	}
+	if h.Total == 0 || other.Min < h.Min {
+		h.Min = other.Min
+	}
+	if other.Max > h.Max {
+		h.Max = other.Max
+	}
+	for idx, count := range other.Counts {
+		h.Counts[idx] += count
+	}
+	h.Total += other.Total
+	h.Sum += other.Sum
+}
+
+func (h *LatencyHistogram) Mean() float64 {
+	if h.Total == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Total)
+}
+
+// Percentile returns the latency below which p (0-100) percent of the observations fall
+func (h *LatencyHistogram) Percentile(p float64) float64 {
+	if h.Total == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.Min
+	}
+	if p >= 100 {
+		return h.Max
+	}
+	rank := uint64(math.Ceil(p / 100 * float64(h.Total)))
+	indexes := make([]int, 0, len(h.Counts))
+	for idx := range h.Counts {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	var seen uint64
+	for _, idx := range indexes {
+		seen += h.Counts[idx]
+		if seen >= rank {
+			// The bucket mid point can fall outside of what we actually observed
+			return math.Min(math.Max(bucketValue(idx), h.Min), h.Max)
+		}
+	}
+	return h.Max
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyHistogramPercentile(t *testing.T) {
+	h := NewLatencyHistogram()
+	for i := 1; i <= 1000; i++ {
+		h.Observe(float64(i))
+	}
+	assert.Equal(t, uint64(1000), h.Total)
+	assert.Equal(t, float64(1), h.Min)
+	assert.Equal(t, float64(1000), h.Max)
+	assert.InDelta(t, 500.5, h.Mean(), 0.001)
+	assert.InEpsilon(t, 500, h.Percentile(50), 0.03)
+	assert.InEpsilon(t, 900, h.Percentile(90), 0.03)
+	assert.InEpsilon(t, 990, h.Percentile(99), 0.03)
+	assert.Equal(t, float64(1000), h.Percentile(100))
+	assert.Equal(t, float64(1), h.Percentile(0))
+}
+
+func TestLatencyHistogramEmpty(t *testing.T) {
+	h := NewLatencyHistogram()
+	assert.Equal(t, float64(0), h.Percentile(99))
+	assert.Equal(t, float64(0), h.Mean())
+	h.Observe(-1)
+	assert.Equal(t, uint64(0), h.Total)
+}
+
+func TestLatencyHistogramMerge(t *testing.T) {
+	// One fast engine and one slow engine. Averaging their p50 would give 250,
+	// while the true collection p50 sits on the boundary of the two.
+	fast := NewLatencyHistogram()
+	slow := NewLatencyHistogram()
+	for i := 0; i < 900; i++ {
+		fast.Observe(10)
+	}
+	for i := 0; i < 100; i++ {
+		slow.Observe(490)
+	}
+	merged := NewLatencyHistogram()
+	merged.Merge(fast)
+	merged.Merge(slow)
+	merged.Merge(nil)
+
+	assert.Equal(t, uint64(1000), merged.Total)
+	assert.Equal(t, float64(10), merged.Min)
+	assert.Equal(t, float64(490), merged.Max)
+	assert.InEpsilon(t, 10, merged.Percentile(50), 0.03)
+	assert.InEpsilon(t, 10, merged.Percentile(90), 0.03)
+	assert.InEpsilon(t, 490, merged.Percentile(95), 0.03)
+}
+
+func TestLatencyHistogramJSONRoundTrip(t *testing.T) {
+	h := NewLatencyHistogram()
+	h.Observe(0.2)
+	h.Observe(15)
+	h.Observe(2500)
+	raw, err := json.Marshal(h)
+	assert.NoError(t, err)
+	decoded := new(LatencyHistogram)
+	assert.NoError(t, json.Unmarshal(raw, decoded))
+	assert.Equal(t, h, decoded)
+}
@@ -0,0 +1,271 @@
+package model
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	JTLSeparator = "|"
+	// Delimiter of the jmeter CSV results when it's not configured
+	csvSeparator = ","
+	// Jmeter transaction controllers write their samples with a response message starting with this
+	transactionMessagePrefix = "Number of samples in transaction"
+	// The setagaya reporter of playwright writes the page timings and web vitals with this response message
+	webVitalMessage = "Web vital"
+)
+
+// Names of the JTL columns read by setagaya. They are the names jmeter writes in the header of the files.
+const (
+	JTLColumnTimestamp       = "timeStamp"
+	JTLColumnElapsed         = "elapsed"
+	JTLColumnLabel           = "label"
+	JTLColumnResponseCode    = "responseCode"
+	JTLColumnResponseMessage = "responseMessage"
+	JTLColumnThreadName      = "threadName"
+	JTLColumnSuccess         = "success"
+	JTLColumnFailureMessage  = "failureMessage"
+	JTLColumnBytes           = "bytes"
+	JTLColumnGrpThreads      = "grpThreads"
+	JTLColumnAllThreads      = "allThreads"
+	JTLColumnLatency         = "Latency"
+	JTLColumnConnect         = "Connect"
+)
+
+var (
+	// DefaultJTLColumns are the columns written by the engines with the default configuration
+	DefaultJTLColumns = []string{JTLColumnTimestamp, JTLColumnElapsed, JTLColumnLabel, JTLColumnResponseCode,
+		JTLColumnResponseMessage, JTLColumnThreadName, JTLColumnSuccess, JTLColumnFailureMessage, JTLColumnBytes,
+		JTLColumnGrpThreads, JTLColumnAllThreads, JTLColumnLatency, JTLColumnConnect}
+	// Engines predating the failureMessage column write one column less
+	legacyJTLColumns = []string{JTLColumnTimestamp, JTLColumnElapsed, JTLColumnLabel, JTLColumnResponseCode,
+		JTLColumnResponseMessage, JTLColumnThreadName, JTLColumnSuccess, JTLColumnBytes, JTLColumnGrpThreads,
+		JTLColumnAllThreads, JTLColumnLatency, JTLColumnConnect}
+
+	defaultJTLSchema, _ = NewJTLSchema(DefaultJTLColumns)
+	legacyJTLSchema, _  = NewJTLSchema(legacyJTLColumns)
+
+	// ErrJTLHeader is returned for the header line of the JTL files. It's not a sample
+	ErrJTLHeader = errors.New("line is the header of the JTL file")
+)
+
+// JTLRecord is a sample of a JTL file
+type JTLRecord struct {
+	Timestamp       int64
+	Elapsed         float64
+	Label           string
+	ResponseCode    string
+	ResponseMessage string
+	ThreadName      string
+	Success         bool
+	// Message of the assertion which failed the sample. Empty when the sample passed its assertions
+	FailureMessage string
+	Bytes          int64
+	GrpThreads     float64
+	AllThreads     float64
+	Latency        float64
+	Connect        float64
+	// True when the sample is written by a transaction controller rather than a sampler
+	Transaction bool
+	// True when the sample is a page timing or a web vital collected by playwright rather than a request
+	WebVital bool
+}
+
+func cleanJTLValue(v string) string {
+	return strings.NewReplacer(JTLSeparator, " ", "\r", " ", "\n", " ").Replace(v)
+}
+
+func formatJTLFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// String formats the record as a line with the default columns, whatever the format it was read from
+func (r *JTLRecord) String() string {
+	return strings.Join([]string{
+		strconv.FormatInt(r.Timestamp, 10),
+		formatJTLFloat(r.Elapsed),
+		cleanJTLValue(r.Label),
+		cleanJTLValue(r.ResponseCode),
+		cleanJTLValue(r.ResponseMessage),
+		cleanJTLValue(r.ThreadName),
+		strconv.FormatBool(r.Success),
+		cleanJTLValue(r.FailureMessage),
+		strconv.FormatInt(r.Bytes, 10),
+		formatJTLFloat(r.GrpThreads),
+		formatJTLFloat(r.AllThreads),
+		formatJTLFloat(r.Latency),
+		formatJTLFloat(r.Connect),
+	}, JTLSeparator)
+}
+
+// JTLSchema is the layout of the lines of a JTL file. Custom sample_variables or other jmeter versions
+// add, remove or move columns, so the columns are looked up by name.
+type JTLSchema struct {
+	size    int
+	columns map[string]int
+}
+
+func NewJTLSchema(columns []string) (*JTLSchema, error) {
+	s := &JTLSchema{
+		size:    len(columns),
+		columns: make(map[string]int, len(columns)),
+	}
+	for i, c := range columns {
+		s.columns[strings.TrimSpace(c)] = i
+	}
+	for _, required := range []string{JTLColumnLabel, JTLColumnResponseCode, JTLColumnLatency} {
+		if _, ok := s.columns[required]; !ok {
+			return nil, fmt.Errorf("JTL columns do not have the required %s column", required)
+		}
+	}
+	return s, nil
+}
+
+func (s *JTLSchema) column(line []string, name string) (string, bool) {
+	i, ok := s.columns[name]
+	if !ok {
+		return "", false
+	}
+	return line[i], true
+}
+
+func (s *JTLSchema) float(line []string, name string) float64 {
+	v, ok := s.column(line, name)
+	if !ok {
+		return 0
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0 // default to 0 if parsing fails
+	}
+	return f
+}
+
+func (s *JTLSchema) parse(line []string, raw string) (*JTLRecord, error) {
+	// We use char "|" as the separator in the JTL files. If some users somehow put another | in their label name
+	// we could end up a broken split. For those requests, we simply return an error, otherwise the process will crash.
+	if len(line) != s.size {
+		return nil, fmt.Errorf("line length was not expected. Raw line is %s", raw)
+	}
+	latencyColumn, _ := s.column(line, JTLColumnLatency)
+	latency, err := strconv.ParseFloat(latencyColumn, 64)
+	if err != nil {
+		return nil, err
+	}
+	r := &JTLRecord{
+		Timestamp:  int64(s.float(line, JTLColumnTimestamp)),
+		Elapsed:    s.float(line, JTLColumnElapsed),
+		Success:    true,
+		Bytes:      int64(s.float(line, JTLColumnBytes)),
+		GrpThreads: s.float(line, JTLColumnGrpThreads),
+		AllThreads: s.float(line, JTLColumnAllThreads),
+		Latency:    latency,
+		Connect:    s.float(line, JTLColumnConnect),
+	}
+	r.Label, _ = s.column(line, JTLColumnLabel)
+	r.ResponseCode, _ = s.column(line, JTLColumnResponseCode)
+	r.ResponseMessage, _ = s.column(line, JTLColumnResponseMessage)
+	r.ThreadName, _ = s.column(line, JTLColumnThreadName)
+	r.FailureMessage, _ = s.column(line, JTLColumnFailureMessage)
+	if success, ok := s.column(line, JTLColumnSuccess); ok {
+		r.Success = success == "true"
+	}
+	r.Transaction = strings.HasPrefix(r.ResponseMessage, transactionMessagePrefix)
+	if r.Transaction {
+		// Transaction samples do not have a latency of their own. Their elapsed time covers all the child samples
+		r.Latency = r.Elapsed
+	}
+	r.WebVital = r.ResponseMessage == webVitalMessage
+	return r, nil
+}
+
+func isJTLHeader(line []string) bool {
+	var label, latency bool
+	for _, c := range line {
+		switch strings.TrimSpace(c) {
+		case JTLColumnLabel:
+			label = true
+		case JTLColumnLatency:
+			latency = true
+		}
+	}
+	return label && latency
+}
+
+// splitJTLLine splits a line of delimited values. Jmeter quotes the values containing the delimiter or quotes,
+// those lines are read as CSV.
+func splitJTLLine(raw, delimiter string) []string {
+	if !strings.Contains(raw, `"`) {
+		return strings.Split(raw, delimiter)
+	}
+	r := csv.NewReader(strings.NewReader(raw))
+	r.Comma = []rune(delimiter)[0]
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	line, err := r.Read()
+	if err != nil {
+		return strings.Split(raw, delimiter)
+	}
+	return line
+}
+
+// JTLParser parses the lines of a delimited JTL file, either the pipe delimited lines of setagaya or
+// the CSV results of jmeter. The columns are taken from the header of the file when it has one,
+// otherwise from the configured columns. Without either, the default columns are expected.
+// A parser keeps the header it has seen, so every file needs its own parser.
+type JTLParser struct {
+	schema    *JTLSchema
+	delimiter string
+}
+
+// NewJTLParser makes a parser expecting the columns. Empty columns mean the default ones.
+func NewJTLParser(columns []string) (*JTLParser, error) {
+	p := new(JTLParser)
+	if len(columns) == 0 {
+		return p, nil
+	}
+	schema, err := NewJTLSchema(columns)
+	if err != nil {
+		return nil, err
+	}
+	p.schema = schema
+	return p, nil
+}
+
+func (p *JTLParser) Parse(raw string) (*JTLRecord, error) {
+	if p.delimiter == "" {
+		// The delimiter is detected from the first line. Jmeter writes comma separated values
+		// unless the delimiter is configured like setagaya does
+		p.delimiter = JTLSeparator
+		if !strings.Contains(raw, JTLSeparator) && strings.Contains(raw, csvSeparator) {
+			p.delimiter = csvSeparator
+		}
+	}
+	line := splitJTLLine(raw, p.delimiter)
+	if isJTLHeader(line) {
+		schema, err := NewJTLSchema(line)
+		if err != nil {
+			return nil, err
+		}
+		p.schema = schema
+		return nil, ErrJTLHeader
+	}
+	schema := p.schema
+	if schema == nil {
+		switch len(line) {
+		case legacyJTLSchema.size:
+			schema = legacyJTLSchema
+		default:
+			schema = defaultJTLSchema
+		}
+	}
+	return schema.parse(line, raw)
+}
+
+// ParseJTLLine parses a line written with the default columns
+func ParseJTLLine(raw string) (*JTLRecord, error) {
+	return new(JTLParser).Parse(raw)
+}
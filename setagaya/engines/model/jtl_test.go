@@ -0,0 +1,91 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJTLLine(t *testing.T) {
+	record, err := ParseJTLLine("1700000000000|120|login|200|OK|Thread Group 1-1|false|Test failed: text expected to contain /welcome/|512|10|20|100|5")
+	assert.NoError(t, err)
+	assert.Equal(t, "login", record.Label)
+	assert.Equal(t, "200", record.ResponseCode)
+	assert.Equal(t, "OK", record.ResponseMessage)
+	assert.False(t, record.Success)
+	assert.Equal(t, "Test failed: text expected to contain /welcome/", record.FailureMessage)
+	assert.Equal(t, float64(20), record.AllThreads)
+	assert.Equal(t, float64(100), record.Latency)
+	assert.False(t, record.Transaction)
+}
+
+func TestParseJTLLineTransaction(t *testing.T) {
+	record, err := ParseJTLLine("1700000000000|350|checkout|200|Number of samples in transaction : 3, number of failing samples : 0|Thread Group 1-1|true||1536|10|20|0|0")
+	assert.NoError(t, err)
+	assert.Equal(t, "checkout", record.Label)
+	assert.True(t, record.Success)
+	assert.True(t, record.Transaction)
+	assert.Equal(t, float64(350), record.Latency)
+}
+
+func TestParseJTLLineWebVital(t *testing.T) {
+	record, err := ParseJTLLine("1700000000000|1830|checkout:lcp|200|Web vital|worker 0|true||0|4|4|1830|0")
+	assert.NoError(t, err)
+	assert.Equal(t, "checkout:lcp", record.Label)
+	assert.True(t, record.WebVital)
+	assert.False(t, record.Transaction)
+
+	record, err = ParseJTLLine("1700000000000|2100|checkout|200|OK|worker 0|true||0|4|4|2100|0")
+	assert.NoError(t, err)
+	assert.False(t, record.WebVital)
+}
+
+func TestParseJTLLineLegacy(t *testing.T) {
+	record, err := ParseJTLLine("1700000000000|120|login|500|Internal Server Error|Thread Group 1-1|false|512|10|x|100|5")
+	assert.NoError(t, err)
+	assert.Equal(t, "500", record.ResponseCode)
+	assert.Equal(t, "", record.FailureMessage)
+	assert.Equal(t, float64(0), record.AllThreads)
+	assert.Equal(t, float64(100), record.Latency)
+}
+
+func TestParseJTLLineInvalid(t *testing.T) {
+	_, err := ParseJTLLine("1700000000000|120|log|in|200|OK")
+	assert.Error(t, err)
+	_, err = ParseJTLLine("timeStamp|elapsed|label|responseCode|responseMessage|threadName|success|failureMessage|bytes|grpThreads|allThreads|Latency|Connect")
+	assert.Error(t, err)
+}
+
+func TestJTLParserHeader(t *testing.T) {
+	p, err := NewJTLParser(nil)
+	assert.NoError(t, err)
+	// sample_variables are appended to the columns and the thread name is not saved
+	_, err = p.Parse("timeStamp|elapsed|label|responseCode|responseMessage|success|failureMessage|bytes|grpThreads|allThreads|Latency|Connect|userId")
+	assert.ErrorIs(t, err, ErrJTLHeader)
+
+	record, err := p.Parse("1700000000000|120|login|200|OK|true||512|10|20|100|5|42")
+	assert.NoError(t, err)
+	assert.Equal(t, "login", record.Label)
+	assert.Equal(t, "200", record.ResponseCode)
+	assert.True(t, record.Success)
+	assert.Equal(t, float64(20), record.AllThreads)
+	assert.Equal(t, float64(100), record.Latency)
+
+	_, err = p.Parse("1700000000000|120|login|200|OK|Thread Group 1-1|true||512|10|20|100|5|42")
+	assert.Error(t, err)
+}
+
+func TestJTLParserConfiguredColumns(t *testing.T) {
+	p, err := NewJTLParser([]string{"timeStamp", "label", "responseCode", "Latency"})
+	assert.NoError(t, err)
+	record, err := p.Parse("1700000000000|login|500|100")
+	assert.NoError(t, err)
+	assert.Equal(t, "login", record.Label)
+	assert.Equal(t, "500", record.ResponseCode)
+	assert.True(t, record.Success)
+	assert.Equal(t, float64(0), record.AllThreads)
+	assert.Equal(t, float64(100), record.Latency)
+
+	_, err = NewJTLParser([]string{"timeStamp", "label", "Latency"})
+	assert.Error(t, err)
+}
@@ -1,40 +1,92 @@
 package model
 
-import "github.com/hveda/Setagaya/setagaya/model"
+import (
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+)
 
 type SetagayaMetric struct {
-	Threads      float64
-	Latency      float64
-	Label        string
-	Status       string
-	Raw          string
-	CollectionID string
-	PlanID       string
-	EngineID     string
-	RunID        string
+	// Time the sample was taken at, in milliseconds
+	Timestamp      int64
+	Threads        float64
+	Latency        float64
+	Label          string
+	Status         string
+	Message        string
+	Success        bool
+	FailureMessage string
+	Transaction    bool
+	WebVital       bool
+	Raw            string
+	CollectionID   string
+	PlanID         string
+	EngineID       string
+	RunID          string
 }
 
-func (edc *EngineDataConfig) deepCopy() *EngineDataConfig {
-	edcCopy := EngineDataConfig{
-		EngineData:  map[string]*model.SetagayaFile{},
-		Duration:    edc.Duration,
-		Concurrency: edc.Concurrency,
-		Rampup:      edc.Rampup,
-		RunID:       edc.RunID,
-		EngineID:    edc.EngineID,
+// ErrorMessage is the message describing why the sample failed. Assertion failures are more specific
+// than the response message, which is usually just "OK" for them.
+func (sm SetagayaMetric) ErrorMessage() string {
+	if sm.FailureMessage != "" {
+		return sm.FailureMessage
 	}
+	return sm.Message
+}
+
+// deepCopy starts from a copy of the whole config, so a new field is kept unless it shares memory with the original,
+// then replaces the maps, slices and pointers with copies of their own
+func (edc *EngineDataConfig) deepCopy() *EngineDataConfig {
+	edcCopy := *edc
+	edcCopy.EngineData = make(map[string]*model.SetagayaFile, len(edc.EngineData))
 	for filename, ed := range edc.EngineData {
 		if ed != nil {
-			sf := model.SetagayaFile{
-				Filename:     ed.Filename,
-				Filepath:     ed.Filepath,
-				Filelink:     ed.Filelink,
-				TotalSplits:  ed.TotalSplits,
-				CurrentSplit: ed.CurrentSplit,
-			}
+			sf := *ed
 			edcCopy.EngineData[filename] = &sf
 		}
 	}
+	if edc.Seed != nil {
+		seed := *edc.Seed
+		edcCopy.Seed = &seed
+	}
+	if edc.Parameters != nil {
+		edcCopy.Parameters = make(map[string]string, len(edc.Parameters))
+		for k, v := range edc.Parameters {
+			edcCopy.Parameters[k] = v
+		}
+	}
+	if edc.JTLColumns != nil {
+		edcCopy.JTLColumns = append([]string{}, edc.JTLColumns...)
+	}
+	if edc.Artifacts != nil {
+		edcCopy.Artifacts = make([]*config.Artifact, len(edc.Artifacts))
+		for i, a := range edc.Artifacts {
+			if a != nil {
+				ac := *a
+				edcCopy.Artifacts[i] = &ac
+			}
+		}
+	}
+	if edc.FailureCapture != nil {
+		fc := *edc.FailureCapture
+		edcCopy.FailureCapture = &fc
+	}
+	if edc.NetworkShaping != nil {
+		ns := *edc.NetworkShaping
+		edcCopy.NetworkShaping = &ns
+	}
+	if edc.DNSCaching != nil {
+		dc := *edc.DNSCaching
+		dc.Servers = append([]string(nil), edc.DNSCaching.Servers...)
+		edcCopy.DNSCaching = &dc
+	}
+	if edc.ConnectionPolicy != nil {
+		cp := *edc.ConnectionPolicy
+		if cp.KeepAlive != nil {
+			keepAlive := *cp.KeepAlive
+			cp.KeepAlive = &keepAlive
+		}
+		edcCopy.ConnectionPolicy = &cp
+	}
 	return &edcCopy
 }
 
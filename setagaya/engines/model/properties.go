@@ -0,0 +1,89 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// Most properties a push can change, and the longest value of a property
+	maxRuntimeProperties     = 50
+	maxRuntimePropertyLength = 4096
+)
+
+var runtimePropertyNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]{0,99}$`)
+
+// The properties set by the agent and by jmeter itself. Changing them mid-run would break the run instead of
+// tweaking it
+var reservedPropertyPrefixes = []string{"setagaya.", "beanshell.", "jmeter.", "search_paths", "user.classpath"}
+
+// RuntimePropertiesRequest changes jmeter properties of a run in progress. The plans read them with
+// ${__P(name)}, e.g. to toggle a debug flag, and see the new values within a second.
+type RuntimePropertiesRequest struct {
+	Properties map[string]string `json:"properties"`
+}
+
+func (rpr *RuntimePropertiesRequest) Validate() error {
+	if len(rpr.Properties) == 0 {
+		return errors.New("no property to change")
+	}
+	if len(rpr.Properties) > maxRuntimeProperties {
+		return fmt.Errorf("at most %d properties can be changed at once", maxRuntimeProperties)
+	}
+	for name, value := range rpr.Properties {
+		if !runtimePropertyNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid property name %q", name)
+		}
+		for _, prefix := range reservedPropertyPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				return fmt.Errorf("property %s is managed by setagaya and cannot be changed", name)
+			}
+		}
+		if len(value) > maxRuntimePropertyLength {
+			return fmt.Errorf("property %s is longer than %d characters", name, maxRuntimePropertyLength)
+		}
+	}
+	return nil
+}
+
+// Names returns the sorted names of the properties, the values can be secrets
+func (rpr *RuntimePropertiesRequest) Names() []string {
+	names := make([]string, 0, len(rpr.Properties))
+	for name := range rpr.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var propertyValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "\f", `\f`)
+
+// FormatProperties writes the properties in the format of java.util.Properties.load, sorted by name. The names
+// are already restricted to a safe charset.
+func FormatProperties(properties map[string]string) []byte {
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	for _, name := range names {
+		value := propertyValueEscaper.Replace(properties[name])
+		// Leading white spaces are otherwise dropped
+		if strings.HasPrefix(value, " ") {
+			value = `\` + value
+		}
+		fmt.Fprintf(&b, "%s=%s\n", name, value)
+	}
+	return b.Bytes()
+}
+
+// RampdownRequest has the engine stop its threads one by one over the seconds, as at the end of its duration. Only
+// the engines of the attended-only runs can, their test plans are prepared for it.
+type RampdownRequest struct {
+	Seconds int `json:"seconds"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimePropertiesRequestValidate(t *testing.T) {
+	valid := &RuntimePropertiesRequest{Properties: map[string]string{"debug": "true", "target.path": "/checkout"}}
+	assert.NoError(t, valid.Validate())
+	assert.Equal(t, []string{"debug", "target.path"}, valid.Names())
+
+	invalid := []map[string]string{
+		nil,
+		{"bad name": "x"},
+		{"setagaya.throughput": "60"},
+		{"jmeter.save.saveservice.output_format": "xml"},
+		{"payload": strings.Repeat("a", maxRuntimePropertyLength+1)},
+	}
+	for _, properties := range invalid {
+		assert.Error(t, (&RuntimePropertiesRequest{Properties: properties}).Validate())
+	}
+	tooMany := map[string]string{}
+	for i := 0; i <= maxRuntimeProperties; i++ {
+		tooMany[strings.Repeat("p", i+1)] = "x"
+	}
+	assert.Error(t, (&RuntimePropertiesRequest{Properties: tooMany}).Validate())
+}
+
+func TestFormatProperties(t *testing.T) {
+	formatted := FormatProperties(map[string]string{
+		"debug":   "true",
+		"banner":  " hello",
+		"payload": "a=b\nc\\d",
+	})
+	assert.Equal(t, "banner=\\ hello\ndebug=true\npayload=a=b\\nc\\\\d\n", string(formatted))
+	assert.Empty(t, FormatProperties(nil))
+}
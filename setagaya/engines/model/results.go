@@ -0,0 +1,181 @@
+package model
+
+import (
+	"encoding/xml"
+	"errors"
+	"html"
+	"strings"
+	"time"
+)
+
+// ResultParser turns the lines of a jmeter result file into samples. Parsers keep state between the lines,
+// so every file needs its own parser.
+type ResultParser interface {
+	// Parse returns the samples completed by the line. Samples of the XML format span several lines,
+	// so most of the lines do not complete any.
+	Parse(line string) ([]*JTLRecord, error)
+}
+
+// delimitedResultParser reads the pipe delimited lines of setagaya and the CSV results of jmeter
+type delimitedResultParser struct {
+	*JTLParser
+}
+
+func (p *delimitedResultParser) Parse(line string) ([]*JTLRecord, error) {
+	r, err := p.JTLParser.Parse(line)
+	if errors.Is(err, ErrJTLHeader) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []*JTLRecord{r}, nil
+}
+
+type xmlSample struct {
+	Timestamp       int64   `xml:"ts,attr"`
+	Elapsed         float64 `xml:"t,attr"`
+	Label           string  `xml:"lb,attr"`
+	ResponseCode    string  `xml:"rc,attr"`
+	ResponseMessage string  `xml:"rm,attr"`
+	ThreadName      string  `xml:"tn,attr"`
+	Success         bool    `xml:"s,attr"`
+	Bytes           int64   `xml:"by,attr"`
+	GrpThreads      float64 `xml:"ng,attr"`
+	AllThreads      float64 `xml:"na,attr"`
+	Latency         float64 `xml:"lt,attr"`
+	Connect         float64 `xml:"ct,attr"`
+}
+
+func (s *xmlSample) record() *JTLRecord {
+	r := &JTLRecord{
+		Timestamp:       s.Timestamp,
+		Elapsed:         s.Elapsed,
+		Label:           s.Label,
+		ResponseCode:    s.ResponseCode,
+		ResponseMessage: s.ResponseMessage,
+		ThreadName:      s.ThreadName,
+		Success:         s.Success,
+		Bytes:           s.Bytes,
+		GrpThreads:      s.GrpThreads,
+		AllThreads:      s.AllThreads,
+		Latency:         s.Latency,
+		Connect:         s.Connect,
+		Transaction:     strings.HasPrefix(s.ResponseMessage, transactionMessagePrefix),
+	}
+	if r.Transaction {
+		r.Latency = r.Elapsed
+	}
+	return r
+}
+
+func isXMLSampleStart(line string) bool {
+	return strings.HasPrefix(line, "<httpSample ") || strings.HasPrefix(line, "<sample ")
+}
+
+func isXMLSampleEnd(line string) bool {
+	return strings.HasPrefix(line, "</httpSample>") || strings.HasPrefix(line, "</sample>")
+}
+
+// xmlResultParser reads the XML results of jmeter. Jmeter writes every sample element on its own line,
+// so the file can be read line by line as it's written. Like ParseDebugResults, only the top level samples
+// are returned. Sub results, like redirects, are part of their parent sample.
+type xmlResultParser struct {
+	// Samples whose element is not closed yet, the first one is the top level sample
+	open []*JTLRecord
+}
+
+func (p *xmlResultParser) Parse(line string) ([]*JTLRecord, error) {
+	line = strings.TrimSpace(line)
+	switch {
+	case isXMLSampleStart(line):
+		closed := strings.HasSuffix(line, "/>")
+		element := line
+		if !closed {
+			element = strings.TrimSuffix(line, ">") + "/>"
+		}
+		s := new(xmlSample)
+		if err := xml.Unmarshal([]byte(element), s); err != nil {
+			return nil, err
+		}
+		r := s.record()
+		if !closed {
+			p.open = append(p.open, r)
+			return nil, nil
+		}
+		if len(p.open) == 0 {
+			return []*JTLRecord{r}, nil
+		}
+	case isXMLSampleEnd(line):
+		if len(p.open) == 0 {
+			return nil, nil
+		}
+		r := p.open[len(p.open)-1]
+		p.open = p.open[:len(p.open)-1]
+		if len(p.open) == 0 {
+			return []*JTLRecord{r}, nil
+		}
+	case strings.HasPrefix(line, "<failureMessage>"):
+		// Only the assertions of the top level sample are kept. Messages spanning several lines are cut to the first one
+		if len(p.open) != 1 || p.open[0].FailureMessage != "" {
+			return nil, nil
+		}
+		message := strings.TrimSuffix(strings.TrimPrefix(line, "<failureMessage>"), "</failureMessage>")
+		p.open[0].FailureMessage = html.UnescapeString(message)
+	}
+	return nil, nil
+}
+
+// detectingResultParser picks the parser from the first line of the file
+type detectingResultParser struct {
+	columns []string
+	parser  ResultParser
+}
+
+func (p *detectingResultParser) Parse(line string) ([]*JTLRecord, error) {
+	if p.parser == nil {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			return nil, nil
+		}
+		if strings.HasPrefix(trimmed, "<") {
+			p.parser = new(xmlResultParser)
+		} else {
+			jp, err := NewJTLParser(p.columns)
+			if err != nil {
+				return nil, err
+			}
+			p.parser = &delimitedResultParser{jp}
+		}
+	}
+	return p.parser.Parse(line)
+}
+
+// NewResultParser makes a parser detecting the format of the file, XML or delimited values.
+// columns are the expected columns of the delimited values, see NewJTLParser.
+func NewResultParser(columns []string) (ResultParser, error) {
+	if len(columns) > 0 {
+		if _, err := NewJTLSchema(columns); err != nil {
+			return nil, err
+		}
+	}
+	return &detectingResultParser{columns: columns}, nil
+}
+
+const (
+	GapReasonAgentRestarted = "agent restarted"
+	GapReasonTruncated      = "result file truncated"
+	// The controller lost the stream of the engine and the engine could not replay all the samples it missed
+	GapReasonStreamInterrupted = "stream interrupted"
+)
+
+// ResultGap is a period of a run whose samples are missing from the results of an engine
+type ResultGap struct {
+	// Result file missing the samples. Empty when all the files of the engine are affected
+	File   string    `json:"file,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+	// Number of missing samples when it's known
+	Samples uint64 `json:"samples,omitempty"`
+}
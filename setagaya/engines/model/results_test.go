@@ -0,0 +1,109 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseResultLines(t *testing.T, p ResultParser, lines []string) []*JTLRecord {
+	records := []*JTLRecord{}
+	for _, l := range lines {
+		r, err := p.Parse(l)
+		assert.NoError(t, err)
+		records = append(records, r...)
+	}
+	return records
+}
+
+func TestResultParserCSV(t *testing.T) {
+	p, err := NewResultParser(nil)
+	assert.NoError(t, err)
+	records := parseResultLines(t, p, []string{
+		"timeStamp,elapsed,label,responseCode,responseMessage,threadName,dataType,success,failureMessage,bytes,sentBytes,grpThreads,allThreads,URL,Latency,IdleTime,Connect",
+		`1700000000000,120,"search, page 1",200,OK,Thread Group 1-1,text,true,,512,100,10,20,http://example.com,100,0,5`,
+		"1700000000100,80,login,200,OK,Thread Group 1-2,text,false,Test failed: text expected to contain /welcome/,512,100,10,20,http://example.com,70,0,5",
+	})
+	assert.Len(t, records, 2)
+	assert.Equal(t, "search, page 1", records[0].Label)
+	assert.Equal(t, int64(1700000000000), records[0].Timestamp)
+	assert.Equal(t, float64(100), records[0].Latency)
+	assert.Equal(t, float64(20), records[0].AllThreads)
+	assert.True(t, records[0].Success)
+	assert.False(t, records[1].Success)
+	assert.Equal(t, "Test failed: text expected to contain /welcome/", records[1].FailureMessage)
+}
+
+func TestResultParserPipe(t *testing.T) {
+	p, err := NewResultParser(nil)
+	assert.NoError(t, err)
+	records := parseResultLines(t, p, []string{
+		"timeStamp|elapsed|label|responseCode|responseMessage|threadName|success|failureMessage|bytes|grpThreads|allThreads|Latency|Connect",
+		"1700000000000|120|login|200|OK|Thread Group 1-1|true||512|10|20|100|5",
+	})
+	assert.Len(t, records, 1)
+	assert.Equal(t, "login", records[0].Label)
+	assert.Equal(t, "1700000000000|120|login|200|OK|Thread Group 1-1|true||512|10|20|100|5", records[0].String())
+}
+
+func TestResultParserXML(t *testing.T) {
+	p, err := NewResultParser(nil)
+	assert.NoError(t, err)
+	records := parseResultLines(t, p, []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<testResults version="1.2">`,
+		`<httpSample t="120" it="0" lt="100" ct="5" ts="1700000000000" s="true" lb="search" rc="200" rm="OK" tn="Thread Group 1-1" dt="text" by="512" sby="100" ng="10" na="20"/>`,
+		`<httpSample t="80" it="0" lt="70" ct="5" ts="1700000000100" s="false" lb="login &amp; redirect" rc="200" rm="OK" tn="Thread Group 1-2" dt="text" by="512" sby="100" ng="10" na="20">`,
+		`  <httpSample t="30" it="0" lt="30" ct="5" ts="1700000000100" s="true" lb="login-0" rc="302" rm="Found" tn="Thread Group 1-2" dt="text" by="100" sby="100" ng="10" na="20"/>`,
+		`  <assertionResult>`,
+		`    <name>Response Assertion</name>`,
+		`    <failure>true</failure>`,
+		`    <error>false</error>`,
+		`    <failureMessage>Test failed: text expected to contain &lt;welcome&gt;</failureMessage>`,
+		`  </assertionResult>`,
+		`</httpSample>`,
+		`<sample t="350" it="0" lt="0" ct="0" ts="1700000000200" s="true" lb="checkout" rc="200" rm="Number of samples in transaction : 3, number of failing samples : 0" tn="Thread Group 1-1" dt="" by="1536" sby="0" ng="10" na="20">`,
+		`  <httpSample t="100" it="0" lt="90" ct="5" ts="1700000000200" s="true" lb="cart" rc="200" rm="OK" tn="Thread Group 1-1" dt="text" by="512" sby="100" ng="10" na="20"/>`,
+		`</sample>`,
+		`</testResults>`,
+	})
+	assert.Len(t, records, 3)
+	assert.Equal(t, "search", records[0].Label)
+	assert.Equal(t, float64(100), records[0].Latency)
+	assert.True(t, records[0].Success)
+	assert.Equal(t, "login & redirect", records[1].Label)
+	assert.False(t, records[1].Success)
+	assert.Equal(t, "Test failed: text expected to contain <welcome>", records[1].FailureMessage)
+	assert.Equal(t, "checkout", records[2].Label)
+	assert.True(t, records[2].Transaction)
+	assert.Equal(t, float64(350), records[2].Latency)
+}
+
+func TestNewResultParserInvalidColumns(t *testing.T) {
+	_, err := NewResultParser([]string{"timeStamp", "label"})
+	assert.Error(t, err)
+}
+
+func TestResultParserResumesFromHeader(t *testing.T) {
+	// A file read from an offset is parsed with its header first, the lines in between are skipped
+	p, err := NewResultParser(nil)
+	assert.Nil(t, err)
+	records := parseResultLines(t, p, []string{
+		"label,Latency,responseCode,success",
+		"search,120,500,false",
+	})
+	assert.Len(t, records, 1)
+	assert.Equal(t, "search", records[0].Label)
+	assert.Equal(t, float64(120), records[0].Latency)
+	assert.Equal(t, "500", records[0].ResponseCode)
+	assert.False(t, records[0].Success)
+}
+
+func TestResultGapJSON(t *testing.T) {
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	b, err := json.Marshal(&ResultGap{Start: start, End: start.Add(time.Minute), Reason: GapReasonAgentRestarted})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"start":"2026-10-16T10:00:00Z","end":"2026-10-16T10:01:00Z","reason":"agent restarted"}`, string(b))
+}
@@ -0,0 +1,15 @@
+package model
+
+// EngineSeed is the seed of an engine of a plan, derived from the seed of the run. The engines draw different values
+// from each other, and the same ones every time the run is replayed with its seed.
+func EngineSeed(seed, planID int64, engineID int) int64 {
+	return int64(mix64(mix64(uint64(seed)^uint64(planID)) ^ uint64(engineID)))
+}
+
+// mix64 is the finalizer of splitmix64, the close inputs give unrelated outputs
+func mix64(z uint64) uint64 {
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineSeed(t *testing.T) {
+	assert.Equal(t, EngineSeed(42, 7, 0), EngineSeed(42, 7, 0))
+	seeds := map[int64]bool{}
+	for _, s := range []int64{
+		EngineSeed(42, 7, 0), EngineSeed(42, 7, 1), EngineSeed(42, 8, 0), EngineSeed(43, 7, 0), EngineSeed(0, 0, 0),
+	} {
+		seeds[s] = true
+	}
+	assert.Len(t, seeds, 5)
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"compress/gzip"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ResultSegmentRequest is what the controller sends to the engines at the checkpoints of the soak runs, for them to
+// upload the samples they read since the previous checkpoint
+type ResultSegmentRequest struct {
+	// Name of the segment in the storage
+	Filename string `json:"filename"`
+	// Signed url the engine uploads the segment to. The engine uploads it to the storage when it's empty
+	UploadURL string `json:"upload_url,omitempty"`
+	// Region of the storage the engine uploads the segment to when there is no signed url
+	Region string `json:"region,omitempty"`
+}
+
+// ResultSegmentWriter keeps the samples of an engine on disk until they are uploaded, as a gzipped JTL file with the
+// default columns. The result files of jmeter are not rotated, jmeter keeps them open for the whole run.
+type ResultSegmentWriter struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	gz      *gzip.Writer
+	samples int
+}
+
+func NewResultSegmentWriter(path string) (*ResultSegmentWriter, error) {
+	w := &ResultSegmentWriter{path: path}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *ResultSegmentWriter) open() error {
+	f, err := os.Create(w.path)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.gz = gzip.NewWriter(f)
+	w.samples = 0
+	_, err = w.gz.Write([]byte(strings.Join(DefaultJTLColumns, JTLSeparator) + "\n"))
+	return err
+}
+
+// Write adds a sample, a line with the default columns
+func (w *ResultSegmentWriter) Write(line string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.gz.Write([]byte(line + "\n")); err != nil {
+		return err
+	}
+	w.samples++
+	return nil
+}
+
+func (w *ResultSegmentWriter) close() error {
+	if err := w.gz.Close(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+// Rotate ends the segment and returns its content and the number of its samples. The next samples go to a new one.
+func (w *ResultSegmentWriter) Rotate() ([]byte, int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.close(); err != nil {
+		return nil, 0, err
+	}
+	content, err := os.ReadFile(w.path)
+	samples := w.samples
+	if openErr := w.open(); openErr != nil && err == nil {
+		err = openErr
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return content, samples, nil
+}
+
+// Close ends the segment and removes it, the samples not uploaded yet are lost
+func (w *ResultSegmentWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.close(); err != nil {
+		return err
+	}
+	return os.Remove(w.path)
+}
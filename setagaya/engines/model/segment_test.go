@@ -0,0 +1,45 @@
+package model
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gunzip(t *testing.T, content []byte) []string {
+	r, err := gzip.NewReader(bytes.NewReader(content))
+	assert.NoError(t, err)
+	b, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestResultSegmentWriter(t *testing.T) {
+	w, err := NewResultSegmentWriter(filepath.Join(t.TempDir(), "segment.jtl.gz"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write("1|2"))
+	assert.NoError(t, w.Write("3|4"))
+
+	content, samples, err := w.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, samples)
+	lines := gunzip(t, content)
+	assert.Equal(t, []string{strings.Join(DefaultJTLColumns, JTLSeparator), "1|2", "3|4"}, lines)
+
+	// The next segment only has the samples written after the rotation
+	assert.NoError(t, w.Write("5|6"))
+	content, samples, err = w.Rotate()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, samples)
+	assert.Equal(t, "5|6", gunzip(t, content)[1])
+
+	_, samples, err = w.Rotate()
+	assert.NoError(t, err)
+	assert.Zero(t, samples)
+	assert.NoError(t, w.Close())
+}
@@ -0,0 +1,201 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Significance tells whether the latency difference between two runs is real or just noise.
+// Differences are target minus base, so a positive difference means the target run is slower.
+type Significance struct {
+	Confidence float64 `json:"confidence"`
+	MeanDiff   float64 `json:"mean_diff"`
+	// Confidence interval of MeanDiff
+	MeanDiffLower float64 `json:"mean_diff_lower"`
+	MeanDiffUpper float64 `json:"mean_diff_upper"`
+	// Two sided p-values of Welch's t-test and the Mann-Whitney U test
+	TTestP       float64 `json:"t_test_p"`
+	MannWhitneyP float64 `json:"mann_whitney_p"`
+	// Latency distributions are rarely normal, so we only call a difference significant
+	// when both tests agree
+	Significant bool `json:"significant"`
+}
+
+// Variance is estimated from the bucket mid points as the digest does not keep the raw samples
+func (h *LatencyHistogram) Variance() float64 {
+	if h.Total < 2 {
+		return 0
+	}
+	mean := h.Mean()
+	var ss float64
+	for idx, count := range h.Counts {
+		v := math.Min(math.Max(bucketValue(idx), h.Min), h.Max)
+		ss += float64(count) * (v - mean) * (v - mean)
+	}
+	return ss / float64(h.Total-1)
+}
+
+// CompareLatencies runs the significance tests of target against base at the given confidence level, e.g. 0.95
+func CompareLatencies(base, target *LatencyHistogram, confidence float64) (*Significance, error) {
+	if base == nil || target == nil || base.Total < 2 || target.Total < 2 {
+		return nil, errors.New("both runs need at least two samples to be compared")
+	}
+	if confidence <= 0 || confidence >= 1 {
+		return nil, errors.New("confidence should be between 0 and 1")
+	}
+	s := &Significance{
+		Confidence: confidence,
+		MeanDiff:   target.Mean() - base.Mean(),
+	}
+	var margin float64
+	s.TTestP, margin = welchTTest(base, target, confidence)
+	s.MeanDiffLower = s.MeanDiff - margin
+	s.MeanDiffUpper = s.MeanDiff + margin
+	s.MannWhitneyP = mannWhitneyU(base, target)
+	alpha := 1 - confidence
+	s.Significant = s.TTestP < alpha && s.MannWhitneyP < alpha
+	return s, nil
+}
+
+// welchTTest returns the two sided p-value and the margin of the confidence interval of the mean difference
+func welchTTest(a, b *LatencyHistogram, confidence float64) (float64, float64) {
+	na, nb := float64(a.Total), float64(b.Total)
+	va, vb := a.Variance()/na, b.Variance()/nb
+	se := math.Sqrt(va + vb)
+	diff := b.Mean() - a.Mean()
+	if se == 0 {
+		if diff == 0 {
+			return 1, 0
+		}
+		return 0, 0
+	}
+	df := (va + vb) * (va + vb) / (va*va/(na-1) + vb*vb/(nb-1))
+	t := diff / se
+	return studentTwoSidedP(t, df), studentCritical(confidence, df) * se
+}
+
+// mannWhitneyU returns the two sided p-value of the Mann-Whitney U test using the normal approximation.
+// Samples in the same bucket are treated as ties.
+func mannWhitneyU(a, b *LatencyHistogram) float64 {
+	indexes := map[int]bool{}
+	for idx := range a.Counts {
+		indexes[idx] = true
+	}
+	for idx := range b.Counts {
+		indexes[idx] = true
+	}
+	sorted := make([]int, 0, len(indexes))
+	for idx := range indexes {
+		sorted = append(sorted, idx)
+	}
+	sort.Ints(sorted)
+
+	na, nb := float64(a.Total), float64(b.Total)
+	n := na + nb
+	var seen, rankSumB, ties float64
+	for _, idx := range sorted {
+		ca, cb := float64(a.Counts[idx]), float64(b.Counts[idx])
+		t := ca + cb
+		avgRank := seen + (t+1)/2
+		rankSumB += cb * avgRank
+		ties += t*t*t - t
+		seen += t
+	}
+	u := rankSumB - nb*(nb+1)/2
+	mu := na * nb / 2
+	sigma := math.Sqrt(na * nb / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return 1
+	}
+	// continuity correction
+	z := math.Max(math.Abs(u-mu)-0.5, 0) / sigma
+	return math.Erfc(z / math.Sqrt2)
+}
+
+func studentTwoSidedP(t, df float64) float64 {
+	return regularizedIncompleteBeta(df/2, 0.5, df/(df+t*t))
+}
+
+// studentCritical finds t so that the two sided p-value equals 1 - confidence
+func studentCritical(confidence, df float64) float64 {
+	alpha := 1 - confidence
+	lo, hi := 0.0, 1.0
+	for studentTwoSidedP(hi, df) > alpha && hi < 1e6 {
+		hi *= 2
+	}
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if studentTwoSidedP(mid, df) > alpha {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+func regularizedIncompleteBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	bt := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return bt * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - bt*betaContinuedFraction(b, a, 1-x)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction of the incomplete beta function with the modified Lentz's method
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	qab, qap, qam := a+b, a+1, a-1
+	c := 1.0
+	d := 1 - qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		m2 := 2 * fm
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
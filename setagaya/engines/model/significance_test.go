@@ -0,0 +1,60 @@
+package model
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStudentDistribution(t *testing.T) {
+	assert.InDelta(t, 2.228, studentCritical(0.95, 10), 0.001)
+	assert.InDelta(t, 1.960, studentCritical(0.95, 100000), 0.001)
+	assert.InDelta(t, 0.0734, studentTwoSidedP(2, 10), 0.001)
+	assert.InDelta(t, 1, studentTwoSidedP(0, 10), 0.000001)
+}
+
+func makeNoisyHistogram(r *rand.Rand, mean, stddev float64, samples int) *LatencyHistogram {
+	h := NewLatencyHistogram()
+	for i := 0; i < samples; i++ {
+		h.Observe(r.NormFloat64()*stddev + mean)
+	}
+	return h
+}
+
+func TestCompareLatenciesNoise(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	base := makeNoisyHistogram(r, 200, 20, 5000)
+	target := makeNoisyHistogram(r, 200, 20, 5000)
+	s, err := CompareLatencies(base, target, 0.95)
+	assert.NoError(t, err)
+	assert.False(t, s.Significant)
+	assert.True(t, s.MeanDiffLower <= s.MeanDiff && s.MeanDiff <= s.MeanDiffUpper)
+	assert.True(t, s.MeanDiffLower < 0 && s.MeanDiffUpper > 0)
+}
+
+func TestCompareLatenciesRegression(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	base := makeNoisyHistogram(r, 200, 20, 5000)
+	target := makeNoisyHistogram(r, 220, 20, 5000)
+	s, err := CompareLatencies(base, target, 0.95)
+	assert.NoError(t, err)
+	assert.True(t, s.Significant)
+	assert.InDelta(t, 20, s.MeanDiff, 2)
+	assert.Less(t, s.TTestP, 0.001)
+	assert.Less(t, s.MannWhitneyP, 0.001)
+	assert.Greater(t, s.MeanDiffLower, float64(0))
+}
+
+func TestCompareLatenciesInvalid(t *testing.T) {
+	h := NewLatencyHistogram()
+	h.Observe(1)
+	_, err := CompareLatencies(h, h, 0.95)
+	assert.Error(t, err)
+	h.Observe(2)
+	_, err = CompareLatencies(h, h, 1.5)
+	assert.Error(t, err)
+	s, err := CompareLatencies(h, h, 0.95)
+	assert.NoError(t, err)
+	assert.False(t, s.Significant)
+}
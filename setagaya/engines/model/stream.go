@@ -0,0 +1,134 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultStreamBufferSize is how many of the latest events the agents keep for subscribers catching up
+const DefaultStreamBufferSize = 50000
+
+// StreamEventID identifies an event streamed by an agent. It's sent as the SSE id of the event, so
+// a reconnecting subscriber sends it back as the Last-Event-ID header.
+type StreamEventID struct {
+	// When the numbering started, in milliseconds. It starts over with every run and every restart of the agent
+	Epoch int64
+	// Sequence number of the event. Numbers start at 1 and have no holes, so a subscriber knows
+	// how many events it missed from the numbers it receives
+	Seq uint64
+	// Clock of the engine when the event was streamed, in milliseconds
+	Timestamp int64
+}
+
+func (id StreamEventID) String() string {
+	return fmt.Sprintf("%d:%d:%d", id.Epoch, id.Seq, id.Timestamp)
+}
+
+// Follows tells whether the event comes after the other one in the same numbering
+func (id StreamEventID) Follows(other StreamEventID) bool {
+	return id.Epoch == other.Epoch && id.Seq > other.Seq
+}
+
+// ParseStreamEventID reads the SSE id of an event, or the Last-Event-ID header sent by a reconnecting
+// subscriber. It returns false when the id is not one of an agent event.
+func ParseStreamEventID(s string) (StreamEventID, bool) {
+	var id StreamEventID
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return id, false
+	}
+	var err error
+	if id.Epoch, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+		return id, false
+	}
+	if id.Seq, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return id, false
+	}
+	if id.Timestamp, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return id, false
+	}
+	return id, true
+}
+
+// StreamEvent is a line streamed by an agent with its id
+type StreamEvent struct {
+	ID   StreamEventID
+	Data string
+}
+
+// StreamBuffer numbers the events streamed by an agent and keeps the latest ones. A subscriber
+// reconnecting with the id of the last event it received gets the events it missed, as long as
+// they are still in the buffer.
+type StreamBuffer struct {
+	events []StreamEvent
+	// Index of the oldest event
+	start   int
+	count   int
+	epoch   int64
+	lastSeq uint64
+}
+
+func NewStreamBuffer(size int) *StreamBuffer {
+	return &StreamBuffer{
+		events: make([]StreamEvent, size),
+		epoch:  time.Now().UnixMilli(),
+	}
+}
+
+// Add numbers the event and keeps it. The oldest event is dropped when the buffer is full
+func (b *StreamBuffer) Add(data string) StreamEvent {
+	b.lastSeq++
+	ev := StreamEvent{
+		ID: StreamEventID{
+			Epoch:     b.epoch,
+			Seq:       b.lastSeq,
+			Timestamp: time.Now().UnixMilli(),
+		},
+		Data: data,
+	}
+	if len(b.events) == 0 {
+		return ev
+	}
+	if b.count < len(b.events) {
+		b.events[(b.start+b.count)%len(b.events)] = ev
+		b.count++
+		return ev
+	}
+	b.events[b.start] = ev
+	b.start = (b.start + 1) % len(b.events)
+	return ev
+}
+
+// Since returns the kept events following the event. An event of another numbering was streamed
+// before the agent was restarted or before the current run, so all the kept events are returned.
+func (b *StreamBuffer) Since(id StreamEventID) []StreamEvent {
+	seq := id.Seq
+	if id.Epoch != b.epoch || seq > b.lastSeq {
+		seq = 0
+	}
+	firstSeq := b.lastSeq - uint64(b.count) + 1
+	skip := 0
+	if seq >= firstSeq {
+		skip = int(seq - firstSeq + 1)
+	}
+	events := make([]StreamEvent, 0, b.count-skip)
+	for i := skip; i < b.count; i++ {
+		events = append(events, b.events[(b.start+i)%len(b.events)])
+	}
+	return events
+}
+
+// Reset forgets the events and starts a new numbering, for a new run
+func (b *StreamBuffer) Reset() {
+	b.start = 0
+	b.count = 0
+	b.lastSeq = 0
+	epoch := time.Now().UnixMilli()
+	if epoch <= b.epoch {
+		// Resets within the same millisecond still get their own numbering
+		epoch = b.epoch + 1
+	}
+	b.epoch = epoch
+}
@@ -0,0 +1,191 @@
+package model
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// StreamBatchContentType is the content type of the stream of batches the agents serve at /stream/batches
+const StreamBatchContentType = "application/vnd.setagaya.stream-batch"
+
+const (
+	// DefaultStreamBatchSize is how many events the agents put in a batch at most
+	DefaultStreamBatchSize = 512
+	// StreamBatchInterval is how long the agents wait for a batch to fill before sending it anyway
+	StreamBatchInterval = 200 * time.Millisecond
+	// maxStreamBatchLength bounds the frames a reader accepts, so a corrupted length does not allocate gigabytes
+	maxStreamBatchLength = 64 << 20
+)
+
+// ErrStreamBatch is returned when a frame of the stream of batches cannot be read
+var ErrStreamBatch = errors.New("invalid stream batch")
+
+// AppendStreamBatch encodes the events as a frame of the stream of batches. The events must follow each other in the
+// same numbering, without holes, as the frame only carries the numbering of the first one.
+//
+// A frame is the length of its payload, then the epoch, the sequence number of the first event and the number of
+// events, then every event as the difference of its timestamp with the previous one and its data. Every number is a
+// varint.
+func AppendStreamBatch(dst []byte, events []StreamEvent) []byte {
+	if len(events) == 0 {
+		return dst
+	}
+	payload := binary.AppendVarint(nil, events[0].ID.Epoch)
+	payload = binary.AppendUvarint(payload, events[0].ID.Seq)
+	payload = binary.AppendUvarint(payload, uint64(len(events)))
+	previous := events[0].ID.Epoch
+	for _, ev := range events {
+		payload = binary.AppendVarint(payload, ev.ID.Timestamp-previous)
+		previous = ev.ID.Timestamp
+		payload = binary.AppendUvarint(payload, uint64(len(ev.Data)))
+		payload = append(payload, ev.Data...)
+	}
+	dst = binary.AppendUvarint(dst, uint64(len(payload)))
+	return append(dst, payload...)
+}
+
+// ReadStreamBatch reads the next frame of the stream of batches. It returns io.EOF when the stream ended between two
+// frames.
+func ReadStreamBatch(r *bufio.Reader) ([]StreamEvent, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxStreamBatchLength {
+		return nil, fmt.Errorf("%w: frame of %d bytes", ErrStreamBatch, length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return decodeStreamBatch(payload)
+}
+
+func decodeStreamBatch(payload []byte) ([]StreamEvent, error) {
+	var n int
+	varint := func() (int64, bool) {
+		v, read := binary.Varint(payload[n:])
+		n += max(read, 0)
+		return v, read > 0
+	}
+	uvarint := func() (uint64, bool) {
+		v, read := binary.Uvarint(payload[n:])
+		n += max(read, 0)
+		return v, read > 0
+	}
+	epoch, ok1 := varint()
+	seq, ok2 := uvarint()
+	count, ok3 := uvarint()
+	// Every event takes two bytes at least
+	if !ok1 || !ok2 || !ok3 || count > uint64(len(payload)) {
+		return nil, fmt.Errorf("%w: truncated header", ErrStreamBatch)
+	}
+	events := make([]StreamEvent, count)
+	timestamp := epoch
+	for i := range events {
+		delta, ok := varint()
+		if !ok {
+			return nil, fmt.Errorf("%w: truncated event %d", ErrStreamBatch, i)
+		}
+		size, ok := uvarint()
+		if !ok || size > uint64(len(payload)-n) {
+			return nil, fmt.Errorf("%w: truncated event %d", ErrStreamBatch, i)
+		}
+		timestamp += delta
+		events[i] = StreamEvent{
+			ID:   StreamEventID{Epoch: epoch, Seq: seq + uint64(i), Timestamp: timestamp},
+			Data: string(payload[n : n+int(size)]),
+		}
+		n += int(size)
+	}
+	if n != len(payload) {
+		return nil, fmt.Errorf("%w: %d bytes left over", ErrStreamBatch, len(payload)-n)
+	}
+	return events, nil
+}
+
+// StreamBatchWriter gathers the events of the stream into batches and writes them as frames
+type StreamBatchWriter struct {
+	w       io.Writer
+	size    int
+	pending []StreamEvent
+	buf     []byte
+}
+
+// NewStreamBatchWriter returns a writer of batches of size events at most
+func NewStreamBatchWriter(w io.Writer, size int) *StreamBatchWriter {
+	return &StreamBatchWriter{w: w, size: size, pending: make([]StreamEvent, 0, size)}
+}
+
+// Add adds the event to the batch. The pending batch is written first when the event does not follow it, e.g. after
+// the numbering started over. It returns true when the batch is full and should be written.
+func (bw *StreamBatchWriter) Add(ev StreamEvent) (full bool, err error) {
+	if n := len(bw.pending); n > 0 && (ev.ID.Epoch != bw.pending[n-1].ID.Epoch || ev.ID.Seq != bw.pending[n-1].ID.Seq+1) {
+		if err := bw.Flush(); err != nil {
+			return false, err
+		}
+	}
+	bw.pending = append(bw.pending, ev)
+	return len(bw.pending) >= bw.size, nil
+}
+
+// Pending is the number of events waiting to be written
+func (bw *StreamBatchWriter) Pending() int {
+	return len(bw.pending)
+}
+
+// Flush writes the pending events as a frame
+func (bw *StreamBatchWriter) Flush() error {
+	if len(bw.pending) == 0 {
+		return nil
+	}
+	bw.buf = AppendStreamBatch(bw.buf[:0], bw.pending)
+	bw.pending = bw.pending[:0]
+	_, err := bw.w.Write(bw.buf)
+	return err
+}
+
+// WriteStreamBatches writes the events to w in batches until the channel is closed. A batch is written when it's full
+// or when it waited for the interval, and flush is called after every batch. The events are still drained when w
+// fails, so the sender is never blocked.
+func WriteStreamBatches(w io.Writer, flush func(), events <-chan StreamEvent, size int, interval time.Duration) {
+	bw := NewStreamBatchWriter(w, size)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var err error
+	write := func() {
+		if err == nil {
+			if err = bw.Flush(); err == nil {
+				flush()
+			}
+		}
+		bw.pending = bw.pending[:0]
+	}
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				write()
+				return
+			}
+			if ev.Data == "" {
+				continue
+			}
+			full, addErr := bw.Add(ev)
+			if addErr != nil && err == nil {
+				err = addErr
+			}
+			if full {
+				write()
+			}
+		case <-ticker.C:
+			if bw.Pending() > 0 {
+				write()
+			}
+		}
+	}
+}
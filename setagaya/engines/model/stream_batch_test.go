@@ -0,0 +1,117 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStreamEvents(epoch int64, seq uint64, data ...string) []StreamEvent {
+	events := []StreamEvent{}
+	for i, d := range data {
+		events = append(events, StreamEvent{
+			ID:   StreamEventID{Epoch: epoch, Seq: seq + uint64(i), Timestamp: epoch + int64(i*7)},
+			Data: d,
+		})
+	}
+	return events
+}
+
+func TestStreamBatchRoundTrip(t *testing.T) {
+	first := testStreamEvents(1760000000000, 1, "1760000000000,120,login,200", "", "1760000000010,95,home,200")
+	second := testStreamEvents(1760000000000, 4, "1760000000020,300,checkout,500")
+	frames := AppendStreamBatch(nil, first)
+	frames = AppendStreamBatch(frames, second)
+
+	r := bufio.NewReader(bytes.NewReader(frames))
+	events, err := ReadStreamBatch(r)
+	assert.NoError(t, err)
+	assert.Equal(t, first, events)
+	events, err = ReadStreamBatch(r)
+	assert.NoError(t, err)
+	assert.Equal(t, second, events)
+	_, err = ReadStreamBatch(r)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestReadStreamBatchInvalid(t *testing.T) {
+	frame := AppendStreamBatch(nil, testStreamEvents(1760000000000, 1, "a", "b"))
+
+	// The stream is cut in the middle of a frame
+	_, err := ReadStreamBatch(bufio.NewReader(bytes.NewReader(frame[:len(frame)-1])))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// The payload has more events than it says
+	corrupted := append([]byte{}, frame...)
+	corrupted[0]++
+	corrupted = append(corrupted, 0)
+	_, err = ReadStreamBatch(bufio.NewReader(bytes.NewReader(corrupted)))
+	assert.ErrorIs(t, err, ErrStreamBatch)
+
+	_, err = ReadStreamBatch(bufio.NewReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x7f})))
+	assert.ErrorIs(t, err, ErrStreamBatch)
+}
+
+func TestStreamBatchWriter(t *testing.T) {
+	var buf bytes.Buffer
+	bw := NewStreamBatchWriter(&buf, 2)
+	events := append(testStreamEvents(1, 1, "a", "b", "c"), testStreamEvents(2, 1, "d")...)
+
+	full, err := bw.Add(events[0])
+	assert.NoError(t, err)
+	assert.False(t, full)
+	full, _ = bw.Add(events[1])
+	assert.True(t, full)
+	assert.NoError(t, bw.Flush())
+	assert.Equal(t, 0, bw.Pending())
+
+	// The numbering starts over, the pending batch is written on its own
+	bw.Add(events[2])
+	bw.Add(events[3])
+	assert.Equal(t, 1, bw.Pending())
+	assert.NoError(t, bw.Flush())
+
+	r := bufio.NewReader(&buf)
+	var read [][]StreamEvent
+	for {
+		batch, err := ReadStreamBatch(r)
+		if err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+			break
+		}
+		read = append(read, batch)
+	}
+	assert.Equal(t, [][]StreamEvent{events[:2], events[2:3], events[3:]}, read)
+}
+
+func TestWriteStreamBatches(t *testing.T) {
+	var buf bytes.Buffer
+	flushes := 0
+	events := make(chan StreamEvent)
+	done := make(chan struct{})
+	go func() {
+		WriteStreamBatches(&buf, func() { flushes++ }, events, 2, time.Hour)
+		close(done)
+	}()
+	for _, ev := range testStreamEvents(1, 1, "a", "b", "c") {
+		events <- ev
+	}
+	// Blank lines are not streamed
+	events <- StreamEvent{}
+	close(events)
+	<-done
+
+	// A full batch, then the rest when the stream ends
+	assert.Equal(t, 2, flushes)
+	r := bufio.NewReader(&buf)
+	batch, err := ReadStreamBatch(r)
+	assert.NoError(t, err)
+	assert.Len(t, batch, 2)
+	batch, err = ReadStreamBatch(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", batch[0].Data)
+}
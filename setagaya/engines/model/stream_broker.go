@@ -0,0 +1,159 @@
+package model
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// StreamBroker streams the samples read by an agent to the subscribers of its stream. The events are numbered and the
+// latest ones are kept, so a subscriber reconnecting with the id of the last event it received gets the events it
+// missed before the live ones.
+type StreamBroker struct {
+	// Samples to stream. The agents send them in the order they read them
+	Bus            chan string
+	newClients     chan *streamSubscription
+	closingClients chan chan StreamEvent
+	clients        map[chan StreamEvent]bool
+	buffer         *StreamBuffer
+	bufferLock     sync.Mutex
+	// Called with every sample before it's streamed, the agents record their metrics with it
+	observe func(line string)
+}
+
+// streamSubscription is a subscriber of the stream. A subscriber resuming the stream gets the events
+// following the last one it received before the live ones.
+type streamSubscription struct {
+	events      chan StreamEvent
+	lastEventID StreamEventID
+	resume      bool
+}
+
+// NewStreamBroker starts streaming the samples sent to the Bus of the broker. observe can be nil
+func NewStreamBroker(bufferSize int, observe func(line string)) *StreamBroker {
+	b := &StreamBroker{
+		Bus:            make(chan string),
+		newClients:     make(chan *streamSubscription),
+		closingClients: make(chan chan StreamEvent),
+		clients:        make(map[chan StreamEvent]bool),
+		buffer:         NewStreamBuffer(bufferSize),
+		observe:        observe,
+	}
+	go b.listen()
+	return b
+}
+
+// Subscribe registers a subscriber of the stream. lastEventID is the Last-Event-ID header of a subscriber reconnecting
+// after losing the stream, it's empty for a new one. The events are sent to the channel until Unsubscribe closes it.
+func (b *StreamBroker) Subscribe(lastEventID string) chan StreamEvent {
+	s := &streamSubscription{
+		events: make(chan StreamEvent),
+	}
+	s.lastEventID, s.resume = ParseStreamEventID(lastEventID)
+	b.newClients <- s
+	return s.events
+}
+
+// Unsubscribe stops sending the events to the subscriber and closes its channel
+func (b *StreamBroker) Unsubscribe(events chan StreamEvent) {
+	b.closingClients <- events
+}
+
+// Reset forgets the kept events and starts a new numbering, for a new run
+func (b *StreamBroker) Reset() {
+	b.bufferLock.Lock()
+	defer b.bufferLock.Unlock()
+	b.buffer.Reset()
+}
+
+// replay sends the buffered events the subscriber missed while it was disconnected
+func (b *StreamBroker) replay(s *streamSubscription) {
+	b.bufferLock.Lock()
+	missed := b.buffer.Since(s.lastEventID)
+	b.bufferLock.Unlock()
+	log.Printf("setagaya-agent: Replaying %d events after event %s", len(missed), s.lastEventID)
+	for _, ev := range missed {
+		s.events <- ev
+	}
+}
+
+func (b *StreamBroker) listen() {
+	for {
+		select {
+		case s := <-b.newClients:
+			b.clients[s.events] = true
+			log.Printf("setagaya-agent: Metric subscriber added. %d registered subscribers", len(b.clients))
+			if s.resume {
+				b.replay(s)
+			}
+		case s := <-b.closingClients:
+			delete(b.clients, s)
+			close(s)
+			log.Printf("setagaya-agent: Metric subscriber removed. %d registered subscribers", len(b.clients))
+		case line := <-b.Bus:
+			if line == "" {
+				// Blank lines are not numbered, the subscribers would count them as lost
+				continue
+			}
+			if b.observe != nil {
+				b.observe(line)
+			}
+			b.bufferLock.Lock()
+			ev := b.buffer.Add(line)
+			b.bufferLock.Unlock()
+			for events := range b.clients {
+				events <- ev
+			}
+		}
+	}
+}
+
+// subscribeRequest subscribes the client of the request until it goes away
+func (b *StreamBroker) subscribeRequest(r *http.Request) chan StreamEvent {
+	// Set by the subscribers reconnecting after losing the stream
+	events := b.Subscribe(r.Header.Get("Last-Event-ID"))
+	go func() {
+		<-r.Context().Done()
+		b.Unsubscribe(events)
+	}()
+	return events
+}
+
+// ServeEvents streams the samples as server sent events. The id of every event is the id of the sample
+func (b *StreamBroker) ServeEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	events := b.subscribeRequest(r)
+	// The subscriber knows it's subscribed once it gets the headers
+	flusher.Flush()
+	for ev := range events {
+		if ev.Data == "" {
+			continue
+		}
+		fmt.Fprintf(w, "id: %s\ndata: %s\n\n", ev.ID, ev.Data)
+		flusher.Flush()
+	}
+}
+
+// ServeBatches streams the same events as ServeEvents in binary batches, for the controllers of large fleets of
+// engines. The subscribers resume it the same way, with the Last-Event-ID header.
+func (b *StreamBroker) ServeBatches(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", StreamBatchContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	WriteStreamBatches(w, flusher.Flush, b.subscribeRequest(r), DefaultStreamBatchSize, StreamBatchInterval)
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveEvents(t *testing.T, events chan StreamEvent, n int) []StreamEvent {
+	received := []StreamEvent{}
+	timeout := time.After(5 * time.Second)
+	for len(received) < n {
+		select {
+		case ev := <-events:
+			received = append(received, ev)
+		case <-timeout:
+			t.Fatalf("received %d events, expected %d", len(received), n)
+		}
+	}
+	return received
+}
+
+// publish sends the lines to the broker as an agent does, the subscribers are read meanwhile
+func publish(b *StreamBroker, lines ...string) {
+	go func() {
+		for _, line := range lines {
+			b.Bus <- line
+		}
+	}()
+}
+
+func TestStreamBrokerResume(t *testing.T) {
+	observed := make(chan string, 10)
+	b := NewStreamBroker(10, func(line string) { observed <- line })
+	events := b.Subscribe("")
+	publish(b, "a", "", "b")
+	received := receiveEvents(t, events, 2)
+	assert.Equal(t, []uint64{1, 2}, streamEventSeqs(received))
+	b.Unsubscribe(events)
+	// Blank lines are neither observed nor streamed
+	assert.Equal(t, "a", <-observed)
+	assert.Equal(t, "b", <-observed)
+
+	// The subscriber reconnects with the id of the first event, it gets the events it missed first
+	b.Bus <- "c"
+	events = b.Subscribe(received[0].ID.String())
+	defer b.Unsubscribe(events)
+	resumed := receiveEvents(t, events, 2)
+	assert.Equal(t, []uint64{2, 3}, streamEventSeqs(resumed))
+	assert.Equal(t, "c", resumed[1].Data)
+
+	// A new run starts a new numbering
+	b.Reset()
+	publish(b, "d")
+	ev := receiveEvents(t, events, 1)[0]
+	assert.Equal(t, uint64(1), ev.ID.Seq)
+	assert.NotEqual(t, received[0].ID.Epoch, ev.ID.Epoch)
+}
+
+func TestStreamBrokerServeEvents(t *testing.T) {
+	b := NewStreamBroker(10, nil)
+	server := httptest.NewServer(http.HandlerFunc(b.ServeEvents))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	publish(b, "1700000000000|120|login|200|OK|Thread Group 1-1|true||512|10|20|100|5")
+	r := bufio.NewReader(resp.Body)
+	id, err := r.ReadString('\n')
+	assert.NoError(t, err)
+	data, err := r.ReadString('\n')
+	assert.NoError(t, err)
+	eventID, ok := ParseStreamEventID(strings.TrimSpace(strings.TrimPrefix(id, "id: ")))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), eventID.Seq)
+	assert.Equal(t, "data: 1700000000000|120|login|200|OK|Thread Group 1-1|true||512|10|20|100|5\n", data)
+}
+
+func TestCleanFolder(t *testing.T) {
+	folder := filepath.Join(t.TempDir(), "test-data")
+	// The folder is made when it's missing
+	assert.NoError(t, CleanFolder(folder))
+	assert.NoError(t, os.MkdirAll(filepath.Join(folder, "nested"), 0750))
+	assert.NoError(t, os.WriteFile(filepath.Join(folder, "plan.jmx"), []byte("<jmeterTestPlan/>"), 0600))
+	assert.NoError(t, CleanFolder(folder))
+	entries, err := os.ReadDir(folder)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
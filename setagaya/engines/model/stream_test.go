@@ -0,0 +1,65 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func streamEventSeqs(events []StreamEvent) []uint64 {
+	seqs := []uint64{}
+	for _, ev := range events {
+		seqs = append(seqs, ev.ID.Seq)
+	}
+	return seqs
+}
+
+func TestStreamBufferSince(t *testing.T) {
+	b := NewStreamBuffer(3)
+	first := b.Add("a")
+	second := b.Add("b")
+	assert.Equal(t, []uint64{2}, streamEventSeqs(b.Since(first.ID)))
+	assert.Empty(t, b.Since(second.ID))
+	assert.True(t, second.ID.Follows(first.ID))
+	assert.NotZero(t, second.ID.Timestamp)
+
+	// The oldest events are dropped when the buffer is full
+	for _, data := range []string{"c", "d", "e"} {
+		b.Add(data)
+	}
+	events := b.Since(first.ID)
+	assert.Equal(t, []uint64{3, 4, 5}, streamEventSeqs(events))
+	assert.Equal(t, "c", events[0].Data)
+}
+
+func TestStreamBufferOtherNumbering(t *testing.T) {
+	b := NewStreamBuffer(10)
+	first := b.Add("a")
+	b.Add("b")
+	// The subscriber saw events of the agent before it was restarted
+	assert.Equal(t, []uint64{1, 2}, streamEventSeqs(b.Since(StreamEventID{Epoch: 1, Seq: 1})))
+	assert.Equal(t, []uint64{1, 2}, streamEventSeqs(b.Since(StreamEventID{Epoch: first.ID.Epoch, Seq: 100})))
+}
+
+func TestStreamBufferReset(t *testing.T) {
+	b := NewStreamBuffer(10)
+	before := b.Add("a")
+	b.Reset()
+	assert.Empty(t, b.Since(StreamEventID{}))
+	after := b.Add("b")
+	assert.Equal(t, uint64(1), after.ID.Seq)
+	assert.NotEqual(t, before.ID.Epoch, after.ID.Epoch)
+	assert.False(t, after.ID.Follows(before.ID))
+}
+
+func TestParseStreamEventID(t *testing.T) {
+	id := StreamEventID{Epoch: 1760000000000, Seq: 42, Timestamp: 1760000000123}
+	parsed, ok := ParseStreamEventID(id.String())
+	assert.True(t, ok)
+	assert.Equal(t, id, parsed)
+
+	for _, invalid := range []string{"", "42", "1:2", "1:b:3"} {
+		_, ok = ParseStreamEventID(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
@@ -0,0 +1,56 @@
+package model
+
+const (
+	// The engine never paces below half or above three times of its share of the target.
+	// Beyond that, the target is simply not reachable with the given concurrency.
+	minThroughputFactor = 0.5
+	maxThroughputFactor = 3
+	// A single correction can at most double or halve the current pacing so the loop does not oscillate
+	maxThroughputStep = 2
+)
+
+// NextThroughput calculates the pacing(requests per second) an engine should configure in order to hold the target.
+// current is what is configured right now and achieved is what was measured over the last interval.
+// When responses slow down the engine achieves less than it is configured for, so we compensate by asking for more.
+func NextThroughput(target, current, achieved float64) float64 {
+	if target <= 0 {
+		return 0
+	}
+	if current <= 0 {
+		current = target
+	}
+	if achieved <= 0 {
+		return current
+	}
+	next := current * target / achieved
+	if next > current*maxThroughputStep {
+		next = current * maxThroughputStep
+	}
+	if next < current/maxThroughputStep {
+		next = current / maxThroughputStep
+	}
+	if next > target*maxThroughputFactor {
+		next = target * maxThroughputFactor
+	}
+	if next < target*minThroughputFactor {
+		next = target * minThroughputFactor
+	}
+	return next
+}
+
+// CapThroughput keeps the pacing of an engine under its cap, max is 0 when it's not capped. An engine without a
+// target is paced at its cap.
+func CapThroughput(rps, max float64) float64 {
+	if max > 0 && (rps <= 0 || rps > max) {
+		return max
+	}
+	return rps
+}
+
+// SplitTargetRPS distributes the total target of a plan evenly across its engines
+func SplitTargetRPS(total, engines int) float64 {
+	if total <= 0 || engines <= 0 {
+		return 0
+	}
+	return float64(total) / float64(engines)
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextThroughput(t *testing.T) {
+	testCases := []struct {
+		name     string
+		target   float64
+		current  float64
+		achieved float64
+		expected float64
+	}{
+		{"disabled", 0, 10, 10, 0},
+		{"on target", 100, 100, 100, 100},
+		{"first interval", 100, 0, 0, 100},
+		{"nothing measured", 100, 120, 0, 120},
+		{"slow responses compensated", 100, 100, 80, 125},
+		{"overshoot reduced", 100, 100, 125, 80},
+		{"step is capped", 100, 100, 10, 200},
+		{"upper bound", 100, 250, 50, 300},
+		{"lower bound", 100, 60, 200, 50},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.expected, NextThroughput(tc.target, tc.current, tc.achieved), 0.0001)
+		})
+	}
+}
+
+func TestCapThroughput(t *testing.T) {
+	assert.Equal(t, float64(0), CapThroughput(0, 0))
+	assert.Equal(t, float64(120), CapThroughput(120, 0))
+	assert.Equal(t, float64(80), CapThroughput(80, 100))
+	// The feedback loop cannot pace above the cap to compensate slow responses
+	assert.Equal(t, float64(100), CapThroughput(300, 100))
+	// Without a target, the engine is paced at its cap
+	assert.Equal(t, float64(100), CapThroughput(0, 100))
+}
+
+func TestSplitTargetRPS(t *testing.T) {
+	assert.Equal(t, float64(0), SplitTargetRPS(0, 3))
+	assert.Equal(t, float64(0), SplitTargetRPS(100, 0))
+	assert.Equal(t, float64(25), SplitTargetRPS(100, 4))
+	assert.InDelta(t, 33.333, SplitTargetRPS(100, 3), 0.001)
+}
@@ -0,0 +1,42 @@
+package model
+
+// TransactionStat holds the samples of a transaction controller
+type TransactionStat struct {
+	Histogram *LatencyHistogram `json:"histogram"`
+	Failed    uint64            `json:"failed"`
+}
+
+// TransactionStats keeps the business transactions apart from the samplers. The samples of the transaction
+// controllers would otherwise be counted twice in the run figures, once on their own and once through their children.
+type TransactionStats struct {
+	Labels map[string]*TransactionStat `json:"labels"`
+}
+
+func NewTransactionStats() *TransactionStats {
+	return &TransactionStats{Labels: map[string]*TransactionStat{}}
+}
+
+func (ts *TransactionStats) get(label string) *TransactionStat {
+	stat, ok := ts.Labels[label]
+	if !ok {
+		stat = &TransactionStat{Histogram: NewLatencyHistogram()}
+		ts.Labels[label] = stat
+	}
+	return stat
+}
+
+func (ts *TransactionStats) Observe(label string, latency float64, success bool) {
+	stat := ts.get(label)
+	stat.Histogram.Observe(latency)
+	if !success {
+		stat.Failed++
+	}
+}
+
+func (ts *TransactionStats) Merge(other *TransactionStats) {
+	for label, stat := range other.Labels {
+		s := ts.get(label)
+		s.Histogram.Merge(stat.Histogram)
+		s.Failed += stat.Failed
+	}
+}
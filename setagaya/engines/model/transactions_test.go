@@ -0,0 +1,33 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionStatsObserve(t *testing.T) {
+	ts := NewTransactionStats()
+	ts.Observe("checkout", 300, true)
+	ts.Observe("checkout", 500, false)
+	ts.Observe("login", 100, true)
+
+	checkout := ts.Labels["checkout"]
+	assert.Equal(t, uint64(2), checkout.Histogram.Total)
+	assert.Equal(t, uint64(1), checkout.Failed)
+	assert.Equal(t, uint64(1), ts.Labels["login"].Histogram.Total)
+}
+
+func TestTransactionStatsMerge(t *testing.T) {
+	a := NewTransactionStats()
+	a.Observe("checkout", 300, true)
+	b := NewTransactionStats()
+	b.Observe("checkout", 500, false)
+	b.Observe("login", 100, true)
+
+	a.Merge(b)
+	assert.Equal(t, uint64(2), a.Labels["checkout"].Histogram.Total)
+	assert.Equal(t, float64(500), a.Labels["checkout"].Histogram.Max)
+	assert.Equal(t, uint64(1), a.Labels["checkout"].Failed)
+	assert.Equal(t, uint64(1), a.Labels["login"].Histogram.Total)
+}
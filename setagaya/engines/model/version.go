@@ -0,0 +1,60 @@
+package model
+
+import (
+	"net/http"
+	"os"
+)
+
+// AgentVersion is the version of the agents, set when their images are built with
+// -ldflags "-X github.com/hveda/Setagaya/setagaya/engines/model.AgentVersion=v1.2.3"
+var AgentVersion = "dev"
+
+// ProtocolVersion is the version of the protocol between the controller and the agents, the endpoints of the agents
+// and what they exchange. It's increased by the changes the controllers or the agents built before cannot work with,
+// and MinProtocolVersion by the ones dropping the older protocols. The agents built before the handshake do not
+// report a protocol, they speak the protocol 0.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 0
+)
+
+// The headers of the response to /start with the versions of the agent and of the engine it runs, so they are kept
+// with the run
+const (
+	AgentVersionHeader  = "X-Setagaya-Agent-Version"
+	EngineVersionHeader = "X-Setagaya-Engine-Version"
+)
+
+// EngineVersion is what the /version endpoint of the agents returns. The version of the engine is read from the
+// environment of the image, JMETER_VERSION or PLAYWRIGHT_VERSION, and is empty when the image does not set it.
+type EngineVersion struct {
+	Agent         string `json:"agent"`
+	Engine        string `json:"engine"`
+	EngineVersion string `json:"engine_version"`
+	// Protocol the agent speaks, and the oldest one of the controllers it works with
+	Protocol    int `json:"protocol"`
+	MinProtocol int `json:"min_protocol"`
+}
+
+func NewEngineVersion(engine, envVar string) *EngineVersion {
+	return &EngineVersion{
+		Agent:         AgentVersion,
+		Engine:        engine,
+		EngineVersion: os.Getenv(envVar),
+		Protocol:      ProtocolVersion,
+		MinProtocol:   MinProtocolVersion,
+	}
+}
+
+// CompatibleWith tells whether the agent works with a controller speaking the protocol, and the older ones down to
+// minimum. Each side has to speak a protocol the other one still works with.
+func (ev *EngineVersion) CompatibleWith(protocol, minimum int) bool {
+	return ev.Protocol >= minimum && protocol >= ev.MinProtocol
+}
+
+func (ev *EngineVersion) SetHeaders(h http.Header) {
+	h.Set(AgentVersionHeader, ev.Agent)
+	if ev.EngineVersion != "" {
+		h.Set(EngineVersionHeader, ev.EngineVersion)
+	}
+}
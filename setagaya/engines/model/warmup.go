@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Warmup is the start of a run whose samples are left out of its summary, while the JIT compiles the code and the
+// caches fill up. They are still streamed, exported to prometheus and written to the result files.
+type Warmup struct {
+	end time.Time
+}
+
+// NewWarmup is the warm-up of the engine starting at start. No sample is left out when it lasts 0 seconds
+func NewWarmup(start time.Time, seconds int) Warmup {
+	if seconds <= 0 {
+		return Warmup{}
+	}
+	return Warmup{end: start.Add(time.Duration(seconds) * time.Second)}
+}
+
+// Excludes tells whether the sample taken at the timestamp, in milliseconds, is part of the warm-up
+func (w Warmup) Excludes(timestamp int64) bool {
+	return !w.end.IsZero() && timestamp < w.end.UnixMilli()
+}
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarmup(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	w := NewWarmup(start, 60)
+	assert.True(t, w.Excludes(start.UnixMilli()))
+	assert.True(t, w.Excludes(start.Add(59*time.Second).UnixMilli()))
+	assert.False(t, w.Excludes(start.Add(time.Minute).UnixMilli()))
+
+	none := NewWarmup(start, 0)
+	assert.False(t, none.Excludes(start.UnixMilli()))
+	assert.False(t, Warmup{}.Excludes(0))
+}
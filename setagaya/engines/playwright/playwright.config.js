@@ -0,0 +1,14 @@
+// Default config used by the setagaya agent. The number of workers, the repetitions and the
+// global timeout are passed from the plan on the command line.
+module.exports = {
+  testDir: '/test-data',
+  testMatch: /.*\.spec\.(js|ts)/,
+  fullyParallel: true,
+  retries: 0,
+  use: {
+    headless: true,
+    trace: 'off',
+    screenshot: 'off',
+    video: 'off',
+  },
+};
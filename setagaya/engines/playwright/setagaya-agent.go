@@ -0,0 +1,576 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	_ "go.uber.org/automaxprocs"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/engines/containerstats"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+	"github.com/hveda/Setagaya/setagaya/engines/runonce"
+	"github.com/hveda/Setagaya/setagaya/engines/sidecar"
+	"github.com/hveda/Setagaya/setagaya/model"
+	sos "github.com/hveda/Setagaya/setagaya/object_storage"
+	"github.com/hveda/Setagaya/setagaya/utils"
+
+	"github.com/hpcloud/tail"
+)
+
+// This agent runs Playwright scenarios instead of jmeter plans. It's experimental.
+// The setagaya reporter writes every test and every collected page timing as a JTL line, so the rest
+// of the pipeline(prometheus metrics, streaming to the controller, histograms) works as it does for jmeter.
+
+const (
+	RESULT_ROOT      = "/test-result"
+	TEST_DATA_FOLDER = "/test-data"
+	PLAYWRIGHT_HOME  = "/playwright"
+	RESULT_FILE_ENV  = "SETAGAYA_RESULT_FILE"
+	// Run parameters are exposed to the scenarios as environment variables, e.g. process.env.SETAGAYA_PARAM_host
+	PARAM_ENV_PREFIX = "SETAGAYA_PARAM_"
+	// Seed of the engine for the scenarios drawing random values, when the run is seeded
+	SEED_ENV = "SETAGAYA_SEED"
+	// Tests are repeated until the global timeout(plan duration) is reached
+	REPEAT_EACH = 100000
+)
+
+// How long the samples written last are waited for once playwright exited. The tail polls the file more often
+const tailDrainTimeout = 2 * time.Second
+
+var (
+	PLAYWRIGHT_BIN = path.Join(PLAYWRIGHT_HOME, "node_modules", ".bin", "playwright")
+	REPORTER_PATH  = path.Join(PLAYWRIGHT_HOME, "setagaya-reporter.js")
+	CONFIG_PATH    = path.Join(PLAYWRIGHT_HOME, "playwright.config.js")
+)
+
+type SetagayaWrapper struct {
+	// Streams the samples of playwright to the controller
+	stream        *enginesModel.StreamBroker
+	logCounter    int
+	pidLock       sync.RWMutex
+	handlerLock   sync.RWMutex
+	currentPid    int
+	storageClient sos.StorageInterface
+	writer        io.Writer
+	buffer        []byte
+	bufferLock    sync.RWMutex
+	runID         int
+	collectionID  string
+	planID        string
+	engineID      int
+	specFile      string
+	histogram     *enginesModel.LatencyHistogram
+	histogramLock sync.RWMutex
+	// Start of the run left out of its summary
+	warmup         enginesModel.Warmup
+	errorStats     *enginesModel.ErrorStats
+	errorStatsLock sync.RWMutex
+	assertions     *enginesModel.AssertionStats
+	assertionsLock sync.RWMutex
+	// nil when no service mesh injects its sidecar in the pod
+	sidecar *sidecar.Sidecar
+	// nil when the engine is not a job running the plan once
+	runOnce *runonce.Run
+}
+
+func NewServer() (sw *SetagayaWrapper) {
+	sw = &SetagayaWrapper{
+		storageClient: sos.Client.Storage,
+		histogram:     enginesModel.NewLatencyHistogram(),
+		errorStats:    enginesModel.NewErrorStats(),
+		assertions:    enginesModel.NewAssertionStats(),
+		sidecar:       sidecar.FromEnv(),
+	}
+	sw.stream = enginesModel.NewStreamBroker(enginesModel.DefaultStreamBufferSize, sw.makePromMetrics)
+	sw.runOnce = runonce.FromEnv(sw.exit)
+	sw.collectionID, sw.planID = os.Getenv("collection_id"), os.Getenv("plan_id")
+	sw.writer = io.MultiWriter(sw, os.Stderr)
+	// The output of playwright carries the samples, only the logs of the agent are scrubbed
+	log.SetOutput(config.ScrubSecretsWriter(sw.writer))
+	return
+}
+
+// Write keeps the output of the agent and the playwright process so it can be served by /output
+func (sw *SetagayaWrapper) Write(p []byte) (int, error) {
+	sw.bufferLock.Lock()
+	defer sw.bufferLock.Unlock()
+	sw.buffer = append(sw.buffer, p...)
+	return len(p), nil
+}
+
+// parseRawMetrics parses the JTL lines written by the setagaya reporter. The columns are the same as jmeter's
+func parseRawMetrics(rawLine string) (enginesModel.SetagayaMetric, error) {
+	record, err := enginesModel.ParseJTLLine(rawLine)
+	if err != nil {
+		return enginesModel.SetagayaMetric{}, err
+	}
+	return enginesModel.SetagayaMetric{
+		Timestamp:      record.Timestamp,
+		Threads:        record.AllThreads,
+		Label:          record.Label,
+		Status:         record.ResponseCode,
+		Message:        record.ResponseMessage,
+		Success:        record.Success,
+		FailureMessage: record.FailureMessage,
+		Latency:        record.Latency,
+		WebVital:       record.WebVital,
+		Raw:            rawLine,
+	}, nil
+}
+
+// setRegionMetric publishes the region the engine generates the traffic for, so the metrics scraped from the engine
+// can be broken down by region
+func (sw *SetagayaWrapper) setRegionMetric(region string) {
+	if region == "" {
+		return
+	}
+	config.EngineRegionGauge.WithLabelValues(sw.collectionID, sw.planID, strconv.Itoa(sw.runID),
+		strconv.Itoa(sw.engineID), region).Set(1)
+}
+
+func (sw *SetagayaWrapper) makePromMetrics(line string) {
+	metric, err := parseRawMetrics(line)
+	if err != nil {
+		return
+	}
+	collectionID := sw.collectionID
+	planID := sw.planID
+	engineID := fmt.Sprintf("%d", sw.engineID)
+	runID := fmt.Sprintf("%d", sw.runID)
+
+	if metric.WebVital {
+		// Page timings are not requests, they would skew the latency and the counts of the samples
+		config.WebVitalSummary.WithLabelValues(collectionID, metric.Label, runID).Observe(metric.Latency)
+		return
+	}
+	config.StatusCounter.WithLabelValues(collectionID, planID, runID, engineID, metric.Label, metric.Status).Inc()
+	config.CollectionLatencySummary.WithLabelValues(collectionID, runID).Observe(metric.Latency)
+	config.PlanLatencySummary.WithLabelValues(collectionID, planID, runID).Observe(metric.Latency)
+	config.LabelLatencySummary.WithLabelValues(collectionID, metric.Label, runID).Observe(metric.Latency)
+	config.ThreadsGauge.WithLabelValues(collectionID, planID, runID, engineID).Set(metric.Threads)
+	if sw.warmup.Excludes(metric.Timestamp) {
+		return
+	}
+
+	sw.histogramLock.Lock()
+	sw.histogram.Observe(metric.Latency)
+	sw.histogramLock.Unlock()
+	sw.assertionsLock.Lock()
+	sw.assertions.Observe(metric.Label, metric.FailureMessage)
+	sw.assertionsLock.Unlock()
+	if !metric.Success {
+		sw.errorStatsLock.Lock()
+		sw.errorStats.Observe(metric.Label, metric.Status, metric.ErrorMessage())
+		sw.errorStatsLock.Unlock()
+	}
+}
+
+func (sw *SetagayaWrapper) makeLogFile() string {
+	filename := fmt.Sprintf("kpi-%d.jtl", sw.logCounter)
+	return path.Join(RESULT_ROOT, filename)
+}
+
+// tailResults streams the samples playwright writes to the result file until it exited. The samples it wrote last
+// and the tail did not read yet are still streamed
+func (sw *SetagayaWrapper) tailResults(logFile string, exited <-chan struct{}) {
+	var t *tail.Tail
+	var err error
+	for {
+		t, err = tail.TailFile(logFile, tail.Config{MustExist: true, Follow: true, Poll: true})
+		if err == nil {
+			break
+		}
+		select {
+		case <-exited:
+			// Playwright exited before writing any sample
+			return
+		case <-time.After(time.Second):
+		}
+	}
+	log.Printf("setagaya-agent: Start tailing result file %s", logFile)
+	defer func() {
+		if err := t.Stop(); err != nil {
+			log.Printf("Error stopping tail: %v", err)
+		}
+	}()
+	for {
+		select {
+		case <-exited:
+			for {
+				select {
+				case line := <-t.Lines:
+					sw.stream.Bus <- line.Text
+				case <-time.After(tailDrainTimeout):
+					return
+				}
+			}
+		case line := <-t.Lines:
+			sw.stream.Bus <- line.Text
+		}
+	}
+}
+
+func (sw *SetagayaWrapper) setPid(pid int) {
+	sw.pidLock.Lock()
+	defer sw.pidLock.Unlock()
+	sw.currentPid = pid
+}
+
+func (sw *SetagayaWrapper) getPid() int {
+	sw.pidLock.RLock()
+	defer sw.pidLock.RUnlock()
+	return sw.currentPid
+}
+
+func (sw *SetagayaWrapper) stopHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+	// The controller stops the engines once it collected their results, the engines running once are done
+	defer sw.runOnce.Stopped()
+	pid := sw.getPid()
+	if pid == 0 {
+		return
+	}
+	log.Printf("setagaya-agent: Shutting down Playwright process %d", pid)
+	// Playwright spawns workers and browsers. We signal the whole process group so none of them are left behind
+	if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+		log.Printf("Error stopping Playwright process: %v", err)
+	}
+	for sw.getPid() != 0 {
+		time.Sleep(time.Second * 2)
+	}
+}
+
+func makePlaywrightArgs(specFile, concurrency, duration string) ([]string, error) {
+	workers, err := strconv.Atoi(concurrency)
+	if err != nil {
+		return nil, err
+	}
+	minutes, err := strconv.Atoi(duration)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(minutes) * time.Minute
+	return []string{"test", specFile,
+		"--config", CONFIG_PATH,
+		"--reporter", REPORTER_PATH,
+		"--workers", strconv.Itoa(workers),
+		"--repeat-each", strconv.Itoa(REPEAT_EACH),
+		"--global-timeout", strconv.FormatInt(timeout.Milliseconds(), 10),
+	}, nil
+}
+
+// runCommand starts playwright and returns its pid, with a channel closed once it exited. The pid is 0 and the channel
+// nil when it cannot be started
+func (sw *SetagayaWrapper) runCommand(edc enginesModel.EngineDataConfig) (int, <-chan struct{}) {
+	log.Printf("setagaya-agent: Start to run scenario")
+	if sw.specFile == "" {
+		log.Printf("setagaya-agent: ERROR - Playwright spec file is missing")
+		return 0, nil
+	}
+	args, err := makePlaywrightArgs(filepath.Join(TEST_DATA_FOLDER, sw.specFile), edc.Concurrency, edc.Duration)
+	if err != nil {
+		log.Println(err)
+		return 0, nil
+	}
+	// #nosec G204 - the spec file is saved by the agent and the rest of the arguments are numbers
+	cmd := exec.Command(PLAYWRIGHT_BIN, args...)
+	cmd.Dir = TEST_DATA_FOLDER
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", RESULT_FILE_ENV, sw.makeLogFile()))
+	for name, value := range edc.Parameters {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s%s=%s", PARAM_ENV_PREFIX, name, value))
+	}
+	if edc.Seed != nil {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", SEED_ENV, *edc.Seed))
+	}
+	cmd.Stdout = sw.writer
+	cmd.Stderr = sw.writer
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		log.Println(err)
+		return 0, nil
+	}
+	pid := cmd.Process.Pid
+	sw.setPid(pid)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		// Playwright exits with non zero code when any of the tests failed, which is expected in a load test
+		if err := cmd.Wait(); err != nil {
+			log.Printf("setagaya-agent: Playwright exited: %v", err)
+		}
+		log.Printf("setagaya-agent: Shutdown is finished, resetting pid to zero")
+		sw.setPid(0)
+		sw.runOnce.Finished()
+	}()
+	return pid, exited
+}
+
+func saveToDisk(filename string, file []byte) error {
+	cleanFilename := filepath.Base(filename)
+	if cleanFilename == "." || cleanFilename == ".." || strings.Contains(cleanFilename, "..") {
+		return errors.New("invalid filename")
+	}
+	return os.WriteFile(filepath.Join(TEST_DATA_FOLDER, cleanFilename), file, 0600)
+}
+
+func (sw *SetagayaWrapper) prepareTestData(edc enginesModel.EngineDataConfig) error {
+	sw.specFile = ""
+	for _, sf := range edc.EngineData {
+		file, err := enginesModel.FetchFile(sw.storageClient, sf)
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(sf.Filename) == ".csv" {
+			if file, err = utils.SplitCSV(file, sf.TotalSplits, sf.CurrentSplit); err != nil {
+				return err
+			}
+			if edc.ShuffleData && edc.Seed != nil {
+				if file, err = utils.ShuffleCSV(file, *edc.Seed); err != nil {
+					return err
+				}
+			}
+		}
+		if model.IsTestFile(sf.Filename) {
+			sw.specFile = filepath.Base(sf.Filename)
+		}
+		if err := saveToDisk(sf.Filename, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sw *SetagayaWrapper) startHandler(w http.ResponseWriter, r *http.Request) {
+	sw.handlerLock.Lock()
+	defer sw.handlerLock.Unlock()
+
+	if r.Method != http.MethodPost {
+		return
+	}
+	if sw.getPid() != 0 {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	defer r.Body.Close()
+	var edc enginesModel.EngineDataConfig
+	if err := json.NewDecoder(r.Body).Decode(&edc); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := edc.CheckNetworkShaping(); err != nil {
+		log.Printf("setagaya-agent: %v", err)
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err := sw.sidecar.WaitReady(); err != nil {
+		log.Printf("setagaya-agent: %v", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if err := enginesModel.CleanFolder(TEST_DATA_FOLDER); err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err := sw.prepareTestData(edc); err != nil {
+		if errors.Is(err, sos.FileNotFoundError()) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sw.runID = int(edc.RunID)
+	sw.engineID = edc.EngineID
+	sw.setRegionMetric(edc.Region)
+	sw.warmup = enginesModel.NewWarmup(time.Now(), edc.Warmup)
+	sw.histogramLock.Lock()
+	sw.histogram = enginesModel.NewLatencyHistogram()
+	sw.histogramLock.Unlock()
+	sw.errorStatsLock.Lock()
+	sw.errorStats = enginesModel.NewErrorStats()
+	sw.errorStatsLock.Unlock()
+	sw.assertionsLock.Lock()
+	sw.assertions = enginesModel.NewAssertionStats()
+	sw.assertionsLock.Unlock()
+	sw.stream.Reset()
+	logFile := sw.makeLogFile()
+	pid, exited := sw.runCommand(edc)
+	sw.logCounter++
+	if exited != nil {
+		go sw.tailResults(logFile, exited)
+	}
+	log.Printf("setagaya-agent: Start running Playwright process with pid: %d", pid)
+	playwrightVersion().SetHeaders(w.Header())
+	if _, err := w.Write([]byte(strconv.Itoa(pid))); err != nil {
+		log.Printf("Error writing PID response: %v", err)
+	}
+}
+
+func (sw *SetagayaWrapper) progressHandler(w http.ResponseWriter, r *http.Request) {
+	if sw.getPid() == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (sw *SetagayaWrapper) histogramHandler(w http.ResponseWriter, r *http.Request) {
+	sw.histogramLock.RLock()
+	defer sw.histogramLock.RUnlock()
+	enginesModel.WriteJSON(w, sw.histogram)
+}
+
+// errorsHandler returns the failed samples of the current run so the controller can aggregate them across engines
+func (sw *SetagayaWrapper) errorsHandler(w http.ResponseWriter, r *http.Request) {
+	sw.errorStatsLock.RLock()
+	defer sw.errorStatsLock.RUnlock()
+	enginesModel.WriteJSON(w, sw.errorStats)
+}
+
+// assertionsHandler returns the assertion results of the current run so the controller can add them to the run summary
+func (sw *SetagayaWrapper) assertionsHandler(w http.ResponseWriter, r *http.Request) {
+	sw.assertionsLock.RLock()
+	defer sw.assertionsLock.RUnlock()
+	enginesModel.WriteJSON(w, sw.assertions)
+}
+
+func (sw *SetagayaWrapper) stdoutHandler(w http.ResponseWriter, r *http.Request) {
+	sw.bufferLock.RLock()
+	defer sw.bufferLock.RUnlock()
+	if _, err := w.Write(sw.buffer); err != nil {
+		log.Printf("Error writing stdout response: %v", err)
+	}
+}
+
+func (sw *SetagayaWrapper) reportOwnMetrics(interval time.Duration) error {
+	prev := uint64(0)
+	var prevNetwork *containerstats.NetworkStats
+	engineNumber := strconv.Itoa(sw.engineID)
+	cpuFactor := containerstats.CPUFactor()
+	for {
+		time.Sleep(interval)
+		cpuUsage, err := containerstats.ReadCPUUsage()
+		if err != nil {
+			return err
+		}
+		if prev == 0 {
+			prev = cpuUsage
+			continue
+		}
+		used := (cpuUsage - prev) / uint64(interval.Seconds()) / 1000
+		prev = cpuUsage
+		memoryUsage, err := containerstats.ReadMemoryUsage()
+		if err != nil {
+			return err
+		}
+		config.CpuGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber).Set(float64(used) * cpuFactor)
+		config.MemGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber).Set(float64(memoryUsage))
+		for _, resource := range containerstats.PressureResources {
+			// The nodes running cgroup v1 do not report the pressure
+			p, err := containerstats.ReadPressure(resource)
+			if err != nil {
+				continue
+			}
+			config.PressureGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, resource, "some").Set(p.Some.Avg10)
+			if p.Full != nil {
+				config.PressureGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, resource, "full").Set(p.Full.Avg10)
+			}
+		}
+		// The network is reported on a best effort basis, the engine keeps running without it
+		ns, err := containerstats.ReadNetworkStats()
+		if err != nil {
+			continue
+		}
+		if prevNetwork != nil {
+			rates := ns.Rates(prevNetwork, interval)
+			config.NetworkGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "rx").Set(rates.RxBytes)
+			config.NetworkGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "tx").Set(rates.TxBytes)
+			config.TCPRetransmitsGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber).Set(rates.RetransSegs)
+		}
+		prevNetwork = ns
+		config.TCPConnectionsGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "established").
+			Set(float64(ns.Established))
+		config.TCPConnectionsGauge.WithLabelValues(sw.collectionID, sw.planID, engineNumber, "time_wait").
+			Set(float64(ns.TimeWait))
+	}
+}
+
+// quitSidecarOnTermination stops the sidecar of the service mesh along the engine, the pod would not terminate
+// while the sidecar runs
+func (sw *SetagayaWrapper) quitSidecarOnTermination() {
+	if sw.sidecar == nil {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	<-signals
+	sw.exit()
+}
+
+// exit stops the sidecar along the engine and exits
+func (sw *SetagayaWrapper) exit() {
+	if err := sw.sidecar.Quit(); err != nil {
+		log.Printf("setagaya-agent: Cannot stop the sidecar: %v", err)
+	}
+	os.Exit(0)
+}
+
+func playwrightVersion() *enginesModel.EngineVersion {
+	return enginesModel.NewEngineVersion(model.PlaywrightEngine, "PLAYWRIGHT_VERSION")
+}
+
+// versionHandler returns the versions of the agent and of Playwright
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	enginesModel.WriteJSON(w, playwrightVersion())
+}
+
+func main() {
+	sw := NewServer()
+	go func() {
+		if err := sw.reportOwnMetrics(5 * time.Second); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	go sw.quitSidecarOnTermination()
+	http.HandleFunc("/start", sw.startHandler)
+	http.HandleFunc("/stop", sw.stopHandler)
+	http.HandleFunc("/stream", sw.stream.ServeEvents)
+	http.HandleFunc("/stream/batches", sw.stream.ServeBatches)
+	http.HandleFunc("/progress", sw.progressHandler)
+	http.HandleFunc("/output", sw.stdoutHandler)
+	http.HandleFunc("/histogram", sw.histogramHandler)
+	http.HandleFunc("/errors", sw.errorsHandler)
+	http.HandleFunc("/assertions", sw.assertionsHandler)
+	http.HandleFunc("/version", versionHandler)
+	http.HandleFunc("/metrics", promhttp.Handler().ServeHTTP)
+
+	server := &http.Server{
+		Addr:           ":8080",
+		ReadTimeout:    30 * time.Second,
+		WriteTimeout:   30 * time.Second,
+		IdleTimeout:    120 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+	log.Fatal(server.ListenAndServe())
+}
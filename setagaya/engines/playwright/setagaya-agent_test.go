@@ -0,0 +1,239 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+// Calls the setagaya reporter the way playwright does, with a passed and a failed test. The passed test has page
+// timings attached by the setagaya fixture
+const reporterScript = `
+const Reporter = require(process.argv[1]);
+const reporter = new Reporter();
+reporter.onBegin({ workers: 2 });
+const startTime = new Date(1700000000000);
+const timings = { ttfb: 120.4, lcp: 1830, cls: 0.12, fcp: undefined };
+reporter.onTestEnd({ title: 'checkout' }, {
+  workerIndex: 0, startTime, status: 'passed', duration: 2100,
+  attachments: [{ name: 'setagaya-timings', body: Buffer.from(JSON.stringify(timings)) }],
+});
+reporter.onTestEnd({ title: 'login' }, {
+  workerIndex: 1, startTime, status: 'failed', duration: 900,
+  error: { message: 'expect(received).toBeVisible()' }, attachments: [],
+});
+reporter.onEnd();
+`
+
+// Every wrapper serves its own run, the prometheus metrics are kept across the tests
+var lastTestRunID int
+
+func newTestWrapper() *SetagayaWrapper {
+	lastTestRunID++
+	sw := &SetagayaWrapper{
+		histogram:    enginesModel.NewLatencyHistogram(),
+		errorStats:   enginesModel.NewErrorStats(),
+		assertions:   enginesModel.NewAssertionStats(),
+		collectionID: "1",
+		planID:       "1",
+		runID:        lastTestRunID,
+	}
+	sw.stream = enginesModel.NewStreamBroker(enginesModel.DefaultStreamBufferSize, sw.makePromMetrics)
+	return sw
+}
+
+// runReporter returns the lines the setagaya reporter writes for reporterScript
+func runReporter(t *testing.T) []string {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+	resultFile := filepath.Join(t.TempDir(), "kpi-0.jtl")
+	reporter, err := filepath.Abs("setagaya-reporter.js")
+	assert.NoError(t, err)
+	cmd := exec.Command(node, "-e", reporterScript, reporter)
+	cmd.Env = append(os.Environ(), RESULT_FILE_ENV+"="+resultFile)
+	out, err := cmd.CombinedOutput()
+	if !assert.NoError(t, err, string(out)) {
+		t.FailNow()
+	}
+	content, err := os.ReadFile(resultFile)
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestParseRawMetrics(t *testing.T) {
+	metric, err := parseRawMetrics("1700000000000|900|login|500|expect(received).toBeVisible()|worker 1|false|" +
+		"expect(received).toBeVisible()|0|2|2|900|0")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1700000000000), metric.Timestamp)
+	assert.Equal(t, "login", metric.Label)
+	assert.Equal(t, "500", metric.Status)
+	assert.False(t, metric.Success)
+	assert.Equal(t, "expect(received).toBeVisible()", metric.ErrorMessage())
+	assert.Equal(t, float64(900), metric.Latency)
+	assert.Equal(t, float64(2), metric.Threads)
+	assert.False(t, metric.WebVital)
+
+	metric, err = parseRawMetrics("1700000000000|1830|checkout:lcp|200|Web vital|worker 0|true||0|2|2|1830|0")
+	assert.NoError(t, err)
+	assert.True(t, metric.WebVital)
+
+	_, err = parseRawMetrics("not a sample")
+	assert.Error(t, err)
+}
+
+func TestReporterLines(t *testing.T) {
+	lines := runReporter(t)
+	metrics := []enginesModel.SetagayaMetric{}
+	for _, line := range lines {
+		metric, err := parseRawMetrics(line)
+		if assert.NoError(t, err, line) {
+			metrics = append(metrics, metric)
+		}
+	}
+	// The test, its timings but the missing one, then the failed test
+	if !assert.Len(t, metrics, 5) {
+		t.FailNow()
+	}
+	assert.Equal(t, "checkout", metrics[0].Label)
+	assert.Equal(t, float64(2100), metrics[0].Latency)
+	assert.False(t, metrics[0].WebVital)
+	vitals := map[string]float64{}
+	for _, m := range metrics[1:4] {
+		assert.True(t, m.WebVital, m.Raw)
+		assert.True(t, m.Success)
+		vitals[m.Label] = m.Latency
+	}
+	// CLS is a score, it's scaled to be meaningful as an integer
+	assert.Equal(t, map[string]float64{"checkout:ttfb": 120, "checkout:lcp": 1830, "checkout:cls": 120}, vitals)
+	assert.Equal(t, "login", metrics[4].Label)
+	assert.False(t, metrics[4].Success)
+	assert.Equal(t, "expect(received).toBeVisible()", metrics[4].FailureMessage)
+	assert.Equal(t, float64(2), metrics[4].Threads)
+}
+
+func TestMakePromMetricsWebVitals(t *testing.T) {
+	sw := newTestWrapper()
+	vitalSeries := testutil.CollectAndCount(config.WebVitalSummary)
+	events := sw.stream.Subscribe("")
+	defer sw.stream.Unsubscribe(events)
+	lines := runReporter(t)
+	go func() {
+		for _, line := range lines {
+			sw.stream.Bus <- line
+		}
+	}()
+	// Every line is streamed to the controller, the web vitals included
+	for range lines {
+		select {
+		case <-events:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the samples were not streamed")
+		}
+	}
+
+	// Only the tests are samples of the run
+	sw.histogramLock.RLock()
+	assert.Equal(t, uint64(2), sw.histogram.Total)
+	assert.Equal(t, float64(2100), sw.histogram.Max)
+	sw.histogramLock.RUnlock()
+	sw.assertionsLock.RLock()
+	assert.ElementsMatch(t, []string{"checkout", "login"}, assertionLabels(sw.assertions))
+	sw.assertionsLock.RUnlock()
+	runID := strconv.Itoa(sw.runID)
+	assert.Equal(t, float64(1), testutil.ToFloat64(config.StatusCounter.WithLabelValues("1", "1", runID, "0", "checkout", "200")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(config.StatusCounter.WithLabelValues("1", "1", runID, "0", "checkout:lcp", "200")))
+	// The web vitals have their own summary
+	assert.Equal(t, vitalSeries+3, testutil.CollectAndCount(config.WebVitalSummary))
+}
+
+func assertionLabels(as *enginesModel.AssertionStats) []string {
+	labels := []string{}
+	for label := range as.Labels {
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+func TestMakePlaywrightArgs(t *testing.T) {
+	args, err := makePlaywrightArgs("/test-data/checkout.spec.js", "4", "5")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test", "/test-data/checkout.spec.js",
+		"--config", CONFIG_PATH,
+		"--reporter", REPORTER_PATH,
+		"--workers", "4",
+		"--repeat-each", "100000",
+		"--global-timeout", "300000",
+	}, args)
+
+	_, err = makePlaywrightArgs("/test-data/checkout.spec.js", "four", "5")
+	assert.Error(t, err)
+	_, err = makePlaywrightArgs("/test-data/checkout.spec.js", "4", "")
+	assert.Error(t, err)
+}
+
+func TestSetRegionMetric(t *testing.T) {
+	sw := newTestWrapper()
+	sw.engineID = 2
+	runID := strconv.Itoa(sw.runID)
+	series := testutil.CollectAndCount(config.EngineRegionGauge)
+	sw.setRegionMetric("")
+	assert.Equal(t, series, testutil.CollectAndCount(config.EngineRegionGauge))
+
+	sw.setRegionMetric("asia")
+	assert.Equal(t, float64(1), testutil.ToFloat64(config.EngineRegionGauge.WithLabelValues("1", "1", runID, "2", "asia")))
+}
+
+// The tail stops once playwright exited on its own, after streaming the samples it wrote last
+func TestTailResultsStopsWhenPlaywrightExits(t *testing.T) {
+	sw := newTestWrapper()
+	events := sw.stream.Subscribe("")
+	defer sw.stream.Unsubscribe(events)
+	lines := runReporter(t)
+	resultFile := filepath.Join(t.TempDir(), "kpi-0.jtl")
+	assert.NoError(t, os.WriteFile(resultFile, nil, 0o600))
+
+	exited := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		sw.tailResults(resultFile, exited)
+		close(stopped)
+	}()
+	assert.NoError(t, os.WriteFile(resultFile, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+	close(exited)
+	for range lines {
+		select {
+		case <-events:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the samples were not streamed")
+		}
+	}
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tail was not stopped")
+	}
+
+	// Playwright can exit before writing any sample
+	stopped = make(chan struct{})
+	go func() {
+		sw.tailResults(filepath.Join(t.TempDir(), "kpi-1.jtl"), exited)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the tail was not stopped")
+	}
+}
@@ -0,0 +1,57 @@
+// Scenarios import `test` from this module instead of @playwright/test to report page timings.
+//
+//   const { test, expect } = require('/playwright/setagaya-fixture');
+//
+// After every test, navigation timings and core web vitals of the last loaded page are attached
+// to the result and picked up by the setagaya reporter.
+const base = require('@playwright/test');
+
+const observeVitals = () => {
+  window.__setagayaVitals = { lcp: 0, cls: 0 };
+  new PerformanceObserver((list) => {
+    const entries = list.getEntries();
+    window.__setagayaVitals.lcp = entries[entries.length - 1].startTime;
+  }).observe({ type: 'largest-contentful-paint', buffered: true });
+  new PerformanceObserver((list) => {
+    for (const entry of list.getEntries()) {
+      if (!entry.hadRecentInput) {
+        window.__setagayaVitals.cls += entry.value;
+      }
+    }
+  }).observe({ type: 'layout-shift', buffered: true });
+};
+
+const collectTimings = () => {
+  const nav = performance.getEntriesByType('navigation')[0];
+  const paint = performance.getEntriesByName('first-contentful-paint')[0];
+  const vitals = window.__setagayaVitals || {};
+  if (!nav) {
+    return {};
+  }
+  return {
+    ttfb: nav.responseStart - nav.requestStart,
+    dom_content_loaded: nav.domContentLoadedEventEnd - nav.startTime,
+    load: nav.loadEventEnd - nav.startTime,
+    fcp: paint ? paint.startTime : undefined,
+    lcp: vitals.lcp || undefined,
+    cls: vitals.cls,
+  };
+};
+
+const test = base.test.extend({
+  page: async ({ page }, use, testInfo) => {
+    await page.addInitScript(observeVitals);
+    await use(page);
+    try {
+      const timings = await page.evaluate(collectTimings);
+      await testInfo.attach('setagaya-timings', {
+        body: JSON.stringify(timings),
+        contentType: 'application/json',
+      });
+    } catch (e) {
+      // The page could be closed already. We still have the duration of the test itself
+    }
+  },
+});
+
+module.exports = { ...base, test };
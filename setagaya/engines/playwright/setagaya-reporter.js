@@ -0,0 +1,64 @@
+// Playwright reporter writing results in the jmeter JTL format used by setagaya:
+// timeStamp|elapsed|label|responseCode|responseMessage|threadName|success|failureMessage|bytes|grpThreads|allThreads|Latency|Connect
+// Failed expect() calls are the assertions of playwright tests, their message is reported as the failure message.
+// Every test is reported with its title as the label. Page timings attached by the setagaya fixture
+// are reported as extra samples labelled "<test title>:<timing>", e.g. "checkout:lcp". Their response message is
+// WEB_VITAL_MESSAGE so they are kept out of the latency and the counts of the requests.
+const fs = require('fs');
+
+const TIMINGS_ATTACHMENT = 'setagaya-timings';
+const ASSERTION_ERROR = /expect\(/;
+const WEB_VITAL_MESSAGE = 'Web vital';
+
+function clean(value) {
+  // "|" is the column separator, it cannot appear in the values
+  return String(value).replace(/[|\r\n]/g, ' ');
+}
+
+class SetagayaReporter {
+  constructor() {
+    this.out = fs.createWriteStream(process.env.SETAGAYA_RESULT_FILE || '/test-result/kpi-0.jtl', { flags: 'a' });
+    this.workers = 0;
+  }
+
+  onBegin(config) {
+    this.workers = config.workers;
+  }
+
+  write(timestamp, elapsed, label, code, message, worker, success, failureMessage = '') {
+    const line = [timestamp, Math.round(elapsed), clean(label), code, clean(message), worker,
+      success, clean(failureMessage), 0, this.workers, this.workers, Math.round(elapsed), 0];
+    this.out.write(line.join('|') + '\n');
+  }
+
+  onTestEnd(test, result) {
+    const label = test.title;
+    const worker = `worker ${result.workerIndex}`;
+    const timestamp = result.startTime.getTime();
+    const passed = result.status === 'passed';
+    const message = passed ? 'OK' : (result.error && result.error.message) || result.status;
+    const failureMessage = !passed && result.error && ASSERTION_ERROR.test(message) ? message : '';
+    this.write(timestamp, result.duration, label, passed ? 200 : 500, message, worker, passed, failureMessage);
+
+    for (const attachment of result.attachments) {
+      if (attachment.name !== TIMINGS_ATTACHMENT || !attachment.body) {
+        continue;
+      }
+      const timings = JSON.parse(attachment.body.toString());
+      for (const [name, value] of Object.entries(timings)) {
+        if (typeof value !== 'number' || Number.isNaN(value)) {
+          continue;
+        }
+        // CLS is a score rather than a duration. We scale it so it's still meaningful as an integer
+        const elapsed = name === 'cls' ? value * 1000 : value;
+        this.write(timestamp, elapsed, `${label}:${name}`, 200, WEB_VITAL_MESSAGE, worker, true);
+      }
+    }
+  }
+
+  onEnd() {
+    return new Promise((resolve) => this.out.end(resolve));
+  }
+}
+
+module.exports = SetagayaReporter;
@@ -0,0 +1,75 @@
+// Package runonce lets the engines run as the pods of a kubernetes job. Such an engine serves a single run: it
+// exits once the controller collected its results and stopped it, so the job completes. The scheduler tells the
+// engines they run once in their environment.
+package runonce
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Set to true when the engine runs once
+	Env = "SETAGAYA_RUN_ONCE"
+	// Seconds a finished engine waits for the controller to collect its results before it exits anyway
+	LingerEnv = "SETAGAYA_RUN_ONCE_LINGER"
+
+	defaultLinger = 15 * time.Minute
+	// Leaves the time to the response of the stop request to be sent
+	exitDelay = time.Second
+)
+
+type Run struct {
+	linger    time.Duration
+	exitDelay time.Duration
+	exit      func()
+	once      sync.Once
+	mu        sync.Mutex
+	timer     *time.Timer
+}
+
+// FromEnv returns the run of the engine, nil when the engine is not running once. All the methods can be called on
+// nil. exit is called once, when the engine should exit.
+func FromEnv(exit func()) *Run {
+	if ok, _ := strconv.ParseBool(os.Getenv(Env)); !ok {
+		return nil
+	}
+	linger := defaultLinger
+	if seconds, err := strconv.Atoi(os.Getenv(LingerEnv)); err == nil && seconds > 0 {
+		linger = time.Duration(seconds) * time.Second
+	}
+	return &Run{linger: linger, exitDelay: exitDelay, exit: exit}
+}
+
+func (r *Run) exitAfter(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.timer != nil && d >= r.linger {
+		return
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timer = time.AfterFunc(d, func() {
+		r.once.Do(r.exit)
+	})
+}
+
+// Finished is called when the plan finished by itself. The engine keeps its results until the controller collects
+// them, the other engines of the collection can still be running, but it does not wait for longer than the linger.
+func (r *Run) Finished() {
+	if r == nil {
+		return
+	}
+	r.exitAfter(r.linger)
+}
+
+// Stopped is called when the controller stopped the engine, after it collected the results. The engine exits.
+func (r *Run) Stopped() {
+	if r == nil {
+		return
+	}
+	r.exitAfter(r.exitDelay)
+}
@@ -0,0 +1,53 @@
+package runonce
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromEnv(t *testing.T) {
+	exit := func() {}
+	t.Setenv(Env, "")
+	assert.Nil(t, FromEnv(exit))
+	t.Setenv(Env, "false")
+	assert.Nil(t, FromEnv(exit))
+
+	t.Setenv(Env, "true")
+	t.Setenv(LingerEnv, "60")
+	r := FromEnv(exit)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, time.Minute, r.linger)
+	}
+	t.Setenv(LingerEnv, "later")
+	assert.Equal(t, defaultLinger, FromEnv(exit).linger)
+
+	// The engines not running once ignore the calls
+	var none *Run
+	none.Finished()
+	none.Stopped()
+}
+
+func TestRunExits(t *testing.T) {
+	var exits atomic.Int32
+	r := &Run{linger: time.Hour, exitDelay: time.Millisecond, exit: func() { exits.Add(1) }}
+	r.Finished()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(0), exits.Load())
+
+	// The results were collected, the engine does not wait for the rest of the linger
+	r.Stopped()
+	r.Stopped()
+	assert.Eventually(t, func() bool { return exits.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), exits.Load())
+}
+
+func TestRunLingers(t *testing.T) {
+	var exits atomic.Int32
+	r := &Run{linger: 10 * time.Millisecond, exitDelay: time.Millisecond, exit: func() { exits.Add(1) }}
+	r.Finished()
+	assert.Eventually(t, func() bool { return exits.Load() == 1 }, time.Second, time.Millisecond)
+}
@@ -0,0 +1,90 @@
+// Package sidecar lets the engines work along the sidecar a service mesh injects in their pods. The scheduler
+// passes the endpoints of the sidecar in the environment of the engines.
+package sidecar
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// Answers 200 once the sidecar proxies the traffic
+	ReadyURLEnv = "SIDECAR_READY_URL"
+	// Stops the sidecar when it's posted to
+	QuitURLEnv = "SIDECAR_QUIT_URL"
+	// Seconds to wait for the sidecar to be ready
+	ReadyTimeoutEnv = "SIDECAR_READY_TIMEOUT"
+
+	defaultReadyTimeout = time.Minute
+	readyPollInterval   = time.Second
+)
+
+type Sidecar struct {
+	client       *http.Client
+	readyURL     string
+	quitURL      string
+	readyTimeout time.Duration
+	pollInterval time.Duration
+}
+
+// FromEnv returns the sidecar of the pod, nil when there is none. All the methods can be called on nil.
+func FromEnv() *Sidecar {
+	readyURL := os.Getenv(ReadyURLEnv)
+	quitURL := os.Getenv(QuitURLEnv)
+	if readyURL == "" && quitURL == "" {
+		return nil
+	}
+	timeout := defaultReadyTimeout
+	if seconds, err := strconv.Atoi(os.Getenv(ReadyTimeoutEnv)); err == nil && seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+	return &Sidecar{
+		client:       &http.Client{Timeout: 5 * time.Second},
+		readyURL:     readyURL,
+		quitURL:      quitURL,
+		readyTimeout: timeout,
+		pollInterval: readyPollInterval,
+	}
+}
+
+// WaitReady blocks until the sidecar is ready. The files of a run cannot be downloaded before, as the sidecar
+// proxies all the outbound traffic of the pod.
+func (s *Sidecar) WaitReady() error {
+	if s == nil || s.readyURL == "" {
+		return nil
+	}
+	deadline := time.Now().Add(s.readyTimeout)
+	for {
+		resp, err := s.client.Get(s.readyURL)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("sidecar responded with %d", resp.StatusCode)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("sidecar is not ready after %s: %w", s.readyTimeout, err)
+		}
+		time.Sleep(s.pollInterval)
+	}
+}
+
+// Quit stops the sidecar, so the pod terminates once the engine is done
+func (s *Sidecar) Quit() error {
+	if s == nil || s.quitURL == "" {
+		return nil
+	}
+	resp, err := s.client.Post(s.quitURL, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("sidecar responded with %d to the quit request", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package sidecar
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(ReadyURLEnv, "")
+	t.Setenv(QuitURLEnv, "")
+	assert.Nil(t, FromEnv())
+
+	t.Setenv(ReadyURLEnv, "http://localhost:15021/healthz/ready")
+	t.Setenv(ReadyTimeoutEnv, "30")
+	s := FromEnv()
+	assert.NotNil(t, s)
+	assert.Equal(t, 30*time.Second, s.readyTimeout)
+
+	t.Setenv(ReadyTimeoutEnv, "soon")
+	assert.Equal(t, defaultReadyTimeout, FromEnv().readyTimeout)
+}
+
+func TestWaitReady(t *testing.T) {
+	var polls atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if polls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	s := &Sidecar{client: ts.Client(), readyURL: ts.URL, readyTimeout: time.Second, pollInterval: time.Millisecond}
+	assert.NoError(t, s.WaitReady())
+	assert.Equal(t, int32(3), polls.Load())
+
+	polls.Store(-1000)
+	s.readyTimeout = 10 * time.Millisecond
+	assert.Error(t, s.WaitReady())
+
+	var none *Sidecar
+	assert.NoError(t, none.WaitReady())
+	assert.NoError(t, none.Quit())
+}
+
+func TestQuit(t *testing.T) {
+	var method string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	}))
+	defer ts.Close()
+	s := &Sidecar{client: ts.Client(), quitURL: ts.URL}
+	assert.NoError(t, s.Quit())
+	assert.Equal(t, http.MethodPost, method)
+
+	s.quitURL = ts.URL + "/missing"
+	ts.Config.Handler = http.NotFoundHandler()
+	assert.Error(t, s.Quit())
+}
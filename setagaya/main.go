@@ -4,49 +4,96 @@ package main
 // Main entry point for the API server and controller
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/context"
+	gcontext "github.com/gorilla/context"
 	"github.com/julienschmidt/httprouter"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	_ "go.uber.org/automaxprocs"
 
 	"github.com/hveda/Setagaya/setagaya/api"
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/object_storage"
 	"github.com/hveda/Setagaya/setagaya/ui"
 )
 
 func main() {
-	api := api.NewAPIServer()
-	routes := api.InitRoutes()
+	// The config is loaded before the flags are parsed, it looks the flag up by itself
+	flag.Bool("local", false, "run the whole platform on this machine, with SQLite and docker")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second,
+		"how long the requests in flight are given to finish when the server stops")
+	flag.Parse()
+	apiServer := api.NewAPIServer()
+	routes := apiServer.InitRoutes()
 	ui := ui.NewUI()
 	uiRoutes := ui.InitRoutes()
 	routes = append(routes, uiRoutes...)
 	r := httprouter.New()
 	for _, route := range routes {
-		r.Handle(route.Method, route.Path, route.HandlerFunc)
+		r.Handle(route.Method, route.Path, api.LogRoute(route.Path, route.HandlerFunc))
 	}
 	r.Handler("GET", "/metrics", promhttp.Handler())
+	r.GET("/readyz", apiServer.ReadyzHandler)
 
-	fileServer := http.FileServer(http.Dir("/static"))
+	fileServer := http.FileServer(http.Dir(filepath.Join(config.SC.UIDir(), "static")))
 	r.GET("/static/*filepath", func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 		req.URL.Path = ps.ByName("filepath")
 		// Set the cache expiration time to 7 days
 		w.Header().Set("Cache-Control", "public, max-age=604800")
 		fileServer.ServeHTTP(w, req)
 	})
+	// The engines download the test files from here in the local mode
+	if storageHandler := object_storage.Handler(); storageHandler != nil {
+		r.GET("/storage/*filepath", func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+			req.URL.Path = ps.ByName("filepath")
+			storageHandler.ServeHTTP(w, req)
+		})
+	}
 
 	// Create HTTP server with timeouts for security
 	server := &http.Server{
 		Addr:           fmt.Sprintf(":%d", 8080),
-		Handler:        context.ClearHandler(r),
+		Handler:        api.Compress(api.AccessLog(gcontext.ClearHandler(r))),
 		ReadTimeout:    15 * time.Second,
 		WriteTimeout:   15 * time.Second,
 		IdleTimeout:    60 * time.Second,
 		MaxHeaderBytes: 1 << 20, // 1 MB
 	}
+	// The server speaks plain HTTP, HTTP/2 without TLS (h2c) is spoken to the clients asking for it
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+
+	// The streams are told to reconnect elsewhere as soon as the server starts shutting down
+	server.RegisterOnShutdown(apiServer.Shutdown)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
 
-	log.Fatal(server.ListenAndServe())
+	// Rolling deployments stop the server with SIGTERM. It stops accepting connections and drains the ones in flight.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	sig := <-stop
+	log.Printf("Received %s, shutting down the API server", sig)
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("The requests in flight did not finish in %s, closing the connections: %v", *shutdownTimeout, err)
+		if err := server.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+	log.Print("The API server is stopped")
 }
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"math"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	ActivityProjectUpdated      = "project_updated"
+	ActivityProjectFileUploaded = "project_file_uploaded"
+	ActivityProjectFileDeleted  = "project_file_deleted"
+	// The project used a threshold of its engine minutes budget
+	ActivityProjectBudgetWarning = "project_budget_warning"
+
+	ActivityPlanCreated      = "plan_created"
+	ActivityPlanUpdated      = "plan_updated"
+	ActivityPlanDeleted      = "plan_deleted"
+	ActivityPlanFileUploaded = "plan_file_uploaded"
+	ActivityPlanFileDeleted  = "plan_file_deleted"
+
+	ActivityCollectionCreated        = "collection_created"
+	ActivityCollectionUpdated        = "collection_updated"
+	ActivityCollectionDeleted        = "collection_deleted"
+	ActivityCollectionConfigured     = "collection_configured"
+	ActivityCollectionFileUploaded   = "collection_file_uploaded"
+	ActivityCollectionFileDeleted    = "collection_file_deleted"
+	ActivityCollectionDeployed       = "collection_deployed"
+	ActivityCollectionTriggered      = "collection_triggered"
+	ActivityCollectionStopped        = "collection_stopped"
+	ActivityCollectionPlanStopped    = "collection_plan_stopped"
+	ActivityCollectionPlanRetried    = "collection_plan_retried"
+	ActivityCollectionEngineReplaced = "collection_engine_replaced"
+	ActivityCollectionReserved       = "collection_reserved"
+	ActivityCollectionUnreserved     = "collection_unreserved"
+	ActivityCollectionPurged         = "collection_purged"
+)
+
+// Activity is a change made by a user to a project, its plans or its collections. Unlike the audit log, which
+// records the actions of the admins, the activity is shown to the users of the project.
+type Activity struct {
+	ID        int64  `json:"id"`
+	ProjectID int64  `json:"project_id"`
+	Actor     string `json:"actor" classification:"personal"`
+	Action    string `json:"action"`
+	// Kind of the project, the plan or the collection which was changed, like the favorites of the users
+	TargetKind  string    `json:"target_kind"`
+	TargetID    int64     `json:"target_id"`
+	TargetName  string    `json:"target_name,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+func RecordActivity(a *Activity) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into project_activity (project_id, actor, action, target_kind, target_id, target_name,
+		detail) values (?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(a.ProjectID, truncate(a.Actor, 255), a.Action, a.TargetKind, a.TargetID,
+		truncate(a.TargetName, 255), truncate(a.Detail, 255))
+	return err
+}
+
+// GetProjectActivity returns the latest activity of the project first. The activity before the given id is
+// returned when it's not 0, to page through the feed.
+func GetProjectActivity(projectID, before int64, limit int) ([]*Activity, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select id, project_id, actor, action, target_kind, target_id, target_name, detail,
+		created_time from project_activity where project_id=? and id<? order by id desc limit ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+	rows, err := q.Query(projectID, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := []*Activity{}
+	for rows.Next() {
+		a := new(Activity)
+		if err := rows.Scan(&a.ID, &a.ProjectID, &a.Actor, &a.Action, &a.TargetKind, &a.TargetID, &a.TargetName,
+			&a.Detail, &a.CreatedTime); err != nil {
+			return nil, err
+		}
+		r = append(r, a)
+	}
+	return r, rows.Err()
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectActivity(t *testing.T) {
+	SetupLocalDatabase(t)
+
+	actions := []string{ActivityProjectUpdated, ActivityPlanCreated, ActivityCollectionCreated,
+		ActivityCollectionTriggered, ActivityCollectionStopped}
+	for i, action := range actions {
+		assert.NoError(t, RecordActivity(&Activity{ProjectID: 1, Actor: "alice", Action: action,
+			TargetKind: UserItemCollection, TargetID: int64(i + 1), TargetName: "checkout"}))
+	}
+	// The activity of the other projects is not in the feed
+	assert.NoError(t, RecordActivity(&Activity{ProjectID: 2, Actor: "bob", Action: ActivityProjectUpdated,
+		TargetKind: UserItemProject, TargetID: 2}))
+
+	// The latest activity comes first
+	page, err := GetProjectActivity(1, 0, 3)
+	assert.NoError(t, err)
+	if assert.Len(t, page, 3) {
+		assert.Equal(t, ActivityCollectionStopped, page[0].Action)
+		assert.Equal(t, ActivityCollectionTriggered, page[1].Action)
+		assert.Equal(t, ActivityCollectionCreated, page[2].Action)
+		assert.Equal(t, int64(1), page[0].ProjectID)
+		assert.Equal(t, "alice", page[0].Actor)
+		assert.Equal(t, UserItemCollection, page[0].TargetKind)
+		assert.Equal(t, int64(5), page[0].TargetID)
+		assert.Equal(t, "checkout", page[0].TargetName)
+		assert.False(t, page[0].CreatedTime.IsZero())
+	}
+
+	// The next page is the activity before the last one of the page
+	next, err := GetProjectActivity(1, page[len(page)-1].ID, 3)
+	assert.NoError(t, err)
+	if assert.Len(t, next, 2) {
+		assert.Equal(t, ActivityPlanCreated, next[0].Action)
+		assert.Equal(t, ActivityProjectUpdated, next[1].Action)
+	}
+	last, err := GetProjectActivity(1, next[len(next)-1].ID, 3)
+	assert.NoError(t, err)
+	assert.Empty(t, last)
+
+	other, err := GetProjectActivity(2, 0, 50)
+	assert.NoError(t, err)
+	assert.Len(t, other, 1)
+	assert.Equal(t, "bob", other[0].Actor)
+}
+
+func TestRecordActivityTruncates(t *testing.T) {
+	SetupLocalDatabase(t)
+
+	long := strings.Repeat("x", 300)
+	assert.NoError(t, RecordActivity(&Activity{ProjectID: 1, Actor: long, Action: ActivityPlanUpdated,
+		TargetKind: UserItemPlan, TargetID: 1, TargetName: long, Detail: long}))
+	activity, err := GetProjectActivity(1, 0, 50)
+	assert.NoError(t, err)
+	if assert.Len(t, activity, 1) {
+		assert.Len(t, activity[0].Actor, 255)
+		assert.Len(t, activity[0].TargetName, 255)
+		assert.Len(t, activity[0].Detail, 255)
+	}
+}
@@ -0,0 +1,138 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	DefaultHeartbeatTimeout = 15
+	MinHeartbeatTimeout     = 1
+	MaxHeartbeatTimeout     = 24 * 60
+	// Seconds the engines take to stop their threads once the heartbeat of the run was missed
+	AttendedRampdown = 60
+)
+
+// AttendedRun stops the run when nobody sends its heartbeat for the timeout, so a forgotten run does not load a
+// shared environment for the weekend. The UI sends it while the collection is open, the clients send it to the API.
+type AttendedRun struct {
+	// Minutes the run goes on without a heartbeat, 15 by default
+	HeartbeatTimeout int `json:"heartbeat_timeout"`
+}
+
+// Validate fills the defaults. A nil run is not attended
+func (ar *AttendedRun) Validate() error {
+	if ar == nil {
+		return nil
+	}
+	if ar.HeartbeatTimeout == 0 {
+		ar.HeartbeatTimeout = DefaultHeartbeatTimeout
+	}
+	if ar.HeartbeatTimeout < MinHeartbeatTimeout || ar.HeartbeatTimeout > MaxHeartbeatTimeout {
+		return fmt.Errorf("the heartbeat timeout should be between %d and %d minutes", MinHeartbeatTimeout,
+			MaxHeartbeatTimeout)
+	}
+	return nil
+}
+
+// RunHeartbeat is the last heartbeat of an attended-only run
+type RunHeartbeat struct {
+	RunID         int64     `json:"run_id"`
+	CollectionID  int64     `json:"collection_id"`
+	Timeout       int       `json:"heartbeat_timeout"`
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	LastBy        string    `json:"last_by" classification:"personal"`
+	// The engines are ramping down since, nobody sent the heartbeat in time. Zero while the run is attended
+	StoppingTime time.Time `json:"stopping_time"`
+}
+
+// Deadline is when the run is stopped without another heartbeat
+func (rh *RunHeartbeat) Deadline() time.Time {
+	return rh.LastHeartbeat.Add(time.Duration(rh.Timeout) * time.Minute)
+}
+
+// Missed tells nobody sent the heartbeat in time and the run is not stopping yet
+func (rh *RunHeartbeat) Missed(now time.Time) bool {
+	return rh.StoppingTime.IsZero() && !now.Before(rh.Deadline())
+}
+
+// RampedDown tells the engines had the time to ramp down since the run started stopping
+func (rh *RunHeartbeat) RampedDown(now time.Time) bool {
+	return !rh.StoppingTime.IsZero() && !now.Before(rh.StoppingTime.Add(AttendedRampdown*time.Second))
+}
+
+func StartRunHeartbeat(collectionID, runID int64, ar *AttendedRun, started time.Time, by string) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_run_heartbeat (run_id, collection_id, timeout_minutes,
+		last_heartbeat, last_by) values (?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(runID, collectionID, ar.HeartbeatTimeout, started, by)
+	return err
+}
+
+func GetRunHeartbeat(runID int64) (*RunHeartbeat, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select run_id, collection_id, timeout_minutes, last_heartbeat, last_by, stopping_time
+		from collection_run_heartbeat where run_id=?`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rh := new(RunHeartbeat)
+	var stopping sql.NullTime
+	err = q.QueryRow(runID).Scan(&rh.RunID, &rh.CollectionID, &rh.Timeout, &rh.LastHeartbeat, &rh.LastBy, &stopping)
+	if err != nil {
+		return nil, &DBError{Err: err, Message: "the run is not attended-only"}
+	}
+	if stopping.Valid {
+		rh.StoppingTime = stopping.Time
+	}
+	return rh, nil
+}
+
+// Beat records a heartbeat, the run goes on for another timeout
+func (rh *RunHeartbeat) Beat(by string, now time.Time) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("update collection_run_heartbeat set last_heartbeat=?, last_by=? where run_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err := q.Exec(now, by, rh.RunID); err != nil {
+		return err
+	}
+	rh.LastHeartbeat, rh.LastBy = now, by
+	return nil
+}
+
+// Stop records the run started stopping, the heartbeats cannot keep it going anymore
+func (rh *RunHeartbeat) Stop(now time.Time) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("update collection_run_heartbeat set stopping_time=? where run_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err := q.Exec(now, rh.RunID); err != nil {
+		return err
+	}
+	rh.StoppingTime = now
+	return nil
+}
+
+func (c *Collection) deleteRunHeartbeats() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_heartbeat where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttendedRunValidate(t *testing.T) {
+	var none *AttendedRun
+	assert.NoError(t, none.Validate())
+
+	ar := &AttendedRun{}
+	assert.NoError(t, ar.Validate())
+	assert.Equal(t, DefaultHeartbeatTimeout, ar.HeartbeatTimeout)
+
+	assert.Error(t, (&AttendedRun{HeartbeatTimeout: -1}).Validate())
+	assert.Error(t, (&AttendedRun{HeartbeatTimeout: MaxHeartbeatTimeout + 1}).Validate())
+	assert.NoError(t, (&AttendedRun{HeartbeatTimeout: MaxHeartbeatTimeout}).Validate())
+}
+
+func TestRunHeartbeatMissed(t *testing.T) {
+	last := time.Date(2026, 10, 16, 17, 0, 0, 0, time.UTC)
+	rh := &RunHeartbeat{Timeout: 15, LastHeartbeat: last}
+	assert.Equal(t, last.Add(15*time.Minute), rh.Deadline())
+	assert.False(t, rh.Missed(last.Add(14*time.Minute)))
+	assert.True(t, rh.Missed(last.Add(15*time.Minute)))
+	assert.False(t, rh.RampedDown(last.Add(time.Hour)))
+
+	// Once the run is stopping, it's not missed again and ends after the ramp-down
+	stopping := last.Add(16 * time.Minute)
+	rh.StoppingTime = stopping
+	assert.False(t, rh.Missed(last.Add(time.Hour)))
+	assert.False(t, rh.RampedDown(stopping.Add(AttendedRampdown*time.Second-time.Second)))
+	assert.True(t, rh.RampedDown(stopping.Add(AttendedRampdown*time.Second)))
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	AuditActionImagePolicyOverride = "image_policy_override"
+	// An admin read classified data, see Classify
+	AuditActionClassifiedRead = "classified_read"
+	// An admin added engine minutes to the exhausted budget of a project
+	AuditActionBudgetExtension = "budget_extension"
+	// An admin was let through to a destructive action by a TOTP code
+	AuditActionStepUp = "step_up"
+	// An admin enrolled a TOTP secret, or had the one of another admin reset
+	AuditActionMFAEnrolled = "mfa_enrolled"
+	AuditActionMFAReset    = "mfa_reset"
+	// An admin entered too many invalid TOTP codes in a row, their codes are refused for a while
+	AuditActionMFALocked = "mfa_locked"
+	// An admin made the platform read-only, or writable again
+	AuditActionPlatformFrozen   = "platform_frozen"
+	AuditActionPlatformUnfrozen = "platform_unfrozen"
+)
+
+// AuditEntry records an action of an admin that bypasses a safeguard of the platform, or reads classified data
+type AuditEntry struct {
+	ID          int64     `json:"id"`
+	Actor       string    `json:"actor" classification:"personal"`
+	Action      string    `json:"action"`
+	Target      string    `json:"target"`
+	Detail      string    `json:"detail"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+// execer is either the database or a transaction, so the entries can be recorded along with the action
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func recordAudit(db execer, actor, action, target, detail string) error {
+	_, err := db.Exec("insert into audit_log (actor, action, target, detail) values (?,?,?,?)",
+		actor, action, truncate(target, 255), detail)
+	return err
+}
+
+// GetAuditLog returns the latest entries first
+func GetAuditLog(limit int) ([]*AuditEntry, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select id, actor, action, target, detail, created_time from audit_log order by id desc limit ?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := []*AuditEntry{}
+	for rows.Next() {
+		ae := new(AuditEntry)
+		if err := rows.Scan(&ae.ID, &ae.Actor, &ae.Action, &ae.Target, &ae.Detail, &ae.CreatedTime); err != nil {
+			return nil, err
+		}
+		r = append(r, ae)
+	}
+	return r, rows.Err()
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// Baseline is the run new runs of a collection are compared against by default
+type Baseline struct {
+	CollectionID int64     `json:"collection_id"`
+	RunID        int64     `json:"run_id"`
+	SetBy        string    `json:"set_by"`
+	Reason       string    `json:"reason"`
+	SetTime      time.Time `json:"set_time"`
+}
+
+// BaselineChange is an audit log entry of the baseline. RunID is 0 when the baseline was cleared.
+type BaselineChange struct {
+	CollectionID int64     `json:"collection_id"`
+	RunID        int64     `json:"run_id"`
+	ChangedBy    string    `json:"changed_by"`
+	Reason       string    `json:"reason"`
+	ChangedTime  time.Time `json:"changed_time"`
+}
+
+func (c *Collection) changeBaseline(runID int64, account, reason string) error {
+	db := config.SC.DBC
+	tx, err := db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+	}()
+	if runID == 0 {
+		_, err = tx.Exec("delete from collection_baseline where collection_id=?", c.ID)
+	} else {
+		_, err = tx.Exec(`insert into collection_baseline (collection_id, run_id, set_by, reason) values (?,?,?,?)
+			on duplicate key update run_id=?, set_by=?, reason=?, set_time=NOW()`,
+			c.ID, runID, account, reason, runID, account, reason)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("insert into collection_baseline_history (collection_id, run_id, changed_by, reason) values (?,?,?,?)",
+		c.ID, runID, account, reason)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetBaseline promotes the run to be the baseline of the collection
+func (c *Collection) SetBaseline(runID int64, account, reason string) error {
+	return c.changeBaseline(runID, account, reason)
+}
+
+func (c *Collection) ClearBaseline(account, reason string) error {
+	return c.changeBaseline(0, account, reason)
+}
+
+func (c *Collection) deleteBaseline() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_baseline where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
+
+func (c *Collection) GetBaseline() (*Baseline, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select collection_id, run_id, set_by, reason, set_time from collection_baseline where collection_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	b := new(Baseline)
+	if err := q.QueryRow(c.ID).Scan(&b.CollectionID, &b.RunID, &b.SetBy, &b.Reason, &b.SetTime); err != nil {
+		return nil, &DBError{Err: err, Message: "the collection does not have a baseline"}
+	}
+	return b, nil
+}
+
+func (c *Collection) GetBaselineHistory() ([]*BaselineChange, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select collection_id, run_id, changed_by, reason, changed_time from collection_baseline_history
+		where collection_id=? order by id desc`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := []*BaselineChange{}
+	for rows.Next() {
+		bc := new(BaselineChange)
+		if err := rows.Scan(&bc.CollectionID, &bc.RunID, &bc.ChangedBy, &bc.Reason, &bc.ChangedTime); err != nil {
+			return nil, err
+		}
+		r = append(r, bc)
+	}
+	return r, rows.Err()
+}
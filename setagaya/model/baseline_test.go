@@ -0,0 +1,63 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseline(t *testing.T) {
+	SetupLocalDatabase(t)
+	collection := &Collection{ID: 1}
+	other := &Collection{ID: 2}
+
+	_, err := collection.GetBaseline()
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, collection.SetBaseline(10, "alice", "release 1.0"))
+	assert.NoError(t, other.SetBaseline(20, "carol", "other collection"))
+	b, err := collection.GetBaseline()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), b.CollectionID)
+	assert.Equal(t, int64(10), b.RunID)
+	assert.Equal(t, "alice", b.SetBy)
+	assert.Equal(t, "release 1.0", b.Reason)
+	assert.False(t, b.SetTime.IsZero())
+
+	// Promoting another run replaces the baseline
+	assert.NoError(t, collection.SetBaseline(12, "bob", "release 1.1"))
+	b, err = collection.GetBaseline()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), b.RunID)
+	assert.Equal(t, "bob", b.SetBy)
+	assert.Equal(t, "release 1.1", b.Reason)
+
+	assert.NoError(t, collection.ClearBaseline("alice", "flaky environment"))
+	_, err = collection.GetBaseline()
+	assert.ErrorIs(t, err, ErrNotFound)
+	b, err = other.GetBaseline()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), b.RunID)
+
+	// Every change is audited, the latest first. Clearing the baseline is recorded with run 0
+	history, err := collection.GetBaselineHistory()
+	assert.NoError(t, err)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, int64(0), history[0].RunID)
+		assert.Equal(t, "alice", history[0].ChangedBy)
+		assert.Equal(t, "flaky environment", history[0].Reason)
+		assert.Equal(t, int64(12), history[1].RunID)
+		assert.Equal(t, "bob", history[1].ChangedBy)
+		assert.Equal(t, int64(10), history[2].RunID)
+		assert.Equal(t, int64(1), history[2].CollectionID)
+		assert.False(t, history[2].ChangedTime.IsZero())
+	}
+
+	// The history outlives the baseline of a deleted collection
+	assert.NoError(t, other.deleteBaseline())
+	_, err = other.GetBaseline()
+	assert.ErrorIs(t, err, ErrNotFound)
+	history, err = other.GetBaselineHistory()
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+}
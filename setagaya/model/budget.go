@@ -0,0 +1,330 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// The budgets are in engine minutes per calendar month, in UTC. An engine counts from its deployment to its purge,
+// whether it runs a test or not, as it holds its node all along.
+const (
+	budgetMonthFormat       = "2006-01"
+	maxMonthlyEngineMinutes = 100000000
+	maxBudgetReasonLength   = 255
+)
+
+// BudgetWarningThresholds are the percentages of the budget of the month the projects are warned at
+var BudgetWarningThresholds = []int{50, 80, 100}
+
+var ErrBudgetExhausted = errors.New("the engine minutes budget of the project is exhausted")
+
+type ProjectBudget struct {
+	ProjectID            int64     `json:"project_id"`
+	MonthlyEngineMinutes int       `json:"monthly_engine_minutes"`
+	UpdatedBy            string    `json:"updated_by" classification:"personal"`
+	UpdatedTime          time.Time `json:"updated_time"`
+}
+
+func (pb *ProjectBudget) Validate() error {
+	if pb.MonthlyEngineMinutes <= 0 || pb.MonthlyEngineMinutes > maxMonthlyEngineMinutes {
+		return fmt.Errorf("monthly engine minutes should be between 1 and %d", maxMonthlyEngineMinutes)
+	}
+	return nil
+}
+
+// BudgetExtension adds engine minutes to the budget of a project for a month. Only the admins grant them
+type BudgetExtension struct {
+	ID            int64     `json:"id"`
+	ProjectID     int64     `json:"project_id"`
+	Month         string    `json:"month"`
+	EngineMinutes int       `json:"engine_minutes"`
+	GrantedBy     string    `json:"granted_by" classification:"personal"`
+	Reason        string    `json:"reason"`
+	CreatedTime   time.Time `json:"created_time"`
+}
+
+func (be *BudgetExtension) Validate() error {
+	if be.EngineMinutes <= 0 || be.EngineMinutes > maxMonthlyEngineMinutes {
+		return fmt.Errorf("engine minutes should be between 1 and %d", maxMonthlyEngineMinutes)
+	}
+	if be.Reason == "" || len(be.Reason) > maxBudgetReasonLength {
+		return fmt.Errorf("reason is required and cannot be longer than %d characters", maxBudgetReasonLength)
+	}
+	return nil
+}
+
+// BudgetStatus is how much of its budget a project used this month
+type BudgetStatus struct {
+	*ProjectBudget
+	Month      string             `json:"month"`
+	Extensions []*BudgetExtension `json:"extensions"`
+	// The budget and the extensions of the month
+	LimitEngineMinutes    int     `json:"limit_engine_minutes"`
+	ConsumedEngineMinutes float64 `json:"consumed_engine_minutes"`
+	Percent               float64 `json:"percent"`
+	// The collections of the project cannot be triggered until the next month or an extension
+	Exhausted bool `json:"exhausted"`
+}
+
+// CrossedThresholds are the warning thresholds the consumption reached, the highest last
+func (bs *BudgetStatus) CrossedThresholds() []int {
+	crossed := []int{}
+	for _, t := range BudgetWarningThresholds {
+		if bs.Percent >= float64(t) {
+			crossed = append(crossed, t)
+		}
+	}
+	return crossed
+}
+
+// BudgetMonth is the month of the budgets at t
+func BudgetMonth(t time.Time) string {
+	return t.UTC().Format(budgetMonthFormat)
+}
+
+func budgetMonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// engineLaunch is a deployment of the engines of a collection. End is nil while they are deployed
+type engineLaunch struct {
+	Engines int64
+	Start   time.Time
+	End     *time.Time
+}
+
+// engineMinutes sums the minutes the engines of the launches were deployed for between from and to
+func engineMinutes(launches []*engineLaunch, from, to time.Time) float64 {
+	total := 0.0
+	for _, l := range launches {
+		start, end := l.Start, to
+		if l.End != nil && l.End.Before(end) {
+			end = *l.End
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(start) {
+			total += float64(l.Engines) * end.Sub(start).Minutes()
+		}
+	}
+	return total
+}
+
+func getEngineLaunches(projectID int64, from, to time.Time) ([]*engineLaunch, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select coalesce(h.engines_count, 0), h.started_time, h.end_time
+		from collection_launch_history2 h join collection c on c.id=h.collection_id
+		where c.project_id=? and h.started_time < ? and (h.end_time is null or h.end_time > ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(projectID, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	launches := []*engineLaunch{}
+	for rows.Next() {
+		l := new(engineLaunch)
+		var end sql.NullTime
+		if err := rows.Scan(&l.Engines, &l.Start, &end); err != nil {
+			return nil, err
+		}
+		if end.Valid {
+			l.End = &end.Time
+		}
+		launches = append(launches, l)
+	}
+	return launches, rows.Err()
+}
+
+// GetProjectBudget returns the budget of the project. It's nil when the project has none
+func GetProjectBudget(projectID int64) (*ProjectBudget, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select monthly_engine_minutes, updated_by, updated_time from project_budget where project_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	pb := &ProjectBudget{ProjectID: projectID}
+	if err := q.QueryRow(projectID).Scan(&pb.MonthlyEngineMinutes, &pb.UpdatedBy, &pb.UpdatedTime); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return pb, nil
+}
+
+// GetProjectBudgets returns the budgets of all the projects having one
+func GetProjectBudgets() ([]*ProjectBudget, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select project_id, monthly_engine_minutes, updated_by, updated_time from project_budget")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	budgets := []*ProjectBudget{}
+	for rows.Next() {
+		pb := new(ProjectBudget)
+		if err := rows.Scan(&pb.ProjectID, &pb.MonthlyEngineMinutes, &pb.UpdatedBy, &pb.UpdatedTime); err != nil {
+			return nil, err
+		}
+		budgets = append(budgets, pb)
+	}
+	return budgets, rows.Err()
+}
+
+func SetProjectBudget(pb *ProjectBudget) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into project_budget (project_id, monthly_engine_minutes, updated_by) values (?, ?, ?)
+		on duplicate key update monthly_engine_minutes=?, updated_by=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(pb.ProjectID, pb.MonthlyEngineMinutes, pb.UpdatedBy, pb.MonthlyEngineMinutes, pb.UpdatedBy)
+	return err
+}
+
+// DeleteProjectBudget removes the budget of the project with its extensions and its warnings
+func DeleteProjectBudget(projectID int64) error {
+	db := config.SC.DBC
+	for _, table := range []string{"project_budget", "project_budget_extension", "project_budget_warning"} {
+		// #nosec G202 -- The table names are constants
+		if _, err := db.Exec("delete from "+table+" where project_id=?", projectID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GrantBudgetExtension adds engine minutes to the budget of the month of the extension. It's recorded in the
+// audit log
+func GrantBudgetExtension(be *BudgetExtension) error {
+	db := config.SC.DBC
+	tx, err := db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+	}()
+	r, err := tx.Exec(`insert into project_budget_extension (project_id, month, engine_minutes, granted_by, reason)
+		values (?,?,?,?,?)`, be.ProjectID, be.Month, be.EngineMinutes, be.GrantedBy, be.Reason)
+	if err != nil {
+		return err
+	}
+	if be.ID, err = r.LastInsertId(); err != nil {
+		return err
+	}
+	detail := fmt.Sprintf("%d engine minutes added to the budget of %s: %s", be.EngineMinutes, be.Month, be.Reason)
+	if err := recordAudit(tx, be.GrantedBy, AuditActionBudgetExtension, fmt.Sprintf("project %d", be.ProjectID),
+		detail); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func getBudgetExtensions(projectID int64, month string) ([]*BudgetExtension, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select id, engine_minutes, granted_by, reason, created_time from project_budget_extension
+		where project_id=? and month=? order by id`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(projectID, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	extensions := []*BudgetExtension{}
+	for rows.Next() {
+		be := &BudgetExtension{ProjectID: projectID, Month: month}
+		if err := rows.Scan(&be.ID, &be.EngineMinutes, &be.GrantedBy, &be.Reason, &be.CreatedTime); err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, be)
+	}
+	return extensions, rows.Err()
+}
+
+// makeBudgetStatus sums up the consumption of the budget over the month of now
+func makeBudgetStatus(pb *ProjectBudget, extensions []*BudgetExtension, launches []*engineLaunch,
+	now time.Time) *BudgetStatus {
+	bs := &BudgetStatus{ProjectBudget: pb, Month: BudgetMonth(now), Extensions: extensions,
+		LimitEngineMinutes: pb.MonthlyEngineMinutes}
+	for _, be := range extensions {
+		bs.LimitEngineMinutes += be.EngineMinutes
+	}
+	bs.ConsumedEngineMinutes = engineMinutes(launches, budgetMonthStart(now), now)
+	bs.Percent = bs.ConsumedEngineMinutes * 100 / float64(bs.LimitEngineMinutes)
+	bs.Exhausted = bs.ConsumedEngineMinutes >= float64(bs.LimitEngineMinutes)
+	return bs
+}
+
+// GetBudgetStatus returns the consumption of the budget of the project this month. It's nil when the project has
+// no budget
+func GetBudgetStatus(projectID int64, now time.Time) (*BudgetStatus, error) {
+	pb, err := GetProjectBudget(projectID)
+	if err != nil || pb == nil {
+		return nil, err
+	}
+	extensions, err := getBudgetExtensions(projectID, BudgetMonth(now))
+	if err != nil {
+		return nil, err
+	}
+	launches, err := getEngineLaunches(projectID, budgetMonthStart(now), now)
+	if err != nil {
+		return nil, err
+	}
+	return makeBudgetStatus(pb, extensions, launches, now), nil
+}
+
+// CheckBudget returns ErrBudgetExhausted when the project used all of its budget this month
+func CheckBudget(projectID int64, now time.Time) error {
+	bs, err := GetBudgetStatus(projectID, now)
+	if err != nil || bs == nil || !bs.Exhausted {
+		return err
+	}
+	return fmt.Errorf("%w: %.0f of the %d engine minutes of %s are used, ask the admins for an extension",
+		ErrBudgetExhausted, bs.ConsumedEngineMinutes, bs.LimitEngineMinutes, bs.Month)
+}
+
+// RecordBudgetWarning records the project was warned it reached the threshold of its budget this month. It
+// returns false when it was already warned.
+func RecordBudgetWarning(projectID int64, month string, threshold int) (bool, error) {
+	db := config.SC.DBC
+	var warned int
+	if err := db.QueryRow("select count(*) from project_budget_warning where project_id=? and month=? and threshold=?",
+		projectID, month, threshold).Scan(&warned); err != nil {
+		return false, err
+	}
+	if warned > 0 {
+		return false, nil
+	}
+	_, err := db.Exec("insert into project_budget_warning (project_id, month, threshold) values (?,?,?)",
+		projectID, month, threshold)
+	if isDuplicateEntry(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
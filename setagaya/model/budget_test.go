@@ -0,0 +1,69 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineMinutes(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	from := budgetMonthStart(now)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), from)
+	ended := func(t time.Time) *time.Time { return &t }
+
+	launches := []*engineLaunch{
+		// 2 engines for an hour
+		{Engines: 2, Start: now.Add(-3 * time.Hour), End: ended(now.Add(-2 * time.Hour))},
+		// Still deployed, 3 engines for 30 minutes so far
+		{Engines: 3, Start: now.Add(-30 * time.Minute)},
+		// Deployed the last month, only the minutes of this month count
+		{Engines: 1, Start: from.Add(-time.Hour), End: ended(from.Add(10 * time.Minute))},
+		// Purged before the month
+		{Engines: 5, Start: from.Add(-2 * time.Hour), End: ended(from.Add(-time.Hour))},
+	}
+	assert.InDelta(t, 120+90+10, engineMinutes(launches, from, now), 0.001)
+	assert.Equal(t, 0.0, engineMinutes(nil, from, now))
+}
+
+func TestMakeBudgetStatus(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	pb := &ProjectBudget{ProjectID: 1, MonthlyEngineMinutes: 100}
+	launches := []*engineLaunch{{Engines: 1, Start: now.Add(-85 * time.Minute)}}
+
+	bs := makeBudgetStatus(pb, []*BudgetExtension{}, launches, now)
+	assert.Equal(t, "2026-10", bs.Month)
+	assert.Equal(t, 100, bs.LimitEngineMinutes)
+	assert.InDelta(t, 85, bs.Percent, 0.001)
+	assert.False(t, bs.Exhausted)
+	assert.Equal(t, []int{50, 80}, bs.CrossedThresholds())
+
+	launches = append(launches, &engineLaunch{Engines: 1, Start: now.Add(-15 * time.Minute)})
+	bs = makeBudgetStatus(pb, []*BudgetExtension{}, launches, now)
+	assert.True(t, bs.Exhausted)
+	assert.Equal(t, []int{50, 80, 100}, bs.CrossedThresholds())
+
+	// An extension lifts the limit of the month
+	bs = makeBudgetStatus(pb, []*BudgetExtension{{EngineMinutes: 100}}, launches, now)
+	assert.Equal(t, 200, bs.LimitEngineMinutes)
+	assert.False(t, bs.Exhausted)
+	assert.Equal(t, []int{50}, bs.CrossedThresholds())
+}
+
+func TestBudgetValidate(t *testing.T) {
+	assert.NoError(t, (&ProjectBudget{MonthlyEngineMinutes: 6000}).Validate())
+	assert.Error(t, (&ProjectBudget{}).Validate())
+	assert.Error(t, (&ProjectBudget{MonthlyEngineMinutes: maxMonthlyEngineMinutes + 1}).Validate())
+
+	assert.NoError(t, (&BudgetExtension{EngineMinutes: 600, Reason: "release week"}).Validate())
+	assert.Error(t, (&BudgetExtension{EngineMinutes: 600}).Validate())
+	assert.Error(t, (&BudgetExtension{EngineMinutes: -1, Reason: "release week"}).Validate())
+}
+
+func TestBudgetMonth(t *testing.T) {
+	// The months are in UTC
+	tokyo := time.FixedZone("JST", 9*60*60)
+	assert.Equal(t, "2026-09", BudgetMonth(time.Date(2026, 10, 1, 8, 0, 0, 0, tokyo)))
+	assert.Equal(t, "2026-10", BudgetMonth(time.Date(2026, 10, 1, 9, 0, 0, 0, tokyo)))
+}
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"math"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// Number of recent calibration runs used to estimate the noise of the environment
+const calibrationWindow = 10
+
+// A calibration run is a run of the collection flagged as such when it's triggered. Its workload is the one of the
+// plans of the collection, so the noise is only measured while they stay the same: the calibration runs are dropped
+// when the load of the plans changes. The collections meant for calibration hold a short, steady workload against a
+// stable endpoint.
+
+// CalibrationNoise describes how much the results of the same workload vary from run to run in the environment.
+// The figures are relative, e.g. 0.1 means 10%.
+type CalibrationNoise struct {
+	Runs int `json:"runs"`
+	// Coefficient of variation of the mean and p95 latencies across the calibration runs
+	MeanCV float64 `json:"mean_cv"`
+	P95CV  float64 `json:"p95_cv"`
+	// Relative latency changes below this threshold are considered environment noise.
+	// It's two times the coefficient of variation, which covers ~95% of the run to run variance.
+	Threshold float64 `json:"threshold"`
+}
+
+func coefficientOfVariation(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+	var ss float64
+	for _, v := range values {
+		ss += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(ss/float64(len(values)-1)) / mean
+}
+
+// CalculateNoise returns nil when there are not enough calibration runs to estimate the noise
+func CalculateNoise(summaries []*RunSummary) *CalibrationNoise {
+	if len(summaries) < 2 {
+		return nil
+	}
+	means := make([]float64, len(summaries))
+	p95s := make([]float64, len(summaries))
+	for i, s := range summaries {
+		means[i] = s.Mean
+		p95s[i] = s.P95
+	}
+	n := &CalibrationNoise{
+		Runs:   len(summaries),
+		MeanCV: coefficientOfVariation(means),
+		P95CV:  coefficientOfVariation(p95s),
+	}
+	n.Threshold = 2 * math.Max(n.MeanCV, n.P95CV)
+	return n
+}
+
+// ExceedsNoise tells whether the relative change of the mean latency from base to target is larger than the noise
+func (n *CalibrationNoise) ExceedsNoise(base, target *RunSummary) bool {
+	if n == nil {
+		return true
+	}
+	if base.Mean == 0 {
+		return target.Mean != 0
+	}
+	return math.Abs(target.Mean-base.Mean)/base.Mean > n.Threshold
+}
+
+func MarkCalibrationRun(collectionID, runID int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into collection_calibration_run (run_id, collection_id) values (?,?)")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(runID, collectionID)
+	return err
+}
+
+func (c *Collection) deleteCalibrationRuns() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_calibration_run where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
+
+// sameWorkload tells whether the plans put the same load as the current ones, in which case the calibration runs
+// still measure the noise of the collection
+func sameWorkload(current, plans []*ExecutionPlan) bool {
+	if len(current) != len(plans) {
+		return false
+	}
+	byID := make(map[int64]*ExecutionPlan, len(current))
+	for _, ep := range current {
+		byID[ep.PlanID] = ep
+	}
+	for _, ep := range plans {
+		cp, ok := byID[ep.PlanID]
+		if !ok {
+			return false
+		}
+		if cp.Engines != ep.Engines || cp.Concurrency != ep.Concurrency || cp.Rampup != ep.Rampup ||
+			cp.Duration != ep.Duration || cp.TargetRPS != ep.TargetRPS || cp.EngineType != ep.EngineType {
+			return false
+		}
+	}
+	return true
+}
+
+func IsCalibrationRun(runID int64) (bool, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select count(1) from collection_calibration_run where run_id=?")
+	if err != nil {
+		return false, err
+	}
+	defer q.Close()
+	var count int
+	if err := q.QueryRow(runID).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetCalibrationSummaries returns the summaries of the most recent finished calibration runs of the collection
+func (c *Collection) GetCalibrationSummaries() ([]*RunSummary, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select s.run_id, s.collection_id, s.samples, s.min_latency, s.max_latency, s.mean_latency, s.p50, s.p90, s.p95, s.p99
+		from collection_calibration_run c join collection_run_summary s on c.run_id = s.run_id
+		where c.collection_id=? order by c.run_id desc limit ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(c.ID, calibrationWindow)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := []*RunSummary{}
+	for rows.Next() {
+		rs := new(RunSummary)
+		if err := rows.Scan(&rs.RunID, &rs.CollectionID, &rs.Samples, &rs.Min, &rs.Max, &rs.Mean, &rs.P50, &rs.P90, &rs.P95, &rs.P99); err != nil {
+			return nil, err
+		}
+		r = append(r, rs)
+	}
+	return r, rows.Err()
+}
+
+func (c *Collection) GetCalibrationNoise() (*CalibrationNoise, error) {
+	summaries, err := c.GetCalibrationSummaries()
+	if err != nil {
+		return nil, err
+	}
+	return CalculateNoise(summaries), nil
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculateNoise(t *testing.T) {
+	assert.Nil(t, CalculateNoise(nil))
+	assert.Nil(t, CalculateNoise([]*RunSummary{{Mean: 100, P95: 200}}))
+
+	n := CalculateNoise([]*RunSummary{
+		{Mean: 100, P95: 200},
+		{Mean: 110, P95: 210},
+		{Mean: 90, P95: 190},
+	})
+	assert.Equal(t, 3, n.Runs)
+	assert.InDelta(t, 0.1, n.MeanCV, 0.0001)
+	assert.InDelta(t, 0.05, n.P95CV, 0.0001)
+	assert.InDelta(t, 0.2, n.Threshold, 0.0001)
+}
+
+func TestExceedsNoise(t *testing.T) {
+	base := &RunSummary{Mean: 100}
+	n := &CalibrationNoise{Threshold: 0.15}
+	assert.False(t, n.ExceedsNoise(base, &RunSummary{Mean: 110}))
+	assert.False(t, n.ExceedsNoise(base, &RunSummary{Mean: 90}))
+	assert.True(t, n.ExceedsNoise(base, &RunSummary{Mean: 120}))
+	assert.True(t, n.ExceedsNoise(base, &RunSummary{Mean: 80}))
+
+	var unknown *CalibrationNoise
+	assert.True(t, unknown.ExceedsNoise(base, &RunSummary{Mean: 101}))
+}
+
+func TestSameWorkload(t *testing.T) {
+	current := []*ExecutionPlan{
+		{PlanID: 1, Engines: 2, Concurrency: 50, Rampup: 10, Duration: 5},
+		{PlanID: 2, Engines: 1, Concurrency: 10, Duration: 5},
+	}
+	same := []*ExecutionPlan{
+		{PlanID: 2, Engines: 1, Concurrency: 10, Duration: 5, Name: "renamed"},
+		{PlanID: 1, Engines: 2, Concurrency: 50, Rampup: 10, Duration: 5},
+	}
+	assert.True(t, sameWorkload(current, same))
+	assert.True(t, sameWorkload(nil, nil))
+
+	assert.False(t, sameWorkload(current, same[:1]))
+	assert.False(t, sameWorkload(current, []*ExecutionPlan{
+		{PlanID: 3, Engines: 1, Concurrency: 10, Duration: 5},
+		{PlanID: 1, Engines: 2, Concurrency: 50, Rampup: 10, Duration: 5},
+	}))
+	assert.False(t, sameWorkload(current, []*ExecutionPlan{
+		{PlanID: 2, Engines: 1, Concurrency: 10, Duration: 5},
+		{PlanID: 1, Engines: 2, Concurrency: 100, Rampup: 10, Duration: 5},
+	}))
+}
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	ChaosMesh = "chaos-mesh"
+	Litmus    = "litmus"
+
+	MaxChaosActions = 20
+)
+
+var (
+	ErrChaosDisabled = errors.New("chaos actions are not enabled, they need chaos_namespaces in the executor config")
+
+	// The API group of the experiments of every provider. The actions can only create experiments of their provider
+	chaosGroups = map[string]string{
+		ChaosMesh: "chaos-mesh.org",
+		Litmus:    "litmuschaos.io",
+	}
+	chaosActionNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,38}[a-z0-9])?$`)
+)
+
+// ChaosAction creates a chaos experiment at a point of the timeline of the runs of a collection, e.g. it kills a
+// pod of the system under test five minutes in. The experiments are deleted when the run ends.
+type ChaosAction struct {
+	Name string `json:"name"`
+	// Time after the start of the run, like 5m
+	At        string `json:"at"`
+	Provider  string `json:"provider"`
+	Namespace string `json:"namespace"`
+	// The experiment created, e.g. a PodChaos of Chaos Mesh or a ChaosEngine of Litmus. Its name and namespace are
+	// set by Setagaya
+	Manifest map[string]interface{} `json:"manifest"`
+}
+
+// Offset returns the time after the start of the run the action is taken at
+func (ca *ChaosAction) Offset() time.Duration {
+	d, _ := time.ParseDuration(ca.At)
+	return d
+}
+
+// APIVersion returns the api version and the kind of the experiment
+func (ca *ChaosAction) APIVersion() (string, string) {
+	apiVersion, _ := ca.Manifest["apiVersion"].(string)
+	kind, _ := ca.Manifest["kind"].(string)
+	return apiVersion, kind
+}
+
+func (ca *ChaosAction) Validate() error {
+	if !chaosActionNamePattern.MatchString(ca.Name) {
+		return fmt.Errorf("chaos action name %q should be up to 40 lower case alphanumeric characters or '-'", ca.Name)
+	}
+	if d, err := time.ParseDuration(ca.At); err != nil || d < 0 {
+		return fmt.Errorf("chaos action %s should be at a duration after the start of the run, like 5m", ca.Name)
+	}
+	group, ok := chaosGroups[ca.Provider]
+	if !ok {
+		return fmt.Errorf("chaos action %s should use %s or %s", ca.Name, ChaosMesh, Litmus)
+	}
+	if !config.SC.ExecutorConfig.ChaosAllowed(ca.Namespace) {
+		return fmt.Errorf("chaos action %s cannot create experiments in namespace %q", ca.Name, ca.Namespace)
+	}
+	apiVersion, kind := ca.APIVersion()
+	if !strings.HasPrefix(apiVersion, group+"/") || kind == "" {
+		return fmt.Errorf("chaos action %s should create an experiment of the %s api group", ca.Name, group)
+	}
+	return nil
+}
+
+// ValidateChaosActions checks the actions of a collection
+func ValidateChaosActions(actions []*ChaosAction) error {
+	if len(config.SC.ExecutorConfig.ChaosNamespaces) == 0 {
+		return ErrChaosDisabled
+	}
+	if len(actions) > MaxChaosActions {
+		return fmt.Errorf("a collection can have up to %d chaos actions", MaxChaosActions)
+	}
+	names := map[string]bool{}
+	for _, ca := range actions {
+		if err := ca.Validate(); err != nil {
+			return err
+		}
+		if names[ca.Name] {
+			return fmt.Errorf("chaos action %s is defined twice", ca.Name)
+		}
+		names[ca.Name] = true
+	}
+	return nil
+}
+
+// GetChaosActions returns the chaos actions of the runs of the collection, none when it has none
+func (c *Collection) GetChaosActions() ([]*ChaosAction, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select actions from collection_chaos where collection_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	var raw string
+	actions := []*ChaosAction{}
+	err = q.QueryRow(c.ID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return actions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(raw), &actions); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// SetChaosActions replaces the chaos actions of the collection. They are removed when actions is empty
+func (c *Collection) SetChaosActions(actions []*ChaosAction) error {
+	if len(actions) == 0 {
+		return c.deleteChaosActions()
+	}
+	raw, err := json.Marshal(actions)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_chaos (collection_id, actions) values (?,?)
+		on duplicate key update actions=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID, string(raw), string(raw))
+	return err
+}
+
+func (c *Collection) deleteChaosActions() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_chaos where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
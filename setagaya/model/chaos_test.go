@@ -0,0 +1,54 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func podKill() *ChaosAction {
+	return &ChaosAction{
+		Name:      "kill-checkout",
+		At:        "5m",
+		Provider:  ChaosMesh,
+		Namespace: "shop",
+		Manifest: map[string]interface{}{
+			"apiVersion": "chaos-mesh.org/v1alpha1",
+			"kind":       "PodChaos",
+			"spec":       map[string]interface{}{"action": "pod-kill", "mode": "one"},
+		},
+	}
+}
+
+func TestValidateChaosActions(t *testing.T) {
+	ec := config.SC.ExecutorConfig
+	defer func() { config.SC.ExecutorConfig = ec }()
+
+	config.SC.ExecutorConfig = &config.ExecutorConfig{}
+	assert.ErrorIs(t, ValidateChaosActions([]*ChaosAction{podKill()}), ErrChaosDisabled)
+
+	config.SC.ExecutorConfig = &config.ExecutorConfig{ChaosNamespaces: []string{"shop"}}
+	assert.NoError(t, ValidateChaosActions(nil))
+	assert.NoError(t, ValidateChaosActions([]*ChaosAction{podKill()}))
+	assert.Equal(t, 5*time.Minute, podKill().Offset())
+
+	for _, change := range []func(*ChaosAction){
+		func(ca *ChaosAction) { ca.Name = "Kill_Checkout" },
+		func(ca *ChaosAction) { ca.At = "later" },
+		func(ca *ChaosAction) { ca.At = "-1m" },
+		func(ca *ChaosAction) { ca.Provider = "gremlin" },
+		func(ca *ChaosAction) { ca.Namespace = "setagaya" },
+		// The experiments are limited to the api group of the provider
+		func(ca *ChaosAction) { ca.Provider = Litmus },
+		func(ca *ChaosAction) { ca.Manifest["apiVersion"] = "apps/v1" },
+		func(ca *ChaosAction) { delete(ca.Manifest, "kind") },
+	} {
+		ca := podKill()
+		change(ca)
+		assert.Error(t, ValidateChaosActions([]*ChaosAction{ca}), ca)
+	}
+	assert.Error(t, ValidateChaosActions([]*ChaosAction{podKill(), podKill()}))
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// Sensitivity classes of the fields. A field is tagged with its class, e.g. `classification:"personal"`, and the
+// reads of the tagged fields through the admin endpoints are recorded in the audit log.
+const (
+	// Identifies a user, by their name or their e-mail address
+	ClassPersonal = "personal"
+	// Names and paths of the files the users uploaded
+	ClassFileMetadata = "file_metadata"
+)
+
+const classificationTag = "classification"
+
+// The values classified are the responses of the API, which are trees. The depth only guards against a cycle
+const maxClassifyDepth = 16
+
+// Classify returns the json names of the classified fields holding data in v, by class
+func Classify(v interface{}) map[string][]string {
+	found := map[string]map[string]bool{}
+	classify(reflect.ValueOf(v), found, 0)
+	classes := make(map[string][]string, len(found))
+	for class, fields := range found {
+		for field := range fields {
+			classes[class] = append(classes[class], field)
+		}
+		sort.Strings(classes[class])
+	}
+	return classes
+}
+
+func classify(v reflect.Value, found map[string]map[string]bool, depth int) {
+	if !v.IsValid() || depth > maxClassifyDepth {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			classify(v.Elem(), found, depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		// The slices of strings or of bytes cannot have classified fields, they are not walked
+		if v.Type().Elem().Kind() <= reflect.Complex128 || v.Type().Elem().Kind() == reflect.String {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			classify(v.Index(i), found, depth+1)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			classify(iter.Value(), found, depth+1)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			class := f.Tag.Get(classificationTag)
+			if class == "" {
+				classify(v.Field(i), found, depth+1)
+				continue
+			}
+			if isEmptyValue(v.Field(i)) {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if found[class] == nil {
+				found[class] = map[string]bool{}
+			}
+			found[class][name] = true
+		}
+	}
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// RecordClassifiedRead records in the audit log that the admin read the classified fields at the target, the url of
+// an admin endpoint
+func RecordClassifiedRead(actor, target string, classes map[string][]string) error {
+	names := make([]string, 0, len(classes))
+	for class := range classes {
+		names = append(names, class)
+	}
+	sort.Strings(names)
+	details := make([]string, len(names))
+	for i, class := range names {
+		details[i] = class + ": " + strings.Join(classes[class], ", ")
+	}
+	return recordAudit(config.SC.DBC, actor, AuditActionClassifiedRead, target, strings.Join(details, "; "))
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+func TestClassify(t *testing.T) {
+	deployments := []*Deployment{
+		{CollectionID: 1, ProjectOwner: "qa", LaunchedBy: "alice@example.com"},
+		{CollectionID: 2, ProjectOwner: "qa"},
+	}
+	assert.Equal(t, map[string][]string{ClassPersonal: {"launched_by", "project_owner"}}, Classify(deployments))
+
+	// The fields of the embedded structs and of the maps are classified too
+	files := map[string]*ProjectFile{"users.csv": {SetagayaFile: SetagayaFile{Filename: "users.csv",
+		Filepath: "project/1/users.csv"}}}
+	assert.Equal(t, map[string][]string{ClassFileMetadata: {"filename", "filepath"}}, Classify(files))
+
+	report := &object_storage.HealthReport{OutOfSync: []string{"plan/1/a.csv"}}
+	assert.Equal(t, map[string][]string{ClassFileMetadata: {"out_of_sync"}}, Classify(report))
+	report.OutOfSync = []string{}
+	assert.Empty(t, Classify(report))
+
+	// The empty fields are not read
+	assert.Empty(t, Classify(&Deployment{CollectionID: 1}))
+	assert.Empty(t, Classify([]*RunningPlan{{CollectionID: 1}}))
+	assert.Empty(t, Classify(nil))
+	assert.Empty(t, Classify("alice@example.com"))
+
+	// Nor the fields left out of the json
+	assert.Empty(t, Classify(struct {
+		Owner string `json:"-" classification:"personal"`
+		owner string `classification:"personal"`
+	}{"alice", "bob"}))
+}
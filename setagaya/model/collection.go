@@ -11,16 +11,19 @@ import (
 	"github.com/hveda/Setagaya/setagaya/config"
 	"github.com/hveda/Setagaya/setagaya/object_storage"
 
-	mysql "github.com/go-sql-driver/mysql"
 	log "github.com/sirupsen/logrus"
 )
 
 type SetagayaFile struct {
-	Filename     string `json:"filename"` // Name of the file - a.txt
-	Filepath     string `json:"filepath"` // Relative path of the file - /plan/22/a.txt
-	Filelink     string `json:"filelink"` // Full url for users to download the file - storage.com/setagaya/plan/22/a.txt
+	Filename     string `json:"filename" classification:"file_metadata"` // Name of the file - a.txt
+	Filepath     string `json:"filepath" classification:"file_metadata"` // Relative path of the file - /plan/22/a.txt
+	Filelink     string `json:"filelink" classification:"file_metadata"` // Full url for users to download the file - storage.com/setagaya/plan/22/a.txt
 	TotalSplits  int    `json:"total_splits"`
 	CurrentSplit int    `json:"current_split"`
+	// Region of the storage the file is kept in, empty for the default storage
+	Region string `json:"region,omitempty"`
+	// Fragment tells the jmx is a fragment of the project library included by the test plan, not the test plan
+	Fragment bool `json:"fragment,omitempty"`
 }
 
 type Collection struct {
@@ -32,6 +35,15 @@ type Collection struct {
 	CreatedTime    time.Time        `json:"created_time"`
 	Data           []*SetagayaFile  `json:"data"`
 	CSVSplit       bool             `json:"csv_split"`
+	// Markdown documenting the intent and the prerequisites of the collection. It's only returned when getting
+	// the collection
+	Description string `json:"description,omitempty"`
+	// Keeps the load on until the collection is stopped, nil for the collections of discrete runs
+	Continuous *ContinuousMode `json:"continuous,omitempty"`
+	// Runs the collection for days with checkpoints, nil for the regular runs
+	Soak *SoakMode `json:"soak,omitempty"`
+	// Passed to the engines of all the plans, unless a plan overrides them
+	Variables map[string]string `json:"variables,omitempty"`
 }
 
 type CollectionLaunchHistory struct {
@@ -63,18 +75,29 @@ func CreateCollection(name string, projectID int64) (int64, error) {
 func GetCollection(ID int64) (*Collection, error) {
 	DBC := config.SC.DBC
 
-	q, err := DBC.Prepare("select id, name, project_id, created_time, csv_split from collection where id=?")
+	q, err := DBC.Prepare(`select id, name, project_id, created_time, csv_split, coalesce(description, ''),
+		continuous, soak, variables from collection where id=?`)
 	if err != nil {
 		return nil, err
 	}
 	defer q.Close()
 
 	collection := new(Collection)
+	var continuous, soak, variables sql.NullString
 	err = q.QueryRow(ID).Scan(&collection.ID, &collection.Name, &collection.ProjectID,
-		&collection.CreatedTime, &collection.CSVSplit)
+		&collection.CreatedTime, &collection.CSVSplit, &collection.Description, &continuous, &soak, &variables)
 	if err != nil {
 		return nil, &DBError{Err: err, Message: "collection not found"}
 	}
+	if collection.Continuous, err = parseContinuousMode(continuous); err != nil {
+		return nil, err
+	}
+	if collection.Soak, err = parseSoakMode(soak); err != nil {
+		return nil, err
+	}
+	if collection.Variables, err = parseVariables(variables); err != nil {
+		return nil, err
+	}
 	if collection.Data, err = collection.getCollectionFiles(); err != nil {
 		return collection, err
 	}
@@ -89,6 +112,61 @@ func (c *Collection) Delete() error {
 	if err := c.DeleteRunHistory(); err != nil {
 		return err
 	}
+	// The baseline history is kept as an audit log
+	if err := c.deleteBaseline(); err != nil {
+		return err
+	}
+	if err := c.deleteCalibrationRuns(); err != nil {
+		return err
+	}
+	if err := c.deleteFailureCaptures(); err != nil {
+		return err
+	}
+	if err := c.deleteRunErrors(); err != nil {
+		return err
+	}
+	if err := c.deleteRunGaps(); err != nil {
+		return err
+	}
+	if err := c.deleteRunEngineConfigs(); err != nil {
+		return err
+	}
+	if err := c.deleteRunManifests(); err != nil {
+		return err
+	}
+	if err := c.deleteRunFiles(); err != nil {
+		return err
+	}
+	if err := c.deleteIdempotencyKeys(); err != nil {
+		return err
+	}
+	if err := c.deleteJobs(); err != nil {
+		return err
+	}
+	if err := c.deleteVerifications(); err != nil {
+		return err
+	}
+	if err := c.deleteChaosActions(); err != nil {
+		return err
+	}
+	if err := c.deleteRunEvents(); err != nil {
+		return err
+	}
+	if err := c.deleteSoakRuns(); err != nil {
+		return err
+	}
+	if err := c.deleteRunHeartbeats(); err != nil {
+		return err
+	}
+	if err := DeletePendingPlansByCollection(c.ID); err != nil {
+		return err
+	}
+	if err := c.deletePlanRetries(); err != nil {
+		return err
+	}
+	if err := c.deleteReservations(); err != nil {
+		return err
+	}
 	if err := c.DeleteAllFiles(); err != nil {
 		return err
 	}
@@ -112,13 +190,39 @@ func (c *Collection) AddExecutionPlan(ep *ExecutionPlan) error {
 	}
 	db := config.SC.DBC
 	q, err := db.Prepare(
-		"insert into collection_plan (plan_id, collection_id, rampup, concurrency, duration, engines, csv_split) values (?,?,?,?,?,?,?) on duplicate key update rampup=?, concurrency=?, duration=?, engines=?, csv_split=?")
+		"insert into collection_plan (plan_id, collection_id, rampup, concurrency, duration, engines, csv_split, target_rps, engine_type, os, arch, network_shaping, dns_caching, connection_policy, rampdown, concurrency_distribution, start_after, variables, warmup, max_engine_rps) values (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?) on duplicate key update rampup=?, concurrency=?, duration=?, engines=?, csv_split=?, target_rps=?, engine_type=?, os=?, arch=?, network_shaping=?, dns_caching=?, connection_policy=?, rampdown=?, concurrency_distribution=?, start_after=?, variables=?, warmup=?, max_engine_rps=?")
 	if err != nil {
 		return err
 	}
 	defer q.Close()
-	_, err = q.Exec(ep.PlanID, c.ID, ep.Rampup, ep.Concurrency, ep.Duration, ep.Engines, CSVSplitDB, ep.Rampup, ep.Concurrency,
-		ep.Duration, ep.Engines, CSVSplitDB)
+	engineType := ep.GetEngineType()
+	os := ep.GetOS()
+	networkShaping, err := ep.networkShapingDB()
+	if err != nil {
+		return err
+	}
+	dnsCaching, err := ep.dnsCachingDB()
+	if err != nil {
+		return err
+	}
+	connectionPolicy, err := ep.connectionPolicyDB()
+	if err != nil {
+		return err
+	}
+	concurrencyDistribution, err := ep.concurrencyDistributionDB()
+	if err != nil {
+		return err
+	}
+	startAfter, err := ep.startAfterDB()
+	if err != nil {
+		return err
+	}
+	variables, err := ep.variablesDB()
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ep.PlanID, c.ID, ep.Rampup, ep.Concurrency, ep.Duration, ep.Engines, CSVSplitDB, ep.TargetRPS, engineType, os, ep.Arch, networkShaping, dnsCaching, connectionPolicy, ep.Rampdown, concurrencyDistribution, startAfter, variables, ep.Warmup, ep.MaxEngineRPS,
+		ep.Rampup, ep.Concurrency, ep.Duration, ep.Engines, CSVSplitDB, ep.TargetRPS, engineType, os, ep.Arch, networkShaping, dnsCaching, connectionPolicy, ep.Rampdown, concurrencyDistribution, startAfter, variables, ep.Warmup, ep.MaxEngineRPS)
 	if err != nil {
 		return err
 	}
@@ -127,7 +231,7 @@ func (c *Collection) AddExecutionPlan(ep *ExecutionPlan) error {
 
 func (c *Collection) GetExecutionPlans() ([]*ExecutionPlan, error) {
 	db := config.SC.DBC
-	q, err := db.Prepare("select plan_id, rampup, concurrency, duration, engines, csv_split from collection_plan where collection_id=?")
+	q, err := db.Prepare("select plan_id, rampup, concurrency, duration, engines, csv_split, target_rps, engine_type, os, arch, network_shaping, dns_caching, connection_policy, rampdown, concurrency_distribution, start_after, variables, warmup, max_engine_rps from collection_plan where collection_id=?")
 	if err != nil {
 		return nil, err
 	}
@@ -141,8 +245,27 @@ func (c *Collection) GetExecutionPlans() ([]*ExecutionPlan, error) {
 	for rows.Next() {
 		ep := new(ExecutionPlan)
 		var CSVSplitDB int8
-		rows.Scan(&ep.PlanID, &ep.Rampup, &ep.Concurrency, &ep.Duration, &ep.Engines, &CSVSplitDB)
+		var networkShaping, dnsCaching, connectionPolicy, concurrencyDistribution, startAfter, variables []byte
+		rows.Scan(&ep.PlanID, &ep.Rampup, &ep.Concurrency, &ep.Duration, &ep.Engines, &CSVSplitDB, &ep.TargetRPS, &ep.EngineType, &ep.OS, &ep.Arch, &networkShaping, &dnsCaching, &connectionPolicy, &ep.Rampdown, &concurrencyDistribution, &startAfter, &variables, &ep.Warmup, &ep.MaxEngineRPS)
 		ep.CSVSplit = CSVSplitDB == 1
+		if err := ep.scanNetworkShaping(networkShaping); err != nil {
+			return nil, err
+		}
+		if err := ep.scanDNSCaching(dnsCaching); err != nil {
+			return nil, err
+		}
+		if err := ep.scanConnectionPolicy(connectionPolicy); err != nil {
+			return nil, err
+		}
+		if err := ep.scanConcurrencyDistribution(concurrencyDistribution); err != nil {
+			return nil, err
+		}
+		if err := ep.scanStartAfter(startAfter); err != nil {
+			return nil, err
+		}
+		if err := ep.scanVariables(variables); err != nil {
+			return nil, err
+		}
 		r = append(r, ep)
 	}
 	err = rows.Err()
@@ -154,7 +277,7 @@ func (c *Collection) GetExecutionPlans() ([]*ExecutionPlan, error) {
 
 func GetExecutionPlan(collectionID, planID int64) (*ExecutionPlan, error) {
 	db := config.SC.DBC
-	q, err := db.Prepare("select plan_id, rampup, concurrency, duration, engines, csv_split from collection_plan where collection_id=? and plan_id=?")
+	q, err := db.Prepare("select plan_id, rampup, concurrency, duration, engines, csv_split, target_rps, engine_type, os, arch, network_shaping, dns_caching, connection_policy, rampdown, concurrency_distribution, start_after, variables, warmup, max_engine_rps from collection_plan where collection_id=? and plan_id=?")
 	if err != nil {
 		return nil, err
 	}
@@ -162,11 +285,30 @@ func GetExecutionPlan(collectionID, planID int64) (*ExecutionPlan, error) {
 
 	ep := new(ExecutionPlan)
 	var CSVSplitDB int8
-	err = q.QueryRow(collectionID, planID).Scan(&ep.PlanID, &ep.Rampup, &ep.Concurrency, &ep.Duration, &ep.Engines, &CSVSplitDB)
+	var networkShaping, dnsCaching, connectionPolicy, concurrencyDistribution, startAfter, variables []byte
+	err = q.QueryRow(collectionID, planID).Scan(&ep.PlanID, &ep.Rampup, &ep.Concurrency, &ep.Duration, &ep.Engines, &CSVSplitDB, &ep.TargetRPS, &ep.EngineType, &ep.OS, &ep.Arch, &networkShaping, &dnsCaching, &connectionPolicy, &ep.Rampdown, &concurrencyDistribution, &startAfter, &variables, &ep.Warmup, &ep.MaxEngineRPS)
 	if err != nil {
 		return nil, err
 	}
 	ep.CSVSplit = CSVSplitDB == 1
+	if err := ep.scanNetworkShaping(networkShaping); err != nil {
+		return nil, err
+	}
+	if err := ep.scanDNSCaching(dnsCaching); err != nil {
+		return nil, err
+	}
+	if err := ep.scanConnectionPolicy(connectionPolicy); err != nil {
+		return nil, err
+	}
+	if err := ep.scanConcurrencyDistribution(concurrencyDistribution); err != nil {
+		return nil, err
+	}
+	if err := ep.scanStartAfter(startAfter); err != nil {
+		return nil, err
+	}
+	if err := ep.scanVariables(variables); err != nil {
+		return nil, err
+	}
 	return ep, nil
 }
 
@@ -197,6 +339,14 @@ func (c *Collection) DeleteExecutionPlans() error {
 		return err
 	}
 	defer rs.Close()
+	q2, err := db.Prepare("delete from collection_plan_region where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q2.Close()
+	if _, err = q2.Exec(c.ID); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -235,6 +385,11 @@ func (c *Collection) Store(ec *ExecutionCollection) error {
 	if err != nil {
 		return err
 	}
+	if !sameWorkload(currentPlans, ec.Tests) {
+		if err := c.deleteCalibrationRuns(); err != nil {
+			return err
+		}
+	}
 	delPending := []int64{}
 outer:
 	for _, cp := range currentPlans {
@@ -253,6 +408,9 @@ outer:
 		if addErr := c.AddExecutionPlan(ep); addErr != nil {
 			log.Printf("Error adding execution plan: %v", addErr)
 		}
+		if regionErr := c.StorePlanRegions(ep.PlanID, ep.Regions); regionErr != nil {
+			log.Printf("Error storing plan regions: %v", regionErr)
+		}
 	}
 	//remove deleted plans
 	for _, pid := range delPending {
@@ -260,12 +418,21 @@ outer:
 		if err != nil {
 			return err
 		}
+		if err = c.StorePlanRegions(pid, nil); err != nil {
+			return err
+		}
 	}
 	err = c.updateCollectionCSVSplit(ec.CSVSplit)
 	if err != nil {
 		return err
 	}
-	return nil
+	if err := c.updateCollectionContinuous(ec.Continuous); err != nil {
+		return err
+	}
+	if err := c.updateCollectionSoak(ec.Soak); err != nil {
+		return err
+	}
+	return c.updateCollectionVariables(ec.Variables)
 }
 
 func (c *Collection) MakeFileName(filename string) string {
@@ -281,10 +448,11 @@ func (c *Collection) StoreFile(content io.ReadCloser, filename string) error {
 	}
 	defer q.Close()
 	_, err = q.Query(c.ID, filename)
-	if driverErr, ok := err.(*mysql.MySQLError); ok {
-		if driverErr.Number == 1062 {
-			return errors.New("file already exists; if you wish to update it then delete existing one and upload again")
-		}
+	if isDuplicateEntry(err) {
+		return &RequestError{Err: err,
+			Message: "file already exists; if you wish to update it then delete existing one and upload again"}
+	}
+	if err != nil {
 		return err
 	}
 	return object_storage.Client.Storage.Upload(filenameForStorage, content)
@@ -389,10 +557,19 @@ func (c *Collection) RunFinish(runID int64) error {
 }
 
 type RunHistory struct {
-	ID           int64     `json:"id"`
-	CollectionID int64     `json:"collection_id"`
-	StartedTime  time.Time `json:"started_time"`
-	EndTime      time.Time `json:"end_time"`
+	ID           int64        `json:"id"`
+	CollectionID int64        `json:"collection_id"`
+	StartedTime  time.Time    `json:"started_time"`
+	EndTime      time.Time    `json:"end_time"`
+	Summary      *RunSummary  `json:"summary,omitempty"`
+	Metadata     *RunMetadata `json:"metadata,omitempty"`
+	Calibration  bool         `json:"calibration"`
+	// Periods whose samples are missing from the results
+	Gaps []*RunGap `json:"gaps,omitempty"`
+	// What happened to the system under test during the run, e.g. the chaos experiments
+	Events []*RunEvent `json:"events,omitempty"`
+	// Attempts to deploy and trigger again plans whose engines failed during the run
+	Retries []*PlanRetry `json:"retries,omitempty"`
 }
 
 func GetRun(runID int64) (*RunHistory, error) {
@@ -415,6 +592,30 @@ func GetRun(runID int64) (*RunHistory, error) {
 	return r, nil
 }
 
+// LoadDetails loads the summary, the metadata, the gaps, the events and the retries of the run
+func (r *RunHistory) LoadDetails() error {
+	// Runs that are still in progress or finished without any samples do not have a summary
+	if summary, err := GetRunSummary(r.ID); err == nil {
+		summary.CalculateThroughput(r.EndTime.Sub(r.StartedTime))
+		r.Summary = summary
+	}
+	if metadata, err := GetRunMetadata(r.ID); err == nil {
+		r.Metadata = metadata
+	}
+	var err error
+	if r.Calibration, err = IsCalibrationRun(r.ID); err != nil {
+		return err
+	}
+	if r.Gaps, err = GetRunGaps(r.ID); err != nil {
+		return err
+	}
+	if r.Events, err = GetRunEvents(r.ID); err != nil {
+		return err
+	}
+	r.Retries, err = GetPlanRetries(r.ID)
+	return err
+}
+
 func (c *Collection) GetRuns() ([]*RunHistory, error) {
 	db := config.SC.DBC
 	q, err := db.Prepare("select run_id, collection_id, started_time, end_time from collection_run_history where collection_id=? order by started_time desc")
@@ -437,22 +638,49 @@ func (c *Collection) GetRuns() ([]*RunHistory, error) {
 	return r, nil
 }
 
+// allocateRunID takes the next run id from the sequence. The update locks the row until the transaction ends,
+// so concurrent triggers get distinct ids, and ids are never reused as the counter only grows.
+func allocateRunID(tx *sql.Tx) (int64, error) {
+	r, err := tx.Exec("update run_id_sequence set id=LAST_INSERT_ID(id+1)")
+	if err != nil {
+		return int64(0), err
+	}
+	if n, err := r.RowsAffected(); err != nil || n != 1 {
+		return int64(0), errors.New("run id sequence is not initialised")
+	}
+	return r.LastInsertId()
+}
+
+// StartRun allocates the id of a new run and records the run, so it can be looked up as soon as it's triggered.
+// A collection can only have one run at a time.
 func (c *Collection) StartRun() (int64, error) {
 	db := config.SC.DBC
-	q, err := db.Prepare("insert into collection_run (collection_id) values(?)")
+	tx, err := db.BeginTx(context.TODO(), nil)
 	if err != nil {
 		return int64(0), err
 	}
-	defer q.Close()
-	r, err := q.Exec(c.ID)
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+	}()
+	runID, err := allocateRunID(tx)
 	if err != nil {
 		return int64(0), err
 	}
-	id, err := r.LastInsertId()
-	if err != nil {
-		return int64(0), &DBError{Err: err, Message: "You cannot start another run"}
+	if _, err = tx.Exec("insert into collection_run (id, collection_id) values(?, ?)", runID, c.ID); err != nil {
+		if isDuplicateEntry(err) {
+			return int64(0), &RequestError{Err: err, Message: "You cannot start another run"}
+		}
+		return int64(0), err
 	}
-	return id, err
+	if _, err = tx.Exec("insert into collection_run_history (collection_id, run_id) values (?, ?)", c.ID, runID); err != nil {
+		return int64(0), err
+	}
+	if err = tx.Commit(); err != nil {
+		return int64(0), err
+	}
+	return runID, nil
 }
 
 func (c *Collection) StopRun() error {
@@ -544,13 +772,10 @@ func (c *Collection) NewLaunchEntry(owner, cxt string, enginesCount, machinesCou
 		}
 	}()
 	r, err := tx.Exec("insert into collection_launch (collection_id) values(?)", c.ID)
+	if isDuplicateEntry(err) {
+		return &RequestError{Err: err, Message: "There is a launch in progress. Please either wait or purge."}
+	}
 	if err != nil {
-		if driverErr, ok := err.(*mysql.MySQLError); ok {
-			if driverErr.Number == 1062 {
-				return &DBError{Err: err, Message: "There is a launch in progress. Please either wait or purge."}
-			}
-			return err
-		}
 		return err
 	}
 	launchID, err := r.LastInsertId()
@@ -621,3 +846,96 @@ func GetLaunchingCollectionByContext(cxt string) ([]int64, error) {
 	}
 	return collectionIDs, nil
 }
+
+// GetLaunchingCollections returns the collections with a launch in progress, whatever controller launched them
+func GetLaunchingCollections() ([]int64, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select collection_id from collection_launch")
+	var collectionIDs []int64
+	if err != nil {
+		return collectionIDs, err
+	}
+	defer q.Close()
+	rs, err := q.Query()
+	if err != nil {
+		return collectionIDs, err
+	}
+	defer rs.Close()
+	for rs.Next() {
+		var cid int64
+		rs.Scan(&cid)
+		collectionIDs = append(collectionIDs, cid)
+	}
+	return collectionIDs, nil
+}
+
+// GetLaunchedEngines returns the number of engines launched by every context and not purged yet
+func GetLaunchedEngines() (map[string]int64, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select context, coalesce(sum(engines_count), 0) from collection_launch_history2 where end_time is null group by context")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rs, err := q.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	engines := make(map[string]int64)
+	for rs.Next() {
+		var cxt string
+		var count int64
+		if err := rs.Scan(&cxt, &count); err != nil {
+			return nil, err
+		}
+		engines[cxt] = count
+	}
+	return engines, rs.Err()
+}
+
+// Deployment is a collection launched and not purged yet, with who it belongs to
+type Deployment struct {
+	CollectionID   int64  `json:"collection_id"`
+	CollectionName string `json:"collection_name"`
+	ProjectID      int64  `json:"project_id"`
+	ProjectName    string `json:"project_name"`
+	ProjectOwner   string `json:"project_owner" classification:"personal"`
+	// Who launched the collection
+	LaunchedBy  string    `json:"launched_by" classification:"personal"`
+	Context     string    `json:"context"`
+	Engines     int64     `json:"engines"`
+	Nodes       int64     `json:"nodes"`
+	Vu          int64     `json:"vu"`
+	Running     bool      `json:"running"`
+	StartedTime time.Time `json:"started_time"`
+}
+
+// GetDeployments returns the collections launched by all the contexts and not purged yet, the oldest first
+func GetDeployments() ([]*Deployment, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select h.collection_id, c.name, p.id, p.name, p.owner, h.owner, h.context,
+		coalesce(h.engines_count, 0), coalesce(h.nodes_count, 0), coalesce(h.vu, 0),
+		exists(select 1 from running_plan r where r.collection_id=h.collection_id), h.started_time
+		from collection_launch_history2 h join collection c on c.id=h.collection_id join project p on p.id=c.project_id
+		where h.end_time is null order by h.started_time`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rs, err := q.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+	deployments := []*Deployment{}
+	for rs.Next() {
+		d := new(Deployment)
+		if err := rs.Scan(&d.CollectionID, &d.CollectionName, &d.ProjectID, &d.ProjectName, &d.ProjectOwner,
+			&d.LaunchedBy, &d.Context, &d.Engines, &d.Nodes, &d.Vu, &d.Running, &d.StartedTime); err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, d)
+	}
+	return deployments, rs.Err()
+}
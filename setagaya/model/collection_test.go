@@ -224,6 +224,11 @@ func TestCollectionRun(t *testing.T) {
 		t.Fatal(err)
 	}
 	assert.Equal(t, runIDExpected, runID)
+	// The run is recorded as soon as it's started
+	run, err := GetRun(runID)
+	assert.NoError(t, err)
+	assert.Equal(t, collectionID, run.CollectionID)
+	assert.True(t, run.EndTime.IsZero())
 	_, err = c.StartRun()
 	assert.NotNil(t, err)
 
@@ -233,4 +238,60 @@ func TestCollectionRun(t *testing.T) {
 	runID, err = c.GetCurrentRun()
 	assert.NoError(t, err)
 	assert.Equal(t, int64(0), runID)
+
+	// Ids are not reused once the previous run is stopped
+	nextRunID, err := c.StartRun()
+	assert.NoError(t, err)
+	assert.Greater(t, nextRunID, runIDExpected)
+	assert.NoError(t, c.StopRun())
+}
+
+func TestGetDeployments(t *testing.T) {
+	if os.Getenv("SETAGAYA_TEST_MODE") == "true" || config.SC.DBC == nil {
+		t.Skip("Skipping database test in test mode")
+		return
+	}
+
+	projectID, err := CreateProject("deployments", "team", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := GetProject(projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer project.Delete()
+	collectionID, err := CreateCollection("deployed", projectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetCollection(collectionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Delete()
+	if err := c.NewLaunchEntry("someone", "test", 3, 1, 30); err != nil {
+		t.Fatal(err)
+	}
+	deployments, err := GetDeployments()
+	assert.NoError(t, err)
+	var found *Deployment
+	for _, d := range deployments {
+		if d.CollectionID == collectionID {
+			found = d
+		}
+	}
+	if assert.NotNil(t, found) {
+		assert.Equal(t, "team", found.ProjectOwner)
+		assert.Equal(t, "someone", found.LaunchedBy)
+		assert.Equal(t, int64(3), found.Engines)
+		assert.False(t, found.Running)
+	}
+
+	assert.NoError(t, c.MarkUsageFinished("test", 30))
+	deployments, err = GetDeployments()
+	assert.NoError(t, err)
+	for _, d := range deployments {
+		assert.NotEqual(t, collectionID, d.CollectionID)
+	}
 }
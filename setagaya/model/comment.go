@@ -0,0 +1,222 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// MaxCommentSize is the size in bytes a comment can take at most
+const MaxCommentSize = 16 * 1024
+
+// A mention is @ followed by the name of a user, when it does not follow a word like in an email address
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.@])@([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// RunComment is a comment on a run, so the analysis of the results lives next to them. A comment either starts a
+// thread or replies to the comment starting it, replies to replies are added to the same thread.
+type RunComment struct {
+	ID           int64     `json:"id"`
+	RunID        int64     `json:"run_id"`
+	CollectionID int64     `json:"collection_id"`
+	ParentID     int64     `json:"parent_id,omitempty"`
+	Author       string    `json:"author"`
+	Body         string    `json:"body"`
+	Mentions     []string  `json:"mentions,omitempty"`
+	CreatedTime  time.Time `json:"created_time"`
+	// Replies of the thread, the oldest first
+	Replies []*RunComment `json:"replies,omitempty"`
+}
+
+func ValidateComment(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return fmt.Errorf("the comment cannot be empty")
+	}
+	if len(body) > MaxCommentSize {
+		return fmt.Errorf("the comment can take up to %d bytes", MaxCommentSize)
+	}
+	if !utf8.ValidString(body) {
+		return fmt.Errorf("the comment is not valid text")
+	}
+	return nil
+}
+
+// ParseMentions returns the users mentioned in the comment, in the order they are first mentioned
+func ParseMentions(body string) []string {
+	mentions := []string{}
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		// The end of a sentence is not part of the name
+		user := strings.TrimRight(m[1], ".-")
+		if user == "" || seen[user] {
+			continue
+		}
+		seen[user] = true
+		mentions = append(mentions, user)
+	}
+	return mentions
+}
+
+// excerpt shortens the text to size bytes at most without splitting a character
+func excerpt(s string, size int) string {
+	if len(s) <= size {
+		return s
+	}
+	end := 0
+	for i := range s {
+		if i > size-len("…") {
+			break
+		}
+		end = i
+	}
+	return s[:end] + "…"
+}
+
+const runCommentColumns = "id, run_id, collection_id, parent_id, author, body, created_time"
+
+func scanRunComment(row interface{ Scan(...any) error }) (*RunComment, error) {
+	c := new(RunComment)
+	if err := row.Scan(&c.ID, &c.RunID, &c.CollectionID, &c.ParentID, &c.Author, &c.Body, &c.CreatedTime); err != nil {
+		return nil, err
+	}
+	c.Mentions = ParseMentions(c.Body)
+	return c, nil
+}
+
+func GetRunComment(id int64) (*RunComment, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + runCommentColumns + " from run_comment where id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	c, err := scanRunComment(q.QueryRow(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &DBError{Err: err, Message: "comment not found"}
+	}
+	return c, err
+}
+
+// GetRunComments returns the threads of the run, the oldest first
+func GetRunComments(runID int64) ([]*RunComment, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + runCommentColumns + " from run_comment where run_id=? order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments := []*RunComment{}
+	for rows.Next() {
+		c, err := scanRunComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return makeThreads(comments), nil
+}
+
+// makeThreads nests the replies in the comments starting their thread. The comments are sorted by id, so a thread
+// is always started before its replies.
+func makeThreads(comments []*RunComment) []*RunComment {
+	threads := []*RunComment{}
+	byID := map[int64]*RunComment{}
+	for _, c := range comments {
+		if parent, ok := byID[c.ParentID]; ok {
+			parent.Replies = append(parent.Replies, c)
+			continue
+		}
+		if c.ParentID == 0 {
+			byID[c.ID] = c
+			threads = append(threads, c)
+		}
+	}
+	return threads
+}
+
+// AddRunComment adds the comment to the run and notifies the users mentioned in it. The reply to a reply is added
+// to the thread of the comment it replies to. readable tells whether a mentioned user can read the run, the others
+// are notified without the excerpt of the comment.
+func AddRunComment(run *RunHistory, parentID int64, author, body string,
+	readable func(user string) bool) (*RunComment, error) {
+	if err := ValidateComment(body); err != nil {
+		return nil, err
+	}
+	if parentID != 0 {
+		parent, err := GetRunComment(parentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent.RunID != run.ID {
+			return nil, &DBError{Err: sql.ErrNoRows, Message: "comment not found"}
+		}
+		if parent.ParentID != 0 {
+			parentID = parent.ParentID
+		}
+	}
+	db := config.SC.DBC
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	r, err := tx.Exec("insert into run_comment (run_id, collection_id, parent_id, author, body) values (?,?,?,?,?)",
+		run.ID, run.CollectionID, parentID, author, body)
+	if err != nil {
+		return nil, err
+	}
+	c := &RunComment{RunID: run.ID, CollectionID: run.CollectionID, ParentID: parentID, Author: author, Body: body,
+		Mentions: ParseMentions(body), CreatedTime: time.Now()}
+	if c.ID, err = r.LastInsertId(); err != nil {
+		return nil, err
+	}
+	message := excerpt(body, 255)
+	for _, user := range c.Mentions {
+		if user == author {
+			continue
+		}
+		n := &Notification{User: user, Kind: NotificationMention, Actor: author, CollectionID: c.CollectionID,
+			RunID: c.RunID, CommentID: c.ID}
+		if readable(user) {
+			n.Message = message
+		}
+		if err := notify(tx, n); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Delete deletes the comment, with its replies when it starts a thread, and the notifications of its mentions
+func (c *RunComment) Delete() error {
+	db := config.SC.DBC
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`delete from user_notification where comment_id in
+		(select id from run_comment where id=? or parent_id=?)`, c.ID, c.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("delete from run_comment where id=? or parent_id=?", c.ID, c.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	assert.Equal(t, []string{"alice", "bob.smith"},
+		ParseMentions("@alice the p99 regressed, @bob.smith can you check? cc @alice."))
+	assert.Equal(t, []string{"carol"}, ParseMentions("(@carol) see carol@example.com"))
+	assert.Empty(t, ParseMentions("no mentions@here nor @ alone"))
+}
+
+func TestValidateComment(t *testing.T) {
+	assert.NoError(t, ValidateComment("The throughput dropped after the deploy"))
+	assert.Error(t, ValidateComment(" \n"))
+	assert.Error(t, ValidateComment(strings.Repeat("a", MaxCommentSize+1)))
+	assert.Error(t, ValidateComment("\xff"))
+}
+
+func TestExcerpt(t *testing.T) {
+	assert.Equal(t, "short", excerpt("short", 255))
+	long := strings.Repeat("é", 200)
+	e := excerpt(long, 255)
+	assert.LessOrEqual(t, len(e), 255)
+	assert.True(t, utf8.ValidString(e))
+	assert.True(t, strings.HasSuffix(e, "…"))
+}
+
+func TestMakeThreads(t *testing.T) {
+	comments := []*RunComment{
+		{ID: 1},
+		{ID: 2},
+		{ID: 3, ParentID: 1},
+		{ID: 4, ParentID: 2},
+		{ID: 5, ParentID: 1},
+		// The thread was deleted
+		{ID: 6, ParentID: 9},
+	}
+	threads := makeThreads(comments)
+	assert.Len(t, threads, 2)
+	assert.Equal(t, []*RunComment{comments[2], comments[4]}, threads[0].Replies)
+	assert.Equal(t, []*RunComment{comments[3]}, threads[1].Replies)
+}
+
+func TestAddRunCommentMentions(t *testing.T) {
+	SetupLocalDatabase(t)
+	run := &RunHistory{ID: 5, CollectionID: 2}
+	readable := func(user string) bool { return user == "bob" }
+	c, err := AddRunComment(run, 0, "alice", "@bob @mallory the p99 regressed", readable)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob", "mallory"}, c.Mentions)
+
+	// The users who cannot read the run are still told they were mentioned, without what was said
+	notifications, err := GetNotifications("bob", false, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, notifications, 1) {
+		assert.Equal(t, "@bob @mallory the p99 regressed", notifications[0].Message)
+	}
+	notifications, err = GetNotifications("mallory", false, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, notifications, 1) {
+		assert.Empty(t, notifications[0].Message)
+		assert.Equal(t, int64(5), notifications[0].RunID)
+	}
+}
@@ -0,0 +1,170 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Strategies dividing the users of a plan across its engines
+const (
+	// Every engine runs the same share, the total has to be a multiple of the engines
+	ConcurrencyEqual = "equal"
+	// Every engine runs a share proportional to its weight
+	ConcurrencyWeighted = "weighted"
+	// Every engine runs the same share, and the first engines one more user each until the total is reached
+	ConcurrencyRemainder = "remainder"
+)
+
+// ConcurrencyDistribution divides a total of users across the engines of a plan. Without one, every engine runs the
+// concurrency of the plan.
+type ConcurrencyDistribution struct {
+	Strategy string `yaml:"strategy" json:"strategy"`
+	// Users of the plan across all of its engines
+	Total int `yaml:"total" json:"total"`
+	// One per engine, only for the weighted strategy
+	Weights []int `yaml:"weights,omitempty" json:"weights,omitempty"`
+}
+
+// Split returns the users of every engine. They add up to the total, and every engine runs at least one.
+func (cd *ConcurrencyDistribution) Split(engines int) ([]int, error) {
+	if engines <= 0 {
+		return nil, errors.New("the plan has no engine to split the users across")
+	}
+	if cd.Total < engines {
+		return nil, fmt.Errorf("%d users cannot be split across %d engines, every engine runs one at least", cd.Total,
+			engines)
+	}
+	if cd.Strategy != ConcurrencyWeighted && len(cd.Weights) > 0 {
+		return nil, fmt.Errorf("weights are only used by the %s strategy", ConcurrencyWeighted)
+	}
+	var shares []int
+	switch cd.Strategy {
+	case ConcurrencyEqual:
+		if cd.Total%engines != 0 {
+			return nil, fmt.Errorf("%d users cannot be split equally across %d engines, the %s strategy can spread the rest",
+				cd.Total, engines, ConcurrencyRemainder)
+		}
+		shares = splitRemainder(cd.Total, engines)
+	case ConcurrencyRemainder:
+		shares = splitRemainder(cd.Total, engines)
+	case ConcurrencyWeighted:
+		var err error
+		if shares, err = splitWeighted(cd.Total, cd.Weights, engines); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("concurrency strategy %q is not supported", cd.Strategy)
+	}
+	sum := 0
+	for _, s := range shares {
+		sum += s
+	}
+	if sum != cd.Total {
+		return nil, fmt.Errorf("the engines would run %d users instead of %d", sum, cd.Total)
+	}
+	return shares, nil
+}
+
+func splitRemainder(total, engines int) []int {
+	shares := make([]int, engines)
+	for i := range shares {
+		shares[i] = total / engines
+		if i < total%engines {
+			shares[i]++
+		}
+	}
+	return shares
+}
+
+// splitWeighted gives every engine the whole part of its share, and the users left to the engines with the largest
+// fractions, the first engines on ties
+func splitWeighted(total int, weights []int, engines int) ([]int, error) {
+	if len(weights) != engines {
+		return nil, fmt.Errorf("the %s strategy needs one weight per engine, %d instead of %d", ConcurrencyWeighted,
+			len(weights), engines)
+	}
+	sumWeights := 0
+	for _, w := range weights {
+		if w <= 0 {
+			return nil, errors.New("the weights of the engines should be positive")
+		}
+		sumWeights += w
+	}
+	shares := make([]int, engines)
+	fractions := make([]int, engines)
+	left := total
+	for i, w := range weights {
+		shares[i] = total * w / sumWeights
+		fractions[i] = total * w % sumWeights
+		left -= shares[i]
+	}
+	order := make([]int, engines)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return fractions[order[a]] > fractions[order[b]] })
+	for _, i := range order[:left] {
+		shares[i]++
+	}
+	for i, s := range shares {
+		if s == 0 {
+			return nil, fmt.Errorf("engine %d would not run any user with its weight", i)
+		}
+	}
+	return shares, nil
+}
+
+// EngineConcurrencies returns the users of every engine of the plan
+func (ep *ExecutionPlan) EngineConcurrencies() ([]int, error) {
+	if ep.ConcurrencyDistribution == nil {
+		shares := make([]int, ep.Engines)
+		for i := range shares {
+			shares[i] = ep.Concurrency
+		}
+		return shares, nil
+	}
+	return ep.ConcurrencyDistribution.Split(ep.Engines)
+}
+
+// TotalConcurrency is the users of the plan across all of its engines
+func (ep *ExecutionPlan) TotalConcurrency() int {
+	if ep.ConcurrencyDistribution == nil {
+		return ep.Engines * ep.Concurrency
+	}
+	return ep.ConcurrencyDistribution.Total
+}
+
+// ApplyConcurrencyDistribution checks the distribution of the plan, and sets its concurrency to the largest share
+// of its engines, what an engine has to be able to run
+func (ep *ExecutionPlan) ApplyConcurrencyDistribution() error {
+	if ep.ConcurrencyDistribution == nil {
+		return nil
+	}
+	shares, err := ep.ConcurrencyDistribution.Split(ep.Engines)
+	if err != nil {
+		return err
+	}
+	ep.Concurrency = 0
+	for _, s := range shares {
+		ep.Concurrency = max(ep.Concurrency, s)
+	}
+	return nil
+}
+
+// concurrencyDistributionDB is the json the distribution is stored as, nil when every engine runs the concurrency
+func (ep *ExecutionPlan) concurrencyDistributionDB() ([]byte, error) {
+	if ep.ConcurrencyDistribution == nil {
+		return nil, nil
+	}
+	return json.Marshal(ep.ConcurrencyDistribution)
+}
+
+func (ep *ExecutionPlan) scanConcurrencyDistribution(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	ep.ConcurrencyDistribution = new(ConcurrencyDistribution)
+	return json.Unmarshal(raw, ep.ConcurrencyDistribution)
+}
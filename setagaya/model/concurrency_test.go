@@ -0,0 +1,95 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyDistributionSplit(t *testing.T) {
+	cases := []struct {
+		name    string
+		cd      *ConcurrencyDistribution
+		engines int
+		want    []int
+	}{
+		{"equal", &ConcurrencyDistribution{Strategy: ConcurrencyEqual, Total: 90}, 3, []int{30, 30, 30}},
+		{"remainder", &ConcurrencyDistribution{Strategy: ConcurrencyRemainder, Total: 101}, 3, []int{34, 34, 33}},
+		{"remainder without rest", &ConcurrencyDistribution{Strategy: ConcurrencyRemainder, Total: 4}, 4,
+			[]int{1, 1, 1, 1}},
+		{"weighted", &ConcurrencyDistribution{Strategy: ConcurrencyWeighted, Total: 100, Weights: []int{2, 1, 1}}, 3,
+			[]int{50, 25, 25}},
+		// 7.7, 2.2 and 1.1: the user left goes to the largest fraction
+		{"weighted fractions", &ConcurrencyDistribution{Strategy: ConcurrencyWeighted, Total: 11, Weights: []int{7, 2, 1}},
+			3, []int{8, 2, 1}},
+		// The first engines get the users left on ties
+		{"weighted ties", &ConcurrencyDistribution{Strategy: ConcurrencyWeighted, Total: 100, Weights: []int{1, 1, 1}},
+			3, []int{34, 33, 33}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			shares, err := tc.cd.Split(tc.engines)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, shares)
+		})
+	}
+}
+
+func TestConcurrencyDistributionSplitErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		cd      *ConcurrencyDistribution
+		engines int
+	}{
+		{"not a multiple", &ConcurrencyDistribution{Strategy: ConcurrencyEqual, Total: 100}, 3},
+		{"fewer users than engines", &ConcurrencyDistribution{Strategy: ConcurrencyRemainder, Total: 2}, 3},
+		{"no engine", &ConcurrencyDistribution{Strategy: ConcurrencyRemainder, Total: 2}, 0},
+		{"unknown strategy", &ConcurrencyDistribution{Strategy: "random", Total: 10}, 2},
+		{"missing weights", &ConcurrencyDistribution{Strategy: ConcurrencyWeighted, Total: 10, Weights: []int{1}}, 2},
+		{"zero weight", &ConcurrencyDistribution{Strategy: ConcurrencyWeighted, Total: 10, Weights: []int{1, 0}}, 2},
+		{"weights of another strategy", &ConcurrencyDistribution{Strategy: ConcurrencyEqual, Total: 10,
+			Weights: []int{1, 1}}, 2},
+		// 99.9 and 0.1 users
+		{"engine without user", &ConcurrencyDistribution{Strategy: ConcurrencyWeighted, Total: 100,
+			Weights: []int{999, 1}}, 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.cd.Split(tc.engines)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExecutionPlanConcurrencies(t *testing.T) {
+	ep := &ExecutionPlan{Engines: 3, Concurrency: 10}
+	shares, err := ep.EngineConcurrencies()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{10, 10, 10}, shares)
+	assert.Equal(t, 30, ep.TotalConcurrency())
+	assert.NoError(t, ep.ApplyConcurrencyDistribution())
+	assert.Equal(t, 10, ep.Concurrency)
+
+	ep.ConcurrencyDistribution = &ConcurrencyDistribution{Strategy: ConcurrencyRemainder, Total: 100}
+	assert.NoError(t, ep.ApplyConcurrencyDistribution())
+	assert.Equal(t, 34, ep.Concurrency)
+	assert.Equal(t, 100, ep.TotalConcurrency())
+	shares, err = ep.EngineConcurrencies()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{34, 33, 33}, shares)
+}
+
+func TestScanConcurrencyDistribution(t *testing.T) {
+	ep := &ExecutionPlan{ConcurrencyDistribution: &ConcurrencyDistribution{Strategy: ConcurrencyWeighted, Total: 10,
+		Weights: []int{3, 2}}}
+	raw, err := ep.concurrencyDistributionDB()
+	assert.NoError(t, err)
+	scanned := new(ExecutionPlan)
+	assert.NoError(t, scanned.scanConcurrencyDistribution(raw))
+	assert.Equal(t, ep.ConcurrencyDistribution, scanned.ConcurrencyDistribution)
+
+	raw, err = new(ExecutionPlan).concurrencyDistributionDB()
+	assert.NoError(t, err)
+	assert.Nil(t, raw)
+	assert.NoError(t, scanned.scanConcurrencyDistribution(nil))
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ConnectionPolicy is how the jmeter engines of a plan open and reuse their HTTP connections. It overrides what the
+// samplers of the test plan set, as the connections change the results as much as the load does.
+type ConnectionPolicy struct {
+	// Whether the HTTP samplers keep their connection alive. nil keeps what each sampler sets
+	KeepAlive *bool `yaml:"keep_alive,omitempty" json:"keep_alive,omitempty"`
+	// The threads close their connections at the end of every iteration, like new users would
+	ResetEachIteration bool `yaml:"reset_each_iteration" json:"reset_each_iteration"`
+	// Milliseconds a connection is reused for. 0 keeps the default of jmeter
+	TTL int `yaml:"ttl" json:"ttl"`
+	// Connections an engine opens at most to a host. Every thread needs one, the rest is shared by the threads to
+	// download the embedded resources in parallel. 0 means no limit
+	MaxConnections int `yaml:"max_connections" json:"max_connections"`
+	// Milliseconds the first requests of the threads are spread over, so the connections are not all opened at once
+	Stagger int `yaml:"stagger" json:"stagger"`
+}
+
+func (cp *ConnectionPolicy) Validate(concurrency int) error {
+	if cp.TTL < 0 || cp.MaxConnections < 0 || cp.Stagger < 0 {
+		return errors.New("ttl, max connections and stagger cannot be negative")
+	}
+	if cp.MaxConnections > 0 && cp.MaxConnections < concurrency {
+		return fmt.Errorf("max connections %d is below the concurrency %d, every thread needs a connection",
+			cp.MaxConnections, concurrency)
+	}
+	return nil
+}
+
+// ParallelDownloads is the pool of connections every thread downloads the embedded resources with. 0 means the
+// resources are downloaded one after the other on the connection of the thread
+func (cp *ConnectionPolicy) ParallelDownloads(threads int) int {
+	if cp.MaxConnections == 0 || threads <= 0 {
+		return 0
+	}
+	return cp.MaxConnections/threads - 1
+}
+
+// ValidateConnectionPolicy checks the connection policy of a plan. Only the jmeter engines have one
+func ValidateConnectionPolicy(cp *ConnectionPolicy, engineType string, concurrency int) error {
+	if cp == nil {
+		return nil
+	}
+	if engineType != "" && engineType != JmeterEngine {
+		return fmt.Errorf("connection policies are only available to the %s plans", JmeterEngine)
+	}
+	return cp.Validate(concurrency)
+}
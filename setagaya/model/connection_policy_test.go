@@ -0,0 +1,30 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionPolicyValidate(t *testing.T) {
+	assert.NoError(t, (&ConnectionPolicy{}).Validate(100))
+	assert.NoError(t, (&ConnectionPolicy{TTL: 5000, MaxConnections: 100, Stagger: 2000}).Validate(100))
+	assert.Error(t, (&ConnectionPolicy{TTL: -1}).Validate(100))
+	assert.Error(t, (&ConnectionPolicy{Stagger: -1}).Validate(100))
+	assert.Error(t, (&ConnectionPolicy{MaxConnections: 50}).Validate(100))
+}
+
+func TestConnectionPolicyParallelDownloads(t *testing.T) {
+	assert.Equal(t, 0, (&ConnectionPolicy{}).ParallelDownloads(10))
+	assert.Equal(t, 0, (&ConnectionPolicy{MaxConnections: 15}).ParallelDownloads(10))
+	assert.Equal(t, 1, (&ConnectionPolicy{MaxConnections: 20}).ParallelDownloads(10))
+	assert.Equal(t, 5, (&ConnectionPolicy{MaxConnections: 60}).ParallelDownloads(10))
+	assert.Equal(t, 0, (&ConnectionPolicy{MaxConnections: 60}).ParallelDownloads(0))
+}
+
+func TestValidateConnectionPolicy(t *testing.T) {
+	assert.NoError(t, ValidateConnectionPolicy(nil, PlaywrightEngine, 10))
+	assert.NoError(t, ValidateConnectionPolicy(&ConnectionPolicy{}, "", 10))
+	assert.Error(t, ValidateConnectionPolicy(&ConnectionPolicy{}, PlaywrightEngine, 10))
+	assert.Error(t, ValidateConnectionPolicy(&ConnectionPolicy{MaxConnections: 5}, JmeterEngine, 10))
+}
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	DefaultContinuousWindow = 60
+	MinContinuousWindow     = 5
+	MaxContinuousWindow     = 24 * 60
+)
+
+// ContinuousMode keeps a constant load on the system under test until the collection is stopped, for the
+// steady-state capacity monitoring. The load is cut in windows, each of them a run of its own with its own results.
+// The plans run for the window instead of their duration and the engines are triggered again for the next window.
+type ContinuousMode struct {
+	// Minutes of the windows, 60 by default
+	Window int `yaml:"window" json:"window"`
+}
+
+// Validate fills the defaults of the mode. A nil mode is a collection of discrete runs
+func (cm *ContinuousMode) Validate() error {
+	if cm == nil {
+		return nil
+	}
+	if config.SC.ExecutorConfig.RunsOnce() {
+		return fmt.Errorf("the engines run once with the %s execution mode, they cannot run continuously",
+			config.ExecutionModeJob)
+	}
+	if cm.Window == 0 {
+		cm.Window = DefaultContinuousWindow
+	}
+	if cm.Window < MinContinuousWindow || cm.Window > MaxContinuousWindow {
+		return fmt.Errorf("the continuous window should be between %d and %d minutes", MinContinuousWindow,
+			MaxContinuousWindow)
+	}
+	return nil
+}
+
+// ApplyTo sets the plans to run for a window. The windows after the first start at full load, the engines ramped
+// up already, and the load does not ramp down between the windows.
+func (cm *ContinuousMode) ApplyTo(eps []*ExecutionPlan, nextWindow bool) {
+	for _, ep := range eps {
+		ep.Duration = cm.Window
+		ep.Rampdown = 0
+		if nextWindow {
+			ep.Rampup = 0
+		}
+	}
+}
+
+func (c *Collection) updateCollectionContinuous(cm *ContinuousMode) error {
+	continuous, err := jsonColumn(cm, cm == nil)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("update collection set continuous=? where id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(continuous, c.ID)
+	return err
+}
+
+func parseContinuousMode(continuous sql.NullString) (*ContinuousMode, error) {
+	if !continuous.Valid {
+		return nil, nil
+	}
+	cm := new(ContinuousMode)
+	if err := json.Unmarshal([]byte(continuous.String), cm); err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
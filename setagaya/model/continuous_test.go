@@ -0,0 +1,52 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestContinuousModeValidate(t *testing.T) {
+	var none *ContinuousMode
+	assert.NoError(t, none.Validate())
+
+	cm := new(ContinuousMode)
+	assert.NoError(t, cm.Validate())
+	assert.Equal(t, DefaultContinuousWindow, cm.Window)
+	assert.Error(t, (&ContinuousMode{Window: 1}).Validate())
+	assert.Error(t, (&ContinuousMode{Window: MaxContinuousWindow + 1}).Validate())
+
+	ec := config.SC.ExecutorConfig
+	defer func() { config.SC.ExecutorConfig = ec }()
+	config.SC.ExecutorConfig = &config.ExecutorConfig{ExecutionMode: config.ExecutionModeJob}
+	assert.Error(t, (&ContinuousMode{Window: 30}).Validate())
+}
+
+func TestContinuousModeApplyTo(t *testing.T) {
+	cm := &ContinuousMode{Window: 30}
+	eps := []*ExecutionPlan{{Duration: 5, Rampup: 60, Rampdown: 30}, {Duration: 10, Rampup: 0}}
+	cm.ApplyTo(eps, false)
+	assert.Equal(t, 30, eps[0].Duration)
+	assert.Equal(t, 60, eps[0].Rampup)
+	assert.Zero(t, eps[0].Rampdown)
+	assert.Equal(t, 30, eps[1].Duration)
+
+	cm.ApplyTo(eps, true)
+	assert.Equal(t, 0, eps[0].Rampup)
+}
+
+func TestParseContinuousMode(t *testing.T) {
+	raw, err := jsonColumn(&ContinuousMode{Window: 15}, false)
+	assert.NoError(t, err)
+	cm, err := parseContinuousMode(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, 15, cm.Window)
+
+	raw, err = jsonColumn((*ContinuousMode)(nil), true)
+	assert.NoError(t, err)
+	cm, err = parseContinuousMode(raw)
+	assert.NoError(t, err)
+	assert.Nil(t, cm)
+}
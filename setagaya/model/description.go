@@ -0,0 +1,63 @@
+package model
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// MaxDescriptionSize is the size in bytes the description of a project, a plan or a collection can take at most
+const MaxDescriptionSize = 32 * 1024
+
+// ValidateDescription checks the description is markdown text which is not too large. It's stored as it is and
+// rendered by the clients.
+func ValidateDescription(description string) error {
+	if len(description) > MaxDescriptionSize {
+		return fmt.Errorf("the description can take up to %d bytes", MaxDescriptionSize)
+	}
+	if !utf8.ValidString(description) {
+		return fmt.Errorf("the description is not valid text")
+	}
+	return nil
+}
+
+// The tables are constants, they are never given by the users
+func setDescription(table string, id int64, description string) error {
+	if err := ValidateDescription(description); err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	// #nosec G201 -- the table is one of the constants of this file
+	q, err := db.Prepare(fmt.Sprintf("update %s set description=? where id=?", table))
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(description, id)
+	return err
+}
+
+func (p *Project) SetDescription(description string) error {
+	if err := setDescription("project", p.ID, description); err != nil {
+		return err
+	}
+	p.Description = description
+	return nil
+}
+
+func (p *Plan) SetDescription(description string) error {
+	if err := setDescription("plan", p.ID, description); err != nil {
+		return err
+	}
+	p.Description = description
+	return nil
+}
+
+func (c *Collection) SetDescription(description string) error {
+	if err := setDescription("collection", c.ID, description); err != nil {
+		return err
+	}
+	c.Description = description
+	return nil
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDescription(t *testing.T) {
+	assert.NoError(t, ValidateDescription(""))
+	assert.NoError(t, ValidateDescription("# Checkout\n\nNeeds the `users.csv` of the **staging** accounts"))
+	assert.NoError(t, ValidateDescription(strings.Repeat("a", MaxDescriptionSize)))
+	assert.Error(t, ValidateDescription(strings.Repeat("a", MaxDescriptionSize+1)))
+	assert.Error(t, ValidateDescription("\xff\xfe"))
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const maxDNSServers = 5
+
+// DNSCaching controls how the jmeter engines of a plan cache the DNS lookups. The JVM can keep the addresses it
+// resolved first for the whole run, so the engines would not follow a DNS weighted or failing over deployment.
+type DNSCaching struct {
+	// Seconds the JVM caches the successful lookups. 0 means they are not cached
+	TTL int `yaml:"ttl" json:"ttl"`
+	// Seconds the JVM caches the failed lookups. 0 means they are not cached
+	NegativeTTL int `yaml:"negative_ttl" json:"negative_ttl"`
+	// Adds a DNS Cache Manager to the test plan, the threads resolve the hosts again at every iteration
+	ClearEachIteration bool `yaml:"clear_each_iteration" json:"clear_each_iteration"`
+	// Resolvers the DNS Cache Manager uses instead of the ones of the engine
+	Servers []string `yaml:"servers,omitempty" json:"servers,omitempty"`
+}
+
+func (dc *DNSCaching) Validate() error {
+	if dc.TTL < 0 || dc.NegativeTTL < 0 {
+		return errors.New("dns ttls cannot be negative")
+	}
+	if len(dc.Servers) > maxDNSServers {
+		return fmt.Errorf("at most %d dns servers can be set", maxDNSServers)
+	}
+	for _, s := range dc.Servers {
+		if net.ParseIP(s) == nil && len(validation.IsDNS1123Subdomain(s)) > 0 {
+			return fmt.Errorf("dns server %s should be an ip or a host name", s)
+		}
+	}
+	return nil
+}
+
+// UsesCacheManager tells whether the test plan needs a DNS Cache Manager
+func (dc *DNSCaching) UsesCacheManager() bool {
+	return dc.ClearEachIteration || len(dc.Servers) > 0
+}
+
+// JVMArgs set the ttls of the DNS cache of the JVM. They only apply when the networkaddress.cache.ttl security
+// properties are not set by the image
+func (dc *DNSCaching) JVMArgs() []string {
+	return []string{
+		fmt.Sprintf("-Dsun.net.inetaddr.ttl=%d", dc.TTL),
+		fmt.Sprintf("-Dsun.net.inetaddr.negative.ttl=%d", dc.NegativeTTL),
+	}
+}
+
+// ValidateDNSCaching checks the dns caching of a plan. Only the jmeter engines can control it
+func ValidateDNSCaching(dc *DNSCaching, engineType string) error {
+	if dc == nil {
+		return nil
+	}
+	if engineType != "" && engineType != JmeterEngine {
+		return fmt.Errorf("dns caching is only available to the %s plans", JmeterEngine)
+	}
+	return dc.Validate()
+}
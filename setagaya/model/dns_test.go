@@ -0,0 +1,34 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSCachingValidate(t *testing.T) {
+	assert.NoError(t, (&DNSCaching{}).Validate())
+	assert.NoError(t, (&DNSCaching{TTL: 30, NegativeTTL: 5, Servers: []string{"10.0.0.10", "dns.internal"}}).Validate())
+	assert.Error(t, (&DNSCaching{TTL: -1}).Validate())
+	assert.Error(t, (&DNSCaching{Servers: []string{"not a host"}}).Validate())
+	assert.Error(t, (&DNSCaching{Servers: []string{"a", "b", "c", "d", "e", "f"}}).Validate())
+}
+
+func TestDNSCachingCacheManager(t *testing.T) {
+	assert.False(t, (&DNSCaching{TTL: 30}).UsesCacheManager())
+	assert.True(t, (&DNSCaching{ClearEachIteration: true}).UsesCacheManager())
+	assert.True(t, (&DNSCaching{Servers: []string{"10.0.0.10"}}).UsesCacheManager())
+}
+
+func TestDNSCachingJVMArgs(t *testing.T) {
+	dc := &DNSCaching{TTL: 30, NegativeTTL: 5}
+	assert.Equal(t, []string{"-Dsun.net.inetaddr.ttl=30", "-Dsun.net.inetaddr.negative.ttl=5"}, dc.JVMArgs())
+}
+
+func TestValidateDNSCaching(t *testing.T) {
+	assert.NoError(t, ValidateDNSCaching(nil, PlaywrightEngine))
+	assert.NoError(t, ValidateDNSCaching(&DNSCaching{}, ""))
+	assert.NoError(t, ValidateDNSCaching(&DNSCaching{}, JmeterEngine))
+	assert.Error(t, ValidateDNSCaching(&DNSCaching{}, PlaywrightEngine))
+	assert.Error(t, ValidateDNSCaching(&DNSCaching{TTL: -1}, JmeterEngine))
+}
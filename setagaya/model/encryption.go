@@ -0,0 +1,144 @@
+package model
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// The encrypted fields are stored as enc:v1:<id of the key>:<nonce and ciphertext in base64>, so the key they were
+// encrypted with is known once it's rotated
+const encryptedFieldPrefix = "enc:v1:"
+
+var ErrEncryptionDisabled = errors.New("sensitive fields need an encryption_key in the secure config")
+
+type fieldKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// fieldCipher encrypts the fields with the key of the secure config, and decrypts them with it or a previous key
+type fieldCipher struct {
+	current *fieldKey
+	byID    map[string]*fieldKey
+}
+
+func newFieldKey(encoded string) (*fieldKey, error) {
+	key, err := config.DecodeEncryptionKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &fieldKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func newFieldCipher(sc *config.SecureConfig) (*fieldCipher, error) {
+	if sc == nil || sc.EncryptionKey == "" {
+		return nil, ErrEncryptionDisabled
+	}
+	fc := &fieldCipher{byID: make(map[string]*fieldKey)}
+	for i, encoded := range append([]string{sc.EncryptionKey}, sc.PreviousKeys...) {
+		k, err := newFieldKey(encoded)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			fc.current = k
+		}
+		fc.byID[k.id] = k
+	}
+	return fc, nil
+}
+
+func (fc *fieldCipher) encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, fc.current.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := fc.current.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedFieldPrefix + fc.current.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (fc *fieldCipher) decrypt(stored string) (string, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(stored, encryptedFieldPrefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted field")
+	}
+	k, ok := fc.byID[id]
+	if !ok {
+		return "", fmt.Errorf("the field is encrypted with key %s, which is not in the secure config", id)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < k.aead.NonceSize() {
+		return "", errors.New("malformed encrypted field")
+	}
+	plaintext, err := k.aead.Open(nil, sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt the field with key %s: %w", id, err)
+	}
+	return string(plaintext), nil
+}
+
+// EncryptedString is a field encrypted in the database with the key of the secure config. It's encrypted when it's
+// written and decrypted when it's read, the code using it only sees the plaintext. The fields written before they
+// were encrypted are read as they are.
+type EncryptedString string
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	fc, err := newFieldCipher(config.SC.Secure)
+	if err != nil {
+		return nil, err
+	}
+	return fc.encrypt(string(s))
+}
+
+func (s *EncryptedString) Scan(src interface{}) error {
+	var stored string
+	switch v := src.(type) {
+	case nil:
+		stored = ""
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("cannot read an encrypted field from %T", src)
+	}
+	if !strings.HasPrefix(stored, encryptedFieldPrefix) {
+		*s = EncryptedString(stored)
+		return nil
+	}
+	fc, err := newFieldCipher(config.SC.Secure)
+	if err != nil {
+		return err
+	}
+	plaintext, err := fc.decrypt(stored)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plaintext)
+	return nil
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	testEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	testPreviousKey   = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+	testPreviousValue = "old credentials"
+)
+
+func TestEncryptedString(t *testing.T) {
+	sc := config.SC.Secure
+	defer func() { config.SC.Secure = sc }()
+	config.SC.Secure = &config.SecureConfig{EncryptionKey: testEncryptionKey}
+
+	v, err := EncryptedString("vault://kv/payments/staging").Value()
+	assert.NoError(t, err)
+	stored := v.(string)
+	assert.True(t, strings.HasPrefix(stored, encryptedFieldPrefix))
+	assert.NotContains(t, stored, "payments")
+	// Every write has its own nonce
+	again, _ := EncryptedString("vault://kv/payments/staging").Value()
+	assert.NotEqual(t, stored, again)
+
+	var s EncryptedString
+	assert.NoError(t, s.Scan([]byte(stored)))
+	assert.Equal(t, EncryptedString("vault://kv/payments/staging"), s)
+
+	// The fields written before they were encrypted
+	assert.NoError(t, s.Scan("plain"))
+	assert.Equal(t, EncryptedString("plain"), s)
+	empty, err := EncryptedString("").Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "", empty)
+
+	// A tampered field is not decrypted
+	assert.Error(t, s.Scan(stored[:len(stored)-4]+"AAA="))
+}
+
+func TestEncryptedStringRotation(t *testing.T) {
+	sc := config.SC.Secure
+	defer func() { config.SC.Secure = sc }()
+	config.SC.Secure = &config.SecureConfig{EncryptionKey: testPreviousKey}
+	v, err := EncryptedString(testPreviousValue).Value()
+	assert.NoError(t, err)
+
+	// The fields encrypted with the previous key are still read once it's rotated
+	config.SC.Secure = &config.SecureConfig{EncryptionKey: testEncryptionKey, PreviousKeys: []string{testPreviousKey}}
+	var s EncryptedString
+	assert.NoError(t, s.Scan(v))
+	assert.Equal(t, EncryptedString(testPreviousValue), s)
+
+	// Not once it's dropped
+	config.SC.Secure = &config.SecureConfig{EncryptionKey: testEncryptionKey}
+	assert.Error(t, s.Scan(v))
+
+	config.SC.Secure = nil
+	_, err = EncryptedString("secret").Value()
+	assert.ErrorIs(t, err, ErrEncryptionDisabled)
+	assert.ErrorIs(t, s.Scan(v), ErrEncryptionDisabled)
+}
+
+func TestPlanSecretValidate(t *testing.T) {
+	ps := &PlanSecret{Name: "payments.staging", Kind: PlanSecretCredentialRef, Value: "vault://kv/payments"}
+	assert.NoError(t, ps.Validate())
+
+	for _, invalid := range []*PlanSecret{
+		{Name: "", Kind: PlanSecretCredentialRef, Value: "v"},
+		{Name: "1st", Kind: PlanSecretCredentialRef, Value: "v"},
+		{Name: "a b", Kind: PlanSecretCredentialRef, Value: "v"},
+		{Name: "hook", Kind: "password", Value: "v"},
+		{Name: "hook", Kind: PlanSecretWebhookSecret},
+		{Name: "hook", Kind: PlanSecretWebhookSecret, Value: EncryptedString(strings.Repeat("a", maxPlanSecretValueBytes+1))},
+	} {
+		assert.Error(t, invalid.Validate(), invalid.Name)
+	}
+}
@@ -1,5 +1,25 @@
 package model
 
+import (
+	"errors"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+// mysqlDuplicateEntry is the number of the errors of the inserts breaking a unique key
+const mysqlDuplicateEntry = 1062
+
+// The kinds of the errors of the model and of the controller. The API answers them with the status of their kind,
+// whatever wraps them, so the packages returning them do not need to know about http.
+var (
+	// ErrNotFound is the kind of the errors of the resources which do not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid is the kind of the errors of the requests which cannot be done, because they are invalid or the
+	// resource is not in a state allowing them
+	ErrInvalid = errors.New("invalid request")
+)
+
+// DBError is returned when a resource does not exist
 type DBError struct {
 	Err     error
 	Message string
@@ -8,3 +28,51 @@ type DBError struct {
 func (e *DBError) Error() string {
 	return e.Message
 }
+
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DBError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// RequestError is returned when the request cannot be done, e.g. retrying a plan of a collection which is not
+// running
+type RequestError struct {
+	Err     error
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RequestError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// ParameterError is returned when the run parameters supplied at trigger time do not match the
+// parameters declared by the plans
+type ParameterError struct {
+	Message string
+}
+
+func (e *ParameterError) Error() string {
+	return e.Message
+}
+
+func (e *ParameterError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// isDuplicateEntry tells whether the insert failed because the row is already there. The SQLite database of the
+// local mode reports it with the same error
+func isDuplicateEntry(err error) bool {
+	var driverErr *mysql.MySQLError
+	return errors.As(err, &driverErr) && driverErr.Number == mysqlDuplicateEntry
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -72,16 +73,14 @@ func TestDBErrorAsError(t *testing.T) {
 }
 
 func TestDBErrorUnwrap(t *testing.T) {
-	// Test that we can identify the nature of DBError by its content
 	originalErr := errors.New("connection timeout")
 	dbErr := &DBError{
 		Err:     originalErr,
 		Message: "database timeout",
 	}
 
-	// While DBError doesn't implement Unwrap, we can still access the original error
-	assert.Equal(t, originalErr, dbErr.Err)
-	assert.Contains(t, dbErr.Err.Error(), "connection timeout")
+	assert.ErrorIs(t, dbErr, originalErr)
+	assert.Equal(t, originalErr, errors.Unwrap(dbErr))
 	assert.Equal(t, "database timeout", dbErr.Message) // Test that the message is set correctly
 }
 
@@ -109,3 +108,21 @@ func TestDBErrorComparison(t *testing.T) {
 	assert.Equal(t, err1.Message, err2.Message)
 	assert.Equal(t, err1.Error(), err2.Error())
 }
+
+func TestErrorKinds(t *testing.T) {
+	notFound := fmt.Errorf("cannot retry: %w", &DBError{Message: "plan 1 is not in the collection"})
+	assert.ErrorIs(t, notFound, ErrNotFound)
+	assert.NotErrorIs(t, notFound, ErrInvalid)
+
+	cause := errors.New("duplicate entry")
+	invalid := fmt.Errorf("cannot launch: %w", &RequestError{Err: cause, Message: "There is a launch in progress"})
+	assert.ErrorIs(t, invalid, ErrInvalid)
+	assert.ErrorIs(t, invalid, cause)
+	assert.NotErrorIs(t, invalid, ErrNotFound)
+	assert.Equal(t, "cannot launch: There is a launch in progress", invalid.Error())
+
+	assert.ErrorIs(t, &ParameterError{Message: "missing parameter"}, ErrInvalid)
+	assert.NotErrorIs(t, errors.New("boom"), ErrNotFound)
+	assert.False(t, isDuplicateEntry(cause))
+	assert.False(t, isDuplicateEntry(nil))
+}
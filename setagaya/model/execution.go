@@ -1,13 +1,236 @@
 package model
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	JmeterEngine = "jmeter"
+	// Experimental. Runs Playwright browser scenarios and reports page timings and web vitals
+	PlaywrightEngine = "playwright"
+
+	LinuxOS = "linux"
+	// Only jmeter engines run on windows, for the protocols only windows clients speak
+	WindowsOS = "windows"
+
+	AMD64Arch = "amd64"
+	ARM64Arch = "arm64"
+)
+
 type ExecutionPlan struct {
 	Name        string `yaml:"name" json:"name"`
 	PlanID      int64  `yaml:"testid" json:"plan_id"`
 	Concurrency int    `yaml:"concurrency" json:"concurrency"`
 	Rampup      int    `yaml:"rampup" json:"rampup"`
-	Engines     int    `yaml:"engines" json:"engines"`
-	Duration    int    `yaml:"duration" json:"duration"`
-	CSVSplit    bool   `yaml:"csv_split" json:"csv_split"` // go-sql-driver does not support tinyint mapped to bool directly: https://github.com/go-sql-driver/mysql/issues/440
+	// Seconds the threads take to stop at the end of the run, so their connections drain. 0 stops them at once
+	Rampdown int `yaml:"rampdown,omitempty" json:"rampdown"`
+	// Seconds at the start of the run whose samples are left out of the summary and the SLOs. 0 keeps them all
+	Warmup   int  `yaml:"warmup,omitempty" json:"warmup"`
+	Engines  int  `yaml:"engines" json:"engines"`
+	Duration int  `yaml:"duration" json:"duration"`
+	CSVSplit bool `yaml:"csv_split" json:"csv_split"` // go-sql-driver does not support tinyint mapped to bool directly: https://github.com/go-sql-driver/mysql/issues/440
+	// Total requests per second the plan should hold across all of its engines. 0 means no throughput control
+	TargetRPS int `yaml:"target_rps" json:"target_rps"`
+	// Requests per second every engine of a jmeter plan sends at most, whatever its concurrency and its target. It's
+	// a safety net against a concurrency multiplied by mistake. 0 means no cap
+	MaxEngineRPS int `yaml:"max_engine_rps,omitempty" json:"max_engine_rps"`
+	// Optional geographic distribution of the engines. Weights are in percentage and must add up to 100
+	Regions []*RegionWeight `yaml:"regions,omitempty" json:"regions,omitempty"`
+	// Engine running the plan. Empty means jmeter
+	EngineType string `yaml:"engine_type,omitempty" json:"engine_type"`
+	// Operating system of the nodes the engines run on. Empty means linux
+	OS string `yaml:"os,omitempty" json:"os"`
+	// CPU architecture of the nodes the engines run on. Empty means any node, whatever its architecture
+	Arch string `yaml:"arch,omitempty" json:"arch"`
+	// Egress network of the engines, to emulate constrained clients. nil means the network of the cluster
+	NetworkShaping *config.NetworkShaping `yaml:"network_shaping,omitempty" json:"network_shaping,omitempty"`
+	// DNS cache of the jmeter engines. nil means the defaults of the JVM
+	DNSCaching *DNSCaching `yaml:"dns_caching,omitempty" json:"dns_caching,omitempty"`
+	// HTTP connections of the jmeter engines. nil keeps what the test plan sets
+	ConnectionPolicy *ConnectionPolicy `yaml:"connection_policy,omitempty" json:"connection_policy,omitempty"`
+	// Divides a total of users across the engines. nil means every engine runs the concurrency
+	ConcurrencyDistribution *ConcurrencyDistribution `yaml:"concurrency_distribution,omitempty" json:"concurrency_distribution,omitempty"`
+	// Delays the start of the plan in the runs until another plan ran for a while. nil starts it with the run
+	StartAfter *PlanDependency `yaml:"start_after,omitempty" json:"start_after,omitempty"`
+	// Values overriding the variables of the collection for this plan
+	Variables map[string]string `yaml:"variables,omitempty" json:"variables,omitempty"`
+}
+
+// Phases of a plan in progress
+const (
+	PlanPhaseRampup   = "ramp_up"
+	PlanPhaseSteady   = "steady"
+	PlanPhaseRampdown = "ramp_down"
+	// The duration is over, the engines are finishing their last samples
+	PlanPhaseEnding = "ending"
+)
+
+// ValidatePhases checks the ramp-up and the ramp-down fit in the duration of the plan
+func (ep *ExecutionPlan) ValidatePhases() error {
+	if ep.Rampup < 0 || ep.Rampdown < 0 {
+		return errors.New("ramp up and ramp down cannot be negative")
+	}
+	if ep.Rampup+ep.Rampdown > ep.Duration*60 {
+		return errors.New("ramp up and ramp down cannot last longer than the duration")
+	}
+	if ep.Warmup < 0 {
+		return errors.New("warm up cannot be negative")
+	}
+	if ep.Warmup > 0 && ep.Warmup >= ep.Duration*60 {
+		return errors.New("warm up should end before the duration")
+	}
+	return nil
+}
+
+// ValidateMaxEngineRPS checks the cap of the engines of the plan. They have to be able to hold its target together
+func (ep *ExecutionPlan) ValidateMaxEngineRPS() error {
+	if ep.MaxEngineRPS < 0 {
+		return errors.New("max engine RPS cannot be negative")
+	}
+	if ep.MaxEngineRPS == 0 {
+		return nil
+	}
+	if ep.GetEngineType() != JmeterEngine {
+		return errors.New("max engine RPS is only supported by jmeter plans")
+	}
+	if ep.TargetRPS > ep.MaxEngineRPS*ep.Engines {
+		return fmt.Errorf("%d engines capped at %d rps cannot hold the target of %d rps", ep.Engines, ep.MaxEngineRPS,
+			ep.TargetRPS)
+	}
+	return nil
+}
+
+// Phase is the phase of the plan after it ran for elapsed
+func (ep *ExecutionPlan) Phase(elapsed time.Duration) string {
+	duration := time.Duration(ep.Duration) * time.Minute
+	switch {
+	case elapsed >= duration:
+		return PlanPhaseEnding
+	case elapsed < time.Duration(ep.Rampup)*time.Second:
+		return PlanPhaseRampup
+	case elapsed >= duration-time.Duration(ep.Rampdown)*time.Second:
+		return PlanPhaseRampdown
+	}
+	return PlanPhaseSteady
+}
+
+// GetEngineType returns the engine type of the plan, falling back to jmeter for plans created before
+// engine types were introduced
+func (ep *ExecutionPlan) GetEngineType() string {
+	if ep.EngineType == "" {
+		return JmeterEngine
+	}
+	return ep.EngineType
+}
+
+// GetOS returns the operating system the engines of the plan run on
+func (ep *ExecutionPlan) GetOS() string {
+	if ep.OS == "" {
+		return LinuxOS
+	}
+	return ep.OS
+}
+
+func ValidateOS(os, engineType string) error {
+	switch os {
+	case "", LinuxOS:
+		return nil
+	case WindowsOS:
+		if engineType != "" && engineType != JmeterEngine {
+			return fmt.Errorf("only jmeter engines run on %s", os)
+		}
+		return nil
+	}
+	return fmt.Errorf("os %s is not supported", os)
+}
+
+// networkShapingDB is the json the network shaping is stored as, nil when the plan does not shape its network
+func (ep *ExecutionPlan) networkShapingDB() ([]byte, error) {
+	if ep.NetworkShaping == nil {
+		return nil, nil
+	}
+	return json.Marshal(ep.NetworkShaping)
+}
+
+func (ep *ExecutionPlan) scanNetworkShaping(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	ep.NetworkShaping = new(config.NetworkShaping)
+	return json.Unmarshal(raw, ep.NetworkShaping)
+}
+
+// dnsCachingDB is the json the dns caching is stored as, nil when the plan keeps the defaults
+func (ep *ExecutionPlan) dnsCachingDB() ([]byte, error) {
+	if ep.DNSCaching == nil {
+		return nil, nil
+	}
+	return json.Marshal(ep.DNSCaching)
+}
+
+func (ep *ExecutionPlan) scanDNSCaching(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	ep.DNSCaching = new(DNSCaching)
+	return json.Unmarshal(raw, ep.DNSCaching)
+}
+
+// connectionPolicyDB is the json the connection policy is stored as, nil when the plan has none
+func (ep *ExecutionPlan) connectionPolicyDB() ([]byte, error) {
+	if ep.ConnectionPolicy == nil {
+		return nil, nil
+	}
+	return json.Marshal(ep.ConnectionPolicy)
+}
+
+func (ep *ExecutionPlan) scanConnectionPolicy(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	ep.ConnectionPolicy = new(ConnectionPolicy)
+	return json.Unmarshal(raw, ep.ConnectionPolicy)
+}
+
+// ValidateNetworkShaping checks the shaping of a plan can be applied on the cluster
+func ValidateNetworkShaping(ns *config.NetworkShaping, os string, shaper *config.NetworkShaper) error {
+	if ns == nil {
+		return nil
+	}
+	if shaper == nil {
+		return errors.New("network shaping is not enabled on this cluster")
+	}
+	if os == WindowsOS {
+		return fmt.Errorf("network shaping is not available to the %s engines", os)
+	}
+	return ns.Validate()
+}
+
+// ValidateArch checks the architecture of a plan. The windows engine image is only built for amd64
+func ValidateArch(arch, os string) error {
+	switch arch {
+	case "", AMD64Arch:
+		return nil
+	case ARM64Arch:
+		if os == WindowsOS {
+			return fmt.Errorf("%s engines do not run on %s", os, arch)
+		}
+		return nil
+	}
+	return fmt.Errorf("architecture %s is not supported", arch)
+}
+
+func ValidateEngineType(engineType string) error {
+	switch engineType {
+	case "", JmeterEngine, PlaywrightEngine:
+		return nil
+	}
+	return fmt.Errorf("engine type %s is not supported", engineType)
 }
 
 type ExecutionCollection struct {
@@ -16,6 +239,10 @@ type ExecutionCollection struct {
 	CollectionID int64            `yaml:"collectionid"`
 	Tests        []*ExecutionPlan `yaml:"tests"`
 	CSVSplit     bool             `yaml:"csv_split"`
+	Continuous   *ContinuousMode  `yaml:"continuous,omitempty"`
+	Soak         *SoakMode        `yaml:"soak,omitempty"`
+	// Passed to the engines of all the plans along with the parameters, e.g. the target host
+	Variables map[string]string `yaml:"variables,omitempty"`
 }
 
 type ExecutionWrapper struct {
@@ -3,10 +3,13 @@ package model
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
 )
 
 func TestExecutionPlan(t *testing.T) {
@@ -373,3 +376,139 @@ multi-test:
 	assert.Equal(t, 900, test2.Duration)
 	assert.True(t, test2.CSVSplit)
 }
+
+func TestExecutionPlanEngineType(t *testing.T) {
+	ep := &ExecutionPlan{}
+	assert.Equal(t, JmeterEngine, ep.GetEngineType())
+	ep.EngineType = PlaywrightEngine
+	assert.Equal(t, PlaywrightEngine, ep.GetEngineType())
+
+	assert.NoError(t, ValidateEngineType(""))
+	assert.NoError(t, ValidateEngineType(JmeterEngine))
+	assert.NoError(t, ValidateEngineType(PlaywrightEngine))
+	assert.Error(t, ValidateEngineType("gatling"))
+}
+
+func TestExecutionPlanOS(t *testing.T) {
+	ep := &ExecutionPlan{}
+	assert.Equal(t, LinuxOS, ep.GetOS())
+	ep.OS = WindowsOS
+	assert.Equal(t, WindowsOS, ep.GetOS())
+
+	assert.NoError(t, ValidateOS("", ""))
+	assert.NoError(t, ValidateOS(LinuxOS, PlaywrightEngine))
+	assert.NoError(t, ValidateOS(WindowsOS, ""))
+	assert.NoError(t, ValidateOS(WindowsOS, JmeterEngine))
+	assert.Error(t, ValidateOS(WindowsOS, PlaywrightEngine))
+	assert.Error(t, ValidateOS("darwin", JmeterEngine))
+}
+
+func TestValidateNetworkShaping(t *testing.T) {
+	shaper := &config.NetworkShaper{Image: "setagaya:shaper"}
+	ns := &config.NetworkShaping{Rate: "1mbit"}
+	assert.NoError(t, ValidateNetworkShaping(nil, LinuxOS, nil))
+	assert.NoError(t, ValidateNetworkShaping(ns, "", shaper))
+	assert.Error(t, ValidateNetworkShaping(ns, "", nil))
+	assert.Error(t, ValidateNetworkShaping(ns, WindowsOS, shaper))
+	assert.Error(t, ValidateNetworkShaping(&config.NetworkShaping{}, "", shaper))
+}
+
+func TestExecutionPlanNetworkShapingDB(t *testing.T) {
+	ep := &ExecutionPlan{}
+	raw, err := ep.networkShapingDB()
+	assert.NoError(t, err)
+	assert.Nil(t, raw)
+	assert.NoError(t, ep.scanNetworkShaping(raw))
+	assert.Nil(t, ep.NetworkShaping)
+
+	ep.NetworkShaping = &config.NetworkShaping{Rate: "1mbit", Delay: 100}
+	raw, err = ep.networkShapingDB()
+	assert.NoError(t, err)
+	scanned := &ExecutionPlan{}
+	assert.NoError(t, scanned.scanNetworkShaping(raw))
+	assert.Equal(t, ep.NetworkShaping, scanned.NetworkShaping)
+}
+
+func TestExecutionPlanDNSCachingDB(t *testing.T) {
+	ep := &ExecutionPlan{}
+	raw, err := ep.dnsCachingDB()
+	assert.NoError(t, err)
+	assert.Nil(t, raw)
+
+	ep.DNSCaching = &DNSCaching{TTL: 0, ClearEachIteration: true, Servers: []string{"10.0.0.10"}}
+	raw, err = ep.dnsCachingDB()
+	assert.NoError(t, err)
+	scanned := &ExecutionPlan{}
+	assert.NoError(t, scanned.scanDNSCaching(raw))
+	assert.Equal(t, ep.DNSCaching, scanned.DNSCaching)
+}
+
+func TestExecutionPlanConnectionPolicyDB(t *testing.T) {
+	keepAlive := false
+	ep := &ExecutionPlan{ConnectionPolicy: &ConnectionPolicy{KeepAlive: &keepAlive, MaxConnections: 100}}
+	raw, err := ep.connectionPolicyDB()
+	assert.NoError(t, err)
+	scanned := &ExecutionPlan{}
+	assert.NoError(t, scanned.scanConnectionPolicy(raw))
+	assert.Equal(t, ep.ConnectionPolicy, scanned.ConnectionPolicy)
+	assert.NoError(t, scanned.scanConnectionPolicy(nil))
+}
+
+func TestValidateArch(t *testing.T) {
+	assert.NoError(t, ValidateArch("", WindowsOS))
+	assert.NoError(t, ValidateArch(AMD64Arch, WindowsOS))
+	assert.NoError(t, ValidateArch(ARM64Arch, ""))
+	assert.NoError(t, ValidateArch(ARM64Arch, LinuxOS))
+	assert.Error(t, ValidateArch(ARM64Arch, WindowsOS))
+	assert.Error(t, ValidateArch("s390x", LinuxOS))
+}
+
+func TestIsTestFile(t *testing.T) {
+	assert.True(t, IsTestFile("plan.jmx"))
+	assert.True(t, IsTestFile("checkout.spec.js"))
+	assert.True(t, IsTestFile("checkout.spec.ts"))
+	assert.False(t, IsTestFile("helpers.js"))
+	assert.False(t, IsTestFile("users.csv"))
+}
+
+func TestExecutionPlanValidatePhases(t *testing.T) {
+	assert.NoError(t, (&ExecutionPlan{Duration: 10, Rampup: 60, Rampdown: 60}).ValidatePhases())
+	assert.NoError(t, (&ExecutionPlan{Duration: 2, Rampup: 60, Rampdown: 60}).ValidatePhases())
+	assert.Error(t, (&ExecutionPlan{Duration: 2, Rampup: 60, Rampdown: 61}).ValidatePhases())
+	assert.Error(t, (&ExecutionPlan{Duration: 10, Rampdown: -1}).ValidatePhases())
+	assert.NoError(t, (&ExecutionPlan{Duration: 10, Warmup: 120}).ValidatePhases())
+	assert.Error(t, (&ExecutionPlan{Duration: 2, Warmup: 120}).ValidatePhases())
+	assert.Error(t, (&ExecutionPlan{Duration: 10, Warmup: -1}).ValidatePhases())
+}
+
+func TestExecutionPlanPhase(t *testing.T) {
+	ep := &ExecutionPlan{Duration: 10, Rampup: 60, Rampdown: 120}
+	assert.Equal(t, PlanPhaseRampup, ep.Phase(30*time.Second))
+	assert.Equal(t, PlanPhaseSteady, ep.Phase(time.Minute))
+	assert.Equal(t, PlanPhaseSteady, ep.Phase(7*time.Minute+59*time.Second))
+	assert.Equal(t, PlanPhaseRampdown, ep.Phase(8*time.Minute))
+	assert.Equal(t, PlanPhaseEnding, ep.Phase(10*time.Minute))
+
+	// Without a ramp-down the plan is steady until the end of its duration
+	ep.Rampdown = 0
+	assert.Equal(t, PlanPhaseSteady, ep.Phase(9*time.Minute+59*time.Second))
+}
+
+func TestValidateMaxEngineRPS(t *testing.T) {
+	ep := &ExecutionPlan{Engines: 4, TargetRPS: 400}
+	assert.NoError(t, ep.ValidateMaxEngineRPS())
+	ep.MaxEngineRPS = 100
+	assert.NoError(t, ep.ValidateMaxEngineRPS())
+
+	// The engines cannot hold the target under their cap
+	ep.MaxEngineRPS = 99
+	assert.Error(t, ep.ValidateMaxEngineRPS())
+	ep.TargetRPS = 0
+	assert.NoError(t, ep.ValidateMaxEngineRPS())
+
+	ep.MaxEngineRPS = -1
+	assert.Error(t, ep.ValidateMaxEngineRPS())
+	ep.MaxEngineRPS = 10
+	ep.EngineType = PlaywrightEngine
+	assert.Error(t, ep.ValidateMaxEngineRPS())
+}
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+const (
+	DefaultFailureCaptureSamples = 20
+	MaxFailureCaptureSamples     = 200
+	// Captured response bodies are truncated to this size
+	FailureCaptureBodyLimit = 4096
+)
+
+// FailureCapture asks the engines to keep a random sample of the failing responses(status >= 400) of the run
+type FailureCapture struct {
+	// Probability of a failing response to be captured
+	Rate float64 `json:"rate"`
+	// Maximum number of responses captured by each engine. 0 means DefaultFailureCaptureSamples
+	MaxSamples int `json:"max_samples"`
+}
+
+func (fc *FailureCapture) Validate() error {
+	if fc == nil {
+		return nil
+	}
+	if fc.Rate <= 0 || fc.Rate > 1 {
+		return errors.New("failure capture rate should be greater than 0 and at most 1")
+	}
+	if fc.MaxSamples < 0 || fc.MaxSamples > MaxFailureCaptureSamples {
+		return fmt.Errorf("failure capture max samples should be between 0 and %d", MaxFailureCaptureSamples)
+	}
+	return nil
+}
+
+func (fc *FailureCapture) GetMaxSamples() int {
+	if fc.MaxSamples == 0 {
+		return DefaultFailureCaptureSamples
+	}
+	return fc.MaxSamples
+}
+
+// FailedResponse is a failing response captured by an engine
+type FailedResponse struct {
+	PlanID          int64  `json:"plan_id"`
+	EngineID        int    `json:"engine_id"`
+	Label           string `json:"label"`
+	ResponseCode    string `json:"response_code"`
+	ResponseMessage string `json:"response_message"`
+	URL             string `json:"url"`
+	Timestamp       int64  `json:"timestamp"`
+	ResponseHeaders string `json:"response_headers"`
+	ResponseBody    string `json:"response_body"`
+	// True when the body was longer than FailureCaptureBodyLimit
+	Truncated bool `json:"truncated"`
+}
+
+// FailureCaptureFile is the object uploaded by an engine with the failing responses it captured
+type FailureCaptureFile struct {
+	Filename string `json:"filename"`
+	Samples  int    `json:"samples"`
+	// Team of the plan of the engine, set by the controller
+	Team string `json:"team,omitempty"`
+}
+
+func MakeFailureCaptureFilename(runID, planID int64, engineID int) string {
+	return fmt.Sprintf("run/%d/failures-%d-%d.json", runID, planID, engineID)
+}
+
+func StoreFailureCaptureFile(collectionID, runID, planID int64, engineID int, fcf *FailureCaptureFile) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_run_failure_capture (run_id, collection_id, plan_id, engine_id, filename, samples,
+		team) values (?,?,?,?,?,?,?) on duplicate key update filename=?, samples=?, team=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(runID, collectionID, planID, engineID, fcf.Filename, fcf.Samples, fcf.Team, fcf.Filename, fcf.Samples,
+		fcf.Team)
+	return err
+}
+
+// GetFailedResponses downloads the failing responses captured by all the engines of the run.
+// Files which cannot be downloaded are skipped as they are only a sample anyway.
+func GetFailedResponses(runID int64) ([]*FailedResponse, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select filename from collection_run_failure_capture where run_id=? order by plan_id, engine_id")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	filenames := []string{}
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	r := []*FailedResponse{}
+	for _, filename := range filenames {
+		content, err := object_storage.Client.Storage.Download(filename)
+		if err != nil {
+			continue
+		}
+		var responses []*FailedResponse
+		if err := json.Unmarshal(content, &responses); err != nil {
+			continue
+		}
+		r = append(r, responses...)
+	}
+	return r, nil
+}
+
+func (c *Collection) deleteFailureCaptures() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("select filename from collection_run_failure_capture where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	rows, err := q.Query(c.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			return err
+		}
+		// The objects are deleted on a best effort basis. They are useless once the rows are gone
+		if err := object_storage.Client.Storage.Delete(filename); err != nil {
+			log.Printf("Error deleting failure capture %s: %v", filename, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	q2, err := db.Prepare("delete from collection_run_failure_capture where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q2.Close()
+	_, err = q2.Exec(c.ID)
+	return err
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureCaptureValidate(t *testing.T) {
+	var disabled *FailureCapture
+	assert.NoError(t, disabled.Validate())
+
+	fc := &FailureCapture{Rate: 0.1}
+	assert.NoError(t, fc.Validate())
+	assert.Equal(t, DefaultFailureCaptureSamples, fc.GetMaxSamples())
+	assert.Equal(t, 50, (&FailureCapture{Rate: 1, MaxSamples: 50}).GetMaxSamples())
+
+	assert.Error(t, (&FailureCapture{}).Validate())
+	assert.Error(t, (&FailureCapture{Rate: 1.5}).Validate())
+	assert.Error(t, (&FailureCapture{Rate: 0.5, MaxSamples: -1}).Validate())
+	assert.Error(t, (&FailureCapture{Rate: 0.5, MaxSamples: MaxFailureCaptureSamples + 1}).Validate())
+}
+
+func TestMakeFailureCaptureFilename(t *testing.T) {
+	assert.Equal(t, "run/12/failures-3-0.json", MakeFailureCaptureFilename(12, 3, 0))
+}
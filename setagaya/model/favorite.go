@@ -0,0 +1,138 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	UserItemProject    = "project"
+	UserItemPlan       = "plan"
+	UserItemCollection = "collection"
+
+	MaxFavorites = 100
+	// Only the latest items opened by a user are kept
+	MaxRecentItems = 50
+)
+
+var ErrTooManyFavorites = fmt.Errorf("a user can have up to %d favorites", MaxFavorites)
+
+// UserItem is a project, a plan or a collection pinned or lately opened by a user. The name and the project are
+// filled in when the item is listed, so the user can tell the items apart.
+type UserItem struct {
+	Kind      string    `json:"kind"`
+	ID        int64     `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	ProjectID int64     `json:"project_id,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+func ValidateUserItemKind(kind string) error {
+	switch kind {
+	case UserItemProject, UserItemPlan, UserItemCollection:
+		return nil
+	}
+	return fmt.Errorf("%s cannot be a favorite, only a project, a plan or a collection can", kind)
+}
+
+func getUserItems(query, user string, limit int) ([]*UserItem, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(user, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := []*UserItem{}
+	for rows.Next() {
+		item := new(UserItem)
+		if err := rows.Scan(&item.Kind, &item.ID, &item.Time); err != nil {
+			return nil, err
+		}
+		r = append(r, item)
+	}
+	return r, rows.Err()
+}
+
+// GetFavorites returns the items pinned by the user, the latest first
+func GetFavorites(user string) ([]*UserItem, error) {
+	return getUserItems(`select kind, item_id, created_time from user_favorite where user=?
+		order by created_time desc, kind, item_id desc limit ?`, user, MaxFavorites)
+}
+
+// AddFavorite pins the item for the user. Pinning an item twice keeps it where it was.
+func AddFavorite(user, kind string, id int64) error {
+	db := config.SC.DBC
+	var count int
+	err := db.QueryRow("select count(*) from user_favorite where user=?", user).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count >= MaxFavorites {
+		var exists int
+		err := db.QueryRow("select 1 from user_favorite where user=? and kind=? and item_id=?", user, kind, id).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTooManyFavorites
+		}
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	q, err := db.Prepare("insert into user_favorite (user, kind, item_id) values (?,?,?) on duplicate key update item_id=item_id")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(user, kind, id)
+	return err
+}
+
+func RemoveFavorite(user, kind string, id int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from user_favorite where user=? and kind=? and item_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(user, kind, id)
+	return err
+}
+
+// GetRecentItems returns the items the user opened lately, the latest first
+func GetRecentItems(user string, limit int) ([]*UserItem, error) {
+	return getUserItems(`select kind, item_id, accessed_time from user_recent where user=?
+		order by accessed_time desc, kind, item_id desc limit ?`, user, limit)
+}
+
+// RecordRecentItem records the user opened the item, and forgets the items opened before the latest ones
+func RecordRecentItem(user, kind string, id int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into user_recent (user, kind, item_id) values (?,?,?) on duplicate key update accessed_time=NOW()")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err := q.Exec(user, kind, id); err != nil {
+		return err
+	}
+	var oldest time.Time
+	err = db.QueryRow("select accessed_time from user_recent where user=? order by accessed_time desc limit 1 offset ?",
+		user, MaxRecentItems-1).Scan(&oldest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("delete from user_recent where user=? and accessed_time<?", user, oldest)
+	return err
+}
@@ -0,0 +1,16 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateUserItemKind(t *testing.T) {
+	for _, kind := range []string{UserItemProject, UserItemPlan, UserItemCollection} {
+		assert.NoError(t, ValidateUserItemKind(kind))
+	}
+	for _, kind := range []string{"", "run", "Project"} {
+		assert.Error(t, ValidateUserItemKind(kind))
+	}
+}
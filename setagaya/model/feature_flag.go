@@ -0,0 +1,199 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// ErrFeatureDisabled is returned when the feature is turned off for the tenant, or for every tenant by the config
+var ErrFeatureDisabled = errors.New("feature is not enabled")
+
+// FeatureFlag is a feature flag as the config sets it for every tenant, and the tenants overriding it
+type FeatureFlag struct {
+	*config.Feature
+	Enabled bool `json:"enabled"`
+	// Whether the feature is on for the tenants overriding the config, by their name
+	Overrides map[string]bool `json:"overrides"`
+}
+
+// TenantFeatureFlag is whether a feature is on for a tenant
+type TenantFeatureFlag struct {
+	*config.Feature
+	Enabled bool `json:"enabled"`
+	// The tenant overrides the config, Enabled is its own
+	Overridden bool `json:"overridden"`
+}
+
+// NewFeatureDisabledError tells which feature is off, it's an ErrFeatureDisabled
+func NewFeatureDisabledError(name string) error {
+	return fmt.Errorf("%w: %s", ErrFeatureDisabled, name)
+}
+
+// resolveFeature tells whether the feature is on for a tenant with the given overrides
+func resolveFeature(name string, overrides map[string]bool) (enabled, overridden bool) {
+	if enabled, ok := overrides[name]; ok {
+		return enabled, true
+	}
+	return config.SC.FeatureFlags.Enabled(name), false
+}
+
+// GetFeatureFlags returns every known flag with the tenants overriding it
+func GetFeatureFlags() ([]*FeatureFlag, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select t.name, f.flag, f.enabled from tenant_feature_flag f join tenant t on t.id=f.tenant_id
+		order by t.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	overrides := make(map[string]map[string]bool)
+	for rows.Next() {
+		var tenant, flag string
+		var enabled bool
+		if err := rows.Scan(&tenant, &flag, &enabled); err != nil {
+			return nil, err
+		}
+		if _, ok := overrides[flag]; !ok {
+			overrides[flag] = make(map[string]bool)
+		}
+		overrides[flag][tenant] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	flags := make([]*FeatureFlag, 0, len(config.KnownFeatures))
+	for _, f := range config.KnownFeatures {
+		ff := &FeatureFlag{Feature: f, Enabled: config.SC.FeatureFlags.Enabled(f.Name), Overrides: overrides[f.Name]}
+		if ff.Overrides == nil {
+			ff.Overrides = map[string]bool{}
+		}
+		flags = append(flags, ff)
+	}
+	return flags, nil
+}
+
+// getFeatureOverrides returns the flags the tenant overrides. The flags no longer known are left out
+func (t *Tenant) getFeatureOverrides() (map[string]bool, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select flag, enabled from tenant_feature_flag where tenant_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	overrides := make(map[string]bool)
+	for rows.Next() {
+		var flag string
+		var enabled bool
+		if err := rows.Scan(&flag, &enabled); err != nil {
+			return nil, err
+		}
+		if config.GetFeature(flag) != nil {
+			overrides[flag] = enabled
+		}
+	}
+	return overrides, rows.Err()
+}
+
+// GetFeatureFlags returns whether every known feature is on for the tenant
+func (t *Tenant) GetFeatureFlags() ([]*TenantFeatureFlag, error) {
+	overrides, err := t.getFeatureOverrides()
+	if err != nil {
+		return nil, err
+	}
+	flags := make([]*TenantFeatureFlag, 0, len(config.KnownFeatures))
+	for _, f := range config.KnownFeatures {
+		enabled, overridden := resolveFeature(f.Name, overrides)
+		flags = append(flags, &TenantFeatureFlag{Feature: f, Enabled: enabled, Overridden: overridden})
+	}
+	return flags, nil
+}
+
+// SetFeatureFlag turns the feature on or off for the tenant, whatever the config sets
+func (t *Tenant) SetFeatureFlag(name string, enabled bool) error {
+	if config.GetFeature(name) == nil {
+		return fmt.Errorf("%w: unknown feature flag %s", ErrInvalid, name)
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into tenant_feature_flag (tenant_id, flag, enabled) values (?, ?, ?)
+		on duplicate key update enabled=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(t.ID, name, enabled, enabled)
+	return err
+}
+
+// DeleteFeatureFlag removes the override of the tenant, the feature follows the config again
+func (t *Tenant) DeleteFeatureFlag(name string) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from tenant_feature_flag where tenant_id=? and flag=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(t.ID, name)
+	return err
+}
+
+// FeatureEnabled tells whether the feature is on for the tenant. The config decides for the resources of no tenant,
+// which t is nil for
+func FeatureEnabled(name string, t *Tenant) (bool, error) {
+	if t == nil {
+		return config.SC.FeatureFlags.Enabled(name), nil
+	}
+	overrides, err := t.getFeatureOverrides()
+	if err != nil {
+		return false, err
+	}
+	enabled, _ := resolveFeature(name, overrides)
+	return enabled, nil
+}
+
+// RequireFeature returns an ErrFeatureDisabled when the feature is off for the tenant of the project
+func RequireFeature(name string, projectID int64) error {
+	t, err := GetTenantByProject(projectID)
+	if err != nil {
+		return err
+	}
+	enabled, err := FeatureEnabled(name, t)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return NewFeatureDisabledError(name)
+	}
+	return nil
+}
+
+// GetTenantByProject returns the tenant owning the project. It's nil when the project belongs to no tenant
+func GetTenantByProject(projectID int64) (*Tenant, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select t.id from tenant t join project p on p.owner=t.owner where p.id=?
+		order by t.id limit 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	var tenantID int64
+	if err := q.QueryRow(projectID).Scan(&tenantID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return GetTenant(tenantID)
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestResolveFeature(t *testing.T) {
+	ff := config.SC.FeatureFlags
+	defer func() { config.SC.FeatureFlags = ff }()
+	config.SC.FeatureFlags = config.FeatureFlags{config.FeatureAsyncJobs: false}
+
+	// The config decides for the tenants which do not override it
+	enabled, overridden := resolveFeature(config.FeatureAsyncJobs, nil)
+	assert.False(t, enabled)
+	assert.False(t, overridden)
+	enabled, _ = resolveFeature(config.FeaturePlaywrightEngine, nil)
+	assert.True(t, enabled)
+
+	overrides := map[string]bool{config.FeatureAsyncJobs: true, config.FeaturePlaywrightEngine: false}
+	enabled, overridden = resolveFeature(config.FeatureAsyncJobs, overrides)
+	assert.True(t, enabled)
+	assert.True(t, overridden)
+	enabled, _ = resolveFeature(config.FeaturePlaywrightEngine, overrides)
+	assert.False(t, enabled)
+	enabled, overridden = resolveFeature(config.FeatureRBACEnforcement, overrides)
+	assert.False(t, enabled)
+	assert.False(t, overridden)
+}
+
+func TestFeatureDisabledError(t *testing.T) {
+	err := NewFeatureDisabledError(config.FeaturePlaywrightEngine)
+	assert.ErrorIs(t, err, ErrFeatureDisabled)
+	assert.Contains(t, err.Error(), config.FeaturePlaywrightEngine)
+}
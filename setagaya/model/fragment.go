@@ -0,0 +1,87 @@
+package model
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+// includePathProperty is the property of the Include Controllers of jmeter naming the fragment they include
+const includePathProperty = "IncludeController.includepath"
+
+// IsFragment tells whether a file of the project library is a jmx fragment. The plans of the project include the
+// fragments from their test plans through Include Controllers, they are not shared like the data files.
+func IsFragment(filename string) bool {
+	return strings.HasSuffix(filename, ".jmx")
+}
+
+// IncludeName is the fragment an include path of a jmx refers to. The engines keep the fragments next to the test
+// plan, so only the base name of the path counts, whichever system the path was written on.
+func IncludeName(includePath string) string {
+	p := strings.TrimSpace(strings.ReplaceAll(includePath, `\`, "/"))
+	if p == "" {
+		return ""
+	}
+	return filepath.Base(p)
+}
+
+// JMXIncludes lists the fragments the Include Controllers of a jmx include, once each and in the order they appear
+func JMXIncludes(content []byte) ([]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	includes := []string{}
+	seen := map[string]bool{}
+	inInclude := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return includes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid jmx: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			inInclude = false
+			if t.Name.Local != "stringProp" {
+				continue
+			}
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "name" && attr.Value == includePathProperty {
+					inInclude = true
+				}
+			}
+		case xml.CharData:
+			if !inInclude {
+				continue
+			}
+			name := IncludeName(string(t))
+			if name != "" && !seen[name] {
+				seen[name] = true
+				includes = append(includes, name)
+			}
+		case xml.EndElement:
+			inInclude = false
+		}
+	}
+}
+
+// GetFragment is the fragment of the library of the project the plans include under the name
+func (p *Project) GetFragment(filename string) (*SetagayaFile, error) {
+	exists, err := p.hasFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, &DBError{Err: errors.New("not found"),
+			Message: fmt.Sprintf("fragment %s is not in the library of the project", filename)}
+	}
+	f := &SetagayaFile{Filename: filename, Filepath: p.MakeFileName(filename), Fragment: true}
+	f.Filelink = object_storage.Client.Storage.GetUrl(f.Filepath)
+	return f, nil
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsFragment(t *testing.T) {
+	assert.True(t, IsFragment("login.jmx"))
+	assert.False(t, IsFragment("users.csv"))
+	assert.False(t, IsFragment("checkout.spec.ts"))
+}
+
+func TestIncludeName(t *testing.T) {
+	assert.Equal(t, "login.jmx", IncludeName("login.jmx"))
+	assert.Equal(t, "login.jmx", IncludeName("fragments/login.jmx"))
+	assert.Equal(t, "login.jmx", IncludeName(`C:\tests\fragments\login.jmx`))
+	assert.Equal(t, "login.jmx", IncludeName(" /home/me/login.jmx "))
+	assert.Equal(t, "", IncludeName(""))
+}
+
+func TestJMXIncludes(t *testing.T) {
+	jmx := `<?xml version="1.0" encoding="UTF-8"?>
+<jmeterTestPlan version="1.2">
+  <hashTree>
+    <IncludeController guiclass="IncludeControllerGui" testclass="IncludeController" testname="Login">
+      <stringProp name="IncludeController.includepath">fragments/login.jmx</stringProp>
+    </IncludeController>
+    <IncludeController guiclass="IncludeControllerGui" testclass="IncludeController" testname="Setup">
+      <stringProp name="IncludeController.includepath">C:\tests\setup.jmx</stringProp>
+    </IncludeController>
+    <IncludeController guiclass="IncludeControllerGui" testclass="IncludeController" testname="Login again">
+      <stringProp name="IncludeController.includepath">login.jmx</stringProp>
+    </IncludeController>
+    <IncludeController guiclass="IncludeControllerGui" testclass="IncludeController" testname="Not set">
+      <stringProp name="IncludeController.includepath"></stringProp>
+    </IncludeController>
+    <stringProp name="TestPlan.comments">other.jmx</stringProp>
+  </hashTree>
+</jmeterTestPlan>`
+	includes, err := JMXIncludes([]byte(jmx))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"login.jmx", "setup.jmx"}, includes)
+
+	includes, err = JMXIncludes([]byte(`<jmeterTestPlan><hashTree/></jmeterTestPlan>`))
+	assert.NoError(t, err)
+	assert.Empty(t, includes)
+
+	_, err = JMXIncludes([]byte(`<jmeterTestPlan><hashTree>`))
+	assert.Error(t, err)
+}
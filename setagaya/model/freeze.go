@@ -0,0 +1,97 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const maxFreezeReasonLength = 255
+
+var ErrPlatformFrozen = errors.New("the platform is read-only")
+
+// PlatformFreeze makes the platform read-only during an incident or a change freeze. Nothing is changed and no
+// collection is triggered until an admin lifts it, the running collections can still be stopped and purged.
+type PlatformFreeze struct {
+	Reason     string    `json:"reason"`
+	FrozenBy   string    `json:"frozen_by" classification:"personal"`
+	FrozenTime time.Time `json:"frozen_time"`
+}
+
+func (pf *PlatformFreeze) Validate() error {
+	if pf.Reason == "" || len(pf.Reason) > maxFreezeReasonLength {
+		return fmt.Errorf("reason is required and cannot be longer than %d characters", maxFreezeReasonLength)
+	}
+	return nil
+}
+
+// Err is the error the changes are refused with while the platform is frozen
+func (pf *PlatformFreeze) Err() error {
+	return fmt.Errorf("%w since %s: %s", ErrPlatformFrozen, pf.FrozenTime.UTC().Format(time.RFC3339), pf.Reason)
+}
+
+// GetPlatformFreeze returns the freeze of the platform, nil when it's writable
+func GetPlatformFreeze() (*PlatformFreeze, error) {
+	db := config.SC.DBC
+	pf := new(PlatformFreeze)
+	err := db.QueryRow("select reason, frozen_by, frozen_time from platform_freeze where id=1").
+		Scan(&pf.Reason, &pf.FrozenBy, &pf.FrozenTime)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pf, nil
+}
+
+// CheckPlatformFreeze returns ErrPlatformFrozen while the platform is read-only
+func CheckPlatformFreeze() error {
+	pf, err := GetPlatformFreeze()
+	if err != nil || pf == nil {
+		return err
+	}
+	return pf.Err()
+}
+
+// FreezePlatform makes the platform read-only. A platform already frozen keeps its time, with the new reason. It's
+// recorded in the audit log
+func FreezePlatform(pf *PlatformFreeze) error {
+	db := config.SC.DBC
+	tx, err := db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+	}()
+	if _, err := tx.Exec(`insert into platform_freeze (id, reason, frozen_by) values (1, ?, ?)
+		on duplicate key update reason=?, frozen_by=?`, pf.Reason, pf.FrozenBy, pf.Reason, pf.FrozenBy); err != nil {
+		return err
+	}
+	if err := recordAudit(tx, pf.FrozenBy, AuditActionPlatformFrozen, "platform", pf.Reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UnfreezePlatform makes the platform writable again. actor is the admin lifting the freeze
+func UnfreezePlatform(actor string) error {
+	db := config.SC.DBC
+	r, err := db.Exec("delete from platform_freeze where id=1")
+	if err != nil {
+		return err
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return &DBError{Err: errors.New("not found"), Message: "the platform is not frozen"}
+	}
+	return recordAudit(db, actor, AuditActionPlatformUnfrozen, "platform", "")
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlatformFreeze(t *testing.T) {
+	pf := &PlatformFreeze{FrozenBy: "admin"}
+	assert.Error(t, pf.Validate())
+	pf.Reason = strings.Repeat("a", maxFreezeReasonLength+1)
+	assert.Error(t, pf.Validate())
+	pf.Reason = "incident 42"
+	assert.NoError(t, pf.Validate())
+
+	pf.FrozenTime = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	err := pf.Err()
+	assert.True(t, errors.Is(err, ErrPlatformFrozen))
+	assert.Equal(t, "the platform is read-only since 2026-10-16T12:00:00Z: incident 42", err.Error())
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	// How long the response of a request is returned to the requests with the same key
+	IdempotencyKeyTTL = 24 * time.Hour
+	// A request still being handled after this long is considered lost, e.g. the api was restarted,
+	// so its key can be used again
+	idempotencyKeyAbandonedAfter = 10 * time.Minute
+	MaxIdempotencyKeyLength      = 255
+)
+
+var ErrIdempotencyKeyInUse = errors.New("a request with the same idempotency key is in progress")
+
+// IdempotentResponse is the response of a request, returned again to the retries of the request
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+func deleteExpiredIdempotencyKeys() error {
+	db := config.SC.DBC
+	// The times are compared with the clock of the database, which set created_time
+	q, err := db.Prepare(`delete from idempotency_key where created_time < NOW() - INTERVAL ? SECOND
+		or (status_code = 0 and created_time < NOW() - INTERVAL ? SECOND)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(int64(IdempotencyKeyTTL.Seconds()), int64(idempotencyKeyAbandonedAfter.Seconds()))
+	return err
+}
+
+// ReserveIdempotencyKey claims the key for a request on the collection. It returns the response stored for the key
+// when it was used by a previous request, or nil when the key is claimed and the request should be handled.
+// ErrIdempotencyKeyInUse is returned while the previous request is still being handled.
+func ReserveIdempotencyKey(collectionID int64, operation, key string) (*IdempotentResponse, error) {
+	// Expired keys are cleaned up here, so there is no need for a background job
+	if err := deleteExpiredIdempotencyKeys(); err != nil {
+		return nil, err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into idempotency_key (collection_id, operation, idempotency_key) values (?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	_, err = q.Exec(collectionID, operation, key)
+	if err == nil {
+		return nil, nil
+	}
+	if !isDuplicateEntry(err) {
+		return nil, err
+	}
+	return getIdempotentResponse(collectionID, operation, key)
+}
+
+func getIdempotentResponse(collectionID int64, operation, key string) (*IdempotentResponse, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select status_code, response from idempotency_key where collection_id=? and operation=? and idempotency_key=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	resp := new(IdempotentResponse)
+	var body []byte
+	if err := q.QueryRow(collectionID, operation, key).Scan(&resp.StatusCode, &body); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == 0 {
+		return nil, ErrIdempotencyKeyInUse
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request which claimed the key
+func CompleteIdempotencyKey(collectionID int64, operation, key string, resp *IdempotentResponse) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("update idempotency_key set status_code=?, response=? where collection_id=? and operation=? and idempotency_key=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(resp.StatusCode, resp.Body, collectionID, operation, key)
+	return err
+}
+
+// ReleaseIdempotencyKey gives up the key, so a retry of the request is handled again
+func ReleaseIdempotencyKey(collectionID int64, operation, key string) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from idempotency_key where collection_id=? and operation=? and idempotency_key=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(collectionID, operation, key)
+	return err
+}
+
+func (c *Collection) deleteIdempotencyKeys() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from idempotency_key where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+var imageDigestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// ImagePolicyOverride allows an image digest to be deployed in spite of the vulnerability policy
+type ImagePolicyOverride struct {
+	Digest      string    `json:"digest"`
+	Image       string    `json:"image"`
+	Admin       string    `json:"admin" classification:"personal"`
+	Reason      string    `json:"reason"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+func ValidateImageDigest(digest string) error {
+	if !imageDigestPattern.MatchString(digest) {
+		return errors.New("digest should be sha256:<64 hex characters>")
+	}
+	return nil
+}
+
+// CreateImagePolicyOverride allows the digest to be deployed. The override is recorded in the audit log
+func CreateImagePolicyOverride(digest, image, admin, reason string) error {
+	db := config.SC.DBC
+	tx, err := db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+	}()
+	_, err = tx.Exec(`insert into image_policy_override (digest, image, admin, reason) values (?,?,?,?)
+		on duplicate key update image=?, admin=?, reason=?, created_time=NOW()`,
+		digest, truncate(image, 255), admin, truncate(reason, 255), truncate(image, 255), admin, truncate(reason, 255))
+	if err != nil {
+		return err
+	}
+	detail := fmt.Sprintf("%s is allowed in spite of the vulnerability policy: %s", image, reason)
+	if err := recordAudit(tx, admin, AuditActionImagePolicyOverride, digest, detail); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetImagePolicyOverride returns the override of the digest. It's nil when there is none
+func GetImagePolicyOverride(digest string) (*ImagePolicyOverride, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select digest, image, admin, reason, created_time from image_policy_override where digest=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	o := new(ImagePolicyOverride)
+	if err := q.QueryRow(digest).Scan(&o.Digest, &o.Image, &o.Admin, &o.Reason, &o.CreatedTime); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return o, nil
+}
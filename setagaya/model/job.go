@@ -0,0 +1,147 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is an operation on a collection run in the background, e.g. a deployment that takes longer than
+// the clients can wait for a response. Clients poll the job until it's finished.
+type Job struct {
+	ID           int64  `json:"id"`
+	CollectionID int64  `json:"collection_id"`
+	Kind         string `json:"kind"`
+	Status       string `json:"status"`
+	// Response of the operation once it's finished
+	StatusCode int             `json:"status_code,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	// The job is posted to the url once it's finished
+	CallbackURL  string    `json:"callback_url,omitempty"`
+	CreatedTime  time.Time `json:"created_time"`
+	FinishedTime time.Time `json:"finished_time"`
+}
+
+func CreateJob(collectionID int64, kind, callbackURL string) (*Job, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into job (collection_id, kind, status, callback_url) values (?, ?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	r, err := q.Exec(collectionID, kind, JobRunning, truncate(callbackURL, 1024))
+	if err != nil {
+		return nil, err
+	}
+	id, err := r.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetJob(id)
+}
+
+const jobColumns = `id, collection_id, kind, status, status_code, result, error, callback_url, created_time, finished_time`
+
+type jobScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row jobScanner) (*Job, error) {
+	j := new(Job)
+	var result []byte
+	var finishedTime sql.NullTime
+	err := row.Scan(&j.ID, &j.CollectionID, &j.Kind, &j.Status, &j.StatusCode, &result, &j.Error,
+		&j.CallbackURL, &j.CreatedTime, &finishedTime)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) > 0 {
+		j.Result = result
+	}
+	if finishedTime.Valid {
+		j.FinishedTime = finishedTime.Time
+	}
+	return j, nil
+}
+
+func GetJob(jobID int64) (*Job, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + jobColumns + " from job where id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	j, err := scanJob(q.QueryRow(jobID))
+	if err != nil {
+		return nil, &DBError{Err: err, Message: "job not found"}
+	}
+	return j, nil
+}
+
+// GetFailedJobs returns the latest jobs which failed since the given time, the most recent first
+func GetFailedJobs(since time.Time, limit int) ([]*Job, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + jobColumns + " from job where status=? and created_time>=? order by id desc limit ?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(JobFailed, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := []*Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// Finish records the outcome of the job. A job fails when the operation responded with an error status
+func (j *Job) Finish(statusCode int, result json.RawMessage, errMessage string) error {
+	j.Status = JobSucceeded
+	if statusCode >= 400 {
+		j.Status = JobFailed
+	}
+	j.StatusCode = statusCode
+	j.Result = result
+	j.Error = truncate(errMessage, 1024)
+	j.FinishedTime = time.Now()
+	db := config.SC.DBC
+	q, err := db.Prepare("update job set status=?, status_code=?, result=?, error=?, finished_time=NOW() where id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	var stored []byte
+	if len(result) > 0 {
+		stored = result
+	}
+	_, err = q.Exec(j.Status, j.StatusCode, stored, j.Error, j.ID)
+	return err
+}
+
+func (c *Collection) deleteJobs() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from job where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
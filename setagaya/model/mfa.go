@@ -0,0 +1,282 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" // #nosec G505 -- RFC 6238 TOTP uses HMAC-SHA1, which the authenticator apps expect
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// Time steps a code is accepted before and after its own, for the clocks of the phones drifting
+	totpSkew       = 1
+	totpSecretSize = 20
+	totpIssuer     = "Setagaya"
+)
+
+var (
+	ErrStepUpRequired = errors.New("the action needs a valid TOTP code")
+	ErrMFAEnrolled    = errors.New("the account is enrolled already, another admin resets it")
+	ErrMFALocked      = errors.New("too many invalid TOTP codes")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// AccountMFA is the TOTP secret of an admin. It's confirmed by the first valid code, the admin has the secret in
+// their authenticator app from then on.
+type AccountMFA struct {
+	Account   string          `json:"account" classification:"personal"`
+	Secret    EncryptedString `json:"-"`
+	Confirmed bool            `json:"confirmed"`
+	// Time step of the last code used, so a code is not used twice
+	LastCounter int64 `json:"-"`
+	// Invalid codes entered in a row. The codes are refused until LockedUntil once there are too many of them
+	FailedAttempts int       `json:"-"`
+	LockedUntil    time.Time `json:"-"`
+	CreatedTime    time.Time `json:"created_time"`
+}
+
+// TOTPEnrollment is what the admin adds to their authenticator app
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	// otpauth uri of the secret, the apps scan it as a QR code
+	URI string `json:"uri"`
+}
+
+func newTOTPSecret() (string, error) {
+	raw := make([]byte, totpSecretSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(raw), nil
+}
+
+func totpURI(account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", totpIssuer)
+	return fmt.Sprintf("otpauth://totp/%s:%s?%s", totpIssuer, url.PathEscape(account), v.Encode())
+}
+
+// totpCode is the HOTP code of the counter, RFC 4226
+func totpCode(secret string, counter int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter)) // #nosec G115 -- the counters are positive
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+func totpCounter(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// matchTOTP returns the time step of the code when it's valid at now and newer than the last one used
+func matchTOTP(secret, code string, now time.Time, lastCounter int64) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := totpCounter(now)
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		expected, err := totpCode(secret, counter)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// GetAccountMFA returns the TOTP secret of the account, nil when it has none
+func GetAccountMFA(account string) (*AccountMFA, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select account, secret, confirmed, last_counter, failed_attempts, locked_until, created_time
+		from account_mfa where account=?`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	m := new(AccountMFA)
+	var lockedUntil sql.NullTime
+	err = q.QueryRow(account).Scan(&m.Account, &m.Secret, &m.Confirmed, &m.LastCounter, &m.FailedAttempts,
+		&lockedUntil, &m.CreatedTime)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		m.LockedUntil = lockedUntil.Time
+	}
+	return m, nil
+}
+
+// EnrollMFA draws a TOTP secret for the account. A secret which was never confirmed is replaced, a confirmed one
+// has to be reset first.
+func EnrollMFA(account string) (*TOTPEnrollment, error) {
+	existing, err := GetAccountMFA(account)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Confirmed {
+		return nil, ErrMFAEnrolled
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	db := config.SC.DBC
+	if _, err := db.Exec("delete from account_mfa where account=? and confirmed=0", account); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("insert into account_mfa (account, secret) values (?,?)", account,
+		EncryptedString(secret)); err != nil {
+		return nil, err
+	}
+	if err := recordAudit(db, account, AuditActionMFAEnrolled, account, ""); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{Secret: secret, URI: totpURI(account, secret)}, nil
+}
+
+// stepUpConfig is the step-up of the config, nil when it's not configured
+func stepUpConfig() *config.StepUpConfig {
+	if ac := config.SC.AuthConfig; ac != nil {
+		return ac.StepUp
+	}
+	return nil
+}
+
+// Verify checks the code and confirms the secret. The code cannot be used again. Once the admin entered too many
+// invalid codes in a row, their codes are refused until the lockout is over, the valid ones included.
+func (m *AccountMFA) Verify(code string, now time.Time) error {
+	limit := stepUpConfig().AttemptsLimit()
+	db := config.SC.DBC
+	if m.FailedAttempts >= limit {
+		if now.Before(m.LockedUntil) {
+			return m.lockedErr()
+		}
+		// The lockout is over, the admin has all their attempts again. The row is only reset when it's over in the
+		// database too, the account may have been locked again since it was read
+		r, err := db.Exec(`update account_mfa set failed_attempts=0, locked_until=null
+			where account=? and failed_attempts>=? and locked_until<=?`, m.Account, limit, now)
+		if err != nil {
+			return err
+		}
+		n, err := r.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			current, err := GetAccountMFA(m.Account)
+			if err != nil {
+				return err
+			}
+			if current == nil {
+				return ErrStepUpRequired
+			}
+			*m = *current
+			if m.FailedAttempts >= limit {
+				return m.lockedErr()
+			}
+		}
+		m.FailedAttempts, m.LockedUntil = 0, time.Time{}
+	}
+	counter, ok := matchTOTP(string(m.Secret), code, now, m.LastCounter)
+	if !ok {
+		return m.recordFailure(now, limit)
+	}
+	// Two requests with the same code, only one of them moves the counter. None does once the account is locked by
+	// the requests guessing the codes at the same time
+	r, err := db.Exec(`update account_mfa set last_counter=?, confirmed=1, failed_attempts=0, locked_until=null
+		where account=? and last_counter<? and failed_attempts<?`, counter, m.Account, counter, limit)
+	if err != nil {
+		return err
+	}
+	if n, err := r.RowsAffected(); err != nil || n == 0 {
+		return ErrStepUpRequired
+	}
+	m.LastCounter, m.Confirmed, m.FailedAttempts = counter, true, 0
+	return nil
+}
+
+func (m *AccountMFA) lockedErr() error {
+	return fmt.Errorf("%w, they are refused until %s", ErrMFALocked, m.LockedUntil.UTC().Format(time.RFC3339))
+}
+
+// recordFailure counts an invalid code of the admin, and locks the account once there are too many of them in a row.
+// The lockout is recorded in the audit log
+func (m *AccountMFA) recordFailure(now time.Time, limit int) error {
+	db := config.SC.DBC
+	lockedUntil := now.Add(stepUpConfig().LockoutDuration())
+	// The failures stop being counted at the limit, so the requests at the same time cannot try more codes. The
+	// failure reaching the limit sets the lockout in the same statement, no request sees the account at the limit
+	// without it. locked_until is assigned first as MySQL evaluates the assignments in order
+	r, err := db.Exec(`update account_mfa
+		set locked_until=case when failed_attempts+1>=? then ? else locked_until end, failed_attempts=failed_attempts+1
+		where account=? and failed_attempts<?`, limit, lockedUntil, m.Account, limit)
+	if err != nil {
+		return err
+	}
+	if n, err := r.RowsAffected(); err != nil || n == 0 {
+		// Another request locked the account meanwhile
+		return ErrMFALocked
+	}
+	if err := db.QueryRow("select failed_attempts from account_mfa where account=?", m.Account).
+		Scan(&m.FailedAttempts); err != nil {
+		return err
+	}
+	if m.FailedAttempts < limit {
+		return ErrStepUpRequired
+	}
+	m.LockedUntil = lockedUntil
+	detail := fmt.Sprintf("%d invalid codes, locked until %s", m.FailedAttempts, m.LockedUntil.UTC().Format(time.RFC3339))
+	if err := recordAudit(db, m.Account, AuditActionMFALocked, m.Account, detail); err != nil {
+		return err
+	}
+	return m.lockedErr()
+}
+
+// ResetMFA deletes the TOTP secret of the account, so it can enroll again. actor is the admin resetting it
+func ResetMFA(actor, account string) error {
+	db := config.SC.DBC
+	r, err := db.Exec("delete from account_mfa where account=?", account)
+	if err != nil {
+		return err
+	}
+	if n, err := r.RowsAffected(); err == nil && n == 0 {
+		return &DBError{Err: errors.New("not found"), Message: fmt.Sprintf("%s is not enrolled", account)}
+	}
+	return recordAudit(db, actor, AuditActionMFAReset, account, "")
+}
+
+// RecordStepUp records a destructive action the admin was let through by the step-up. how is the way the admin was
+// verified, a code sent with the request or the window of the last one
+func RecordStepUp(actor, target, how string) error {
+	return recordAudit(config.SC.DBC, actor, AuditActionStepUp, target, how)
+}
@@ -0,0 +1,157 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// The secret of the test vectors of RFC 6238, "12345678901234567890" in base32
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	for unix, code := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924"} {
+		got, err := totpCode(rfcTOTPSecret, totpCounter(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, code, got)
+	}
+	_, err := totpCode("not base32!", 1)
+	assert.Error(t, err)
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	counter, ok := matchTOTP(rfcTOTPSecret, "081804", now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, totpCounter(now), counter)
+
+	// The clock of the phone is a step late
+	_, ok = matchTOTP(rfcTOTPSecret, "081804", now.Add(totpPeriod*time.Second), 0)
+	assert.True(t, ok)
+	_, ok = matchTOTP(rfcTOTPSecret, "081804", now.Add(2*totpPeriod*time.Second), 0)
+	assert.False(t, ok)
+
+	// A code is not used twice
+	_, ok = matchTOTP(rfcTOTPSecret, "081804", now, counter)
+	assert.False(t, ok)
+	_, ok = matchTOTP(rfcTOTPSecret, "81804", now, 0)
+	assert.False(t, ok)
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	secret, err := newTOTPSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+	other, _ := newTOTPSecret()
+	assert.NotEqual(t, secret, other)
+
+	uri := totpURI("alice admin", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Setagaya:alice%20admin?"))
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=Setagaya")
+}
+
+func TestVerifyLockout(t *testing.T) {
+	SetupLocalDatabase(t)
+	sc, ac := config.SC.Secure, config.SC.AuthConfig
+	defer func() { config.SC.Secure, config.SC.AuthConfig = sc, ac }()
+	config.SC.Secure = &config.SecureConfig{EncryptionKey: testEncryptionKey}
+	config.SC.AuthConfig = &config.AuthConfig{StepUp: &config.StepUpConfig{MaxAttempts: 3, Lockout: 10}}
+
+	enrollment, err := EnrollMFA("admin")
+	assert.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	valid, err := totpCode(enrollment.Secret, totpCounter(now))
+	assert.NoError(t, err)
+	invalid := "000000"
+	if invalid == valid {
+		invalid = "111111"
+	}
+	verify := func(code string, at time.Time) error {
+		m, err := GetAccountMFA("admin")
+		assert.NoError(t, err)
+		return m.Verify(code, at)
+	}
+
+	// A valid code clears the invalid ones entered before it
+	assert.ErrorIs(t, verify(invalid, now), ErrStepUpRequired)
+	assert.ErrorIs(t, verify(invalid, now), ErrStepUpRequired)
+	assert.NoError(t, verify(valid, now))
+	m, err := GetAccountMFA("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, m.FailedAttempts)
+
+	// The account is locked at the limit, even the valid codes are refused
+	later := now.Add(totpPeriod * time.Second)
+	for i := 0; i < 2; i++ {
+		assert.ErrorIs(t, verify(invalid, later), ErrStepUpRequired)
+	}
+	assert.ErrorIs(t, verify(invalid, later), ErrMFALocked)
+	next, err := totpCode(enrollment.Secret, totpCounter(later))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, verify(next, later), ErrMFALocked)
+	audit, err := GetAuditLog(1)
+	assert.NoError(t, err)
+	if assert.Len(t, audit, 1) {
+		assert.Equal(t, AuditActionMFALocked, audit[0].Action)
+	}
+
+	// Once the lockout is over the admin has all their attempts again
+	over := later.Add(10 * time.Minute)
+	code, err := totpCode(enrollment.Secret, totpCounter(over))
+	assert.NoError(t, err)
+	assert.NoError(t, verify(code, over))
+
+	// A reset clears the lockout along with the secret
+	for i := 0; i < 3; i++ {
+		assert.Error(t, verify(invalid, over))
+	}
+	assert.NoError(t, ResetMFA("other-admin", "admin"))
+	m, err = GetAccountMFA("admin")
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+}
+
+func TestVerifyLockoutInterleaved(t *testing.T) {
+	SetupLocalDatabase(t)
+	sc, ac := config.SC.Secure, config.SC.AuthConfig
+	defer func() { config.SC.Secure, config.SC.AuthConfig = sc, ac }()
+	config.SC.Secure = &config.SecureConfig{EncryptionKey: testEncryptionKey}
+	config.SC.AuthConfig = &config.AuthConfig{StepUp: &config.StepUpConfig{MaxAttempts: 2, Lockout: 10}}
+
+	enrollment, err := EnrollMFA("admin")
+	assert.NoError(t, err)
+	now := time.Unix(1700000000, 0).UTC()
+	valid, err := totpCode(enrollment.Secret, totpCounter(now))
+	assert.NoError(t, err)
+	invalid := "000000"
+	if invalid == valid {
+		invalid = "111111"
+	}
+
+	// Both requests read the account before the first one reaches the limit
+	first, err := GetAccountMFA("admin")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, first.Verify(invalid, now), ErrStepUpRequired)
+	second, err := GetAccountMFA("admin")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, first.Verify(invalid, now), ErrMFALocked)
+
+	// The account is never at the limit without its lockout
+	m, err := GetAccountMFA("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, m.FailedAttempts)
+	assert.Equal(t, now.Add(10*time.Minute).Unix(), m.LockedUntil.Unix())
+
+	// A request which read the account at the limit before its lockout cannot reset it, the lockout is still on
+	second.FailedAttempts, second.LockedUntil = 2, time.Time{}
+	assert.ErrorIs(t, second.Verify(valid, now), ErrMFALocked)
+	m, err = GetAccountMFA("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, m.FailedAttempts)
+	assert.False(t, m.LockedUntil.IsZero())
+}
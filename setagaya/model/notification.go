@@ -0,0 +1,87 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	// The user was mentioned in a comment on a run
+	NotificationMention = "mention"
+)
+
+// Notification is something which happened to a user, shown in their inbox until they read it
+type Notification struct {
+	ID           int64      `json:"id"`
+	User         string     `json:"user"`
+	Kind         string     `json:"kind"`
+	Actor        string     `json:"actor"`
+	CollectionID int64      `json:"collection_id"`
+	RunID        int64      `json:"run_id"`
+	CommentID    int64      `json:"comment_id"`
+	Message      string     `json:"message"`
+	ReadTime     *time.Time `json:"read_time,omitempty"`
+	CreatedTime  time.Time  `json:"created_time"`
+}
+
+func notify(db execer, n *Notification) error {
+	_, err := db.Exec(`insert into user_notification (user, kind, actor, collection_id, run_id, comment_id, message)
+		values (?,?,?,?,?,?,?)`, n.User, n.Kind, n.Actor, n.CollectionID, n.RunID, n.CommentID, n.Message)
+	return err
+}
+
+// GetNotifications returns the latest notifications of the user first
+func GetNotifications(user string, unreadOnly bool, limit int) ([]*Notification, error) {
+	db := config.SC.DBC
+	query := `select id, user, kind, actor, collection_id, run_id, comment_id, message, read_time, created_time
+		from user_notification where user=?`
+	if unreadOnly {
+		query += " and read_time is null"
+	}
+	q, err := db.Prepare(query + " order by id desc limit ?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(user, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := []*Notification{}
+	for rows.Next() {
+		n := new(Notification)
+		var readTime sql.NullTime
+		if err := rows.Scan(&n.ID, &n.User, &n.Kind, &n.Actor, &n.CollectionID, &n.RunID, &n.CommentID, &n.Message,
+			&readTime, &n.CreatedTime); err != nil {
+			return nil, err
+		}
+		if readTime.Valid {
+			n.ReadTime = &readTime.Time
+		}
+		r = append(r, n)
+	}
+	return r, rows.Err()
+}
+
+// MarkNotificationsRead marks the notifications of the user as read, all of them when no id is given
+func MarkNotificationsRead(user string, ids []int64) error {
+	db := config.SC.DBC
+	if len(ids) == 0 {
+		_, err := db.Exec("update user_notification set read_time=NOW() where user=? and read_time is null", user)
+		return err
+	}
+	q, err := db.Prepare("update user_notification set read_time=NOW() where user=? and id=? and read_time is null")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	for _, id := range ids {
+		if _, err := q.Exec(user, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	ParameterString = "string"
+	ParameterInt    = "int"
+	ParameterFloat  = "float"
+	ParameterBool   = "bool"
+)
+
+// Parameter names are passed to the engines as properties(jmeter) or environment variables(playwright)
+// so we keep them to a safe charset
+var parameterNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]{0,99}$`)
+
+// PlanParameter is a named value a plan expects to be supplied when the collection is triggered.
+// A parameter without default is mandatory.
+// Jmeter plans read them with ${__P(name)}.
+type PlanParameter struct {
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	Default     *string `json:"default,omitempty"`
+	Description string  `json:"description"`
+}
+
+func (pp *PlanParameter) validateValue(value string) error {
+	var err error
+	switch pp.Type {
+	case ParameterInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case ParameterFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case ParameterBool:
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("parameter %s expects a %s value, got %q", pp.Name, pp.Type, value)
+	}
+	return nil
+}
+
+func ValidatePlanParameters(parameters []*PlanParameter) error {
+	seen := map[string]bool{}
+	for _, pp := range parameters {
+		if !parameterNamePattern.MatchString(pp.Name) {
+			return fmt.Errorf("invalid parameter name %q", pp.Name)
+		}
+		if seen[pp.Name] {
+			return fmt.Errorf("parameter %s is declared more than once", pp.Name)
+		}
+		seen[pp.Name] = true
+		switch pp.Type {
+		case ParameterString, ParameterInt, ParameterFloat, ParameterBool:
+		default:
+			return fmt.Errorf("parameter %s has unsupported type %s", pp.Name, pp.Type)
+		}
+		if pp.Default != nil {
+			if err := pp.validateValue(*pp.Default); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveParameters validates the supplied values against the declared parameters and fills in the defaults.
+// Supplied values not declared by the plan are ignored as they can belong to another plan in the collection.
+func ResolveParameters(declared []*PlanParameter, supplied map[string]string) (map[string]string, error) {
+	r := map[string]string{}
+	for _, pp := range declared {
+		value, ok := supplied[pp.Name]
+		if !ok {
+			if pp.Default == nil {
+				return nil, fmt.Errorf("parameter %s is required", pp.Name)
+			}
+			value = *pp.Default
+		}
+		if err := pp.validateValue(value); err != nil {
+			return nil, err
+		}
+		r[pp.Name] = value
+	}
+	return r, nil
+}
+
+func (p *Plan) StoreParameters(parameters []*PlanParameter) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from plan_parameter where plan_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err = q.Exec(p.ID); err != nil {
+		return err
+	}
+	if len(parameters) == 0 {
+		return nil
+	}
+	q2, err := db.Prepare("insert into plan_parameter (plan_id, name, type, default_value, description) values (?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer q2.Close()
+	for _, pp := range parameters {
+		if _, err := q2.Exec(p.ID, pp.Name, pp.Type, pp.Default, pp.Description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Plan) GetParameters() ([]*PlanParameter, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select name, type, default_value, description from plan_parameter where plan_id=? order by name")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := []*PlanParameter{}
+	for rows.Next() {
+		pp := new(PlanParameter)
+		var defaultValue sql.NullString
+		rows.Scan(&pp.Name, &pp.Type, &defaultValue, &pp.Description)
+		if defaultValue.Valid {
+			pp.Default = &defaultValue.String
+		}
+		r = append(r, pp)
+	}
+	return r, rows.Err()
+}
+
+// ResolveCollectionParameters resolves the supplied values for every execution plan of the collection.
+// The result is aligned with c.ExecutionPlans. Values not declared by any of the plans, nor variables of the
+// collection, are rejected as they are most likely typos.
+func (c *Collection) ResolveCollectionParameters(supplied map[string]string) ([]map[string]string, error) {
+	r := make([]map[string]string, len(c.ExecutionPlans))
+	declared := map[string]bool{}
+	for i, ep := range c.ExecutionPlans {
+		plan, err := GetPlan(ep.PlanID)
+		if err != nil {
+			return nil, err
+		}
+		resolved, err := resolvePlanValues(plan.Parameters, c.Variables, ep.Variables, supplied)
+		if err != nil {
+			return nil, &ParameterError{Message: fmt.Sprintf("plan %d: %s", plan.ID, err)}
+		}
+		for _, pp := range plan.Parameters {
+			declared[pp.Name] = true
+		}
+		for name := range MergeVariables(c.Variables, ep.Variables) {
+			declared[name] = true
+		}
+		r[i] = resolved
+	}
+	for name := range supplied {
+		if !declared[name] {
+			return nil, &ParameterError{Message: fmt.Sprintf("parameter %s is not declared by any plan in the collection", name)}
+		}
+	}
+	return r, nil
+}
+
+// resolvePlanValues returns what the engines of a plan are passed: the variables of the collection, overridden by
+// the ones of the plan, and the parameters of the plan. The variables also supply the parameters of the same name,
+// the values of the trigger override them all.
+func resolvePlanValues(declared []*PlanParameter, collectionVariables, planVariables,
+	supplied map[string]string) (map[string]string, error) {
+	variables := MergeVariables(collectionVariables, planVariables)
+	values := MergeVariables(variables, supplied)
+	resolved, err := ResolveParameters(declared, values)
+	if err != nil {
+		return nil, err
+	}
+	for name := range variables {
+		if _, ok := resolved[name]; !ok {
+			resolved[name] = values[name]
+		}
+	}
+	return resolved, nil
+}
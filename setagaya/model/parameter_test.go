@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePlanParameters(t *testing.T) {
+	five := "5"
+	notANumber := "five"
+	assert.NoError(t, ValidatePlanParameters(nil))
+	assert.NoError(t, ValidatePlanParameters([]*PlanParameter{
+		{Name: "target.host", Type: ParameterString},
+		{Name: "users", Type: ParameterInt, Default: &five},
+	}))
+	assert.Error(t, ValidatePlanParameters([]*PlanParameter{{Name: "bad name", Type: ParameterString}}))
+	assert.Error(t, ValidatePlanParameters([]*PlanParameter{{Name: "host", Type: "url"}}))
+	assert.Error(t, ValidatePlanParameters([]*PlanParameter{{Name: "users", Type: ParameterInt, Default: &notANumber}}))
+	assert.Error(t, ValidatePlanParameters([]*PlanParameter{
+		{Name: "host", Type: ParameterString},
+		{Name: "host", Type: ParameterString},
+	}))
+}
+
+func TestResolveParameters(t *testing.T) {
+	five := "5"
+	declared := []*PlanParameter{
+		{Name: "host", Type: ParameterString},
+		{Name: "users", Type: ParameterInt, Default: &five},
+		{Name: "debug", Type: ParameterBool, Default: &[]string{"false"}[0]},
+	}
+
+	r, err := ResolveParameters(declared, map[string]string{"host": "staging.example.com", "other": "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"host": "staging.example.com", "users": "5", "debug": "false"}, r)
+
+	r, err = ResolveParameters(declared, map[string]string{"host": "prod.example.com", "users": "50"})
+	assert.NoError(t, err)
+	assert.Equal(t, "50", r["users"])
+
+	_, err = ResolveParameters(declared, map[string]string{"users": "50"})
+	assert.Error(t, err)
+	_, err = ResolveParameters(declared, map[string]string{"host": "a", "users": "many"})
+	assert.Error(t, err)
+}
+
+func TestResolvePlanValues(t *testing.T) {
+	five := "5"
+	declared := []*PlanParameter{
+		{Name: "host", Type: ParameterString},
+		{Name: "users", Type: ParameterInt, Default: &five},
+	}
+	collectionVariables := map[string]string{"host": "example.com", "token": "t0k3n", "region": "eu"}
+	planVariables := map[string]string{"region": "us"}
+
+	r, err := resolvePlanValues(declared, collectionVariables, planVariables, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"host": "example.com", "users": "5", "token": "t0k3n", "region": "us"}, r)
+
+	r, err = resolvePlanValues(declared, collectionVariables, planVariables,
+		map[string]string{"host": "staging.example.com", "region": "ap"})
+	assert.NoError(t, err)
+	assert.Equal(t, "staging.example.com", r["host"])
+	assert.Equal(t, "ap", r["region"])
+
+	// The variables do not make up for a mandatory parameter
+	_, err = resolvePlanValues(declared, map[string]string{"token": "t0k3n"}, nil, nil)
+	assert.Error(t, err)
+}
@@ -1,13 +1,13 @@
 package model
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"time"
 
-	mysql "github.com/go-sql-driver/mysql"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/hveda/Setagaya/setagaya/config"
@@ -15,12 +15,19 @@ import (
 )
 
 type Plan struct {
-	ID          int64           `json:"id"`
-	Name        string          `json:"name"`
-	ProjectID   int64           `json:"project_id"`
-	CreatedTime time.Time       `json:"created_time"`
-	TestFile    *SetagayaFile   `json:"test_file"`
-	Data        []*SetagayaFile `json:"data"`
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	ProjectID   int64     `json:"project_id"`
+	CreatedTime time.Time `json:"created_time"`
+	// Markdown documenting the intent and the prerequisites of the plan. It's only returned when getting the plan
+	Description string `json:"description,omitempty"`
+	// Team owning the plan when the plans of a collection belong to different teams. The metrics and the files of
+	// its runs are labelled with it
+	Team     string          `json:"team,omitempty"`
+	TestFile *SetagayaFile   `json:"test_file"`
+	Data     []*SetagayaFile `json:"data"`
+	// Values the plan expects at trigger time
+	Parameters []*PlanParameter `json:"parameters"`
 }
 
 func CreatePlan(name string, projectID int64) (int64, error) {
@@ -41,17 +48,20 @@ func CreatePlan(name string, projectID int64) (int64, error) {
 
 func GetPlan(ID int64) (*Plan, error) {
 	db := config.SC.DBC
-	q, err := db.Prepare("select id, name, project_id, created_time from plan where id=?")
+	q, err := db.Prepare("select id, name, project_id, created_time, coalesce(description, ''), team from plan where id=?")
 	if err != nil {
 		return nil, err
 	}
 	defer q.Close()
 
 	plan := new(Plan)
-	err = q.QueryRow(ID).Scan(&plan.ID, &plan.Name, &plan.ProjectID, &plan.CreatedTime)
+	err = q.QueryRow(ID).Scan(&plan.ID, &plan.Name, &plan.ProjectID, &plan.CreatedTime, &plan.Description, &plan.Team)
 	if err != nil {
 		return nil, &DBError{Err: err, Message: "plan not found"}
 	}
+	if plan.Parameters, err = plan.GetParameters(); err != nil {
+		return nil, err
+	}
 	if plan.TestFile, plan.Data, err = plan.GetPlanFiles(); err != nil {
 		return plan, nil
 	}
@@ -82,6 +92,11 @@ func (p *Plan) GetPlanFiles() (*SetagayaFile, []*SetagayaFile, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	shared, err := p.getSharedFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	r = append(r, shared...)
 	q2, err := db.Prepare("select filename from plan_test_file where plan_id=?")
 	if err != nil {
 		return nil, nil, err
@@ -101,6 +116,15 @@ func (p *Plan) Delete() error {
 	if err := p.DeleteAllFiles(); err != nil {
 		return err
 	}
+	if err := p.unshareAllFiles(); err != nil {
+		return err
+	}
+	if err := p.StoreParameters(nil); err != nil {
+		return err
+	}
+	if err := p.deleteSecrets(); err != nil {
+		return err
+	}
 	db := config.SC.DBC
 	q, err := db.Prepare("delete from plan where id=?")
 	if err != nil {
@@ -118,10 +142,39 @@ func (p *Plan) MakeFileName(filename string) string {
 	return fmt.Sprintf("plan/%d/%s", p.ID, filename)
 }
 
+// IsTestFile tells whether the file is the test script of a plan, either a jmx or a Playwright spec.
+// A plan can only have one test file and the rest of the files are treated as data.
+func IsTestFile(filename string) bool {
+	for _, suffix := range []string{".jmx", ".spec.js", ".spec.ts"} {
+		if strings.HasSuffix(filename, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Plan) StoreFile(content io.ReadCloser, filename string) error {
+	shared, err := p.isSharedFile(filename)
+	if err != nil {
+		return err
+	}
+	if shared {
+		return errors.New("the plan uses a file of the project library with the same name")
+	}
+	// The template variables of the jmx are checked now rather than when the engines render it
+	if strings.HasSuffix(filename, ".jmx") {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		if err := ValidateTemplate(data, p.Parameters); err != nil {
+			return err
+		}
+		content = io.NopCloser(bytes.NewReader(data))
+	}
 	filenameForStorage := p.MakeFileName(filename)
 	table := "plan_data"
-	if strings.HasSuffix(filename, ".jmx") {
+	if IsTestFile(filename) {
 		table = "plan_test_file"
 	}
 	db := config.SC.DBC
@@ -131,18 +184,27 @@ func (p *Plan) StoreFile(content io.ReadCloser, filename string) error {
 	}
 	defer q.Close()
 	_, err = q.Exec(p.ID, filename)
-	if driverErr, ok := err.(*mysql.MySQLError); ok {
-		if driverErr.Number == 1062 {
-			return errors.New("file already exists; if you wish to update it then delete existing one and upload again")
-		}
+	if isDuplicateEntry(err) {
+		return &RequestError{Err: err,
+			Message: "file already exists; if you wish to update it then delete existing one and upload again"}
+	}
+	if err != nil {
 		return err
 	}
 	return object_storage.Client.Storage.Upload(filenameForStorage, content)
 }
 
+// DeleteFile deletes a file of the plan. The files of the project library are only no longer used by the plan
 func (p *Plan) DeleteFile(filename string) error {
+	shared, err := p.isSharedFile(filename)
+	if err != nil {
+		return err
+	}
+	if shared {
+		return p.UnshareFile(filename)
+	}
 	table := "plan_data"
-	if strings.HasSuffix(filename, ".jmx") {
+	if IsTestFile(filename) {
 		table = "plan_test_file"
 	}
 	db := config.SC.DBC
@@ -177,6 +239,10 @@ func (p *Plan) DeleteAllFiles() error {
 	}
 
 	for _, f := range p.Data {
+		// The files of the project library are not the plan's to delete
+		if f.Filepath != p.MakeFileName(f.Filename) {
+			continue
+		}
 		err = p.DeleteFile(f.Filename)
 		if err != nil {
 			log.Error(err)
@@ -294,6 +360,21 @@ func DeleteRunningPlan(collectionID, planID int64) error {
 	return nil
 }
 
+// DeleteRunningPlansByCollection clears all the running plans of the collection, whatever controller context they belong to
+func DeleteRunningPlansByCollection(collectionID int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from running_plan where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(collectionID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func GetRunningPlansByCollection(collectionID int64) ([]*RunningPlan, error) {
 	db := config.SC.DBC
 	var rps []*RunningPlan
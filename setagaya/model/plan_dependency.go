@@ -0,0 +1,170 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// PlanDependency delays the start of a plan in the runs until another plan of the collection ran for some minutes,
+// or finished
+type PlanDependency struct {
+	PlanID int64 `yaml:"testid" json:"plan_id"`
+	// Minutes the other plan runs before this one starts
+	Minutes int `yaml:"minutes,omitempty" json:"minutes,omitempty"`
+	// This plan starts once the other one finished
+	Finished bool `yaml:"finished,omitempty" json:"finished,omitempty"`
+}
+
+// String describes when the plan starts, for the events of the runs
+func (pd *PlanDependency) String() string {
+	if pd.Finished {
+		return fmt.Sprintf("after plan %d finished", pd.PlanID)
+	}
+	return fmt.Sprintf("after plan %d ran for %d minutes", pd.PlanID, pd.Minutes)
+}
+
+// ValidatePlanDependencies checks the plans depend on other plans of the collection, and that they all start
+// eventually: the dependencies cannot loop
+func ValidatePlanDependencies(eps []*ExecutionPlan) error {
+	plans := make(map[int64]*ExecutionPlan, len(eps))
+	for _, ep := range eps {
+		plans[ep.PlanID] = ep
+	}
+	for _, ep := range eps {
+		pd := ep.StartAfter
+		if pd == nil {
+			continue
+		}
+		if config.SC.ExecutorConfig.RunsOnce() {
+			return fmt.Errorf("the engines run once with the %s execution mode, the plans cannot wait for each other",
+				config.ExecutionModeJob)
+		}
+		if _, ok := plans[pd.PlanID]; !ok || pd.PlanID == ep.PlanID {
+			return fmt.Errorf("plan %d can only start after another plan of the collection", ep.PlanID)
+		}
+		if pd.Minutes < 0 {
+			return errors.New("the minutes a plan waits for cannot be negative")
+		}
+		if (pd.Minutes > 0) == pd.Finished {
+			return fmt.Errorf("plan %d should start either after some minutes of plan %d or once it finished",
+				ep.PlanID, pd.PlanID)
+		}
+	}
+	for _, ep := range eps {
+		seen := map[int64]bool{ep.PlanID: true}
+		for next := ep.StartAfter; next != nil; next = plans[next.PlanID].StartAfter {
+			if seen[next.PlanID] {
+				return fmt.Errorf("plan %d waits for itself through the plans it starts after", ep.PlanID)
+			}
+			seen[next.PlanID] = true
+		}
+	}
+	return nil
+}
+
+func HasPlanDependencies(eps []*ExecutionPlan) bool {
+	for _, ep := range eps {
+		if ep.StartAfter != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// startAfterDB is the json the dependency is stored as, nil when the plan starts with the run
+func (ep *ExecutionPlan) startAfterDB() ([]byte, error) {
+	if ep.StartAfter == nil {
+		return nil, nil
+	}
+	return json.Marshal(ep.StartAfter)
+}
+
+func (ep *ExecutionPlan) scanStartAfter(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	ep.StartAfter = new(PlanDependency)
+	return json.Unmarshal(raw, ep.StartAfter)
+}
+
+// PendingPlan is a plan of a run waiting for the plan it starts after
+type PendingPlan struct {
+	RunID        int64
+	CollectionID int64
+	Plan         *ExecutionPlan
+	// What the engines are triggered with, opaque to the model
+	EngineData  string
+	CreatedTime time.Time
+}
+
+func AddPendingPlan(pp *PendingPlan) error {
+	plan, err := json.Marshal(pp.Plan)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_run_pending_plan (run_id, collection_id, plan_id, plan, engine_data)
+		values (?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(pp.RunID, pp.CollectionID, pp.Plan.PlanID, string(plan), pp.EngineData)
+	return err
+}
+
+// GetPendingPlans returns the plans of the run still waiting to start
+func GetPendingPlans(runID int64) ([]*PendingPlan, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select run_id, collection_id, plan, engine_data, created_time from collection_run_pending_plan
+		where run_id=? order by plan_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pps := []*PendingPlan{}
+	for rows.Next() {
+		pp := &PendingPlan{Plan: new(ExecutionPlan)}
+		var plan string
+		if err := rows.Scan(&pp.RunID, &pp.CollectionID, &plan, &pp.EngineData, &pp.CreatedTime); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(plan), pp.Plan); err != nil {
+			return nil, err
+		}
+		pps = append(pps, pp)
+	}
+	return pps, rows.Err()
+}
+
+func DeletePendingPlan(runID, planID int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_pending_plan where run_id=? and plan_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(runID, planID)
+	return err
+}
+
+// DeletePendingPlansByCollection drops the plans waiting to start when the run of the collection ends
+func DeletePendingPlansByCollection(collectionID int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_pending_plan where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(collectionID)
+	return err
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestValidatePlanDependencies(t *testing.T) {
+	eps := []*ExecutionPlan{
+		{PlanID: 1},
+		{PlanID: 2, StartAfter: &PlanDependency{PlanID: 1, Minutes: 5}},
+		{PlanID: 3, StartAfter: &PlanDependency{PlanID: 2, Finished: true}},
+	}
+	assert.NoError(t, ValidatePlanDependencies(eps))
+	assert.True(t, HasPlanDependencies(eps))
+	assert.False(t, HasPlanDependencies(eps[:1]))
+
+	invalid := []*PlanDependency{
+		{PlanID: 4, Minutes: 5},
+		{PlanID: 2, Minutes: 5},
+		{PlanID: 1},
+		{PlanID: 1, Minutes: 5, Finished: true},
+		{PlanID: 1, Minutes: -1, Finished: true},
+	}
+	for _, pd := range invalid {
+		eps[1].StartAfter = pd
+		assert.Error(t, ValidatePlanDependencies(eps))
+	}
+
+	eps[1].StartAfter = &PlanDependency{PlanID: 1, Minutes: 5}
+	eps[0].StartAfter = &PlanDependency{PlanID: 3, Finished: true}
+	assert.Error(t, ValidatePlanDependencies(eps))
+
+	eps[0].StartAfter = nil
+	ec := config.SC.ExecutorConfig
+	defer func() { config.SC.ExecutorConfig = ec }()
+	config.SC.ExecutorConfig = &config.ExecutorConfig{ExecutionMode: config.ExecutionModeJob}
+	assert.Error(t, ValidatePlanDependencies(eps))
+}
+
+func TestPlanDependencyString(t *testing.T) {
+	assert.Equal(t, "after plan 3 ran for 5 minutes", (&PlanDependency{PlanID: 3, Minutes: 5}).String())
+	assert.Equal(t, "after plan 3 finished", (&PlanDependency{PlanID: 3, Finished: true}).String())
+}
+
+func TestStartAfterColumn(t *testing.T) {
+	ep := &ExecutionPlan{}
+	raw, err := ep.startAfterDB()
+	assert.NoError(t, err)
+	assert.Nil(t, raw)
+
+	ep.StartAfter = &PlanDependency{PlanID: 3, Minutes: 5}
+	raw, err = ep.startAfterDB()
+	assert.NoError(t, err)
+	scanned := &ExecutionPlan{}
+	assert.NoError(t, scanned.scanStartAfter(raw))
+	assert.Equal(t, ep.StartAfter, scanned.StartAfter)
+}
@@ -0,0 +1,280 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+// PlanFileUsage is what uses a file of a plan: the plans and the collections which would miss it at their next run,
+// and the versions of the file the past runs were sent. The users check it before deleting or replacing a file,
+// typically a CSV of the library shared by several plans.
+type PlanFileUsage struct {
+	PlanID   int64  `json:"plan_id"`
+	Filename string `json:"filename" classification:"file_metadata"`
+	Filepath string `json:"filepath" classification:"file_metadata"`
+	// The file is in the library of the project, the other plans of the project may use it
+	Shared bool `json:"shared"`
+	// Checksum of the file as it's stored now. Empty when it cannot be downloaded
+	SHA256 string `json:"sha256,omitempty"`
+	// Plans using the file, the plan itself included
+	Plans       []int64            `json:"plans"`
+	Collections []*FileCollection  `json:"collections"`
+	Versions    []*FileVersionRuns `json:"versions"`
+}
+
+// FileCollection is a collection with plans using the file
+type FileCollection struct {
+	ID      int64   `json:"id"`
+	Name    string  `json:"name"`
+	PlanIDs []int64 `json:"plan_ids"`
+	// The collection is running now, its engines already downloaded the file
+	Running bool `json:"running"`
+}
+
+// FileVersionRuns is a version of the file and the runs it was sent to
+type FileVersionRuns struct {
+	SHA256 string `json:"sha256"`
+	// The file is stored with this version now
+	Current     bool      `json:"current"`
+	Runs        int       `json:"runs"`
+	Collections []int64   `json:"collections"`
+	FirstRunID  int64     `json:"first_run_id"`
+	LastRunID   int64     `json:"last_run_id"`
+	FirstUsed   time.Time `json:"first_used"`
+	LastUsed    time.Time `json:"last_used"`
+}
+
+// runFile is a file a run was sent, as recorded with the manifest of the run
+type runFile struct {
+	RunID        int64
+	CollectionID int64
+	SHA256       string
+	CreatedTime  time.Time
+}
+
+// FileChecksum is the sha256 of a stored file, as the runs record it
+func FileChecksum(filepath string) (string, error) {
+	content, err := object_storage.Client.Storage.Download(filepath)
+	if err != nil {
+		return "", fmt.Errorf("cannot download %s: %w", filepath, err)
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// GetFileUsage returns what uses the file of the plan. The file is one of the plan or one of the library the plan
+// uses.
+func (p *Plan) GetFileUsage(filename string) (*PlanFileUsage, error) {
+	u := &PlanFileUsage{PlanID: p.ID, Filename: filename, Plans: []int64{p.ID}}
+	files := p.Data
+	if p.TestFile != nil {
+		files = append([]*SetagayaFile{p.TestFile}, files...)
+	}
+	for _, f := range files {
+		if f.Filename == filename {
+			u.Filepath = f.Filepath
+		}
+	}
+	if u.Filepath == "" {
+		return nil, &DBError{Err: errors.New("not found"), Message: fmt.Sprintf("plan %d has no file named %s", p.ID, filename)}
+	}
+	project := &Project{ID: p.ProjectID}
+	if u.Filepath == project.MakeFileName(filename) {
+		u.Shared = true
+		plans, err := project.filePlans(filename)
+		if err != nil {
+			return nil, err
+		}
+		u.Plans = plans
+	}
+	var err error
+	if u.Collections, err = planCollections(u.Plans); err != nil {
+		return nil, err
+	}
+	runFiles, err := getRunFiles(u.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	// The current version is informational, the usage is still worth returning without it
+	u.SHA256, _ = FileChecksum(u.Filepath)
+	u.Versions = fileVersions(runFiles, u.SHA256)
+	return u, nil
+}
+
+// filePlans are the plans using a file of the library
+func (p *Project) filePlans(filename string) ([]int64, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select plan_id from plan_shared_file where project_id=? and filename=? order by plan_id")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(p.ID, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	plans := []int64{}
+	for rows.Next() {
+		var planID int64
+		if err := rows.Scan(&planID); err != nil {
+			return nil, err
+		}
+		plans = append(plans, planID)
+	}
+	return plans, rows.Err()
+}
+
+// planCollections are the collections with any of the plans
+func planCollections(planIDs []int64) ([]*FileCollection, error) {
+	collections := []*FileCollection{}
+	if len(planIDs) == 0 {
+		return collections, nil
+	}
+	placeholders := make([]string, len(planIDs))
+	args := make([]interface{}, len(planIDs))
+	for i, planID := range planIDs {
+		placeholders[i] = "?"
+		args[i] = planID
+	}
+	db := config.SC.DBC
+	// #nosec G201 -- Using parameterized placeholders, not direct user input in SQL
+	query := fmt.Sprintf(`select c.id, c.name, cp.plan_id from collection c
+		join collection_plan cp on cp.collection_id = c.id where cp.plan_id in (%s) order by c.id, cp.plan_id`,
+		strings.Join(placeholders, ","))
+	q, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byID := map[int64]*FileCollection{}
+	for rows.Next() {
+		var id, planID int64
+		var name string
+		if err := rows.Scan(&id, &name, &planID); err != nil {
+			return nil, err
+		}
+		fc, ok := byID[id]
+		if !ok {
+			fc = &FileCollection{ID: id, Name: name, PlanIDs: []int64{}}
+			byID[id] = fc
+			collections = append(collections, fc)
+		}
+		fc.PlanIDs = append(fc.PlanIDs, planID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	running, err := GetRunningPlans()
+	if err != nil {
+		return nil, err
+	}
+	for _, rp := range running {
+		if fc, ok := byID[rp.CollectionID]; ok {
+			fc.Running = true
+		}
+	}
+	return collections, nil
+}
+
+// fileVersions groups the runs sent the file by version of the file, the latest used first
+func fileVersions(runFiles []*runFile, current string) []*FileVersionRuns {
+	versions := []*FileVersionRuns{}
+	bySHA := map[string]*FileVersionRuns{}
+	collections := map[string]map[int64]bool{}
+	// A file of the library is sent once for every plan using it
+	runs := map[string]map[int64]bool{}
+	for _, rf := range runFiles {
+		v, ok := bySHA[rf.SHA256]
+		if !ok {
+			v = &FileVersionRuns{SHA256: rf.SHA256, Current: rf.SHA256 == current, Collections: []int64{},
+				FirstRunID: rf.RunID, FirstUsed: rf.CreatedTime}
+			bySHA[rf.SHA256] = v
+			collections[rf.SHA256] = map[int64]bool{}
+			runs[rf.SHA256] = map[int64]bool{}
+			versions = append(versions, v)
+		}
+		if !runs[rf.SHA256][rf.RunID] {
+			runs[rf.SHA256][rf.RunID] = true
+			v.Runs++
+		}
+		if rf.RunID < v.FirstRunID {
+			v.FirstRunID, v.FirstUsed = rf.RunID, rf.CreatedTime
+		}
+		if rf.RunID > v.LastRunID {
+			v.LastRunID, v.LastUsed = rf.RunID, rf.CreatedTime
+		}
+		if !collections[rf.SHA256][rf.CollectionID] {
+			collections[rf.SHA256][rf.CollectionID] = true
+			v.Collections = append(v.Collections, rf.CollectionID)
+		}
+	}
+	for _, v := range versions {
+		sort.Slice(v.Collections, func(i, j int) bool { return v.Collections[i] < v.Collections[j] })
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].LastRunID > versions[j].LastRunID })
+	return versions
+}
+
+// storeRunFiles records the files the run was sent, so the runs using a version of a file can be told
+func storeRunFiles(m *RunManifest) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into collection_run_file (run_id, collection_id, plan_id, filepath, sha256) values (?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	for _, f := range m.Files {
+		if _, err := q.Exec(m.RunID, m.CollectionID, f.PlanID, f.Filepath, f.SHA256); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getRunFiles(filepath string) ([]*runFile, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select run_id, collection_id, sha256, created_time from collection_run_file where filepath=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	runFiles := []*runFile{}
+	for rows.Next() {
+		rf := new(runFile)
+		if err := rows.Scan(&rf.RunID, &rf.CollectionID, &rf.SHA256, &rf.CreatedTime); err != nil {
+			return nil, err
+		}
+		runFiles = append(runFiles, rf)
+	}
+	return runFiles, rows.Err()
+}
+
+func (c *Collection) deleteRunFiles() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_file where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
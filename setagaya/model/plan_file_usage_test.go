@@ -0,0 +1,28 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileVersions(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 9, 0, 0, 0, time.UTC) }
+	runFiles := []*runFile{
+		{RunID: 3, CollectionID: 10, SHA256: "old", CreatedTime: day(3)},
+		{RunID: 1, CollectionID: 10, SHA256: "old", CreatedTime: day(1)},
+		{RunID: 5, CollectionID: 20, SHA256: "new", CreatedTime: day(5)},
+		// A file of the library sent to two plans of the run
+		{RunID: 5, CollectionID: 20, SHA256: "new", CreatedTime: day(5)},
+		{RunID: 4, CollectionID: 11, SHA256: "old", CreatedTime: day(4)},
+	}
+	versions := fileVersions(runFiles, "new")
+	assert.Len(t, versions, 2)
+	assert.Equal(t, &FileVersionRuns{SHA256: "new", Current: true, Runs: 1, Collections: []int64{20},
+		FirstRunID: 5, LastRunID: 5, FirstUsed: day(5), LastUsed: day(5)}, versions[0])
+	assert.Equal(t, &FileVersionRuns{SHA256: "old", Runs: 3, Collections: []int64{10, 11},
+		FirstRunID: 1, LastRunID: 4, FirstUsed: day(1), LastUsed: day(4)}, versions[1])
+
+	assert.Empty(t, fileVersions(nil, ""))
+}
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	PlanRetryDeploying = "deploying"
+	PlanRetryRunning   = "running"
+	PlanRetryFailed    = "failed"
+)
+
+// PlanRetry is an attempt to deploy the engines of a plan again and to trigger them within the run in progress,
+// e.g. after they crashed. The run keeps its id, the attempts are listed in its history.
+type PlanRetry struct {
+	ID           int64     `json:"id"`
+	RunID        int64     `json:"run_id"`
+	CollectionID int64     `json:"collection_id"`
+	PlanID       int64     `json:"plan_id"`
+	Attempt      int       `json:"attempt"`
+	Status       string    `json:"status"`
+	Message      string    `json:"message"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedTime  time.Time `json:"created_time"`
+	UpdatedTime  time.Time `json:"updated_time"`
+}
+
+// CreatePlanRetry records the next attempt of the plan in the run
+func CreatePlanRetry(collectionID, runID, planID int64, owner string) (*PlanRetry, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select count(*) from collection_run_plan_retry where run_id=? and plan_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	attempts := 0
+	if err := q.QueryRow(runID, planID).Scan(&attempts); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	pr := &PlanRetry{
+		RunID:        runID,
+		CollectionID: collectionID,
+		PlanID:       planID,
+		Attempt:      attempts + 1,
+		Status:       PlanRetryDeploying,
+		CreatedBy:    owner,
+		CreatedTime:  now,
+		UpdatedTime:  now,
+	}
+	q2, err := db.Prepare(`insert into collection_run_plan_retry (run_id, collection_id, plan_id, attempt, status,
+		created_by) values (?,?,?,?,?,?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer q2.Close()
+	r, err := q2.Exec(pr.RunID, pr.CollectionID, pr.PlanID, pr.Attempt, pr.Status, pr.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	if pr.ID, err = r.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+func UpdatePlanRetry(pr *PlanRetry) error {
+	pr.Message = truncate(pr.Message, 1024)
+	db := config.SC.DBC
+	q, err := db.Prepare(`update collection_run_plan_retry set status=?, message=?, updated_time=CURRENT_TIMESTAMP
+		where id=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(pr.Status, pr.Message, pr.ID)
+	return err
+}
+
+// GetPlanRetries returns the attempts made in the run, oldest first
+func GetPlanRetries(runID int64) ([]*PlanRetry, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select id, run_id, collection_id, plan_id, attempt, status, message, created_by,
+		created_time, updated_time from collection_run_plan_retry where run_id=? order by id`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := []*PlanRetry{}
+	for rows.Next() {
+		pr := new(PlanRetry)
+		if err := rows.Scan(&pr.ID, &pr.RunID, &pr.CollectionID, &pr.PlanID, &pr.Attempt, &pr.Status, &pr.Message,
+			&pr.CreatedBy, &pr.CreatedTime, &pr.UpdatedTime); err != nil {
+			return nil, err
+		}
+		r = append(r, pr)
+	}
+	return r, rows.Err()
+}
+
+func (c *Collection) deletePlanRetries() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_plan_retry where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
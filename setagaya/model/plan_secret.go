@@ -0,0 +1,138 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// Kinds of the secrets of the plans
+const (
+	// Reference to where the credentials of an environment are kept, e.g. vault://kv/payments/staging
+	PlanSecretCredentialRef = "credential_ref"
+	// Secret signing the webhooks the plan calls or receives
+	PlanSecretWebhookSecret = "webhook_secret"
+)
+
+const (
+	maxPlanSecrets          = 20
+	maxPlanSecretValueBytes = 4096
+)
+
+var planSecretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,62}$`)
+
+// PlanSecret is a sensitive metadata of a plan. Its value is encrypted in the database and never returned by the
+// API, only its name and kind are.
+type PlanSecret struct {
+	PlanID      int64           `json:"plan_id"`
+	Name        string          `json:"name"`
+	Kind        string          `json:"kind"`
+	Value       EncryptedString `json:"-"`
+	UpdatedBy   string          `json:"updated_by" classification:"personal"`
+	UpdatedTime time.Time       `json:"updated_time"`
+}
+
+func (ps *PlanSecret) Validate() error {
+	if !planSecretNamePattern.MatchString(ps.Name) {
+		return fmt.Errorf("secret name %s should be up to 63 letters, digits, _, . or -", ps.Name)
+	}
+	switch ps.Kind {
+	case PlanSecretCredentialRef, PlanSecretWebhookSecret:
+	default:
+		return fmt.Errorf("secret kind should be %s or %s", PlanSecretCredentialRef, PlanSecretWebhookSecret)
+	}
+	if ps.Value == "" || len(ps.Value) > maxPlanSecretValueBytes {
+		return fmt.Errorf("secret value is required and cannot be longer than %d bytes", maxPlanSecretValueBytes)
+	}
+	return nil
+}
+
+// GetSecrets returns the secrets of the plan without their value
+func (p *Plan) GetSecrets() ([]*PlanSecret, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select name, kind, updated_by, updated_time from plan_secret where plan_id=? order by name")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	secrets := []*PlanSecret{}
+	for rows.Next() {
+		ps := &PlanSecret{PlanID: p.ID}
+		if err := rows.Scan(&ps.Name, &ps.Kind, &ps.UpdatedBy, &ps.UpdatedTime); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, ps)
+	}
+	return secrets, rows.Err()
+}
+
+// GetSecret returns the secret of the plan with its value decrypted
+func (p *Plan) GetSecret(name string) (*PlanSecret, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select name, kind, value, updated_by, updated_time from plan_secret where plan_id=? and name=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	ps := &PlanSecret{PlanID: p.ID}
+	if err := q.QueryRow(p.ID, name).Scan(&ps.Name, &ps.Kind, &ps.Value, &ps.UpdatedBy, &ps.UpdatedTime); err != nil {
+		return nil, &DBError{Err: err, Message: "secret not found"}
+	}
+	return ps, nil
+}
+
+// SetSecret creates the secret of the plan or replaces its value
+func (p *Plan) SetSecret(ps *PlanSecret) error {
+	if config.SC.Secure == nil {
+		return ErrEncryptionDisabled
+	}
+	secrets, err := p.GetSecrets()
+	if err != nil {
+		return err
+	}
+	exists := false
+	for _, s := range secrets {
+		exists = exists || s.Name == ps.Name
+	}
+	if !exists && len(secrets) >= maxPlanSecrets {
+		return fmt.Errorf("%w: a plan can have up to %d secrets", ErrInvalid, maxPlanSecrets)
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into plan_secret (plan_id, name, kind, value, updated_by) values (?, ?, ?, ?, ?)
+		on duplicate key update kind=?, value=?, updated_by=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(p.ID, ps.Name, ps.Kind, ps.Value, ps.UpdatedBy, ps.Kind, ps.Value, ps.UpdatedBy)
+	return err
+}
+
+func (p *Plan) DeleteSecret(name string) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from plan_secret where plan_id=? and name=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(p.ID, name)
+	return err
+}
+
+func (p *Plan) deleteSecrets() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from plan_secret where plan_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(p.ID)
+	return err
+}
@@ -76,6 +76,33 @@ func TestGetRunningPlans(t *testing.T) {
 	assert.Equal(t, nil, err)
 }
 
+func TestDeleteRunningPlansByCollection(t *testing.T) {
+	// Skip database tests in test mode (when no real DB connection available)
+	if os.Getenv("SETAGAYA_TEST_MODE") == "true" || config.SC.DBC == nil {
+		t.Skip("Skipping database test in test mode")
+		return
+	}
+
+	collectionID := int64(2)
+	for _, planID := range []int64{1, 2} {
+		if err := AddRunningPlan(collectionID, planID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddRunningPlan(collectionID+1, 1); err != nil {
+		t.Fatal(err)
+	}
+	err := DeleteRunningPlansByCollection(collectionID)
+	assert.Nil(t, err)
+	rps, err := GetRunningPlansByCollection(collectionID)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(rps))
+	rps, err = GetRunningPlansByCollection(collectionID + 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rps))
+	DeleteRunningPlan(collectionID+1, 1)
+}
+
 func TestMain(m *testing.M) {
 	if err := setupAndTeardown(); err != nil {
 		log.Fatal(err)
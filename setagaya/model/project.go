@@ -12,11 +12,13 @@ import (
 )
 
 type Project struct {
-	ID          int64  `json:"id"`
-	Name        string `json:"name"`
-	Owner       string `json:"owner"`
-	ssID        null.String
-	SID         string        `json:"sid"`
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	ssID  null.String
+	SID   string `json:"sid"`
+	// Markdown documenting the project. It's only returned when getting the project
+	Description string        `json:"description,omitempty"`
 	CreatedTime time.Time     `json:"created_time"`
 	Collections []*Collection `json:"collections"`
 	Plans       []*Plan       `json:"plans"`
@@ -91,14 +93,15 @@ func GetProjectsByOwners(owners []string) ([]*Project, error) {
 
 func GetProject(id int64) (*Project, error) {
 	db := config.SC.DBC
-	q, err := db.Prepare("select id, name, owner, sid, created_time from project where id=?")
+	q, err := db.Prepare("select id, name, owner, sid, coalesce(description, ''), created_time from project where id=?")
 	if err != nil {
 		return nil, err
 	}
 	defer q.Close()
 
 	project := new(Project)
-	err = q.QueryRow(id).Scan(&project.ID, &project.Name, &project.Owner, &project.ssID, &project.CreatedTime)
+	err = q.QueryRow(id).Scan(&project.ID, &project.Name, &project.Owner, &project.ssID, &project.Description,
+		&project.CreatedTime)
 	if err != nil {
 		return nil, &DBError{Err: err, Message: "project not found"}
 	}
@@ -108,6 +111,18 @@ func GetProject(id int64) (*Project, error) {
 }
 
 func (p *Project) Delete() error {
+	if err := p.DeleteAllFiles(); err != nil {
+		return err
+	}
+	if err := DeleteProjectSecurityContext(p.ID); err != nil {
+		return err
+	}
+	if err := DeleteProjectRegistry(p.ID); err != nil {
+		return err
+	}
+	if err := DeleteProjectBudget(p.ID); err != nil {
+		return err
+	}
 	db := config.SC.DBC
 	q, err := db.Prepare("delete from project where id=?")
 	if err != nil {
@@ -150,7 +165,7 @@ func (p *Project) GetCollections() ([]*Collection, error) {
 func (p *Project) GetPlans() ([]*Plan, error) {
 	db := config.SC.DBC
 	r := []*Plan{}
-	q, err := db.Prepare("select id, name, project_id, created_time from plan where project_id=?")
+	q, err := db.Prepare("select id, name, project_id, created_time, team from plan where project_id=?")
 	if err != nil {
 		return r, err
 	}
@@ -162,7 +177,7 @@ func (p *Project) GetPlans() ([]*Plan, error) {
 	defer rows.Close()
 	for rows.Next() {
 		plan := new(Plan)
-		rows.Scan(&plan.ID, &plan.Name, &plan.ProjectID, &plan.CreatedTime)
+		rows.Scan(&plan.ID, &plan.Name, &plan.ProjectID, &plan.CreatedTime, &plan.Team)
 		r = append(r, plan)
 	}
 	err = rows.Err()
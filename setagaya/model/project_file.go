@@ -0,0 +1,244 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+// ErrProjectFileInUse is returned when a file of the library of a project is deleted while plans still use it
+var ErrProjectFileInUse = errors.New("the file is used by plans of the project")
+
+// ProjectFile is a data file of the library of a project. The plans of the project use it without uploading their
+// own copy, the engines download it from the library.
+type ProjectFile struct {
+	SetagayaFile
+	// Plans using the file. It cannot be deleted until they stop using it
+	References  int       `json:"references"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+func (p *Project) MakeFileName(filename string) string {
+	return fmt.Sprintf("project/%d/%s", p.ID, filename)
+}
+
+// StoreFile adds a file to the library of the project. Every plan has its own test file, the jmx files of the
+// library are the fragments the test plans include.
+func (p *Project) StoreFile(content io.ReadCloser, filename string) error {
+	if IsTestFile(filename) && !IsFragment(filename) {
+		return errors.New("test files cannot be shared, upload them to the plan")
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into project_file (project_id, filename) values (?, ?)")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(p.ID, filename)
+	if isDuplicateEntry(err) {
+		return &RequestError{Err: err,
+			Message: "file already exists; if you wish to update it then delete existing one and upload again"}
+	}
+	if err != nil {
+		return err
+	}
+	return object_storage.Client.Storage.Upload(p.MakeFileName(filename), content)
+}
+
+// GetFiles lists the library of the project, with the number of plans using every file
+func (p *Project) GetFiles() ([]*ProjectFile, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select f.filename, f.created_time, count(s.plan_id) from project_file f
+		left join plan_shared_file s on s.project_id = f.project_id and s.filename = f.filename
+		where f.project_id=? group by f.filename, f.created_time order by f.filename`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := []*ProjectFile{}
+	for rows.Next() {
+		f := new(ProjectFile)
+		if err := rows.Scan(&f.Filename, &f.CreatedTime, &f.References); err != nil {
+			return nil, err
+		}
+		f.Filepath = p.MakeFileName(f.Filename)
+		f.Filelink = object_storage.Client.Storage.GetUrl(f.Filepath)
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func (p *Project) hasFile(filename string) (bool, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select count(*) from project_file where project_id=? and filename=?")
+	if err != nil {
+		return false, err
+	}
+	defer q.Close()
+	var count int
+	if err := q.QueryRow(p.ID, filename).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (p *Project) fileReferences(filename string) (int, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select count(*) from plan_shared_file where project_id=? and filename=?")
+	if err != nil {
+		return 0, err
+	}
+	defer q.Close()
+	var count int
+	if err := q.QueryRow(p.ID, filename).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// DeleteFile removes a file from the library. It fails while plans still use the file. The file is only deleted when
+// no plan uses it in the same statement, so a plan cannot start using it meanwhile
+func (p *Project) DeleteFile(filename string) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`delete from project_file where project_id=? and filename=? and not exists
+		(select 1 from plan_shared_file s where s.project_id=? and s.filename=?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	r, err := q.Exec(p.ID, filename, p.ID, filename)
+	if err != nil {
+		return err
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		references, err := p.fileReferences(filename)
+		if err != nil {
+			return err
+		}
+		if references > 0 {
+			return fmt.Errorf("%w: %s is used by %d plans", ErrProjectFileInUse, filename, references)
+		}
+	}
+	return object_storage.Client.Storage.Delete(p.MakeFileName(filename))
+}
+
+func (p *Project) DeleteAllFiles() error {
+	files, err := p.GetFiles()
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := p.DeleteFile(f.Filename); err != nil {
+			log.Error(err)
+		}
+	}
+	return nil
+}
+
+// ShareFile makes the plan use a file of the library of its project. The file is sent to the engines like the data
+// files of the plan.
+func (pl *Plan) ShareFile(filename string) error {
+	if IsFragment(filename) {
+		return fmt.Errorf("%s is a fragment, the plans using it include it from their test plan", filename)
+	}
+	for _, f := range pl.Data {
+		if f.Filename == filename {
+			return fmt.Errorf("the plan already has a file named %s", filename)
+		}
+	}
+	db := config.SC.DBC
+	// The file is shared only if it's in the library, in the same statement so it cannot be deleted meanwhile
+	q, err := db.Prepare(`insert into plan_shared_file (plan_id, project_id, filename)
+		select ?, project_id, filename from project_file where project_id=? and filename=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	r, err := q.Exec(pl.ID, pl.ProjectID, filename)
+	if err != nil {
+		return err
+	}
+	if n, err := r.RowsAffected(); err != nil || n == 0 {
+		return &DBError{Err: errors.New("not found"), Message: fmt.Sprintf("file %s is not in the library of the project", filename)}
+	}
+	return nil
+}
+
+// UnshareFile stops the plan using a file of the library. The file stays in the library
+func (pl *Plan) UnshareFile(filename string) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from plan_shared_file where plan_id=? and filename=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(pl.ID, filename)
+	return err
+}
+
+func (pl *Plan) isSharedFile(filename string) (bool, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select count(*) from plan_shared_file where plan_id=? and filename=?")
+	if err != nil {
+		return false, err
+	}
+	defer q.Close()
+	var count int
+	if err := q.QueryRow(pl.ID, filename).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// getSharedFiles are the files of the library the plan uses. They are stored once in the library
+func (pl *Plan) getSharedFiles() ([]*SetagayaFile, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select filename from plan_shared_file where plan_id=? order by filename")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(pl.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	project := &Project{ID: pl.ProjectID}
+	files := []*SetagayaFile{}
+	for rows.Next() {
+		f := new(SetagayaFile)
+		if err := rows.Scan(&f.Filename); err != nil {
+			return nil, err
+		}
+		f.Filepath = project.MakeFileName(f.Filename)
+		f.Filelink = object_storage.Client.Storage.GetUrl(f.Filepath)
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func (pl *Plan) unshareAllFiles() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from plan_shared_file where plan_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(pl.ID)
+	return err
+}
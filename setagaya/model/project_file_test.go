@@ -0,0 +1,52 @@
+package model
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestProjectFileName(t *testing.T) {
+	p := &Project{ID: 7}
+	assert.Equal(t, "project/7/users.csv", p.MakeFileName("users.csv"))
+}
+
+func TestProjectStoreTestFile(t *testing.T) {
+	p := &Project{ID: 7}
+	for _, filename := range []string{"checkout.spec.js", "checkout.spec.ts"} {
+		err := p.StoreFile(io.NopCloser(strings.NewReader("")), filename)
+		assert.Error(t, err, filename)
+	}
+}
+
+func TestProjectFileShareAndDelete(t *testing.T) {
+	SetupLocalDatabase(t)
+	db := config.SC.DBC
+	p := &Project{ID: 7}
+	_, err := db.Exec("insert into project_file (project_id, filename) values (?, ?)", p.ID, "users.csv")
+	assert.NoError(t, err)
+	pl := &Plan{ID: 3, ProjectID: p.ID}
+	assert.NoError(t, pl.ShareFile("users.csv"))
+
+	// The file is kept while a plan uses it
+	assert.ErrorIs(t, p.DeleteFile("users.csv"), ErrProjectFileInUse)
+	files, err := p.GetFiles()
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, 1, files[0].References)
+	}
+
+	// A file which is not in the library, or not anymore, is not shared
+	_, err = db.Exec("delete from project_file where project_id=? and filename=?", p.ID, "users.csv")
+	assert.NoError(t, err)
+	other := &Plan{ID: 4, ProjectID: p.ID}
+	var dbErr *DBError
+	assert.ErrorAs(t, other.ShareFile("users.csv"), &dbErr)
+	shared, err := other.isSharedFile("users.csv")
+	assert.NoError(t, err)
+	assert.False(t, shared)
+}
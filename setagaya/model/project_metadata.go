@@ -0,0 +1,139 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	maxProjectMetadata = 20
+	// Kubernetes limits the total size of the annotations of an object to 256kB, the engines need room for theirs
+	maxAnnotationsSize = 64 * 1024
+)
+
+var (
+	// Keys of the domains of kubernetes, they drive the behaviour of the cluster
+	defaultReservedMetadataPrefixes = []string{"kubernetes.io/", "k8s.io/"}
+	// Labels Setagaya finds its resources with
+	setagayaLabels = []string{"app", "collection", "kind", "plan", "project", "tenant"}
+)
+
+// ProjectMetadata are the labels and the annotations added to all the engine resources of a project, e.g. the
+// cost center of the team or the exclusion of the istio sidecar. They never replace the ones of Setagaya.
+type ProjectMetadata struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// isReservedMetadataKey tells whether the key falls under one of the prefixes. A prefix ending with a slash is a
+// domain, the keys of its subdomains are reserved as well, e.g. node.kubernetes.io/ under kubernetes.io/.
+func isReservedMetadataKey(key string, prefixes []string) bool {
+	domain, _, prefixed := strings.Cut(key, "/")
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+		if prefixed && strings.HasSuffix(p, "/") && strings.HasSuffix(domain, "."+strings.TrimSuffix(p, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateMetadataKey(kind, key string, reserved []string) error {
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return fmt.Errorf("%s %s is invalid: %s", kind, key, strings.Join(errs, ", "))
+	}
+	if isReservedMetadataKey(key, reserved) {
+		return fmt.Errorf("%s %s is reserved", kind, key)
+	}
+	return nil
+}
+
+// Validate checks the labels and the annotations are valid in kubernetes and none of their keys is reserved. The
+// reserved prefixes of the config come on top of the default ones.
+func (pm *ProjectMetadata) Validate(reservedPrefixes []string) error {
+	if len(pm.Labels) > maxProjectMetadata || len(pm.Annotations) > maxProjectMetadata {
+		return fmt.Errorf("a project can have up to %d labels and %d annotations", maxProjectMetadata, maxProjectMetadata)
+	}
+	reserved := append(append([]string{}, defaultReservedMetadataPrefixes...), reservedPrefixes...)
+	for key, value := range pm.Labels {
+		if err := validateMetadataKey("label", key, reserved); err != nil {
+			return err
+		}
+		if slices.Contains(setagayaLabels, key) {
+			return fmt.Errorf("label %s is reserved", key)
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("value of label %s is invalid: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	size := 0
+	for key, value := range pm.Annotations {
+		if err := validateMetadataKey("annotation", key, reserved); err != nil {
+			return err
+		}
+		size += len(key) + len(value)
+	}
+	if size > maxAnnotationsSize {
+		return fmt.Errorf("the annotations of a project can take up to %d bytes", maxAnnotationsSize)
+	}
+	return nil
+}
+
+// GetProjectMetadata returns the labels and the annotations of the engine resources of the project. It's nil when
+// the project has none
+func GetProjectMetadata(projectID int64) (*ProjectMetadata, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select metadata from project_metadata where project_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	var raw []byte
+	if err := q.QueryRow(projectID).Scan(&raw); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	pm := new(ProjectMetadata)
+	if err := json.Unmarshal(raw, pm); err != nil {
+		return nil, err
+	}
+	return pm, nil
+}
+
+func SetProjectMetadata(projectID int64, pm *ProjectMetadata) error {
+	raw, err := json.Marshal(pm)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into project_metadata (project_id, metadata) values (?, ?)
+		on duplicate key update metadata=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(projectID, raw, raw)
+	return err
+}
+
+func DeleteProjectMetadata(projectID int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from project_metadata where project_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(projectID)
+	return err
+}
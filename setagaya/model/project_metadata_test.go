@@ -0,0 +1,44 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectMetadataValidate(t *testing.T) {
+	pm := &ProjectMetadata{
+		Labels:      map[string]string{"cost-center": "cc-1234", "example.com/team": "payments"},
+		Annotations: map[string]string{"sidecar.istio.io/inject": "false"},
+	}
+	assert.NoError(t, pm.Validate(nil))
+	assert.NoError(t, (&ProjectMetadata{}).Validate(nil))
+	// The reserved prefixes of the config cover the subdomains
+	assert.Error(t, pm.Validate([]string{"istio.io/"}))
+	assert.Error(t, pm.Validate([]string{"cost-"}))
+
+	invalid := []*ProjectMetadata{
+		{Labels: map[string]string{"app": "mine"}},
+		{Labels: map[string]string{"collection": "1"}},
+		{Labels: map[string]string{"kubernetes.io/hostname": "node-1"}},
+		{Labels: map[string]string{"node.kubernetes.io/instance-type": "large"}},
+		{Labels: map[string]string{"team": "payments and billing"}},
+		{Labels: map[string]string{"-team": "payments"}},
+		{Annotations: map[string]string{"k8s.io/owner": "payments"}},
+		{Annotations: map[string]string{"docs": strings.Repeat("a", maxAnnotationsSize)}},
+	}
+	for _, pm := range invalid {
+		assert.Error(t, pm.Validate(nil))
+	}
+}
+
+func TestIsReservedMetadataKey(t *testing.T) {
+	prefixes := []string{"kubernetes.io/", "setagaya"}
+	assert.True(t, isReservedMetadataKey("kubernetes.io/arch", prefixes))
+	assert.True(t, isReservedMetadataKey("topology.kubernetes.io/zone", prefixes))
+	assert.True(t, isReservedMetadataKey("setagaya.io/run", prefixes))
+	assert.False(t, isReservedMetadataKey("notkubernetes.io/arch", prefixes))
+	assert.False(t, isReservedMetadataKey("kubernetes.io", prefixes))
+	assert.False(t, isReservedMetadataKey("team", prefixes))
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// The top level domains of the host names redacted without a url around them. The words with a dot are too often
+// file names or java classes to redact them all, e.g. results.jtl or java.io.IOException
+var redactedTLDs = map[string]bool{
+	"com": true, "net": true, "org": true, "edu": true, "gov": true, "io": true, "co": true, "dev": true,
+	"app": true, "cloud": true, "ai": true, "info": true, "biz": true, "me": true, "us": true, "uk": true,
+	"de": true, "fr": true, "jp": true, "cn": true, "kr": true, "in": true, "au": true, "ca": true, "eu": true,
+	"local": true, "internal": true, "corp": true, "lan": true, "intra": true, "example": true, "test": true,
+}
+
+var (
+	emailPattern    = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+`)
+	urlHostPattern  = regexp.MustCompile(`(?i)\b([a-z][a-z0-9+.-]*://)(?:[^/?#\s@"']*@)?[^/?#\s"'<>]+`)
+	ipPattern       = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	hostnamePattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}\b`)
+)
+
+// Redactor strips the identifiers of the users and the hosts of the system under test from the texts of a run. The
+// users are replaced by a pseudonym, the same one for every occurrence, so the reader can still tell them apart.
+type Redactor struct {
+	redactions config.Redactions
+	users      map[string]string
+}
+
+// NewRedactor returns a redactor applying the rules after the built-in ones
+func NewRedactor(rules []*config.RedactionRule) (*Redactor, error) {
+	redactions, err := config.CompileRedactions(rules)
+	if err != nil {
+		return nil, err
+	}
+	return &Redactor{redactions: redactions, users: map[string]string{}}, nil
+}
+
+// User returns the pseudonym of the user. Its occurrences in the texts are replaced by it too
+func (r *Redactor) User(user string) string {
+	if user == "" {
+		return ""
+	}
+	if pseudonym, ok := r.users[user]; ok {
+		return pseudonym
+	}
+	pseudonym := fmt.Sprintf("user-%d", len(r.users)+1)
+	r.users[user] = pseudonym
+	return pseudonym
+}
+
+// String redacts the text
+func (r *Redactor) String(s string) string {
+	if s == "" {
+		return s
+	}
+	// The longest users first, so a user containing another one is replaced whole
+	users := make([]string, 0, len(r.users))
+	for user := range r.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return len(users[i]) > len(users[j]) })
+	for _, user := range users {
+		s = strings.ReplaceAll(s, user, r.users[user])
+	}
+	s = emailPattern.ReplaceAllString(s, "[email]")
+	s = urlHostPattern.ReplaceAllString(s, "${1}[host]")
+	s = ipPattern.ReplaceAllString(s, "[ip]")
+	s = hostnamePattern.ReplaceAllStringFunc(s, func(host string) string {
+		if !redactedTLDs[strings.ToLower(host[strings.LastIndex(host, ".")+1:])] {
+			return host
+		}
+		return "[host]"
+	})
+	return r.redactions.Apply(s)
+}
+
+// redactKeys redacts the keys of the map, typically the labels of the samplers. The keys redacted the same way are
+// numbered, e.g. the same request to two hosts, so none of them is lost
+func redactKeys[T any](r *Redactor, m map[string]T) map[string]T {
+	if m == nil {
+		return nil
+	}
+	redacted := make(map[string]T, len(m))
+	// In order, so the numbering does not depend on the order of the map
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		base := r.String(k)
+		rk := base
+		for i := 2; ; i++ {
+			if _, ok := redacted[rk]; !ok {
+				break
+			}
+			rk = fmt.Sprintf("%s #%d", base, i)
+		}
+		redacted[rk] = m[k]
+	}
+	return redacted
+}
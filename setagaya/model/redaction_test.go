@@ -0,0 +1,76 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestRedactorString(t *testing.T) {
+	r, err := NewRedactor([]*config.RedactionRule{
+		{Pattern: `order-[0-9]+`},
+		{Pattern: `(tenant)=\w+`, Replacement: "${1}=x"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", r.User("alice"))
+	assert.Equal(t, "user-1", r.User("alice"))
+
+	cases := map[string]string{
+		"POST https://api.example.com:8443/login?u=1": "POST https://[host]/login?u=1",
+		"mailto bob@example.co.jp please":             "mailto [email] please",
+		"Connection refused: 10.0.12.7:443":           "Connection refused: [ip]:443",
+		"UnknownHostException: checkout.internal":     "UnknownHostException: [host]",
+		"stopped by alice":                            "stopped by user-1",
+		"missing order-1234":                          "missing [REDACTED]",
+		"/api/items?tenant=acme":                      "/api/items?tenant=x",
+		// Files and java classes are left alone
+		"java.io.IOException reading results.jtl": "java.io.IOException reading results.jtl",
+	}
+	for in, out := range cases {
+		assert.Equal(t, out, r.String(in), in)
+	}
+
+	_, err = NewRedactor([]*config.RedactionRule{{Pattern: "("}})
+	assert.Error(t, err)
+}
+
+func TestRunExportAnonymize(t *testing.T) {
+	r, err := NewRedactor(nil)
+	assert.NoError(t, err)
+	e := &RunExport{
+		Run: &RunHistory{
+			Summary: &RunSummary{
+				Samples: 10,
+				Assertions: map[string]*LabelAssertions{
+					"https://a.example.com/login": {Samples: 4, Failures: map[string]uint64{"expected 200 from a.example.com": 1}},
+					"https://b.example.com/login": {Samples: 6},
+				},
+			},
+			Metadata: &RunMetadata{Branch: "carol/fix", BuildURL: "https://ci.example.com/build/1"},
+			Retries:  []*PlanRetry{{CreatedBy: "carol", Message: "retried by carol"}},
+		},
+		Errors: &RunErrors{Labels: map[string][]*RunError{
+			"GET http://10.0.0.1/": {{Label: "GET http://10.0.0.1/", Message: "timeout to 10.0.0.1"}},
+		}},
+		Logs: map[int64]string{1: "connecting to db.corp"},
+	}
+	e.Anonymize(r)
+
+	assert.True(t, e.Anonymized)
+	s := e.Run.Summary
+	assert.Equal(t, uint64(10), s.Samples)
+	// The same request to two hosts stays two labels
+	assert.Equal(t, uint64(4), s.Assertions["https://[host]/login"].Samples)
+	assert.Equal(t, uint64(6), s.Assertions["https://[host]/login #2"].Samples)
+	assert.Equal(t, map[string]uint64{"expected 200 from [host]": 1}, s.Assertions["https://[host]/login"].Failures)
+	assert.Equal(t, "user-1/fix", e.Run.Metadata.Branch)
+	assert.Equal(t, "https://[host]/build/1", e.Run.Metadata.BuildURL)
+	assert.Equal(t, "user-1", e.Run.Retries[0].CreatedBy)
+	assert.Equal(t, "retried by user-1", e.Run.Retries[0].Message)
+	errs := e.Errors.Labels["GET http://[host]/"]
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "timeout to [ip]", errs[0].Message)
+	assert.Equal(t, "connecting to [host]", e.Logs[1])
+}
@@ -0,0 +1,142 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// RegionWeight tells how much of the traffic of a plan should come from a region, in percentage.
+// Engines of the plan are distributed across the regions according to the weights so the traffic mimics
+// the geography of the real users.
+type RegionWeight struct {
+	Region string `yaml:"region" json:"region"`
+	Weight int    `yaml:"weight" json:"weight"`
+}
+
+func ValidateRegionWeights(regions []*RegionWeight, engines int) error {
+	if len(regions) == 0 {
+		return nil
+	}
+	if len(regions) > engines {
+		return fmt.Errorf("plan has %d regions but only %d engines", len(regions), engines)
+	}
+	total := 0
+	seen := map[string]struct{}{}
+	for _, r := range regions {
+		if r.Region == "" {
+			return errors.New("region name cannot be empty")
+		}
+		if _, ok := seen[r.Region]; ok {
+			return fmt.Errorf("region %s is specified more than once", r.Region)
+		}
+		seen[r.Region] = struct{}{}
+		if r.Weight <= 0 {
+			return fmt.Errorf("weight of region %s must be positive", r.Region)
+		}
+		total += r.Weight
+	}
+	if total != 100 {
+		return fmt.Errorf("region weights must add up to 100, got %d", total)
+	}
+	return nil
+}
+
+// AssignEngineRegions returns the region of every engine of a plan. It uses the largest remainder method so
+// the engine counts are as close as possible to the weights. Every region gets at least one engine.
+func AssignEngineRegions(regions []*RegionWeight, engines int) []string {
+	if len(regions) == 0 || engines <= 0 {
+		return nil
+	}
+	type share struct {
+		idx       int
+		count     int
+		remainder float64
+	}
+	shares := make([]*share, len(regions))
+	assigned := 0
+	for i, r := range regions {
+		exact := float64(engines) * float64(r.Weight) / 100
+		count := int(exact)
+		shares[i] = &share{idx: i, count: count, remainder: exact - float64(count)}
+		assigned += count
+	}
+	byRemainder := make([]*share, len(shares))
+	copy(byRemainder, shares)
+	sort.SliceStable(byRemainder, func(i, j int) bool {
+		return byRemainder[i].remainder > byRemainder[j].remainder
+	})
+	for i := 0; assigned < engines; i++ {
+		byRemainder[i%len(byRemainder)].count++
+		assigned++
+	}
+	// Make sure no region is left out when there are only a few engines
+	for _, s := range shares {
+		if s.count > 0 {
+			continue
+		}
+		for _, donor := range byRemainder {
+			if donor.count > 1 {
+				donor.count--
+				s.count++
+				break
+			}
+		}
+	}
+	r := make([]string, 0, engines)
+	for _, s := range shares {
+		for i := 0; i < s.count; i++ {
+			r = append(r, regions[s.idx].Region)
+		}
+	}
+	return r
+}
+
+func (c *Collection) StorePlanRegions(planID int64, regions []*RegionWeight) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_plan_region where collection_id=? and plan_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err = q.Exec(c.ID, planID); err != nil {
+		return err
+	}
+	if len(regions) == 0 {
+		return nil
+	}
+	q2, err := db.Prepare("insert into collection_plan_region (collection_id, plan_id, region, weight) values (?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer q2.Close()
+	for _, r := range regions {
+		if _, err := q2.Exec(c.ID, planID, r.Region, r.Weight); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Collection) GetPlanRegions(planID int64) ([]*RegionWeight, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select region, weight from collection_plan_region where collection_id=? and plan_id=? order by region")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(c.ID, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := []*RegionWeight{}
+	for rows.Next() {
+		rw := new(RegionWeight)
+		rows.Scan(&rw.Region, &rw.Weight)
+		r = append(r, rw)
+	}
+	return r, rows.Err()
+}
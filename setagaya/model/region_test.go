@@ -0,0 +1,35 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRegionWeights(t *testing.T) {
+	assert.NoError(t, ValidateRegionWeights(nil, 1))
+	assert.NoError(t, ValidateRegionWeights([]*RegionWeight{{"asia", 70}, {"europe", 30}}, 2))
+	assert.Error(t, ValidateRegionWeights([]*RegionWeight{{"asia", 70}, {"europe", 20}}, 2))
+	assert.Error(t, ValidateRegionWeights([]*RegionWeight{{"asia", 100}, {"europe", 0}}, 2))
+	assert.Error(t, ValidateRegionWeights([]*RegionWeight{{"asia", 50}, {"asia", 50}}, 2))
+	assert.Error(t, ValidateRegionWeights([]*RegionWeight{{"", 100}}, 2))
+	assert.Error(t, ValidateRegionWeights([]*RegionWeight{{"asia", 50}, {"europe", 50}}, 1))
+}
+
+func TestAssignEngineRegions(t *testing.T) {
+	count := func(regions []string) map[string]int {
+		m := map[string]int{}
+		for _, r := range regions {
+			m[r]++
+		}
+		return m
+	}
+	weights := []*RegionWeight{{"asia", 60}, {"europe", 30}, {"us", 10}}
+
+	assert.Nil(t, AssignEngineRegions(nil, 3))
+	assert.Equal(t, map[string]int{"asia": 6, "europe": 3, "us": 1}, count(AssignEngineRegions(weights, 10)))
+	assert.Equal(t, map[string]int{"asia": 4, "europe": 2, "us": 1}, count(AssignEngineRegions(weights, 7)))
+	// Every region gets at least one engine
+	assert.Equal(t, map[string]int{"asia": 1, "europe": 1, "us": 1}, count(AssignEngineRegions(weights, 3)))
+	assert.Len(t, AssignEngineRegions(weights, 25), 25)
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	maxImagePullSecrets = 10
+	maxImageLength      = 255
+)
+
+// Names of the kubernetes secrets
+var secretNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// ProjectRegistry lets the engines of a project run custom images out of private registries
+type ProjectRegistry struct {
+	// Images by engine type. The engine types not in it run the image of the config
+	Images map[string]string `json:"images,omitempty"`
+	// Secrets in the namespace of the engines to pull the images with. They are checked when the engines are deployed
+	ImagePullSecrets []string `json:"image_pull_secrets"`
+}
+
+func (pr *ProjectRegistry) Validate() error {
+	for engineType, image := range pr.Images {
+		if engineType != JmeterEngine && engineType != PlaywrightEngine {
+			return fmt.Errorf("engine type %s is unknown", engineType)
+		}
+		if image == "" || len(image) > maxImageLength || strings.ContainsAny(image, " \t\n") {
+			return fmt.Errorf("image of the %s engine is invalid", engineType)
+		}
+	}
+	if len(pr.ImagePullSecrets) > maxImagePullSecrets {
+		return fmt.Errorf("a project can have up to %d image pull secrets", maxImagePullSecrets)
+	}
+	for _, name := range pr.ImagePullSecrets {
+		if len(name) > 253 || !secretNamePattern.MatchString(name) {
+			return fmt.Errorf("image pull secret %s is not a valid secret name", name)
+		}
+	}
+	return nil
+}
+
+// CustomImage returns the image the engines of the type run instead of the one of the config
+func (pr *ProjectRegistry) CustomImage(engineType string) (string, bool) {
+	if pr == nil {
+		return "", false
+	}
+	image, ok := pr.Images[engineType]
+	return image, ok
+}
+
+// EngineContainer returns the container of the engines of the type with the image and the pull secrets of the
+// project. The container of the config is left untouched.
+func (pr *ProjectRegistry) EngineContainer(engineType string, ec *config.ExecutorContainer) *config.ExecutorContainer {
+	if pr == nil || ec == nil {
+		return ec
+	}
+	c := *ec
+	if image, ok := pr.CustomImage(engineType); ok {
+		c.Image = image
+	}
+	c.ImagePullSecrets = append(append([]string{}, ec.ImagePullSecrets...), pr.ImagePullSecrets...)
+	return &c
+}
+
+// GetProjectRegistry returns the registry settings of the project. It's nil when the project has none
+func GetProjectRegistry(projectID int64) (*ProjectRegistry, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select registry from project_registry where project_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	var raw []byte
+	if err := q.QueryRow(projectID).Scan(&raw); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	pr := new(ProjectRegistry)
+	if err := json.Unmarshal(raw, pr); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+func SetProjectRegistry(projectID int64, pr *ProjectRegistry) error {
+	raw, err := json.Marshal(pr)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into project_registry (project_id, registry) values (?, ?)
+		on duplicate key update registry=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(projectID, raw, raw)
+	return err
+}
+
+func DeleteProjectRegistry(projectID int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from project_registry where project_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(projectID)
+	return err
+}
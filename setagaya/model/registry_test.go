@@ -0,0 +1,51 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestProjectRegistryValidate(t *testing.T) {
+	pr := &ProjectRegistry{
+		Images:           map[string]string{JmeterEngine: "registry.example.com/team/jmeter:5.6"},
+		ImagePullSecrets: []string{"team-registry", "registry.example.com"},
+	}
+	assert.NoError(t, pr.Validate())
+	assert.NoError(t, (&ProjectRegistry{}).Validate())
+
+	invalid := []*ProjectRegistry{
+		{Images: map[string]string{"k6": "grafana/k6"}},
+		{Images: map[string]string{JmeterEngine: ""}},
+		{Images: map[string]string{PlaywrightEngine: "team/playwright latest"}},
+		{ImagePullSecrets: []string{"Team_Registry"}},
+		{ImagePullSecrets: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k"}},
+	}
+	for _, pr := range invalid {
+		assert.Error(t, pr.Validate())
+	}
+}
+
+func TestProjectRegistryEngineContainer(t *testing.T) {
+	ec := &config.ExecutorContainer{Image: "setagaya/jmeter", CPU: "1", Mem: "2Gi", ImagePullSecrets: []string{"shared"}}
+	var none *ProjectRegistry
+	assert.Same(t, ec, none.EngineContainer(JmeterEngine, ec))
+
+	pr := &ProjectRegistry{
+		Images:           map[string]string{JmeterEngine: "registry.example.com/team/jmeter:5.6"},
+		ImagePullSecrets: []string{"team-registry"},
+	}
+	c := pr.EngineContainer(JmeterEngine, ec)
+	assert.Equal(t, "registry.example.com/team/jmeter:5.6", c.Image)
+	assert.Equal(t, "1", c.CPU)
+	assert.Equal(t, []string{"shared", "team-registry"}, c.ImagePullSecrets)
+	// The container of the config is left untouched
+	assert.Equal(t, "setagaya/jmeter", ec.Image)
+	assert.Equal(t, []string{"shared"}, ec.ImagePullSecrets)
+
+	c = pr.EngineContainer(PlaywrightEngine, &config.ExecutorContainer{Image: "setagaya/playwright"})
+	assert.Equal(t, "setagaya/playwright", c.Image)
+	assert.Equal(t, []string{"team-registry"}, c.ImagePullSecrets)
+}
@@ -0,0 +1,192 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// Reservations are booked at most that long in advance, and for at most that long
+const (
+	MaxReservationLead   = 30 * 24 * time.Hour
+	MaxReservationWindow = 24 * time.Hour
+)
+
+// Reservation holds room in the cluster for the engines of a collection during a window, e.g. for a scheduled
+// critical test. The engines of the other collections are not deployed when they would take the room reserved and
+// not used yet.
+type Reservation struct {
+	ID           int64 `json:"id"`
+	CollectionID int64 `json:"collection_id"`
+	Engines      int   `json:"engines"`
+	// Resources of every engine, the ones of the jmeter engines by default
+	CPU         string    `json:"cpu"`
+	Mem         string    `json:"mem"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+// Validate checks the reservation is for some engines of a known size, during a window which did not end yet
+func (r *Reservation) Validate(now time.Time) error {
+	if r.Engines <= 0 {
+		return errors.New("engines should be more than 0")
+	}
+	if limit := config.SC.ExecutorConfig.MaxEnginesInCollection; limit > 0 && r.Engines > limit {
+		return fmt.Errorf("a collection cannot have more than %d engines", limit)
+	}
+	if _, err := resource.ParseQuantity(r.CPU); err != nil {
+		return fmt.Errorf("invalid cpu %q", r.CPU)
+	}
+	if _, err := resource.ParseQuantity(r.Mem); err != nil {
+		return fmt.Errorf("invalid mem %q", r.Mem)
+	}
+	if !r.EndTime.After(r.StartTime) {
+		return errors.New("end_time should be after start_time")
+	}
+	if !r.EndTime.After(now) {
+		return errors.New("the window already ended")
+	}
+	if r.StartTime.After(now.Add(MaxReservationLead)) {
+		return fmt.Errorf("reservations cannot start more than %s ahead", MaxReservationLead)
+	}
+	if r.EndTime.Sub(r.StartTime) > MaxReservationWindow {
+		return fmt.Errorf("reservations cannot last more than %s", MaxReservationWindow)
+	}
+	return nil
+}
+
+// Resources is what the given number of engines of the reservation request. Validate makes sure the sizes parse.
+func (r *Reservation) Resources(engines int) apiv1.ResourceList {
+	rl := apiv1.ResourceList{}
+	if engines <= 0 {
+		return rl
+	}
+	for name, size := range map[apiv1.ResourceName]string{apiv1.ResourceCPU: r.CPU, apiv1.ResourceMemory: r.Mem} {
+		q, err := resource.ParseQuantity(size)
+		if err != nil {
+			continue
+		}
+		total := resource.Quantity{}
+		for i := 0; i < engines; i++ {
+			total.Add(q)
+		}
+		rl[name] = total
+	}
+	return rl
+}
+
+// Overlaps tells whether the reservation holds room at some point between start and end
+func (r *Reservation) Overlaps(start, end time.Time) bool {
+	return r.StartTime.Before(end) && r.EndTime.After(start)
+}
+
+// IsActive tells whether the reservation holds room at the time
+func (r *Reservation) IsActive(now time.Time) bool {
+	return !r.StartTime.After(now) && r.EndTime.After(now)
+}
+
+const reservationColumns = "id, collection_id, engines, cpu, mem, start_time, end_time, created_by, created_time"
+
+func scanReservation(row interface{ Scan(...any) error }) (*Reservation, error) {
+	r := new(Reservation)
+	if err := row.Scan(&r.ID, &r.CollectionID, &r.Engines, &r.CPU, &r.Mem, &r.StartTime, &r.EndTime, &r.CreatedBy,
+		&r.CreatedTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func queryReservations(query string, args ...any) ([]*Reservation, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + reservationColumns + " from collection_reservation " + query)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reservations := []*Reservation{}
+	for rows.Next() {
+		r, err := scanReservation(rows)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, r)
+	}
+	return reservations, rows.Err()
+}
+
+// GetReservations returns the reservations of the collection which did not end yet, the earliest first
+func GetReservations(collectionID int64, now time.Time) ([]*Reservation, error) {
+	return queryReservations("where collection_id=? and end_time>? order by start_time", collectionID, now)
+}
+
+// GetOverlappingReservations returns the reservations of all the collections holding room between start and end
+func GetOverlappingReservations(start, end time.Time) ([]*Reservation, error) {
+	return queryReservations("where start_time<? and end_time>? order by start_time", end, start)
+}
+
+func GetReservation(collectionID, id int64) (*Reservation, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + reservationColumns + " from collection_reservation where id=? and collection_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	r, err := scanReservation(q.QueryRow(id, collectionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &DBError{Err: err, Message: "reservation not found"}
+	}
+	return r, err
+}
+
+func CreateReservation(r *Reservation) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_reservation (collection_id, engines, cpu, mem, start_time, end_time,
+		created_by) values (?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	res, err := q.Exec(r.CollectionID, r.Engines, r.CPU, r.Mem, r.StartTime, r.EndTime, r.CreatedBy)
+	if err != nil {
+		return err
+	}
+	r.CreatedTime = time.Now()
+	r.ID, err = res.LastInsertId()
+	return err
+}
+
+// Delete releases the room held by the reservation, even when its window started
+func (r *Reservation) Delete() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_reservation where id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(r.ID)
+	return err
+}
+
+func (c *Collection) deleteReservations() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_reservation where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestReservationValidate(t *testing.T) {
+	ec := config.SC.ExecutorConfig
+	defer func() { config.SC.ExecutorConfig = ec }()
+	config.SC.ExecutorConfig = &config.ExecutorConfig{MaxEnginesInCollection: 10}
+
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	valid := func() *Reservation {
+		return &Reservation{Engines: 4, CPU: "1", Mem: "2Gi", StartTime: now.Add(time.Hour),
+			EndTime: now.Add(2 * time.Hour)}
+	}
+	assert.NoError(t, valid().Validate(now))
+
+	r := valid()
+	r.StartTime = now.Add(-time.Hour)
+	assert.NoError(t, r.Validate(now), "a reservation can start in the past as long as it did not end")
+
+	r = valid()
+	r.Engines = 0
+	assert.Error(t, r.Validate(now))
+	r.Engines = 11
+	assert.Error(t, r.Validate(now))
+
+	r = valid()
+	r.Mem = "lots"
+	assert.Error(t, r.Validate(now))
+
+	r = valid()
+	r.EndTime = r.StartTime
+	assert.Error(t, r.Validate(now))
+
+	r = valid()
+	r.StartTime, r.EndTime = now.Add(-2*time.Hour), now
+	assert.Error(t, r.Validate(now))
+
+	r = valid()
+	r.StartTime, r.EndTime = now.Add(MaxReservationLead+time.Hour), now.Add(MaxReservationLead+2*time.Hour)
+	assert.Error(t, r.Validate(now))
+
+	r = valid()
+	r.EndTime = r.StartTime.Add(MaxReservationWindow + time.Minute)
+	assert.Error(t, r.Validate(now))
+}
+
+func TestReservationResources(t *testing.T) {
+	r := &Reservation{Engines: 3, CPU: "500m", Mem: "1Gi"}
+	rl := r.Resources(3)
+	cpu, mem := rl[apiv1.ResourceCPU], rl[apiv1.ResourceMemory]
+	assert.Equal(t, 0, cpu.Cmp(resource.MustParse("1500m")))
+	assert.Equal(t, 0, mem.Cmp(resource.MustParse("3Gi")))
+	assert.Empty(t, r.Resources(0))
+	assert.Empty(t, r.Resources(-1))
+}
+
+func TestReservationWindow(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	r := &Reservation{StartTime: start, EndTime: start.Add(time.Hour)}
+	assert.True(t, r.IsActive(start))
+	assert.True(t, r.IsActive(start.Add(59*time.Minute)))
+	assert.False(t, r.IsActive(start.Add(-time.Second)))
+	assert.False(t, r.IsActive(start.Add(time.Hour)))
+
+	assert.True(t, r.Overlaps(start.Add(-time.Hour), start.Add(time.Minute)))
+	assert.True(t, r.Overlaps(start.Add(30*time.Minute), start.Add(2*time.Hour)))
+	assert.False(t, r.Overlaps(start.Add(-time.Hour), start))
+	assert.False(t, r.Overlaps(start.Add(time.Hour), start.Add(2*time.Hour)))
+}
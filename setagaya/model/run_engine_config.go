@@ -0,0 +1,75 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// RunEngineConfig is what an engine was sent when the run was triggered, so a run can be reproduced
+type RunEngineConfig struct {
+	PlanID   int64 `json:"plan_id"`
+	EngineID int   `json:"engine_id"`
+	// Engine data config of the engine, without the secrets
+	Config json.RawMessage `json:"config"`
+	// Sha256 of the test plan as the engine modified it. Empty when the engine does not report it
+	JMXSHA256 string `json:"jmx_sha256,omitempty"`
+	// Versions of the agent and of JMeter or Playwright. Empty when the engine does not report them
+	AgentVersion  string    `json:"agent_version,omitempty"`
+	EngineVersion string    `json:"engine_version,omitempty"`
+	TriggeredTime time.Time `json:"triggered_time"`
+}
+
+// StoreRunEngineConfig keeps the config an engine was triggered with. A retried trigger replaces it
+func StoreRunEngineConfig(collectionID, runID int64, rec *RunEngineConfig) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_run_engine_config (run_id, collection_id, plan_id, engine_id, config,
+		jmx_sha256, agent_version, engine_version) values (?,?,?,?,?,?,?,?) on duplicate key update config=?,
+		jmx_sha256=?, agent_version=?, engine_version=?, triggered_time=NOW()`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(runID, collectionID, rec.PlanID, rec.EngineID, string(rec.Config), rec.JMXSHA256,
+		rec.AgentVersion, rec.EngineVersion, string(rec.Config), rec.JMXSHA256, rec.AgentVersion, rec.EngineVersion)
+	return err
+}
+
+func GetRunEngineConfigs(runID int64) ([]*RunEngineConfig, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select plan_id, engine_id, config, jmx_sha256, agent_version, engine_version, triggered_time
+		from collection_run_engine_config where run_id=? order by plan_id, engine_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	configs := []*RunEngineConfig{}
+	for rows.Next() {
+		rec := new(RunEngineConfig)
+		var raw string
+		if err := rows.Scan(&rec.PlanID, &rec.EngineID, &raw, &rec.JMXSHA256, &rec.AgentVersion, &rec.EngineVersion,
+			&rec.TriggeredTime); err != nil {
+			return nil, err
+		}
+		rec.Config = json.RawMessage(raw)
+		configs = append(configs, rec)
+	}
+	return configs, rows.Err()
+}
+
+func (c *Collection) deleteRunEngineConfigs() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_engine_config where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
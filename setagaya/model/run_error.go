@@ -0,0 +1,107 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	DefaultTopErrors = 10
+	MaxTopErrors     = 100
+)
+
+// RunError is the number of failed samples of a label with the same error in a run
+type RunError struct {
+	Label    string `json:"-"`
+	Category string `json:"category"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Count    uint64 `json:"count"`
+}
+
+// RunErrors is the error breakdown of a run, aggregated across all the engines
+type RunErrors struct {
+	// Failed samples by error category
+	Categories map[string]uint64 `json:"categories"`
+	// The most frequent errors of every label
+	Labels map[string][]*RunError `json:"labels"`
+}
+
+func truncate(s string, size int) string {
+	if len(s) > size {
+		return s[:size]
+	}
+	return s
+}
+
+func StoreRunErrors(collectionID, runID int64, errs []*RunError) error {
+	db := config.SC.DBC
+	tx, err := db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+	}()
+	q, err := tx.Prepare(`insert into collection_run_error (run_id, collection_id, label, category, code, message, count)
+		values (?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	for _, e := range errs {
+		if _, err := q.Exec(runID, collectionID, truncate(e.Label, 255), e.Category, truncate(e.Code, 255),
+			truncate(e.Message, 512), e.Count); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetRunErrors returns the error categories of the run and the top most frequent errors of every label
+func GetRunErrors(runID int64, top int) (*RunErrors, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select label, category, code, message, count from collection_run_error
+		where run_id=? order by label, count desc, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	r := &RunErrors{
+		Categories: map[string]uint64{},
+		Labels:     map[string][]*RunError{},
+	}
+	for rows.Next() {
+		e := new(RunError)
+		if err := rows.Scan(&e.Label, &e.Category, &e.Code, &e.Message, &e.Count); err != nil {
+			return nil, err
+		}
+		r.Categories[e.Category] += e.Count
+		if len(r.Labels[e.Label]) < top {
+			r.Labels[e.Label] = append(r.Labels[e.Label], e)
+		}
+	}
+	return r, rows.Err()
+}
+
+func (c *Collection) deleteRunErrors() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_error where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
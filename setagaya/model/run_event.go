@@ -0,0 +1,85 @@
+package model
+
+import (
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	RunEventChaosInjected = "chaos_injected"
+	RunEventChaosFailed   = "chaos_failed"
+	RunEventChaosRemoved  = "chaos_removed"
+	// The memory of an engine of a soak run kept growing
+	RunEventMemoryLeak   = "engine_memory_leak"
+	RunEventSoakExtended = "soak_extended"
+	// Nobody sent the heartbeat of an attended-only run in time, its engines ramp down and it stops
+	RunEventHeartbeatMissed = "heartbeat_missed"
+	// The plans starting after other plans of the collection
+	RunEventPlanWaiting     = "plan_waiting"
+	RunEventPlanStarted     = "plan_started"
+	RunEventPlanStartFailed = "plan_start_failed"
+	RunEventPlanStopped     = "plan_stopped"
+	RunEventPlanRetried     = "plan_retried"
+	RunEventPlanRetryFailed = "plan_retry_failed"
+	RunEventEngineReplaced  = "engine_replaced"
+	// jmeter properties pushed to the engines during the run. Only their names are recorded
+	RunEventPropertiesChanged = "properties_changed"
+	// The heavy listeners of a test plan the engines disabled
+	RunEventListenersStripped = "listeners_stripped"
+)
+
+// RunEvent is something that happened to the system under test during a run, e.g. a chaos experiment, so the
+// changes of its latencies can be attributed
+type RunEvent struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+}
+
+func AddRunEvent(collectionID, runID int64, kind, message string) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_run_event (run_id, collection_id, event_time, kind, message)
+		values (?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(runID, collectionID, time.Now(), kind, truncate(message, 1024))
+	return err
+}
+
+func GetRunEvents(runID int64) ([]*RunEvent, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select event_time, kind, message from collection_run_event where run_id=?
+		order by event_time, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []*RunEvent
+	for rows.Next() {
+		e := new(RunEvent)
+		if err := rows.Scan(&e.Time, &e.Kind, &e.Message); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (c *Collection) deleteRunEvents() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_event where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
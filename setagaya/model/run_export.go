@@ -0,0 +1,54 @@
+package model
+
+// RunExport is a run with its results and the logs of its engines, as a single document to share the results
+type RunExport struct {
+	Run    *RunHistory `json:"run"`
+	Errors *RunErrors  `json:"errors"`
+	// Logs of the engines by plan. Only the last run of the collection has them, while its engines are deployed
+	Logs map[int64]string `json:"logs,omitempty"`
+	// The users and the hosts of the system under test are redacted
+	Anonymized bool `json:"anonymized"`
+}
+
+// Anonymize redacts the identifiers of the users and the hosts from the export, so it can be shared with external
+// vendors. The figures of the run are kept as they are.
+func (e *RunExport) Anonymize(r *Redactor) {
+	run := e.Run
+	// The users are known before the texts are redacted, so their mentions are replaced too
+	for _, pr := range run.Retries {
+		pr.CreatedBy = r.User(pr.CreatedBy)
+	}
+	for _, pr := range run.Retries {
+		pr.Message = r.String(pr.Message)
+	}
+	if s := run.Summary; s != nil {
+		s.Assertions = redactKeys(r, s.Assertions)
+		for _, la := range s.Assertions {
+			la.Failures = redactKeys(r, la.Failures)
+		}
+		s.Transactions = redactKeys(r, s.Transactions)
+	}
+	if m := run.Metadata; m != nil {
+		m.Branch = r.String(m.Branch)
+		m.BuildURL = r.String(m.BuildURL)
+	}
+	for _, g := range run.Gaps {
+		g.Reason = r.String(g.Reason)
+	}
+	for _, ev := range run.Events {
+		ev.Message = r.String(ev.Message)
+	}
+	if e.Errors != nil {
+		e.Errors.Labels = redactKeys(r, e.Errors.Labels)
+		for _, errs := range e.Errors.Labels {
+			for _, re := range errs {
+				re.Label = r.String(re.Label)
+				re.Message = r.String(re.Message)
+			}
+		}
+	}
+	for planID, l := range e.Logs {
+		e.Logs[planID] = r.String(l)
+	}
+	e.Anonymized = true
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// RunGap is a period of a run whose samples are missing from the results of an engine,
+// e.g. because the engine was restarted. Metrics of the run do not cover it.
+type RunGap struct {
+	PlanID   int64 `json:"plan_id"`
+	EngineID int   `json:"engine_id"`
+	// Result file missing the samples. Empty when all the files of the engine are affected
+	File   string    `json:"file,omitempty"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+	// Number of missing samples when it's known
+	Samples uint64 `json:"samples,omitempty"`
+}
+
+func StoreRunGaps(collectionID, runID int64, gaps []*RunGap) error {
+	db := config.SC.DBC
+	tx, err := db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+	}()
+	q, err := tx.Prepare(`insert into collection_run_gap (run_id, collection_id, plan_id, engine_id, file, start_time,
+		end_time, reason, samples) values (?,?,?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	for _, g := range gaps {
+		if _, err := q.Exec(runID, collectionID, g.PlanID, g.EngineID, truncate(g.File, 255), g.Start, g.End,
+			truncate(g.Reason, 255), g.Samples); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func GetRunGaps(runID int64) ([]*RunGap, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select plan_id, engine_id, file, start_time, end_time, reason, samples from collection_run_gap
+		where run_id=? order by start_time, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var gaps []*RunGap
+	for rows.Next() {
+		g := new(RunGap)
+		if err := rows.Scan(&g.PlanID, &g.EngineID, &g.File, &g.Start, &g.End, &g.Reason, &g.Samples); err != nil {
+			return nil, err
+		}
+		gaps = append(gaps, g)
+	}
+	return gaps, rows.Err()
+}
+
+func (c *Collection) deleteRunGaps() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_gap where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
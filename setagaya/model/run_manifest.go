@@ -0,0 +1,153 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// RunManifest is everything a run was triggered with. It's written once when the run starts and never changed, so
+// the run can be reproduced and what changed since can be told.
+type RunManifest struct {
+	RunID        int64 `json:"run_id"`
+	CollectionID int64 `json:"collection_id"`
+	// Run this one reproduces, if any
+	ReproducedFrom int64            `json:"reproduced_from,omitempty"`
+	Trigger        *TriggerRequest  `json:"trigger"`
+	Plans          []*ExecutionPlan `json:"plans"`
+	// Variables of the collection, the ones of the plans are kept with the plans
+	Variables map[string]string `json:"variables,omitempty"`
+	Files     []*ManifestFile   `json:"files"`
+	// Digest of the image the engines of every plan run. Empty when the scheduler cannot tell
+	EngineImages map[int64]string `json:"engine_images"`
+	CreatedTime  time.Time        `json:"created_time"`
+}
+
+// ManifestFile is a file the engines were sent
+type ManifestFile struct {
+	// Plan the file belongs to, 0 for the files of the collection
+	PlanID   int64  `json:"plan_id,omitempty"`
+	Filepath string `json:"filepath"`
+	SHA256   string `json:"sha256"`
+}
+
+func (mf *ManifestFile) key() string {
+	return fmt.Sprintf("%d/%s", mf.PlanID, mf.Filepath)
+}
+
+// Diff lists what changed between the manifest and a newer one, the files, the execution plans, the trigger
+// inputs and the engine images
+func (m *RunManifest) Diff(current *RunManifest) []string {
+	changes := []string{}
+	files := map[string]*ManifestFile{}
+	for _, f := range m.Files {
+		files[f.key()] = f
+	}
+	for _, f := range current.Files {
+		old, ok := files[f.key()]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("file %s was added", f.Filepath))
+		case old.SHA256 != f.SHA256:
+			changes = append(changes, fmt.Sprintf("file %s changed", f.Filepath))
+		}
+		delete(files, f.key())
+	}
+	for _, f := range files {
+		changes = append(changes, fmt.Sprintf("file %s was removed", f.Filepath))
+	}
+	plans := map[int64]*ExecutionPlan{}
+	for _, ep := range m.Plans {
+		plans[ep.PlanID] = ep
+	}
+	for _, ep := range current.Plans {
+		old, ok := plans[ep.PlanID]
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("plan %d was added", ep.PlanID))
+		case !sameJSON(old, ep):
+			changes = append(changes, fmt.Sprintf("execution plan %d changed", ep.PlanID))
+		}
+		delete(plans, ep.PlanID)
+	}
+	for planID := range plans {
+		changes = append(changes, fmt.Sprintf("plan %d was removed", planID))
+	}
+	for planID, image := range current.EngineImages {
+		if old := m.EngineImages[planID]; old != "" && image != "" && old != image {
+			changes = append(changes, fmt.Sprintf("engine image of plan %d changed from %s to %s", planID, old, image))
+		}
+	}
+	if !sameJSON(m.Variables, current.Variables) {
+		changes = append(changes, "collection variables changed")
+	}
+	if !sameJSON(m.Trigger, current.Trigger) {
+		changes = append(changes, "trigger inputs changed")
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func sameJSON(a, b interface{}) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(ja) == string(jb)
+}
+
+// StoreRunManifest writes the manifest of a run. It fails when the run already has one
+func StoreRunManifest(m *RunManifest) error {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into collection_run_manifest (run_id, collection_id, manifest) values (?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err = q.Exec(m.RunID, m.CollectionID, string(raw)); err != nil {
+		return err
+	}
+	return storeRunFiles(m)
+}
+
+func GetRunManifest(runID int64) (*RunManifest, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select manifest, created_time from collection_run_manifest where run_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	var raw string
+	var createdTime time.Time
+	if err := q.QueryRow(runID).Scan(&raw, &createdTime); err != nil {
+		return nil, &DBError{Err: err, Message: "run manifest not found"}
+	}
+	m := new(RunManifest)
+	if err := json.Unmarshal([]byte(raw), m); err != nil {
+		return nil, err
+	}
+	m.CreatedTime = createdTime
+	return m, nil
+}
+
+func (c *Collection) deleteRunManifests() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_run_manifest where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
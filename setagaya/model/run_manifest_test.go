@@ -0,0 +1,50 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunManifestDiff(t *testing.T) {
+	base := &RunManifest{
+		Trigger: &TriggerRequest{Parameters: map[string]string{"host": "example.com"}},
+		Plans:   []*ExecutionPlan{{PlanID: 1, Engines: 2, Concurrency: 10}, {PlanID: 2, Engines: 1, Concurrency: 5}},
+		Files: []*ManifestFile{
+			{PlanID: 1, Filepath: "plan/1/test.jmx", SHA256: "aa"},
+			{PlanID: 2, Filepath: "plan/2/test.jmx", SHA256: "bb"},
+			{Filepath: "collection/3/users.csv", SHA256: "cc"},
+		},
+		EngineImages: map[int64]string{1: "jmeter@sha256:11", 2: "jmeter@sha256:11"},
+	}
+	same := &RunManifest{
+		Trigger:      &TriggerRequest{Parameters: map[string]string{"host": "example.com"}},
+		Plans:        []*ExecutionPlan{{PlanID: 1, Engines: 2, Concurrency: 10}, {PlanID: 2, Engines: 1, Concurrency: 5}},
+		Files:        base.Files,
+		EngineImages: map[int64]string{1: "jmeter@sha256:11", 2: ""},
+	}
+	assert.Empty(t, base.Diff(same))
+
+	changed := &RunManifest{
+		Trigger: &TriggerRequest{Parameters: map[string]string{"host": "staging.example.com"}},
+		Plans:   []*ExecutionPlan{{PlanID: 1, Engines: 2, Concurrency: 20}, {PlanID: 4, Engines: 1, Concurrency: 5}},
+		Files: []*ManifestFile{
+			{PlanID: 1, Filepath: "plan/1/test.jmx", SHA256: "dd"},
+			{PlanID: 4, Filepath: "plan/4/test.jmx", SHA256: "bb"},
+		},
+		EngineImages: map[int64]string{1: "jmeter@sha256:22"},
+		Variables:    map[string]string{"token": "t0k3n"},
+	}
+	assert.Equal(t, []string{
+		"collection variables changed",
+		"engine image of plan 1 changed from jmeter@sha256:11 to jmeter@sha256:22",
+		"execution plan 1 changed",
+		"file collection/3/users.csv was removed",
+		"file plan/1/test.jmx changed",
+		"file plan/2/test.jmx was removed",
+		"file plan/4/test.jmx was added",
+		"plan 2 was removed",
+		"plan 4 was added",
+		"trigger inputs changed",
+	}, base.Diff(changed))
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"regexp"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// RunMetadata links a run to the code it was testing, so performance changes between runs
+// can be traced back to code changes. All the fields are optional.
+type RunMetadata struct {
+	CommitSHA string `json:"commit_sha"`
+	Branch    string `json:"branch"`
+	BuildURL  string `json:"build_url"`
+	// Seed of the random values of the engines of the run, set by the controller when the run is triggered
+	Seed *int64 `json:"seed,omitempty"`
+}
+
+func (rm *RunMetadata) IsEmpty() bool {
+	return rm == nil || (rm.CommitSHA == "" && rm.Branch == "" && rm.BuildURL == "" && rm.Seed == nil)
+}
+
+func (rm *RunMetadata) Validate() error {
+	if rm == nil {
+		return nil
+	}
+	if rm.CommitSHA != "" && !commitSHAPattern.MatchString(rm.CommitSHA) {
+		return errors.New("commit sha should be 7 to 40 hex characters")
+	}
+	if len(rm.Branch) > 255 {
+		return errors.New("branch name is too long")
+	}
+	if rm.BuildURL != "" {
+		if len(rm.BuildURL) > 1024 {
+			return errors.New("build url is too long")
+		}
+		u, err := url.Parse(rm.BuildURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("build url should be a http(s) url")
+		}
+	}
+	return nil
+}
+
+func StoreRunMetadata(collectionID, runID int64, rm *RunMetadata) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_run_metadata (run_id, collection_id, commit_sha, branch, build_url,
+		seed) values (?,?,?,?,?,?) on duplicate key update commit_sha=?, branch=?, build_url=?, seed=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(runID, collectionID, rm.CommitSHA, rm.Branch, rm.BuildURL, rm.Seed, rm.CommitSHA, rm.Branch,
+		rm.BuildURL, rm.Seed)
+	return err
+}
+
+func GetRunMetadata(runID int64) (*RunMetadata, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select commit_sha, branch, build_url, seed from collection_run_metadata where run_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rm := new(RunMetadata)
+	var seed sql.NullInt64
+	if err := q.QueryRow(runID).Scan(&rm.CommitSHA, &rm.Branch, &rm.BuildURL, &seed); err != nil {
+		return nil, &DBError{Err: err, Message: "run metadata not found"}
+	}
+	if seed.Valid {
+		rm.Seed = &seed.Int64
+	}
+	return rm, nil
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunMetadataValidate(t *testing.T) {
+	var nilMetadata *RunMetadata
+	assert.NoError(t, nilMetadata.Validate())
+	assert.True(t, nilMetadata.IsEmpty())
+	assert.True(t, (&RunMetadata{}).IsEmpty())
+
+	rm := &RunMetadata{
+		CommitSHA: "9b3bb75",
+		Branch:    "feature/faster-checkout",
+		BuildURL:  "https://ci.example.com/builds/1234",
+	}
+	assert.NoError(t, rm.Validate())
+	assert.False(t, rm.IsEmpty())
+
+	assert.Error(t, (&RunMetadata{CommitSHA: "not-a-sha"}).Validate())
+	assert.Error(t, (&RunMetadata{CommitSHA: "abc"}).Validate())
+	assert.Error(t, (&RunMetadata{BuildURL: "ftp://ci.example.com/1"}).Validate())
+	assert.Error(t, (&RunMetadata{BuildURL: "builds/1234"}).Validate())
+}
+
+func TestRunMetadataSeed(t *testing.T) {
+	seed := int64(0)
+	assert.False(t, (&RunMetadata{Seed: &seed}).IsEmpty())
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+)
+
+// States of the runs, for the gates waiting for them
+const (
+	RunStateRunning  = "running"
+	RunStateFinished = "finished"
+	// The run ended before its plans ran to their end, or without any samples
+	RunStateAborted = "aborted"
+)
+
+// The times of the runs are stored to the second
+const runStateGrace = 5 * time.Second
+
+// abortingEvents are the events of the plans which did not run to their end
+var abortingEvents = map[string]bool{
+	RunEventPlanStopped:     true,
+	RunEventPlanStartFailed: true,
+	RunEventPlanRetryFailed: true,
+}
+
+// State tells whether the run is in progress, ran its plans to their end or was cut short. expected is how long the
+// run lasts when its plans run to their end, 0 when it cannot be told.
+func (r *RunHistory) State(expected time.Duration, hasSummary bool, events []*RunEvent) string {
+	if r.EndTime.IsZero() {
+		return RunStateRunning
+	}
+	if !hasSummary || r.EndTime.Sub(r.StartedTime) < expected-runStateGrace {
+		return RunStateAborted
+	}
+	for _, e := range events {
+		if abortingEvents[e.Kind] {
+			return RunStateAborted
+		}
+	}
+	return RunStateFinished
+}
+
+// ExpectedDuration is how long the run of the manifest lasts when its plans run to their end: its longest plan, or
+// the window of a continuous collection
+func (m *RunManifest) ExpectedDuration(continuous *ContinuousMode) time.Duration {
+	if continuous != nil {
+		return time.Duration(continuous.Window) * time.Minute
+	}
+	duration := 0
+	for _, ep := range m.Plans {
+		duration = max(duration, ep.Duration)
+	}
+	return time.Duration(duration) * time.Minute
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunHistoryState(t *testing.T) {
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	run := &RunHistory{StartedTime: start}
+	assert.Equal(t, RunStateRunning, run.State(30*time.Minute, false, nil))
+
+	run.EndTime = start.Add(31 * time.Minute)
+	assert.Equal(t, RunStateFinished, run.State(30*time.Minute, true, nil))
+	assert.Equal(t, RunStateFinished, run.State(0, true, []*RunEvent{{Kind: RunEventPlanStarted}}))
+	assert.Equal(t, RunStateAborted, run.State(30*time.Minute, false, nil))
+	assert.Equal(t, RunStateAborted, run.State(30*time.Minute, true, []*RunEvent{{Kind: RunEventPlanStopped}}))
+
+	// Stopped before the end of its longest plan
+	run.EndTime = start.Add(12 * time.Minute)
+	assert.Equal(t, RunStateAborted, run.State(30*time.Minute, true, nil))
+	assert.Equal(t, RunStateFinished, run.State(0, true, nil))
+}
+
+func TestRunManifestExpectedDuration(t *testing.T) {
+	m := &RunManifest{Plans: []*ExecutionPlan{{Duration: 10}, {Duration: 30}, {Duration: 5}}}
+	assert.Equal(t, 30*time.Minute, m.ExpectedDuration(nil))
+	assert.Equal(t, 15*time.Minute, m.ExpectedDuration(&ContinuousMode{Window: 15}))
+	assert.Zero(t, (&RunManifest{}).ExpectedDuration(nil))
+}
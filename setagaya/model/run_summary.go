@@ -0,0 +1,193 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	// Assertion messages often contain ids, so the number of distinct messages kept per label is capped.
+	// Failures beyond the cap are counted under AssertionOverflowMessage.
+	MaxAssertionMessages     = 20
+	maxAssertionMessage      = 256
+	AssertionOverflowMessage = "(other messages)"
+)
+
+// LabelAssertions counts the samples of a label passing and failing their assertions.
+// Samples failing for other reasons, e.g. connection errors, are counted as passed as no assertion failed.
+type LabelAssertions struct {
+	Samples uint64 `json:"samples"`
+	Passed  uint64 `json:"passed"`
+	Failed  uint64 `json:"failed"`
+	// Failed samples by assertion failure message
+	Failures map[string]uint64 `json:"failures,omitempty"`
+}
+
+func (la *LabelAssertions) AddFailures(message string, count uint64) {
+	if len(message) > maxAssertionMessage {
+		message = message[:maxAssertionMessage]
+	}
+	if la.Failures == nil {
+		la.Failures = map[string]uint64{}
+	}
+	if _, ok := la.Failures[message]; !ok && len(la.Failures) >= MaxAssertionMessages {
+		message = AssertionOverflowMessage
+	}
+	la.Failures[message] += count
+}
+
+func (la *LabelAssertions) Merge(other *LabelAssertions) {
+	la.Samples += other.Samples
+	la.Passed += other.Passed
+	la.Failed += other.Failed
+	for message, count := range other.Failures {
+		la.AddFailures(message, count)
+	}
+}
+
+// TransactionSummary holds the latency figures of a business transaction, i.e. a jmeter transaction controller
+type TransactionSummary struct {
+	Samples uint64  `json:"samples"`
+	Failed  uint64  `json:"failed"`
+	Mean    float64 `json:"mean"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	// Transactions per second. It's calculated from the run duration when the summary is read
+	Throughput float64 `json:"throughput"`
+}
+
+// RunSummary holds the collection level latency figures of a finished run.
+// The percentiles are calculated from the merged digests of all the engines, so they are the
+// true percentiles of the run instead of averages of per engine percentiles.
+type RunSummary struct {
+	RunID        int64   `json:"run_id"`
+	CollectionID int64   `json:"collection_id"`
+	Samples      uint64  `json:"samples"`
+	Min          float64 `json:"min"`
+	Max          float64 `json:"max"`
+	Mean         float64 `json:"mean"`
+	P50          float64 `json:"p50"`
+	P90          float64 `json:"p90"`
+	P95          float64 `json:"p95"`
+	P99          float64 `json:"p99"`
+	// Serialised merged digest. We keep it so the figures can be recalculated later
+	Histogram string `json:"-"`
+	// Source control information of the run, if it was supplied at trigger time
+	Metadata *RunMetadata `json:"metadata,omitempty"`
+	// Assertion results by label. Empty when the engines did not report any
+	Assertions map[string]*LabelAssertions `json:"assertions,omitempty"`
+	// Business transactions by label. They are not part of the figures above, which only cover the samplers
+	Transactions map[string]*TransactionSummary `json:"transactions,omitempty"`
+}
+
+// CalculateThroughput fills the throughput of the transactions from the duration of the run
+func (rs *RunSummary) CalculateThroughput(duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	for _, t := range rs.Transactions {
+		t.Throughput = float64(t.Samples) / duration.Seconds()
+	}
+}
+
+// jsonColumn serialises v for the optional json columns of the summary
+func jsonColumn(v interface{}, empty bool) (sql.NullString, error) {
+	if empty {
+		return sql.NullString{}, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(raw), Valid: true}, nil
+}
+
+type RunSummaryDiff struct {
+	Samples int64   `json:"samples"`
+	Mean    float64 `json:"mean"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+}
+
+type RunComparison struct {
+	Base   *RunSummary     `json:"base"`
+	Target *RunSummary     `json:"target"`
+	Diff   *RunSummaryDiff `json:"diff"`
+}
+
+// CompareRunSummaries calculates the difference of target against base. Positive numbers mean
+// the target run is slower(or has more samples) than the base run.
+func CompareRunSummaries(base, target *RunSummary) *RunComparison {
+	return &RunComparison{
+		Base:   base,
+		Target: target,
+		Diff: &RunSummaryDiff{
+			Samples: int64(target.Samples) - int64(base.Samples),
+			Mean:    target.Mean - base.Mean,
+			P50:     target.P50 - base.P50,
+			P90:     target.P90 - base.P90,
+			P95:     target.P95 - base.P95,
+			P99:     target.P99 - base.P99,
+		},
+	}
+}
+
+func StoreRunSummary(rs *RunSummary) error {
+	assertions, err := jsonColumn(rs.Assertions, len(rs.Assertions) == 0)
+	if err != nil {
+		return err
+	}
+	transactions, err := jsonColumn(rs.Transactions, len(rs.Transactions) == 0)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_run_summary
+		(run_id, collection_id, samples, min_latency, max_latency, mean_latency, p50, p90, p95, p99, histogram, assertions, transactions)
+		values (?,?,?,?,?,?,?,?,?,?,?,?,?)
+		on duplicate key update samples=?, min_latency=?, max_latency=?, mean_latency=?, p50=?, p90=?, p95=?, p99=?, histogram=?,
+		assertions=?, transactions=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(rs.RunID, rs.CollectionID, rs.Samples, rs.Min, rs.Max, rs.Mean, rs.P50, rs.P90, rs.P95, rs.P99, rs.Histogram,
+		assertions, transactions,
+		rs.Samples, rs.Min, rs.Max, rs.Mean, rs.P50, rs.P90, rs.P95, rs.P99, rs.Histogram, assertions, transactions)
+	return err
+}
+
+func GetRunSummary(runID int64) (*RunSummary, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select run_id, collection_id, samples, min_latency, max_latency, mean_latency, p50, p90, p95, p99, histogram,
+		assertions, transactions from collection_run_summary where run_id=?`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rs := new(RunSummary)
+	var assertions, transactions sql.NullString
+	err = q.QueryRow(runID).Scan(&rs.RunID, &rs.CollectionID, &rs.Samples, &rs.Min, &rs.Max, &rs.Mean,
+		&rs.P50, &rs.P90, &rs.P95, &rs.P99, &rs.Histogram, &assertions, &transactions)
+	if err != nil {
+		return nil, &DBError{Err: err, Message: "run summary not found"}
+	}
+	if assertions.Valid {
+		if err := json.Unmarshal([]byte(assertions.String), &rs.Assertions); err != nil {
+			return nil, err
+		}
+	}
+	if transactions.Valid {
+		if err := json.Unmarshal([]byte(transactions.String), &rs.Transactions); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareRunSummaries(t *testing.T) {
+	base := &RunSummary{RunID: 1, Samples: 1000, Mean: 100, P50: 90, P90: 150, P95: 200, P99: 400}
+	target := &RunSummary{RunID: 2, Samples: 900, Mean: 120, P50: 95, P90: 170, P95: 190, P99: 500}
+
+	c := CompareRunSummaries(base, target)
+	assert.Equal(t, base, c.Base)
+	assert.Equal(t, target, c.Target)
+	assert.Equal(t, int64(-100), c.Diff.Samples)
+	assert.Equal(t, float64(20), c.Diff.Mean)
+	assert.Equal(t, float64(5), c.Diff.P50)
+	assert.Equal(t, float64(20), c.Diff.P90)
+	assert.Equal(t, float64(-10), c.Diff.P95)
+	assert.Equal(t, float64(100), c.Diff.P99)
+}
+
+func TestLabelAssertionsMerge(t *testing.T) {
+	la := &LabelAssertions{Samples: 3, Passed: 2, Failed: 1, Failures: map[string]uint64{"Response code was 500": 1}}
+	la.Merge(&LabelAssertions{Samples: 2, Failed: 2, Failures: map[string]uint64{
+		"Response code was 500":          1,
+		"Test failed: text expected foo": 1,
+	}})
+	assert.Equal(t, uint64(5), la.Samples)
+	assert.Equal(t, uint64(2), la.Passed)
+	assert.Equal(t, uint64(3), la.Failed)
+	assert.Equal(t, uint64(2), la.Failures["Response code was 500"])
+	assert.Equal(t, uint64(1), la.Failures["Test failed: text expected foo"])
+}
+
+func TestLabelAssertionsAddFailuresOverflow(t *testing.T) {
+	la := new(LabelAssertions)
+	for i := 0; i < MaxAssertionMessages+5; i++ {
+		la.AddFailures(fmt.Sprintf("id %d not found", i), 1)
+	}
+	assert.Len(t, la.Failures, MaxAssertionMessages+1)
+	assert.Equal(t, uint64(5), la.Failures[AssertionOverflowMessage])
+}
+
+func TestRunSummaryCalculateThroughput(t *testing.T) {
+	rs := &RunSummary{Transactions: map[string]*TransactionSummary{
+		"checkout": {Samples: 600},
+	}}
+	rs.CalculateThroughput(time.Minute)
+	assert.Equal(t, float64(10), rs.Transactions["checkout"].Throughput)
+
+	rs.CalculateThroughput(0)
+	assert.Equal(t, float64(10), rs.Transactions["checkout"].Throughput)
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// ScrubSecrets removes the secrets the CI systems leave in the build urls and the branches, e.g. the tokens of
+// the urls, before the metadata is returned
+func (rm *RunMetadata) ScrubSecrets() {
+	if rm == nil {
+		return
+	}
+	rm.Branch = config.ScrubSecrets(rm.Branch)
+	rm.BuildURL = config.ScrubSecrets(rm.BuildURL)
+}
+
+// ScrubSecrets removes the secrets from the metadata of the run and from the messages of its events and retries,
+// which can quote the errors of the engines and of the system under test
+func (r *RunHistory) ScrubSecrets() {
+	r.Metadata.ScrubSecrets()
+	if r.Summary != nil {
+		r.Summary.Metadata.ScrubSecrets()
+	}
+	for _, e := range r.Events {
+		e.Message = config.ScrubSecrets(e.Message)
+	}
+	for _, pr := range r.Retries {
+		pr.Message = config.ScrubSecrets(pr.Message)
+	}
+}
+
+// ScrubSecrets removes the secrets from the messages of the errors, e.g. the signed urls of the failed requests
+func (re *RunErrors) ScrubSecrets() {
+	for _, errs := range re.Labels {
+		for _, e := range errs {
+			e.Message = config.ScrubSecrets(e.Message)
+		}
+	}
+}
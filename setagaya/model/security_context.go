@@ -0,0 +1,58 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// GetProjectSecurityContext returns the security context of the engines of the project. It's nil when the
+// project has none and the one of the config applies.
+func GetProjectSecurityContext(projectID int64) (*config.EngineSecurityContext, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select security_context from project_security_context where project_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	var raw []byte
+	if err := q.QueryRow(projectID).Scan(&raw); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	esc := new(config.EngineSecurityContext)
+	if err := json.Unmarshal(raw, esc); err != nil {
+		return nil, err
+	}
+	return esc, nil
+}
+
+func SetProjectSecurityContext(projectID int64, esc *config.EngineSecurityContext) error {
+	raw, err := json.Marshal(esc)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into project_security_context (project_id, security_context) values (?, ?)
+		on duplicate key update security_context=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(projectID, raw, raw)
+	return err
+}
+
+func DeleteProjectSecurityContext(projectID int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from project_security_context where project_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(projectID)
+	return err
+}
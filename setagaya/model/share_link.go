@@ -0,0 +1,215 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	DefaultShareLinkTTL = 24 * time.Hour
+	MaxShareLinkTTL     = 30 * 24 * time.Hour
+)
+
+var (
+	ErrShareLinksDisabled = errors.New("share links are not enabled, they need a share_link_key in the auth config")
+	ErrShareLinkExpired   = errors.New("the share link expired")
+	ErrShareLinkRevoked   = errors.New("the share link was revoked")
+)
+
+// RunShareLink gives read-only access to a run to the people without an account, e.g. the stakeholders of a test,
+// until it expires or it's revoked. Its token is signed, so the run and the expiry it tells cannot be changed.
+type RunShareLink struct {
+	ID           int64     `json:"id"`
+	RunID        int64     `json:"run_id"`
+	CollectionID int64     `json:"collection_id"`
+	CreatedBy    string    `json:"created_by"`
+	ExpiresTime  time.Time `json:"expires_time"`
+	CreatedTime  time.Time `json:"created_time"`
+	revoked      bool
+}
+
+func shareLinkKey() ([]byte, error) {
+	if config.SC.AuthConfig == nil || config.SC.AuthConfig.ShareLinkKey == "" {
+		return nil, ErrShareLinksDisabled
+	}
+	return []byte(config.SC.AuthConfig.ShareLinkKey), nil
+}
+
+// signShareLink returns the token of the link, its id and expiry followed by their signature
+func signShareLink(key []byte, id, runID int64, expires time.Time) string {
+	payload := fmt.Sprintf("%d.%d", id, expires.Unix())
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s.%d", payload, runID)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseShareLinkToken returns the id and the expiry the token tells, before its signature is checked
+func parseShareLinkToken(token string) (int64, time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, time.Time{}, &DBError{Err: sql.ErrNoRows, Message: "share link not found"}
+	}
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, &DBError{Err: err, Message: "share link not found"}
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, &DBError{Err: err, Message: "share link not found"}
+	}
+	return id, time.Unix(expires, 0), nil
+}
+
+// Token returns the token of the link, which is part of its URL
+func (l *RunShareLink) Token() (string, error) {
+	key, err := shareLinkKey()
+	if err != nil {
+		return "", err
+	}
+	return signShareLink(key, l.ID, l.RunID, l.ExpiresTime), nil
+}
+
+// check tells why the link cannot be used anymore, if it cannot
+func (l *RunShareLink) check(now time.Time) error {
+	if l.revoked {
+		return ErrShareLinkRevoked
+	}
+	if !now.Before(l.ExpiresTime) {
+		return ErrShareLinkExpired
+	}
+	return nil
+}
+
+const runShareLinkColumns = "id, run_id, collection_id, created_by, expires_time, revoked_time, created_time"
+
+func scanRunShareLink(row interface{ Scan(...any) error }) (*RunShareLink, error) {
+	l := new(RunShareLink)
+	var revokedTime sql.NullTime
+	if err := row.Scan(&l.ID, &l.RunID, &l.CollectionID, &l.CreatedBy, &l.ExpiresTime, &revokedTime,
+		&l.CreatedTime); err != nil {
+		return nil, err
+	}
+	l.revoked = revokedTime.Valid
+	return l, nil
+}
+
+func GetRunShareLink(id int64) (*RunShareLink, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + runShareLinkColumns + " from run_share_link where id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	l, err := scanRunShareLink(q.QueryRow(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &DBError{Err: err, Message: "share link not found"}
+	}
+	return l, err
+}
+
+// GetRunShareLinkByToken returns the link of the token when it can still be used. The signature and the expiry of
+// the token are checked before the link is looked up.
+func GetRunShareLinkByToken(token string, now time.Time) (*RunShareLink, error) {
+	key, err := shareLinkKey()
+	if err != nil {
+		return nil, err
+	}
+	id, expires, err := parseShareLinkToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(expires) {
+		return nil, ErrShareLinkExpired
+	}
+	l, err := GetRunShareLink(id)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(token), []byte(signShareLink(key, l.ID, l.RunID, l.ExpiresTime))) {
+		return nil, &DBError{Err: sql.ErrNoRows, Message: "share link not found"}
+	}
+	if err := l.check(now); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// GetRunShareLinks returns the links of the run that can still be used, the latest first
+func GetRunShareLinks(runID int64) ([]*RunShareLink, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + runShareLinkColumns +
+		" from run_share_link where run_id=? and revoked_time is null order by id desc")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	now := time.Now()
+	links := []*RunShareLink{}
+	for rows.Next() {
+		l, err := scanRunShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		if l.check(now) == nil {
+			links = append(links, l)
+		}
+	}
+	return links, rows.Err()
+}
+
+// CreateRunShareLink makes a link to the run, which expires after ttl
+func CreateRunShareLink(run *RunHistory, owner string, ttl time.Duration) (*RunShareLink, error) {
+	if _, err := shareLinkKey(); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 || ttl > MaxShareLinkTTL {
+		return nil, fmt.Errorf("a share link can last up to %s", MaxShareLinkTTL)
+	}
+	// The expiry is signed as seconds, like it's stored
+	now := time.Now().UTC()
+	l := &RunShareLink{RunID: run.ID, CollectionID: run.CollectionID, CreatedBy: owner,
+		ExpiresTime: now.Add(ttl).Truncate(time.Second), CreatedTime: now}
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into run_share_link (run_id, collection_id, created_by, expires_time) values (?,?,?,?)")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	r, err := q.Exec(l.RunID, l.CollectionID, l.CreatedBy, l.ExpiresTime)
+	if err != nil {
+		return nil, err
+	}
+	if l.ID, err = r.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Revoke stops the link from working, before it expires
+func (l *RunShareLink) Revoke() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("update run_share_link set revoked_time=NOW() where id=? and revoked_time is null")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err := q.Exec(l.ID); err != nil {
+		return err
+	}
+	l.revoked = true
+	return nil
+}
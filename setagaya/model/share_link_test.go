@@ -0,0 +1,60 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestSignShareLink(t *testing.T) {
+	key := []byte("share-link-key")
+	expires := time.Unix(1792137600, 0)
+	token := signShareLink(key, 12, 34, expires)
+	id, e, err := parseShareLinkToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), id)
+	assert.True(t, expires.Equal(e))
+
+	// The run, the expiry and the key are all signed
+	assert.Equal(t, token, signShareLink(key, 12, 34, expires))
+	assert.NotEqual(t, token, signShareLink(key, 12, 35, expires))
+	assert.NotEqual(t, token, signShareLink(key, 12, 34, expires.Add(time.Hour)))
+	assert.NotEqual(t, token, signShareLink([]byte("other-key"), 12, 34, expires))
+
+	for _, token := range []string{"", "12.1792137600", "a.1792137600.sig", "12.b.sig"} {
+		_, _, err := parseShareLinkToken(token)
+		assert.Error(t, err, token)
+		assert.ErrorAs(t, err, new(*DBError), token)
+	}
+}
+
+func TestShareLinkCheck(t *testing.T) {
+	now := time.Now()
+	l := &RunShareLink{ExpiresTime: now.Add(time.Hour)}
+	assert.NoError(t, l.check(now))
+	assert.ErrorIs(t, l.check(now.Add(time.Hour)), ErrShareLinkExpired)
+	l.revoked = true
+	assert.ErrorIs(t, l.check(now), ErrShareLinkRevoked)
+}
+
+func TestGetRunShareLinkByTokenWithoutTheDB(t *testing.T) {
+	key := config.SC.AuthConfig.ShareLinkKey
+	defer func() { config.SC.AuthConfig.ShareLinkKey = key }()
+
+	config.SC.AuthConfig.ShareLinkKey = ""
+	_, err := GetRunShareLinkByToken("1.1792137600.sig", time.Now())
+	assert.ErrorIs(t, err, ErrShareLinksDisabled)
+	_, err = (&RunShareLink{ID: 1}).Token()
+	assert.ErrorIs(t, err, ErrShareLinksDisabled)
+
+	// The expired tokens are turned down before the link is looked up
+	config.SC.AuthConfig.ShareLinkKey = "share-link-key"
+	expired := signShareLink([]byte("share-link-key"), 1, 2, time.Now().Add(-time.Minute))
+	_, err = GetRunShareLinkByToken(expired, time.Now())
+	assert.ErrorIs(t, err, ErrShareLinkExpired)
+	_, err = GetRunShareLinkByToken("not a token", time.Now())
+	assert.ErrorAs(t, err, new(*DBError))
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	SmokeDeploying = "deploying"
+	SmokeRunning   = "running"
+	SmokePassed    = "passed"
+	SmokeFailed    = "failed"
+)
+
+// SmokeTest is a quick validation of a plan with a single engine and a tiny workload.
+// It's not a run, so it does not appear in the run history of the collection.
+type SmokeTest struct {
+	CollectionID int64     `json:"collection_id"`
+	PlanID       int64     `json:"plan_id"`
+	Status       string    `json:"status"`
+	Message      string    `json:"message"`
+	Samples      uint64    `json:"samples"`
+	Failures     uint64    `json:"failures"`
+	P95          float64   `json:"p95"`
+	StartedTime  time.Time `json:"started_time"`
+	UpdatedTime  time.Time `json:"updated_time"`
+}
+
+func (st *SmokeTest) IsFinished() bool {
+	return st.Status == SmokePassed || st.Status == SmokeFailed
+}
+
+// StartSmokeTest replaces the previous smoke test of the plan
+func StartSmokeTest(collectionID, planID int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into plan_smoke_test (collection_id, plan_id, status) values (?,?,?)
+		on duplicate key update status=?, message='', samples=0, failures=0, p95=0, started_time=NOW()`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(collectionID, planID, SmokeDeploying, SmokeDeploying)
+	return err
+}
+
+func UpdateSmokeTest(st *SmokeTest) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`update plan_smoke_test set status=?, message=?, samples=?, failures=?, p95=?
+		where collection_id=? and plan_id=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(st.Status, st.Message, st.Samples, st.Failures, st.P95, st.CollectionID, st.PlanID)
+	return err
+}
+
+func GetSmokeTest(collectionID, planID int64) (*SmokeTest, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select collection_id, plan_id, status, message, samples, failures, p95, started_time, updated_time
+		from plan_smoke_test where collection_id=? and plan_id=?`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	st := new(SmokeTest)
+	err = q.QueryRow(collectionID, planID).Scan(&st.CollectionID, &st.PlanID, &st.Status, &st.Message, &st.Samples,
+		&st.Failures, &st.P95, &st.StartedTime, &st.UpdatedTime)
+	if err != nil {
+		return nil, &DBError{Err: err, Message: "smoke test not found"}
+	}
+	return st, nil
+}
@@ -0,0 +1,282 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	MinSoakDuration = 60
+	// The engines of a soak run run for that long, the controller ends the run at its end time before
+	MaxSoakDuration = 14 * 24 * 60
+
+	DefaultSoakCheckpointInterval = 30
+	MinSoakCheckpointInterval     = 5
+	// Growth of the memory of an engine, in MB per hour, from which it's reported as leaking
+	DefaultSoakMemoryLeakThreshold = 50
+)
+
+// SoakMode runs the collection for days. The aggregates of the run are saved at every checkpoint, along with the
+// results the engines read since the previous one, so a run that long does not depend on the engines lasting until
+// its end. Its end time can be pushed back while it runs.
+type SoakMode struct {
+	// Minutes the runs last
+	Duration int `yaml:"duration" json:"duration"`
+	// Minutes between the checkpoints, 30 by default
+	CheckpointInterval int `yaml:"checkpoint_interval" json:"checkpoint_interval"`
+	// MB per hour, 50 by default
+	MemoryLeakThreshold float64 `yaml:"memory_leak_threshold" json:"memory_leak_threshold"`
+}
+
+// Validate fills the defaults of the mode. A nil mode is a collection of regular runs
+func (sm *SoakMode) Validate() error {
+	if sm == nil {
+		return nil
+	}
+	if config.SC.ExecutorConfig.RunsOnce() {
+		return fmt.Errorf("the engines run once with the %s execution mode, the soak runs cannot be checkpointed",
+			config.ExecutionModeJob)
+	}
+	if sm.CheckpointInterval == 0 {
+		sm.CheckpointInterval = DefaultSoakCheckpointInterval
+	}
+	if sm.MemoryLeakThreshold == 0 {
+		sm.MemoryLeakThreshold = DefaultSoakMemoryLeakThreshold
+	}
+	if sm.Duration < MinSoakDuration || sm.Duration > MaxSoakDuration {
+		return fmt.Errorf("the soak duration should be between %d and %d minutes", MinSoakDuration, MaxSoakDuration)
+	}
+	if sm.CheckpointInterval < MinSoakCheckpointInterval || sm.CheckpointInterval > sm.Duration {
+		return fmt.Errorf("the soak checkpoint interval should be between %d minutes and the duration",
+			MinSoakCheckpointInterval)
+	}
+	if sm.MemoryLeakThreshold < 0 {
+		return errors.New("the memory leak threshold cannot be negative")
+	}
+	return nil
+}
+
+// ApplyTo sets the plans to run as long as a soak run can, the controller ends the run at its end time. The
+// ramp-down would only start at the end of that duration, so there is none.
+func (sm *SoakMode) ApplyTo(eps []*ExecutionPlan) {
+	for _, ep := range eps {
+		ep.Duration = MaxSoakDuration
+		ep.Rampdown = 0
+	}
+}
+
+func (c *Collection) updateCollectionSoak(sm *SoakMode) error {
+	soak, err := jsonColumn(sm, sm == nil)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("update collection set soak=? where id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(soak, c.ID)
+	return err
+}
+
+func parseSoakMode(soak sql.NullString) (*SoakMode, error) {
+	if !soak.Valid {
+		return nil, nil
+	}
+	sm := new(SoakMode)
+	if err := json.Unmarshal([]byte(soak.String), sm); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+// RunSoak is the state of a soak run
+type RunSoak struct {
+	RunID        int64     `json:"run_id"`
+	CollectionID int64     `json:"collection_id"`
+	StartedTime  time.Time `json:"started_time"`
+	EndTime      time.Time `json:"end_time"`
+}
+
+// Extend pushes the end of the run back, up to the longest a soak run can last
+func (rs *RunSoak) Extend(d time.Duration) error {
+	if d <= 0 {
+		return errors.New("a soak run can only be extended")
+	}
+	end := rs.EndTime.Add(d)
+	if end.Sub(rs.StartedTime) > MaxSoakDuration*time.Minute {
+		return fmt.Errorf("a soak run cannot last more than %d minutes", MaxSoakDuration)
+	}
+	rs.EndTime = end
+	return nil
+}
+
+func StartRunSoak(collectionID, runID int64, started time.Time, sm *SoakMode) (*RunSoak, error) {
+	rs := &RunSoak{
+		RunID:        runID,
+		CollectionID: collectionID,
+		StartedTime:  started,
+		EndTime:      started.Add(time.Duration(sm.Duration) * time.Minute),
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into collection_run_soak (run_id, collection_id, started_time, end_time) values (?,?,?,?)")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	if _, err := q.Exec(rs.RunID, rs.CollectionID, rs.StartedTime, rs.EndTime); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+func GetRunSoak(runID int64) (*RunSoak, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select run_id, collection_id, started_time, end_time from collection_run_soak where run_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rs := new(RunSoak)
+	if err := q.QueryRow(runID).Scan(&rs.RunID, &rs.CollectionID, &rs.StartedTime, &rs.EndTime); err != nil {
+		return nil, &DBError{Err: err, Message: "the run is not a soak run"}
+	}
+	return rs, nil
+}
+
+func (rs *RunSoak) UpdateEndTime() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("update collection_run_soak set end_time=? where run_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(rs.EndTime, rs.RunID)
+	return err
+}
+
+// RunCheckpoint holds the aggregates of a soak run at a point of it
+type RunCheckpoint struct {
+	Time    time.Time   `json:"time"`
+	Summary *RunSummary `json:"summary"`
+}
+
+func StoreRunCheckpoint(rc *RunCheckpoint) error {
+	summary, err := json.Marshal(rc.Summary)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_run_checkpoint (run_id, collection_id, checkpoint_time, summary,
+		histogram) values (?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(rc.Summary.RunID, rc.Summary.CollectionID, rc.Time, string(summary), rc.Summary.Histogram)
+	return err
+}
+
+func GetRunCheckpoints(runID int64) ([]*RunCheckpoint, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select checkpoint_time, summary, histogram from collection_run_checkpoint where run_id=?
+		order by checkpoint_time, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	checkpoints := []*RunCheckpoint{}
+	for rows.Next() {
+		rc := &RunCheckpoint{Summary: new(RunSummary)}
+		var summary string
+		if err := rows.Scan(&rc.Time, &summary, &rc.Summary.Histogram); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(summary), rc.Summary); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, rc)
+	}
+	return checkpoints, rows.Err()
+}
+
+// ResultSegment is a part of the results of an engine, uploaded at a checkpoint of a soak run
+type ResultSegment struct {
+	PlanID   int64  `json:"plan_id"`
+	EngineID int    `json:"engine_id"`
+	Filename string `json:"filename"`
+	Samples  int    `json:"samples"`
+	// Team of the plan, set by the controller
+	Team string `json:"team,omitempty"`
+}
+
+func MakeResultSegmentFilename(runID, planID int64, engineID, seq int) string {
+	return fmt.Sprintf("run/%d/results-%d-%d-%05d.jtl.gz", runID, planID, engineID, seq)
+}
+
+func StoreResultSegment(collectionID, runID int64, rs *ResultSegment) error {
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_run_result_segment (run_id, collection_id, plan_id, engine_id, filename,
+		samples, team) values (?,?,?,?,?,?,?)`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(runID, collectionID, rs.PlanID, rs.EngineID, rs.Filename, rs.Samples, rs.Team)
+	return err
+}
+
+func GetResultSegments(runID int64) ([]*ResultSegment, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select plan_id, engine_id, filename, samples, team from collection_run_result_segment
+		where run_id=? order by id`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	segments := []*ResultSegment{}
+	for rows.Next() {
+		rs := new(ResultSegment)
+		if err := rows.Scan(&rs.PlanID, &rs.EngineID, &rs.Filename, &rs.Samples, &rs.Team); err != nil {
+			return nil, err
+		}
+		segments = append(segments, rs)
+	}
+	return segments, rows.Err()
+}
+
+func (c *Collection) deleteSoakRuns() error {
+	db := config.SC.DBC
+	for _, query := range []string{
+		"delete from collection_run_soak where collection_id=?",
+		"delete from collection_run_checkpoint where collection_id=?",
+		"delete from collection_run_result_segment where collection_id=?",
+	} {
+		q, err := db.Prepare(query)
+		if err != nil {
+			return err
+		}
+		_, err = q.Exec(c.ID)
+		q.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestSoakModeValidate(t *testing.T) {
+	var none *SoakMode
+	assert.NoError(t, none.Validate())
+
+	sm := &SoakMode{Duration: 24 * 60}
+	assert.NoError(t, sm.Validate())
+	assert.Equal(t, DefaultSoakCheckpointInterval, sm.CheckpointInterval)
+	assert.Equal(t, float64(DefaultSoakMemoryLeakThreshold), sm.MemoryLeakThreshold)
+
+	assert.Error(t, (&SoakMode{Duration: 10}).Validate())
+	assert.Error(t, (&SoakMode{Duration: MaxSoakDuration + 1}).Validate())
+	assert.Error(t, (&SoakMode{Duration: 120, CheckpointInterval: 1}).Validate())
+	assert.Error(t, (&SoakMode{Duration: 120, CheckpointInterval: 180}).Validate())
+	assert.Error(t, (&SoakMode{Duration: 120, MemoryLeakThreshold: -1}).Validate())
+
+	ec := config.SC.ExecutorConfig
+	defer func() { config.SC.ExecutorConfig = ec }()
+	config.SC.ExecutorConfig = &config.ExecutorConfig{ExecutionMode: config.ExecutionModeJob}
+	assert.Error(t, (&SoakMode{Duration: 120}).Validate())
+}
+
+func TestSoakModeApplyTo(t *testing.T) {
+	eps := []*ExecutionPlan{{Duration: 5, Rampdown: 60}, {Duration: 10}}
+	(&SoakMode{Duration: 120}).ApplyTo(eps)
+	assert.Equal(t, MaxSoakDuration, eps[0].Duration)
+	assert.Zero(t, eps[0].Rampdown)
+	assert.Equal(t, MaxSoakDuration, eps[1].Duration)
+}
+
+func TestRunSoakExtend(t *testing.T) {
+	started := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	rs := &RunSoak{StartedTime: started, EndTime: started.Add(24 * time.Hour)}
+	assert.NoError(t, rs.Extend(12*time.Hour))
+	assert.Equal(t, started.Add(36*time.Hour), rs.EndTime)
+
+	assert.Error(t, rs.Extend(0))
+	assert.Error(t, rs.Extend(MaxSoakDuration*time.Minute))
+	assert.Equal(t, started.Add(36*time.Hour), rs.EndTime)
+}
+
+func TestParseSoakMode(t *testing.T) {
+	raw, err := jsonColumn(&SoakMode{Duration: 600, CheckpointInterval: 15, MemoryLeakThreshold: 20}, false)
+	assert.NoError(t, err)
+	sm, err := parseSoakMode(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, &SoakMode{Duration: 600, CheckpointInterval: 15, MemoryLeakThreshold: 20}, sm)
+
+	raw, err = jsonColumn((*SoakMode)(nil), true)
+	assert.NoError(t, err)
+	sm, err = parseSoakMode(raw)
+	assert.NoError(t, err)
+	assert.Nil(t, sm)
+}
+
+func TestMakeResultSegmentFilename(t *testing.T) {
+	assert.Equal(t, "run/7/results-3-1-00012.jtl.gz", MakeResultSegmentFilename(7, 3, 1, 12))
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// The tokens are 32 random bytes, they cannot be guessed
+const statusPageTokenSize = 32
+
+// RunStatusPage is the public status page of a run. Whoever has its token sees the headline figures of the run
+// without signing in, e.g. on the dashboards of a war room during a game day. A run has one page at most.
+type RunStatusPage struct {
+	Token        string    `json:"token"`
+	RunID        int64     `json:"run_id"`
+	CollectionID int64     `json:"collection_id"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedTime  time.Time `json:"created_time"`
+}
+
+func makeStatusPageToken() (string, error) {
+	b := make([]byte, statusPageTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// isStatusPageToken tells whether the token could be one of a page, so the others are turned down without a query
+func isStatusPageToken(token string) bool {
+	if len(token) != base64.RawURLEncoding.EncodedLen(statusPageTokenSize) {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil
+}
+
+const runStatusPageColumns = "token, run_id, collection_id, created_by, created_time"
+
+func getRunStatusPage(where string, arg interface{}) (*RunStatusPage, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + runStatusPageColumns + " from run_status_page where " + where + "=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	sp := new(RunStatusPage)
+	err = q.QueryRow(arg).Scan(&sp.Token, &sp.RunID, &sp.CollectionID, &sp.CreatedBy, &sp.CreatedTime)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &DBError{Err: err, Message: "status page not found"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// GetRunStatusPage returns the page of the token
+func GetRunStatusPage(token string) (*RunStatusPage, error) {
+	if !isStatusPageToken(token) {
+		return nil, &DBError{Err: sql.ErrNoRows, Message: "status page not found"}
+	}
+	return getRunStatusPage("token", token)
+}
+
+// GetRunStatusPageByRun returns the page of the run, if it has one
+func GetRunStatusPageByRun(runID int64) (*RunStatusPage, error) {
+	return getRunStatusPage("run_id", runID)
+}
+
+// CreateRunStatusPage makes the page of the run. The run keeps its page when it has one already, so the link
+// shared with the war room stays the same.
+func CreateRunStatusPage(run *RunHistory, owner string) (*RunStatusPage, error) {
+	if sp, err := GetRunStatusPageByRun(run.ID); err == nil {
+		return sp, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	token, err := makeStatusPageToken()
+	if err != nil {
+		return nil, err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("insert into run_status_page (token, run_id, collection_id, created_by) values (?,?,?,?)")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	if _, err := q.Exec(token, run.ID, run.CollectionID, owner); err != nil {
+		return nil, err
+	}
+	return &RunStatusPage{Token: token, RunID: run.ID, CollectionID: run.CollectionID, CreatedBy: owner,
+		CreatedTime: time.Now()}, nil
+}
+
+// DeleteRunStatusPage revokes the page of the run. Its link stops working at once.
+func DeleteRunStatusPage(runID int64) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from run_status_page where run_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(runID)
+	return err
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusPageToken(t *testing.T) {
+	token, err := makeStatusPageToken()
+	assert.NoError(t, err)
+	assert.True(t, isStatusPageToken(token))
+	other, err := makeStatusPageToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	assert.False(t, isStatusPageToken(""))
+	assert.False(t, isStatusPageToken(token[1:]))
+	assert.False(t, isStatusPageToken("!"+token[1:]))
+	assert.False(t, isStatusPageToken("../../"+token[6:]))
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// StoragePrefixes are the folders of the object storage the files of the plans, collections, projects and runs are
+// kept in. Every file under them is referenced by a row of the database.
+var StoragePrefixes = []string{"plan/", "collection/", "project/", "run/"}
+
+// The files of all the tenants in the object storage, with how their name is made
+var storageFileQueries = []struct {
+	query    string
+	filename func(id int64, filename string) string
+}{
+	{
+		query:    "select plan_id, filename from plan_data",
+		filename: func(id int64, filename string) string { return (&Plan{ID: id}).MakeFileName(filename) },
+	},
+	{
+		query:    "select plan_id, filename from plan_test_file",
+		filename: func(id int64, filename string) string { return (&Plan{ID: id}).MakeFileName(filename) },
+	},
+	{
+		query:    "select collection_id, filename from collection_data",
+		filename: func(id int64, filename string) string { return (&Collection{ID: id}).MakeFileName(filename) },
+	},
+	{
+		query:    "select project_id, filename from project_file",
+		filename: func(id int64, filename string) string { return (&Project{ID: id}).MakeFileName(filename) },
+	},
+	{
+		query:    "select run_id, filename from collection_run_failure_capture",
+		filename: func(_ int64, filename string) string { return filename },
+	},
+	{
+		query:    "select run_id, filename from collection_run_result_segment",
+		filename: func(_ int64, filename string) string { return filename },
+	},
+}
+
+// GetStorageReferences returns the files of the object storage referenced by the database, whoever owns them
+func GetStorageReferences() (map[string]bool, error) {
+	db := config.SC.DBC
+	references := map[string]bool{}
+	for _, sf := range storageFileQueries {
+		q, err := db.Prepare(sf.query)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := q.Query()
+		if err != nil {
+			q.Close()
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var filename string
+			if err := rows.Scan(&id, &filename); err != nil {
+				rows.Close()
+				q.Close()
+				return nil, err
+			}
+			references[sf.filename(id, filename)] = true
+		}
+		err = rows.Err()
+		rows.Close()
+		q.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return references, nil
+}
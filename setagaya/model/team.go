@@ -0,0 +1,54 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// ValidateTeam checks the team can label the metrics and the resources of the plan. Empty means the plan belongs to
+// the owner of its project.
+func ValidateTeam(team string) error {
+	if team == "" {
+		return nil
+	}
+	if errs := validation.IsValidLabelValue(team); len(errs) > 0 {
+		return errors.New("team is invalid: " + strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// GetPlanTeam returns the team of the plan without loading its files
+func GetPlanTeam(planID int64) (string, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select team from plan where id=?")
+	if err != nil {
+		return "", err
+	}
+	defer q.Close()
+	team := ""
+	if err := q.QueryRow(planID).Scan(&team); err != nil {
+		return "", &DBError{Err: err, Message: "plan not found"}
+	}
+	return team, nil
+}
+
+func (p *Plan) SetTeam(team string) error {
+	if err := ValidateTeam(team); err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("update plan set team=? where id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err := q.Exec(team, p.ID); err != nil {
+		return err
+	}
+	p.Team = team
+	return nil
+}
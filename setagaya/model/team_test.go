@@ -0,0 +1,18 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTeam(t *testing.T) {
+	assert.NoError(t, ValidateTeam(""))
+	assert.NoError(t, ValidateTeam("checkout"))
+	assert.NoError(t, ValidateTeam("payments.eu_1"))
+	assert.NoError(t, ValidateTeam(strings.Repeat("a", 63)))
+	assert.Error(t, ValidateTeam(strings.Repeat("a", 64)))
+	assert.Error(t, ValidateTeam("checkout team"))
+	assert.Error(t, ValidateTeam("-checkout"))
+}
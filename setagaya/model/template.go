@@ -0,0 +1,87 @@
+package model
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+// ErrInvalidTemplate is returned when a jmx uses template variables its plan does not declare
+var ErrInvalidTemplate = errors.New("the jmx uses undeclared template variables")
+
+// templateVariablePattern is a {{name}} of a jmx, the names are the ones of the parameters. The braces around other
+// text, like the ones of a json body, are not variables and are kept as they are.
+var templateVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.]{0,99})\s*\}\}`)
+
+// TemplateVariables lists the variables a jmx uses, once each and in the order they appear
+func TemplateVariables(content []byte) []string {
+	variables := []string{}
+	seen := map[string]bool{}
+	for _, m := range templateVariablePattern.FindAllSubmatch(content, -1) {
+		name := string(m[1])
+		if !seen[name] {
+			seen[name] = true
+			variables = append(variables, name)
+		}
+	}
+	return variables
+}
+
+// ValidateTemplate checks the variables of a jmx are parameters of its plan, so they always have a value when the
+// engines render it
+func ValidateTemplate(content []byte, declared []*PlanParameter) error {
+	names := map[string]bool{}
+	for _, pp := range declared {
+		names[pp.Name] = true
+	}
+	undeclared := []string{}
+	for _, name := range TemplateVariables(content) {
+		if !names[name] {
+			undeclared = append(undeclared, name)
+		}
+	}
+	if len(undeclared) > 0 {
+		return fmt.Errorf("%w: %s, they should be declared as parameters of the plan", ErrInvalidTemplate,
+			strings.Join(undeclared, ", "))
+	}
+	return nil
+}
+
+// RenderTemplate replaces the variables of a jmx with their values. The values are escaped, they cannot change the
+// structure of the jmx whatever they are.
+func RenderTemplate(content []byte, values map[string]string) ([]byte, error) {
+	missing := []string{}
+	for _, name := range TemplateVariables(content) {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the template variables %s have no value", strings.Join(missing, ", "))
+	}
+	return templateVariablePattern.ReplaceAllFunc(content, func(m []byte) []byte {
+		name := string(templateVariablePattern.FindSubmatch(m)[1])
+		var escaped bytes.Buffer
+		// Writing to a buffer does not fail
+		_ = xml.EscapeText(&escaped, []byte(values[name]))
+		return escaped.Bytes()
+	}), nil
+}
+
+// ValidateTestFileTemplate checks the test file of the plan only uses the parameters, so they cannot be changed
+// from under its template variables
+func (p *Plan) ValidateTestFileTemplate(parameters []*PlanParameter) error {
+	if p.TestFile == nil || !strings.HasSuffix(p.TestFile.Filename, ".jmx") {
+		return nil
+	}
+	content, err := object_storage.Client.Storage.Download(p.TestFile.Filepath)
+	if err != nil {
+		return err
+	}
+	return ValidateTemplate(content, parameters)
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const templatedJMX = `<HTTPSamplerProxy testname="Login">
+  <stringProp name="HTTPSampler.domain">{{target.host}}</stringProp>
+  <stringProp name="HTTPSampler.port">{{ port }}</stringProp>
+  <stringProp name="HTTPSampler.path">/login?tenant={{target.host}}</stringProp>
+  <stringProp name="Argument.value">{"user": {{}}, "ids": {{ [1, 2] }}}</stringProp>
+</HTTPSamplerProxy>`
+
+func TestTemplateVariables(t *testing.T) {
+	assert.Equal(t, []string{"target.host", "port"}, TemplateVariables([]byte(templatedJMX)))
+	assert.Empty(t, TemplateVariables([]byte(`<stringProp name="x">${__P(target.host)}</stringProp>`)))
+}
+
+func TestValidateTemplate(t *testing.T) {
+	defaultPort := "443"
+	declared := []*PlanParameter{
+		{Name: "target.host", Type: ParameterString},
+		{Name: "port", Type: ParameterInt, Default: &defaultPort},
+	}
+	assert.NoError(t, ValidateTemplate([]byte(templatedJMX), declared))
+
+	err := ValidateTemplate([]byte(templatedJMX), declared[:1])
+	assert.ErrorIs(t, err, ErrInvalidTemplate)
+	assert.Contains(t, err.Error(), "port")
+}
+
+func TestRenderTemplate(t *testing.T) {
+	rendered, err := RenderTemplate([]byte(templatedJMX), map[string]string{
+		"target.host": "shop.example.com",
+		"port":        "8443",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `<HTTPSamplerProxy testname="Login">
+  <stringProp name="HTTPSampler.domain">shop.example.com</stringProp>
+  <stringProp name="HTTPSampler.port">8443</stringProp>
+  <stringProp name="HTTPSampler.path">/login?tenant=shop.example.com</stringProp>
+  <stringProp name="Argument.value">{"user": {{}}, "ids": {{ [1, 2] }}}</stringProp>
+</HTTPSamplerProxy>`, string(rendered))
+
+	// The values cannot add elements to the jmx
+	rendered, err = RenderTemplate([]byte(`<stringProp name="x">{{host}}</stringProp>`),
+		map[string]string{"host": `a</stringProp><evil attr="1">&`})
+	assert.NoError(t, err)
+	assert.Equal(t, `<stringProp name="x">a&lt;/stringProp&gt;&lt;evil attr=&#34;1&#34;&gt;&amp;</stringProp>`,
+		string(rendered))
+
+	_, err = RenderTemplate([]byte(templatedJMX), map[string]string{"port": "8443"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "target.host")
+}
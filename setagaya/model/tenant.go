@@ -0,0 +1,233 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// Roles every tenant is created with
+const (
+	// Manages the tenant, its quota and who has a role in it
+	TenantRoleAdmin = "admin"
+	// Creates and runs the collections of the tenant
+	TenantRoleMember = "member"
+	// Only sees the collections and their results
+	TenantRoleViewer = "viewer"
+)
+
+var DefaultTenantRoles = []string{TenantRoleAdmin, TenantRoleMember, TenantRoleViewer}
+
+const (
+	maxTenantNameLength = 30
+	maxNamespaceLength  = 63
+)
+
+var (
+	// The name is used in the namespace of the tenant, so it must be a valid DNS label
+	tenantNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	ErrTenantExists   = errors.New("tenant already exists")
+)
+
+// TenantQuota limits what a tenant can use at a time. 0 is unlimited
+type TenantQuota struct {
+	MaxEngines            int `json:"max_engines"`
+	MaxRunningCollections int `json:"max_running_collections"`
+}
+
+type Tenant struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Owner string `json:"owner" classification:"personal"`
+	// Where the scheduler deploys the engines of the tenant
+	Namespace string `json:"namespace"`
+	// Where the files of the tenant are kept in the object storage
+	StoragePrefix string `json:"storage_prefix"`
+	// Region of the bucket the files of the tenant are kept in, the default bucket when it's empty
+	StorageRegion string       `json:"storage_region"`
+	Quota         *TenantQuota `json:"quota"`
+	CreatedTime   time.Time    `json:"created_time"`
+}
+
+func ValidateTenantName(name string) error {
+	if len(name) > maxTenantNameLength {
+		return fmt.Errorf("tenant name cannot be longer than %d characters", maxTenantNameLength)
+	}
+	if !tenantNamePattern.MatchString(name) {
+		return errors.New("tenant name can only have lowercase letters, digits and dashes, and cannot start or end with a dash")
+	}
+	return nil
+}
+
+func (q *TenantQuota) Validate() error {
+	if q.MaxEngines < 0 || q.MaxRunningCollections < 0 {
+		return errors.New("quota cannot be negative")
+	}
+	return nil
+}
+
+// MakeTenantNamespace names the namespace of the tenant after the namespace of the executors
+func MakeTenantNamespace(name string) (string, error) {
+	namespace := fmt.Sprintf("%s-%s", config.SC.ExecutorConfig.Namespace, name)
+	if len(namespace) > maxNamespaceLength {
+		return "", fmt.Errorf("namespace %s is longer than %d characters", namespace, maxNamespaceLength)
+	}
+	return namespace, nil
+}
+
+func makeTenantStoragePrefix(name string) string {
+	return fmt.Sprintf("tenants/%s/", name)
+}
+
+// CreateTenant creates the tenant with the default roles and assigns the admin role to the given subject
+func CreateTenant(name, owner, namespace, admin, storageRegion string, quota *TenantQuota) (*Tenant, error) {
+	db := config.SC.DBC
+	tx, err := db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+	}()
+	r, err := tx.Exec(`insert into tenant (name, owner, namespace, storage_prefix, storage_region, max_engines,
+		max_running_collections) values (?, ?, ?, ?, ?, ?, ?)`, name, owner, namespace, makeTenantStoragePrefix(name),
+		storageRegion, quota.MaxEngines, quota.MaxRunningCollections)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return nil, ErrTenantExists
+		}
+		return nil, err
+	}
+	tenantID, err := r.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range DefaultTenantRoles {
+		if _, err := tx.Exec("insert into tenant_role (tenant_id, name) values (?, ?)", tenantID, role); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec("insert into tenant_role_assignment (tenant_id, role, subject) values (?, ?, ?)",
+		tenantID, TenantRoleAdmin, admin); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetTenant(tenantID)
+}
+
+func GetTenant(tenantID int64) (*Tenant, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select id, name, owner, namespace, storage_prefix, storage_region, max_engines,
+		max_running_collections, created_time from tenant where id=?`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	t := &Tenant{Quota: new(TenantQuota)}
+	err = q.QueryRow(tenantID).Scan(&t.ID, &t.Name, &t.Owner, &t.Namespace, &t.StoragePrefix, &t.StorageRegion,
+		&t.Quota.MaxEngines, &t.Quota.MaxRunningCollections, &t.CreatedTime)
+	if err != nil {
+		return nil, &DBError{Err: err, Message: "tenant not found"}
+	}
+	return t, nil
+}
+
+// GetTenantNamespaceByProject returns the namespace of the tenant owning the project. It's empty when the
+// project belongs to no tenant
+func GetTenantNamespaceByProject(projectID int64) (string, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select t.namespace from tenant t join project p on p.owner=t.owner where p.id=?
+		order by t.id limit 1`)
+	if err != nil {
+		return "", err
+	}
+	defer q.Close()
+	var namespace string
+	if err := q.QueryRow(projectID).Scan(&namespace); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return namespace, nil
+}
+
+// GetRoleAssignments returns the subjects having every role in the tenant
+func (t *Tenant) GetRoleAssignments() (map[string][]string, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare(`select r.name, a.subject from tenant_role r left join tenant_role_assignment a
+		on a.tenant_id=r.tenant_id and a.role=r.name where r.tenant_id=? order by r.name, a.subject`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	rows, err := q.Query(t.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	assignments := make(map[string][]string)
+	for rows.Next() {
+		var role string
+		var subject sql.NullString
+		if err := rows.Scan(&role, &subject); err != nil {
+			return nil, err
+		}
+		if _, ok := assignments[role]; !ok {
+			assignments[role] = []string{}
+		}
+		if subject.Valid {
+			assignments[role] = append(assignments[role], subject.String)
+		}
+	}
+	return assignments, rows.Err()
+}
+
+// CanChange tells whether the account has a role of the tenant letting it change the resources of the tenant. The
+// subjects of the roles are users or mailing lists
+func CanChange(assignments map[string][]string, account *Account) bool {
+	for _, role := range []string{TenantRoleAdmin, TenantRoleMember} {
+		for _, subject := range assignments[role] {
+			if subject == account.Name {
+				return true
+			}
+			if _, ok := account.MLMap[subject]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *Tenant) Delete() error {
+	db := config.SC.DBC
+	tx, err := db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+	}()
+	for _, table := range []string{"tenant_role_assignment", "tenant_role", "tenant_branding", "tenant_feature_flag"} {
+		if _, err := tx.Exec(fmt.Sprintf("delete from %s where tenant_id=?", table), t.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("delete from tenant where id=?", t.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	maxBrandingTextLength = 100
+	maxSupportLinks       = 10
+	defaultDisplayName    = "Setagaya"
+)
+
+var ErrBrandingHostTaken = errors.New("the host already shows the branding of another tenant")
+
+// TenantBranding is how the UI presents itself to the users of a tenant, as a managed deployment hosts several
+// brands. The UI reads it before the users log in, so it's public.
+type TenantBranding struct {
+	DisplayName string `json:"display_name"`
+	// Absolute url of the logo, or a path of the UI like /static/logo.svg
+	LogoURL string `json:"logo_url"`
+	// Host the UI of the tenant is served at, e.g. loadtest.brand.example. The UI served at it is shown with the
+	// branding of the tenant
+	Host         string         `json:"host,omitempty"`
+	SupportLinks []*SupportLink `json:"support_links"`
+}
+
+// SupportLink is where the users of a tenant get help, e.g. the chat channel or the documentation of their brand
+type SupportLink struct {
+	Title string `json:"title"`
+	// An http(s) or a mailto url
+	URL string `json:"url"`
+}
+
+// DefaultBranding is the branding of the UI served at the host of no tenant
+func DefaultBranding() *TenantBranding {
+	return &TenantBranding{DisplayName: defaultDisplayName, SupportLinks: []*SupportLink{}}
+}
+
+// validateBrandingURL only accepts the schemes the UI can link to, so a javascript url cannot be shown to the users
+func validateBrandingURL(raw string, schemes ...string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	for _, s := range schemes {
+		if u.Scheme == s && (u.Host != "" || u.Opaque != "") {
+			return nil
+		}
+	}
+	return fmt.Errorf("should be a %s url", strings.Join(schemes, " or "))
+}
+
+// Validate checks the branding and lowercases its host
+func (tb *TenantBranding) Validate() error {
+	if tb.DisplayName == "" || len(tb.DisplayName) > maxBrandingTextLength {
+		return fmt.Errorf("display name is required and cannot be longer than %d characters", maxBrandingTextLength)
+	}
+	// A path of the UI, or a url of another host. //host/logo.svg would be another host without a scheme
+	isPath := strings.HasPrefix(tb.LogoURL, "/") && !strings.HasPrefix(tb.LogoURL, "//")
+	if tb.LogoURL != "" && !isPath {
+		if err := validateBrandingURL(tb.LogoURL, "https", "http"); err != nil {
+			return fmt.Errorf("logo url %s", err)
+		}
+	}
+	tb.Host = strings.ToLower(tb.Host)
+	if tb.Host != "" {
+		if errs := validation.IsDNS1123Subdomain(tb.Host); len(errs) > 0 {
+			return fmt.Errorf("host %s is invalid: %s", tb.Host, strings.Join(errs, ", "))
+		}
+	}
+	if len(tb.SupportLinks) > maxSupportLinks {
+		return fmt.Errorf("a tenant can have up to %d support links", maxSupportLinks)
+	}
+	for _, l := range tb.SupportLinks {
+		if l == nil || l.Title == "" || len(l.Title) > maxBrandingTextLength {
+			return fmt.Errorf("support links need a title of up to %d characters", maxBrandingTextLength)
+		}
+		if err := validateBrandingURL(l.URL, "https", "http", "mailto"); err != nil {
+			return fmt.Errorf("support link %s %s", l.Title, err)
+		}
+	}
+	if tb.SupportLinks == nil {
+		tb.SupportLinks = []*SupportLink{}
+	}
+	return nil
+}
+
+func scanBranding(row *sql.Row) (*TenantBranding, error) {
+	var raw []byte
+	if err := row.Scan(&raw); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	tb := new(TenantBranding)
+	if err := json.Unmarshal(raw, tb); err != nil {
+		return nil, err
+	}
+	return tb, nil
+}
+
+// GetBranding returns the branding of the tenant. It's nil when the tenant has none
+func (t *Tenant) GetBranding() (*TenantBranding, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select branding from tenant_branding where tenant_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	return scanBranding(q.QueryRow(t.ID))
+}
+
+func (t *Tenant) SetBranding(tb *TenantBranding) error {
+	raw, err := json.Marshal(tb)
+	if err != nil {
+		return err
+	}
+	// The hosts are unique, but many tenants have none
+	host := sql.NullString{String: tb.Host, Valid: tb.Host != ""}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into tenant_branding (tenant_id, host, branding) values (?, ?, ?)
+		on duplicate key update host=?, branding=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err = q.Exec(t.ID, host, raw, host, raw); err != nil {
+		if isDuplicateEntry(err) {
+			return ErrBrandingHostTaken
+		}
+		return err
+	}
+	return nil
+}
+
+func (t *Tenant) DeleteBranding() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from tenant_branding where tenant_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(t.ID)
+	return err
+}
+
+// FindBranding returns the branding of the tenant named, or of the tenant the UI is served at the host for when no
+// tenant is named. It's the default branding when neither has one.
+func FindBranding(tenantName, host string) (*TenantBranding, error) {
+	db := config.SC.DBC
+	query := "select branding from tenant_branding where host=?"
+	arg := strings.ToLower(host)
+	if tenantName != "" {
+		query = "select b.branding from tenant_branding b join tenant t on t.id=b.tenant_id where t.name=?"
+		arg = tenantName
+	}
+	q, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	tb, err := scanBranding(q.QueryRow(arg))
+	if err != nil {
+		return nil, err
+	}
+	if tb == nil {
+		return DefaultBranding(), nil
+	}
+	return tb, nil
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// The files of the tenant in the object storage, with how their name is made
+var tenantFileQueries = []struct {
+	query    string
+	filename func(id int64, filename string) string
+}{
+	{
+		query: `select d.plan_id, d.filename from plan_data d join plan pl on pl.id=d.plan_id
+			join project p on p.id=pl.project_id where p.owner=?`,
+		filename: func(id int64, filename string) string { return (&Plan{ID: id}).MakeFileName(filename) },
+	},
+	{
+		query: `select f.plan_id, f.filename from plan_test_file f join plan pl on pl.id=f.plan_id
+			join project p on p.id=pl.project_id where p.owner=?`,
+		filename: func(id int64, filename string) string { return (&Plan{ID: id}).MakeFileName(filename) },
+	},
+	{
+		query: `select d.collection_id, d.filename from collection_data d join collection c on c.id=d.collection_id
+			join project p on p.id=c.project_id where p.owner=?`,
+		filename: func(id int64, filename string) string { return (&Collection{ID: id}).MakeFileName(filename) },
+	},
+	{
+		query: `select f.project_id, f.filename from project_file f join project p on p.id=f.project_id
+			where p.owner=?`,
+		filename: func(id int64, filename string) string { return (&Project{ID: id}).MakeFileName(filename) },
+	},
+	{
+		query: `select f.run_id, f.filename from collection_run_failure_capture f
+			join collection c on c.id=f.collection_id join project p on p.id=c.project_id where p.owner=?`,
+		filename: func(_ int64, filename string) string { return filename },
+	},
+}
+
+// RoutesStorage tells if the files of the projects of the owner are kept in the region of the tenant. Like the
+// namespace, they are kept in the region of the first tenant of the owner.
+func (t *Tenant) RoutesStorage() (bool, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select min(id) from tenant where owner=?")
+	if err != nil {
+		return false, err
+	}
+	defer q.Close()
+	var first int64
+	if err := q.QueryRow(t.Owner).Scan(&first); err != nil {
+		return false, err
+	}
+	return first == t.ID, nil
+}
+
+// StorageFiles lists the files of the tenant in the object storage: the files of its plans, collections and
+// projects, and the failing responses captured in its runs
+func (t *Tenant) StorageFiles() ([]string, error) {
+	db := config.SC.DBC
+	files := []string{}
+	for _, tf := range tenantFileQueries {
+		q, err := db.Prepare(tf.query)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := q.Query(t.Owner)
+		if err != nil {
+			q.Close()
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var filename string
+			if err := rows.Scan(&id, &filename); err != nil {
+				rows.Close()
+				q.Close()
+				return nil, err
+			}
+			files = append(files, tf.filename(id, filename))
+		}
+		err = rows.Err()
+		rows.Close()
+		q.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// SetStorageRegion changes where the files of the tenant are read from and written to. The files have to be
+// moved to the region first.
+func (t *Tenant) SetStorageRegion(region string) error {
+	db := config.SC.DBC
+	q, err := db.Prepare("update tenant set storage_region=? where id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	if _, err := q.Exec(region, t.ID); err != nil {
+		return fmt.Errorf("cannot set the storage region of tenant %s: %w", t.Name, err)
+	}
+	t.StorageRegion = region
+	return nil
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTenantName(t *testing.T) {
+	for _, name := range []string{"acme", "team-42", "a"} {
+		assert.NoError(t, ValidateTenantName(name), name)
+	}
+	invalid := []string{"", "Acme", "-acme", "acme-", "acme_team", "acme.team", strings.Repeat("a", maxTenantNameLength+1)}
+	for _, name := range invalid {
+		assert.Error(t, ValidateTenantName(name), name)
+	}
+}
+
+func TestCanChange(t *testing.T) {
+	assignments := map[string][]string{
+		TenantRoleAdmin:  {"alice"},
+		TenantRoleMember: {"perf-team"},
+		TenantRoleViewer: {"bob", "sre"},
+	}
+	assert.True(t, CanChange(assignments, &Account{Name: "alice", MLMap: map[string]interface{}{}}))
+	assert.True(t, CanChange(assignments, &Account{Name: "carol", MLMap: map[string]interface{}{"perf-team": struct{}{}}}))
+	assert.False(t, CanChange(assignments, &Account{Name: "bob", MLMap: map[string]interface{}{"sre": struct{}{}}}))
+	assert.False(t, CanChange(assignments, &Account{Name: "dave", MLMap: map[string]interface{}{}}))
+}
+
+func TestTenantQuotaValidate(t *testing.T) {
+	assert.NoError(t, (&TenantQuota{}).Validate())
+	assert.NoError(t, (&TenantQuota{MaxEngines: 100, MaxRunningCollections: 5}).Validate())
+	assert.Error(t, (&TenantQuota{MaxEngines: -1}).Validate())
+	assert.Error(t, (&TenantQuota{MaxRunningCollections: -1}).Validate())
+}
+
+func TestTenantBrandingValidate(t *testing.T) {
+	tb := &TenantBranding{DisplayName: "Acme Load", LogoURL: "https://cdn.acme.example/logo.svg", Host: "Load.Acme.Example",
+		SupportLinks: []*SupportLink{{Title: "Chat", URL: "https://chat.acme.example/load"}, {Title: "Mail", URL: "mailto:load@acme.example"}}}
+	assert.NoError(t, tb.Validate())
+	assert.Equal(t, "load.acme.example", tb.Host)
+	assert.NoError(t, (&TenantBranding{DisplayName: "Acme", LogoURL: "/static/acme.svg"}).Validate())
+
+	invalid := []*TenantBranding{
+		{},
+		{DisplayName: strings.Repeat("a", maxBrandingTextLength+1)},
+		{DisplayName: "Acme", LogoURL: "javascript:alert(1)"},
+		{DisplayName: "Acme", LogoURL: "//cdn.acme.example/logo.svg"},
+		{DisplayName: "Acme", Host: "acme.example:8080"},
+		{DisplayName: "Acme", SupportLinks: []*SupportLink{{Title: "Chat", URL: "javascript:alert(1)"}}},
+		{DisplayName: "Acme", SupportLinks: []*SupportLink{{URL: "https://chat.acme.example"}}},
+	}
+	for _, tb := range invalid {
+		assert.Error(t, tb.Validate(), tb.LogoURL)
+	}
+}
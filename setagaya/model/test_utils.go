@@ -98,6 +98,18 @@ func setupAndTeardown() error {
 	return nil
 }
 
+// SetupLocalDatabase runs the test against an empty database of the local mode, the one the models used before is
+// restored when the test ends
+func SetupLocalDatabase(t *testing.T) {
+	db := config.OpenLocalDatabase(t.TempDir())
+	original := config.SC.DBC
+	config.SC.DBC = db
+	t.Cleanup(func() {
+		config.SC.DBC = original
+		db.Close()
+	})
+}
+
 // SetupTestEnvironment initializes a test environment with mock config
 func SetupTestEnvironment(t *testing.T) func() {
 	// Store original config
@@ -0,0 +1,34 @@
+package model
+
+import "math/rand/v2"
+
+// TriggerRequest holds what the user can supply when triggering a collection. Every field is optional.
+type TriggerRequest struct {
+	// Values of the parameters declared by the plans of the collection
+	Parameters map[string]string `json:"parameters"`
+	// Source control information of the code being tested
+	Metadata *RunMetadata `json:"metadata"`
+	// Calibration runs execute the workload of the collection to measure how noisy the environment is. They are
+	// used to tell real performance changes from environment variance in comparisons, until the plans change.
+	Calibration bool `json:"calibration"`
+	// Captures a sample of the failing responses of the run. Disabled when nil. Only jmeter engines support it
+	FailureCapture *FailureCapture `json:"failure_capture"`
+	// Seed of the random values of the engines, so a run can be replayed with the same ones. A seed is drawn when
+	// it's not given, the runs vary and the seed of every run is kept with its metadata.
+	Seed *int64 `json:"seed,omitempty"`
+	// Shuffles the rows of the csv files of the engines with the seed
+	ShuffleData bool `json:"shuffle_data"`
+	// Stops the run when nobody sends its heartbeat in time. nil runs unattended
+	Attended *AttendedRun `json:"attended,omitempty"`
+}
+
+// WithSeed is the request with a seed, the one given or a new one. The request itself is not changed, the windows of
+// a continuous collection are triggered with the same one and draw a seed each.
+func (tr *TriggerRequest) WithSeed() *TriggerRequest {
+	seeded := *tr
+	if seeded.Seed == nil {
+		seed := rand.Int64()
+		seeded.Seed = &seed
+	}
+	return &seeded
+}
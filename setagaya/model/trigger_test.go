@@ -0,0 +1,19 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriggerRequestWithSeed(t *testing.T) {
+	tr := &TriggerRequest{Parameters: map[string]string{"host": "example.com"}}
+	seeded := tr.WithSeed()
+	assert.NotNil(t, seeded.Seed)
+	assert.Nil(t, tr.Seed)
+	assert.Equal(t, tr.Parameters, seeded.Parameters)
+
+	seed := int64(42)
+	tr.Seed = &seed
+	assert.Equal(t, int64(42), *tr.WithSeed().Seed)
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"math"
+	"sort"
 	"strconv"
 	"time"
 
@@ -200,3 +201,52 @@ func GetUsageSummaryBySid(sid, startedTime, endTime string) (*OwnerUsageSummary,
 	s.History = sidHistory
 	return s, nil
 }
+
+// ProjectUsage is the usage of a project in vuh, across all the contexts
+type ProjectUsage struct {
+	ProjectID int64   `json:"project_id"`
+	Name      string  `json:"name"`
+	Owner     string  `json:"owner" classification:"personal"`
+	VUH       float64 `json:"vuh"`
+}
+
+// rankProjectsByUsage sums up the usage of the launches by project and returns the top projects. The launches
+// of the deleted projects are left out.
+func rankProjectsByUsage(history []*CollectionLaunchHistory, collectionsToProjects map[int64]Project, top int) []*ProjectUsage {
+	usage := make(map[int64]*ProjectUsage)
+	for _, h := range history {
+		project, ok := collectionsToProjects[h.CollectionID]
+		if !ok {
+			continue
+		}
+		pu, ok := usage[project.ID]
+		if !ok {
+			pu = &ProjectUsage{ProjectID: project.ID, Name: project.Name, Owner: project.Owner}
+			usage[project.ID] = pu
+		}
+		pu.VUH += calVUH(calBillingHours(h.StartedTime, h.EndTime), float64(h.Vu))
+	}
+	ranked := make([]*ProjectUsage, 0, len(usage))
+	for _, pu := range usage {
+		ranked = append(ranked, pu)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].VUH != ranked[j].VUH {
+			return ranked[i].VUH > ranked[j].VUH
+		}
+		return ranked[i].ProjectID < ranked[j].ProjectID
+	})
+	if len(ranked) > top {
+		ranked = ranked[:top]
+	}
+	return ranked
+}
+
+// GetTopProjectsByUsage returns the projects which used the most vuh between the two times
+func GetTopProjectsByUsage(startedTime, endTime string, top int) ([]*ProjectUsage, error) {
+	history, err := GetHistory(startedTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	return rankProjectsByUsage(history, makeCollectionsToProjects(history), top), nil
+}
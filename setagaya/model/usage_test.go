@@ -304,3 +304,30 @@ func TestUsageEdgeCases(t *testing.T) {
 		assert.Equal(t, 1000000000000.0, result)
 	})
 }
+
+func TestRankProjectsByUsage(t *testing.T) {
+	start := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	history := []*CollectionLaunchHistory{
+		{CollectionID: 1, Vu: 10, StartedTime: start, EndTime: start.Add(2 * time.Hour)},
+		{CollectionID: 2, Vu: 30, StartedTime: start, EndTime: start.Add(time.Hour)},
+		{CollectionID: 3, Vu: 100, StartedTime: start, EndTime: start.Add(time.Hour)},
+		// The project of the collection is deleted
+		{CollectionID: 4, Vu: 1000, StartedTime: start, EndTime: start.Add(time.Hour)},
+	}
+	collectionsToProjects := map[int64]Project{
+		1: {ID: 10, Name: "a", Owner: "team-a"},
+		2: {ID: 10, Name: "a", Owner: "team-a"},
+		3: {ID: 20, Name: "b", Owner: "team-b"},
+	}
+	ranked := rankProjectsByUsage(history, collectionsToProjects, 5)
+	assert.Len(t, ranked, 2)
+	assert.Equal(t, int64(20), ranked[0].ProjectID)
+	assert.Equal(t, 100.0, ranked[0].VUH)
+	assert.Equal(t, int64(10), ranked[1].ProjectID)
+	assert.Equal(t, 50.0, ranked[1].VUH)
+	assert.Equal(t, "team-a", ranked[1].Owner)
+
+	ranked = rankProjectsByUsage(history, collectionsToProjects, 1)
+	assert.Len(t, ranked, 1)
+	assert.Equal(t, int64(20), ranked[0].ProjectID)
+}
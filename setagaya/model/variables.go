@@ -0,0 +1,78 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// Longest value of a variable, they end up on the command line of the engines
+const maxVariableLength = 4096
+
+// ValidateVariables checks the variables of a collection or of a plan can be passed to the engines, like the
+// parameters of the plans
+func ValidateVariables(variables map[string]string) error {
+	for name, value := range variables {
+		if !parameterNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid variable name %q", name)
+		}
+		if len(value) > maxVariableLength {
+			return fmt.Errorf("variable %s is longer than %d characters", name, maxVariableLength)
+		}
+	}
+	return nil
+}
+
+// MergeVariables returns the variables of all the layers, the values of the later layers overriding the ones of
+// the earlier layers
+func MergeVariables(layers ...map[string]string) map[string]string {
+	r := map[string]string{}
+	for _, layer := range layers {
+		for name, value := range layer {
+			r[name] = value
+		}
+	}
+	return r
+}
+
+func (c *Collection) updateCollectionVariables(variables map[string]string) error {
+	column, err := jsonColumn(variables, len(variables) == 0)
+	if err != nil {
+		return err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("update collection set variables=? where id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(column, c.ID)
+	return err
+}
+
+func parseVariables(variables sql.NullString) (map[string]string, error) {
+	if !variables.Valid {
+		return nil, nil
+	}
+	r := map[string]string{}
+	if err := json.Unmarshal([]byte(variables.String), &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (ep *ExecutionPlan) variablesDB() ([]byte, error) {
+	if len(ep.Variables) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(ep.Variables)
+}
+
+func (ep *ExecutionPlan) scanVariables(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, &ep.Variables)
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateVariables(t *testing.T) {
+	assert.NoError(t, ValidateVariables(nil))
+	assert.NoError(t, ValidateVariables(map[string]string{"target.host": "example.com", "API_TOKEN": ""}))
+	assert.Error(t, ValidateVariables(map[string]string{"target host": "example.com"}))
+	assert.Error(t, ValidateVariables(map[string]string{"payload": strings.Repeat("a", maxVariableLength+1)}))
+}
+
+func TestMergeVariables(t *testing.T) {
+	assert.Empty(t, MergeVariables())
+	collection := map[string]string{"host": "example.com", "region": "eu"}
+	merged := MergeVariables(collection, map[string]string{"region": "us"}, nil)
+	assert.Equal(t, map[string]string{"host": "example.com", "region": "us"}, merged)
+	assert.Equal(t, "eu", collection["region"])
+}
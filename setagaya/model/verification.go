@@ -0,0 +1,212 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+const (
+	VerificationDeploying = "deploying"
+	VerificationRunning   = "running"
+	VerificationPassed    = "passed"
+	VerificationMarginal  = "marginal"
+	VerificationFailed    = "failed"
+
+	DefaultVerificationTolerance         = 0.1
+	DefaultVerificationPassThreshold     = 75
+	DefaultVerificationMarginalThreshold = 50
+)
+
+// VerificationRequest is what a deployment gate, e.g. a Spinnaker or Harness stage, sends to verify a release.
+// Every field is optional.
+type VerificationRequest struct {
+	// Values of the parameters declared by the plans of the collection
+	Parameters map[string]string `json:"parameters"`
+	// Source control information of the release being verified
+	Metadata *RunMetadata `json:"metadata"`
+	// Run the verification run is scored against, the baseline of the collection by default
+	BaselineRunID int64 `json:"baseline_run_id"`
+	// Ratio a figure can exceed the one of the baseline by and still pass, 0.1 by default
+	Tolerance *float64 `json:"tolerance"`
+	// Lowest scores, out of 100, of the verifications passing and of the marginal ones. 75 and 50 by default
+	PassThreshold     *float64 `json:"pass_threshold"`
+	MarginalThreshold *float64 `json:"marginal_threshold"`
+	// Keeps the engines deployed after the run, for the next verifications
+	KeepEngines bool `json:"keep_engines"`
+}
+
+// Validate fills the defaults of the request and checks its thresholds
+func (vr *VerificationRequest) Validate() error {
+	if vr.Tolerance == nil {
+		t := DefaultVerificationTolerance
+		vr.Tolerance = &t
+	}
+	if vr.PassThreshold == nil {
+		t := float64(DefaultVerificationPassThreshold)
+		vr.PassThreshold = &t
+	}
+	if vr.MarginalThreshold == nil {
+		t := float64(DefaultVerificationMarginalThreshold)
+		vr.MarginalThreshold = &t
+	}
+	if *vr.Tolerance < 0 {
+		return errors.New("tolerance cannot be negative")
+	}
+	if *vr.PassThreshold < 0 || *vr.PassThreshold > 100 {
+		return errors.New("pass threshold should be between 0 and 100")
+	}
+	if *vr.MarginalThreshold < 0 || *vr.MarginalThreshold > *vr.PassThreshold {
+		return errors.New("marginal threshold should be between 0 and the pass threshold")
+	}
+	return vr.Metadata.Validate()
+}
+
+// VerificationMetric is a figure of the verification run compared to the one of the baseline run
+type VerificationMetric struct {
+	Name     string  `json:"name"`
+	Baseline float64 `json:"baseline"`
+	Value    float64 `json:"value"`
+	Passed   bool    `json:"passed"`
+}
+
+// Verification runs the collection and scores the run against a baseline run, like the automated canary analysis
+// of the deployment pipelines. The score is the percentage of the metrics that passed.
+type Verification struct {
+	ID                int64                 `json:"id"`
+	CollectionID      int64                 `json:"collection_id"`
+	RunID             int64                 `json:"run_id"`
+	BaselineRunID     int64                 `json:"baseline_run_id"`
+	Status            string                `json:"status"`
+	Score             float64               `json:"score"`
+	PassThreshold     float64               `json:"pass_threshold"`
+	MarginalThreshold float64               `json:"marginal_threshold"`
+	Tolerance         float64               `json:"tolerance"`
+	Metrics           []*VerificationMetric `json:"metrics"`
+	Message           string                `json:"message"`
+	CreatedBy         string                `json:"created_by"`
+	CreatedTime       time.Time             `json:"created_time"`
+	UpdatedTime       time.Time             `json:"updated_time"`
+}
+
+func (v *Verification) IsFinished() bool {
+	return v.Status == VerificationPassed || v.Status == VerificationMarginal || v.Status == VerificationFailed
+}
+
+// Judge sets the status of the verification from its score
+func (v *Verification) Judge() {
+	switch {
+	case v.Score >= v.PassThreshold:
+		v.Status = VerificationPassed
+	case v.Score >= v.MarginalThreshold:
+		v.Status = VerificationMarginal
+	default:
+		v.Status = VerificationFailed
+	}
+}
+
+func CreateVerification(collectionID, baselineRunID int64, vr *VerificationRequest, owner string) (*Verification, error) {
+	now := time.Now()
+	v := &Verification{
+		CollectionID:      collectionID,
+		BaselineRunID:     baselineRunID,
+		Status:            VerificationDeploying,
+		PassThreshold:     *vr.PassThreshold,
+		MarginalThreshold: *vr.MarginalThreshold,
+		Tolerance:         *vr.Tolerance,
+		CreatedBy:         owner,
+		CreatedTime:       now,
+		UpdatedTime:       now,
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into collection_verification (collection_id, baseline_run_id, status, pass_threshold,
+		marginal_threshold, tolerance, created_by) values (?,?,?,?,?,?,?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	r, err := q.Exec(v.CollectionID, v.BaselineRunID, v.Status, v.PassThreshold, v.MarginalThreshold, v.Tolerance,
+		v.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	if v.ID, err = r.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func UpdateVerification(v *Verification) error {
+	metrics, err := jsonColumn(v.Metrics, len(v.Metrics) == 0)
+	if err != nil {
+		return err
+	}
+	if len(v.Message) > 1024 {
+		v.Message = v.Message[:1024]
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`update collection_verification set run_id=?, status=?, score=?, metrics=?, message=?,
+		updated_time=CURRENT_TIMESTAMP where id=?`)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(v.RunID, v.Status, v.Score, metrics, v.Message, v.ID)
+	return err
+}
+
+const verificationColumns = `id, collection_id, run_id, baseline_run_id, status, score, pass_threshold,
+	marginal_threshold, tolerance, metrics, message, created_by, created_time, updated_time`
+
+func GetVerification(collectionID, id int64) (*Verification, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + verificationColumns + " from collection_verification where id=? and collection_id=?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	return scanVerification(q.QueryRow(id, collectionID))
+}
+
+// GetRunVerification returns the last verification scoring the run
+func GetRunVerification(collectionID, runID int64) (*Verification, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select " + verificationColumns +
+		" from collection_verification where run_id=? and collection_id=? order by id desc limit 1")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	return scanVerification(q.QueryRow(runID, collectionID))
+}
+
+func scanVerification(row *sql.Row) (*Verification, error) {
+	v := new(Verification)
+	var metrics sql.NullString
+	err := row.Scan(&v.ID, &v.CollectionID, &v.RunID, &v.BaselineRunID, &v.Status, &v.Score,
+		&v.PassThreshold, &v.MarginalThreshold, &v.Tolerance, &metrics, &v.Message, &v.CreatedBy, &v.CreatedTime,
+		&v.UpdatedTime)
+	if err != nil {
+		return nil, &DBError{Err: err, Message: "verification not found"}
+	}
+	if metrics.Valid {
+		if err := json.Unmarshal([]byte(metrics.String), &v.Metrics); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+func (c *Collection) deleteVerifications() error {
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from collection_verification where collection_id=?")
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	_, err = q.Exec(c.ID)
+	return err
+}
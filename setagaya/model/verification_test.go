@@ -0,0 +1,37 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerificationRequestValidate(t *testing.T) {
+	vr := new(VerificationRequest)
+	assert.NoError(t, vr.Validate())
+	assert.Equal(t, DefaultVerificationTolerance, *vr.Tolerance)
+	assert.Equal(t, float64(DefaultVerificationPassThreshold), *vr.PassThreshold)
+	assert.Equal(t, float64(DefaultVerificationMarginalThreshold), *vr.MarginalThreshold)
+
+	value := func(f float64) *float64 { return &f }
+	for _, vr := range []*VerificationRequest{
+		{Tolerance: value(-0.1)},
+		{PassThreshold: value(101)},
+		{PassThreshold: value(60), MarginalThreshold: value(70)},
+		{Metadata: &RunMetadata{CommitSHA: "not a sha"}},
+	} {
+		assert.Error(t, vr.Validate())
+	}
+}
+
+func TestVerificationJudge(t *testing.T) {
+	v := &Verification{PassThreshold: 75, MarginalThreshold: 50, Status: VerificationRunning}
+	assert.False(t, v.IsFinished())
+	for score, status := range map[float64]string{100: VerificationPassed, 75: VerificationPassed,
+		60: VerificationMarginal, 40: VerificationFailed} {
+		v.Score = score
+		v.Judge()
+		assert.Equal(t, status, v.Status)
+		assert.True(t, v.IsFinished())
+	}
+}
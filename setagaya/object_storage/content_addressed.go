@@ -0,0 +1,191 @@
+package object_storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ContentIndex maps the names of the files to the digest of their content
+type ContentIndex interface {
+	// Resolve returns the digest of the file, FileNotFoundError when the file is not in the index
+	Resolve(filename string) (string, error)
+	// Link maps the file to the digest. It returns the digest the file had before, empty if it had none
+	Link(filename, digest string) (string, error)
+	// Unlink removes the file from the index and returns its digest, FileNotFoundError when it's not in the index
+	Unlink(filename string) (string, error)
+	// Release calls remove when no file has the digest anymore. No file is linked to the digest until it returned
+	Release(digest string, remove func() error) error
+	// List lists the files of the index whose name starts with the prefix
+	List(prefix string) ([]*ObjectInfo, error)
+}
+
+// contentAddressedStorage stores the content of the files once under their sha256 in the backend, whatever the
+// number of files having it. The files are mapped to their content by the index, so copying a file does not copy
+// its content. The files stored before the index are still read from their name.
+type contentAddressedStorage struct {
+	backend StorageInterface
+	index   ContentIndex
+}
+
+func NewContentAddressedStorage(backend StorageInterface, index ContentIndex) StorageInterface {
+	return &contentAddressedStorage{backend: backend, index: index}
+}
+
+func blobName(digest string) string {
+	return fmt.Sprintf("blobs/sha256/%s", digest)
+}
+
+// Locate is where the content of the file is stored in the backend
+func (s *contentAddressedStorage) Locate(filename string) string {
+	digest, err := s.index.Resolve(filename)
+	if err != nil {
+		return filename
+	}
+	return blobName(digest)
+}
+
+// release deletes the content when no file has it anymore
+func (s *contentAddressedStorage) release(digest string) error {
+	return s.index.Release(digest, func() error {
+		return s.backend.Delete(blobName(digest))
+	})
+}
+
+func (s *contentAddressedStorage) link(filename, digest string) error {
+	previous, err := s.index.Link(filename, digest)
+	if err != nil {
+		return err
+	}
+	if previous != "" && previous != digest {
+		return s.release(previous)
+	}
+	return nil
+}
+
+func (s *contentAddressedStorage) Upload(filename string, content io.ReadCloser) error {
+	data, err := io.ReadAll(content)
+	content.Close()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	// The file is linked first so the content cannot be released meanwhile, then the content is stored whether
+	// other files have it or not, as the last of them may have been deleted with it just before
+	if err := s.link(filename, digest); err != nil {
+		return err
+	}
+	return s.backend.Upload(blobName(digest), io.NopCloser(bytes.NewReader(data)))
+}
+
+func (s *contentAddressedStorage) Delete(filename string) error {
+	digest, err := s.index.Unlink(filename)
+	if errors.Is(err, FileNotFoundError()) {
+		return s.backend.Delete(filename)
+	}
+	if err != nil {
+		return err
+	}
+	return s.release(digest)
+}
+
+func (s *contentAddressedStorage) GetUrl(filename string) string {
+	return s.backend.GetUrl(s.Locate(filename))
+}
+
+// SignedUrl signs the url of the content of the file when downloading it. An upload goes to the name of the file, as
+// its content is not known yet.
+func (s *contentAddressedStorage) SignedUrl(filename, method string, expiry time.Duration) (string, error) {
+	b, ok := s.backend.(signer)
+	if !ok {
+		return "", errors.New("the backend does not sign urls")
+	}
+	if method == http.MethodGet {
+		filename = s.Locate(filename)
+	}
+	return b.SignedUrl(filename, method, expiry)
+}
+
+func (s *contentAddressedStorage) Download(filename string) ([]byte, error) {
+	return s.backend.Download(s.Locate(filename))
+}
+
+// Copy maps the destination to the content of the source, nothing is copied in the backend
+func (s *contentAddressedStorage) Copy(src, dst string) error {
+	digest, err := s.index.Resolve(src)
+	if errors.Is(err, FileNotFoundError()) {
+		return copyContent(s, src, dst)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.link(dst, digest); err != nil {
+		return err
+	}
+	// The content may have been released with the source before the destination was linked to it
+	if current, err := s.index.Resolve(src); err != nil || current != digest {
+		if err := s.Delete(dst); err != nil {
+			return err
+		}
+		return FileNotFoundError()
+	}
+	return nil
+}
+
+// List lists the files of the index, and the ones stored before the index under their name
+func (s *contentAddressedStorage) List(prefix string) ([]*ObjectInfo, error) {
+	objects, err := s.index.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := List(s.backend, prefix)
+	if err != nil {
+		return nil, err
+	}
+	indexed := make(map[string]bool, len(objects))
+	for _, o := range objects {
+		indexed[o.Name] = true
+	}
+	for _, o := range stored {
+		if !indexed[o.Name] {
+			objects = append(objects, o)
+		}
+	}
+	return objects, nil
+}
+
+// CheckHealth probes the backend, the index is in the database
+func (s *contentAddressedStorage) CheckHealth() *HealthReport {
+	return CheckHealth(s.backend)
+}
+
+func copyContent(storage StorageInterface, src, dst string) error {
+	content, err := storage.Download(src)
+	if err != nil {
+		return err
+	}
+	return storage.Upload(dst, io.NopCloser(bytes.NewReader(content)))
+}
+
+// Copy copies the file. It's instant when the storage is content addressed
+func Copy(storage StorageInterface, src, dst string) error {
+	if c, ok := storage.(interface{ Copy(src, dst string) error }); ok {
+		return c.Copy(src, dst)
+	}
+	return copyContent(storage, src, dst)
+}
+
+// Locate is where the file is stored in the backend of the storage. The engines read the files from the backend
+// directly, as they cannot reach the index.
+func Locate(storage StorageInterface, filename string) string {
+	if l, ok := storage.(interface{ Locate(filename string) string }); ok {
+		return l.Locate(filename)
+	}
+	return filename
+}
@@ -0,0 +1,200 @@
+package object_storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryContentIndex struct {
+	digests map[string]string
+	// Called when a file is about to be linked
+	beforeLink func()
+}
+
+func (idx *memoryContentIndex) Resolve(filename string) (string, error) {
+	digest, ok := idx.digests[filename]
+	if !ok {
+		return "", FileNotFoundError()
+	}
+	return digest, nil
+}
+
+func (idx *memoryContentIndex) Link(filename, digest string) (string, error) {
+	if idx.beforeLink != nil {
+		before := idx.beforeLink
+		idx.beforeLink = nil
+		before()
+	}
+	previous := idx.digests[filename]
+	idx.digests[filename] = digest
+	return previous, nil
+}
+
+func (idx *memoryContentIndex) Unlink(filename string) (string, error) {
+	digest, err := idx.Resolve(filename)
+	if err != nil {
+		return "", err
+	}
+	delete(idx.digests, filename)
+	return digest, nil
+}
+
+func (idx *memoryContentIndex) Release(digest string, remove func() error) error {
+	for _, d := range idx.digests {
+		if d == digest {
+			return nil
+		}
+	}
+	return remove()
+}
+
+func (idx *memoryContentIndex) List(prefix string) ([]*ObjectInfo, error) {
+	objects := []*ObjectInfo{}
+	for filename := range idx.digests {
+		if strings.HasPrefix(filename, prefix) {
+			objects = append(objects, &ObjectInfo{Name: filename})
+		}
+	}
+	return objects, nil
+}
+
+func content(s string) io.ReadCloser {
+	return io.NopCloser(strings.NewReader(s))
+}
+
+func TestContentAddressedStorage(t *testing.T) {
+	backend := NewMockStorage("http://storage")
+	index := &memoryContentIndex{digests: map[string]string{}}
+	storage := NewContentAddressedStorage(backend, index)
+
+	assert.NoError(t, storage.Upload("plan/1/users.csv", content("alice,bob")))
+	assert.NoError(t, storage.Upload("plan/2/users.csv", content("alice,bob")))
+	assert.Len(t, backend.files, 1)
+
+	data, err := storage.Download("plan/2/users.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice,bob", string(data))
+	blob := Locate(storage, "plan/1/users.csv")
+	assert.True(t, strings.HasPrefix(blob, "blobs/sha256/"))
+	assert.Equal(t, "http://storage/"+blob, storage.GetUrl("plan/1/users.csv"))
+
+	// The content is kept until no file has it
+	assert.NoError(t, storage.Delete("plan/1/users.csv"))
+	assert.Len(t, backend.files, 1)
+	assert.NoError(t, storage.Delete("plan/2/users.csv"))
+	assert.Empty(t, backend.files)
+}
+
+func TestContentAddressedStorageReplace(t *testing.T) {
+	backend := NewMockStorage("http://storage")
+	storage := NewContentAddressedStorage(backend, &memoryContentIndex{digests: map[string]string{}})
+
+	assert.NoError(t, storage.Upload("plan/1/users.csv", content("alice")))
+	assert.NoError(t, storage.Upload("plan/1/users.csv", content("bob")))
+	assert.Len(t, backend.files, 1)
+	data, err := storage.Download("plan/1/users.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", string(data))
+}
+
+func TestContentAddressedStorageDeleteWhileUploading(t *testing.T) {
+	backend := NewMockStorage("http://storage")
+	index := &memoryContentIndex{digests: map[string]string{}}
+	storage := NewContentAddressedStorage(backend, index)
+
+	// The last file having the content is deleted while another one with the same content is uploaded
+	assert.NoError(t, storage.Upload("plan/1/users.csv", content("alice,bob")))
+	index.beforeLink = func() {
+		assert.NoError(t, storage.Delete("plan/1/users.csv"))
+	}
+	assert.NoError(t, storage.Upload("plan/2/users.csv", content("alice,bob")))
+	data, err := storage.Download("plan/2/users.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice,bob", string(data))
+
+	// The source of a copy is deleted before the destination is linked to its content
+	index.beforeLink = func() {
+		assert.NoError(t, storage.Delete("plan/2/users.csv"))
+	}
+	assert.ErrorIs(t, Copy(storage, "plan/2/users.csv", "plan/3/users.csv"), FileNotFoundError())
+	_, err = index.Resolve("plan/3/users.csv")
+	assert.ErrorIs(t, err, FileNotFoundError())
+	assert.Empty(t, backend.files)
+}
+
+func TestContentAddressedStorageCopy(t *testing.T) {
+	backend := NewMockStorage("http://storage")
+	storage := NewContentAddressedStorage(backend, &memoryContentIndex{digests: map[string]string{}})
+
+	assert.NoError(t, storage.Upload("plan/1/test.jmx", content("<jmeterTestPlan/>")))
+	assert.NoError(t, Copy(storage, "plan/1/test.jmx", "plan/2/test.jmx"))
+	assert.Len(t, backend.files, 1)
+	assert.Equal(t, Locate(storage, "plan/1/test.jmx"), Locate(storage, "plan/2/test.jmx"))
+
+	// The files stored before the index are copied into it
+	backend.files["plan/3/legacy.csv"] = []byte("carol")
+	assert.NoError(t, Copy(storage, "plan/3/legacy.csv", "plan/4/legacy.csv"))
+	data, err := storage.Download("plan/4/legacy.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "carol", string(data))
+	assert.NoError(t, storage.Delete("plan/3/legacy.csv"))
+	assert.NotContains(t, backend.files, "plan/3/legacy.csv")
+}
+
+func TestCopyWithoutIndex(t *testing.T) {
+	backend := NewMockStorage("http://storage")
+	assert.NoError(t, backend.Upload("plan/1/users.csv", content("alice")))
+	assert.NoError(t, Copy(backend, "plan/1/users.csv", "plan/2/users.csv"))
+	assert.Equal(t, []byte("alice"), backend.files["plan/2/users.csv"])
+	assert.Equal(t, "plan/1/users.csv", Locate(backend, "plan/1/users.csv"))
+}
+
+type signingStorage struct {
+	*MockStorage
+}
+
+func (s signingStorage) SignedUrl(filename, method string, expiry time.Duration) (string, error) {
+	return fmt.Sprintf("https://signed/%s?method=%s&expiry=%s", filename, method, expiry), nil
+}
+
+func TestContentAddressedStorageList(t *testing.T) {
+	backend := NewMockStorage("http://storage")
+	storage := NewContentAddressedStorage(backend, &memoryContentIndex{digests: map[string]string{}})
+	assert.NoError(t, storage.Upload("plan/1/users.csv", content("alice,bob")))
+	assert.NoError(t, storage.Upload("plan/2/users.csv", content("alice,bob")))
+	// Stored before the index
+	assert.NoError(t, backend.Upload("plan/3/test.jmx", content("jmx")))
+
+	objects, err := List(storage, "plan/")
+	assert.NoError(t, err)
+	names := []string{}
+	for _, o := range objects {
+		names = append(names, o.Name)
+	}
+	assert.Equal(t, []string{"plan/1/users.csv", "plan/2/users.csv", "plan/3/test.jmx"}, names)
+}
+
+func TestContentAddressedStorageSignedUrl(t *testing.T) {
+	index := &memoryContentIndex{digests: map[string]string{}}
+	s := NewContentAddressedStorage(signingStorage{NewMockStorage("http://storage")}, index).(*contentAddressedStorage)
+	assert.Nil(t, s.Upload("plan/1/data.csv", content("a,b")))
+	digest := index.digests["plan/1/data.csv"]
+
+	url, err := s.SignedUrl("plan/1/data.csv", http.MethodGet, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://signed/blobs/sha256/"+digest+"?method=GET&expiry=1m0s", url)
+
+	url, err = s.SignedUrl("failures/1.json", http.MethodPut, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://signed/failures/1.json?method=PUT&expiry=1m0s", url)
+
+	unsigned := NewContentAddressedStorage(NewMockStorage("http://storage"), index).(*contentAddressedStorage)
+	_, err = unsigned.SignedUrl("plan/1/data.csv", http.MethodGet, time.Minute)
+	assert.NotNil(t, err)
+}
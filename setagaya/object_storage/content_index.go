@@ -0,0 +1,111 @@
+package object_storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// dbContentIndex keeps the index of the content addressed storage in the database of Setagaya
+type dbContentIndex struct{}
+
+func (dbContentIndex) Resolve(filename string) (string, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select digest from object_storage_content where filename=?")
+	if err != nil {
+		return "", err
+	}
+	defer q.Close()
+	var digest string
+	err = q.QueryRow(filename).Scan(&digest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", FileNotFoundError()
+	}
+	return digest, err
+}
+
+func (idx dbContentIndex) Link(filename, digest string) (string, error) {
+	previous, err := idx.Resolve(filename)
+	if err != nil && !errors.Is(err, FileNotFoundError()) {
+		return "", err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(`insert into object_storage_content (filename, digest) values (?,?)
+		on duplicate key update digest=?`)
+	if err != nil {
+		return "", err
+	}
+	defer q.Close()
+	if _, err := q.Exec(filename, digest, digest); err != nil {
+		return "", err
+	}
+	return previous, nil
+}
+
+func (idx dbContentIndex) Unlink(filename string) (string, error) {
+	digest, err := idx.Resolve(filename)
+	if err != nil {
+		return "", err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare("delete from object_storage_content where filename=?")
+	if err != nil {
+		return "", err
+	}
+	defer q.Close()
+	if _, err := q.Exec(filename); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// Release locks the rows of the digest, and the gap where new ones would go, until the content is removed
+func (dbContentIndex) Release(digest string, remove func() error) error {
+	db := config.SC.DBC
+	tx, err := db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var references int
+	if err := tx.QueryRow("select count(*) from object_storage_content where digest=? for update", digest).
+		Scan(&references); err != nil {
+		return err
+	}
+	if references > 0 {
+		return nil
+	}
+	if err := remove(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (dbContentIndex) List(prefix string) ([]*ObjectInfo, error) {
+	db := config.SC.DBC
+	q, err := db.Prepare("select filename, created_time from object_storage_content where filename like ?")
+	if err != nil {
+		return nil, err
+	}
+	defer q.Close()
+	// The wildcards of the prefix widen the pattern, the names are checked again
+	rows, err := q.Query(prefix + "%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	objects := []*ObjectInfo{}
+	for rows.Next() {
+		o := new(ObjectInfo)
+		if err := rows.Scan(&o.Name, &o.Updated); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(o.Name, prefix) {
+			objects = append(objects, o)
+		}
+	}
+	return objects, rows.Err()
+}
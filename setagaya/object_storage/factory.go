@@ -12,22 +12,30 @@ const (
 	nexusStorageProvider = "nexus"
 	gcpStorageProvider   = "gcp"
 	localStorageProvider = "local"
+	// The storage of the local mode
+	filesystemStorageProvider = "filesystem"
 )
 
-var allStorageProvidder = []string{nexusStorageProvider, gcpStorageProvider, localStorageProvider}
+var allStorageProvidder = []string{nexusStorageProvider, gcpStorageProvider, localStorageProvider, filesystemStorageProvider}
 
 type PlatformConfig struct {
 	Storage StorageInterface
 }
 
 func getStorageOfType(storageProvider string) (StorageInterface, error) {
+	return makeStorage(storageProvider, config.SC.ObjectStorage)
+}
+
+func makeStorage(storageProvider string, o *config.ObjectStorage) (StorageInterface, error) {
 	switch storageProvider {
 	case nexusStorageProvider:
-		return NewNexusStorage(), nil
+		return NewNexusStorage(o), nil
 	case gcpStorageProvider:
-		return NewGcpStorage(), nil
+		return NewGcpStorage(o), nil
 	case localStorageProvider:
-		return NewLocalStorage(), nil
+		return NewLocalStorage(o), nil
+	case filesystemStorageProvider:
+		return NewFilesystemStorage(o), nil
 	default:
 		return nil, fmt.Errorf("unknown storage type %s, valid storage types are %v", storageProvider, allStorageProvidder)
 	}
@@ -43,13 +51,61 @@ func factoryConfig() PlatformConfig {
 	if err != nil {
 		log.Panic(err)
 	}
+	// The files are written to both storages and read from the secondary one when the primary one fails
+	if secondary := config.SC.ObjectStorage.Secondary; secondary != nil {
+		ss, err := makeStorage(secondary.Provider, secondary)
+		if err != nil {
+			log.Panic(err)
+		}
+		s = NewFailoverStorage(s, ss)
+	}
+	// The engines have no database, they are sent where the content is stored
+	if config.SC.ObjectStorage.ContentAddressed && config.SC.DBC != nil {
+		s = NewContentAddressedStorage(s, dbContentIndex{})
+	}
+	// The content of the files of the regions is not shared, so they are not content addressed
+	if regions := config.SC.ObjectStorage.Regions; len(regions) > 0 {
+		rs := make(map[string]StorageInterface, len(regions))
+		for region, o := range regions {
+			r, err := makeStorage(o.Provider, o)
+			if err != nil {
+				log.Panic(err)
+			}
+			if o.Secondary != nil {
+				secondary, err := makeStorage(o.Secondary.Provider, o.Secondary)
+				if err != nil {
+					log.Panic(err)
+				}
+				r = NewFailoverStorage(r, secondary)
+			}
+			rs[region] = r
+		}
+		var router RegionRouter
+		if config.SC.DBC != nil {
+			router = dbRegionRouter{}
+		}
+		s = NewRegionalStorage(s, rs, router)
+	}
 	return PlatformConfig{
 		Storage: s,
 	}
 }
 
+// GCPStorageConfig is the config of the gcp bucket, the primary or the secondary storage. It's nil when neither is
+// a gcp bucket
+func GCPStorageConfig() *config.ObjectStorage {
+	o := config.SC.ObjectStorage
+	if o.Provider == gcpStorageProvider {
+		return o
+	}
+	if o.Secondary != nil && o.Secondary.Provider == gcpStorageProvider {
+		return o.Secondary
+	}
+	return nil
+}
+
 func IsProviderGCP() bool {
-	return config.SC.ObjectStorage.Provider == gcpStorageProvider
+	return GCPStorageConfig() != nil
 }
 
 var Client PlatformConfig
@@ -87,7 +87,7 @@ func TestIsProviderGCPConstants(t *testing.T) {
 	assert.Contains(t, allStorageProvidder, gcpStorageProvider)
 	assert.Contains(t, allStorageProvidder, nexusStorageProvider)
 	assert.Contains(t, allStorageProvidder, localStorageProvider)
-	assert.Equal(t, 3, len(allStorageProvidder))
+	assert.Equal(t, 4, len(allStorageProvidder))
 }
 
 func TestIsProviderGCPWithNilConfig(t *testing.T) {
@@ -16,9 +16,9 @@ func TestStorageProviderConstants(t *testing.T) {
 
 func TestAllStorageProviders(t *testing.T) {
 	// Test that all providers are listed in the slice
-	expected := []string{"nexus", "gcp", "local"}
+	expected := []string{"nexus", "gcp", "local", "filesystem"}
 	assert.Equal(t, expected, allStorageProvidder)
-	assert.Len(t, allStorageProvidder, 3)
+	assert.Len(t, allStorageProvidder, 4)
 	assert.Contains(t, allStorageProvidder, nexusStorageProvider)
 	assert.Contains(t, allStorageProvidder, gcpStorageProvider)
 	assert.Contains(t, allStorageProvidder, localStorageProvider)
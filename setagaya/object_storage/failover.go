@@ -0,0 +1,294 @@
+package object_storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	primaryStorage   = 0
+	secondaryStorage = 1
+	// File written and read back to probe the storages
+	healthProbeFilename = "health/probe"
+)
+
+// BackendHealth is the result of the last probe of a storage, or of the last request the storage failed
+type BackendHealth struct {
+	Name        string    `json:"name"`
+	Healthy     bool      `json:"healthy"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastChecked time.Time `json:"last_checked"`
+}
+
+// HealthReport is the health of the storages and the files which are not the same in both of them yet
+type HealthReport struct {
+	Storages []*BackendHealth `json:"storages"`
+	// Files written to or deleted from one storage only. They are repaired when both storages are healthy
+	OutOfSync []string `json:"out_of_sync" classification:"file_metadata"`
+}
+
+// repair is what has to be done to the other storage to bring a file back in sync
+type repair struct {
+	// Storage which has the right version of the file
+	source  int
+	deleted bool
+}
+
+// failoverStorage writes the files to both storages and reads them from the primary storage, from the secondary
+// one when the primary storage fails. A failing storage is skipped until a probe finds it healthy again. The files
+// which could be written to one storage only are kept and copied to the other one by CheckHealth.
+type failoverStorage struct {
+	backends [2]StorageInterface
+	mu       sync.Mutex
+	health   [2]*BackendHealth
+	pending  map[string]repair
+}
+
+func NewFailoverStorage(primary, secondary StorageInterface) StorageInterface {
+	now := time.Now()
+	return &failoverStorage{
+		backends: [2]StorageInterface{primary, secondary},
+		health: [2]*BackendHealth{
+			{Name: "primary", Healthy: true, LastChecked: now},
+			{Name: "secondary", Healthy: true, LastChecked: now},
+		},
+		pending: map[string]repair{},
+	}
+}
+
+func (fs *failoverStorage) markHealth(i int, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	h := fs.health[i]
+	if err != nil && h.Healthy {
+		log.Printf("The %s object storage failed, failing over: %v", h.Name, err)
+	}
+	h.Healthy = err == nil
+	h.LastError = ""
+	if err != nil {
+		h.LastError = err.Error()
+	}
+	h.LastChecked = time.Now()
+}
+
+// order is the storages to read from, the healthy ones first
+func (fs *failoverStorage) order() []int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.health[primaryStorage].Healthy && fs.health[secondaryStorage].Healthy {
+		return []int{secondaryStorage, primaryStorage}
+	}
+	return []int{primaryStorage, secondaryStorage}
+}
+
+func (fs *failoverStorage) setPending(filename string, r *repair) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if r == nil {
+		delete(fs.pending, filename)
+		return
+	}
+	fs.pending[filename] = *r
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, FileNotFoundError())
+}
+
+func (fs *failoverStorage) Upload(filename string, content io.ReadCloser) error {
+	data, err := io.ReadAll(content)
+	content.Close()
+	if err != nil {
+		return err
+	}
+	errs := [2]error{}
+	for i, b := range fs.backends {
+		errs[i] = b.Upload(filename, io.NopCloser(bytes.NewReader(data)))
+		fs.markHealth(i, errs[i])
+	}
+	switch {
+	case errs[primaryStorage] != nil && errs[secondaryStorage] != nil:
+		return errs[primaryStorage]
+	case errs[primaryStorage] != nil:
+		fs.setPending(filename, &repair{source: secondaryStorage})
+	case errs[secondaryStorage] != nil:
+		fs.setPending(filename, &repair{source: primaryStorage})
+	default:
+		fs.setPending(filename, nil)
+	}
+	return nil
+}
+
+func (fs *failoverStorage) Delete(filename string) error {
+	errs := [2]error{}
+	for i, b := range fs.backends {
+		if err := b.Delete(filename); err != nil && !isNotFound(err) {
+			errs[i] = err
+			fs.markHealth(i, err)
+		}
+	}
+	switch {
+	case errs[primaryStorage] != nil && errs[secondaryStorage] != nil:
+		return errs[primaryStorage]
+	case errs[primaryStorage] != nil:
+		fs.setPending(filename, &repair{source: secondaryStorage, deleted: true})
+	case errs[secondaryStorage] != nil:
+		fs.setPending(filename, &repair{source: primaryStorage, deleted: true})
+	default:
+		fs.setPending(filename, nil)
+	}
+	return nil
+}
+
+// Download reads the file from the other storage when the first one fails or does not have it, as it could have
+// been written while the first one was down
+func (fs *failoverStorage) Download(filename string) ([]byte, error) {
+	var firstErr error
+	for _, i := range fs.order() {
+		content, err := fs.backends[i].Download(filename)
+		if err == nil {
+			return content, nil
+		}
+		if !isNotFound(err) {
+			fs.markHealth(i, err)
+		}
+		if firstErr == nil || isNotFound(firstErr) {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// List lists the files of the first healthy storage. The files out of sync are listed by one storage only until they
+// are repaired
+func (fs *failoverStorage) List(prefix string) ([]*ObjectInfo, error) {
+	var firstErr error
+	for _, i := range fs.order() {
+		objects, err := List(fs.backends[i], prefix)
+		if err == nil {
+			return objects, nil
+		}
+		if !errors.Is(err, ErrListUnsupported) {
+			fs.markHealth(i, err)
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+func (fs *failoverStorage) GetUrl(filename string) string {
+	return fs.backends[fs.order()[0]].GetUrl(filename)
+}
+
+// SignedUrl signs the url of the storage the files are read from. When it cannot sign urls, the engines download
+// the files through the failover storage themselves.
+func (fs *failoverStorage) SignedUrl(filename, method string, expiry time.Duration) (string, error) {
+	s, ok := fs.backends[fs.order()[0]].(signer)
+	if !ok {
+		return "", errors.New("the storage the files are read from does not sign urls")
+	}
+	return s.SignedUrl(filename, method, expiry)
+}
+
+func probe(storage StorageInterface) error {
+	content := []byte(time.Now().Format(time.RFC3339Nano))
+	if err := storage.Upload(healthProbeFilename, io.NopCloser(bytes.NewReader(content))); err != nil {
+		return err
+	}
+	read, err := storage.Download(healthProbeFilename)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(read, content) {
+		return fmt.Errorf("the storage returned %d bytes instead of the %d written", len(read), len(content))
+	}
+	return nil
+}
+
+func (fs *failoverStorage) repair(filename string, r repair) error {
+	target := fs.backends[1-r.source]
+	if r.deleted {
+		if err := target.Delete(filename); err != nil && !isNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	content, err := fs.backends[r.source].Download(filename)
+	if isNotFound(err) {
+		// Deleted since, the delete brought it back in sync
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return target.Upload(filename, io.NopCloser(bytes.NewReader(content)))
+}
+
+// CheckHealth probes both storages, then copies the files which are out of sync when both storages are healthy
+func (fs *failoverStorage) CheckHealth() *HealthReport {
+	healthy := true
+	for i, b := range fs.backends {
+		err := probe(b)
+		fs.markHealth(i, err)
+		healthy = healthy && err == nil
+	}
+	if healthy {
+		fs.mu.Lock()
+		pending := make(map[string]repair, len(fs.pending))
+		for filename, r := range fs.pending {
+			pending[filename] = r
+		}
+		fs.mu.Unlock()
+		for filename, r := range pending {
+			if err := fs.repair(filename, r); err != nil {
+				log.Printf("Cannot bring %s back in sync in the object storages: %v", filename, err)
+				continue
+			}
+			fs.mu.Lock()
+			// The file could have been written again while it was repaired
+			if fs.pending[filename] == r {
+				delete(fs.pending, filename)
+			}
+			fs.mu.Unlock()
+		}
+	}
+	return fs.report()
+}
+
+func (fs *failoverStorage) report() *HealthReport {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	r := &HealthReport{Storages: []*BackendHealth{}, OutOfSync: []string{}}
+	for _, h := range fs.health {
+		copied := *h
+		r.Storages = append(r.Storages, &copied)
+	}
+	for filename := range fs.pending {
+		r.OutOfSync = append(r.OutOfSync, filename)
+	}
+	sort.Strings(r.OutOfSync)
+	return r
+}
+
+// CheckHealth probes the storage. With a secondary storage, it also brings the files written to one storage only
+// back in sync.
+func CheckHealth(storage StorageInterface) *HealthReport {
+	if c, ok := storage.(interface{ CheckHealth() *HealthReport }); ok {
+		return c.CheckHealth()
+	}
+	h := &BackendHealth{Name: "primary", Healthy: true, LastChecked: time.Now()}
+	if err := probe(storage); err != nil {
+		h.Healthy = false
+		h.LastError = err.Error()
+	}
+	return &HealthReport{Storages: []*BackendHealth{h}, OutOfSync: []string{}}
+}
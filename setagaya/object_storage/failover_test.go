@@ -0,0 +1,115 @@
+package object_storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailoverStorageReadsFromSecondary(t *testing.T) {
+	primary := NewMockStorage("http://primary")
+	secondary := NewMockStorage("http://secondary")
+	s := NewFailoverStorage(primary, secondary)
+
+	assert.Nil(t, s.Upload("plan/1/test.jmx", content("jmx")))
+	assert.Equal(t, "jmx", string(primary.files["plan/1/test.jmx"]))
+	assert.Equal(t, "jmx", string(secondary.files["plan/1/test.jmx"]))
+	assert.Equal(t, "http://primary/plan/1/test.jmx", s.GetUrl("plan/1/test.jmx"))
+	c, err := s.Download("plan/1/missing.csv")
+	assert.Nil(t, c)
+	assert.ErrorIs(t, err, FileNotFoundError())
+
+	primary.SetDownloadError(errors.New("unavailable"))
+	c, err = s.Download("plan/1/test.jmx")
+	assert.Nil(t, err)
+	assert.Equal(t, "jmx", string(c))
+	assert.Equal(t, "http://secondary/plan/1/test.jmx", s.GetUrl("plan/1/test.jmx"))
+
+	// The primary storage could have the file
+	_, err = s.Download("plan/1/missing.csv")
+	assert.Error(t, err)
+
+	secondary.SetDownloadError(errors.New("unavailable too"))
+	_, err = s.Download("plan/1/test.jmx")
+	assert.EqualError(t, err, "unavailable too")
+}
+
+func TestFailoverStorageList(t *testing.T) {
+	primary := NewMockStorage("http://primary")
+	secondary := NewMockStorage("http://secondary")
+	s := NewFailoverStorage(primary, secondary)
+	assert.Nil(t, s.Upload("plan/1/test.jmx", content("jmx")))
+	assert.Nil(t, secondary.Upload("plan/2/test.jmx", content("jmx")))
+
+	objects, err := List(s, "plan/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+
+	// The secondary storage is listed while the primary one fails
+	primary.SetListError(errors.New("unavailable"))
+	objects, err = List(s, "plan/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+	secondary.SetListError(errors.New("unavailable too"))
+	_, err = List(s, "plan/")
+	assert.Error(t, err)
+}
+
+func TestFailoverStorageReadsFilesMissingFromPrimary(t *testing.T) {
+	primary := NewMockStorage("http://primary")
+	secondary := NewMockStorage("http://secondary")
+	s := NewFailoverStorage(primary, secondary)
+	secondary.files["plan/1/data.csv"] = []byte("a,b")
+
+	c, err := s.Download("plan/1/data.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, "a,b", string(c))
+}
+
+func TestFailoverStorageRepairsOutOfSyncFiles(t *testing.T) {
+	primary := NewMockStorage("http://primary")
+	secondary := NewMockStorage("http://secondary")
+	s := NewFailoverStorage(primary, secondary).(*failoverStorage)
+	secondary.files["plan/1/old.csv"] = []byte("old")
+
+	primary.SetUploadError(errors.New("unavailable"))
+	primary.SetDeleteError(errors.New("unavailable"))
+	assert.Nil(t, s.Upload("plan/1/data.csv", content("a,b")))
+	primary.files["plan/1/old.csv"] = []byte("old")
+	assert.Nil(t, s.Delete("plan/1/old.csv"))
+
+	report := CheckHealth(s)
+	assert.False(t, report.Storages[0].Healthy)
+	assert.True(t, report.Storages[1].Healthy)
+	assert.Equal(t, []string{"plan/1/data.csv", "plan/1/old.csv"}, report.OutOfSync)
+
+	primary.SetUploadError(nil)
+	primary.SetDeleteError(nil)
+	report = CheckHealth(s)
+	assert.True(t, report.Storages[0].Healthy)
+	assert.Empty(t, report.OutOfSync)
+	assert.Equal(t, "a,b", string(primary.files["plan/1/data.csv"]))
+	assert.NotContains(t, primary.files, "plan/1/old.csv")
+}
+
+func TestFailoverStorageFailsWhenBothStoragesFail(t *testing.T) {
+	primary := NewMockStorage("http://primary")
+	secondary := NewMockStorage("http://secondary")
+	s := NewFailoverStorage(primary, secondary)
+	primary.SetUploadError(errors.New("primary unavailable"))
+	secondary.SetUploadError(errors.New("secondary unavailable"))
+	assert.EqualError(t, s.Upload("plan/1/test.jmx", content("jmx")), "primary unavailable")
+}
+
+func TestCheckHealthWithoutSecondary(t *testing.T) {
+	storage := NewMockStorage("http://primary")
+	report := CheckHealth(storage)
+	assert.Len(t, report.Storages, 1)
+	assert.True(t, report.Storages[0].Healthy)
+
+	storage.SetUploadError(errors.New("unavailable"))
+	report = CheckHealth(storage)
+	assert.False(t, report.Storages[0].Healthy)
+	assert.Equal(t, "unavailable", report.Storages[0].LastError)
+}
@@ -217,6 +217,6 @@ func TestStorageProviderConstants_Isolated(t *testing.T) {
 	assert.Equal(t, "local", localStorageProvider)
 
 	// Test the slice
-	expected := []string{"nexus", "gcp", "local"}
+	expected := []string{"nexus", "gcp", "local", "filesystem"}
 	assert.Equal(t, expected, allStorageProvidder)
 }
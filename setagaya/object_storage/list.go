@@ -0,0 +1,41 @@
+package object_storage
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrListUnsupported is returned when the storage cannot list its files, like nexus and the local storage
+var ErrListUnsupported = errors.New("the object storage cannot list its files")
+
+// ObjectInfo is a file of the storage
+type ObjectInfo struct {
+	Name string `json:"name" classification:"file_metadata"`
+	// Region of the storage keeping the file, empty for the default storage
+	Region  string    `json:"region,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+type lister interface {
+	List(prefix string) ([]*ObjectInfo, error)
+}
+
+// List lists the files of the storage whose name starts with the prefix, sorted by name
+func List(storage StorageInterface, prefix string) ([]*ObjectInfo, error) {
+	l, ok := storage.(lister)
+	if !ok {
+		return nil, ErrListUnsupported
+	}
+	objects, err := l.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Name == objects[j].Name {
+			return objects[i].Region < objects[j].Region
+		}
+		return objects[i].Name < objects[j].Name
+	})
+	return objects, nil
+}
@@ -0,0 +1,52 @@
+package object_storage
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// The files of the plans, collections, projects and runs are kept in the region of the tenant owning them
+var regionalFilePattern = regexp.MustCompile(`^(plan|collection|project|run)/(\d+)/`)
+
+// Like the namespace, the region is the one of the first tenant of the owner of the project
+var regionQueries = map[string]string{
+	"project": `select t.storage_region from tenant t join project p on p.owner=t.owner where p.id=?
+		order by t.id limit 1`,
+	"plan": `select t.storage_region from tenant t join project p on p.owner=t.owner
+		join plan pl on pl.project_id=p.id where pl.id=? order by t.id limit 1`,
+	"collection": `select t.storage_region from tenant t join project p on p.owner=t.owner
+		join collection c on c.project_id=p.id where c.id=? order by t.id limit 1`,
+	"run": `select t.storage_region from tenant t join project p on p.owner=t.owner
+		join collection c on c.project_id=p.id join collection_run_history h on h.collection_id=c.id
+		where h.run_id=? order by t.id limit 1`,
+}
+
+// dbRegionRouter finds the tenant owning a file in the database of Setagaya
+type dbRegionRouter struct{}
+
+func (dbRegionRouter) Region(filename string) (string, error) {
+	m := regionalFilePattern.FindStringSubmatch(filename)
+	if m == nil {
+		return "", nil
+	}
+	id, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return "", err
+	}
+	db := config.SC.DBC
+	q, err := db.Prepare(regionQueries[m[1]])
+	if err != nil {
+		return "", err
+	}
+	defer q.Close()
+	var region string
+	err = q.QueryRow(id).Scan(&region)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return region, err
+}
@@ -0,0 +1,210 @@
+package object_storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// RegionRouter tells which region a file is kept in, so the files of the tenants stay in their region
+type RegionRouter interface {
+	// Region returns the region of the file, empty when it's kept in the default storage
+	Region(filename string) (string, error)
+}
+
+// regionalStorage keeps every file in the storage of its region. A file cannot be routed when its region has no
+// storage, it's never written to another region instead. Without a router, like in the engines which have no
+// database, every file is in the default storage and the region has to be given with ForRegion.
+type regionalStorage struct {
+	defaultStorage StorageInterface
+	regions        map[string]StorageInterface
+	router         RegionRouter
+}
+
+func NewRegionalStorage(defaultStorage StorageInterface, regions map[string]StorageInterface, router RegionRouter) StorageInterface {
+	return &regionalStorage{defaultStorage: defaultStorage, regions: regions, router: router}
+}
+
+func (s *regionalStorage) ForRegion(region string) (StorageInterface, error) {
+	if region == "" {
+		return s.defaultStorage, nil
+	}
+	storage, ok := s.regions[region]
+	if !ok {
+		return nil, fmt.Errorf("no object storage is configured for region %s", region)
+	}
+	return storage, nil
+}
+
+func (s *regionalStorage) Region(filename string) (string, error) {
+	if s.router == nil {
+		return "", nil
+	}
+	return s.router.Region(filename)
+}
+
+func (s *regionalStorage) storageOf(filename string) (StorageInterface, error) {
+	region, err := s.Region(filename)
+	if err != nil {
+		return nil, err
+	}
+	return s.ForRegion(region)
+}
+
+func (s *regionalStorage) Upload(filename string, content io.ReadCloser) error {
+	storage, err := s.storageOf(filename)
+	if err != nil {
+		content.Close()
+		return err
+	}
+	return storage.Upload(filename, content)
+}
+
+func (s *regionalStorage) Delete(filename string) error {
+	storage, err := s.storageOf(filename)
+	if err != nil {
+		return err
+	}
+	return storage.Delete(filename)
+}
+
+func (s *regionalStorage) Download(filename string) ([]byte, error) {
+	storage, err := s.storageOf(filename)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Download(filename)
+}
+
+func (s *regionalStorage) GetUrl(filename string) string {
+	storage, err := s.storageOf(filename)
+	if err != nil {
+		log.Printf("Cannot find the region of %s: %v", filename, err)
+		return fmt.Sprintf("/api/files/%s", filename)
+	}
+	return storage.GetUrl(filename)
+}
+
+func (s *regionalStorage) SignedUrl(filename, method string, expiry time.Duration) (string, error) {
+	storage, err := s.storageOf(filename)
+	if err != nil {
+		return "", err
+	}
+	sg, ok := storage.(signer)
+	if !ok {
+		return "", fmt.Errorf("the storage of %s does not sign urls", filename)
+	}
+	return sg.SignedUrl(filename, method, expiry)
+}
+
+func (s *regionalStorage) Locate(filename string) string {
+	storage, err := s.storageOf(filename)
+	if err != nil {
+		return filename
+	}
+	return Locate(storage, filename)
+}
+
+func (s *regionalStorage) Copy(src, dst string) error {
+	srcRegion, err := s.Region(src)
+	if err != nil {
+		return err
+	}
+	dstRegion, err := s.Region(dst)
+	if err != nil {
+		return err
+	}
+	from, err := s.ForRegion(srcRegion)
+	if err != nil {
+		return err
+	}
+	if srcRegion == dstRegion {
+		return Copy(from, src, dst)
+	}
+	to, err := s.ForRegion(dstRegion)
+	if err != nil {
+		return err
+	}
+	content, err := from.Download(src)
+	if err != nil {
+		return err
+	}
+	return to.Upload(dst, io.NopCloser(bytes.NewReader(content)))
+}
+
+// List lists the files of the default storage and of every region, with their region
+func (s *regionalStorage) List(prefix string) ([]*ObjectInfo, error) {
+	objects, err := List(s.defaultStorage, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for region, storage := range s.regions {
+		r, err := List(storage, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list the files of region %s: %w", region, err)
+		}
+		for _, o := range r {
+			o.Region = region
+		}
+		objects = append(objects, r...)
+	}
+	return objects, nil
+}
+
+// CheckHealth probes the default storage and the storage of every region
+func (s *regionalStorage) CheckHealth() *HealthReport {
+	report := CheckHealth(s.defaultStorage)
+	regions := make([]string, 0, len(s.regions))
+	for region := range s.regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	for _, region := range regions {
+		r := CheckHealth(s.regions[region])
+		for _, h := range r.Storages {
+			h.Name = fmt.Sprintf("%s %s", region, h.Name)
+			report.Storages = append(report.Storages, h)
+		}
+		report.OutOfSync = append(report.OutOfSync, r.OutOfSync...)
+	}
+	return report
+}
+
+// ForRegion is the storage of the region. The storage is its own default region when it has no regions
+func ForRegion(storage StorageInterface, region string) (StorageInterface, error) {
+	if r, ok := storage.(interface {
+		ForRegion(region string) (StorageInterface, error)
+	}); ok {
+		return r.ForRegion(region)
+	}
+	if region != "" {
+		return nil, fmt.Errorf("no object storage is configured for region %s", region)
+	}
+	return storage, nil
+}
+
+// Region is the region the file is kept in, empty for the default storage. The engines are sent it as they cannot
+// find it out without the database.
+func Region(storage StorageInterface, filename string) (string, error) {
+	if r, ok := storage.(interface {
+		Region(filename string) (string, error)
+	}); ok {
+		return r.Region(filename)
+	}
+	return "", nil
+}
+
+// HasRegion tells if the files can be kept in the region
+func HasRegion(region string) bool {
+	if region == "" {
+		return true
+	}
+	_, ok := config.SC.ObjectStorage.Regions[region]
+	return ok
+}
@@ -0,0 +1,124 @@
+package object_storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type prefixRouter map[string]string
+
+func (r prefixRouter) Region(filename string) (string, error) {
+	if strings.HasPrefix(filename, "broken/") {
+		return "", errors.New("database is down")
+	}
+	for prefix, region := range r {
+		if strings.HasPrefix(filename, prefix) {
+			return region, nil
+		}
+	}
+	return "", nil
+}
+
+func TestRegionalStorageRoutesFiles(t *testing.T) {
+	defaultStorage := NewMockStorage("http://default")
+	eu := NewMockStorage("http://eu")
+	s := NewRegionalStorage(defaultStorage, map[string]StorageInterface{"eu": eu},
+		prefixRouter{"plan/1/": "eu", "plan/2/": "us"})
+
+	assert.Nil(t, s.Upload("plan/1/test.jmx", content("eu")))
+	assert.Nil(t, s.Upload("plan/3/test.jmx", content("default")))
+	assert.Equal(t, "eu", string(eu.files["plan/1/test.jmx"]))
+	assert.NotContains(t, defaultStorage.files, "plan/1/test.jmx")
+	assert.Equal(t, "default", string(defaultStorage.files["plan/3/test.jmx"]))
+	assert.Equal(t, "http://eu/plan/1/test.jmx", s.GetUrl("plan/1/test.jmx"))
+
+	c, err := s.Download("plan/1/test.jmx")
+	assert.Nil(t, err)
+	assert.Equal(t, "eu", string(c))
+
+	// The files are never written to another region
+	assert.NotNil(t, s.Upload("plan/2/test.jmx", content("us")))
+	assert.NotNil(t, s.Upload("broken/test.jmx", content("unknown")))
+	assert.NotContains(t, defaultStorage.files, "plan/2/test.jmx")
+	assert.NotContains(t, defaultStorage.files, "broken/test.jmx")
+
+	assert.Nil(t, s.Delete("plan/1/test.jmx"))
+	assert.NotContains(t, eu.files, "plan/1/test.jmx")
+}
+
+func TestRegionalStorageList(t *testing.T) {
+	defaultStorage := NewMockStorage("http://default")
+	eu := NewMockStorage("http://eu")
+	s := NewRegionalStorage(defaultStorage, map[string]StorageInterface{"eu": eu}, prefixRouter{"plan/1/": "eu"})
+	assert.Nil(t, s.Upload("plan/1/test.jmx", content("eu")))
+	assert.Nil(t, s.Upload("plan/3/test.jmx", content("default")))
+	assert.Nil(t, s.Upload("collection/3/users.csv", content("default")))
+
+	objects, err := List(s, "plan/")
+	assert.NoError(t, err)
+	assert.Equal(t, []*ObjectInfo{{Name: "plan/1/test.jmx", Region: "eu"}, {Name: "plan/3/test.jmx"}}, objects)
+
+	// A storage which cannot list its files
+	_, err = List(NewRegionalStorage(defaultStorage, map[string]StorageInterface{"eu": localStorage{}}, nil), "plan/")
+	assert.ErrorIs(t, err, ErrListUnsupported)
+}
+
+func TestRegionalStorageCopiesAcrossRegions(t *testing.T) {
+	defaultStorage := NewMockStorage("http://default")
+	eu := NewMockStorage("http://eu")
+	s := NewRegionalStorage(defaultStorage, map[string]StorageInterface{"eu": eu}, prefixRouter{"plan/1/": "eu"})
+	assert.Nil(t, s.Upload("plan/3/data.csv", content("a,b")))
+
+	assert.Nil(t, Copy(s, "plan/3/data.csv", "plan/1/data.csv"))
+	assert.Equal(t, "a,b", string(eu.files["plan/1/data.csv"]))
+	assert.Nil(t, Copy(s, "plan/3/data.csv", "plan/4/data.csv"))
+	assert.Equal(t, "a,b", string(defaultStorage.files["plan/4/data.csv"]))
+}
+
+func TestForRegion(t *testing.T) {
+	defaultStorage := NewMockStorage("http://default")
+	eu := NewMockStorage("http://eu")
+	// The engines have no router, the region is given by the controller
+	s := NewRegionalStorage(defaultStorage, map[string]StorageInterface{"eu": eu}, nil)
+
+	region, err := Region(s, "plan/1/test.jmx")
+	assert.Nil(t, err)
+	assert.Equal(t, "", region)
+	storage, err := ForRegion(s, "eu")
+	assert.Nil(t, err)
+	assert.Equal(t, eu, storage)
+	storage, err = ForRegion(s, "")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultStorage, storage)
+	_, err = ForRegion(s, "us")
+	assert.NotNil(t, err)
+
+	storage, err = ForRegion(defaultStorage, "")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultStorage, storage)
+	_, err = ForRegion(defaultStorage, "eu")
+	assert.NotNil(t, err)
+}
+
+func TestRegionalFilePattern(t *testing.T) {
+	for filename, expected := range map[string][]string{
+		"plan/12/test.jmx":             {"plan", "12"},
+		"collection/3/data.csv":        {"collection", "3"},
+		"project/4/users.csv":          {"project", "4"},
+		"run/99/failures-1-0.json":     {"run", "99"},
+		"blobs/sha256/0123456789abcde": nil,
+		"health/probe":                 nil,
+		"plan/abc/test.jmx":            nil,
+	} {
+		m := regionalFilePattern.FindStringSubmatch(filename)
+		if expected == nil {
+			assert.Nil(t, m, filename)
+			continue
+		}
+		assert.Equal(t, expected, m[1:], filename)
+		assert.Contains(t, regionQueries, m[1])
+	}
+}
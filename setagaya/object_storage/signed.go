@@ -0,0 +1,41 @@
+package object_storage
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// signer is a storage signing urls, which give access to a file for a while without the credentials of the storage
+type signer interface {
+	SignedUrl(filename, method string, expiry time.Duration) (string, error)
+}
+
+func signedUrl(storage StorageInterface, filename, method string) string {
+	expiry := config.SC.ObjectStorage.SignedURLExpiry()
+	s, ok := storage.(signer)
+	if !ok || expiry == 0 {
+		return ""
+	}
+	url, err := s.SignedUrl(filename, method, expiry)
+	if err != nil {
+		log.Printf("Cannot sign the url of %s: %v", filename, err)
+		return ""
+	}
+	return url
+}
+
+// SignedUrl is a url downloading the file without the credentials of the storage. It's empty when the storage
+// does not sign the urls.
+func SignedUrl(storage StorageInterface, filename string) string {
+	return signedUrl(storage, filename, http.MethodGet)
+}
+
+// SignedUploadUrl is a url uploading the file with a PUT without the credentials of the storage. It's empty when
+// the storage does not sign the urls.
+func SignedUploadUrl(storage StorageInterface, filename string) string {
+	return signedUrl(storage, filename, http.MethodPut)
+}
@@ -0,0 +1,122 @@
+package object_storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+// filesystemStorage keeps the files in a folder of the machine. The engines download them from the api, which
+// serves the folder with Handler.
+type filesystemStorage struct {
+	root string
+	url  string
+}
+
+func NewFilesystemStorage(o *config.ObjectStorage) filesystemStorage {
+	return filesystemStorage{
+		root: o.Path,
+		url:  o.Url,
+	}
+}
+
+// path keeps the file within the root folder
+func (f filesystemStorage) path(filename string) (string, error) {
+	p := filepath.Join(f.root, filepath.FromSlash(filename))
+	if !strings.HasPrefix(p, filepath.Clean(f.root)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid filename %s", filename)
+	}
+	return p, nil
+}
+
+func (f filesystemStorage) GetUrl(filename string) string {
+	return fmt.Sprintf("%s/%s", f.url, filename)
+}
+
+func (f filesystemStorage) Upload(filename string, content io.ReadCloser) error {
+	defer content.Close()
+	p, err := f.path(filename)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, content); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (f filesystemStorage) Delete(filename string) error {
+	p, err := f.path(filename)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); errors.Is(err, fs.ErrNotExist) {
+		return FileNotFoundError()
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f filesystemStorage) Download(filename string) ([]byte, error) {
+	p, err := f.path(filename)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, FileNotFoundError()
+	}
+	return b, err
+}
+
+func (f filesystemStorage) List(prefix string) ([]*ObjectInfo, error) {
+	objects := []*ObjectInfo{}
+	err := filepath.WalkDir(f.root, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == f.root {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(f.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, &ObjectInfo{Name: name, Updated: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
+
+// Handler serves the files of the filesystem storage, nil when the platform uses another storage
+func Handler() http.Handler {
+	fs, ok := Client.Storage.(filesystemStorage)
+	if !ok {
+		return nil
+	}
+	return http.FileServer(http.Dir(fs.root))
+}
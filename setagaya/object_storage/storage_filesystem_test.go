@@ -0,0 +1,46 @@
+package object_storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilesystemStorage(t *testing.T) {
+	fs := filesystemStorage{root: t.TempDir(), url: "http://host.docker.internal:8080/storage"}
+	assert.Equal(t, "http://host.docker.internal:8080/storage/plan/1/test.jmx", fs.GetUrl("plan/1/test.jmx"))
+
+	assert.NoError(t, fs.Upload("plan/1/test.jmx", io.NopCloser(strings.NewReader("jmx"))))
+	b, err := fs.Download("plan/1/test.jmx")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("jmx"), b)
+
+	assert.NoError(t, fs.Delete("plan/1/test.jmx"))
+	_, err = fs.Download("plan/1/test.jmx")
+	assert.Equal(t, FileNotFoundError(), err)
+	assert.Equal(t, FileNotFoundError(), fs.Delete("plan/1/test.jmx"))
+
+	// The files are kept in the root folder
+	assert.Error(t, fs.Upload("../escape", io.NopCloser(strings.NewReader("jmx"))))
+	_, err = fs.Download("../../etc/passwd")
+	assert.Error(t, err)
+}
+
+func TestFilesystemStorageList(t *testing.T) {
+	fs := filesystemStorage{root: t.TempDir()}
+	for _, filename := range []string{"plan/1/test.jmx", "plan/1/users.csv", "run/7/failures-1-0.json"} {
+		assert.NoError(t, fs.Upload(filename, io.NopCloser(strings.NewReader("content"))))
+	}
+	objects, err := List(fs, "plan/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 2)
+	assert.Equal(t, "plan/1/test.jmx", objects[0].Name)
+	assert.False(t, objects[0].Updated.IsZero())
+
+	// The folder is created with the first file
+	objects, err = List(filesystemStorage{root: t.TempDir() + "/missing"}, "plan/")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+}
@@ -2,9 +2,10 @@ package object_storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -13,61 +14,73 @@ import (
 
 	"cloud.google.com/go/storage"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 
 	"github.com/hveda/Setagaya/setagaya/config"
 )
 
+// gcpStorage creates its client on first use, so the engines downloading the files through signed urls can run
+// without the credentials of the bucket
 type gcpStorage struct {
-	client *storage.Client
-	ctx    context.Context
-	bucket string
+	ctx          context.Context
+	bucket       string
+	requireProxy bool
+	once         sync.Once
+	client       *storage.Client
+	clientErr    error
 }
 
-func NewGcpStorage() *gcpStorage {
+func NewGcpStorage(o *config.ObjectStorage) *gcpStorage {
 	ctx := context.Background()
-	if config.SC.ObjectStorage.RequireProxy {
+	if o.RequireProxy {
 		// GCP's storage client needs OAuth2 token
 		// The golang/oauth2 lib relies on the httpClient passed in it's context to make http calls
 		log.Info("Setting up GCP OAuth client with proxy")
 		ctx = context.WithValue(context.Background(), oauth2.HTTPClient, config.SC.HTTPProxyClient)
 	}
 	return &gcpStorage{
-		client: newStorageClient(ctx),
-		ctx:    ctx,
-		bucket: config.SC.ObjectStorage.Bucket,
+		ctx:          ctx,
+		bucket:       o.Bucket,
+		requireProxy: o.RequireProxy,
 	}
 }
 
-func newStorageClient(ctx context.Context) *storage.Client {
+func (gs *gcpStorage) bucketHandle() (*storage.BucketHandle, error) {
+	gs.once.Do(func() {
+		gs.client, gs.clientErr = newStorageClient(gs.ctx, gs.requireProxy)
+	})
+	if gs.clientErr != nil {
+		return nil, gs.clientErr
+	}
+	return gs.client.Bucket(gs.bucket), nil
+}
+
+func newStorageClient(ctx context.Context, requireProxy bool) (*storage.Client, error) {
 	// in order to use proxy we need to supply our own http.Client
 	// But a new http.Client from net/http will not authenticate with gcp
 	// And for gcp's http.Client it also needs to know scope before setting up auth
 	// This will change with - https://github.com/googleapis/google-cloud-go/issues/1962
 	creds, err := google.FindDefaultCredentials(ctx, storage.ScopeFullControl)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	hc, _, err := htransport.NewClient(ctx, option.WithCredentials(creds))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	if config.SC.ObjectStorage.RequireProxy {
+	if requireProxy {
 		log.Info("Setting up GCP storage client with proxy")
 		baseTransportWithProxy, transportErr := htransport.NewTransport(ctx, config.SC.HTTPProxyClient.Transport,
 			option.WithCredentials(creds))
 		if transportErr != nil {
-			log.Fatal(transportErr)
+			return nil, transportErr
 		}
 		if transport, ok := hc.Transport.(*oauth2.Transport); ok {
 			transport.Base = baseTransportWithProxy
 		}
 	}
-	client, err := storage.NewClient(ctx, option.WithHTTPClient(hc))
-	if err != nil {
-		log.Fatal(err)
-	}
-	return client
+	return storage.NewClient(ctx, option.WithHTTPClient(hc))
 }
 
 func (gs *gcpStorage) Upload(filename string, content io.ReadCloser) error {
@@ -75,7 +88,11 @@ func (gs *gcpStorage) Upload(filename string, content io.ReadCloser) error {
 	ctx, cancel := context.WithTimeout(gs.ctx, time.Minute*30)
 	defer cancel()
 
-	wc := gs.client.Bucket(gs.bucket).Object(filename).NewWriter(ctx)
+	bucket, err := gs.bucketHandle()
+	if err != nil {
+		return err
+	}
+	wc := bucket.Object(filename).NewWriter(ctx)
 	if _, err := io.Copy(wc, content); err != nil {
 		log.Print(err)
 		return err
@@ -90,21 +107,44 @@ func (gs *gcpStorage) Delete(filename string) error {
 	ctx, cancel := context.WithTimeout(gs.ctx, time.Second*10)
 	defer cancel()
 
-	if err := gs.client.Bucket(gs.bucket).Object(filename).Delete(ctx); err != nil {
+	bucket, err := gs.bucketHandle()
+	if err != nil {
+		return err
+	}
+	if err := bucket.Object(filename).Delete(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (gs *gcpStorage) GetUrl(filename string) string {
+	if url := SignedUrl(gs, filename); url != "" {
+		return url
+	}
 	return fmt.Sprintf("/api/files/%s", filename)
 }
 
+func (gs *gcpStorage) SignedUrl(filename, method string, expiry time.Duration) (string, error) {
+	bucket, err := gs.bucketHandle()
+	if err != nil {
+		return "", err
+	}
+	return bucket.SignedURL(filename, &storage.SignedURLOptions{
+		Scheme:  storage.SigningSchemeV4,
+		Method:  method,
+		Expires: time.Now().Add(expiry),
+	})
+}
+
 func (gs *gcpStorage) Download(filename string) ([]byte, error) {
 	// Need long timeout for downloading large files
 	ctx, cancel := context.WithTimeout(gs.ctx, time.Minute*30)
 	defer cancel()
-	rc, err := gs.client.Bucket(gs.bucket).Object(filename).NewReader(ctx)
+	bucket, err := gs.bucketHandle()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := bucket.Object(filename).NewReader(ctx)
 	if err != nil {
 		return nil, gs.IfFileNotFoundWrapper(err)
 	}
@@ -120,8 +160,29 @@ func (gs *gcpStorage) Download(filename string) ([]byte, error) {
 	return data, nil
 }
 
+func (gs *gcpStorage) List(prefix string) ([]*ObjectInfo, error) {
+	ctx, cancel := context.WithTimeout(gs.ctx, time.Minute*10)
+	defer cancel()
+	bucket, err := gs.bucketHandle()
+	if err != nil {
+		return nil, err
+	}
+	objects := []*ObjectInfo{}
+	it := bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, &ObjectInfo{Name: attrs.Name, Updated: attrs.Updated})
+	}
+}
+
 func (gs *gcpStorage) IfFileNotFoundWrapper(err error) error {
-	if strings.Contains(err.Error(), "object doesn't exist") {
+	if errors.Is(err, storage.ErrObjectNotExist) {
 		return FileNotFoundError()
 	}
 	return err
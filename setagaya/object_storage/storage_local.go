@@ -16,9 +16,8 @@ type localStorage struct {
 	url string
 }
 
-func NewLocalStorage() localStorage {
+func NewLocalStorage(o *config.ObjectStorage) localStorage {
 	ls := new(localStorage)
-	o := config.SC.ObjectStorage
 	ls.url = o.Url
 	return *ls
 }
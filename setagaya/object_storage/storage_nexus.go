@@ -16,9 +16,8 @@ type nexusStorage struct {
 	password string
 }
 
-func NewNexusStorage() nexusStorage {
+func NewNexusStorage(o *config.ObjectStorage) nexusStorage {
 	ns := new(nexusStorage)
-	o := config.SC.ObjectStorage
 	ns.nexusURL = o.Url
 	ns.username = o.User
 	ns.password = o.Password
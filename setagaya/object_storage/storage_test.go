@@ -48,6 +48,7 @@ type MockStorage struct {
 	uploadError   error
 	deleteError   error
 	downloadError error
+	listError     error
 }
 
 func NewMockStorage(baseURL string) *MockStorage {
@@ -102,6 +103,19 @@ func (m *MockStorage) Download(filename string) ([]byte, error) {
 	return data, nil
 }
 
+func (m *MockStorage) List(prefix string) ([]*ObjectInfo, error) {
+	if m.listError != nil {
+		return nil, m.listError
+	}
+	objects := []*ObjectInfo{}
+	for filename := range m.files {
+		if strings.HasPrefix(filename, prefix) {
+			objects = append(objects, &ObjectInfo{Name: filename})
+		}
+	}
+	return objects, nil
+}
+
 // SetErrors allows setting errors for testing error conditions
 func (m *MockStorage) SetUploadError(err error) {
 	m.uploadError = err
@@ -115,6 +129,10 @@ func (m *MockStorage) SetDownloadError(err error) {
 	m.downloadError = err
 }
 
+func (m *MockStorage) SetListError(err error) {
+	m.listError = err
+}
+
 func TestMockStorageImplementsInterface(t *testing.T) {
 	// Test that MockStorage implements StorageInterface
 	var storage StorageInterface = NewMockStorage("http://test.com")
@@ -0,0 +1,367 @@
+package operator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// The path Argo Workflows calls the executor plugins on
+	ArgoExecutePath = "/api/v1/template.execute"
+	// The token Argo authenticates its calls with, mounted in the sidecar of the plugin
+	ArgoTokenPath = "/var/run/argo/token"
+	// The key of the plugin in the plugin templates of the workflows
+	argoPluginName = "setagaya"
+	argoRequeue    = 10 * time.Second
+)
+
+// ArgoStep is the plugin template of a workflow step running a collection
+type ArgoStep struct {
+	CollectionID int64             `json:"collectionID"`
+	Parameters   map[string]string `json:"parameters,omitempty"`
+	// Keeps the engines deployed after the run, for the next steps
+	KeepEngines bool `json:"keepEngines,omitempty"`
+	SLO         *SLO `json:"slo,omitempty"`
+}
+
+// SLO is the service level objectives the run of a step must meet. The latencies are in milliseconds.
+// The objectives left out are not checked.
+type SLO struct {
+	P50 *float64 `json:"p50,omitempty"`
+	P90 *float64 `json:"p90,omitempty"`
+	P95 *float64 `json:"p95,omitempty"`
+	P99 *float64 `json:"p99,omitempty"`
+	// Highest ratio of the samples failing their assertions, between 0 and 1
+	AssertionFailureRate *float64 `json:"assertionFailureRate,omitempty"`
+}
+
+// SLOResult is the outcome of an objective of a run
+type SLOResult struct {
+	Objective string  `json:"objective"`
+	Threshold float64 `json:"threshold"`
+	Value     float64 `json:"value"`
+	Passed    bool    `json:"passed"`
+}
+
+// assertionFailureRate is the ratio of the samples of the run that failed their assertions
+func (rs *apiRunSummary) assertionFailureRate() float64 {
+	var samples, failed uint64
+	for _, la := range rs.Assertions {
+		samples += la.Samples
+		failed += la.Failed
+	}
+	if samples == 0 {
+		return 0
+	}
+	return float64(failed) / float64(samples)
+}
+
+// evaluate checks the summary of the run against the objectives
+func (slo *SLO) evaluate(rs *apiRunSummary) []*SLOResult {
+	if slo == nil {
+		return nil
+	}
+	results := []*SLOResult{}
+	for _, o := range []struct {
+		name      string
+		threshold *float64
+		value     float64
+	}{
+		{"p50", slo.P50, rs.P50},
+		{"p90", slo.P90, rs.P90},
+		{"p95", slo.P95, rs.P95},
+		{"p99", slo.P99, rs.P99},
+		{"assertionFailureRate", slo.AssertionFailureRate, rs.assertionFailureRate()},
+	} {
+		if o.threshold == nil {
+			continue
+		}
+		results = append(results, &SLOResult{
+			Objective: o.name,
+			Threshold: *o.threshold,
+			Value:     o.value,
+			Passed:    o.value <= *o.threshold,
+		})
+	}
+	return results
+}
+
+// The types below are the part of the executor plugin protocol of Argo Workflows the plugin uses
+
+type argoExecuteArgs struct {
+	Workflow struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			UID       string `json:"uid"`
+		} `json:"metadata"`
+	} `json:"workflow"`
+	Template struct {
+		Name   string                     `json:"name"`
+		Plugin map[string]json.RawMessage `json:"plugin"`
+	} `json:"template"`
+}
+
+type argoParameter struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type argoOutputs struct {
+	Parameters []*argoParameter `json:"parameters,omitempty"`
+}
+
+type argoNodeResult struct {
+	Phase   string       `json:"phase"`
+	Message string       `json:"message"`
+	Outputs *argoOutputs `json:"outputs,omitempty"`
+}
+
+type argoExecuteReply struct {
+	Node    *argoNodeResult `json:"node,omitempty"`
+	Requeue string          `json:"requeue,omitempty"`
+}
+
+const (
+	argoRunning   = "Running"
+	argoSucceeded = "Succeeded"
+	argoFailed    = "Failed"
+)
+
+// argoStepState is how far a step got. Argo calls the plugin again until the step ends.
+type argoStepState struct {
+	mu           sync.Mutex
+	deployedTime time.Time
+	runID        int64
+	result       *argoNodeResult
+}
+
+// ArgoPlugin is an executor plugin of Argo Workflows running the collections of the steps. It runs as a sidecar
+// of the agent pod of a workflow and keeps the state of its steps while the workflow runs: a step deploys the
+// engines of its collection, triggers a run once they are reachable and waits for it to end. The figures of the run
+// and its SLO results are the outputs of the step, which fails when an objective is not met.
+type ArgoPlugin struct {
+	api   *APIClient
+	token string
+	now   func() time.Time
+	mu    sync.Mutex
+	steps map[string]*argoStepState
+}
+
+// NewArgoPlugin returns the plugin. token authenticates the calls of Argo, it's not checked when it's empty.
+func NewArgoPlugin(api *APIClient, token string) *ArgoPlugin {
+	return &ArgoPlugin{api: api, token: token, now: time.Now, steps: map[string]*argoStepState{}}
+}
+
+// ReadArgoToken reads the token Argo mounts in the sidecars of the plugins, empty when there is none
+func ReadArgoToken() (string, error) {
+	b, err := os.ReadFile(ArgoTokenPath)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// argoStepKey identifies a step across the calls. The template is part of it, so the iterations of a loop, whose
+// templates differ, are different steps. It's also the idempotency key of the trigger of the step.
+func argoStepKey(args *argoExecuteArgs, step json.RawMessage) string {
+	sum := sha256.Sum256(append([]byte(args.Template.Name+"\n"), step...))
+	return "argo-" + args.Workflow.Metadata.UID + "-" + hex.EncodeToString(sum[:8])
+}
+
+func (p *ArgoPlugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != ArgoExecutePath {
+		http.NotFound(w, r)
+		return
+	}
+	if p.token != "" && r.Header.Get("Authorization") != "Bearer "+p.token {
+		http.Error(w, "invalid token", http.StatusForbidden)
+		return
+	}
+	args := new(argoExecuteArgs)
+	if err := json.NewDecoder(r.Body).Decode(args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	raw, ok := args.Template.Plugin[argoPluginName]
+	// Argo tries the next plugin
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	reply := &argoExecuteReply{}
+	step := new(ArgoStep)
+	if err := json.Unmarshal(raw, step); err != nil || step.CollectionID == 0 {
+		reply.Node = &argoNodeResult{Phase: argoFailed, Message: "invalid setagaya step: collectionID is required"}
+	} else {
+		reply.Node = p.execute(r.Context(), argoStepKey(args, raw), step)
+		if reply.Node.Phase == argoRunning {
+			reply.Requeue = argoRequeue.String()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reply); err != nil {
+		log.Errorf("Cannot reply to argo: %v", err)
+	}
+}
+
+func (p *ArgoPlugin) state(key string) *argoStepState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.steps[key]
+	if !ok {
+		s = new(argoStepState)
+		p.steps[key] = s
+	}
+	return s
+}
+
+// execute moves the step along
+func (p *ArgoPlugin) execute(ctx context.Context, key string, step *ArgoStep) *argoNodeResult {
+	s := p.state(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.result != nil {
+		return s.result
+	}
+	result, err := p.advance(ctx, key, s, step)
+	if err != nil {
+		// The API could not be reached, the step is tried again
+		log.Warnf("Cannot run setagaya step of collection %d: %v", step.CollectionID, err)
+		return &argoNodeResult{Phase: argoRunning, Message: err.Error()}
+	}
+	if result.Phase != argoRunning {
+		if s.runID != 0 || !s.deployedTime.IsZero() {
+			p.purgeEngines(ctx, step)
+		}
+		s.result = result
+	}
+	return result
+}
+
+func (p *ArgoPlugin) advance(ctx context.Context, key string, s *argoStepState, step *ArgoStep) (*argoNodeResult, error) {
+	if s.runID != 0 {
+		return p.follow(ctx, s, step)
+	}
+	cs, err := p.api.collectionStatus(ctx, step.CollectionID)
+	if isAPIError(err) {
+		return &argoNodeResult{Phase: argoFailed, Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cs.reachable() {
+		run, err := p.api.trigger(ctx, step.CollectionID, step.Parameters, key)
+		if isAPIError(err) {
+			return &argoNodeResult{Phase: argoFailed, Message: err.Error()}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.runID = run.ID
+		return &argoNodeResult{Phase: argoRunning, Message: fmt.Sprintf("run %d started", run.ID)}, nil
+	}
+	if s.deployedTime.IsZero() {
+		// The engines of another step may already be deploying
+		if !cs.deployed() {
+			if err := p.api.deploy(ctx, step.CollectionID); err != nil {
+				if isAPIError(err) {
+					return &argoNodeResult{Phase: argoFailed, Message: err.Error()}, nil
+				}
+				return nil, err
+			}
+		}
+		s.deployedTime = p.now()
+	}
+	if p.now().Sub(s.deployedTime) > deployTimeout {
+		return &argoNodeResult{Phase: argoFailed,
+			Message: fmt.Sprintf("the engines are not reachable after %s", deployTimeout)}, nil
+	}
+	return &argoNodeResult{Phase: argoRunning, Message: "deploying the engines"}, nil
+}
+
+func (p *ArgoPlugin) follow(ctx context.Context, s *argoStepState, step *ArgoStep) (*argoNodeResult, error) {
+	run, err := p.api.getRun(ctx, step.CollectionID, s.runID)
+	if isAPIError(err) {
+		return &argoNodeResult{Phase: argoFailed, Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if run.EndTime.IsZero() {
+		return &argoNodeResult{Phase: argoRunning, Message: fmt.Sprintf("run %d in progress", run.ID)}, nil
+	}
+	return runResult(run, step.SLO), nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// runResult makes the outputs of the step out of the figures of the run and checks its objectives
+func runResult(run *apiRun, slo *SLO) *argoNodeResult {
+	params := []*argoParameter{{Name: "run-id", Value: strconv.FormatInt(run.ID, 10)}}
+	if run.Summary == nil {
+		if slo != nil {
+			return &argoNodeResult{Phase: argoFailed, Message: fmt.Sprintf("run %d has no samples", run.ID),
+				Outputs: &argoOutputs{Parameters: append(params, &argoParameter{Name: "slo-passed", Value: "false"})}}
+		}
+		return &argoNodeResult{Phase: argoSucceeded, Message: fmt.Sprintf("run %d finished without samples", run.ID),
+			Outputs: &argoOutputs{Parameters: params}}
+	}
+	rs := run.Summary
+	params = append(params,
+		&argoParameter{Name: "samples", Value: strconv.FormatUint(rs.Samples, 10)},
+		&argoParameter{Name: "mean", Value: formatFloat(rs.Mean)},
+		&argoParameter{Name: "p50", Value: formatFloat(rs.P50)},
+		&argoParameter{Name: "p90", Value: formatFloat(rs.P90)},
+		&argoParameter{Name: "p95", Value: formatFloat(rs.P95)},
+		&argoParameter{Name: "p99", Value: formatFloat(rs.P99)},
+		&argoParameter{Name: "assertion-failure-rate", Value: formatFloat(rs.assertionFailureRate())},
+	)
+	results := slo.evaluate(rs)
+	breached := []string{}
+	for _, r := range results {
+		if !r.Passed {
+			breached = append(breached, fmt.Sprintf("%s %s > %s", r.Objective, formatFloat(r.Value),
+				formatFloat(r.Threshold)))
+		}
+	}
+	if results != nil {
+		raw, _ := json.Marshal(results)
+		params = append(params,
+			&argoParameter{Name: "slo-passed", Value: strconv.FormatBool(len(breached) == 0)},
+			&argoParameter{Name: "slo-results", Value: string(raw)},
+		)
+	}
+	result := &argoNodeResult{Phase: argoSucceeded, Message: fmt.Sprintf("run %d finished", run.ID),
+		Outputs: &argoOutputs{Parameters: params}}
+	if len(breached) > 0 {
+		result.Phase = argoFailed
+		result.Message = fmt.Sprintf("run %d breached its SLO: %s", run.ID, strings.Join(breached, ", "))
+	}
+	return result
+}
+
+func (p *ArgoPlugin) purgeEngines(ctx context.Context, step *ArgoStep) {
+	if step.KeepEngines {
+		return
+	}
+	if err := p.api.purge(ctx, step.CollectionID); err != nil {
+		log.Warnf("Cannot purge the engines of collection %d: %v", step.CollectionID, err)
+	}
+}
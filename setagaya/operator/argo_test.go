@@ -0,0 +1,119 @@
+package operator
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestArgoPlugin(t *testing.T) (*ArgoPlugin, *fakeAPI) {
+	api := new(fakeAPI)
+	s := httptest.NewServer(api)
+	t.Cleanup(s.Close)
+	c, err := NewAPIClient(s.URL, "", "")
+	assert.Nil(t, err)
+	return NewArgoPlugin(c, "token"), api
+}
+
+func executeArgoStep(t *testing.T, p *ArgoPlugin, plugin map[string]interface{}) (int, *argoExecuteReply) {
+	body, err := json.Marshal(map[string]interface{}{
+		"workflow": map[string]interface{}{"metadata": map[string]string{"name": "release", "uid": "4f2c"}},
+		"template": map[string]interface{}{"name": "load-test", "plugin": plugin},
+	})
+	assert.Nil(t, err)
+	req := httptest.NewRequest(http.MethodPost, ArgoExecutePath, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+	reply := new(argoExecuteReply)
+	if rr.Code == http.StatusOK {
+		assert.Nil(t, json.NewDecoder(rr.Body).Decode(reply))
+	}
+	return rr.Code, reply
+}
+
+func TestArgoPluginRunsStep(t *testing.T) {
+	p, api := newTestArgoPlugin(t)
+	api.summary = map[string]interface{}{
+		"samples": 1000, "p50": 120, "p90": 300, "p95": 450, "p99": 900,
+		"assertions": map[string]interface{}{"home": map[string]int{"samples": 1000, "failed": 20}},
+	}
+	step := map[string]interface{}{"setagaya": map[string]interface{}{
+		"collectionID": 7,
+		"slo":          map[string]float64{"p95": 500, "assertionFailureRate": 0.01},
+	}}
+
+	code, reply := executeArgoStep(t, p, step)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, argoRunning, reply.Node.Phase)
+	assert.Equal(t, "10s", reply.Requeue)
+	assert.True(t, api.called("POST /api/collections/7/deploy"))
+
+	api.reachable = true
+	_, reply = executeArgoStep(t, p, step)
+	assert.Equal(t, argoRunning, reply.Node.Phase)
+	assert.Equal(t, "run 3 started", reply.Node.Message)
+	if assert.Len(t, api.keys, 1) {
+		assert.Contains(t, api.keys[0], "argo-4f2c-")
+	}
+
+	_, reply = executeArgoStep(t, p, step)
+	assert.Equal(t, argoRunning, reply.Node.Phase)
+	api.ended = true
+	_, reply = executeArgoStep(t, p, step)
+	assert.Equal(t, argoFailed, reply.Node.Phase)
+	assert.Equal(t, "run 3 breached its SLO: assertionFailureRate 0.02 > 0.01", reply.Node.Message)
+	assert.Empty(t, reply.Requeue)
+	outputs := map[string]string{}
+	for _, param := range reply.Node.Outputs.Parameters {
+		outputs[param.Name] = param.Value
+	}
+	assert.Equal(t, "3", outputs["run-id"])
+	assert.Equal(t, "450", outputs["p95"])
+	assert.Equal(t, "false", outputs["slo-passed"])
+	results := []*SLOResult{}
+	assert.Nil(t, json.Unmarshal([]byte(outputs["slo-results"]), &results))
+	assert.Len(t, results, 2)
+	assert.True(t, api.called("POST /api/collections/7/purge"))
+
+	// The result is kept for the calls of Argo that follow
+	_, again := executeArgoStep(t, p, step)
+	assert.Equal(t, reply, again)
+	assert.Len(t, api.keys, 1)
+}
+
+func TestArgoPluginDeployTimeout(t *testing.T) {
+	p, _ := newTestArgoPlugin(t)
+	step := map[string]interface{}{"setagaya": map[string]interface{}{"collectionID": 7, "keepEngines": true}}
+	executeArgoStep(t, p, step)
+	p.now = func() time.Time { return time.Now().Add(deployTimeout + time.Minute) }
+	_, reply := executeArgoStep(t, p, step)
+	assert.Equal(t, argoFailed, reply.Node.Phase)
+}
+
+func TestArgoPluginIgnoresOtherTemplates(t *testing.T) {
+	p, _ := newTestArgoPlugin(t)
+	code, _ := executeArgoStep(t, p, map[string]interface{}{"slack": map[string]string{"text": "done"}})
+	assert.Equal(t, http.StatusNotFound, code)
+
+	_, reply := executeArgoStep(t, p, map[string]interface{}{"setagaya": map[string]string{}})
+	assert.Equal(t, argoFailed, reply.Node.Phase)
+
+	req := httptest.NewRequest(http.MethodPost, ArgoExecutePath, bytes.NewReader([]byte("{}")))
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestSLOEvaluate(t *testing.T) {
+	var none *SLO
+	assert.Nil(t, none.evaluate(&apiRunSummary{}))
+	p99 := 1000.0
+	results := (&SLO{P99: &p99}).evaluate(&apiRunSummary{P99: 1000})
+	assert.Equal(t, []*SLOResult{{Objective: "p99", Threshold: 1000, Value: 1000, Passed: true}}, results)
+}
@@ -0,0 +1,277 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The code of the errors of the API when the session expired
+const loginRequiredCode = "SETAGAYA_ERR_LOGIN_REQUIRED"
+
+// APIError is an error returned by the API of Setagaya
+type APIError struct {
+	StatusCode int
+	Message    string `json:"message"`
+	Code       string `json:"code"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func isNotFound(err error) bool {
+	var ae *APIError
+	return errors.As(err, &ae) && ae.StatusCode == http.StatusNotFound
+}
+
+type apiCollection struct {
+	ID int64 `json:"id"`
+}
+
+type apiPlanStatus struct {
+	EnginesReachable bool `json:"engines_reachable"`
+	EnginesDeployed  int  `json:"engines_deployed"`
+}
+
+type apiCollectionStatus struct {
+	Plans []*apiPlanStatus `json:"status"`
+}
+
+// reachable tells whether the engines of all the plans can be triggered
+func (cs *apiCollectionStatus) reachable() bool {
+	for _, p := range cs.Plans {
+		if !p.EnginesReachable {
+			return false
+		}
+	}
+	return len(cs.Plans) > 0
+}
+
+// deployed tells whether the engines of any plan were deployed, even if they are not reachable yet
+func (cs *apiCollectionStatus) deployed() bool {
+	for _, p := range cs.Plans {
+		if p.EnginesDeployed > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+type apiLabelAssertions struct {
+	Samples uint64 `json:"samples"`
+	Failed  uint64 `json:"failed"`
+}
+
+// apiRunSummary holds the latency figures of a run, in milliseconds
+type apiRunSummary struct {
+	Samples    uint64                         `json:"samples"`
+	Mean       float64                        `json:"mean"`
+	P50        float64                        `json:"p50"`
+	P90        float64                        `json:"p90"`
+	P95        float64                        `json:"p95"`
+	P99        float64                        `json:"p99"`
+	Assertions map[string]*apiLabelAssertions `json:"assertions"`
+}
+
+type apiRun struct {
+	ID          int64          `json:"id"`
+	StartedTime time.Time      `json:"started_time"`
+	EndTime     time.Time      `json:"end_time"`
+	Summary     *apiRunSummary `json:"summary"`
+}
+
+// APIClient calls the API of Setagaya on behalf of the operator. It signs in with its account when the API needs
+// one, and again when its session expires.
+type APIClient struct {
+	baseURL  string
+	client   *http.Client
+	username string
+	password string
+}
+
+// NewAPIClient returns a client of the API at baseURL. The username is empty when the API does not authenticate.
+func NewAPIClient(baseURL, username, password string) (*APIClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &APIClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client: &http.Client{
+			Jar:     jar,
+			Timeout: 30 * time.Second,
+			// The login answers with a redirection to the UI, the session is in its cookie
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		username: username,
+		password: password,
+	}, nil
+}
+
+func (c *APIClient) login(ctx context.Context) error {
+	form := url.Values{"username": {c.username}, "password": {c.password}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || strings.Contains(resp.Header.Get("Location"), "error_msg") {
+		return fmt.Errorf("cannot log in to setagaya as %s", c.username)
+	}
+	return nil
+}
+
+type request struct {
+	method         string
+	path           string
+	contentType    string
+	body           []byte
+	idempotencyKey string
+}
+
+func (c *APIClient) send(ctx context.Context, r *request, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, r.method, c.baseURL+r.path, bytes.NewReader(r.body))
+	if err != nil {
+		return err
+	}
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	if r.idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", r.idempotencyKey)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		ae := &APIError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(ae); err != nil {
+			ae.Message = http.StatusText(resp.StatusCode)
+		}
+		return ae
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// doRequest calls the API, signing in first when the session is missing or expired
+func (c *APIClient) doRequest(ctx context.Context, r *request, out interface{}) error {
+	err := c.send(ctx, r, out)
+	var ae *APIError
+	if c.username == "" || !errors.As(err, &ae) || ae.Code != loginRequiredCode {
+		return err
+	}
+	if err := c.login(ctx); err != nil {
+		return err
+	}
+	return c.send(ctx, r, out)
+}
+
+func (c *APIClient) do(ctx context.Context, method, path, contentType string, body []byte, out interface{}) error {
+	return c.doRequest(ctx, &request{method: method, path: path, contentType: contentType, body: body}, out)
+}
+
+func (c *APIClient) postForm(ctx context.Context, path string, form url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodPost, path, "application/x-www-form-urlencoded", []byte(form.Encode()), out)
+}
+
+func collectionPath(collectionID int64, sub string) string {
+	return "/api/collections/" + strconv.FormatInt(collectionID, 10) + sub
+}
+
+func (c *APIClient) createCollection(ctx context.Context, projectID int64, name string) (int64, error) {
+	collection := new(apiCollection)
+	form := url.Values{"name": {name}, "project_id": {strconv.FormatInt(projectID, 10)}}
+	if err := c.postForm(ctx, "/api/collections", form, collection); err != nil {
+		return 0, err
+	}
+	return collection.ID, nil
+}
+
+// uploadCollectionConfig replaces the plans of the collection with the ones of the YAML
+func (c *APIClient) uploadCollectionConfig(ctx context.Context, collectionID int64, config []byte) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("collectionYAML", "collection.yaml")
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(config); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPut, collectionPath(collectionID, "/config"), mw.FormDataContentType(), body.Bytes(), nil)
+}
+
+func (c *APIClient) deleteCollection(ctx context.Context, collectionID int64) error {
+	return c.do(ctx, http.MethodDelete, collectionPath(collectionID, ""), "", nil, nil)
+}
+
+func (c *APIClient) deploy(ctx context.Context, collectionID int64) error {
+	return c.postForm(ctx, collectionPath(collectionID, "/deploy"), nil, nil)
+}
+
+func (c *APIClient) collectionStatus(ctx context.Context, collectionID int64) (*apiCollectionStatus, error) {
+	cs := new(apiCollectionStatus)
+	if err := c.do(ctx, http.MethodGet, collectionPath(collectionID, "/status"), "", nil, cs); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// trigger starts a run of the collection. The run of a previous trigger with the same idempotency key, when it's not
+// empty, is returned instead of starting another one.
+func (c *APIClient) trigger(ctx context.Context, collectionID int64, parameters map[string]string,
+	idempotencyKey string) (*apiRun, error) {
+	body, err := json.Marshal(map[string]interface{}{"parameters": parameters})
+	if err != nil {
+		return nil, err
+	}
+	run := new(apiRun)
+	req := &request{method: http.MethodPost, path: collectionPath(collectionID, "/trigger"),
+		contentType: "application/json", body: body, idempotencyKey: idempotencyKey}
+	if err := c.doRequest(ctx, req, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (c *APIClient) getRun(ctx context.Context, collectionID, runID int64) (*apiRun, error) {
+	run := new(apiRun)
+	path := collectionPath(collectionID, "/runs/"+strconv.FormatInt(runID, 10))
+	if err := c.do(ctx, http.MethodGet, path, "", nil, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (c *APIClient) stop(ctx context.Context, collectionID int64) error {
+	return c.postForm(ctx, collectionPath(collectionID, "/stop"), nil, nil)
+}
+
+func (c *APIClient) purge(ctx context.Context, collectionID int64) error {
+	return c.postForm(ctx, collectionPath(collectionID, "/purge"), nil, nil)
+}
@@ -0,0 +1,82 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIClientLogsIn(t *testing.T) {
+	logins := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("password") != "secret" {
+			http.Redirect(w, r, "/login?error_msg=wrong", http.StatusSeeOther)
+			return
+		}
+		logins++
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok"})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/api/collections", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"message": "login required", "code": loginRequiredCode})
+			return
+		}
+		assert.Equal(t, "12", r.FormValue("project_id"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 7, "name": r.FormValue("name")})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	c, err := NewAPIClient(s.URL+"/", "operator", "secret")
+	assert.Nil(t, err)
+	id, err := c.createCollection(context.Background(), 12, "checkout")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), id)
+	// The session is kept
+	_, err = c.createCollection(context.Background(), 12, "checkout")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, logins)
+
+	c, _ = NewAPIClient(s.URL, "operator", "wrong")
+	_, err = c.createCollection(context.Background(), 12, "checkout")
+	assert.EqualError(t, err, "cannot log in to setagaya as operator")
+}
+
+func TestAPIClientErrors(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/collections/7/runs/3":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "run not found", "code": "SETAGAYA_ERR_NOT_FOUND"})
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer s.Close()
+
+	c, _ := NewAPIClient(s.URL, "", "")
+	_, err := c.getRun(context.Background(), 7, 3)
+	assert.True(t, isNotFound(err))
+	assert.EqualError(t, err, "404 SETAGAYA_ERR_NOT_FOUND: run not found")
+
+	err = c.deploy(context.Background(), 7)
+	assert.False(t, isNotFound(err))
+	assert.True(t, isAPIError(err))
+	assert.Equal(t, "Bad Gateway", err.(*APIError).Message)
+}
+
+func TestCollectionStatusReachable(t *testing.T) {
+	cs := &apiCollectionStatus{}
+	assert.False(t, cs.reachable())
+	cs.Plans = []*apiPlanStatus{{EnginesReachable: true}, {EnginesReachable: false}}
+	assert.False(t, cs.reachable())
+	cs.Plans[1].EnginesReachable = true
+	assert.True(t, cs.reachable())
+}
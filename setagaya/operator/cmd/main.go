@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/hveda/Setagaya/setagaya/operator"
+)
+
+// kubeConfig is the config of the cluster the operator runs in, the one of the kubeconfig out of it
+func kubeConfig() (*rest.Config, error) {
+	if config, err := rest.InClusterConfig(); err == nil {
+		return config, nil
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
+
+// serveArgoPlugin serves the executor plugin of Argo Workflows until the context is done
+func serveArgoPlugin(ctx context.Context, addr string, api *operator.APIClient) {
+	token, err := operator.ReadArgoToken()
+	if err != nil {
+		log.Fatalf("Cannot read the argo token: %v", err)
+	}
+	server := &http.Server{Addr: addr, Handler: operator.NewArgoPlugin(api, token)}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Infof("Argo executor plugin is listening on %s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// The operator is configured by its environment: SETAGAYA_API_URL, the account it signs in with in
+// SETAGAYA_USERNAME and SETAGAYA_PASSWORD, and WATCH_NAMESPACE to only manage the resources of a namespace.
+// With -argo-plugin-addr, it serves the executor plugin of Argo Workflows instead.
+func main() {
+	interval := flag.Duration("interval", operator.DefaultInterval, "interval between two reconciliations")
+	argoPluginAddr := flag.String("argo-plugin-addr", "", "address the executor plugin of Argo Workflows listens on")
+	flag.Parse()
+	apiURL := os.Getenv("SETAGAYA_API_URL")
+	if apiURL == "" {
+		log.Fatal("SETAGAYA_API_URL is not set")
+	}
+	api, err := operator.NewAPIClient(apiURL, os.Getenv("SETAGAYA_USERNAME"), os.Getenv("SETAGAYA_PASSWORD"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer cancel()
+	if *argoPluginAddr != "" {
+		serveArgoPlugin(ctx, *argoPluginAddr, api)
+		return
+	}
+	config, err := kubeConfig()
+	if err != nil {
+		log.Fatalf("Cannot get the kubernetes config: %v", err)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Fatalf("Cannot get the kubernetes client: %v", err)
+	}
+	namespace := os.Getenv("WATCH_NAMESPACE")
+	log.Infof("Operator is reconciling the setagaya resources against %s", apiURL)
+	operator.NewOperator(api, client, namespace, *interval).Run(ctx)
+}
@@ -0,0 +1,373 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	DefaultInterval = 5 * time.Second
+	// A run fails when its engines are not reachable this long after they were deployed
+	deployTimeout = 15 * time.Minute
+)
+
+// Operator reconciles the custom resources of a namespace, or of all of them, every interval. Like the controller
+// of Setagaya, it polls rather than watches: the state of the runs is in the API, which has nothing to watch.
+type Operator struct {
+	api       *APIClient
+	client    dynamic.Interface
+	namespace string
+	interval  time.Duration
+	now       func() time.Time
+}
+
+// NewOperator returns the operator of the resources of the namespace, of all of them when it's empty
+func NewOperator(api *APIClient, client dynamic.Interface, namespace string, interval time.Duration) *Operator {
+	return &Operator{api: api, client: client, namespace: namespace, interval: interval, now: time.Now}
+}
+
+// Run reconciles the resources until the context is done
+func (o *Operator) Run(ctx context.Context) {
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	for {
+		o.reconcileAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *Operator) reconcileAll(ctx context.Context) {
+	collections, err := o.client.Resource(CollectionResource).Namespace(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Errorf("Cannot list the setagaya collections: %v", err)
+	}
+	if collections != nil {
+		for i := range collections.Items {
+			u := &collections.Items[i]
+			c := new(Collection)
+			if err := fromUnstructured(u, c); err != nil {
+				log.Errorf("Invalid setagaya collection %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+				continue
+			}
+			if err := o.reconcileCollection(ctx, c); err != nil {
+				log.Errorf("Cannot reconcile setagaya collection %s/%s: %v", c.Namespace, c.Name, err)
+			}
+		}
+	}
+	runs, err := o.client.Resource(RunResource).Namespace(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Errorf("Cannot list the setagaya runs: %v", err)
+		return
+	}
+	for i := range runs.Items {
+		u := &runs.Items[i]
+		r := new(Run)
+		if err := fromUnstructured(u, r); err != nil {
+			log.Errorf("Invalid setagaya run %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+			continue
+		}
+		if err := o.reconcileRun(ctx, r); err != nil {
+			log.Errorf("Cannot reconcile setagaya run %s/%s: %v", r.Namespace, r.Name, err)
+		}
+	}
+}
+
+func (o *Operator) update(ctx context.Context, gvr schema.GroupVersionResource, namespace string,
+	obj interface{}) (*unstructured.Unstructured, error) {
+	u, err := toUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return o.client.Resource(gvr).Namespace(namespace).Update(ctx, u, metav1.UpdateOptions{})
+}
+
+func (o *Operator) updateStatus(ctx context.Context, gvr schema.GroupVersionResource, namespace string,
+	obj interface{}) (*unstructured.Unstructured, error) {
+	u, err := toUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return o.client.Resource(gvr).Namespace(namespace).UpdateStatus(ctx, u, metav1.UpdateOptions{})
+}
+
+// isAPIError tells whether the API turned the request down, rather than it could not be reached. The requests
+// turned down are not retried until the spec changes.
+func isAPIError(err error) bool {
+	var ae *APIError
+	return errors.As(err, &ae)
+}
+
+// collectionConfig is the YAML of the collection the API takes, made from the spec
+func collectionConfig(c *Collection) ([]byte, error) {
+	tests := c.Spec.Tests
+	if tests == nil {
+		tests = []map[string]interface{}{}
+	}
+	return yaml.Marshal(map[string]interface{}{
+		"multi-test": map[string]interface{}{
+			"name":         c.collectionName(),
+			"projectid":    c.Spec.ProjectID,
+			"collectionid": c.Status.CollectionID,
+			"tests":        tests,
+			"csv_split":    c.Spec.CSVSplit,
+		},
+	})
+}
+
+func (c *Collection) collectionName() string {
+	if c.Spec.Name != "" {
+		return c.Spec.Name
+	}
+	return c.Name
+}
+
+// reconcileCollection creates the collection in Setagaya and uploads its configuration whenever the spec changes
+func (o *Operator) reconcileCollection(ctx context.Context, c *Collection) error {
+	if c.DeletionTimestamp != nil {
+		return o.finalizeCollection(ctx, c)
+	}
+	if !hasFinalizer(&c.ObjectMeta) {
+		c.Finalizers = append(c.Finalizers, Finalizer)
+		_, err := o.update(ctx, CollectionResource, c.Namespace, c)
+		return err
+	}
+	if c.Status.ObservedGeneration == c.Generation && c.Status.CollectionID != 0 {
+		return nil
+	}
+	if c.Status.CollectionID == 0 {
+		id, err := o.api.createCollection(ctx, c.Spec.ProjectID, c.collectionName())
+		if err != nil {
+			if !isAPIError(err) {
+				return err
+			}
+			c.Status.ObservedGeneration, c.Status.Phase, c.Status.Message = c.Generation, CollectionFailed, err.Error()
+			_, err = o.updateStatus(ctx, CollectionResource, c.Namespace, c)
+			return err
+		}
+		// The collection is recorded at once, so it's not created twice when the upload fails
+		c.Status.CollectionID = id
+		u, err := o.updateStatus(ctx, CollectionResource, c.Namespace, c)
+		if err != nil {
+			return err
+		}
+		if err := fromUnstructured(u, c); err != nil {
+			return err
+		}
+	}
+	config, err := collectionConfig(c)
+	if err != nil {
+		return err
+	}
+	c.Status.Phase, c.Status.Message = CollectionReady, ""
+	if err := o.api.uploadCollectionConfig(ctx, c.Status.CollectionID, config); err != nil {
+		if !isAPIError(err) {
+			return err
+		}
+		c.Status.Phase, c.Status.Message = CollectionFailed, err.Error()
+	}
+	c.Status.ObservedGeneration = c.Generation
+	_, err = o.updateStatus(ctx, CollectionResource, c.Namespace, c)
+	return err
+}
+
+// finalizeCollection stops the runs of the collection, purges its engines and deletes it before the resource goes
+func (o *Operator) finalizeCollection(ctx context.Context, c *Collection) error {
+	if !hasFinalizer(&c.ObjectMeta) {
+		return nil
+	}
+	if id := c.Status.CollectionID; id != 0 {
+		if err := o.api.stop(ctx, id); err != nil && !isNotFound(err) {
+			log.Warnf("Cannot stop collection %d: %v", id, err)
+		}
+		if err := o.api.purge(ctx, id); err != nil && !isNotFound(err) {
+			log.Warnf("Cannot purge collection %d: %v", id, err)
+		}
+		if err := o.api.deleteCollection(ctx, id); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	removeFinalizer(&c.ObjectMeta)
+	_, err := o.update(ctx, CollectionResource, c.Namespace, c)
+	return err
+}
+
+func (o *Operator) getCollection(ctx context.Context, namespace, name string) (*Collection, error) {
+	u, err := o.client.Resource(CollectionResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	c := new(Collection)
+	if err := fromUnstructured(u, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reconcileRun moves the run along: its engines are deployed, then it's triggered once they are reachable, and it's
+// followed until it ends
+func (o *Operator) reconcileRun(ctx context.Context, r *Run) error {
+	if r.DeletionTimestamp != nil {
+		return o.finalizeRun(ctx, r)
+	}
+	if r.Status.Done() {
+		if hasFinalizer(&r.ObjectMeta) {
+			removeFinalizer(&r.ObjectMeta)
+			_, err := o.update(ctx, RunResource, r.Namespace, r)
+			return err
+		}
+		return nil
+	}
+	if !hasFinalizer(&r.ObjectMeta) {
+		r.Finalizers = append(r.Finalizers, Finalizer)
+		_, err := o.update(ctx, RunResource, r.Namespace, r)
+		return err
+	}
+	switch r.Status.Phase {
+	case RunDeploying:
+		return o.triggerRun(ctx, r)
+	case RunRunning:
+		return o.followRun(ctx, r)
+	default:
+		return o.deployRun(ctx, r)
+	}
+}
+
+// waitRun keeps the run pending, it's only updated when the reason changes
+func (o *Operator) waitRun(ctx context.Context, r *Run, message string) error {
+	if r.Status.Phase == RunPending && r.Status.Message == message {
+		return nil
+	}
+	r.Status.Phase, r.Status.Message = RunPending, message
+	_, err := o.updateStatus(ctx, RunResource, r.Namespace, r)
+	return err
+}
+
+func (o *Operator) deployRun(ctx context.Context, r *Run) error {
+	c, err := o.getCollection(ctx, r.Namespace, r.Spec.Collection)
+	if k8serrors.IsNotFound(err) {
+		return o.waitRun(ctx, r, fmt.Sprintf("setagaya collection %s not found", r.Spec.Collection))
+	}
+	if err != nil {
+		return err
+	}
+	if c.Status.Phase == CollectionFailed && c.Status.ObservedGeneration == c.Generation {
+		return o.endRun(ctx, r, RunFailed, fmt.Sprintf("setagaya collection %s failed: %s", c.Name, c.Status.Message))
+	}
+	if c.Status.CollectionID == 0 || c.Status.ObservedGeneration != c.Generation {
+		return o.waitRun(ctx, r, fmt.Sprintf("waiting for setagaya collection %s to be reconciled", c.Name))
+	}
+	r.Status.CollectionID = c.Status.CollectionID
+	if err := o.api.deploy(ctx, r.Status.CollectionID); err != nil {
+		if !isAPIError(err) {
+			return err
+		}
+		return o.endRun(ctx, r, RunFailed, err.Error())
+	}
+	now := metav1.NewTime(o.now())
+	r.Status.Phase, r.Status.Message, r.Status.DeployedTime = RunDeploying, "", &now
+	_, err = o.updateStatus(ctx, RunResource, r.Namespace, r)
+	return err
+}
+
+func (o *Operator) triggerRun(ctx context.Context, r *Run) error {
+	cs, err := o.api.collectionStatus(ctx, r.Status.CollectionID)
+	if err != nil {
+		return err
+	}
+	if !cs.reachable() {
+		if r.Status.DeployedTime != nil && o.now().Sub(r.Status.DeployedTime.Time) > deployTimeout {
+			return o.endRun(ctx, r, RunFailed, fmt.Sprintf("the engines are not reachable after %s", deployTimeout))
+		}
+		return nil
+	}
+	run, err := o.api.trigger(ctx, r.Status.CollectionID, r.Spec.Parameters, string(r.UID))
+	if err != nil {
+		if !isAPIError(err) {
+			return err
+		}
+		return o.endRun(ctx, r, RunFailed, err.Error())
+	}
+	started := metav1.NewTime(run.StartedTime)
+	r.Status.Phase, r.Status.RunID, r.Status.StartedTime = RunRunning, run.ID, &started
+	_, err = o.updateStatus(ctx, RunResource, r.Namespace, r)
+	return err
+}
+
+func (o *Operator) followRun(ctx context.Context, r *Run) error {
+	run, err := o.api.getRun(ctx, r.Status.CollectionID, r.Status.RunID)
+	if err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		return o.endRun(ctx, r, RunFailed, err.Error())
+	}
+	if run.EndTime.IsZero() {
+		return nil
+	}
+	end := metav1.NewTime(run.EndTime)
+	r.Status.EndTime = &end
+	return o.endRun(ctx, r, RunFinished, "")
+}
+
+// endRun records the end of the run. The engines it deployed are purged unless they are kept.
+func (o *Operator) endRun(ctx context.Context, r *Run, phase, message string) error {
+	if r.Status.Phase == RunDeploying || r.Status.Phase == RunRunning {
+		o.purgeEngines(ctx, r)
+	}
+	if r.Status.EndTime == nil {
+		end := metav1.NewTime(o.now())
+		r.Status.EndTime = &end
+	}
+	r.Status.Phase, r.Status.Message = phase, message
+	u, err := o.updateStatus(ctx, RunResource, r.Namespace, r)
+	if err != nil {
+		return err
+	}
+	if err := fromUnstructured(u, r); err != nil {
+		return err
+	}
+	removeFinalizer(&r.ObjectMeta)
+	_, err = o.update(ctx, RunResource, r.Namespace, r)
+	return err
+}
+
+func (o *Operator) purgeEngines(ctx context.Context, r *Run) {
+	if r.Spec.KeepEngines {
+		return
+	}
+	if err := o.api.purge(ctx, r.Status.CollectionID); err != nil {
+		log.Warnf("Cannot purge the engines of collection %d: %v", r.Status.CollectionID, err)
+	}
+}
+
+// finalizeRun stops the run in progress before the resource goes
+func (o *Operator) finalizeRun(ctx context.Context, r *Run) error {
+	if !hasFinalizer(&r.ObjectMeta) {
+		return nil
+	}
+	if r.Status.Phase == RunRunning {
+		if err := o.api.stop(ctx, r.Status.CollectionID); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+	if r.Status.Phase == RunDeploying || r.Status.Phase == RunRunning {
+		o.purgeEngines(ctx, r)
+	}
+	removeFinalizer(&r.ObjectMeta)
+	_, err := o.update(ctx, RunResource, r.Namespace, r)
+	return err
+}
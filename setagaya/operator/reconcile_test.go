@@ -0,0 +1,226 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+// fakeAPI is the API of Setagaya with a collection whose run ends once ended is set
+type fakeAPI struct {
+	mu        sync.Mutex
+	calls     []string
+	config    []byte
+	reachable bool
+	ended     bool
+	// Idempotency keys of the triggers
+	keys    []string
+	summary map[string]interface{}
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.Method+" "+r.URL.Path)
+	switch r.Method + " " + r.URL.Path {
+	case "POST /api/collections":
+		json.NewEncoder(w).Encode(map[string]int64{"id": 7})
+	case "PUT /api/collections/7/config":
+		file, _, err := r.FormFile("collectionYAML")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.config, _ = io.ReadAll(file)
+	case "GET /api/collections/7/status":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": []map[string]interface{}{{"plan_id": 1, "engines_reachable": f.reachable}},
+		})
+	case "POST /api/collections/7/trigger":
+		f.keys = append(f.keys, r.Header.Get("Idempotency-Key"))
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 3, "started_time": time.Now()})
+	case "GET /api/collections/7/runs/3":
+		run := map[string]interface{}{"id": 3, "started_time": time.Now()}
+		if f.ended {
+			run["end_time"] = time.Now()
+			run["summary"] = f.summary
+		}
+		json.NewEncoder(w).Encode(run)
+	}
+}
+
+func (f *fakeAPI) called(call string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.calls {
+		if c == call {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestOperator(t *testing.T, objects ...runtime.Object) (*Operator, *fakeAPI) {
+	api := new(fakeAPI)
+	s := httptest.NewServer(api)
+	t.Cleanup(s.Close)
+	c, err := NewAPIClient(s.URL, "", "")
+	assert.Nil(t, err)
+	client := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		CollectionResource: "SetagayaCollectionList",
+		RunResource:        "SetagayaRunList",
+	}, objects...)
+	return NewOperator(c, client, "", time.Second), api
+}
+
+func newObject(t *testing.T, kind string, obj interface{}) *unstructured.Unstructured {
+	u, err := toUnstructured(obj)
+	assert.Nil(t, err)
+	u.SetAPIVersion(Group + "/" + Version)
+	u.SetKind(kind)
+	return u
+}
+
+func getCollection(t *testing.T, o *Operator) *Collection {
+	c, err := o.getCollection(context.Background(), "tests", "checkout")
+	assert.Nil(t, err)
+	return c
+}
+
+func getRun(t *testing.T, o *Operator) *Run {
+	u, err := o.client.Resource(RunResource).Namespace("tests").Get(context.Background(), "nightly", metav1.GetOptions{})
+	assert.Nil(t, err)
+	r := new(Run)
+	assert.Nil(t, fromUnstructured(u, r))
+	return r
+}
+
+func TestReconcileCollection(t *testing.T) {
+	collection := &Collection{
+		ObjectMeta: metav1.ObjectMeta{Name: "checkout", Namespace: "tests", Generation: 1},
+		Spec: CollectionSpec{ProjectID: 12, Tests: []map[string]interface{}{
+			{"name": "browse", "concurrency": 10, "engines": 2, "duration": 5},
+		}},
+	}
+	o, api := newTestOperator(t, newObject(t, "SetagayaCollection", collection))
+	ctx := context.Background()
+
+	// The finalizer is added first
+	o.reconcileAll(ctx)
+	c := getCollection(t, o)
+	assert.Equal(t, []string{Finalizer}, c.Finalizers)
+	assert.False(t, api.called("POST /api/collections"))
+
+	o.reconcileAll(ctx)
+	c = getCollection(t, o)
+	assert.Equal(t, int64(7), c.Status.CollectionID)
+	assert.Equal(t, CollectionReady, c.Status.Phase)
+	assert.Equal(t, int64(1), c.Status.ObservedGeneration)
+	config := struct {
+		MultiTest struct {
+			Name         string                   `yaml:"name"`
+			ProjectID    int64                    `yaml:"projectid"`
+			CollectionID int64                    `yaml:"collectionid"`
+			Tests        []map[string]interface{} `yaml:"tests"`
+		} `yaml:"multi-test"`
+	}{}
+	assert.Nil(t, yaml.Unmarshal(api.config, &config))
+	assert.Equal(t, "checkout", config.MultiTest.Name)
+	assert.Equal(t, int64(12), config.MultiTest.ProjectID)
+	assert.Equal(t, int64(7), config.MultiTest.CollectionID)
+	assert.Len(t, config.MultiTest.Tests, 1)
+
+	// Nothing is uploaded until the spec changes
+	api.config = nil
+	o.reconcileAll(ctx)
+	assert.Nil(t, api.config)
+
+	now := metav1.Now()
+	c.DeletionTimestamp = &now
+	assert.Nil(t, o.reconcileCollection(ctx, c))
+	assert.True(t, api.called("POST /api/collections/7/purge"))
+	assert.True(t, api.called("DELETE /api/collections/7"))
+	assert.Empty(t, getCollection(t, o).Finalizers)
+}
+
+func TestReconcileRun(t *testing.T) {
+	collection := &Collection{
+		ObjectMeta: metav1.ObjectMeta{Name: "checkout", Namespace: "tests", Generation: 1},
+		Spec:       CollectionSpec{ProjectID: 12},
+	}
+	run := &Run{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "tests"},
+		Spec:       RunSpec{Collection: "checkout", Parameters: map[string]string{"host": "example.com"}},
+	}
+	o, api := newTestOperator(t, newObject(t, "SetagayaRun", run))
+	ctx := context.Background()
+
+	// The run waits for its collection
+	o.reconcileAll(ctx)
+	o.reconcileAll(ctx)
+	r := getRun(t, o)
+	assert.Equal(t, []string{Finalizer}, r.Finalizers)
+	assert.Equal(t, RunPending, r.Status.Phase)
+	assert.Contains(t, r.Status.Message, "not found")
+
+	_, err := o.client.Resource(CollectionResource).Namespace("tests").Create(ctx,
+		newObject(t, "SetagayaCollection", collection), metav1.CreateOptions{})
+	assert.Nil(t, err)
+	o.reconcileAll(ctx)
+	o.reconcileAll(ctx)
+	o.reconcileAll(ctx)
+	r = getRun(t, o)
+	assert.Equal(t, RunDeploying, r.Status.Phase)
+	assert.Equal(t, int64(7), r.Status.CollectionID)
+	assert.NotNil(t, r.Status.DeployedTime)
+	assert.True(t, api.called("POST /api/collections/7/deploy"))
+
+	// It's triggered once the engines are reachable
+	o.reconcileAll(ctx)
+	assert.Equal(t, RunDeploying, getRun(t, o).Status.Phase)
+	api.reachable = true
+	o.reconcileAll(ctx)
+	r = getRun(t, o)
+	assert.Equal(t, RunRunning, r.Status.Phase)
+	assert.Equal(t, int64(3), r.Status.RunID)
+
+	o.reconcileAll(ctx)
+	assert.Equal(t, RunRunning, getRun(t, o).Status.Phase)
+	assert.False(t, api.called("POST /api/collections/7/purge"))
+	api.ended = true
+	o.reconcileAll(ctx)
+	r = getRun(t, o)
+	assert.Equal(t, RunFinished, r.Status.Phase)
+	assert.NotNil(t, r.Status.EndTime)
+	assert.Empty(t, r.Finalizers)
+	assert.True(t, api.called("POST /api/collections/7/purge"))
+}
+
+func TestReconcileRunDeployTimeout(t *testing.T) {
+	deployed := metav1.NewTime(time.Now().Add(-deployTimeout - time.Minute))
+	run := &Run{
+		ObjectMeta: metav1.ObjectMeta{Name: "nightly", Namespace: "tests", Finalizers: []string{Finalizer}},
+		Spec:       RunSpec{Collection: "checkout", KeepEngines: true},
+		Status:     RunStatus{Phase: RunDeploying, CollectionID: 7, DeployedTime: &deployed},
+	}
+	o, api := newTestOperator(t, newObject(t, "SetagayaRun", run))
+	o.reconcileAll(context.Background())
+	r := getRun(t, o)
+	assert.Equal(t, RunFailed, r.Status.Phase)
+	assert.Empty(t, r.Finalizers)
+	// The engines are kept
+	assert.False(t, api.called("POST /api/collections/7/purge"))
+}
@@ -0,0 +1,128 @@
+// Package operator reconciles the SetagayaCollection and SetagayaRun custom resources against the API of Setagaya,
+// so the load tests can be managed declaratively along the manifests of the applications they test. It also serves
+// the executor plugin running collections as the steps of Argo Workflows. The operator only talks to the API, it
+// does not import the configuration of the platform.
+package operator
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "setagaya.io"
+	Version = "v1alpha1"
+	// Keeps the resources until the collection or the engines they own in Setagaya are cleaned up
+	Finalizer = "setagaya.io/finalizer"
+)
+
+var (
+	CollectionResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "setagayacollections"}
+	RunResource        = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "setagayaruns"}
+)
+
+const (
+	CollectionReady  = "Ready"
+	CollectionFailed = "Failed"
+)
+
+// Collection is a collection of Setagaya and its plans. The operator creates the collection in the project and
+// uploads its configuration whenever the spec changes. Deleting the resource deletes the collection.
+type Collection struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              CollectionSpec   `json:"spec"`
+	Status            CollectionStatus `json:"status,omitempty"`
+}
+
+type CollectionSpec struct {
+	ProjectID int64 `json:"projectID"`
+	// Name of the collection in Setagaya, the name of the resource by default
+	Name     string `json:"name,omitempty"`
+	CSVSplit bool   `json:"csvSplit,omitempty"`
+	// The plans of the collection, like the tests of the YAML of a collection
+	Tests []map[string]interface{} `json:"tests"`
+}
+
+type CollectionStatus struct {
+	CollectionID int64 `json:"collectionID,omitempty"`
+	// Generation of the spec the configuration of the collection was last uploaded from
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	Phase              string `json:"phase,omitempty"`
+	Message            string `json:"message,omitempty"`
+}
+
+const (
+	RunPending   = "Pending"
+	RunDeploying = "Deploying"
+	RunRunning   = "Running"
+	RunFinished  = "Finished"
+	RunFailed    = "Failed"
+)
+
+// Run is a run of a SetagayaCollection of the same namespace. The operator deploys the engines of the collection,
+// triggers the run and follows it until it finishes. The engines are purged afterwards unless they are kept.
+// Deleting a run in progress stops it.
+type Run struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              RunSpec   `json:"spec"`
+	Status            RunStatus `json:"status,omitempty"`
+}
+
+type RunSpec struct {
+	// Name of the SetagayaCollection
+	Collection string `json:"collection"`
+	// Run parameters passed to the plans
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// Keeps the engines deployed after the run, for the next runs
+	KeepEngines bool `json:"keepEngines,omitempty"`
+}
+
+type RunStatus struct {
+	Phase        string       `json:"phase,omitempty"`
+	CollectionID int64        `json:"collectionID,omitempty"`
+	RunID        int64        `json:"runID,omitempty"`
+	DeployedTime *metav1.Time `json:"deployedTime,omitempty"`
+	StartedTime  *metav1.Time `json:"startedTime,omitempty"`
+	EndTime      *metav1.Time `json:"endTime,omitempty"`
+	Message      string       `json:"message,omitempty"`
+}
+
+// Done tells whether the run reached its end, whether it succeeded or not
+func (s *RunStatus) Done() bool {
+	return s.Phase == RunFinished || s.Phase == RunFailed
+}
+
+func fromUnstructured(u *unstructured.Unstructured, obj interface{}) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), obj)
+}
+
+func toUnstructured(obj interface{}) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+func hasFinalizer(om *metav1.ObjectMeta) bool {
+	for _, f := range om.Finalizers {
+		if f == Finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(om *metav1.ObjectMeta) {
+	finalizers := []string{}
+	for _, f := range om.Finalizers {
+		if f != Finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	om.Finalizers = finalizers
+}
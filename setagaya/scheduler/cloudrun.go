@@ -10,6 +10,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/hveda/Setagaya/setagaya/config"
 	model "github.com/hveda/Setagaya/setagaya/model"
@@ -54,6 +55,17 @@ func NewCloudRun(cfg *config.ClusterConfig) *CloudRun {
 	return cr
 }
 
+// Region is where the services of the engines are created
+func (cr *CloudRun) Region() string {
+	return cr.region
+}
+
+// Ping lists a service of the project, which needs both the api and the permissions of the controller
+func (cr *CloudRun) Ping(ctx context.Context) error {
+	_, err := cr.rs.Namespaces.Services.List(cr.nsProjectID).Limit(1).Context(ctx).Do()
+	return err
+}
+
 func (cr *CloudRun) MakeName(projectID, collectionID, planID int64, engineID int) string {
 	return fmt.Sprintf("engine-%d-%d-%d-%d", projectID, collectionID, planID, engineID)
 }
@@ -175,7 +187,7 @@ func (cr *CloudRun) sendCreateServiceReq(projectID, collectionID, planID int64,
 	return nil
 }
 
-func (cr *CloudRun) DeployEngine(projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error {
+func (cr *CloudRun) DeployEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error {
 	item := &cloudRunRequest{
 		method:         "create",
 		projectID:      projectID,
@@ -188,7 +200,7 @@ func (cr *CloudRun) DeployEngine(projectID, collectionID, planID int64, engineID
 	return nil
 }
 
-func (cr *CloudRun) DeployPlan(projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) error {
+func (cr *CloudRun) DeployPlan(ctx context.Context, projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) error {
 	return nil
 }
 
@@ -201,8 +213,22 @@ func (cr *CloudRun) deleteService(serviceID string) error {
 	return nil
 }
 
-func (cr *CloudRun) PurgeCollection(collectionID int64) error {
-	items, err := cr.getEnginesByCollection(collectionID)
+func (cr *CloudRun) PurgeCollection(ctx context.Context, collectionID int64) error {
+	items, err := cr.getEnginesByCollection(ctx, collectionID)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		cr.throttlingQueue <- &cloudRunRequest{
+			method:    "delete",
+			serviceID: item.Metadata.Name,
+		}
+	}
+	return nil
+}
+
+func (cr *CloudRun) PurgePlan(ctx context.Context, collectionID, planID int64) error {
+	items, err := cr.getEnginesByCollectionPlan(ctx, collectionID, planID)
 	if err != nil {
 		return err
 	}
@@ -215,26 +241,35 @@ func (cr *CloudRun) PurgeCollection(collectionID int64) error {
 	return nil
 }
 
-func (cr *CloudRun) getEnginesByCollection(collectionID int64) ([]*runv1.Service, error) {
+// ReplaceEngine queues the deletion of the service of the engine before its creation, the queue keeps their order
+func (cr *CloudRun) ReplaceEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error {
+	cr.throttlingQueue <- &cloudRunRequest{
+		method:    "delete",
+		serviceID: cr.MakeName(projectID, collectionID, planID, engineID),
+	}
+	return cr.DeployEngine(ctx, projectID, collectionID, planID, engineID, containerConfig)
+}
+
+func (cr *CloudRun) getEnginesByCollection(ctx context.Context, collectionID int64) ([]*runv1.Service, error) {
 	label := makeCollectionLabel(collectionID)
-	resp, err := cr.rs.Namespaces.Services.List(cr.nsProjectID).LabelSelector(label).Do()
+	resp, err := cr.rs.Namespaces.Services.List(cr.nsProjectID).LabelSelector(label).Context(ctx).Do()
 	if err != nil {
 		return []*runv1.Service{}, err
 	}
 	return resp.Items, nil
 }
 
-func (cr *CloudRun) getEnginesByCollectionPlan(collectionID, planID int64) ([]*runv1.Service, error) {
+func (cr *CloudRun) getEnginesByCollectionPlan(ctx context.Context, collectionID, planID int64) ([]*runv1.Service, error) {
 	label := fmt.Sprintf("collection=%d, plan=%d", collectionID, planID)
-	resp, err := cr.rs.Namespaces.Services.List(cr.nsProjectID).LabelSelector(label).Do()
+	resp, err := cr.rs.Namespaces.Services.List(cr.nsProjectID).LabelSelector(label).Context(ctx).Do()
 	if err != nil {
 		return []*runv1.Service{}, err
 	}
 	return resp.Items, nil
 }
 
-func (cr *CloudRun) CollectionStatus(projectID, collectionID int64, eps []*model.ExecutionPlan) (*smodel.CollectionStatus, error) {
-	items, err := cr.getEnginesByCollection(collectionID)
+func (cr *CloudRun) CollectionStatus(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) (*smodel.CollectionStatus, error) {
+	items, err := cr.getEnginesByCollection(ctx, collectionID)
 	if err != nil {
 		return nil, err
 	}
@@ -291,9 +326,10 @@ func (cr *CloudRun) CollectionStatus(projectID, collectionID int64, eps []*model
 }
 
 // This func is used by generateEngines as we need to fetch the engine urls per plan
-func (cr *CloudRun) FetchEngineUrlsByPlan(collectionID, planID int64, opts *smodel.EngineOwnerRef) ([]string, error) {
+func (cr *CloudRun) FetchEngineUrlsByPlan(ctx context.Context, collectionID, planID int64,
+	opts *smodel.EngineOwnerRef) ([]string, error) {
 	// need to make it get url by plan
-	items, err := cr.getEnginesByCollectionPlan(collectionID, planID)
+	items, err := cr.getEnginesByCollectionPlan(ctx, collectionID, planID)
 	if err != nil {
 		return nil, err
 	}
@@ -304,7 +340,7 @@ func (cr *CloudRun) FetchEngineUrlsByPlan(collectionID, planID int64, opts *smod
 	return m, nil
 }
 
-func (cr *CloudRun) GetDeployedCollections() (map[int64]time.Time, error) {
+func (cr *CloudRun) GetDeployedCollections(ctx context.Context) (map[int64]time.Time, error) {
 	deployCollections := make(map[int64]time.Time)
 	resp, err := cr.rs.Namespaces.Services.List(cr.nsProjectID).Do()
 	if err != nil {
@@ -325,44 +361,93 @@ func (cr *CloudRun) GetDeployedCollections() (map[int64]time.Time, error) {
 	return deployCollections, nil
 }
 
-func (cr *CloudRun) GetPodsMetrics(collectionID, planID int64) (map[string]apiv1.ResourceList, error) {
+func (cr *CloudRun) GetCollectionResources(ctx context.Context) (map[int64]time.Time, error) {
+	collections := make(map[int64]time.Time)
+	resp, err := cr.rs.Namespaces.Services.List(cr.nsProjectID).LabelSelector(collectionLabel).Do()
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range resp.Items {
+		t, err := time.Parse(time.RFC3339, item.Metadata.CreationTimestamp)
+		if err != nil {
+			// A resource we cannot date is treated as a new one, so it's not reaped too early
+			t = time.Now()
+		}
+		addCollectionResource(collections, item.Metadata.Labels, t)
+	}
+	return collections, nil
+}
+
+func (cr *CloudRun) GetPodsMetrics(ctx context.Context, collectionID, planID int64) (map[string]apiv1.ResourceList, error) {
 	// For cloud run, pod metrics is not supported
 	return nil, ErrFeatureUnavailable
 }
 
 // TODO: what we need is actually get the deployed engines account, not only ready ones.
 // We also need to change this in k8s.go
-func (cr *CloudRun) PodReadyCount(collectionID int64) int {
-	items, err := cr.getEnginesByCollection(collectionID)
+func (cr *CloudRun) PodReadyCount(ctx context.Context, collectionID int64) int {
+	items, err := cr.getEnginesByCollection(ctx, collectionID)
 	if err != nil {
 		return 0
 	}
 	return len(items)
 }
 
-func (cr *CloudRun) GetCollectionEnginesDetail(projectID, collectionID int64) (*smodel.CollectionDetails, error) {
+func (cr *CloudRun) EngineCount(ctx context.Context, collectionID int64) (int, error) {
+	items, err := cr.getEnginesByCollection(ctx, collectionID)
+	if err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+func (cr *CloudRun) GetCollectionEnginesDetail(ctx context.Context, projectID, collectionID int64) (*smodel.CollectionDetails, error) {
 	return nil, nil
 }
 
-func (cr *CloudRun) ExposeProject(projectID int64) error {
+func (cr *CloudRun) GetEnginesProgress(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) ([]*smodel.EngineProgress, error) {
+	return nil, ErrFeatureUnavailable
+}
+
+func (cr *CloudRun) RenderPlan(projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) ([]runtime.Object, error) {
+	// The engines are cloud run services, there are no manifests to review
+	return nil, ErrFeatureUnavailable
+}
+
+func (cr *CloudRun) CollectionCompleted(ctx context.Context, collectionID int64) (bool, error) {
+	// The engines only run as jobs in kubernetes
+	return false, ErrFeatureUnavailable
+}
+
+func (cr *CloudRun) ProvisionTenant(ctx context.Context, tenant *model.Tenant) error {
+	// Cloud run services of all the tenants live in the same project
+	return ErrFeatureUnavailable
+}
+
+func (cr *CloudRun) GetClusterCapacity(ctx context.Context) (*smodel.ClusterCapacity, error) {
+	// Cloud run scales by itself, there are no nodes to look at
+	return nil, ErrFeatureUnavailable
+}
+
+func (cr *CloudRun) ExposeProject(ctx context.Context, projectID int64) error {
 	return nil
 }
 
-func (cr *CloudRun) PurgeProjectIngress(projectID int64) error {
+func (cr *CloudRun) PurgeProjectIngress(ctx context.Context, projectID int64) error {
 	return nil
 }
 
-func (cr *CloudRun) GetDeployedServices() (map[int64]time.Time, error) {
+func (cr *CloudRun) GetDeployedServices(ctx context.Context) (map[int64]time.Time, error) {
 	return nil, nil
 }
 
-func (cr *CloudRun) GetEnginesByProject(projectID int64) ([]apiv1.Pod, error) {
+func (cr *CloudRun) GetEnginesByProject(ctx context.Context, projectID int64) ([]apiv1.Pod, error) {
 	return nil, nil
 }
 
-func (cr *CloudRun) DownloadPodLog(collectionID, planID int64) (string, error) {
+func (cr *CloudRun) DownloadPodLog(ctx context.Context, collectionID, planID int64) (string, error) {
 	// Cloud run API does not support fetching the logs now.
-	engines, err := cr.getEnginesByCollectionPlan(collectionID, planID)
+	engines, err := cr.getEnginesByCollectionPlan(ctx, collectionID, planID)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,506 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
+)
+
+const (
+	dockerSocket     = "/var/run/docker.sock"
+	dockerEnginePort = "8080/tcp"
+	// The engines download the test files from the platform running on the host
+	dockerHostGateway = "host.docker.internal:host-gateway"
+)
+
+// Docker runs the engines as containers of the local docker daemon, for the local mode. The port of each engine
+// is published on the loopback interface, which is how the controller reaches it.
+type Docker struct {
+	client *http.Client
+}
+
+func NewDocker(cfg *config.ClusterConfig) *Docker {
+	d := &Docker{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", dockerSocket)
+				},
+			},
+			Timeout: 5 * time.Minute,
+		},
+	}
+	// The start waits for docker to be reachable, see controller.WaitForDependencies
+	if err := d.Ping(context.Background()); err != nil {
+		log.Warnf("Cannot reach docker at %s, the local mode runs the engines in docker: %v", dockerSocket, err)
+	}
+	return d
+}
+
+func (d *Docker) Ping(ctx context.Context) error {
+	return d.do(ctx, http.MethodGet, "/_ping", nil, nil, nil)
+}
+
+type dockerPort struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+type dockerContainer struct {
+	ID      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Labels  map[string]string `json:"Labels"`
+	State   string            `json:"State"`
+	Created int64             `json:"Created"`
+	Ports   []dockerPort      `json:"Ports"`
+}
+
+func (dc *dockerContainer) createdTime() time.Time {
+	return time.Unix(dc.Created, 0)
+}
+
+func (dc *dockerContainer) name() string {
+	if len(dc.Names) == 0 {
+		return dc.ID
+	}
+	return strings.TrimPrefix(dc.Names[0], "/")
+}
+
+// engineURL is where the engine is published on the host
+func (dc *dockerContainer) engineURL() string {
+	for _, p := range dc.Ports {
+		if fmt.Sprintf("%d/%s", p.PrivatePort, p.Type) == dockerEnginePort && p.PublicPort != 0 {
+			return fmt.Sprintf("127.0.0.1:%d", p.PublicPort)
+		}
+	}
+	return ""
+}
+
+func (dc *dockerContainer) engineID() int {
+	name := dc.name()
+	id, err := strconv.Atoi(name[strings.LastIndex(name, "-")+1:])
+	if err != nil {
+		return -1
+	}
+	return id
+}
+
+type dockerError struct {
+	Message string `json:"message"`
+}
+
+// do sends the request to the daemon and decodes its response into out, when it's not nil
+func (d *Docker) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	u := url.URL{Scheme: "http", Host: "docker", Path: path, RawQuery: query.Encode()}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		de := new(dockerError)
+		if err := json.NewDecoder(resp.Body).Decode(de); err != nil || de.Message == "" {
+			de.Message = resp.Status
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return &NoResourcesFoundErr{Message: de.Message}
+		}
+		return fmt.Errorf("docker responded with %d: %s", resp.StatusCode, de.Message)
+	}
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (d *Docker) listContainers(ctx context.Context, labels ...string) ([]*dockerContainer, error) {
+	filters, err := json.Marshal(map[string][]string{"label": labels})
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	query.Set("all", "true")
+	query.Set("filters", string(filters))
+	containers := []*dockerContainer{}
+	if err := d.do(ctx, http.MethodGet, "/containers/json", query, nil, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+func (d *Docker) listEngines(ctx context.Context, collectionID int64, labels ...string) ([]*dockerContainer, error) {
+	labels = append(labels, "kind=executor", makeCollectionLabel(collectionID))
+	return d.listContainers(ctx, labels...)
+}
+
+func (d *Docker) pullImage(ctx context.Context, image string) error {
+	query := url.Values{}
+	query.Set("fromImage", image)
+	return d.do(ctx, http.MethodPost, "/images/create", query, nil, nil)
+}
+
+func makeDockerContainer(engineName string, labels map[string]string, containerConfig *config.ExecutorContainer) (map[string]interface{}, error) {
+	hostConfig := map[string]interface{}{
+		"PortBindings": map[string]interface{}{
+			dockerEnginePort: []map[string]string{{"HostIp": "127.0.0.1", "HostPort": ""}},
+		},
+		"ExtraHosts": []string{dockerHostGateway},
+	}
+	if containerConfig.CPU != "" {
+		cpu, err := resource.ParseQuantity(containerConfig.CPU)
+		if err != nil {
+			return nil, err
+		}
+		hostConfig["NanoCpus"] = cpu.MilliValue() * 1000000
+	}
+	if containerConfig.Mem != "" {
+		mem, err := resource.ParseQuantity(containerConfig.Mem)
+		if err != nil {
+			return nil, err
+		}
+		hostConfig["Memory"] = mem.Value()
+	}
+	return map[string]interface{}{
+		"Hostname":     engineName,
+		"Image":        containerConfig.Image,
+		"Labels":       labels,
+		"ExposedPorts": map[string]interface{}{dockerEnginePort: struct{}{}},
+		"HostConfig":   hostConfig,
+	}, nil
+}
+
+func (d *Docker) DeployEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error {
+	engineName := makeEngineName(projectID, collectionID, planID, engineID)
+	labels := makeEngineLabel(projectID, collectionID, planID, engineName)
+	container, err := makeDockerContainer(engineName, labels, containerConfig)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	query.Set("name", engineName)
+	created := struct {
+		ID string `json:"Id"`
+	}{}
+	err = d.do(ctx, http.MethodPost, "/containers/create", query, container, &created)
+	if errors.As(err, new(*NoResourcesFoundErr)) {
+		// The image is not on the machine yet
+		if err := d.pullImage(ctx, containerConfig.Image); err != nil {
+			return err
+		}
+		err = d.do(ctx, http.MethodPost, "/containers/create", query, container, &created)
+	}
+	if err != nil {
+		return err
+	}
+	return d.do(ctx, http.MethodPost, fmt.Sprintf("/containers/%s/start", created.ID), nil, nil, nil)
+}
+
+func (d *Docker) DeployPlan(ctx context.Context, projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) error {
+	for i := 0; i < replicas; i++ {
+		if err := d.DeployEngine(ctx, projectID, collectionID, planID, i, containerConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Docker) CollectionStatus(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) (*smodel.CollectionStatus, error) {
+	planStatuses := initializePlanStatuses(eps)
+	cs := &smodel.CollectionStatus{}
+	engines, err := d.listEngines(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	enginesReady := true
+	for _, e := range engines {
+		planID, err := strconv.ParseInt(e.Labels["plan"], 10, 64)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		if ps, ok := planStatuses[planID]; ok {
+			ps.EnginesDeployed++
+		}
+		if e.State != "running" {
+			enginesReady = false
+		}
+	}
+	if !enginesReady || len(eps) == 0 {
+		for _, ps := range planStatuses {
+			cs.Plans = append(cs.Plans, ps)
+		}
+		return cs, nil
+	}
+	engineReachable := false
+	engineUrls, err := d.FetchEngineUrlsByPlan(ctx, collectionID, eps[0].PlanID, nil)
+	if err == nil && len(engineUrls) > 0 {
+		engineReachable = d.ServiceReachable(engineUrls[0])
+	}
+	cs.Plans = collectPlanStatuses(collectionID, eps, planStatuses, engineReachable)
+	return cs, nil
+}
+
+func (d *Docker) ServiceReachable(engineUrl string) bool {
+	resp, err := http.Get(fmt.Sprintf("http://%s/start", engineUrl))
+	if err != nil {
+		log.Warn(err)
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// FetchEngineUrlsByPlan returns the urls of the running engines of the plan in the order of their ids
+func (d *Docker) FetchEngineUrlsByPlan(ctx context.Context, collectionID, planID int64,
+	opts *smodel.EngineOwnerRef) ([]string, error) {
+	engines, err := d.listEngines(ctx, collectionID, fmt.Sprintf("plan=%d", planID))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(engines, func(i, j int) bool {
+		return engines[i].engineID() < engines[j].engineID()
+	})
+	urls := []string{}
+	for _, e := range engines {
+		if u := e.engineURL(); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
+func (d *Docker) PurgeCollection(ctx context.Context, collectionID int64) error {
+	containers, err := d.listContainers(ctx, makeCollectionLabel(collectionID))
+	if err != nil {
+		return err
+	}
+	var lastError error
+	query := url.Values{}
+	query.Set("force", "true")
+	for _, c := range containers {
+		if err := d.do(ctx, http.MethodDelete, "/containers/"+c.ID, query, nil, nil); err != nil {
+			log.Error(err)
+			lastError = err
+		}
+	}
+	return lastError
+}
+
+func (d *Docker) PurgePlan(ctx context.Context, collectionID, planID int64) error {
+	containers, err := d.listEngines(ctx, collectionID, fmt.Sprintf("plan=%d", planID))
+	if err != nil {
+		return err
+	}
+	var lastError error
+	query := url.Values{}
+	query.Set("force", "true")
+	for _, c := range containers {
+		if err := d.do(ctx, http.MethodDelete, "/containers/"+c.ID, query, nil, nil); err != nil {
+			log.Error(err)
+			lastError = err
+		}
+	}
+	return lastError
+}
+
+func (d *Docker) ReplaceEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error {
+	query := url.Values{}
+	query.Set("force", "true")
+	engineName := makeEngineName(projectID, collectionID, planID, engineID)
+	err := d.do(ctx, http.MethodDelete, "/containers/"+engineName, query, nil, nil)
+	if err != nil && !errors.As(err, new(*NoResourcesFoundErr)) {
+		return err
+	}
+	return d.DeployEngine(ctx, projectID, collectionID, planID, engineID, containerConfig)
+}
+
+func (d *Docker) GetDeployedCollections(ctx context.Context) (map[int64]time.Time, error) {
+	containers, err := d.listContainers(ctx, "kind=executor")
+	if err != nil {
+		return nil, err
+	}
+	deployedCollections := make(map[int64]time.Time)
+	for _, c := range containers {
+		collectionID, err := strconv.ParseInt(c.Labels["collection"], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		deployedCollections[collectionID] = c.createdTime()
+	}
+	return deployedCollections, nil
+}
+
+func (d *Docker) GetCollectionResources(ctx context.Context) (map[int64]time.Time, error) {
+	containers, err := d.listContainers(ctx, collectionLabel)
+	if err != nil {
+		return nil, err
+	}
+	collections := make(map[int64]time.Time)
+	for _, c := range containers {
+		addCollectionResource(collections, c.Labels, c.createdTime())
+	}
+	return collections, nil
+}
+
+func (d *Docker) GetPodsMetrics(ctx context.Context, collectionID, planID int64) (map[string]apiv1.ResourceList, error) {
+	// The usage of the engines is in docker stats, the metrics server of kubernetes is not there
+	return nil, ErrFeatureUnavailable
+}
+
+func (d *Docker) PodReadyCount(ctx context.Context, collectionID int64) int {
+	engines, err := d.listEngines(ctx, collectionID)
+	if err != nil {
+		log.Warn(err)
+	}
+	ready := 0
+	for _, e := range engines {
+		if e.State == "running" {
+			ready++
+		}
+	}
+	return ready
+}
+
+func (d *Docker) EngineCount(ctx context.Context, collectionID int64) (int, error) {
+	engines, err := d.listEngines(ctx, collectionID)
+	if err != nil {
+		return 0, err
+	}
+	return len(engines), nil
+}
+
+// demuxDockerLog strips the headers docker puts in front of each chunk of the output of a container without tty
+func demuxDockerLog(r io.Reader) (string, error) {
+	var out strings.Builder
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return out.String(), nil
+		} else if err != nil {
+			return "", err
+		}
+		size := binary.BigEndian.Uint32(header[4:])
+		if _, err := io.CopyN(&out, r, int64(size)); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (d *Docker) DownloadPodLog(ctx context.Context, collectionID, planID int64) (string, error) {
+	engines, err := d.listEngines(ctx, collectionID, fmt.Sprintf("plan=%d", planID))
+	if err != nil {
+		return "", err
+	}
+	if len(engines) == 0 {
+		return "", &NoResourcesFoundErr{Message: "Cannot find the engines"}
+	}
+	u := url.URL{Scheme: "http", Host: "docker", Path: fmt.Sprintf("/containers/%s/logs", engines[0].ID),
+		RawQuery: "stdout=true&stderr=true"}
+	resp, err := d.client.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("docker responded with %d", resp.StatusCode)
+	}
+	return demuxDockerLog(resp.Body)
+}
+
+func (d *Docker) GetCollectionEnginesDetail(ctx context.Context, projectID, collectionID int64) (*smodel.CollectionDetails, error) {
+	engines, err := d.listEngines(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(engines) == 0 {
+		return nil, &NoResourcesFoundErr{Message: "Cannot find the engines"}
+	}
+	collectionDetails := &smodel.CollectionDetails{IngressIP: "127.0.0.1"}
+	for _, e := range engines {
+		collectionDetails.Engines = append(collectionDetails.Engines, &smodel.EngineStatus{
+			Name:        e.name(),
+			Status:      e.State,
+			CreatedTime: e.createdTime(),
+		})
+	}
+	return collectionDetails, nil
+}
+
+func (d *Docker) GetEnginesProgress(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) ([]*smodel.EngineProgress, error) {
+	return nil, ErrFeatureUnavailable
+}
+
+func (d *Docker) GetClusterCapacity(ctx context.Context) (*smodel.ClusterCapacity, error) {
+	return nil, ErrFeatureUnavailable
+}
+
+func (d *Docker) RenderPlan(projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) ([]runtime.Object, error) {
+	// The engines are plain containers, there are no manifests to review
+	return nil, ErrFeatureUnavailable
+}
+
+func (d *Docker) CollectionCompleted(ctx context.Context, collectionID int64) (bool, error) {
+	// The engines only run as jobs in kubernetes
+	return false, ErrFeatureUnavailable
+}
+
+func (d *Docker) ProvisionTenant(ctx context.Context, tenant *model.Tenant) error {
+	// There are no namespaces in docker
+	return ErrFeatureUnavailable
+}
+
+// The engines are published on the host, they do not need an ingress
+func (d *Docker) ExposeProject(ctx context.Context, projectID int64) error {
+	return nil
+}
+
+func (d *Docker) PurgeProjectIngress(ctx context.Context, projectID int64) error {
+	return nil
+}
+
+func (d *Docker) GetDeployedServices(ctx context.Context) (map[int64]time.Time, error) {
+	return nil, nil
+}
+
+func (d *Docker) GetEnginesByProject(ctx context.Context, projectID int64) ([]apiv1.Pod, error) {
+	return nil, nil
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func dockerLogChunk(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDemuxDockerLog(t *testing.T) {
+	raw := append(dockerLogChunk(1, "starting jmeter\n"), dockerLogChunk(2, "warning\n")...)
+	out, err := demuxDockerLog(bytes.NewReader(raw))
+	assert.NoError(t, err)
+	assert.Equal(t, "starting jmeter\nwarning\n", out)
+
+	out, err = demuxDockerLog(bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+
+	// A chunk shorter than its header says is a truncated log
+	_, err = demuxDockerLog(bytes.NewReader(dockerLogChunk(1, "starting jmeter")[:12]))
+	assert.Error(t, err)
+}
+
+func TestMakeDockerContainer(t *testing.T) {
+	labels := map[string]string{"collection": "2"}
+	c, err := makeDockerContainer("engine-1-2-3-0", labels, &config.ExecutorContainer{
+		Image: "setagaya:jmeter",
+		CPU:   "500m",
+		Mem:   "1Gi",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "setagaya:jmeter", c["Image"])
+	assert.Equal(t, labels, c["Labels"])
+	hostConfig := c["HostConfig"].(map[string]interface{})
+	assert.Equal(t, int64(500000000), hostConfig["NanoCpus"])
+	assert.Equal(t, int64(1<<30), hostConfig["Memory"])
+	assert.Equal(t, []string{dockerHostGateway}, hostConfig["ExtraHosts"])
+
+	c, err = makeDockerContainer("engine-1-2-3-0", labels, &config.ExecutorContainer{Image: "setagaya:jmeter"})
+	assert.NoError(t, err)
+	hostConfig = c["HostConfig"].(map[string]interface{})
+	assert.NotContains(t, hostConfig, "NanoCpus")
+	assert.NotContains(t, hostConfig, "Memory")
+
+	_, err = makeDockerContainer("engine-1-2-3-0", labels, &config.ExecutorContainer{Image: "setagaya:jmeter", CPU: "a lot"})
+	assert.Error(t, err)
+}
@@ -3,6 +3,8 @@ package scheduler
 import (
 	"errors"
 	"fmt"
+
+	"github.com/hveda/Setagaya/setagaya/model"
 )
 
 var (
@@ -17,6 +19,7 @@ func makeIPNotAssignedError() error {
 	return fmt.Errorf("%w%s", ErrIngress, "IP is not assigned yet")
 }
 
+// NoResourcesFoundErr is returned when the engines or the nodes of the collection cannot be found
 type NoResourcesFoundErr struct {
 	Err     error
 	Message string
@@ -25,3 +28,11 @@ type NoResourcesFoundErr struct {
 func (e *NoResourcesFoundErr) Error() string {
 	return e.Message
 }
+
+func (e *NoResourcesFoundErr) Unwrap() error {
+	return e.Err
+}
+
+func (e *NoResourcesFoundErr) Is(target error) bool {
+	return target == model.ErrNotFound
+}
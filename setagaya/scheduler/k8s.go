@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"context"
+	"encoding/json"
 	e "errors"
 	"fmt"
 	"io"
@@ -14,16 +15,22 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/engines/containerstats"
+	"github.com/hveda/Setagaya/setagaya/engines/runonce"
+	"github.com/hveda/Setagaya/setagaya/engines/sidecar"
 	model "github.com/hveda/Setagaya/setagaya/model"
 	"github.com/hveda/Setagaya/setagaya/object_storage"
 	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	apiv1 "k8s.io/api/core/v1"
 	v1networking "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
 	metricsc "k8s.io/metrics/pkg/client/clientset/versioned"
@@ -31,9 +38,11 @@ import (
 
 type K8sClientManager struct {
 	*config.ExecutorConfig
-	client         *kubernetes.Clientset
+	client         kubernetes.Interface
 	metricClient   *metricsc.Clientset
 	serviceAccount string
+	// Region of the cluster, empty when it is not configured
+	region string
 }
 
 func NewK8sClientManager(cfg *config.ClusterConfig) *K8sClientManager {
@@ -52,12 +61,22 @@ func NewK8sClientManager(cfg *config.ClusterConfig) *K8sClientManager {
 		executorConfig = config.SC.ExecutorConfig
 	}
 
-	return &K8sClientManager{
+	kcm := &K8sClientManager{
 		ExecutorConfig: executorConfig,
-		client:         c,
 		metricClient:   metricsc,
 		serviceAccount: "setagaya-ingress-serviceaccount-1",
+		region:         cfg.Region,
 	}
+	// Left nil without a client, Ping tells it
+	if c != nil {
+		kcm.client = c
+	}
+	return kcm
+}
+
+// Region is where the nodes of the cluster, hence the engines, run
+func (kcm *K8sClientManager) Region() string {
+	return kcm.region
 }
 
 func makeNodeAffinity(key, value string) *apiv1.NodeAffinity {
@@ -152,6 +171,27 @@ func prepareTolerations() []apiv1.Toleration {
 	return tolerations
 }
 
+// scheduleOnWindows moves the engines to the windows nodes. The node affinity of the config targets the nodes of
+// the linux engines, and the security context only has linux options, which windows pods cannot have.
+func scheduleOnWindows(spec *apiv1.PodSpec) {
+	spec.OS = &apiv1.PodOS{Name: apiv1.Windows}
+	spec.NodeSelector = map[string]string{apiv1.LabelOSStable: string(apiv1.Windows)}
+	if spec.Affinity != nil {
+		spec.Affinity.NodeAffinity = nil
+	}
+	// The windows nodes are usually tainted so the linux pods stay away from them
+	spec.Tolerations = append(spec.Tolerations, apiv1.Toleration{
+		Key:      apiv1.LabelOSStable,
+		Operator: apiv1.TolerationOpEqual,
+		Value:    string(apiv1.Windows),
+		Effect:   apiv1.TaintEffectNoSchedule,
+	})
+	spec.SecurityContext = nil
+	for i := range spec.Containers {
+		spec.Containers[i].SecurityContext = nil
+	}
+}
+
 func (kcm *K8sClientManager) makeHostAliases() []apiv1.HostAlias {
 	if kcm.ExecutorConfig != nil && kcm.HostAliases != nil {
 		hostAliases := []apiv1.HostAlias{}
@@ -166,15 +206,269 @@ func (kcm *K8sClientManager) makeHostAliases() []apiv1.HostAlias {
 	return []apiv1.HostAlias{}
 }
 
-func (kcm *K8sClientManager) generatePlanDeployment(planName string, replicas int, labels map[string]string, containerConfig *config.ExecutorContainer,
-	affinity *apiv1.Affinity, tolerations []apiv1.Toleration, envvars []apiv1.EnvVar) appsv1.StatefulSet {
-	t := true
+// engineScratchVolumes are where the engines write, so they can run with a read-only root filesystem. The results
+// also outlive the restarts of the engine container so the agent can resume reading them.
+func engineScratchVolumes() ([]apiv1.Volume, []apiv1.VolumeMount) {
 	volumes := []apiv1.Volume{}
 	volumeMounts := []apiv1.VolumeMount{}
-	if object_storage.IsProviderGCP() {
+	for _, v := range []struct{ name, mountPath string }{
+		{"setagaya-results", "/test-result"},
+		{"setagaya-test-data", "/test-data"},
+		{"setagaya-tmp", "/tmp"},
+	} {
+		volumes = append(volumes, apiv1.Volume{
+			Name: v.name,
+			VolumeSource: apiv1.VolumeSource{
+				EmptyDir: &apiv1.EmptyDirVolumeSource{},
+			},
+		})
+		volumeMounts = append(volumeMounts, apiv1.VolumeMount{
+			Name:      v.name,
+			MountPath: v.mountPath,
+		})
+	}
+	return volumes, volumeMounts
+}
+
+// makeSecurityContexts turns the security context of the engines into the ones of their pod and their container
+func makeSecurityContexts(esc *config.EngineSecurityContext) (*apiv1.PodSecurityContext, *apiv1.SecurityContext) {
+	if esc == nil {
+		return nil, nil
+	}
+	t, f := true, false
+	psc := &apiv1.PodSecurityContext{
+		RunAsUser:  esc.RunAsUser,
+		RunAsGroup: esc.RunAsGroup,
+		FSGroup:    esc.FSGroup,
+	}
+	if esc.RunAsNonRoot {
+		psc.RunAsNonRoot = &t
+	}
+	if esc.SeccompProfile != "" {
+		profile := &apiv1.SeccompProfile{Type: apiv1.SeccompProfileType(esc.SeccompProfile)}
+		if name, ok := strings.CutPrefix(esc.SeccompProfile, "Localhost/"); ok {
+			profile.Type = apiv1.SeccompProfileTypeLocalhost
+			profile.LocalhostProfile = &name
+		}
+		psc.SeccompProfile = profile
+	}
+	csc := &apiv1.SecurityContext{}
+	if esc.ReadOnlyRootFilesystem {
+		csc.ReadOnlyRootFilesystem = &t
+	}
+	if esc.DisallowPrivilegeEscalation {
+		csc.AllowPrivilegeEscalation = &f
+	}
+	if len(esc.DropCapabilities) > 0 {
+		csc.Capabilities = &apiv1.Capabilities{}
+		for _, c := range esc.DropCapabilities {
+			csc.Capabilities.Drop = append(csc.Capabilities.Drop, apiv1.Capability(c))
+		}
+	}
+	return psc, csc
+}
+
+// makeImagePullSecrets returns the pull secret of the executors followed by the ones of the container
+func (kcm *K8sClientManager) makeImagePullSecrets(containerConfig *config.ExecutorContainer) []apiv1.LocalObjectReference {
+	refs := []apiv1.LocalObjectReference{}
+	seen := make(map[string]bool)
+	for _, name := range append([]string{kcm.ImagePullSecret}, containerConfig.ImagePullSecrets...) {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		refs = append(refs, apiv1.LocalObjectReference{Name: name})
+	}
+	return refs
+}
+
+// checkImagePullSecrets makes sure the pull secrets of the container exist in the namespace and hold registry
+// credentials. Otherwise the engines would be stuck pulling their image rather than failing the deployment.
+func (kcm *K8sClientManager) checkImagePullSecrets(ctx context.Context, namespace string,
+	containerConfig *config.ExecutorContainer) error {
+	for _, name := range containerConfig.ImagePullSecrets {
+		secret, err := kcm.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return fmt.Errorf("image pull secret %s does not exist in namespace %s", name, namespace)
+			}
+			return err
+		}
+		if secret.Type != apiv1.SecretTypeDockerConfigJson && secret.Type != apiv1.SecretTypeDockercfg {
+			return fmt.Errorf("secret %s is of type %s, image pull secrets should hold registry credentials", name, secret.Type)
+		}
+	}
+	return nil
+}
+
+// engineSecurityContext is the security context of the engines of the project, or the one of the config when
+// the project has none
+func (kcm *K8sClientManager) engineSecurityContext(projectID int64) *config.EngineSecurityContext {
+	esc, err := model.GetProjectSecurityContext(projectID)
+	if err != nil {
+		log.Warnf("Cannot get the security context of project %d, using the default one: %v", projectID, err)
+	}
+	if esc != nil {
+		return esc
+	}
+	return kcm.SecurityContext
+}
+
+const enginePort = "8080"
+
+// serviceMeshAnnotations leave the port of the engines out of the mesh, as the proxy breaks the streaming of the
+// metrics, and hold the engines until the sidecar is up
+func serviceMeshAnnotations(sm *config.ServiceMesh) map[string]string {
+	if sm == nil {
+		return nil
+	}
+	switch sm.Kind {
+	case config.ServiceMeshIstio:
+		return map[string]string{
+			"traffic.sidecar.istio.io/excludeInboundPorts": enginePort,
+			"proxy.istio.io/config":                        `{"holdApplicationUntilProxyStarts": true}`,
+		}
+	case config.ServiceMeshLinkerd:
+		return map[string]string{
+			"config.linkerd.io/skip-inbound-ports": enginePort,
+			"config.linkerd.io/proxy-await":        "enabled",
+		}
+	}
+	return nil
+}
+
+// serviceMeshEnvvars tell the engines how to wait for the sidecar before a run and how to stop it
+func serviceMeshEnvvars(sm *config.ServiceMesh) []apiv1.EnvVar {
+	if sm == nil {
+		return nil
+	}
+	var readyURL, quitURL string
+	switch sm.Kind {
+	case config.ServiceMeshIstio:
+		readyURL, quitURL = "http://localhost:15021/healthz/ready", "http://localhost:15020/quitquitquit"
+	case config.ServiceMeshLinkerd:
+		readyURL, quitURL = "http://localhost:4191/ready", "http://localhost:4191/shutdown"
+	default:
+		return nil
+	}
+	return []apiv1.EnvVar{
+		{Name: sidecar.ReadyURLEnv, Value: readyURL},
+		{Name: sidecar.QuitURLEnv, Value: quitURL},
+		{Name: sidecar.ReadyTimeoutEnv, Value: strconv.Itoa(sm.ReadyTimeout)},
+	}
+}
+
+// cpuFactorEnvvars tell the engines what a core of the architecture they run on is worth, so they report their cpu
+// usage in amd64 cores
+func cpuFactorEnvvars(factors map[string]float64) []apiv1.EnvVar {
+	if len(factors) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(factors)
+	if err != nil {
+		return nil
+	}
+	return []apiv1.EnvVar{{Name: containerstats.CPUFactorsEnv, Value: string(raw)}}
+}
+
+// scheduleOnArch keeps the engines on the nodes of the architecture the plan chose. The nodes of the architectures
+// the cluster does not run on by default are usually tainted, like the arm64 nodes of GKE
+func scheduleOnArch(spec *apiv1.PodSpec, arch string) {
+	if arch == "" {
+		return
+	}
+	if spec.NodeSelector == nil {
+		spec.NodeSelector = map[string]string{}
+	}
+	spec.NodeSelector[apiv1.LabelArchStable] = arch
+	spec.Tolerations = append(spec.Tolerations, apiv1.Toleration{
+		Key:      apiv1.LabelArchStable,
+		Operator: apiv1.TolerationOpEqual,
+		Value:    arch,
+		Effect:   apiv1.TaintEffectNoSchedule,
+	})
+}
+
+// shapeNetwork adds the init container shaping the egress network of the engines with tc. The qdisc stays on the
+// interface of the pod, which its containers share, so the engine itself does not need the NET_ADMIN capability
+func (kcm *K8sClientManager) shapeNetwork(spec *apiv1.PodSpec, ns *config.NetworkShaping) {
+	if ns == nil || kcm.NetworkShaper == nil {
+		return
+	}
+	root := int64(0)
+	nonRoot := false
+	noEscalation := false
+	command := append([]string{"tc", "qdisc", "replace", "dev", kcm.NetworkShaper.Device, "root", "netem"}, ns.NetemArgs()...)
+	// The namespaces with a resource quota only take the containers setting their resources
+	resources := apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse("10m"),
+		apiv1.ResourceMemory: resource.MustParse("16Mi"),
+	}
+	spec.InitContainers = append(spec.InitContainers, apiv1.Container{
+		Name:            "shape-network",
+		Image:           kcm.NetworkShaper.Image,
+		ImagePullPolicy: kcm.ImagePullPolicy,
+		Command:         command,
+		SecurityContext: &apiv1.SecurityContext{
+			RunAsUser:                &root,
+			RunAsNonRoot:             &nonRoot,
+			AllowPrivilegeEscalation: &noEscalation,
+			Capabilities: &apiv1.Capabilities{
+				Add:  []apiv1.Capability{"NET_ADMIN"},
+				Drop: []apiv1.Capability{"ALL"},
+			},
+		},
+		Resources: apiv1.ResourceRequirements{Limits: resources, Requests: resources},
+	})
+	for i := range spec.Containers {
+		spec.Containers[i].Env = append(spec.Containers[i].Env, apiv1.EnvVar{Name: config.NetworkShapingEnv, Value: ns.String()})
+	}
+}
+
+// projectMetadata is the labels and the annotations the project adds to its engine resources, nil when it has none
+func (kcm *K8sClientManager) projectMetadata(projectID int64) *model.ProjectMetadata {
+	pm, err := model.GetProjectMetadata(projectID)
+	if err != nil {
+		log.Warnf("Cannot get the metadata of project %d, deploying without: %v", projectID, err)
+	}
+	return pm
+}
+
+// mergeMetadata returns a new map with the entries of both, the ones of base win
+func mergeMetadata(extra, base map[string]string) map[string]string {
+	if len(extra) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(extra)+len(base))
+	for k, v := range extra {
+		merged[k] = v
+	}
+	for k, v := range base {
+		merged[k] = v
+	}
+	return merged
+}
+
+// applyProjectMetadata adds the labels and the annotations of the project to the object. The maps of the object
+// are replaced rather than updated, as they can be shared with the selectors.
+func applyProjectMetadata(om *metav1.ObjectMeta, pm *model.ProjectMetadata) {
+	if pm == nil {
+		return
+	}
+	om.Labels = mergeMetadata(pm.Labels, om.Labels)
+	om.Annotations = mergeMetadata(pm.Annotations, om.Annotations)
+}
+
+func (kcm *K8sClientManager) generatePlanDeployment(planName string, replicas int, labels map[string]string, containerConfig *config.ExecutorContainer,
+	affinity *apiv1.Affinity, tolerations []apiv1.Toleration, envvars []apiv1.EnvVar, esc *config.EngineSecurityContext) appsv1.StatefulSet {
+	t := true
+	volumes, volumeMounts := engineScratchVolumes()
+	podSecurityContext, securityContext := makeSecurityContexts(esc)
+	// The engines download the files through signed urls when the storage signs them, they don't need its credentials
+	if gcp := object_storage.GCPStorageConfig(); gcp != nil && config.SC.ObjectStorage.SignedURLExpiry() == 0 {
 		volumeName := "setagaya-gcp-auth"
-		secretName := config.SC.ObjectStorage.SecretName
-		authFileName := config.SC.ObjectStorage.AuthFileName
+		secretName := gcp.SecretName
+		authFileName := gcp.AuthFileName
 		mountPath := fmt.Sprintf("/auth/%s", authFileName)
 		v := apiv1.Volume{
 			Name: volumeName,
@@ -210,6 +504,8 @@ func (kcm *K8sClientManager) generatePlanDeployment(planName string, replicas in
 		},
 	}
 	volumes = append(volumes, cmVolume)
+	envvars = append(envvars, serviceMeshEnvvars(kcm.ServiceMesh)...)
+	envvars = append(envvars, cpuFactorEnvvars(kcm.CPUFactors)...)
 	cmVolumeMounts := apiv1.VolumeMount{
 		Name:      cmVolumeName,
 		MountPath: config.ConfigFilePath,
@@ -230,27 +526,26 @@ func (kcm *K8sClientManager) generatePlanDeployment(planName string, replicas in
 			},
 			Template: apiv1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
+					Labels:      labels,
+					Annotations: serviceMeshAnnotations(kcm.ServiceMesh),
 				},
 				Spec: apiv1.PodSpec{
-					Affinity:                     affinity,
-					Tolerations:                  tolerations,
-					ServiceAccountName:           kcm.serviceAccount,
-					AutomountServiceAccountToken: &t,
-					ImagePullSecrets: []apiv1.LocalObjectReference{
-						{
-							Name: kcm.ImagePullSecret,
-						},
-					},
+					Affinity:                      affinity,
+					Tolerations:                   tolerations,
+					ServiceAccountName:            kcm.serviceAccount,
+					AutomountServiceAccountToken:  &t,
+					ImagePullSecrets:              kcm.makeImagePullSecrets(containerConfig),
 					TerminationGracePeriodSeconds: new(int64),
 					HostAliases:                   kcm.makeHostAliases(),
 					Volumes:                       volumes,
+					SecurityContext:               podSecurityContext,
 					Containers: []apiv1.Container{
 						{
 							Name:            planName,
 							Image:           containerConfig.Image,
 							ImagePullPolicy: kcm.ImagePullPolicy,
 							Env:             envvars,
+							SecurityContext: securityContext,
 							Resources: apiv1.ResourceRequirements{
 								Limits: apiv1.ResourceList{
 									apiv1.ResourceCPU:    resource.MustParse(containerConfig.CPU),
@@ -280,8 +575,10 @@ func (kcm *K8sClientManager) generatePlanDeployment(planName string, replicas in
 
 func (kcm *K8sClientManager) generateEngineDeployment(engineName string, labels map[string]string,
 	containerConfig *config.ExecutorContainer, affinity *apiv1.Affinity,
-	tolerations []apiv1.Toleration) appsv1.Deployment {
+	tolerations []apiv1.Toleration, esc *config.EngineSecurityContext) appsv1.Deployment {
 	t := true
+	volumes, volumeMounts := engineScratchVolumes()
+	podSecurityContext, securityContext := makeSecurityContexts(esc)
 	deployment := appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:                       engineName,
@@ -295,25 +592,27 @@ func (kcm *K8sClientManager) generateEngineDeployment(engineName string, labels
 			},
 			Template: apiv1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
+					Labels:      labels,
+					Annotations: serviceMeshAnnotations(kcm.ServiceMesh),
 				},
 				Spec: apiv1.PodSpec{
-					Affinity:                     affinity,
-					Tolerations:                  tolerations,
-					ServiceAccountName:           kcm.serviceAccount,
-					AutomountServiceAccountToken: &t,
-					ImagePullSecrets: []apiv1.LocalObjectReference{
-						{
-							Name: kcm.ImagePullSecret,
-						},
-					},
+					Affinity:                      affinity,
+					Tolerations:                   tolerations,
+					ServiceAccountName:            kcm.serviceAccount,
+					AutomountServiceAccountToken:  &t,
+					ImagePullSecrets:              kcm.makeImagePullSecrets(containerConfig),
 					TerminationGracePeriodSeconds: new(int64),
 					HostAliases:                   kcm.makeHostAliases(),
+					Volumes:                       volumes,
+					SecurityContext:               podSecurityContext,
 					Containers: []apiv1.Container{
 						{
 							Name:            engineName,
 							Image:           containerConfig.Image,
 							ImagePullPolicy: kcm.ImagePullPolicy,
+							Env:             append(serviceMeshEnvvars(kcm.ServiceMesh), cpuFactorEnvvars(kcm.CPUFactors)...),
+							SecurityContext: securityContext,
+							VolumeMounts:    volumeMounts,
 							Resources: apiv1.ResourceRequirements{
 								Limits: apiv1.ResourceList{
 									apiv1.ResourceCPU:    resource.MustParse(containerConfig.CPU),
@@ -340,9 +639,9 @@ func (kcm *K8sClientManager) generateEngineDeployment(engineName string, labels
 	return deployment
 }
 
-func (kcm *K8sClientManager) deploy(deployment *appsv1.Deployment) error {
-	deploymentsClient := kcm.client.AppsV1().Deployments(kcm.Namespace)
-	_, err := deploymentsClient.Create(context.TODO(), deployment, metav1.CreateOptions{})
+func (kcm *K8sClientManager) deploy(ctx context.Context, namespace string, deployment *appsv1.Deployment) error {
+	deploymentsClient := kcm.client.AppsV1().Deployments(namespace)
+	_, err := deploymentsClient.Create(ctx, deployment, metav1.CreateOptions{})
 	if errors.IsAlreadyExists(err) {
 		// do nothing if already exists
 		return nil
@@ -352,17 +651,17 @@ func (kcm *K8sClientManager) deploy(deployment *appsv1.Deployment) error {
 	return nil
 }
 
-func (kcm *K8sClientManager) expose(name string, deployment *appsv1.Deployment) error {
+func (kcm *K8sClientManager) expose(ctx context.Context, namespace, name string, deployment *appsv1.Deployment) error {
 	service := &apiv1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: name,
-			Annotations: map[string]string{
+			Annotations: mergeMetadata(deployment.Annotations, map[string]string{
 				"networking.istio.io/exportTo": ".",
-			},
-			Labels: deployment.Spec.Template.Labels,
+			}),
+			Labels: deployment.Labels,
 		},
 		Spec: apiv1.ServiceSpec{
-			Selector: deployment.Spec.Template.Labels,
+			Selector: deployment.Spec.Selector.MatchLabels,
 			Ports: []apiv1.ServicePort{
 				{
 					Port:       80,
@@ -380,7 +679,7 @@ func (kcm *K8sClientManager) expose(name string, deployment *appsv1.Deployment)
 			service.Spec.Type = apiv1.ServiceTypeLoadBalancer
 		}
 	}
-	_, err := kcm.client.CoreV1().Services(kcm.Namespace).Create(context.TODO(), service, metav1.CreateOptions{})
+	_, err := kcm.client.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{})
 	if errors.IsAlreadyExists(err) {
 		return nil
 	} else if err != nil {
@@ -389,9 +688,9 @@ func (kcm *K8sClientManager) expose(name string, deployment *appsv1.Deployment)
 	return nil
 }
 
-func (kcm *K8sClientManager) getRandomHostIP() (string, error) {
+func (kcm *K8sClientManager) getRandomHostIP(ctx context.Context) (string, error) {
 	podList, err := kcm.client.CoreV1().Pods(kcm.Namespace).
-		List(context.TODO(), metav1.ListOptions{
+		List(ctx, metav1.ListOptions{
 			Limit: 1,
 			// we need to add the selector here because pod's hostIP could be empty if it's in pending state
 			// So we want to only find the pod that is running so it would have hostIP.
@@ -408,8 +707,8 @@ func (kcm *K8sClientManager) getRandomHostIP() (string, error) {
 	}
 }
 
-func (kcm *K8sClientManager) CreateService(serviceName string, engine appsv1.Deployment) error {
-	err := kcm.expose(serviceName, &engine)
+func (kcm *K8sClientManager) CreateService(ctx context.Context, namespace, serviceName string, engine appsv1.Deployment) error {
+	err := kcm.expose(ctx, namespace, serviceName, &engine)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -417,23 +716,37 @@ func (kcm *K8sClientManager) CreateService(serviceName string, engine appsv1.Dep
 	return nil
 }
 
-func (kcm *K8sClientManager) DeployEngine(projectID, collectionID, planID int64,
+func (kcm *K8sClientManager) DeployEngine(ctx context.Context, projectID, collectionID, planID int64,
 	engineID int, containerConfig *config.ExecutorContainer) error {
 	engineName := makeEngineName(projectID, collectionID, planID, engineID)
 	labels := makeEngineLabel(projectID, collectionID, planID, engineName)
 	affinity := prepareAffinity(collectionID)
 	tolerations := prepareTolerations()
-	engineConfig := kcm.generateEngineDeployment(engineName, labels, containerConfig, affinity, tolerations)
-	if err := kcm.deploy(&engineConfig); err != nil && !errors.IsAlreadyExists(err) {
+	engineConfig := kcm.generateEngineDeployment(engineName, labels, containerConfig, affinity, tolerations,
+		kcm.engineSecurityContext(projectID))
+	if containerConfig.OS == model.WindowsOS {
+		scheduleOnWindows(&engineConfig.Spec.Template.Spec)
+	}
+	scheduleOnArch(&engineConfig.Spec.Template.Spec, containerConfig.Arch)
+	kcm.shapeNetwork(&engineConfig.Spec.Template.Spec, containerConfig.NetworkShaping)
+	pm := kcm.projectMetadata(projectID)
+	applyProjectMetadata(&engineConfig.ObjectMeta, pm)
+	applyProjectMetadata(&engineConfig.Spec.Template.ObjectMeta, pm)
+	namespace := kcm.projectNamespace(projectID)
+	if err := kcm.checkImagePullSecrets(ctx, namespace, containerConfig); err != nil {
+		return err
+	}
+	if err := kcm.deploy(ctx, namespace, &engineConfig); err != nil && !errors.IsAlreadyExists(err) {
 		return err
 	}
 	engineSvcName := makeEngineName(projectID, collectionID, planID, engineID)
-	if err := kcm.CreateService(engineSvcName, engineConfig); err != nil {
+	if err := kcm.CreateService(ctx, namespace, engineSvcName, engineConfig); err != nil {
 		return err
 	}
 	ingressClass := makeIngressClass(projectID)
 	ingressName := makeIngressName(projectID, collectionID, planID, engineID)
-	if err := kcm.CreateIngress(ingressClass, ingressName, engineSvcName, collectionID, projectID); err != nil {
+	if err := kcm.CreateIngress(ctx, namespace, ingressClass, ingressName, engineSvcName, collectionID,
+		projectID); err != nil {
 		return err
 	}
 	log.Printf("Finish creating one engine for %s", engineName)
@@ -464,28 +777,137 @@ func (kcm *K8sClientManager) makePlanService(name string, label map[string]strin
 	return service
 }
 
-func (kcm *K8sClientManager) DeployPlan(projectID, collectionID, planID int64, enginesNo int, containerconfig *config.ExecutorContainer) error {
+// planResources are the statefulset of the engines of the plan and the service in front of them
+func (kcm *K8sClientManager) planResources(projectID, collectionID, planID int64, enginesNo int,
+	containerconfig *config.ExecutorContainer) (*appsv1.StatefulSet, *apiv1.Service) {
 	planName := makePlanName(projectID, collectionID, planID)
 	labels := makePlanLabel(projectID, collectionID, planID)
 	affinity := prepareAffinity(collectionID)
 	envvars := prepareEngineMetaEnvvars(collectionID, planID)
 	tolerations := prepareTolerations()
-	planConfig := kcm.generatePlanDeployment(planName, enginesNo, labels, containerconfig, affinity, tolerations, envvars)
-	if _, err := kcm.client.AppsV1().StatefulSets(kcm.Namespace).Create(context.TODO(), &planConfig, metav1.CreateOptions{}); err != nil {
-		return err
+	planConfig := kcm.generatePlanDeployment(planName, enginesNo, labels, containerconfig, affinity, tolerations, envvars,
+		kcm.engineSecurityContext(projectID))
+	if containerconfig.OS == model.WindowsOS {
+		scheduleOnWindows(&planConfig.Spec.Template.Spec)
 	}
+	scheduleOnArch(&planConfig.Spec.Template.Spec, containerconfig.Arch)
+	kcm.shapeNetwork(&planConfig.Spec.Template.Spec, containerconfig.NetworkShaping)
 	service := kcm.makePlanService(planName, labels)
-	if _, err := kcm.client.CoreV1().Services(kcm.Namespace).Create(context.TODO(), service, metav1.CreateOptions{}); err != nil {
+	pm := kcm.projectMetadata(projectID)
+	applyProjectMetadata(&planConfig.ObjectMeta, pm)
+	applyProjectMetadata(&planConfig.Spec.Template.ObjectMeta, pm)
+	applyProjectMetadata(&service.ObjectMeta, pm)
+	return &planConfig, service
+}
+
+// makePlanJob runs the engines of the plan as an indexed job rather than the statefulset, they exit after a single
+// run. The hostnames of its pods are engine-<project>-<collection>-<plan>-<index>, like the names of the pods of
+// the statefulset, so the ingress controller finds the engines alike.
+func (kcm *K8sClientManager) makePlanJob(planConfig *appsv1.StatefulSet) *batchv1.Job {
+	template := planConfig.Spec.Template.DeepCopy()
+	template.Spec.RestartPolicy = apiv1.RestartPolicyNever
+	// The hostnames are only published by the headless service of the plan when it's their subdomain
+	template.Spec.Subdomain = planConfig.Name
+	for i := range template.Spec.Containers {
+		template.Spec.Containers[i].Env = append(template.Spec.Containers[i].Env,
+			apiv1.EnvVar{Name: runonce.Env, Value: "true"})
+	}
+	completionMode := batchv1.IndexedCompletion
+	// The finished jobs are kept as long as the collections are before they are purged
+	ttl := safeIntToInt32(int(kcm.Cluster.GCDuration * 60))
+	return &batchv1.Job{
+		ObjectMeta: *planConfig.ObjectMeta.DeepCopy(),
+		Spec: batchv1.JobSpec{
+			Completions:             planConfig.Spec.Replicas,
+			Parallelism:             planConfig.Spec.Replicas,
+			CompletionMode:          &completionMode,
+			BackoffLimit:            int32Ptr(0),
+			TTLSecondsAfterFinished: &ttl,
+			Template:                *template,
+		},
+	}
+}
+
+// jobFinished tells whether all the engines of the job exited, whether they succeeded or not
+func jobFinished(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == apiv1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// deployPlanJob creates the job of the plan. The job of the previous run is replaced when it's finished, while the
+// service of the plan stays until the collection is purged.
+func (kcm *K8sClientManager) deployPlanJob(ctx context.Context, namespace string, job *batchv1.Job,
+	service *apiv1.Service) error {
+	jobsClient := kcm.client.BatchV1().Jobs(namespace)
+	previous, err := jobsClient.Get(ctx, job.Name, metav1.GetOptions{})
+	switch {
+	case err == nil && jobFinished(previous):
+		// The jobs orphan their pods by default
+		propagation := metav1.DeletePropagationBackground
+		if err := jobsClient.Delete(ctx, job.Name, metav1.DeleteOptions{
+			PropagationPolicy: &propagation,
+		}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	case err != nil && !errors.IsNotFound(err):
+		return err
+	}
+	// Created by an attempt the scheduler retries
+	if _, err := jobsClient.Create(ctx, job, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	if _, err := kcm.client.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (kcm *K8sClientManager) DeployPlan(ctx context.Context, projectID, collectionID, planID int64, enginesNo int,
+	containerconfig *config.ExecutorContainer) error {
+	planConfig, service := kcm.planResources(projectID, collectionID, planID, enginesNo, containerconfig)
+	namespace := kcm.projectNamespace(projectID)
+	if err := kcm.checkImagePullSecrets(ctx, namespace, containerconfig); err != nil {
+		return err
+	}
+	if kcm.RunsOnce() {
+		return kcm.deployPlanJob(ctx, namespace, kcm.makePlanJob(planConfig), service)
+	}
+	// The resources created by a previous attempt are kept when the scheduler retries the deployment
+	if _, err := kcm.client.AppsV1().StatefulSets(namespace).Create(ctx, planConfig, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	if _, err := kcm.client.CoreV1().Services(namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
 		log.Println(err)
 		return err
 	}
 	return nil
 }
 
-func (kcm *K8sClientManager) GetIngressUrl(projectID int64) (string, error) {
+// RenderPlan returns the resources DeployPlan would create for the plan, without creating them
+func (kcm *K8sClientManager) RenderPlan(projectID, collectionID, planID int64, enginesNo int, containerconfig *config.ExecutorContainer) ([]runtime.Object, error) {
+	planConfig, service := kcm.planResources(projectID, collectionID, planID, enginesNo, containerconfig)
+	namespace := kcm.projectNamespace(projectID)
+	service.TypeMeta = metav1.TypeMeta{APIVersion: "v1", Kind: "Service"}
+	service.Namespace = namespace
+	if kcm.RunsOnce() {
+		job := kcm.makePlanJob(planConfig)
+		job.TypeMeta = metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}
+		job.Namespace = namespace
+		return []runtime.Object{job, service}, nil
+	}
+	planConfig.TypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"}
+	planConfig.Namespace = namespace
+	return []runtime.Object{planConfig, service}, nil
+}
+
+func (kcm *K8sClientManager) GetIngressUrl(ctx context.Context, projectID int64) (string, error) {
 	igName := makeIngressClass(projectID)
-	serviceClient, err := kcm.client.CoreV1().Services(kcm.Namespace).
-		Get(context.TODO(), igName, metav1.GetOptions{})
+	serviceClient, err := kcm.client.CoreV1().Services(kcm.projectNamespace(projectID)).
+		Get(ctx, igName, metav1.GetOptions{})
 	if err != nil {
 		return "", makeSchedulerIngressError(err)
 	}
@@ -499,7 +921,7 @@ func (kcm *K8sClientManager) GetIngressUrl(projectID int64) (string, error) {
 		}
 		return serviceClient.Status.LoadBalancer.Ingress[0].IP, nil
 	}
-	ip_addr, err := kcm.getRandomHostIP()
+	ip_addr, err := kcm.getRandomHostIP(ctx)
 	if err != nil {
 		return "", makeSchedulerIngressError(err)
 	}
@@ -507,30 +929,36 @@ func (kcm *K8sClientManager) GetIngressUrl(projectID int64) (string, error) {
 	return fmt.Sprintf("%s:%d", ip_addr, exposedPort), nil
 }
 
-func (kcm *K8sClientManager) GetPods(labelSelector, fieldSelector string) ([]apiv1.Pod, error) {
-	podsClient, err := kcm.client.CoreV1().Pods(kcm.Namespace).
-		List(context.TODO(), metav1.ListOptions{
+func (kcm *K8sClientManager) getPods(ctx context.Context, labelSelector, fieldSelector string) ([]apiv1.Pod, error) {
+	podsClient, err := kcm.client.CoreV1().Pods(kcm.listNamespace()).
+		List(ctx, metav1.ListOptions{
 			LabelSelector: labelSelector,
 			FieldSelector: fieldSelector,
 		})
 	if err != nil {
 		return nil, err
 	}
-	return podsClient.Items, nil
+	pods := []apiv1.Pod{}
+	for _, pod := range podsClient.Items {
+		if kcm.ownsNamespace(pod.Namespace) {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
 }
 
-func (kcm *K8sClientManager) GetPodsByCollection(collectionID int64, fieldSelector string) []apiv1.Pod {
+func (kcm *K8sClientManager) GetPodsByCollection(ctx context.Context, collectionID int64, fieldSelector string) []apiv1.Pod {
 	labelSelector := fmt.Sprintf("collection=%d", collectionID)
-	pods, err := kcm.GetPods(labelSelector, fieldSelector)
+	pods, err := kcm.getPods(ctx, labelSelector, fieldSelector)
 	if err != nil {
 		log.Warn(err)
 	}
 	return pods
 }
 
-func (kcm *K8sClientManager) GetEnginesByProject(projectID int64) ([]apiv1.Pod, error) {
+func (kcm *K8sClientManager) GetEnginesByProject(ctx context.Context, projectID int64) ([]apiv1.Pod, error) {
 	labelSelector := fmt.Sprintf("project=%d, kind=executor", projectID)
-	pods, err := kcm.GetPods(labelSelector, "")
+	pods, err := kcm.getPods(ctx, labelSelector, "")
 	if err != nil {
 		return nil, err
 	}
@@ -542,8 +970,9 @@ func (kcm *K8sClientManager) GetEnginesByProject(projectID int64) ([]apiv1.Pod,
 	return pods, nil
 }
 
-func (kcm *K8sClientManager) FetchEngineUrlsByPlan(collectionID, planID int64, opts *smodel.EngineOwnerRef) ([]string, error) {
-	collectionUrl, err := kcm.GetIngressUrl(opts.ProjectID)
+func (kcm *K8sClientManager) FetchEngineUrlsByPlan(ctx context.Context, collectionID, planID int64,
+	opts *smodel.EngineOwnerRef) ([]string, error) {
+	collectionUrl, err := kcm.GetIngressUrl(ctx, opts.ProjectID)
 	if err != nil {
 		return nil, err
 	}
@@ -591,6 +1020,10 @@ func (kcm *K8sClientManager) processPodsStatus(pods []apiv1.Pod, planStatuses ma
 			log.Error("Could not find running pod in ExecutionPlan")
 			continue
 		}
+		// The engines of the jobs of a finished run, until the jobs are replaced or cleaned up
+		if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+			continue
+		}
 
 		ps.EnginesDeployed += 1
 		if pod.Status.Phase != apiv1.PodRunning {
@@ -602,10 +1035,10 @@ func (kcm *K8sClientManager) processPodsStatus(pods []apiv1.Pod, planStatuses ma
 }
 
 // checkIngressControllerDeployment checks if ingress controller is deployed
-func (kcm *K8sClientManager) checkIngressControllerDeployment(collectionID int64, ingressControllerDeployed bool) bool {
+func (kcm *K8sClientManager) checkIngressControllerDeployment(ctx context.Context, collectionID int64, ingressControllerDeployed bool) bool {
 	if !ingressControllerDeployed {
 		fieldSelector := "status.phase=Running"
-		ingressPods := kcm.GetPodsByCollection(collectionID, fieldSelector)
+		ingressPods := kcm.GetPodsByCollection(ctx, collectionID, fieldSelector)
 		ingressControllerDeployed = len(ingressPods) >= 1
 	}
 	return ingressControllerDeployed
@@ -638,13 +1071,13 @@ func collectPlanStatuses(collectionID int64, eps []*model.ExecutionPlan, planSta
 	return plans
 }
 
-func (kcm *K8sClientManager) CollectionStatus(projectID, collectionID int64, eps []*model.ExecutionPlan) (*smodel.CollectionStatus, error) {
+func (kcm *K8sClientManager) CollectionStatus(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) (*smodel.CollectionStatus, error) {
 	planStatuses := initializePlanStatuses(eps)
 	cs := &smodel.CollectionStatus{}
-	pods := kcm.GetPodsByCollection(collectionID, "")
+	pods := kcm.GetPodsByCollection(ctx, collectionID, "")
 
 	ingressControllerDeployed, enginesReady := kcm.processPodsStatus(pods, planStatuses)
-	ingressControllerDeployed = kcm.checkIngressControllerDeployment(collectionID, ingressControllerDeployed)
+	ingressControllerDeployed = kcm.checkIngressControllerDeployment(ctx, collectionID, ingressControllerDeployed)
 
 	if !ingressControllerDeployed || !enginesReady {
 		for _, ps := range planStatuses {
@@ -661,7 +1094,7 @@ func (kcm *K8sClientManager) CollectionStatus(projectID, collectionID int64, eps
 			ProjectID:    projectID,
 			EnginesCount: randomPlan.Engines,
 		}
-		engineUrls, err := kcm.FetchEngineUrlsByPlan(collectionID, randomPlan.PlanID, opts)
+		engineUrls, err := kcm.FetchEngineUrlsByPlan(ctx, collectionID, randomPlan.PlanID, opts)
 		if err == nil && len(engineUrls) > 0 {
 			randomEngine := engineUrls[0]
 			engineReachable = kcm.ServiceReachable(randomEngine)
@@ -672,13 +1105,13 @@ func (kcm *K8sClientManager) CollectionStatus(projectID, collectionID int64, eps
 	return cs, nil
 }
 
-func (kcm *K8sClientManager) GetPodsByCollectionPlan(collectionID, planID int64) ([]apiv1.Pod, error) {
+func (kcm *K8sClientManager) GetPodsByCollectionPlan(ctx context.Context, collectionID, planID int64) ([]apiv1.Pod, error) {
 	labelSelector := fmt.Sprintf("plan=%d,collection=%d", planID, collectionID)
 	fieldSelector := ""
-	return kcm.GetPods(labelSelector, fieldSelector)
+	return kcm.getPods(ctx, labelSelector, fieldSelector)
 }
 
-func (kcm *K8sClientManager) FetchLogFromPod(pod apiv1.Pod) (string, error) {
+func (kcm *K8sClientManager) FetchLogFromPod(ctx context.Context, pod apiv1.Pod) (string, error) {
 	logOptions := &apiv1.PodLogOptions{
 		Follow: false,
 	}
@@ -691,7 +1124,7 @@ func (kcm *K8sClientManager) FetchLogFromPod(pod apiv1.Pod) (string, error) {
 		Param("container", logOptions.Container).
 		Param("previous", strconv.FormatBool(logOptions.Previous)).
 		Param("timestamps", strconv.FormatBool(logOptions.Timestamps))
-	readCloser, err := req.Stream(context.TODO())
+	readCloser, err := req.Stream(ctx)
 	if err != nil {
 		return "", err
 	}
@@ -703,28 +1136,33 @@ func (kcm *K8sClientManager) FetchLogFromPod(pod apiv1.Pod) (string, error) {
 	return string(c), nil
 }
 
-func (kcm *K8sClientManager) DownloadPodLog(collectionID, planID int64) (string, error) {
-	pods, err := kcm.GetPodsByCollectionPlan(collectionID, planID)
+func (kcm *K8sClientManager) DownloadPodLog(ctx context.Context, collectionID, planID int64) (string, error) {
+	pods, err := kcm.GetPodsByCollectionPlan(ctx, collectionID, planID)
 	if err != nil {
 		return "", err
 	}
 	if len(pods) > 0 {
-		return kcm.FetchLogFromPod(pods[0])
+		return kcm.FetchLogFromPod(ctx, pods[0])
 	}
 	return "", fmt.Errorf("cannot find pod for the plan %d", planID)
 }
 
-func (kcm *K8sClientManager) PodReadyCount(collectionID int64) int {
-	label := makeCollectionLabel(collectionID)
-	podsClient, err := kcm.client.CoreV1().Pods(kcm.Namespace).
-		List(context.TODO(), metav1.ListOptions{
-			LabelSelector: label,
-		})
+// EngineCount counts all the pods of the collection, including the ones being terminated
+func (kcm *K8sClientManager) EngineCount(ctx context.Context, collectionID int64) (int, error) {
+	pods, err := kcm.getPods(ctx, makeCollectionLabel(collectionID), "")
+	if err != nil {
+		return 0, err
+	}
+	return len(pods), nil
+}
+
+func (kcm *K8sClientManager) PodReadyCount(ctx context.Context, collectionID int64) int {
+	pods, err := kcm.getPods(ctx, makeCollectionLabel(collectionID), "")
 	if err != nil {
 		log.Warn(err)
 	}
 	ready := 0
-	for _, pod := range podsClient.Items {
+	for _, pod := range pods {
 		if pod.Status.Phase == "Running" {
 			ready++
 		}
@@ -732,6 +1170,15 @@ func (kcm *K8sClientManager) PodReadyCount(collectionID int64) int {
 	return ready
 }
 
+// Ping lists a pod of the namespace of the engines, which needs both the cluster and the permissions of the controller
+func (kcm *K8sClientManager) Ping(ctx context.Context) error {
+	if kcm.client == nil {
+		return e.New("no kubernetes client, see the warnings of the start")
+	}
+	_, err := kcm.client.CoreV1().Pods(kcm.Namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	return err
+}
+
 func (kcm *K8sClientManager) ServiceReachable(engineUrl string) bool {
 	resp, err := http.Get(fmt.Sprintf("http://%s/start", engineUrl))
 	if err != nil {
@@ -742,13 +1189,13 @@ func (kcm *K8sClientManager) ServiceReachable(engineUrl string) bool {
 	return resp.StatusCode == http.StatusOK
 }
 
-func (kcm *K8sClientManager) deleteService(collectionID int64) error {
+func (kcm *K8sClientManager) deleteService(ctx context.Context, namespace string, labelSelector string) error {
 	// We could not delete services by label
 	// So we firstly get them by label and then delete them one by one
 	// you can check here: https://github.com/kubernetes/kubernetes/issues/68468#issuecomment-419981870
-	corev1Client := kcm.client.CoreV1().Services(kcm.Namespace)
-	resp, err := corev1Client.List(context.TODO(), metav1.ListOptions{
-		LabelSelector: makeCollectionLabel(collectionID),
+	corev1Client := kcm.client.CoreV1().Services(namespace)
+	resp, err := corev1Client.List(ctx, metav1.ListOptions{
+		LabelSelector: labelSelector,
 	})
 	if err != nil {
 		return err
@@ -758,17 +1205,16 @@ func (kcm *K8sClientManager) deleteService(collectionID int64) error {
 	// the errors could be similar so we should avoid return a long list of errors
 	var lastError error
 	for _, svc := range resp.Items {
-		if err := corev1Client.Delete(context.TODO(), svc.Name, metav1.DeleteOptions{}); err != nil {
+		if err := corev1Client.Delete(ctx, svc.Name, metav1.DeleteOptions{}); err != nil {
 			lastError = err
 		}
 	}
 	return lastError
 }
 
-func (kcm *K8sClientManager) deleteDeployment(collectionID int64) error {
-	ls := fmt.Sprintf("collection=%d", collectionID)
-	deploymentsClient := kcm.client.AppsV1().Deployments(kcm.Namespace)
-	err := deploymentsClient.DeleteCollection(context.TODO(), metav1.DeleteOptions{
+func (kcm *K8sClientManager) deleteDeployment(ctx context.Context, namespace string, ls string) error {
+	deploymentsClient := kcm.client.AppsV1().Deployments(namespace)
+	err := deploymentsClient.DeleteCollection(ctx, metav1.DeleteOptions{
 		GracePeriodSeconds: new(int64),
 	}, metav1.ListOptions{
 		LabelSelector: ls,
@@ -777,33 +1223,106 @@ func (kcm *K8sClientManager) deleteDeployment(collectionID int64) error {
 		log.Error(err)
 		return err
 	}
-	if err := kcm.client.AppsV1().StatefulSets(kcm.Namespace).DeleteCollection(context.TODO(),
+	if err := kcm.client.AppsV1().StatefulSets(namespace).DeleteCollection(ctx,
 		metav1.DeleteOptions{GracePeriodSeconds: new(int64)}, metav1.ListOptions{LabelSelector: ls}); err != nil {
 		return err
 	}
+	// The jobs orphan their pods by default
+	propagation := metav1.DeletePropagationBackground
+	if err := kcm.client.BatchV1().Jobs(namespace).DeleteCollection(ctx,
+		metav1.DeleteOptions{GracePeriodSeconds: new(int64), PropagationPolicy: &propagation},
+		metav1.ListOptions{LabelSelector: ls}); err != nil {
+		return err
+	}
 	return nil
 }
 
-func (kcm *K8sClientManager) PurgeCollection(collectionID int64) error {
-	err := kcm.deleteDeployment(collectionID)
+// CollectionCompleted tells whether the jobs of the collection are all finished, i.e. all its engines exited.
+// It's false when the collection has no jobs.
+func (kcm *K8sClientManager) CollectionCompleted(ctx context.Context, collectionID int64) (bool, error) {
+	jobs, err := kcm.client.BatchV1().Jobs(kcm.listNamespace()).List(ctx, metav1.ListOptions{
+		LabelSelector: makeCollectionLabel(collectionID),
+	})
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if !kcm.ownsNamespace(job.Namespace) {
+			continue
+		}
+		if !jobFinished(job) {
+			return false, nil
+		}
+		found = true
+	}
+	return found, nil
+}
+
+func (kcm *K8sClientManager) PurgeCollection(ctx context.Context, collectionID int64) error {
+	namespaces, err := kcm.findNamespaces(ctx, makeCollectionLabel(collectionID))
 	if err != nil {
 		return err
 	}
-	err = kcm.deleteService(collectionID)
+	for _, namespace := range namespaces {
+		if err := kcm.deleteDeployment(ctx, namespace, makeCollectionLabel(collectionID)); err != nil {
+			return err
+		}
+		if err := kcm.deleteService(ctx, namespace, makeCollectionLabel(collectionID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kcm *K8sClientManager) PurgePlan(ctx context.Context, collectionID, planID int64) error {
+	ls := makePlanSelector(collectionID, planID)
+	namespaces, err := kcm.findNamespaces(ctx, ls)
 	if err != nil {
 		return err
 	}
+	for _, namespace := range namespaces {
+		if err := kcm.deleteDeployment(ctx, namespace, ls); err != nil {
+			return err
+		}
+		if err := kcm.deleteService(ctx, namespace, ls); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (kcm *K8sClientManager) PurgeProjectIngress(projectID int64) error {
+// ReplaceEngine deletes the pod of the engine, which the stateful set of its plan creates again with the same name.
+// The pod is already gone when a previous attempt deleted it
+func (kcm *K8sClientManager) ReplaceEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int,
+	containerConfig *config.ExecutorContainer) error {
+	if kcm.RunsOnce() {
+		return ErrFeatureUnavailable
+	}
+	namespace := kcm.projectNamespace(projectID)
+	engineName := makeEngineName(projectID, collectionID, planID, engineID)
+	err := kcm.client.CoreV1().Pods(namespace).Delete(ctx, engineName, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (kcm *K8sClientManager) PurgeProjectIngress(ctx context.Context, projectID int64) error {
 	igName := makeIngressClass(projectID)
 	deleteOpts := metav1.DeleteOptions{}
-	if err := kcm.client.AppsV1().Deployments(kcm.Namespace).Delete(context.TODO(), igName, deleteOpts); err != nil {
+	namespaces, err := kcm.findNamespaces(ctx, fmt.Sprintf("project=%d,kind=ingress-controller", projectID))
+	if err != nil {
 		return err
 	}
-	if err := kcm.client.CoreV1().Services(kcm.Namespace).Delete(context.TODO(), igName, deleteOpts); err != nil {
-		return err
+	for _, namespace := range namespaces {
+		if err := kcm.client.AppsV1().Deployments(namespace).Delete(ctx, igName, deleteOpts); err != nil {
+			return err
+		}
+		if err := kcm.client.CoreV1().Services(namespace).Delete(ctx, igName, deleteOpts); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -903,21 +1422,23 @@ func (kcm *K8sClientManager) generateControllerDeployment(igName string, project
 	return deployment
 }
 
-func (kcm *K8sClientManager) ExposeProject(projectID int64) error {
+func (kcm *K8sClientManager) ExposeProject(ctx context.Context, projectID int64) error {
 	igName := makeIngressClass(projectID)
 	deployment := kcm.generateControllerDeployment(igName, projectID)
+	namespace := kcm.projectNamespace(projectID)
 	// there could be duplicated controller deployment from multiple collections
 	// This method has already taken it into considertion.
-	if err := kcm.deploy(&deployment); err != nil {
+	if err := kcm.deploy(ctx, namespace, &deployment); err != nil {
 		return err
 	}
-	if err := kcm.expose(igName, &deployment); err != nil {
+	if err := kcm.expose(ctx, namespace, igName, &deployment); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (kcm *K8sClientManager) CreateIngress(ingressClass, ingressName, serviceName string, collectionID, projectID int64) error {
+func (kcm *K8sClientManager) CreateIngress(ctx context.Context, namespace, ingressClass, ingressName, serviceName string,
+	collectionID, projectID int64) error {
 	ingressRule := v1networking.IngressRule{}
 	pathType := v1networking.PathType("Exact")
 	ingressRule.HTTP = &v1networking.HTTPIngressRuleValue{
@@ -953,16 +1474,17 @@ func (kcm *K8sClientManager) CreateIngress(ingressClass, ingressName, serviceNam
 			Rules: []v1networking.IngressRule{ingressRule},
 		},
 	}
-	_, err := kcm.client.NetworkingV1().Ingresses(kcm.Namespace).Create(context.TODO(), &ingress, metav1.CreateOptions{})
+	applyProjectMetadata(&ingress.ObjectMeta, kcm.projectMetadata(projectID))
+	_, err := kcm.client.NetworkingV1().Ingresses(namespace).Create(ctx, &ingress, metav1.CreateOptions{})
 	if err != nil {
 		log.Error(err)
 	}
 	return nil
 }
 
-func (kcm *K8sClientManager) GetDeployedCollections() (map[int64]time.Time, error) {
+func (kcm *K8sClientManager) GetDeployedCollections(ctx context.Context) (map[int64]time.Time, error) {
 	labelSelector := "kind=executor"
-	pods, err := kcm.GetPods(labelSelector, "")
+	pods, err := kcm.getPods(ctx, labelSelector, "")
 	if err != nil {
 		return nil, err
 	}
@@ -977,14 +1499,38 @@ func (kcm *K8sClientManager) GetDeployedCollections() (map[int64]time.Time, erro
 	return deployedCollections, nil
 }
 
-func (kcm *K8sClientManager) GetDeployedServices() (map[int64]time.Time, error) {
+// GetCollectionResources lists the collections owning any of the resources a purge deletes, deployments,
+// statefulsets, jobs, services and pods, whatever their state. It's used to find the resources left behind.
+func (kcm *K8sClientManager) GetCollectionResources(ctx context.Context) (map[int64]time.Time, error) {
+	collections := make(map[int64]time.Time)
+	resources, err := kcm.listResources(ctx, collectionLabel)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range resources {
+		addCollectionResource(collections, r.Labels, r.CreationTimestamp.Time)
+	}
+	pods, err := kcm.getPods(ctx, collectionLabel, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		addCollectionResource(collections, pod.Labels, pod.CreationTimestamp.Time)
+	}
+	return collections, nil
+}
+
+func (kcm *K8sClientManager) GetDeployedServices(ctx context.Context) (map[int64]time.Time, error) {
 	labelSelector := "kind=ingress-controller"
-	services, err := kcm.client.CoreV1().Services(kcm.Namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector})
+	services, err := kcm.client.CoreV1().Services(kcm.listNamespace()).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
 	if err != nil {
 		return nil, err
 	}
 	deployedServices := make(map[int64]time.Time)
 	for _, svc := range services.Items {
+		if !kcm.ownsNamespace(svc.Namespace) {
+			continue
+		}
 		projectID, err := strconv.ParseInt(svc.Labels["project"], 10, 64)
 		if err != nil {
 			return nil, err
@@ -994,8 +1540,8 @@ func (kcm *K8sClientManager) GetDeployedServices() (map[int64]time.Time, error)
 	return deployedServices, nil
 }
 
-func (kcm *K8sClientManager) GetPodsMetrics(collectionID, planID int64) (map[string]apiv1.ResourceList, error) {
-	metricsList, err := kcm.metricClient.MetricsV1beta1().PodMetricses(kcm.Namespace).List(context.TODO(), metav1.ListOptions{
+func (kcm *K8sClientManager) GetPodsMetrics(ctx context.Context, collectionID, planID int64) (map[string]apiv1.ResourceList, error) {
+	metricsList, err := kcm.metricClient.MetricsV1beta1().PodMetricses(kcm.listNamespace()).List(ctx, metav1.ListOptions{
 		LabelSelector: fmt.Sprintf("collection=%d,plan=%d", collectionID, planID),
 	})
 	if err != nil {
@@ -1003,6 +1549,9 @@ func (kcm *K8sClientManager) GetPodsMetrics(collectionID, planID int64) (map[str
 	}
 	result := make(map[string]apiv1.ResourceList, len(metricsList.Items))
 	for _, pm := range metricsList.Items {
+		if !kcm.ownsNamespace(pm.Namespace) {
+			continue
+		}
 		for _, cm := range pm.Containers {
 			result[getEngineNumber(pm.GetName())] = cm.Usage
 		}
@@ -1010,9 +1559,9 @@ func (kcm *K8sClientManager) GetPodsMetrics(collectionID, planID int64) (map[str
 	return result, nil
 }
 
-func (kcm *K8sClientManager) GetCollectionEnginesDetail(projectID, collectionID int64) (*smodel.CollectionDetails, error) {
+func (kcm *K8sClientManager) GetCollectionEnginesDetail(ctx context.Context, projectID, collectionID int64) (*smodel.CollectionDetails, error) {
 	labelSelector := fmt.Sprintf("collection=%d", collectionID)
-	pods, err := kcm.GetPods(labelSelector, "")
+	pods, err := kcm.getPods(ctx, labelSelector, "")
 	if err != nil {
 		return nil, err
 	}
@@ -1020,7 +1569,7 @@ func (kcm *K8sClientManager) GetCollectionEnginesDetail(projectID, collectionID
 		return nil, &NoResourcesFoundErr{Err: err, Message: "Cannot find the engines"}
 	}
 	collectionDetails := new(smodel.CollectionDetails)
-	ingressUrl, err := kcm.GetIngressUrl(projectID)
+	ingressUrl, err := kcm.GetIngressUrl(ctx, projectID)
 	if err != nil {
 		collectionDetails.IngressIP = err.Error()
 	} else {
@@ -1032,6 +1581,8 @@ func (kcm *K8sClientManager) GetCollectionEnginesDetail(projectID, collectionID
 		es.Name = p.Name
 		es.CreatedTime = p.CreationTimestamp.Time
 		es.Status = string(p.Status.Phase)
+		es.PlanID, _ = strconv.ParseInt(p.Labels["plan"], 10, 64)
+		es.Image = engineImage(p)
 		engines = append(engines, es)
 	}
 	collectionDetails.Engines = engines
@@ -1039,6 +1590,371 @@ func (kcm *K8sClientManager) GetCollectionEnginesDetail(projectID, collectionID
 	return collectionDetails, nil
 }
 
+// engineImage is the digest of the image of the engine container, empty until the image is pulled
+func engineImage(pod apiv1.Pod) string {
+	if len(pod.Spec.Containers) == 0 {
+		return ""
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == pod.Spec.Containers[0].Name {
+			return cs.ImageID
+		}
+	}
+	return ""
+}
+
+func hasPodCondition(pod apiv1.Pod, condition apiv1.PodConditionType) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == condition && c.Status == apiv1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// podEngineStage tells how far the deployment of the engine running in the pod got, short of being reachable
+func podEngineStage(pod apiv1.Pod) (string, string) {
+	if pod.Status.Phase == apiv1.PodFailed {
+		return smodel.EngineFailed, pod.Status.Message
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting == nil {
+			continue
+		}
+		switch cs.State.Waiting.Reason {
+		case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError", "CrashLoopBackOff":
+			message := cs.State.Waiting.Message
+			if message == "" {
+				message = cs.State.Waiting.Reason
+			}
+			return smodel.EngineFailed, message
+		}
+	}
+	switch {
+	case hasPodCondition(pod, apiv1.PodReady):
+		return smodel.EngineReady, ""
+	case pod.Status.Phase == apiv1.PodRunning:
+		return smodel.EngineStarting, ""
+	case hasPodCondition(pod, apiv1.PodInitialized):
+		// The containers of a pending pod are created once their image is pulled
+		return smodel.EnginePullingImage, ""
+	case hasPodCondition(pod, apiv1.PodScheduled):
+		return smodel.EngineScheduled, ""
+	}
+	return smodel.EngineCreated, ""
+}
+
+// GetEnginesProgress reports the stage of every engine of the collection. Engines without a pod yet are pending,
+// and ready engines are checked for being reachable through the ingress.
+func (kcm *K8sClientManager) GetEnginesProgress(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) ([]*smodel.EngineProgress, error) {
+	pods, err := kcm.getPods(ctx, fmt.Sprintf("collection=%d,kind=executor", collectionID), "")
+	if err != nil {
+		return nil, err
+	}
+	progress := make(map[string]*smodel.EngineProgress)
+	for _, pod := range pods {
+		stage, message := podEngineStage(pod)
+		key := fmt.Sprintf("%s-%s", pod.Labels["plan"], getEngineNumber(pod.Name))
+		progress[key] = &smodel.EngineProgress{Stage: stage, Message: message}
+	}
+	engines := []*smodel.EngineProgress{}
+	for _, ep := range eps {
+		var engineUrls []string
+		for i := 0; i < ep.Engines; i++ {
+			p, ok := progress[fmt.Sprintf("%d-%d", ep.PlanID, i)]
+			if !ok {
+				p = &smodel.EngineProgress{Stage: smodel.EnginePending}
+			}
+			p.PlanID = ep.PlanID
+			p.EngineID = i
+			if p.Stage == smodel.EngineReady {
+				if engineUrls == nil {
+					opts := &smodel.EngineOwnerRef{ProjectID: projectID, EnginesCount: ep.Engines}
+					if engineUrls, err = kcm.FetchEngineUrlsByPlan(ctx, collectionID, ep.PlanID, opts); err != nil {
+						engineUrls = []string{}
+					}
+				}
+				if i < len(engineUrls) && kcm.ServiceReachable(engineUrls[i]) {
+					p.Stage = smodel.EngineReachable
+				}
+			}
+			engines = append(engines, p)
+		}
+	}
+	return engines, nil
+}
+
+// The resources the engines are sized by
+var capacityResources = []apiv1.ResourceName{apiv1.ResourceCPU, apiv1.ResourceMemory}
+
+func addResources(total, rl apiv1.ResourceList) {
+	for _, name := range capacityResources {
+		q, ok := rl[name]
+		if !ok {
+			continue
+		}
+		sum := total[name]
+		sum.Add(q)
+		total[name] = sum
+	}
+}
+
+// makeClusterCapacity sums up the resources of the nodes and the requests of the engines still running on them
+func makeClusterCapacity(nodes []apiv1.Node, pods []apiv1.Pod) *smodel.ClusterCapacity {
+	capacity := &smodel.ClusterCapacity{
+		Nodes:       len(nodes),
+		Allocatable: apiv1.ResourceList{},
+		Requested:   apiv1.ResourceList{},
+	}
+	for _, node := range nodes {
+		addResources(capacity.Allocatable, node.Status.Allocatable)
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+			continue
+		}
+		capacity.Engines++
+		for _, c := range pod.Spec.Containers {
+			addResources(capacity.Requested, c.Resources.Requests)
+		}
+	}
+	return capacity
+}
+
+// GetClusterCapacity reports the resources of the nodes the engines are scheduled on, the ones matching the
+// node affinity of the executors when there is one, and how much of them the engines requested.
+func (kcm *K8sClientManager) GetClusterCapacity(ctx context.Context) (*smodel.ClusterCapacity, error) {
+	opts := metav1.ListOptions{}
+	if na := config.SC.ExecutorConfig.NodeAffinity; len(na) > 0 {
+		opts.LabelSelector = fmt.Sprintf("%s=%s", na[0]["key"], na[0]["value"])
+	}
+	nodes, err := kcm.client.CoreV1().Nodes().List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := kcm.getPods(ctx, "kind=executor", "")
+	if err != nil {
+		return nil, err
+	}
+	return makeClusterCapacity(nodes.Items, pods), nil
+}
+
+func (kcm *K8sClientManager) tenantNamespacesEnabled() bool {
+	return kcm.TenantNamespaces != nil && kcm.TenantNamespaces.Enabled
+}
+
+// projectNamespace is where the resources of the project are deployed. It's the namespace of the tenant owning
+// the project when the tenants are isolated, the namespace of the executors otherwise.
+func (kcm *K8sClientManager) projectNamespace(projectID int64) string {
+	if !kcm.tenantNamespacesEnabled() {
+		return kcm.Namespace
+	}
+	namespace, err := model.GetTenantNamespaceByProject(projectID)
+	if err != nil {
+		log.Warnf("Cannot find the tenant of project %d, deploying to %s: %v", projectID, kcm.Namespace, err)
+		return kcm.Namespace
+	}
+	if namespace == "" {
+		return kcm.Namespace
+	}
+	return namespace
+}
+
+// listNamespace is where the resources are listed from. When the tenants are isolated they are listed from all
+// the namespaces, and only the ones in the namespaces of Setagaya are kept, see ownsNamespace.
+func (kcm *K8sClientManager) listNamespace() string {
+	if kcm.tenantNamespacesEnabled() {
+		return metav1.NamespaceAll
+	}
+	return kcm.Namespace
+}
+
+// ownsNamespace tells whether the namespace is the one of the executors or one of the tenants, which are named
+// after it
+func (kcm *K8sClientManager) ownsNamespace(namespace string) bool {
+	return namespace == kcm.Namespace || strings.HasPrefix(namespace, kcm.Namespace+"-")
+}
+
+// listResources lists the deployments, statefulsets, jobs and services with the label
+func (kcm *K8sClientManager) listResources(ctx context.Context, labelSelector string) ([]metav1.ObjectMeta, error) {
+	opts := metav1.ListOptions{LabelSelector: labelSelector}
+	namespace := kcm.listNamespace()
+	resources := []metav1.ObjectMeta{}
+	deployments, err := kcm.client.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments.Items {
+		resources = append(resources, d.ObjectMeta)
+	}
+	statefulSets, err := kcm.client.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, ss := range statefulSets.Items {
+		resources = append(resources, ss.ObjectMeta)
+	}
+	jobs, err := kcm.client.BatchV1().Jobs(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs.Items {
+		resources = append(resources, job.ObjectMeta)
+	}
+	services, err := kcm.client.CoreV1().Services(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range services.Items {
+		resources = append(resources, svc.ObjectMeta)
+	}
+	owned := []metav1.ObjectMeta{}
+	for _, r := range resources {
+		if kcm.ownsNamespace(r.Namespace) {
+			owned = append(owned, r)
+		}
+	}
+	return owned, nil
+}
+
+// findNamespaces returns the namespaces having resources with the label. Resources deployed before the tenant of
+// their project was onboarded are still in the namespace of the executors, so they are purged wherever they are.
+func (kcm *K8sClientManager) findNamespaces(ctx context.Context, labelSelector string) ([]string, error) {
+	resources, err := kcm.listResources(ctx, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	namespaces := []string{}
+	for _, r := range resources {
+		if !found[r.Namespace] {
+			found[r.Namespace] = true
+			namespaces = append(namespaces, r.Namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// The ingress controllers of the projects run with this role. See kubernetes/ingress.yaml
+const (
+	ingressRoleName        = "setagaya-ingress-role-1"
+	ingressRoleBindingName = "setagaya-ingress-role-binding-1"
+	// Name of the resource quota and the network policy of the tenants
+	tenantResourceName = "setagaya-tenant"
+)
+
+// copySharedObjects copies what the engines and the ingress controllers need from the namespace of the executors
+// to the namespace of a tenant, the secrets, the config map and the service account with its role.
+func (kcm *K8sClientManager) copySharedObjects(ctx context.Context, namespace string) error {
+	secrets := []string{kcm.ImagePullSecret}
+	if gcp := object_storage.GCPStorageConfig(); gcp != nil {
+		secrets = append(secrets, gcp.SecretName)
+	}
+	for _, name := range secrets {
+		if name == "" {
+			continue
+		}
+		secret, err := kcm.client.CoreV1().Secrets(kcm.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		copied := &apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: secret.Name, Labels: secret.Labels},
+			Type:       secret.Type,
+			Data:       secret.Data,
+		}
+		if _, err := kcm.client.CoreV1().Secrets(namespace).Create(ctx, copied, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	cm, err := kcm.client.CoreV1().ConfigMaps(kcm.Namespace).Get(ctx, config.SC.ObjectStorage.ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	copiedCM := &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: cm.Name, Labels: cm.Labels},
+		Data:       cm.Data,
+	}
+	if _, err := kcm.client.CoreV1().ConfigMaps(namespace).Create(ctx, copiedCM, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	sa := &apiv1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: kcm.serviceAccount}}
+	if _, err := kcm.client.CoreV1().ServiceAccounts(namespace).Create(ctx, sa, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	role, err := kcm.client.RbacV1().Roles(kcm.Namespace).Get(ctx, ingressRoleName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	copiedRole := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{Name: role.Name, Labels: role.Labels},
+		Rules:      role.Rules,
+	}
+	if _, err := kcm.client.RbacV1().Roles(namespace).Create(ctx, copiedRole, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: ingressRoleBindingName},
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: kcm.serviceAccount, Namespace: namespace},
+		},
+		RoleRef: rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: ingressRoleName},
+	}
+	if _, err := kcm.client.RbacV1().RoleBindings(namespace).Create(ctx, binding, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// applyTenantTemplates creates the resource quota and the network policy of the configured templates in the
+// namespace of the tenant
+func (kcm *K8sClientManager) applyTenantTemplates(ctx context.Context, tenant *model.Tenant) error {
+	labels := makeTenantLabel(tenant.Name)
+	if spec := kcm.TenantNamespaces.ResourceQuota; spec != nil {
+		quota := &apiv1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: tenantResourceName, Labels: labels},
+			Spec:       *spec.DeepCopy(),
+		}
+		if _, err := kcm.client.CoreV1().ResourceQuotas(tenant.Namespace).Create(ctx, quota, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	if spec := kcm.TenantNamespaces.NetworkPolicy; spec != nil {
+		policy := &v1networking.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: tenantResourceName, Labels: labels},
+			Spec:       *spec.DeepCopy(),
+		}
+		if _, err := kcm.client.NetworkingV1().NetworkPolicies(tenant.Namespace).Create(ctx, policy, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProvisionTenant creates the namespace of the tenant. When the tenants are isolated, the namespace gets the
+// resource quota and the network policy of the templates and what the engines need to run in it.
+// A tenant can be provisioned again safely.
+func (kcm *K8sClientManager) ProvisionTenant(ctx context.Context, tenant *model.Tenant) error {
+	namespace := &apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   tenant.Namespace,
+			Labels: makeTenantLabel(tenant.Name),
+		},
+	}
+	_, err := kcm.client.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	if !kcm.tenantNamespacesEnabled() {
+		return nil
+	}
+	if err := kcm.applyTenantTemplates(ctx, tenant); err != nil {
+		return err
+	}
+	return kcm.copySharedObjects(ctx, tenant.Namespace)
+}
+
 func getEngineNumber(podName string) string {
 	return strings.Split(podName, "-")[4]
 }
@@ -0,0 +1,337 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/engines/runonce"
+	"github.com/hveda/Setagaya/setagaya/engines/sidecar"
+	"github.com/hveda/Setagaya/setagaya/model"
+	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
+)
+
+func makePod(phase apiv1.PodPhase, conditions ...apiv1.PodConditionType) apiv1.Pod {
+	pod := apiv1.Pod{}
+	pod.Status.Phase = phase
+	for _, c := range conditions {
+		pod.Status.Conditions = append(pod.Status.Conditions, apiv1.PodCondition{Type: c, Status: apiv1.ConditionTrue})
+	}
+	return pod
+}
+
+func TestPodEngineStage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pod      apiv1.Pod
+		expected string
+	}{
+		{"created", makePod(apiv1.PodPending), smodel.EngineCreated},
+		{"scheduled", makePod(apiv1.PodPending, apiv1.PodScheduled), smodel.EngineScheduled},
+		{"pulling image", makePod(apiv1.PodPending, apiv1.PodScheduled, apiv1.PodInitialized), smodel.EnginePullingImage},
+		{"starting", makePod(apiv1.PodRunning, apiv1.PodScheduled, apiv1.PodInitialized), smodel.EngineStarting},
+		{"ready", makePod(apiv1.PodRunning, apiv1.PodScheduled, apiv1.PodInitialized, apiv1.PodReady), smodel.EngineReady},
+		{"failed", makePod(apiv1.PodFailed, apiv1.PodScheduled), smodel.EngineFailed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stage, _ := podEngineStage(tc.pod)
+			assert.Equal(t, tc.expected, stage)
+		})
+	}
+}
+
+func TestPodEngineStageImagePullError(t *testing.T) {
+	pod := makePod(apiv1.PodPending, apiv1.PodScheduled, apiv1.PodInitialized)
+	pod.Status.ContainerStatuses = []apiv1.ContainerStatus{{
+		State: apiv1.ContainerState{Waiting: &apiv1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+	}}
+	stage, message := podEngineStage(pod)
+	assert.Equal(t, smodel.EngineFailed, stage)
+	assert.Equal(t, "ImagePullBackOff", message)
+
+	// Containers waiting to be created are still pulling their image
+	pod.Status.ContainerStatuses[0].State.Waiting.Reason = "ContainerCreating"
+	stage, _ = podEngineStage(pod)
+	assert.Equal(t, smodel.EnginePullingImage, stage)
+}
+
+func TestEngineImage(t *testing.T) {
+	pod := makePod(apiv1.PodRunning)
+	assert.Empty(t, engineImage(pod))
+	pod.Spec.Containers = []apiv1.Container{{Name: "engine"}, {Name: "sidecar"}}
+	pod.Status.ContainerStatuses = []apiv1.ContainerStatus{
+		{Name: "sidecar", ImageID: "docker.io/envoy@sha256:22"},
+		{Name: "engine", ImageID: "docker.io/jmeter@sha256:11"},
+	}
+	assert.Equal(t, "docker.io/jmeter@sha256:11", engineImage(pod))
+}
+
+func TestMakeClusterCapacity(t *testing.T) {
+	node := apiv1.Node{}
+	node.Status.Allocatable = apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse("4"),
+		apiv1.ResourceMemory: resource.MustParse("16Gi"),
+		apiv1.ResourcePods:   resource.MustParse("110"),
+	}
+	engine := func(phase apiv1.PodPhase) apiv1.Pod {
+		pod := makePod(phase)
+		pod.Spec.Containers = []apiv1.Container{{
+			Resources: apiv1.ResourceRequirements{Requests: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse("500m"),
+				apiv1.ResourceMemory: resource.MustParse("1Gi"),
+			}},
+		}}
+		return pod
+	}
+	pods := []apiv1.Pod{engine(apiv1.PodRunning), engine(apiv1.PodPending), engine(apiv1.PodSucceeded)}
+
+	capacity := makeClusterCapacity([]apiv1.Node{node, node}, pods)
+	assert.Equal(t, 2, capacity.Nodes)
+	assert.Equal(t, 2, capacity.Engines)
+	cpu := capacity.Allocatable[apiv1.ResourceCPU]
+	assert.Equal(t, "8", cpu.String())
+	_, ok := capacity.Allocatable[apiv1.ResourcePods]
+	assert.False(t, ok)
+	cpu = capacity.Requested[apiv1.ResourceCPU]
+	assert.Equal(t, "1", cpu.String())
+	memory := capacity.Requested[apiv1.ResourceMemory]
+	assert.Equal(t, "2Gi", memory.String())
+}
+
+func TestTenantNamespaces(t *testing.T) {
+	kcm := &K8sClientManager{ExecutorConfig: &config.ExecutorConfig{Namespace: "setagaya-executors"}}
+	assert.Equal(t, "setagaya-executors", kcm.listNamespace())
+	assert.Equal(t, "setagaya-executors", kcm.projectNamespace(1))
+
+	kcm.TenantNamespaces = &config.TenantNamespaces{Enabled: true}
+	assert.Equal(t, metav1.NamespaceAll, kcm.listNamespace())
+	assert.True(t, kcm.ownsNamespace("setagaya-executors"))
+	assert.True(t, kcm.ownsNamespace("setagaya-executors-payments"))
+	assert.False(t, kcm.ownsNamespace("setagaya-executorsfoo"))
+	assert.False(t, kcm.ownsNamespace("kube-system"))
+}
+
+func TestMakeSecurityContexts(t *testing.T) {
+	psc, csc := makeSecurityContexts(nil)
+	assert.Nil(t, psc)
+	assert.Nil(t, csc)
+
+	user := int64(1000)
+	psc, csc = makeSecurityContexts(&config.EngineSecurityContext{
+		RunAsNonRoot:                true,
+		RunAsUser:                   &user,
+		ReadOnlyRootFilesystem:      true,
+		DisallowPrivilegeEscalation: true,
+		SeccompProfile:              "Localhost/profiles/engine.json",
+		DropCapabilities:            []string{"ALL"},
+	})
+	assert.True(t, *psc.RunAsNonRoot)
+	assert.Equal(t, user, *psc.RunAsUser)
+	assert.Nil(t, psc.FSGroup)
+	assert.Equal(t, apiv1.SeccompProfileTypeLocalhost, psc.SeccompProfile.Type)
+	assert.Equal(t, "profiles/engine.json", *psc.SeccompProfile.LocalhostProfile)
+	assert.True(t, *csc.ReadOnlyRootFilesystem)
+	assert.False(t, *csc.AllowPrivilegeEscalation)
+	assert.Equal(t, []apiv1.Capability{"ALL"}, csc.Capabilities.Drop)
+
+	psc, csc = makeSecurityContexts(&config.EngineSecurityContext{SeccompProfile: "RuntimeDefault"})
+	assert.Equal(t, apiv1.SeccompProfileTypeRuntimeDefault, psc.SeccompProfile.Type)
+	assert.Nil(t, psc.RunAsNonRoot)
+	assert.Nil(t, csc.ReadOnlyRootFilesystem)
+	assert.Nil(t, csc.Capabilities)
+}
+
+func TestMakeImagePullSecrets(t *testing.T) {
+	kcm := &K8sClientManager{ExecutorConfig: &config.ExecutorConfig{ImagePullSecret: "setagaya-registry"}}
+	refs := kcm.makeImagePullSecrets(&config.ExecutorContainer{ImagePullSecrets: []string{"team-registry", "setagaya-registry"}})
+	assert.Equal(t, []apiv1.LocalObjectReference{{Name: "setagaya-registry"}, {Name: "team-registry"}}, refs)
+
+	kcm.ImagePullSecret = ""
+	assert.Empty(t, kcm.makeImagePullSecrets(&config.ExecutorContainer{}))
+}
+
+func TestApplyProjectMetadata(t *testing.T) {
+	labels := makePlanLabel(1, 2, 3)
+	om := metav1.ObjectMeta{Labels: labels}
+	applyProjectMetadata(&om, nil)
+	assert.Equal(t, labels, om.Labels)
+
+	applyProjectMetadata(&om, &model.ProjectMetadata{
+		Labels:      map[string]string{"cost-center": "cc-1234", "plan": "mine"},
+		Annotations: map[string]string{"sidecar.istio.io/inject": "false"},
+	})
+	assert.Equal(t, "cc-1234", om.Labels["cost-center"])
+	// The labels of Setagaya win
+	assert.Equal(t, "3", om.Labels["plan"])
+	assert.Equal(t, "false", om.Annotations["sidecar.istio.io/inject"])
+	// The map shared with the selectors is left untouched
+	assert.NotContains(t, labels, "cost-center")
+}
+
+func TestServiceMesh(t *testing.T) {
+	assert.Nil(t, serviceMeshAnnotations(nil))
+	assert.Nil(t, serviceMeshEnvvars(nil))
+
+	istio := &config.ServiceMesh{Kind: config.ServiceMeshIstio, ReadyTimeout: 60}
+	assert.Equal(t, "8080", serviceMeshAnnotations(istio)["traffic.sidecar.istio.io/excludeInboundPorts"])
+	envvars := serviceMeshEnvvars(istio)
+	assert.Len(t, envvars, 3)
+	assert.Equal(t, apiv1.EnvVar{Name: sidecar.QuitURLEnv, Value: "http://localhost:15020/quitquitquit"}, envvars[1])
+	assert.Equal(t, "60", envvars[2].Value)
+
+	linkerd := &config.ServiceMesh{Kind: config.ServiceMeshLinkerd, ReadyTimeout: 30}
+	assert.Equal(t, "8080", serviceMeshAnnotations(linkerd)["config.linkerd.io/skip-inbound-ports"])
+	assert.Equal(t, "http://localhost:4191/ready", serviceMeshEnvvars(linkerd)[0].Value)
+}
+
+func TestScheduleOnWindows(t *testing.T) {
+	nonRoot := true
+	spec := apiv1.PodSpec{
+		Affinity: &apiv1.Affinity{
+			NodeAffinity: makeNodeAffinity("pool", "engines"),
+			PodAffinity:  collectionPodAffinity(1),
+		},
+		SecurityContext: &apiv1.PodSecurityContext{RunAsNonRoot: &nonRoot},
+		Containers:      []apiv1.Container{{Name: "engine", SecurityContext: &apiv1.SecurityContext{RunAsNonRoot: &nonRoot}}},
+	}
+	scheduleOnWindows(&spec)
+	assert.Equal(t, apiv1.Windows, spec.OS.Name)
+	assert.Equal(t, map[string]string{"kubernetes.io/os": "windows"}, spec.NodeSelector)
+	assert.Nil(t, spec.Affinity.NodeAffinity)
+	assert.NotNil(t, spec.Affinity.PodAffinity)
+	assert.Len(t, spec.Tolerations, 1)
+	assert.Nil(t, spec.SecurityContext)
+	assert.Nil(t, spec.Containers[0].SecurityContext)
+}
+
+func TestScheduleOnArch(t *testing.T) {
+	spec := apiv1.PodSpec{}
+	scheduleOnArch(&spec, "")
+	assert.Nil(t, spec.NodeSelector)
+	assert.Empty(t, spec.Tolerations)
+
+	scheduleOnArch(&spec, "arm64")
+	assert.Equal(t, map[string]string{"kubernetes.io/arch": "arm64"}, spec.NodeSelector)
+	assert.Equal(t, "arm64", spec.Tolerations[0].Value)
+
+	scheduleOnWindows(&spec)
+	scheduleOnArch(&spec, "amd64")
+	assert.Equal(t, map[string]string{"kubernetes.io/os": "windows", "kubernetes.io/arch": "amd64"}, spec.NodeSelector)
+}
+
+func TestCPUFactorEnvvars(t *testing.T) {
+	assert.Nil(t, cpuFactorEnvvars(nil))
+	envvars := cpuFactorEnvvars(map[string]float64{"arm64": 0.8})
+	assert.Equal(t, []apiv1.EnvVar{{Name: "CPU_FACTORS", Value: `{"arm64":0.8}`}}, envvars)
+}
+
+func TestShapeNetwork(t *testing.T) {
+	ns := &config.NetworkShaping{Rate: "1mbit", Delay: 100}
+	spec := apiv1.PodSpec{Containers: []apiv1.Container{{Name: "engine"}}}
+	kcm := &K8sClientManager{ExecutorConfig: &config.ExecutorConfig{}}
+	kcm.shapeNetwork(&spec, ns)
+	assert.Empty(t, spec.InitContainers)
+
+	kcm.NetworkShaper = &config.NetworkShaper{Image: "setagaya:shaper", Device: "eth0"}
+	kcm.shapeNetwork(&spec, nil)
+	assert.Empty(t, spec.InitContainers)
+
+	kcm.shapeNetwork(&spec, ns)
+	assert.Len(t, spec.InitContainers, 1)
+	init := spec.InitContainers[0]
+	assert.Equal(t, []string{"tc", "qdisc", "replace", "dev", "eth0", "root", "netem", "delay", "100ms", "rate", "1mbit"}, init.Command)
+	assert.Equal(t, []apiv1.Capability{"NET_ADMIN"}, init.SecurityContext.Capabilities.Add)
+	assert.Equal(t, int64(0), *init.SecurityContext.RunAsUser)
+	assert.Equal(t, []apiv1.EnvVar{{Name: "NETWORK_SHAPING", Value: "delay 100ms rate 1mbit"}}, spec.Containers[0].Env)
+}
+
+func TestMakePlanJob(t *testing.T) {
+	labels := makePlanLabel(1, 2, 3)
+	planConfig := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: makePlanName(1, 2, 3), Labels: labels},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: int32Ptr(4),
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       apiv1.PodSpec{Containers: []apiv1.Container{{Name: "engine"}}},
+			},
+		},
+	}
+	kcm := &K8sClientManager{ExecutorConfig: &config.ExecutorConfig{Cluster: &config.ClusterConfig{GCDuration: 15}}}
+	job := kcm.makePlanJob(planConfig)
+	assert.Equal(t, "engine-1-2-3", job.Name)
+	assert.Equal(t, labels, job.Labels)
+	assert.Equal(t, int32(4), *job.Spec.Completions)
+	assert.Equal(t, int32(4), *job.Spec.Parallelism)
+	assert.Equal(t, batchv1.IndexedCompletion, *job.Spec.CompletionMode)
+	assert.Equal(t, int32(0), *job.Spec.BackoffLimit)
+	assert.Equal(t, int32(900), *job.Spec.TTLSecondsAfterFinished)
+	spec := job.Spec.Template.Spec
+	assert.Equal(t, apiv1.RestartPolicyNever, spec.RestartPolicy)
+	assert.Equal(t, "engine-1-2-3", spec.Subdomain)
+	assert.Equal(t, []apiv1.EnvVar{{Name: runonce.Env, Value: "true"}}, spec.Containers[0].Env)
+	// The statefulset is left as it was
+	assert.Empty(t, planConfig.Spec.Template.Spec.Containers[0].Env)
+}
+
+func TestJobFinished(t *testing.T) {
+	job := &batchv1.Job{}
+	assert.False(t, jobFinished(job))
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: apiv1.ConditionFalse}}
+	assert.False(t, jobFinished(job))
+	job.Status.Conditions[0].Status = apiv1.ConditionTrue
+	assert.True(t, jobFinished(job))
+	job.Status.Conditions[0].Type = batchv1.JobFailed
+	assert.True(t, jobFinished(job))
+}
+
+func TestProcessPodsStatusSkipsFinishedEngines(t *testing.T) {
+	running := makePod(apiv1.PodRunning)
+	running.Labels = map[string]string{"plan": "3"}
+	finished := makePod(apiv1.PodSucceeded)
+	finished.Labels = map[string]string{"plan": "3"}
+	planStatuses := initializePlanStatuses([]*model.ExecutionPlan{{PlanID: 3, Engines: 1}})
+	_, ready := (&K8sClientManager{}).processPodsStatus([]apiv1.Pod{finished, running}, planStatuses)
+	assert.True(t, ready)
+	assert.Equal(t, 1, planStatuses[3].EnginesDeployed)
+}
+
+// The stateful set created by the first attempt is kept when the creation of the service times out and the
+// deployment is retried
+func TestDeployPlanRetried(t *testing.T) {
+	model.SetupLocalDatabase(t)
+	client := fake.NewSimpleClientset()
+	failed := false
+	client.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if failed {
+			return false, nil, nil
+		}
+		failed = true
+		return true, nil, apierrors.NewServerTimeout(apiv1.Resource("services"), "create", 1)
+	})
+	ec := config.SC.ExecutorConfig
+	defer func() { config.SC.ExecutorConfig = ec }()
+	config.SC.ExecutorConfig = &config.ExecutorConfig{Namespace: "setagaya-executors", Cluster: &config.ClusterConfig{}}
+	kcm := &K8sClientManager{ExecutorConfig: config.SC.ExecutorConfig, client: client}
+	rs := newResilientScheduler("test", kcm, &config.SchedulerResilience{Attempts: 3, BackoffMs: 1,
+		FailureThreshold: 5, CooldownSeconds: 1})
+	ctx := context.Background()
+	assert.NoError(t, rs.DeployPlan(ctx, 1, 2, 3, 2, &config.ExecutorContainer{Image: "setagaya:jmeter", CPU: "1", Mem: "1Gi"}))
+	assert.True(t, failed)
+	_, err := client.AppsV1().StatefulSets("setagaya-executors").Get(ctx, "engine-1-2-3", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = client.CoreV1().Services("setagaya-executors").Get(ctx, "engine-1-2-3", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
@@ -3,12 +3,29 @@ package scheduler
 import (
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func makeName(kind string, projectID, collectionID, planID int64, engineID int) string {
 	return fmt.Sprintf("%s-%d-%d-%d-%d", kind, projectID, collectionID, planID, engineID)
 }
 
+// ParseEngineName returns the ids in the name of an engine, as listed in the details of the engines of a collection
+func ParseEngineName(name string) (projectID, collectionID, planID int64, engineID int, err error) {
+	parts := strings.Split(name, "-")
+	if len(parts) != 5 || parts[0] != "engine" {
+		return 0, 0, 0, 0, fmt.Errorf("%s is not the name of an engine", name)
+	}
+	ids := make([]int64, 4)
+	for i, p := range parts[1:] {
+		if ids[i], err = strconv.ParseInt(p, 10, 64); err != nil || ids[i] < 0 {
+			return 0, 0, 0, 0, fmt.Errorf("%s is not the name of an engine", name)
+		}
+	}
+	return ids[0], ids[1], ids[2], int(ids[3]), nil
+}
+
 func makeEngineName(projectID, collectionID, planID int64, engineID int) string {
 	return makeName("engine", projectID, collectionID, planID, engineID)
 }
@@ -59,6 +76,29 @@ func makePlanLabel(projectID, collectionID, planID int64) map[string]string {
 	return base
 }
 
+func makeTenantLabel(tenant string) map[string]string {
+	return map[string]string{"tenant": tenant}
+}
+
 func makeCollectionLabel(collectionID int64) string {
 	return fmt.Sprintf("collection=%d", collectionID)
 }
+
+func makePlanSelector(collectionID, planID int64) string {
+	return fmt.Sprintf("collection=%d,plan=%d", collectionID, planID)
+}
+
+// collectionLabel is set on every resource deployed for a collection
+const collectionLabel = "collection"
+
+// addCollectionResource records a resource of the collection found in its labels. A collection is
+// kept with the creation time of its newest resource. Resources without a valid label are ignored.
+func addCollectionResource(collections map[int64]time.Time, labels map[string]string, created time.Time) {
+	collectionID, err := strconv.ParseInt(labels[collectionLabel], 10, 64)
+	if err != nil {
+		return
+	}
+	if t, ok := collections[collectionID]; !ok || created.After(t) {
+		collections[collectionID] = created
+	}
+}
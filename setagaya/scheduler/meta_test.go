@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -123,6 +124,21 @@ func TestMakeEngineName(t *testing.T) {
 	}
 }
 
+func TestParseEngineName(t *testing.T) {
+	projectID, collectionID, planID, engineID, err := ParseEngineName(makeEngineName(123, 456, 789, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(123), projectID)
+	assert.Equal(t, int64(456), collectionID)
+	assert.Equal(t, int64(789), planID)
+	assert.Equal(t, 2, engineID)
+
+	for _, name := range []string{"", "engine-1-2-3", "ingress-1-2-3-4", "engine-1-2-3-x", "engine-1-2-3--4",
+		"engine-1-2-3-4-5"} {
+		_, _, _, _, err := ParseEngineName(name)
+		assert.Error(t, err, name)
+	}
+}
+
 func TestMakePlanName(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -501,3 +517,15 @@ func TestLabelConsistency(t *testing.T) {
 	assert.Equal(t, "executor", engineLabel["kind"])
 	assert.Equal(t, "executor", planLabel["kind"])
 }
+
+func TestAddCollectionResource(t *testing.T) {
+	older := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	collections := make(map[int64]time.Time)
+	addCollectionResource(collections, map[string]string{"collection": "1"}, newer)
+	addCollectionResource(collections, map[string]string{"collection": "1"}, older)
+	addCollectionResource(collections, map[string]string{"collection": "2"}, older)
+	addCollectionResource(collections, map[string]string{"collection": "invalid"}, older)
+	addCollectionResource(collections, map[string]string{"kind": "ingress-controller"}, older)
+	assert.Equal(t, map[int64]time.Time{1: newer, 2: older}, collections)
+}
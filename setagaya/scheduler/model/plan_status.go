@@ -3,6 +3,8 @@ package model
 import (
 	"time"
 
+	apiv1 "k8s.io/api/core/v1"
+
 	"github.com/hveda/Setagaya/setagaya/model"
 )
 
@@ -13,6 +15,8 @@ type PlanStatus struct {
 	EnginesDeployed  int       `json:"engines_deployed"`
 	InProgress       bool      `json:"in_progress"`
 	StartedTime      time.Time `json:"started_time"`
+	// Phase of the plan in progress, see the phases of model.ExecutionPlan. Empty when it's not in progress
+	Phase string `json:"phase,omitempty"`
 }
 
 type CollectionStatus struct {
@@ -34,10 +38,44 @@ type NodesInfo struct {
 
 type AllNodesInfo map[string]*NodesInfo
 
+// ClusterCapacity is the room left for the engines in a cluster
+type ClusterCapacity struct {
+	// Nodes the engines can be scheduled on
+	Nodes       int                `json:"nodes"`
+	Allocatable apiv1.ResourceList `json:"allocatable"`
+	// Engines deployed in the cluster and the resources they requested
+	Engines   int                `json:"engines"`
+	Requested apiv1.ResourceList `json:"requested"`
+}
+
 type EngineStatus struct {
 	Name        string    `json:"name"`
 	Status      string    `json:"status"`
 	CreatedTime time.Time `json:"created_time"`
+	PlanID      int64     `json:"plan_id,omitempty"`
+	// Digest of the image the engine runs, once it's pulled
+	Image string `json:"image,omitempty"`
+}
+
+// Stages an engine goes through while it's deployed, in order
+const (
+	EnginePending      = "pending"
+	EngineCreated      = "created"
+	EngineScheduled    = "scheduled"
+	EnginePullingImage = "pulling_image"
+	EngineStarting     = "starting"
+	EngineReady        = "ready"
+	EngineReachable    = "reachable"
+	// The engine cannot get any further, e.g. its image cannot be pulled
+	EngineFailed = "failed"
+)
+
+// EngineProgress is how far the deployment of an engine got
+type EngineProgress struct {
+	PlanID   int64  `json:"plan_id"`
+	EngineID int    `json:"engine_id"`
+	Stage    string `json:"stage"`
+	Message  string `json:"message,omitempty"`
 }
 
 type CollectionDetails struct {
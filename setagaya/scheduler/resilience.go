@@ -0,0 +1,380 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
+)
+
+// ErrSchedulerUnavailable is returned without calling the scheduler while its circuit is open
+var ErrSchedulerUnavailable = errors.New("the scheduler is unavailable after too many failed calls, retry later")
+
+// UnavailableError is the ErrSchedulerUnavailable of an operation, with the time left before the scheduler is called
+// again
+type UnavailableError struct {
+	Operation  string
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Operation, ErrSchedulerUnavailable)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return ErrSchedulerUnavailable
+}
+
+// Kinds of the failed calls to the scheduler
+const (
+	callFailureTransient = "transient"
+	callFailurePermanent = "permanent"
+	callFailureRejected  = "rejected"
+)
+
+// isTransient tells whether the call may succeed if it's made again: the scheduler timed out, was overloaded or
+// could not be reached. The errors the scheduler answers with, like a missing resource, are not transient.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err) || apierrors.IsInternalError(err) || apierrors.IsUnexpectedServerError(err) {
+		return true
+	}
+	var ge *googleapi.Error
+	if errors.As(err, &ge) {
+		return ge.Code == http.StatusTooManyRequests || ge.Code >= http.StatusInternalServerError
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// circuitBreaker opens after too many transient failures in a row. Once the cool-down is over, a single call is let
+// through: the circuit closes when it succeeds and stays open for another cool-down when it fails.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+}
+
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.failures < cb.threshold {
+		return true
+	}
+	if cb.now().Sub(cb.openedAt) < cb.cooldown {
+		return false
+	}
+	// The other calls wait for the outcome of this one
+	cb.openedAt = cb.now()
+	return true
+}
+
+// retryAfter is what is left of the cool-down of the open circuit
+func (cb *circuitBreaker) retryAfter() time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return max(cb.cooldown-cb.now().Sub(cb.openedAt), 0)
+}
+
+func (cb *circuitBreaker) record(transient bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if !transient {
+		if cb.failures >= cb.threshold {
+			log.Printf("The circuit of the %s scheduler is closed", cb.name)
+			config.SchedulerCircuitOpenGauge.WithLabelValues(cb.name).Set(0)
+		}
+		cb.failures = 0
+		return
+	}
+	cb.failures++
+	if cb.failures == cb.threshold {
+		log.Printf("The circuit of the %s scheduler is open after %d failed calls in a row", cb.name, cb.failures)
+		config.SchedulerCircuitOpenGauge.WithLabelValues(cb.name).Set(1)
+	}
+	if cb.failures >= cb.threshold {
+		cb.openedAt = cb.now()
+	}
+}
+
+// resilience retries the calls failing transiently, with an exponential backoff and jitter, behind a circuit breaker.
+// The calls are not retried once their context is done.
+type resilience struct {
+	attempts int
+	backoff  time.Duration
+	breaker  *circuitBreaker
+	sleep    func(context.Context, time.Duration) error
+}
+
+func newResilience(name string, cfg *config.SchedulerResilience) *resilience {
+	cfg = cfg.WithDefaults()
+	return &resilience{
+		attempts: cfg.Attempts,
+		backoff:  time.Duration(cfg.BackoffMs) * time.Millisecond,
+		breaker: &circuitBreaker{
+			name:      name,
+			threshold: cfg.FailureThreshold,
+			cooldown:  time.Duration(cfg.CooldownSeconds) * time.Second,
+			now:       time.Now,
+		},
+		sleep: sleepContext,
+	}
+}
+
+// sleepContext waits for d, or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait is the backoff before the retry, between half and all of the doubled backoff
+func (r *resilience) wait(retry int) time.Duration {
+	d := r.backoff << (retry - 1)
+	return d/2 + rand.N(d/2+1)
+}
+
+func (r *resilience) do(ctx context.Context, operation string, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var err error
+	for attempt := 1; attempt <= r.attempts; attempt++ {
+		if attempt > 1 {
+			if sleepErr := r.sleep(ctx, r.wait(attempt-1)); sleepErr != nil {
+				return err
+			}
+		}
+		if !r.breaker.allow() {
+			config.SchedulerCallFailures.WithLabelValues(operation, callFailureRejected).Inc()
+			if err != nil {
+				return err
+			}
+			return &UnavailableError{Operation: operation, RetryAfter: r.breaker.retryAfter()}
+		}
+		err = f()
+		// The call was cancelled or ran out of time, the scheduler did not fail
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		transient := isTransient(err)
+		r.breaker.record(transient)
+		if !transient {
+			if err != nil && !errors.Is(err, ErrFeatureUnavailable) {
+				config.SchedulerCallFailures.WithLabelValues(operation, callFailurePermanent).Inc()
+			}
+			return err
+		}
+		config.SchedulerCallFailures.WithLabelValues(operation, callFailureTransient).Inc()
+		log.Printf("Scheduler call %s failed, attempt %d of %d: %v", operation, attempt, r.attempts, err)
+	}
+	return err
+}
+
+func call[T any](ctx context.Context, r *resilience, operation string, f func() (T, error)) (T, error) {
+	var v T
+	err := r.do(ctx, operation, func() error {
+		var err error
+		v, err = f()
+		return err
+	})
+	return v, err
+}
+
+// resilientScheduler makes the calls of the controller to the scheduler through the resilience
+type resilientScheduler struct {
+	scheduler EngineScheduler
+	r         *resilience
+}
+
+func newResilientScheduler(name string, s EngineScheduler, cfg *config.SchedulerResilience) EngineScheduler {
+	return &resilientScheduler{scheduler: s, r: newResilience(name, cfg)}
+}
+
+// Ping is not retried, the callers waiting for the cluster retry it themselves
+func (rs *resilientScheduler) Ping(ctx context.Context) error {
+	return Ping(ctx, rs.scheduler)
+}
+
+func (rs *resilientScheduler) Region() string {
+	if r, ok := rs.scheduler.(Regioner); ok {
+		return r.Region()
+	}
+	return ""
+}
+
+func (rs *resilientScheduler) DeployEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int,
+	containerConfig *config.ExecutorContainer) error {
+	return rs.r.do(ctx, "deploy_engine", func() error {
+		return rs.scheduler.DeployEngine(ctx, projectID, collectionID, planID, engineID, containerConfig)
+	})
+}
+
+func (rs *resilientScheduler) DeployPlan(ctx context.Context, projectID, collectionID, planID int64, replicas int,
+	containerConfig *config.ExecutorContainer) error {
+	return rs.r.do(ctx, "deploy_plan", func() error {
+		return rs.scheduler.DeployPlan(ctx, projectID, collectionID, planID, replicas, containerConfig)
+	})
+}
+
+// RenderPlan does not call the scheduler
+func (rs *resilientScheduler) RenderPlan(projectID, collectionID, planID int64, replicas int,
+	containerConfig *config.ExecutorContainer) ([]runtime.Object, error) {
+	return rs.scheduler.RenderPlan(projectID, collectionID, planID, replicas, containerConfig)
+}
+
+func (rs *resilientScheduler) CollectionCompleted(ctx context.Context, collectionID int64) (bool, error) {
+	return call(ctx, rs.r, "collection_completed", func() (bool, error) {
+		return rs.scheduler.CollectionCompleted(ctx, collectionID)
+	})
+}
+
+func (rs *resilientScheduler) CollectionStatus(ctx context.Context, projectID, collectionID int64,
+	eps []*model.ExecutionPlan) (*smodel.CollectionStatus, error) {
+	return call(ctx, rs.r, "collection_status", func() (*smodel.CollectionStatus, error) {
+		return rs.scheduler.CollectionStatus(ctx, projectID, collectionID, eps)
+	})
+}
+
+func (rs *resilientScheduler) FetchEngineUrlsByPlan(ctx context.Context, collectionID, planID int64,
+	opts *smodel.EngineOwnerRef) ([]string, error) {
+	return call(ctx, rs.r, "fetch_engine_urls", func() ([]string, error) {
+		return rs.scheduler.FetchEngineUrlsByPlan(ctx, collectionID, planID, opts)
+	})
+}
+
+func (rs *resilientScheduler) PurgeCollection(ctx context.Context, collectionID int64) error {
+	return rs.r.do(ctx, "purge_collection", func() error {
+		return rs.scheduler.PurgeCollection(ctx, collectionID)
+	})
+}
+
+func (rs *resilientScheduler) PurgePlan(ctx context.Context, collectionID, planID int64) error {
+	return rs.r.do(ctx, "purge_plan", func() error {
+		return rs.scheduler.PurgePlan(ctx, collectionID, planID)
+	})
+}
+
+func (rs *resilientScheduler) ReplaceEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int,
+	containerConfig *config.ExecutorContainer) error {
+	return rs.r.do(ctx, "replace_engine", func() error {
+		return rs.scheduler.ReplaceEngine(ctx, projectID, collectionID, planID, engineID, containerConfig)
+	})
+}
+
+func (rs *resilientScheduler) GetDeployedCollections(ctx context.Context) (map[int64]time.Time, error) {
+	return call(ctx, rs.r, "get_deployed_collections", func() (map[int64]time.Time, error) {
+		return rs.scheduler.GetDeployedCollections(ctx)
+	})
+}
+
+func (rs *resilientScheduler) GetCollectionResources(ctx context.Context) (map[int64]time.Time, error) {
+	return call(ctx, rs.r, "get_collection_resources", func() (map[int64]time.Time, error) {
+		return rs.scheduler.GetCollectionResources(ctx)
+	})
+}
+
+func (rs *resilientScheduler) GetPodsMetrics(ctx context.Context, collectionID, planID int64) (map[string]apiv1.ResourceList, error) {
+	return call(ctx, rs.r, "get_pods_metrics", func() (map[string]apiv1.ResourceList, error) {
+		return rs.scheduler.GetPodsMetrics(ctx, collectionID, planID)
+	})
+}
+
+// PodReadyCount does not tell its failures, they cannot be retried
+func (rs *resilientScheduler) PodReadyCount(ctx context.Context, collectionID int64) int {
+	return rs.scheduler.PodReadyCount(ctx, collectionID)
+}
+
+func (rs *resilientScheduler) EngineCount(ctx context.Context, collectionID int64) (int, error) {
+	return call(ctx, rs.r, "engine_count", func() (int, error) {
+		return rs.scheduler.EngineCount(ctx, collectionID)
+	})
+}
+
+func (rs *resilientScheduler) DownloadPodLog(ctx context.Context, collectionID, planID int64) (string, error) {
+	return call(ctx, rs.r, "download_pod_log", func() (string, error) {
+		return rs.scheduler.DownloadPodLog(ctx, collectionID, planID)
+	})
+}
+
+func (rs *resilientScheduler) GetCollectionEnginesDetail(ctx context.Context, projectID, collectionID int64) (*smodel.CollectionDetails, error) {
+	return call(ctx, rs.r, "get_collection_engines_detail", func() (*smodel.CollectionDetails, error) {
+		return rs.scheduler.GetCollectionEnginesDetail(ctx, projectID, collectionID)
+	})
+}
+
+func (rs *resilientScheduler) GetEnginesProgress(ctx context.Context, projectID, collectionID int64,
+	eps []*model.ExecutionPlan) ([]*smodel.EngineProgress, error) {
+	return call(ctx, rs.r, "get_engines_progress", func() ([]*smodel.EngineProgress, error) {
+		return rs.scheduler.GetEnginesProgress(ctx, projectID, collectionID, eps)
+	})
+}
+
+func (rs *resilientScheduler) GetClusterCapacity(ctx context.Context) (*smodel.ClusterCapacity, error) {
+	return call(ctx, rs.r, "get_cluster_capacity", func() (*smodel.ClusterCapacity, error) {
+		return rs.scheduler.GetClusterCapacity(ctx)
+	})
+}
+
+func (rs *resilientScheduler) ProvisionTenant(ctx context.Context, tenant *model.Tenant) error {
+	return rs.r.do(ctx, "provision_tenant", func() error {
+		return rs.scheduler.ProvisionTenant(ctx, tenant)
+	})
+}
+
+func (rs *resilientScheduler) GetDeployedServices(ctx context.Context) (map[int64]time.Time, error) {
+	return call(ctx, rs.r, "get_deployed_services", func() (map[int64]time.Time, error) {
+		return rs.scheduler.GetDeployedServices(ctx)
+	})
+}
+
+func (rs *resilientScheduler) ExposeProject(ctx context.Context, projectID int64) error {
+	return rs.r.do(ctx, "expose_project", func() error {
+		return rs.scheduler.ExposeProject(ctx, projectID)
+	})
+}
+
+func (rs *resilientScheduler) PurgeProjectIngress(ctx context.Context, projectID int64) error {
+	return rs.r.do(ctx, "purge_project_ingress", func() error {
+		return rs.scheduler.PurgeProjectIngress(ctx, projectID)
+	})
+}
+
+func (rs *resilientScheduler) GetEnginesByProject(ctx context.Context, projectID int64) ([]apiv1.Pod, error) {
+	return call(ctx, rs.r, "get_engines_by_project", func() ([]apiv1.Pod, error) {
+		return rs.scheduler.GetEnginesByProject(ctx, projectID)
+	})
+}
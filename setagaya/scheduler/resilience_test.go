@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+)
+
+func TestIsTransient(t *testing.T) {
+	resource := schema.GroupResource{Resource: "deployments"}
+	assert.True(t, isTransient(apierrors.NewServerTimeout(resource, "create", 1)))
+	assert.True(t, isTransient(apierrors.NewTooManyRequests("slow down", 1)))
+	assert.True(t, isTransient(fmt.Errorf("deploying: %w", apierrors.NewServiceUnavailable("etcd"))))
+	assert.True(t, isTransient(&googleapi.Error{Code: http.StatusBadGateway}))
+	assert.True(t, isTransient(fmt.Errorf("dial: %w", syscall.ECONNREFUSED)))
+
+	assert.False(t, isTransient(nil))
+	assert.False(t, isTransient(apierrors.NewNotFound(resource, "engine-1")))
+	assert.False(t, isTransient(apierrors.NewAlreadyExists(resource, "engine-1")))
+	assert.False(t, isTransient(&googleapi.Error{Code: http.StatusForbidden}))
+	assert.False(t, isTransient(ErrFeatureUnavailable))
+}
+
+func newTestResilience(attempts, threshold int) (*resilience, *time.Time) {
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	r := newResilience("test", &config.SchedulerResilience{Attempts: attempts, BackoffMs: 100,
+		FailureThreshold: threshold, CooldownSeconds: 30})
+	r.breaker.now = func() time.Time { return now }
+	r.sleep = func(context.Context, time.Duration) error { return nil }
+	return r, &now
+}
+
+func TestResilienceRetries(t *testing.T) {
+	r, _ := newTestResilience(3, 10)
+	ctx := context.Background()
+	unavailable := apierrors.NewServiceUnavailable("etcd")
+
+	calls := 0
+	err := r.do(ctx, "deploy_plan", func() error {
+		calls++
+		if calls < 3 {
+			return unavailable
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = r.do(ctx, "deploy_plan", func() error {
+		calls++
+		return unavailable
+	})
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 3, calls)
+
+	// The answers of the scheduler are not retried
+	calls = 0
+	notFound := apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "engine-1")
+	_, err = call(ctx, r, "download_pod_log", func() (string, error) {
+		calls++
+		return "", notFound
+	})
+	assert.ErrorIs(t, err, notFound)
+	assert.Equal(t, 1, calls)
+}
+
+func TestResilienceCircuitBreaker(t *testing.T) {
+	r, now := newTestResilience(1, 2)
+	ctx := context.Background()
+	unavailable := errors.Join(errors.New("apiserver"), syscall.ECONNRESET)
+	failing := func() error { return unavailable }
+
+	assert.ErrorIs(t, r.do(ctx, "purge_collection", failing), syscall.ECONNRESET)
+	assert.ErrorIs(t, r.do(ctx, "purge_collection", failing), syscall.ECONNRESET)
+
+	// The circuit is open, the scheduler is not called
+	called := false
+	err := r.do(ctx, "purge_collection", func() error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrSchedulerUnavailable)
+	assert.False(t, called)
+	var ue *UnavailableError
+	assert.ErrorAs(t, err, &ue)
+	assert.Equal(t, "purge_collection", ue.Operation)
+	assert.Equal(t, 30*time.Second, ue.RetryAfter)
+
+	// A single call is let through after the cool-down, it opens the circuit again when it fails
+	*now = now.Add(31 * time.Second)
+	assert.ErrorIs(t, r.do(ctx, "purge_collection", failing), syscall.ECONNRESET)
+	assert.ErrorIs(t, r.do(ctx, "purge_collection", failing), ErrSchedulerUnavailable)
+
+	// And closes it when it succeeds
+	*now = now.Add(31 * time.Second)
+	assert.NoError(t, r.do(ctx, "purge_collection", func() error { return nil }))
+	assert.NoError(t, r.do(ctx, "purge_collection", func() error { return nil }))
+}
+
+func TestResilienceCancelled(t *testing.T) {
+	r, _ := newTestResilience(3, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The retries stop when the operation is cancelled, and the breaker does not count the call
+	calls := 0
+	err := r.do(ctx, "purge_collection", func() error {
+		calls++
+		cancel()
+		return errors.Join(context.Canceled, syscall.ECONNRESET)
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+	assert.NoError(t, r.do(context.Background(), "purge_collection", func() error { return nil }))
+
+	// A cancelled operation does not call the scheduler
+	called := false
+	err = r.do(ctx, "purge_collection", func() error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, called)
+}
+
+func TestSleepContext(t *testing.T) {
+	assert.NoError(t, sleepContext(context.Background(), time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, sleepContext(ctx, time.Hour), context.Canceled)
+}
+
+func TestResilienceWait(t *testing.T) {
+	r, _ := newTestResilience(3, 5)
+	for retry, limit := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		for i := 0; i < 20; i++ {
+			w := r.wait(retry + 1)
+			assert.GreaterOrEqual(t, w, limit/2)
+			assert.LessOrEqual(t, w, limit)
+		}
+	}
+}
+
+func TestSchedulerResilienceDefaults(t *testing.T) {
+	var unset *config.SchedulerResilience
+	assert.Equal(t, &config.SchedulerResilience{Attempts: 3, BackoffMs: 200, FailureThreshold: 5, CooldownSeconds: 30},
+		unset.WithDefaults())
+	assert.Equal(t, 1, (&config.SchedulerResilience{Attempts: 1}).WithDefaults().Attempts)
+}
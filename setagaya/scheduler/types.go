@@ -1,42 +1,104 @@
 package scheduler
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/hveda/Setagaya/setagaya/config"
 	"github.com/hveda/Setagaya/setagaya/model"
 	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
 )
 
+// EngineScheduler creates and deletes the engines of the collections. The calls of the deploy, trigger, stop and purge
+// paths take the context of the operation, they stop when it's cancelled or its deadline is reached.
 type EngineScheduler interface {
-	DeployEngine(projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error
-	DeployPlan(projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) error
-	CollectionStatus(projectID, collectionID int64, eps []*model.ExecutionPlan) (*smodel.CollectionStatus, error)
-	FetchEngineUrlsByPlan(collectionID, planID int64, opts *smodel.EngineOwnerRef) ([]string, error)
-	PurgeCollection(collectionID int64) error
-	GetDeployedCollections() (map[int64]time.Time, error)
-	GetPodsMetrics(collectionID, planID int64) (map[string]apiv1.ResourceList, error)
-	PodReadyCount(collectionID int64) int
-	DownloadPodLog(collectionID, planID int64) (string, error)
-	GetCollectionEnginesDetail(projectID, collectionID int64) (*smodel.CollectionDetails, error)
-	GetDeployedServices() (map[int64]time.Time, error)
-	ExposeProject(projectID int64) error
-	PurgeProjectIngress(projectID int64) error
-	GetEnginesByProject(projectID int64) ([]apiv1.Pod, error)
+	DeployEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error
+	DeployPlan(ctx context.Context, projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) error
+	RenderPlan(projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) ([]runtime.Object, error)
+	// Tells whether the engines of the collection all exited, when they run as jobs
+	CollectionCompleted(ctx context.Context, collectionID int64) (bool, error)
+	CollectionStatus(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) (*smodel.CollectionStatus, error)
+	FetchEngineUrlsByPlan(ctx context.Context, collectionID, planID int64, opts *smodel.EngineOwnerRef) ([]string, error)
+	PurgeCollection(ctx context.Context, collectionID int64) error
+	// Removes the engines of a single plan of the collection, e.g. to deploy them again during a run
+	PurgePlan(ctx context.Context, collectionID, planID int64) error
+	// Deletes a single engine of a plan and creates it again, e.g. when it misbehaves
+	ReplaceEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error
+	GetDeployedCollections(ctx context.Context) (map[int64]time.Time, error)
+	GetCollectionResources(ctx context.Context) (map[int64]time.Time, error)
+	GetPodsMetrics(ctx context.Context, collectionID, planID int64) (map[string]apiv1.ResourceList, error)
+	PodReadyCount(ctx context.Context, collectionID int64) int
+	EngineCount(ctx context.Context, collectionID int64) (int, error)
+	DownloadPodLog(ctx context.Context, collectionID, planID int64) (string, error)
+	GetCollectionEnginesDetail(ctx context.Context, projectID, collectionID int64) (*smodel.CollectionDetails, error)
+	GetEnginesProgress(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) ([]*smodel.EngineProgress, error)
+	GetClusterCapacity(ctx context.Context) (*smodel.ClusterCapacity, error)
+	ProvisionTenant(ctx context.Context, tenant *model.Tenant) error
+	GetDeployedServices(ctx context.Context) (map[int64]time.Time, error)
+	ExposeProject(ctx context.Context, projectID int64) error
+	PurgeProjectIngress(ctx context.Context, projectID int64) error
+	GetEnginesByProject(ctx context.Context, projectID int64) ([]apiv1.Pod, error)
 }
 
 var ErrFeatureUnavailable = errors.New("feature unavailable")
 
+// Pinger is a scheduler which can tell whether its cluster is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping tells whether the cluster of the scheduler is reachable. The schedulers which cannot tell are deemed so
+func Ping(ctx context.Context, s EngineScheduler) error {
+	if p, ok := s.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Regioner is a scheduler which deploys the engines in a known region
+type Regioner interface {
+	Region() string
+}
+
+// CheckRegions tells whether the scheduler can spread the engines of a plan across the regions by their weights.
+// The engines of a plan are deployed together, in the region of the cluster, so the weights are only honoured when
+// all the traffic comes from that region. The schedulers which do not tell their region honour no weights.
+func CheckRegions(s EngineScheduler, regions []*model.RegionWeight) error {
+	if len(regions) == 0 {
+		return nil
+	}
+	region := ""
+	if r, ok := s.(Regioner); ok {
+		region = r.Region()
+	}
+	for _, rw := range regions {
+		if rw.Region != region {
+			if region == "" {
+				return fmt.Errorf("%w: the scheduler cannot deploy the engines in region %s", ErrFeatureUnavailable,
+					rw.Region)
+			}
+			return fmt.Errorf("%w: the scheduler deploys the engines in region %s only, not in %s",
+				ErrFeatureUnavailable, region, rw.Region)
+		}
+	}
+	return nil
+}
+
+// NewEngineScheduler returns the scheduler of the cluster. Its calls failing transiently are retried
 func NewEngineScheduler(cfg *config.ClusterConfig) EngineScheduler {
 	switch cfg.Kind {
 	case "k8s":
-		return NewK8sClientManager(cfg)
+		return newResilientScheduler(cfg.Kind, NewK8sClientManager(cfg), cfg.Resilience)
 	case "cloudrun":
-		return NewCloudRun(cfg)
+		return newResilientScheduler(cfg.Kind, NewCloudRun(cfg), cfg.Resilience)
+	case "docker":
+		return newResilientScheduler(cfg.Kind, NewDocker(cfg), cfg.Resilience)
 	}
 	log.Fatalf("Setagaya does not support %s as scheduler", cfg.Kind)
 	return nil
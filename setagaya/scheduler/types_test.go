@@ -0,0 +1,26 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/model"
+)
+
+func TestCheckRegions(t *testing.T) {
+	asia := []*model.RegionWeight{{Region: "asia", Weight: 100}}
+	spread := []*model.RegionWeight{{Region: "asia", Weight: 70}, {Region: "europe", Weight: 30}}
+	k8s := newResilientScheduler("k8s", &K8sClientManager{region: "asia"}, nil)
+
+	assert.NoError(t, CheckRegions(k8s, nil))
+	assert.NoError(t, CheckRegions(k8s, asia))
+	// Only a share of the engines could be deployed where they should
+	assert.True(t, errors.Is(CheckRegions(k8s, spread), ErrFeatureUnavailable))
+	assert.True(t, errors.Is(CheckRegions(&CloudRun{region: "europe"}, asia), ErrFeatureUnavailable))
+	// The clusters without region cannot honour any weight
+	assert.True(t, errors.Is(CheckRegions(&K8sClientManager{}, asia), ErrFeatureUnavailable))
+	assert.True(t, errors.Is(CheckRegions(newResilientScheduler("docker", &Docker{}, nil), asia),
+		ErrFeatureUnavailable))
+}
@@ -0,0 +1,122 @@
+package testutil
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+var metricRates = flag.String("metric-rates", "0,10000,100000",
+	"samples per second the benchmarks of the metric path are run at, 0 sends them as fast as they are taken")
+
+// MetricRates are the rates of the -metric-rates flag, for the benchmarks of the metric path
+func MetricRates() ([]int, error) {
+	rates := []int{}
+	for _, s := range strings.Split(*metricRates, ",") {
+		rate, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid metric rate %q", s)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// MetricLoad generates synthetic JTL samples at a steady rate, standing in for jmeter in the benchmarks of the
+// metric path of the agents and the controller. The samples have the default columns.
+type MetricLoad struct {
+	// Samples per second, 0 sends them as fast as they are taken
+	Rate    int
+	Samples int
+	// Distinct labels the samples are spread over
+	Labels int
+}
+
+// JTLLine is the nth sample of the load. One sample in 50 fails
+func (ml *MetricLoad) JTLLine(n int, now time.Time) string {
+	labels := max(ml.Labels, 1)
+	r := &enginesModel.JTLRecord{
+		Timestamp:       now.UnixMilli(),
+		Elapsed:         float64(50 + n%200),
+		Label:           fmt.Sprintf("request-%d", n%labels),
+		ResponseCode:    "200",
+		ResponseMessage: "OK",
+		ThreadName:      fmt.Sprintf("Thread Group 1-%d", n%100+1),
+		Success:         true,
+		Bytes:           1024,
+		GrpThreads:      100,
+		AllThreads:      100,
+		Latency:         float64(40 + n%200),
+		Connect:         5,
+	}
+	if n%50 == 49 {
+		r.ResponseCode, r.ResponseMessage, r.Success = "500", "Internal Server Error", false
+	}
+	return r.String()
+}
+
+// Run sends the samples at the rate of the load, until they are all sent or ctx is done. It returns the number of
+// samples sent. send blocking holds the load back, the samples are then sent late rather than dropped.
+func (ml *MetricLoad) Run(ctx context.Context, send func(line string)) int {
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	start := time.Now()
+	sent := 0
+	for sent < ml.Samples {
+		due := ml.Samples
+		if ml.Rate > 0 {
+			due = min(ml.Samples, int(time.Since(start).Seconds()*float64(ml.Rate))+1)
+		}
+		for ; sent < due; sent++ {
+			send(ml.JTLLine(sent, time.Now()))
+		}
+		if sent == ml.Samples {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return sent
+		case <-ticker.C:
+		}
+	}
+	return sent
+}
+
+// MetricLoadReport is what a benchmark of the metric path measured: the samples sent by the load, the ones the
+// subscribers received, and the time until the last one was received
+type MetricLoadReport struct {
+	Rate        int
+	Subscribers int
+	Sent        int
+	Received    int
+	Elapsed     time.Duration
+}
+
+// Dropped are the samples some subscriber never received
+func (r *MetricLoadReport) Dropped() int {
+	return r.Sent*r.Subscribers - r.Received
+}
+
+// Throughput is the samples received by every subscriber per second
+func (r *MetricLoadReport) Throughput() float64 {
+	if r.Elapsed <= 0 || r.Subscribers == 0 {
+		return 0
+	}
+	return float64(r.Received) / float64(r.Subscribers) / r.Elapsed.Seconds()
+}
+
+// MetricReporter is what the figures are reported to, a testing.B
+type MetricReporter interface {
+	ReportMetric(n float64, unit string)
+}
+
+// ReportTo adds the figures to the benchmark. Below the rate of the load, the path could not keep up with it
+func (r *MetricLoadReport) ReportTo(b MetricReporter) {
+	b.ReportMetric(r.Throughput(), "samples/s")
+	b.ReportMetric(float64(r.Dropped()), "dropped")
+}
@@ -0,0 +1,45 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	enginesModel "github.com/hveda/Setagaya/setagaya/engines/model"
+)
+
+func TestMetricLoad(t *testing.T) {
+	load := &MetricLoad{Samples: 100, Labels: 3}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	record, err := enginesModel.ParseJTLLine(load.JTLLine(4, now))
+	assert.NoError(t, err)
+	assert.Equal(t, now.UnixMilli(), record.Timestamp)
+	assert.Equal(t, "request-1", record.Label)
+	assert.True(t, record.Success)
+	record, err = enginesModel.ParseJTLLine(load.JTLLine(49, now))
+	assert.NoError(t, err)
+	assert.Equal(t, "500", record.ResponseCode)
+	assert.False(t, record.Success)
+
+	lines := 0
+	assert.Equal(t, 100, load.Run(context.Background(), func(string) { lines++ }))
+	assert.Equal(t, 100, lines)
+
+	// Cancelled before the samples due later are sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	load.Rate = 10
+	assert.Equal(t, 1, load.Run(ctx, func(string) {}))
+}
+
+func TestMetricLoadReport(t *testing.T) {
+	r := &MetricLoadReport{Rate: 1000, Subscribers: 2, Sent: 1000, Received: 1900, Elapsed: 2 * time.Second}
+	assert.Equal(t, 100, r.Dropped())
+	assert.Equal(t, 475.0, r.Throughput())
+
+	rates, err := MetricRates()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 10000, 100000}, rates)
+}
@@ -0,0 +1,453 @@
+// Package testutil provides fakes of the scheduler and of the object storage, so the api and the controller
+// can be tested without a cluster or a storage service.
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+	"github.com/hveda/Setagaya/setagaya/scheduler"
+	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
+)
+
+var _ scheduler.EngineScheduler = (*FakeScheduler)(nil)
+
+type fakeEngine struct {
+	projectID    int64
+	collectionID int64
+	planID       int64
+	engineID     int
+	image        string
+	createdTime  time.Time
+}
+
+func (fe *fakeEngine) name() string {
+	return fmt.Sprintf("engine-%d-%d-%d-%d", fe.projectID, fe.collectionID, fe.planID, fe.engineID)
+}
+
+// FakeScheduler keeps the engines in memory. They are ready and reachable as soon as they are deployed, unless
+// NotReady is set. The urls of the engines point to EngineHost, a test server standing in for the engines
+// routes on the last segment of the path. When Completed is set, the engines exited like the jobs of a finished run.
+type FakeScheduler struct {
+	mu sync.Mutex
+	// Returned by every operation when set
+	Err        error
+	EngineHost string
+	NotReady   bool
+	Completed  bool
+	engines    map[int64][]*fakeEngine
+	exposed    map[int64]time.Time
+	tenants    map[string]*model.Tenant
+}
+
+func NewFakeScheduler() *FakeScheduler {
+	return &FakeScheduler{
+		EngineHost: "localhost",
+		engines:    make(map[int64][]*fakeEngine),
+		exposed:    make(map[int64]time.Time),
+		tenants:    make(map[string]*model.Tenant),
+	}
+}
+
+// fail returns the error of the calls taking a context: the one of the context when it's done, Err otherwise
+func (fs *FakeScheduler) fail(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fs.Err
+}
+
+func (fs *FakeScheduler) deploy(projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) {
+	fs.engines[collectionID] = append(fs.engines[collectionID], &fakeEngine{
+		projectID:    projectID,
+		collectionID: collectionID,
+		planID:       planID,
+		engineID:     engineID,
+		image:        containerConfig.Image,
+		createdTime:  time.Now(),
+	})
+}
+
+func (fs *FakeScheduler) DeployEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.fail(ctx); err != nil {
+		return err
+	}
+	fs.deploy(projectID, collectionID, planID, engineID, containerConfig)
+	return nil
+}
+
+func (fs *FakeScheduler) DeployPlan(ctx context.Context, projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.fail(ctx); err != nil {
+		return err
+	}
+	for i := 0; i < replicas; i++ {
+		fs.deploy(projectID, collectionID, planID, i, containerConfig)
+	}
+	return nil
+}
+
+// RenderPlan returns a bare statefulset of the plan, it only carries the name, the replicas and the image
+func (fs *FakeScheduler) RenderPlan(projectID, collectionID, planID int64, replicas int, containerConfig *config.ExecutorContainer) ([]runtime.Object, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return nil, fs.Err
+	}
+	r := int32(replicas)
+	return []runtime.Object{&appsv1.StatefulSet{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "StatefulSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("engine-%d-%d-%d", projectID, collectionID, planID)},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas: &r,
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{{Name: "engine", Image: containerConfig.Image}},
+				},
+			},
+		},
+	}}, nil
+}
+
+func (fs *FakeScheduler) CollectionCompleted(ctx context.Context, collectionID int64) (bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return false, fs.Err
+	}
+	return fs.Completed && len(fs.engines[collectionID]) > 0, nil
+}
+
+func (fs *FakeScheduler) planEngines(collectionID, planID int64) int {
+	n := 0
+	for _, fe := range fs.engines[collectionID] {
+		if fe.planID == planID {
+			n++
+		}
+	}
+	return n
+}
+
+// CollectionStatus does not look the running plans up, the plans are never in progress
+func (fs *FakeScheduler) CollectionStatus(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) (*smodel.CollectionStatus, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return nil, fs.Err
+	}
+	cs := &smodel.CollectionStatus{}
+	for _, ep := range eps {
+		deployed := fs.planEngines(collectionID, ep.PlanID)
+		cs.Plans = append(cs.Plans, &smodel.PlanStatus{
+			PlanID:           ep.PlanID,
+			Engines:          ep.Engines,
+			EnginesDeployed:  deployed,
+			EnginesReachable: !fs.NotReady && deployed == ep.Engines,
+		})
+	}
+	return cs, nil
+}
+
+func (fs *FakeScheduler) FetchEngineUrlsByPlan(ctx context.Context, collectionID, planID int64, opts *smodel.EngineOwnerRef) ([]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.fail(ctx); err != nil {
+		return nil, err
+	}
+	urls := []string{}
+	for i := 0; i < opts.EnginesCount; i++ {
+		fe := &fakeEngine{projectID: opts.ProjectID, collectionID: collectionID, planID: planID, engineID: i}
+		urls = append(urls, fmt.Sprintf("%s/%s", fs.EngineHost, fe.name()))
+	}
+	return urls, nil
+}
+
+func (fs *FakeScheduler) PurgeCollection(ctx context.Context, collectionID int64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.fail(ctx); err != nil {
+		return err
+	}
+	delete(fs.engines, collectionID)
+	return nil
+}
+
+func (fs *FakeScheduler) PurgePlan(ctx context.Context, collectionID, planID int64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.fail(ctx); err != nil {
+		return err
+	}
+	kept := []*fakeEngine{}
+	for _, fe := range fs.engines[collectionID] {
+		if fe.planID != planID {
+			kept = append(kept, fe)
+		}
+	}
+	fs.engines[collectionID] = kept
+	return nil
+}
+
+func (fs *FakeScheduler) ReplaceEngine(ctx context.Context, projectID, collectionID, planID int64, engineID int, containerConfig *config.ExecutorContainer) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.fail(ctx); err != nil {
+		return err
+	}
+	kept := []*fakeEngine{}
+	for _, fe := range fs.engines[collectionID] {
+		if fe.planID != planID || fe.engineID != engineID {
+			kept = append(kept, fe)
+		}
+	}
+	fs.engines[collectionID] = kept
+	fs.deploy(projectID, collectionID, planID, engineID, containerConfig)
+	return nil
+}
+
+func (fs *FakeScheduler) deployedCollections() map[int64]time.Time {
+	collections := make(map[int64]time.Time)
+	for collectionID, engines := range fs.engines {
+		if len(engines) > 0 {
+			collections[collectionID] = engines[0].createdTime
+		}
+	}
+	return collections
+}
+
+func (fs *FakeScheduler) GetDeployedCollections(ctx context.Context) (map[int64]time.Time, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return nil, fs.Err
+	}
+	return fs.deployedCollections(), nil
+}
+
+func (fs *FakeScheduler) GetCollectionResources(ctx context.Context) (map[int64]time.Time, error) {
+	return fs.GetDeployedCollections(ctx)
+}
+
+func (fs *FakeScheduler) GetPodsMetrics(ctx context.Context, collectionID, planID int64) (map[string]apiv1.ResourceList, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return nil, fs.Err
+	}
+	metrics := make(map[string]apiv1.ResourceList)
+	for _, fe := range fs.engines[collectionID] {
+		if fe.planID != planID {
+			continue
+		}
+		metrics[fe.name()] = apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse("0"),
+			apiv1.ResourceMemory: resource.MustParse("0"),
+		}
+	}
+	return metrics, nil
+}
+
+func (fs *FakeScheduler) PodReadyCount(ctx context.Context, collectionID int64) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.NotReady {
+		return 0
+	}
+	return len(fs.engines[collectionID])
+}
+
+func (fs *FakeScheduler) EngineCount(ctx context.Context, collectionID int64) (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.fail(ctx); err != nil {
+		return 0, err
+	}
+	return len(fs.engines[collectionID]), nil
+}
+
+func (fs *FakeScheduler) DownloadPodLog(ctx context.Context, collectionID, planID int64) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return "", fs.Err
+	}
+	if fs.planEngines(collectionID, planID) == 0 {
+		return "", &scheduler.NoResourcesFoundErr{Message: "Cannot find the engines"}
+	}
+	return "", nil
+}
+
+func (fs *FakeScheduler) engineStatus() string {
+	if fs.NotReady {
+		return string(apiv1.PodPending)
+	}
+	return string(apiv1.PodRunning)
+}
+
+func (fs *FakeScheduler) GetCollectionEnginesDetail(ctx context.Context, projectID, collectionID int64) (*smodel.CollectionDetails, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return nil, fs.Err
+	}
+	if len(fs.engines[collectionID]) == 0 {
+		return nil, &scheduler.NoResourcesFoundErr{Message: "Cannot find the engines"}
+	}
+	cd := &smodel.CollectionDetails{IngressIP: fs.EngineHost, Engines: []*smodel.EngineStatus{}}
+	for _, fe := range fs.engines[collectionID] {
+		cd.Engines = append(cd.Engines, &smodel.EngineStatus{
+			Name:        fe.name(),
+			Status:      fs.engineStatus(),
+			CreatedTime: fe.createdTime,
+		})
+	}
+	return cd, nil
+}
+
+func (fs *FakeScheduler) GetEnginesProgress(ctx context.Context, projectID, collectionID int64, eps []*model.ExecutionPlan) ([]*smodel.EngineProgress, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return nil, fs.Err
+	}
+	progress := []*smodel.EngineProgress{}
+	for _, ep := range eps {
+		deployed := fs.planEngines(collectionID, ep.PlanID)
+		for i := 0; i < ep.Engines; i++ {
+			stage := smodel.EnginePending
+			if i < deployed {
+				stage = smodel.EngineReachable
+				if fs.NotReady {
+					stage = smodel.EngineCreated
+				}
+			}
+			progress = append(progress, &smodel.EngineProgress{PlanID: ep.PlanID, EngineID: i, Stage: stage})
+		}
+	}
+	return progress, nil
+}
+
+// GetClusterCapacity reports a cluster with no room left
+func (fs *FakeScheduler) GetClusterCapacity(ctx context.Context) (*smodel.ClusterCapacity, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return nil, fs.Err
+	}
+	engines := 0
+	for _, e := range fs.engines {
+		engines += len(e)
+	}
+	return &smodel.ClusterCapacity{
+		Allocatable: apiv1.ResourceList{},
+		Engines:     engines,
+		Requested:   apiv1.ResourceList{},
+	}, nil
+}
+
+func (fs *FakeScheduler) ProvisionTenant(ctx context.Context, tenant *model.Tenant) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return fs.Err
+	}
+	fs.tenants[tenant.Name] = tenant
+	return nil
+}
+
+func (fs *FakeScheduler) GetDeployedServices(ctx context.Context) (map[int64]time.Time, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return nil, fs.Err
+	}
+	services := make(map[int64]time.Time)
+	for projectID, created := range fs.exposed {
+		services[projectID] = created
+	}
+	return services, nil
+}
+
+func (fs *FakeScheduler) ExposeProject(ctx context.Context, projectID int64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.fail(ctx); err != nil {
+		return err
+	}
+	if _, ok := fs.exposed[projectID]; !ok {
+		fs.exposed[projectID] = time.Now()
+	}
+	return nil
+}
+
+func (fs *FakeScheduler) PurgeProjectIngress(ctx context.Context, projectID int64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return fs.Err
+	}
+	delete(fs.exposed, projectID)
+	return nil
+}
+
+func (fs *FakeScheduler) GetEnginesByProject(ctx context.Context, projectID int64) ([]apiv1.Pod, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.Err != nil {
+		return nil, fs.Err
+	}
+	pods := []apiv1.Pod{}
+	for _, engines := range fs.engines {
+		for _, fe := range engines {
+			if fe.projectID != projectID {
+				continue
+			}
+			pod := apiv1.Pod{}
+			pod.Name = fe.name()
+			pod.Labels = map[string]string{
+				"project":    fmt.Sprintf("%d", fe.projectID),
+				"collection": fmt.Sprintf("%d", fe.collectionID),
+				"plan":       fmt.Sprintf("%d", fe.planID),
+				"kind":       "executor",
+			}
+			pod.Status.Phase = apiv1.PodPhase(fs.engineStatus())
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	return pods, nil
+}
+
+// Images lists the images of the engines deployed for the collection, to check what a launch deployed
+func (fs *FakeScheduler) Images(collectionID int64) []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	images := []string{}
+	for _, fe := range fs.engines[collectionID] {
+		images = append(images, fe.image)
+	}
+	return images
+}
+
+// Tenant is the tenant provisioned with the name, nil when it was not
+func (fs *FakeScheduler) Tenant(name string) *model.Tenant {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.tenants[name]
+}
@@ -0,0 +1,91 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/config"
+	"github.com/hveda/Setagaya/setagaya/model"
+	smodel "github.com/hveda/Setagaya/setagaya/scheduler/model"
+)
+
+func TestFakeScheduler(t *testing.T) {
+	ctx := context.Background()
+	fs := NewFakeScheduler()
+	ec := &config.ExecutorContainer{Image: "setagaya:jmeter"}
+	eps := []*model.ExecutionPlan{{PlanID: 1, Engines: 2}, {PlanID: 2, Engines: 1}}
+
+	assert.NoError(t, fs.DeployPlan(ctx, 1, 10, 1, 2, ec))
+	cs, err := fs.CollectionStatus(ctx, 1, 10, eps)
+	assert.NoError(t, err)
+	assert.True(t, cs.Plans[0].EnginesReachable)
+	assert.False(t, cs.Plans[1].EnginesReachable)
+
+	assert.NoError(t, fs.DeployEngine(ctx, 1, 10, 2, 0, ec))
+	count, err := fs.EngineCount(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, []string{"setagaya:jmeter", "setagaya:jmeter", "setagaya:jmeter"}, fs.Images(10))
+
+	urls, err := fs.FetchEngineUrlsByPlan(ctx, 10, 1, &smodel.EngineOwnerRef{ProjectID: 1, EnginesCount: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"localhost/engine-1-10-1-0", "localhost/engine-1-10-1-1"}, urls)
+
+	progress, err := fs.GetEnginesProgress(ctx, 1, 10, eps)
+	assert.NoError(t, err)
+	assert.Len(t, progress, 3)
+	assert.Equal(t, smodel.EngineReachable, progress[2].Stage)
+
+	pods, err := fs.GetEnginesByProject(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, pods, 3)
+
+	assert.NoError(t, fs.ReplaceEngine(ctx, 1, 10, 1, 1, ec))
+	count, err = fs.EngineCount(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	assert.NoError(t, fs.PurgePlan(ctx, 10, 2))
+	count, err = fs.EngineCount(ctx, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	deployed, err := fs.GetDeployedCollections(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, deployed, int64(10))
+	assert.NoError(t, fs.PurgeCollection(ctx, 10))
+	deployed, err = fs.GetDeployedCollections(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, deployed)
+}
+
+func TestFakeSchedulerNotReady(t *testing.T) {
+	ctx := context.Background()
+	fs := NewFakeScheduler()
+	fs.NotReady = true
+	eps := []*model.ExecutionPlan{{PlanID: 1, Engines: 1}}
+	assert.NoError(t, fs.DeployPlan(ctx, 1, 10, 1, 1, &config.ExecutorContainer{}))
+	cs, err := fs.CollectionStatus(ctx, 1, 10, eps)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cs.Plans[0].EnginesDeployed)
+	assert.False(t, cs.Plans[0].EnginesReachable)
+	assert.Equal(t, 0, fs.PodReadyCount(ctx, 10))
+}
+
+func TestFakeSchedulerErr(t *testing.T) {
+	ctx := context.Background()
+	fs := NewFakeScheduler()
+	fs.Err = errors.New("cluster is down")
+	assert.Equal(t, fs.Err, fs.DeployPlan(ctx, 1, 10, 1, 1, &config.ExecutorContainer{}))
+	assert.Equal(t, fs.Err, fs.ProvisionTenant(ctx, &model.Tenant{Name: "team"}))
+	assert.Nil(t, fs.Tenant("team"))
+	_, err := fs.GetDeployedCollections(ctx)
+	assert.Equal(t, fs.Err, err)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, fs.PurgeCollection(cancelled, 10), context.Canceled)
+}
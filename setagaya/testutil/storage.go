@@ -0,0 +1,82 @@
+package testutil
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+var _ object_storage.StorageInterface = (*MemoryStorage)(nil)
+
+// MemoryStorage keeps the files in memory. Like the other storages, a missing file is a FileNotFound error
+type MemoryStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files: make(map[string][]byte),
+	}
+}
+
+// UseMemoryStorage makes the platform store its files in memory until the returned func is called
+func UseMemoryStorage() (*MemoryStorage, func()) {
+	ms := NewMemoryStorage()
+	previous := object_storage.Client.Storage
+	object_storage.Client.Storage = ms
+	return ms, func() {
+		object_storage.Client.Storage = previous
+	}
+}
+
+func (ms *MemoryStorage) Upload(filename string, content io.ReadCloser) error {
+	defer content.Close()
+	b, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.files[filename] = b
+	return nil
+}
+
+func (ms *MemoryStorage) Delete(filename string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, ok := ms.files[filename]; !ok {
+		return object_storage.FileNotFoundError()
+	}
+	delete(ms.files, filename)
+	return nil
+}
+
+func (ms *MemoryStorage) GetUrl(filename string) string {
+	return fmt.Sprintf("memory://%s", filename)
+}
+
+func (ms *MemoryStorage) Download(filename string) ([]byte, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	b, ok := ms.files[filename]
+	if !ok {
+		return nil, object_storage.FileNotFoundError()
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// Filenames lists the stored files in order
+func (ms *MemoryStorage) Filenames() []string {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	filenames := make([]string, 0, len(ms.files))
+	for filename := range ms.files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	return filenames
+}
@@ -0,0 +1,32 @@
+package testutil
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/hveda/Setagaya/setagaya/object_storage"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ms, restore := UseMemoryStorage()
+	defer restore()
+	storage := object_storage.Client.Storage
+	assert.Equal(t, ms, storage)
+
+	assert.NoError(t, storage.Upload("plan/1/test.jmx", io.NopCloser(bytes.NewReader([]byte("jmx")))))
+	b, err := storage.Download("plan/1/test.jmx")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("jmx"), b)
+	assert.Equal(t, []string{"plan/1/test.jmx"}, ms.Filenames())
+
+	assert.NoError(t, storage.Delete("plan/1/test.jmx"))
+	_, err = storage.Download("plan/1/test.jmx")
+	assert.IsType(t, object_storage.FileNotFound{}, err)
+	assert.Error(t, storage.Delete("plan/1/test.jmx"))
+
+	restore()
+	assert.NotEqual(t, ms, object_storage.Client.Storage)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"path/filepath"
 
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
@@ -21,7 +22,7 @@ type UI struct {
 
 func NewUI() *UI {
 	u := &UI{
-		tmpl: template.Must(template.ParseGlob("/templates/*.html")),
+		tmpl: template.Must(template.ParseGlob(filepath.Join(config.SC.UIDir(), "templates", "*.html"))),
 	}
 	return u
 }
@@ -99,6 +100,7 @@ func (u *UI) logoutHandler(w http.ResponseWriter, r *http.Request, params httpro
 	}
 	delete(session.Values, auth.MLKey)
 	delete(session.Values, auth.AccountKey)
+	delete(session.Values, auth.StepUpKey)
 	if err := session.Save(r, w); err != nil {
 		log.Printf("Error saving session: %v", err)
 	}
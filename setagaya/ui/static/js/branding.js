@@ -0,0 +1,35 @@
+// Shows the branding of the tenant the UI is served for, it's read before the users log in
+(function () {
+  var req = new XMLHttpRequest();
+  req.open('get', '/api/bootstrap');
+  req.responseType = 'json';
+  req.addEventListener('load', function () {
+    var branding = req.response;
+    if (req.status !== 200 || !branding) {
+      return;
+    }
+    document.title = document.title.replace('Setagaya', branding.display_name);
+    document.querySelectorAll('[data-brand-name]').forEach(function (el) {
+      el.textContent = el.textContent.replace('Setagaya', branding.display_name);
+    });
+    if (branding.logo_url) {
+      document.querySelectorAll('[data-brand-logo]').forEach(function (el) {
+        el.src = branding.logo_url;
+        el.alt = branding.display_name;
+        el.style.display = '';
+      });
+    }
+    document.querySelectorAll('[data-brand-support]').forEach(function (el) {
+      branding.support_links.forEach(function (link) {
+        var a = document.createElement('a');
+        a.className = 'p-2';
+        a.href = link.url;
+        a.target = '_blank';
+        a.rel = 'noopener';
+        a.textContent = link.title;
+        el.appendChild(a);
+      });
+    });
+  });
+  req.send();
+})();
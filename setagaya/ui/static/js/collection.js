@@ -30,6 +30,9 @@ var Collection = Vue.component('collection', {
       log_modal_title: '',
       engines_detail: {},
       upload_url: '',
+      engine_progress: {},
+      progress_source: null,
+      heartbeat_sent: 0,
     };
   },
   computed: {
@@ -122,6 +125,23 @@ var Collection = Vue.component('collection', {
       }
       return engine_life_span;
     },
+    deployment_tip: function () {
+      if (this.progress_source === null) {
+        return '';
+      }
+      var stages = _.values(this.engine_progress);
+      var reachable = _.filter(stages, function (stage) {
+        return stage === 'reachable';
+      }).length;
+      var failed = _.filter(stages, function (stage) {
+        return stage === 'failed';
+      }).length;
+      var tip = 'Engines are being deployed: ' + reachable + '/' + stages.length + ' reachable';
+      if (failed > 0) {
+        tip += ', ' + failed + ' failed';
+      }
+      return tip;
+    },
     total_engines: function () {
       var total = 0;
       _.each(this.collection_status.status, function (plan) {
@@ -136,6 +156,7 @@ var Collection = Vue.component('collection', {
   },
   destroyed: function () {
     clearInterval(this.interval);
+    this.stopWatchingDeployment();
   },
   methods: {
     updateCache: function (collection_status) {
@@ -161,12 +182,26 @@ var Collection = Vue.component('collection', {
         function (resp) {
           this.collection_status = resp.body;
           this.updateCache(this.collection_status.status);
+          if (this.triggered) {
+            this.heartbeat();
+          }
         },
         function (resp) {
           alert(resp.body.message);
         }
       );
     },
+    // The open page keeps the attended-only run going, with a heartbeat a minute. The other runs have none to send
+    heartbeat: function () {
+      if (Date.now() - this.heartbeat_sent < 60000) {
+        return;
+      }
+      this.heartbeat_sent = Date.now();
+      this.$http.post('collections/' + this.collection_id + '/heartbeat').then(
+        function (resp) {},
+        function (resp) {}
+      );
+    },
     plan_url: function (plan_id) {
       return '#plans/' + plan_id;
     },
@@ -176,12 +211,35 @@ var Collection = Vue.component('collection', {
         function (resp) {
           this.launched = true;
           this.purged = false;
+          this.watchDeployment();
         },
         function (resp) {
           alert(resp.body.message);
         }
       );
     },
+    watchDeployment: function () {
+      this.stopWatchingDeployment();
+      this.engine_progress = {};
+      var self = this,
+        source = new EventSource('/api/collections/' + this.collection_id + '/deploy/progress');
+      source.addEventListener('progress', function (e) {
+        var engine = JSON.parse(e.data);
+        Vue.set(self.engine_progress, engine.plan_id + '-' + engine.engine_id, engine.stage);
+      });
+      _.each(['done', 'timeout', 'error'], function (event) {
+        source.addEventListener(event, function () {
+          self.stopWatchingDeployment();
+        });
+      });
+      this.progress_source = source;
+    },
+    stopWatchingDeployment: function () {
+      if (this.progress_source !== null) {
+        this.progress_source.close();
+        this.progress_source = null;
+      }
+    },
     trigger: function () {
       this.trigger_in_progress = true;
       var url = 'collections/' + this.collection_id + '/trigger';
@@ -210,6 +268,18 @@ var Collection = Vue.component('collection', {
         }
       );
     },
+    stopPlan: function (e, plan_id) {
+      e.preventDefault();
+      var r = confirm('You are going to stop plan ' + plan_id + ' while the other plans keep running. Continue?');
+      if (!r) return;
+      var url = 'collections/' + this.collection_id + '/plans/' + plan_id + '/stop';
+      this.$http.post(url).then(
+        function (resp) {},
+        function (resp) {
+          alert(resp.body.message);
+        }
+      );
+    },
     purge: function () {
       var url = 'collections/' + this.collection_id + '/purge';
       this.purge_in_progress = true;
@@ -300,6 +370,13 @@ var Collection = Vue.component('collection', {
         progress = Math.min(100, (delta / duration) * 100); // we can have overflow
       return progress.toFixed(0) + '%';
     },
+    planPhase: function (plan) {
+      if (!this.planStarted(plan)) {
+        return '';
+      }
+      var phase = this.cache[plan.plan_id].phase;
+      return phase ? phase.replace('_', ' ') : '';
+    },
     runningProgressStyle: function (plan) {
       var p = this.runningProgress(plan);
       return {
@@ -5,6 +5,7 @@ import (
 	"encoding/csv"
 	"errors"
 	"log"
+	"math/rand/v2"
 )
 
 func calCSVRange(totalRows, totalSplits, currentSplit int) (int, int) {
@@ -50,3 +51,23 @@ func SplitCSV(file []byte, totalSplits, currentSplit int) ([]byte, error) {
 	}
 	return buf.Bytes(), nil
 }
+
+// ShuffleCSV reorders the records of the csv randomly, the same way for the same seed
+func ShuffleCSV(file []byte, seed int64) ([]byte, error) {
+	csvReader := csv.NewReader(bytes.NewReader(file))
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	r := rand.New(rand.NewPCG(uint64(seed), 0))
+	r.Shuffle(len(records), func(i, j int) {
+		records[i], records[j] = records[j], records[i]
+	})
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
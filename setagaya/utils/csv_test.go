@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"testing"
 
@@ -333,3 +334,25 @@ func TestSplitCSVEdgeCases(t *testing.T) {
 		assert.InDelta(t, expectedLines, resultLines, 50) // Allow some variance
 	})
 }
+
+func TestShuffleCSV(t *testing.T) {
+	file := []byte("1,a\n2,b\n3,c\n4,d\n5,e\n6,f\n7,g\n8,h\n")
+	shuffled, err := ShuffleCSV(file, 42)
+	assert.NoError(t, err)
+	again, err := ShuffleCSV(file, 42)
+	assert.NoError(t, err)
+	assert.Equal(t, shuffled, again)
+	assert.NotEqual(t, file, shuffled)
+
+	other, err := ShuffleCSV(file, 43)
+	assert.NoError(t, err)
+	assert.NotEqual(t, shuffled, other)
+
+	// The records are kept, only their order changes
+	lines := strings.Split(strings.TrimSpace(string(shuffled)), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, strings.Split(strings.TrimSpace(string(file)), "\n"), lines)
+
+	_, err = ShuffleCSV([]byte("a,\"b\n"), 42)
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"runtime"
 	"time"
@@ -12,6 +13,19 @@ const RETRY_LIMIT int = 5
 const RETRY_INTERVAL int = 10
 
 func Retry(attempt func() error, exempt error) error {
+	return retry(context.Background(), attempt, exempt)
+}
+
+// RetryContext is Retry stopping when ctx is cancelled or its deadline is reached. It returns the last error of the
+// attempts then, the error of ctx when there was no attempt.
+func RetryContext(ctx context.Context, attempt func() error, exempt error) error {
+	return retry(ctx, attempt, exempt)
+}
+
+func retry(ctx context.Context, attempt func() error, exempt error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	var err error
 	for i := 0; i < RETRY_LIMIT; i++ {
 		err = attempt()
@@ -21,12 +35,18 @@ func Retry(attempt func() error, exempt error) error {
 		if errors.Is(err, exempt) {
 			return err
 		}
-		pc, file, line, ok := runtime.Caller(1)
+		pc, file, line, ok := runtime.Caller(2)
 		if ok {
 			log.Errorf("%s Called from %s, line #%d, func: %v", err,
 				file, line, runtime.FuncForPC(pc).Name())
 		}
-		time.Sleep(time.Duration(RETRY_INTERVAL) * time.Second)
+		timer := time.NewTimer(time.Duration(RETRY_INTERVAL) * time.Second)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
 	}
 	return err
 }
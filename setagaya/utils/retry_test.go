@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
@@ -259,3 +260,29 @@ func TestRetryRuntimeCaller(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 2, attempts)
 }
+
+func TestRetryContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	failure := errors.New("engine is not up yet")
+
+	// The retries stop when the context is cancelled, with the error of the last attempt
+	attempts := 0
+	start := time.Now()
+	err := RetryContext(ctx, func() error {
+		attempts++
+		cancel()
+		return failure
+	}, nil)
+	assert.Equal(t, failure, err)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), time.Duration(RETRY_INTERVAL)*time.Second)
+
+	// Nothing is attempted once it's cancelled
+	attempts = 0
+	err = RetryContext(ctx, func() error {
+		attempts++
+		return nil
+	}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, attempts)
+}
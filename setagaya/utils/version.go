@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseVersion reads the major, minor and patch numbers of a version like v1.2.3 or 1.2. The numbers left out are 0
+// and the suffix of a pre-release or a build, like -rc.1 or +abcdef, is ignored.
+func ParseVersion(v string) ([3]int, error) {
+	var r [3]int
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if s == "" || len(parts) > 3 {
+		return r, fmt.Errorf("invalid version %q", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return r, fmt.Errorf("invalid version %q", v)
+		}
+		r[i] = n
+	}
+	return r, nil
+}
+
+// CompareVersions returns -1, 0 or 1 when the version a is older than, the same as or newer than b
+func CompareVersions(a, b string) (int, error) {
+	va, err := ParseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := ParseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va {
+		switch {
+		case va[i] < vb[i]:
+			return -1, nil
+		case va[i] > vb[i]:
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
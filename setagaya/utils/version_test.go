@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	testCases := []struct {
+		version  string
+		expected [3]int
+	}{
+		{"v1.2.3", [3]int{1, 2, 3}},
+		{"1.2.3", [3]int{1, 2, 3}},
+		{"5.6", [3]int{5, 6, 0}},
+		{"v2", [3]int{2, 0, 0}},
+		{"v1.4.0-rc.1", [3]int{1, 4, 0}},
+		{"1.4.2+abcdef", [3]int{1, 4, 2}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			v, err := ParseVersion(tc.version)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, v)
+		})
+	}
+	for _, invalid := range []string{"", "dev", "v", "1.2.3.4", "1.x", "1.-2"} {
+		_, err := ParseVersion(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	c, err := CompareVersions("v1.2.3", "1.2.3")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, c)
+
+	c, err = CompareVersions("v1.2.3", "v1.10.0")
+	assert.NoError(t, err)
+	assert.Equal(t, -1, c)
+
+	c, err = CompareVersions("v2.0", "v1.10.9")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, c)
+
+	_, err = CompareVersions("dev", "v1.0.0")
+	assert.Error(t, err)
+}